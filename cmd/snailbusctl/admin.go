@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"snailbus/internal/anonymize"
+	"snailbus/internal/bundle"
+	"snailbus/internal/demo"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/models"
+	"snailbus/internal/secretbox"
+	"snailbus/internal/storage"
+)
+
+// databaseCommand runs a subcommand that has no API counterpart against the database
+type databaseCommand func(*storage.PostgresStorage, []string) (interface{}, error)
+
+// databaseCommands maps the commands that always need the database to their
+// implementation, by their full name
+var databaseCommands = map[string]databaseCommand{
+	"orgs create":              createOrg,
+	"users grant-system-admin": grantSystemAdmin,
+	"seed":                     seed,
+	"import-bundle":            importBundle,
+	"anonymize":                anonymizeDatabase,
+	"reencrypt-secrets":        reencryptSecrets,
+}
+
+// openDatabase connects to a database
+// When SECRETS_KEY_FILE is set, secrets are encrypted with its keys as by the server.
+func openDatabase(url string) (*storage.PostgresStorage, error) {
+	store, err := storage.NewPostgresStorage(url)
+	if err != nil {
+		return nil, err
+	}
+	if keyFile := os.Getenv("SECRETS_KEY_FILE"); keyFile != "" {
+		keys, err := secretbox.LoadKeyFile(keyFile)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		store.EnableSecretEncryption(secretbox.New(keys))
+	}
+	return store, nil
+}
+
+// createOrg creates a new organization
+func createOrg(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("orgs create", flag.ExitOnError)
+	name := fs.String("name", "", "Organization name (required)")
+	fs.Parse(args)
+
+	req := models.CreateOrganizationRequest{Name: *name}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fmt.Errorf("invalid organization: %w", err)
+	}
+
+	// The name is checked by the database, so a concurrent create cannot claim it too
+	org, err := store.CreateOrganization(req.Name)
+	if errors.Is(err, storage.ErrOrgNameTaken) {
+		return nil, fmt.Errorf("organization %q already exists", req.Name)
+	}
+	return org, err
+}
+
+// grantSystemAdmin sets or clears a user's system administrator flag
+func grantSystemAdmin(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("users grant-system-admin", flag.ExitOnError)
+	username := fs.String("username", "", "Username (required)")
+	revoke := fs.Bool("revoke", false, "Revoke system administrator access instead of granting it")
+	fs.Parse(args)
+
+	if *username == "" {
+		return nil, errors.New("-username is required")
+	}
+	user, err := (&databaseBackend{store: store}).user(*username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.SetUserSystemAdmin(user.ID, !*revoke); err != nil {
+		return nil, err
+	}
+	user.IsAdmin = !*revoke
+	return user, nil
+}
+
+// seed creates the demo organization, users, and hosts
+func seed(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	orgName := fs.String("org", demo.DefaultOrgName, "Demo organization name")
+	password := fs.String("password", os.Getenv("SNAILBUS_USER_PASSWORD"), "Password of the demo users (defaults to $SNAILBUS_USER_PASSWORD, then "+demo.DefaultPassword+")")
+	hosts := fs.Int("hosts", demo.DefaultHosts, fmt.Sprintf("Number of synthetic hosts (at most %d)", demo.MaxHosts))
+	fs.Parse(args)
+
+	if *password != "" && len(*password) < 8 {
+		return nil, errors.New("password must be at least 8 characters")
+	}
+	if *hosts < 1 {
+		return nil, errors.New("-hosts must be positive")
+	}
+
+	return demo.Seed(store, demo.Options{OrgName: *orgName, Password: *password, Hosts: *hosts})
+}
+
+// importBundle imports an offline bundle into an organization, attributed to one of its users
+func importBundle(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	org := orgFlags(fs)
+	username := fs.String("username", "", "User the imported reports are attributed to (required)")
+	file := fs.String("file", "", "Bundle file, a tar archive optionally gzip-compressed (required)")
+	fs.Parse(args)
+
+	if *username == "" {
+		return nil, errors.New("-username is required")
+	}
+	if *file == "" {
+		return nil, errors.New("-file is required")
+	}
+
+	keys, err := bundle.ParseKeys(splitList(os.Getenv("BUNDLE_TRUSTED_KEYS")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUNDLE_TRUSTED_KEYS: %w", err)
+	}
+	if keys.Len() == 0 {
+		return nil, errors.New("BUNDLE_TRUSTED_KEYS must list the public keys bundles are signed with")
+	}
+
+	organization, err := resolveOrganization(store, *org)
+	if err != nil {
+		return nil, err
+	}
+	user, _, err := store.GetUserByUsername(*username)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && user.OrgID != organization.ID) {
+		return nil, fmt.Errorf("user %q not found in organization", *username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := bundle.Read(f, keys, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := bundle.NewImporter(store, jsonlimit.DefaultLimits()).Import(b, organization.ID, user.ID, models.ImportSourceCLI)
+	if errors.Is(err, storage.ErrBundleAlreadyImported) {
+		return nil, fmt.Errorf("bundle %s has already been imported", b.SHA256)
+	}
+	return batch, err
+}
+
+// anonymizeDatabase pseudonymizes the personal data in a copy of the database
+func anonymizeDatabase(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("anonymize", flag.ExitOnError)
+	confirm := fs.String("confirm", "", "Name of the database to anonymize, to confirm it is the copy (required)")
+	key := fs.String("key", os.Getenv("SNAILBUS_ANONYMIZE_KEY"), "Key the pseudonyms are derived from, so runs over refreshed copies agree (defaults to $SNAILBUS_ANONYMIZE_KEY, then a random key)")
+	password := fs.String("password", os.Getenv("SNAILBUS_USER_PASSWORD"), "Password set for every user (defaults to $SNAILBUS_USER_PASSWORD, then a random one)")
+	fs.Parse(args)
+
+	if *password != "" && len(*password) < 8 {
+		return nil, errors.New("password must be at least 8 characters")
+	}
+
+	var database string
+	if err := store.DB().QueryRow(`SELECT current_database()`).Scan(&database); err != nil {
+		return nil, fmt.Errorf("failed to get database name: %w", err)
+	}
+	if *confirm != database {
+		return nil, fmt.Errorf("this rewrites every row of database %q; pass -confirm %s to proceed", database, database)
+	}
+
+	pseudonymKey := []byte(*key)
+	if len(pseudonymKey) == 0 {
+		pseudonymKey = make([]byte, 32)
+		if _, err := rand.Read(pseudonymKey); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+	return anonymize.Anonymize(context.Background(), store.DB(), anonymize.Options{Key: pseudonymKey, Password: *password})
+}
+
+// reencryptSecrets seals stored secrets with the primary key from SECRETS_KEY_FILE
+func reencryptSecrets(store *storage.PostgresStorage, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("reencrypt-secrets", flag.ExitOnError)
+	fs.Parse(args)
+
+	if os.Getenv("SECRETS_KEY_FILE") == "" {
+		return nil, errors.New("SECRETS_KEY_FILE is required")
+	}
+	counts, err := store.ReencryptSecrets(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"resealed": counts}, nil
+}
+
+// splitList splits a comma-separated value, trimming whitespace and dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
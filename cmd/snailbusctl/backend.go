@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+	"snailbus/internal/storage"
+)
+
+// orgRef names the organization a command acts on by name or ID
+type orgRef struct {
+	Name string
+	ID   string
+}
+
+func (o orgRef) set() bool {
+	return o.Name != "" || o.ID != ""
+}
+
+// hostFilter selects the hosts listed, as the q, status, and include_archived
+// parameters of GET /api/v1/hosts
+type hostFilter struct {
+	Query           string
+	Status          string
+	IncludeArchived bool
+}
+
+// backend carries out commands either against the database or through a server's API
+// Requests are validated by the commands before they reach a backend.
+type backend interface {
+	ListUsers(org orgRef) ([]*models.User, error)
+	CreateUser(org orgRef, req models.CreateUserRequest) (*models.User, error)
+	DeleteUser(org orgRef, username string) error
+
+	ListAPIKeys(username string) ([]*models.APIKey, error)
+	CreateAPIKey(username string, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error)
+	DeleteAPIKey(username, keyID string) error
+
+	ListHosts(org orgRef, filter hostFilter) ([]*models.HostSummary, error)
+}
+
+// databaseBackend runs commands directly against the database
+// Unlike the API it is not scoped by a caller, so commands name the organization or
+// user they act on.
+type databaseBackend struct {
+	store storage.Storage
+}
+
+func (d *databaseBackend) ListUsers(org orgRef) ([]*models.User, error) {
+	organization, err := resolveOrganization(d.store, org)
+	if err != nil {
+		return nil, err
+	}
+	return d.store.ListUsersByOrganization(organization.ID)
+}
+
+func (d *databaseBackend) CreateUser(org orgRef, req models.CreateUserRequest) (*models.User, error) {
+	organization, err := resolveOrganization(d.store, org)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := d.store.GetUserByUsername(req.Username); err == nil {
+		return nil, fmt.Errorf("username %q already exists", req.Username)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check username: %w", err)
+	}
+	if _, err := d.store.GetUserByEmail(req.Email); err == nil {
+		return nil, fmt.Errorf("email %q already exists", req.Email)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	return d.store.CreateUser(req.Username, req.Email, passwordHash, organization.ID, req.Role)
+}
+
+func (d *databaseBackend) DeleteUser(org orgRef, username string) error {
+	organization, err := resolveOrganization(d.store, org)
+	if err != nil {
+		return err
+	}
+	user, err := d.user(username)
+	if err != nil {
+		return err
+	}
+	if user.OrgID != organization.ID {
+		return fmt.Errorf("user %q not found in organization", username)
+	}
+
+	err = d.store.DeleteUser(user.ID, 0)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("user %q not found", username)
+	}
+	return err
+}
+
+func (d *databaseBackend) ListAPIKeys(username string) ([]*models.APIKey, error) {
+	user, err := d.user(username)
+	if err != nil {
+		return nil, err
+	}
+	return d.store.GetAPIKeysByUserID(user.ID)
+}
+
+func (d *databaseBackend) CreateAPIKey(username string, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	user, err := d.user(username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restrict the key in the same transaction, so an unrestricted key is never left behind
+	var plainKey string
+	var apiKey *models.APIKey
+	err = d.store.WithTx(func(tx storage.Storage) error {
+		if plainKey, apiKey, err = storage.GenerateAPIKey(tx, user.ID, req.Name, req.ExpiresAt); err != nil {
+			return err
+		}
+		if len(req.AllowedEndpoints) > 0 {
+			return tx.SetAPIKeyAllowedEndpoints(apiKey.ID, req.AllowedEndpoints)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{
+		ID:               apiKey.ID,
+		Key:              plainKey,
+		Name:             apiKey.Name,
+		ExpiresAt:        apiKey.ExpiresAt,
+		CreatedAt:        apiKey.CreatedAt,
+		AllowedEndpoints: req.AllowedEndpoints,
+	}, nil
+}
+
+func (d *databaseBackend) DeleteAPIKey(username, keyID string) error {
+	// Only delete a key of the named user, so a mistyped ID can't remove someone else's
+	keys, err := d.ListAPIKeys(username)
+	if err != nil {
+		return err
+	}
+	if findAPIKey(keys, keyID) == nil {
+		return fmt.Errorf("API key %s not found for user %q", keyID, username)
+	}
+
+	err = d.store.DeleteAPIKey(keyID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("API key %s not found", keyID)
+	}
+	return err
+}
+
+func (d *databaseBackend) ListHosts(org orgRef, filter hostFilter) ([]*models.HostSummary, error) {
+	organization, err := resolveOrganization(d.store, org)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the query as GET /api/v1/hosts does
+	var query *search.Query
+	if filter.Query != "" {
+		if query, err = search.Parse(filter.Query); err != nil {
+			return nil, fmt.Errorf("invalid search query: %w", err)
+		}
+	}
+	if filter.Status != "" {
+		term, err := search.StatusTerm(filter.Status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status: %w", err)
+		}
+		if query == nil {
+			query = &search.Query{}
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	if query != nil {
+		return d.store.SearchHosts(organization.ID, query, filter.IncludeArchived)
+	}
+	return d.store.ListHosts(organization.ID, filter.IncludeArchived)
+}
+
+// user looks up a user by username
+func (d *databaseBackend) user(username string) (*models.User, error) {
+	user, _, err := d.store.GetUserByUsername(username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("user %q not found", username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// resolveOrganization looks up an organization by ID or name
+func resolveOrganization(store storage.Storage, org orgRef) (*models.Organization, error) {
+	var organization *models.Organization
+	var err error
+	switch {
+	case org.ID != "":
+		organization, err = store.GetOrganizationByID(org.ID)
+	case org.Name != "":
+		organization, err = store.GetOrganizationByName(org.Name)
+	default:
+		return nil, errors.New("-org or -org-id is required")
+	}
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, errors.New("organization not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return organization, nil
+}
+
+// findAPIKey returns the key with the given ID, or nil
+func findAPIKey(keys []*models.APIKey, keyID string) *models.APIKey {
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key
+		}
+	}
+	return nil
+}
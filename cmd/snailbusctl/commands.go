@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+)
+
+// orgFlags adds the flags naming an organization to a command
+func orgFlags(fs *flag.FlagSet) *orgRef {
+	org := &orgRef{}
+	fs.StringVar(&org.Name, "org", "", "Organization name (required against the database unless -org-id is set)")
+	fs.StringVar(&org.ID, "org-id", "", "Organization ID")
+	return org
+}
+
+// usernameFlag adds the flag naming the user whose API keys a command acts on
+func usernameFlag(fs *flag.FlagSet) *string {
+	return fs.String("username", "", "User that owns the keys (required against the database)")
+}
+
+// listUsers lists the users of an organization
+func listUsers(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("users list", flag.ExitOnError)
+	org := orgFlags(fs)
+	fs.Parse(args)
+
+	users, err := b.ListUsers(*org)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"users": users, "total": len(users)}, nil
+}
+
+// createUser creates a user with a role in an organization
+func createUser(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("users create", flag.ExitOnError)
+	org := orgFlags(fs)
+	username := fs.String("username", "", "Username (required)")
+	email := fs.String("email", "", "Email address (required)")
+	password := fs.String("password", os.Getenv("SNAILBUS_USER_PASSWORD"), "Password (defaults to $SNAILBUS_USER_PASSWORD)")
+	role := fs.String("role", "viewer", "Role: admin, editor, or viewer")
+	fs.Parse(args)
+
+	// Validate with the same rules as POST /api/v1/users
+	req := models.CreateUserRequest{
+		Username: *username,
+		Email:    *email,
+		Password: *password,
+		Role:     *role,
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fmt.Errorf("invalid user: %w", err)
+	}
+	if err := auth.ValidateRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	user, err := b.CreateUser(*org, req)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// deleteUser deletes a user of an organization
+func deleteUser(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("users delete", flag.ExitOnError)
+	org := orgFlags(fs)
+	username := fs.String("username", "", "Username (required)")
+	fs.Parse(args)
+
+	if *username == "" {
+		return nil, errors.New("-username is required")
+	}
+	if err := b.DeleteUser(*org, *username); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"deleted": *username}, nil
+}
+
+// listAPIKeys lists a user's API keys
+func listAPIKeys(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("api-keys list", flag.ExitOnError)
+	username := usernameFlag(fs)
+	fs.Parse(args)
+
+	keys, err := b.ListAPIKeys(*username)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"api_keys": keys, "total": len(keys)}, nil
+}
+
+// createAPIKey creates an API key for a user and prints the plain key once
+func createAPIKey(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("api-keys create", flag.ExitOnError)
+	username := usernameFlag(fs)
+	name := fs.String("name", "", "Descriptive key name (required)")
+	expiresIn := fs.Duration("expires-in", 0, "Key lifetime, e.g. 720h (default: never expires)")
+	allowed := fs.String("allowed-endpoints", "", `Comma-separated endpoint patterns the key is restricted to, e.g. "POST /api/v1/ingest"`)
+	fs.Parse(args)
+
+	req := models.CreateAPIKeyRequest{Name: *name}
+	if *expiresIn > 0 {
+		expiresAt := time.Now().Add(*expiresIn).UTC()
+		req.ExpiresAt = &expiresAt
+	}
+	req.AllowedEndpoints = splitList(*allowed)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fmt.Errorf("invalid API key: %w", err)
+	}
+	if _, err := auth.CompileEndpoints(req.AllowedEndpoints); err != nil {
+		return nil, err
+	}
+
+	created, err := b.CreateAPIKey(*username, req)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// rotateAPIKey replaces an API key with a new one and deletes the old key
+// The new key keeps the old one's name and endpoint restrictions, and its lifetime unless
+// -expires-in sets another. The new key is printed even if the old one can't be deleted.
+func rotateAPIKey(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("api-keys rotate", flag.ExitOnError)
+	username := usernameFlag(fs)
+	keyID := fs.String("id", "", "ID of the key to rotate (required)")
+	expiresIn := fs.Duration("expires-in", 0, "Lifetime of the new key, e.g. 720h (default: that of the old key)")
+	fs.Parse(args)
+
+	if *keyID == "" {
+		return nil, errors.New("-id is required")
+	}
+
+	keys, err := b.ListAPIKeys(*username)
+	if err != nil {
+		return nil, err
+	}
+	old := findAPIKey(keys, *keyID)
+	if old == nil {
+		return nil, fmt.Errorf("API key %s not found", *keyID)
+	}
+
+	req := models.CreateAPIKeyRequest{Name: old.Name, AllowedEndpoints: old.AllowedEndpoints}
+	lifetime := *expiresIn
+	if lifetime == 0 && old.ExpiresAt != nil {
+		lifetime = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+	if lifetime > 0 {
+		expiresAt := time.Now().Add(lifetime).UTC()
+		req.ExpiresAt = &expiresAt
+	}
+
+	created, err := b.CreateAPIKey(*username, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.DeleteAPIKey(*username, old.ID); err != nil {
+		return created, fmt.Errorf("created API key %s but failed to delete API key %s: %w", created.ID, old.ID, err)
+	}
+	return map[string]interface{}{"api_key": created, "deleted": old.ID}, nil
+}
+
+// deleteAPIKey deletes one of a user's API keys
+func deleteAPIKey(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("api-keys delete", flag.ExitOnError)
+	username := usernameFlag(fs)
+	keyID := fs.String("id", "", "ID of the key to delete (required)")
+	fs.Parse(args)
+
+	if *keyID == "" {
+		return nil, errors.New("-id is required")
+	}
+	if err := b.DeleteAPIKey(*username, *keyID); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"deleted": *keyID}, nil
+}
+
+// listHosts lists or searches the hosts of an organization
+func listHosts(b backend, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("hosts list", flag.ExitOnError)
+	org := orgFlags(fs)
+	var filter hostFilter
+	fs.StringVar(&filter.Query, "q", "", `Search query, as the q parameter of GET /api/v1/hosts, e.g. "os:fedora tag:env:prod"`)
+	fs.StringVar(&filter.Status, "status", "", "Host status, active or stale; commas separate alternatives")
+	fs.BoolVar(&filter.IncludeArchived, "include-archived", false, "Include archived hosts")
+	fs.Parse(args)
+
+	hosts, err := b.ListHosts(*org, filter)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"hosts": hosts, "total": len(hosts)}, nil
+}
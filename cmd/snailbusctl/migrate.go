@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/migrations"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// migrateResult is the output of migrate up
+type migrateResult struct {
+	PreviousVersion   uint `json:"previous_version"`
+	Version           uint `json:"version"`
+	RecordedChecksums int  `json:"recorded_checksums"`
+
+	ResealedSecrets map[string]int `json:"resealed_secrets,omitempty"`
+}
+
+// bootstrapResult is the output of bootstrap
+// Organization and APIKey are only set when the admin user was created.
+type bootstrapResult struct {
+	Created      bool                         `json:"created"`
+	Migrations   *migrateResult               `json:"migrations"`
+	Organization *models.Organization         `json:"organization,omitempty"`
+	User         *models.User                 `json:"user"`
+	APIKey       *models.CreateAPIKeyResponse `json:"api_key,omitempty"`
+}
+
+// migrationFlags adds the flags choosing the database and files migrations run with
+// DATABASE_MIGRATION_URL is used when set, as by the server.
+func migrationFlags(fs *flag.FlagSet) (url, source *string) {
+	url = fs.String("database-url", getEnv("DATABASE_MIGRATION_URL", databaseURL()), "Database migrations run against (defaults to $DATABASE_MIGRATION_URL, then $DATABASE_URL)")
+	source = fs.String("path", getEnv("MIGRATIONS_PATH", "file://migrations"), "Migration source (defaults to $MIGRATIONS_PATH)")
+	return url, source
+}
+
+// migrateUp applies pending migrations
+func migrateUp(args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("migrate up", flag.ExitOnError)
+	url, source := migrationFlags(fs)
+	fs.Parse(args)
+
+	result, err := runMigrations(*url, *source)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// migrateStatus prints the schema version and pending migrations without applying them
+func migrateStatus(args []string) error {
+	fs := flag.NewFlagSet("migrate status", flag.ExitOnError)
+	url, source := migrationFlags(fs)
+	fs.Parse(args)
+
+	files, err := migrations.Load(*source)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", *url)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	state, err := migrations.ReadState(db)
+	if err != nil {
+		return err
+	}
+	return migrations.WritePlan(os.Stdout, files, state)
+}
+
+// runMigrations applies pending migrations as the server does at startup
+// Applied migrations are checked against their files first, and the checksums of newly
+// applied ones are recorded. When SECRETS_KEY_FILE is set, stored secrets still in
+// plaintext or under an older key are then sealed with its primary key, as the server
+// does at startup.
+func runMigrations(databaseURL, source string) (*migrateResult, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database for migrations: %w", err)
+	}
+	defer db.Close()
+
+	// Verify applied migrations before changing anything
+	files, err := migrations.Load(source)
+	if errors.Is(err, migrations.ErrUnsupportedSource) {
+		fmt.Fprintf(os.Stderr, "warning: migration checksums are not verified for %s\n", source)
+		files = nil
+	} else if err != nil {
+		return nil, err
+	}
+	var before *migrations.State
+	if files != nil {
+		if before, err = migrations.ReadState(db); err != nil {
+			return nil, err
+		}
+		if err := migrations.Verify(files, before); err != nil {
+			return nil, err
+		}
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance(source, "postgres", driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+
+	result := &migrateResult{}
+	if result.PreviousVersion, err = schemaVersion(m); err != nil {
+		return nil, err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	if result.Version, err = schemaVersion(m); err != nil {
+		return nil, err
+	}
+
+	if files != nil && result.Version > 0 {
+		if result.RecordedChecksums, err = migrations.RecordChecksums(db, files, before, result.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Getenv("SECRETS_KEY_FILE") != "" {
+		store, err := openDatabase(databaseURL)
+		if err != nil {
+			return result, err
+		}
+		defer store.Close()
+		if result.ResealedSecrets, err = store.ReencryptSecrets(context.Background()); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// schemaVersion returns the last applied migration, or 0 for a database without any
+func schemaVersion(m *migrate.Migrate) (uint, error) {
+	version, _, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// bootstrap runs migrations and creates the first organization, admin user, and API key
+// It is safe to run on every deployment: once the admin user exists it only migrates.
+func bootstrap(args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	migrationURL, source := migrationFlags(fs)
+	username := fs.String("username", getEnv("ADMIN_USERNAME", "admin"), "Admin username (defaults to $ADMIN_USERNAME)")
+	password := fs.String("password", getEnv("ADMIN_PASSWORD", "change me"), "Admin password (defaults to $ADMIN_PASSWORD)")
+	email := fs.String("email", getEnv("ADMIN_EMAIL", "admin@localhost"), "Admin email (defaults to $ADMIN_EMAIL)")
+	orgName := fs.String("org", getEnv("ADMIN_ORG_NAME", "Default Organization"), "Organization name (defaults to $ADMIN_ORG_NAME)")
+	fs.Parse(args)
+
+	migrated, err := runMigrations(*migrationURL, *source)
+	if err != nil {
+		return nil, err
+	}
+	result := &bootstrapResult{Migrations: migrated}
+
+	store, err := storage.NewPostgresStorage(databaseURL())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	if user, _, err := store.GetUserByUsername(*username); err == nil {
+		result.User = user
+		return result, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check for existing user: %w", err)
+	}
+
+	passwordHash, err := auth.HashPassword(*password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the organization, admin user, and key together: a bootstrap that fails part
+	// way leaves nothing behind, where the next run would find the admin and skip its key
+	err = store.WithTx(func(tx storage.Storage) error {
+		// Reuse the organization only while it is empty, so bootstrap can't add an admin to a live one
+		org, err := tx.GetOrganizationByName(*orgName)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			if org, err = tx.CreateOrganization(*orgName); err != nil {
+				return fmt.Errorf("failed to create organization: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to get organization: %w", err)
+		default:
+			count, err := tx.CountUsersInOrganization(org.ID)
+			if err != nil {
+				return fmt.Errorf("failed to count users in organization: %w", err)
+			}
+			if count > 0 {
+				return fmt.Errorf("organization %q already has users; cannot create the admin user in it", *orgName)
+			}
+		}
+
+		user, err := tx.CreateUser(*username, *email, passwordHash, org.ID, "admin")
+		if err != nil {
+			return fmt.Errorf("failed to create admin user: %w", err)
+		}
+		plainKey, apiKey, err := storage.GenerateAPIKey(tx, user.ID, "Initial Admin API Key", nil)
+		if err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+
+		result.Organization = org
+		result.User = user
+		result.APIKey = &models.CreateAPIKeyResponse{
+			ID:        apiKey.ID,
+			Key:       plainKey,
+			Name:      apiKey.Name,
+			CreatedAt: apiKey.CreatedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Created = true
+	return result, nil
+}
+
+// getEnv returns an environment variable or a default when it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+// serverBackend runs commands through the API of a running server
+// The API scopes every request to the API key's organization, and API key requests to
+// its user, so commands may not name another organization or user.
+type serverBackend struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func newServerBackend(baseURL, apiKey string) *serverBackend {
+	return &serverBackend{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+var (
+	errServerOrg  = errors.New("-org and -org-id are not accepted with -server; commands act on the API key's organization")
+	errServerUser = errors.New("-username is not accepted with -server; API key commands act on the API key's own user")
+)
+
+func (s *serverBackend) ListUsers(org orgRef) ([]*models.User, error) {
+	if org.set() {
+		return nil, errServerOrg
+	}
+	var response struct {
+		Users []*models.User `json:"users"`
+	}
+	if err := s.do(http.MethodGet, "/api/v1/users", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Users, nil
+}
+
+func (s *serverBackend) CreateUser(org orgRef, req models.CreateUserRequest) (*models.User, error) {
+	if org.set() {
+		return nil, errServerOrg
+	}
+	var user models.User
+	if err := s.do(http.MethodPost, "/api/v1/users", req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *serverBackend) DeleteUser(org orgRef, username string) error {
+	users, err := s.ListUsers(org)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Username == username {
+			return s.do(http.MethodDelete, "/api/v1/users/"+url.PathEscape(user.ID), nil, nil)
+		}
+	}
+	return fmt.Errorf("user %q not found in organization", username)
+}
+
+func (s *serverBackend) ListAPIKeys(username string) ([]*models.APIKey, error) {
+	if username != "" {
+		return nil, errServerUser
+	}
+	var response struct {
+		APIKeys []*models.APIKey `json:"api_keys"`
+	}
+	if err := s.do(http.MethodGet, "/api/v1/api-keys", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.APIKeys, nil
+}
+
+func (s *serverBackend) CreateAPIKey(username string, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	if username != "" {
+		return nil, errServerUser
+	}
+	var created models.CreateAPIKeyResponse
+	if err := s.do(http.MethodPost, "/api/v1/api-keys", req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *serverBackend) DeleteAPIKey(username, keyID string) error {
+	if username != "" {
+		return errServerUser
+	}
+	return s.do(http.MethodDelete, "/api/v1/api-keys/"+url.PathEscape(keyID), nil, nil)
+}
+
+func (s *serverBackend) ListHosts(org orgRef, filter hostFilter) ([]*models.HostSummary, error) {
+	if org.set() {
+		return nil, errServerOrg
+	}
+	params := url.Values{}
+	if filter.Query != "" {
+		params.Set("q", filter.Query)
+	}
+	if filter.Status != "" {
+		params.Set("status", filter.Status)
+	}
+	if filter.IncludeArchived {
+		params.Set("include_archived", "true")
+	}
+	path := "/api/v1/hosts"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	var response struct {
+		Hosts []*models.HostSummary `json:"hosts"`
+	}
+	if err := s.do(http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Hosts, nil
+}
+
+// do sends a request to the server and decodes a successful response into out
+// Error responses are returned with the server's error and message.
+func (s *serverBackend) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, s.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", s.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+		switch {
+		case apiErr.Error == "":
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		case apiErr.Message != "":
+			return fmt.Errorf("%s %s: %s: %s", method, path, apiErr.Error, apiErr.Message)
+		default:
+			return fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package docs
+
+import "embed"
+
+// generated holds swagger.json and swagger.yaml as written by `make swag` (swag init),
+// so the server serves the spec it was built with from any working directory. The
+// pattern also matches this package's Go files, which lets it build before the spec
+// has been generated.
+//
+//go:embed *
+var generated embed.FS
+
+// SwaggerJSON returns the generated spec in JSON, or nil if it was not generated before the build
+func SwaggerJSON() []byte {
+	return readGenerated("swagger.json")
+}
+
+// SwaggerYAML returns the generated spec in YAML, or nil if it was not generated before the build
+func SwaggerYAML() []byte {
+	return readGenerated("swagger.yaml")
+}
+
+func readGenerated(name string) []byte {
+	data, err := generated.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -28,7 +28,7 @@ func exampleOrgContextUsage(store storage.Storage, h *handlers.Handlers) {
 		// Protected routes with org context
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware(store))
-		protected.Use(middleware.OrgContextMiddleware()) // Extract org_id and role
+		protected.Use(middleware.OrgContextMiddleware(store)) // Extract org_id and role
 		{
 			// Example: List hosts filtered by organization
 			protected.GET("/hosts", func(c *gin.Context) {
@@ -75,7 +75,7 @@ func exampleOrgContextUsage(store storage.Storage, h *handlers.Handlers) {
 		// Example: Using with RequireRole
 		adminOnly := v1.Group("")
 		adminOnly.Use(middleware.AuthMiddleware(store))
-		adminOnly.Use(middleware.OrgContextMiddleware())
+		adminOnly.Use(middleware.OrgContextMiddleware(store))
 		adminOnly.Use(middleware.RequireRole("admin"))
 		{
 			adminOnly.GET("/admin/stats", func(c *gin.Context) {
@@ -0,0 +1,91 @@
+package accessreview
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestBuild(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Acme")
+	other, _ := store.CreateOrganization("Other")
+	admin, _ := store.CreateUser("alice", "alice@example.com", "hash", org.ID, "admin")
+	viewer, _ := store.CreateUser("bob", "bob@example.com", "hash", org.ID, "viewer")
+	_, _ = store.CreateUser("carol", "carol@example.com", "hash", other.ID, "admin")
+
+	require.NoError(t, store.SetHostAccessTags(viewer.ID, org.ID, []string{"team:web"}))
+	key, err := store.CreateAPIKey(admin.ID, "hash-1", "prefix-1", "CI", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.SetAPIKeyAllowedEndpoints(key.ID, []string{"POST /api/v1/ingest"}))
+	require.NoError(t, store.UpdateAPIKeyLastUsed(key.ID))
+	_, err = store.CreateAPIKey(viewer.ID, "hash-2", "prefix-2", "Web UI Session", nil)
+	require.NoError(t, err)
+
+	client := &models.OAuthClient{ID: "client-1", OrgID: org.ID, Name: "Dashboard", Scopes: []string{"hosts:read"}, CreatedByUserID: admin.ID}
+	require.NoError(t, store.CreateOAuthClient(client))
+	grant := &models.OAuthGrant{ID: "grant-1", ClientID: client.ID, ClientName: client.Name, UserID: viewer.ID, OrgID: org.ID, Scopes: []string{"hosts:read"}}
+	require.NoError(t, store.CreateOAuthGrant(grant))
+	require.NoError(t, store.UpdateOAuthGrantLastUsed(grant.ID))
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	report, err := Build(store, org, admin.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", report.OrgName)
+	assert.Equal(t, now, report.GeneratedAt)
+	assert.Equal(t, admin.ID, report.GeneratedBy)
+	require.Len(t, report.Users, 2, "only the organization's users")
+
+	users := map[string]*models.AccessReportUser{}
+	for _, user := range report.Users {
+		users[user.Username] = user
+	}
+	alice, bob := users["alice"], users["bob"]
+	require.NotNil(t, alice)
+	require.NotNil(t, bob)
+	assert.Equal(t, "admin", alice.Role)
+	assert.Empty(t, alice.HostAccessTags)
+	require.Len(t, alice.APIKeys, 1)
+	assert.Equal(t, []string{"POST /api/v1/ingest"}, alice.APIKeys[0].AllowedEndpoints)
+	assert.NotNil(t, alice.LastActivityAt, "the key was used")
+	assert.Empty(t, alice.Grants)
+
+	assert.Equal(t, []string{"team:web"}, bob.HostAccessTags)
+	require.Len(t, bob.Grants, 1)
+	assert.Equal(t, bob.Grants[0].LastUsedAt, bob.LastActivityAt, "the grant is bob's latest activity")
+
+	require.Len(t, report.Integrations, 1)
+	assert.Equal(t, "Dashboard", report.Integrations[0].Name)
+	assert.Equal(t, 1, report.Integrations[0].Grants)
+	assert.NotNil(t, report.Integrations[0].LastUsedAt)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, report))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 7, "header, 2 users, 2 keys, 1 grant, 1 integration")
+	assert.Equal(t, CSVHeader, rows[0])
+
+	types := map[string]int{}
+	for _, row := range rows[1:] {
+		require.Len(t, row, len(CSVHeader))
+		types[row[0]]++
+		if row[0] == RowAPIKey && row[2] == "CI" {
+			assert.Equal(t, "alice", row[4])
+			assert.Equal(t, "POST /api/v1/ingest", row[9])
+		}
+		if row[0] == RowUser && row[4] == "alice" {
+			assert.Equal(t, "all", row[9], "alice sees every host")
+			assert.NotEmpty(t, row[12])
+		}
+	}
+	assert.Equal(t, map[string]int{RowUser: 2, RowAPIKey: 2, RowGrant: 1, RowIntegration: 1}, types)
+	assert.Equal(t, "access-report-2025-03-01.csv", Filename(report, models.AccessReportFormatCSV))
+}
@@ -0,0 +1,119 @@
+package acl
+
+import (
+	"sync"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+// DefaultCacheTTL is how long a resolved policy is reused before it is reloaded from storage
+const DefaultCacheTTL = 30 * time.Second
+
+// PolicySource loads the tags a user is restricted to in an organization
+// storage.Storage satisfies this interface
+type PolicySource interface {
+	GetHostAccessTags(userID, orgID string) ([]string, error)
+}
+
+// Policy is the resolved host visibility policy for a user
+// A policy with no tags is unrestricted
+type Policy struct {
+	Tags []string
+}
+
+// Restricted reports whether the policy limits which hosts are visible
+func (p *Policy) Restricted() bool {
+	return p != nil && len(p.Tags) > 0
+}
+
+// Allows reports whether a host carrying hostTags is visible under the policy
+// A restricted policy requires the host to carry at least one of the allowed tags
+func (p *Policy) Allows(hostTags []string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	for _, allowed := range p.Tags {
+		for _, tag := range hostTags {
+			if tag == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterHosts returns only the hosts visible under the policy
+func (p *Policy) FilterHosts(hosts []*models.HostSummary) []*models.HostSummary {
+	if !p.Restricted() {
+		return hosts
+	}
+	visible := make([]*models.HostSummary, 0, len(hosts))
+	for _, host := range hosts {
+		if p.Allows(host.Tags) {
+			visible = append(visible, host)
+		}
+	}
+	return visible
+}
+
+type cacheEntry struct {
+	orgID     string
+	policy    *Policy
+	expiresAt time.Time
+}
+
+// Evaluator resolves host visibility policies for users and caches them
+type Evaluator struct {
+	source PolicySource
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.RWMutex
+	cache map[string]cacheEntry // userID -> cached policy
+}
+
+// NewEvaluator creates a new policy evaluator backed by source
+func NewEvaluator(source PolicySource, ttl time.Duration) *Evaluator {
+	return &Evaluator{
+		source: source,
+		ttl:    ttl,
+		now:    time.Now,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+// PolicyFor returns the host visibility policy for a user in the organization it acts in
+// (user.OrgID). Admins are never restricted by tag policies
+func (e *Evaluator) PolicyFor(user *models.User) (*Policy, error) {
+	if user == nil || user.Role == "admin" {
+		return &Policy{}, nil
+	}
+
+	e.mu.RLock()
+	entry, ok := e.cache[user.ID]
+	e.mu.RUnlock()
+	if ok && entry.orgID == user.OrgID && e.now().Before(entry.expiresAt) {
+		return entry.policy, nil
+	}
+
+	tags, err := e.source.GetHostAccessTags(user.ID, user.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{Tags: tags}
+	e.mu.Lock()
+	e.cache[user.ID] = cacheEntry{orgID: user.OrgID, policy: policy, expiresAt: e.now().Add(e.ttl)}
+	e.mu.Unlock()
+
+	return policy, nil
+}
+
+// Invalidate drops any cached policy for a user
+// Call this after the user's policy changes so the update takes effect immediately
+func (e *Evaluator) Invalidate(userID string) {
+	e.mu.Lock()
+	delete(e.cache, userID)
+	e.mu.Unlock()
+}
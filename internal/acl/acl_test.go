@@ -0,0 +1,114 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+type fakeSource struct {
+	tags  map[string][]string
+	calls int
+	err   error
+}
+
+func (f *fakeSource) GetHostAccessTags(userID, orgID string) ([]string, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.tags[orgID+"/"+userID], nil
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *Policy
+		hostTags []string
+		expected bool
+	}{
+		{"nil policy is unrestricted", nil, nil, true},
+		{"empty policy is unrestricted", &Policy{}, []string{"team:db"}, true},
+		{"matching tag", &Policy{Tags: []string{"team:web"}}, []string{"env:prod", "team:web"}, true},
+		{"any of several allowed tags", &Policy{Tags: []string{"team:db", "team:web"}}, []string{"team:web"}, true},
+		{"no matching tag", &Policy{Tags: []string{"team:web"}}, []string{"team:db"}, false},
+		{"untagged host", &Policy{Tags: []string{"team:web"}}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.policy.Allows(tt.hostTags))
+		})
+	}
+}
+
+func TestPolicy_FilterHosts(t *testing.T) {
+	hosts := []*models.HostSummary{
+		{HostID: "1", Tags: []string{"team:web"}},
+		{HostID: "2", Tags: []string{"team:db"}},
+		{HostID: "3"},
+	}
+
+	visible := (&Policy{Tags: []string{"team:web"}}).FilterHosts(hosts)
+	require.Len(t, visible, 1)
+	assert.Equal(t, "1", visible[0].HostID)
+
+	assert.Len(t, (&Policy{}).FilterHosts(hosts), 3)
+}
+
+func TestEvaluator_PolicyFor(t *testing.T) {
+	source := &fakeSource{tags: map[string][]string{"org-1/viewer-1": {"team:web"}}}
+	e := NewEvaluator(source, time.Minute)
+
+	t.Run("admins are unrestricted without lookup", func(t *testing.T) {
+		policy, err := e.PolicyFor(&models.User{ID: "admin-1", Role: "admin"})
+		require.NoError(t, err)
+		assert.False(t, policy.Restricted())
+		assert.Equal(t, 0, source.calls)
+	})
+
+	t.Run("policies are cached until invalidated", func(t *testing.T) {
+		viewer := &models.User{ID: "viewer-1", OrgID: "org-1", Role: "viewer"}
+
+		policy, err := e.PolicyFor(viewer)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team:web"}, policy.Tags)
+
+		_, err = e.PolicyFor(viewer)
+		require.NoError(t, err)
+		assert.Equal(t, 1, source.calls)
+
+		e.Invalidate(viewer.ID)
+		_, err = e.PolicyFor(viewer)
+		require.NoError(t, err)
+		assert.Equal(t, 2, source.calls)
+	})
+
+	t.Run("expired entries are reloaded", func(t *testing.T) {
+		now := time.Now()
+		e.now = func() time.Time { return now.Add(2 * time.Minute) }
+		defer func() { e.now = time.Now }()
+
+		_, err := e.PolicyFor(&models.User{ID: "viewer-1", OrgID: "org-1", Role: "viewer"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, source.calls)
+	})
+
+	t.Run("policies apply in the organization that set them", func(t *testing.T) {
+		policy, err := e.PolicyFor(&models.User{ID: "viewer-1", OrgID: "org-2", Role: "viewer"})
+		require.NoError(t, err)
+		assert.False(t, policy.Restricted())
+		assert.Equal(t, 4, source.calls, "a cached policy of another organization is not reused")
+	})
+
+	t.Run("source errors are returned", func(t *testing.T) {
+		failing := NewEvaluator(&fakeSource{err: errors.New("boom")}, time.Minute)
+		_, err := failing.PolicyFor(&models.User{ID: "viewer-2", Role: "viewer"})
+		assert.Error(t, err)
+	})
+}
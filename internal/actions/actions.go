@@ -0,0 +1,286 @@
+// Package actions delivers outbound actions: templated HTTP calls, such as creating a
+// Jira or GitHub issue, made when a problem is detected on a host.
+//
+// Fire records one run per matching action, and the dispatcher delivers due runs in
+// the background. A failed delivery is retried with exponential backoff up to
+// MaxAttempts, after which the run stays failed until it is retried by hand. Runs
+// live in storage, so deliveries survive restarts and are shared between instances.
+//
+// URL, header values, and body are Go text/templates executed with .Finding and
+// .Action. {{secret "name"}} inserts an organization secret and {{json .Finding.Summary}}
+// a JSON-quoted value. {{payload}} inserts the standard event document in the schema
+// version the action is pinned to, so receivers see a stable format until the action is
+// moved to a newer version. Deliveries are signed with the action's signing secret and,
+// while a rotation's grace period lasts, also with the previous one. Requests go
+// through the outbound client, which refuses internal addresses and does not follow
+// redirects.
+//
+// Slack and Mattermost actions post to an incoming webhook: their body template renders
+// the message text (DefaultChatTemplate when empty), which is sent as {"text": ...}.
+// An action's rate limit caps the runs queued for it in any hour; findings over the
+// limit are dropped rather than queued, so a burst of findings cannot flood a channel.
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+const (
+	// MaxAttempts is how many times a run is delivered before it fails
+	MaxAttempts = 5
+	// BaseBackoff is the wait before the first retry; it doubles with each attempt
+	BaseBackoff = 30 * time.Second
+	// MaxBackoff caps the wait between retries
+	MaxBackoff = time.Hour
+	// DedupWindow suppresses repeated runs of an action for the same finding on the same host
+	DedupWindow = 24 * time.Hour
+	// RateLimitWindow is the period an action's rate limit counts runs over
+	RateLimitWindow = time.Hour
+	// PollInterval is how often the dispatcher looks for due runs
+	PollInterval = 5 * time.Second
+
+	requestTimeout    = 30 * time.Second
+	claimLease        = 2 * time.Minute // Longer than a delivery, so a claimed run is only reclaimed after a crash
+	claimBatch        = 20
+	maxErrorLength    = 500
+	maxFindingDetails = 20
+)
+
+// Dispatcher queues and delivers action runs
+type Dispatcher struct {
+	store  storage.Storage
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher creates a dispatcher backed by store
+func NewDispatcher(store storage.Storage) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: outbound.NewClient(requestTimeout),
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Fire queues a run of each of the organization's enabled actions triggered by finding
+// It returns the number of runs queued; runs for a finding already reported within
+// DedupWindow, and runs of actions that reached their rate limit, are skipped.
+func (d *Dispatcher) Fire(orgID string, finding models.Finding) (int, error) {
+	actions, err := d.store.ListActions(orgID)
+	if err != nil {
+		return 0, err
+	}
+	if len(finding.Details) > maxFindingDetails {
+		finding.Details = finding.Details[:maxFindingDetails]
+	}
+
+	now := d.now()
+	queued := 0
+	for _, action := range actions {
+		if !action.Enabled || !triggeredBy(action, finding.Type) {
+			continue
+		}
+		if action.RateLimitPerHour > 0 {
+			recent, err := d.store.CountActionRuns(action.ID, now.Add(-RateLimitWindow))
+			if err != nil {
+				return queued, err
+			}
+			if recent >= action.RateLimitPerHour {
+				logger.Logger.Warn().
+					Str("action_id", action.ID).
+					Str("org_id", orgID).
+					Str("finding", finding.Type).
+					Int("rate_limit_per_hour", action.RateLimitPerHour).
+					Msg("Outbound action rate limit reached, finding dropped")
+				continue
+			}
+		}
+		run := &models.ActionRun{
+			ID:            uuid.New().String(),
+			ActionID:      action.ID,
+			OrgID:         orgID,
+			Finding:       finding,
+			Status:        models.ActionRunPending,
+			NextAttemptAt: &now,
+		}
+		created, err := d.store.CreateActionRun(run, now.Add(-DedupWindow))
+		if err != nil {
+			return queued, err
+		}
+		if created {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func triggeredBy(action *models.Action, findingType string) bool {
+	for _, trigger := range action.Triggers {
+		if trigger == findingType {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers due runs every PollInterval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.processDue(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to process outbound action runs")
+			}
+		}
+	}
+}
+
+// processDue claims due runs and delivers them, returning how many were attempted
+func (d *Dispatcher) processDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		runs, err := d.store.ClaimActionRuns(d.now(), claimLease, claimBatch)
+		if err != nil {
+			return attempted, err
+		}
+		for _, run := range runs {
+			d.deliver(ctx, run)
+		}
+		attempted += len(runs)
+		if len(runs) < claimBatch || ctx.Err() != nil {
+			return attempted, nil
+		}
+	}
+}
+
+// deliver makes one attempt at a claimed run and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, run *models.ActionRun) {
+	status, err := d.attempt(ctx, run)
+
+	run.Attempts++
+	run.ResponseStatus = status
+	now := d.now()
+	switch {
+	case err == nil:
+		run.Status = models.ActionRunSucceeded
+		run.LastError = ""
+		run.NextAttemptAt = nil
+		run.CompletedAt = &now
+	case run.Attempts >= MaxAttempts || errors.Is(err, errPermanent):
+		run.Status = models.ActionRunFailed
+		run.LastError = truncate(err.Error(), maxErrorLength)
+		run.NextAttemptAt = nil
+		run.CompletedAt = &now
+	default:
+		next := now.Add(backoff(run.Attempts))
+		run.Status = models.ActionRunPending
+		run.LastError = truncate(err.Error(), maxErrorLength)
+		run.NextAttemptAt = &next
+	}
+
+	log := logger.Logger.Info()
+	if run.Status != models.ActionRunSucceeded {
+		log = logger.Logger.Warn().Str("error", run.LastError)
+	}
+	log.Str("run_id", run.ID).
+		Str("action_id", run.ActionID).
+		Str("org_id", run.OrgID).
+		Str("status", run.Status).
+		Int("attempts", run.Attempts).
+		Msg("Outbound action attempted")
+
+	if err := d.store.FinishActionRun(run); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Logger.Error().Err(err).Str("run_id", run.ID).Msg("Failed to record outbound action run")
+	}
+}
+
+// errPermanent marks failures that retrying cannot fix
+var errPermanent = errors.New("permanent failure")
+
+// attempt renders and sends the run's action, returning the response status
+func (d *Dispatcher) attempt(ctx context.Context, run *models.ActionRun) (int, error) {
+	action, err := d.store.GetAction(run.ActionID, run.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	if !action.Enabled {
+		return 0, fmt.Errorf("%w: action is disabled", errPermanent)
+	}
+	secrets, err := d.store.GetOrgSecretValues(run.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	req, err := render(action, run.Finding, secrets)
+	if err != nil {
+		// A missing secret can be added before the next attempt, so rendering errors are retried
+		return 0, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, strings.NewReader(req.body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	for name, value := range req.headers {
+		httpReq.Header.Set(name, value)
+	}
+	if httpReq.Header.Get("Content-Type") == "" && req.body != "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("User-Agent", "snailbus-actions")
+	httpReq.Header.Set(SchemaVersionHeader, strconv.Itoa(action.SchemaVersion))
+	httpReq.Header.Set(DeliveryHeader, run.ID)
+	if signature := Sign(action, req.body, d.now()); signature != "" {
+		httpReq.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := d.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Only the status is recorded, so run errors cannot be used to read responses back
+		return resp.StatusCode, fmt.Errorf("target returned status %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	wait := BaseBackoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
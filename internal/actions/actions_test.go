@@ -0,0 +1,484 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const testOrgID = "org-1"
+
+// target records requests and answers with a configurable status
+type target struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newTarget(t *testing.T, status int) (*target, *httptest.Server) {
+	tgt := &target{status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		tgt.mu.Lock()
+		defer tgt.mu.Unlock()
+		tgt.requests = append(tgt.requests, r)
+		tgt.bodies = append(tgt.bodies, string(body))
+		w.WriteHeader(tgt.status)
+	}))
+	t.Cleanup(server.Close)
+	return tgt, server
+}
+
+func newTestDispatcher(t *testing.T, store storage.Storage, now *time.Time) *Dispatcher {
+	d := NewDispatcher(store)
+	// The test targets listen on loopback, which the outbound client refuses
+	d.client = &http.Client{Timeout: requestTimeout}
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func createTestAction(t *testing.T, store storage.Storage, url string) *models.Action {
+	action := &models.Action{
+		ID:            "action-1",
+		Name:          "Open ticket",
+		Triggers:      []string{models.FindingHostUnreachable},
+		Method:        http.MethodPost,
+		URL:           url + "/issues",
+		Headers:       map[string]string{"Authorization": `Bearer {{secret "token"}}`},
+		BodyTemplate:  `{"title": {{json .Finding.Summary}}, "host": {{json .Finding.Hostname}}, "action": {{json .Action.Name}}}`,
+		Enabled:       true,
+		SchemaVersion: CurrentSchemaVersion,
+		SigningSecret: "sbws_test",
+	}
+	require.NoError(t, Validate(action))
+	require.NoError(t, store.CreateAction(action, testOrgID))
+	return action
+}
+
+func unreachableFinding(hostID string) models.Finding {
+	return models.Finding{
+		Type:     models.FindingHostUnreachable,
+		HostID:   hostID,
+		Hostname: hostID + ".example.com",
+		Summary:  hostID + " is unreachable",
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	store := storage.NewMockStorage()
+	tgt, server := newTarget(t, http.StatusCreated)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+
+	action := createTestAction(t, store, server.URL)
+	require.NoError(t, store.SetOrgSecret(testOrgID, "token", "s3cret"))
+
+	queued, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	// Findings that match no trigger queue nothing
+	queued, err = d.Fire(testOrgID, models.Finding{Type: models.FindingReportErrors, HostID: "host-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	attempted, err := d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	require.Len(t, tgt.requests, 1)
+	assert.Equal(t, http.MethodPost, tgt.requests[0].Method)
+	assert.Equal(t, "/issues", tgt.requests[0].URL.Path)
+	assert.Equal(t, "Bearer s3cret", tgt.requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "application/json", tgt.requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "1", tgt.requests[0].Header.Get(SchemaVersionHeader))
+	assert.Equal(t, Sign(action, tgt.bodies[0], now), tgt.requests[0].Header.Get(SignatureHeader))
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal([]byte(tgt.bodies[0]), &body))
+	assert.Equal(t, "host-1 is unreachable", body["title"])
+	assert.Equal(t, "host-1.example.com", body["host"])
+	assert.Equal(t, "Open ticket", body["action"])
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, runs[0].ID, tgt.requests[0].Header.Get(DeliveryHeader))
+	assert.Equal(t, models.ActionRunSucceeded, runs[0].Status)
+	assert.Equal(t, 1, runs[0].Attempts)
+	assert.Equal(t, http.StatusCreated, runs[0].ResponseStatus)
+	assert.NotNil(t, runs[0].CompletedAt)
+	assert.Nil(t, runs[0].NextAttemptAt)
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	store := storage.NewMockStorage()
+	tgt, server := newTarget(t, http.StatusServiceUnavailable)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+
+	action := createTestAction(t, store, server.URL)
+	require.NoError(t, store.SetOrgSecret(testOrgID, "token", "s3cret"))
+	_, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		attempted, err := d.processDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, attempted)
+
+		runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, models.ActionRunPending, runs[0].Status)
+		assert.Equal(t, attempt, runs[0].Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, runs[0].ResponseStatus)
+		assert.Contains(t, runs[0].LastError, "status 503")
+		require.NotNil(t, runs[0].NextAttemptAt)
+		assert.Equal(t, now.Add(backoff(attempt)), *runs[0].NextAttemptAt)
+
+		// Nothing is due until the backoff has passed
+		attempted, err = d.processDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, attempted)
+		now = runs[0].NextAttemptAt.Add(time.Second)
+	}
+
+	// The last attempt fails the run for good
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, tgt.requests, MaxAttempts)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionRunFailed, runs[0].Status)
+	assert.Nil(t, runs[0].NextAttemptAt)
+	assert.NotNil(t, runs[0].CompletedAt)
+
+	// A manual retry starts over, and succeeds once the target recovers
+	tgt.mu.Lock()
+	tgt.status = http.StatusOK
+	tgt.mu.Unlock()
+	_, err = store.RetryActionRun(runs[0].ID, testOrgID)
+	require.NoError(t, err)
+	now = now.Add(time.Second)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	run, err := store.GetActionRun(runs[0].ID, testOrgID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionRunSucceeded, run.Status)
+	assert.Equal(t, 1, run.Attempts)
+	assert.Empty(t, run.LastError)
+}
+
+func TestDispatcher_RefusesInternalTargets(t *testing.T) {
+	store := storage.NewMockStorage()
+	tgt, server := newTarget(t, http.StatusOK)
+	now := time.Now().UTC()
+	d := NewDispatcher(store)
+	d.now = func() time.Time { return now }
+	action := createTestAction(t, store, server.URL)
+	require.NoError(t, store.SetOrgSecret(testOrgID, "token", "s3cret"))
+
+	_, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.ActionRunPending, runs[0].Status)
+	assert.Contains(t, runs[0].LastError, "not allowed")
+	assert.Empty(t, tgt.requests)
+}
+
+func TestDispatcher_RefusesInternalChatWebhooks(t *testing.T) {
+	store := storage.NewMockStorage()
+	tgt, server := newTarget(t, http.StatusOK)
+	d := NewDispatcher(store)
+	action := &models.Action{
+		ID:           "action-1",
+		Name:         "Ops channel",
+		Kind:         models.ActionKindSlack,
+		Triggers:     []string{models.FindingHostUnreachable},
+		Method:       http.MethodPost,
+		URL:          `{{secret "webhook"}}`,
+		BodyTemplate: DefaultChatTemplate,
+		Enabled:      true,
+	}
+	require.NoError(t, store.CreateAction(action, testOrgID))
+	// The secret holds a URL on the server's own network
+	require.NoError(t, store.SetOrgSecret(testOrgID, "webhook", server.URL))
+
+	_, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0].LastError, "not allowed")
+	assert.Empty(t, tgt.requests)
+}
+
+func TestDispatcher_DoesNotRecordResponseBody(t *testing.T) {
+	store := storage.NewMockStorage()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "internal-only response")
+	}))
+	t.Cleanup(server.Close)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+	action := createTestAction(t, store, server.URL)
+	require.NoError(t, store.SetOrgSecret(testOrgID, "token", "s3cret"))
+
+	_, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "target returned status 403", runs[0].LastError)
+}
+
+func TestDispatcher_Dedup(t *testing.T) {
+	store := storage.NewMockStorage()
+	_, server := newTarget(t, http.StatusOK)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+	createTestAction(t, store, server.URL)
+
+	queued, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	// The same problem on the same host is only reported once per window
+	queued, err = d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	// Another host is a separate finding
+	queued, err = d.Fire(testOrgID, unreachableFinding("host-2"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	// Other organizations' actions are not triggered
+	queued, err = d.Fire("org-2", unreachableFinding("host-3"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+}
+
+func TestDispatcher_RateLimit(t *testing.T) {
+	store := storage.NewMockStorage()
+	_, server := newTarget(t, http.StatusOK)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+	action := createTestAction(t, store, server.URL)
+	action.RateLimitPerHour = 2
+	require.NoError(t, store.UpdateAction(action, testOrgID))
+
+	for _, hostID := range []string{"host-1", "host-2"} {
+		queued, err := d.Fire(testOrgID, unreachableFinding(hostID))
+		require.NoError(t, err)
+		assert.Equal(t, 1, queued)
+	}
+
+	// Findings over the limit are dropped
+	queued, err := d.Fire(testOrgID, unreachableFinding("host-3"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	assert.Len(t, runs, 2)
+
+	// Once the window has passed the action runs again
+	now = now.Add(RateLimitWindow + time.Minute)
+	queued, err = d.Fire(testOrgID, unreachableFinding("host-3"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+}
+
+func TestDispatcher_DisabledAndMissingSecret(t *testing.T) {
+	store := storage.NewMockStorage()
+	tgt, server := newTarget(t, http.StatusOK)
+	now := time.Now().UTC()
+	d := newTestDispatcher(t, store, &now)
+	action := createTestAction(t, store, server.URL)
+
+	// Without the secret the run cannot be rendered and is retried later
+	_, err := d.Fire(testOrgID, unreachableFinding("host-1"))
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tgt.requests)
+
+	runs, err := store.ListActionRuns(action.ID, testOrgID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionRunPending, runs[0].Status)
+	assert.Contains(t, runs[0].LastError, `secret "token" is not set`)
+
+	// Disabling the action fails its queued runs without calling the target
+	action.Enabled = false
+	require.NoError(t, store.UpdateAction(action, testOrgID))
+	now = now.Add(time.Hour)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tgt.requests)
+
+	run, err := store.GetActionRun(runs[0].ID, testOrgID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionRunFailed, run.Status)
+	assert.Equal(t, 2, run.Attempts)
+
+	// Disabled actions are not fired
+	queued, err := d.Fire(testOrgID, unreachableFinding("host-2"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+}
+
+func TestValidate(t *testing.T) {
+	valid := &models.Action{URL: "https://example.com/{{.Finding.HostID}}", BodyTemplate: `{{json .Finding}}`}
+	assert.NoError(t, Validate(valid))
+
+	tests := []struct {
+		name   string
+		action *models.Action
+	}{
+		{"bad url template", &models.Action{URL: "https://example.com/{{.Finding"}},
+		{"bad body template", &models.Action{URL: "https://example.com", BodyTemplate: "{{if}}"}},
+		{"unknown function", &models.Action{URL: "https://example.com", BodyTemplate: "{{env \"HOME\"}}"}},
+		{"bad header name", &models.Action{URL: "https://example.com", Headers: map[string]string{"Bad Header": "x"}}},
+		{"bad header template", &models.Action{URL: "https://example.com", Headers: map[string]string{"X-Token": "{{secret}"}}},
+		{"unsupported schema version", &models.Action{URL: "https://example.com", SchemaVersion: 99}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, Validate(tt.action))
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	finding := unreachableFinding("host-1")
+
+	req, err := render(&models.Action{Method: http.MethodPut, URL: "https://example.com/hosts/{{.Finding.HostID}}"}, finding, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/hosts/host-1", req.url)
+	assert.Equal(t, http.MethodPut, req.method)
+
+	// Only http and https targets are called
+	_, err = render(&models.Action{URL: "file:///etc/passwd"}, finding, nil)
+	assert.Error(t, err)
+
+	// Header values cannot smuggle extra headers
+	_, err = render(&models.Action{
+		URL:     "https://example.com",
+		Headers: map[string]string{"X-Token": `{{secret "token"}}`},
+	}, finding, map[string]string{"token": "a\r\nX-Injected: 1"})
+	assert.Error(t, err)
+}
+
+func TestRender_Chat(t *testing.T) {
+	finding := unreachableFinding("host-1")
+	finding.Details = []string{"icmp timeout", `port 22: "refused"`}
+	action := &models.Action{
+		Kind:         models.ActionKindSlack,
+		Method:       http.MethodPost,
+		URL:          `{{secret "webhook"}}`,
+		BodyTemplate: DefaultChatTemplate,
+	}
+	require.NoError(t, Validate(action))
+
+	req, err := render(action, finding, map[string]string{"webhook": "https://hooks.slack.com/services/T0/B0/x"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.slack.com/services/T0/B0/x", req.url)
+	var message map[string]string
+	require.NoError(t, json.Unmarshal([]byte(req.body), &message))
+	assert.Equal(t, map[string]string{"text": "host-1 is unreachable\n> icmp timeout\n> port 22: \"refused\""}, message)
+
+	// HTTP actions send the rendered body as-is
+	action.Kind = models.ActionKindHTTP
+	req, err = render(action, finding, map[string]string{"webhook": "https://example.com"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(req.body, "host-1 is unreachable\n"))
+}
+
+func TestRender_Payload(t *testing.T) {
+	finding := unreachableFinding("host-1")
+	action := &models.Action{ID: "action-1", Name: "Webhook", URL: "https://example.com", BodyTemplate: "{{payload}}", SchemaVersion: 1}
+
+	req, err := render(action, finding, nil)
+	require.NoError(t, err)
+	var payload struct {
+		SchemaVersion int               `json:"schema_version"`
+		Type          string            `json:"type"`
+		Action        map[string]string `json:"action"`
+		Finding       models.Finding    `json:"finding"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(req.body), &payload))
+	assert.Equal(t, 1, payload.SchemaVersion)
+	assert.Equal(t, models.FindingHostUnreachable, payload.Type)
+	assert.Equal(t, "Webhook", payload.Action["name"])
+	assert.Equal(t, "host-1", payload.Finding.HostID)
+
+	action.SchemaVersion = 99
+	_, err = render(action, finding, nil)
+	assert.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+	action := &models.Action{
+		SigningSecret:           "new",
+		PreviousSigningSecret:   "old",
+		PreviousSecretExpiresAt: &expires,
+	}
+
+	// Both secrets sign during the grace period
+	header := Sign(action, `{"a":1}`, now)
+	parts := strings.Split(header, ",")
+	require.Len(t, parts, 3)
+	assert.Equal(t, "t=1700000000", parts[0])
+	assert.Equal(t, "v1="+signature("new", "1700000000", `{"a":1}`), parts[1])
+	assert.Equal(t, "v1="+signature("old", "1700000000", `{"a":1}`), parts[2])
+
+	// Only the current secret signs once it is over
+	assert.Len(t, strings.Split(Sign(action, `{"a":1}`, expires), ","), 2)
+
+	// Actions without a secret are not signed
+	assert.Empty(t, Sign(&models.Action{}, `{"a":1}`, now))
+}
+
+func TestSignPayload(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	action := &models.Action{SigningSecret: "new"}
+	assert.Equal(t, Sign(action, `{"a":1}`, now), SignPayload("new", `{"a":1}`, now))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, BaseBackoff, backoff(1))
+	assert.Equal(t, 2*BaseBackoff, backoff(2))
+	assert.Equal(t, 4*BaseBackoff, backoff(3))
+	assert.Equal(t, MaxBackoff, backoff(20))
+}
@@ -0,0 +1,27 @@
+package actions
+
+import (
+	"encoding/json"
+
+	"snailbus/internal/models"
+)
+
+// DefaultChatTemplate is the message of Slack and Mattermost actions without a body template
+const DefaultChatTemplate = `{{.Finding.Summary}}{{range .Finding.Details}}
+> {{.}}{{end}}`
+
+// IsChat reports whether kind posts chat messages rather than a templated body
+func IsChat(kind string) bool {
+	return kind == models.ActionKindSlack || kind == models.ActionKindMattermost
+}
+
+// chatMessage is the incoming webhook payload; Slack and Mattermost both accept it
+type chatMessage struct {
+	Text string `json:"text"`
+}
+
+// chatBody wraps rendered message text in an incoming webhook payload
+func chatBody(text string) (string, error) {
+	body, err := json.Marshal(chatMessage{Text: text})
+	return string(body), err
+}
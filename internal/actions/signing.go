@@ -0,0 +1,94 @@
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+const (
+	// CurrentSchemaVersion is the schema version new actions are pinned to
+	CurrentSchemaVersion = 1
+	// SigningSecretPrefix marks action signing secrets
+	SigningSecretPrefix = "sbws_"
+	// DefaultGracePeriod is how long a rotated-out signing secret keeps signing deliveries
+	DefaultGracePeriod = 24 * time.Hour
+)
+
+// Headers set on every delivery
+const (
+	SignatureHeader     = "X-Snailbus-Signature"
+	SchemaVersionHeader = "X-Snailbus-Schema-Version"
+	DeliveryHeader      = "X-Snailbus-Delivery"
+)
+
+// payloads builds the {{payload}} document of each supported schema version
+// A new version is added here when the document or the template data changes shape;
+// actions stay on the version they are pinned to until an admin moves them.
+var payloads = map[int]func(data templateData) interface{}{
+	1: payloadV1,
+}
+
+// payloadV1 is the version 1 event document
+func payloadV1(data templateData) interface{} {
+	return map[string]interface{}{
+		"schema_version": 1,
+		"type":           data.Finding.Type,
+		"action":         map[string]string{"id": data.Action.ID, "name": data.Action.Name},
+		"finding":        data.Finding,
+	}
+}
+
+// SupportedSchemaVersion reports whether actions can be pinned to version
+func SupportedSchemaVersion(version int) bool {
+	_, ok := payloads[version]
+	return ok
+}
+
+// GenerateSigningSecret returns a new random signing secret
+func GenerateSigningSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate signing secret: %w", err)
+	}
+	return SigningSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a delivery body sent at now
+// The value is "t=<unix seconds>" followed by a "v1=<hex HMAC-SHA256 of t.body>" for the
+// action's signing secret and, during a rotation's grace period, one for the previous
+// secret. Receivers accept the delivery if any v1 value matches a secret they hold.
+// It returns "" for actions without a signing secret.
+func Sign(action *models.Action, body string, now time.Time) string {
+	if action.SigningSecret == "" {
+		return ""
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	parts := []string{"t=" + timestamp, "v1=" + signature(action.SigningSecret, timestamp, body)}
+	if action.PreviousSigningSecret != "" && action.PreviousSecretExpiresAt != nil && now.Before(*action.PreviousSecretExpiresAt) {
+		parts = append(parts, "v1="+signature(action.PreviousSigningSecret, timestamp, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// SignPayload returns the signature header value for a body signed with secret at now
+// It has the format of Sign with a single secret, so other signed deliveries such as
+// webhooks are verified the same way as actions.
+func SignPayload(secret, body string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+func signature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"snailbus/internal/models"
+)
+
+// headerNamePattern matches valid HTTP header names
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_` + "`" + `|~-]+$`)
+
+// templateData is what action templates are executed with
+type templateData struct {
+	SchemaVersion int
+	Finding       models.Finding
+	Action        struct {
+		ID   string
+		Name string
+	}
+}
+
+// request is an action rendered for one finding
+type request struct {
+	method  string
+	url     string
+	headers map[string]string
+	body    string
+}
+
+// funcs returns the template functions; secret looks names up in secrets and payload renders data
+func funcs(secrets map[string]string, data *templateData) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(name string) (string, error) {
+			value, ok := secrets[name]
+			if !ok {
+				return "", fmt.Errorf("secret %q is not set", name)
+			}
+			return value, nil
+		},
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"payload": func() (string, error) {
+			build, ok := payloads[data.SchemaVersion]
+			if !ok {
+				return "", fmt.Errorf("unsupported schema version %d", data.SchemaVersion)
+			}
+			payload, err := json.Marshal(build(*data))
+			return string(payload), err
+		},
+	}
+}
+
+// Validate checks that an action's schema version is supported, its header names are
+// valid, and its templates parse. A zero schema version is left for the caller to set.
+func Validate(action *models.Action) error {
+	if action.SchemaVersion != 0 && !SupportedSchemaVersion(action.SchemaVersion) {
+		return fmt.Errorf("unsupported schema version %d", action.SchemaVersion)
+	}
+	parse := func(name, text string) error {
+		if _, err := template.New(name).Funcs(funcs(nil, nil)).Option("missingkey=error").Parse(text); err != nil {
+			return fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := parse("url", action.URL); err != nil {
+		return err
+	}
+	for name, value := range action.Headers {
+		if !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if err := parse("header "+name, value); err != nil {
+			return err
+		}
+	}
+	return parse("body", action.BodyTemplate)
+}
+
+// render executes an action's templates for a finding
+// The body of a chat action is the message text, sent as an incoming webhook payload.
+func render(action *models.Action, finding models.Finding, secrets map[string]string) (*request, error) {
+	data := templateData{SchemaVersion: action.SchemaVersion, Finding: finding}
+	data.Action.ID = action.ID
+	data.Action.Name = action.Name
+
+	execute := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Funcs(funcs(secrets, &data)).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	req := &request{method: action.Method, headers: make(map[string]string, len(action.Headers))}
+	var err error
+	if req.url, err = execute("url", action.URL); err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(strings.TrimSpace(req.url))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("rendered URL is not an http:// or https:// URL")
+	}
+	req.url = parsed.String()
+
+	for name, value := range action.Headers {
+		if req.headers[name], err = execute("header "+name, value); err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(req.headers[name], "\r\n") {
+			return nil, fmt.Errorf("rendered header %s contains a line break", name)
+		}
+	}
+	if req.body, err = execute("body", action.BodyTemplate); err != nil {
+		return nil, err
+	}
+	if IsChat(action.Kind) {
+		if req.body, err = chatBody(req.body); err != nil {
+			return nil, fmt.Errorf("failed to encode chat message: %w", err)
+		}
+	}
+	return req, nil
+}
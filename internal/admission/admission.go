@@ -0,0 +1,142 @@
+// Package admission bounds concurrent ingest work, so that load spikes are shed
+// with 429 responses instead of piling up on the database connection pool until
+// requests time out.
+//
+// At most maxInFlight operations run at once. Up to maxQueue more wait for a slot,
+// each for at most queueTimeout; anything beyond that is rejected immediately.
+// In-flight operations, queue depth, saturation, and rejections are exported as
+// Prometheus metrics.
+package admission
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"snailbus/internal/metrics"
+)
+
+// Rejection reasons, reported in the ingest_rejected_total metric
+const (
+	ReasonQueueFull    = "queue_full"
+	ReasonQueueTimeout = "queue_timeout"
+)
+
+var (
+	// ErrQueueFull is returned by Acquire when every slot is busy and the queue is full
+	ErrQueueFull = errors.New("admission queue is full")
+
+	// ErrQueueTimeout is returned by Acquire when no slot freed up within the queue timeout
+	ErrQueueTimeout = errors.New("timed out waiting for admission")
+)
+
+// Stats is a point-in-time view of the controller
+type Stats struct {
+	InFlight    int
+	Queued      int
+	MaxInFlight int
+	MaxQueue    int
+	Saturation  float64 // InFlight / MaxInFlight
+}
+
+// Controller admits operations up to a concurrency limit with a bounded wait queue
+type Controller struct {
+	slots        chan struct{}
+	maxQueue     int
+	queueTimeout time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+// NewController creates a controller running at most maxInFlight operations with
+// up to maxQueue waiting for at most queueTimeout each
+func NewController(maxInFlight, maxQueue int, queueTimeout time.Duration) *Controller {
+	c := &Controller{
+		slots:        make(chan struct{}, maxInFlight),
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+	}
+	c.report()
+	return c
+}
+
+// Acquire waits for a slot and returns the function releasing it
+// It fails with ErrQueueFull, ErrQueueTimeout, or the context's error if ctx is done first.
+func (c *Controller) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case c.slots <- struct{}{}:
+		c.report()
+		return c.release, nil
+	default:
+	}
+
+	c.mu.Lock()
+	if c.queued >= c.maxQueue {
+		c.mu.Unlock()
+		metrics.IngestRejectedTotal.WithLabelValues(ReasonQueueFull).Inc()
+		return nil, ErrQueueFull
+	}
+	c.queued++
+	c.mu.Unlock()
+	c.report()
+
+	defer func() {
+		c.mu.Lock()
+		c.queued--
+		c.mu.Unlock()
+		c.report()
+	}()
+
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case c.slots <- struct{}{}:
+		return c.release, nil
+	case <-timer.C:
+		metrics.IngestRejectedTotal.WithLabelValues(ReasonQueueTimeout).Inc()
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release frees a slot taken by Acquire
+func (c *Controller) release() {
+	<-c.slots
+	c.report()
+}
+
+// RetryAfter is how long rejected clients are asked to wait: the queue timeout, in whole seconds
+func (c *Controller) RetryAfter() int {
+	return int(math.Max(1, math.Ceil(c.queueTimeout.Seconds())))
+}
+
+// Stats returns the current load
+func (c *Controller) Stats() Stats {
+	c.mu.Lock()
+	queued := c.queued
+	c.mu.Unlock()
+
+	stats := Stats{
+		InFlight:    len(c.slots),
+		Queued:      queued,
+		MaxInFlight: cap(c.slots),
+		MaxQueue:    c.maxQueue,
+	}
+	if stats.MaxInFlight > 0 {
+		stats.Saturation = float64(stats.InFlight) / float64(stats.MaxInFlight)
+	}
+	return stats
+}
+
+// report updates the saturation gauges
+func (c *Controller) report() {
+	stats := c.Stats()
+	metrics.IngestInFlight.Set(float64(stats.InFlight))
+	metrics.IngestQueueDepth.Set(float64(stats.Queued))
+	metrics.IngestSaturation.Set(stats.Saturation)
+}
@@ -0,0 +1,60 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_Acquire(t *testing.T) {
+	c := NewController(2, 1, 50*time.Millisecond)
+
+	first, err := c.Acquire(context.Background())
+	require.NoError(t, err)
+	second, err := c.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{InFlight: 2, MaxInFlight: 2, MaxQueue: 1, Saturation: 1}, c.Stats())
+
+	// A queued request gets the slot released while it waits
+	acquired := make(chan error)
+	go func() {
+		release, err := c.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	require.Eventually(t, func() bool { return c.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// The queue holds one request, so the next is rejected without waiting
+	_, err = c.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	first()
+	require.NoError(t, <-acquired)
+
+	// With every slot busy, queued requests give up after the queue timeout
+	third, err := c.Acquire(context.Background())
+	require.NoError(t, err)
+	_, err = c.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueTimeout)
+
+	// Or when their context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	second()
+	third()
+	assert.Equal(t, Stats{MaxInFlight: 2, MaxQueue: 1}, c.Stats())
+}
+
+func TestController_RetryAfter(t *testing.T) {
+	assert.Equal(t, 5, NewController(1, 0, 5*time.Second).RetryAfter())
+	assert.Equal(t, 2, NewController(1, 0, 1500*time.Millisecond).RetryAfter())
+	assert.Equal(t, 1, NewController(1, 0, 100*time.Millisecond).RetryAfter())
+}
@@ -0,0 +1,345 @@
+// Package anonymize scrubs personal data from a copy of the snailbus database so
+// that it can be shared, for example as a staging environment cloned from production.
+//
+// Emails, usernames, hostnames, organization names, and IP addresses are replaced
+// with pseudonyms derived from a key with HMAC-SHA256. An identifier gets the same
+// pseudonym in every table and inside report data and host events, so joins,
+// filters, and host history still line up; without the key the originals can be
+// neither recovered nor confirmed. Credentials are removed rather than replaced:
+// every user gets the same new password, and outbound actions, webhooks, and
+// remote-write targets are disabled so a staging copy never calls production endpoints.
+//
+// Rows are identified by tableoid and ctid and read through a cursor, so tables of any
+// size are scrubbed in one transaction without holding them in memory. A ctid is only
+// unique within one table, and host_reports is partitioned by month, so the partition
+// holding the row (its tableoid) is part of its identity. Host, user, and organization
+// IDs are kept.
+package anonymize
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"snailbus/internal/auth"
+)
+
+// batchSize is how many rows are fetched from the cursor at a time
+const batchSize = 500
+
+// Column types
+const (
+	typeText = iota
+	typeTextArray
+	typeJSON
+)
+
+// column is a column holding personal data and how each value is scrubbed
+type column struct {
+	table string
+	name  string
+	typ   int
+	scrub func(p *Pseudonymizer, value string) string
+}
+
+// columns are scrubbed in order. Columns that name identifiers come first, so that
+// the identifiers are known when free text and report data are scrubbed.
+var columns = []column{
+	{"organizations", "name", typeText, (*Pseudonymizer).OrgName},
+	{"users", "username", typeText, (*Pseudonymizer).Username},
+	{"users", "email", typeText, (*Pseudonymizer).Email},
+	{"host_accounts", "username", typeText, (*Pseudonymizer).Username},
+	{"hosts", "hostname", typeText, (*Pseudonymizer).Hostname},
+	{"hosts", "display_name", typeText, (*Pseudonymizer).Hostname},
+	{"host_events", "hostname", typeText, (*Pseudonymizer).Hostname},
+	{"host_probe_results", "hostname", typeText, (*Pseudonymizer).Hostname},
+	{"host_reports", "hostname", typeText, (*Pseudonymizer).Hostname},
+	{"audit_events", "actor_username", typeText, (*Pseudonymizer).Username},
+
+	{"hosts", "description", typeText, (*Pseudonymizer).Text},
+	{"hosts", "data", typeJSON, nil},
+	{"hosts", "errors", typeTextArray, (*Pseudonymizer).Text},
+	{"hosts", "health", typeJSON, nil},
+	{"host_events", "payload", typeJSON, nil},
+	{"host_reports", "data", typeJSON, nil},
+	{"host_reports", "errors", typeTextArray, (*Pseudonymizer).Text},
+	{"host_reports", "health", typeJSON, nil},
+	{"host_accounts", "home", typeText, (*Pseudonymizer).Text},
+	{"host_services", "address", typeText, (*Pseudonymizer).IP},
+	{"host_probe_results", "address", typeText, (*Pseudonymizer).Text},
+	{"host_probe_results", "error", typeText, (*Pseudonymizer).Text},
+	{"host_probe_results", "prober", typeText, scrubProber},
+	{"probe_jobs", "prober", typeText, scrubProber},
+	{"probe_jobs", "targets", typeJSON, nil},
+	{"action_runs", "finding", typeJSON, nil},
+	{"action_runs", "last_error", typeText, (*Pseudonymizer).Text},
+	{"webhook_deliveries", "event", typeJSON, nil},
+	{"webhook_deliveries", "last_error", typeText, (*Pseudonymizer).Text},
+	{"fleet_reports", "title", typeText, (*Pseudonymizer).Text},
+	{"fleet_reports", "content", typeJSON, nil},
+	{"fleet_reports", "emailed_to", typeTextArray, (*Pseudonymizer).Email},
+	{"fleet_reports", "email_error", typeText, (*Pseudonymizer).Text},
+	{"import_batches", "results", typeJSON, nil},
+	{"org_remote_write", "last_error", typeText, (*Pseudonymizer).Text},
+	{"audit_events", "details", typeJSON, nil},
+	{"audit_events", "client_ip", typeText, (*Pseudonymizer).IP},
+	{"audit_events", "user_agent", typeText, (*Pseudonymizer).Text},
+}
+
+// credentials are statements that remove secrets and disable calls to external endpoints
+var credentials = []struct {
+	table string
+	query string
+}{
+	{"org_secrets", `UPDATE org_secrets SET value = '' WHERE value <> ''`},
+	{"org_remote_write", `UPDATE org_remote_write SET url = 'https://remote-write.example.invalid/api/v1/write', username = '', password = '', bearer_token = ''`},
+	{"actions", `UPDATE actions SET url = 'https://actions.example.invalid/' || id, headers = '{}', enabled = false,
+		signing_secret = '', previous_signing_secret = '', previous_secret_expires_at = NULL`},
+	{"webhooks", `UPDATE webhooks SET url = 'https://webhooks.example.invalid/' || id, enabled = false, signing_secret = ''`},
+}
+
+// Options configures Anonymize
+type Options struct {
+	// Key derives the pseudonyms; the same key and data give the same pseudonyms
+	Key []byte
+	// Password is set as every user's password; empty sets an unguessable one
+	Password string
+}
+
+// ColumnResult is the number of rows changed in a column
+type ColumnResult struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Rows   int64  `json:"rows"`
+}
+
+// Result summarizes an anonymization
+type Result struct {
+	Columns     []ColumnResult `json:"columns"`
+	Credentials []ColumnResult `json:"credentials"` // Rows whose secrets were removed
+	Passwords   int64          `json:"passwords"`   // Users whose password was replaced
+}
+
+// Anonymize replaces personal data and credentials throughout the database in one
+// transaction, so a failure leaves it unchanged
+func Anonymize(ctx context.Context, db *sql.DB, opts Options) (*Result, error) {
+	if len(opts.Key) == 0 {
+		return nil, errors.New("a pseudonym key is required")
+	}
+	password := opts.Password
+	if password == "" {
+		random := make([]byte, 24)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(random)
+	}
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	p := NewPseudonymizer(opts.Key)
+	result := &Result{Columns: []ColumnResult{}, Credentials: []ColumnResult{}}
+	for _, col := range columns {
+		rows, err := scrubColumn(ctx, tx, p, col)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s.%s: %w", col.table, col.name, err)
+		}
+		result.Columns = append(result.Columns, ColumnResult{Table: col.table, Column: col.name, Rows: rows})
+	}
+
+	for _, cred := range credentials {
+		res, err := tx.ExecContext(ctx, cred.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove credentials from %s: %w", cred.table, err)
+		}
+		rows, _ := res.RowsAffected()
+		result.Credentials = append(result.Credentials, ColumnResult{Table: cred.table, Rows: rows})
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $1`, passwordHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset passwords: %w", err)
+	}
+	result.Passwords, _ = res.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return result, nil
+}
+
+// update is a scrubbed value waiting to be written
+type update struct {
+	tableOID string // Table, or partition, the row is in
+	ctid     string
+	value    interface{}
+}
+
+// scrubColumn scrubs every value of a column and returns how many rows changed
+// The table and column names come from columns, never from input.
+func scrubColumn(ctx context.Context, tx *sql.Tx, p *Pseudonymizer, col column) (int64, error) {
+	cast := ""
+	if col.typ == typeJSON {
+		cast = "::text"
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`DECLARE anonymize_rows NO SCROLL CURSOR FOR SELECT tableoid::oid::text, ctid::text, %s%s FROM %s WHERE %s IS NOT NULL`,
+		col.name, cast, col.table, col.name)); err != nil {
+		return 0, err
+	}
+	defer tx.ExecContext(ctx, `CLOSE anonymize_rows`)
+
+	setter := "$1"
+	if col.typ == typeJSON {
+		setter = "$1::jsonb"
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = %s WHERE tableoid = $2::oid AND ctid = $3::tid`, col.table, col.name, setter))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var changed int64
+	for {
+		updates, fetched, err := fetchBatch(ctx, tx, p, col)
+		if err != nil {
+			return changed, err
+		}
+		for _, u := range updates {
+			if _, err := stmt.ExecContext(ctx, u.value, u.tableOID, u.ctid); err != nil {
+				return changed, err
+			}
+		}
+		changed += int64(len(updates))
+		if fetched < batchSize {
+			return changed, nil
+		}
+	}
+}
+
+// fetchBatch reads the next rows from the cursor and returns the values that change
+func fetchBatch(ctx context.Context, tx *sql.Tx, p *Pseudonymizer, col column) ([]update, int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM anonymize_rows`, batchSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var updates []update
+	fetched := 0
+	for rows.Next() {
+		fetched++
+		var tableOID, ctid string
+		switch col.typ {
+		case typeText:
+			var value string
+			if err := rows.Scan(&tableOID, &ctid, &value); err != nil {
+				return nil, 0, err
+			}
+			if scrubbed := col.scrub(p, value); scrubbed != value {
+				updates = append(updates, update{tableOID, ctid, scrubbed})
+			}
+		case typeTextArray:
+			var values pq.StringArray
+			if err := rows.Scan(&tableOID, &ctid, &values); err != nil {
+				return nil, 0, err
+			}
+			scrubbed := make(pq.StringArray, len(values))
+			changed := false
+			for i, value := range values {
+				scrubbed[i] = col.scrub(p, value)
+				changed = changed || scrubbed[i] != value
+			}
+			if changed {
+				updates = append(updates, update{tableOID, ctid, scrubbed})
+			}
+		case typeJSON:
+			var value string
+			if err := rows.Scan(&tableOID, &ctid, &value); err != nil {
+				return nil, 0, err
+			}
+			scrubbed, err := p.JSON([]byte(value))
+			if err != nil {
+				return nil, 0, err
+			}
+			if !bytes.Equal(scrubbed, []byte(value)) {
+				updates = append(updates, update{tableOID, ctid, string(scrubbed)})
+			}
+		}
+	}
+	return updates, fetched, rows.Err()
+}
+
+// JSON scrubs every string in a JSON document, and object keys that are known
+// identifiers. A document with nothing to scrub is returned as it was.
+func (p *Pseudonymizer) JSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	changed := false
+	document = p.scrubJSON("", document, &changed)
+	if !changed {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// scrubJSON scrubs a decoded JSON value found under key, setting changed if anything was replaced
+func (p *Pseudonymizer) scrubJSON(key string, value interface{}, changed *bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		scrubbed := p.Value(key, v)
+		*changed = *changed || scrubbed != v
+		return scrubbed
+	case []interface{}:
+		for i, item := range v {
+			v[i] = p.scrubJSON(key, item, changed)
+		}
+		return v
+	case map[string]interface{}:
+		scrubbed := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if pseudonym, ok := p.known[k]; ok {
+				k = pseudonym
+				*changed = true
+			}
+			scrubbed[k] = p.scrubJSON(k, item, changed)
+		}
+		return scrubbed
+	}
+	return value
+}
+
+// scrubProber scrubs the prober of a probe, "server" or "agent:<username>"
+func scrubProber(p *Pseudonymizer, prober string) string {
+	if username, ok := strings.CutPrefix(prober, "agent:"); ok {
+		return "agent:" + p.Username(username)
+	}
+	return prober
+}
@@ -0,0 +1,113 @@
+package anonymize
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPseudonymizer_Deterministic(t *testing.T) {
+	a, b := NewPseudonymizer([]byte("key")), NewPseudonymizer([]byte("key"))
+	other := NewPseudonymizer([]byte("other key"))
+
+	email := a.Email("alice@corp.example.com")
+	assert.Regexp(t, `^user-[0-9a-f]{16}@example\.invalid$`, email)
+	assert.Equal(t, email, a.Email("alice@corp.example.com"))
+	assert.Equal(t, email, b.Email("alice@corp.example.com"), "the same key gives the same pseudonyms")
+	assert.NotEqual(t, email, other.Email("alice@corp.example.com"))
+
+	assert.Regexp(t, `^user-[0-9a-f]{12}$`, a.Username("alice"))
+	assert.Regexp(t, `^host-[0-9a-f]{12}$`, a.Hostname("web-01.corp.example.com"))
+	assert.Regexp(t, `^Organization [0-9a-f]{12}$`, a.OrgName("Acme Corp"))
+	assert.NotEqual(t, a.Username("alice"), a.Username("bob"))
+
+	// Identifiers that say nothing about anyone are kept
+	assert.Equal(t, "root", a.Username("root"))
+	assert.Equal(t, "localhost", a.Hostname("localhost"))
+	assert.Equal(t, "", a.Email(""))
+}
+
+func TestPseudonymizer_NoCollisions(t *testing.T) {
+	// IPv4 pseudonyms have 24 bits, so enough addresses collide on the first attempt
+	p := NewPseudonymizer([]byte("key"))
+	seen := make(map[string]string)
+	for i := 0; i < 20000; i++ {
+		ip := fmt.Sprintf("192.168.%d.%d", i/250, i%250+1)
+		pseudonym := p.IP(ip)
+		if previous, ok := seen[pseudonym]; ok {
+			t.Fatalf("%s and %s both became %s", previous, ip, pseudonym)
+		}
+		seen[pseudonym] = ip
+	}
+}
+
+func TestPseudonymizer_IP(t *testing.T) {
+	p := NewPseudonymizer([]byte("key"))
+
+	pseudonym := p.IP("203.0.113.7")
+	assert.True(t, strings.HasPrefix(pseudonym, "10."), pseudonym)
+	assert.Equal(t, pseudonym+"/24", p.IP("203.0.113.7/24"), "a prefix keeps its length")
+	assert.True(t, strings.HasPrefix(p.IP("2001:db8::1"), "fd"))
+
+	for _, kept := range []string{"127.0.0.1", "0.0.0.0", "::1", "224.0.0.251", "255.255.255.0", "not an ip", "10.0.0.1/abc"} {
+		assert.Equal(t, kept, p.IP(kept))
+	}
+}
+
+func TestPseudonymizer_Text(t *testing.T) {
+	p := NewPseudonymizer([]byte("key"))
+	host := p.Hostname("web-01")
+	user := p.Username("alice")
+
+	assert.Equal(t, host, p.Text("web-01"))
+	assert.Equal(t, p.IP("203.0.113.7"), p.Text("203.0.113.7"))
+	assert.Equal(t,
+		"probe of "+host+" ("+p.IP("203.0.113.7")+") failed, notified "+p.Email("ops@corp.example.com"),
+		p.Text("probe of web-01 (203.0.113.7) failed, notified ops@corp.example.com"))
+	assert.Equal(t, "/home/"+user+"/.ssh", p.Text("/home/alice/.ssh"))
+	assert.Equal(t, "/home/root", p.Text("/home/root"))
+
+	// Unknown words are not identifiers
+	assert.Equal(t, "disk full on /var", p.Text("disk full on /var"))
+}
+
+func TestPseudonymizer_JSON(t *testing.T) {
+	p := NewPseudonymizer([]byte("key"))
+	host := p.Hostname("web-01")
+
+	data := []byte(`{"hostname":"db-01","users":[{"user":"bob","uid":1001,"home":"/home/bob"}],` +
+		`"web-01":{"load":0.25},"ips":["203.0.113.7"],"note":"a <b> & c"}`)
+	scrubbed, err := p.JSON(data)
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(scrubbed, &doc))
+	assert.Equal(t, p.Hostname("db-01"), doc["hostname"], "values under known keys are identifiers")
+	users := doc["users"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, p.Username("bob"), users["user"])
+	assert.Equal(t, "/home/"+p.Username("bob"), users["home"])
+	assert.Equal(t, float64(1001), users["uid"])
+	assert.Contains(t, doc, host, "keys that are known identifiers are replaced")
+	assert.NotContains(t, doc, "web-01")
+	assert.Equal(t, []interface{}{p.IP("203.0.113.7")}, doc["ips"])
+	assert.Contains(t, string(scrubbed), `"a <b> & c"`)
+
+	// Documents without identifiers are left byte for byte
+	unchanged := []byte(`{"load": 1.50, "status": "ok"}`)
+	scrubbed, err = p.JSON(unchanged)
+	require.NoError(t, err)
+	assert.Equal(t, unchanged, scrubbed)
+
+	_, err = p.JSON([]byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestScrubProber(t *testing.T) {
+	p := NewPseudonymizer([]byte("key"))
+	assert.Equal(t, "server", scrubProber(p, "server"))
+	assert.Equal(t, "agent:"+p.Username("alice"), scrubProber(p, "agent:alice"))
+}
@@ -0,0 +1,242 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Kinds of identifier, each with its own pseudonym format
+const (
+	KindEmail    = "email"
+	KindUsername = "username"
+	KindHostname = "hostname"
+	KindOrgName  = "org_name"
+	KindIP       = "ip"
+)
+
+// preserved are values that identify no one and that reports rely on, such as
+// system accounts; they are never replaced
+var preserved = map[string]map[string]bool{
+	KindUsername: setOf("root", "daemon", "bin", "sys", "sync", "games", "man", "lp", "mail", "news",
+		"uucp", "proxy", "www-data", "backup", "list", "irc", "gnats", "nobody", "nfsnobody", "sshd",
+		"messagebus", "dbus", "polkitd", "chrony", "ntp", "postfix", "apache", "nginx", "postgres",
+		"mysql", "ubuntu", "ec2-user", "centos", "fedora", "debian", "cloud-user"),
+	KindHostname: setOf("localhost", "localhost.localdomain", "localhost6"),
+}
+
+// jsonKeyKinds maps keys of report data to the kind of identifier their string values hold
+// Values under other keys are scrubbed as free text.
+var jsonKeyKinds = map[string]string{
+	"hostname":  KindHostname,
+	"host_name": KindHostname,
+	"fqdn":      KindHostname,
+	"nodename":  KindHostname,
+	"username":  KindUsername,
+	"user_name": KindUsername,
+	"user":      KindUsername,
+	"login":     KindUsername,
+	"owner":     KindUsername,
+	"email":     KindEmail,
+	"mail":      KindEmail,
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	ipv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	tokenPattern = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9._-]*`)
+)
+
+// Pseudonymizer replaces identifiers with pseudonyms derived from a key
+// The same identifier always gets the same pseudonym, and two identifiers never
+// share one. Identifiers it has replaced are also recognized in free text, so
+// Text and JSON should be used after the columns that hold them.
+type Pseudonymizer struct {
+	key      []byte
+	assigned map[string]string // kind + original to pseudonym
+	known    map[string]string // Original to pseudonym of any kind, for free text
+	byKind   map[string]map[string]bool
+	used     map[string]bool // Pseudonyms handed out
+}
+
+// NewPseudonymizer creates a pseudonymizer whose pseudonyms are derived from key
+func NewPseudonymizer(key []byte) *Pseudonymizer {
+	return &Pseudonymizer{
+		key:      key,
+		assigned: make(map[string]string),
+		known:    make(map[string]string),
+		byKind:   make(map[string]map[string]bool),
+		used:     make(map[string]bool),
+	}
+}
+
+// Email returns the pseudonym of an email address
+func (p *Pseudonymizer) Email(email string) string {
+	return p.assign(KindEmail, email, func(sum []byte) string {
+		return "user-" + hex.EncodeToString(sum[:8]) + "@example.invalid"
+	})
+}
+
+// Username returns the pseudonym of a username, or the username itself for system accounts
+func (p *Pseudonymizer) Username(username string) string {
+	return p.assign(KindUsername, username, func(sum []byte) string {
+		return "user-" + hex.EncodeToString(sum[:6])
+	})
+}
+
+// Hostname returns the pseudonym of a hostname
+func (p *Pseudonymizer) Hostname(hostname string) string {
+	return p.assign(KindHostname, hostname, func(sum []byte) string {
+		return "host-" + hex.EncodeToString(sum[:6])
+	})
+}
+
+// OrgName returns the pseudonym of an organization name
+func (p *Pseudonymizer) OrgName(name string) string {
+	return p.assign(KindOrgName, name, func(sum []byte) string {
+		return "Organization " + hex.EncodeToString(sum[:6])
+	})
+}
+
+// IP returns the pseudonym of an IP address or CIDR prefix, keeping its family and
+// prefix length, or value itself if it is neither. Loopback, unspecified, and
+// multicast addresses and netmasks say nothing about a host and are kept.
+func (p *Pseudonymizer) IP(value string) string {
+	address, prefix, isCIDR := strings.Cut(value, "/")
+	ip := net.ParseIP(address)
+	if ip == nil || (isCIDR && !isDigits(prefix)) {
+		return value
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() || isNetmask(ip) {
+		return value
+	}
+
+	ip4 := ip.To4()
+	pseudonym := p.assign(KindIP, ip.String(), func(sum []byte) string {
+		if ip4 != nil {
+			return net.IPv4(10, sum[0], sum[1], sum[2]).String()
+		}
+		// Unique local addresses (fd00::/8)
+		mapped := make(net.IP, net.IPv6len)
+		mapped[0] = 0xfd
+		copy(mapped[1:], sum[:15])
+		return mapped.String()
+	})
+	if isCIDR {
+		return pseudonym + "/" + prefix
+	}
+	return pseudonym
+}
+
+// Text scrubs free text: a value that is a known identifier or an IP address is
+// replaced whole, and otherwise email addresses, IPv4 addresses, known hostnames,
+// and known usernames as path segments (such as /home/alice) are replaced within it
+func (p *Pseudonymizer) Text(text string) string {
+	if pseudonym, ok := p.known[text]; ok {
+		return pseudonym
+	}
+	if pseudonym := p.IP(text); pseudonym != text {
+		return pseudonym
+	}
+
+	text = emailPattern.ReplaceAllStringFunc(text, p.Email)
+	text = ipv4Pattern.ReplaceAllStringFunc(text, p.IP)
+	text = tokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		if p.byKind[KindHostname][token] {
+			return p.Hostname(token)
+		}
+		return token
+	})
+	if strings.Contains(text, "/") {
+		segments := strings.Split(text, "/")
+		for i, segment := range segments {
+			if p.byKind[KindUsername][segment] {
+				segments[i] = p.Username(segment)
+			}
+		}
+		text = strings.Join(segments, "/")
+	}
+	return text
+}
+
+// Value scrubs a value of report data found under key
+// Known keys such as hostname and email say what the value is; others are free text.
+func (p *Pseudonymizer) Value(key, value string) string {
+	switch jsonKeyKinds[strings.ToLower(key)] {
+	case KindHostname:
+		return p.Hostname(value)
+	case KindUsername:
+		return p.Username(value)
+	case KindEmail:
+		return p.Email(value)
+	}
+	return p.Text(value)
+}
+
+// assign returns the pseudonym of an identifier, deriving it the first time
+// A derived pseudonym that is already taken is derived again with a counter.
+func (p *Pseudonymizer) assign(kind, original string, format func(sum []byte) string) string {
+	if original == "" || preserved[kind][original] {
+		return original
+	}
+	id := kind + "\x00" + original
+	if pseudonym, ok := p.assigned[id]; ok {
+		return pseudonym
+	}
+
+	var pseudonym string
+	for attempt := uint32(0); ; attempt++ {
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write([]byte(id))
+		_ = binary.Write(mac, binary.BigEndian, attempt)
+		pseudonym = format(mac.Sum(nil))
+		if !p.used[pseudonym] {
+			break
+		}
+	}
+
+	p.used[pseudonym] = true
+	p.assigned[id] = pseudonym
+	if _, ok := p.known[original]; !ok {
+		p.known[original] = pseudonym
+	}
+	if p.byKind[kind] == nil {
+		p.byKind[kind] = make(map[string]bool)
+	}
+	p.byKind[kind][original] = true
+	return pseudonym
+}
+
+// isNetmask reports whether ip is an IPv4 netmask, all ones then all zeros
+func isNetmask(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	bits := binary.BigEndian.Uint32(ip4)
+	return bits != 0 && ^bits&(^bits+1) == 0
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func setOf(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,161 @@
+// Package apierror defines the errors handlers report to clients. Handlers pass them to
+// gin's c.Error and return; middleware.ErrorHandler renders the response, so the status
+// and JSON envelope of each kind of error are decided in one place:
+//
+//	{"error": "host group not found"}
+//	{"error": "user not in your organization", "message": "You can only manage users in your own organization."}
+//	{"error": "invalid rule", "message": "unknown field \"colour\"", "field": "rule"}
+//
+// The kinds are the sentinels below, which the storage package uses as its own, so a
+// storage error can be reported as is: From maps storage.ErrNotFound to a 404 and a
+// named conflict such as storage.ErrHostGroupNameTaken to a 409 with its message.
+//
+// A few responses are still written by handlers: those with statuses no kind maps to
+// (412 from conditional updates, 413, 503), errors carrying extra fields (such as the
+// valid roles, or the missing host ID), ingest responses, which are encoded in the
+// agent's format (JSON, CBOR, or MessagePack), and OAuth token endpoint errors, whose
+// shape RFC 6749 fixes.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kinds of error, compared with errors.Is. Every *Error of a kind matches its sentinel.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("invalid input")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Error is an error with the response it should produce
+type Error struct {
+	// Message is the response's error, a short lower-case summary
+	Message string
+	// Detail is an optional longer explanation, rendered as message
+	Detail string
+	// Field optionally names the request field at fault
+	Field string
+	// Err is the underlying cause of an internal error. It is logged, never shown.
+	Err error
+
+	kind error // One of the sentinels above, or nil for internal errors
+}
+
+// NotFound reports a missing resource, or one the caller may not know exists (404)
+func NotFound(message string) *Error {
+	return &Error{Message: message, kind: ErrNotFound}
+}
+
+// Conflict reports a write that conflicts with the current state of a resource (409)
+func Conflict(message string) *Error {
+	return &Error{Message: message, kind: ErrConflict}
+}
+
+// Validation reports a malformed request (400)
+func Validation(message string) *Error {
+	return &Error{Message: message, kind: ErrValidation}
+}
+
+// Unauthorized reports a request without valid credentials (401)
+func Unauthorized(message string) *Error {
+	return &Error{Message: message, kind: ErrUnauthorized}
+}
+
+// Forbidden reports a request the caller is not allowed to make (403)
+func Forbidden(message string) *Error {
+	return &Error{Message: message, kind: ErrForbidden}
+}
+
+// Internal reports a failure of the server (500). message is shown to the client and
+// err is logged.
+func Internal(message string, err error) *Error {
+	return &Error{Message: message, Err: err}
+}
+
+// WithDetail returns a copy of the error with a longer explanation. Errors are copied
+// since package-level errors such as storage conflicts are shared.
+func (e *Error) WithDetail(detail string) *Error {
+	copied := *e
+	copied.Detail = detail
+	return &copied
+}
+
+// WithField returns a copy of the error naming the request field at fault
+func (e *Error) WithField(field string) *Error {
+	copied := *e
+	copied.Field = field
+	return &copied
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel of the error's kind
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// Status returns the HTTP status of the error's kind
+func (e *Error) Status() int {
+	switch e.kind {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrConflict:
+		return http.StatusConflict
+	case ErrValidation:
+		return http.StatusBadRequest
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Body returns the JSON response body of the error
+func (e *Error) Body() map[string]string {
+	body := map[string]string{"error": e.Message}
+	if e.Detail != "" {
+		body["message"] = e.Detail
+	}
+	if e.Field != "" {
+		body["field"] = e.Field
+	}
+	return body
+}
+
+// From returns the *Error that err is or wraps. Other errors are classified by the
+// sentinel they match, with the sentinel's message; errors of no kind are internal
+// errors with a generic message, so their text is never shown to clients.
+func From(err error) *Error {
+	return Wrap(err, "internal server error")
+}
+
+// Wrap is From with the message of internal errors, for handlers that report a failed
+// operation: a named storage conflict is passed on, anything unexpected becomes an
+// internal error with message.
+func Wrap(err error, message string) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, kind := range []error{ErrNotFound, ErrConflict, ErrValidation, ErrUnauthorized, ErrForbidden} {
+		if errors.Is(err, kind) {
+			return &Error{Message: kind.Error(), Err: err, kind: kind}
+		}
+	}
+	return Internal(message, err)
+}
@@ -0,0 +1,70 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestKinds(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		kind       error
+		wantStatus int
+	}{
+		{"not found", NotFound("host not found"), ErrNotFound, http.StatusNotFound},
+		{"conflict", Conflict("name taken"), ErrConflict, http.StatusConflict},
+		{"validation", Validation("invalid rule"), ErrValidation, http.StatusBadRequest},
+		{"unauthorized", Unauthorized("unauthorized"), ErrUnauthorized, http.StatusUnauthorized},
+		{"forbidden", Forbidden("not allowed"), ErrForbidden, http.StatusForbidden},
+		{"internal", Internal("failed", errors.New("boom")), nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Status(); got != tt.wantStatus {
+				t.Errorf("Status() = %d, want %d", got, tt.wantStatus)
+			}
+			for _, kind := range []error{ErrNotFound, ErrConflict, ErrValidation, ErrUnauthorized, ErrForbidden} {
+				wrapped := fmt.Errorf("context: %w", tt.err)
+				if got := errors.Is(wrapped, kind); got != (kind == tt.kind) {
+					t.Errorf("errors.Is(%v) = %v", kind, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFrom(t *testing.T) {
+	conflict := Conflict("host group name already exists")
+	if got := From(fmt.Errorf("insert: %w", conflict)); got != conflict {
+		t.Errorf("From(wrapped *Error) = %v, want the wrapped error", got)
+	}
+
+	got := From(fmt.Errorf("query: %w", ErrNotFound))
+	if got.Status() != http.StatusNotFound || got.Message != "not found" {
+		t.Errorf("From(sentinel) = %+v", got)
+	}
+
+	cause := errors.New("connection refused")
+	got = From(cause)
+	if got.Status() != http.StatusInternalServerError || got.Message != "internal server error" || !errors.Is(got, cause) {
+		t.Errorf("From(unknown) = %+v", got)
+	}
+}
+
+func TestWithCopies(t *testing.T) {
+	shared := Forbidden("user not in your organization")
+	detailed := shared.WithDetail("You can only manage users in your own organization.").WithField("user_id")
+	if shared.Detail != "" || shared.Field != "" {
+		t.Errorf("With* modified the original error: %+v", shared)
+	}
+	body := detailed.Body()
+	if body["message"] == "" || body["field"] != "user_id" || body["error"] != shared.Message {
+		t.Errorf("Body() = %v", body)
+	}
+	if !errors.Is(detailed, ErrForbidden) {
+		t.Error("copy lost the error's kind")
+	}
+}
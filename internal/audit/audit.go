@@ -0,0 +1,88 @@
+// Package audit records state-changing operations in an organization's audit log.
+//
+// Handlers call Record once an operation has succeeded. The recorder fills in who made
+// the request (user, username, authentication method, and any system administrator
+// impersonating the user) and where it came from
+// (request ID, client IP, and user agent), so call sites only describe the action and
+// its target. Recording is best effort: a failure is logged and the request it
+// describes still succeeds, since the operation has already been applied.
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+)
+
+// maxUserAgentLength bounds the user agent stored with an event
+const maxUserAgentLength = 500
+
+// Store persists audit events
+type Store interface {
+	CreateAuditEvent(event *models.AuditEvent) error
+}
+
+// Recorder writes audit events for requests
+type Recorder struct {
+	store Store
+}
+
+// NewRecorder creates a recorder backed by store
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{store: store}
+}
+
+// Record appends event to the audit log, taking its actor and request metadata from c
+// event.OrgID defaults to the organization of the authenticated caller. A nil recorder
+// records nothing.
+func (r *Recorder) Record(c *gin.Context, event models.AuditEvent) {
+	if r == nil {
+		return
+	}
+
+	if event.OrgID == "" {
+		event.OrgID = middleware.GetOrgID(c)
+	}
+	if event.OrgID == "" {
+		// Every event belongs to an organization; unauthenticated requests change nothing worth auditing
+		return
+	}
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		event.ActorUserID = principal.UserID
+		event.AuthMethod = principal.Method
+		if principal.User != nil {
+			event.ActorUsername = principal.User.Username
+		}
+		if principal.Impersonator != nil {
+			event.ImpersonatorUserID = principal.Impersonator.ID
+			event.ImpersonatorUsername = principal.Impersonator.Username
+		}
+	} else {
+		event.ActorUserID = middleware.GetUserID(c)
+		if user, ok := c.Get("user"); ok {
+			if userObj, ok := user.(*models.User); ok {
+				event.ActorUsername = userObj.Username
+			}
+		}
+	}
+	event.RequestID = c.GetString(logger.RequestIDKey)
+	event.ClientIP = c.ClientIP()
+	event.UserAgent = truncate(c.Request.UserAgent(), maxUserAgentLength)
+
+	if err := r.store.CreateAuditEvent(&event); err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("action", event.Action).
+			Str("target_id", event.TargetID).
+			Msg("Failed to record audit event")
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
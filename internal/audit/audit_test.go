@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// testContext returns a context for a request from 203.0.113.7 with the given user agent
+func testContext(userAgent string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/hosts/host-1", nil)
+	c.Request.RemoteAddr = "203.0.113.7:41000"
+	c.Request.Header.Set("User-Agent", userAgent)
+	c.Set(logger.RequestIDKey, "request-1")
+	return c
+}
+
+func TestRecorder_Record(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Acme")
+	admin, _ := store.CreateUser("alice", "alice@example.com", "hash", org.ID, "admin")
+
+	c := testContext("snailctl/1.0")
+	c.Set("principal", auth.NewUserPrincipal(admin, auth.MethodAPIKey, "key-1", nil))
+	c.Set("org_id", org.ID)
+
+	NewRecorder(store).Record(c, models.AuditEvent{
+		Action:     models.AuditHostDeleted,
+		TargetType: models.AuditTargetHost,
+		TargetID:   "host-1",
+		Details:    map[string]string{"reason": models.HostDeletionDecommissioned},
+	})
+
+	page, err := store.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	event := page.Events[0]
+	assert.Equal(t, org.ID, event.OrgID)
+	assert.Equal(t, models.AuditHostDeleted, event.Action)
+	assert.Equal(t, admin.ID, event.ActorUserID)
+	assert.Equal(t, "alice", event.ActorUsername)
+	assert.Equal(t, auth.MethodAPIKey, event.AuthMethod)
+	assert.Equal(t, "host-1", event.TargetID)
+	assert.Equal(t, models.HostDeletionDecommissioned, event.Details["reason"])
+	assert.Equal(t, "request-1", event.RequestID)
+	assert.Equal(t, "203.0.113.7", event.ClientIP)
+	assert.Equal(t, "snailctl/1.0", event.UserAgent)
+	assert.False(t, event.CreatedAt.IsZero())
+}
+
+func TestRecorder_Record_WithoutPrincipal(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Acme")
+	admin, _ := store.CreateUser("alice", "alice@example.com", "hash", org.ID, "admin")
+
+	c := testContext(strings.Repeat("a", maxUserAgentLength+100))
+	c.Set("user", admin)
+	c.Set("user_id", admin.ID)
+
+	NewRecorder(store).Record(c, models.AuditEvent{OrgID: org.ID, Action: models.AuditUserCreated})
+
+	page, err := store.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, admin.ID, page.Events[0].ActorUserID)
+	assert.Equal(t, "alice", page.Events[0].ActorUsername)
+	assert.Empty(t, page.Events[0].AuthMethod)
+	assert.Len(t, page.Events[0].UserAgent, maxUserAgentLength)
+}
+
+func TestRecorder_Record_NoOrganization(t *testing.T) {
+	store := &failingStore{}
+	NewRecorder(store).Record(testContext("curl"), models.AuditEvent{Action: models.AuditUserCreated})
+	assert.Zero(t, store.calls)
+
+	// A nil recorder records nothing
+	var recorder *Recorder
+	recorder.Record(testContext("curl"), models.AuditEvent{OrgID: "org-1", Action: models.AuditUserCreated})
+}
+
+func TestRecorder_Record_StoreError(t *testing.T) {
+	store := &failingStore{}
+	// The failure is logged, not returned or panicked on
+	NewRecorder(store).Record(testContext("curl"), models.AuditEvent{OrgID: "org-1", Action: models.AuditUserCreated})
+	assert.Equal(t, 1, store.calls)
+}
+
+type failingStore struct {
+	calls int
+}
+
+func (s *failingStore) CreateAuditEvent(*models.AuditEvent) error {
+	s.calls++
+	return errors.New("database unavailable")
+}
@@ -15,8 +15,16 @@ const (
 	APIKeyLength = 32
 	// BcryptCost is the cost factor for bcrypt password hashing
 	BcryptCost = 12
+	// APIKeyPrefixLength is the length of the prefix keys are looked up by, unique per key
+	APIKeyPrefixLength = 16
+	// LegacyAPIKeyPrefixLength is the prefix length of keys created before prefixes were
+	// unique; such keys are still found by it
+	LegacyAPIKeyPrefixLength = 8
 )
 
+// apiKeyEncodedLength is the length of a generated key, base64 of APIKeyLength bytes
+var apiKeyEncodedLength = base64.URLEncoding.EncodedLen(APIKeyLength)
+
 // HashPassword hashes a password using bcrypt
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
@@ -44,12 +52,8 @@ func GenerateAPIKey() (plainKey string, keyHash string, keyPrefix string, err er
 	// Encode as base64 for the plain key (user-friendly)
 	plainKey = base64.URLEncoding.EncodeToString(keyBytes)
 
-	// Extract prefix (first 8 characters) for efficient lookup
-	if len(plainKey) >= 8 {
-		keyPrefix = plainKey[:8]
-	} else {
-		keyPrefix = plainKey
-	}
+	// Extract prefix for efficient lookup
+	keyPrefix = GetKeyPrefix(plainKey)
 
 	// Hash the key for storage (using bcrypt)
 	keyHashBytes, err := bcrypt.GenerateFromPassword(keyBytes, BcryptCost)
@@ -83,11 +87,7 @@ func HashAPIKey(plainKey string) (keyHash string, keyPrefix string, err error) {
 	}
 
 	// Extract prefix
-	if len(plainKey) >= 8 {
-		keyPrefix = plainKey[:8]
-	} else {
-		keyPrefix = plainKey
-	}
+	keyPrefix = GetKeyPrefix(plainKey)
 
 	keyHashBytes, err := bcrypt.GenerateFromPassword(keyBytes, BcryptCost)
 	if err != nil {
@@ -99,12 +99,32 @@ func HashAPIKey(plainKey string) (keyHash string, keyPrefix string, err error) {
 
 // GetKeyPrefix extracts the prefix from a plain API key
 func GetKeyPrefix(plainKey string) string {
-	if len(plainKey) >= 8 {
-		return plainKey[:8]
+	if len(plainKey) >= APIKeyPrefixLength {
+		return plainKey[:APIKeyPrefixLength]
 	}
 	return plainKey
 }
 
+// GetKeyPrefixes returns the prefixes a plain API key may be stored under: its
+// prefix and, for keys created before prefixes were unique, its legacy prefix
+func GetKeyPrefixes(plainKey string) []string {
+	prefix := GetKeyPrefix(plainKey)
+	if len(plainKey) < APIKeyPrefixLength {
+		return []string{prefix}
+	}
+	return []string{prefix, plainKey[:LegacyAPIKeyPrefixLength]}
+}
+
+// IsAPIKeyFormat reports whether value could be a generated API key, so that
+// malformed keys are rejected without looking up candidates
+func IsAPIKeyFormat(value string) bool {
+	if len(value) != apiKeyEncodedLength {
+		return false
+	}
+	_, err := base64.URLEncoding.DecodeString(value)
+	return err == nil
+}
+
 // ConstantTimeCompare performs a constant-time comparison of two strings
 // This helps prevent timing attacks
 func ConstantTimeCompare(a, b string) bool {
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// allowedMethods are the HTTP methods accepted in endpoint patterns
+var allowedMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
+// EndpointMatcher decides whether a request may be made with an endpoint-restricted API key
+//
+// Patterns have the form "[METHOD ]/path". Without a method any method matches.
+// A path segment of the form ":name" matches any single segment, and a trailing "/*"
+// matches the path itself and everything below it. Examples:
+//
+//	POST /api/v1/ingest
+//	GET /api/v1/hosts/:host_id
+//	/api/v1/hosts/*
+type EndpointMatcher struct {
+	rules []endpointRule
+}
+
+type endpointRule struct {
+	method   string // empty matches any method
+	segments []string
+	prefix   bool
+}
+
+// CompileEndpoints parses endpoint patterns into a matcher
+// It returns an error describing the first invalid pattern
+func CompileEndpoints(patterns []string) (*EndpointMatcher, error) {
+	m := &EndpointMatcher{rules: make([]endpointRule, 0, len(patterns))}
+	for _, pattern := range patterns {
+		rule, err := compileEndpoint(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+func compileEndpoint(pattern string) (endpointRule, error) {
+	var rule endpointRule
+
+	p := strings.TrimSpace(pattern)
+	if method, rest, ok := strings.Cut(p, " "); ok {
+		method = strings.ToUpper(method)
+		if !allowedMethods[method] {
+			return rule, fmt.Errorf("invalid endpoint pattern %q: unknown method %q", pattern, method)
+		}
+		rule.method = method
+		p = strings.TrimSpace(rest)
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		return rule, fmt.Errorf("invalid endpoint pattern %q: path must start with /", pattern)
+	}
+
+	if p == "/*" {
+		rule.prefix = true
+		return rule, nil
+	}
+	if trimmed, ok := strings.CutSuffix(p, "/*"); ok {
+		rule.prefix = true
+		p = trimmed
+	}
+
+	for _, segment := range splitPath(p) {
+		if segment == "" || strings.Contains(segment, "*") || segment == "." || segment == ".." || segment == ":" {
+			return rule, fmt.Errorf("invalid endpoint pattern %q: bad path segment %q", pattern, segment)
+		}
+		rule.segments = append(rule.segments, segment)
+	}
+	return rule, nil
+}
+
+// Allows reports whether any pattern matches the request method and path
+func (m *EndpointMatcher) Allows(method, requestPath string) bool {
+	segments := splitPath(path.Clean("/" + requestPath))
+	for _, rule := range m.rules {
+		if rule.matches(method, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r endpointRule) matches(method string, segments []string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	if len(segments) < len(r.segments) || (!r.prefix && len(segments) != len(r.segments)) {
+		return false
+	}
+	for i, want := range r.segments {
+		if strings.HasPrefix(want, ":") {
+			continue
+		}
+		if segments[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPath splits a path into its segments, ignoring leading and trailing slashes
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestCompileEndpoints_Invalid(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"api/v1/ingest",
+		"FETCH /api/v1/hosts",
+		"/api/*/hosts",
+		"/api//hosts",
+		"/api/../admin",
+	} {
+		if _, err := CompileEndpoints([]string{pattern}); err == nil {
+			t.Errorf("CompileEndpoints(%q) expected error", pattern)
+		}
+	}
+}
+
+func TestEndpointMatcher_Allows(t *testing.T) {
+	matcher, err := CompileEndpoints([]string{
+		"POST /api/v1/ingest",
+		"get /api/v1/hosts/:host_id",
+		"/api/v1/export/*",
+	})
+	if err != nil {
+		t.Fatalf("CompileEndpoints() error = %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"POST", "/api/v1/ingest", true},
+		{"POST", "/api/v1/ingest/", true},
+		{"GET", "/api/v1/ingest", false},
+		{"POST", "/api/v1/ingest/extra", false},
+		{"GET", "/api/v1/hosts/abc", true},
+		{"GET", "/api/v1/hosts", false},
+		{"DELETE", "/api/v1/hosts/abc", false},
+		{"GET", "/api/v1/export", true},
+		{"POST", "/api/v1/export/a/b", true},
+		{"GET", "/api/v1/exports", false},
+		{"POST", "/api/v1/ingest/../users", false},
+	}
+
+	for _, tt := range tests {
+		if got := matcher.Allows(tt.method, tt.path); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package auth
+
+// EnrollmentTokenPrefix starts the tokens agents exchange for an ingest key at enrollment
+// They are generated and hashed like delegated tokens (GenerateOAuthToken).
+const EnrollmentTokenPrefix = "sbet_"
+
+// EnrollmentEndpoints are the endpoints an API key issued at enrollment may call
+var EnrollmentEndpoints = []string{
+	"POST /api/v1/ingest",
+	"POST /api/v1/ingest/batch",
+}
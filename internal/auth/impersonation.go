@@ -0,0 +1,12 @@
+package auth
+
+import "strings"
+
+// ImpersonationTokenPrefix starts the tokens system administrators act as other users with
+// They are generated and hashed like delegated tokens (GenerateOAuthToken).
+const ImpersonationTokenPrefix = "sbit_"
+
+// LooksLikeImpersonationToken reports whether a bearer credential is an impersonation token
+func LooksLikeImpersonationToken(token string) bool {
+	return strings.HasPrefix(token, ImpersonationTokenPrefix)
+}
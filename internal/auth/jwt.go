@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or fail signature checks
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for well-formed tokens past their exp claim
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// jwtHeader is the only JOSE header accepted and produced: HMAC-SHA256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the JWT claims snailbus understands
+type Claims struct {
+	Subject   string   `json:"sub"` // User ID
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"` // Required
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	// AllowedEndpoints limits the token to these endpoint patterns, like API key restrictions
+	AllowedEndpoints []string `json:"allowed_endpoints,omitempty"`
+}
+
+// Audience is the aud claim, which may be a single string or a list
+type Audience []string
+
+// UnmarshalJSON accepts both forms of the aud claim
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether aud lists audience
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// SignJWT encodes claims as an HS256-signed JWT
+func SignJWT(claims *Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + jwtSignature(signingInput, secret), nil
+}
+
+// ParseJWT verifies an HS256 JWT and returns its claims
+// Tokens using any other algorithm are rejected, as are tokens without exp
+func ParseJWT(token string, secret []byte, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	expected := jwtSignature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Subject == "" || claims.ExpiresAt == 0 {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// LooksLikeJWT reports whether a bearer credential has the three-part JWT shape
+// API keys are base64url encoded and never contain dots
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func jwtSignature(signingInput string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWT_RoundTrip(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Now()
+
+	token, err := SignJWT(&Claims{
+		Subject:          "user-1",
+		Issuer:           "snailbus",
+		Audience:         Audience{"api"},
+		ExpiresAt:        now.Add(time.Hour).Unix(),
+		AllowedEndpoints: []string{"POST /api/v1/ingest"},
+	}, secret)
+	require.NoError(t, err)
+	assert.True(t, LooksLikeJWT(token))
+
+	claims, err := ParseJWT(token, secret, now)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.True(t, claims.Audience.Contains("api"))
+	assert.Equal(t, []string{"POST /api/v1/ingest"}, claims.AllowedEndpoints)
+
+	// Expired and not-yet-valid tokens
+	_, err = ParseJWT(token, secret, now.Add(2*time.Hour))
+	assert.Equal(t, ErrTokenExpired, err)
+	early, _ := SignJWT(&Claims{Subject: "user-1", ExpiresAt: now.Add(time.Hour).Unix(), NotBefore: now.Add(time.Minute).Unix()}, secret)
+	_, err = ParseJWT(early, secret, now)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// Wrong secret
+	_, err = ParseJWT(token, []byte("another-secret-another-secret-00"), now)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// Missing exp
+	noExp, _ := SignJWT(&Claims{Subject: "user-1"}, secret)
+	_, err = ParseJWT(noExp, secret, now)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestJWT_RejectsOtherAlgorithms(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	token, err := SignJWT(&Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()}, secret)
+	require.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = ParseJWT(none+"."+parts[1]+".", secret, time.Now())
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = ParseJWT(none+"."+parts[1]+"."+parts[2], secret, time.Now())
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestAudience_UnmarshalJSON(t *testing.T) {
+	var a Audience
+	require.NoError(t, a.UnmarshalJSON([]byte(`"api"`)))
+	assert.Equal(t, Audience{"api"}, a)
+	require.NoError(t, a.UnmarshalJSON([]byte(`["api","web"]`)))
+	assert.True(t, a.Contains("web"))
+	assert.False(t, a.Contains("cli"))
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	plainKey, _, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.False(t, LooksLikeJWT(plainKey))
+	assert.True(t, LooksLikeJWT("a.b.c"))
+}
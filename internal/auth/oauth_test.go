@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOAuthScopes(t *testing.T) {
+	scopes, err := ParseOAuthScopes("stats:read hosts:read", "hosts:read")
+	if err != nil {
+		t.Fatalf("ParseOAuthScopes() error = %v", err)
+	}
+	if want := []string{"hosts:read", "stats:read"}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("ParseOAuthScopes() = %v, want %v", scopes, want)
+	}
+
+	if _, err := ParseOAuthScopes("hosts:write"); err == nil {
+		t.Error("ParseOAuthScopes(hosts:write) expected error")
+	}
+}
+
+func TestOAuthScopeEndpoints(t *testing.T) {
+	matcher, err := CompileEndpoints(OAuthScopeEndpoints([]string{"hosts:read"}))
+	if err != nil {
+		t.Fatalf("CompileEndpoints() error = %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/api/v1/auth/me", true},
+		{"GET", "/api/v1/hosts", true},
+		{"GET", "/api/v1/hosts/abc/events", true},
+		{"DELETE", "/api/v1/hosts/abc", false},
+		{"GET", "/api/v1/events", false},
+		{"GET", "/api/v1/api-keys", false},
+	}
+	for _, tt := range tests {
+		if got := matcher.Allows(tt.method, tt.path); got != tt.want {
+			t.Errorf("Allows(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateOAuthToken(t *testing.T) {
+	token, hash, err := GenerateOAuthToken(OAuthAccessTokenPrefix)
+	if err != nil {
+		t.Fatalf("GenerateOAuthToken() error = %v", err)
+	}
+	if !strings.HasPrefix(token, OAuthAccessTokenPrefix) || !LooksLikeOAuthToken(token) {
+		t.Errorf("GenerateOAuthToken() = %q, want an access token", token)
+	}
+	if hash != HashOAuthToken(token) {
+		t.Error("GenerateOAuthToken() hash does not match HashOAuthToken")
+	}
+	if LooksLikeOAuthToken("dGhpcyBpcyBhbiBBUEkga2V5") || LooksLikeJWT(token) {
+		t.Error("delegated tokens must not be confused with API keys or JWTs")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE() = false for the RFC 7636 example")
+	}
+	if VerifyPKCE(verifier+"x", challenge) {
+		t.Error("VerifyPKCE() = true for a wrong verifier")
+	}
+	if VerifyPKCE("short", challenge) {
+		t.Error("VerifyPKCE() = true for a verifier shorter than 43 characters")
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import "snailbus/internal/models"
+
+// Principal kinds
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+)
+
+// Authentication methods, as named in AUTH_METHODS
+const (
+	MethodAPIKey        = "api_key"
+	MethodJWT           = "jwt"
+	MethodMTLS          = "mtls"
+	MethodOAuth         = "oauth"
+	MethodSession       = "session"
+	MethodImpersonation = "impersonation"
+)
+
+// Principal is the authenticated caller of a request, whichever method authenticated it
+type Principal struct {
+	Kind   string       // PrincipalUser or PrincipalServiceAccount
+	UserID string       // ID of the user the credential belongs to
+	User   *models.User // Loaded user record
+	OrgID  string
+	Role   string
+
+	// Scopes are endpoint patterns (see CompileEndpoints) the credential is limited to
+	// Empty means the credential may call every endpoint the role allows
+	Scopes []string
+
+	Method       string // Authentication method that produced the principal (MethodAPIKey, ...)
+	CredentialID string // API key ID, token ID, delegated grant ID, session ID, or certificate serial
+
+	// Impersonator is the system administrator acting as the user, for impersonation tokens
+	Impersonator *models.User
+
+	// HostID is the only host the credential may report as, for API keys issued at enrollment
+	HostID string
+}
+
+// NewUserPrincipal builds a principal acting as user
+func NewUserPrincipal(user *models.User, method, credentialID string, scopes []string) *Principal {
+	return &Principal{
+		Kind:         PrincipalUser,
+		UserID:       user.ID,
+		User:         user,
+		OrgID:        user.OrgID,
+		Role:         user.Role,
+		Scopes:       scopes,
+		Method:       method,
+		CredentialID: credentialID,
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// Organization roles
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Permissions describe what a role allows, for clients deciding what to offer a user
+// They are not checked themselves: each route requires roles (see middleware.RequireRole).
+const (
+	PermissionHostsRead   = "hosts:read"   // List, search, export, and diff hosts and their history
+	PermissionAPIKeysOwn  = "api_keys:own" // Create and delete one's own API keys
+	PermissionHostsWrite  = "hosts:write"  // Edit, tag, archive, restore, and delete hosts
+	PermissionProbesRun   = "probes:run"   // Create reachability probes and report their results
+	PermissionIngest      = "ingest"       // Submit host reports
+	PermissionUsersManage = "users:manage" // Create and delete users, change roles and host access
+	PermissionOrgManage   = "org:manage"   // Organization settings, reports, actions, webhooks, secrets, OAuth clients, audit log
+)
+
+// roles are the organization roles from least to most privileged; each has the
+// permissions of the roles before it
+var roles = []models.Role{
+	{
+		Name:        RoleViewer,
+		Description: "Read-only access to hosts",
+		Permissions: []string{PermissionHostsRead, PermissionAPIKeysOwn},
+	},
+	{
+		Name:        RoleEditor,
+		Description: "Submits reports and manages hosts",
+		Permissions: []string{PermissionHostsWrite, PermissionProbesRun, PermissionIngest},
+	},
+	{
+		Name:        RoleAdmin,
+		Description: "Manages users and the organization",
+		Permissions: []string{PermissionUsersManage, PermissionOrgManage},
+	},
+}
+
+// Roles returns the organization roles from least to most privileged, each with all
+// of its permissions
+func Roles() []models.Role {
+	result := make([]models.Role, len(roles))
+	var permissions []string
+	for i, role := range roles {
+		permissions = append(permissions, role.Permissions...)
+		role.Permissions = append([]string(nil), permissions...)
+		result[i] = role
+	}
+	return result
+}
+
+// RoleNames returns the names of the organization roles from least to most privileged
+func RoleNames() []string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	return names
+}
+
+// ValidRole reports whether role is an organization role
+func ValidRole(role string) bool {
+	for _, r := range roles {
+		if r.Name == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrInvalidRole is returned by ValidateRole for a role that does not exist
+var ErrInvalidRole = errors.New("invalid role")
+
+// ValidateRole returns an error naming the valid roles if role is not one of them
+func ValidateRole(role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("%w %q: must be one of %s", ErrInvalidRole, role, strings.Join(RoleNames(), ", "))
+	}
+	return nil
+}
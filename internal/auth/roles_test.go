@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateRole(t *testing.T) {
+	for _, role := range []string{RoleViewer, RoleEditor, RoleAdmin} {
+		if err := ValidateRole(role); err != nil {
+			t.Errorf("ValidateRole(%q) error = %v", role, err)
+		}
+	}
+	for _, role := range []string{"", "Admin", "owner"} {
+		if err := ValidateRole(role); !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("ValidateRole(%q) error = %v, want ErrInvalidRole", role, err)
+		}
+	}
+}
+
+func TestRoles_Inherit(t *testing.T) {
+	roles := Roles()
+	if names := RoleNames(); !reflect.DeepEqual(names, []string{RoleViewer, RoleEditor, RoleAdmin}) {
+		t.Fatalf("RoleNames() = %v", names)
+	}
+	for i := 1; i < len(roles); i++ {
+		granted := make(map[string]bool)
+		for _, permission := range roles[i].Permissions {
+			granted[permission] = true
+		}
+		for _, permission := range roles[i-1].Permissions {
+			if !granted[permission] {
+				t.Errorf("role %s lacks %s of %s", roles[i].Name, permission, roles[i-1].Name)
+			}
+		}
+	}
+
+	// The returned roles are copies
+	roles[0].Permissions[0] = "changed"
+	if Roles()[0].Permissions[0] == "changed" {
+		t.Error("Roles() shares permissions with its callers")
+	}
+}
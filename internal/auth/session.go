@@ -0,0 +1,16 @@
+package auth
+
+import "strings"
+
+// Session token prefixes
+// Sessions are the Web UI's sign-ins: a short-lived access token renewed with a
+// refresh token, generated and hashed like delegated tokens (GenerateOAuthToken).
+const (
+	SessionAccessTokenPrefix  = "sbst_"
+	SessionRefreshTokenPrefix = "sbsr_"
+)
+
+// LooksLikeSessionToken reports whether a bearer credential is a session access or refresh token
+func LooksLikeSessionToken(token string) bool {
+	return strings.HasPrefix(token, SessionAccessTokenPrefix) || strings.HasPrefix(token, SessionRefreshTokenPrefix)
+}
@@ -0,0 +1,221 @@
+// Package autoscale computes per-replica load signals for horizontal autoscalers.
+//
+// CPU is a poor proxy for snailbus load: ingests mostly wait on the database, so a
+// replica can be saturated with little CPU in use. The tracker reports what the
+// replica is actually doing instead: ingests running and waiting for an admission
+// slot, the request rate, and the 95th percentile handler latency over the last
+// minute. Latencies are counted in one-second buckets of a fixed histogram, so memory
+// use does not grow with traffic. The signals are served as JSON (for KEDA's
+// metrics-api scaler) and exported as autoscaling_* gauges (for the Prometheus
+// scaler or a Kubernetes metrics adapter).
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"snailbus/internal/admission"
+	"snailbus/internal/metrics"
+)
+
+const (
+	// BucketWidth is the resolution of the sliding window
+	BucketWidth = time.Second
+	// Window is how far back the request rate and latency are computed over
+	Window = time.Minute
+	// ReportInterval is how often Run updates the autoscaling gauges
+	ReportInterval = 5 * time.Second
+
+	numBuckets = int(Window / BucketWidth)
+)
+
+// latencyBounds are the upper bounds of the latency histogram bins, in seconds
+// Latencies above the last bound are counted in an overflow bin.
+var latencyBounds = [...]float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.15, 0.2, 0.3, 0.4, 0.5,
+	0.75, 1, 1.5, 2, 3, 5, 7.5, 10, 15, 30, 60,
+}
+
+// Signals is a point-in-time view of the replica's load
+type Signals struct {
+	InFlightIngests   int       `json:"in_flight_ingests"`  // Ingests being processed
+	IngestQueueDepth  int       `json:"ingest_queue_depth"` // Ingests waiting for an admission slot
+	IngestSaturation  float64   `json:"ingest_saturation"`  // Admission slots in use, 0 without admission control
+	Requests          int64     `json:"requests"`           // Requests completed within the window
+	RequestsPerSecond float64   `json:"requests_per_second"`
+	P95LatencySeconds float64   `json:"p95_latency_seconds"` // 0 without requests in the window
+	Window            string    `json:"window"`
+	CollectedAt       time.Time `json:"collected_at"`
+}
+
+type bucket struct {
+	slot   int64 // start of the bucket in BucketWidth units since the epoch
+	counts [len(latencyBounds) + 1]int64
+}
+
+// Tracker records request latencies and in-flight ingests
+type Tracker struct {
+	admission *admission.Controller
+
+	mu       sync.Mutex
+	buckets  [numBuckets]bucket
+	inFlight int
+}
+
+// NewTracker creates a tracker; controller reports the admission queue, and may be nil
+// when ingest admission control is disabled
+func NewTracker(controller *admission.Controller) *Tracker {
+	return &Tracker{admission: controller}
+}
+
+// Observe records a completed request that took d
+func (t *Tracker) Observe(d time.Duration) {
+	t.observe(d, time.Now())
+}
+
+func (t *Tracker) observe(d time.Duration, now time.Time) {
+	slot := now.UnixNano() / int64(BucketWidth)
+	bin := len(latencyBounds)
+	for i, bound := range latencyBounds {
+		if d.Seconds() <= bound {
+			bin = i
+			break
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[slot%int64(numBuckets)]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+	b.counts[bin]++
+}
+
+// StartIngest counts an ingest as in flight until the returned function is called
+func (t *Tracker) StartIngest() func() {
+	t.mu.Lock()
+	t.inFlight++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.inFlight--
+			t.mu.Unlock()
+		})
+	}
+}
+
+// Signals returns the current load
+func (t *Tracker) Signals() Signals {
+	return t.signals(time.Now())
+}
+
+func (t *Tracker) signals(now time.Time) Signals {
+	slot := now.UnixNano() / int64(BucketWidth)
+	oldest := slot - int64(numBuckets) + 1
+
+	var counts [len(latencyBounds) + 1]int64
+	t.mu.Lock()
+	inFlight := t.inFlight
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.slot < oldest || b.slot > slot {
+			continue
+		}
+		for bin, n := range b.counts {
+			counts[bin] += n
+		}
+	}
+	t.mu.Unlock()
+
+	s := Signals{
+		InFlightIngests: inFlight,
+		Window:          Window.String(),
+		CollectedAt:     now.UTC(),
+	}
+	for _, n := range counts {
+		s.Requests += n
+	}
+	s.RequestsPerSecond = float64(s.Requests) / Window.Seconds()
+	s.P95LatencySeconds = quantile(0.95, counts[:])
+
+	if t.admission != nil {
+		stats := t.admission.Stats()
+		s.IngestQueueDepth = stats.Queued
+		s.IngestSaturation = stats.Saturation
+	}
+	return s
+}
+
+// quantile estimates the q-quantile of the histogram counts, interpolating linearly
+// within the bin it falls in like Prometheus' histogram_quantile. Quantiles in the
+// overflow bin are reported as the last bound.
+func quantile(q float64, counts []int64) float64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	var cumulative int64
+	for bin, n := range counts {
+		if n == 0 || float64(cumulative+n) < rank {
+			cumulative += n
+			continue
+		}
+		if bin == len(latencyBounds) {
+			return latencyBounds[len(latencyBounds)-1]
+		}
+		lower := 0.0
+		if bin > 0 {
+			lower = latencyBounds[bin-1]
+		}
+		upper := latencyBounds[bin]
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// Report updates the autoscaling gauges
+func (t *Tracker) Report() {
+	s := t.Signals()
+	metrics.AutoscalingInFlightIngests.Set(float64(s.InFlightIngests))
+	metrics.AutoscalingIngestQueueDepth.Set(float64(s.IngestQueueDepth))
+	metrics.AutoscalingRequestsPerSecond.Set(s.RequestsPerSecond)
+	metrics.AutoscalingLatencyP95.Set(s.P95LatencySeconds)
+}
+
+// Run reports the gauges every ReportInterval until ctx is cancelled
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(ReportInterval)
+	defer ticker.Stop()
+
+	t.Report()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Report()
+		}
+	}
+}
+
+// Handler serves the current signals as JSON
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(t.Signals())
+	})
+}
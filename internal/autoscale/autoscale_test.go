@@ -0,0 +1,82 @@
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/admission"
+)
+
+func TestTracker_Latency(t *testing.T) {
+	tracker := NewTracker(nil)
+	now := time.Unix(1_700_000_000, 0)
+
+	s := tracker.signals(now)
+	assert.Zero(t, s.Requests)
+	assert.Zero(t, s.P95LatencySeconds)
+
+	// 94 fast requests and 6 slow ones: the 95th percentile falls among the slow ones
+	for i := 0; i < 94; i++ {
+		tracker.observe(4*time.Millisecond, now.Add(-time.Duration(i%30)*time.Second))
+	}
+	for i := 0; i < 6; i++ {
+		tracker.observe(1200*time.Millisecond, now)
+	}
+
+	s = tracker.signals(now)
+	assert.Equal(t, int64(100), s.Requests)
+	assert.InDelta(t, 100.0/60, s.RequestsPerSecond, 1e-9)
+	assert.Greater(t, s.P95LatencySeconds, 1.0)
+	assert.LessOrEqual(t, s.P95LatencySeconds, 1.5)
+	assert.Equal(t, "1m0s", s.Window)
+
+	// Requests older than the window drop out
+	s = tracker.signals(now.Add(Window))
+	assert.Zero(t, s.Requests)
+	assert.Zero(t, s.P95LatencySeconds)
+
+	// Latencies beyond the last bound report the last bound
+	slow := NewTracker(nil)
+	slow.observe(5*time.Minute, now)
+	assert.Equal(t, 60.0, slow.signals(now).P95LatencySeconds)
+}
+
+func TestTracker_Ingests(t *testing.T) {
+	controller := admission.NewController(1, 5, time.Second)
+	tracker := NewTracker(controller)
+
+	done := tracker.StartIngest()
+	release, err := controller.Acquire(context.Background())
+	require.NoError(t, err)
+
+	s := tracker.Signals()
+	assert.Equal(t, 1, s.InFlightIngests)
+	assert.Equal(t, 1.0, s.IngestSaturation)
+
+	release()
+	done()
+	done() // Calling it again is harmless
+	assert.Equal(t, 0, tracker.Signals().InFlightIngests)
+}
+
+func TestTracker_Handler(t *testing.T) {
+	tracker := NewTracker(nil)
+	tracker.Observe(10 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/autoscaling", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var s Signals
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+	assert.Equal(t, int64(1), s.Requests)
+	assert.Greater(t, s.P95LatencySeconds, 0.0)
+}
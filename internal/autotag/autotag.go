@@ -0,0 +1,139 @@
+// Package autotag derives host tags from hostnames with an organization's tag rules.
+//
+// A rule is a regular expression in RE2 syntax matched against the hostname, and the
+// tags it adds to the host on a match. Tags may reference the expression's capture
+// groups as ${1} or ${name}, so "^(?P<role>[a-z]+)-\d+\.(?P<env>prod|staging)\."
+// with the tags "role:${role}" and "env:${env}" tags web-1.prod.example.com with
+// role:web and env:prod. Every matching rule applies. A tag that expands to nothing,
+// or to a "key:" prefix without a value because a group did not participate in the
+// match, is skipped.
+package autotag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// Rule limits, enforced by Compile
+const (
+	MaxRules         = 100
+	MaxPatternLength = 256
+	MaxTagsPerRule   = 16
+	MaxTagLength     = 100
+)
+
+// groupRef finds capture group references in a tag template, as regexp.Expand reads them
+var groupRef = regexp.MustCompile(`\$(\$|\{[^}]*\}|[A-Za-z0-9_]+)`)
+
+// Rules are compiled tag rules
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	tags    []string
+}
+
+// Compile validates tag rules and prepares them for Tags
+func Compile(rules []models.HostTagRule) (*Rules, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("at most %d rules are allowed (got %d)", MaxRules, len(rules))
+	}
+
+	compiled := &Rules{rules: make([]rule, 0, len(rules))}
+	for i, r := range rules {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("rule %d: pattern must not be empty", i+1)
+		}
+		if len(r.Pattern) > MaxPatternLength {
+			return nil, fmt.Errorf("rule %d: pattern is longer than %d characters", i+1, MaxPatternLength)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid pattern: %w", i+1, err)
+		}
+		if len(r.Tags) == 0 {
+			return nil, fmt.Errorf("rule %d: at least one tag is required", i+1)
+		}
+		if len(r.Tags) > MaxTagsPerRule {
+			return nil, fmt.Errorf("rule %d: at most %d tags are allowed (got %d)", i+1, MaxTagsPerRule, len(r.Tags))
+		}
+		for _, tag := range r.Tags {
+			if strings.TrimSpace(tag) == "" {
+				return nil, fmt.Errorf("rule %d: tag must not be empty", i+1)
+			}
+			if len(tag) > MaxTagLength {
+				return nil, fmt.Errorf("rule %d: tag %q is longer than %d characters", i+1, tag, MaxTagLength)
+			}
+			if err := checkGroups(pattern, tag); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+		}
+		compiled.rules = append(compiled.rules, rule{pattern: pattern, tags: r.Tags})
+	}
+	return compiled, nil
+}
+
+// checkGroups returns an error if a tag template references a group the pattern does not have
+func checkGroups(pattern *regexp.Regexp, tag string) error {
+	for _, match := range groupRef.FindAllStringSubmatch(tag, -1) {
+		if match[1] == "$" {
+			continue // $$ is a literal $
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(match[1], "{"), "}")
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > pattern.NumSubexp() {
+				return fmt.Errorf("tag %q references group %d, but the pattern has %d", tag, n, pattern.NumSubexp())
+			}
+			continue
+		}
+		if pattern.SubexpIndex(name) < 0 {
+			return fmt.Errorf("tag %q references unknown group %q (write ${1}x rather than $1x)", tag, name)
+		}
+	}
+	return nil
+}
+
+// Tags returns the tags the rules derive from a hostname, sorted and without duplicates
+func (r *Rules) Tags(hostname string) []string {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, rule := range r.rules {
+		match := rule.pattern.FindStringSubmatchIndex(hostname)
+		if match == nil {
+			continue
+		}
+		for _, template := range rule.tags {
+			tag := strings.TrimSpace(string(rule.pattern.ExpandString(nil, template, hostname, match)))
+			if tag == "" || strings.HasSuffix(tag, ":") || len(tag) > MaxTagLength || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Missing returns the derived tags that are not in current, sorted
+func Missing(current, derived []string) []string {
+	have := make(map[string]bool, len(current))
+	for _, tag := range current {
+		have[tag] = true
+	}
+	missing := []string{}
+	for _, tag := range derived {
+		if !have[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,77 @@
+package autotag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"snailbus/internal/models"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []models.HostTagRule
+		wantErr bool
+	}{
+		{"plain tags", []models.HostTagRule{{Pattern: `^web-\d+`, Tags: []string{"role:web"}}}, false},
+		{"numbered group", []models.HostTagRule{{Pattern: `-(prod|dev)$`, Tags: []string{"env:$1", "env:${1}"}}}, false},
+		{"named group", []models.HostTagRule{{Pattern: `\.(?P<env>prod|dev)\.`, Tags: []string{"env:${env}"}}}, false},
+		{"no rules", nil, false},
+		{"empty pattern", []models.HostTagRule{{Pattern: "", Tags: []string{"a"}}}, true},
+		{"invalid pattern", []models.HostTagRule{{Pattern: `web-(`, Tags: []string{"a"}}}, true},
+		{"no tags", []models.HostTagRule{{Pattern: `web`}}, true},
+		{"blank tag", []models.HostTagRule{{Pattern: `web`, Tags: []string{" "}}}, true},
+		{"missing group", []models.HostTagRule{{Pattern: `-(prod)$`, Tags: []string{"env:$2"}}}, true},
+		{"unknown name", []models.HostTagRule{{Pattern: `-(?P<env>prod)$`, Tags: []string{"env:${stage}"}}}, true},
+		{"ambiguous reference", []models.HostTagRule{{Pattern: `-(prod)$`, Tags: []string{"env:$1x"}}}, true},
+		{"long pattern", []models.HostTagRule{{Pattern: strings.Repeat("a", MaxPatternLength+1), Tags: []string{"a"}}}, true},
+		{"too many rules", make([]models.HostTagRule, MaxRules+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRules_Tags(t *testing.T) {
+	rules, err := Compile([]models.HostTagRule{
+		{Pattern: `^web-\d+`, Tags: []string{"role:web"}},
+		{Pattern: `^(?P<role>[a-z]+)-\d+(?:\.(?P<env>prod|staging))?\.`, Tags: []string{"role:${role}", "env:${env}"}},
+		{Pattern: `(?i)-LAB$`, Tags: []string{"env:lab"}},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		hostname string
+		want     []string
+	}{
+		{"web-1.prod.example.com", []string{"env:prod", "role:web"}},
+		{"db-12.staging.example.com", []string{"env:staging", "role:db"}},
+		{"db-3.example.com", []string{"role:db"}}, // env did not participate, so env: is skipped
+		{"build-lab", []string{"env:lab"}},
+		{"laptop", []string{}},
+	}
+	for _, tt := range tests {
+		if got := rules.Tags(tt.hostname); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tags(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestMissing(t *testing.T) {
+	got := Missing([]string{"env:prod", "team:web"}, []string{"role:web", "env:prod"})
+	if want := []string{"role:web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+	if got := Missing(nil, nil); len(got) != 0 {
+		t.Errorf("Missing() = %v, want none", got)
+	}
+}
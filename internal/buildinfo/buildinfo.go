@@ -0,0 +1,71 @@
+// Package buildinfo describes the running server: the version, commit, and build date
+// injected with -ldflags at build time, and the Go runtime it was built with.
+//
+// Builds without ldflags, such as go run or a plain go build in a checkout, fall back
+// to the VCS details the Go toolchain stamps into the binary, so they still name the
+// commit they were built from.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Unknown is reported for details that were neither injected nor stamped by the toolchain
+const Unknown = "unknown"
+
+// Info identifies a build
+// @Description Version, commit, and build date of the running server, and the Go runtime it was built with
+type Info struct {
+	Version   string `json:"version"`    // Semantic version from git describe, e.g. v1.4.0 or v1.4.0-3-gabc1234-dirty; "dev" for development builds
+	Commit    string `json:"commit"`     // Git commit the server was built from
+	BuildDate string `json:"build_date"` // When the binary was built (RFC 3339), or the commit time for development builds
+	Modified  bool   `json:"modified"`   // The working tree had uncommitted changes; only known for development builds
+	GoVersion string `json:"go_version"`
+	Compiler  string `json:"compiler"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// New describes this build from the ldflags-injected version, commit, and build date
+// Empty and "unknown" values are filled in from the binary's VCS stamp where available.
+func New(version, commit, buildDate string) Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Compiler:  runtime.Compiler,
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if isUnknown(info.Commit) {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if isUnknown(info.BuildDate) {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if isUnknown(info.Commit) {
+		info.Commit = Unknown
+	}
+	if isUnknown(info.BuildDate) {
+		info.BuildDate = Unknown
+	}
+	return info
+}
+
+func isUnknown(value string) bool {
+	return value == "" || value == Unknown
+}
@@ -0,0 +1,23 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	info := New("v1.4.0", "abc1234", "2026-10-15T09:00:00Z")
+	assert.Equal(t, "v1.4.0", info.Version)
+	assert.Equal(t, "abc1234", info.Commit, "injected values win over the VCS stamp")
+	assert.Equal(t, "2026-10-15T09:00:00Z", info.BuildDate)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, info.Platform)
+
+	// Test binaries carry no VCS stamp, so missing details stay unknown
+	info = New("", "", Unknown)
+	assert.Equal(t, "dev", info.Version)
+	assert.Equal(t, Unknown, info.Commit)
+	assert.Equal(t, Unknown, info.BuildDate)
+}
@@ -0,0 +1,287 @@
+// Package bundle reads, writes, and imports offline report bundles.
+//
+// Air-gapped sites cannot send reports to snailbus directly. Their agents write
+// reports to disk instead, and an exporter packs them into a bundle: a tar archive,
+// optionally gzip-compressed, holding the report files, manifest.json listing each
+// report with its SHA-256, and manifest.sig, an Ed25519 signature over the manifest.
+// A bundle is only accepted if it was signed with a trusted key and every report
+// matches its checksum, so a bundle cannot be altered on its way across the air gap.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// Names of the bundle's metadata files
+const (
+	ManifestName  = "manifest.json"
+	SignatureName = "manifest.sig"
+)
+
+// FormatVersion is the manifest version this package reads and writes
+const FormatVersion = 1
+
+var (
+	// ErrInvalid is returned, wrapped with the reason, for archives that are not well-formed bundles
+	ErrInvalid = errors.New("invalid bundle")
+	// ErrUntrustedKey is returned when a bundle was signed with a key that is not trusted
+	ErrUntrustedKey = errors.New("bundle was signed with an untrusted key")
+	// ErrInvalidSignature is returned when a manifest's signature does not match it
+	ErrInvalidSignature = errors.New("invalid bundle signature")
+	// ErrTooLarge is returned when a bundle's contents exceed the size limit
+	ErrTooLarge = errors.New("bundle is too large")
+)
+
+// Manifest lists the reports in a bundle
+type Manifest struct {
+	Version    int       `json:"version"`
+	Exporter   string    `json:"exporter,omitempty"` // Who or what exported the bundle, e.g. a site name
+	ExportedAt time.Time `json:"exported_at"`
+	Reports    []Entry   `json:"reports"`
+}
+
+// Entry is a report file in a bundle
+type Entry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // Hex-encoded checksum of the file
+}
+
+// signature is the content of manifest.sig
+type signature struct {
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"` // Base64 Ed25519 signature over the manifest file
+}
+
+// File is a report read from a bundle
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Bundle is a verified bundle
+type Bundle struct {
+	Manifest Manifest
+	KeyID    string // Trusted key that signed the manifest
+	SHA256   string // Hex-encoded checksum of the bundle as read, compressed or not
+	Reports  []File // In manifest order
+}
+
+// Keyring holds the public keys bundles may be signed with
+type Keyring struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// ParseKeys creates a keyring from base64-encoded Ed25519 public keys
+func ParseKeys(encoded []string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]ed25519.PublicKey, len(encoded))}
+	for _, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("bundle key must be valid base64: %w", err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("bundle key must be %d bytes (got %d)", ed25519.PublicKeySize, len(key))
+		}
+		k.keys[KeyID(key)] = ed25519.PublicKey(key)
+	}
+	return k, nil
+}
+
+// KeyID identifies a public key (a truncated SHA-256 of the key, as for receipts)
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Len returns the number of trusted keys
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// Read reads and verifies a bundle
+// maxSize bounds the total size of the files in the bundle after decompression; 0 disables the limit.
+func Read(r io.Reader, keys *Keyring, maxSize int64) (*Bundle, error) {
+	hash := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, hash))
+
+	var archive io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		defer gz.Close()
+		archive = gz
+	}
+
+	files := make(map[string][]byte)
+	var total int64
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: %s is not a regular file", ErrInvalid, header.Name)
+		}
+		name := path.Clean(header.Name)
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("%w: %s appears more than once", ErrInvalid, name)
+		}
+
+		total += header.Size
+		if maxSize > 0 && total > maxSize {
+			return nil, ErrTooLarge
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		files[name] = data
+	}
+	// Hash whatever follows the archive too, so the checksum covers the whole upload
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	manifestData, ok := files[ManifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalid, ManifestName)
+	}
+	signatureData, ok := files[SignatureName]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalid, SignatureName)
+	}
+	keyID, err := verify(manifestData, signatureData, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, ManifestName, err)
+	}
+	if manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported manifest version %d", ErrInvalid, manifest.Version)
+	}
+
+	b := &Bundle{
+		Manifest: manifest,
+		KeyID:    keyID,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		Reports:  make([]File, 0, len(manifest.Reports)),
+	}
+	listed := map[string]bool{ManifestName: true, SignatureName: true}
+	for _, entry := range manifest.Reports {
+		name := path.Clean(entry.Path)
+		if listed[name] {
+			return nil, fmt.Errorf("%w: %s is listed more than once", ErrInvalid, entry.Path)
+		}
+		listed[name] = true
+
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalid, entry.Path)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrInvalid, entry.Path)
+		}
+		b.Reports = append(b.Reports, File{Path: entry.Path, Data: data})
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("%w: %s is not listed in the manifest", ErrInvalid, name)
+		}
+	}
+	return b, nil
+}
+
+// verify checks the manifest signature and returns the ID of the key that made it
+func verify(manifest, signatureData []byte, keys *Keyring) (string, error) {
+	var sig signature
+	if err := json.Unmarshal(signatureData, &sig); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalid, SignatureName, err)
+	}
+	key, ok := keys.keys[sig.KeyID]
+	if !ok {
+		return "", ErrUntrustedKey
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(key, manifest, raw) {
+		return "", ErrInvalidSignature
+	}
+	return sig.KeyID, nil
+}
+
+// Write writes a gzip-compressed bundle of reports, signed with key
+// It is the reference exporter; files are named by their position in reports.
+func Write(w io.Writer, key ed25519.PrivateKey, exporter string, exportedAt time.Time, reports [][]byte) error {
+	manifest := Manifest{
+		Version:    FormatVersion,
+		Exporter:   exporter,
+		ExportedAt: exportedAt.UTC(),
+		Reports:    make([]Entry, len(reports)),
+	}
+	for i, report := range reports {
+		sum := sha256.Sum256(report)
+		manifest.Reports[i] = Entry{Path: fmt.Sprintf("reports/%06d.json", i+1), SHA256: hex.EncodeToString(sum[:])}
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	signatureData, err := json.Marshal(signature{
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestData)),
+	})
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: manifest.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, bytes.NewReader(data))
+		return err
+	}
+	if err := add(ManifestName, manifestData); err != nil {
+		return err
+	}
+	if err := add(SignatureName, signatureData); err != nil {
+		return err
+	}
+	for i, report := range reports {
+		if err := add(manifest.Reports[i].Path, report); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,253 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	hostA = "6f0c5a52-0000-0000-0000-00000000000a"
+	hostB = "6f0c5a52-0000-0000-0000-00000000000b"
+)
+
+func testKey(t *testing.T, seed byte) (ed25519.PrivateKey, *Keyring) {
+	t.Helper()
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	keys, err := ParseKeys([]string{base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))})
+	require.NoError(t, err)
+	return key, keys
+}
+
+func report(hostID, hostname, timestamp string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"meta": map[string]string{"host_id": hostID, "hostname": hostname, "collection_id": hostname + "@" + timestamp, "timestamp": timestamp},
+		"data": map[string]interface{}{"system": map[string]string{"os_name": "Fedora"}, "secrets": map[string]string{"token": "x"}},
+	})
+	return data
+}
+
+func writeBundle(t *testing.T, key ed25519.PrivateKey, reports ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, key, "site-a", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), reports))
+	return buf.Bytes()
+}
+
+// rawTar builds an uncompressed tar with the given files, in order
+func rawTar(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: file[0], Mode: 0o644, Size: int64(len(file[1]))}))
+		_, err := tw.Write([]byte(file[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestReadWrite(t *testing.T) {
+	key, keys := testKey(t, 1)
+	data := writeBundle(t, key, report(hostA, "a", "2026-03-01T10:00:00Z"), report(hostB, "b", "2026-03-01T11:00:00Z"))
+
+	b, err := Read(bytes.NewReader(data), keys, 0)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(key.Public().(ed25519.PublicKey)), b.KeyID)
+	assert.Len(t, b.SHA256, 64)
+	assert.Equal(t, "site-a", b.Manifest.Exporter)
+	require.Len(t, b.Reports, 2)
+	assert.Equal(t, "reports/000001.json", b.Reports[0].Path)
+	assert.Equal(t, report(hostB, "b", "2026-03-01T11:00:00Z"), b.Reports[1].Data)
+
+	// The checksum identifies the uploaded file
+	again, err := Read(bytes.NewReader(data), keys, 0)
+	require.NoError(t, err)
+	assert.Equal(t, b.SHA256, again.SHA256)
+
+	// Contents larger than the limit are refused
+	_, err = Read(bytes.NewReader(data), keys, 100)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestRead_Rejects(t *testing.T) {
+	key, keys := testKey(t, 1)
+	other, _ := testKey(t, 2)
+
+	_, err := Read(bytes.NewReader(writeBundle(t, other, report(hostA, "a", "2026-03-01T10:00:00Z"))), keys, 0)
+	assert.ErrorIs(t, err, ErrUntrustedKey)
+
+	// Re-pack a valid bundle, uncompressed, with one file altered or added
+	b, err := Read(bytes.NewReader(writeBundle(t, key, report(hostA, "a", "2026-03-01T10:00:00Z"))), keys, 0)
+	require.NoError(t, err)
+	manifest, _ := json.Marshal(b.Manifest)
+
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  error
+	}{
+		{"not a tar", nil, ErrInvalid},
+		{"missing manifest", [][2]string{{"reports/000001.json", "{}"}}, ErrInvalid},
+		{"missing signature", [][2]string{{ManifestName, string(manifest)}}, ErrInvalid},
+		{"bad signature", [][2]string{
+			{ManifestName, string(manifest)},
+			{SignatureName, `{"key_id":"` + b.KeyID + `","signature":"` + base64.StdEncoding.EncodeToString(make([]byte, 64)) + `"}`},
+		}, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("not a bundle")
+			if tt.files != nil {
+				data = rawTar(t, tt.files...)
+			}
+			_, err := Read(bytes.NewReader(data), keys, 0)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	// A signed manifest whose report was altered, or with an extra file
+	signedManifest, signature := signManifest(t, key, b.Manifest)
+	_, err = Read(bytes.NewReader(rawTar(t,
+		[2]string{ManifestName, signedManifest},
+		[2]string{SignatureName, signature},
+		[2]string{"reports/000001.json", "{}"},
+	)), keys, 0)
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	_, err = Read(bytes.NewReader(rawTar(t,
+		[2]string{ManifestName, signedManifest},
+		[2]string{SignatureName, signature},
+		[2]string{"reports/000001.json", string(b.Reports[0].Data)},
+		[2]string{"reports/extra.json", "{}"},
+	)), keys, 0)
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.Contains(t, err.Error(), "not listed")
+
+	// Uncompressed bundles are accepted too
+	_, err = Read(bytes.NewReader(rawTar(t,
+		[2]string{ManifestName, signedManifest},
+		[2]string{SignatureName, signature},
+		[2]string{"reports/000001.json", string(b.Reports[0].Data)},
+	)), keys, 0)
+	assert.NoError(t, err)
+}
+
+func signManifest(t *testing.T, key ed25519.PrivateKey, manifest Manifest) (string, string) {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	sig, err := json.Marshal(signature{
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	})
+	require.NoError(t, err)
+	return string(data), string(sig)
+}
+
+func TestParseKeys(t *testing.T) {
+	_, err := ParseKeys([]string{"dGVzdA=="})
+	assert.Error(t, err)
+	_, err = ParseKeys([]string{"not base64!"})
+	assert.Error(t, err)
+
+	keys, err := ParseKeys(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, keys.Len())
+}
+
+func TestImporter_Import(t *testing.T) {
+	key, keys := testKey(t, 1)
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Offline Org")
+	require.NoError(t, err)
+	user, err := store.CreateUser("importer", "importer@example.com", "hash", org.ID, "admin")
+	require.NoError(t, err)
+	require.NoError(t, store.SetIngestFilter(&models.IngestFilter{OrgID: org.ID, Paths: []string{"secrets"}}))
+
+	// hostB already has a newer report than the bundle's
+	current := &models.Report{
+		ID:         hostB,
+		ReceivedAt: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		Meta:       models.ReportMeta{HostID: hostB, Hostname: "b"},
+		Data:       json.RawMessage(`{}`),
+	}
+	require.NoError(t, store.SaveHost(current, org.ID, user.ID))
+
+	data := writeBundle(t, key,
+		report(hostA, "a-new", "2026-03-01T11:00:00+01:00"),
+		report(hostA, "a-old", "2026-03-01T09:00:00Z"),
+		report(hostB, "b", "2026-03-01T10:00:00Z"),
+		report(hostA, "", "2026-03-01T10:00:00Z"),
+		report(hostA, "a", ""),
+		[]byte("not json"),
+	)
+	b, err := Read(bytes.NewReader(data), keys, 0)
+	require.NoError(t, err)
+
+	importer := NewImporter(store, jsonlimit.DefaultLimits())
+	batch, err := importer.Import(b, org.ID, user.ID, models.ImportSourceAPI)
+	require.NoError(t, err)
+	assert.Equal(t, 6, batch.ReportCount)
+	assert.Equal(t, 2, batch.Imported)
+	assert.Equal(t, 1, batch.Superseded)
+	assert.Equal(t, 3, batch.Rejected)
+	assert.NotNil(t, batch.CompletedAt)
+
+	statuses := make([]string, len(batch.Results))
+	for i, result := range batch.Results {
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []string{
+		models.ImportReportImported, models.ImportReportImported, models.ImportReportSuperseded,
+		models.ImportReportRejected, models.ImportReportRejected, models.ImportReportRejected,
+	}, statuses)
+	assert.Equal(t, "2026-03-01T10:00:00Z", batch.Results[0].Timestamp, "timestamps are canonicalized to UTC")
+	assert.Equal(t, "missing hostname in meta", batch.Results[3].Error)
+	assert.True(t, strings.HasPrefix(batch.Results[4].Error, "missing timestamp in meta"))
+	assert.Equal(t, "invalid JSON payload", batch.Results[5].Error)
+
+	// The newest report wins, received at its collection time, with the ingest filter applied
+	host, err := store.GetHost(hostA, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "a-new", host.Meta.Hostname)
+	assert.True(t, host.ReceivedAt.Equal(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)))
+	assert.NotContains(t, string(host.Data), "secrets")
+
+	host, err = store.GetHost(hostB, org.ID)
+	require.NoError(t, err)
+	assert.True(t, host.ReceivedAt.Equal(current.ReceivedAt), "a newer report is kept")
+
+	// Events carry the batch
+	events, err := store.ListHostEvents(org.ID, hostA, 0, 10, true)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, batch.ID, events[0].Payload.ImportBatchID)
+
+	// The same bundle is only imported once
+	_, err = importer.Import(b, org.ID, user.ID, models.ImportSourceCLI)
+	assert.True(t, errors.Is(err, storage.ErrBundleAlreadyImported))
+
+	stored, err := store.GetImportBatch(batch.ID, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, stored.Results, 6)
+	batches, err := store.ListImportBatches(org.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Nil(t, batches[0].Results)
+}
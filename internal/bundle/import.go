@@ -0,0 +1,176 @@
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/fieldfilter"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Importer stores the reports of verified bundles
+type Importer struct {
+	store  storage.Storage
+	limits jsonlimit.Limits
+}
+
+// NewImporter creates an importer that checks reports against the ingest JSON limits
+func NewImporter(store storage.Storage, limits jsonlimit.Limits) *Importer {
+	return &Importer{store: store, limits: limits}
+}
+
+// pendingReport is a valid report waiting to be stored
+type pendingReport struct {
+	report *models.Report
+	result *models.ImportResult
+}
+
+// Import stores a bundle's reports in the organization, attributed to userID, and
+// records the import batch.
+//
+// Reports are validated like ingested ones, except that meta.timestamp is required:
+// it becomes the report's receive time, so hosts keep the time their data was
+// collected. Reports are stored oldest first, and a report is superseded if its
+// host already has one at least as recent. Invalid reports are rejected without
+// failing the batch. Imports raise no outbound action findings and issue no receipts.
+//
+// Returns storage.ErrBundleAlreadyImported if the organization already imported the bundle.
+func (im *Importer) Import(b *Bundle, orgID, userID, source string) (*models.ImportBatch, error) {
+	batch := &models.ImportBatch{
+		ID:           uuid.New().String(),
+		Source:       source,
+		ImportedBy:   userID,
+		BundleSHA256: b.SHA256,
+		KeyID:        b.KeyID,
+		Exporter:     b.Manifest.Exporter,
+		ExportedAt:   b.Manifest.ExportedAt.UTC(),
+		ReportCount:  len(b.Reports),
+		Results:      make([]models.ImportResult, len(b.Reports)),
+	}
+	if err := im.store.CreateImportBatch(batch, orgID); err != nil {
+		return nil, err
+	}
+
+	filter, err := im.ingestFilter(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]pendingReport, 0, len(b.Reports))
+	for i, file := range b.Reports {
+		result := &batch.Results[i]
+		result.Path = file.Path
+		report, err := im.parse(file.Data, filter)
+		if report != nil {
+			result.HostID = report.Meta.HostID
+			result.Hostname = report.Meta.Hostname
+			result.CollectionID = report.Meta.CollectionID
+			result.Timestamp = report.Meta.Timestamp
+		}
+		if err != nil {
+			result.Status = models.ImportReportRejected
+			result.Error = err.Error()
+			continue
+		}
+		pending = append(pending, pendingReport{report: report, result: result})
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].report.ReceivedAt.Before(pending[j].report.ReceivedAt)
+	})
+	for _, p := range pending {
+		imported, err := im.store.ImportHost(p.report, orgID, userID, batch.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", p.result.Path, err)
+		}
+		if imported {
+			p.result.Status = models.ImportReportImported
+		} else {
+			p.result.Status = models.ImportReportSuperseded
+		}
+	}
+
+	for _, result := range batch.Results {
+		switch result.Status {
+		case models.ImportReportImported:
+			batch.Imported++
+		case models.ImportReportSuperseded:
+			batch.Superseded++
+		default:
+			batch.Rejected++
+		}
+	}
+	if err := im.store.FinishImportBatch(batch, orgID); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ingestFilter returns the organization's compiled ingest filter, nil if it has none
+func (im *Importer) ingestFilter(orgID string) (*fieldfilter.Filter, error) {
+	filter, err := im.store.GetIngestFilter(orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingest filter: %w", err)
+	}
+	return fieldfilter.Compile(filter.Paths)
+}
+
+// parse validates a bundled report and converts it to a stored report
+// The report is returned with as much metadata as was readable, even when invalid.
+func (im *Importer) parse(data []byte, filter *fieldfilter.Filter) (*models.Report, error) {
+	if err := im.limits.Check(data); err != nil {
+		var limitErr *jsonlimit.Error
+		if errors.As(err, &limitErr) {
+			return nil, fmt.Errorf("report exceeds JSON limits: %w", err)
+		}
+		return nil, errors.New("invalid JSON payload")
+	}
+	var req models.IngestRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, errors.New("invalid JSON payload")
+	}
+
+	report := &models.Report{ID: req.Meta.HostID, Meta: req.Meta}
+	if req.Meta.HostID == "" {
+		return report, errors.New("missing host_id in meta")
+	}
+	if req.Meta.Hostname == "" {
+		return report, errors.New("missing hostname in meta")
+	}
+	if req.Meta.Timestamp == "" {
+		return report, errors.New("missing timestamp in meta; bundled reports must carry their collection time")
+	}
+	collectedAt, err := models.ParseReportTimestamp(req.Meta.Timestamp)
+	if err != nil {
+		return report, errors.New("invalid timestamp in meta")
+	}
+	report.Meta.Timestamp = models.FormatReportTimestamp(collectedAt)
+	report.ReceivedAt = collectedAt.UTC().Truncate(time.Microsecond) // Postgres timestamp precision
+
+	if req.Health != nil {
+		req.Health.Normalize()
+		if err := req.Health.Validate(); err != nil {
+			return report, fmt.Errorf("invalid health in report: %w", err)
+		}
+	}
+
+	report.Data = req.Data
+	if filter != nil {
+		if report.Data, report.Stripped, err = filter.Apply(req.Data); err != nil {
+			return report, fmt.Errorf("failed to apply ingest filter: %w", err)
+		}
+	}
+	report.Errors = req.Errors
+	report.Health = req.Health
+	return report, nil
+}
@@ -0,0 +1,239 @@
+// Package checkin measures hosts against their organization's expected check-in
+// windows and raises host_overdue findings for hosts that miss them.
+//
+// An organization's schedule maps tags to windows. A host is held to the shortest
+// window among the tags it carries, so a host tagged both env:prod (1h) and env:lab
+// (24h) must report hourly. Hosts without a matching tag use the schedule's default,
+// and organizations without a schedule or default use the server default.
+package checkin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	// CheckInterval is how often the monitor looks for overdue hosts
+	CheckInterval = 5 * time.Minute
+	// DefaultInterval is the server default window (CHECKIN_DEFAULT_INTERVAL)
+	DefaultInterval = 24 * time.Hour
+)
+
+// Window returns the check-in window of a host carrying tags, and the tag that set it
+// The tag is empty when the schedule's default or fallback applies; schedule may be nil.
+func Window(schedule *models.CheckinSchedule, tags []string, fallback time.Duration) (time.Duration, string) {
+	if schedule == nil {
+		return fallback, ""
+	}
+
+	var window time.Duration
+	var windowTag string
+	for _, w := range schedule.Windows {
+		interval := time.Duration(w.IntervalSeconds) * time.Second
+		if (window == 0 || interval < window) && hasTag(tags, w.Tag) {
+			window, windowTag = interval, w.Tag
+		}
+	}
+	if window > 0 {
+		return window, windowTag
+	}
+	if schedule.DefaultIntervalSeconds > 0 {
+		return time.Duration(schedule.DefaultIntervalSeconds) * time.Second, ""
+	}
+	return fallback, ""
+}
+
+// Evaluate compares a host's last report with its check-in window at now
+func Evaluate(schedule *models.CheckinSchedule, host *models.HostSummary, fallback time.Duration, now time.Time) models.HostCheckin {
+	window, windowTag := Window(schedule, host.Tags, fallback)
+	status := models.HostCheckin{
+		HostID:                  host.HostID,
+		Hostname:                host.Hostname,
+		LastSeen:                host.LastSeen,
+		ExpectedIntervalSeconds: int64(window / time.Second),
+		WindowTag:               windowTag,
+		DueAt:                   host.LastSeen.Add(window),
+	}
+	if late := now.Sub(status.DueAt); late > 0 {
+		status.Overdue = true
+		status.OverdueSeconds = late.Seconds()
+	}
+	return status
+}
+
+// Finding describes an overdue host as a host_overdue finding
+func Finding(status models.HostCheckin, now time.Time) models.Finding {
+	window := time.Duration(status.ExpectedIntervalSeconds) * time.Second
+	finding := models.Finding{
+		Type:     models.FindingHostOverdue,
+		HostID:   status.HostID,
+		Hostname: status.Hostname,
+		Summary: fmt.Sprintf("%s has not checked in for %s (expected every %s)",
+			status.Hostname, now.Sub(status.LastSeen).Round(time.Minute), window),
+		Details:    []string{"last seen " + status.LastSeen.UTC().Format(time.RFC3339)},
+		DetectedAt: now,
+	}
+	if status.WindowTag != "" {
+		finding.Details = append(finding.Details, "window set by tag "+status.WindowTag)
+	}
+	return finding
+}
+
+// Uptime measures how much of [from, to) a host was covered by its reports
+// Each report covers the check-in window from when it was received, so a host is only
+// down once a report is overdue. reports are the host's report times in the period,
+// oldest first, optionally preceded by its last report before from. The host is measured
+// from from, or from its first report if it only started reporting during the period.
+func Uptime(reports []time.Time, window time.Duration, from, to time.Time) models.HostUptime {
+	start := from
+	if len(reports) > 0 && reports[0].After(start) {
+		start = reports[0]
+	}
+	if start.After(to) {
+		start = to
+	}
+	uptime := models.HostUptime{
+		ExpectedIntervalSeconds: int64(window / time.Second),
+		From:                    start,
+		To:                      to,
+		MeasuredSeconds:         to.Sub(start).Seconds(),
+	}
+
+	var up time.Duration
+	coveredUntil := start
+	outage := func(length time.Duration) {
+		uptime.Outages++
+		uptime.LongestOutageSeconds = math.Max(uptime.LongestOutageSeconds, length.Seconds())
+	}
+	for _, at := range reports {
+		if !at.Before(from) && at.Before(to) {
+			uptime.Reports++
+		}
+		covers, until := maxTime(at, start), minTime(at.Add(window), to)
+		if !until.After(covers) || !until.After(coveredUntil) {
+			continue
+		}
+		if covers.After(coveredUntil) {
+			outage(covers.Sub(coveredUntil))
+			coveredUntil = covers
+		}
+		up += until.Sub(coveredUntil)
+		coveredUntil = until
+	}
+	if to.After(coveredUntil) {
+		outage(to.Sub(coveredUntil))
+	}
+
+	uptime.UpSeconds = up.Seconds()
+	uptime.UptimePercent = Percent(uptime.UpSeconds, uptime.MeasuredSeconds)
+	return uptime
+}
+
+// Percent returns up as a percentage of measured, rounded to two decimals; 100 if nothing was measured
+func Percent(up, measured float64) float64 {
+	if measured <= 0 {
+		return 100
+	}
+	return math.Round(up/measured*10000) / 100
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Monitor raises host_overdue findings for organizations with a check-in schedule
+// Organizations without a schedule have not declared windows and are not monitored.
+// A host that stays overdue is reported again once the actions dedup window has passed.
+type Monitor struct {
+	store      storage.Storage
+	dispatcher *actions.Dispatcher
+	fallback   time.Duration
+	now        func() time.Time
+}
+
+// NewMonitor creates a monitor that fires findings through dispatcher
+// fallback is the window of hosts whose schedule matches no tag and sets no default.
+func NewMonitor(store storage.Storage, dispatcher *actions.Dispatcher, fallback time.Duration) *Monitor {
+	return &Monitor{
+		store:      store,
+		dispatcher: dispatcher,
+		fallback:   fallback,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run checks for overdue hosts every CheckInterval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.Check(); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to check host check-ins")
+			}
+		}
+	}
+}
+
+// Check fires a finding for each overdue host and returns the number of action runs queued
+// An organization that fails is logged and skipped so it does not hold up the others.
+func (m *Monitor) Check() (int, error) {
+	schedules, err := m.store.ListCheckinSchedules()
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	queued := 0
+	for _, schedule := range schedules {
+		hosts, err := m.store.ListHosts(schedule.OrgID, false)
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("org_id", schedule.OrgID).Msg("Failed to list hosts for check-ins")
+			continue
+		}
+		for _, host := range hosts {
+			status := Evaluate(schedule, host, m.fallback, now)
+			if !status.Overdue {
+				continue
+			}
+			n, err := m.dispatcher.Fire(schedule.OrgID, Finding(status, now))
+			if err != nil {
+				logger.Logger.Error().Err(err).Str("org_id", schedule.OrgID).Str("host_id", host.HostID).
+					Msg("Failed to queue host_overdue actions")
+				continue
+			}
+			queued += n
+		}
+	}
+	return queued, nil
+}
@@ -0,0 +1,197 @@
+package checkin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	testHostProd = "00000000-0000-0000-0000-000000000001"
+	testHostLab  = "00000000-0000-0000-0000-000000000002"
+)
+
+func TestWindow(t *testing.T) {
+	schedule := &models.CheckinSchedule{
+		DefaultIntervalSeconds: 7200,
+		Windows: []models.CheckinWindow{
+			{Tag: "env:lab", IntervalSeconds: 86400},
+			{Tag: "env:prod", IntervalSeconds: 3600},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		schedule *models.CheckinSchedule
+		tags     []string
+		want     time.Duration
+		wantTag  string
+	}{
+		{"matching tag", schedule, []string{"env:lab"}, 24 * time.Hour, "env:lab"},
+		{"shortest matching tag", schedule, []string{"env:lab", "team:web", "env:prod"}, time.Hour, "env:prod"},
+		{"schedule default", schedule, []string{"team:web"}, 2 * time.Hour, ""},
+		{"no default", &models.CheckinSchedule{Windows: schedule.Windows}, nil, 48 * time.Hour, ""},
+		{"no schedule", nil, []string{"env:prod"}, 48 * time.Hour, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotTag := Window(tt.schedule, tt.tags, 48*time.Hour)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantTag, gotTag)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	schedule := &models.CheckinSchedule{Windows: []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 3600}}}
+	host := &models.HostSummary{HostID: testHostProd, Hostname: "web-1", Tags: []string{"env:prod"}, LastSeen: now.Add(-90 * time.Minute)}
+
+	status := Evaluate(schedule, host, 24*time.Hour, now)
+	assert.True(t, status.Overdue)
+	assert.Equal(t, 1800.0, status.OverdueSeconds)
+	assert.Equal(t, int64(3600), status.ExpectedIntervalSeconds)
+	assert.Equal(t, "env:prod", status.WindowTag)
+	assert.Equal(t, now.Add(-30*time.Minute), status.DueAt)
+
+	finding := Finding(status, now)
+	assert.Equal(t, models.FindingHostOverdue, finding.Type)
+	assert.Equal(t, "web-1 has not checked in for 1h30m0s (expected every 1h0m0s)", finding.Summary)
+	assert.Contains(t, finding.Details, "window set by tag env:prod")
+
+	// Without the tag the host falls back to the server default
+	host.Tags = nil
+	status = Evaluate(schedule, host, 24*time.Hour, now)
+	assert.False(t, status.Overdue)
+	assert.Zero(t, status.OverdueSeconds)
+}
+
+func TestUptime(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	at := func(hours float64) time.Time { return from.Add(time.Duration(hours * float64(time.Hour))) }
+
+	tests := []struct {
+		name        string
+		reports     []time.Time
+		wantFrom    time.Time
+		wantUp      float64 // hours
+		wantPercent float64
+		wantReports int
+		wantOutages int
+		wantLongest float64 // hours
+	}{
+		{
+			name:        "hourly reports",
+			reports:     []time.Time{at(-0.5), at(0.5), at(1.5), at(2.5), at(3.5), at(4.5), at(5.5), at(6.5), at(7.5), at(8.5), at(9.5), at(10.5), at(11.5), at(12.5), at(13.5), at(14.5), at(15.5), at(16.5), at(17.5), at(18.5), at(19.5), at(20.5), at(21.5), at(22.5)},
+			wantFrom:    from,
+			wantUp:      24,
+			wantPercent: 100,
+			wantReports: 23,
+		},
+		{
+			name:        "gap in reports",
+			reports:     []time.Time{at(-0.5), at(0.5), at(6), at(6.5)},
+			wantFrom:    from,
+			wantUp:      4, // 0-2 and 6-8
+			wantPercent: 16.67,
+			wantReports: 3,
+			wantOutages: 2,
+			wantLongest: 16, // still down
+		},
+		{
+			name:        "first report during the period",
+			reports:     []time.Time{at(12), at(13), at(14), at(15), at(16), at(17), at(18), at(19), at(20), at(21), at(22), at(23)},
+			wantFrom:    at(12),
+			wantUp:      12,
+			wantPercent: 100,
+			wantReports: 12,
+		},
+		{
+			name:        "no reports",
+			wantFrom:    from,
+			wantPercent: 0,
+			wantOutages: 1,
+			wantLongest: 24,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Uptime(tt.reports, 90*time.Minute, from, to)
+			assert.Equal(t, tt.wantFrom, got.From)
+			assert.Equal(t, to, got.To)
+			assert.Equal(t, int64(5400), got.ExpectedIntervalSeconds)
+			assert.InDelta(t, tt.wantUp*3600, got.UpSeconds, 0.001)
+			assert.Equal(t, tt.wantPercent, got.UptimePercent)
+			assert.Equal(t, tt.wantReports, got.Reports)
+			assert.Equal(t, tt.wantOutages, got.Outages)
+			assert.InDelta(t, tt.wantLongest*3600, got.LongestOutageSeconds, 0.001)
+		})
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+	other, err := store.CreateOrganization("Other Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	for _, host := range []struct {
+		id, orgID string
+		seen      time.Time
+	}{
+		{testHostProd, org.ID, now.Add(-2 * time.Hour)},
+		{testHostLab, org.ID, now.Add(-2 * time.Hour)},
+		{"00000000-0000-0000-0000-000000000003", other.ID, now.Add(-30 * 24 * time.Hour)},
+	} {
+		require.NoError(t, store.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: host.seen,
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: "host-" + host.id[len(host.id)-1:]},
+			Data:       json.RawMessage(`{}`),
+		}, host.orgID, "user-1"))
+	}
+	require.NoError(t, store.SetHostTags(testHostProd, org.ID, []string{"env:prod"}, "", 0))
+	require.NoError(t, store.SetHostTags(testHostLab, org.ID, []string{"env:lab"}, "", 0))
+	require.NoError(t, store.SetCheckinSchedule(&models.CheckinSchedule{
+		OrgID: org.ID,
+		Windows: []models.CheckinWindow{
+			{Tag: "env:prod", IntervalSeconds: 3600},
+			{Tag: "env:lab", IntervalSeconds: 86400},
+		},
+	}))
+	action := &models.Action{
+		ID:       "action-1",
+		Name:     "Page on-call",
+		Triggers: []string{models.FindingHostOverdue},
+		Method:   http.MethodPost,
+		URL:      "https://example.com/page",
+		Enabled:  true,
+	}
+	require.NoError(t, store.CreateAction(action, org.ID))
+
+	m := NewMonitor(store, actions.NewDispatcher(store), 24*time.Hour)
+	queued, err := m.Check()
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued, "only the prod host is overdue; the other org has no schedule")
+
+	runs, err := store.ListActionRuns(action.ID, org.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, testHostProd, runs[0].Finding.HostID)
+
+	// A host that stays overdue is not reported again within the dedup window
+	queued, err = m.Check()
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+}
@@ -0,0 +1,93 @@
+package checkin
+
+import (
+	"errors"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+	"snailbus/internal/storage"
+)
+
+// StaleMonitor marks hosts that missed their check-in window as stale
+// It is checked every CheckInterval by the stale-hosts background job. Unlike Monitor it covers every organization: those without a schedule are held to the
+// server default window. A host's next report clears its mark. The number of stale hosts
+// of each organization is exported as hosts_stale_total.
+type StaleMonitor struct {
+	store    storage.Storage
+	fallback time.Duration
+	now      func() time.Time
+	exported map[string]bool // Organizations with a hosts_stale_total series
+}
+
+// NewStaleMonitor creates a monitor marking hosts stale in store
+// fallback is the window of hosts whose schedule matches no tag and sets no default.
+func NewStaleMonitor(store storage.Storage, fallback time.Duration) *StaleMonitor {
+	return &StaleMonitor{
+		store:    store,
+		fallback: fallback,
+		now:      func() time.Time { return time.Now().UTC() },
+		exported: make(map[string]bool),
+	}
+}
+
+// Check marks the hosts that are overdue as stale and returns the number newly marked
+// An organization that fails is logged and skipped so it does not hold up the others.
+func (m *StaleMonitor) Check() (int, error) {
+	orgIDs, err := m.store.ListHostOrgIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	marked := 0
+	seen := make(map[string]bool, len(orgIDs))
+	for _, orgID := range orgIDs {
+		seen[orgID] = true
+		n, stale, err := m.checkOrg(orgID, now)
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("org_id", orgID).Msg("Failed to mark stale hosts")
+			continue
+		}
+		marked += n
+		metrics.HostsStaleTotal.WithLabelValues(orgID).Set(float64(stale))
+		m.exported[orgID] = true
+	}
+
+	// Organizations left without hosts drop their series
+	for orgID := range m.exported {
+		if !seen[orgID] {
+			metrics.HostsStaleTotal.DeleteLabelValues(orgID)
+			delete(m.exported, orgID)
+		}
+	}
+	return marked, nil
+}
+
+// checkOrg marks the organization's overdue hosts, returning how many were newly marked
+// and how many are stale
+func (m *StaleMonitor) checkOrg(orgID string, now time.Time) (int, int, error) {
+	schedule, err := m.store.GetCheckinSchedule(orgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, 0, err
+	}
+	hosts, err := m.store.ListHosts(orgID, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stale := make(map[string]time.Time)
+	for _, host := range hosts {
+		if Evaluate(schedule, host, m.fallback, now).Overdue {
+			stale[host.HostID] = host.LastSeen
+		}
+	}
+	marked, err := m.store.MarkStaleHosts(orgID, stale, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if marked > 0 {
+		logger.Logger.Info().Str("org_id", orgID).Int("marked", marked).Int("stale", len(stale)).Msg("Marked hosts stale")
+	}
+	return marked, len(stale), nil
+}
@@ -0,0 +1,102 @@
+package checkin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/metrics"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestStaleMonitor_Check(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+	other, err := store.CreateOrganization("Other Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	const otherHost = "00000000-0000-0000-0000-000000000003"
+	save := func(hostID, orgID string, seen time.Time) {
+		require.NoError(t, store.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: seen,
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(`{}`),
+		}, orgID, "user-1"))
+	}
+	save(testHostProd, org.ID, now.Add(-2*time.Hour))
+	save(testHostLab, org.ID, now.Add(-2*time.Hour))
+	save(otherHost, other.ID, now.Add(-30*24*time.Hour))
+	require.NoError(t, store.SetHostTags(testHostProd, org.ID, []string{"env:prod"}, "", 0))
+	require.NoError(t, store.SetCheckinSchedule(&models.CheckinSchedule{
+		OrgID:   org.ID,
+		Windows: []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 3600}},
+	}))
+
+	m := NewStaleMonitor(store, 24*time.Hour)
+	m.now = func() time.Time { return now }
+	marked, err := m.Check()
+	require.NoError(t, err)
+	assert.Equal(t, 2, marked, "the prod host misses its window; the other org's host the server default")
+
+	statuses := func(orgID string) map[string]string {
+		hosts, err := store.ListHosts(orgID, false)
+		require.NoError(t, err)
+		statuses := make(map[string]string)
+		for _, host := range hosts {
+			statuses[host.HostID] = host.Status
+		}
+		return statuses
+	}
+	assert.Equal(t, map[string]string{testHostProd: models.HostStatusStale, testHostLab: models.HostStatusActive}, statuses(org.ID))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.HostsStaleTotal.WithLabelValues(org.ID)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.HostsStaleTotal.WithLabelValues(other.ID)))
+
+	// Hosts already marked keep the time they were first found stale
+	m.now = func() time.Time { return now.Add(time.Hour) }
+	marked, err = m.Check()
+	require.NoError(t, err)
+	assert.Equal(t, 0, marked)
+	hosts, err := store.ListHosts(other.ID, false)
+	require.NoError(t, err)
+	require.NotNil(t, hosts[0].StaleSince)
+	assert.Equal(t, now, *hosts[0].StaleSince)
+
+	// A report clears the mark, and a longer window clears a host it no longer covers
+	save(testHostProd, org.ID, now)
+	require.NoError(t, store.SetCheckinSchedule(&models.CheckinSchedule{OrgID: other.ID, DefaultIntervalSeconds: 60 * 86400}))
+	_, err = m.Check()
+	require.NoError(t, err)
+	assert.Equal(t, models.HostStatusActive, statuses(org.ID)[testHostProd])
+	assert.Equal(t, models.HostStatusActive, statuses(other.ID)[otherHost])
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.HostsStaleTotal.WithLabelValues(other.ID)))
+}
+
+func TestStaleMonitor_ReportDuringCheck(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	require.NoError(t, store.SaveHost(&models.Report{
+		ID:         testHostProd,
+		ReceivedAt: now,
+		Meta:       models.ReportMeta{HostID: testHostProd, Hostname: "web-1"},
+		Data:       json.RawMessage(`{}`),
+	}, org.ID, "user-1"))
+
+	// The host was found overdue on an older report than the one now stored
+	marked, err := store.MarkStaleHosts(org.ID, map[string]time.Time{testHostProd: now.Add(-48 * time.Hour)}, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, marked)
+	hosts, err := store.ListHosts(org.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.HostStatusActive, hosts[0].Status)
+}
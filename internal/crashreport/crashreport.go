@@ -0,0 +1,269 @@
+// Package crashreport forwards recovered panics to a Sentry-compatible error tracker.
+//
+// Events are posted to the store endpoint of the project named by a Sentry DSN
+// (https://<key>@<host>/<project>), which Sentry and compatible servers such as
+// GlitchTip accept. Delivery runs in the background with a short timeout and is best
+// effort: failures are logged, never retried, and never delay the response. Flush
+// waits for deliveries still running, so reports of a panic shortly before shutdown
+// are not lost.
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"snailbus/internal/logger"
+)
+
+// deliveryTimeout bounds each delivery
+const deliveryTimeout = 5 * time.Second
+
+// Reporter sends events to an error tracker. A nil Reporter drops them.
+type Reporter struct {
+	endpoint    string
+	auth        string
+	release     string
+	environment string
+	serverName  string
+	client      *http.Client
+	pending     sync.WaitGroup // Deliveries running in the background
+}
+
+// New creates a reporter for dsn
+func New(dsn, release, environment string) (*Reporter, error) {
+	endpoint, key, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	serverName, _ := os.Hostname()
+	return &Reporter{
+		endpoint:    endpoint,
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=snailbus/%s, sentry_key=%s", release, key),
+		release:     release,
+		environment: environment,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: deliveryTimeout},
+	}, nil
+}
+
+// ParseDSN returns the store endpoint and public key of a Sentry DSN
+func ParseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid DSN: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("invalid DSN: scheme must be http or https")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid DSN: missing public key")
+	}
+	path := strings.Trim(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return "", "", fmt.Errorf("invalid DSN: missing project ID")
+	}
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project), u.User.Username(), nil
+}
+
+// Panic describes a recovered panic
+type Panic struct {
+	Value     interface{}
+	Stack     []uintptr // Program counters, as captured by runtime.Callers in the deferred recover
+	RequestID string
+	Method    string
+	Route     string // Matched route pattern, or the path if none matched
+	URL       string
+}
+
+// Event is the part of the Sentry event payload the reporter fills in
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Request     *EventRequest     `json:"request,omitempty"`
+	Exception   struct {
+		Values []Exception `json:"values"`
+	} `json:"exception"`
+}
+
+// EventRequest is the request that panicked
+type EventRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// Exception is the panic value with the stack it was raised on
+type Exception struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []Frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// Frame is a stack frame; Sentry lists frames outermost first
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// NewEvent builds the event reporting p
+func (r *Reporter) NewEvent(p Panic) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	e := Event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "fatal",
+		Platform:    "go",
+		Logger:      "snailbus",
+		Release:     r.release,
+		Environment: r.environment,
+		ServerName:  r.serverName,
+		Transaction: strings.TrimSpace(p.Method + " " + p.Route),
+		Message:     fmt.Sprintf("panic: %v", p.Value),
+		Tags:        map[string]string{"request_id": p.RequestID},
+	}
+	if p.Method != "" {
+		e.Request = &EventRequest{Method: p.Method, URL: p.URL}
+	}
+
+	exception := Exception{Type: fmt.Sprintf("%T", p.Value), Value: fmt.Sprint(p.Value)}
+	if err, ok := p.Value.(error); ok {
+		exception.Value = err.Error()
+	}
+	exception.Stacktrace.Frames = Frames(p.Stack)
+	e.Exception.Values = []Exception{exception}
+	return e
+}
+
+// Frames resolves program counters to frames, outermost first
+func Frames(pcs []uintptr) []Frame {
+	var frames []Frame
+	callers := runtime.CallersFrames(pcs)
+	for {
+		f, more := callers.Next()
+		if f.Function != "" {
+			module, function := splitFunction(f.Function)
+			frames = append(frames, Frame{
+				Function: function,
+				Module:   module,
+				Filename: f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(module, "snailbus"),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// splitFunction splits a qualified function name such as
+// snailbus/internal/handlers.(*Handlers).Ingest into its package and function
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
+
+// Report sends the event for p in the background
+func (r *Reporter) Report(p Panic) {
+	if r == nil {
+		return
+	}
+	event := r.NewEvent(p)
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		if err := r.send(event); err != nil {
+			logger.Logger.Warn().
+				Err(err).
+				Str("event_id", event.EventID).
+				Str("request_id", p.RequestID).
+				Msg("Failed to deliver crash report")
+		}
+	}()
+}
+
+// Flush waits for the reports being delivered, or until ctx is done
+// Each delivery is bounded by its own timeout, so Flush returns within it regardless.
+func (r *Reporter) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reporter) send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error tracker returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package crashreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDSN(t *testing.T) {
+	endpoint, key, err := ParseDSN("https://abc123@o1.ingest.sentry.io/42")
+	require.NoError(t, err)
+	assert.Equal(t, "https://o1.ingest.sentry.io/api/42/store/", endpoint)
+	assert.Equal(t, "abc123", key)
+
+	// Self-hosted trackers may live under a path
+	endpoint, _, err = ParseDSN("http://abc123@glitchtip.internal:8000/errors/7")
+	require.NoError(t, err)
+	assert.Equal(t, "http://glitchtip.internal:8000/errors/api/7/store/", endpoint)
+
+	for _, dsn := range []string{"", "https://o1.ingest.sentry.io/42", "https://abc123@o1.ingest.sentry.io/", "ftp://abc123@host/1", "::"} {
+		_, _, err := ParseDSN(dsn)
+		assert.Error(t, err, dsn)
+	}
+}
+
+func TestReporter_Report(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://key1@", 1) + "/5"
+	reporter, err := New(dsn, "1.2.3", "staging")
+	require.NoError(t, err)
+
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	reporter.Report(Panic{
+		Value:     errors.New("nil map write"),
+		Stack:     pcs,
+		RequestID: "req-1",
+		Method:    http.MethodPost,
+		Route:     "/api/v1/ingest",
+		URL:       "/api/v1/ingest",
+	})
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+	}
+	assert.Equal(t, "/api/5/store/", r.URL.Path)
+	assert.Contains(t, r.Header.Get("X-Sentry-Auth"), "sentry_key=key1")
+
+	var event Event
+	require.NoError(t, json.Unmarshal(<-bodies, &event))
+	assert.Len(t, event.EventID, 32)
+	assert.Equal(t, "1.2.3", event.Release)
+	assert.Equal(t, "staging", event.Environment)
+	assert.Equal(t, "POST /api/v1/ingest", event.Transaction)
+	assert.Equal(t, "req-1", event.Tags["request_id"])
+	require.Len(t, event.Exception.Values, 1)
+	exception := event.Exception.Values[0]
+	assert.Equal(t, "*errors.errorString", exception.Type)
+	assert.Equal(t, "nil map write", exception.Value)
+
+	// The innermost frame, this test, comes last
+	frames := exception.Stacktrace.Frames
+	require.NotEmpty(t, frames)
+	last := frames[len(frames)-1]
+	assert.Equal(t, "snailbus/internal/crashreport", last.Module)
+	assert.Equal(t, "TestReporter_Report", last.Function)
+	assert.True(t, last.InApp)
+}
+
+func TestReporter_Flush(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		delivered <- struct{}{}
+	}))
+	defer server.Close()
+
+	reporter, err := New(strings.Replace(server.URL, "http://", "http://key1@", 1)+"/5", "1.2.3", "")
+	require.NoError(t, err)
+	reporter.Report(Panic{Value: "boom"})
+
+	// A delivery still running holds up Flush until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, reporter.Flush(ctx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, reporter.Flush(context.Background()))
+	select {
+	case <-delivered:
+	default:
+		t.Fatal("Flush returned before the event was delivered")
+	}
+}
+
+func TestReporter_Nil(t *testing.T) {
+	var reporter *Reporter
+	reporter.Report(Panic{Value: "boom"}) // Does nothing
+	assert.NoError(t, reporter.Flush(context.Background()))
+}
+
+func TestSplitFunction(t *testing.T) {
+	module, function := splitFunction("snailbus/internal/handlers.(*Handlers).Ingest")
+	assert.Equal(t, "snailbus/internal/handlers", module)
+	assert.Equal(t, "(*Handlers).Ingest", function)
+
+	module, function = splitFunction("runtime.gopanic")
+	assert.Equal(t, "runtime", module)
+	assert.Equal(t, "gopanic", function)
+}
@@ -0,0 +1,173 @@
+// Package dbadvisor suggests storage and vacuum changes for the snailbus tables from
+// their statistics.
+//
+// The hosts tables are written with INSERT ... ON CONFLICT DO UPDATE, which leaves a
+// dead row version behind for every report. Unless the new version fits on the same
+// page (a HOT update), every index gets a new entry too, so the tables and their
+// indexes bloat faster than autovacuum's defaults expect. The advisor flags tables
+// where that happens and proposes a lower fillfactor, more eager autovacuum settings,
+// partitioning, or dropping unused indexes. Suggestions come with the SQL applying
+// them, which should be reviewed before it is run.
+package dbadvisor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"snailbus/internal/models"
+)
+
+// Thresholds for advice
+const (
+	// FillFactor advice needs this many updates and a HOT ratio below LowHOTRatio
+	MinUpdatesForFillFactor = 10000
+	LowHOTRatio             = 0.5
+	SuggestedFillFactor     = 80
+
+	// Autovacuum advice needs this many dead tuples, making up at least HighDeadTupleRatio
+	MinDeadTuples      = 10000
+	HighDeadTupleRatio = 0.2
+	// SuggestedVacuumScaleFactor replaces the default autovacuum_vacuum_scale_factor of 0.2
+	SuggestedVacuumScaleFactor = 0.05
+
+	// Bloat advice needs this much estimated bloat, making up at least HighBloatRatio of the relation
+	MinBloatBytes  = 1 << 30
+	HighBloatRatio = 0.3
+
+	// Partitioning advice needs a table this large whose deletes reach PartitionDeleteRatio of its inserts
+	MinPartitionBytes    = 10 << 30
+	PartitionDeleteRatio = 0.25
+
+	// Unused index advice needs a non-unique index this large that was never scanned
+	MinUnusedIndexBytes = 10 << 20
+)
+
+// Advise returns the suggested changes for the tables, warnings first
+func Advise(tables []models.TableMaintenance, now time.Time) []models.MaintenanceAdvice {
+	advice := []models.MaintenanceAdvice{}
+	for _, t := range tables {
+		advice = append(advice, adviseTable(t, now)...)
+	}
+	sort.SliceStable(advice, func(i, j int) bool {
+		a, b := advice[i], advice[j]
+		if a.Severity != b.Severity {
+			return a.Severity == models.AdviceWarning
+		}
+		return a.Table < b.Table
+	})
+	return advice
+}
+
+// adviseTable returns the suggested changes for one table
+func adviseTable(t models.TableMaintenance, now time.Time) []models.MaintenanceAdvice {
+	var advice []models.MaintenanceAdvice
+	table := pq.QuoteIdentifier(t.Table)
+
+	if t.Updates >= MinUpdatesForFillFactor && t.HOTUpdateRatio < LowHOTRatio {
+		if t.FillFactor >= 100 {
+			advice = append(advice, models.MaintenanceAdvice{
+				Table:    t.Table,
+				Kind:     models.AdviceFillFactor,
+				Severity: models.AdviceWarning,
+				Message: fmt.Sprintf("%.0f%% of %d updates were HOT. Pages are filled completely, so updated rows move to other pages "+
+					"and every index gets a new entry. A fillfactor of %d leaves room for updates on the same page; it applies to pages "+
+					"written from now on, or to the whole table after VACUUM FULL or pg_repack.",
+					t.HOTUpdateRatio*100, t.Updates, SuggestedFillFactor),
+				SQL: fmt.Sprintf("ALTER TABLE %s SET (fillfactor = %d);", table, SuggestedFillFactor),
+			})
+		} else {
+			advice = append(advice, models.MaintenanceAdvice{
+				Table:    t.Table,
+				Kind:     models.AdviceFillFactor,
+				Severity: models.AdviceInfo,
+				Message: fmt.Sprintf("%.0f%% of %d updates were HOT despite a fillfactor of %d. Updates that change an indexed "+
+					"column can't be HOT; check whether the indexes on frequently updated columns are needed.",
+					t.HOTUpdateRatio*100, t.Updates, t.FillFactor),
+			})
+		}
+	}
+
+	if t.DeadTuples >= MinDeadTuples && t.DeadTupleRatio >= HighDeadTupleRatio {
+		advice = append(advice, models.MaintenanceAdvice{
+			Table:    t.Table,
+			Kind:     models.AdviceAutovacuum,
+			Severity: models.AdviceWarning,
+			Message: fmt.Sprintf("%.0f%% of the tuples (%d) are dead; the table was last vacuumed %s. A lower scale factor "+
+				"makes autovacuum run after fewer changes.",
+				t.DeadTupleRatio*100, t.DeadTuples, lastVacuumed(t, now)),
+			SQL: fmt.Sprintf("ALTER TABLE %s SET (autovacuum_vacuum_scale_factor = %g);", table, SuggestedVacuumScaleFactor),
+		})
+	}
+
+	if total := t.TableBytes + t.IndexBytes; t.EstimatedBloatBytes >= MinBloatBytes && total > 0 &&
+		float64(t.EstimatedBloatBytes)/float64(total) >= HighBloatRatio {
+		advice = append(advice, models.MaintenanceAdvice{
+			Table:    t.Table,
+			Kind:     models.AdviceBloat,
+			Severity: models.AdviceWarning,
+			Message: fmt.Sprintf("About %s of the table's %s is held by dead tuples. VACUUM makes the space reusable but does "+
+				"not shrink the files; VACUUM FULL (which locks the table) or pg_repack returns it to the operating system.",
+				formatBytes(t.EstimatedBloatBytes), formatBytes(total)),
+			SQL: fmt.Sprintf("VACUUM (ANALYZE) %s;", table),
+		})
+	}
+
+	if !t.Partitioned && t.TableBytes+t.IndexBytes >= MinPartitionBytes && t.Inserts > 0 &&
+		float64(t.Deletes) >= PartitionDeleteRatio*float64(t.Inserts) {
+		advice = append(advice, models.MaintenanceAdvice{
+			Table:    t.Table,
+			Kind:     models.AdvicePartitioning,
+			Severity: models.AdviceInfo,
+			Message: fmt.Sprintf("The table holds %s and %d of its %d inserted rows were deleted again. Partitioning it by "+
+				"time lets retention drop whole partitions instead of deleting rows that vacuum then has to reclaim.",
+				formatBytes(t.TableBytes+t.IndexBytes), t.Deletes, t.Inserts),
+		})
+	}
+
+	for _, index := range t.Indexes {
+		if index.Scans > 0 || index.Unique || index.Bytes < MinUnusedIndexBytes {
+			continue
+		}
+		advice = append(advice, models.MaintenanceAdvice{
+			Table:    t.Table,
+			Index:    index.Name,
+			Kind:     models.AdviceUnusedIndex,
+			Severity: models.AdviceInfo,
+			Message: fmt.Sprintf("The index takes %s and was not scanned since statistics were reset. Every update that is "+
+				"not HOT writes to it. Scans on replicas are not counted here; check them before dropping it.",
+				formatBytes(index.Bytes)),
+			SQL: fmt.Sprintf("DROP INDEX CONCURRENTLY %s;", pq.QuoteIdentifier(index.Name)),
+		})
+	}
+
+	return advice
+}
+
+// lastVacuumed describes when a table was last vacuumed, manually or by autovacuum
+func lastVacuumed(t models.TableMaintenance, now time.Time) string {
+	last := t.LastAutovacuum
+	if t.LastVacuum != nil && (last == nil || t.LastVacuum.After(*last)) {
+		last = t.LastVacuum
+	}
+	if last == nil {
+		return "never"
+	}
+	return now.Sub(*last).Truncate(time.Minute).String() + " ago"
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
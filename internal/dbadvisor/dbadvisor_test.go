@@ -0,0 +1,102 @@
+package dbadvisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+func TestAdvise(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	vacuumed := now.Add(-36 * time.Hour)
+
+	tables := []models.TableMaintenance{
+		{
+			// Upserted on every report with the default fillfactor
+			Table:               "hosts",
+			FillFactor:          100,
+			TableBytes:          2 << 30,
+			IndexBytes:          1 << 30,
+			LiveTuples:          100000,
+			DeadTuples:          50000,
+			DeadTupleRatio:      1.0 / 3,
+			Updates:             200000,
+			HOTUpdates:          20000,
+			HOTUpdateRatio:      0.1,
+			EstimatedBloatBytes: 1 << 30,
+			LastAutovacuum:      &vacuumed,
+			Indexes: []models.IndexMaintenance{
+				{Name: "hosts_pkey", Bytes: 100 << 20, Unique: true},
+				{Name: "idx_hosts_unused", Bytes: 50 << 20},
+				{Name: "idx_hosts_small", Bytes: 1 << 20},
+			},
+		},
+		{
+			// Large, with rows deleted by retention
+			Table:      "host_events",
+			FillFactor: 100,
+			TableBytes: 12 << 30,
+			IndexBytes: 2 << 30,
+			Inserts:    1000000,
+			Deletes:    400000,
+		},
+		{
+			// Healthy
+			Table:          "organizations",
+			FillFactor:     100,
+			Updates:        50000,
+			HOTUpdates:     45000,
+			HOTUpdateRatio: 0.9,
+		},
+	}
+
+	advice := Advise(tables, now)
+	kinds := make(map[string][]string)
+	for _, a := range advice {
+		kinds[a.Table] = append(kinds[a.Table], a.Kind)
+	}
+	assert.ElementsMatch(t, []string{models.AdviceFillFactor, models.AdviceAutovacuum, models.AdviceBloat, models.AdviceUnusedIndex}, kinds["hosts"])
+	assert.Equal(t, []string{models.AdvicePartitioning}, kinds["host_events"])
+	assert.Empty(t, kinds["organizations"])
+
+	// Warnings first
+	require.Len(t, advice, 5)
+	for _, a := range advice[:3] {
+		assert.Equal(t, models.AdviceWarning, a.Severity)
+	}
+	for _, a := range advice[3:] {
+		assert.Equal(t, models.AdviceInfo, a.Severity)
+	}
+
+	for _, a := range advice {
+		switch a.Kind {
+		case models.AdviceFillFactor:
+			assert.Equal(t, `ALTER TABLE "hosts" SET (fillfactor = 80);`, a.SQL)
+		case models.AdviceAutovacuum:
+			assert.Contains(t, a.Message, "last vacuumed 36h0m0s ago")
+			assert.Equal(t, `ALTER TABLE "hosts" SET (autovacuum_vacuum_scale_factor = 0.05);`, a.SQL)
+		case models.AdviceUnusedIndex:
+			assert.Equal(t, "idx_hosts_unused", a.Index)
+			assert.Equal(t, `DROP INDEX CONCURRENTLY "idx_hosts_unused";`, a.SQL)
+		}
+	}
+}
+
+func TestAdvise_LoweredFillFactor(t *testing.T) {
+	advice := Advise([]models.TableMaintenance{
+		{Table: "hosts", FillFactor: 80, Updates: 200000, HOTUpdateRatio: 0.1},
+	}, time.Now())
+	require.Len(t, advice, 1)
+	assert.Equal(t, models.AdviceInfo, advice[0].Severity)
+	assert.Empty(t, advice[0].SQL, "lowering the fillfactor further would not help")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "3.0 GiB", formatBytes(3<<30))
+}
@@ -0,0 +1,249 @@
+// Package demo seeds an example organization so the API can be explored without
+// wiring up snail-core agents.
+//
+// Seed creates the organization, one user of each role, an API key for the admin,
+// and a fleet of synthetic hosts whose reports carry the sections snailbus derives
+// data from (OS, packages, listening ports, and accounts). Hosts are tagged by
+// environment and team, a few have not reported for days, and a few reported
+// collection errors, so search, facets, check-ins, and exports all have something
+// to show. The fleet is generated from a fixed seed and looks the same every time.
+package demo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	// DefaultOrgName is the organization Seed creates
+	DefaultOrgName = "Snailbus Demo"
+	// DefaultPassword is the password of the demo users unless another is given
+	DefaultPassword = "snailbus-demo"
+	// DefaultHosts is how many synthetic hosts Seed creates
+	DefaultHosts = 36
+	// MaxHosts bounds Options.Hosts
+	MaxHosts = 1000
+)
+
+// ErrAlreadySeeded is returned when the demo organization already exists
+var ErrAlreadySeeded = errors.New("demo organization already exists")
+
+// Options configures Seed; zero values use the defaults
+type Options struct {
+	OrgName  string
+	Password string
+	Hosts    int
+	Now      time.Time // Reference time for the hosts' last reports
+}
+
+// Result describes what Seed created
+type Result struct {
+	Organization *models.Organization `json:"organization"`
+	Users        []*models.User       `json:"users"`
+	Password     string               `json:"password"`
+	APIKey       string               `json:"api_key"` // Admin's key; shown only here
+	Hosts        int                  `json:"hosts"`
+}
+
+// roles are the demo users, one per role
+var roles = []string{"admin", "editor", "viewer"}
+
+// profile is a kind of host in the synthetic fleet
+type profile struct {
+	prefix   string
+	tags     []string
+	packages []string
+	ports    []port
+	accounts []string
+}
+
+type port struct {
+	protocol string
+	number   int
+	process  string
+}
+
+var profiles = []profile{
+	{"web", []string{"env:prod", "team:web"}, []string{"nginx", "openssl", "curl"}, []port{{"tcp", 22, "sshd"}, {"tcp", 80, "nginx"}, {"tcp", 443, "nginx"}}, []string{"nginx"}},
+	{"api", []string{"env:prod", "team:platform"}, []string{"openssl", "python3", "gunicorn"}, []port{{"tcp", 22, "sshd"}, {"tcp", 8000, "gunicorn"}}, []string{"app"}},
+	{"db", []string{"env:prod", "team:data"}, []string{"postgresql-server", "openssl"}, []port{{"tcp", 22, "sshd"}, {"tcp", 5432, "postgres"}}, []string{"postgres"}},
+	{"cache", []string{"env:prod", "team:platform"}, []string{"redis"}, []port{{"tcp", 22, "sshd"}, {"tcp", 6379, "redis-server"}}, []string{"redis"}},
+	{"ci", []string{"env:lab", "team:platform"}, []string{"git", "podman", "golang"}, []port{{"tcp", 22, "sshd"}, {"udp", 323, "chronyd"}}, []string{"runner"}},
+	{"lab", []string{"env:lab"}, []string{"git", "vim-enhanced", "podman"}, []port{{"tcp", 22, "sshd"}, {"tcp", 5900, "Xvnc"}}, []string{"alice", "bob"}},
+}
+
+// distros are the operating systems hosts run, as reported by snail-core
+var distros = []struct{ name, version, major, minor string }{
+	{"Fedora", "42", "42", ""},
+	{"Fedora", "41", "41", ""},
+	{"Debian", "12.2", "12", "2"},
+	{"Ubuntu", "22.04", "22", "04"},
+	{"Red Hat Enterprise Linux", "9.4", "9", "4"},
+	{"Rocky Linux", "9.3", "9", "3"},
+}
+
+// Seed creates the demo organization, users, and hosts
+// It returns ErrAlreadySeeded, without changing anything, if the organization exists,
+// and an error if the demo usernames (demo-admin, demo-editor, demo-viewer) are taken.
+func Seed(store storage.Storage, opts Options) (*Result, error) {
+	if opts.OrgName == "" {
+		opts.OrgName = DefaultOrgName
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if opts.Hosts == 0 {
+		opts.Hosts = DefaultHosts
+	}
+	if opts.Hosts < 0 || opts.Hosts > MaxHosts {
+		return nil, fmt.Errorf("hosts must be between 1 and %d: %d", MaxHosts, opts.Hosts)
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now().UTC()
+	}
+
+	if _, err := store.GetOrganizationByName(opts.OrgName); err == nil {
+		return nil, ErrAlreadySeeded
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check organization: %w", err)
+	}
+
+	for _, role := range roles {
+		if _, _, err := store.GetUserByUsername("demo-" + role); err == nil {
+			return nil, fmt.Errorf("user demo-%s already exists", role)
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to check username: %w", err)
+		}
+	}
+
+	org, err := store.CreateOrganization(opts.OrgName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	result := &Result{Organization: org, Password: opts.Password}
+
+	passwordHash, err := auth.HashPassword(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		username := "demo-" + role
+		user, err := store.CreateUser(username, username+"@demo.snailbus.local", passwordHash, org.ID, role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user %s: %w", username, err)
+		}
+		result.Users = append(result.Users, user)
+	}
+	admin := result.Users[0]
+
+	plainKey, _, err := storage.GenerateAPIKey(store, admin.ID, "Demo", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	result.APIKey = plainKey
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < opts.Hosts; i++ {
+		report, tags := syntheticHost(rng, org.ID, i, opts.Now)
+		if err := store.SaveHost(report, org.ID, admin.ID); err != nil {
+			return nil, fmt.Errorf("failed to save host %s: %w", report.Meta.Hostname, err)
+		}
+		if err := store.SetHostTags(report.Meta.HostID, org.ID, tags, admin.ID, 0); err != nil {
+			return nil, fmt.Errorf("failed to tag host %s: %w", report.Meta.Hostname, err)
+		}
+		result.Hosts++
+	}
+
+	return result, nil
+}
+
+// syntheticHost builds the i-th host's report and tags
+// Host IDs are derived from the organization, so they never collide with the hosts
+// of a demo organization seeded into another database and later merged.
+func syntheticHost(rng *rand.Rand, orgID string, i int, now time.Time) (*models.Report, []string) {
+	p := profiles[i%len(profiles)]
+	hostname := fmt.Sprintf("%s-%02d.demo.snailbus.local", p.prefix, i/len(profiles)+1)
+	hostID := uuid.NewSHA1(uuid.NameSpaceURL, []byte("snailbus-demo:"+orgID+"/"+hostname)).String()
+	distro := distros[rng.Intn(len(distros))]
+
+	// Most hosts reported within the hour; every tenth has been silent for days
+	age := time.Duration(rng.Intn(60)) * time.Minute
+	if i%10 == 9 {
+		age = time.Duration(2+rng.Intn(5)) * 24 * time.Hour
+	}
+	receivedAt := now.Add(-age).Truncate(time.Second)
+
+	packages := []map[string]string{
+		{"name": "bash", "version": "5.2.26", "release": "3"},
+		{"name": "systemd", "version": fmt.Sprintf("25%d", 3+rng.Intn(4)), "release": "1"},
+	}
+	for _, name := range p.packages {
+		packages = append(packages, map[string]string{
+			"name":    name,
+			"version": fmt.Sprintf("%d.%d.%d", 1+rng.Intn(3), rng.Intn(20), rng.Intn(10)),
+			"release": fmt.Sprint(1 + rng.Intn(5)),
+		})
+	}
+
+	ports := make([]map[string]interface{}, 0, len(p.ports))
+	for _, pt := range p.ports {
+		ports = append(ports, map[string]interface{}{
+			"protocol": pt.protocol,
+			"address":  "0.0.0.0",
+			"port":     pt.number,
+			"process":  pt.process,
+			"pid":      1000 + rng.Intn(30000),
+		})
+	}
+
+	users := []map[string]interface{}{
+		{"name": "root", "uid": 0, "gid": 0, "home": "/root", "shell": "/bin/bash"},
+	}
+	for j, name := range p.accounts {
+		users = append(users, map[string]interface{}{
+			"name": name, "uid": 1000 + j, "gid": 1000 + j, "home": "/home/" + name, "shell": "/bin/bash",
+		})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"system": map[string]interface{}{
+			"hostname": hostname,
+			"os": map[string]string{
+				"name":          distro.name,
+				"version":       distro.version,
+				"version_major": distro.major,
+				"version_minor": distro.minor,
+			},
+			"uptime_seconds": rng.Intn(90 * 24 * 3600),
+		},
+		"packages": map[string]interface{}{"installed": packages},
+		"network":  map[string]interface{}{"listening_ports": ports},
+		"users":    users,
+	})
+
+	report := &models.Report{
+		ID:         hostID,
+		ReceivedAt: receivedAt,
+		Meta: models.ReportMeta{
+			Hostname:     hostname,
+			HostID:       hostID,
+			CollectionID: uuid.NewSHA1(uuid.NameSpaceURL, []byte("snailbus-demo:"+hostID+"/"+receivedAt.String())).String(),
+			Timestamp:    receivedAt.Format(time.RFC3339),
+			SnailVersion: "0.5.0",
+		},
+		Data: data,
+	}
+	if i%12 == 5 {
+		report.Errors = []string{"packages: dnf history is locked by another process"}
+	}
+	return report, append([]string(nil), p.tags...)
+}
@@ -0,0 +1,72 @@
+package demo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/storage"
+)
+
+func TestSeed(t *testing.T) {
+	store := storage.NewMockStorage()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	result, err := Seed(store, Options{Now: now})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOrgName, result.Organization.Name)
+	assert.Equal(t, DefaultPassword, result.Password)
+	assert.NotEmpty(t, result.APIKey)
+	assert.Equal(t, DefaultHosts, result.Hosts)
+
+	// One user of each role, all able to log in with the password
+	require.Len(t, result.Users, 3)
+	for i, role := range []string{"admin", "editor", "viewer"} {
+		user, hash, err := store.GetUserByUsername("demo-" + role)
+		require.NoError(t, err)
+		assert.Equal(t, role, user.Role)
+		assert.Equal(t, result.Users[i].ID, user.ID)
+		assert.True(t, auth.CheckPassword(DefaultPassword, hash))
+	}
+
+	hosts, err := store.ListHosts(result.Organization.ID, false)
+	require.NoError(t, err)
+	require.Len(t, hosts, DefaultHosts)
+	stale := 0
+	for _, host := range hosts {
+		assert.NotEmpty(t, host.OSName, host.Hostname)
+		assert.Contains(t, host.Tags[0], "env:", host.Hostname)
+		if now.Sub(host.LastSeen) > 24*time.Hour {
+			stale++
+		}
+	}
+	assert.Equal(t, DefaultHosts/10, stale, "every tenth host has been silent for days")
+
+	// Seeding again leaves the organization alone
+	_, err = Seed(store, Options{Now: now})
+	assert.True(t, errors.Is(err, ErrAlreadySeeded))
+
+	// Another demo organization would reuse the demo usernames
+	_, err = Seed(store, Options{OrgName: "Other Demo", Now: now})
+	assert.ErrorContains(t, err, "demo-admin already exists")
+	_, err = store.GetOrganizationByName("Other Demo")
+	assert.True(t, errors.Is(err, storage.ErrNotFound), "nothing is created")
+}
+
+func TestSeed_Options(t *testing.T) {
+	store := storage.NewMockStorage()
+
+	_, err := Seed(store, Options{Hosts: MaxHosts + 1})
+	assert.Error(t, err)
+
+	result, err := Seed(store, Options{OrgName: "Eval", Password: "correct-horse", Hosts: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Hosts)
+	_, hash, err := store.GetUserByUsername("demo-viewer")
+	require.NoError(t, err)
+	assert.True(t, auth.CheckPassword("correct-horse", hash))
+}
@@ -0,0 +1,315 @@
+// Package errorrate tracks per-endpoint server error rates for self-monitoring.
+//
+// Every response is recorded into ten-second buckets per endpoint. The tracker
+// reports the 5xx ratio over fixed sliding windows and, when a threshold is
+// configured, raises an alert for each endpoint whose ratio over the alert window
+// exceeds it. While any alert is firing the service reports itself as degraded.
+package errorrate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"snailbus/internal/metrics"
+)
+
+const (
+	// BucketWidth is the resolution of the sliding windows
+	BucketWidth = 10 * time.Second
+	// MaxWindow is the longest window the tracker keeps data for
+	MaxWindow = 15 * time.Minute
+
+	// DefaultWindow is the alert window used when none is configured
+	DefaultWindow = 5 * time.Minute
+	// DefaultMinRequests is the request count below which an endpoint never alerts
+	DefaultMinRequests = 20
+
+	numBuckets = int(MaxWindow / BucketWidth)
+)
+
+// Windows are the sliding windows reported for every endpoint
+var Windows = []time.Duration{time.Minute, 5 * time.Minute, MaxWindow}
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Config configures alerting
+type Config struct {
+	// Threshold is the 5xx ratio (0-1) at which an endpoint alerts; 0 disables alerting
+	Threshold float64
+	// MinRequests is the minimum number of requests in the window before an endpoint can alert
+	MinRequests int64
+	// Window is the sliding window the threshold is evaluated over
+	Window time.Duration
+	// Notify is called for every alert state change
+	Notify func(Alert)
+}
+
+// WindowStats is the error rate of an endpoint over one window
+type WindowStats struct {
+	Window    string  `json:"window"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// EndpointStats is the error rate of an endpoint over every window
+type EndpointStats struct {
+	Endpoint      string        `json:"endpoint"`
+	Windows       []WindowStats `json:"windows"`
+	Alerting      bool          `json:"alerting"`
+	AlertingSince *time.Time    `json:"alerting_since,omitempty"`
+}
+
+// Alert describes an endpoint crossing the threshold in either direction
+type Alert struct {
+	Status    string    `json:"status"`
+	Endpoint  string    `json:"endpoint"`
+	Window    string    `json:"window"`
+	Requests  int64     `json:"requests"`
+	Errors    int64     `json:"errors"`
+	ErrorRate float64   `json:"error_rate"`
+	Threshold float64   `json:"threshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type bucket struct {
+	slot   int64 // start of the bucket in BucketWidth units since the epoch
+	total  int64
+	errors int64
+}
+
+type series struct {
+	buckets       [numBuckets]bucket
+	alertingSince *time.Time
+}
+
+// Tracker records responses and evaluates error rates
+type Tracker struct {
+	cfg Config
+
+	mu        sync.Mutex
+	endpoints map[string]*series
+}
+
+// NewTracker creates a tracker, filling in defaults for unset config values
+func NewTracker(cfg Config) *Tracker {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Window > MaxWindow {
+		cfg.Window = MaxWindow
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultMinRequests
+	}
+	return &Tracker{
+		cfg:       cfg,
+		endpoints: make(map[string]*series),
+	}
+}
+
+// Threshold returns the configured alert threshold (0 when alerting is disabled)
+func (t *Tracker) Threshold() float64 {
+	return t.cfg.Threshold
+}
+
+// Window returns the alert window
+func (t *Tracker) Window() time.Duration {
+	return t.cfg.Window
+}
+
+// Record counts a response for endpoint
+func (t *Tracker) Record(endpoint string, status int) {
+	t.record(endpoint, status, time.Now())
+}
+
+func (t *Tracker) record(endpoint string, status int, now time.Time) {
+	slot := now.UnixNano() / int64(BucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.endpoints[endpoint]
+	if !ok {
+		s = &series{}
+		t.endpoints[endpoint] = s
+	}
+
+	b := &s.buckets[slot%int64(numBuckets)]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+	b.total++
+	if status >= 500 {
+		b.errors++
+	}
+}
+
+// sum totals the buckets of s that fall inside window ending at slot now
+func (s *series) sum(now int64, window time.Duration) (total, errors int64) {
+	oldest := now - int64(window/BucketWidth) + 1
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.slot >= oldest && b.slot <= now {
+			total += b.total
+			errors += b.errors
+		}
+	}
+	return total, errors
+}
+
+// Degraded reports whether any endpoint is currently alerting
+func (t *Tracker) Degraded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.endpoints {
+		if s.alertingSince != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot returns the current error rates of every endpoint seen within MaxWindow
+func (t *Tracker) Snapshot() []EndpointStats {
+	return t.snapshot(time.Now())
+}
+
+func (t *Tracker) snapshot(now time.Time) []EndpointStats {
+	slot := now.UnixNano() / int64(BucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]EndpointStats, 0, len(t.endpoints))
+	for endpoint, s := range t.endpoints {
+		es := EndpointStats{
+			Endpoint:      endpoint,
+			Windows:       make([]WindowStats, 0, len(Windows)),
+			Alerting:      s.alertingSince != nil,
+			AlertingSince: s.alertingSince,
+		}
+		for _, window := range Windows {
+			total, errors := s.sum(slot, window)
+			es.Windows = append(es.Windows, WindowStats{
+				Window:    window.String(),
+				Requests:  total,
+				Errors:    errors,
+				ErrorRate: ratio(errors, total),
+			})
+		}
+		stats = append(stats, es)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+	return stats
+}
+
+// Evaluate updates the error rate metrics and alert states, notifying on every change
+func (t *Tracker) Evaluate() {
+	t.evaluate(time.Now())
+}
+
+func (t *Tracker) evaluate(now time.Time) {
+	slot := now.UnixNano() / int64(BucketWidth)
+
+	var alerts []Alert
+	degraded := false
+
+	t.mu.Lock()
+	for endpoint, s := range t.endpoints {
+		for _, window := range Windows {
+			total, errors := s.sum(slot, window)
+			metrics.HTTPEndpointErrorRatio.WithLabelValues(endpoint, window.String()).Set(ratio(errors, total))
+		}
+
+		total, errors := s.sum(slot, t.cfg.Window)
+		rate := ratio(errors, total)
+		firing := t.cfg.Threshold > 0 && total >= t.cfg.MinRequests && rate >= t.cfg.Threshold
+
+		switch {
+		case firing && s.alertingSince == nil:
+			since := now
+			s.alertingSince = &since
+			alerts = append(alerts, t.alert(StatusFiring, endpoint, total, errors, now))
+		case !firing && s.alertingSince != nil:
+			s.alertingSince = nil
+			alerts = append(alerts, t.alert(StatusResolved, endpoint, total, errors, now))
+		}
+
+		if s.alertingSince != nil {
+			degraded = true
+			metrics.HTTPEndpointErrorAlerting.WithLabelValues(endpoint).Set(1)
+		} else {
+			metrics.HTTPEndpointErrorAlerting.WithLabelValues(endpoint).Set(0)
+		}
+
+		// Forget endpoints with no traffic left in any window
+		if s.alertingSince == nil {
+			if all, _ := s.sum(slot, MaxWindow); all == 0 {
+				delete(t.endpoints, endpoint)
+				for _, window := range Windows {
+					metrics.HTTPEndpointErrorRatio.DeleteLabelValues(endpoint, window.String())
+				}
+				metrics.HTTPEndpointErrorAlerting.DeleteLabelValues(endpoint)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	if degraded {
+		metrics.ServiceDegraded.Set(1)
+	} else {
+		metrics.ServiceDegraded.Set(0)
+	}
+
+	if t.cfg.Notify != nil {
+		for _, alert := range alerts {
+			t.cfg.Notify(alert)
+		}
+	}
+}
+
+func (t *Tracker) alert(status, endpoint string, total, errors int64, now time.Time) Alert {
+	return Alert{
+		Status:    status,
+		Endpoint:  endpoint,
+		Window:    t.cfg.Window.String(),
+		Requests:  total,
+		Errors:    errors,
+		ErrorRate: ratio(errors, total),
+		Threshold: t.cfg.Threshold,
+		Timestamp: now.UTC(),
+	}
+}
+
+// Run evaluates the tracker every BucketWidth until ctx is cancelled
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(BucketWidth)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Evaluate()
+		}
+	}
+}
+
+func ratio(errors, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(errors) / float64(total)
+}
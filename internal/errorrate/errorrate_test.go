@@ -0,0 +1,129 @@
+package errorrate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker_Windows(t *testing.T) {
+	tracker := NewTracker(Config{})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Ten minutes ago: 10 requests, all failing
+	for i := 0; i < 10; i++ {
+		tracker.record("GET /api/v1/hosts", http.StatusInternalServerError, now.Add(-10*time.Minute))
+	}
+	// Now: 10 requests, one failing
+	for i := 0; i < 9; i++ {
+		tracker.record("GET /api/v1/hosts", http.StatusOK, now)
+	}
+	tracker.record("GET /api/v1/hosts", http.StatusBadGateway, now)
+
+	stats := tracker.snapshot(now)
+	require.Len(t, stats, 1)
+	windows := map[string]WindowStats{}
+	for _, w := range stats[0].Windows {
+		windows[w.Window] = w
+	}
+
+	assert.Equal(t, int64(10), windows["1m0s"].Requests)
+	assert.InDelta(t, 0.1, windows["1m0s"].ErrorRate, 1e-9)
+	assert.Equal(t, int64(10), windows["5m0s"].Requests)
+	assert.Equal(t, int64(20), windows["15m0s"].Requests)
+	assert.InDelta(t, 0.55, windows["15m0s"].ErrorRate, 1e-9)
+
+	// 4xx responses are not errors
+	tracker.record("POST /api/v1/ingest", http.StatusBadRequest, now)
+	for _, es := range tracker.snapshot(now) {
+		if es.Endpoint == "POST /api/v1/ingest" {
+			assert.Equal(t, int64(0), es.Windows[0].Errors)
+		}
+	}
+}
+
+func TestTracker_Alerting(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []Alert
+	tracker := NewTracker(Config{
+		Threshold:   0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+		Notify: func(a Alert) {
+			mu.Lock()
+			defer mu.Unlock()
+			alerts = append(alerts, a)
+		},
+	})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Below the minimum request count nothing fires
+	for i := 0; i < 3; i++ {
+		tracker.record("GET /api/v1/hosts", http.StatusInternalServerError, now)
+	}
+	tracker.evaluate(now)
+	assert.False(t, tracker.Degraded())
+	assert.Empty(t, alerts)
+
+	tracker.record("GET /api/v1/hosts", http.StatusOK, now)
+	tracker.evaluate(now)
+	assert.True(t, tracker.Degraded())
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatusFiring, alerts[0].Status)
+	assert.Equal(t, "GET /api/v1/hosts", alerts[0].Endpoint)
+	assert.InDelta(t, 0.75, alerts[0].ErrorRate, 1e-9)
+
+	// Still firing: no repeat notification
+	tracker.evaluate(now.Add(BucketWidth))
+	assert.Len(t, alerts, 1)
+
+	// Once the errors age out of the window the alert resolves
+	later := now.Add(2 * time.Minute)
+	for i := 0; i < 4; i++ {
+		tracker.record("GET /api/v1/hosts", http.StatusOK, later)
+	}
+	tracker.evaluate(later)
+	assert.False(t, tracker.Degraded())
+	require.Len(t, alerts, 2)
+	assert.Equal(t, StatusResolved, alerts[1].Status)
+
+	// Endpoints without traffic in any window are dropped
+	tracker.evaluate(later.Add(MaxWindow))
+	assert.Empty(t, tracker.snapshot(later.Add(MaxWindow)))
+}
+
+func TestTracker_AlertingDisabled(t *testing.T) {
+	tracker := NewTracker(Config{MinRequests: 1})
+	now := time.Now()
+	tracker.record("GET /api/v1/hosts", http.StatusInternalServerError, now)
+	tracker.evaluate(now)
+	assert.False(t, tracker.Degraded())
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Alert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err == nil {
+			received <- alert
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	WebhookNotifier(server.URL)(Alert{Status: StatusFiring, Endpoint: "GET /api/v1/hosts", Threshold: 0.5})
+
+	select {
+	case alert := <-received:
+		assert.Equal(t, StatusFiring, alert.Status)
+		assert.Equal(t, "GET /api/v1/hosts", alert.Endpoint)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
@@ -0,0 +1,49 @@
+package errorrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"snailbus/internal/logger"
+)
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier returns a Notify func that POSTs each alert as JSON to url
+// Deliveries run in the background so a slow receiver never delays evaluation
+func WebhookNotifier(url string) func(Alert) {
+	client := &http.Client{Timeout: webhookTimeout}
+	return func(alert Alert) {
+		go func() {
+			if err := postAlert(client, url, alert); err != nil {
+				logger.Logger.Warn().
+					Err(err).
+					Str("endpoint", alert.Endpoint).
+					Str("status", alert.Status).
+					Msg("Failed to deliver error rate alert webhook")
+			}
+		}()
+	}
+}
+
+func postAlert(client *http.Client, url string, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Package features checks feature flags for an organization.
+//
+// Flags are stored in the database with a global default and per-organization
+// overrides, so a risky feature can be enabled for a few organizations before
+// it is enabled for everyone. A Checker caches the flags for a short TTL, so
+// changes made on another server instance take up to the TTL to apply; changes
+// made through this instance apply immediately.
+//
+// Unknown flags are disabled, so code can check a flag before it is created.
+package features
+
+import (
+	"sync"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+)
+
+// DefaultTTL is how long an organization's flags are cached
+const DefaultTTL = 30 * time.Second
+
+// Store loads feature flags
+type Store interface {
+	ListFeatureFlags() ([]*models.FeatureFlag, error)
+}
+
+// Checker answers whether a flag is enabled for an organization
+type Checker struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu       sync.Mutex
+	flags    []*models.FeatureFlag
+	loadedAt time.Time
+}
+
+// NewChecker creates a checker that caches flags for ttl (0 disables caching)
+func NewChecker(store Store, ttl time.Duration) *Checker {
+	return &Checker{store: store, ttl: ttl, now: time.Now}
+}
+
+// Enabled reports whether the flag is on for the organization
+// Flags that cannot be loaded are treated as disabled.
+func (c *Checker) Enabled(orgID, name string) bool {
+	flags, err := c.load()
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("flag", name).Msg("Failed to load feature flags")
+		return false
+	}
+	for _, flag := range flags {
+		if flag.Name == name {
+			return flag.EnabledFor(orgID)
+		}
+	}
+	return false
+}
+
+// ForOrg returns every flag's effective state for the organization
+func (c *Checker) ForOrg(orgID string) (map[string]bool, error) {
+	flags, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		enabled[flag.Name] = flag.EnabledFor(orgID)
+	}
+	return enabled, nil
+}
+
+// Invalidate drops the cache, e.g. after a flag changed
+func (c *Checker) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags = nil
+}
+
+// load returns the cached flags, reloading them once the TTL has passed
+func (c *Checker) load() ([]*models.FeatureFlag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.flags != nil && now.Sub(c.loadedAt) < c.ttl {
+		return c.flags, nil
+	}
+	flags, err := c.store.ListFeatureFlags()
+	if err != nil {
+		return nil, err
+	}
+	c.flags = flags
+	c.loadedAt = now
+	return flags, nil
+}
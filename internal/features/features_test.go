@@ -0,0 +1,69 @@
+package features
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+type fakeStore struct {
+	flags []*models.FeatureFlag
+	err   error
+	loads int
+}
+
+func (s *fakeStore) ListFeatureFlags() ([]*models.FeatureFlag, error) {
+	s.loads++
+	return s.flags, s.err
+}
+
+func TestChecker_Enabled(t *testing.T) {
+	store := &fakeStore{flags: []*models.FeatureFlag{
+		{Name: "async-ingest", Enabled: false, Orgs: []models.FeatureFlagOverride{{OrgID: "canary", Enabled: true}}},
+		{Name: "new-search", Enabled: true, Orgs: []models.FeatureFlagOverride{{OrgID: "holdout", Enabled: false}}},
+	}}
+	checker := NewChecker(store, time.Minute)
+
+	assert.True(t, checker.Enabled("canary", "async-ingest"))
+	assert.False(t, checker.Enabled("other", "async-ingest"))
+	assert.True(t, checker.Enabled("other", "new-search"))
+	assert.False(t, checker.Enabled("holdout", "new-search"))
+	assert.False(t, checker.Enabled("canary", "unknown"))
+
+	flags, err := checker.ForOrg("canary")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"async-ingest": true, "new-search": true}, flags)
+	assert.Equal(t, 1, store.loads)
+}
+
+func TestChecker_Cache(t *testing.T) {
+	store := &fakeStore{flags: []*models.FeatureFlag{{Name: "beta", Enabled: true}}}
+	checker := NewChecker(store, time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	assert.True(t, checker.Enabled("org", "beta"))
+	store.flags = []*models.FeatureFlag{{Name: "beta", Enabled: false}}
+
+	// Cached until the TTL passes or the cache is invalidated
+	assert.True(t, checker.Enabled("org", "beta"))
+	now = now.Add(time.Minute)
+	assert.False(t, checker.Enabled("org", "beta"))
+
+	store.flags = []*models.FeatureFlag{{Name: "beta", Enabled: true}}
+	checker.Invalidate()
+	assert.True(t, checker.Enabled("org", "beta"))
+	assert.Equal(t, 3, store.loads)
+
+	// Flags that cannot be loaded are off
+	store.err = errors.New("database down")
+	checker.Invalidate()
+	assert.False(t, checker.Enabled("org", "beta"))
+	_, err := checker.ForOrg("org")
+	assert.Error(t, err)
+}
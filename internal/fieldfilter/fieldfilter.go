@@ -0,0 +1,134 @@
+// Package fieldfilter removes denylisted fields from report data before it is stored.
+//
+// A path names a field by its object keys from the root of a report's data,
+// separated by dots, e.g. "users" or "processes.cmdline"; "*" matches any key.
+// Arrays are transparent: a path continues into every element, so
+// "processes.cmdline" drops the cmdline of each entry in a processes list.
+package fieldfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// Path limits, enforced by Compile
+const (
+	MaxPaths      = 100
+	MaxPathLength = 256
+)
+
+// wildcard matches any object key
+const wildcard = "*"
+
+// Filter is a compiled denylist of data paths
+type Filter struct {
+	paths    []string
+	segments [][]string
+}
+
+// Compile validates a denylist and prepares it for Apply
+func Compile(paths []string) (*Filter, error) {
+	if len(paths) > MaxPaths {
+		return nil, fmt.Errorf("at most %d paths are allowed (got %d)", MaxPaths, len(paths))
+	}
+
+	f := &Filter{}
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("path must not be empty")
+		}
+		if len(path) > MaxPathLength {
+			return nil, fmt.Errorf("path %q is longer than %d characters", path, MaxPathLength)
+		}
+		segments := strings.Split(path, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("path %q has an empty segment", path)
+			}
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("path %q is listed twice", path)
+		}
+		seen[path] = true
+
+		f.paths = append(f.paths, path)
+		f.segments = append(f.segments, segments)
+	}
+	return f, nil
+}
+
+// Apply returns data with every denylisted field removed, and the paths that matched
+// Data without a match is returned unchanged; otherwise it is re-encoded, so key order
+// and whitespace are not preserved.
+func (f *Filter) Apply(data json.RawMessage) (json.RawMessage, []models.StrippedField, error) {
+	if len(f.segments) == 0 || len(data) == 0 {
+		return data, nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep integers beyond float64 precision intact
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode report data: %w", err)
+	}
+
+	var stripped []models.StrippedField
+	for i, segments := range f.segments {
+		if count := strip(value, segments); count > 0 {
+			stripped = append(stripped, models.StrippedField{Path: f.paths[i], Count: count})
+		}
+	}
+	if len(stripped) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode report data: %w", err)
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), stripped, nil
+}
+
+// strip removes the fields matching segments below value and returns how many it removed
+func strip(value interface{}, segments []string) int {
+	switch v := value.(type) {
+	case []interface{}:
+		count := 0
+		for _, elem := range v {
+			count += strip(elem, segments)
+		}
+		return count
+	case map[string]interface{}:
+		key, rest := segments[0], segments[1:]
+		if len(rest) == 0 {
+			if key == wildcard {
+				count := len(v)
+				clear(v)
+				return count
+			}
+			if _, ok := v[key]; ok {
+				delete(v, key)
+				return 1
+			}
+			return 0
+		}
+		if key == wildcard {
+			count := 0
+			for _, child := range v {
+				count += strip(child, rest)
+			}
+			return count
+		}
+		if child, ok := v[key]; ok {
+			return strip(child, rest)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package fieldfilter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"snailbus/internal/models"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{"simple paths", []string{"users", "processes.cmdline"}, false},
+		{"wildcard", []string{"network.*.mac"}, false},
+		{"no paths", nil, false},
+		{"empty path", []string{""}, true},
+		{"empty segment", []string{"processes..cmdline"}, true},
+		{"trailing dot", []string{"users."}, true},
+		{"duplicate", []string{"users", "users"}, true},
+		{"too long", []string{strings.Repeat("a", MaxPathLength+1)}, true},
+		{"too many", make([]string, MaxPaths+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilter_Apply(t *testing.T) {
+	data := `{
+		"system": {"hostname": "web-01", "uptime": 12345678901234567},
+		"users": [{"name": "root"}, {"name": "alice"}],
+		"processes": [
+			{"pid": 1, "name": "systemd", "cmdline": "/sbin/init"},
+			{"pid": 42, "name": "sshd", "cmdline": "sshd: alice"},
+			{"pid": 43, "name": "kworker"}
+		],
+		"network": {"eth0": {"mac": "aa", "mtu": 1500}, "lo": {"mtu": 65536}}
+	}`
+
+	tests := []struct {
+		name         string
+		paths        []string
+		wantData     string
+		wantStripped []models.StrippedField
+	}{
+		{
+			name:         "top-level section",
+			paths:        []string{"users"},
+			wantData:     `{"system": {"hostname": "web-01", "uptime": 12345678901234567}, "processes": [{"pid": 1, "name": "systemd", "cmdline": "/sbin/init"}, {"pid": 42, "name": "sshd", "cmdline": "sshd: alice"}, {"pid": 43, "name": "kworker"}], "network": {"eth0": {"mac": "aa", "mtu": 1500}, "lo": {"mtu": 65536}}}`,
+			wantStripped: []models.StrippedField{{Path: "users", Count: 1}},
+		},
+		{
+			name:         "field of every array element",
+			paths:        []string{"processes.cmdline"},
+			wantData:     `{"system": {"hostname": "web-01", "uptime": 12345678901234567}, "users": [{"name": "root"}, {"name": "alice"}], "processes": [{"pid": 1, "name": "systemd"}, {"pid": 42, "name": "sshd"}, {"pid": 43, "name": "kworker"}], "network": {"eth0": {"mac": "aa", "mtu": 1500}, "lo": {"mtu": 65536}}}`,
+			wantStripped: []models.StrippedField{{Path: "processes.cmdline", Count: 2}},
+		},
+		{
+			name:         "wildcard key",
+			paths:        []string{"network.*.mac", "system.missing"},
+			wantData:     `{"system": {"hostname": "web-01", "uptime": 12345678901234567}, "users": [{"name": "root"}, {"name": "alice"}], "processes": [{"pid": 1, "name": "systemd", "cmdline": "/sbin/init"}, {"pid": 42, "name": "sshd", "cmdline": "sshd: alice"}, {"pid": 43, "name": "kworker"}], "network": {"eth0": {"mtu": 1500}, "lo": {"mtu": 65536}}}`,
+			wantStripped: []models.StrippedField{{Path: "network.*.mac", Count: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := Compile(tt.paths)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, stripped, err := filter.Apply(json.RawMessage(data))
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(stripped, tt.wantStripped) {
+				t.Errorf("Apply() stripped = %+v, want %+v", stripped, tt.wantStripped)
+			}
+			if !jsonEqual(t, got, tt.wantData) {
+				t.Errorf("Apply() data = %s, want %s", got, tt.wantData)
+			}
+			if !strings.Contains(string(got), "12345678901234567") {
+				t.Errorf("Apply() lost integer precision: %s", got)
+			}
+		})
+	}
+}
+
+func TestFilter_ApplyNoMatch(t *testing.T) {
+	filter, err := Compile([]string{"users"})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	data := json.RawMessage(`{"system":  {"hostname": "web-01"}}`)
+
+	got, stripped, err := filter.Apply(data)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if stripped != nil {
+		t.Errorf("Apply() stripped = %+v, want none", stripped)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Apply() changed data without a match: %s", got)
+	}
+}
+
+func jsonEqual(t *testing.T, got json.RawMessage, want string) bool {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	return reflect.DeepEqual(gotValue, wantValue)
+}
@@ -0,0 +1,345 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/acl"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	webHostID   = "00000000-0000-0000-0000-000000000001"
+	dbHostID    = "00000000-0000-0000-0000-000000000002"
+	otherHostID = "00000000-0000-0000-0000-000000000003"
+)
+
+type graphFixture struct {
+	store  *storage.MockStorage
+	router func(user *models.User) *gin.Engine
+	admin  *models.User
+	viewer *models.User // Restricted to team:db
+	other  *models.User // Admin of another organization
+}
+
+func setupGraphTest(t *testing.T) *graphFixture {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMockStorage()
+	srv := NewServer(NewResolver(store, acl.NewEvaluator(store, 0)))
+
+	org, _ := store.CreateOrganization("Test Org")
+	otherOrg, _ := store.CreateOrganization("Other Org")
+	f := &graphFixture{store: store}
+	f.admin, _ = store.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	f.viewer, _ = store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	f.other, _ = store.CreateUser("other", "other@example.com", "hash", otherOrg.ID, "admin")
+	require.NoError(t, store.SetHostAccessTags(f.viewer.ID, org.ID, []string{"team:db"}))
+
+	f.router = func(user *models.User) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set("user", user)
+				c.Set("user_id", user.ID)
+				c.Set("org_id", user.OrgID)
+				c.Set("role", user.Role)
+			}
+		})
+		r.POST("/graphql", func(c *gin.Context) {
+			c.Request = c.Request.WithContext(WithGinContext(c.Request.Context(), c))
+			srv.ServeHTTP(c.Writer, c.Request)
+		})
+		return r
+	}
+
+	// The web host has three reports; the db host one
+	for seq := 1; seq <= 3; seq++ {
+		f.saveReport(t, webHostID, "team:web", seq, f.admin)
+	}
+	f.saveReport(t, dbHostID, "team:db", 1, f.admin)
+	f.saveReport(t, otherHostID, "team:web", 1, f.other)
+	return f
+}
+
+// saveReport stores a report of the host and adds it to the host's history; its data
+// lists seq packages
+func (f *graphFixture) saveReport(t *testing.T, hostID, tag string, seq int, user *models.User) {
+	t.Helper()
+	packages := make([]string, seq)
+	for i := range packages {
+		packages[i] = fmt.Sprintf(`{"name": "pkg%d"}`, i)
+	}
+	report := &models.Report{
+		ID:         fmt.Sprintf("%s-%d", hostID, seq),
+		ReceivedAt: time.Now().Add(time.Duration(seq) * time.Minute),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+		Data:       json.RawMessage(`{"system": {"os": {"name": "Fedora", "version": "42"}}, "packages": {"installed": [` + strings.Join(packages, ",") + `]}}`),
+	}
+	require.NoError(t, f.store.SaveHost(report, user.OrgID, user.ID))
+	require.NoError(t, f.store.SaveHostReport(models.NewHostReport(fmt.Sprintf("report-%s-%d", hostID, seq), report, user.ID), user.OrgID, 10))
+	require.NoError(t, f.store.SetHostTags(hostID, user.OrgID, []string{tag}, user.ID, 0))
+}
+
+type graphError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+type graphResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []graphError    `json:"errors"`
+}
+
+func (f *graphFixture) query(t *testing.T, user *models.User, query string, variables map[string]interface{}) graphResponse {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	f.router(user).ServeHTTP(w, req)
+
+	var resp graphResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return resp
+}
+
+func hostIDs(t *testing.T, data json.RawMessage) []string {
+	t.Helper()
+	var result struct {
+		Hosts []struct {
+			HostID string `json:"hostId"`
+		} `json:"hosts"`
+	}
+	require.NoError(t, json.Unmarshal(data, &result))
+	ids := []string{}
+	for _, host := range result.Hosts {
+		ids = append(ids, host.HostID)
+	}
+	return ids
+}
+
+func TestQuery_HostsScopedToOrgAndPolicy(t *testing.T) {
+	f := setupGraphTest(t)
+
+	resp := f.query(t, f.admin, `{ hosts { hostId } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.ElementsMatch(t, []string{webHostID, dbHostID}, hostIDs(t, resp.Data))
+
+	// Restricted users only see the hosts their tag policy allows
+	resp = f.query(t, f.viewer, `{ hosts { hostId } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.Equal(t, []string{dbHostID}, hostIDs(t, resp.Data))
+
+	resp = f.query(t, f.other, `{ hosts { hostId } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.Equal(t, []string{otherHostID}, hostIDs(t, resp.Data))
+}
+
+func TestQuery_Host(t *testing.T) {
+	f := setupGraphTest(t)
+	query := `query($id: ID!) { host(hostId: $id) { hostId hostname tags } }`
+
+	resp := f.query(t, f.admin, query, map[string]interface{}{"id": webHostID})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"host": {"hostId": "`+webHostID+`", "hostname": "host-1", "tags": ["team:web"]}}`, string(resp.Data))
+
+	// Hosts of other organizations and hosts outside the tag policy are null
+	for _, tc := range []struct {
+		user   *models.User
+		hostID string
+	}{
+		{f.admin, otherHostID},
+		{f.viewer, webHostID},
+		{f.admin, "00000000-0000-0000-0000-000000000099"},
+	} {
+		resp = f.query(t, tc.user, query, map[string]interface{}{"id": tc.hostID})
+		require.Empty(t, resp.Errors)
+		assert.JSONEq(t, `{"host": null}`, string(resp.Data), "%s as %s", tc.hostID, tc.user.Username)
+	}
+}
+
+func TestHostSummary_ReportsAndDiff(t *testing.T) {
+	f := setupGraphTest(t)
+
+	// The history is newest first
+	resp := f.query(t, f.admin, `query($id: ID!) {
+		host(hostId: $id) {
+			reports(limit: 2) { id }
+			diff { from { id } to { id } addedCount removedCount changedCount paths }
+		}
+	}`, map[string]interface{}{"id": webHostID})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"host": {
+		"reports": [{"id": "report-`+webHostID+`-3"}, {"id": "report-`+webHostID+`-2"}],
+		"diff": {
+			"from": {"id": "report-`+webHostID+`-2"},
+			"to": {"id": "report-`+webHostID+`-3"},
+			"addedCount": 1, "removedCount": 0, "changedCount": 0,
+			"paths": ["packages.installed[name=pkg2]"]
+		}
+	}}`, string(resp.Data))
+
+	// from and to pick the reports compared
+	resp = f.query(t, f.admin, `query($id: ID!, $from: ID) {
+		host(hostId: $id) { diff(from: $from) { addedCount paths(limit: 1) } }
+	}`, map[string]interface{}{"id": webHostID, "from": "report-" + webHostID + "-1"})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"host": {"diff": {"addedCount": 2, "paths": ["packages.installed[name=pkg1]"]}}}`, string(resp.Data))
+
+	// A host with a single report has no change to diff
+	resp = f.query(t, f.admin, `query($id: ID!) { host(hostId: $id) { diff { addedCount } } }`,
+		map[string]interface{}{"id": dbHostID})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"host": {"diff": null}}`, string(resp.Data))
+
+	// Reports of other hosts are not in the history
+	resp = f.query(t, f.admin, `query($id: ID!, $from: ID) { host(hostId: $id) { diff(from: $from) { addedCount } } }`,
+		map[string]interface{}{"id": webHostID, "from": "report-" + otherHostID + "-1"})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "report not found", resp.Errors[0].Message)
+	assert.Equal(t, float64(http.StatusNotFound), resp.Errors[0].Extensions["status"])
+	assert.Equal(t, []interface{}{"host", "diff"}, resp.Errors[0].Path)
+
+	resp = f.query(t, f.admin, `query($id: ID!) { host(hostId: $id) { reports(limit: -1) { id } } }`,
+		map[string]interface{}{"id": webHostID})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, float64(http.StatusBadRequest), resp.Errors[0].Extensions["status"])
+}
+
+func TestHostSummary_DiffLimit(t *testing.T) {
+	f := setupGraphTest(t)
+	for i := 0; i < MaxDiffsPerQuery; i++ {
+		f.saveReport(t, fmt.Sprintf("10000000-0000-0000-0000-%012d", i), "team:web", 1, f.admin)
+	}
+
+	resp := f.query(t, f.admin, `{ hosts { diff { addedCount } } }`, nil)
+	require.NotEmpty(t, resp.Errors)
+	assert.Equal(t, "too many diffs", resp.Errors[0].Message)
+	assert.Equal(t, float64(http.StatusBadRequest), resp.Errors[0].Extensions["status"])
+}
+
+func TestQuery_Stats(t *testing.T) {
+	f := setupGraphTest(t)
+	query := `{ stats { total osNames { value count } tags { value count } } }`
+
+	resp := f.query(t, f.admin, query, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"stats": {
+		"total": 2,
+		"osNames": [{"value": "Fedora", "count": 2}],
+		"tags": [{"value": "team:db", "count": 1}, {"value": "team:web", "count": 1}]
+	}}`, string(resp.Data))
+
+	// Restricted users only count the hosts they can see
+	resp = f.query(t, f.viewer, query, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"stats": {
+		"total": 1,
+		"osNames": [{"value": "Fedora", "count": 1}],
+		"tags": [{"value": "team:db", "count": 1}]
+	}}`, string(resp.Data))
+}
+
+func TestQuery_UsersRequiresAdmin(t *testing.T) {
+	f := setupGraphTest(t)
+
+	resp := f.query(t, f.admin, `{ users { username role } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"users": [{"username": "admin", "role": "admin"}, {"username": "viewer", "role": "viewer"}]}`, string(resp.Data))
+
+	resp = f.query(t, f.viewer, `{ users { username } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "insufficient role", resp.Errors[0].Message)
+	assert.Equal(t, float64(http.StatusForbidden), resp.Errors[0].Extensions["status"])
+	assert.JSONEq(t, `null`, string(resp.Data))
+}
+
+func TestQuery_APIKeys(t *testing.T) {
+	f := setupGraphTest(t)
+	_, _, err := storage.GenerateAPIKey(f.store, f.admin.ID, "laptop", nil)
+	require.NoError(t, err)
+	expired := time.Now().Add(-time.Hour)
+	_, _, err = storage.GenerateAPIKey(f.store, f.viewer.ID, "old", &expired)
+	require.NoError(t, err)
+
+	// Each user sees their own keys
+	resp := f.query(t, f.admin, `{ apiKeys { name expired } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"apiKeys": [{"name": "laptop", "expired": false}]}`, string(resp.Data))
+
+	resp = f.query(t, f.viewer, `{ apiKeys { name expired } }`, nil)
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"apiKeys": [{"name": "old", "expired": true}]}`, string(resp.Data))
+}
+
+func TestServer_RequiresOrganization(t *testing.T) {
+	f := setupGraphTest(t)
+
+	resp := f.query(t, nil, `{ hosts { hostId } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "unauthorized", resp.Errors[0].Message)
+	assert.Equal(t, float64(http.StatusUnauthorized), resp.Errors[0].Extensions["status"])
+}
+
+func TestServer_ComplexityLimit(t *testing.T) {
+	f := setupGraphTest(t)
+
+	var query strings.Builder
+	query.WriteString("{")
+	for i := 0; i <= ComplexityLimit/10; i++ {
+		fmt.Fprintf(&query, " h%d: hosts { hostId hostname name osName osVersion tags lastSeen sections status }", i)
+	}
+	query.WriteString(" }")
+
+	resp := f.query(t, f.admin, query.String(), nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "complexity")
+}
+
+// failingStorage fails to list hosts
+type failingStorage struct {
+	*storage.MockStorage
+}
+
+func (failingStorage) ListHosts(orgID string, includeArchived bool) ([]*models.HostSummary, error) {
+	return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestServer_HidesInternalErrors(t *testing.T) {
+	f := setupGraphTest(t)
+	store := failingStorage{f.store}
+	srv := NewServer(NewResolver(store, acl.NewEvaluator(store, 0)))
+
+	r := gin.New()
+	r.POST("/graphql", func(c *gin.Context) {
+		c.Set("user", f.admin)
+		c.Set("org_id", f.admin.OrgID)
+		c.Request = c.Request.WithContext(WithGinContext(c.Request.Context(), c))
+		srv.ServeHTTP(c.Writer, c.Request)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ hosts { hostId } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp graphResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "failed to retrieve hosts", resp.Errors[0].Message)
+	assert.Equal(t, float64(http.StatusInternalServerError), resp.Errors[0].Extensions["status"])
+	assert.NotContains(t, w.Body.String(), "10.0.0.5")
+}
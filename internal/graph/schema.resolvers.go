@@ -0,0 +1,261 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver
+// implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.86
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"snailbus/internal/apierror"
+	"snailbus/internal/auth"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/reportdiff"
+	"snailbus/internal/storage"
+)
+
+// AddedCount is the resolver for the addedCount field.
+func (r *hostReportDiffResolver) AddedCount(ctx context.Context, obj *models.HostReportDiff) (int, error) {
+	return len(obj.Added), nil
+}
+
+// RemovedCount is the resolver for the removedCount field.
+func (r *hostReportDiffResolver) RemovedCount(ctx context.Context, obj *models.HostReportDiff) (int, error) {
+	return len(obj.Removed), nil
+}
+
+// ChangedCount is the resolver for the changedCount field.
+func (r *hostReportDiffResolver) ChangedCount(ctx context.Context, obj *models.HostReportDiff) (int, error) {
+	return len(obj.Changed), nil
+}
+
+// Paths is the resolver for the paths field.
+func (r *hostReportDiffResolver) Paths(ctx context.Context, obj *models.HostReportDiff, limit *int) ([]string, error) {
+	n, err := limitArg(limit)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, changes := range [][]models.ReportChange{obj.Added, obj.Removed, obj.Changed} {
+		for _, change := range changes {
+			if len(paths) == n {
+				return paths, nil
+			}
+			paths = append(paths, change.Path)
+		}
+	}
+	return paths, nil
+}
+
+// Reports is the resolver for the reports field.
+func (r *hostSummaryResolver) Reports(ctx context.Context, obj *models.HostSummary, limit *int) ([]*models.HostReport, error) {
+	_, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limitArg(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The host was resolved through hosts or host, so the caller may see it
+	reports, err := r.storage.ListHostReports(obj.HostID, orgID)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve host reports", err)
+	}
+	if len(reports) > n {
+		reports = reports[:n]
+	}
+	return reports, nil
+}
+
+// Diff is the resolver for the diff field.
+func (r *hostSummaryResolver) Diff(ctx context.Context, obj *models.HostSummary, from *string, to *string) (*models.HostReportDiff, error) {
+	req, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.diffs.Add(1) > MaxDiffsPerQuery {
+		return nil, apierror.Validation("too many diffs").
+			WithDetail(fmt.Sprintf("A query may compare the reports of at most %d hosts.", MaxDiffsPerQuery))
+	}
+
+	var fromID, toID string
+	if from != nil {
+		fromID = *from
+	}
+	if to != nil {
+		toID = *to
+	}
+	// Without from and to the host's last change is compared, as GET /hosts/{host_id}/diff does
+	if fromID == "" || toID == "" {
+		reports, err := r.storage.ListHostReports(obj.HostID, orgID)
+		if err != nil {
+			return nil, apierror.Internal("failed to compare host reports", err)
+		}
+		if toID == "" {
+			if len(reports) == 0 {
+				return nil, nil
+			}
+			toID = reports[0].ID
+		}
+		if fromID == "" {
+			// The history is newest first, so the report before to follows it
+			for i, report := range reports {
+				if report.ID == toID && i+1 < len(reports) {
+					fromID = reports[i+1].ID
+					break
+				}
+			}
+			if fromID == "" {
+				return nil, nil
+			}
+		}
+	}
+
+	var reports [2]*models.HostReport
+	for i, reportID := range []string{fromID, toID} {
+		report, err := r.storage.GetHostReportByID(reportID, obj.HostID, orgID)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, apierror.NotFound("report not found").WithDetail("Report " + reportID + " is not in the host's history.")
+			}
+			return nil, apierror.Internal("failed to compare host reports", err)
+		}
+		reports[i] = report
+	}
+
+	diff, err := reportdiff.Compare(reports[0], reports[1])
+	if err != nil {
+		return nil, apierror.Internal("failed to compare host reports", err)
+	}
+	return diff, nil
+}
+
+// Hosts is the resolver for the hosts field.
+func (r *queryResolver) Hosts(ctx context.Context, includeArchived *bool) ([]*models.HostSummary, error) {
+	req, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := r.hostPolicy(req)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve hosts", err)
+	}
+
+	hosts, err := r.storage.ListHosts(orgID, includeArchived != nil && *includeArchived)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve hosts", err)
+	}
+	return policy.FilterHosts(hosts), nil
+}
+
+// Host is the resolver for the host field.
+func (r *queryResolver) Host(ctx context.Context, hostID string) (*models.HostSummary, error) {
+	req, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := r.hostPolicy(req)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve host", err)
+	}
+
+	// Archived hosts are found by ID, as GET /hosts/{host_id} finds them
+	hosts, err := r.storage.ListHosts(orgID, true)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve host", err)
+	}
+	for _, host := range hosts {
+		if host.HostID != hostID {
+			continue
+		}
+		// Hosts outside the caller's tag policy are null, like hosts that do not exist
+		if !policy.Allows(host.Tags) {
+			return nil, nil
+		}
+		return host, nil
+	}
+	return nil, nil
+}
+
+// Stats is the resolver for the stats field.
+func (r *queryResolver) Stats(ctx context.Context) (*models.HostFacets, error) {
+	req, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := r.hostPolicy(req)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve host facets", err)
+	}
+
+	// Restricted users get counts over the hosts they can see, as GET /hosts/facets does
+	if policy.Restricted() {
+		hosts, err := r.storage.ListHosts(orgID, false)
+		if err != nil {
+			return nil, apierror.Internal("failed to retrieve host facets", err)
+		}
+		return storage.CountHostFacets(policy.FilterHosts(hosts)), nil
+	}
+
+	facets, err := r.storage.GetHostFacets(orgID)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve host facets", err)
+	}
+	return facets, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context) ([]*models.User, error) {
+	req, orgID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if middleware.GetRole(req.c) != auth.RoleAdmin {
+		return nil, apierror.Forbidden("insufficient role").WithDetail("Listing users requires the admin role.")
+	}
+
+	users, err := r.storage.ListUsersByOrganization(orgID)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve users", err)
+	}
+	return users, nil
+}
+
+// APIKeys is the resolver for the apiKeys field.
+func (r *queryResolver) APIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	req, _, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID := middleware.GetUserID(req.c)
+	if userID == "" {
+		return nil, apierror.Unauthorized("unauthorized")
+	}
+
+	apiKeys, err := r.storage.GetAPIKeysByUserID(userID)
+	if err != nil {
+		return nil, apierror.Internal("failed to retrieve API keys", err)
+	}
+	for _, key := range apiKeys {
+		key.Expired = auth.IsExpired(key.ExpiresAt)
+	}
+	return apiKeys, nil
+}
+
+// HostReportDiff returns HostReportDiffResolver implementation.
+func (r *Resolver) HostReportDiff() HostReportDiffResolver { return &hostReportDiffResolver{r} }
+
+// HostSummary returns HostSummaryResolver implementation.
+func (r *Resolver) HostSummary() HostSummaryResolver { return &hostSummaryResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+type hostReportDiffResolver struct{ *Resolver }
+type hostSummaryResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
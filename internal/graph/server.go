@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+)
+
+// ComplexityLimit is the most fields a query may select, counting each field once per
+// place it is selected, so queries cannot repeat an expensive selection under aliases
+const ComplexityLimit = 500
+
+// NewServer returns the GraphQL HTTP handler. Requests must carry the gin context (see
+// WithGinContext). Only POST with a JSON body is served: browsers cannot send one
+// cross-origin without a preflight, so session cookies cannot be used for CSRF.
+func NewServer(resolver *Resolver) *handler.Server {
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: resolver}))
+	srv.AddTransport(transport.POST{})
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(ComplexityLimit))
+	srv.SetErrorPresenter(presentError)
+	srv.SetRecoverFunc(func(ctx context.Context, err any) error {
+		return apierror.Internal("internal server error", fmt.Errorf("panic: %v", err))
+	})
+	return srv
+}
+
+// presentError renders resolver errors like middleware.ErrorHandler renders handler
+// errors: the client sees the apierror message and detail, with the HTTP status its kind
+// maps to as extensions.status, and the cause of internal errors is only logged.
+// Errors in the query itself (syntax, unknown fields, invalid arguments) are shown as
+// gqlgen reports them.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) && gqlErr.Err == nil {
+		return gqlErr
+	}
+
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+	apiErr := apierror.From(err)
+	status := apiErr.Status()
+	if apiErr.Err != nil && status >= 500 {
+		if req, ok := ctx.Value(contextKey{}).(*request); ok {
+			logger.FromContext(req.c).
+				Err(apiErr.Err).
+				Str("response", apiErr.Message).
+				Str("path", presented.Path.String()).
+				Msg("GraphQL field failed with an internal error")
+		}
+	}
+
+	presented.Message = apiErr.Message
+	presented.Extensions = map[string]interface{}{"status": status}
+	if apiErr.Detail != "" {
+		presented.Extensions["message"] = apiErr.Detail
+	}
+	return presented
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_GetAccessReport(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	_, _ = mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	_, err := mockStore.CreateAPIKey(admin.ID, "hash", "prefix", "CI", nil)
+	require.NoError(t, err)
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/access-report", h.GetAccessReport)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/access-report", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report models.AccessReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, org.ID, report.OrgID)
+	assert.Equal(t, admin.ID, report.GeneratedBy)
+	assert.Len(t, report.Users, 2)
+	assert.NotContains(t, w.Body.String(), "prefix", "key prefixes and hashes are never exported")
+
+	w = doProbeRequest(r, http.MethodGet, "/orgs/current/access-report?format=csv", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "access-report-")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 4, "header, 2 users, 1 API key")
+	assert.True(t, strings.HasPrefix(lines[0], "type,id,name,"))
+
+	w = doProbeRequest(r, http.MethodGet, "/orgs/current/access-report?format=xml", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+)
+
+// ListAccounts searches the local user accounts reported across the fleet
+// @Summary     Search host accounts
+// @Description Returns the local user accounts from the latest report of each host in the authenticated user's organization, for access reviews and incident response, e.g. ?username=root&shell=/bin/bash.
+// @Description Filters are exact matches and combine with AND. Archived hosts are left out unless include_archived=true.
+// @Description Users with a tag-based host access policy only see accounts on hosts carrying at least one of their allowed tags.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       username          query     string  false  "Account name"
+// @Param       shell             query     string  false  "Login shell, e.g. /bin/bash"
+// @Param       uid               query     int     false  "User ID"
+// @Param       host_id           query     string  false  "Only accounts on this host"
+// @Param       include_archived  query     bool    false  "Include archived hosts"
+// @Success     200  {object}  map[string]interface{}  "Accounts with total count"
+// @Failure     400  {object}  map[string]string       "Invalid uid"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/accounts [get]
+func (h *Handlers) ListAccounts(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	filter := models.HostAccountFilter{
+		Username:        c.Query("username"),
+		Shell:           c.Query("shell"),
+		HostID:          c.Query("host_id"),
+		IncludeArchived: c.Query("include_archived") == "true",
+	}
+	if value := c.Query("uid"); value != "" {
+		uid, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			_ = c.Error(apierror.Validation("uid must be an integer"))
+			return
+		}
+		filter.UID = &uid
+	}
+
+	allowed, err := h.visibleHostIDs(c, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve accounts", err))
+		return
+	}
+
+	accounts, err := h.store(c).SearchHostAccounts(orgID, filter)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve accounts", err))
+		return
+	}
+	if allowed != nil {
+		visible := accounts[:0]
+		for _, account := range accounts {
+			if allowed[account.HostID] {
+				visible = append(visible, account)
+			}
+		}
+		accounts = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts": accounts,
+		"total":    len(accounts),
+	})
+}
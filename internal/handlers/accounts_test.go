@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_ListAccounts(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	save := func(hostID, hostname, data string) {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(data),
+		}, org.ID, user.ID))
+	}
+	// Both shapes of the users section: a list, or an object holding one
+	save(webID, "web-01", `{"users": [
+		{"name": "root", "uid": 0, "gid": 0, "home": "/root", "shell": "/bin/bash"},
+		{"name": "deploy", "uid": 1001, "gid": 1001, "home": "/home/deploy", "shell": "/bin/bash"},
+		{"name": "nobody", "uid": 65534, "shell": "/sbin/nologin"}
+	]}`)
+	save(dbID, "db-01", `{"users": {"users": [
+		{"username": "root", "uid": "0", "home_dir": "/root", "shell": "/bin/zsh"},
+		{"uid": 5}
+	]}}`)
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("org_id", user.OrgID)
+	})
+	r.GET("/accounts", h.ListAccounts)
+
+	list := func(query string) []models.HostAccount {
+		w := doProbeRequest(r, http.MethodGet, "/accounts"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Accounts []models.HostAccount `json:"accounts"`
+			Total    int                  `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, len(resp.Accounts), resp.Total)
+		return resp.Accounts
+	}
+
+	assert.Len(t, list(""), 4)
+
+	roots := list("?username=root")
+	require.Len(t, roots, 2)
+	assert.Equal(t, "db-01", roots[0].Hostname)
+	assert.Equal(t, "/root", roots[0].Home)
+	require.NotNil(t, roots[0].UID)
+	assert.Equal(t, int64(0), *roots[0].UID)
+	assert.Equal(t, "web-01", roots[1].Hostname)
+
+	bash := list("?username=root&shell=/bin/bash")
+	require.Len(t, bash, 1)
+	assert.Equal(t, webID, bash[0].HostID)
+
+	assert.Len(t, list("?uid=1001"), 1)
+	assert.Len(t, list("?host_id="+dbID), 1)
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodGet, "/accounts?uid=root", nil).Code)
+
+	// Archived hosts are left out by default
+	_, err := mockStore.ArchiveHost(dbID, org.ID, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, list("?username=root"), 1)
+	assert.Len(t, list("?username=root&include_archived=true"), 2)
+}
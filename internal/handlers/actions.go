@@ -0,0 +1,632 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+// Default and maximum number of runs returned by ListActionRuns
+const (
+	defaultActionRunLimit = 50
+	maxActionRunLimit     = 500
+)
+
+// secretNamePattern is the form of organization secret names usable from {{secret "name"}}
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// actionsEnabled writes a 400 response and returns false if outbound actions are disabled
+func (h *Handlers) actionsEnabled(c *gin.Context) bool {
+	if h.actions == nil {
+		_ = c.Error(apierror.Validation("outbound actions are disabled").WithDetail("Set OUTBOUND_ACTIONS_ENABLED=true to enable them"))
+		return false
+	}
+	return true
+}
+
+// fireFinding queues the organization's actions for a finding
+// Failures are logged; a finding never fails the request that detected it.
+// Findings on archived hosts are dropped.
+func (h *Handlers) fireFinding(orgID string, finding models.Finding) {
+	if h.actions == nil {
+		return
+	}
+	if finding.HostID != "" {
+		archived, err := h.storage.IsHostArchived(finding.HostID, orgID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Logger.Error().Err(err).
+				Str("org_id", orgID).
+				Str("host_id", finding.HostID).
+				Msg("Failed to check whether host is archived")
+			return
+		}
+		if archived {
+			return
+		}
+	}
+	if finding.DetectedAt.IsZero() {
+		finding.DetectedAt = time.Now().UTC()
+	}
+	queued, err := h.actions.Fire(orgID, finding)
+	if err != nil {
+		logger.Logger.Error().Err(err).
+			Str("org_id", orgID).
+			Str("host_id", finding.HostID).
+			Str("finding", finding.Type).
+			Msg("Failed to queue outbound actions")
+		return
+	}
+	if queued > 0 {
+		logger.Logger.Info().
+			Str("org_id", orgID).
+			Str("host_id", finding.HostID).
+			Str("finding", finding.Type).
+			Int("runs", queued).
+			Msg("Queued outbound actions")
+	}
+}
+
+// fireUnreachable reports each unreachable probe result as a host_unreachable finding
+func (h *Handlers) fireUnreachable(orgID string, results []*models.ProbeResult) {
+	for _, result := range results {
+		if result.Reachable {
+			continue
+		}
+		target := result.Method
+		if result.Port != 0 {
+			target = fmt.Sprintf("%s port %d", result.Method, result.Port)
+		}
+		finding := models.Finding{
+			Type:       models.FindingHostUnreachable,
+			HostID:     result.HostID,
+			Hostname:   result.Hostname,
+			Summary:    fmt.Sprintf("%s is unreachable (%s)", result.Hostname, target),
+			DetectedAt: result.ProbedAt,
+		}
+		if result.Error != "" {
+			finding.Details = []string{result.Error}
+		}
+		h.fireFinding(orgID, finding)
+	}
+}
+
+// buildAction validates an action request into an action
+// Returns false after writing a 400 response if it is invalid
+func buildAction(c *gin.Context, action *models.Action) bool {
+	var req models.ActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return false
+	}
+
+	action.Name = strings.TrimSpace(req.Name)
+	action.Kind = req.Kind
+	if action.Kind == "" {
+		action.Kind = models.ActionKindHTTP
+	}
+	action.Triggers = req.Triggers
+	action.Method = req.Method
+	if action.Method == "" {
+		action.Method = http.MethodPost
+	}
+	action.URL = req.URL
+	action.Headers = req.Headers
+	action.BodyTemplate = req.BodyTemplate
+	action.Enabled = req.Enabled == nil || *req.Enabled
+	action.SchemaVersion = req.SchemaVersion
+	action.RateLimitPerHour = req.RateLimitPerHour
+
+	if action.Name == "" {
+		_ = c.Error(apierror.Validation("name is required"))
+		return false
+	}
+	if actions.IsChat(action.Kind) {
+		// Incoming webhooks only accept POST
+		if action.Method != http.MethodPost {
+			_ = c.Error(apierror.Validation("invalid action").WithDetail(action.Kind + " actions must use POST"))
+			return false
+		}
+		if action.BodyTemplate == "" {
+			action.BodyTemplate = actions.DefaultChatTemplate
+		}
+	}
+	// A templated URL, such as a chat webhook kept in a secret, is checked when it is
+	// delivered; a literal one can be refused now
+	if !strings.Contains(action.URL, "{{") {
+		if _, err := outbound.CheckURL(action.URL); err != nil {
+			_ = c.Error(apierror.Validation("invalid action").WithDetail(err.Error()))
+			return false
+		}
+	}
+	if err := actions.Validate(action); err != nil {
+		_ = c.Error(apierror.Validation("invalid action").WithDetail(err.Error()))
+		return false
+	}
+	return true
+}
+
+// ListActions returns the organization's outbound actions
+// @Summary     List outbound actions
+// @Description Returns the organization's outbound actions: HTTP calls, such as opening a Jira or GitHub issue, made when a finding is detected on a host. Requires admin role and OUTBOUND_ACTIONS_ENABLED.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Actions with total count"
+// @Failure     400  {object}  map[string]string       "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/actions [get]
+func (h *Handlers) ListActions(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	list, err := h.store(c).ListActions(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list actions", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": list,
+		"total":   len(list),
+	})
+}
+
+// CreateAction creates an outbound action
+// @Summary     Create outbound action
+// @Description Creates an action run for each finding of the listed trigger types (host_unreachable from probe jobs, report_errors from ingested reports with collection errors, host_overdue from hosts that missed their check-in window, host_health_warning, host_health_critical, and host_health_recovered from changes in agent-reported health, host_new from a host's first report, and ioc_match from reports matching an IOC list).
+// @Description kind slack or mattermost posts a chat message to an incoming webhook URL; body_template is the message text and defaults to the finding's summary and details. rate_limit_per_hour caps the runs queued in any hour (0 is unlimited); findings over the limit are dropped.
+// @Description URL, header values, and body_template are Go text/template strings executed with .Finding (type, host_id, hostname, summary, details, detected_at) and .Action (id, name); {{secret "name"}} inserts an organization secret, {{json .Finding.Summary}} a JSON-quoted value, and {{payload}} the standard event document of the action's schema_version.
+// @Description Deliveries are signed with HMAC-SHA256 in the X-Snailbus-Signature header. The signing secret is returned only in this response and when it is rotated.
+// @Description Failed deliveries are retried with exponential backoff. The same finding on the same host runs an action at most once per 24 hours. Requires admin role.
+// @Tags        Actions
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.ActionRequest         true  "Action definition"
+// @Success     201      {object}  models.ActionSecretResponse  "Action created, with its signing secret"
+// @Failure     400      {object}  map[string]string     "Invalid action or outbound actions disabled"
+// @Failure     401      {object}  map[string]string     "Unauthorized"
+// @Failure     403      {object}  map[string]string     "Admin role required"
+// @Failure     500      {object}  map[string]string     "Internal server error"
+// @Router      /api/v1/actions [post]
+func (h *Handlers) CreateAction(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	action := &models.Action{
+		ID:        uuid.New().String(),
+		CreatedBy: middleware.GetUserID(c),
+	}
+	if !buildAction(c, action) {
+		return
+	}
+	if action.SchemaVersion == 0 {
+		action.SchemaVersion = actions.CurrentSchemaVersion
+	}
+	secret, err := actions.GenerateSigningSecret()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create action", err))
+		return
+	}
+	action.SigningSecret = secret
+
+	if err := h.store(c).CreateAction(action, orgID); err != nil {
+		_ = c.Error(apierror.Internal("failed to create action", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("action_id", action.ID).
+		Str("kind", action.Kind).
+		Strs("triggers", action.Triggers).
+		Int("schema_version", action.SchemaVersion).
+		Msg("Action created")
+
+	c.JSON(http.StatusCreated, models.ActionSecretResponse{Action: action, SigningSecret: secret})
+}
+
+// GetAction returns an outbound action
+// @Summary     Get outbound action
+// @Description Returns an outbound action in the organization. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Action ID (UUID)"
+// @Success     200  {object}  models.Action      "Action"
+// @Failure     400  {object}  map[string]string  "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Action not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/actions/{id} [get]
+func (h *Handlers) GetAction(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	action, err := h.store(c).GetAction(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("action not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get action", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// UpdateAction replaces an outbound action's definition
+// @Summary     Update outbound action
+// @Description Replaces an outbound action's definition. Runs already queued use the new definition on their next attempt; disabling an action fails its queued runs.
+// @Description schema_version moves the action to another payload version; when omitted the action stays on its pinned version. The signing secret is not changed. Requires admin role.
+// @Tags        Actions
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id       path      string                true  "Action ID (UUID)"
+// @Param       request  body      models.ActionRequest  true  "Action definition"
+// @Success     200      {object}  models.Action         "Action updated"
+// @Failure     400      {object}  map[string]string     "Invalid action or outbound actions disabled"
+// @Failure     401      {object}  map[string]string     "Unauthorized"
+// @Failure     403      {object}  map[string]string     "Admin role required"
+// @Failure     404      {object}  map[string]string     "Action not found"
+// @Failure     500      {object}  map[string]string     "Internal server error"
+// @Router      /api/v1/actions/{id} [put]
+func (h *Handlers) UpdateAction(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	action := &models.Action{ID: c.Param("id")}
+	if !buildAction(c, action) {
+		return
+	}
+
+	if err := h.store(c).UpdateAction(action, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("action not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to update action", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("action_id", action.ID).
+		Bool("enabled", action.Enabled).
+		Int("schema_version", action.SchemaVersion).
+		Msg("Action updated")
+
+	c.JSON(http.StatusOK, action)
+}
+
+// RotateActionSecret issues a new signing secret for an outbound action
+// @Summary     Rotate outbound action signing secret
+// @Description Replaces the action's signing secret and returns the new one; it is not shown again. During the grace period (grace_period_hours, default 24, max 720) deliveries carry a signature for both the new and the previous secret, so receivers can switch secrets without rejecting deliveries.
+// @Description A grace period of 0 drops the previous secret immediately. Actions created before signing was added are unsigned until their first rotation. Requires admin role.
+// @Tags        Actions
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id       path      string                            true   "Action ID (UUID)"
+// @Param       request  body      models.RotateActionSecretRequest  false  "Grace period"
+// @Success     200      {object}  models.ActionSecretResponse       "Action with its new signing secret"
+// @Failure     400      {object}  map[string]string                 "Invalid grace period or outbound actions disabled"
+// @Failure     401      {object}  map[string]string                 "Unauthorized"
+// @Failure     403      {object}  map[string]string                 "Admin role required"
+// @Failure     404      {object}  map[string]string                 "Action not found"
+// @Failure     500      {object}  map[string]string                 "Internal server error"
+// @Router      /api/v1/actions/{id}/signing-secret/rotate [post]
+func (h *Handlers) RotateActionSecret(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	actionID := c.Param("id")
+
+	// The body is optional
+	var req models.RotateActionSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	grace := actions.DefaultGracePeriod
+	if req.GracePeriodHours != nil {
+		grace = time.Duration(*req.GracePeriodHours) * time.Hour
+	}
+	var previousExpiresAt *time.Time
+	if grace > 0 {
+		expires := time.Now().UTC().Add(grace)
+		previousExpiresAt = &expires
+	}
+
+	secret, err := actions.GenerateSigningSecret()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to rotate signing secret", err))
+		return
+	}
+	action, err := h.store(c).RotateActionSigningSecret(actionID, orgID, secret, previousExpiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("action not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to rotate signing secret", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("action_id", actionID).
+		Dur("grace_period", grace).
+		Msg("Action signing secret rotated")
+	c.JSON(http.StatusOK, models.ActionSecretResponse{Action: action, SigningSecret: secret})
+}
+
+// DeleteAction deletes an outbound action and its run history
+// @Summary     Delete outbound action
+// @Description Deletes an outbound action, its run history, and any runs not yet delivered. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Action ID (UUID)"
+// @Success     204  "Action deleted"
+// @Failure     400  {object}  map[string]string  "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Action not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/actions/{id} [delete]
+func (h *Handlers) DeleteAction(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	actionID := c.Param("id")
+
+	if err := h.store(c).DeleteAction(actionID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("action not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete action", err))
+		return
+	}
+
+	logger.FromContext(c).Str("action_id", actionID).Msg("Action deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// ListActionRuns returns an outbound action's delivery history
+// @Summary     List outbound action runs
+// @Description Returns an action's runs, newest first, with the finding, status (pending, running, succeeded, failed), attempt count, and last response or error. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id     path      string  true   "Action ID (UUID)"
+// @Param       limit  query     int     false  "Maximum number of runs (default 50, max 500)"
+// @Success     200  {object}  map[string]interface{}  "Runs with total count"
+// @Failure     400  {object}  map[string]string       "Invalid limit or outbound actions disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     404  {object}  map[string]string       "Action not found"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/actions/{id}/runs [get]
+func (h *Handlers) ListActionRuns(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	actionID := c.Param("id")
+
+	limit := defaultActionRunLimit
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxActionRunLimit {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(maxActionRunLimit)))
+			return
+		}
+		limit = parsed
+	}
+
+	if _, err := h.store(c).GetAction(actionID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("action not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to list action runs", err))
+		return
+	}
+
+	runs, err := h.store(c).ListActionRuns(actionID, orgID, limit)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list action runs", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  runs,
+		"total": len(runs),
+	})
+}
+
+// RetryActionRun requeues a failed outbound action run
+// @Summary     Retry outbound action run
+// @Description Requeues a failed run with a fresh set of attempts, e.g. after fixing the action or the target. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string  true  "Action ID (UUID)"
+// @Param       run_id  path      string  true  "Run ID (UUID)"
+// @Success     202  {object}  models.ActionRun   "Run requeued"
+// @Failure     400  {object}  map[string]string  "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Run not found"
+// @Failure     409  {object}  map[string]string  "Run has not failed"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/actions/{id}/runs/{run_id}/retry [post]
+func (h *Handlers) RetryActionRun(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	runID := c.Param("run_id")
+
+	run, err := h.store(c).GetActionRun(runID, orgID)
+	if err == nil && run.ActionID != c.Param("id") {
+		err = storage.ErrNotFound
+	}
+	if err == nil {
+		run, err = h.store(c).RetryActionRun(runID, orgID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("action run not found"))
+			return
+		case errors.Is(err, storage.ErrActionRunNotFailed):
+			_ = c.Error(apierror.Conflict("action run has not failed"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to retry action run", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("action_id", run.ActionID).
+		Str("run_id", run.ID).
+		Msg("Action run requeued")
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListOrgSecrets returns the names of the organization's secrets
+// @Summary     List organization secrets
+// @Description Returns the names of the secrets available to outbound action templates. Values are never returned. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Secret names with total count"
+// @Failure     400  {object}  map[string]string       "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/secrets [get]
+func (h *Handlers) ListOrgSecrets(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	secrets, err := h.store(c).ListOrgSecrets(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list secrets", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secrets": secrets,
+		"total":   len(secrets),
+	})
+}
+
+// SetOrgSecret creates or replaces an organization secret
+// @Summary     Set organization secret
+// @Description Creates or replaces a secret, such as an issue tracker API token, for use in outbound action templates as {{secret "name"}}. Names may contain letters, digits, '_', '.', and '-'. Requires admin role.
+// @Tags        Actions
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name     path      string                      true  "Secret name"
+// @Param       request  body      models.SetOrgSecretRequest  true  "Secret value"
+// @Success     204  "Secret set"
+// @Failure     400  {object}  map[string]string  "Invalid name or value, or outbound actions disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/secrets/{name} [put]
+func (h *Handlers) SetOrgSecret(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	name := c.Param("name")
+	if !secretNamePattern.MatchString(name) {
+		_ = c.Error(apierror.Validation("invalid secret name"))
+		return
+	}
+	var req models.SetOrgSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	if err := h.store(c).SetOrgSecret(orgID, name, req.Value); err != nil {
+		_ = c.Error(apierror.Internal("failed to set secret", err))
+		return
+	}
+
+	logger.FromContext(c).Str("secret", name).Msg("Secret set")
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteOrgSecret deletes an organization secret
+// @Summary     Delete organization secret
+// @Description Deletes a secret. Runs of actions that still reference it fail to render and are retried until it is set again. Requires admin role.
+// @Tags        Actions
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name  path  string  true  "Secret name"
+// @Success     204  "Secret deleted"
+// @Failure     400  {object}  map[string]string  "Outbound actions disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Secret not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/secrets/{name} [delete]
+func (h *Handlers) DeleteOrgSecret(c *gin.Context) {
+	if !h.actionsEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	name := c.Param("name")
+
+	if err := h.store(c).DeleteOrgSecret(orgID, name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("secret not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete secret", err))
+		return
+	}
+
+	logger.FromContext(c).Str("secret", name).Msg("Secret deleted")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// setupActionsTest creates an organization and a router acting as its admin
+func setupActionsTest(t *testing.T, enabled bool) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	var opts []Option
+	if enabled {
+		opts = append(opts, WithActions(actions.NewDispatcher(mockStore)))
+	}
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.GET("/actions", h.ListActions)
+	r.POST("/actions", h.CreateAction)
+	r.GET("/actions/:id", h.GetAction)
+	r.PUT("/actions/:id", h.UpdateAction)
+	r.DELETE("/actions/:id", h.DeleteAction)
+	r.POST("/actions/:id/signing-secret/rotate", h.RotateActionSecret)
+	r.GET("/actions/:id/runs", h.ListActionRuns)
+	r.POST("/actions/:id/runs/:run_id/retry", h.RetryActionRun)
+	r.GET("/secrets", h.ListOrgSecrets)
+	r.PUT("/secrets/:name", h.SetOrgSecret)
+	r.DELETE("/secrets/:name", h.DeleteOrgSecret)
+	return r, mockStore, admin
+}
+
+func TestHandlers_Actions_Disabled(t *testing.T) {
+	r, _, _ := setupActionsTest(t, false)
+
+	for _, path := range []string{"/actions", "/secrets"} {
+		w := doProbeRequest(r, http.MethodGet, path, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "OUTBOUND_ACTIONS_ENABLED")
+	}
+}
+
+func TestHandlers_Actions_CRUD(t *testing.T) {
+	r, _, _ := setupActionsTest(t, true)
+
+	// Invalid definitions are rejected
+	invalid := []models.ActionRequest{
+		{Name: "x", Triggers: []string{"unknown"}, URL: "https://example.com"},
+		{Name: "x", Triggers: []string{models.FindingHostUnreachable}, URL: "https://example.com", Method: "GET"},
+		{Name: "x", Triggers: []string{models.FindingHostUnreachable}, URL: "https://example.com", BodyTemplate: "{{.Finding"},
+		{Name: "x", Triggers: []string{models.FindingHostUnreachable}, URL: "https://example.com", Headers: map[string]string{"Bad Header": "x"}},
+		{Name: " ", Triggers: []string{models.FindingHostUnreachable}, URL: "https://example.com"},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPost, "/actions", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	w := doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:         "Open Jira issue",
+		Triggers:     []string{models.FindingHostUnreachable},
+		URL:          "https://jira.example.com/rest/api/2/issue",
+		Headers:      map[string]string{"Authorization": `Bearer {{secret "jira"}}`},
+		BodyTemplate: `{"fields": {"summary": {{json .Finding.Summary}}}}`,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+	assert.NotEmpty(t, action.ID)
+	assert.Equal(t, http.MethodPost, action.Method)
+	assert.True(t, action.Enabled)
+
+	w = doProbeRequest(r, http.MethodGet, "/actions/"+action.ID, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	disabled := false
+	w = doProbeRequest(r, http.MethodPut, "/actions/"+action.ID, models.ActionRequest{
+		Name:     "Open Jira issue",
+		Triggers: []string{models.FindingHostUnreachable, models.FindingReportErrors},
+		Method:   http.MethodPut,
+		URL:      "https://jira.example.com/rest/api/2/issue",
+		Enabled:  &disabled,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+	assert.False(t, action.Enabled)
+	assert.Len(t, action.Triggers, 2)
+
+	w = doProbeRequest(r, http.MethodGet, "/actions", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	w = doProbeRequest(r, http.MethodDelete, "/actions/"+action.ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/actions/"+action.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doProbeRequest(r, http.MethodPut, "/actions/"+action.ID, models.ActionRequest{
+		Name: "x", Triggers: []string{models.FindingReportErrors}, URL: "https://example.com",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Actions_SigningSecret(t *testing.T) {
+	r, _, _ := setupActionsTest(t, true)
+
+	request := models.ActionRequest{
+		Name:         "Webhook",
+		Triggers:     []string{models.FindingHostUnreachable},
+		URL:          "https://hooks.example.com/snailbus",
+		BodyTemplate: "{{payload}}",
+	}
+	unsupported := request
+	unsupported.SchemaVersion = 99
+	w := doProbeRequest(r, http.MethodPost, "/actions", unsupported)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// The signing secret is returned on create only
+	w = doProbeRequest(r, http.MethodPost, "/actions", request)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.ActionSecretResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.SigningSecret, actions.SigningSecretPrefix))
+	assert.Equal(t, actions.CurrentSchemaVersion, created.SchemaVersion)
+	assert.NotNil(t, created.SigningSecretCreatedAt)
+
+	w = doProbeRequest(r, http.MethodGet, "/actions/"+created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.SigningSecret)
+
+	// Updates without a schema version keep the pinned one
+	w = doProbeRequest(r, http.MethodPut, "/actions/"+created.ID, request)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, actions.CurrentSchemaVersion, updated.SchemaVersion)
+
+	// Rotating keeps the old secret signing for the default grace period
+	w = doProbeRequest(r, http.MethodPost, "/actions/"+created.ID+"/signing-secret/rotate", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rotated models.ActionSecretResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.SigningSecret, rotated.SigningSecret)
+	require.NotNil(t, rotated.PreviousSecretExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(actions.DefaultGracePeriod), *rotated.PreviousSecretExpiresAt, time.Minute)
+
+	noGrace := 0
+	w = doProbeRequest(r, http.MethodPost, "/actions/"+created.ID+"/signing-secret/rotate", models.RotateActionSecretRequest{GracePeriodHours: &noGrace})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	rotated = models.ActionSecretResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Nil(t, rotated.PreviousSecretExpiresAt)
+
+	tooLong := 1000
+	w = doProbeRequest(r, http.MethodPost, "/actions/"+created.ID+"/signing-secret/rotate", models.RotateActionSecretRequest{GracePeriodHours: &tooLong})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doProbeRequest(r, http.MethodPost, "/actions/00000000-0000-0000-0000-000000000000/signing-secret/rotate", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Actions_FiredByIngest(t *testing.T) {
+	r, mockStore, admin := setupActionsTest(t, true)
+
+	w := doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:     "Report errors",
+		Triggers: []string{models.FindingReportErrors},
+		URL:      "https://tickets.example.com/new",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+
+	ingest := func(errs []string) {
+		w := doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+			Meta:   models.ReportMeta{HostID: probeHostUp, Hostname: "web-1"},
+			Data:   json.RawMessage(`{}`),
+			Errors: errs,
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// Clean reports do not trigger anything
+	ingest(nil)
+	runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	// Reports with errors queue one run per host and window
+	ingest([]string{"packages: rpm database locked"})
+	ingest([]string{"packages: rpm database locked"})
+
+	w = doProbeRequest(r, http.MethodGet, "/actions/"+action.ID+"/runs", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Runs  []models.ActionRun `json:"runs"`
+		Total int                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Equal(t, 1, page.Total)
+	run := page.Runs[0]
+	assert.Equal(t, models.ActionRunPending, run.Status)
+	assert.Equal(t, models.FindingReportErrors, run.Finding.Type)
+	assert.Equal(t, probeHostUp, run.Finding.HostID)
+	assert.Equal(t, "web-1", run.Finding.Hostname)
+	assert.Equal(t, []string{"packages: rpm database locked"}, run.Finding.Details)
+
+	w = doProbeRequest(r, http.MethodGet, "/actions/"+action.ID+"/runs?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Only failed runs can be retried
+	w = doProbeRequest(r, http.MethodPost, "/actions/"+action.ID+"/runs/"+run.ID+"/retry", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doProbeRequest(r, http.MethodPost, "/actions/other/runs/"+run.ID+"/retry", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	run.Status = models.ActionRunFailed
+	run.Attempts = actions.MaxAttempts
+	require.NoError(t, mockStore.FinishActionRun(&run))
+	w = doProbeRequest(r, http.MethodPost, "/actions/"+action.ID+"/runs/"+run.ID+"/retry", nil)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var retried models.ActionRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &retried))
+	assert.Equal(t, models.ActionRunPending, retried.Status)
+	assert.Equal(t, 0, retried.Attempts)
+}
+
+func TestHandlers_Actions_Chat(t *testing.T) {
+	r, mockStore, admin := setupActionsTest(t, true)
+
+	// Incoming webhooks only accept POST
+	w := doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name: "x", Kind: models.ActionKindSlack, Triggers: []string{models.FindingHostNew},
+		URL: "https://hooks.slack.com/services/x", Method: http.MethodPut,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name: "x", Kind: "teams", Triggers: []string{models.FindingHostNew}, URL: "https://example.com",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	// Webhook URLs on the server's own network are refused
+	for _, url := range []string{"http://localhost:8065/hooks/x", "http://169.254.169.254/latest/meta-data", "http://10.0.0.5/hooks/x"} {
+		w = doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+			Name: "x", Kind: models.ActionKindMattermost, Triggers: []string{models.FindingHostNew}, URL: url,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+
+	w = doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:             "Ops channel",
+		Kind:             models.ActionKindMattermost,
+		Triggers:         []string{models.FindingHostNew},
+		URL:              `{{secret "mattermost"}}`,
+		RateLimitPerHour: 10,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+	assert.Equal(t, models.ActionKindMattermost, action.Kind)
+	assert.Equal(t, actions.DefaultChatTemplate, action.BodyTemplate)
+	assert.Equal(t, 10, action.RateLimitPerHour)
+
+	// Only a host's first report is a new host
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         probeHostDown,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: probeHostDown, Hostname: "db-1"},
+		Data:       json.RawMessage(`{}`),
+	}, admin.OrgID, admin.ID))
+	for _, meta := range []models.ReportMeta{
+		{HostID: probeHostDown, Hostname: "db-1"},
+		{HostID: probeHostUp, Hostname: "web-1", SnailVersion: "0.9.0"},
+	} {
+		w = doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{Meta: meta, Data: json.RawMessage(`{}`)})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.FindingHostNew, runs[0].Finding.Type)
+	assert.Equal(t, "web-1 reported for the first time", runs[0].Finding.Summary)
+	assert.Equal(t, []string{"agent version 0.9.0"}, runs[0].Finding.Details)
+}
+
+func TestHandlers_Actions_FiredByProbeResults(t *testing.T) {
+	r, mockStore, admin := setupProbeTest(t)
+	dispatcher := actions.NewDispatcher(mockStore)
+	h := New(mockStore, WithActions(dispatcher))
+	r.POST("/agent/probes/:id/results", h.SubmitProbeResults)
+
+	action := &models.Action{
+		ID:       "action-1",
+		Name:     "Host down",
+		Triggers: []string{models.FindingHostUnreachable},
+		Method:   http.MethodPost,
+		URL:      "https://tickets.example.com/new",
+		Enabled:  true,
+	}
+	require.NoError(t, mockStore.CreateAction(action, admin.OrgID))
+
+	w := doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "tcp", Port: 22, Prober: "agent"})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job models.ProbeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	w = doProbeRequest(r, http.MethodPost, "/probes/claim", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doProbeRequest(r, http.MethodPost, "/agent/probes/"+job.ID+"/results", models.SubmitProbeResultsRequest{
+		Results: []models.ProbeResult{
+			{HostID: probeHostUp, Reachable: true},
+			{HostID: probeHostDown, Reachable: false, Error: "connection refused"},
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, probeHostDown, runs[0].Finding.HostID)
+	assert.Equal(t, "down.invalid", runs[0].Finding.Hostname)
+	assert.Equal(t, []string{"connection refused"}, runs[0].Finding.Details)
+}
+
+func TestHandlers_OrgSecrets(t *testing.T) {
+	r, mockStore, admin := setupActionsTest(t, true)
+
+	w := doProbeRequest(r, http.MethodPut, "/secrets/bad%20name", models.SetOrgSecretRequest{Value: "x"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doProbeRequest(r, http.MethodPut, "/secrets/jira", map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doProbeRequest(r, http.MethodPut, "/secrets/jira", models.SetOrgSecretRequest{Value: "t0ken"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Values are never returned
+	w = doProbeRequest(r, http.MethodGet, "/secrets", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"jira"`)
+	assert.NotContains(t, w.Body.String(), "t0ken")
+
+	values, err := mockStore.GetOrgSecretValues(admin.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, "t0ken", values["jira"])
+
+	w = doProbeRequest(r, http.MethodDelete, "/secrets/jira", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodDelete, "/secrets/jira", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Actions_FiredByHealthTransitions(t *testing.T) {
+	r, mockStore, admin := setupActionsTest(t, true)
+
+	w := doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:     "Health",
+		Triggers: []string{models.FindingHealthCritical, models.FindingHealthRecovered},
+		URL:      "https://pager.example.com/alert",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+
+	ingest := func(health *models.HostHealth) {
+		w := doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+			Meta:   models.ReportMeta{HostID: probeHostUp, Hostname: "web-1"},
+			Data:   json.RawMessage(`{}`),
+			Health: health,
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	findings := func() []string {
+		runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+		require.NoError(t, err)
+		var types []string
+		for _, run := range runs {
+			types = append(types, run.Finding.Type)
+		}
+		return types
+	}
+
+	// A healthy first report, an unchanged status, and a report without health raise nothing
+	ingest(&models.HostHealth{Status: models.HealthOK})
+	ingest(&models.HostHealth{Status: models.HealthOK})
+	ingest(nil)
+	assert.Empty(t, findings())
+
+	// Warning is not among the action's triggers
+	ingest(&models.HostHealth{Status: models.HealthWarning})
+	assert.Empty(t, findings())
+
+	ingest(&models.HostHealth{Status: models.HealthCritical, Checks: []models.HealthCheck{
+		{Name: "disk:/var", Status: models.HealthCritical, Message: "99% used"},
+		{Name: "ntp", Status: models.HealthOK},
+	}})
+	require.Equal(t, []string{models.FindingHealthCritical}, findings())
+	runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "web-1 health changed from warning to critical", runs[0].Finding.Summary)
+	assert.Equal(t, []string{"disk:/var: critical (99% used)"}, runs[0].Finding.Details)
+
+	ingest(&models.HostHealth{Status: models.HealthOK})
+	assert.ElementsMatch(t, []string{models.FindingHealthCritical, models.FindingHealthRecovered}, findings())
+}
+
+func TestHealthTransitionFinding(t *testing.T) {
+	tests := []struct {
+		previous, current string
+		want              string
+	}{
+		{"", models.HealthOK, ""},
+		{"", models.HealthWarning, models.FindingHealthWarning},
+		{"", models.HealthCritical, models.FindingHealthCritical},
+		{models.HealthOK, models.HealthOK, ""},
+		{models.HealthOK, models.HealthWarning, models.FindingHealthWarning},
+		{models.HealthWarning, models.HealthCritical, models.FindingHealthCritical},
+		{models.HealthCritical, models.HealthWarning, models.FindingHealthWarning},
+		{models.HealthCritical, models.HealthOK, models.FindingHealthRecovered},
+		{models.HealthWarning, models.HealthOK, models.FindingHealthRecovered},
+		{models.HealthUnknown, models.HealthOK, ""},
+		{models.HealthCritical, models.HealthUnknown, ""},
+		{models.HealthUnknown, models.HealthCritical, models.FindingHealthCritical},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, models.HealthTransitionFinding(tt.previous, tt.current), "%q -> %q", tt.previous, tt.current)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/storage"
+)
+
+// ListDBActivity returns the database queries currently issued by snailbus
+// @Summary     List database activity
+// @Description Returns the Postgres backends opened by snailbus (pg_stat_activity filtered by application_name), including the running query and how long it has been running.
+// @Description Queries issued on behalf of an API request carry the request ID in their application_name. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Database activity with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/admin/db/activity [get]
+func (h *Handlers) ListDBActivity(c *gin.Context) {
+	activity, err := h.store(c).ListDBActivity(c.Request.Context())
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve database activity", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity": activity,
+		"total":    len(activity),
+	})
+}
+
+// CancelDBQuery cancels a running snailbus database query
+// @Summary     Cancel database query
+// @Description Cancels the query running on a snailbus Postgres backend. With terminate=true the backend connection is terminated instead.
+// @Description Only backends opened by snailbus can be cancelled. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       pid        path      int   true   "Backend process ID from the activity listing"
+// @Param       terminate  query     bool  false  "Terminate the backend instead of cancelling its query"
+// @Success     200  {object}  map[string]interface{}  "Query cancelled"
+// @Failure     400  {object}  map[string]string       "Invalid pid"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Failure     404  {object}  map[string]string       "No snailbus backend with this pid"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/admin/db/cancel/{pid} [post]
+func (h *Handlers) CancelDBQuery(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil || pid <= 0 {
+		_ = c.Error(apierror.Validation("invalid pid"))
+		return
+	}
+	terminate := c.Query("terminate") == "true"
+
+	if err := h.store(c).CancelDBQuery(c.Request.Context(), pid, terminate); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("backend not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Int("pid", pid).Msg("Failed to cancel database query")
+		_ = c.Error(apierror.Internal("failed to cancel query", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Int("pid", pid).
+		Bool("terminate", terminate).
+		Msg("Cancelled database query")
+
+	c.JSON(http.StatusOK, gin.H{
+		"pid":        pid,
+		"terminated": terminate,
+	})
+}
+
+// GetDBMaintenance reports table bloat and vacuum activity with maintenance advice
+// @Summary     Get database maintenance report
+// @Description Returns the size, estimated live and dead rows, HOT update ratio, and vacuum history of every snailbus table and the size and scans of its indexes (pg_stat_user_tables and pg_stat_user_indexes), and the vacuums currently running.
+// @Description Bloat is estimated from the share of dead rows. Counters are cumulative since stats_reset_at. The advice suggests fillfactor, autovacuum, and partitioning changes and unused indexes to drop, with SQL to review before running it. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.DBMaintenance  "Maintenance report"
+// @Failure     401  {object}  map[string]string     "Unauthorized"
+// @Failure     403  {object}  map[string]string     "System administrator access required"
+// @Failure     500  {object}  map[string]string     "Internal server error"
+// @Router      /api/v1/admin/db/maintenance [get]
+func (h *Handlers) GetDBMaintenance(c *gin.Context) {
+	report, err := h.store(c).DBMaintenance(c.Request.Context())
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve database maintenance report", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListErrorRates returns the per-endpoint 5xx ratios tracked by the server
+// @Summary     List endpoint error rates
+// @Description Returns the ratio of 5xx responses per endpoint over 1m, 5m and 15m sliding windows, the alert threshold and window, and whether the service is degraded.
+// @Description Rates are tracked in memory per server instance. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Endpoint error rates"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Router      /api/v1/admin/error-rates [get]
+func (h *Handlers) ListErrorRates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"endpoints":    h.errorRates.Snapshot(),
+		"degraded":     h.errorRates.Degraded(),
+		"threshold":    h.errorRates.Threshold(),
+		"alert_window": h.errorRates.Window().String(),
+	})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/buildinfo"
+	"snailbus/internal/errorrate"
+	"snailbus/internal/lifecycle"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_DBActivity(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	mockStore.SetDBActivity([]*models.DBActivity{
+		{PID: 101, ApplicationName: "snailbus/req-1", RequestID: "req-1", State: "active", Query: "SELECT 1"},
+		{PID: 102, ApplicationName: "snailbus", State: "idle"},
+	})
+	h := New(mockStore)
+
+	r := setupTestRouter(h)
+	r.GET("/admin/db/activity", h.ListDBActivity)
+	r.POST("/admin/db/cancel/:pid", h.CancelDBQuery)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := do(http.MethodGet, "/admin/db/activity")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Activity []models.DBActivity `json:"activity"`
+		Total    int                 `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, 2, listed.Total)
+	assert.Equal(t, "req-1", listed.Activity[0].RequestID)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/db/cancel/abc").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/db/cancel/999").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/db/cancel/101").Code)
+
+	w = do(http.MethodGet, "/admin/db/activity")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, 1, listed.Total)
+}
+
+func TestHandlers_DBMaintenance(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+	r := setupTestRouter(h)
+	r.GET("/admin/db/maintenance", h.GetDBMaintenance)
+
+	get := func() models.DBMaintenance {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/db/maintenance", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var report models.DBMaintenance
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return report
+	}
+
+	report := get()
+	assert.Empty(t, report.Tables)
+	assert.NotNil(t, report.Advice)
+
+	mockStore.SetDBMaintenance(&models.DBMaintenance{
+		Tables: []models.TableMaintenance{{
+			Table: "hosts", FillFactor: 100, Updates: 50000, HOTUpdates: 1000, HOTUpdateRatio: 0.02,
+		}},
+		RunningVacuums: []models.VacuumProgress{{PID: 42, Table: "hosts", Autovacuum: true, Phase: "scanning heap"}},
+	})
+	report = get()
+	require.Len(t, report.Tables, 1)
+	require.Len(t, report.RunningVacuums, 1)
+	require.Len(t, report.Advice, 1)
+	assert.Equal(t, models.AdviceFillFactor, report.Advice[0].Kind)
+	assert.Equal(t, "hosts", report.Advice[0].Table)
+}
+
+func TestHandlers_ErrorRatesAndReadiness(t *testing.T) {
+	tracker := errorrate.NewTracker(errorrate.Config{Threshold: 0.5, MinRequests: 2, Window: time.Minute})
+	h := New(storage.NewMockStorage(), WithErrorRateTracker(tracker))
+
+	r := setupTestRouter(h)
+	r.GET("/readyz", h.Ready)
+	r.GET("/admin/error-rates", h.ListErrorRates)
+
+	get := func(path string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	assert.Equal(t, "ready", get("/readyz")["status"])
+
+	tracker.Record("GET /api/v1/hosts", http.StatusInternalServerError)
+	tracker.Record("GET /api/v1/hosts", http.StatusInternalServerError)
+	tracker.Evaluate()
+
+	// Degraded keeps the instance ready but names the alerting endpoints
+	ready := get("/readyz")
+	assert.Equal(t, "degraded", ready["status"])
+	assert.Equal(t, []interface{}{"GET /api/v1/hosts"}, ready["alerting_endpoints"])
+
+	rates := get("/admin/error-rates")
+	assert.Equal(t, true, rates["degraded"])
+	assert.Equal(t, 0.5, rates["threshold"])
+	assert.Equal(t, "1m0s", rates["alert_window"])
+	endpoints := rates["endpoints"].([]interface{})
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "GET /api/v1/hosts", endpoints[0].(map[string]interface{})["endpoint"])
+}
+
+func TestHandlers_Status(t *testing.T) {
+	tracker := errorrate.NewTracker(errorrate.Config{Threshold: 0.5, MinRequests: 2, Window: time.Minute})
+	h := New(storage.NewMockStorage(), WithErrorRateTracker(tracker), WithBuildInfo(buildinfo.Info{Version: "1.2.3"}))
+
+	r := setupTestRouter(h)
+	r.GET("/status", middleware.IPRateLimitMiddleware("3-M"), h.Status)
+
+	get := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "operational", "version": "1.2.3", "api_version": "v1"}, body)
+
+	tracker.Record("GET /api/v1/hosts", http.StatusInternalServerError)
+	tracker.Record("GET /api/v1/hosts", http.StatusInternalServerError)
+	tracker.Evaluate()
+
+	// Degraded, without naming the alerting endpoints
+	code, body = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", body["status"])
+	assert.NotContains(t, body, "alerting_endpoints")
+
+	get()
+	code, _ = get()
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func TestHandlers_Version(t *testing.T) {
+	info := buildinfo.New("v1.4.0", "abc1234", "2026-10-15T09:00:00Z")
+	h := New(storage.NewMockStorage(), WithBuildInfo(info))
+
+	r := setupTestRouter(h)
+	r.GET("/version", h.Version)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var body buildinfo.Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, info, body)
+	assert.Contains(t, w.Body.String(), `"build_date":"2026-10-15T09:00:00Z"`)
+}
+
+func TestHandlers_ReadinessReplication(t *testing.T) {
+	store := storage.NewMockStorage()
+	h := New(store)
+
+	r := setupTestRouter(h)
+	r.GET("/readyz", h.Ready)
+
+	get := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get()
+	assert.Equal(t, http.StatusOK, code)
+	replication := body["replication"].(map[string]interface{})
+	assert.Equal(t, "primary", replication["primary_role"])
+	assert.NotContains(t, replication, "replica")
+
+	// A lagging replica is reported but reads fall back to the primary, so the instance stays ready
+	store.SetReplicationStatus(&models.ReplicationStatus{
+		PrimaryRole: models.DatabaseRolePrimary,
+		Replica: &models.ReplicaStatus{
+			Role:          models.DatabaseRoleReplica,
+			LagSeconds:    45,
+			MaxLagSeconds: 30,
+		},
+	})
+	code, body = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body["status"])
+	replica := body["replication"].(map[string]interface{})["replica"].(map[string]interface{})
+	assert.Equal(t, 45.0, replica["lag_seconds"])
+	assert.Equal(t, false, replica["serving_reads"])
+
+	// A primary in recovery cannot take writes
+	store.SetReplicationStatus(&models.ReplicationStatus{PrimaryRole: models.DatabaseRoleReplica})
+	code, body = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "read_only", body["database"])
+}
+
+func TestHandlers_ReadinessPrivileges(t *testing.T) {
+	get := func(h *Handlers) (int, map[string]interface{}) {
+		r := setupTestRouter(h)
+		r.GET("/readyz", h.Ready)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	// Privileges are left out when they were not checked
+	code, body := get(New(storage.NewMockStorage()))
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "privileges")
+
+	// A restricted role that can still run DDL is reported but stays ready
+	code, body = get(New(storage.NewMockStorage(), WithDatabasePrivileges(&models.DatabasePrivileges{
+		Role:       "snailbus_app",
+		Restricted: true,
+		DDL:        []string{"CREATE on schema public"},
+	})))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body["status"])
+	privileges := body["privileges"].(map[string]interface{})
+	assert.Equal(t, "snailbus_app", privileges["role"])
+	assert.Equal(t, []interface{}{"CREATE on schema public"}, privileges["ddl"])
+
+	// Missing table privileges would fail requests, so the instance is not ready
+	code, body = get(New(storage.NewMockStorage(), WithDatabasePrivileges(&models.DatabasePrivileges{
+		Role:       "snailbus_app",
+		Restricted: true,
+		Missing:    []string{"INSERT on hosts"},
+	})))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "insufficient_privileges", body["database"])
+	assert.Equal(t, []interface{}{"INSERT on hosts"}, body["privileges"].(map[string]interface{})["missing"])
+}
+
+func TestHandlers_ReadinessLifecycle(t *testing.T) {
+	state := lifecycle.NewState()
+	h := New(storage.NewMockStorage(), WithLifecycle(state))
+
+	r := setupTestRouter(h)
+	r.GET("/readyz", h.Ready)
+	r.GET("/startupz", h.Startup)
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	state.Phase("migrations")(nil)
+	code, body := get("/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "starting", body["status"])
+	assert.Len(t, body["phases"], 1)
+
+	state.MarkStarted()
+	code, body = get("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "started", body["status"])
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Once draining, readiness fails so the pod leaves its Services
+	state.Drain()
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", body["status"])
+	code, _ = get("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Without lifecycle tracking the server is always started
+	h = New(storage.NewMockStorage())
+	r = setupTestRouter(h)
+	r.GET("/startupz", h.Startup)
+	code, _ = get("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// deletionDetails describes a host deletion's reason in an audit event
+func deletionDetails(deletion *models.HostDeletion) map[string]string {
+	if deletion == nil {
+		return nil
+	}
+	details := map[string]string{"reason": deletion.Reason}
+	if deletion.Note != "" {
+		details["note"] = deletion.Note
+	}
+	return details
+}
+
+// auditPage reads the action, actor, before, and limit query parameters
+// Returns false after writing a 400 response if they are invalid
+func auditPage(c *gin.Context) (filter models.AuditFilter, beforeID int64, limit int, ok bool) {
+	filter.Action = c.Query("action")
+	if filter.Action != "" && !containsString(models.AuditActions, filter.Action) {
+		_ = c.Error(apierror.Validation("invalid action").WithDetail("action must be one of " + strings.Join(models.AuditActions, ", ")))
+		return filter, 0, 0, false
+	}
+	filter.ActorUserID = c.Query("actor")
+
+	if before := c.Query("before"); before != "" {
+		parsed, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || parsed < 1 {
+			_ = c.Error(apierror.Validation("before must be a positive event ID"))
+			return filter, 0, 0, false
+		}
+		beforeID = parsed
+	}
+	limit = storage.DefaultAuditPageSize
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > storage.MaxAuditPageSize {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(storage.MaxAuditPageSize)))
+			return filter, 0, 0, false
+		}
+		limit = parsed
+	}
+	return filter, beforeID, limit, true
+}
+
+// ListAuditEvents returns the organization's audit log
+// @Summary     List audit events
+// @Description Returns the organization's audit log, newest first: user creation, deletion, and role changes, API key creation and deletion, host deletion, and ingest, each with the acting user, how they authenticated, the target, and the request ID, client IP, and user agent of the request.
+// @Description Page with before=<next_before>; next_before is omitted on the last page. Requires admin role.
+// @Tags        Audit
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       action  query     string  false  "Only events with this action (e.g. user.created, host.deleted)"
+// @Param       actor   query     string  false  "Only events by this user ID"
+// @Param       before  query     int     false  "Return events with an ID less than this"
+// @Param       limit   query     int     false  "Maximum number of events (default 100, max 1000)"
+// @Success     200  {object}  map[string]interface{}  "Events and the next_before cursor"
+// @Failure     400  {object}  map[string]string       "Invalid filter or paging parameters"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/audit [get]
+func (h *Handlers) ListAuditEvents(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	filter, beforeID, limit, ok := auditPage(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.store(c).ListAuditEvents(orgID, filter, beforeID, limit)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve audit events", err))
+		return
+	}
+
+	response := gin.H{
+		"events":   page.Events,
+		"limit":    limit,
+		"has_more": page.Next != 0,
+	}
+	if page.Next != 0 {
+		response["next_before"] = page.Next
+	}
+	c.JSON(http.StatusOK, response)
+}
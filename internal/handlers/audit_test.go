@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// auditPageResponse is the body of GET /audit
+type auditPageResponse struct {
+	Events     []models.AuditEvent `json:"events"`
+	Limit      int                 `json:"limit"`
+	HasMore    bool                `json:"has_more"`
+	NextBefore int64               `json:"next_before"`
+}
+
+// setupAuditTest creates an organization and a router acting as its admin
+func setupAuditTest(t *testing.T) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.DELETE("/hosts/:host_id", h.DeleteHost)
+	r.POST("/users", h.CreateUser)
+	r.PUT("/users/:user_id/role", h.UpdateUserRole)
+	r.DELETE("/users/:user_id", h.DeleteUser)
+	r.POST("/api-keys", h.CreateAPIKey)
+	r.DELETE("/api-keys/:id", h.DeleteAPIKey)
+	r.GET("/audit", h.ListAuditEvents)
+	return r, mockStore, admin
+}
+
+func readAuditPage(t *testing.T, r *gin.Engine, path string) auditPageResponse {
+	t.Helper()
+	w := doProbeRequest(r, http.MethodGet, path, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page auditPageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+func TestHandlers_Audit_RecordsStateChanges(t *testing.T) {
+	r, _, admin := setupAuditTest(t)
+
+	w := doProbeRequest(r, http.MethodPost, "/users", models.CreateUserRequest{
+		Username: "bob", Email: "bob@example.com", Password: "correct-horse-battery", Role: "viewer",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bob models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bob))
+
+	w = doProbeRequest(r, http.MethodPut, "/users/"+bob.ID+"/role", models.UpdateUserRoleRequest{Role: "editor"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodPost, "/api-keys", models.CreateAPIKeyRequest{Name: "CI"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var key models.CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	w = doProbeRequest(r, http.MethodDelete, "/api-keys/"+key.ID, nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+		Meta: models.ReportMeta{HostID: probeHostUp, Hostname: "web-1", CollectionID: "collection-1"},
+		Data: json.RawMessage(`{}`),
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = doProbeRequest(r, http.MethodDelete, "/hosts/"+probeHostUp+"?reason=decommissioned", nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodDelete, "/users/"+bob.ID, nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	// Failed operations are not recorded
+	w = doProbeRequest(r, http.MethodDelete, "/users/"+bob.ID, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	page := readAuditPage(t, r, "/audit")
+	require.Len(t, page.Events, 7)
+	assert.False(t, page.HasMore)
+	assert.Zero(t, page.NextBefore)
+
+	// Newest first
+	actions := make([]string, len(page.Events))
+	for i, event := range page.Events {
+		actions[i] = event.Action
+		assert.Equal(t, admin.OrgID, event.OrgID)
+		assert.Equal(t, admin.ID, event.ActorUserID)
+		assert.Equal(t, "admin", event.ActorUsername)
+		assert.Equal(t, "192.0.2.1", event.ClientIP)
+	}
+	assert.Equal(t, []string{
+		models.AuditUserDeleted,
+		models.AuditHostDeleted,
+		models.AuditHostIngested,
+		models.AuditAPIKeyDeleted,
+		models.AuditAPIKeyCreated,
+		models.AuditUserRoleChanged,
+		models.AuditUserCreated,
+	}, actions)
+
+	deleted, hostDeleted, ingested, keyDeleted, keyCreated, roleChanged, created :=
+		page.Events[0], page.Events[1], page.Events[2], page.Events[3], page.Events[4], page.Events[5], page.Events[6]
+	assert.Equal(t, bob.ID, created.TargetID)
+	assert.Equal(t, map[string]string{"username": "bob", "role": "viewer"}, created.Details)
+	assert.Equal(t, map[string]string{"username": "bob", "old_role": "viewer", "new_role": "editor"}, roleChanged.Details)
+	assert.Equal(t, models.AuditTargetAPIKey, keyCreated.TargetType)
+	assert.Equal(t, key.ID, keyCreated.TargetID)
+	assert.Equal(t, "CI", keyCreated.Details["name"])
+	assert.Equal(t, key.ID, keyDeleted.TargetID)
+	assert.Equal(t, probeHostUp, ingested.TargetID)
+	assert.Equal(t, "web-1", ingested.Details["hostname"])
+	assert.Equal(t, probeHostUp, hostDeleted.TargetID)
+	assert.Equal(t, models.HostDeletionDecommissioned, hostDeleted.Details["reason"])
+	assert.Equal(t, models.AuditTargetUser, deleted.TargetType)
+	assert.Equal(t, map[string]string{"username": "bob", "role": "editor"}, deleted.Details)
+}
+
+func TestHandlers_Audit_FilterAndPage(t *testing.T) {
+	r, mockStore, admin := setupAuditTest(t)
+	other, _ := mockStore.CreateOrganization("Other Org")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, mockStore.CreateAuditEvent(&models.AuditEvent{
+			OrgID: admin.OrgID, Action: models.AuditHostIngested, ActorUserID: admin.ID, TargetID: strconv.Itoa(i),
+		}))
+	}
+	require.NoError(t, mockStore.CreateAuditEvent(&models.AuditEvent{
+		OrgID: admin.OrgID, Action: models.AuditHostDeleted, ActorUserID: "someone-else",
+	}))
+	require.NoError(t, mockStore.CreateAuditEvent(&models.AuditEvent{OrgID: other.ID, Action: models.AuditHostIngested}))
+
+	// Other organizations' events are not visible
+	page := readAuditPage(t, r, "/audit")
+	assert.Len(t, page.Events, 4)
+
+	page = readAuditPage(t, r, "/audit?action=host.deleted")
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, "someone-else", page.Events[0].ActorUserID)
+
+	page = readAuditPage(t, r, "/audit?actor="+admin.ID+"&limit=2")
+	require.Len(t, page.Events, 2)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "2", page.Events[0].TargetID)
+	assert.Equal(t, "1", page.Events[1].TargetID)
+
+	page = readAuditPage(t, r, "/audit?actor="+admin.ID+"&limit=2&before="+strconv.FormatInt(page.NextBefore, 10))
+	require.Len(t, page.Events, 1)
+	assert.False(t, page.HasMore)
+	assert.Equal(t, "0", page.Events[0].TargetID)
+
+	for _, query := range []string{"action=host.unknown", "limit=0", "limit=1001", "before=0", "before=abc"} {
+		w := doProbeRequest(r, http.MethodGet, "/audit?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
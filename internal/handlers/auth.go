@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"snailbus/internal/apierror"
 	"snailbus/internal/auth"
 	"snailbus/internal/logger"
 	"snailbus/internal/metrics"
@@ -16,107 +21,104 @@ import (
 // Register handles user registration
 // @Summary     Register new user
 // @Description Creates a new user account with a new organization. The user is automatically assigned as admin role.
-// @Description Only one user can be registered per organization (registration is only allowed once per organization).
+// @Description Only one user can be registered per organization (registration is only allowed once per organization). Organization names are unique ignoring case.
+// @Description Registration is idempotent: retrying the same username, email, password, and organization returns the original user.
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
 // @Param       request  body      models.RegisterRequest  true  "Registration data"
 // @Success     201      {object}  models.User  "User created"
+// @Success     200      {object}  models.User  "Registration already completed by an earlier request"
 // @Failure     400      {object}  map[string]string  "Invalid request"
-// @Failure     409      {object}  map[string]string  "User already exists or organization already has a user"
+// @Failure     409      {object}  map[string]string  "User already exists, organization name taken, or organization already has a user"
 // @Router      /api/v1/auth/register [post]
 func (h *Handlers) Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
 		return
 	}
 
-	// Check if username already exists
-	_, _, err := h.storage.GetUserByUsername(req.Username)
-	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
+	// Hash password
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("username", req.Username).
+			Msg("Failed to hash password")
+		_ = c.Error(apierror.Internal("failed to create user", err))
 		return
 	}
 
-	// Check if email already exists
-	_, err = h.storage.GetUserByEmail(req.Email)
+	// Create the organization and its admin user in a single transaction
+	user, err := h.store(c).RegisterUser(req.OrgName, req.Username, req.Email, passwordHash)
 	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
+		c.JSON(http.StatusCreated, user)
 		return
 	}
 
-	// Check if organization name already exists
-	existingOrg, err := h.storage.GetOrganizationByName(req.OrgName)
-	if err == nil {
-		// Organization exists, check if it has any users
-		userCount, err := h.storage.CountUsersInOrganization(existingOrg.ID)
-		if err != nil {
-			logger.FromContext(c).
-				Err(err).
-				Str("org_id", existingOrg.ID).
-				Msg("Failed to count users in organization")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check organization"})
-			return
-		}
-		if userCount > 0 {
-			c.JSON(http.StatusConflict, gin.H{
-				"error":   "organization already has a user",
-				"message": "Registration is only allowed once per organization. This organization already has a registered user.",
-			})
+	if errors.Is(err, storage.ErrConflict) {
+		// A retried registration (e.g. after a client timeout) returns the original user
+		if existing := h.findRegistration(c, req); existing != nil {
+			c.JSON(http.StatusOK, existing)
 			return
 		}
-		// Organization exists but has no users - reject registration
-		// Users cannot join existing organizations, they must create new ones
-		c.JSON(http.StatusConflict, gin.H{
-			"error":   "organization name already exists",
-			"message": "This organization name is already taken. Please choose a different name.",
-		})
-		return
 	}
 
-	// Create a new organization for this user
-	org, err := h.storage.CreateOrganization(req.OrgName)
-	if err != nil {
+	switch {
+	case errors.Is(err, storage.ErrUsernameTaken):
+		_ = c.Error(apierror.Conflict("username already exists"))
+	case errors.Is(err, storage.ErrEmailTaken):
+		_ = c.Error(apierror.Conflict("email already exists"))
+	case errors.Is(err, storage.ErrOrgHasUsers):
+		_ = c.Error(apierror.Conflict("organization already has a user").WithDetail("Registration is only allowed once per organization. This organization already has a registered user."))
+	case errors.Is(err, storage.ErrOrgNameTaken):
+		// Users cannot join existing organizations, they must create new ones
+		_ = c.Error(apierror.Conflict("organization name already exists").WithDetail("This organization name is already taken. Please choose a different name."))
+	default:
 		logger.FromContext(c).
 			Err(err).
+			Str("username", req.Username).
+			Str("email", req.Email).
 			Str("org_name", req.OrgName).
-			Msg("Failed to create organization")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
-		return
+			Msg("Failed to register user")
+		_ = c.Error(apierror.Internal("failed to create user", err))
 	}
-	orgID := org.ID
+}
 
-	// Hash password
-	passwordHash, err := auth.HashPassword(req.Password)
+// findRegistration returns the existing user if req repeats a registration that
+// already succeeded: same username, email, organization, and password.
+func (h *Handlers) findRegistration(c *gin.Context, req models.RegisterRequest) *models.User {
+	user, passwordHash, err := h.store(c).GetUserByUsername(req.Username)
 	if err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("username", req.Username).
-			Msg("Failed to hash password")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
-		return
+		if !errors.Is(err, storage.ErrNotFound) {
+			logger.FromContext(c).
+				Err(err).
+				Str("username", req.Username).
+				Msg("Failed to look up existing registration")
+		}
+		return nil
+	}
+	if user.Email != req.Email || user.Role != "admin" {
+		return nil
 	}
 
-	// Create user with admin role automatically
-	user, err := h.storage.CreateUser(req.Username, req.Email, passwordHash, orgID, "admin")
-	if err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("username", req.Username).
-			Str("email", req.Email).
-			Str("org_id", orgID).
-			Msg("Failed to create user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
-		return
+	org, err := h.store(c).GetOrganizationByID(user.OrgID)
+	if err != nil || !strings.EqualFold(org.Name, req.OrgName) {
+		return nil
+	}
+
+	if !auth.CheckPassword(req.Password, passwordHash) {
+		return nil
 	}
 
-	c.JSON(http.StatusCreated, user)
+	return user
 }
 
-// Login handles user login and returns an API key
+// Login handles user login and returns a session token or an API key
 // @Summary     Login
-// @Description Authenticates a user and returns an API key for this session
+// @Description Authenticates a user and starts a session. When sessions are enabled (session in AUTH_METHODS), token is a short-lived access token sent as "Authorization: Bearer <token>" and refresh_token renews it at /api/v1/auth/refresh.
+// @Description Otherwise token is an API key named "Web UI Session", sent in the X-API-Key header.
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
@@ -127,49 +129,43 @@ func (h *Handlers) Register(c *gin.Context) {
 func (h *Handlers) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
 		return
 	}
 
 	// Get user and password hash
-	user, passwordHash, err := h.storage.GetUserByUsername(req.Username)
+	user, passwordHash, err := h.store(c).GetUserByUsername(req.Username)
 	if err != nil {
 		// Don't reveal if user exists
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		_ = c.Error(apierror.Unauthorized("invalid credentials"))
 		return
 	}
 
 	// Check if user is active
 	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is inactive"})
+		_ = c.Error(apierror.Unauthorized("account is inactive"))
 		return
 	}
 
 	// Verify password
 	if !auth.CheckPassword(req.Password, passwordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		_ = c.Error(apierror.Unauthorized("invalid credentials"))
 		return
 	}
 
-	// Generate API key for this session
-	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
-	if err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("user_id", user.ID).
-			Msg("Failed to generate API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+	if h.sessionTTL > 0 {
+		h.startSession(c, user)
 		return
 	}
 
-	// Store API key
-	_, err = h.storage.CreateAPIKey(user.ID, keyHash, keyPrefix, "Web UI Session", nil)
+	// Generate and store an API key for this session
+	plainKey, _, err := storage.GenerateAPIKey(h.storage, user.ID, "Web UI Session", nil)
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", user.ID).
 			Msg("Failed to store API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		_ = c.Error(apierror.Internal("failed to create session", err))
 		return
 	}
 
@@ -186,6 +182,7 @@ func (h *Handlers) Login(c *gin.Context) {
 // CreateAPIKey creates a new API key for the authenticated user
 // @Summary     Create API key
 // @Description Creates a new API key for the authenticated user
+// @Description The key can optionally be restricted to specific endpoints with "[METHOD ]/path" patterns, e.g. "POST /api/v1/ingest" or "/api/v1/hosts/*".
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
@@ -197,36 +194,45 @@ func (h *Handlers) Login(c *gin.Context) {
 func (h *Handlers) CreateAPIKey(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
 	var req models.CreateAPIKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
 		return
 	}
 
-	// Generate API key
-	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
+	allowedEndpoints, err := normalizeEndpoints(req.AllowedEndpoints)
 	if err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("user_id", userID.(string)).
-			Msg("Failed to generate API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate API key"})
+		_ = c.Error(apierror.Validation("invalid allowed_endpoints").WithDetail(err.Error()))
 		return
 	}
 
-	// Store API key
-	apiKey, err := h.storage.CreateAPIKey(userID.(string), keyHash, keyPrefix, req.Name, req.ExpiresAt)
+	// Generate and store the API key with its endpoint restrictions, in one transaction
+	// so that an unrestricted key is never left behind
+	var plainKey string
+	var apiKey *models.APIKey
+	err = h.store(c).WithTx(func(tx storage.Storage) error {
+		if plainKey, apiKey, err = storage.GenerateAPIKey(tx, userID.(string), req.Name, req.ExpiresAt); err != nil {
+			return err
+		}
+		if len(allowedEndpoints) > 0 {
+			if err := tx.SetAPIKeyAllowedEndpoints(apiKey.ID, allowedEndpoints); err != nil {
+				return err
+			}
+			apiKey.AllowedEndpoints = allowedEndpoints
+		}
+		return nil
+	})
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID.(string)).
 			Str("key_name", req.Name).
 			Msg("Failed to store API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+		_ = c.Error(apierror.Internal("failed to create API key", err))
 		return
 	}
 
@@ -235,6 +241,12 @@ func (h *Handlers) CreateAPIKey(c *gin.Context) {
 	if orgID != "" {
 		metrics.APIKeysCreatedTotal.WithLabelValues(orgID).Inc()
 	}
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditAPIKeyCreated,
+		TargetType: models.AuditTargetAPIKey,
+		TargetID:   apiKey.ID,
+		Details:    map[string]string{"name": apiKey.Name},
+	})
 
 	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{
 		ID:        apiKey.ID,
@@ -242,12 +254,14 @@ func (h *Handlers) CreateAPIKey(c *gin.Context) {
 		Name:      apiKey.Name,
 		ExpiresAt: apiKey.ExpiresAt,
 		CreatedAt: apiKey.CreatedAt,
+
+		AllowedEndpoints: apiKey.AllowedEndpoints,
 	})
 }
 
 // ListAPIKeys lists all API keys for the authenticated user
 // @Summary     List API keys
-// @Description Returns all API keys for the authenticated user
+// @Description Returns all API keys for the authenticated user. Keys whose expires_at has passed are marked expired; they no longer authenticate and are deleted after API_KEY_EXPIRED_RETENTION.
 // @Tags        Auth
 // @Produce     json
 // @Security    ApiKeyAuth
@@ -256,19 +270,22 @@ func (h *Handlers) CreateAPIKey(c *gin.Context) {
 func (h *Handlers) ListAPIKeys(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
-	apiKeys, err := h.storage.GetAPIKeysByUserID(userID.(string))
+	apiKeys, err := h.store(c).GetAPIKeysByUserID(userID.(string))
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID.(string)).
 			Msg("Failed to list API keys")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve API keys"})
+		_ = c.Error(apierror.Internal("failed to retrieve API keys", err))
 		return
 	}
+	for _, key := range apiKeys {
+		key.Expired = auth.IsExpired(key.ExpiresAt)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"api_keys": apiKeys,
@@ -276,6 +293,55 @@ func (h *Handlers) ListAPIKeys(c *gin.Context) {
 	})
 }
 
+// DeleteExpiredAPIKeys deletes the authenticated user's expired API keys
+// @Summary     Delete expired API keys
+// @Description Deletes every API key of the authenticated user whose expires_at has passed, without waiting for the cleanup job. expired=true is required, so a request cannot delete unexpired keys by mistake.
+// @Tags        Auth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       expired  query     bool                    true  "Must be true"
+// @Success     200      {object}  map[string]interface{}  "IDs of the deleted keys and their count"
+// @Failure     400      {object}  map[string]string       "expired=true missing"
+// @Failure     401      {object}  map[string]string       "Unauthorized"
+// @Failure     500      {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/api-keys [delete]
+func (h *Handlers) DeleteExpiredAPIKeys(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	if expired, err := strconv.ParseBool(c.Query("expired")); err != nil || !expired {
+		_ = c.Error(apierror.Validation("expired=true is required").WithDetail("Only expired API keys can be deleted in bulk; delete other keys by ID."))
+		return
+	}
+
+	deleted, err := h.store(c).DeleteExpiredAPIKeys(userID, time.Now())
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", userID).
+			Msg("Failed to delete expired API keys")
+		_ = c.Error(apierror.Internal("failed to delete expired API keys", err))
+		return
+	}
+
+	ids := make([]string, 0, len(deleted))
+	for _, key := range deleted {
+		ids = append(ids, key.ID)
+		h.audit.Record(c, models.AuditEvent{
+			Action:     models.AuditAPIKeyDeleted,
+			TargetType: models.AuditTargetAPIKey,
+			TargetID:   key.ID,
+			Details:    map[string]string{"reason": "expired"},
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deleted": ids,
+		"total":   len(ids),
+	})
+}
+
 // DeleteAPIKey deletes an API key
 // @Summary     Delete API key
 // @Description Deletes an API key by ID
@@ -289,16 +355,16 @@ func (h *Handlers) ListAPIKeys(c *gin.Context) {
 func (h *Handlers) DeleteAPIKey(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
 	keyID := c.Param("id")
 
 	// Verify the key belongs to the user
-	apiKeys, err := h.storage.GetAPIKeysByUserID(userID.(string))
+	apiKeys, err := h.store(c).GetAPIKeysByUserID(userID.(string))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify ownership"})
+		_ = c.Error(apierror.Internal("failed to verify ownership", err))
 		return
 	}
 
@@ -312,14 +378,14 @@ func (h *Handlers) DeleteAPIKey(c *gin.Context) {
 	}
 
 	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		_ = c.Error(apierror.NotFound("API key not found"))
 		return
 	}
 
 	// Delete the key
-	if err := h.storage.DeleteAPIKey(keyID); err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+	if err := h.store(c).DeleteAPIKey(keyID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("API key not found"))
 			return
 		}
 		logger.FromContext(c).
@@ -327,13 +393,106 @@ func (h *Handlers) DeleteAPIKey(c *gin.Context) {
 			Str("user_id", userID.(string)).
 			Str("key_id", keyID).
 			Msg("Failed to delete API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete API key"})
+		_ = c.Error(apierror.Internal("failed to delete API key", err))
 		return
 	}
 
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditAPIKeyDeleted,
+		TargetType: models.AuditTargetAPIKey,
+		TargetID:   keyID,
+	})
 	c.Status(http.StatusNoContent)
 }
 
+// UpdateAPIKeyEndpoints replaces the endpoint restrictions of an API key
+// @Summary     Update API key endpoint restrictions
+// @Description Replaces the endpoints an API key may call. Patterns have the form "[METHOD ]/path"; ":name" matches one path segment and a trailing "/*" matches everything below a path.
+// @Description An empty list removes all restrictions.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id       path      string                              true  "API key ID"
+// @Param       request  body      models.UpdateAPIKeyEndpointsRequest  true  "Allowed endpoints"
+// @Success     200      {object}  models.APIKey  "API key updated"
+// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     404      {object}  map[string]string  "API key not found"
+// @Router      /api/v1/api-keys/{id}/endpoints [put]
+func (h *Handlers) UpdateAPIKeyEndpoints(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req models.UpdateAPIKeyEndpointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	allowedEndpoints, err := normalizeEndpoints(req.AllowedEndpoints)
+	if err != nil {
+		_ = c.Error(apierror.Validation("invalid allowed_endpoints").WithDetail(err.Error()))
+		return
+	}
+
+	// Verify the key belongs to the user
+	keyID := c.Param("id")
+	apiKeys, err := h.store(c).GetAPIKeysByUserID(userID.(string))
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to verify ownership", err))
+		return
+	}
+	var apiKey *models.APIKey
+	for _, key := range apiKeys {
+		if key.ID == keyID {
+			apiKey = key
+			break
+		}
+	}
+	if apiKey == nil {
+		_ = c.Error(apierror.NotFound("API key not found"))
+		return
+	}
+
+	if err := h.store(c).SetAPIKeyAllowedEndpoints(keyID, allowedEndpoints); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("API key not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("key_id", keyID).
+			Msg("Failed to update API key endpoints")
+		_ = c.Error(apierror.Internal("failed to update API key", err))
+		return
+	}
+
+	apiKey.AllowedEndpoints = allowedEndpoints
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// normalizeEndpoints trims and de-duplicates endpoint patterns and checks that they compile
+func normalizeEndpoints(patterns []string) ([]string, error) {
+	seen := make(map[string]bool, len(patterns))
+	normalized := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.Join(strings.Fields(pattern), " ")
+		if seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+		normalized = append(normalized, pattern)
+	}
+
+	if _, err := auth.CompileEndpoints(normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
 // GetMe returns the current authenticated user
 // @Summary     Get current user
 // @Description Returns information about the currently authenticated user
@@ -345,7 +504,7 @@ func (h *Handlers) DeleteAPIKey(c *gin.Context) {
 func (h *Handlers) GetMe(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
@@ -365,49 +524,38 @@ func (h *Handlers) GetMe(c *gin.Context) {
 func (h *Handlers) GetAPIKeyFromCredentials(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
 		return
 	}
 
 	// Get user and password hash
-	user, passwordHash, err := h.storage.GetUserByUsername(req.Username)
+	user, passwordHash, err := h.store(c).GetUserByUsername(req.Username)
 	if err != nil {
 		// Don't reveal if user exists
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		_ = c.Error(apierror.Unauthorized("invalid credentials"))
 		return
 	}
 
 	// Check if user is active
 	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is inactive"})
+		_ = c.Error(apierror.Unauthorized("account is inactive"))
 		return
 	}
 
 	// Verify password
 	if !auth.CheckPassword(req.Password, passwordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-		return
-	}
-
-	// Generate API key
-	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
-	if err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("user_id", user.ID).
-			Msg("Failed to generate API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate API key"})
+		_ = c.Error(apierror.Unauthorized("invalid credentials"))
 		return
 	}
 
-	// Store API key
-	apiKey, err := h.storage.CreateAPIKey(user.ID, keyHash, keyPrefix, "Auto-generated from credentials", nil)
+	// Generate and store API key
+	plainKey, apiKey, err := storage.GenerateAPIKey(h.storage, user.ID, "Auto-generated from credentials", nil)
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", user.ID).
 			Msg("Failed to store API key")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+		_ = c.Error(apierror.Internal("failed to create API key", err))
 		return
 	}
 
@@ -422,7 +570,7 @@ func (h *Handlers) GetAPIKeyFromCredentials(c *gin.Context) {
 
 // ListUsers lists all users in the current organization (admin-only)
 // @Summary     List users in organization
-// @Description Returns all users in the authenticated user's organization
+// @Description Returns all users in the authenticated user's organization. Each user's version, quoted, is its ETag for If-Match.
 // @Tags        Users
 // @Produce     json
 // @Security    ApiKeyAuth
@@ -434,17 +582,17 @@ func (h *Handlers) ListUsers(c *gin.Context) {
 	// Alternative: user, _ := c.Get("user"); userObj := user.(*models.User); orgID := userObj.OrgID
 	orgID := middleware.GetOrgID(c)
 	if orgID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
-	users, err := h.storage.ListUsersByOrganization(orgID)
+	users, err := h.store(c).ListUsersByOrganization(orgID)
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("org_id", orgID).
 			Msg("Failed to list users")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve users"})
+		_ = c.Error(apierror.Internal("failed to retrieve users", err))
 		return
 	}
 
@@ -456,21 +604,21 @@ func (h *Handlers) ListUsers(c *gin.Context) {
 
 // CreateUser creates a new user in the current organization (admin-only)
 // @Summary     Create user
-// @Description Creates a new user in the authenticated user's organization
+// @Description Creates a new user in the authenticated user's organization. The role must be one of those listed by GET /api/v1/roles.
 // @Tags        Users
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
 // @Param       request  body      models.CreateUserRequest  true  "User creation data"
 // @Success     201      {object}  models.User  "User created"
-// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     400      {object}  map[string]string  "Invalid request or role"
 // @Failure     403      {object}  map[string]string  "Forbidden - admin role required"
 // @Failure     409      {object}  map[string]string  "User already exists"
 // @Router      /api/v1/users [post]
 func (h *Handlers) CreateUser(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
@@ -478,21 +626,24 @@ func (h *Handlers) CreateUser(c *gin.Context) {
 
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if !validateRole(c, req.Role) {
 		return
 	}
 
 	// Check if username already exists
-	_, _, err := h.storage.GetUserByUsername(req.Username)
+	_, _, err := h.store(c).GetUserByUsername(req.Username)
 	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
+		_ = c.Error(apierror.Conflict("username already exists"))
 		return
 	}
 
 	// Check if email already exists
-	_, err = h.storage.GetUserByEmail(req.Email)
+	_, err = h.store(c).GetUserByEmail(req.Email)
 	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
+		_ = c.Error(apierror.Conflict("email already exists"))
 		return
 	}
 
@@ -503,13 +654,22 @@ func (h *Handlers) CreateUser(c *gin.Context) {
 			Err(err).
 			Str("username", req.Username).
 			Msg("Failed to hash password")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+		_ = c.Error(apierror.Internal("failed to create user", err))
 		return
 	}
 
 	// Create user in the current organization
-	newUser, err := h.storage.CreateUser(req.Username, req.Email, passwordHash, userObj.OrgID, req.Role)
+	newUser, err := h.store(c).CreateUser(req.Username, req.Email, passwordHash, userObj.OrgID, req.Role)
 	if err != nil {
+		// The checks above race with concurrent requests; the database has the final say
+		switch {
+		case errors.Is(err, storage.ErrUsernameTaken):
+			_ = c.Error(apierror.Conflict("username already exists"))
+			return
+		case errors.Is(err, storage.ErrEmailTaken):
+			_ = c.Error(apierror.Conflict("email already exists"))
+			return
+		}
 		logger.FromContext(c).
 			Err(err).
 			Str("username", req.Username).
@@ -517,31 +677,41 @@ func (h *Handlers) CreateUser(c *gin.Context) {
 			Str("org_id", userObj.OrgID).
 			Str("role", req.Role).
 			Msg("Failed to create user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+		_ = c.Error(apierror.Internal("failed to create user", err))
 		return
 	}
 
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      userObj.OrgID,
+		Action:     models.AuditUserCreated,
+		TargetType: models.AuditTargetUser,
+		TargetID:   newUser.ID,
+		Details:    map[string]string{"username": newUser.Username, "role": newUser.Role},
+	})
 	c.JSON(http.StatusCreated, newUser)
 }
 
 // UpdateUserRole updates a user's role (admin-only)
 // @Summary     Update user role
-// @Description Updates the role of a user in the current organization. Admins cannot update their own role.
+// @Description Updates the role of a user in the current organization to one of those listed by GET /api/v1/roles. Admins cannot update their own role.
+// @Description With If-Match set to the user's version as an ETag (e.g. "3"), the role is only updated if the user has not changed since. The response carries the new ETag.
 // @Tags        Users
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
-// @Param       user_id  path      string  true  "User ID"
-// @Param       request  body      models.UpdateUserRoleRequest  true  "Role update data"
+// @Param       user_id   path      string  true   "User ID"
+// @Param       If-Match  header    string  false  "ETag of the user being updated"
+// @Param       request   body      models.UpdateUserRoleRequest  true  "Role update data"
 // @Success     200      {object}  models.User  "User updated"
-// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     400      {object}  map[string]string  "Invalid request or role"
 // @Failure     403      {object}  map[string]string  "Forbidden - admin role required or cannot update own role"
 // @Failure     404      {object}  map[string]string  "User not found"
+// @Failure     412      {object}  map[string]string  "User changed since If-Match was read"
 // @Router      /api/v1/users/{user_id}/role [put]
 func (h *Handlers) UpdateUserRole(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
@@ -550,46 +720,55 @@ func (h *Handlers) UpdateUserRole(c *gin.Context) {
 
 	// Prevent users from updating their own role
 	if currentUser.ID == userID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "cannot update own role",
-			"message": "You cannot update your own role. Ask another admin to update it for you.",
-		})
+		_ = c.Error(apierror.Forbidden("cannot update own role").WithDetail("You cannot update your own role. Ask another admin to update it for you."))
 		return
 	}
 
 	// Verify the target user is in the same organization
-	targetUser, err := h.storage.GetUserByID(userID)
+	targetUser, err := h.store(c).GetUserByID(userID)
 	if err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("user not found"))
 			return
 		}
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID).
 			Msg("Failed to get user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		_ = c.Error(apierror.Internal("failed to retrieve user", err))
 		return
 	}
 
 	if targetUser.OrgID != currentUser.OrgID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "user not in your organization",
-			"message": "You can only update users in your own organization.",
-		})
+		_ = c.Error(apierror.Forbidden("user not in your organization").WithDetail("You can only update users in your own organization."))
 		return
 	}
 
 	var req models.UpdateUserRoleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if !validateRole(c, req.Role) {
+		return
+	}
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	// Update the user's role
-	if err := h.storage.UpdateUserRole(userID, req.Role); err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	oldRole := targetUser.Role
+	if err := h.store(c).UpdateUserRole(userID, req.Role, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("user not found"))
+			return
+		case errors.Is(err, storage.ErrInvalidInput):
+			_ = c.Error(apierror.Validation("invalid role"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
 			return
 		}
 		logger.FromContext(c).
@@ -597,39 +776,49 @@ func (h *Handlers) UpdateUserRole(c *gin.Context) {
 			Str("user_id", userID).
 			Str("new_role", req.Role).
 			Msg("Failed to update user role")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user role"})
+		_ = c.Error(apierror.Internal("failed to update user role", err))
 		return
 	}
 
 	// Fetch updated user
-	updatedUser, err := h.storage.GetUserByID(userID)
+	updatedUser, err := h.store(c).GetUserByID(userID)
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID).
 			Msg("Failed to get updated user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve updated user"})
+		_ = c.Error(apierror.Internal("failed to retrieve updated user", err))
 		return
 	}
 
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      currentUser.OrgID,
+		Action:     models.AuditUserRoleChanged,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"username": targetUser.Username, "old_role": oldRole, "new_role": updatedUser.Role},
+	})
+	setETag(c, updatedUser.Version)
 	c.JSON(http.StatusOK, updatedUser)
 }
 
 // DeleteUser deletes a user from the current organization (admin-only)
 // @Summary     Delete user
-// @Description Deletes a user from the current organization. Admins cannot delete themselves.
+// @Description Deletes a user from the current organization. Admins cannot delete themselves. With If-Match, the user is only deleted if it has not changed since that ETag.
 // @Tags        Users
 // @Produce     json
 // @Security    ApiKeyAuth
-// @Param       user_id  path      string  true  "User ID"
+// @Param       user_id   path      string  true   "User ID"
+// @Param       If-Match  header    string  false  "ETag of the user being deleted"
 // @Success     204      "User deleted"
 // @Failure     403      {object}  map[string]string  "Forbidden - admin role required or cannot delete self"
 // @Failure     404      {object}  map[string]string  "User not found"
+// @Failure     412      {object}  map[string]string  "User changed since If-Match was read"
 // @Router      /api/v1/users/{user_id} [delete]
 func (h *Handlers) DeleteUser(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
@@ -638,49 +827,59 @@ func (h *Handlers) DeleteUser(c *gin.Context) {
 
 	// Prevent users from deleting themselves
 	if currentUser.ID == userID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "cannot delete yourself",
-			"message": "You cannot delete your own account. Ask another admin to delete it for you.",
-		})
+		_ = c.Error(apierror.Forbidden("cannot delete yourself").WithDetail("You cannot delete your own account. Ask another admin to delete it for you."))
 		return
 	}
 
 	// Verify the target user is in the same organization
-	targetUser, err := h.storage.GetUserByID(userID)
+	targetUser, err := h.store(c).GetUserByID(userID)
 	if err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("user not found"))
 			return
 		}
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID).
 			Msg("Failed to get user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		_ = c.Error(apierror.Internal("failed to retrieve user", err))
 		return
 	}
 
 	if targetUser.OrgID != currentUser.OrgID {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "user not in your organization",
-			"message": "You can only delete users in your own organization.",
-		})
+		_ = c.Error(apierror.Forbidden("user not in your organization").WithDetail("You can only delete users in your own organization."))
+		return
+	}
+
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	// Delete the user
-	if err := h.storage.DeleteUser(userID); err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	if err := h.store(c).DeleteUser(userID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("user not found"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
 			return
 		}
 		logger.FromContext(c).
 			Err(err).
 			Str("user_id", userID).
 			Msg("Failed to delete user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		_ = c.Error(apierror.Internal("failed to delete user", err))
 		return
 	}
 
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      currentUser.OrgID,
+		Action:     models.AuditUserDeleted,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"username": targetUser.Username, "role": targetUser.Role},
+	})
 	c.Status(http.StatusNoContent)
 }
@@ -3,12 +3,16 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"snailbus/internal/auth"
 	"snailbus/internal/models"
@@ -90,6 +94,24 @@ func TestHandlers_Register(t *testing.T) {
 			},
 			expectedStatus: http.StatusConflict,
 		},
+		{
+			name: "organization name differs only in case",
+			body: models.RegisterRequest{
+				Username: "newuser",
+				Email:    "newuser@example.com",
+				Password: "password123",
+				OrgName:  "existing ORGANIZATION",
+			},
+			setupMock: func() *storage.MockStorage {
+				mock := storage.NewMockStorage()
+				mock.CreateOrganization("Existing Organization")
+				return mock
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Contains(t, w.Body.String(), "organization name already exists")
+			},
+		},
 		{
 			name: "invalid request body",
 			body: models.RegisterRequest{
@@ -126,6 +148,119 @@ func TestHandlers_Register(t *testing.T) {
 	}
 }
 
+func TestHandlers_Register_Idempotent(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+	r := setupTestRouter(h)
+	r.POST("/register", h.Register)
+
+	register := func(body models.RegisterRequest) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body := models.RegisterRequest{
+		Username: "retryuser",
+		Email:    "retry@example.com",
+		Password: "password123",
+		OrgName:  "Retry Org",
+	}
+
+	first := register(body)
+	require.Equal(t, http.StatusCreated, first.Code)
+	var created models.User
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), &created))
+
+	// Retrying the identical request returns the original user
+	retry := register(body)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	var retried models.User
+	require.NoError(t, json.Unmarshal(retry.Body.Bytes(), &retried))
+	assert.Equal(t, created.ID, retried.ID)
+
+	// A different password is not treated as a retry
+	wrongPassword := body
+	wrongPassword.Password = "differentpassword"
+	assert.Equal(t, http.StatusConflict, register(wrongPassword).Code)
+
+	// Neither is a different organization name
+	otherOrg := body
+	otherOrg.OrgName = "Another Org"
+	assert.Equal(t, http.StatusConflict, register(otherOrg).Code)
+
+	count, err := mockStore.CountUsersInOrganization(created.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestHandlers_Register_Concurrent(t *testing.T) {
+	const attempts = 8
+
+	run := func(t *testing.T, bodyFor func(i int) models.RegisterRequest) []int {
+		mockStore := storage.NewMockStorage()
+		h := New(mockStore)
+		r := setupTestRouter(h)
+		r.POST("/register", h.Register)
+
+		codes := make([]int, attempts)
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				bodyBytes, _ := json.Marshal(bodyFor(i))
+				req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(bodyBytes))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				codes[i] = w.Code
+			}(i)
+		}
+		wg.Wait()
+		return codes
+	}
+
+	countCodes := func(codes []int) map[int]int {
+		counts := map[int]int{}
+		for _, code := range codes {
+			counts[code]++
+		}
+		return counts
+	}
+
+	t.Run("identical retries create one user", func(t *testing.T) {
+		codes := run(t, func(int) models.RegisterRequest {
+			return models.RegisterRequest{
+				Username: "raceuser",
+				Email:    "race@example.com",
+				Password: "password123",
+				OrgName:  "Race Org",
+			}
+		})
+		counts := countCodes(codes)
+		assert.Equal(t, 1, counts[http.StatusCreated])
+		assert.Equal(t, attempts-1, counts[http.StatusOK])
+	})
+
+	t.Run("different users racing for one organization", func(t *testing.T) {
+		codes := run(t, func(i int) models.RegisterRequest {
+			return models.RegisterRequest{
+				Username: fmt.Sprintf("raceuser%d", i),
+				Email:    fmt.Sprintf("race%d@example.com", i),
+				Password: "password123",
+				OrgName:  "Contested Org",
+			}
+		})
+		counts := countCodes(codes)
+		assert.Equal(t, 1, counts[http.StatusCreated])
+		assert.Equal(t, attempts-1, counts[http.StatusConflict])
+	})
+}
+
 func TestHandlers_Login(t *testing.T) {
 	// Create test user
 	mockStore := storage.NewMockStorage()
@@ -198,7 +333,7 @@ func TestHandlers_Login(t *testing.T) {
 			// Handle inactive user test case
 			if tt.name == "inactive user" {
 				// Create inactive user
-				mockStore.DeleteUser(user.ID)
+				mockStore.DeleteUser(user.ID, 0)
 				passwordHash, _ := auth.HashPassword("password123")
 				inactiveUser, _ := mockStore.CreateUser("testuser", "test@example.com", passwordHash, org.ID, "admin")
 				inactiveUser.IsActive = false
@@ -500,6 +635,63 @@ func TestHandlers_DeleteAPIKey(t *testing.T) {
 	}
 }
 
+func TestHandlers_DeleteExpiredAPIKeys(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+	other, _ := mockStore.CreateUser("otheruser", "other@example.com", "hash", org.ID, "admin")
+
+	expired := time.Now().Add(-time.Hour)
+	valid := time.Now().Add(time.Hour)
+	expiredKey, _ := mockStore.CreateAPIKey(user.ID, "hash1", "prefix1", "Expired", &expired)
+	_, _ = mockStore.CreateAPIKey(user.ID, "hash2", "prefix2", "Valid", &valid)
+	_, _ = mockStore.CreateAPIKey(other.ID, "hash3", "prefix3", "Other Expired", &expired)
+
+	r := setupTestRouter(h)
+	withUser := func(c *gin.Context) { c.Set("user_id", user.ID) }
+	r.GET("/api-keys", withUser, h.ListAPIKeys)
+	r.DELETE("/api-keys", withUser, h.DeleteExpiredAPIKeys)
+
+	// Expired keys are listed as such until they are deleted
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api-keys", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		APIKeys []models.APIKey `json:"api_keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	expiredByName := map[string]bool{}
+	for _, key := range list.APIKeys {
+		expiredByName[key.Name] = key.Expired
+	}
+	assert.Equal(t, map[string]bool{"Expired": true, "Valid": false}, expiredByName)
+
+	for _, query := range []string{"", "?expired=false", "?expired=yes"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api-keys"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api-keys?expired=true", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Deleted []string `json:"deleted"`
+		Total   int      `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{expiredKey.ID}, response.Deleted)
+	assert.Equal(t, 1, response.Total)
+
+	keys, _ := mockStore.GetAPIKeysByUserID(user.ID)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "Valid", keys[0].Name)
+	otherKeys, _ := mockStore.GetAPIKeysByUserID(other.ID)
+	assert.Len(t, otherKeys, 1, "other users' expired keys are left alone")
+}
+
 func TestHandlers_GetMe(t *testing.T) {
 	mockStore := storage.NewMockStorage()
 	h := New(mockStore)
@@ -641,6 +833,25 @@ func TestHandlers_CreateUser(t *testing.T) {
 				assert.Equal(t, "editor", user.Role)
 			},
 		},
+		{
+			name: "invalid role",
+			body: models.CreateUserRequest{
+				Username: "superuser",
+				Email:    "superuser@example.com",
+				Password: "password123",
+				Role:     "owner",
+			},
+			setupContext: func(c *gin.Context) {
+				c.Set("user", adminUser)
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var body map[string]interface{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, "invalid role", body["error"])
+				assert.Equal(t, []interface{}{"viewer", "editor", "admin"}, body["roles"])
+			},
+		},
 		{
 			name: "username already exists",
 			body: models.CreateUserRequest{
@@ -764,6 +975,17 @@ func TestHandlers_UpdateUserRole(t *testing.T) {
 			},
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:   "invalid role",
+			userID: targetUser.ID,
+			body: models.UpdateUserRoleRequest{
+				Role: "Admin",
+			},
+			setupContext: func(c *gin.Context) {
+				c.Set("user", adminUser)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:   "unauthorized - no user",
 			userID: targetUser.ID,
@@ -798,6 +1020,24 @@ func TestHandlers_UpdateUserRole(t *testing.T) {
 	}
 }
 
+func TestHandlers_ListRoles(t *testing.T) {
+	h := New(storage.NewMockStorage())
+	r := setupTestRouter(h)
+	r.GET("/roles", h.ListRoles)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/roles", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.RolesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Roles, 3)
+	assert.Equal(t, "viewer", response.Roles[0].Name)
+	assert.Equal(t, "admin", response.Roles[2].Name)
+	assert.Contains(t, response.Roles[2].Permissions, "hosts:read", "admins have every permission")
+	assert.NotContains(t, response.Roles[0].Permissions, "hosts:write")
+}
+
 func TestHandlers_DeleteUser(t *testing.T) {
 	mockStore := storage.NewMockStorage()
 	h := New(mockStore)
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/bundle"
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Default and maximum number of batches returned by ListImportBatches
+const (
+	defaultImportBatchLimit = 50
+	maxImportBatchLimit     = 500
+)
+
+// bundleImportEnabled writes a 400 response and returns false if no bundle keys are trusted
+func (h *Handlers) bundleImportEnabled(c *gin.Context) bool {
+	if h.bundleKeys == nil || h.bundleKeys.Len() == 0 {
+		_ = c.Error(apierror.Validation("bundle import is disabled").WithDetail("Set BUNDLE_TRUSTED_KEYS to the public keys bundles are signed with to enable it"))
+		return false
+	}
+	return true
+}
+
+// ImportBundle imports an offline bundle of reports
+// @Summary     Import offline bundle
+// @Description Imports a signed bundle of reports exported at an air-gapped site: a tar archive, optionally gzip-compressed, with manifest.json, manifest.sig, and the report files. The manifest must be signed with a key in BUNDLE_TRUSTED_KEYS and every report must match its checksum.
+// @Description Reports are validated like ingested ones but must carry meta.timestamp, which becomes their receive time. A report older than its host's current report is superseded; invalid reports are rejected without failing the batch. Imports raise no outbound action findings and issue no receipts. Requires admin role.
+// @Tags        Bundles
+// @Accept      application/gzip
+// @Accept      application/x-tar
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     201  {object}  models.ImportBatch  "Import batch with per-report results"
+// @Failure     400  {object}  map[string]string  "Invalid bundle, bad signature, or bundle import disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     409  {object}  map[string]string  "Bundle already imported"
+// @Failure     413  {object}  map[string]string  "Bundle too large"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/bundles [post]
+func (h *Handlers) ImportBundle(c *gin.Context) {
+	if !h.bundleImportEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	b, err := bundle.Read(c.Request.Body, h.bundleKeys, h.bundleMax)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, bundle.ErrTooLarge) || errors.As(err, &maxBytesErr):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "bundle is too large"})
+		case errors.Is(err, bundle.ErrInvalid), errors.Is(err, bundle.ErrUntrustedKey), errors.Is(err, bundle.ErrInvalidSignature):
+			logger.FromContext(c).Err(err).Msg("Rejected offline bundle")
+			_ = c.Error(apierror.Validation("invalid bundle").WithDetail(err.Error()))
+		default:
+			logger.FromContext(c).Err(err).Msg("Failed to read offline bundle")
+			_ = c.Error(apierror.Validation("failed to read bundle"))
+		}
+		return
+	}
+
+	batch, err := h.bundles.Import(b, orgID, middleware.GetUserID(c), models.ImportSourceAPI)
+	if errors.Is(err, storage.ErrBundleAlreadyImported) {
+		_ = c.Error(apierror.Conflict("bundle has already been imported"))
+		return
+	}
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("bundle_sha256", b.SHA256).Msg("Failed to import offline bundle")
+		_ = c.Error(apierror.Internal("failed to import bundle", err))
+		return
+	}
+
+	metrics.HostsIngestedTotal.WithLabelValues(orgID).Add(float64(batch.Imported))
+	logger.FromContext(c).
+		Str("batch_id", batch.ID).
+		Str("key_id", batch.KeyID).
+		Int("imported", batch.Imported).
+		Int("superseded", batch.Superseded).
+		Int("rejected", batch.Rejected).
+		Msg("Offline bundle imported")
+	c.JSON(http.StatusCreated, batch)
+}
+
+// ListImportBatches returns the organization's bundle imports
+// @Summary     List bundle imports
+// @Description Returns the organization's bundle import batches, newest first, with their report counts. Per-report results are only returned by GET /api/v1/bundles/{id}. Requires admin role.
+// @Tags        Bundles
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       limit  query     int     false  "Maximum number of batches (default 50, max 500)"
+// @Success     200  {object}  map[string]interface{}  "Batches with total count"
+// @Failure     400  {object}  map[string]string       "Invalid limit"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/bundles [get]
+func (h *Handlers) ListImportBatches(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	limit := defaultImportBatchLimit
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxImportBatchLimit {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(maxImportBatchLimit)))
+			return
+		}
+		limit = parsed
+	}
+
+	batches, err := h.store(c).ListImportBatches(orgID, limit)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list bundle imports", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batches": batches,
+		"total":   len(batches),
+	})
+}
+
+// GetImportBatch returns a bundle import with its per-report results
+// @Summary     Get bundle import
+// @Description Returns a bundle import batch with the outcome of each report (imported, superseded, or rejected with the reason). A batch without completed_at was interrupted and can be retried by importing the bundle again. Requires admin role.
+// @Tags        Bundles
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Import batch ID (UUID)"
+// @Success     200  {object}  models.ImportBatch  "Import batch"
+// @Failure     401  {object}  map[string]string   "Unauthorized"
+// @Failure     403  {object}  map[string]string   "Admin role required"
+// @Failure     404  {object}  map[string]string   "Import batch not found"
+// @Failure     500  {object}  map[string]string   "Internal server error"
+// @Router      /api/v1/bundles/{id} [get]
+func (h *Handlers) GetImportBatch(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	batch, err := h.store(c).GetImportBatch(c.Param("id"), orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.NotFound("import batch not found"))
+		return
+	}
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to get bundle import", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
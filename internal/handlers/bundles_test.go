@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/bundle"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func setupBundlesTest(t *testing.T, keys *bundle.Keyring) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	var opts []Option
+	if keys != nil {
+		opts = append(opts, WithBundleImport(keys, 1024*1024))
+	}
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/bundles", h.ImportBundle)
+	r.GET("/bundles", h.ListImportBatches)
+	r.GET("/bundles/:id", h.GetImportBatch)
+	return r, mockStore, admin
+}
+
+func postBundle(r *gin.Engine, data []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/bundles", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/gzip")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlers_Bundles(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	keys, err := bundle.ParseKeys([]string{base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))})
+	require.NoError(t, err)
+
+	report, _ := json.Marshal(models.IngestRequest{
+		Meta: models.ReportMeta{HostID: probeHostUp, Hostname: "web-1", Timestamp: "2026-03-01T10:00:00Z"},
+		Data: json.RawMessage(`{"system":{}}`),
+	})
+	var buf bytes.Buffer
+	require.NoError(t, bundle.Write(&buf, key, "site-a", time.Now(), [][]byte{report}))
+
+	// Import is disabled without trusted keys
+	r, _, _ := setupBundlesTest(t, nil)
+	w := postBundle(r, buf.Bytes())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "BUNDLE_TRUSTED_KEYS")
+
+	r, mockStore, admin := setupBundlesTest(t, keys)
+
+	w = postBundle(r, []byte("not a bundle"))
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = postBundle(r, buf.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var batch models.ImportBatch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, models.ImportSourceAPI, batch.Source)
+	assert.Equal(t, admin.ID, batch.ImportedBy)
+	assert.Equal(t, "site-a", batch.Exporter)
+	assert.Equal(t, 1, batch.Imported)
+	require.Len(t, batch.Results, 1)
+	assert.Equal(t, models.ImportReportImported, batch.Results[0].Status)
+
+	host, err := mockStore.GetHost(probeHostUp, admin.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-01T10:00:00Z", host.ReceivedAt.UTC().Format(time.RFC3339), "reports keep their collection time")
+
+	// A bundle is imported once
+	w = postBundle(r, buf.Bytes())
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodGet, "/bundles", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Batches []models.ImportBatch `json:"batches"`
+		Total   int                  `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Total)
+	assert.Empty(t, list.Batches[0].Results)
+
+	w = doProbeRequest(r, http.MethodGet, "/bundles?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doProbeRequest(r, http.MethodGet, "/bundles/"+batch.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"imported"`)
+
+	w = doProbeRequest(r, http.MethodGet, "/bundles/00000000-0000-0000-0000-000000000000", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/checkin"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// ListCheckins compares each host's last report with its expected check-in window
+// @Summary     List host check-ins
+// @Description Returns each host's last report, the check-in window that applies to it, and whether it is overdue, most overdue first. A host uses the shortest window of the organization's check-in schedule whose tag it carries, otherwise the schedule's default, otherwise the server default (CHECKIN_DEFAULT_INTERVAL).
+// @Description Archived hosts are left out. Users with a tag-based host access policy only see hosts carrying at least one of their allowed tags.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       overdue  query     bool  false  "Only overdue hosts"
+// @Success     200  {object}  map[string]interface{}  "Host check-ins with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/checkins [get]
+func (h *Handlers) ListCheckins(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	schedule, err := h.store(c).GetCheckinSchedule(orgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.Internal("failed to retrieve check-ins", err))
+		return
+	}
+
+	hosts, err := h.store(c).ListHosts(orgID, false)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve check-ins", err))
+		return
+	}
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve check-ins", err))
+		return
+	}
+	hosts = policy.FilterHosts(hosts)
+
+	onlyOverdue := c.Query("overdue") == "true"
+	now := time.Now().UTC()
+	checkins := []models.HostCheckin{}
+	overdue := 0
+	for _, host := range hosts {
+		status := checkin.Evaluate(schedule, host, h.staleAfter, now)
+		if status.Overdue {
+			overdue++
+		} else if onlyOverdue {
+			continue
+		}
+		checkins = append(checkins, status)
+	}
+	// Most overdue first
+	sort.Slice(checkins, func(i, j int) bool {
+		if !checkins[i].DueAt.Equal(checkins[j].DueAt) {
+			return checkins[i].DueAt.Before(checkins[j].DueAt)
+		}
+		return checkins[i].HostID < checkins[j].HostID
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"checkins": checkins,
+		"total":    len(checkins),
+		"overdue":  overdue,
+	})
+}
+
+// GetCheckinSchedule returns the organization's check-in schedule
+// @Summary     Get check-in schedule
+// @Description Returns how often the organization's hosts are expected to report, by tag. The ETag header carries the schedule's version for If-Match. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.CheckinSchedule  "Check-in schedule"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     404  {object}  map[string]string       "No check-in schedule configured"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/orgs/current/checkin-schedule [get]
+func (h *Handlers) GetCheckinSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	schedule, err := h.store(c).GetCheckinSchedule(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no check-in schedule configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get check-in schedule", err))
+		return
+	}
+
+	setETag(c, schedule.Version)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// SetCheckinSchedule replaces the organization's check-in schedule
+// @Summary     Set check-in schedule
+// @Description Declares how often hosts are expected to report, e.g. hosts tagged env:prod every hour and env:lab daily. A host carrying several listed tags uses the shortest window; hosts without one use default_interval_seconds, or the server default when it is omitted.
+// @Description Hosts that miss their window are reported by GET /checkins, exported as down through remote write, and raise host_overdue findings for outbound actions. Intervals are between 60 seconds and 30 days.
+// @Description With If-Match, the schedule is only replaced if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                            false  "ETag of the schedule being replaced"
+// @Param       request  body      models.SetCheckinScheduleRequest  true   "Windows by tag"
+// @Success     200      {object}  models.CheckinSchedule            "Check-in schedule set"
+// @Failure     400      {object}  map[string]string                 "Invalid schedule"
+// @Failure     401      {object}  map[string]string                 "Unauthorized"
+// @Failure     403      {object}  map[string]string                 "Admin role required"
+// @Failure     412      {object}  map[string]string                 "Schedule changed since If-Match was read"
+// @Failure     500      {object}  map[string]string                 "Internal server error"
+// @Router      /api/v1/orgs/current/checkin-schedule [put]
+func (h *Handlers) SetCheckinSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetCheckinScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if req.DefaultIntervalSeconds == 0 && len(req.Windows) == 0 {
+		_ = c.Error(apierror.Validation("schedule must set default_interval_seconds or at least one window"))
+		return
+	}
+	windows := make([]models.CheckinWindow, len(req.Windows))
+	seen := make(map[string]bool, len(req.Windows))
+	for i, window := range req.Windows {
+		window.Tag = strings.TrimSpace(window.Tag)
+		if window.Tag == "" || seen[window.Tag] {
+			_ = c.Error(apierror.Validation("window tags must be non-empty and unique"))
+			return
+		}
+		seen[window.Tag] = true
+		windows[i] = window
+	}
+
+	schedule := &models.CheckinSchedule{
+		OrgID:                  orgID,
+		DefaultIntervalSeconds: req.DefaultIntervalSeconds,
+		Windows:                windows,
+		UpdatedByUserID:        middleware.GetUserID(c),
+		Version:                ifVersion,
+	}
+	if err := h.store(c).SetCheckinSchedule(schedule); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set check-in schedule", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Int64("default_interval_seconds", schedule.DefaultIntervalSeconds).
+		Int("windows", len(schedule.Windows)).
+		Msg("Check-in schedule set")
+	setETag(c, schedule.Version)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteCheckinSchedule returns every host to the server default check-in window
+// @Summary     Delete check-in schedule
+// @Description Removes the organization's check-in schedule, so every host uses the server default window and no host_overdue findings are raised. With If-Match, the schedule is only removed if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the schedule being removed"
+// @Success     204  "Check-in schedule deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No check-in schedule configured"
+// @Failure     412  {object}  map[string]string  "Schedule changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/checkin-schedule [delete]
+func (h *Handlers) DeleteCheckinSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteCheckinSchedule(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no check-in schedule configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete check-in schedule", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Check-in schedule deleted")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_Checkins(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithCheckinDefault(48*time.Hour))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	now := time.Now().UTC()
+	for _, host := range []struct {
+		id   string
+		tags []string
+		seen time.Time
+	}{
+		{"00000000-0000-0000-0000-000000000001", []string{"env:prod"}, now.Add(-2 * time.Hour)},
+		{"00000000-0000-0000-0000-000000000002", []string{"env:lab"}, now.Add(-2 * time.Hour)},
+		{"00000000-0000-0000-0000-000000000003", nil, now.Add(-30 * time.Hour)},
+	} {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: host.seen,
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: "host-" + host.id[len(host.id)-1:]},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID))
+		require.NoError(t, mockStore.SetHostTags(host.id, org.ID, host.tags, admin.ID, 0))
+	}
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/checkins", h.ListCheckins)
+	r.GET("/orgs/current/checkin-schedule", h.GetCheckinSchedule)
+	r.PUT("/orgs/current/checkin-schedule", h.SetCheckinSchedule)
+	r.DELETE("/orgs/current/checkin-schedule", h.DeleteCheckinSchedule)
+
+	type listResponse struct {
+		Checkins []models.HostCheckin `json:"checkins"`
+		Total    int                  `json:"total"`
+		Overdue  int                  `json:"overdue"`
+	}
+	list := func(path string) listResponse {
+		w := doProbeRequest(r, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp listResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// Without a schedule every host uses the server default
+	resp := list("/checkins")
+	assert.Equal(t, 3, resp.Total)
+	assert.Zero(t, resp.Overdue)
+	assert.Equal(t, int64(48*3600), resp.Checkins[0].ExpectedIntervalSeconds)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/orgs/current/checkin-schedule", nil).Code)
+
+	invalid := []models.SetCheckinScheduleRequest{
+		{},
+		{DefaultIntervalSeconds: 30},
+		{Windows: []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 10}}},
+		{Windows: []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 3600}, {Tag: " env:prod", IntervalSeconds: 7200}}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPut, "/orgs/current/checkin-schedule", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	w := doProbeRequest(r, http.MethodPut, "/orgs/current/checkin-schedule", models.SetCheckinScheduleRequest{
+		DefaultIntervalSeconds: 86400,
+		Windows: []models.CheckinWindow{
+			{Tag: "env:prod", IntervalSeconds: 3600},
+			{Tag: "env:lab", IntervalSeconds: 86400},
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var schedule models.CheckinSchedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+	assert.Equal(t, admin.ID, schedule.UpdatedByUserID)
+	assert.Len(t, schedule.Windows, 2)
+
+	// The prod host missed its hourly window and the untagged host its daily default
+	resp = list("/checkins?overdue=true")
+	assert.Equal(t, 2, resp.Overdue)
+	require.Len(t, resp.Checkins, 2)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000003", resp.Checkins[0].HostID, "most overdue first")
+	assert.Empty(t, resp.Checkins[0].WindowTag)
+	assert.Equal(t, "env:prod", resp.Checkins[1].WindowTag)
+	assert.True(t, resp.Checkins[1].Overdue)
+	assert.Equal(t, 3, list("/checkins").Total)
+
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodDelete, "/orgs/current/checkin-schedule", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodDelete, "/orgs/current/checkin-schedule", nil).Code)
+	assert.Zero(t, list("/checkins").Overdue)
+}
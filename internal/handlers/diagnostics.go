@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+)
+
+// diagnosticFile is one file of a diagnostic bundle
+type diagnosticFile struct {
+	name  string
+	write func(*bytes.Buffer) error
+}
+
+// GetDiagnostics returns a diagnostic bundle to attach to support tickets
+// @Summary     Download diagnostic bundle
+// @Description Returns a zip archive describing this server instance: manifest.json (build and runtime), config.json (configuration with keys and passwords redacted), database.json (migration version, connection pool statistics, replication status), and error_rates.json (recent per-endpoint 5xx rates).
+// @Description With profiles=true the archive also holds goroutine.txt and heap.pb.gz profiles (readable with go tool pprof). A section that cannot be collected records its error instead of failing the bundle. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     application/zip
+// @Security    ApiKeyAuth
+// @Param       profiles  query     bool               false  "Include goroutine and heap profiles"
+// @Success     200       {file}    file               "Diagnostic bundle"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     403       {object}  map[string]string  "System administrator access required"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/diagnostics [get]
+func (h *Handlers) GetDiagnostics(c *gin.Context) {
+	now := time.Now().UTC()
+	files := []diagnosticFile{
+		{"manifest.json", jsonFile(diagnosticManifest(now))},
+		{"database.json", jsonFile(h.databaseDiagnostics(c))},
+		{"error_rates.json", jsonFile(gin.H{
+			"endpoints":    h.errorRates.Snapshot(),
+			"degraded":     h.errorRates.Degraded(),
+			"threshold":    h.errorRates.Threshold(),
+			"alert_window": h.errorRates.Window().String(),
+		})},
+	}
+	if h.config != nil {
+		files = append(files, diagnosticFile{"config.json", jsonFile(h.config.Redacted())})
+	}
+	if c.Query("profiles") == "true" {
+		files = append(files,
+			diagnosticFile{"goroutine.txt", profileFile("goroutine", 1)},
+			diagnosticFile{"heap.pb.gz", profileFile("heap", 0)},
+		)
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, file := range files {
+		var content bytes.Buffer
+		if err := file.write(&content); err != nil {
+			logger.FromContext(c).Err(err).Str("file", file.name).Msg("Failed to collect diagnostics")
+			content.Reset()
+			fmt.Fprintf(&content, "failed to collect %s: %v\n", file.name, err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			_, err = w.Write(content.Bytes())
+		}
+		if err != nil {
+			_ = c.Error(apierror.Internal("failed to create diagnostic bundle", err))
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		_ = c.Error(apierror.Internal("failed to create diagnostic bundle", err))
+		return
+	}
+
+	logger.FromContext(c).Int("files", len(files)).Msg("Diagnostic bundle downloaded")
+	filename := "snailbus-diagnostics-" + now.Format("20060102T150405Z") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// databaseDiagnostics collects database state, keeping errors in place of the sections that failed
+func (h *Handlers) databaseDiagnostics(c *gin.Context) gin.H {
+	database := gin.H{}
+	if diagnostics, err := h.store(c).DatabaseDiagnostics(c.Request.Context()); err != nil {
+		database["error"] = err.Error()
+	} else {
+		database["migration_version"] = diagnostics.MigrationVersion
+		database["migration_dirty"] = diagnostics.MigrationDirty
+		database["pools"] = diagnostics.Pools
+	}
+	if replication, err := h.store(c).ReplicationStatus(c.Request.Context()); err != nil {
+		database["replication_error"] = err.Error()
+	} else {
+		database["replication"] = replication
+	}
+	return database
+}
+
+// diagnosticManifest describes the build and runtime of this instance
+func diagnosticManifest(now time.Time) gin.H {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	hostname, _ := os.Hostname()
+
+	manifest := gin.H{
+		"generated_at": now,
+		"hostname":     hostname,
+		"go_version":   runtime.Version(),
+		"os":           runtime.GOOS,
+		"arch":         runtime.GOARCH,
+		"num_cpu":      runtime.NumCPU(),
+		"gomaxprocs":   runtime.GOMAXPROCS(0),
+		"goroutines":   runtime.NumGoroutine(),
+		"memory": gin.H{
+			"heap_alloc_bytes": mem.HeapAlloc,
+			"heap_inuse_bytes": mem.HeapInuse,
+			"sys_bytes":        mem.Sys,
+			"num_gc":           mem.NumGC,
+		},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		manifest["build"] = gin.H{
+			"module":   info.Main.Path,
+			"version":  info.Main.Version,
+			"settings": settings,
+		}
+	}
+	return manifest
+}
+
+func jsonFile(v interface{}) func(*bytes.Buffer) error {
+	return func(buf *bytes.Buffer) error {
+		encoder := json.NewEncoder(buf)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+}
+
+// profileFile writes a runtime/pprof profile; debug 0 is the gzipped protobuf format
+func profileFile(name string, debugLevel int) func(*bytes.Buffer) error {
+	return func(buf *bytes.Buffer) error {
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			return fmt.Errorf("unknown profile %q", name)
+		}
+		return profile.WriteTo(buf, debugLevel)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/config"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_GetDiagnostics(t *testing.T) {
+	store := storage.NewMockStorage()
+	store.SetMigrationVersion(26)
+	h := New(store, WithConfig(&config.Config{
+		DatabaseURL: "postgres://snail:hunter2@db:5432/snailbus",
+		JWTSecret:   "jwt-secret",
+		Port:        "8080",
+	}))
+
+	r := setupTestRouter(h)
+	r.GET("/admin/diagnostics", h.GetDiagnostics)
+
+	download := func(path string) map[string][]byte {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), `attachment; filename="snailbus-diagnostics-`)
+
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			files[f.Name], err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+		return files
+	}
+
+	files := download("/admin/diagnostics")
+	assert.Len(t, files, 4)
+	assert.NotContains(t, files, "heap.pb.gz", "profiles are opt-in")
+
+	cfg := string(files["config.json"])
+	assert.Contains(t, cfg, "postgres://snail:xxxxx@db:5432/snailbus")
+	assert.NotContains(t, cfg, "hunter2")
+	assert.NotContains(t, cfg, "jwt-secret")
+
+	var database map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["database.json"], &database))
+	assert.Equal(t, float64(26), database["migration_version"])
+	assert.Contains(t, database["pools"], "primary")
+	assert.Equal(t, "primary", database["replication"].(map[string]interface{})["primary_role"])
+
+	var manifest map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.NotEmpty(t, manifest["go_version"])
+	assert.Contains(t, files, "error_rates.json")
+
+	files = download("/admin/diagnostics?profiles=true")
+	assert.Contains(t, string(files["goroutine.txt"]), "goroutine profile")
+	assert.NotEmpty(t, files["heap.pb.gz"])
+
+	// Without a configuration the bundle leaves it out
+	h = New(store)
+	r = setupTestRouter(h)
+	r.GET("/admin/diagnostics", h.GetDiagnostics)
+	assert.NotContains(t, download("/admin/diagnostics"), "config.json")
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/payload"
+)
+
+// ingestFormatKey is the context key of the encoding ingest responses are written in
+const ingestFormatKey = "ingest_response_format"
+
+// negotiateIngestFormat returns the encoding of an ingest request's body and records
+// the one its response is written in: the first supported type in Accept, or the
+// request's own encoding
+func negotiateIngestFormat(c *gin.Context) payload.Format {
+	format := payload.FromContentType(c.GetHeader("Content-Type"))
+	c.Set(ingestFormatKey, payload.Negotiate(c.GetHeader("Accept"), format))
+	return format
+}
+
+// respondIngest writes an ingest response in the negotiated encoding, JSON if none was negotiated
+func respondIngest(c *gin.Context, status int, obj interface{}) {
+	format := payload.FormatJSON
+	if negotiated, ok := c.Get(ingestFormatKey); ok {
+		format = negotiated.(payload.Format)
+	}
+	if !format.Binary() {
+		c.JSON(status, obj)
+		return
+	}
+
+	data, err := payload.Marshal(format, obj)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("format", string(format)).Msg("Failed to encode ingest response")
+		_ = c.Error(apierror.Internal("failed to encode response", err))
+		return
+	}
+	c.Data(status, format.ContentType(), data)
+}
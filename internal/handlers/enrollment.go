@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/auth"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// defaultEnrollmentTokenTTL is how long an enrollment token lasts unless expires_at is given
+const defaultEnrollmentTokenTTL = 24 * time.Hour
+
+// CreateEnrollmentToken mints a token agents enroll with
+// @Summary     Create enrollment token
+// @Description Mints a token that snail-core agents exchange at POST /api/v1/enroll for their own API key, so hosts can be registered without distributing a shared key to every machine. The token can be used max_uses times until expires_at (default 24 hours from now); it is shown only once.
+// @Description The API keys issued with it belong to the administrator creating it, may only call the ingest endpoints, and may only report for the host that enrolled. Requires admin role.
+// @Tags        Enrollment
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.CreateEnrollmentTokenRequest   true  "Token details"
+// @Success     201      {object}  models.CreateEnrollmentTokenResponse  "Token created"
+// @Failure     400      {object}  map[string]string                     "Invalid request"
+// @Failure     401      {object}  map[string]string                     "Unauthorized"
+// @Failure     403      {object}  map[string]string                     "Admin role required"
+// @Failure     500      {object}  map[string]string                     "Internal server error"
+// @Router      /api/v1/enroll-tokens [post]
+func (h *Handlers) CreateEnrollmentToken(c *gin.Context) {
+	var req models.CreateEnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(defaultEnrollmentTokenTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			_ = c.Error(apierror.Validation("expires_at must be in the future").WithField("expires_at"))
+			return
+		}
+		expiresAt = req.ExpiresAt.UTC()
+	}
+
+	plain, tokenHash, err := auth.GenerateOAuthToken(auth.EnrollmentTokenPrefix)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create enrollment token", err))
+		return
+	}
+	token := &models.EnrollmentToken{
+		ID:              uuid.New().String(),
+		OrgID:           middleware.GetOrgID(c),
+		Name:            req.Name,
+		TokenHash:       tokenHash,
+		MaxUses:         req.MaxUses,
+		ExpiresAt:       expiresAt,
+		CreatedByUserID: middleware.GetUserID(c),
+	}
+	if err := h.store(c).CreateEnrollmentToken(token); err != nil {
+		_ = c.Error(apierror.Internal("failed to create enrollment token", err))
+		return
+	}
+
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditEnrollmentTokenCreated,
+		TargetType: models.AuditTargetEnrollmentToken,
+		TargetID:   token.ID,
+		Details: map[string]string{
+			"name":       token.Name,
+			"expires_at": token.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, models.CreateEnrollmentTokenResponse{EnrollmentToken: token, Token: plain})
+}
+
+// ListEnrollmentTokens lists the organization's enrollment tokens
+// @Summary     List enrollment tokens
+// @Description Returns the organization's enrollment tokens, newest first, with how many times each has been used. Expired and used-up tokens are listed until deleted. Requires admin role.
+// @Tags        Enrollment
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {array}   models.EnrollmentToken  "Enrollment tokens"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/enroll-tokens [get]
+func (h *Handlers) ListEnrollmentTokens(c *gin.Context) {
+	tokens, err := h.store(c).ListEnrollmentTokens(middleware.GetOrgID(c))
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list enrollment tokens", err))
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DeleteEnrollmentToken revokes an enrollment token
+// @Summary     Delete enrollment token
+// @Description Deletes an enrollment token so no more agents can enroll with it. API keys already issued with it keep working; delete them from the creator's API keys to revoke them. Requires admin role.
+// @Tags        Enrollment
+// @Security    ApiKeyAuth
+// @Param       id  path  string  true  "Enrollment token ID"
+// @Success     204  "Token deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Token not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/enroll-tokens/{id} [delete]
+func (h *Handlers) DeleteEnrollmentToken(c *gin.Context) {
+	tokenID := c.Param("id")
+	err := h.store(c).DeleteEnrollmentToken(tokenID, middleware.GetOrgID(c))
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.NotFound("enrollment token not found"))
+		return
+	}
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to delete enrollment token", err))
+		return
+	}
+
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditEnrollmentTokenDeleted,
+		TargetType: models.AuditTargetEnrollmentToken,
+		TargetID:   tokenID,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// Enroll exchanges an enrollment token for an agent's API key
+// @Summary     Enroll host
+// @Description Called by a snail-core agent on first start with the enrollment token it was provisioned with, its host ID, and its hostname. Returns an API key, shown only once, that may only call POST /api/v1/ingest and /api/v1/ingest/batch, and only with reports whose meta.host_id is the enrolled host; others are rejected with 403.
+// @Description Each enrollment uses up one of the token's uses. The key belongs to the administrator who created the token and is listed with their API keys. Needs no credentials other than the token.
+// @Tags        Enrollment
+// @Accept      json
+// @Produce     json
+// @Param       request  body      models.EnrollRequest   true  "Enrollment token and host"
+// @Success     201      {object}  models.EnrollResponse  "Host enrolled"
+// @Failure     400      {object}  map[string]string      "Invalid request"
+// @Failure     401      {object}  map[string]string      "Invalid, expired, or used-up enrollment token"
+// @Failure     429      {object}  map[string]string      "Too many requests"
+// @Failure     500      {object}  map[string]string      "Internal server error"
+// @Router      /api/v1/enroll [post]
+func (h *Handlers) Enroll(c *gin.Context) {
+	var req models.EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	// The token is used up, the key issued, and the key restricted together, so a failed
+	// enrollment neither costs a use nor leaves an unrestricted key behind
+	var token *models.EnrollmentToken
+	var plainKey string
+	var apiKey *models.APIKey
+	err := h.store(c).WithTx(func(tx storage.Storage) error {
+		var err error
+		token, err = tx.RedeemEnrollmentToken(auth.HashOAuthToken(req.Token), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		// A creator who was deactivated or moved to another organization no longer vouches for the token
+		creator, err := tx.GetUserByID(token.CreatedByUserID)
+		if err != nil {
+			return err
+		}
+		if !creator.IsActive || creator.OrgID != token.OrgID {
+			return storage.ErrNotFound
+		}
+
+		if plainKey, apiKey, err = storage.GenerateAPIKey(tx, creator.ID, "enrolled: "+req.Hostname, nil); err != nil {
+			return err
+		}
+		if err := tx.SetAPIKeyAllowedEndpoints(apiKey.ID, auth.EnrollmentEndpoints); err != nil {
+			return err
+		}
+		return tx.SetAPIKeyHost(apiKey.ID, req.HostID)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.Unauthorized("invalid enrollment token"))
+		return
+	}
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", req.HostID).Msg("Failed to enroll host")
+		_ = c.Error(apierror.Internal("failed to enroll host", err))
+		return
+	}
+
+	// The request carries no credentials; the event belongs to the token's organization
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      token.OrgID,
+		Action:     models.AuditHostEnrolled,
+		TargetType: models.AuditTargetHost,
+		TargetID:   req.HostID,
+		Details: map[string]string{
+			"hostname":   req.Hostname,
+			"token_id":   token.ID,
+			"token_name": token.Name,
+			"api_key_id": apiKey.ID,
+		},
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, models.EnrollResponse{
+		HostID:           req.HostID,
+		OrgID:            token.OrgID,
+		APIKeyID:         apiKey.ID,
+		APIKey:           plainKey,
+		AllowedEndpoints: auth.EnrollmentEndpoints,
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_Enroll(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	other, _ := mockStore.CreateOrganization("Other Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	admins := r.Group("/api/v1", func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	admins.POST("/enroll-tokens", h.CreateEnrollmentToken)
+	admins.GET("/enroll-tokens", h.ListEnrollmentTokens)
+	admins.DELETE("/enroll-tokens/:id", h.DeleteEnrollmentToken)
+	r.POST("/api/v1/enroll", h.Enroll)
+	agents := r.Group("/api/v1", middleware.AuthChain(middleware.NewAPIKeyAuthenticator(mockStore)),
+		middleware.OrgContextMiddleware(mockStore))
+	agents.POST("/ingest", h.Ingest)
+	agents.GET("/hosts", h.ListHosts)
+
+	do := func(method, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Reader
+		if s, ok := body.(string); ok {
+			reader = bytes.NewReader([]byte(s))
+		} else {
+			b, _ := json.Marshal(body)
+			reader = bytes.NewReader(b)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/enroll-tokens", "", models.CreateEnrollmentTokenRequest{Name: "rack 12", MaxUses: 1})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.CreateEnrollmentTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.Token, auth.EnrollmentTokenPrefix))
+	assert.NotContains(t, w.Body.String(), "token_hash")
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), created.ExpiresAt, time.Minute)
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	w = do(http.MethodPost, "/api/v1/enroll", "", models.EnrollRequest{Token: created.Token, HostID: hostID, Hostname: "web-01"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var enrolled models.EnrollResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrolled))
+	assert.Equal(t, org.ID, enrolled.OrgID)
+	assert.Equal(t, auth.EnrollmentEndpoints, enrolled.AllowedEndpoints)
+
+	// The token had one use
+	w = do(http.MethodPost, "/api/v1/enroll", "", models.EnrollRequest{Token: created.Token, HostID: hostID, Hostname: "web-01"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = do(http.MethodPost, "/api/v1/enroll", "", models.EnrollRequest{Token: "sbet_unknown", HostID: hostID, Hostname: "web-01"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The key reports for its own host only, and only to the ingest endpoints
+	report := func(id string) string {
+		return `{"meta": {"host_id": "` + id + `", "hostname": "web-01"}, "data": {}}`
+	}
+	w = do(http.MethodPost, "/api/v1/ingest", enrolled.APIKey, report(hostID))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do(http.MethodPost, "/api/v1/ingest", enrolled.APIKey, report("00000000-0000-0000-0000-000000000002"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/v1/hosts", enrolled.APIKey, "").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", strings.NewReader(report(hostID)))
+	req.Header.Set("X-API-Key", enrolled.APIKey)
+	req.Header.Set(middleware.OrgIDHeader, other.ID)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(http.MethodGet, "/api/v1/enroll-tokens", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var tokens []models.EnrollmentToken
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	require.Len(t, tokens, 1)
+	assert.Equal(t, 1, tokens[0].Uses)
+
+	page, err := mockStore.ListAuditEvents(org.ID, models.AuditFilter{Action: models.AuditHostEnrolled}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, hostID, page.Events[0].TargetID)
+	assert.Equal(t, enrolled.APIKeyID, page.Events[0].Details["api_key_id"])
+
+	// Deleting the token keeps the keys issued with it
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/enroll-tokens/"+created.ID, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/enroll-tokens/"+created.ID, "", "").Code)
+	w = do(http.MethodPost, "/api/v1/ingest", enrolled.APIKey, report(hostID))
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestHandlers_Enroll_InactiveCreator(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	plain, tokenHash, err := auth.GenerateOAuthToken(auth.EnrollmentTokenPrefix)
+	require.NoError(t, err)
+	require.NoError(t, mockStore.CreateEnrollmentToken(&models.EnrollmentToken{
+		ID:              "token-1",
+		OrgID:           org.ID,
+		Name:            "rack 12",
+		TokenHash:       tokenHash,
+		MaxUses:         5,
+		ExpiresAt:       time.Now().Add(time.Hour),
+		CreatedByUserID: admin.ID,
+	}))
+	admin.IsActive = false
+
+	r := setupTestRouter(h)
+	r.POST("/enroll", h.Enroll)
+	body, _ := json.Marshal(models.EnrollRequest{Token: plain, HostID: "00000000-0000-0000-0000-000000000001", Hostname: "web-01"})
+	req := httptest.NewRequest(http.MethodPost, "/enroll", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	// The failed enrollment does not use up the token
+	tokens, err := mockStore.ListEnrollmentTokens(org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, tokens[0].Uses)
+}
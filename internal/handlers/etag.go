@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/logger"
+)
+
+// setETag sets the ETag response header to a resource version
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// ifMatchVersion returns the version required by the request's If-Match header, or 0 if the
+// header is absent or "*". Any other value is not an ETag setETag issued and can never match,
+// so a 412 response is written and false returned.
+func ifMatchVersion(c *gin.Context) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if len(header) > 2 && header[0] == '"' && header[len(header)-1] == '"' {
+		version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+		if err == nil && version > 0 {
+			return version, true
+		}
+	}
+	versionMismatch(c)
+	return 0, false
+}
+
+// versionMismatch writes the 412 response for a write whose If-Match is not the current version
+func versionMismatch(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   "resource has been modified",
+		"message": "If-Match does not match the current ETag. Fetch the resource again and retry with its ETag.",
+	})
+}
+
+// setHostETag sets the ETag response header to the version of a host's tags and details after a change
+// The change is already stored, so a failed lookup only leaves the header out.
+func (h *Handlers) setHostETag(c *gin.Context, hostID, orgID string) {
+	version, err := h.store(c).GetHostMetadataVersion(hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host metadata version")
+		return
+	}
+	setETag(c, version)
+}
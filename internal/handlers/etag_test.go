@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// doIfMatchRequest sends a JSON request with an If-Match header, omitted when ifMatch is empty
+func doIfMatchRequest(r *gin.Engine, method, path, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version int64
+		ok      bool
+	}{
+		{"", 0, true},
+		{"*", 0, true},
+		{`"3"`, 3, true},
+		{` "12" `, 12, true},
+		{"3", 0, false},
+		{`W/"3"`, 0, false},
+		{`"0"`, 0, false},
+		{`"-1"`, 0, false},
+		{`"3", "4"`, 0, false},
+		{`""`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+			c.Request.Header.Set("If-Match", tt.header)
+
+			version, ok := ifMatchVersion(c)
+			assert.Equal(t, tt.version, version)
+			assert.Equal(t, tt.ok, ok)
+			if !ok {
+				assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlers_IngestFilter_IfMatch(t *testing.T) {
+	r, _, _ := setupIngestFilterTest(t)
+	req := models.SetIngestFilterRequest{Paths: []string{"users"}}
+
+	// A version of a filter that does not exist can never match
+	w := doIfMatchRequest(r, http.MethodPut, "/orgs/current/ingest-filter", `"1"`, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = doIfMatchRequest(r, http.MethodPut, "/orgs/current/ingest-filter", "", req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = doIfMatchRequest(r, http.MethodGet, "/orgs/current/ingest-filter", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	w = doIfMatchRequest(r, http.MethodPut, "/orgs/current/ingest-filter", etag, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"version":2`)
+
+	// A second admin holding the old ETag cannot overwrite or delete the change
+	w = doIfMatchRequest(r, http.MethodPut, "/orgs/current/ingest-filter", etag, models.SetIngestFilterRequest{Paths: []string{"network"}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doIfMatchRequest(r, http.MethodDelete, "/orgs/current/ingest-filter", etag, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = doIfMatchRequest(r, http.MethodGet, "/orgs/current/ingest-filter", "", nil)
+	assert.Contains(t, w.Body.String(), `"paths":["users"]`)
+
+	w = doIfMatchRequest(r, http.MethodDelete, "/orgs/current/ingest-filter", `"2"`, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doIfMatchRequest(r, http.MethodDelete, "/orgs/current/ingest-filter", `"2"`, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_HostMetadata_IfMatch(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         probeHostUp,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: probeHostUp, Hostname: "web-1"},
+		Data:       json.RawMessage(`{}`),
+	}, org.ID, admin.ID))
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/hosts/:host_id", h.GetHost)
+	r.PATCH("/hosts/:host_id", h.UpdateHost)
+	r.PUT("/hosts/:host_id/tags", h.SetHostTags)
+	r.POST("/ingest", h.Ingest)
+
+	w := doIfMatchRequest(r, http.MethodGet, "/hosts/"+probeHostUp, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	name := "Web"
+	w = doIfMatchRequest(r, http.MethodPatch, "/hosts/"+probeHostUp, etag, models.UpdateHostRequest{DisplayName: &name})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// Tags and details share one version, so the stale ETag fails for either
+	w = doIfMatchRequest(r, http.MethodPut, "/hosts/"+probeHostUp+"/tags", etag, models.UpdateHostTagsRequest{Tags: []string{"team:web"}})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doIfMatchRequest(r, http.MethodPatch, "/hosts/"+probeHostUp, etag, models.UpdateHostRequest{DisplayName: &name})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = doIfMatchRequest(r, http.MethodPut, "/hosts/"+probeHostUp+"/tags", `"2"`, models.UpdateHostTagsRequest{Tags: []string{"team:web"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	// New reports do not change the version
+	report, _ := json.Marshal(models.IngestRequest{
+		Meta: models.ReportMeta{HostID: probeHostUp, Hostname: "web-1"},
+		Data: json.RawMessage(`{"system":{}}`),
+	})
+	w = doIfMatchRequest(r, http.MethodPost, "/ingest", "", json.RawMessage(report))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = doIfMatchRequest(r, http.MethodGet, "/hosts/"+probeHostUp, "", nil)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	tags, err := mockStore.GetHostTags(probeHostUp, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team:web"}, tags)
+}
+
+func TestHandlers_UserRole_IfMatch(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	user, _ := mockStore.CreateUser("user", "user@example.com", "hash", org.ID, "viewer")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.PUT("/users/:user_id/role", h.UpdateUserRole)
+	r.DELETE("/users/:user_id", h.DeleteUser)
+
+	w := doIfMatchRequest(r, http.MethodPut, "/users/"+user.ID+"/role", `"1"`, models.UpdateUserRoleRequest{Role: "editor"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var updated models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, int64(2), updated.Version)
+
+	// A concurrent change made with the same ETag is rejected
+	w = doIfMatchRequest(r, http.MethodPut, "/users/"+user.ID+"/role", `"1"`, models.UpdateUserRoleRequest{Role: "admin"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doIfMatchRequest(r, http.MethodDelete, "/users/"+user.ID, `"1"`, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	stored, err := mockStore.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "editor", stored.Role)
+
+	w = doIfMatchRequest(r, http.MethodDelete, "/users/"+user.ID, `"2"`, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/acl"
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// hostEventPage reads the after, limit, and include_payload query parameters
+// Returns false after writing a 400 response if they are invalid
+func hostEventPage(c *gin.Context) (afterID int64, limit int, includeReports bool, ok bool) {
+	if after := c.Query("after"); after != "" {
+		parsed, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || parsed < 0 {
+			_ = c.Error(apierror.Validation("after must be a non-negative event ID"))
+			return 0, 0, false, false
+		}
+		afterID = parsed
+	}
+	limit = storage.DefaultHostEventLimit
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > storage.MaxHostEventLimit {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(storage.MaxHostEventLimit)))
+			return 0, 0, false, false
+		}
+		limit = parsed
+	}
+	includeReports = c.Query("include_payload") == "true"
+	return afterID, limit, includeReports, true
+}
+
+// eventsResponse builds the paged response; next_after continues after the last event read
+func eventsResponse(events []*models.HostEvent, read []*models.HostEvent, afterID int64) gin.H {
+	nextAfter := afterID
+	if len(read) > 0 {
+		nextAfter = read[len(read)-1].ID
+	}
+	return gin.H{
+		"events":     events,
+		"next_after": nextAfter,
+	}
+}
+
+// ListHostEvents returns the organization's host activity feed
+// @Summary     List host events
+// @Description Returns the append-only stream of host mutations (ingested, updated, tagged, deleted, restored) in the authenticated user's organization, oldest first.
+// @Description Page with after=<next_after>. Report payloads are omitted unless include_payload=true. Users with a tag-based host access policy only see events for hosts they can currently see, so a page may hold fewer than limit events.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       after            query     int     false  "Return events with an ID greater than this"
+// @Param       limit            query     int     false  "Maximum number of events to read (default 100, max 1000)"
+// @Param       host_id          query     string  false  "Only events for this host"
+// @Param       include_payload  query     bool    false  "Include full report payloads"
+// @Success     200  {object}  map[string]interface{}  "Events and the next_after cursor"
+// @Failure     400  {object}  map[string]string       "Invalid paging parameters"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/events [get]
+func (h *Handlers) ListHostEvents(c *gin.Context) {
+	h.listHostEvents(c, c.Query("host_id"))
+}
+
+// GetHostEvents returns the event history of a single host
+// @Summary     Get host events
+// @Description Returns the event history of a host, oldest first, including events from before it was deleted. Paging works as for GET /api/v1/events.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id          path      string  true   "Host ID (UUID)"
+// @Param       after            query     int     false  "Return events with an ID greater than this"
+// @Param       limit            query     int     false  "Maximum number of events to read (default 100, max 1000)"
+// @Param       include_payload  query     bool    false  "Include full report payloads"
+// @Success     200  {object}  map[string]interface{}  "Events and the next_after cursor"
+// @Failure     400  {object}  map[string]string       "Invalid paging parameters"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/events [get]
+func (h *Handlers) GetHostEvents(c *gin.Context) {
+	h.listHostEvents(c, c.Param("host_id"))
+}
+
+func (h *Handlers) listHostEvents(c *gin.Context, hostID string) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	afterID, limit, includeReports, ok := hostEventPage(c)
+	if !ok {
+		return
+	}
+
+	read, err := h.store(c).ListHostEvents(orgID, hostID, afterID, limit, includeReports)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host events", err))
+		return
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host events", err))
+		return
+	}
+	events, err := visibleHostEvents(h.store(c), orgID, policy, read)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, eventsResponse(events, read, afterID))
+}
+
+// visibleHostEvents drops the events of hosts a restricted user cannot currently see
+func visibleHostEvents(store storage.Storage, orgID string, policy *acl.Policy, read []*models.HostEvent) ([]*models.HostEvent, error) {
+	if !policy.Restricted() || len(read) == 0 {
+		return read, nil
+	}
+	hosts, err := store.ListHosts(orgID, true)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[string]bool)
+	for _, host := range policy.FilterHosts(hosts) {
+		visible[host.HostID] = true
+	}
+	events := []*models.HostEvent{}
+	for _, event := range read {
+		if visible[event.HostID] {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Batching window of event streams
+const (
+	defaultEventStreamWindow = time.Second
+	minEventStreamWindow     = 100 * time.Millisecond
+	maxEventStreamWindow     = 30 * time.Second
+)
+
+// eventStreamKeepAlive is how long a stream may go without writing before a comment
+// is sent, so proxies do not close it as idle
+const eventStreamKeepAlive = 15 * time.Second
+
+// StreamHostEvents streams the organization's host activity feed as Server-Sent Events
+// @Summary     Stream host events
+// @Description Streams the host events of the authenticated user's organization as Server-Sent Events, with the event ID as id, the event type as event, and the event as JSON data. New events are read once per window and sent together, then flushed.
+// @Description The stream starts after the Last-Event-ID header, so a reconnecting EventSource resumes without missing events, or after the after parameter; without either it starts with the next new event. Report payloads are omitted unless include_payload=true. Clients that accept gzip get a gzip-compressed stream, flushed after every batch. A comment is sent when the stream has been idle for 15 seconds. Users with a tag-based host access policy only see events for hosts they can currently see.
+// @Tags        Hosts
+// @Produce     text/event-stream
+// @Security    ApiKeyAuth
+// @Param       Last-Event-ID    header    int     false  "Resume after this event ID"
+// @Param       after            query     int     false  "Start after this event ID, when Last-Event-ID is not sent"
+// @Param       host_id          query     string  false  "Only events for this host"
+// @Param       include_payload  query     bool    false  "Include full report payloads"
+// @Param       window           query     string  false  "Batching window, e.g. 500ms (default 1s, between 100ms and 30s)"
+// @Success     200  {string}  string             "Event stream"
+// @Failure     400  {object}  map[string]string  "Invalid cursor or window"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/events/stream [get]
+func (h *Handlers) StreamHostEvents(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	cursor := c.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = c.Query("after")
+	}
+	var afterID int64
+	if cursor != "" {
+		parsed, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || parsed < 0 {
+			_ = c.Error(apierror.Validation("Last-Event-ID and after must be a non-negative event ID"))
+			return
+		}
+		afterID = parsed
+	}
+	window := defaultEventStreamWindow
+	if w := c.Query("window"); w != "" {
+		parsed, err := time.ParseDuration(w)
+		if err != nil || parsed < minEventStreamWindow || parsed > maxEventStreamWindow {
+			_ = c.Error(apierror.Validation("window must be a duration between " + minEventStreamWindow.String() + " and " + maxEventStreamWindow.String()))
+			return
+		}
+		window = parsed
+	}
+	hostID := c.Query("host_id")
+	includeReports := c.Query("include_payload") == "true"
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to stream host events", err))
+		return
+	}
+	// The stream is open for as long as the client listens, so it runs on the pool
+	// (see middleware.QueryConnection) rather than holding a connection
+	store := h.storage
+	if cursor == "" {
+		if afterID, err = store.LastHostEventID(orgID); err != nil {
+			_ = c.Error(apierror.Internal("failed to stream host events", err))
+			return
+		}
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	header.Add("Vary", "Accept-Encoding")
+	var out io.Writer = c.Writer
+	flush := c.Writer.Flush
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		header.Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		out = gz
+		flush = func() {
+			// Flushing ends the gzip block, so the client can decompress the batch now
+			_ = gz.Flush()
+			c.Writer.Flush()
+		}
+	}
+	c.Status(http.StatusOK)
+	if _, err := io.WriteString(out, ": stream of host events\n\n"); err != nil {
+		return
+	}
+	flush()
+
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	idle := time.Duration(0)
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Send everything that arrived during the window, however many pages it takes
+		sent := 0
+		for {
+			read, err := store.ListHostEvents(orgID, hostID, afterID, storage.MaxHostEventLimit, includeReports)
+			if err == nil {
+				var events []*models.HostEvent
+				if events, err = visibleHostEvents(store, orgID, policy, read); err == nil {
+					err = writeHostEvents(out, events)
+					sent += len(events)
+				}
+			}
+			if err != nil {
+				// Ending the stream makes the client reconnect with the last ID it received
+				logger.FromContext(c).Err(err).Msg("Failed to stream host events")
+				return
+			}
+			if len(read) > 0 {
+				afterID = read[len(read)-1].ID
+			}
+			if len(read) < storage.MaxHostEventLimit {
+				break
+			}
+		}
+
+		if sent == 0 {
+			if idle += window; idle < eventStreamKeepAlive {
+				continue
+			}
+			if _, err := io.WriteString(out, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		idle = 0
+		flush()
+	}
+}
+
+// writeHostEvents writes events as Server-Sent Events
+func writeHostEvents(w io.Writer, events []*models.HostEvent) error {
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		// gzip;q=0 refuses it
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// RestoreHost brings back a deleted host
+// @Summary     Restore deleted host
+// @Description Restores a deleted host in the authenticated user's organization with the report and tags it had when it was deleted, recording a restored event. Requires editor or admin role; users restricted by a tag policy cannot restore hosts.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true  "Host ID (UUID)"
+// @Success     200  {object}  map[string]interface{}  "Restored event"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     404  {object}  map[string]string       "Host has no history"
+// @Failure     409  {object}  map[string]string       "Host is not deleted"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/restore [post]
+func (h *Handlers) RestoreHost(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to restore host", err))
+		return
+	}
+	if policy.Restricted() {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	event, err := h.store(c).RestoreHost(hostID, orgID, middleware.GetUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("host not found"))
+		case errors.Is(err, storage.ErrHostNotDeleted):
+			_ = c.Error(apierror.Conflict("host is not deleted"))
+		default:
+			logger.FromContext(c).
+				Err(err).
+				Str("host_id", hostID).
+				Msg("Failed to restore host")
+			_ = c.Error(apierror.Internal("failed to restore host", err))
+		}
+		return
+	}
+
+	// The full report is available from GET /hosts/:host_id
+	if event.Payload != nil {
+		payload := *event.Payload
+		payload.Report = nil
+		event.Payload = &payload
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "restored",
+		"event":  event,
+	})
+}
+
+// ArchiveHost hides a host without deleting it
+// @Summary     Archive host
+// @Description Archives a host in the authenticated user's organization, recording an archived event. Archived hosts keep their reports, tags, and history but are left out of the host list (unless include_archived=true), facets, fleet comparisons, probes, remote-write metrics, and findings; reports from them are still accepted. Requires editor or admin role.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true  "Host ID (UUID)"
+// @Success     200  {object}  map[string]interface{}  "Archived event"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     404  {object}  map[string]string       "Host not found"
+// @Failure     409  {object}  map[string]string       "Host is already archived"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/archive [post]
+func (h *Handlers) ArchiveHost(c *gin.Context) {
+	h.setHostArchived(c, true)
+}
+
+// UnarchiveHost shows an archived host again
+// @Summary     Unarchive host
+// @Description Returns an archived host in the authenticated user's organization to the default host list, facets, and findings, recording an unarchived event. Requires editor or admin role.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true  "Host ID (UUID)"
+// @Success     200  {object}  map[string]interface{}  "Unarchived event"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     404  {object}  map[string]string       "Host not found"
+// @Failure     409  {object}  map[string]string       "Host is not archived"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/unarchive [post]
+func (h *Handlers) UnarchiveHost(c *gin.Context) {
+	h.setHostArchived(c, false)
+}
+
+// setHostArchived archives or unarchives the host named by the host_id path parameter
+func (h *Handlers) setHostArchived(c *gin.Context, archive bool) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	action, status := "unarchive", "unarchived"
+	if archive {
+		action, status = "archive", "archived"
+	}
+
+	// Editors restricted by a tag policy cannot archive hosts they cannot see
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to "+action+" host", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	var event *models.HostEvent
+	if archive {
+		event, err = h.store(c).ArchiveHost(hostID, orgID, middleware.GetUserID(c))
+	} else {
+		event, err = h.store(c).UnarchiveHost(hostID, orgID, middleware.GetUserID(c))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("host not found"))
+		case errors.Is(err, storage.ErrHostArchived), errors.Is(err, storage.ErrHostNotArchived):
+			_ = c.Error(apierror.Conflict(err.Error()))
+		default:
+			logger.FromContext(c).
+				Err(err).
+				Str("host_id", hostID).
+				Msg("Failed to " + action + " host")
+			_ = c.Error(apierror.Internal("failed to "+action+" host", err))
+		}
+		return
+	}
+
+	logger.FromContext(c).Str("host_id", hostID).Msg("Host " + status)
+	c.JSON(http.StatusOK, gin.H{
+		"status": status,
+		"event":  event,
+	})
+}
+
+// ReplayHostEvents rebuilds the organization's hosts from the event stream
+// @Summary     Replay host events
+// @Description Rebuilds the hosts and host tags of the authenticated user's organization by replaying the host event stream. Hosts are replayed one at a time, so ingestion keeps working. Requires admin role.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Number of hosts replayed"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Insufficient role"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/events/replay [post]
+func (h *Handlers) ReplayHostEvents(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	replayed, err := h.store(c).ReplayHostEvents(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to replay host events", err))
+		return
+	}
+
+	logger.FromContext(c).Int("hosts", replayed).Msg("Replayed host events")
+	c.JSON(http.StatusOK, gin.H{"hosts_replayed": replayed})
+}
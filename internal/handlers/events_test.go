@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_HostEvents(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:db"}))
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	save := func(hostID, hostname string) {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID))
+	}
+	save(webID, "web-1")
+	save(webID, "web-1.example.com")
+	save(dbID, "db-1")
+	require.NoError(t, mockStore.SetHostTags(webID, org.ID, []string{"team:web"}, admin.ID, 0))
+	require.NoError(t, mockStore.SetHostTags(dbID, org.ID, []string{"team:db"}, admin.ID, 0))
+
+	do := func(user *models.User, method, path string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/events", h.ListHostEvents)
+		r.GET("/hosts/:host_id/events", h.GetHostEvents)
+		r.POST("/hosts/:host_id/restore", h.RestoreHost)
+		r.POST("/events/replay", h.ReplayHostEvents)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	type page struct {
+		Events    []models.HostEvent `json:"events"`
+		NextAfter int64              `json:"next_after"`
+	}
+	list := func(user *models.User, path string) page {
+		w := do(user, http.MethodGet, path)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var p page
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		return p
+	}
+
+	t.Run("feed pages in order", func(t *testing.T) {
+		first := list(admin, "/events?limit=3")
+		require.Len(t, first.Events, 3)
+		assert.Equal(t, models.HostEventIngested, first.Events[0].Type)
+		assert.Equal(t, models.HostEventUpdated, first.Events[1].Type)
+		assert.Nil(t, first.Events[0].Payload.Report, "reports are omitted by default")
+
+		rest := list(admin, "/events?after="+strconv.FormatInt(first.NextAfter, 10))
+		require.Len(t, rest.Events, 2)
+		assert.Equal(t, models.HostEventTagged, rest.Events[0].Type)
+		assert.Equal(t, []string{"team:web"}, rest.Events[0].Payload.Tags)
+	})
+
+	t.Run("payloads on request", func(t *testing.T) {
+		p := list(admin, "/hosts/"+webID+"/events?include_payload=true")
+		require.Len(t, p.Events, 3)
+		require.NotNil(t, p.Events[1].Payload.Report)
+		assert.Equal(t, "web-1.example.com", p.Events[1].Payload.Report.Meta.Hostname)
+	})
+
+	t.Run("restricted users only see visible hosts", func(t *testing.T) {
+		p := list(viewer, "/events")
+		require.Len(t, p.Events, 2)
+		for _, event := range p.Events {
+			assert.Equal(t, dbID, event.HostID)
+		}
+		assert.Equal(t, int64(5), p.NextAfter)
+	})
+
+	t.Run("invalid paging", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(admin, http.MethodGet, "/events?limit=0").Code)
+		assert.Equal(t, http.StatusBadRequest, do(admin, http.MethodGet, "/events?after=x").Code)
+	})
+
+	t.Run("restore deleted host", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, do(admin, http.MethodPost, "/hosts/"+webID+"/restore").Code)
+
+		require.NoError(t, mockStore.DeleteHost(webID, org.ID, admin.ID, nil))
+		_, err := mockStore.GetHost(webID, org.ID)
+		require.ErrorIs(t, err, storage.ErrNotFound)
+
+		w := do(admin, http.MethodPost, "/hosts/"+webID+"/restore")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		report, err := mockStore.GetHost(webID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "web-1.example.com", report.Meta.Hostname)
+		tags, err := mockStore.GetHostTags(webID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team:web"}, tags)
+
+		events := list(admin, "/hosts/"+webID+"/events").Events
+		require.Len(t, events, 5)
+		assert.Equal(t, models.HostEventDeleted, events[3].Type)
+		assert.Equal(t, models.HostEventRestored, events[4].Type)
+		assert.Equal(t, admin.ID, events[4].ActorUserID)
+
+		assert.Equal(t, http.StatusNotFound, do(admin, http.MethodPost, "/hosts/00000000-0000-0000-0000-000000000099/restore").Code)
+		assert.Equal(t, http.StatusNotFound, do(viewer, http.MethodPost, "/hosts/"+webID+"/restore").Code)
+	})
+
+	t.Run("replay rebuilds hosts", func(t *testing.T) {
+		w := do(admin, http.MethodPost, "/events/replay")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"hosts_replayed": 2}`, w.Body.String())
+
+		report, err := mockStore.GetHost(webID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "web-1.example.com", report.Meta.Hostname)
+		tags, err := mockStore.GetHostTags(dbID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team:db"}, tags)
+
+		// Replaying is not recorded as activity
+		assert.Len(t, list(admin, "/events").Events, 7)
+	})
+}
+
+func TestHandlers_StreamHostEvents(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:db"}))
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	save := func(hostID, hostname string) {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID))
+	}
+	save(webID, "web-1")
+	save(dbID, "db-1")
+	require.NoError(t, mockStore.SetHostTags(webID, org.ID, []string{"team:web"}, admin.ID, 0))
+	require.NoError(t, mockStore.SetHostTags(dbID, org.ID, []string{"team:db"}, admin.ID, 0))
+	events, err := mockStore.ListHostEvents(org.ID, "", 0, 100, false)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	// stream listens for 300ms and returns the response
+	stream := func(user *models.User, path string, header http.Header) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/events/stream", h.StreamHostEvents)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		for name, values := range header {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// ids returns the IDs of the events in a stream
+	ids := func(body string) []int64 {
+		var ids []int64
+		for _, line := range strings.Split(body, "\n") {
+			if id, ok := strings.CutPrefix(line, "id: "); ok {
+				parsed, err := strconv.ParseInt(id, 10, 64)
+				require.NoError(t, err)
+				ids = append(ids, parsed)
+			}
+		}
+		return ids
+	}
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		w := stream(admin, "/events/stream?window=100ms", http.Header{"Last-Event-ID": {strconv.FormatInt(events[0].ID, 10)}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, []int64{events[1].ID, events[2].ID, events[3].ID}, ids(w.Body.String()))
+		assert.Contains(t, w.Body.String(), "id: "+strconv.FormatInt(events[1].ID, 10)+"\nevent: ingested\ndata: {")
+	})
+
+	t.Run("starts with new events without a cursor", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			save(webID, "web-1.example.com")
+		}()
+		w := stream(admin, "/events/stream?window=100ms", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		got := ids(w.Body.String())
+		require.Len(t, got, 1)
+		assert.Greater(t, got[0], events[3].ID)
+	})
+
+	t.Run("restricted users see their hosts", func(t *testing.T) {
+		w := stream(viewer, "/events/stream?window=100ms&after=0", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, []int64{events[1].ID, events[3].ID}, ids(w.Body.String()))
+	})
+
+	t.Run("compresses for clients accepting gzip", func(t *testing.T) {
+		w := stream(admin, "/events/stream?window=100ms&after=0", http.Header{"Accept-Encoding": {"br;q=1.0, gzip;q=0.8"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Len(t, ids(string(body)), 5)
+
+		w = stream(admin, "/events/stream?window=100ms&after=0", http.Header{"Accept-Encoding": {"gzip;q=0"}})
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Len(t, ids(w.Body.String()), 5)
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		for _, path := range []string{"/events/stream?window=10ms", "/events/stream?window=soon", "/events/stream?after=-1"} {
+			w := stream(admin, path, nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		}
+		w := stream(admin, "/events/stream", http.Header{"Last-Event-ID": {"abc"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandlers_DeleteHostReason(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	save := func() {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: "web-1"},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID))
+	}
+
+	do := func(h *Handlers, method, path string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", admin)
+			c.Set("user_id", admin.ID)
+			c.Set("org_id", org.ID)
+		})
+		r.DELETE("/hosts/:host_id", h.DeleteHost)
+		r.GET("/events", h.ListHostEvents)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	h := New(mockStore)
+	save()
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodDelete, "/hosts/"+hostID+"?reason=bored").Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodDelete, "/hosts/"+hostID+"?reason=other").Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodDelete, "/hosts/"+hostID+"?note=oops").Code)
+	require.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, "/hosts/"+hostID+"?reason=reimaged&note=Fedora+42").Code)
+
+	// The reason is reported on the deleted event in the activity feed
+	w := do(h, http.MethodGet, "/events")
+	require.Equal(t, http.StatusOK, w.Code)
+	var feed struct {
+		Events []*models.HostEvent `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	deleted := feed.Events[len(feed.Events)-1]
+	assert.Equal(t, models.HostEventDeleted, deleted.Type)
+	require.NotNil(t, deleted.Payload)
+	assert.Equal(t, &models.HostDeletion{Reason: models.HostDeletionReimaged, Note: "Fedora 42"}, deleted.Payload.Deletion)
+
+	// Without a reason the deleted event has no payload, unless one is required
+	save()
+	assert.Equal(t, http.StatusBadRequest, do(New(mockStore, WithDeletionReasonRequired()), http.MethodDelete, "/hosts/"+hostID).Code)
+	assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, "/hosts/"+hostID).Code)
+}
+
+func TestHandlers_ArchiveHost(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithActions(actions.NewDispatcher(mockStore)))
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", org.ID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.GET("/hosts", h.ListHosts)
+	r.GET("/hosts/facets", h.GetHostFacets)
+	r.POST("/hosts/:host_id/archive", h.ArchiveHost)
+	r.POST("/hosts/:host_id/unarchive", h.UnarchiveHost)
+	r.POST("/actions", h.CreateAction)
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	ingest := func(hostID, hostname string, errs []string) {
+		w := doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+			Meta:   models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:   json.RawMessage(`{}`),
+			Errors: errs,
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	ingest(webID, "web-1", nil)
+	ingest(dbID, "db-1", nil)
+
+	list := func(path string) []models.HostSummary {
+		w := doProbeRequest(r, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Hosts []models.HostSummary `json:"hosts"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Hosts
+	}
+
+	w := doProbeRequest(r, http.MethodPost, "/hosts/"+webID+"/archive", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, doProbeRequest(r, http.MethodPost, "/hosts/"+webID+"/archive", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodPost, "/hosts/00000000-0000-0000-0000-000000000009/archive", nil).Code)
+
+	hosts := list("/hosts")
+	require.Len(t, hosts, 1)
+	assert.Equal(t, dbID, hosts[0].HostID)
+
+	hosts = list("/hosts?include_archived=true")
+	require.Len(t, hosts, 2)
+	for _, host := range hosts {
+		assert.Equal(t, host.HostID == webID, host.ArchivedAt != nil, host.HostID)
+	}
+	assert.Len(t, list("/hosts?q=hostname:web-1&include_archived=true"), 1)
+	assert.Empty(t, list("/hosts?q=hostname:web-1"))
+
+	w = doProbeRequest(r, http.MethodGet, "/hosts/facets", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var facets models.HostFacets
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &facets))
+	assert.Equal(t, int64(1), facets.Total)
+
+	// Archived hosts still report, but their findings do not fire actions
+	w = doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:     "Report errors",
+		Triggers: []string{models.FindingReportErrors},
+		URL:      "https://tickets.example.com/new",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+	ingest(webID, "web-1", []string{"packages: rpm database locked"})
+	runs, err := mockStore.ListActionRuns(action.ID, org.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	w = doProbeRequest(r, http.MethodPost, "/hosts/"+webID+"/unarchive", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, doProbeRequest(r, http.MethodPost, "/hosts/"+webID+"/unarchive", nil).Code)
+	assert.Len(t, list("/hosts"), 2)
+
+	ingest(webID, "web-1", []string{"packages: rpm database locked"})
+	runs, err = mockStore.ListActionRuns(action.ID, org.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
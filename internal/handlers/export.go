@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/acl"
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/workpool"
+)
+
+// DefaultExportWorkers is how many reports an export encodes at a time unless configured
+const DefaultExportWorkers = 4
+
+// hostCSVHeader is the header row of a CSV host export
+var hostCSVHeader = []string{
+	"host_id", "hostname", "name", "display_name", "os_name", "os_version", "status",
+	"last_seen", "collected_at", "archived_at", "stale_since", "tags", "health", "sections",
+	"uploaded_by_user_id",
+}
+
+// ExportHosts streams every host in the organization as JSON Lines or CSV
+// @Summary     Export hosts
+// @Description Streams every host in the authenticated user's organization, ordered by host ID. format=ndjson (the default) writes one JSON object per line (JSON Lines); format=csv writes one row per host with a header row.
+// @Description view=full (the default for ndjson) exports each host's complete collection report; view=summary (the default for csv, and the only view CSV supports) exports the host summary listed by GET /api/v1/hosts. In CSV, tags and sections are separated by semicolons and health is the health status.
+// @Description Hosts are read from the database in batches and written as each batch is ready, so the export does not load the whole fleet into memory.
+// @Description An interrupted export can be resumed by passing the host_id of the last line or row received as after.
+// @Description Archived hosts are included.
+// @Description Users with a tag-based host access policy only receive hosts carrying at least one of their allowed tags.
+// @Tags        Hosts
+// @Produce     application/x-ndjson
+// @Produce     text/csv
+// @Security    ApiKeyAuth
+// @Param       format  query     string             false  "ndjson or csv"  Enums(ndjson, csv)
+// @Param       view    query     string             false  "full or summary; defaults to full for ndjson and summary for csv"  Enums(full, summary)
+// @Param       after   query     string             false  "Only export hosts with a host ID after this one"
+// @Success     200     {object}  models.Report      "One report, or host summary, per line"
+// @Failure     400     {object}  map[string]string  "Invalid format, view, or after"
+// @Failure     401     {object}  map[string]string  "Unauthorized"
+// @Failure     500     {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/export [get]
+func (h *Handlers) ExportHosts(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	format := c.DefaultQuery("format", models.HostExportFormatNDJSON)
+	if format != models.HostExportFormatNDJSON && format != models.HostExportFormatCSV {
+		_ = c.Error(apierror.Validation("format must be ndjson or csv"))
+		return
+	}
+	view := c.Query("view")
+	switch {
+	case view == "" && format == models.HostExportFormatCSV:
+		view = models.HostExportViewSummary
+	case view == "":
+		view = models.HostExportViewFull
+	case view != models.HostExportViewFull && view != models.HostExportViewSummary:
+		_ = c.Error(apierror.Validation("view must be full or summary"))
+		return
+	}
+	if format == models.HostExportFormatCSV && view == models.HostExportViewFull {
+		_ = c.Error(apierror.Validation("csv exports only support the summary view"))
+		return
+	}
+
+	after := c.Query("after")
+	if after != "" {
+		if _, err := uuid.Parse(after); err != nil {
+			_ = c.Error(apierror.Validation("after must be a host ID"))
+			return
+		}
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to export hosts", err))
+		return
+	}
+
+	if format == models.HostExportFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="hosts.csv"`)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="hosts.jsonl"`)
+	}
+
+	var written int
+	if view == models.HostExportViewFull {
+		written, err = h.exportReports(c, orgID, after, policy)
+	} else {
+		written, err = h.exportSummaries(c, orgID, after, format, policy)
+	}
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("format", format).
+			Str("view", view).
+			Int("hosts_written", written).
+			Msg("Failed to export hosts")
+		// Once streaming has started the status line is already sent; the
+		// truncated body is the only signal left to the client
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			_ = c.Error(apierror.Internal("failed to export hosts", err))
+		}
+		return
+	}
+	c.Writer.Flush()
+}
+
+// exportReports writes the full report of each visible host as JSON Lines
+func (h *Handlers) exportReports(c *gin.Context, orgID, after string, policy *acl.Policy) (int, error) {
+	allowed, err := h.policyHostIDs(c, orgID, policy)
+	if err != nil {
+		return 0, err
+	}
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	written := 0
+	err = h.store(c).IterateHostBatches(ctx, orgID, after, h.exportBatchSize, func(batch []*models.Report) error {
+		lines := make([]*exportLine, 0, len(batch))
+		for _, report := range batch {
+			if allowed == nil || allowed[report.Meta.HostID] {
+				lines = append(lines, &exportLine{report: report})
+			}
+		}
+		err := workpool.Run(ctx, lines, workpool.Options{Workers: h.exportWorkers}, func(ctx context.Context, line *exportLine) error {
+			data, err := json.Marshal(line.report)
+			line.data = append(data, '\n')
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Lines are encoded concurrently but written in host ID order, so the last
+		// line received is always a valid point to resume from
+		for _, line := range lines {
+			if _, err := c.Writer.Write(line.data); err != nil {
+				return err
+			}
+			written++
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	return written, err
+}
+
+// exportSummaries writes the summary of each visible host as JSON Lines or CSV rows
+func (h *Handlers) exportSummaries(c *gin.Context, orgID, after, format string, policy *acl.Policy) (int, error) {
+	c.Status(http.StatusOK)
+
+	var cw *csv.Writer
+	encoder := json.NewEncoder(c.Writer)
+	if format == models.HostExportFormatCSV {
+		cw = csv.NewWriter(c.Writer)
+		if err := cw.Write(hostCSVHeader); err != nil {
+			return 0, err
+		}
+	}
+
+	written := 0
+	err := h.store(c).IterateHostSummaryBatches(c.Request.Context(), orgID, after, h.exportBatchSize, func(batch []*models.HostSummary) error {
+		for _, host := range policy.FilterHosts(batch) {
+			if cw != nil {
+				if err := cw.Write(hostCSVRow(host)); err != nil {
+					return err
+				}
+			} else if err := encoder.Encode(host); err != nil {
+				return err
+			}
+			written++
+		}
+		if cw != nil {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	return written, err
+}
+
+// hostCSVRow returns the CSV row of a host, in the columns of hostCSVHeader
+func hostCSVRow(host *models.HostSummary) []string {
+	health := ""
+	if host.Health != nil {
+		health = host.Health.Status
+	}
+	return []string{
+		host.HostID, host.Hostname, host.Name, host.DisplayName, host.OSName, host.OSVersion, host.Status,
+		csvTime(&host.LastSeen), csvTime(host.CollectedAt), csvTime(host.ArchivedAt), csvTime(host.StaleSince),
+		strings.Join(host.Tags, ";"), health, strings.Join(host.Sections, ";"),
+		host.UploadedByUserID,
+	}
+}
+
+// csvTime formats an optional time as RFC 3339 UTC, empty if unset
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// exportLine is a report and its encoded JSON Lines line
+type exportLine struct {
+	report *models.Report
+	data   []byte
+}
+
+// visibleHostIDs returns the set of host IDs the authenticated user may see,
+// or nil if the user is not restricted by a tag policy
+func (h *Handlers) visibleHostIDs(c *gin.Context, orgID string) (map[string]bool, error) {
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		return nil, err
+	}
+	return h.policyHostIDs(c, orgID, policy)
+}
+
+// policyHostIDs returns the set of host IDs a policy allows, or nil if it is unrestricted
+func (h *Handlers) policyHostIDs(c *gin.Context, orgID string, policy *acl.Policy) (map[string]bool, error) {
+	if !policy.Restricted() {
+		return nil, nil
+	}
+
+	hosts, err := h.store(c).ListHosts(orgID, true)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range policy.FilterHosts(hosts) {
+		allowed[host.HostID] = true
+	}
+	return allowed, nil
+}
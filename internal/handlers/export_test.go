@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_ExportHosts(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithExportConcurrency(2, 2))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	hostIDs := []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000002",
+		"00000000-0000-0000-0000-000000000003",
+	}
+	for _, hostID := range hostIDs {
+		mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(`{"system":{}}`),
+		}, org.ID, admin.ID)
+	}
+	require.NoError(t, mockStore.SetHostTags(hostIDs[0], org.ID, []string{"team:web"}, "", 0))
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:web"}))
+
+	export := func(user *models.User, query string) []models.Report {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/hosts/export", h.ExportHosts)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts/export"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		var reports []models.Report
+		scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+		for scanner.Scan() {
+			var report models.Report
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &report))
+			reports = append(reports, report)
+		}
+		return reports
+	}
+
+	t.Run("streams every host in host ID order", func(t *testing.T) {
+		reports := export(admin, "")
+		require.Len(t, reports, len(hostIDs))
+		for i, report := range reports {
+			assert.Equal(t, hostIDs[i], report.Meta.HostID)
+		}
+	})
+
+	t.Run("resumes after a host", func(t *testing.T) {
+		reports := export(admin, "?after="+hostIDs[1])
+		require.Len(t, reports, 1)
+		assert.Equal(t, hostIDs[2], reports[0].Meta.HostID)
+	})
+
+	t.Run("rejects an invalid resume point", func(t *testing.T) {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", admin)
+			c.Set("org_id", admin.OrgID)
+		})
+		r.GET("/hosts/export", h.ExportHosts)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts/export?after=host-1", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("respects host access policy", func(t *testing.T) {
+		reports := export(viewer, "")
+		require.Len(t, reports, 1)
+		assert.Equal(t, hostIDs[0], reports[0].Meta.HostID)
+	})
+
+	get := func(user *models.User, query string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/hosts/export", h.ExportHosts)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts/export"+query, nil))
+		return w
+	}
+
+	t.Run("streams host summaries", func(t *testing.T) {
+		w := get(admin, "?view=summary&after="+hostIDs[0])
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		require.Len(t, lines, 2)
+		for i, line := range lines {
+			var host models.HostSummary
+			require.NoError(t, json.Unmarshal([]byte(line), &host))
+			assert.Equal(t, hostIDs[i+1], host.HostID)
+			assert.Equal(t, "active", host.Status)
+		}
+	})
+
+	t.Run("streams csv", func(t *testing.T) {
+		w := get(admin, "?format=csv")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="hosts.csv"`, w.Header().Get("Content-Disposition"))
+
+		rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, len(hostIDs)+1)
+		assert.Equal(t, hostCSVHeader, rows[0])
+		assert.Equal(t, hostIDs[0], rows[1][0])
+		assert.Equal(t, "host-1", rows[1][1])
+		assert.Equal(t, "team:web", rows[1][11])
+		_, err = time.Parse(time.RFC3339, rows[1][7])
+		assert.NoError(t, err, "last_seen is RFC 3339")
+	})
+
+	t.Run("csv respects host access policy", func(t *testing.T) {
+		w := get(viewer, "?format=csv")
+		require.Equal(t, http.StatusOK, w.Code)
+		rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, hostIDs[0], rows[1][0])
+	})
+
+	t.Run("rejects invalid format and view", func(t *testing.T) {
+		for _, query := range []string{"?format=xml", "?view=everything", "?format=csv&view=full"} {
+			assert.Equal(t, http.StatusBadRequest, get(admin, query).Code, query)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+	"snailbus/internal/storage"
+)
+
+// GetHostFacets returns host counts per OS name, OS version, and tag
+// @Summary     Host facets
+// @Description Returns exact host counts for the authenticated user's organization grouped by OS name, OS version, and tag.
+// @Description Counts are maintained incrementally as reports are ingested and hosts are deleted or re-tagged, so this endpoint does not scan hosts.
+// @Description For users with a tag-based host access policy, counts only include the hosts they can see.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.HostFacets   "Host facet counts"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/facets [get]
+func (h *Handlers) GetHostFacets(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host facets", err))
+		return
+	}
+
+	// Pre-aggregated counters cover the whole organization; restricted users
+	// get counts computed over the hosts they are allowed to see
+	if policy.Restricted() {
+		hosts, err := h.store(c).ListHosts(orgID, false)
+		if err != nil {
+			_ = c.Error(apierror.Internal("failed to retrieve host facets", err))
+			return
+		}
+		c.JSON(http.StatusOK, storage.CountHostFacets(policy.FilterHosts(hosts)))
+		return
+	}
+
+	facets, err := h.store(c).GetHostFacets(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host facets", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, facets)
+}
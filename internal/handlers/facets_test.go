@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_GetHostFacets(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	hosts := []struct {
+		id, os, version, tag string
+	}{
+		{"00000000-0000-0000-0000-000000000001", "Fedora", "42", "team:web"},
+		{"00000000-0000-0000-0000-000000000002", "Fedora", "41", "team:db"},
+		{"00000000-0000-0000-0000-000000000003", "Debian", "12", "team:web"},
+	}
+	for _, host := range hosts {
+		mockStore.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: host.id},
+			Data:       json.RawMessage(`{"system":{"os":{"name":"` + host.os + `","version":"` + host.version + `"}}}`),
+		}, org.ID, admin.ID)
+		require.NoError(t, mockStore.SetHostTags(host.id, org.ID, []string{host.tag}, admin.ID, 0))
+	}
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:db"}))
+
+	facetsFor := func(user *models.User) models.HostFacets {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/hosts/facets", h.GetHostFacets)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts/facets", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var facets models.HostFacets
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &facets))
+		return facets
+	}
+
+	facets := facetsFor(admin)
+	assert.Equal(t, int64(3), facets.Total)
+	assert.Equal(t, []models.FacetCount{{Value: "Fedora", Count: 2}, {Value: "Debian", Count: 1}}, facets.OSNames)
+	assert.Len(t, facets.OSVersion, 3)
+	assert.Equal(t, models.FacetCount{Value: "team:web", Count: 2}, facets.Tags[0])
+
+	// Restricted users only see counts for their hosts
+	facets = facetsFor(viewer)
+	assert.Equal(t, int64(1), facets.Total)
+	assert.Equal(t, []models.FacetCount{{Value: "Fedora 41", Count: 1}}, facets.OSVersion)
+}
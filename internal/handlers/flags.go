@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// featureFlagNamePattern restricts flag names to lowercase identifiers such as "async-ingest"
+var featureFlagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// featureEnabled reports whether a feature flag is on for the caller's organization
+func (h *Handlers) featureEnabled(c *gin.Context, name string) bool {
+	return h.features.Enabled(middleware.GetOrgID(c), name)
+}
+
+// ListFeatureFlags returns every feature flag
+// @Summary     List feature flags
+// @Description Returns every feature flag with its default and per-organization overrides. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Feature flags with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/admin/flags [get]
+func (h *Handlers) ListFeatureFlags(c *gin.Context) {
+	flags, err := h.store(c).ListFeatureFlags()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve feature flags", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": flags,
+		"total": len(flags),
+	})
+}
+
+// SetFeatureFlag creates or replaces a feature flag
+// @Summary     Set feature flag
+// @Description Creates a feature flag or replaces its description and default. enabled applies to every organization without an override; existing overrides are kept. Requires system administrator privileges.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name     path      string                        true  "Flag name (lowercase letters, digits, '.', '_', '-')"
+// @Param       request  body      models.SetFeatureFlagRequest  true  "Description and default"
+// @Success     200  {object}  models.FeatureFlag  "Flag"
+// @Failure     400  {object}  map[string]string  "Invalid flag name or request"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "System administrator access required"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/flags/{name} [put]
+func (h *Handlers) SetFeatureFlag(c *gin.Context) {
+	name := c.Param("name")
+	if !featureFlagNamePattern.MatchString(name) {
+		_ = c.Error(apierror.Validation("invalid flag name"))
+		return
+	}
+	var req models.SetFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	flag, err := h.store(c).SetFeatureFlag(name, req.Description, *req.Enabled)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("flag", name).Msg("Failed to set feature flag")
+		_ = c.Error(apierror.Internal("failed to set feature flag", err))
+		return
+	}
+	h.features.Invalidate()
+
+	logger.FromContext(c).Str("flag", name).Bool("enabled", flag.Enabled).Msg("Feature flag set")
+	c.JSON(http.StatusOK, flag)
+}
+
+// DeleteFeatureFlag removes a feature flag
+// @Summary     Delete feature flag
+// @Description Deletes a feature flag and its overrides; checks of a deleted flag report it disabled. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name  path  string  true  "Flag name"
+// @Success     204  "Flag deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "System administrator access required"
+// @Failure     404  {object}  map[string]string  "Flag not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/flags/{name} [delete]
+func (h *Handlers) DeleteFeatureFlag(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.store(c).DeleteFeatureFlag(name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("feature flag not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("flag", name).Msg("Failed to delete feature flag")
+		_ = c.Error(apierror.Internal("failed to delete feature flag", err))
+		return
+	}
+	h.features.Invalidate()
+
+	logger.FromContext(c).Str("flag", name).Msg("Feature flag deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// SetFeatureFlagOverride enables or disables a feature flag for one organization
+// @Summary     Set feature flag for an organization
+// @Description Enables or disables a flag for one organization regardless of the flag's default. Requires system administrator privileges.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name     path      string                                true  "Flag name"
+// @Param       org_id   path      string                                true  "Organization ID"
+// @Param       request  body      models.SetFeatureFlagOverrideRequest  true  "Whether the flag is on for the organization"
+// @Success     204  "Override set"
+// @Failure     400  {object}  map[string]string  "Invalid request"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "System administrator access required"
+// @Failure     404  {object}  map[string]string  "Flag or organization not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/flags/{name}/orgs/{org_id} [put]
+func (h *Handlers) SetFeatureFlagOverride(c *gin.Context) {
+	name := c.Param("name")
+	orgID := c.Param("org_id")
+	var req models.SetFeatureFlagOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	if _, err := h.store(c).GetOrganizationByID(orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("organization not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("org_id", orgID).Msg("Failed to get organization")
+		_ = c.Error(apierror.Internal("failed to set feature flag", err))
+		return
+	}
+
+	if err := h.store(c).SetFeatureFlagOverride(name, orgID, *req.Enabled); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("feature flag not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("flag", name).Msg("Failed to set feature flag override")
+		_ = c.Error(apierror.Internal("failed to set feature flag", err))
+		return
+	}
+	h.features.Invalidate()
+
+	logger.FromContext(c).
+		Str("flag", name).
+		Str("flag_org_id", orgID).
+		Bool("enabled", *req.Enabled).
+		Msg("Feature flag override set")
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteFeatureFlagOverride returns an organization to a feature flag's default
+// @Summary     Remove feature flag override
+// @Description Removes an organization's override so the flag's default applies to it again. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name    path  string  true  "Flag name"
+// @Param       org_id  path  string  true  "Organization ID"
+// @Success     204  "Override removed"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "System administrator access required"
+// @Failure     404  {object}  map[string]string  "Override not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/flags/{name}/orgs/{org_id} [delete]
+func (h *Handlers) DeleteFeatureFlagOverride(c *gin.Context) {
+	name := c.Param("name")
+	orgID := c.Param("org_id")
+	if err := h.store(c).DeleteFeatureFlagOverride(name, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("feature flag override not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("flag", name).Msg("Failed to delete feature flag override")
+		_ = c.Error(apierror.Internal("failed to delete feature flag override", err))
+		return
+	}
+	h.features.Invalidate()
+
+	logger.FromContext(c).Str("flag", name).Str("flag_org_id", orgID).Msg("Feature flag override removed")
+	c.Status(http.StatusNoContent)
+}
+
+// GetOrgFeatureFlags returns the feature flags in effect for the caller's organization
+// @Summary     Get organization feature flags
+// @Description Returns whether each feature flag is on for the authenticated user's organization, so clients can show preview features.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Flag name to enabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/orgs/current/flags [get]
+func (h *Handlers) GetOrgFeatureFlags(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	flags, err := h.features.ForOrg(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve feature flags", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/features"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_FeatureFlags(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	checker := features.NewChecker(mockStore, features.DefaultTTL)
+	h := New(mockStore, WithFeatures(checker))
+
+	canary, _ := mockStore.CreateOrganization("canary")
+	other, _ := mockStore.CreateOrganization("other")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", canary.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", other.ID, "viewer")
+
+	router := func(user *models.User) *gin.Engine {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/admin/flags", h.ListFeatureFlags)
+		r.PUT("/admin/flags/:name", h.SetFeatureFlag)
+		r.DELETE("/admin/flags/:name", h.DeleteFeatureFlag)
+		r.PUT("/admin/flags/:name/orgs/:org_id", h.SetFeatureFlagOverride)
+		r.DELETE("/admin/flags/:name/orgs/:org_id", h.DeleteFeatureFlagOverride)
+		r.GET("/orgs/current/flags", h.GetOrgFeatureFlags)
+		r.GET("/preview", middleware.RequireFeature(checker, "new-search"), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return r
+	}
+	r := router(admin)
+	enabled, disabled := true, false
+
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodPut, "/admin/flags/New%20Search", models.SetFeatureFlagRequest{Enabled: &enabled}).Code)
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodPut, "/admin/flags/new-search", map[string]string{"description": "missing enabled"}).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodPut, "/admin/flags/new-search/orgs/"+canary.ID, models.SetFeatureFlagOverrideRequest{Enabled: &enabled}).Code)
+
+	// Off by default, then rolled out to the canary organization only
+	w := doProbeRequest(r, http.MethodPut, "/admin/flags/new-search", models.SetFeatureFlagRequest{Description: "Search v2", Enabled: &disabled})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/preview", nil).Code)
+
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodPut, "/admin/flags/new-search/orgs/00000000-0000-0000-0000-000000000999", models.SetFeatureFlagOverrideRequest{Enabled: &enabled}).Code)
+	require.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodPut, "/admin/flags/new-search/orgs/"+canary.ID, models.SetFeatureFlagOverrideRequest{Enabled: &enabled}).Code)
+	assert.Equal(t, http.StatusOK, doProbeRequest(r, http.MethodGet, "/preview", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(router(viewer), http.MethodGet, "/preview", nil).Code)
+
+	var effective struct {
+		Flags map[string]bool `json:"flags"`
+	}
+	w = doProbeRequest(router(viewer), http.MethodGet, "/orgs/current/flags", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &effective))
+	assert.Equal(t, map[string]bool{"new-search": false}, effective.Flags)
+
+	var listed struct {
+		Flags []*models.FeatureFlag `json:"flags"`
+		Total int                   `json:"total"`
+	}
+	w = doProbeRequest(r, http.MethodGet, "/admin/flags", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Equal(t, 1, listed.Total)
+	assert.Equal(t, "Search v2", listed.Flags[0].Description)
+	require.Len(t, listed.Flags[0].Orgs, 1)
+	assert.Equal(t, canary.ID, listed.Flags[0].Orgs[0].OrgID)
+
+	// Removing the override returns the canary to the default
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodDelete, "/admin/flags/new-search/orgs/"+canary.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodDelete, "/admin/flags/new-search/orgs/"+canary.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/preview", nil).Code)
+
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodDelete, "/admin/flags/new-search", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodDelete, "/admin/flags/new-search", nil).Code)
+}
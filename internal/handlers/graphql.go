@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/graph"
+)
+
+// GraphQL serves the GraphQL API
+// @Summary     GraphQL query
+// @Description Runs a GraphQL query against the schema in internal/graph/schema.graphqls: hosts with their report history and diffs, host counts, users, and the caller's API keys. Introspection is enabled.
+// @Description Queries are scoped like the REST endpoints they mirror: hosts are those of the authenticated user's organization that their tag policy lets them see, and users require admin role.
+// @Description Errors are returned in the response's errors, with the status the REST endpoint would respond with in extensions.status. A query may select at most 500 fields and compare the reports of at most 50 hosts.
+// @Tags        GraphQL
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      object                  true  "query, and optionally variables and operationName"
+// @Success     200      {object}  map[string]interface{}  "data and errors"
+// @Failure     401      {object}  map[string]string       "Unauthorized"
+// @Failure     422      {object}  map[string]interface{}  "Invalid query"
+// @Router      /api/v1/graphql [post]
+func (h *Handlers) GraphQL(c *gin.Context) {
+	c.Request = c.Request.WithContext(graph.WithGinContext(c.Request.Context(), c))
+	h.graphql.ServeHTTP(c.Writer, c.Request)
+}
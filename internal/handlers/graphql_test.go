@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_GraphQL(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	r := setupTestRouter(h)
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(mockStore))
+	protected.Use(middleware.OrgContextMiddleware(mockStore))
+	protected.POST("/graphql", h.GraphQL)
+
+	// Two organizations, each with a host and a user with an API key
+	keys := map[string]string{}
+	for _, name := range []string{"web", "db"} {
+		org, _ := mockStore.CreateOrganization(name)
+		user, _ := mockStore.CreateUser(name, name+"@example.com", "hash", org.ID, "viewer")
+		key, _, err := storage.GenerateAPIKey(mockStore, user.ID, name, nil)
+		require.NoError(t, err)
+		keys[name] = key
+
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         name,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: name, Hostname: name + ".example.com"},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, user.ID))
+	}
+
+	post := func(method, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/graphql", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	query := `{"query": "{ hosts { hostname } apiKeys { name } }"}`
+
+	// Each caller only sees their organization's hosts and their own keys
+	for name, key := range keys {
+		w := post(http.MethodPost, key, query)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"data": {
+			"hosts": [{"hostname": "`+name+`.example.com"}],
+			"apiKeys": [{"name": "`+name+`"}]
+		}}`, w.Body.String())
+	}
+
+	// The endpoint requires authentication
+	w := post(http.MethodPost, "", query)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Only POST with a JSON body is served
+	w = post(http.MethodGet, keys["web"], "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/graphql", strings.NewReader("query={hosts{hostname}}"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-API-Key", keys["web"])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -2,33 +2,432 @@ package handlers
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v3"
+	"github.com/google/uuid"
 
+	"snailbus/internal/acl"
+	"snailbus/internal/actions"
+	"snailbus/internal/apierror"
+	"snailbus/internal/audit"
+	"snailbus/internal/buildinfo"
+	"snailbus/internal/bundle"
+	"snailbus/internal/checkin"
+	"snailbus/internal/config"
+	"snailbus/internal/errorrate"
+	"snailbus/internal/features"
+	"snailbus/internal/graph"
+	"snailbus/internal/hostlimit"
+	"snailbus/internal/ioc"
+	"snailbus/internal/jobs"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/lifecycle"
 	"snailbus/internal/logger"
 	"snailbus/internal/metrics"
 	"snailbus/internal/middleware"
 	"snailbus/internal/models"
+	"snailbus/internal/payload"
+	"snailbus/internal/probe"
+	"snailbus/internal/receipts"
+	"snailbus/internal/remotewrite"
+	"snailbus/internal/reports"
+	"snailbus/internal/reprocess"
+	"snailbus/internal/retention"
+	"snailbus/internal/search"
 	"snailbus/internal/storage"
+	"snailbus/internal/usage"
+	"snailbus/internal/webhooks"
 )
 
 // Handlers contains HTTP handlers
 type Handlers struct {
-	storage storage.Storage
+	storage     storage.Storage
+	acl         *acl.Evaluator
+	audit       *audit.Recorder
+	features    *features.Checker
+	receipts    *receipts.Signer
+	errorRates  *errorrate.Tracker
+	prober      *probe.Prober          // nil when server-side probing is disabled
+	routes      func() gin.RoutesInfo  // Live route table for spec drift checks
+	routeRoles  *middleware.RouteRoles // Roles of restricted routes, for role-scoped API docs; nil leaves the spec unfiltered
+	jsonLimits  jsonlimit.Limits       // Shape limits for ingested reports
+	maxSkew     time.Duration          // How far in the future a report's timestamp may be; 0 disables the check
+	hostLimits  *hostlimit.Limiter     // Per-host ingest rate limits; nil disables them
+	usage       *usage.Tracker
+	actions     *actions.Dispatcher   // nil when outbound actions are disabled
+	webhooks    *webhooks.Dispatcher  // nil when outbound actions are disabled
+	remoteWrite *remotewrite.Exporter // nil when remote-write export is disabled
+	bundles     *bundle.Importer
+	iocs        *ioc.Cache      // Matchers of organizations' IOC lists, invalidated when a list changes
+	bundleKeys  *bundle.Keyring // Keys offline bundles may be signed with; nil or empty disables bundle import
+	bundleMax   int64           // Limit on the uncompressed contents of a bundle; 0 disables it
+	oauthTTL    time.Duration   // Delegated access token lifetime; 0 when delegated tokens are disabled
+	sessionTTL  time.Duration   // Session access token lifetime; 0 when login issues API keys instead
+	sessionMax  time.Duration   // How long a session can be refreshed for
+	reprocess   *reprocess.Runner
+	config      *config.Config // Included, redacted, in diagnostic bundles; nil leaves it out
+	staleAfter  time.Duration  // Check-in window of hosts no organization schedule covers
+	reports     *reports.Service
+	retention   *retention.Enforcer
+	jobs        *jobs.Scheduler            // Scheduled background jobs, reported by GET /admin/jobs
+	privileges  *models.DatabasePrivileges // Startup check of the database role, reported by /readyz; nil if not checked
+	build       buildinfo.Info             // Build reported by /version and /status
+	lifecycle   *lifecycle.State           // Startup phases and shutdown, reported by /startupz and /readyz; nil if not tracked
+	graphql     *handler.Server            // GraphQL executor behind POST /graphql
+
+	requireDeletionReason bool  // Host deletion must give a reason
+	maxDecompressed       int64 // Limit on gzip-compressed ingest bodies once decompressed
+	reportRetention       int   // Reports kept per host when the organization sets no retention
+
+	exportBatchSize int // Hosts exports read per query
+	exportWorkers   int // Reports exports encode at a time
+
+	impersonationTTL time.Duration // Impersonation token lifetime; 0 when impersonation is disabled
+
+	specJSON []byte // OpenAPI spec embedded at build time; nil if it was not generated
+	specYAML []byte
+	specDir  string // Serves the spec files in this directory instead, for local development
 }
 
 // Auth handlers are in auth.go
+// Host tag and access policy handlers are in tags.go
+// Ingest receipt handlers are in receipts.go
+// Host probe handlers are in probes.go
+// API metadata handlers are in meta.go
+// Organization usage handlers are in usage.go
+// Outbound action and organization secret handlers are in actions.go
+// Prometheus remote-write target handlers are in remote_write.go
+// Fleet statistics handlers are in stats.go
+// Delegated token (OAuth provider) handlers are in oauth.go
+// Feature flag handlers are in flags.go
+// Ingest filter handlers are in ingest_filters.go
+// Reprocess job handlers are in reprocess.go
+// Diagnostic bundle handlers are in diagnostics.go
+// Check-in schedule handlers are in checkins.go
+// Host report history handlers are in host_reports.go
+// Fleet report handlers are in reports.go
+// Offline bundle import handlers are in bundles.go
+// Audit log handlers are in audit.go
+// Batch ingest handlers are in ingest_batch.go
+// Impersonation handlers are in impersonation.go
+// Agent enrollment handlers are in enrollment.go
+// The GraphQL handler is in graphql.go
+
+// Option configures optional Handlers dependencies
+type Option func(*Handlers)
+
+// WithReceiptSigner sets the key used to sign ingest receipts
+func WithReceiptSigner(signer *receipts.Signer) Option {
+	return func(h *Handlers) {
+		h.receipts = signer
+	}
+}
+
+// WithErrorRateTracker sets the tracker behind /readyz and the admin error rate endpoint
+func WithErrorRateTracker(tracker *errorrate.Tracker) Option {
+	return func(h *Handlers) {
+		h.errorRates = tracker
+	}
+}
+
+// WithRouteTable sets the source of the live route table compared against the OpenAPI spec
+func WithRouteTable(routes func() gin.RoutesInfo) Option {
+	return func(h *Handlers) {
+		h.routes = routes
+	}
+}
+
+// WithRouteRoles sets the table of route roles used to annotate and filter the OpenAPI spec
+func WithRouteRoles(roles *middleware.RouteRoles) Option {
+	return func(h *Handlers) {
+		h.routeRoles = roles
+	}
+}
+
+// WithJSONLimits sets the depth, key, and string length limits for ingested reports
+func WithJSONLimits(limits jsonlimit.Limits) Option {
+	return func(h *Handlers) {
+		h.jsonLimits = limits
+	}
+}
+
+// WithMaxDecompressedSize limits gzip-compressed ingest bodies to maxSize bytes once decompressed
+func WithMaxDecompressedSize(maxSize int64) Option {
+	return func(h *Handlers) {
+		h.maxDecompressed = maxSize
+	}
+}
+
+// WithMaxClockSkew rejects reports whose timestamp is more than skew ahead of the server clock
+func WithMaxClockSkew(skew time.Duration) Option {
+	return func(h *Handlers) {
+		h.maxSkew = skew
+	}
+}
+
+// WithHostRateLimits rejects reports from hosts that exceed their ingest rate limit
+func WithHostRateLimits(limiter *hostlimit.Limiter) Option {
+	return func(h *Handlers) {
+		h.hostLimits = limiter
+	}
+}
+
+// WithUsageTracker sets the tracker behind the organization usage endpoint
+func WithUsageTracker(tracker *usage.Tracker) Option {
+	return func(h *Handlers) {
+		h.usage = tracker
+	}
+}
+
+// WithProber enables server-side host probe jobs
+func WithProber(prober *probe.Prober) Option {
+	return func(h *Handlers) {
+		h.prober = prober
+	}
+}
+
+// WithActions enables outbound actions, queued on the given dispatcher
+func WithActions(dispatcher *actions.Dispatcher) Option {
+	return func(h *Handlers) {
+		h.actions = dispatcher
+	}
+}
+
+// WithWebhooks enables webhooks, queued on the given dispatcher
+func WithWebhooks(dispatcher *webhooks.Dispatcher) Option {
+	return func(h *Handlers) {
+		h.webhooks = dispatcher
+	}
+}
+
+// WithBundleImport enables importing offline bundles signed with one of keys
+// maxSize bounds the uncompressed contents of a bundle.
+func WithBundleImport(keys *bundle.Keyring, maxSize int64) Option {
+	return func(h *Handlers) {
+		h.bundleKeys = keys
+		h.bundleMax = maxSize
+	}
+}
+
+// WithRemoteWrite enables per-organization Prometheus remote-write targets
+func WithRemoteWrite(exporter *remotewrite.Exporter) Option {
+	return func(h *Handlers) {
+		h.remoteWrite = exporter
+	}
+}
+
+// WithOAuth enables delegated tokens for third-party integrations
+// Access tokens expire after accessTokenTTL and are renewed with their refresh token.
+func WithOAuth(accessTokenTTL time.Duration) Option {
+	return func(h *Handlers) {
+		h.oauthTTL = accessTokenTTL
+	}
+}
+
+// WithSessions makes login start a session instead of creating an API key
+// Access tokens expire after accessTokenTTL and are renewed with the refresh token
+// until the session is lifetime old.
+func WithSessions(accessTokenTTL, lifetime time.Duration) Option {
+	return func(h *Handlers) {
+		h.sessionTTL = accessTokenTTL
+		h.sessionMax = lifetime
+	}
+}
+
+// WithImpersonation lets system administrators act as other users with tokens that
+// expire after tokenTTL
+func WithImpersonation(tokenTTL time.Duration) Option {
+	return func(h *Handlers) {
+		h.impersonationTTL = tokenTTL
+	}
+}
+
+// WithOpenAPISpec sets the generated OpenAPI spec served by /openapi.json and /openapi.yaml
+func WithOpenAPISpec(specJSON, specYAML []byte) Option {
+	return func(h *Handlers) {
+		h.specJSON = specJSON
+		h.specYAML = specYAML
+	}
+}
+
+// WithOpenAPISpecDir serves the OpenAPI spec from swagger.json and swagger.yaml in dir,
+// read on every request, instead of the embedded one, so a spec regenerated with
+// `make swag` is served without rebuilding
+func WithOpenAPISpecDir(dir string) Option {
+	return func(h *Handlers) {
+		h.specDir = dir
+	}
+}
+
+// WithFeatures sets the feature flag checker, so flag changes made through the
+// admin API also apply to middleware.RequireFeature sharing it
+func WithFeatures(checker *features.Checker) Option {
+	return func(h *Handlers) {
+		h.features = checker
+	}
+}
+
+// WithReprocessRunner sets the runner of reprocess jobs
+func WithReprocessRunner(runner *reprocess.Runner) Option {
+	return func(h *Handlers) {
+		h.reprocess = runner
+	}
+}
+
+// WithExportConcurrency sets how many hosts exports read per query and how many
+// reports they encode at a time
+func WithExportConcurrency(workers, batchSize int) Option {
+	return func(h *Handlers) {
+		h.exportWorkers = workers
+		h.exportBatchSize = batchSize
+	}
+}
+
+// WithConfig sets the configuration included, with secrets redacted, in diagnostic bundles
+func WithConfig(cfg *config.Config) Option {
+	return func(h *Handlers) {
+		h.config = cfg
+	}
+}
+
+// WithCheckinDefault sets the check-in window of hosts no organization schedule covers
+func WithCheckinDefault(window time.Duration) Option {
+	return func(h *Handlers) {
+		h.staleAfter = window
+	}
+}
+
+// WithReports sets the service that generates fleet reports, and emails them when it has a mailer
+func WithReports(service *reports.Service) Option {
+	return func(h *Handlers) {
+		h.reports = service
+	}
+}
+
+// WithDatabasePrivileges sets the startup check of the database role reported by /readyz
+func WithDatabasePrivileges(privileges *models.DatabasePrivileges) Option {
+	return func(h *Handlers) {
+		h.privileges = privileges
+	}
+}
+
+// WithLifecycle sets the startup and shutdown state reported by /startupz and /readyz
+func WithLifecycle(state *lifecycle.State) Option {
+	return func(h *Handlers) {
+		h.lifecycle = state
+	}
+}
+
+// WithBuildInfo sets the build reported by the version and public status endpoints
+func WithBuildInfo(info buildinfo.Info) Option {
+	return func(h *Handlers) {
+		h.build = info
+	}
+}
+
+// WithDeletionReasonRequired rejects host deletions that do not give a reason
+func WithDeletionReasonRequired() Option {
+	return func(h *Handlers) {
+		h.requireDeletionReason = true
+	}
+}
+
+// WithHostReportRetention sets how many reports of each host are kept when the
+// organization sets no retention; 0 keeps no history
+func WithHostReportRetention(reports int) Option {
+	return func(h *Handlers) {
+		h.reportRetention = reports
+	}
+}
+
+// WithRetentionEnforcer sets the enforcer admins run the organization's retention with
+// It should be the one the scheduled job uses, so both apply the same server default.
+func WithRetentionEnforcer(enforcer *retention.Enforcer) Option {
+	return func(h *Handlers) {
+		h.retention = enforcer
+	}
+}
+
+// WithJobs sets the scheduler whose jobs GET /admin/jobs reports
+func WithJobs(scheduler *jobs.Scheduler) Option {
+	return func(h *Handlers) {
+		h.jobs = scheduler
+	}
+}
 
 // New creates a new Handlers instance
-func New(store storage.Storage) *Handlers {
-	return &Handlers{storage: store}
+func New(store storage.Storage, opts ...Option) *Handlers {
+	h := &Handlers{
+		storage:         store,
+		acl:             acl.NewEvaluator(store, acl.DefaultCacheTTL),
+		audit:           audit.NewRecorder(store),
+		jsonLimits:      jsonlimit.DefaultLimits(),
+		reportRetention: storage.DefaultHostReportRetention,
+		maxDecompressed: defaultMaxDecompressedSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.receipts == nil {
+		// Without a configured key receipts are signed with an ephemeral one
+		// (crypto/rand does not fail in practice)
+		h.receipts, _ = receipts.GenerateSigner()
+	}
+	if h.errorRates == nil {
+		h.errorRates = errorrate.NewTracker(errorrate.Config{})
+	}
+	if h.usage == nil {
+		h.usage = usage.NewTracker()
+	}
+	if h.features == nil {
+		h.features = features.NewChecker(store, features.DefaultTTL)
+	}
+	if h.staleAfter <= 0 {
+		h.staleAfter = checkin.DefaultInterval
+	}
+	if h.reprocess == nil {
+		h.reprocess = reprocess.NewRunner(store)
+	}
+	h.graphql = graph.NewServer(graph.NewResolver(store, h.acl))
+	if h.exportBatchSize <= 0 {
+		h.exportBatchSize = storage.DefaultHostBatchSize
+	}
+	if h.exportWorkers <= 0 {
+		h.exportWorkers = DefaultExportWorkers
+	}
+	if h.reports == nil {
+		// Without a configured service reports cannot be emailed
+		h.reports = reports.NewService(store, nil, h.staleAfter)
+	}
+	if h.retention == nil {
+		h.retention = retention.NewEnforcer(store, h.reportRetention, false)
+	}
+	if h.jobs == nil {
+		h.jobs = jobs.NewScheduler(store, "") // No jobs scheduled
+	}
+	h.bundles = bundle.NewImporter(store, h.jsonLimits)
+	h.iocs = ioc.NewCache(store, ioc.DefaultTTL)
+
+	return h
+}
+
+// store returns the storage for the request's queries: the one bound to its database
+// connection (see middleware.QueryConnection), so they are attributed to the request
+func (h *Handlers) store(c *gin.Context) storage.Storage {
+	return middleware.RequestStorage(c.Request.Context(), h.storage)
 }
 
 // Health returns server health status
@@ -43,8 +442,8 @@ func New(store storage.Storage) *Handlers {
 func (h *Handlers) Health(c *gin.Context) {
 	// Check database connection by trying a simple query
 	// Note: Health check doesn't require org context, so we use a simple query
-	_, err := h.storage.GetOrganizationByID("00000000-0000-0000-0000-000000000000")
-	if err != nil && err != storage.ErrNotFound {
+	_, err := h.store(c).GetOrganizationByID("00000000-0000-0000-0000-000000000000")
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":   "error",
 			"service":  "snailbus",
@@ -60,147 +459,822 @@ func (h *Handlers) Health(c *gin.Context) {
 	})
 }
 
+// Ready reports whether the service should receive traffic
+// @Summary     Readiness check
+// @Description Returns 503 when the database is unreachable or DATABASE_URL points at a standby (status "read_only"). When any endpoint's 5xx ratio is above the configured alert threshold the service stays ready but reports status "degraded" along with the alerting endpoints.
+// @Description The replication object reports the primary's role and, when DATABASE_REPLICA_URL is set, the read replica's lag and whether it is serving reads. A lagging replica does not fail readiness, since reads fall back to the primary.
+// @Description The privileges object is the startup check of the DATABASE_URL role: table privileges it lacks (503 with database "insufficient_privileges") and the DDL it can still run, which should be empty when DATABASE_MIGRATION_URL is set (restricted).
+// @Description Readiness also fails with status "starting" until migrations have run, and with status "shutting_down" once shutdown has begun (SIGTERM or the preStop hook), so the pod leaves its Services before the listener closes.
+// @Tags        Health
+// @Produce     json
+// @Success     200  {object}  map[string]interface{}  "Service is ready (status ready or degraded)"
+// @Failure     503  {object}  map[string]interface{}  "Service is starting or shutting down, or the database is disconnected, read-only, or missing privileges"
+// @Router      /readyz [get]
+func (h *Handlers) Ready(c *gin.Context) {
+	if h.lifecycle != nil && h.lifecycle.Draining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting_down",
+		})
+		return
+	}
+
+	_, err := h.store(c).GetOrganizationByID("00000000-0000-0000-0000-000000000000")
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":   "not_ready",
+			"database": "disconnected",
+		})
+		return
+	}
+
+	replication, err := h.store(c).ReplicationStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":   "not_ready",
+			"database": "disconnected",
+		})
+		return
+	}
+
+	// Writes would fail against a standby, e.g. a demoted primary after failover
+	if replication.PrimaryRole != models.DatabaseRolePrimary {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":      "not_ready",
+			"database":    "read_only",
+			"replication": replication,
+		})
+		return
+	}
+
+	// A role missing table privileges would fail requests part way through
+	if h.privileges != nil && len(h.privileges.Missing) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":      "not_ready",
+			"database":    "insufficient_privileges",
+			"privileges":  h.privileges,
+			"replication": replication,
+		})
+		return
+	}
+
+	body := gin.H{
+		"status":      "ready",
+		"database":    "connected",
+		"replication": replication,
+	}
+	if h.privileges != nil {
+		body["privileges"] = h.privileges
+	}
+
+	// Degraded is reported but does not fail readiness: every replica sees the
+	// same errors, so pulling them all out of rotation would turn a partial
+	// outage into a full one
+	if h.errorRates.Degraded() {
+		alerting := []string{}
+		for _, stats := range h.errorRates.Snapshot() {
+			if stats.Alerting {
+				alerting = append(alerting, stats.Endpoint)
+			}
+		}
+		body["status"] = "degraded"
+		body["alerting_endpoints"] = alerting
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// Startup reports progress through startup, for Kubernetes startup probes
+// @Summary     Startup check
+// @Description Returns 200 once startup has finished, and 503 with the startup phases (such as migrations) and how long each took until then. Before the router is built the same response is served by the startup gate, so the probe can be pointed here from the first moment the port is open.
+// @Tags        Health
+// @Produce     json
+// @Success     200  {object}  lifecycle.Startup  "Startup has finished"
+// @Failure     503  {object}  lifecycle.Startup  "Startup is in progress or has failed"
+// @Router      /startupz [get]
+func (h *Handlers) Startup(c *gin.Context) {
+	if h.lifecycle == nil {
+		c.JSON(http.StatusOK, gin.H{"status": lifecycle.StatusStarted})
+		return
+	}
+
+	startup := h.lifecycle.Snapshot()
+	status := http.StatusOK
+	if startup.Status != lifecycle.StatusStarted {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, startup)
+}
+
+// Version reports exactly which build is running
+// @Summary     Build information
+// @Description Returns the server's semantic version, git commit, and build date, injected with -ldflags at build time (development builds fall back to the commit stamped by the Go toolchain), and the Go version, compiler, and platform it was built with.
+// @Description The same fields are logged at startup and exported as the build_info metric. Rate limited per client IP by RATE_LIMIT_STATUS.
+// @Tags        Health
+// @Produce     json
+// @Success     200  {object}  buildinfo.Info          "Build information"
+// @Failure     429  {object}  map[string]interface{}  "Rate limit exceeded"
+// @Router      /version [get]
+func (h *Handlers) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, h.build)
+}
+
+// Status reports coarse service health for public status pages and uptime monitors
+// @Summary     Public status
+// @Description Returns whether the service is operational and its version, without authentication. Unlike /health it does not query the database and carries no organization data: status is "degraded" when any endpoint's 5xx ratio is above the configured alert threshold, otherwise "operational".
+// @Description Rate limited per client IP by RATE_LIMIT_STATUS.
+// @Tags        Health
+// @Produce     json
+// @Success     200  {object}  map[string]string       "Service status and version"
+// @Failure     429  {object}  map[string]interface{}  "Rate limit exceeded"
+// @Router      /status [get]
+func (h *Handlers) Status(c *gin.Context) {
+	status := "operational"
+	if h.errorRates.Degraded() {
+		status = "degraded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      status,
+		"version":     h.build.Version,
+		"api_version": "v1",
+	})
+}
+
 // Ingest handles incoming reports from snail-core
 // @Summary     Ingest collection report
 // @Description Receives a collection report from a snail-core agent and stores it. The report replaces any existing data for the same hostname. Supports gzip-compressed requests via the Content-Encoding: gzip header.
+// @Description The response includes a signed receipt over the host ID, collection ID, SHA-256 of the uncompressed body, and receive time, which can later be checked with GET /api/v1/receipts/{id}/verify.
+// @Description meta.timestamp, if set, must be an RFC 3339 date-time (UTC if it has no offset) no further ahead of the server clock than INGEST_MAX_CLOCK_SKEW; it is stored and returned in UTC.
+// @Description The optional health block (status ok, warning, critical, or unknown, and the failing checks) becomes the host's health. A change into warning or critical, or back to ok from either, raises a host_health_warning, host_health_critical, or host_health_recovered finding for outbound actions.
+// @Description Report data is matched against the organization's IOC lists; an indicator found on a host for the first time raises an ioc_match finding.
+// @Description Each host (meta.host_id) may send at most RATE_LIMIT_INGEST_HOST reports, or its override in RATE_LIMIT_INGEST_HOST_OVERRIDES; more get 429 with Retry-After until the period resets.
+// @Description The body may also be CBOR (Content-Type: application/cbor) or MessagePack (application/msgpack) with the same structure; it is converted to JSON, which is what is checked against the JSON limits and stored. The receipt checksum covers the body as sent.
+// @Description Responses, including errors, are encoded as the first of JSON, CBOR, or MessagePack named in Accept, or else like the request body.
 // @Tags        Ingest
 // @Accept      json
 // @Accept      application/gzip
+// @Accept      application/cbor
+// @Accept      application/msgpack
 // @Produce     json
+// @Produce     application/cbor
+// @Produce     application/msgpack
 // @Param       request  body      models.IngestRequest  true  "Collection report from snail-core"
 // @Success     201      {object}  models.IngestResponse  "Report successfully ingested"
 // @Failure     400      {object}  map[string]string     "Invalid request payload"
+// @Failure     403      {object}  map[string]string     "API key issued at enrollment to another host"
+// @Failure     422      {object}  map[string]interface{}  "Payload exceeds JSON depth, key count, or string length limits"
+// @Failure     429      {object}  map[string]interface{}  "Host exceeded its ingest rate limit"
 // @Failure     500      {object}  map[string]string     "Internal server error"
 // @Router      /api/v1/ingest [post]
 func (h *Handlers) Ingest(c *gin.Context) {
-	// Handle gzip-compressed requests
-	var reader io.Reader = c.Request.Body
-	if c.GetHeader("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(c.Request.Body)
-		if err != nil {
-			logger.FromContext(c).Err(err).Msg("Failed to create gzip reader")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to decompress request"})
-			return
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	body, document, ok := h.readIngestBody(c)
+	if !ok {
+		return
 	}
 
-	// Parse the request
-	var req models.IngestRequest
-	if err := json.NewDecoder(reader).Decode(&req); err != nil {
-		logger.FromContext(c).Err(err).Msg("Failed to parse ingest request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON payload"})
+	req, ingestErr := h.decodeIngest(c, document)
+	if ingestErr != nil {
+		respondIngest(c, ingestErr.status, ingestErr.body)
 		return
 	}
+	checksum := sha256.Sum256(body)
 
-	// Validate required fields
-	if req.Meta.HostID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing host_id in meta"})
+	now := time.Now().UTC()
+	if ingestErr = h.validateIngest(&req, now); ingestErr != nil {
+		respondIngest(c, ingestErr.status, ingestErr.body)
 		return
 	}
-	if req.Meta.Hostname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing hostname in meta"})
+	if ingestErr = checkEnrolledHost(c, req.Meta.HostID); ingestErr != nil {
+		respondIngest(c, ingestErr.status, ingestErr.body)
 		return
 	}
 
 	// Get user_id and org_id from context (set by AuthMiddleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		respondIngest(c, http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		respondIngest(c, http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 
 	userObj := user.(*models.User)
 
-	// Create report
-	now := time.Now().UTC()
-	report := &models.Report{
-		ID:         req.Meta.HostID, // Use host_id (UUID) as primary identifier
-		ReceivedAt: now,
-		Meta:       req.Meta,
-		Data:       req.Data,
-		Errors:     req.Errors,
+	// One agent reporting in a loop must not take the organization's share of ingest
+	if h.hostLimits != nil && !h.allowHostReport(c, userObj.OrgID, req.Meta.HostID) {
+		return
+	}
+
+	item, ingestErr := h.prepareIngest(c, userObj.OrgID, req, now)
+	if ingestErr != nil {
+		respondIngest(c, ingestErr.status, ingestErr.body)
+		return
 	}
+	item.checksum = checksum
+	item.size = len(body)
 
-	// Store the report (replaces any previous data for this host)
+	// Store the report (replaces the host's current data; finishIngest keeps its history)
 	// Associate the host with the authenticated user's organization and user ID
-	if err := h.storage.SaveHost(report, userObj.OrgID, userID.(string)); err != nil {
+	if err := h.storeIngest(c, userObj.OrgID, userID.(string), item); err != nil {
 		logger.FromContext(c).
 			Err(err).
 			Str("hostname", req.Meta.Hostname).
 			Str("host_id", req.Meta.HostID).
 			Msg("Failed to save host data")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store host data"})
+		respondIngest(c, http.StatusInternalServerError, gin.H{"error": "failed to store host data"})
 		return
 	}
-
-	// Track business metric: hosts ingested per org
-	metrics.HostsIngestedTotal.WithLabelValues(userObj.OrgID).Inc()
-
-	logger.FromContext(c).
-		Str("host_id", req.Meta.HostID).
-		Str("hostname", req.Meta.Hostname).
-		Str("collection_id", req.Meta.CollectionID).
-		Int("errors_count", len(req.Errors)).
-		Msg("Host data updated")
+	h.finishIngest(c, userObj.OrgID, userID.(string), item)
 
 	// Send response
-	c.JSON(http.StatusCreated, models.IngestResponse{
+	respondIngest(c, http.StatusCreated, models.IngestResponse{
 		Status:     "ok",
 		ReportID:   req.Meta.HostID, // Return host_id instead of hostname
 		ReceivedAt: now.Format(time.RFC3339),
 		Message:    "Host data updated successfully",
+		Receipt:    item.receipt,
+		Stripped:   item.report.Stripped,
+	})
+}
+
+// defaultMaxDecompressedSize bounds decompressed ingest bodies unless WithMaxDecompressedSize is given
+const defaultMaxDecompressedSize = 100 * 1024 * 1024
+
+// readIngestBody reads an ingest request body, decompressing gzip and converting CBOR and
+// MessagePack to JSON. It returns the uncompressed body as sent, which receipts are computed
+// over, and its JSON form. Returns false after writing a 400 response if it cannot be read,
+// or a 413 response if it is too large as sent or once decompressed.
+func (h *Handlers) readIngestBody(c *gin.Context) (body, document []byte, ok bool) {
+	format := negotiateIngestFormat(c)
+
+	// Handle gzip-compressed requests. The body as sent is limited by RequestSizeLimit;
+	// it is decompressed as it is read, and reading stops a byte past the limit on its
+	// decompressed size, so a small body cannot expand to fill memory.
+	var reader io.Reader = c.Request.Body
+	compressed := c.GetHeader("Content-Encoding") == "gzip"
+	if compressed {
+		gzReader, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			if tooLarge(err) {
+				respondIngestTooLarge(c, "request body is too large")
+				return nil, nil, false
+			}
+			logger.FromContext(c).Err(err).Msg("Failed to create gzip reader")
+			respondIngest(c, http.StatusBadRequest, gin.H{"error": "failed to decompress request"})
+			return nil, nil, false
+		}
+		defer gzReader.Close()
+		reader = io.LimitReader(gzReader, h.maxDecompressed+1)
+	}
+
+	// Read the uncompressed body; its hash goes into the receipt
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		if tooLarge(err) {
+			respondIngestTooLarge(c, "request body is too large")
+			return nil, nil, false
+		}
+		logger.FromContext(c).Err(err).Msg("Failed to read ingest request")
+		respondIngest(c, http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		return nil, nil, false
+	}
+	if compressed && int64(len(body)) > h.maxDecompressed {
+		logger.FromContext(c).
+			Int64("max_decompressed", h.maxDecompressed).
+			Msg("Decompressed ingest request exceeds limit")
+		middleware.RejectDecompressedBody(c)
+		respondIngestTooLarge(c, "decompressed request body is too large")
+		return nil, nil, false
+	}
+
+	// CBOR and MessagePack bodies are converted to JSON, which is what gets checked and stored
+	document, err = payload.ToJSON(format, body, 0)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("format", string(format)).Msg("Failed to decode ingest request")
+		respondIngest(c, http.StatusBadRequest, gin.H{"error": "invalid " + string(format) + " payload"})
+		return nil, nil, false
+	}
+	return body, document, true
+}
+
+// tooLarge reports whether reading a body failed because it exceeded RequestSizeLimit's limit
+func tooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// respondIngestTooLarge answers an ingest request whose body is too large with 413
+func respondIngestTooLarge(c *gin.Context, message string) {
+	respondIngest(c, http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "Request entity too large",
+		"message": message,
+	})
+}
+
+// ingestError is a report rejected with the given status and response body
+type ingestError struct {
+	status     int
+	body       gin.H
+	retryAfter int // Seconds until a rate-limited host may report again; 0 otherwise
+}
+
+// rejectIngest returns the error rejecting a report with status and body
+func rejectIngest(status int, body gin.H) *ingestError {
+	return &ingestError{status: status, body: body}
+}
+
+// ingestItem is an accepted report on its way into storage
+type ingestItem struct {
+	report         *models.Report
+	checksum       [sha256.Size]byte // Of the report as sent, for its receipt
+	size           int               // Bytes counted towards the organization's usage
+	newHost        bool              // The host has not reported before
+	previousHealth string            // Health status of the host's last report
+	receipt        *models.Receipt   // Stored with the report, see storeIngest
+}
+
+// decodeIngest checks a report's JSON against the shape limits and decodes it
+func (h *Handlers) decodeIngest(c *gin.Context, document []byte) (models.IngestRequest, *ingestError) {
+	var req models.IngestRequest
+
+	// Reject pathological shapes before decoding them into memory
+	if err := h.jsonLimits.Check(document); err != nil {
+		var limitErr *jsonlimit.Error
+		if errors.As(err, &limitErr) {
+			logger.FromContext(c).
+				Str("limit", limitErr.Limit).
+				Int("max", limitErr.Max).
+				Msg("Ingest request exceeds JSON limits")
+			return req, rejectIngest(http.StatusUnprocessableEntity, gin.H{
+				"error":   "JSON payload exceeds limits",
+				"message": limitErr.Error(),
+				"limit":   limitErr.Limit,
+				"max":     limitErr.Max,
+			})
+		}
+		logger.FromContext(c).Err(err).Msg("Failed to parse ingest request")
+		return req, rejectIngest(http.StatusBadRequest, gin.H{"error": "invalid JSON payload"})
+	}
+
+	if err := json.Unmarshal(document, &req); err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to parse ingest request")
+		return req, rejectIngest(http.StatusBadRequest, gin.H{"error": "invalid JSON payload"})
+	}
+	return req, nil
+}
+
+// validateIngest checks the fields of a report that need no storage, canonicalizing its
+// timestamp and health in place
+func (h *Handlers) validateIngest(req *models.IngestRequest, now time.Time) *ingestError {
+	// Validate required fields
+	if req.Meta.HostID == "" {
+		return rejectIngest(http.StatusBadRequest, gin.H{"error": "missing host_id in meta"})
+	}
+	if req.Meta.Hostname == "" {
+		return rejectIngest(http.StatusBadRequest, gin.H{"error": "missing hostname in meta"})
+	}
+
+	// Canonicalize the agent's collection time so stored and returned timestamps are RFC 3339 UTC
+	if req.Meta.Timestamp != "" {
+		collectedAt, err := models.ParseReportTimestamp(req.Meta.Timestamp)
+		if err != nil {
+			return rejectIngest(http.StatusBadRequest, gin.H{
+				"error":   "invalid timestamp in meta",
+				"message": "timestamp must be an RFC 3339 date-time, e.g. 2025-01-02T15:04:05Z",
+			})
+		}
+		if h.maxSkew > 0 && collectedAt.Sub(now) > h.maxSkew {
+			return rejectIngest(http.StatusBadRequest, gin.H{
+				"error":   "timestamp in meta is in the future",
+				"message": fmt.Sprintf("timestamp is %s ahead of the server clock (allowed skew %s); check the host's clock", collectedAt.Sub(now).Round(time.Second), h.maxSkew),
+			})
+		}
+		req.Meta.Timestamp = models.FormatReportTimestamp(collectedAt)
+	}
+
+	if req.Health != nil {
+		req.Health.Normalize()
+		if err := req.Health.Validate(); err != nil {
+			return rejectIngest(http.StatusBadRequest, gin.H{
+				"error":   "invalid health in report",
+				"message": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// checkEnrolledHost rejects a report for another host than the one the API key was issued
+// to at enrollment; keys not issued at enrollment may report for any host
+func checkEnrolledHost(c *gin.Context, hostID string) *ingestError {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || principal.HostID == "" || principal.HostID == hostID {
+		return nil
+	}
+	return rejectIngest(http.StatusForbidden, gin.H{
+		"error":   "host not allowed",
+		"message": "this API key was issued at enrollment to host " + principal.HostID + " and can only report for it",
 	})
 }
 
+// prepareIngest applies the organization's ingest filter to a validated report and reads
+// what its findings are measured against, returning the report ready to be stored
+func (h *Handlers) prepareIngest(c *gin.Context, orgID string, req models.IngestRequest, now time.Time) (*ingestItem, *ingestError) {
+	// Drop the fields the organization does not want stored; fail closed so they never reach the database
+	data, stripped, err := h.filterReportData(c, orgID, req.Data)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", req.Meta.HostID).Msg("Failed to apply ingest filter")
+		return nil, rejectIngest(http.StatusInternalServerError, gin.H{"error": "failed to apply ingest filter"})
+	}
+
+	item := &ingestItem{}
+	// Health transitions and new hosts are measured against the host's last report
+	if req.Health != nil || h.actions != nil {
+		previous, err := h.store(c).GetHostHealth(req.Meta.HostID, orgID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.FromContext(c).Err(err).Str("host_id", req.Meta.HostID).Msg("Failed to get host health")
+			return nil, rejectIngest(http.StatusInternalServerError, gin.H{"error": "failed to store host data"})
+		}
+		item.newHost = errors.Is(err, storage.ErrNotFound)
+		if previous != nil {
+			item.previousHealth = previous.Status
+		}
+	}
+
+	item.report = &models.Report{
+		ID:         req.Meta.HostID, // Use host_id (UUID) as primary identifier
+		ReceivedAt: now,
+		Meta:       req.Meta,
+		Data:       data,
+		Errors:     req.Errors,
+		Health:     req.Health,
+		Stripped:   stripped,
+	}
+	return item, nil
+}
+
+// storeIngest stores accepted reports together with their signed receipts, so that a
+// receipt is never issued for a report that was not stored
+func (h *Handlers) storeIngest(c *gin.Context, orgID, userID string, items ...*ingestItem) error {
+	reports := make([]*models.Report, len(items))
+	for i, item := range items {
+		reports[i] = item.report
+		item.receipt = &models.Receipt{
+			ID:           uuid.New().String(),
+			HostID:       item.report.Meta.HostID,
+			CollectionID: item.report.Meta.CollectionID,
+			Checksum:     receipts.Checksum(item.checksum[:]),
+			ReceivedAt:   item.report.ReceivedAt.Truncate(time.Microsecond), // Postgres timestamp precision
+		}
+		h.receipts.Sign(item.receipt)
+	}
+
+	return h.store(c).WithTx(func(tx storage.Storage) error {
+		if err := tx.SaveHosts(reports, orgID, userID); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := tx.SaveReceipt(item.receipt, orgID); err != nil {
+				return fmt.Errorf("failed to save receipt: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// finishIngest runs everything that follows from a stored report: report history,
+// usage, findings, webhooks, the audit log, IOC matching, and host tag rules
+func (h *Handlers) finishIngest(c *gin.Context, orgID, userID string, item *ingestItem) {
+	report := item.report
+	meta := report.Meta
+	now := report.ReceivedAt
+
+	h.saveHostReport(c, orgID, userID, report)
+
+	// Track business metric: hosts ingested per org
+	metrics.HostsIngestedTotal.WithLabelValues(orgID).Inc()
+	h.usage.RecordIngest(orgID, item.size)
+	for _, field := range report.Stripped {
+		metrics.IngestFieldsStrippedTotal.WithLabelValues(orgID).Add(float64(field.Count))
+	}
+
+	if item.newHost {
+		finding := models.Finding{
+			Type:       models.FindingHostNew,
+			HostID:     meta.HostID,
+			Hostname:   meta.Hostname,
+			Summary:    fmt.Sprintf("%s reported for the first time", meta.Hostname),
+			DetectedAt: now,
+		}
+		if meta.SnailVersion != "" {
+			finding.Details = []string{"agent version " + meta.SnailVersion}
+		}
+		h.fireFinding(orgID, finding)
+	}
+	if len(report.Errors) > 0 {
+		h.fireFinding(orgID, models.Finding{
+			Type:       models.FindingReportErrors,
+			HostID:     meta.HostID,
+			Hostname:   meta.Hostname,
+			Summary:    fmt.Sprintf("%s reported %d collection errors", meta.Hostname, len(report.Errors)),
+			Details:    report.Errors,
+			DetectedAt: now,
+		})
+	}
+	if report.Health != nil {
+		if findingType := models.HealthTransitionFinding(item.previousHealth, report.Health.Status); findingType != "" {
+			h.fireFinding(orgID, healthFinding(findingType, meta, item.previousHealth, report.Health, now))
+		}
+	}
+	h.fireWebhook(orgID, models.WebhookEvent{
+		Type:         models.WebhookEventHostIngested,
+		HostID:       meta.HostID,
+		Hostname:     meta.Hostname,
+		CollectionID: meta.CollectionID,
+		LastSeen:     &now,
+		OccurredAt:   now,
+	})
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      orgID,
+		Action:     models.AuditHostIngested,
+		TargetType: models.AuditTargetHost,
+		TargetID:   meta.HostID,
+		Details:    map[string]string{"hostname": meta.Hostname, "collection_id": meta.CollectionID},
+	})
+	h.matchIOCs(c, orgID, meta, report.Data, now)
+	h.applyHostTagRules(c, orgID, meta)
+
+	logger.FromContext(c).
+		Str("host_id", meta.HostID).
+		Str("hostname", meta.Hostname).
+		Str("collection_id", meta.CollectionID).
+		Int("errors_count", len(report.Errors)).
+		Int("filter_paths_matched", len(report.Stripped)).
+		Msg("Host data updated")
+}
+
+// allowHostReport counts a report against its host's ingest rate limit, responding
+// with 429 and returning false when the host is over it. A failed check lets the report in.
+func (h *Handlers) allowHostReport(c *gin.Context, orgID, hostID string) bool {
+	result, ingestErr := h.checkHostLimit(c, orgID, hostID)
+	if result != nil && result.Limit > 0 {
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(result.Reset.Unix(), 10))
+	}
+	if ingestErr == nil {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(ingestErr.retryAfter))
+	respondIngest(c, ingestErr.status, ingestErr.body)
+	return false
+}
+
+// checkHostLimit counts a report against its host's ingest rate limit and returns the
+// 429 error when the host is over it. The result is nil if the check failed, which lets
+// the report in.
+func (h *Handlers) checkHostLimit(c *gin.Context, orgID, hostID string) (*hostlimit.Result, *ingestError) {
+	result, err := h.hostLimits.Allow(c.Request.Context(), orgID, hostID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Host rate limit check failed")
+		return nil, nil
+	}
+	if result.Allowed {
+		return &result, nil
+	}
+
+	retryAfter := int(math.Ceil(time.Until(result.Reset).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	logger.FromContext(c).
+		Str("host_id", hostID).
+		Int64("limit", result.Limit).
+		Str("period", result.Period.String()).
+		Msg("Host exceeded its ingest rate limit")
+	return &result, &ingestError{status: http.StatusTooManyRequests, retryAfter: retryAfter, body: gin.H{
+		"error": "host rate limit exceeded",
+		"message": fmt.Sprintf("host %s sent more than %d reports in %s; check the agent's collection schedule, "+
+			"or ask an administrator to raise the host's limit in RATE_LIMIT_INGEST_HOST_OVERRIDES", hostID, result.Limit, result.Period),
+		"host_id":     hostID,
+		"retry_after": retryAfter,
+		"limit":       result.Limit,
+		"period":      result.Period.String(),
+		"reset_time":  result.Reset.UTC().Format(time.RFC3339),
+	}}
+}
+
+// healthFinding describes a host's health transition, listing its failing checks
+func healthFinding(findingType string, meta models.ReportMeta, previous string, health *models.HostHealth, detectedAt time.Time) models.Finding {
+	from := previous
+	if from == "" {
+		from = "not reported"
+	}
+	details := []string{}
+	for _, check := range health.Failing() {
+		detail := check.Name + ": " + check.Status
+		if check.Message != "" {
+			detail += " (" + check.Message + ")"
+		}
+		details = append(details, detail)
+	}
+	return models.Finding{
+		Type:       findingType,
+		HostID:     meta.HostID,
+		Hostname:   meta.Hostname,
+		Summary:    fmt.Sprintf("%s health changed from %s to %s", meta.Hostname, from, health.Status),
+		Details:    details,
+		DetectedAt: detectedAt,
+	}
+}
+
 // ListHosts returns a list of all known hosts in the current organization
 // @Summary     List all hosts
 // @Description Returns a list of all known hosts with summary information for the authenticated user's organization. Each host entry includes the hostname and last seen timestamp.
+// @Description Users with a tag-based host access policy only see hosts carrying at least one of their allowed tags.
+// @Description The optional q parameter filters hosts with the search query language, e.g. `os:fedora version>=40 tag:env=prod package:openssl<3.0`.
+// @Description Archived hosts are left out unless include_archived=true; they carry archived_at.
+// @Description Hosts whose agent reports health carry it as health; filter on it with q, e.g. `health:warning,critical`.
+// @Description Passing limit or cursor pages the response: hosts come newest report first, limit at a time, with has_more and, unless on the last page, next_cursor to pass as cursor for the next page. total counts the hosts on all pages. Without either parameter every host is returned.
+// @Description Each host lists the top-level data sections of its last report as sections. has_section=docker keeps hosts reporting that section; commas separate alternatives (has_section=docker,podman) and repeating the parameter requires every one.
+// @Description Each host has a status: active, or stale once it misses its check-in window, with stale_since. Hosts are checked every 5 minutes and a report makes the host active again. status=stale keeps stale hosts.
+// @Description group_id keeps the hosts of a host group: its static members and the hosts matching its rule.
 // @Tags        Hosts
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
+// @Param       q                 query     string                  false  "Search query (fields: os, version, hostname, id, tag, package, health, section, status)"
+// @Param       has_section       query     []string                false  "Data section the last report must include, e.g. docker"  collectionFormat(multi)
+// @Param       status            query     string                  false  "Host status, active or stale; commas separate alternatives"
+// @Param       group_id          query     string                  false  "Host group ID (UUID)"
+// @Param       include_archived  query     bool                    false  "Include archived hosts"
+// @Param       limit             query     int                     false  "Page size (default 100, max 1000); pages the response"
+// @Param       cursor            query     string                  false  "next_cursor of the previous page"
 // @Success     200  {object}  map[string]interface{}  "List of hosts with total count"
+// @Failure     400  {object}  map[string]string       "Invalid search query, has_section, status, limit, or cursor"
 // @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     404  {object}  map[string]string       "Host group not found"
 // @Failure     500  {object}  map[string]string       "Internal server error"
 // @Router      /api/v1/hosts [get]
 func (h *Handlers) ListHosts(c *gin.Context) {
 	orgID := middleware.GetOrgID(c)
 	if orgID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	includeArchived := c.Query("include_archived") == "true"
+	var query *search.Query
+	if q := c.Query("q"); q != "" {
+		parsed, parseErr := search.Parse(q)
+		if parseErr != nil {
+			_ = c.Error(apierror.Validation("invalid search query").WithDetail(parseErr.Error()))
+			return
+		}
+		query = parsed
+	}
+	// Each has_section is one more term the hosts must match
+	for _, sections := range c.QueryArray("has_section") {
+		term, termErr := search.SectionTerm(sections)
+		if termErr != nil {
+			_ = c.Error(apierror.Validation("invalid has_section").WithDetail(termErr.Error()))
+			return
+		}
+		if query == nil {
+			query = &search.Query{}
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	if status := c.Query("status"); status != "" {
+		term, termErr := search.StatusTerm(status)
+		if termErr != nil {
+			_ = c.Error(apierror.Validation("invalid status").WithDetail(termErr.Error()))
+			return
+		}
+		if query == nil {
+			query = &search.Query{}
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	after, limit, paged, ok := hostPage(c)
+	if !ok {
 		return
 	}
 
-	hosts, err := h.storage.ListHosts(orgID)
+	// Hosts of a group: its static members and the hosts matching its rule
+	var members map[string]bool
+	if groupID := c.Query("group_id"); groupID != "" {
+		group, err := h.hostGroup(c, groupID, orgID)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if members, err = h.hostGroupMembers(c, group, orgID, includeArchived); err != nil {
+			_ = c.Error(apierror.Internal("failed to retrieve hosts", err))
+			return
+		}
+	}
+
+	policy, err := h.hostPolicy(c)
 	if err != nil {
-		logger.FromContext(c).Err(err).Msg("Failed to list hosts")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve hosts"})
+		_ = c.Error(apierror.Internal("failed to retrieve hosts", err))
 		return
 	}
 
+	// Without a query, group, or tag policy the page is read in SQL; otherwise the filtered list is paged
+	if paged && query == nil && members == nil && !policy.Restricted() {
+		page, err := h.store(c).ListHostsPaginated(orgID, includeArchived, after, limit)
+		if err != nil {
+			_ = c.Error(apierror.Internal("failed to retrieve hosts", err))
+			return
+		}
+		c.JSON(http.StatusOK, hostPageResponse(page, limit))
+		return
+	}
+
+	var hosts []*models.HostSummary
+	if query != nil {
+		hosts, err = h.store(c).SearchHosts(orgID, query, includeArchived)
+	} else {
+		hosts, err = h.store(c).ListHosts(orgID, includeArchived)
+	}
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve hosts", err))
+		return
+	}
+	hosts = policy.FilterHosts(hosts)
+	if members != nil {
+		hosts = filterHostGroupMembers(hosts, members)
+	}
+
+	if paged {
+		c.JSON(http.StatusOK, hostPageResponse(storage.PageHosts(hosts, after, limit), limit))
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"hosts": hosts,
 		"total": len(hosts),
 	})
 }
 
+// hostPage reads the limit and cursor query parameters of ListHosts; paged is set when
+// either is given. Returns false after writing a 400 response if they are invalid
+func hostPage(c *gin.Context) (after *storage.HostCursor, limit int, paged bool, ok bool) {
+	limit = storage.DefaultHostPageSize
+	if l, set := c.GetQuery("limit"); set {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > storage.MaxHostPageSize {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(storage.MaxHostPageSize)))
+			return nil, 0, false, false
+		}
+		limit = parsed
+		paged = true
+	}
+	if cursor, set := c.GetQuery("cursor"); set {
+		parsed, err := storage.ParseHostCursor(cursor)
+		if err != nil {
+			_ = c.Error(apierror.Validation("invalid cursor").WithDetail("cursor must be a next_cursor returned by a previous page"))
+			return nil, 0, false, false
+		}
+		after = parsed
+		paged = true
+	}
+	return after, limit, paged, true
+}
+
+// hostPageResponse builds the paged ListHosts response; next_cursor is omitted on the last page
+func hostPageResponse(page *storage.HostPage, limit int) gin.H {
+	response := gin.H{
+		"hosts":    page.Hosts,
+		"total":    page.Total,
+		"limit":    limit,
+		"has_more": page.Next != nil,
+	}
+	if page.Next != nil {
+		response["next_cursor"] = page.Next.String()
+	}
+	return response
+}
+
 // GetHost returns the full data for a specific host
 // @Summary     Get host data
 // @Description Returns the complete collection report for a specific host in the authenticated user's organization, including all collected data and metadata, identified by its host ID.
+// @Description fields limits the response to the listed top-level fields (id is always included), and path to the listed dot-separated paths of the data, such as system.packages, keeping their place in it. Paths with no value are left out. Both are comma-separated.
+// @Description The ETag header carries the version of the host's tags and details, for If-Match on PATCH /hosts/{host_id} and PUT /hosts/{host_id}/tags. Ingested reports do not change it.
 // @Tags        Hosts
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
 // @Param       host_id  path      string  true  "Unique identifier (UUID) of the host to retrieve"
+// @Param       fields   query     string  false  "Top-level fields to return: received_at, meta, data, errors, health"
+// @Param       path     query     string  false  "Paths of the data to return, such as system.packages (at most 20)"
 // @Success     200       {object}  models.Report  "Host data"
-// @Failure     400       {object}  map[string]string  "Missing host_id parameter"
+// @Failure     400       {object}  map[string]string  "Missing host_id parameter, or invalid fields or path"
 // @Failure     401       {object}  map[string]string  "Unauthorized"
 // @Failure     404       {object}  map[string]string  "Host not found"
 // @Failure     500       {object}  map[string]string  "Internal server error"
@@ -208,43 +1282,146 @@ func (h *Handlers) ListHosts(c *gin.Context) {
 func (h *Handlers) GetHost(c *gin.Context) {
 	hostID := c.Param("host_id")
 	if hostID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing host_id"})
+		_ = c.Error(apierror.Validation("missing host_id"))
 		return
 	}
 
 	orgID := middleware.GetOrgID(c)
 	if orgID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	sel, fields, ok := hostSelection(c)
+	if !ok {
 		return
 	}
 
-	report, err := h.storage.GetHost(hostID, orgID)
+	report, err := h.store(c).GetHostSelection(hostID, orgID, sel)
 	if err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "host not found"})
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
 			return
 		}
 		logger.FromContext(c).
 			Err(err).
 			Str("host_id", hostID).
 			Msg("Failed to get host")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve host"})
+		_ = c.Error(apierror.Internal("failed to retrieve host", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, report)
+	// Hosts outside the user's tag policy are reported as not found to avoid leaking their existence
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to retrieve host", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	version, err := h.store(c).GetHostMetadataVersion(hostID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to get host metadata version")
+		_ = c.Error(apierror.Internal("failed to retrieve host", err))
+		return
+	}
+
+	setETag(c, version)
+	if fields == nil {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	response := gin.H{"id": report.ID}
+	for _, field := range fields {
+		switch field {
+		case "received_at":
+			response[field] = report.ReceivedAt
+		case "meta":
+			response[field] = report.Meta
+		case "data":
+			response[field] = report.Data
+		case "errors":
+			response[field] = report.Errors
+		case "health":
+			response[field] = report.Health
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// hostFields are the top-level report fields GetHost's fields parameter selects
+var hostFields = []string{"id", "received_at", "meta", "data", "errors", "health"}
+
+// hostSelection parses GetHost's fields and path parameters into what to load of the
+// host's data and the fields to return, nil for all of them. A path implies the data
+// field. Writes a 400 response and returns false if either is invalid.
+func hostSelection(c *gin.Context) (storage.HostSelection, []string, bool) {
+	var sel storage.HostSelection
+	if list := c.Query("path"); list != "" {
+		paths := strings.Split(list, ",")
+		if len(paths) > storage.MaxHostDataPaths {
+			_ = c.Error(apierror.Validation("invalid path").WithDetail(fmt.Sprintf("at most %d paths may be selected", storage.MaxHostDataPaths)))
+			return sel, nil, false
+		}
+		for _, p := range paths {
+			path, err := storage.ParseHostDataPath(strings.TrimSpace(p))
+			if err != nil {
+				_ = c.Error(apierror.Validation("invalid path").WithDetail(err.Error()))
+				return sel, nil, false
+			}
+			sel.Paths = append(sel.Paths, path)
+		}
+	}
+
+	list, ok := c.GetQuery("fields")
+	if !ok {
+		return sel, nil, true
+	}
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(hostFields, field) {
+			_ = c.Error(apierror.Validation("invalid fields").WithDetail(fmt.Sprintf("unknown field %q; fields are %s", field, strings.Join(hostFields, ", "))))
+			return sel, nil, false
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	if sel.Paths != nil && !slices.Contains(fields, "data") {
+		fields = append(fields, "data")
+	}
+	sel.OmitData = !slices.Contains(fields, "data")
+	return sel, fields, true
 }
 
 // DeleteHost removes a host
 // @Summary     Delete host
-// @Description Removes a host and all its associated data from the authenticated user's organization. This operation cannot be undone. Uses host_id (UUID) as the identifier.
+// @Description Removes a host and all its associated data from the authenticated user's organization. Uses host_id (UUID) as the identifier.
+// @Description The reason (decommissioned, duplicate, reimaged, mistake, or other) and note are recorded on the deleted event in the activity feed. A reason is required when HOST_DELETION_REASON_REQUIRED is set.
 // @Tags        Hosts
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
-// @Param       host_id  path      string  true  "Host ID (UUID) of the host to delete"
+// @Param       host_id  path      string  true   "Host ID (UUID) of the host to delete"
+// @Param       reason   query     string  false  "Why the host is deleted"  Enums(decommissioned, duplicate, reimaged, mistake, other)
+// @Param       note     query     string  false  "Free-text explanation (max 500 characters)"
 // @Success     204       "Host successfully deleted"
-// @Failure     400       {object}  map[string]string  "Missing host_id parameter"
+// @Failure     400       {object}  map[string]string  "Missing host_id, or missing or invalid reason"
 // @Failure     401       {object}  map[string]string  "Unauthorized"
 // @Failure     404       {object}  map[string]string  "Host not found"
 // @Failure     500       {object}  map[string]string  "Internal server error"
@@ -252,32 +1429,179 @@ func (h *Handlers) GetHost(c *gin.Context) {
 func (h *Handlers) DeleteHost(c *gin.Context) {
 	hostID := c.Param("host_id")
 	if hostID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing host_id"})
+		_ = c.Error(apierror.Validation("missing host_id"))
 		return
 	}
 
 	orgID := middleware.GetOrgID(c)
 	if orgID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
 		return
 	}
 
-	if err := h.storage.DeleteHost(hostID, orgID); err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "host not found"})
+	deletion, err := h.hostDeletion(c.Query("reason"), c.Query("note"))
+	if err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	// Hosts outside the user's tag policy are reported as not found to avoid leaking their existence
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to delete host", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	var event models.WebhookEvent
+	if h.webhooks != nil {
+		event = h.hostDeletedEvent(c, hostID, orgID, deletion)
+	}
+	if err := h.store(c).DeleteHost(hostID, orgID, middleware.GetUserID(c), deletion); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
 			return
 		}
 		logger.FromContext(c).
 			Err(err).
 			Str("host_id", hostID).
 			Msg("Failed to delete host")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete host"})
+		_ = c.Error(apierror.Internal("failed to delete host", err))
 		return
 	}
 
+	h.fireWebhook(orgID, event)
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      orgID,
+		Action:     models.AuditHostDeleted,
+		TargetType: models.AuditTargetHost,
+		TargetID:   hostID,
+		Details:    deletionDetails(deletion),
+	})
 	c.Status(http.StatusNoContent)
 }
 
+// hostDeletion validates the reason and note given for a host deletion
+// Returns nil when neither is given and a reason is not required
+func (h *Handlers) hostDeletion(reason, note string) (*models.HostDeletion, error) {
+	note = strings.TrimSpace(note)
+	if reason == "" {
+		if h.requireDeletionReason {
+			return nil, fmt.Errorf("reason is required (one of %s)", strings.Join(models.HostDeletionReasons, ", "))
+		}
+		if note != "" {
+			return nil, fmt.Errorf("note requires a reason")
+		}
+		return nil, nil
+	}
+	if !containsString(models.HostDeletionReasons, reason) {
+		return nil, fmt.Errorf("reason must be one of %s", strings.Join(models.HostDeletionReasons, ", "))
+	}
+	if reason == models.HostDeletionOther && note == "" {
+		return nil, fmt.Errorf("reason other requires a note")
+	}
+	if len(note) > models.MaxHostDeletionNoteLength {
+		return nil, fmt.Errorf("note must be at most %d characters", models.MaxHostDeletionNoteLength)
+	}
+	return &models.HostDeletion{Reason: reason, Note: note}, nil
+}
+
+// UpdateHost edits a host's display name and description
+// @Summary     Update host details
+// @Description Sets the display name and description of a host in the authenticated user's organization. Omitted fields are left unchanged and an empty string clears a field.
+// @Description The display name is shown as the host's name in host listings; the hostname reported by the agent is kept and still updated by ingest.
+// @Description With If-Match set to the ETag of GET /hosts/{host_id}, the host is only updated if its tags and details have not changed since.
+// @Tags        Hosts
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id   path      string                    true   "Host ID (UUID)"
+// @Param       If-Match  header    string                    false  "ETag of the host's tags and details"
+// @Param       request   body      models.UpdateHostRequest  true   "Fields to update"
+// @Success     200      {object}  models.HostDetailsResponse  "Host updated"
+// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     404      {object}  map[string]string  "Host not found"
+// @Failure     412      {object}  map[string]string  "Host tags or details changed since If-Match was read"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/{host_id} [patch]
+func (h *Handlers) UpdateHost(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req models.UpdateHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if req.DisplayName == nil && req.Description == nil {
+		_ = c.Error(apierror.Validation("no fields to update").WithDetail("Set display_name, description, or both"))
+		return
+	}
+	if req.DisplayName != nil {
+		trimmed := strings.TrimSpace(*req.DisplayName)
+		req.DisplayName = &trimmed
+	}
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	// Editors restricted by a tag policy cannot edit hosts they cannot see
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to update host", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	event, err := h.store(c).UpdateHostDetails(hostID, orgID, req, middleware.GetUserID(c), ifVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("host not found"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Msg("Failed to update host details")
+		_ = c.Error(apierror.Internal("failed to update host", err))
+		return
+	}
+	h.setHostETag(c, hostID, orgID)
+
+	details := *event.Payload.Details
+	c.JSON(http.StatusOK, models.HostDetailsResponse{
+		HostID:      hostID,
+		Hostname:    event.Hostname,
+		Name:        models.HostName(event.Hostname, details.DisplayName),
+		DisplayName: details.DisplayName,
+		Description: details.Description,
+	})
+}
+
 // GetOpenAPISpecYAML returns the OpenAPI specification in YAML format
 // @Summary     OpenAPI specification (YAML)
 // @Description Returns the OpenAPI 3.0 specification in YAML format (generated from code annotations)
@@ -286,25 +1610,13 @@ func (h *Handlers) DeleteHost(c *gin.Context) {
 // @Success     200  {string}  string  "OpenAPI specification"
 // @Router      /openapi.yaml [get]
 func (h *Handlers) GetOpenAPISpecYAML(c *gin.Context) {
-	// Try to find the spec file relative to the executable or current working directory
-	specPath := h.findSpecFile("docs/swagger.yaml")
-	if specPath == "" {
-		specPath = h.findSpecFile("openapi.yaml")
-	}
-
-	if specPath == "" {
-		logger.Logger.Warn().Msg("Failed to find OpenAPI spec file")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load OpenAPI specification"})
-		return
-	}
-
-	specData, err := os.ReadFile(specPath)
+	specData, source, err := h.loadOpenAPISpecYAML()
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
-			Str("spec_path", specPath).
-			Msg("Failed to read OpenAPI spec")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load OpenAPI specification"})
+			Str("spec_source", source).
+			Msg("Failed to load OpenAPI spec")
+		_ = c.Error(apierror.Internal("failed to load OpenAPI specification", err))
 		return
 	}
 
@@ -313,101 +1625,29 @@ func (h *Handlers) GetOpenAPISpecYAML(c *gin.Context) {
 
 // GetOpenAPISpecJSON returns the OpenAPI specification in JSON format
 // @Summary     OpenAPI specification (JSON)
-// @Description Returns the OpenAPI 3.0 specification in JSON format (generated from code annotations)
+// @Description Returns the OpenAPI 3.0 specification in JSON format (generated from code annotations). Operations restricted to some roles carry x-required-roles.
+// @Description With role, only the operations that role can call are included; operations for system administrators are left out of every role-scoped spec.
 // @Tags        Health
 // @Produce     application/json
-// @Success     200  {object}  map[string]interface{}  "OpenAPI specification"
+// @Param       role  query     string                  false  "Only include operations this role can call"  Enums(viewer, editor, admin)
+// @Success     200   {object}  map[string]interface{}  "OpenAPI specification"
+// @Failure     400   {object}  map[string]string       "Invalid role"
 // @Router      /openapi.json [get]
 func (h *Handlers) GetOpenAPISpecJSON(c *gin.Context) {
-	// Try to find the spec file relative to the executable or current working directory
-	specPath := h.findSpecFile("docs/swagger.json")
-	if specPath == "" {
-		// Fallback: try to read YAML and convert
-		specPath = h.findSpecFile("docs/swagger.yaml")
-		if specPath == "" {
-			specPath = h.findSpecFile("openapi.yaml")
-		}
-
-		if specPath == "" {
-			logger.Logger.Warn().Msg("Failed to find OpenAPI spec file")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load OpenAPI specification"})
-			return
-		}
-
-		// Read and parse YAML, then convert to JSON
-		specData, err := os.ReadFile(specPath)
-		if err != nil {
-			logger.FromContext(c).
-				Err(err).
-				Str("spec_path", specPath).
-				Msg("Failed to read OpenAPI spec")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load OpenAPI specification"})
-			return
-		}
-
-		var spec map[string]interface{}
-		if err := yaml.Unmarshal(specData, &spec); err != nil {
-			logger.FromContext(c).
-				Err(err).
-				Str("spec_path", specPath).
-				Msg("Failed to parse OpenAPI spec")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse OpenAPI specification"})
-			return
-		}
-		c.JSON(http.StatusOK, spec)
+	role := c.Query("role")
+	if role != "" && !validateRole(c, role) {
 		return
 	}
 
-	// Read JSON file
-	specData, err := os.ReadFile(specPath)
+	spec, source, err := h.loadOpenAPISpec()
 	if err != nil {
 		logger.FromContext(c).
 			Err(err).
-			Str("spec_path", specPath).
-			Msg("Failed to read OpenAPI spec")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load OpenAPI specification"})
+			Str("spec_source", source).
+			Msg("Failed to load OpenAPI spec")
+		_ = c.Error(apierror.Internal("failed to load OpenAPI specification", err))
 		return
 	}
 
-	// Parse and return JSON
-	var spec map[string]interface{}
-	if err := json.Unmarshal(specData, &spec); err != nil {
-		logger.FromContext(c).
-			Err(err).
-			Str("spec_path", specPath).
-			Msg("Failed to parse OpenAPI spec JSON")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse OpenAPI specification"})
-		return
-	}
-
-	c.JSON(http.StatusOK, spec)
-}
-
-// findSpecFile tries to locate a spec file in multiple possible locations
-func (h *Handlers) findSpecFile(relativePath string) string {
-	// Try current working directory first
-	if _, err := os.Stat(relativePath); err == nil {
-		return relativePath
-	}
-
-	// Try relative to executable location
-	execPath, err := os.Executable()
-	if err == nil {
-		execDir := filepath.Dir(execPath)
-		absPath := filepath.Join(execDir, relativePath)
-		if _, err := os.Stat(absPath); err == nil {
-			return absPath
-		}
-	}
-
-	// Try relative to current working directory with absolute path
-	wd, err := os.Getwd()
-	if err == nil {
-		absPath := filepath.Join(wd, relativePath)
-		if _, err := os.Stat(absPath); err == nil {
-			return absPath
-		}
-	}
-
-	return ""
+	c.JSON(http.StatusOK, h.scopeSpec(spec, role))
 }
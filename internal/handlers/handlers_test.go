@@ -3,22 +3,32 @@ package handlers
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"snailbus/internal/hostlimit"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/middleware"
 	"snailbus/internal/models"
+	"snailbus/internal/payload"
+	"snailbus/internal/receipts"
 	"snailbus/internal/storage"
 )
 
 func setupTestRouter(h *Handlers) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	r.Use(middleware.ErrorHandler())
 	return r
 }
 
@@ -282,6 +292,499 @@ func TestHandlers_Ingest_Gzip(t *testing.T) {
 	assert.Equal(t, "ok", response.Status)
 }
 
+func TestHandlers_Ingest_GzipTooLarge(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithMaxDecompressedSize(1024))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+
+	// A small compressed body that expands past the limit
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(bytes.Repeat([]byte(" "), 1<<20))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "decompressed request body is too large")
+
+	// A body cut off by the request size limit is also answered with 413
+	r.POST("/ingest-limited", func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 16)
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+	req = httptest.NewRequest(http.MethodPost, "/ingest-limited", bytes.NewReader(bytes.Repeat([]byte(" "), 64)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestHandlers_Ingest_BinaryEncodings(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	ingest := func(contentType, accept string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, format := range []payload.Format{payload.FormatCBOR, payload.FormatMsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			body, err := payload.Marshal(format, models.IngestRequest{
+				Meta: models.ReportMeta{HostID: hostID, Hostname: "sensor-" + string(format)},
+				Data: json.RawMessage(`{"system": {"os_name": "Fedora", "cpus": 4}}`),
+			})
+			require.NoError(t, err)
+
+			// Without Accept the response is encoded like the request
+			w := ingest(format.ContentType(), "", body)
+			require.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, format.ContentType(), w.Header().Get("Content-Type"))
+			document, err := payload.ToJSON(format, w.Body.Bytes(), 0)
+			require.NoError(t, err)
+			var response models.IngestResponse
+			require.NoError(t, json.Unmarshal(document, &response))
+			assert.Equal(t, "ok", response.Status)
+			checksum := sha256.Sum256(body)
+			assert.Equal(t, receipts.Checksum(checksum[:]), response.Receipt.Checksum, "the receipt covers the body as sent")
+
+			host, err := mockStore.GetHost(hostID, org.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "sensor-"+string(format), host.Meta.Hostname)
+			assert.JSONEq(t, `{"system": {"os_name": "Fedora", "cpus": 4}}`, string(host.Data), "stored as JSON")
+
+			w = ingest(format.ContentType(), "application/json", body)
+			require.Equal(t, http.StatusCreated, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+			w = ingest(format.ContentType(), "", []byte{0x81})
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			document, err = payload.ToJSON(format, w.Body.Bytes(), 0)
+			require.NoError(t, err, "errors are encoded like the request too")
+			assert.Contains(t, string(document), "invalid "+string(format)+" payload")
+		})
+	}
+
+	// A JSON request may ask for a binary response
+	w := ingest("application/json", payload.ContentTypeCBOR, []byte(`{"meta": {"host_id": "`+hostID+`", "hostname": "web-1"}, "data": {}}`))
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, payload.ContentTypeCBOR, w.Header().Get("Content-Type"))
+}
+
+func TestHandlers_Ingest_JSONLimits(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithJSONLimits(jsonlimit.Limits{MaxDepth: 4, MaxKeys: 20, MaxStringLength: 64}))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+
+	meta := `"meta": {"host_id": "00000000-0000-0000-0000-000000000001", "hostname": "test-host"}`
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedLimit  string
+	}{
+		{"within limits", `{` + meta + `, "data": {"system": {"os": "Fedora"}}}`, http.StatusCreated, ""},
+		{"too deep", `{` + meta + `, "data": {"a": {"b": {"c": {}}}}}`, http.StatusUnprocessableEntity, jsonlimit.LimitDepth},
+		{"too many keys", `{` + meta + `, "data": {` + strings.Repeat(`"k": 1, `, 20) + `"last": 1}}`, http.StatusUnprocessableEntity, jsonlimit.LimitKeys},
+		{"string too long", `{` + meta + `, "data": {"motd": "` + strings.Repeat("x", 65) + `"}}`, http.StatusUnprocessableEntity, jsonlimit.LimitStringLength},
+		{"invalid JSON", `{` + meta, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(tt.body)))
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedLimit != "" {
+				var response map[string]interface{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedLimit, response["limit"])
+				assert.NotEmpty(t, response["message"])
+			}
+		})
+	}
+}
+
+func TestHandlers_Ingest_SameHostIDInTwoOrgs(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org1, _ := mockStore.CreateOrganization("Org 1")
+	org2, _ := mockStore.CreateOrganization("Org 2")
+	user1, _ := mockStore.CreateUser("user1", "user1@example.com", "hash", org1.ID, "admin")
+	user2, _ := mockStore.CreateUser("user2", "user2@example.com", "hash", org2.ID, "admin")
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	ingest := func(user *models.User, hostname string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.POST("/ingest", func(c *gin.Context) {
+			c.Set("user_id", user.ID)
+			c.Set("user", user)
+			h.Ingest(c)
+		})
+		body := `{"meta": {"host_id": "` + hostID + `", "hostname": "` + hostname + `"}, "data": {}}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+		return w
+	}
+
+	// Agents in two organizations that generated the same host ID are separate hosts
+	require.Equal(t, http.StatusCreated, ingest(user1, "org1-host").Code)
+	w := ingest(user2, "org2-host")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	report1, err := mockStore.GetHost(hostID, org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "org1-host", report1.Meta.Hostname)
+	report2, err := mockStore.GetHost(hostID, org2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "org2-host", report2.Meta.Hostname)
+
+	// Deleting one organization's copy leaves the other in place
+	require.NoError(t, mockStore.DeleteHost(hostID, org2.ID, user2.ID, nil))
+	_, err = mockStore.GetHost(hostID, org1.ID)
+	assert.NoError(t, err)
+}
+
+func TestHandlers_Ingest_Timestamp(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithMaxClockSkew(time.Hour))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	ingest := func(timestamp string) *httptest.ResponseRecorder {
+		body := `{"meta": {"host_id": "` + hostID + `", "hostname": "test-host", "timestamp": "` + timestamp + `"}, "data": {}}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, ingest("yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, ingest(time.Now().Add(2*time.Hour).Format(time.RFC3339)).Code)
+
+	// Offsets are normalized to UTC and zone-less timestamps are taken to be UTC
+	tests := []struct {
+		timestamp string
+		want      string
+	}{
+		{"2025-01-02T17:04:05+02:00", "2025-01-02T15:04:05Z"},
+		{"2025-01-02T15:04:05.25", "2025-01-02T15:04:05.25Z"},
+		{"2025-01-02 15:04:05Z", "2025-01-02T15:04:05Z"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, http.StatusCreated, ingest(tt.timestamp).Code, tt.timestamp)
+		report, err := mockStore.GetHost(hostID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, report.Meta.Timestamp)
+	}
+
+	hosts, err := mockStore.ListHosts(org.ID, false)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	require.NotNil(t, hosts[0].CollectedAt)
+	assert.Equal(t, time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC), *hosts[0].CollectedAt)
+}
+
+func TestHandlers_Ingest_HostRateLimit(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	limits, err := hostlimit.New("2-M", map[string]string{"00000000-0000-0000-0000-00000000000f": "off"})
+	require.NoError(t, err)
+	h := New(mockStore, WithHostRateLimits(limits))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+	ingest := func(hostID string) *httptest.ResponseRecorder {
+		body := `{"meta": {"host_id": "` + hostID + `", "hostname": "test-host"}, "data": {}}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+		return w
+	}
+
+	const noisy = "00000000-0000-0000-0000-000000000001"
+	w := ingest(noisy)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, http.StatusCreated, ingest(noisy).Code)
+
+	w = ingest(noisy)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "host rate limit exceeded", body["error"])
+	assert.Equal(t, noisy, body["host_id"])
+	assert.Contains(t, body["message"], "collection schedule")
+
+	// Other hosts in the organization are unaffected, and exempt hosts are not counted
+	assert.Equal(t, http.StatusCreated, ingest("00000000-0000-0000-0000-000000000002").Code)
+	for i := 0; i < 5; i++ {
+		w = ingest("00000000-0000-0000-0000-00000000000f")
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
+
+func TestHandlers_Ingest_Health(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		h.Ingest(c)
+	})
+	r.GET("/hosts", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.ListHosts(c)
+	})
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	ingest := func(health string) *httptest.ResponseRecorder {
+		body := `{"meta": {"host_id": "` + hostID + `", "hostname": "test-host"}, "data": {}, "health": ` + health + `}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+		return w
+	}
+
+	invalid := []string{
+		`{"status": "degraded"}`,
+		`{"status": "ok", "checks": [{"name": "", "status": "ok"}]}`,
+		`{"status": "ok", "checks": [{"name": "disk", "status": "broken"}]}`,
+		`{"status": "ok", "checks": [{"name": "disk", "status": "ok", "message": "` + strings.Repeat("x", models.MaxHealthCheckMessageLength+1) + `"}]}`,
+	}
+	for _, health := range invalid {
+		w := ingest(health)
+		assert.Equal(t, http.StatusBadRequest, w.Code, health)
+		assert.Contains(t, w.Body.String(), "invalid health in report")
+	}
+
+	// Statuses are case-insensitive
+	w := ingest(`{"status": "Warning", "checks": [{"name": "disk:/var", "status": "WARNING", "message": "92% used"}]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	report, err := mockStore.GetHost(hostID, org.ID)
+	require.NoError(t, err)
+	require.NotNil(t, report.Health)
+	assert.Equal(t, models.HealthWarning, report.Health.Status)
+	assert.Equal(t, []models.HealthCheck{{Name: "disk:/var", Status: models.HealthWarning, Message: "92% used"}}, report.Health.Checks)
+
+	listHosts := func(q string) []*models.HostSummary {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts?q="+q, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Hosts []*models.HostSummary `json:"hosts"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Hosts
+	}
+	hosts := listHosts("health:warning,critical")
+	require.Len(t, hosts, 1)
+	require.NotNil(t, hosts[0].Health)
+	assert.Equal(t, models.HealthWarning, hosts[0].Health.Status)
+	assert.Empty(t, listHosts("health:ok"))
+}
+
+func TestHandlers_ListHosts_HasSection(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	reports := map[string]string{
+		"00000000-0000-0000-0000-000000000001": `{"packages": {"installed": []}, "docker": {"containers": [{"id": "abc"}]}}`,
+		"00000000-0000-0000-0000-000000000002": `{"packages": {"installed": []}, "docker": {}, "network": {"interfaces": []}}`,
+		"00000000-0000-0000-0000-000000000003": `{"podman": {"containers": []}, "network": {"interfaces": [{"name": "eth0"}]}, "docker": null}`,
+	}
+	for hostID, data := range reports {
+		err := mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(data),
+		}, org.ID, user.ID)
+		require.NoError(t, err)
+	}
+
+	r := setupTestRouter(h)
+	r.GET("/hosts", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.ListHosts(c)
+	})
+
+	list := func(query string) (int, []*models.HostSummary) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts?"+query, nil))
+		var response struct {
+			Hosts []*models.HostSummary `json:"hosts"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Hosts
+	}
+	hostnames := func(hosts []*models.HostSummary) []string {
+		names := []string{}
+		for _, host := range hosts {
+			names = append(names, host.Hostname)
+		}
+		return names
+	}
+
+	code, hosts := list("")
+	require.Equal(t, http.StatusOK, code)
+	sections := map[string][]string{}
+	for _, host := range hosts {
+		sections[host.Hostname] = host.Sections
+	}
+	// Empty and null sections do not count
+	assert.Equal(t, map[string][]string{
+		"1": {"docker", "packages"},
+		"2": {"network", "packages"},
+		"3": {"network", "podman"},
+	}, sections)
+
+	_, hosts = list("has_section=docker")
+	assert.ElementsMatch(t, []string{"1"}, hostnames(hosts))
+
+	_, hosts = list("has_section=docker,podman")
+	assert.ElementsMatch(t, []string{"1", "3"}, hostnames(hosts))
+
+	_, hosts = list("has_section=packages&has_section=network")
+	assert.ElementsMatch(t, []string{"2"}, hostnames(hosts))
+
+	// has_section combines with q
+	_, hosts = list("has_section=network&q=-section:podman")
+	assert.ElementsMatch(t, []string{"2"}, hostnames(hosts))
+
+	code, _ = list("has_section=")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestHandlers_ListHosts_Status(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	now := time.Now().UTC()
+	for hostID, seen := range map[string]time.Time{
+		"00000000-0000-0000-0000-000000000001": now,
+		"00000000-0000-0000-0000-000000000002": now.Add(-48 * time.Hour),
+	} {
+		err := mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: seen,
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, user.ID)
+		require.NoError(t, err)
+	}
+	_, err := mockStore.MarkStaleHosts(org.ID, map[string]time.Time{"00000000-0000-0000-0000-000000000002": now.Add(-48 * time.Hour)}, now)
+	require.NoError(t, err)
+
+	r := setupTestRouter(h)
+	r.GET("/hosts", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.ListHosts(c)
+	})
+
+	list := func(query string) (int, []*models.HostSummary) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts?"+query, nil))
+		var response struct {
+			Hosts []*models.HostSummary `json:"hosts"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Hosts
+	}
+
+	code, hosts := list("status=stale")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "2", hosts[0].Hostname)
+	assert.Equal(t, models.HostStatusStale, hosts[0].Status)
+	require.NotNil(t, hosts[0].StaleSince)
+
+	_, hosts = list("status=active")
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "1", hosts[0].Hostname)
+	assert.Nil(t, hosts[0].StaleSince)
+
+	_, hosts = list("status=active,stale&limit=10")
+	assert.Len(t, hosts, 2)
+	_, hosts = list("q=status:stale")
+	assert.Len(t, hosts, 1)
+
+	code, _ = list("status=offline")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
 func TestHandlers_ListHosts(t *testing.T) {
 	mockStore := storage.NewMockStorage()
 	h := New(mockStore)
@@ -358,6 +861,84 @@ func TestHandlers_ListHosts(t *testing.T) {
 	}
 }
 
+func TestHandlers_ListHosts_Paginated(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		hostID := fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i)
+		err := mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: now.Add(time.Duration(i) * time.Minute),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: fmt.Sprintf("host%d", i)},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, user.ID)
+		require.NoError(t, err)
+	}
+
+	r := setupTestRouter(h)
+	r.GET("/hosts", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.ListHosts(c)
+	})
+
+	type pageResponse struct {
+		Hosts      []*models.HostSummary `json:"hosts"`
+		Total      int                   `json:"total"`
+		Limit      int                   `json:"limit"`
+		HasMore    bool                  `json:"has_more"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	list := func(query string) (int, pageResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts?"+query, nil))
+		var response pageResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	var hostnames []string
+	query := "limit=2"
+	for pages := 0; pages < 5; pages++ {
+		code, page := list(query)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 5, page.Total)
+		assert.Equal(t, 2, page.Limit)
+		for _, host := range page.Hosts {
+			hostnames = append(hostnames, host.Hostname)
+		}
+		if !page.HasMore {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		query = "limit=2&cursor=" + page.NextCursor
+	}
+	// Newest report first
+	assert.Equal(t, []string{"host5", "host4", "host3", "host2", "host1"}, hostnames)
+
+	// Searches are paged after filtering
+	code, page := list("q=hostname:host1,host2,host3&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Hosts, 2)
+	assert.True(t, page.HasMore)
+
+	// Without limit or cursor every host is returned
+	code, page = list("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, page.Hosts, 5)
+	assert.False(t, page.HasMore)
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "cursor=bogus"} {
+		code, _ := list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
 func TestHandlers_GetHost(t *testing.T) {
 	mockStore := storage.NewMockStorage()
 	h := New(mockStore)
@@ -442,6 +1023,94 @@ func TestHandlers_GetHost(t *testing.T) {
 	}
 }
 
+func TestHandlers_GetHost_Selection(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	hostID := "00000000-0000-0000-0000-000000000001"
+	mockStore.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "test-host"},
+		Data:       json.RawMessage(`{"system": {"os_name": "Fedora", "packages": ["bash"]}, "network": {"interfaces": [{"name": "eth0"}]}}`),
+		Errors:     []string{"disk collector failed"},
+	}, org.ID, user.ID)
+
+	r := setupTestRouter(h)
+	r.GET("/hosts/:host_id", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.GetHost(c)
+	})
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/hosts/"+hostID+"?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantKeys []string
+		wantData string
+	}{
+		{
+			name:     "fields without data",
+			query:    "fields=meta,errors",
+			wantKeys: []string{"errors", "id", "meta"},
+		},
+		{
+			name:     "data paths",
+			query:    "path=system.packages,network.interfaces,missing.key",
+			wantKeys: []string{"data", "errors", "id", "meta", "received_at"},
+			wantData: `{"network": {"interfaces": [{"name": "eth0"}]}, "system": {"packages": ["bash"]}}`,
+		},
+		{
+			name:     "path implies data",
+			query:    "fields=meta&path=system.os_name",
+			wantKeys: []string{"data", "id", "meta"},
+			wantData: `{"system": {"os_name": "Fedora"}}`,
+		},
+		{
+			name:     "enclosing path",
+			query:    "fields=data&path=system.os_name,system",
+			wantKeys: []string{"data", "id"},
+			wantData: `{"system": {"os_name": "Fedora", "packages": ["bash"]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.query)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			keys := make([]string, 0, len(response))
+			for key := range response {
+				keys = append(keys, key)
+			}
+			assert.ElementsMatch(t, tt.wantKeys, keys)
+			assert.JSONEq(t, `"`+hostID+`"`, string(response["id"]))
+			if tt.wantData != "" {
+				assert.JSONEq(t, tt.wantData, string(response["data"]))
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"fields=meta,secrets",
+		"path=system..packages",
+		"path=" + strings.Repeat("a,", storage.MaxHostDataPaths) + "a",
+		"path=" + strings.Repeat("a", storage.MaxHostDataPathLength+1),
+	} {
+		w := get(query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
 func TestHandlers_DeleteHost(t *testing.T) {
 	mockStore := storage.NewMockStorage()
 	h := New(mockStore)
@@ -518,3 +1187,81 @@ func TestHandlers_DeleteHost(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlers_UpdateHost(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "ip-10-0-0-1"},
+		Data:       json.RawMessage(`{}`),
+	}, org.ID, user.ID))
+
+	patch := func(hostID, body string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.PATCH("/hosts/:host_id", func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", org.ID)
+			h.UpdateHost(c)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/hosts/"+hostID, strings.NewReader(body)))
+		return w
+	}
+	listed := func() *models.HostSummary {
+		hosts, err := mockStore.ListHosts(org.ID, false)
+		require.NoError(t, err)
+		require.Len(t, hosts, 1)
+		return hosts[0]
+	}
+
+	w := patch(hostID, `{"display_name": " web-frontend ", "description": "Public web server"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.HostDetailsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.HostDetailsResponse{
+		HostID:      hostID,
+		Hostname:    "ip-10-0-0-1",
+		Name:        "web-frontend",
+		DisplayName: "web-frontend",
+		Description: "Public web server",
+	}, response)
+
+	host := listed()
+	assert.Equal(t, "ip-10-0-0-1", host.Hostname)
+	assert.Equal(t, "web-frontend", host.Name)
+	assert.Equal(t, "Public web server", host.Description)
+
+	// Omitted fields are unchanged
+	require.Equal(t, http.StatusOK, patch(hostID, `{"description": "Moved to new rack"}`).Code)
+	assert.Equal(t, "web-frontend", listed().DisplayName)
+
+	// Ingest updates the hostname but keeps the display name
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "ip-10-0-0-2"},
+		Data:       json.RawMessage(`{}`),
+	}, org.ID, user.ID))
+	host = listed()
+	assert.Equal(t, "ip-10-0-0-2", host.Hostname)
+	assert.Equal(t, "web-frontend", host.Name)
+
+	// An empty display name falls back to the hostname
+	require.Equal(t, http.StatusOK, patch(hostID, `{"display_name": ""}`).Code)
+	host = listed()
+	assert.Equal(t, "ip-10-0-0-2", host.Name)
+	assert.Empty(t, host.DisplayName)
+	assert.Equal(t, "Moved to new rack", host.Description)
+
+	assert.Equal(t, http.StatusBadRequest, patch(hostID, `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(hostID, `{"display_name": "`+strings.Repeat("x", 256)+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, patch("00000000-0000-0000-0000-000000000999", `{"display_name": "x"}`).Code)
+}
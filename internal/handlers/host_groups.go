@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+	"snailbus/internal/storage"
+)
+
+// hostGroupMembers returns the IDs of a group's hosts: its static members and, if it has a
+// rule, the hosts matching it. Static members are included even if they are archived; the
+// caller's host list decides which hosts are shown.
+func (h *Handlers) hostGroupMembers(c *gin.Context, group *models.HostGroup, orgID string, includeArchived bool) (map[string]bool, error) {
+	members := make(map[string]bool, len(group.HostIDs))
+	for _, hostID := range group.HostIDs {
+		members[hostID] = true
+	}
+	if group.Rule == "" {
+		return members, nil
+	}
+
+	// Rules are validated when they are saved
+	query, err := search.Parse(group.Rule)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := h.store(c).SearchHosts(orgID, query, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range matched {
+		members[host.HostID] = true
+	}
+	return members, nil
+}
+
+// filterHostGroupMembers keeps the hosts in members
+func filterHostGroupMembers(hosts []*models.HostSummary, members map[string]bool) []*models.HostSummary {
+	kept := make([]*models.HostSummary, 0, len(hosts))
+	for _, host := range hosts {
+		if members[host.HostID] {
+			kept = append(kept, host)
+		}
+	}
+	return kept
+}
+
+// bindHostGroupRequest reads a group definition
+func bindHostGroupRequest(c *gin.Context) (*models.HostGroupRequest, error) {
+	var req models.HostGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, apierror.Validation(err.Error())
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Rule = strings.TrimSpace(req.Rule)
+	if req.Name == "" {
+		return nil, apierror.Validation("name is required").WithField("name")
+	}
+	if req.Rule != "" {
+		if _, err := search.Parse(req.Rule); err != nil {
+			return nil, apierror.Validation("invalid rule").WithDetail(err.Error()).WithField("rule")
+		}
+	}
+	return &req, nil
+}
+
+// ListHostGroups returns the organization's host groups
+// @Summary     List host groups
+// @Description Returns the organization's host groups with their static members, by name. List a group's hosts with GET /api/v1/hosts?group_id=.
+// @Description Users with a tag-based host access policy only see the static members they can see.
+// @Tags        Host Groups
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Groups with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/groups [get]
+func (h *Handlers) ListHostGroups(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	groups, err := h.store(c).ListHostGroups(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list host groups", err))
+		return
+	}
+	if err := h.hideHostGroupMembers(c, orgID, groups...); err != nil {
+		_ = c.Error(apierror.Internal("failed to list host groups", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+		"total":  len(groups),
+	})
+}
+
+// CreateHostGroup creates a host group
+// @Summary     Create host group
+// @Description Creates a group of hosts, such as an environment. A group has static members, added with PUT /api/v1/groups/{group_id}/hosts/{host_id}, and an optional rule: a search query as accepted by GET /api/v1/hosts?q= (e.g. `os:fedora tag:env=prod`) whose matching hosts are members too.
+// @Description Requires editor or admin role.
+// @Tags        Host Groups
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.HostGroupRequest  true  "Group name, description, and rule"
+// @Success     201      {object}  models.HostGroup   "Group created"
+// @Failure     400      {object}  map[string]string  "Invalid request or rule"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     403      {object}  map[string]string  "Editor or admin role required"
+// @Failure     409      {object}  map[string]string  "Group name already exists"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups [post]
+func (h *Handlers) CreateHostGroup(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	req, err := bindHostGroupRequest(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	group := &models.HostGroup{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		Rule:        req.Rule,
+		CreatedBy:   middleware.GetUserID(c),
+	}
+	if err := h.store(c).CreateHostGroup(group, orgID); err != nil {
+		// A taken name is reported as the storage conflict
+		_ = c.Error(apierror.Wrap(err, "failed to create host group"))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("group_id", group.ID).
+		Str("rule", group.Rule).
+		Msg("Host group created")
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// GetHostGroup returns a host group with its host count
+// @Summary     Get host group
+// @Description Returns a host group with its static members and host_count, the number of hosts in the group (static members and hosts matching its rule) that the user can see, leaving out archived hosts.
+// @Tags        Host Groups
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       group_id  path      string  true  "Host group ID (UUID)"
+// @Success     200       {object}  models.HostGroup   "Host group"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     404       {object}  map[string]string  "Host group not found"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups/{group_id} [get]
+func (h *Handlers) GetHostGroup(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	group, err := h.hostGroup(c, c.Param("group_id"), orgID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	count, err := h.countHostGroupMembers(c, group, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to get host group", err))
+		return
+	}
+	group.HostCount = &count
+
+	if err := h.hideHostGroupMembers(c, orgID, group); err != nil {
+		_ = c.Error(apierror.Internal("failed to get host group", err))
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// countHostGroupMembers counts the group's non-archived hosts that the user can see
+func (h *Handlers) countHostGroupMembers(c *gin.Context, group *models.HostGroup, orgID string) (int, error) {
+	members, err := h.hostGroupMembers(c, group, orgID, false)
+	if err != nil {
+		return 0, err
+	}
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		return 0, err
+	}
+	hosts, err := h.store(c).ListHosts(orgID, false)
+	if err != nil {
+		return 0, err
+	}
+	return len(filterHostGroupMembers(policy.FilterHosts(hosts), members)), nil
+}
+
+// UpdateHostGroup replaces a host group's definition
+// @Summary     Update host group
+// @Description Replaces a host group's name, description, and rule. Static members are kept. Requires editor or admin role.
+// @Tags        Host Groups
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       group_id  path      string                   true  "Host group ID (UUID)"
+// @Param       request   body      models.HostGroupRequest  true  "Group name, description, and rule"
+// @Success     200       {object}  models.HostGroup   "Group updated"
+// @Failure     400       {object}  map[string]string  "Invalid request or rule"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     403       {object}  map[string]string  "Editor or admin role required"
+// @Failure     404       {object}  map[string]string  "Host group not found"
+// @Failure     409       {object}  map[string]string  "Group name already exists"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups/{group_id} [put]
+func (h *Handlers) UpdateHostGroup(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	req, err := bindHostGroupRequest(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	group := &models.HostGroup{
+		ID:          c.Param("group_id"),
+		Name:        req.Name,
+		Description: req.Description,
+		Rule:        req.Rule,
+	}
+	if err := h.store(c).UpdateHostGroup(group, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host group not found"))
+			return
+		}
+		_ = c.Error(apierror.Wrap(err, "failed to update host group"))
+		return
+	}
+
+	if err := h.hideHostGroupMembers(c, orgID, group); err != nil {
+		_ = c.Error(apierror.Internal("failed to update host group", err))
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteHostGroup deletes a host group
+// @Summary     Delete host group
+// @Description Deletes a host group. Its hosts are not affected. Requires editor or admin role.
+// @Tags        Host Groups
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       group_id  path      string  true  "Host group ID (UUID)"
+// @Success     200       {object}  map[string]string  "Group deleted"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     403       {object}  map[string]string  "Editor or admin role required"
+// @Failure     404       {object}  map[string]string  "Host group not found"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups/{group_id} [delete]
+func (h *Handlers) DeleteHostGroup(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	groupID := c.Param("group_id")
+
+	if err := h.store(c).DeleteHostGroup(groupID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host group not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete host group", err))
+		return
+	}
+
+	logger.FromContext(c).Str("group_id", groupID).Msg("Host group deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "host group deleted"})
+}
+
+// AddHostGroupMember adds a host to a group's static members
+// @Summary     Add host to group
+// @Description Adds a host to a group's static members. Adding a member again does nothing. A deleted host leaves the groups it was added to. Requires editor or admin role.
+// @Tags        Host Groups
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       group_id  path      string  true  "Host group ID (UUID)"
+// @Param       host_id   path      string  true  "Host ID (UUID)"
+// @Success     200       {object}  models.HostGroup   "Group with the host added"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     403       {object}  map[string]string  "Editor or admin role required"
+// @Failure     404       {object}  map[string]string  "Host group or host not found"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups/{group_id}/hosts/{host_id} [put]
+func (h *Handlers) AddHostGroupMember(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	groupID := c.Param("group_id")
+	hostID := c.Param("host_id")
+
+	if _, err := h.hostGroup(c, groupID, orgID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Editors restricted by a tag policy cannot group hosts they cannot see
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to add host to group", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	if err := h.store(c).AddHostGroupMember(groupID, orgID, hostID, middleware.GetUserID(c)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to add host to group", err))
+		return
+	}
+
+	h.respondHostGroup(c, groupID, orgID)
+}
+
+// RemoveHostGroupMember removes a host from a group's static members
+// @Summary     Remove host from group
+// @Description Removes a host from a group's static members. A host matching the group's rule stays in the group. Requires editor or admin role.
+// @Tags        Host Groups
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       group_id  path      string  true  "Host group ID (UUID)"
+// @Param       host_id   path      string  true  "Host ID (UUID)"
+// @Success     200       {object}  models.HostGroup   "Group with the host removed"
+// @Failure     401       {object}  map[string]string  "Unauthorized"
+// @Failure     403       {object}  map[string]string  "Editor or admin role required"
+// @Failure     404       {object}  map[string]string  "Host group not found or host not a static member"
+// @Failure     500       {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/groups/{group_id}/hosts/{host_id} [delete]
+func (h *Handlers) RemoveHostGroupMember(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	groupID := c.Param("group_id")
+	hostID := c.Param("host_id")
+
+	if _, err := h.hostGroup(c, groupID, orgID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := h.store(c).RemoveHostGroupMember(groupID, orgID, hostID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host is not a member of the group"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to remove host from group", err))
+		return
+	}
+
+	h.respondHostGroup(c, groupID, orgID)
+}
+
+// hostGroup loads a group of the organization
+func (h *Handlers) hostGroup(c *gin.Context, groupID, orgID string) (*models.HostGroup, error) {
+	group, err := h.store(c).GetHostGroup(groupID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, apierror.NotFound("host group not found")
+		}
+		return nil, apierror.Internal("failed to get host group", err)
+	}
+	return group, nil
+}
+
+// hideHostGroupMembers drops the static members of groups that the user may not see
+func (h *Handlers) hideHostGroupMembers(c *gin.Context, orgID string, groups ...*models.HostGroup) error {
+	visible, err := h.visibleHostIDs(c, orgID)
+	if err != nil || visible == nil {
+		return err
+	}
+	for _, group := range groups {
+		kept := make([]string, 0, len(group.HostIDs))
+		for _, hostID := range group.HostIDs {
+			if visible[hostID] {
+				kept = append(kept, hostID)
+			}
+		}
+		group.HostIDs = kept
+	}
+	return nil
+}
+
+// respondHostGroup answers a membership change with the group's static members
+func (h *Handlers) respondHostGroup(c *gin.Context, groupID, orgID string) {
+	group, err := h.hostGroup(c, groupID, orgID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := h.hideHostGroupMembers(c, orgID, group); err != nil {
+		_ = c.Error(apierror.Internal("failed to get host group", err))
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_HostGroups(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	hosts := []struct {
+		id, hostname, os, tag string
+	}{
+		{"00000000-0000-0000-0000-000000000001", "web-01", "Fedora", "team:web"},
+		{"00000000-0000-0000-0000-000000000002", "web-02", "Fedora", "team:web"},
+		{"00000000-0000-0000-0000-000000000003", "db-01", "Debian", "team:db"},
+		{"00000000-0000-0000-0000-000000000004", "ci-01", "Debian", "team:ci"},
+	}
+	for _, host := range hosts {
+		mockStore.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: host.hostname},
+			Data:       json.RawMessage(`{"system":{"os":{"name":"` + host.os + `"}}}`),
+		}, org.ID, admin.ID)
+		require.NoError(t, mockStore.SetHostTags(host.id, org.ID, []string{host.tag}, admin.ID, 0))
+	}
+
+	do := func(user *models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+			c.Set("role", user.Role)
+		})
+		r.GET("/hosts", h.ListHosts)
+		r.GET("/groups", h.ListHostGroups)
+		r.POST("/groups", h.CreateHostGroup)
+		r.GET("/groups/:group_id", h.GetHostGroup)
+		r.PUT("/groups/:group_id", h.UpdateHostGroup)
+		r.DELETE("/groups/:group_id", h.DeleteHostGroup)
+		r.PUT("/groups/:group_id/hosts/:host_id", h.AddHostGroupMember)
+		r.DELETE("/groups/:group_id/hosts/:host_id", h.RemoveHostGroupMember)
+
+		var reqBody []byte
+		if body != nil {
+			reqBody, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	groupHostnames := func(user *models.User, groupID string) []string {
+		w := do(user, http.MethodGet, "/hosts?group_id="+groupID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Hosts []models.HostSummary `json:"hosts"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		names := []string{}
+		for _, host := range resp.Hosts {
+			names = append(names, host.Hostname)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// A dynamic group matching a search rule
+	w := do(admin, http.MethodPost, "/groups", models.HostGroupRequest{Name: " fedora ", Rule: "os:fedora"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var fedora models.HostGroup
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fedora))
+	assert.Equal(t, "fedora", fedora.Name)
+	assert.Equal(t, admin.ID, fedora.CreatedBy)
+	assert.Equal(t, []string{"web-01", "web-02"}, groupHostnames(admin, fedora.ID))
+
+	// Names are unique in the organization and rules must parse
+	assert.Equal(t, http.StatusConflict, do(admin, http.MethodPost, "/groups", models.HostGroupRequest{Name: "fedora"}).Code)
+	w = do(admin, http.MethodPost, "/groups", models.HostGroupRequest{Name: "broken", Rule: "os:"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid rule")
+	assert.Equal(t, http.StatusBadRequest, do(admin, http.MethodPost, "/groups", models.HostGroupRequest{Name: "  "}).Code)
+
+	// A static group
+	w = do(admin, http.MethodPost, "/groups", models.HostGroupRequest{Name: "databases", Description: "Primary databases"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var databases models.HostGroup
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &databases))
+	assert.Empty(t, groupHostnames(admin, databases.ID))
+
+	w = do(admin, http.MethodPut, "/groups/"+databases.ID+"/hosts/"+hosts[2].id, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &databases))
+	assert.Equal(t, []string{hosts[2].id}, databases.HostIDs)
+	// Adding a member again does nothing
+	assert.Equal(t, http.StatusOK, do(admin, http.MethodPut, "/groups/"+databases.ID+"/hosts/"+hosts[2].id, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(admin, http.MethodPut, "/groups/"+databases.ID+"/hosts/00000000-0000-0000-0000-000000000099", nil).Code)
+	assert.Equal(t, []string{"db-01"}, groupHostnames(admin, databases.ID))
+
+	// Static members and rule matches combine
+	require.Equal(t, http.StatusOK, do(admin, http.MethodPut, "/groups/"+fedora.ID+"/hosts/"+hosts[3].id, nil).Code)
+	assert.Equal(t, []string{"ci-01", "web-01", "web-02"}, groupHostnames(admin, fedora.ID))
+
+	w = do(admin, http.MethodGet, "/groups/"+fedora.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got models.HostGroup
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.NotNil(t, got.HostCount)
+	assert.Equal(t, 3, *got.HostCount)
+
+	w = do(admin, http.MethodGet, "/groups", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listResp struct {
+		Groups []models.HostGroup `json:"groups"`
+		Total  int                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResp))
+	assert.Equal(t, 2, listResp.Total)
+	assert.Equal(t, "databases", listResp.Groups[0].Name)
+
+	// Changing the rule keeps static members
+	w = do(admin, http.MethodPut, "/groups/"+fedora.ID, models.HostGroupRequest{Name: "debian", Rule: "os:debian"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"ci-01", "db-01"}, groupHostnames(admin, fedora.ID))
+	assert.Equal(t, http.StatusConflict, do(admin, http.MethodPut, "/groups/"+fedora.ID, models.HostGroupRequest{Name: "databases"}).Code)
+
+	// Removing a static member
+	require.Equal(t, http.StatusOK, do(admin, http.MethodDelete, "/groups/"+databases.ID+"/hosts/"+hosts[2].id, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(admin, http.MethodDelete, "/groups/"+databases.ID+"/hosts/"+hosts[2].id, nil).Code)
+	assert.Empty(t, groupHostnames(admin, databases.ID))
+
+	// Restricted users only see the members they may see
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:ci"}))
+	assert.Equal(t, []string{"ci-01"}, groupHostnames(viewer, fedora.ID))
+	w = do(viewer, http.MethodGet, "/groups/"+fedora.ID, nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, 1, *got.HostCount)
+	assert.Equal(t, []string{hosts[3].id}, got.HostIDs)
+
+	// Deleting a group leaves its hosts
+	require.Equal(t, http.StatusOK, do(admin, http.MethodDelete, "/groups/"+fedora.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(admin, http.MethodGet, "/groups/"+fedora.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(admin, http.MethodGet, "/hosts?group_id="+fedora.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(admin, http.MethodDelete, "/groups/"+fedora.ID, nil).Code)
+	_, err := mockStore.GetHost(hosts[3].id, org.ID)
+	assert.NoError(t, err)
+
+	// Groups are scoped to the organization
+	otherOrg, _ := mockStore.CreateOrganization("Other Org")
+	outsider, _ := mockStore.CreateUser("outsider", "outsider@example.com", "hash", otherOrg.ID, "admin")
+	assert.Equal(t, http.StatusNotFound, do(outsider, http.MethodGet, "/groups/"+databases.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(outsider, http.MethodPut, "/groups/"+databases.ID+"/hosts/"+hosts[0].id, nil).Code)
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/reportdiff"
+	"snailbus/internal/storage"
+)
+
+// hostReportRetention returns how many reports of each host the organization keeps
+func (h *Handlers) hostReportRetention(c *gin.Context, orgID string) (int, error) {
+	retention, err := h.store(c).GetHostReportRetention(orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return h.reportRetention, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return retention.ReportsPerHost, nil
+}
+
+// saveHostReport adds an ingested report to its host's history
+// The report is already stored as the host's current data, so a failure is logged
+// rather than failing the ingest, which the agent would retry.
+func (h *Handlers) saveHostReport(c *gin.Context, orgID, userID string, report *models.Report) {
+	keep, err := h.hostReportRetention(c, orgID)
+	if err == nil {
+		err = h.store(c).SaveHostReport(models.NewHostReport(uuid.New().String(), report, userID), orgID, keep)
+	}
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", report.Meta.HostID).
+			Msg("Failed to save host report history")
+	}
+}
+
+// visibleHost reports whether the host exists and the user may see it, writing a 404 or
+// 500 response when not. failure is the error message of a 500 response.
+func (h *Handlers) visibleHost(c *gin.Context, hostID, orgID, failure string) bool {
+	// Hosts outside the user's tag policy are reported as not found to avoid leaking their existence
+	if _, err := h.store(c).GetHostTags(hostID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
+			return false
+		}
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host")
+		_ = c.Error(apierror.Internal(failure, err))
+		return false
+	}
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal(failure, err))
+		return false
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return false
+	}
+	return true
+}
+
+// ListHostReports returns a host's report history
+// @Summary     List host report history
+// @Description Returns the reports kept for a host in the authenticated user's organization, newest first, without their data; fetch a report by ID for it. The newest is the host's current data.
+// @Description Each report is kept as stored at ingest, after the ingest filter. retention is how many reports the organization keeps per host; older ones are removed when the host reports again.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true  "Host ID (UUID)"
+// @Success     200  {object}  map[string]interface{}  "Reports with total count and retention"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     404  {object}  map[string]string       "Host not found"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/reports [get]
+func (h *Handlers) ListHostReports(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	if !h.visibleHost(c, hostID, orgID, "failed to retrieve host reports") {
+		return
+	}
+
+	reports, err := h.store(c).ListHostReports(hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to list host reports")
+		_ = c.Error(apierror.Internal("failed to retrieve host reports", err))
+		return
+	}
+	retention, err := h.hostReportRetention(c, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host reports", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports":   reports,
+		"total":     len(reports),
+		"retention": retention,
+	})
+}
+
+// GetHostReport returns a report from a host's history
+// @Summary     Get host report
+// @Description Returns a report from a host's history in the authenticated user's organization, with its data as stored at ingest.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id    path      string  true  "Host ID (UUID)"
+// @Param       report_id  path      string  true  "Report ID (UUID) from the host's report history"
+// @Success     200  {object}  models.HostReport  "Report"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     404  {object}  map[string]string  "Host or report not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/reports/{report_id} [get]
+func (h *Handlers) GetHostReport(c *gin.Context) {
+	hostID := c.Param("host_id")
+	reportID := c.Param("report_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	if !h.visibleHost(c, hostID, orgID, "failed to retrieve host report") {
+		return
+	}
+
+	report, err := h.store(c).GetHostReportByID(reportID, hostID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("report not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("host_id", hostID).
+			Str("report_id", reportID).
+			Msg("Failed to get host report")
+		_ = c.Error(apierror.Internal("failed to retrieve host report", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetHostReportDiff compares the data of two reports from a host's history
+// @Summary     Diff host reports
+// @Description Returns the paths added, removed, and changed from the data of one report in a host's history to another's, e.g. which packages were installed or upgraded between two collections.
+// @Description to defaults to the newest report, the host's current data, and from to the report before to, so without parameters the host's last change is returned. Array elements with a unique name or id are matched by it, e.g. packages.installed[name=bash].version; other arrays are compared as sets.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true   "Host ID (UUID)"
+// @Param       from     query     string  false  "Report ID to compare from (default: the report before to)"
+// @Param       to       query     string  false  "Report ID to compare to (default: the newest report)"
+// @Success     200  {object}  models.HostReportDiff  "Changes between the reports"
+// @Failure     401  {object}  map[string]string      "Unauthorized"
+// @Failure     404  {object}  map[string]string      "Host or report not found, or no earlier report to compare with"
+// @Failure     500  {object}  map[string]string      "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/diff [get]
+func (h *Handlers) GetHostReportDiff(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	if !h.visibleHost(c, hostID, orgID, "failed to compare host reports") {
+		return
+	}
+
+	fromID, toID := c.Query("from"), c.Query("to")
+	if fromID == "" || toID == "" {
+		reports, err := h.store(c).ListHostReports(hostID, orgID)
+		if err != nil {
+			logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to list host reports")
+			_ = c.Error(apierror.Internal("failed to compare host reports", err))
+			return
+		}
+		if toID == "" {
+			if len(reports) == 0 {
+				_ = c.Error(apierror.NotFound("report not found").WithDetail("The host has no report history."))
+				return
+			}
+			toID = reports[0].ID
+		}
+		if fromID == "" {
+			// The history is newest first, so the report before to follows it
+			for i, report := range reports {
+				if report.ID == toID && i+1 < len(reports) {
+					fromID = reports[i+1].ID
+					break
+				}
+			}
+			if fromID == "" {
+				_ = c.Error(apierror.NotFound("report not found").WithDetail("There is no earlier report in the host's history to compare with; pass from."))
+				return
+			}
+		}
+	}
+
+	var reports [2]*models.HostReport
+	for i, reportID := range []string{fromID, toID} {
+		report, err := h.store(c).GetHostReportByID(reportID, hostID, orgID)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				_ = c.Error(apierror.NotFound("report not found").WithDetail("Report " + reportID + " is not in the host's history."))
+				return
+			}
+			logger.FromContext(c).
+				Err(err).
+				Str("host_id", hostID).
+				Str("report_id", reportID).
+				Msg("Failed to get host report")
+			_ = c.Error(apierror.Internal("failed to compare host reports", err))
+			return
+		}
+		reports[i] = report
+	}
+
+	diff, err := reportdiff.Compare(reports[0], reports[1])
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to compare host reports")
+		_ = c.Error(apierror.Internal("failed to compare host reports", err))
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// GetHostReportRetention returns the organization's host report retention
+// @Summary     Get host report retention
+// @Description Returns how many reports of each host the organization keeps. The ETag header carries the retention's version for If-Match. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.HostReportRetention  "Host report retention"
+// @Failure     401  {object}  map[string]string           "Unauthorized"
+// @Failure     403  {object}  map[string]string           "Admin role required"
+// @Failure     404  {object}  map[string]string           "No retention configured; the server default applies"
+// @Failure     500  {object}  map[string]string           "Internal server error"
+// @Router      /api/v1/orgs/current/host-report-retention [get]
+func (h *Handlers) GetHostReportRetention(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	retention, err := h.store(c).GetHostReportRetention(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":            "no host report retention configured",
+				"reports_per_host": h.reportRetention,
+			})
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get host report retention", err))
+		return
+	}
+
+	setETag(c, retention.Version)
+	c.JSON(http.StatusOK, retention)
+}
+
+// SetHostReportRetention replaces the organization's host report retention
+// @Summary     Set host report retention
+// @Description Sets how many reports of each host are kept in its history, between 0 and 1000, overriding the server default (HOST_REPORT_RETENTION). 0 stops keeping history. Lowering the retention trims each host's history the next time it reports, or at the next hourly retention run, whichever comes first.
+// @Description delete_hosts_unseen_days, up to 3650, deletes unarchived hosts that have not reported for that many days at the hourly retention run; 0, the default, keeps them.
+// @Description With If-Match, the retention is only replaced if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                                false  "ETag of the retention being replaced"
+// @Param       request  body      models.SetHostReportRetentionRequest  true   "Reports per host"
+// @Success     200      {object}  models.HostReportRetention            "Host report retention set"
+// @Failure     400      {object}  map[string]string                     "Invalid retention"
+// @Failure     401      {object}  map[string]string                     "Unauthorized"
+// @Failure     403      {object}  map[string]string                     "Admin role required"
+// @Failure     412      {object}  map[string]string                     "Retention changed since If-Match was read"
+// @Failure     500      {object}  map[string]string                     "Internal server error"
+// @Router      /api/v1/orgs/current/host-report-retention [put]
+func (h *Handlers) SetHostReportRetention(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetHostReportRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	retention := &models.HostReportRetention{
+		OrgID:                 orgID,
+		ReportsPerHost:        *req.ReportsPerHost,
+		DeleteHostsUnseenDays: req.DeleteHostsUnseenDays,
+		UpdatedByUserID:       middleware.GetUserID(c),
+		Version:               ifVersion,
+	}
+	if err := h.store(c).SetHostReportRetention(retention); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set host report retention", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Int("reports_per_host", retention.ReportsPerHost).
+		Int("delete_hosts_unseen_days", retention.DeleteHostsUnseenDays).
+		Msg("Host report retention set")
+	setETag(c, retention.Version)
+	c.JSON(http.StatusOK, retention)
+}
+
+// DeleteHostReportRetention returns the organization to the server default host report retention
+// @Summary     Delete host report retention
+// @Description Removes the organization's host report retention, so hosts keep the server default number of reports (HOST_REPORT_RETENTION). With If-Match, the retention is only removed if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the retention being removed"
+// @Success     204  "Host report retention deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No host report retention configured"
+// @Failure     412  {object}  map[string]string  "Retention changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/host-report-retention [delete]
+func (h *Handlers) DeleteHostReportRetention(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteHostReportRetention(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no host report retention configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete host report retention", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Host report retention deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// RunHostReportRetention enforces the organization's host report retention now
+// @Summary     Run host report retention
+// @Description Applies the organization's host report retention now instead of at the next hourly run: trims every host's history to reports_per_host and deletes the unarchived hosts that have not reported for delete_hosts_unseen_days. Deleted hosts are recorded in the audit log as host.deleted with reason retention.
+// @Description With dry_run=true nothing is deleted and the response counts what would be; a dry run also counts the history of hosts it would delete in reports_deleted. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       dry_run  query     bool                 false  "Only count what would be deleted"
+// @Success     200      {object}  models.RetentionRun  "What was deleted, or would be"
+// @Failure     401      {object}  map[string]string    "Unauthorized"
+// @Failure     403      {object}  map[string]string    "Admin role required"
+// @Failure     500      {object}  map[string]string    "Internal server error"
+// @Router      /api/v1/orgs/current/host-report-retention/run [post]
+func (h *Handlers) RunHostReportRetention(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	run, err := h.retention.Enforce(middleware.GetOrgID(c), middleware.GetUserID(c), dryRun)
+	if err != nil {
+		logger.FromContext(c).Err(err).Bool("dry_run", dryRun).Msg("Failed to run host report retention")
+		_ = c.Error(apierror.Internal("failed to run host report retention", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Bool("dry_run", dryRun).
+		Int("reports_deleted", run.ReportsDeleted).
+		Int("hosts_deleted", run.HostsDeleted).
+		Msg("Host report retention run")
+	c.JSON(http.StatusOK, run)
+}
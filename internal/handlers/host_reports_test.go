@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func setupHostReportsTest(t *testing.T, opts ...Option) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.GET("/hosts/:host_id/reports", h.ListHostReports)
+	r.GET("/hosts/:host_id/reports/:report_id", h.GetHostReport)
+	r.GET("/hosts/:host_id/diff", h.GetHostReportDiff)
+	r.GET("/orgs/current/host-report-retention", h.GetHostReportRetention)
+	r.PUT("/orgs/current/host-report-retention", h.SetHostReportRetention)
+	r.DELETE("/orgs/current/host-report-retention", h.DeleteHostReportRetention)
+	r.POST("/orgs/current/host-report-retention/run", h.RunHostReportRetention)
+	return r, mockStore, admin
+}
+
+const historyHostID = "00000000-0000-0000-0000-000000000001"
+
+// ingestHistoryReport ingests a report whose data records its sequence number
+func ingestHistoryReport(t *testing.T, r *gin.Engine, seq int) {
+	t.Helper()
+	body := fmt.Sprintf(`{"meta": {"host_id": %q, "hostname": "host-%d"}, "data": {"seq": %d}}`, historyHostID, seq, seq)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+type hostReportsResponse struct {
+	Reports   []models.HostReport `json:"reports"`
+	Total     int                 `json:"total"`
+	Retention int                 `json:"retention"`
+}
+
+func listHistoryReports(t *testing.T, r *gin.Engine) hostReportsResponse {
+	t.Helper()
+	w := doProbeRequest(r, http.MethodGet, "/hosts/"+historyHostID+"/reports", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp hostReportsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestHandlers_HostReports(t *testing.T) {
+	r, _, admin := setupHostReportsTest(t, WithHostReportRetention(3))
+
+	w := doProbeRequest(r, http.MethodGet, "/hosts/"+historyHostID+"/reports", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for seq := 1; seq <= 5; seq++ {
+		ingestHistoryReport(t, r, seq)
+	}
+
+	// The server default keeps the three newest reports, listed without their data
+	resp := listHistoryReports(t, r)
+	assert.Equal(t, 3, resp.Retention)
+	require.Equal(t, 3, resp.Total)
+	hostnames := []string{}
+	for _, report := range resp.Reports {
+		hostnames = append(hostnames, report.Hostname)
+		assert.Nil(t, report.Data)
+		assert.Equal(t, admin.ID, report.UploadedByUserID)
+	}
+	assert.Equal(t, []string{"host-5", "host-4", "host-3"}, hostnames)
+
+	w = doProbeRequest(r, http.MethodGet, "/hosts/"+historyHostID+"/reports/"+resp.Reports[1].ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report models.HostReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.JSONEq(t, `{"seq": 4}`, string(report.Data))
+
+	w = doProbeRequest(r, http.MethodGet, "/hosts/"+historyHostID+"/reports/00000000-0000-0000-0000-00000000dead", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/hosts/00000000-0000-0000-0000-000000000002/reports/"+resp.Reports[1].ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_GetHostReportDiff(t *testing.T) {
+	r, _, _ := setupHostReportsTest(t)
+
+	diffPath := "/hosts/" + historyHostID + "/diff"
+	w := doProbeRequest(r, http.MethodGet, diffPath, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A single report has nothing earlier to compare with unless from is given
+	ingestHistoryReport(t, r, 1)
+	w = doProbeRequest(r, http.MethodGet, diffPath, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "no earlier report")
+
+	ingestHistoryReport(t, r, 2)
+	ingestHistoryReport(t, r, 3)
+	reports := listHistoryReports(t, r).Reports
+	require.Len(t, reports, 3)
+
+	decode := func(w *httptest.ResponseRecorder) models.HostReportDiff {
+		t.Helper()
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var diff models.HostReportDiff
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+		return diff
+	}
+
+	// Without parameters the newest report is compared with the one before it
+	diff := decode(doProbeRequest(r, http.MethodGet, diffPath, nil))
+	assert.Equal(t, historyHostID, diff.HostID)
+	assert.Equal(t, reports[1].ID, diff.From.ID)
+	assert.Equal(t, reports[0].ID, diff.To.ID)
+	assert.Nil(t, diff.To.Data)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, "seq", diff.Changed[0].Path)
+	assert.JSONEq(t, `2`, string(diff.Changed[0].From))
+	assert.JSONEq(t, `3`, string(diff.Changed[0].To))
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Removed)
+
+	// from alone is compared with the newest report, to alone with the report before it
+	diff = decode(doProbeRequest(r, http.MethodGet, diffPath+"?from="+reports[2].ID, nil))
+	assert.JSONEq(t, `1`, string(diff.Changed[0].From))
+	assert.JSONEq(t, `3`, string(diff.Changed[0].To))
+	diff = decode(doProbeRequest(r, http.MethodGet, diffPath+"?to="+reports[1].ID, nil))
+	assert.Equal(t, reports[2].ID, diff.From.ID)
+
+	diff = decode(doProbeRequest(r, http.MethodGet, diffPath+"?from="+reports[0].ID+"&to="+reports[2].ID, nil))
+	assert.JSONEq(t, `3`, string(diff.Changed[0].From))
+
+	w = doProbeRequest(r, http.MethodGet, diffPath+"?from=00000000-0000-0000-0000-00000000dead", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/hosts/00000000-0000-0000-0000-000000000002/diff?from="+reports[2].ID+"&to="+reports[0].ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_HostReportRetention(t *testing.T) {
+	r, _, admin := setupHostReportsTest(t)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/host-report-retention", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"reports_per_host":%d`, storage.DefaultHostReportRetention))
+
+	for _, body := range []string{`{}`, `{"reports_per_host": -1}`, `{"reports_per_host": 1001}`, `{"reports_per_host": 5, "delete_hosts_unseen_days": 3651}`} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/orgs/current/host-report-retention", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	two := 2
+	w = doProbeRequest(r, http.MethodPut, "/orgs/current/host-report-retention", models.SetHostReportRetentionRequest{ReportsPerHost: &two})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var retention models.HostReportRetention
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &retention))
+	assert.Equal(t, 2, retention.ReportsPerHost)
+	assert.Equal(t, admin.ID, retention.UpdatedByUserID)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	for seq := 1; seq <= 4; seq++ {
+		ingestHistoryReport(t, r, seq)
+	}
+	resp := listHistoryReports(t, r)
+	assert.Equal(t, 2, resp.Retention)
+	assert.Equal(t, 2, resp.Total)
+
+	// 0 stops keeping history and clears it at the host's next report
+	zero := 0
+	w = doProbeRequest(r, http.MethodPut, "/orgs/current/host-report-retention", models.SetHostReportRetentionRequest{ReportsPerHost: &zero})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	ingestHistoryReport(t, r, 5)
+	assert.Zero(t, listHistoryReports(t, r).Total)
+
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/host-report-retention", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/host-report-retention", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	ingestHistoryReport(t, r, 6)
+	resp = listHistoryReports(t, r)
+	assert.Equal(t, storage.DefaultHostReportRetention, resp.Retention)
+	assert.Equal(t, 1, resp.Total)
+}
+
+func TestHandlers_RunHostReportRetention(t *testing.T) {
+	r, mockStore, admin := setupHostReportsTest(t)
+
+	for seq := 1; seq <= 4; seq++ {
+		ingestHistoryReport(t, r, seq)
+	}
+	// Set in storage directly, as a lowered retention is before the host reports again
+	require.NoError(t, mockStore.SetHostReportRetention(&models.HostReportRetention{
+		OrgID:                 admin.OrgID,
+		ReportsPerHost:        1,
+		DeleteHostsUnseenDays: 30,
+	}))
+
+	run := func(query string) models.RetentionRun {
+		t.Helper()
+		w := doProbeRequest(r, http.MethodPost, "/orgs/current/host-report-retention/run"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result models.RetentionRun
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	preview := run("?dry_run=true")
+	assert.True(t, preview.DryRun)
+	assert.Equal(t, 3, preview.ReportsDeleted)
+	assert.Zero(t, preview.HostsDeleted, "the host reported just now")
+	assert.Equal(t, 4, listHistoryReports(t, r).Total)
+
+	result := run("")
+	assert.False(t, result.DryRun)
+	assert.Equal(t, 3, result.ReportsDeleted)
+	assert.Equal(t, 30, result.DeleteHostsUnseenDays)
+	assert.Equal(t, 1, listHistoryReports(t, r).Total)
+}
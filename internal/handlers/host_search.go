@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// hostSearchFilter reads the query parameters of FindHosts
+// Returns false after writing a 400 response if they are invalid
+func hostSearchFilter(c *gin.Context) (models.HostSearchFilter, bool) {
+	filter := models.HostSearchFilter{
+		Hostname:        strings.TrimSpace(c.Query("hostname")),
+		OSName:          strings.TrimSpace(c.Query("os_name")),
+		OSVersion:       strings.TrimSpace(c.Query("os_version")),
+		IncludeArchived: c.Query("include_archived") == "true",
+	}
+	for _, name := range c.QueryArray("package") {
+		if name = strings.TrimSpace(name); name == "" {
+			_ = c.Error(apierror.Validation("invalid package").WithDetail("package names must not be empty"))
+			return filter, false
+		}
+		filter.Packages = append(filter.Packages, name)
+	}
+
+	for _, bound := range []struct {
+		param string
+		time  **time.Time
+	}{
+		{"last_seen_after", &filter.LastSeenAfter},
+		{"last_seen_before", &filter.LastSeenBefore},
+	} {
+		param := bound.param
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			_ = c.Error(apierror.Validation("invalid " + param).WithDetail(param + " must be an RFC 3339 timestamp, e.g. 2024-01-01T00:00:00Z"))
+			return filter, false
+		}
+		*bound.time = &t
+	}
+	return filter, true
+}
+
+// FindHosts searches hosts by structured fields of their last report
+// @Summary     Search hosts
+// @Description Returns the hosts of the authenticated user's organization matching every given filter, a page at a time: newest report first, limit at a time, with has_more and, unless on the last page, next_cursor to pass as cursor for the next page. total counts the matching hosts.
+// @Description hostname matches a substring of the hostname and os_name the OS name, both case-insensitive. os_version matches the OS version or its leading segments (22 matches 22.04). Each package names a package that must be installed, matched exactly. last_seen_after and last_seen_before bound when the last report was received.
+// @Description Every filter is answered from a database index. For wildcards, negation, tags, or version comparisons, use q on GET /api/v1/hosts.
+// @Description Users with a tag-based host access policy only see hosts carrying at least one of their allowed tags. Archived hosts are left out unless include_archived=true.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       hostname          query     string                  false  "Hostname substring"
+// @Param       os_name           query     string                  false  "OS name, e.g. Fedora"
+// @Param       os_version        query     string                  false  "OS version or its leading segments, e.g. 22"
+// @Param       package           query     []string                false  "Installed package name"  collectionFormat(multi)
+// @Param       last_seen_after   query     string                  false  "Last report received at or after (RFC 3339)"
+// @Param       last_seen_before  query     string                  false  "Last report received before (RFC 3339)"
+// @Param       include_archived  query     bool                    false  "Include archived hosts"
+// @Param       limit             query     int                     false  "Page size (default 100, max 1000)"
+// @Param       cursor            query     string                  false  "next_cursor of the previous page"
+// @Success     200  {object}  map[string]interface{}  "Page of matching hosts with total count"
+// @Failure     400  {object}  map[string]string       "Invalid filter, limit, or cursor"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/search [get]
+func (h *Handlers) FindHosts(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	filter, ok := hostSearchFilter(c)
+	if !ok {
+		return
+	}
+	after, limit, _, ok := hostPage(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to search hosts", err))
+		return
+	}
+
+	// Without a tag policy the page is read in SQL; otherwise the visible matches are paged
+	var page *storage.HostPage
+	if !policy.Restricted() {
+		page, err = h.store(c).FindHostsPaginated(orgID, filter, after, limit)
+	} else {
+		var hosts []*models.HostSummary
+		if hosts, err = h.store(c).FindHosts(orgID, filter); err == nil {
+			page = storage.PageHosts(policy.FilterHosts(hosts), after, limit)
+		}
+	}
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to search hosts", err))
+		return
+	}
+	c.JSON(http.StatusOK, hostPageResponse(page, limit))
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_FindHosts(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	hosts := []struct {
+		hostname, os, version, packages string
+		age                             time.Duration
+	}{
+		{"web-01", "Ubuntu", "22.04", `[{"name": "nginx", "version": "1.24"}, {"name": "openssl", "version": "3.0.2"}]`, time.Hour},
+		{"web-02", "Ubuntu", "24.04", `[{"name": "nginx", "version": "1.26"}]`, 2 * time.Hour},
+		{"db-01", "Fedora", "40", `[{"name": "postgresql", "version": "16"}, {"name": "openssl", "version": "3.2"}]`, 48 * time.Hour},
+	}
+	for i, host := range hosts {
+		hostID := fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i+1)
+		data := fmt.Sprintf(`{"system": {"os": {"name": %q, "version": %q}}, "packages": {"installed": %s}}`, host.os, host.version, host.packages)
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: now.Add(-host.age),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: host.hostname},
+			Data:       json.RawMessage(data),
+		}, org.ID, user.ID))
+	}
+
+	r := setupTestRouter(h)
+	r.GET("/hosts/search", func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+		h.FindHosts(c)
+	})
+
+	type searchResponse struct {
+		Hosts      []*models.HostSummary `json:"hosts"`
+		Total      int                   `json:"total"`
+		HasMore    bool                  `json:"has_more"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	find := func(query string) (int, []string, searchResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts/search?"+query, nil))
+		var response searchResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		hostnames := []string{}
+		for _, host := range response.Hosts {
+			hostnames = append(hostnames, host.Hostname)
+		}
+		return w.Code, hostnames, response
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"web-01", "web-02", "db-01"}},
+		{"hostname=WEB", []string{"web-01", "web-02"}},
+		{"os_name=ubuntu&os_version=22", []string{"web-01"}},
+		{"os_version=4", []string{}},
+		{"package=openssl", []string{"web-01", "db-01"}},
+		{"package=openssl&package=nginx", []string{"web-01"}},
+		{"package=OpenSSL", []string{}},
+		{"last_seen_after=" + now.Add(-3*time.Hour).Format(time.RFC3339), []string{"web-01", "web-02"}},
+		{"last_seen_before=" + now.Add(-90*time.Minute).Format(time.RFC3339) + "&hostname=web", []string{"web-02"}},
+	}
+	for _, tt := range tests {
+		code, hostnames, response := find(tt.query)
+		require.Equal(t, http.StatusOK, code, tt.query)
+		assert.Equal(t, tt.want, hostnames, tt.query)
+		assert.Equal(t, len(tt.want), response.Total, tt.query)
+	}
+
+	// Results are paged
+	code, hostnames, response := find("package=openssl&limit=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"web-01"}, hostnames)
+	assert.Equal(t, 2, response.Total)
+	require.True(t, response.HasMore)
+	_, hostnames, response = find("package=openssl&limit=1&cursor=" + response.NextCursor)
+	assert.Equal(t, []string{"db-01"}, hostnames)
+	assert.False(t, response.HasMore)
+
+	for _, query := range []string{"last_seen_after=yesterday", "package=", "limit=0", "cursor=bogus"} {
+		code, _, _ := find(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/auth"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Impersonate issues a token that acts as another user
+// @Summary     Impersonate user
+// @Description Issues a short-lived token that acts as the user, with their role, in the organization they are in now, so a system administrator can reproduce an issue the user reported without asking for their credentials. Send it as `Authorization: Bearer sbit_...`; it expires after IMPERSONATION_TOKEN_TTL and cannot select another organization with X-Org-ID.
+// @Description The token is recorded as `user.impersonated` in the user's organization's audit log with the reason given, and every audit event for a change made with it names the administrator in `impersonator_user_id`. System administrators cannot be impersonated. Requires system administrator privileges and `impersonation` in AUTH_METHODS.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       user_id  path      string                     true  "User ID"
+// @Param       request  body      models.ImpersonateRequest  true  "Reason for impersonating the user"
+// @Success     201      {object}  models.ImpersonateResponse  "Impersonation token"
+// @Failure     400      {object}  map[string]string  "Invalid request or impersonation disabled"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     403      {object}  map[string]string  "System administrator access required, or the user cannot be impersonated"
+// @Failure     404      {object}  map[string]string  "User not found"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/admin/impersonate/{user_id} [post]
+func (h *Handlers) Impersonate(c *gin.Context) {
+	if h.impersonationTTL == 0 {
+		_ = c.Error(apierror.Validation("impersonation is disabled").
+			WithDetail("Add impersonation to AUTH_METHODS to enable it"))
+		return
+	}
+
+	var req models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	user, err := h.store(c).GetUserByID(c.Param("user_id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.NotFound("user not found"))
+		return
+	}
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to get user", err))
+		return
+	}
+	// Acting as another administrator would hand out their access to every organization
+	if user.IsAdmin {
+		_ = c.Error(apierror.Forbidden("cannot impersonate a system administrator"))
+		return
+	}
+	if !user.IsActive {
+		_ = c.Error(apierror.Forbidden("cannot impersonate an inactive user"))
+		return
+	}
+
+	plain, tokenHash, err := auth.GenerateOAuthToken(auth.ImpersonationTokenPrefix)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create impersonation token", err))
+		return
+	}
+	token := &models.ImpersonationToken{
+		ID:          uuid.New().String(),
+		AdminUserID: middleware.GetUserID(c),
+		UserID:      user.ID,
+		OrgID:       user.OrgID,
+		TokenHash:   tokenHash,
+		Reason:      req.Reason,
+		ExpiresAt:   time.Now().UTC().Add(h.impersonationTTL),
+	}
+	if err := h.store(c).CreateImpersonationToken(token); err != nil {
+		_ = c.Error(apierror.Internal("failed to create impersonation token", err))
+		return
+	}
+
+	// Recorded in the user's organization, so its admins see who acted as their user
+	h.audit.Record(c, models.AuditEvent{
+		OrgID:      user.OrgID,
+		Action:     models.AuditUserImpersonated,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Details: map[string]string{
+			"username":   user.Username,
+			"reason":     req.Reason,
+			"token_id":   token.ID,
+			"expires_at": token.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, models.ImpersonateResponse{
+		ID:        token.ID,
+		Token:     plain,
+		User:      user,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_Impersonate(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithImpersonation(15*time.Minute))
+
+	org, _ := mockStore.CreateOrganization("Customer")
+	ops, _ := mockStore.CreateOrganization("Operations")
+	user, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "editor")
+	admin, _ := mockStore.CreateUser("operator", "operator@example.com", "hash", ops.ID, "admin")
+	require.NoError(t, mockStore.SetUserSystemAdmin(admin.ID, true))
+
+	r := setupTestRouter(h)
+	systemAdmin := r.Group("/admin", func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	systemAdmin.POST("/impersonate/:user_id", h.Impersonate)
+	acting := r.Group("", middleware.AuthChain(middleware.NewImpersonationAuthenticator(mockStore)),
+		middleware.OrgContextMiddleware(mockStore))
+	acting.POST("/api-keys", h.CreateAPIKey)
+
+	impersonate := func(userID, reason string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.ImpersonateRequest{Reason: reason})
+		req := httptest.NewRequest(http.MethodPost, "/admin/impersonate/"+userID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := impersonate(user.ID, "ticket 42: hosts missing from dashboard")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var issued models.ImpersonateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	assert.Equal(t, user.ID, issued.User.ID)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), issued.ExpiresAt, time.Minute)
+
+	// The token acts as the user; changes made with it name the administrator
+	req := httptest.NewRequest(http.MethodPost, "/api-keys", bytes.NewReader([]byte(`{"name":"debug"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+issued.Token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	page, err := mockStore.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	keyCreated, impersonated := page.Events[0], page.Events[1]
+	assert.Equal(t, models.AuditUserImpersonated, impersonated.Action)
+	assert.Equal(t, admin.ID, impersonated.ActorUserID)
+	assert.Equal(t, user.ID, impersonated.TargetID)
+	assert.Equal(t, "ticket 42: hosts missing from dashboard", impersonated.Details["reason"])
+	assert.Equal(t, issued.ID, impersonated.Details["token_id"])
+	assert.Equal(t, models.AuditAPIKeyCreated, keyCreated.Action)
+	assert.Equal(t, user.ID, keyCreated.ActorUserID)
+	assert.Equal(t, admin.ID, keyCreated.ImpersonatorUserID)
+	assert.Equal(t, admin.Username, keyCreated.ImpersonatorUsername)
+
+	// A reason is required, and system administrators cannot be impersonated
+	assert.Equal(t, http.StatusBadRequest, impersonate(user.ID, "").Code)
+	assert.Equal(t, http.StatusForbidden, impersonate(admin.ID, "testing").Code)
+	assert.Equal(t, http.StatusNotFound, impersonate("00000000-0000-0000-0000-000000000000", "testing").Code)
+}
+
+func TestHandlers_Impersonate_Disabled(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	r := setupTestRouter(h)
+	r.POST("/admin/impersonate/:user_id", h.Impersonate)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/impersonate/some-user", bytes.NewReader([]byte(`{"reason":"testing"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "impersonation is disabled")
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+)
+
+// MaxIngestBatch is the most reports POST /api/v1/ingest/batch accepts in one request
+const MaxIngestBatch = 500
+
+// IngestBatch handles batches of reports relayed for many hosts at once
+// @Summary     Ingest a batch of collection reports
+// @Description Receives an array of collection reports, as sent one at a time to POST /api/v1/ingest, for relays that forward a fleet's reports. Supports gzip-compressed requests via the Content-Encoding: gzip header, and CBOR or MessagePack bodies like /ingest.
+// @Description Each report is checked like a single ingest: JSON limits, required meta fields, timestamp, health, and the host's ingest rate limit. Rejected reports do not stop the others. The accepted reports are stored in one transaction, so either all of them are stored or, on a database error, none are and the request fails with 500.
+// @Description results has one entry per report, in order, with the status /ingest would have returned for it and, when accepted, its signed receipt; the receipt checksum covers the report's JSON. At most 500 reports per request.
+// @Tags        Ingest
+// @Accept      json
+// @Accept      application/gzip
+// @Accept      application/cbor
+// @Accept      application/msgpack
+// @Produce     json
+// @Produce     application/cbor
+// @Produce     application/msgpack
+// @Param       request  body      []models.IngestRequest  true  "Collection reports"
+// @Success     200      {object}  models.IngestBatchResponse  "Per-report results"
+// @Failure     400      {object}  map[string]string         "Not an array of reports, empty, or too many reports"
+// @Failure     401      {object}  map[string]string         "Unauthorized"
+// @Failure     500      {object}  map[string]string         "Internal server error"
+// @Router      /api/v1/ingest/batch [post]
+func (h *Handlers) IngestBatch(c *gin.Context) {
+	_, document, ok := h.readIngestBody(c)
+	if !ok {
+		return
+	}
+
+	// Each report is checked against the JSON limits on its own, not the batch as a whole
+	var documents []json.RawMessage
+	if err := json.Unmarshal(document, &documents); err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to parse ingest batch")
+		respondIngest(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid JSON payload",
+			"message": "the body must be an array of ingest requests",
+		})
+		return
+	}
+	if len(documents) == 0 {
+		respondIngest(c, http.StatusBadRequest, gin.H{"error": "empty batch"})
+		return
+	}
+	if len(documents) > MaxIngestBatch {
+		respondIngest(c, http.StatusBadRequest, gin.H{
+			"error":   "batch too large",
+			"message": "a batch holds at most " + strconv.Itoa(MaxIngestBatch) + " reports; split it into several requests",
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	user, exists := c.Get("user")
+	if userID == "" || !exists {
+		respondIngest(c, http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	orgID := user.(*models.User).OrgID
+
+	now := time.Now().UTC()
+	response := models.IngestBatchResponse{Results: make([]models.IngestBatchResult, len(documents))}
+	var items []*ingestItem
+	var positions []int                 // Index in the batch of each item
+	batched := map[string]*ingestItem{} // Last accepted report of each host
+	for i, raw := range documents {
+		result := &response.Results[i]
+		result.Index = i
+
+		item, ingestErr := h.prepareBatchItem(c, orgID, raw, now, batched)
+		if ingestErr != nil {
+			rejectBatchItem(result, ingestErr)
+			continue
+		}
+		result.HostID = item.report.Meta.HostID
+		batched[result.HostID] = item
+		items = append(items, item)
+		positions = append(positions, i)
+	}
+
+	if len(items) > 0 {
+		// Store the accepted reports together; the rest of ingest runs once they are stored
+		if err := h.storeIngest(c, orgID, userID, items...); err != nil {
+			logger.FromContext(c).
+				Err(err).
+				Int("reports", len(items)).
+				Msg("Failed to save ingest batch")
+			respondIngest(c, http.StatusInternalServerError, gin.H{"error": "failed to store host data"})
+			return
+		}
+	}
+
+	for i, item := range items {
+		result := &response.Results[positions[i]]
+		h.finishIngest(c, orgID, userID, item)
+		result.Status = http.StatusCreated
+		result.ReceivedAt = now.Format(time.RFC3339)
+		result.Receipt = item.receipt
+		result.Stripped = item.report.Stripped
+	}
+
+	for _, result := range response.Results {
+		if result.Status == http.StatusCreated {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+	logger.FromContext(c).
+		Int("accepted", response.Accepted).
+		Int("rejected", response.Rejected).
+		Msg("Ingest batch processed")
+	respondIngest(c, http.StatusOK, response)
+}
+
+// prepareBatchItem decodes, validates, and prepares one report of a batch
+// batched holds the reports of the batch accepted so far: a host that appears more than
+// once is measured against its previous report in the batch, not the stored one.
+func (h *Handlers) prepareBatchItem(c *gin.Context, orgID string, raw json.RawMessage, now time.Time, batched map[string]*ingestItem) (*ingestItem, *ingestError) {
+	req, ingestErr := h.decodeIngest(c, raw)
+	if ingestErr != nil {
+		return nil, ingestErr
+	}
+	if ingestErr = h.validateIngest(&req, now); ingestErr != nil {
+		return nil, ingestErr
+	}
+	if ingestErr = checkEnrolledHost(c, req.Meta.HostID); ingestErr != nil {
+		return nil, ingestErr
+	}
+	if h.hostLimits != nil {
+		if _, ingestErr = h.checkHostLimit(c, orgID, req.Meta.HostID); ingestErr != nil {
+			return nil, ingestErr
+		}
+	}
+
+	item, ingestErr := h.prepareIngest(c, orgID, req, now)
+	if ingestErr != nil {
+		return nil, ingestErr
+	}
+	if previous, ok := batched[req.Meta.HostID]; ok {
+		item.newHost = false
+		item.previousHealth = ""
+		if previous.report.Health != nil {
+			item.previousHealth = previous.report.Health.Status
+		}
+	}
+	item.checksum = sha256.Sum256(raw)
+	item.size = len(raw)
+	return item, nil
+}
+
+// rejectBatchItem records why a report of a batch was not accepted
+func rejectBatchItem(result *models.IngestBatchResult, ingestErr *ingestError) {
+	result.Status = ingestErr.status
+	result.Error, _ = ingestErr.body["error"].(string)
+	result.Message, _ = ingestErr.body["message"].(string)
+}
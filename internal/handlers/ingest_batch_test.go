@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/hostlimit"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/models"
+	"snailbus/internal/receipts"
+	"snailbus/internal/storage"
+)
+
+// setupIngestBatchTest creates an organization and a router ingesting as its admin
+func setupIngestBatchTest(t *testing.T, opts ...Option) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.POST("/ingest/batch", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		c.Set("org_id", user.OrgID)
+		h.IngestBatch(c)
+	})
+	return r, mockStore, user
+}
+
+func postBatch(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/ingest/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlers_IngestBatch(t *testing.T) {
+	r, mockStore, user := setupIngestBatchTest(t)
+
+	const (
+		hostA = "00000000-0000-0000-0000-00000000000a"
+		hostB = "00000000-0000-0000-0000-00000000000b"
+	)
+	reportA := `{"meta": {"host_id": "` + hostA + `", "hostname": "web-1"}, "data": {"system": {"os_name": "Fedora"}}}`
+	body := `[` +
+		reportA + `,` +
+		`{"meta": {"host_id": "` + hostB + `"}, "data": {}},` +
+		`{"meta": {"host_id": "` + hostB + `", "hostname": "db-1", "timestamp": "yesterday"}, "data": {}},` +
+		`{"meta": {"host_id": "` + hostB + `", "hostname": "db-1"}, "data": {}},` +
+		`{"meta": {"host_id": "` + hostA + `", "hostname": "web-1-renamed"}, "data": {}, "health": {"status": "critical"}}` +
+		`]`
+
+	w := postBatch(r, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.IngestBatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Accepted)
+	assert.Equal(t, 2, response.Rejected)
+	require.Len(t, response.Results, 5)
+
+	statuses := make([]int, len(response.Results))
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest, http.StatusCreated, http.StatusCreated}, statuses)
+	assert.Equal(t, "missing hostname in meta", response.Results[1].Error)
+	assert.Equal(t, "invalid timestamp in meta", response.Results[2].Error)
+	assert.NotEmpty(t, response.Results[2].Message)
+
+	// Each accepted report gets its own receipt over its JSON
+	first := response.Results[0]
+	assert.Equal(t, hostA, first.HostID)
+	require.NotNil(t, first.Receipt)
+	checksum := sha256.Sum256([]byte(reportA))
+	assert.Equal(t, receipts.Checksum(checksum[:]), first.Receipt.Checksum)
+	assert.NotEqual(t, first.Receipt.ID, response.Results[3].Receipt.ID)
+
+	// A host reported twice keeps its last report
+	stored, err := mockStore.GetHost(hostA, user.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, "web-1-renamed", stored.Meta.Hostname)
+	require.NotNil(t, stored.Health)
+	assert.Equal(t, models.HealthCritical, stored.Health.Status)
+	_, err = mockStore.GetHost(hostB, user.OrgID)
+	assert.NoError(t, err)
+
+	page, err := mockStore.ListAuditEvents(user.OrgID, models.AuditFilter{Action: models.AuditHostIngested}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, page.Events, 3)
+}
+
+func TestHandlers_IngestBatch_Gzip(t *testing.T) {
+	r, mockStore, user := setupIngestBatchTest(t)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`[{"meta": {"host_id": "` + probeHostUp + `", "hostname": "web-1"}, "data": {}}]`))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/batch", &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"accepted":1`)
+	_, err := mockStore.GetHost(probeHostUp, user.OrgID)
+	assert.NoError(t, err)
+}
+
+func TestHandlers_IngestBatch_Limits(t *testing.T) {
+	limits, err := hostlimit.New("1-M", nil)
+	require.NoError(t, err)
+	r, _, _ := setupIngestBatchTest(t, WithHostRateLimits(limits), WithJSONLimits(jsonlimit.Limits{MaxDepth: 4, MaxKeys: 20, MaxStringLength: 64}))
+
+	// The host rate limit counts each report of the batch
+	report := `{"meta": {"host_id": "` + probeHostUp + `", "hostname": "web-1"}, "data": {}}`
+	deep := `{"meta": {"host_id": "` + probeHostDown + `", "hostname": "web-2"}, "data": {"a": {"b": {"c": {"d": {}}}}}}`
+	w := postBatch(r, `[`+report+`,`+report+`,`+deep+`]`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.IngestBatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+	assert.Equal(t, http.StatusTooManyRequests, response.Results[1].Status)
+	assert.Equal(t, "host rate limit exceeded", response.Results[1].Error)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Results[2].Status)
+
+	for _, body := range []string{`{}`, `[]`, `not json`, `[` + strings.TrimSuffix(strings.Repeat(report+",", MaxIngestBatch+1), ",") + `]`} {
+		w := postBatch(r, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/fieldfilter"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// filterReportData removes the fields listed in the organization's ingest filter from data
+func (h *Handlers) filterReportData(c *gin.Context, orgID string, data json.RawMessage) (json.RawMessage, []models.StrippedField, error) {
+	filter, err := h.store(c).GetIngestFilter(orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return data, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compiled, err := fieldfilter.Compile(filter.Paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return compiled.Apply(data)
+}
+
+// GetIngestFilter returns the organization's ingest filter
+// @Summary     Get ingest filter
+// @Description Returns the report data paths removed from the organization's reports before they are stored. The ETag header carries the filter's version for If-Match. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.IngestFilter  "Ingest filter"
+// @Failure     401  {object}  map[string]string    "Unauthorized"
+// @Failure     403  {object}  map[string]string    "Admin role required"
+// @Failure     404  {object}  map[string]string    "No ingest filter configured"
+// @Failure     500  {object}  map[string]string    "Internal server error"
+// @Router      /api/v1/orgs/current/ingest-filter [get]
+func (h *Handlers) GetIngestFilter(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	filter, err := h.store(c).GetIngestFilter(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no ingest filter configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get ingest filter", err))
+		return
+	}
+
+	setETag(c, filter.Version)
+	c.JSON(http.StatusOK, filter)
+}
+
+// SetIngestFilter replaces the organization's ingest filter
+// @Summary     Set ingest filter
+// @Description Lists report data paths to remove from the organization's reports before they are stored, e.g. users or processes.cmdline.
+// @Description Paths are dot-separated object keys from the root of data; "*" matches any key, and a path continues into every element of an array.
+// @Description Applies to reports ingested after the change; stored reports are not rewritten. The paths each report matched are recorded in its ingested or updated host event and returned in the ingest response.
+// @Description With If-Match, the filter is only replaced if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                         false  "ETag of the filter being replaced"
+// @Param       request  body      models.SetIngestFilterRequest  true  "Paths to remove"
+// @Success     200      {object}  models.IngestFilter            "Ingest filter set"
+// @Failure     400      {object}  map[string]string              "Invalid paths"
+// @Failure     401      {object}  map[string]string              "Unauthorized"
+// @Failure     403      {object}  map[string]string              "Admin role required"
+// @Failure     412      {object}  map[string]string              "Filter changed since If-Match was read"
+// @Failure     500      {object}  map[string]string              "Internal server error"
+// @Router      /api/v1/orgs/current/ingest-filter [put]
+func (h *Handlers) SetIngestFilter(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetIngestFilterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	paths := make([]string, len(req.Paths))
+	for i, path := range req.Paths {
+		paths[i] = strings.TrimSpace(path)
+	}
+	if _, err := fieldfilter.Compile(paths); err != nil {
+		_ = c.Error(apierror.Validation("invalid ingest filter").WithDetail(err.Error()))
+		return
+	}
+
+	filter := &models.IngestFilter{
+		OrgID:           orgID,
+		Paths:           paths,
+		UpdatedByUserID: middleware.GetUserID(c),
+		Version:         ifVersion,
+	}
+	if err := h.store(c).SetIngestFilter(filter); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set ingest filter", err))
+		return
+	}
+
+	logger.FromContext(c).Strs("paths", filter.Paths).Msg("Ingest filter set")
+	setETag(c, filter.Version)
+	c.JSON(http.StatusOK, filter)
+}
+
+// DeleteIngestFilter stores the organization's reports unfiltered again
+// @Summary     Delete ingest filter
+// @Description Removes the organization's ingest filter, so later reports are stored in full. With If-Match, the filter is only removed if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the filter being removed"
+// @Success     204  "Ingest filter deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No ingest filter configured"
+// @Failure     412  {object}  map[string]string  "Filter changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/ingest-filter [delete]
+func (h *Handlers) DeleteIngestFilter(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteIngestFilter(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no ingest filter configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete ingest filter", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Ingest filter deleted")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// setupIngestFilterTest creates an organization and a router acting as its admin
+func setupIngestFilterTest(t *testing.T) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/ingest-filter", h.GetIngestFilter)
+	r.PUT("/orgs/current/ingest-filter", h.SetIngestFilter)
+	r.DELETE("/orgs/current/ingest-filter", h.DeleteIngestFilter)
+	r.POST("/ingest", h.Ingest)
+	return r, mockStore, admin
+}
+
+func TestHandlers_IngestFilter(t *testing.T) {
+	r, _, admin := setupIngestFilterTest(t)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/ingest-filter", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	invalid := []models.SetIngestFilterRequest{
+		{},
+		{Paths: []string{}},
+		{Paths: []string{"processes..cmdline"}},
+		{Paths: []string{"users", " users "}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPut, "/orgs/current/ingest-filter", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	w = doProbeRequest(r, http.MethodPut, "/orgs/current/ingest-filter", models.SetIngestFilterRequest{
+		Paths: []string{"users", " processes.cmdline"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodGet, "/orgs/current/ingest-filter", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var filter models.IngestFilter
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &filter))
+	assert.Equal(t, []string{"users", "processes.cmdline"}, filter.Paths)
+	assert.Equal(t, admin.ID, filter.UpdatedByUserID)
+
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/ingest-filter", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/ingest-filter", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Ingest_Filtered(t *testing.T) {
+	r, mockStore, admin := setupIngestFilterTest(t)
+
+	w := doProbeRequest(r, http.MethodPut, "/orgs/current/ingest-filter", models.SetIngestFilterRequest{
+		Paths: []string{"users", "processes.cmdline", "network"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	body := `{"meta": {"host_id": "` + hostID + `", "hostname": "test-host"}, "data": {
+		"system": {"hostname": "test-host"},
+		"users": [{"name": "root"}],
+		"processes": [{"pid": 1, "cmdline": "/sbin/init"}, {"pid": 2, "cmdline": "sshd: alice"}]
+	}}`
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	wantStripped := []models.StrippedField{
+		{Path: "users", Count: 1},
+		{Path: "processes.cmdline", Count: 2},
+	}
+	var resp models.IngestResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, wantStripped, resp.Stripped)
+
+	// The denylisted fields never reach storage
+	report, err := mockStore.GetHost(hostID, admin.OrgID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"system": {"hostname": "test-host"}, "processes": [{"pid": 1}, {"pid": 2}]}`, string(report.Data))
+
+	// The host's event history records what was stripped
+	events, err := mockStore.ListHostEvents(admin.OrgID, hostID, 0, 10, true)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.NotNil(t, events[0].Payload)
+	require.NotNil(t, events[0].Payload.Report)
+	assert.Equal(t, wantStripped, events[0].Payload.Report.Stripped)
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/ioc"
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Default and maximum number of matches returned by ListIOCMatches
+const (
+	defaultIOCMatchLimit = 100
+	maxIOCMatchLimit     = 1000
+)
+
+// maxIOCListName is the longest IOC list name
+const maxIOCListName = 100
+
+// maxIOCFindingDetails is the most matches listed in an ioc_match finding's details
+const maxIOCFindingDetails = 20
+
+// matchIOCs matches a stored report against the organization's IOC lists, records the
+// matches, and raises an ioc_match finding for indicators the host had not matched before.
+// Failures are logged; they never fail the ingest.
+func (h *Handlers) matchIOCs(c *gin.Context, orgID string, meta models.ReportMeta, data json.RawMessage, now time.Time) {
+	matcher, err := h.iocs.Matcher(orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", meta.HostID).Msg("Failed to load IOC lists")
+		return
+	}
+	matches := matcher.Match(data)
+	if len(matches) == 0 {
+		return
+	}
+
+	newMatches, err := h.store(c).RecordIOCMatches(orgID, meta.HostID, matches, now)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", meta.HostID).Msg("Failed to record IOC matches")
+		return
+	}
+	metrics.IOCMatchesTotal.WithLabelValues(orgID).Add(float64(len(newMatches)))
+	if len(newMatches) == 0 {
+		return
+	}
+
+	logger.FromContext(c).
+		Str("host_id", meta.HostID).
+		Int("matches", len(matches)).
+		Int("new_matches", len(newMatches)).
+		Msg("Report matched IOC lists")
+
+	details := make([]string, 0, len(newMatches))
+	for _, match := range newMatches {
+		if len(details) == maxIOCFindingDetails {
+			details = append(details, fmt.Sprintf("and %d more", len(newMatches)-maxIOCFindingDetails))
+			break
+		}
+		detail := fmt.Sprintf("%s %s (list %s) at %s", match.Type, match.Value, match.ListName, match.Path)
+		if match.Description != "" {
+			detail += ": " + match.Description
+		}
+		details = append(details, detail)
+	}
+	h.fireFinding(orgID, models.Finding{
+		Type:       models.FindingIOCMatch,
+		HostID:     meta.HostID,
+		Hostname:   meta.Hostname,
+		Summary:    fmt.Sprintf("%s matched %d indicators of compromise", meta.Hostname, len(newMatches)),
+		Details:    details,
+		DetectedAt: now,
+	})
+}
+
+// readIOCList parses the request body as an IOC list in the format given by the format
+// query parameter or the Content-Type, writing a 400 response and returning false if it is invalid
+func readIOCList(c *gin.Context) ([]models.IOCIndicator, string, int, bool) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = models.IOCFormatCSV
+		case "application/json", "application/stix+json":
+			format = models.IOCFormatSTIX
+		}
+	}
+	if format == "" {
+		_ = c.Error(apierror.Validation("unknown IOC list format").WithDetail("Send Content-Type text/csv or application/stix+json, or set format to csv or stix"))
+		return nil, "", 0, false
+	}
+
+	indicators, skipped, err := ioc.Parse(format, c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "IOC list is too large"})
+			return nil, "", 0, false
+		}
+		_ = c.Error(apierror.Validation("invalid IOC list").WithDetail(err.Error()))
+		return nil, "", 0, false
+	}
+	return indicators, format, skipped, true
+}
+
+// validIOCListName writes a 400 response and returns false if name is empty or too long
+func validIOCListName(c *gin.Context, name string) bool {
+	if name == "" || len(name) > maxIOCListName {
+		_ = c.Error(apierror.Validation("name must be 1 to " + strconv.Itoa(maxIOCListName) + " characters"))
+		return false
+	}
+	return true
+}
+
+// ListIOCLists returns the organization's IOC lists
+// @Summary     List IOC lists
+// @Description Returns the organization's lists of indicators of compromise with their indicator counts, by name. Requires admin role.
+// @Tags        IOC
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Lists with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/ioc-lists [get]
+func (h *Handlers) ListIOCLists(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	lists, err := h.store(c).ListIOCLists(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list IOC lists", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lists": lists,
+		"total": len(lists),
+	})
+}
+
+// CreateIOCList uploads an IOC list
+// @Summary     Upload IOC list
+// @Description Uploads a list of indicators of compromise that ingested reports are matched against. The body is CSV (Content-Type text/csv) with type,value[,description] rows, types md5, sha1, sha256, process_name, and file_name (an empty type is inferred from a hash's length), or a STIX 2.1 bundle (application/stix+json) whose indicator patterns compare file:hashes, file:name, or process:name.
+// @Description STIX indicators without a supported comparison are skipped and counted. The first time a host's report contains an indicator, an ioc_match finding is raised for outbound actions. Requires admin role.
+// @Tags        IOC
+// @Accept      text/csv
+// @Accept      application/stix+json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name    query     string  true   "List name, unique in the organization"
+// @Param       format  query     string  false  "csv or stix; defaults from Content-Type"
+// @Success     201  {object}  models.IOCListResponse  "List created"
+// @Failure     400  {object}  map[string]string       "Invalid list, name, or format"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     409  {object}  map[string]string       "List name already exists"
+// @Failure     413  {object}  map[string]string       "List too large"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/ioc-lists [post]
+func (h *Handlers) CreateIOCList(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	name := strings.TrimSpace(c.Query("name"))
+	if !validIOCListName(c, name) {
+		return
+	}
+	indicators, format, skipped, ok := readIOCList(c)
+	if !ok {
+		return
+	}
+
+	list := &models.IOCList{
+		ID:         uuid.New().String(),
+		Name:       name,
+		Format:     format,
+		Indicators: indicators,
+		CreatedBy:  middleware.GetUserID(c),
+	}
+	if err := h.store(c).CreateIOCList(list, orgID); err != nil {
+		if errors.Is(err, storage.ErrIOCListNameTaken) {
+			_ = c.Error(apierror.Conflict("IOC list name already exists"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to create IOC list", err))
+		return
+	}
+	h.iocs.Invalidate(orgID)
+
+	logger.FromContext(c).
+		Str("list_id", list.ID).
+		Str("format", format).
+		Int("indicators", len(indicators)).
+		Int("skipped", skipped).
+		Msg("IOC list created")
+
+	list.Indicators = nil
+	c.JSON(http.StatusCreated, models.IOCListResponse{IOCList: list, Skipped: skipped})
+}
+
+// GetIOCList returns an IOC list with its indicators
+// @Summary     Get IOC list
+// @Description Returns an IOC list with its indicators, by type and value. Requires admin role.
+// @Tags        IOC
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "IOC list ID (UUID)"
+// @Success     200  {object}  models.IOCList     "IOC list"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "IOC list not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/ioc-lists/{id} [get]
+func (h *Handlers) GetIOCList(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	list, err := h.store(c).GetIOCList(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("IOC list not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get IOC list", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// ReplaceIOCList replaces the indicators of an IOC list
+// @Summary     Replace IOC list
+// @Description Replaces an IOC list's indicators with an uploaded CSV or STIX list, as for uploads, and renames it if name is given. Matches of indicators the list no longer has are removed. Requires admin role.
+// @Tags        IOC
+// @Accept      text/csv
+// @Accept      application/stix+json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string  true   "IOC list ID (UUID)"
+// @Param       name    query     string  false  "New list name"
+// @Param       format  query     string  false  "csv or stix; defaults from Content-Type"
+// @Success     200  {object}  models.IOCListResponse  "List replaced"
+// @Failure     400  {object}  map[string]string       "Invalid list, name, or format"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     404  {object}  map[string]string       "IOC list not found"
+// @Failure     409  {object}  map[string]string       "List name already exists"
+// @Failure     413  {object}  map[string]string       "List too large"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/ioc-lists/{id} [put]
+func (h *Handlers) ReplaceIOCList(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	listID := c.Param("id")
+
+	existing, err := h.store(c).GetIOCList(listID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("IOC list not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to replace IOC list", err))
+		return
+	}
+	name := existing.Name
+	if c.Query("name") != "" {
+		name = strings.TrimSpace(c.Query("name"))
+		if !validIOCListName(c, name) {
+			return
+		}
+	}
+	indicators, format, skipped, ok := readIOCList(c)
+	if !ok {
+		return
+	}
+
+	list := &models.IOCList{ID: listID, Name: name, Format: format, Indicators: indicators}
+	if err := h.store(c).ReplaceIOCList(list, orgID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("IOC list not found"))
+			return
+		case errors.Is(err, storage.ErrIOCListNameTaken):
+			_ = c.Error(apierror.Conflict("IOC list name already exists"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to replace IOC list", err))
+		return
+	}
+	h.iocs.Invalidate(orgID)
+
+	logger.FromContext(c).
+		Str("list_id", list.ID).
+		Str("format", format).
+		Int("indicators", len(indicators)).
+		Int("skipped", skipped).
+		Msg("IOC list replaced")
+
+	list.Indicators = nil
+	c.JSON(http.StatusOK, models.IOCListResponse{IOCList: list, Skipped: skipped})
+}
+
+// DeleteIOCList removes an IOC list
+// @Summary     Delete IOC list
+// @Description Removes an IOC list with its matches. Requires admin role.
+// @Tags        IOC
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path  string  true  "IOC list ID (UUID)"
+// @Success     204  "IOC list deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "IOC list not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/ioc-lists/{id} [delete]
+func (h *Handlers) DeleteIOCList(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	listID := c.Param("id")
+
+	if err := h.store(c).DeleteIOCList(listID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("IOC list not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete IOC list", err))
+		return
+	}
+	h.iocs.Invalidate(orgID)
+
+	logger.FromContext(c).Str("list_id", listID).Msg("IOC list deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// ListIOCMatches returns the indicators found in hosts' reports
+// @Summary     List IOC matches
+// @Description Returns the indicators of compromise found in the organization's reports, most recently seen first, with the host, the list, where in the report data each was found, and when it was first and last reported. Requires admin role.
+// @Tags        IOC
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  query     string  false  "Only matches on this host"
+// @Param       list_id  query     string  false  "Only matches of this list"
+// @Param       limit    query     int     false  "Maximum number of matches (default 100, max 1000)"
+// @Success     200  {object}  map[string]interface{}  "Matches with total count"
+// @Failure     400  {object}  map[string]string       "Invalid limit"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/ioc-matches [get]
+func (h *Handlers) ListIOCMatches(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	filter := models.IOCMatchFilter{
+		HostID: c.Query("host_id"),
+		ListID: c.Query("list_id"),
+		Limit:  defaultIOCMatchLimit,
+	}
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxIOCMatchLimit {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(maxIOCMatchLimit)))
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	matches, err := h.store(c).ListIOCMatches(orgID, filter)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list IOC matches", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"matches": matches,
+		"total":   len(matches),
+	})
+}
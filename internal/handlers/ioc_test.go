@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// setupIOCTest creates an organization and a router acting as its admin, with outbound actions enabled
+func setupIOCTest(t *testing.T) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, WithActions(actions.NewDispatcher(mockStore)))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.POST("/actions", h.CreateAction)
+	r.GET("/ioc-lists", h.ListIOCLists)
+	r.POST("/ioc-lists", h.CreateIOCList)
+	r.GET("/ioc-lists/:id", h.GetIOCList)
+	r.PUT("/ioc-lists/:id", h.ReplaceIOCList)
+	r.DELETE("/ioc-lists/:id", h.DeleteIOCList)
+	r.GET("/ioc-matches", h.ListIOCMatches)
+	return r, mockStore, admin
+}
+
+func uploadIOCList(r *gin.Engine, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlers_IOCLists(t *testing.T) {
+	r, _, admin := setupIOCTest(t)
+
+	csv := "type,value,description\nprocess_name,xmrig,XMRig miner\n,44d88612fea8a8f36de82e1278abb02f,EICAR\n"
+	w := uploadIOCList(r, http.MethodPost, "/ioc-lists?name=Miners", "text/csv", csv)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.IOCListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, models.IOCFormatCSV, created.Format)
+	assert.Equal(t, 2, created.IndicatorCount)
+	assert.Equal(t, admin.ID, created.CreatedBy)
+
+	w = uploadIOCList(r, http.MethodPost, "/ioc-lists?name=Miners", "text/csv", csv)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = uploadIOCList(r, http.MethodPost, "/ioc-lists", "text/csv", csv)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a name is required")
+	w = uploadIOCList(r, http.MethodPost, "/ioc-lists?name=Other", "text/plain", csv)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the format must be known")
+	w = uploadIOCList(r, http.MethodPost, "/ioc-lists?name=Other", "text/csv", "sha256,not-a-hash\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	stix := `{"type": "bundle", "objects": [
+		{"type": "indicator", "name": "Miner", "pattern": "[process:name = 'xmrig']"},
+		{"type": "indicator", "name": "C2", "pattern": "[ipv4-addr:value = '203.0.113.7']"}
+	]}`
+	w = uploadIOCList(r, http.MethodPut, "/ioc-lists/"+created.ID+"?name=Crypto%20miners", "application/stix+json", stix)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var replaced models.IOCListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replaced))
+	assert.Equal(t, 1, replaced.Skipped)
+	assert.Equal(t, "Crypto miners", replaced.Name)
+
+	w = doProbeRequest(r, http.MethodGet, "/ioc-lists/"+created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list models.IOCList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, models.IOCFormatSTIX, list.Format)
+	assert.Equal(t, []models.IOCIndicator{{Type: models.IOCTypeProcessName, Value: "xmrig", Description: "Miner"}}, list.Indicators)
+
+	w = doProbeRequest(r, http.MethodGet, "/ioc-lists", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	w = doProbeRequest(r, http.MethodDelete, "/ioc-lists/"+created.ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/ioc-lists/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = uploadIOCList(r, http.MethodPut, "/ioc-lists/"+created.ID, "text/csv", csv)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Ingest_IOCMatch(t *testing.T) {
+	r, mockStore, admin := setupIOCTest(t)
+
+	w := doProbeRequest(r, http.MethodPost, "/actions", models.ActionRequest{
+		Name:     "SOC",
+		Triggers: []string{models.FindingIOCMatch},
+		URL:      "https://soc.example.com/alerts",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var action models.Action
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &action))
+
+	w = uploadIOCList(r, http.MethodPost, "/ioc-lists?name=Miners", "text/csv", "process_name,xmrig,XMRig miner\nfile_name,/tmp/.x/kworker\n")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	ingest := func(data string) {
+		w := doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+			Meta: models.ReportMeta{HostID: hostID, Hostname: "web-1"},
+			Data: json.RawMessage(data),
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "xmrig", "the agent is not told what matched")
+	}
+	ingest(`{"processes": [{"name": "sshd"}, {"name": "xmrig", "exe": "/tmp/.x/kworker"}]}`)
+	ingest(`{"processes": [{"name": "xmrig"}]}`)
+
+	runs, err := mockStore.ListActionRuns(action.ID, admin.OrgID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1, "known matches raise no new finding")
+	assert.Equal(t, models.FindingIOCMatch, runs[0].Finding.Type)
+	assert.Equal(t, "web-1 matched 2 indicators of compromise", runs[0].Finding.Summary)
+	assert.Equal(t, []string{
+		"file_name /tmp/.x/kworker (list Miners) at processes[1].exe",
+		"process_name xmrig (list Miners) at processes[1].name: XMRig miner",
+	}, runs[0].Finding.Details)
+
+	w = doProbeRequest(r, http.MethodGet, "/ioc-matches?host_id="+hostID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Matches []models.IOCMatch `json:"matches"`
+		Total   int               `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 2, resp.Total)
+	for _, match := range resp.Matches {
+		assert.Equal(t, "web-1", match.Hostname)
+		assert.Equal(t, "Miners", match.ListName)
+	}
+
+	w = doProbeRequest(r, http.MethodGet, "/ioc-matches?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+)
+
+// ListJobs returns the scheduled background jobs with their last runs
+// @Summary     List background jobs
+// @Description Returns the scheduled background jobs (stale hosts, host retention, API key expiry) by name, with their interval and last run: when it started and finished, on which replica, and its error if it failed. Runs take a database lock, so whichever replica ran a job last is reported. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Jobs with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/admin/jobs [get]
+func (h *Handlers) ListJobs(c *gin.Context) {
+	statuses, err := h.jobs.Statuses()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list background jobs", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  statuses,
+		"total": len(statuses),
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/jobs"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_ListJobs(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	scheduler := jobs.NewScheduler(mockStore, "replica-1")
+	staleHosts := jobs.Job{Name: "stale-hosts", Interval: 5 * time.Minute, Run: func(context.Context) error { return nil }}
+	scheduler.Add(staleHosts)
+	scheduler.Add(jobs.Job{Name: "api-key-expiry", Interval: time.Hour, Run: func(context.Context) error { return nil }})
+	_, err := scheduler.RunOnce(context.Background(), staleHosts)
+	require.NoError(t, err)
+
+	h := New(mockStore, WithJobs(scheduler))
+	r := setupTestRouter(h)
+	r.GET("/admin/jobs", h.ListJobs)
+
+	w := doProbeRequest(r, http.MethodGet, "/admin/jobs", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Jobs  []models.JobStatus `json:"jobs"`
+		Total int                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, 2, response.Total)
+	assert.Equal(t, "api-key-expiry", response.Jobs[0].Name)
+	assert.Nil(t, response.Jobs[0].LastStartedAt)
+	assert.Equal(t, "stale-hosts", response.Jobs[1].Name)
+	assert.Equal(t, int64(300), response.Jobs[1].IntervalSeconds)
+	assert.Equal(t, int64(1), response.Jobs[1].Runs)
+	assert.Equal(t, "replica-1", response.Jobs[1].LastRunner)
+	assert.NotNil(t, response.Jobs[1].LastSuccessAt)
+}
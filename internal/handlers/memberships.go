@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// ListMyOrganizations lists the organizations the authenticated user can act in
+// @Summary     List my organizations
+// @Description Lists the organizations the authenticated user can act in: its own organization (home) first, then those it is a member of, each with the user's role there.
+// @Description Requests act in the user's own organization unless the X-Org-ID header names another one.
+// @Tags        Auth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Organizations and their count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/auth/orgs [get]
+func (h *Handlers) ListMyOrganizations(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	memberships, err := h.store(c).ListUserOrgMemberships(userID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", userID).
+			Msg("Failed to list organization memberships")
+		_ = c.Error(apierror.Internal("failed to retrieve organizations", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizations": memberships,
+		"total":         len(memberships),
+	})
+}
+
+// ListOrgMembers lists the users of other organizations that are members of the current one (admin-only)
+// @Summary     List organization members
+// @Description Lists the users from other organizations that can act in the current organization, with their role here. The organization's own users are listed by GET /api/v1/users.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Members and their count"
+// @Failure     403  {object}  map[string]string       "Forbidden - admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/orgs/current/members [get]
+func (h *Handlers) ListOrgMembers(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	members, err := h.store(c).ListOrgMembers(orgID)
+	if err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("org_id", orgID).
+			Msg("Failed to list organization members")
+		_ = c.Error(apierror.Internal("failed to retrieve members", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+		"total":   len(members),
+	})
+}
+
+// AddOrgMember lets a user of another organization act in the current one (admin-only)
+// @Summary     Add organization member
+// @Description Makes an existing user of another organization a member of the current organization with one of the roles listed by GET /api/v1/roles. The user selects the organization with the X-Org-ID header.
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.AddOrgMemberRequest  true  "Username and role"
+// @Success     201      {object}  models.OrgMembership  "Member added"
+// @Failure     400      {object}  map[string]string     "Invalid request or role"
+// @Failure     403      {object}  map[string]string     "Forbidden - admin role required"
+// @Failure     404      {object}  map[string]string     "User not found"
+// @Failure     409      {object}  map[string]string     "User already belongs to or is a member of the organization"
+// @Router      /api/v1/orgs/current/members [post]
+func (h *Handlers) AddOrgMember(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	var req models.AddOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if !validateRole(c, req.Role) {
+		return
+	}
+
+	user, _, err := h.store(c).GetUserByUsername(req.Username)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("user not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("username", req.Username).
+			Msg("Failed to get user")
+		_ = c.Error(apierror.Internal("failed to retrieve user", err))
+		return
+	}
+
+	membership, err := h.store(c).AddOrgMembership(user.ID, orgID, req.Role)
+	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyMember) {
+			_ = c.Error(apierror.Conflict("user is already a member of the organization"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", user.ID).
+			Str("org_id", orgID).
+			Msg("Failed to add organization member")
+		_ = c.Error(apierror.Internal("failed to add member", err))
+		return
+	}
+
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditMemberAdded,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+		Details:    map[string]string{"username": user.Username, "role": membership.Role},
+	})
+	c.JSON(http.StatusCreated, membership)
+}
+
+// UpdateOrgMemberRole changes a member's role in the current organization (admin-only)
+// @Summary     Update organization member role
+// @Description Changes the role a user from another organization has in the current organization. Admins cannot update their own role.
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       user_id  path      string                        true  "User ID"
+// @Param       request  body      models.UpdateUserRoleRequest  true  "New role"
+// @Success     200      {object}  models.OrgMembership  "Member updated"
+// @Failure     400      {object}  map[string]string     "Invalid request or role"
+// @Failure     403      {object}  map[string]string     "Forbidden - admin role required or cannot update own role"
+// @Failure     404      {object}  map[string]string     "Not a member of the organization"
+// @Router      /api/v1/orgs/current/members/{user_id}/role [put]
+func (h *Handlers) UpdateOrgMemberRole(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	userID := c.Param("user_id")
+
+	if userID == middleware.GetUserID(c) {
+		_ = c.Error(apierror.Forbidden("cannot update own role").WithDetail("You cannot update your own role. Ask another admin to update it for you."))
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if !validateRole(c, req.Role) {
+		return
+	}
+
+	membership, ok := h.orgMember(c, userID, orgID)
+	if !ok {
+		return
+	}
+
+	oldRole := membership.Role
+	if err := h.store(c).UpdateOrgMembershipRole(userID, orgID, req.Role); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("member not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", userID).
+			Str("new_role", req.Role).
+			Msg("Failed to update organization member role")
+		_ = c.Error(apierror.Internal("failed to update member role", err))
+		return
+	}
+	membership.Role = req.Role
+
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditMemberRoleChanged,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"username": membership.Username, "old_role": oldRole, "new_role": req.Role},
+	})
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveOrgMember removes a user of another organization from the current one (admin-only)
+// @Summary     Remove organization member
+// @Description Removes a user from another organization from the current organization; its requests with X-Org-ID set to this organization are rejected from then on. The user's own account and organization are unaffected.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       user_id  path  string  true  "User ID"
+// @Success     204      "Member removed"
+// @Failure     403      {object}  map[string]string  "Forbidden - admin role required"
+// @Failure     404      {object}  map[string]string  "Not a member of the organization"
+// @Router      /api/v1/orgs/current/members/{user_id} [delete]
+func (h *Handlers) RemoveOrgMember(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	userID := c.Param("user_id")
+
+	membership, ok := h.orgMember(c, userID, orgID)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteOrgMembership(userID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("member not found"))
+			return
+		}
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", userID).
+			Msg("Failed to remove organization member")
+		_ = c.Error(apierror.Internal("failed to remove member", err))
+		return
+	}
+
+	h.audit.Record(c, models.AuditEvent{
+		Action:     models.AuditMemberRemoved,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]string{"username": membership.Username, "role": membership.Role},
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// orgMember loads a user's membership of orgID, responding with 404 and returning
+// false for users that are not members, including the organization's own users
+func (h *Handlers) orgMember(c *gin.Context, userID, orgID string) (*models.OrgMembership, bool) {
+	membership, err := h.store(c).GetOrgMembership(userID, orgID)
+	if err == nil && !membership.Home {
+		return membership, true
+	}
+	if err == nil || errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.NotFound("member not found"))
+		return nil, false
+	}
+	logger.FromContext(c).
+		Err(err).
+		Str("user_id", userID).
+		Msg("Failed to get organization membership")
+	_ = c.Error(apierror.Internal("failed to retrieve member", err))
+	return nil, false
+}
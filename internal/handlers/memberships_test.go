@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_OrgMembers(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Fleet A")
+	otherOrg, _ := mockStore.CreateOrganization("Fleet B")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	colleague, _ := mockStore.CreateUser("colleague", "colleague@example.com", "hash", org.ID, "viewer")
+	bob, _ := mockStore.CreateUser("bob", "bob@example.com", "hash", otherOrg.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/members", h.ListOrgMembers)
+	r.POST("/orgs/current/members", h.AddOrgMember)
+	r.PUT("/orgs/current/members/:user_id/role", h.UpdateOrgMemberRole)
+	r.DELETE("/orgs/current/members/:user_id", h.RemoveOrgMember)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/orgs/current/members", `{"username": "bob", "role": "editor"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var added models.OrgMembership
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+	assert.Equal(t, models.OrgMembership{OrgID: org.ID, OrgName: "Fleet A", UserID: bob.ID, Username: "bob", Role: "editor"}, withoutTime(added))
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/orgs/current/members", `{"username": "bob", "role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/orgs/current/members", `{"username": "colleague", "role": "viewer"}`).Code,
+		"the organization's own users are not members")
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/orgs/current/members", `{"username": "nobody", "role": "viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/orgs/current/members", `{"username": "bob", "role": "owner"}`).Code)
+
+	w = do(http.MethodGet, "/orgs/current/members", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Members []models.OrgMembership `json:"members"`
+		Total   int                    `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Total)
+	assert.Equal(t, bob.ID, list.Members[0].UserID)
+
+	w = do(http.MethodPut, "/orgs/current/members/"+bob.ID+"/role", `{"role": "admin"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	membership, err := mockStore.GetOrgMembership(bob.ID, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", membership.Role)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/orgs/current/members/"+colleague.ID+"/role", `{"role": "admin"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/orgs/current/members/"+admin.ID+"/role", `{"role": "viewer"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/orgs/current/members/"+bob.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/orgs/current/members/"+bob.ID, "").Code)
+	_, err = mockStore.GetOrgMembership(bob.ID, org.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	page, err := mockStore.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 10)
+	require.NoError(t, err)
+	var actions []string
+	for _, event := range page.Events {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{models.AuditMemberRemoved, models.AuditMemberRoleChanged, models.AuditMemberAdded}, actions)
+}
+
+func TestHandlers_ListMyOrganizations(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	home, _ := mockStore.CreateOrganization("Home")
+	fleetB, _ := mockStore.CreateOrganization("B Fleet")
+	fleetA, _ := mockStore.CreateOrganization("a fleet")
+	user, _ := mockStore.CreateUser("alice", "alice@example.com", "hash", home.ID, "editor")
+	_, _ = mockStore.AddOrgMembership(user.ID, fleetB.ID, "admin")
+	_, _ = mockStore.AddOrgMembership(user.ID, fleetA.ID, "viewer")
+
+	r := setupTestRouter(h)
+	r.GET("/auth/orgs", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		h.ListMyOrganizations(c)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/orgs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Organizations []models.OrgMembership `json:"organizations"`
+		Total         int                    `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, 3, response.Total)
+
+	got := make([]models.OrgMembership, 0, len(response.Organizations))
+	for _, m := range response.Organizations {
+		got = append(got, withoutTime(m))
+	}
+	assert.Equal(t, []models.OrgMembership{
+		{OrgID: home.ID, OrgName: "Home", UserID: user.ID, Username: "alice", Role: "editor", Home: true},
+		{OrgID: fleetA.ID, OrgName: "a fleet", UserID: user.ID, Username: "alice", Role: "viewer"},
+		{OrgID: fleetB.ID, OrgName: "B Fleet", UserID: user.ID, Username: "alice", Role: "admin"},
+	}, got, "the user's own organization comes first, then the others by name")
+}
+
+// withoutTime clears a membership's creation time for comparison
+func withoutTime(m models.OrgMembership) models.OrgMembership {
+	m.CreatedAt = time.Time{}
+	return m
+}
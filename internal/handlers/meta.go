@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/swaggo/swag"
+	"gopkg.in/yaml.v3"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+)
+
+// specDriftIgnoredPaths are routes that are not API operations and are never documented
+var specDriftIgnoredPaths = map[string]bool{
+	"/swagger/*any": true,
+}
+
+// specMethods are the OpenAPI path item keys that describe operations
+var specMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// scopeSpec annotates each restricted operation with x-required-roles and, when role
+// is set, drops the operations role cannot call. Operations whose route is not
+// recorded are open to every role. The spec is modified in place.
+func (h *Handlers) scopeSpec(spec map[string]interface{}, role string) map[string]interface{} {
+	if h.routeRoles == nil {
+		return spec
+	}
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		return spec
+	}
+	basePath, _ := spec["basePath"].(string)
+	basePath = strings.TrimSuffix(basePath, "/")
+
+	required := make(map[string][]string)
+	for _, route := range h.routeRoles.Routes() {
+		required[routeKey(route.Method, route.Path)] = route.Roles
+	}
+
+	for path, item := range paths {
+		operations, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for method, operation := range operations {
+			if !specMethods[strings.ToLower(method)] {
+				continue
+			}
+			roles, restricted := required[routeKey(method, basePath+path)]
+			if !restricted {
+				continue
+			}
+			if role != "" && !containsRole(roles, role) {
+				delete(operations, method)
+				continue
+			}
+			if op, ok := operation.(map[string]interface{}); ok {
+				op["x-required-roles"] = roles
+			}
+		}
+		if !hasOperations(operations) {
+			delete(paths, path)
+		}
+	}
+	return spec
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOperations reports whether a path item still describes any operation
+func hasOperations(item map[string]interface{}) bool {
+	for key := range item {
+		if specMethods[strings.ToLower(key)] {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSpecDrift compares the OpenAPI spec with the live route table
+// @Summary     OpenAPI spec drift
+// @Description Compares the OpenAPI specification served by this instance with the routes it actually serves. Reports routes missing from the spec and documented operations that are no longer served.
+// @Description Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.SpecDriftReport  "Spec drift report"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Failure     503  {object}  map[string]string       "Spec or route table unavailable"
+// @Router      /api/v1/meta/spec-drift [get]
+func (h *Handlers) GetSpecDrift(c *gin.Context) {
+	if h.routes == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "route table not available"})
+		return
+	}
+
+	spec, source, err := h.loadOpenAPISpec()
+	if err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to load OpenAPI spec for drift check")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "OpenAPI specification not available",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	report, err := specDrift(spec, h.routes())
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("spec_source", source).Msg("Failed to parse OpenAPI spec for drift check")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "OpenAPI specification not available",
+			"message": err.Error(),
+		})
+		return
+	}
+	report.SpecSource = source
+
+	c.JSON(http.StatusOK, report)
+}
+
+// OpenAPISpec returns the OpenAPI spec served by this instance and where it was loaded from
+func (h *Handlers) OpenAPISpec() (map[string]interface{}, string, error) {
+	return h.loadOpenAPISpec()
+}
+
+// loadOpenAPISpec returns the spec served by /openapi.json and where it was loaded
+// from: the files in the spec directory when one is set (see WithOpenAPISpecDir),
+// otherwise the spec embedded at build time or registered with swag
+func (h *Handlers) loadOpenAPISpec() (map[string]interface{}, string, error) {
+	var spec map[string]interface{}
+
+	if h.specDir != "" {
+		for _, name := range []string{"swagger.json", "swagger.yaml"} {
+			specPath := filepath.Join(h.specDir, name)
+			data, err := os.ReadFile(specPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, specPath, err
+			}
+			// YAML is a superset of JSON, so one decoder handles both
+			if err := yaml.Unmarshal(data, &spec); err != nil {
+				return nil, specPath, fmt.Errorf("invalid spec %s: %w", specPath, err)
+			}
+			return spec, specPath, nil
+		}
+		return nil, h.specDir, fmt.Errorf("no swagger.json or swagger.yaml in %s", h.specDir)
+	}
+
+	doc := h.specJSON
+	if doc == nil {
+		registered, err := swag.ReadDoc()
+		if err != nil {
+			return nil, "", fmt.Errorf("no OpenAPI spec was generated before the build (run make swag)")
+		}
+		doc = []byte(registered)
+	}
+	if err := json.Unmarshal(doc, &spec); err != nil {
+		return nil, "embedded", fmt.Errorf("invalid embedded spec: %w", err)
+	}
+	return spec, "embedded", nil
+}
+
+// loadOpenAPISpecYAML returns the spec served by /openapi.yaml and where it was loaded
+// from. A spec only available in JSON is converted.
+func (h *Handlers) loadOpenAPISpecYAML() ([]byte, string, error) {
+	if h.specDir != "" {
+		specPath := filepath.Join(h.specDir, "swagger.yaml")
+		data, err := os.ReadFile(specPath)
+		if err == nil {
+			return data, specPath, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, specPath, err
+		}
+	} else if h.specYAML != nil {
+		return h.specYAML, "embedded", nil
+	}
+
+	spec, source, err := h.loadOpenAPISpec()
+	if err != nil {
+		return nil, source, err
+	}
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, source, fmt.Errorf("failed to encode spec as YAML: %w", err)
+	}
+	return data, source, nil
+}
+
+// specDrift compares documented operations with registered routes
+// Paths are compared with parameter names erased, so /hosts/:host_id matches
+// /hosts/{host_id} and /hosts/{id} alike.
+func specDrift(spec map[string]interface{}, routes gin.RoutesInfo) (*models.SpecDriftReport, error) {
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("spec has no paths object")
+	}
+	basePath, _ := spec["basePath"].(string)
+	basePath = strings.TrimSuffix(basePath, "/")
+
+	documented := make(map[string]models.SpecRoute)
+	for path, item := range paths {
+		operations, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for method := range operations {
+			if !specMethods[strings.ToLower(method)] {
+				continue
+			}
+			route := models.SpecRoute{Method: strings.ToUpper(method), Path: basePath + path}
+			documented[routeKey(route.Method, route.Path)] = route
+		}
+	}
+
+	report := &models.SpecDriftReport{
+		DocumentedCount:   len(documented),
+		Undocumented:      []models.SpecRoute{},
+		DocumentedMissing: []models.SpecRoute{},
+	}
+
+	served := make(map[string]bool)
+	for _, route := range routes {
+		if specDriftIgnoredPaths[route.Path] {
+			continue
+		}
+		report.RouteCount++
+		key := routeKey(route.Method, route.Path)
+		served[key] = true
+		if _, ok := documented[key]; !ok {
+			report.Undocumented = append(report.Undocumented, models.SpecRoute{
+				Method:  route.Method,
+				Path:    route.Path,
+				Handler: route.Handler,
+			})
+		}
+	}
+	for key, route := range documented {
+		if !served[key] {
+			report.DocumentedMissing = append(report.DocumentedMissing, route)
+		}
+	}
+
+	sortSpecRoutes(report.Undocumented)
+	sortSpecRoutes(report.DocumentedMissing)
+	report.InSync = len(report.Undocumented) == 0 && len(report.DocumentedMissing) == 0
+	return report, nil
+}
+
+// routeKey normalizes a method and path for comparison
+// Router parameters (":id", "*rest") and spec parameters ("{id}") all become "{}"
+func routeKey(method, path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") ||
+			(strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")) {
+			segments[i] = "{}"
+		}
+	}
+	return strings.ToUpper(method) + " " + strings.Join(segments, "/")
+}
+
+func sortSpecRoutes(routes []models.SpecRoute) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/swaggo/swag"
+
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// testSpec is a registered swag doc covering part of the router in TestHandlers_GetSpecDrift
+type testSpec struct{}
+
+func (testSpec) ReadDoc() string {
+	return `{
+		"swagger": "2.0",
+		"basePath": "/api/v1",
+		"paths": {
+			"/hosts": {"get": {}, "parameters": []},
+			"/hosts/{id}": {"get": {}, "delete": {}},
+			"/widgets": {"post": {}}
+		}
+	}`
+}
+
+func TestSpecDrift(t *testing.T) {
+	spec := map[string]interface{}{
+		"paths": map[string]interface{}{
+			"/health":                 map[string]interface{}{"get": map[string]interface{}{}},
+			"/api/v1/hosts/{host_id}": map[string]interface{}{"get": map[string]interface{}{}, "summary": "ignored"},
+			"/api/v1/old":             map[string]interface{}{"get": map[string]interface{}{}},
+		},
+	}
+	routes := gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/health", Handler: "h.Health"},
+		{Method: http.MethodGet, Path: "/api/v1/hosts/:id", Handler: "h.GetHost"},
+		{Method: http.MethodDelete, Path: "/api/v1/hosts/:id", Handler: "h.DeleteHost"},
+		{Method: http.MethodGet, Path: "/swagger/*any"},
+	}
+
+	report, err := specDrift(spec, routes)
+	require.NoError(t, err)
+	assert.False(t, report.InSync)
+	assert.Equal(t, 3, report.RouteCount)
+	assert.Equal(t, 3, report.DocumentedCount)
+	assert.Equal(t, []models.SpecRoute{{Method: http.MethodDelete, Path: "/api/v1/hosts/:id", Handler: "h.DeleteHost"}}, report.Undocumented)
+	assert.Equal(t, []models.SpecRoute{{Method: http.MethodGet, Path: "/api/v1/old"}}, report.DocumentedMissing)
+
+	report, err = specDrift(spec, routes[:2])
+	require.NoError(t, err)
+	assert.Len(t, report.Undocumented, 0)
+
+	_, err = specDrift(map[string]interface{}{"swagger": "2.0"}, routes)
+	assert.Error(t, err)
+}
+
+func TestRouteKey(t *testing.T) {
+	assert.Equal(t, "GET /api/v1/hosts/{}", routeKey("get", "/api/v1/hosts/:host_id"))
+	assert.Equal(t, "GET /api/v1/hosts/{}", routeKey("GET", "/api/v1/hosts/{id}"))
+	assert.Equal(t, "GET /files/{}", routeKey("GET", "/files/*path"))
+	assert.Equal(t, "POST /api/v1/probes/{}/results", routeKey("POST", "/api/v1/probes/{id}/results/"))
+}
+
+func TestScopeSpec(t *testing.T) {
+	roles := middleware.NewRouteRoles()
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.GET("/hosts", func(*gin.Context) {})
+	roles.RequireRole(api, "editor", "admin").DELETE("/hosts/:host_id", func(*gin.Context) {})
+	roles.RequireRole(api, "admin").GET("/users", func(*gin.Context) {})
+	roles.Record(api.Group("/admin"), middleware.SystemAdminRole).GET("/flags", func(*gin.Context) {})
+	h := New(storage.NewMockStorage(), WithRouteRoles(roles))
+
+	newSpec := func() map[string]interface{} {
+		var spec map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"basePath": "/",
+			"paths": {
+				"/api/v1/hosts": {"get": {}},
+				"/api/v1/hosts/{host_id}": {"get": {}, "delete": {}, "parameters": []},
+				"/api/v1/users": {"get": {}},
+				"/api/v1/admin/flags": {"get": {}}
+			}
+		}`), &spec))
+		return spec
+	}
+	operations := func(spec map[string]interface{}) []string {
+		var ops []string
+		for path, item := range spec["paths"].(map[string]interface{}) {
+			for method := range item.(map[string]interface{}) {
+				if specMethods[method] {
+					ops = append(ops, method+" "+path)
+				}
+			}
+		}
+		return ops
+	}
+
+	// Unscoped, every operation is kept and restricted ones are annotated
+	spec := h.scopeSpec(newSpec(), "")
+	assert.Len(t, operations(spec), 5)
+	paths := spec["paths"].(map[string]interface{})
+	hostOps := paths["/api/v1/hosts/{host_id}"].(map[string]interface{})
+	assert.Equal(t, []string{"editor", "admin"}, hostOps["delete"].(map[string]interface{})["x-required-roles"])
+	assert.NotContains(t, hostOps["get"], "x-required-roles")
+
+	assert.ElementsMatch(t, []string{"get /api/v1/hosts", "get /api/v1/hosts/{host_id}"},
+		operations(h.scopeSpec(newSpec(), "viewer")))
+	assert.ElementsMatch(t, []string{"get /api/v1/hosts", "get /api/v1/hosts/{host_id}", "delete /api/v1/hosts/{host_id}"},
+		operations(h.scopeSpec(newSpec(), "editor")))
+	assert.ElementsMatch(t, []string{"get /api/v1/hosts", "get /api/v1/hosts/{host_id}", "delete /api/v1/hosts/{host_id}", "get /api/v1/users"},
+		operations(h.scopeSpec(newSpec(), "admin")))
+
+	// Paths left without operations are dropped
+	_, ok := h.scopeSpec(newSpec(), "viewer")["paths"].(map[string]interface{})["/api/v1/users"]
+	assert.False(t, ok)
+
+	// Without a route role table the spec is served as generated
+	assert.Len(t, operations(New(storage.NewMockStorage()).scopeSpec(newSpec(), "viewer")), 5)
+
+	w := httptest.NewRecorder()
+	hr := setupTestRouter(h)
+	hr.GET("/openapi.json", h.GetOpenAPISpecJSON)
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json?role=owner", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlers_GetSpecDrift(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+
+	// Without a route table the check cannot run
+	h := New(mockStore)
+	r := setupTestRouter(h)
+	r.GET("/meta/spec-drift", h.GetSpecDrift)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/meta/spec-drift", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	swag.Register(swag.Name, testSpec{})
+
+	r = setupTestRouter(nil)
+	h = New(mockStore, WithRouteTable(r.Routes))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/v1/hosts", ok)
+	r.GET("/api/v1/hosts/:host_id", ok)
+	r.DELETE("/api/v1/hosts/:host_id", ok)
+	r.GET("/api/v1/meta/spec-drift", h.GetSpecDrift)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/meta/spec-drift", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report models.SpecDriftReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.InSync)
+	assert.Equal(t, "embedded", report.SpecSource)
+	assert.Equal(t, 4, report.DocumentedCount)
+	require.Len(t, report.Undocumented, 1)
+	assert.Equal(t, "/api/v1/meta/spec-drift", report.Undocumented[0].Path)
+	assert.Equal(t, []models.SpecRoute{{Method: http.MethodPost, Path: "/api/v1/widgets"}}, report.DocumentedMissing)
+}
+
+func TestHandlers_GetOpenAPISpec(t *testing.T) {
+	const specJSON = `{"swagger": "2.0", "info": {"title": "embedded"}, "paths": {}}`
+
+	get := func(h *Handlers, path string) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.GET("/openapi.json", h.GetOpenAPISpecJSON)
+		r.GET("/openapi.yaml", h.GetOpenAPISpecYAML)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// The embedded spec is served from memory; YAML is converted when only JSON was embedded
+	h := New(storage.NewMockStorage(), WithOpenAPISpec([]byte(specJSON), nil))
+	w := get(h, "/openapi.json")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"embedded"`)
+	w = get(h, "/openapi.yaml")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "title: embedded")
+
+	// The spec directory overrides it, and is read on every request
+	dir := t.TempDir()
+	h = New(storage.NewMockStorage(), WithOpenAPISpec([]byte(specJSON), nil), WithOpenAPISpecDir(dir))
+	assert.Equal(t, http.StatusInternalServerError, get(h, "/openapi.json").Code)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "swagger.yaml"), []byte("swagger: \"2.0\"\ninfo:\n  title: local\npaths: {}\n"), 0o644))
+	w = get(h, "/openapi.json")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"local"`)
+	w = get(h, "/openapi.yaml")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "title: local")
+}
@@ -0,0 +1,575 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/auth"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// oauthCodeTTL is how long an authorization code can be exchanged for tokens
+const oauthCodeTTL = 10 * time.Minute
+
+// oauthEnabled writes a 400 response and returns false if delegated tokens are disabled
+func (h *Handlers) oauthEnabled(c *gin.Context) bool {
+	if h.oauthTTL == 0 {
+		_ = c.Error(apierror.Validation("delegated tokens are disabled").WithDetail("Add oauth to AUTH_METHODS to enable them"))
+		return false
+	}
+	return true
+}
+
+// validRedirectURI reports whether a client redirect URI is an absolute https URL,
+// or an http URL on a loopback address for native and development clients
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		if u.Hostname() == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+// oauthError writes an RFC 6749 error response for the token and revocation endpoints
+func oauthError(c *gin.Context, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="snailbus"`)
+	}
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// authenticateOAuthClient verifies the client credentials of a token or revocation request
+// Confidential clients send client_id and client_secret with HTTP Basic auth or in the
+// form; public clients send only client_id. Writes the error response and returns nil on failure.
+func (h *Handlers) authenticateOAuthClient(c *gin.Context) *models.OAuthClient {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if clientID == "" {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication required")
+		return nil
+	}
+
+	client, err := h.store(c).GetOAuthClient(clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "unknown client")
+			return nil
+		}
+		logger.FromContext(c).Err(err).Msg("Failed to get OAuth client")
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to authenticate client")
+		return nil
+	}
+
+	if client.Public {
+		if secret != "" {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "public clients have no secret")
+			return nil
+		}
+		return client
+	}
+	if secret == "" || !auth.ConstantTimeCompare(auth.HashOAuthToken(secret), client.SecretHash) {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return nil
+	}
+	return client
+}
+
+// issueOAuthToken generates an access and refresh token pair
+// Returns the plain tokens and the hashed pair to store.
+func (h *Handlers) issueOAuthToken() (access, refresh string, token models.OAuthToken, err error) {
+	access, token.AccessHash, err = auth.GenerateOAuthToken(auth.OAuthAccessTokenPrefix)
+	if err != nil {
+		return "", "", token, err
+	}
+	refresh, token.RefreshHash, err = auth.GenerateOAuthToken(auth.OAuthRefreshTokenPrefix)
+	if err != nil {
+		return "", "", token, err
+	}
+	token.ExpiresAt = time.Now().UTC().Add(h.oauthTTL)
+	return access, refresh, token, nil
+}
+
+// CreateOAuthClient registers a third-party integration
+// @Summary     Register OAuth client
+// @Description Registers a third-party integration (for example an external dashboard) that users of the organization can authorize to read their hosts with delegated tokens instead of their personal API keys.
+// @Description Scopes are hosts:read (hosts, facets, export, host events), events:read (the event feed), and stats:read (fleet statistics); delegated tokens never modify anything.
+// @Description Redirect URIs must be https, or http on a loopback address. Confidential clients get a client_secret, shown only once; public clients (browser or native apps) have none and must use PKCE. Requires admin role.
+// @Tags        OAuth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.CreateOAuthClientRequest   true  "Client details"
+// @Success     201      {object}  models.CreateOAuthClientResponse  "Client registered"
+// @Failure     400      {object}  map[string]string                 "Invalid client or delegated tokens disabled"
+// @Failure     401      {object}  map[string]string                 "Unauthorized"
+// @Failure     403      {object}  map[string]string                 "Admin role required"
+// @Failure     500      {object}  map[string]string                 "Internal server error"
+// @Router      /api/v1/oauth/clients [post]
+func (h *Handlers) CreateOAuthClient(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	var req models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	scopes, err := auth.ParseOAuthScopes(req.Scopes...)
+	if err != nil || len(scopes) == 0 {
+		_ = c.Error(apierror.Validation("invalid scopes").WithDetail("Scopes must be hosts:read, events:read, or stats:read"))
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			_ = c.Error(apierror.Validation("invalid redirect_uris").WithDetail("Redirect URIs must be https, or http on a loopback address, without a fragment: " + uri))
+			return
+		}
+	}
+
+	client := &models.OAuthClient{
+		ID:              uuid.New().String(),
+		OrgID:           orgID,
+		Name:            strings.TrimSpace(req.Name),
+		RedirectURIs:    req.RedirectURIs,
+		Scopes:          scopes,
+		Public:          req.Public,
+		CreatedByUserID: middleware.GetUserID(c),
+	}
+	var secret string
+	if !client.Public {
+		if secret, client.SecretHash, err = auth.GenerateOAuthToken(auth.OAuthClientSecretPrefix); err != nil {
+			_ = c.Error(apierror.Internal("failed to register client", err))
+			return
+		}
+	}
+
+	if err := h.store(c).CreateOAuthClient(client); err != nil {
+		_ = c.Error(apierror.Internal("failed to register client", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("client_id", client.ID).
+		Strs("scopes", client.Scopes).
+		Bool("public", client.Public).
+		Msg("OAuth client registered")
+
+	c.JSON(http.StatusCreated, models.CreateOAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+// ListOAuthClients returns the organization's registered integrations
+// @Summary     List OAuth clients
+// @Description Returns the third-party integrations registered in the organization. Secrets are never returned. Requires admin role.
+// @Tags        OAuth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Clients"
+// @Failure     400  {object}  map[string]string       "Delegated tokens disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/oauth/clients [get]
+func (h *Handlers) ListOAuthClients(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	clients, err := h.store(c).ListOAuthClients(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list clients", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clients": clients,
+		"total":   len(clients),
+	})
+}
+
+// DeleteOAuthClient removes an integration and revokes every token issued to it
+// @Summary     Delete OAuth client
+// @Description Removes a third-party integration and revokes every grant and token issued to it. Requires admin role.
+// @Tags        OAuth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Client ID"
+// @Success     204  "Client deleted"
+// @Failure     400  {object}  map[string]string  "Delegated tokens disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Client not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/oauth/clients/{id} [delete]
+func (h *Handlers) DeleteOAuthClient(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	clientID := c.Param("id")
+
+	if err := h.store(c).DeleteOAuthClient(clientID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("client not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete client", err))
+		return
+	}
+
+	logger.FromContext(c).Str("client_id", clientID).Msg("OAuth client deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// AuthorizeOAuthClient approves a client's authorization request on behalf of the user
+// @Summary     Authorize OAuth client
+// @Description Called by the consent page once the user approves a client's authorization request (the client_id, redirect_uri, scope, state, code_challenge, and code_challenge_method parameters of the OAuth 2.0 authorization code flow).
+// @Description Returns the redirect_uri with a single-use code, valid for 10 minutes, and the state; the client exchanges the code at /api/v1/oauth/token. scope defaults to all of the client's scopes. PKCE (S256) is required for public clients.
+// @Tags        OAuth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.OAuthAuthorizeRequest   true  "Authorization request"
+// @Success     200      {object}  models.OAuthAuthorizeResponse  "Where to redirect the user"
+// @Failure     400      {object}  map[string]string              "Invalid request or delegated tokens disabled"
+// @Failure     401      {object}  map[string]string              "Unauthorized"
+// @Failure     500      {object}  map[string]string              "Internal server error"
+// @Router      /api/v1/oauth/authorize [post]
+func (h *Handlers) AuthorizeOAuthClient(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	userID := middleware.GetUserID(c)
+
+	var req models.OAuthAuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	client, err := h.store(c).GetOAuthClient(req.ClientID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.Internal("failed to authorize client", err))
+		return
+	}
+	// Clients of other organizations are indistinguishable from unknown ones
+	if err != nil || client.OrgID != orgID {
+		_ = c.Error(apierror.Validation("invalid client_id"))
+		return
+	}
+
+	registered := false
+	for _, uri := range client.RedirectURIs {
+		if uri == req.RedirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		_ = c.Error(apierror.Validation("redirect_uri is not registered for this client"))
+		return
+	}
+
+	scopes := client.Scopes
+	if strings.TrimSpace(req.Scope) != "" {
+		if scopes, err = auth.ParseOAuthScopes(req.Scope); err != nil {
+			_ = c.Error(apierror.Validation("invalid scope").WithDetail(err.Error()))
+			return
+		}
+		for _, scope := range scopes {
+			if !containsString(client.Scopes, scope) {
+				_ = c.Error(apierror.Validation("invalid scope").WithDetail("The client may not request " + scope))
+				return
+			}
+		}
+	}
+
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != "S256" {
+		_ = c.Error(apierror.Validation("code_challenge_method must be S256"))
+		return
+	}
+	if client.Public && req.CodeChallenge == "" {
+		_ = c.Error(apierror.Validation("public clients must use PKCE (code_challenge)"))
+		return
+	}
+
+	code, codeHash, err := auth.GenerateOAuthToken(auth.OAuthCodePrefix)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to authorize client", err))
+		return
+	}
+	err = h.store(c).CreateOAuthCode(&models.OAuthCode{
+		CodeHash:      codeHash,
+		ClientID:      client.ID,
+		UserID:        userID,
+		OrgID:         orgID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to authorize client", err))
+		return
+	}
+
+	redirect, _ := url.Parse(req.RedirectURI) // validated at registration
+	query := redirect.Query()
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	logger.FromContext(c).
+		Str("client_id", client.ID).
+		Strs("scopes", scopes).
+		Msg("OAuth client authorized")
+
+	c.JSON(http.StatusOK, models.OAuthAuthorizeResponse{RedirectTo: redirect.String()})
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthToken exchanges an authorization code or refresh token for delegated tokens
+// @Summary     OAuth token endpoint
+// @Description OAuth 2.0 token endpoint (RFC 6749) for registered clients, form-encoded. grant_type=authorization_code takes code, redirect_uri, and code_verifier (when PKCE was used); grant_type=refresh_token takes refresh_token.
+// @Description Confidential clients authenticate with HTTP Basic auth or client_id and client_secret form fields; public clients send client_id. Refreshing rotates both tokens: the old refresh token stops working.
+// @Description The access token is sent as "Authorization: Bearer <token>" and acts as the authorizing user, limited to read-only endpoints of its scopes.
+// @Tags        OAuth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       grant_type     formData  string  true   "authorization_code or refresh_token"
+// @Param       code           formData  string  false  "Authorization code"
+// @Param       redirect_uri   formData  string  false  "Redirect URI used to obtain the code"
+// @Param       code_verifier  formData  string  false  "PKCE code verifier"
+// @Param       refresh_token  formData  string  false  "Refresh token"
+// @Param       client_id      formData  string  false  "Client ID (without HTTP Basic auth)"
+// @Param       client_secret  formData  string  false  "Client secret (without HTTP Basic auth)"
+// @Success     200  {object}  models.OAuthTokenResponse  "Tokens"
+// @Failure     400  {object}  map[string]string          "invalid_request, invalid_grant, or unsupported_grant_type"
+// @Failure     401  {object}  map[string]string          "invalid_client"
+// @Failure     500  {object}  map[string]string          "server_error"
+// @Router      /api/v1/oauth/token [post]
+func (h *Handlers) OAuthToken(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client := h.authenticateOAuthClient(c)
+	if client == nil {
+		return
+	}
+
+	access, refresh, token, err := h.issueOAuthToken()
+	if err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to generate OAuth tokens")
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to issue tokens")
+		return
+	}
+
+	var grant *models.OAuthGrant
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		code, err := h.store(c).ConsumeOAuthCode(auth.HashOAuthToken(c.PostForm("code")), time.Now())
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.FromContext(c).Err(err).Msg("Failed to consume OAuth code")
+			oauthError(c, http.StatusInternalServerError, "server_error", "failed to issue tokens")
+			return
+		}
+		if err != nil || code.ClientID != client.ID || code.RedirectURI != c.PostForm("redirect_uri") {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid, expired, or already used authorization code")
+			return
+		}
+		if code.CodeChallenge != "" && !auth.VerifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge) {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+			return
+		}
+
+		grant = &models.OAuthGrant{
+			ID:       uuid.New().String(),
+			ClientID: client.ID,
+			UserID:   code.UserID,
+			OrgID:    code.OrgID,
+			Scopes:   code.Scopes,
+			Token:    token,
+		}
+		if err := h.store(c).CreateOAuthGrant(grant); err != nil {
+			logger.FromContext(c).Err(err).Msg("Failed to create OAuth grant")
+			oauthError(c, http.StatusInternalServerError, "server_error", "failed to issue tokens")
+			return
+		}
+		logger.FromContext(c).
+			Str("client_id", client.ID).
+			Str("grant_id", grant.ID).
+			Str("user_id", grant.UserID).
+			Msg("OAuth grant created")
+
+	case "refresh_token":
+		refreshToken := c.PostForm("refresh_token")
+		if refreshToken == "" {
+			oauthError(c, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+			return
+		}
+		grant, err = h.store(c).RotateOAuthToken(client.ID, auth.HashOAuthToken(refreshToken), token)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid or revoked refresh token")
+				return
+			}
+			logger.FromContext(c).Err(err).Msg("Failed to rotate OAuth token")
+			oauthError(c, http.StatusInternalServerError, "server_error", "failed to issue tokens")
+			return
+		}
+
+	case "":
+		oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.oauthTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// RevokeOAuthToken lets a client revoke a delegated token
+// @Summary     OAuth token revocation
+// @Description OAuth 2.0 token revocation endpoint (RFC 7009), form-encoded, authenticated like the token endpoint. Revoking an access or refresh token revokes the whole grant. Unknown tokens are not an error.
+// @Tags        OAuth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       token  formData  string  true  "Access or refresh token"
+// @Success     200  "Token revoked"
+// @Failure     400  {object}  map[string]string  "invalid_request"
+// @Failure     401  {object}  map[string]string  "invalid_client"
+// @Failure     500  {object}  map[string]string  "server_error"
+// @Router      /api/v1/oauth/revoke [post]
+func (h *Handlers) RevokeOAuthToken(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+
+	client := h.authenticateOAuthClient(c)
+	if client == nil {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := h.store(c).RevokeOAuthToken(client.ID, auth.HashOAuthToken(token)); err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to revoke OAuth token")
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to revoke token")
+		return
+	}
+
+	logger.FromContext(c).Str("client_id", client.ID).Msg("OAuth token revoked by client")
+	c.Status(http.StatusOK)
+}
+
+// ListOAuthGrants returns the integrations the user has authorized
+// @Summary     List authorized integrations
+// @Description Returns the third-party integrations the authenticated user has authorized, with their scopes and when they last used their token.
+// @Tags        OAuth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Grants"
+// @Failure     400  {object}  map[string]string       "Delegated tokens disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/oauth/grants [get]
+func (h *Handlers) ListOAuthGrants(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	userID := middleware.GetUserID(c)
+
+	grants, err := h.store(c).ListOAuthGrants(userID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list authorized integrations", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"grants": grants,
+		"total":  len(grants),
+	})
+}
+
+// DeleteOAuthGrant revokes an integration the user has authorized
+// @Summary     Revoke authorized integration
+// @Description Revokes one of the authenticated user's grants; its access and refresh tokens stop working immediately.
+// @Tags        OAuth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Grant ID"
+// @Success     204  "Grant revoked"
+// @Failure     400  {object}  map[string]string  "Delegated tokens disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     404  {object}  map[string]string  "Grant not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/oauth/grants/{id} [delete]
+func (h *Handlers) DeleteOAuthGrant(c *gin.Context) {
+	if !h.oauthEnabled(c) {
+		return
+	}
+	userID := middleware.GetUserID(c)
+	grantID := c.Param("id")
+
+	if err := h.store(c).DeleteOAuthGrant(grantID, userID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("grant not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to revoke integration", err))
+		return
+	}
+
+	logger.FromContext(c).Str("grant_id", grantID).Msg("OAuth grant revoked")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// setupOAuthTest creates an organization with an admin and a viewer and routes acting as them
+func setupOAuthTest(t *testing.T, enabled bool) (r *gin.Engine, viewer *gin.Engine, store *storage.MockStorage, viewerUser *models.User) {
+	store = storage.NewMockStorage()
+	var opts []Option
+	if enabled {
+		opts = append(opts, WithOAuth(time.Hour))
+	}
+	h := New(store, opts...)
+
+	org, _ := store.CreateOrganization("Test Org")
+	admin, _ := store.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewerUser, _ = store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	as := func(user *models.User) *gin.Engine {
+		r := setupTestRouter(h)
+		r.POST("/oauth/token", h.OAuthToken)
+		r.POST("/oauth/revoke", h.RevokeOAuthToken)
+		authed := r.Group("")
+		authed.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		authed.GET("/oauth/clients", h.ListOAuthClients)
+		authed.POST("/oauth/clients", h.CreateOAuthClient)
+		authed.DELETE("/oauth/clients/:id", h.DeleteOAuthClient)
+		authed.POST("/oauth/authorize", h.AuthorizeOAuthClient)
+		authed.GET("/oauth/grants", h.ListOAuthGrants)
+		authed.DELETE("/oauth/grants/:id", h.DeleteOAuthGrant)
+		return r
+	}
+	return as(admin), as(viewerUser), store, viewerUser
+}
+
+// doFormRequest posts a form, with HTTP Basic client credentials if clientID is set
+func doFormRequest(r *gin.Engine, path string, form url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// authorize approves an authorization request as the viewer and returns the code
+func authorize(t *testing.T, r *gin.Engine, req models.OAuthAuthorizeRequest) string {
+	t.Helper()
+	w := doProbeRequest(r, http.MethodPost, "/oauth/authorize", req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp models.OAuthAuthorizeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	redirect, err := url.Parse(resp.RedirectTo)
+	require.NoError(t, err)
+	if req.State != "" {
+		assert.Equal(t, req.State, redirect.Query().Get("state"))
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestHandlers_OAuth_Disabled(t *testing.T) {
+	admin, _, _, _ := setupOAuthTest(t, false)
+
+	w := doProbeRequest(admin, http.MethodGet, "/oauth/clients", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "AUTH_METHODS")
+}
+
+func TestHandlers_OAuth_CreateClient_Validation(t *testing.T) {
+	admin, _, _, _ := setupOAuthTest(t, true)
+
+	invalid := []models.CreateOAuthClientRequest{
+		{Name: "Dashboard", RedirectURIs: []string{"http://dashboard.example.com/callback"}, Scopes: []string{"hosts:read"}},
+		{Name: "Dashboard", RedirectURIs: []string{"https://dashboard.example.com/cb#frag"}, Scopes: []string{"hosts:read"}},
+		{Name: "Dashboard", RedirectURIs: []string{"/callback"}, Scopes: []string{"hosts:read"}},
+		{Name: "Dashboard", RedirectURIs: []string{"https://dashboard.example.com/cb"}, Scopes: []string{"hosts:write"}},
+		{Name: "Dashboard", RedirectURIs: []string{"https://dashboard.example.com/cb"}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(admin, http.MethodPost, "/oauth/clients", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	w := doProbeRequest(admin, http.MethodPost, "/oauth/clients", models.CreateOAuthClientRequest{
+		Name: "CLI", RedirectURIs: []string{"http://127.0.0.1:8765/callback"}, Scopes: []string{"hosts:read"}, Public: true,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "client_secret")
+}
+
+func TestHandlers_OAuth_AuthorizationCodeFlow(t *testing.T) {
+	admin, viewer, store, viewerUser := setupOAuthTest(t, true)
+	const redirectURI = "https://dashboard.example.com/callback"
+
+	w := doProbeRequest(admin, http.MethodPost, "/oauth/clients", models.CreateOAuthClientRequest{
+		Name:         "Dashboard",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{"stats:read", "hosts:read"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var client models.CreateOAuthClientResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &client))
+	require.NotEmpty(t, client.ClientSecret)
+	assert.Equal(t, []string{"hosts:read", "stats:read"}, client.Scopes)
+
+	// Authorization requests must match the client's registration
+	for _, req := range []models.OAuthAuthorizeRequest{
+		{ClientID: "unknown", RedirectURI: redirectURI},
+		{ClientID: client.ID, RedirectURI: "https://evil.example.com/callback"},
+		{ClientID: client.ID, RedirectURI: redirectURI, Scope: "events:read"},
+		{ClientID: client.ID, RedirectURI: redirectURI, CodeChallenge: "abc", CodeChallengeMethod: "plain"},
+	} {
+		w := doProbeRequest(viewer, http.MethodPost, "/oauth/authorize", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	code := authorize(t, viewer, models.OAuthAuthorizeRequest{
+		ClientID:            client.ID,
+		RedirectURI:         redirectURI,
+		Scope:               "hosts:read",
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	})
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+
+	// The client must authenticate
+	w = doFormRequest(viewer, "/oauth/token", exchange, client.ID, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_client")
+
+	w = doFormRequest(viewer, "/oauth/token", exchange, client.ID, client.ClientSecret)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var tokens models.OAuthTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, 3600, tokens.ExpiresIn)
+	assert.Equal(t, "hosts:read", tokens.Scope)
+
+	// Codes are single-use
+	w = doFormRequest(viewer, "/oauth/token", exchange, client.ID, client.ClientSecret)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+
+	// Refreshing rotates both tokens
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	w = doFormRequest(viewer, "/oauth/token", refresh, client.ID, client.ClientSecret)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var refreshed models.OAuthTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+	w = doFormRequest(viewer, "/oauth/token", refresh, client.ID, client.ClientSecret)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The user sees and can revoke the grant
+	w = doProbeRequest(viewer, http.MethodGet, "/oauth/grants", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var grants struct {
+		Grants []models.OAuthGrant `json:"grants"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grants))
+	require.Len(t, grants.Grants, 1)
+	assert.Equal(t, "Dashboard", grants.Grants[0].ClientName)
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	_, err := store.GetOAuthGrantByAccessToken(auth.HashOAuthToken(refreshed.AccessToken), time.Now())
+	require.NoError(t, err)
+
+	w = doProbeRequest(admin, http.MethodDelete, "/oauth/grants/"+grants.Grants[0].ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "only the authorizing user can revoke a grant")
+	w = doProbeRequest(viewer, http.MethodDelete, "/oauth/grants/"+grants.Grants[0].ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, err = store.GetOAuthGrantByAccessToken(auth.HashOAuthToken(refreshed.AccessToken), time.Now())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	grantsLeft, _ := store.ListOAuthGrants(viewerUser.ID)
+	assert.Empty(t, grantsLeft)
+}
+
+func TestHandlers_OAuth_PublicClientAndRevoke(t *testing.T) {
+	admin, viewer, store, _ := setupOAuthTest(t, true)
+	const redirectURI = "http://localhost:8765/callback"
+
+	w := doProbeRequest(admin, http.MethodPost, "/oauth/clients", models.CreateOAuthClientRequest{
+		Name: "CLI", RedirectURIs: []string{redirectURI}, Scopes: []string{"events:read"}, Public: true,
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var client models.CreateOAuthClientResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &client))
+
+	// Public clients must use PKCE
+	w = doProbeRequest(viewer, http.MethodPost, "/oauth/authorize", models.OAuthAuthorizeRequest{ClientID: client.ID, RedirectURI: redirectURI})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	verifier := strings.Repeat("p", 64)
+	sum := sha256.Sum256([]byte(verifier))
+	code := authorize(t, viewer, models.OAuthAuthorizeRequest{
+		ClientID: client.ID, RedirectURI: redirectURI,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]), CodeChallengeMethod: "S256",
+	})
+
+	exchange := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {redirectURI}, "client_id": {client.ID}}
+	w = doFormRequest(viewer, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a missing code_verifier fails the exchange")
+
+	code = authorize(t, viewer, models.OAuthAuthorizeRequest{
+		ClientID: client.ID, RedirectURI: redirectURI,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]), CodeChallengeMethod: "S256",
+	})
+	exchange.Set("code", code)
+	exchange.Set("code_verifier", verifier)
+	w = doFormRequest(viewer, "/oauth/token", exchange, "", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens models.OAuthTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	w = doFormRequest(viewer, "/oauth/token", url.Values{"grant_type": {"password"}, "client_id": {client.ID}}, "", "")
+	assert.Contains(t, w.Body.String(), "unsupported_grant_type")
+
+	// Revoking the refresh token revokes the access token with it
+	w = doFormRequest(viewer, "/oauth/revoke", url.Values{"token": {tokens.RefreshToken}, "client_id": {client.ID}}, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := store.GetOAuthGrantByAccessToken(auth.HashOAuthToken(tokens.AccessToken), time.Now())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Deleting the client leaves nothing behind
+	w = doProbeRequest(admin, http.MethodDelete, "/oauth/clients/"+client.ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(admin, http.MethodDelete, "/oauth/clients/"+client.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
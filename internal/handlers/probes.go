@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// probeJobTimeout bounds a server-side probe job from start to recorded results
+const probeJobTimeout = 10 * time.Minute
+
+// CreateProbeJob starts a reachability probe over a set of hosts
+// @Summary     Start host probe job
+// @Description Checks whether hosts answer on the network, by TCP connect to a port or ICMP echo to their reported hostname.
+// @Description With prober "server" (the default) snailbus probes the hosts itself in the background; this must be enabled with PROBE_FROM_SERVER, and hostnames resolving only to loopback, private, or link-local addresses are not probed. With prober "agent" the job waits for a prober agent to claim it. Requires the admin role.
+// @Description Omit host_ids to probe every host visible to the caller. Poll GET /api/v1/probes/{id} for results.
+// @Tags        Probes
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.CreateProbeJobRequest  true  "Hosts and probe method"
+// @Success     202      {object}  models.ProbeJob    "Probe job accepted"
+// @Failure     400      {object}  map[string]string  "Invalid request or server-side probing disabled"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     403      {object}  map[string]string  "Insufficient role"
+// @Failure     404      {object}  map[string]string  "Host not found"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/probes [post]
+func (h *Handlers) CreateProbeJob(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req models.CreateProbeJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if req.Method == models.ProbeMethodTCP && req.Port == 0 {
+		_ = c.Error(apierror.Validation("port is required for tcp probes"))
+		return
+	}
+	if req.Method == models.ProbeMethodICMP {
+		req.Port = 0
+	}
+	if req.Prober == "" {
+		req.Prober = models.ProberServer
+	}
+	if req.Prober == models.ProberServer && h.prober == nil {
+		_ = c.Error(apierror.Validation("server-side probing is disabled").WithDetail("Set PROBE_FROM_SERVER=true or use prober \"agent\""))
+		return
+	}
+
+	targets, missing, err := h.probeTargets(c, orgID, req.HostIDs)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create probe job", err))
+		return
+	}
+	if missing != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "host not found", "host_id": missing})
+		return
+	}
+	if len(targets) == 0 {
+		_ = c.Error(apierror.Validation("no hosts to probe"))
+		return
+	}
+
+	job := &models.ProbeJob{
+		ID:          uuid.New().String(),
+		Method:      req.Method,
+		Port:        req.Port,
+		Prober:      req.Prober,
+		Status:      models.ProbeJobPending,
+		Targets:     targets,
+		RequestedBy: middleware.GetUserID(c),
+	}
+	if job.Prober == models.ProberServer {
+		job.Status = models.ProbeJobRunning
+	}
+
+	if err := h.store(c).CreateProbeJob(job, orgID); err != nil {
+		_ = c.Error(apierror.Internal("failed to create probe job", err))
+		return
+	}
+
+	if job.Prober == models.ProberServer {
+		go h.runProbeJob(job, orgID)
+	}
+
+	logger.FromContext(c).
+		Str("job_id", job.ID).
+		Str("method", job.Method).
+		Str("prober", job.Prober).
+		Int("hosts", len(job.Targets)).
+		Msg("Probe job created")
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// probeTargets resolves host IDs to probe targets among the hosts visible to the caller
+// With no host IDs every visible host is a target. missing is the first requested
+// host that does not exist or is not visible.
+func (h *Handlers) probeTargets(c *gin.Context, orgID string, hostIDs []string) (targets []models.ProbeTarget, missing string, err error) {
+	hosts, err := h.store(c).ListHosts(orgID, false)
+	if err != nil {
+		return nil, "", err
+	}
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		return nil, "", err
+	}
+	hosts = policy.FilterHosts(hosts)
+
+	if len(hostIDs) == 0 {
+		for _, host := range hosts {
+			targets = append(targets, models.ProbeTarget{HostID: host.HostID, Hostname: host.Hostname})
+		}
+		return targets, "", nil
+	}
+
+	byID := make(map[string]*models.HostSummary, len(hosts))
+	for _, host := range hosts {
+		byID[host.HostID] = host
+	}
+	seen := make(map[string]bool, len(hostIDs))
+	for _, hostID := range hostIDs {
+		host, ok := byID[hostID]
+		if !ok {
+			return nil, hostID, nil
+		}
+		if seen[hostID] {
+			continue
+		}
+		seen[hostID] = true
+		targets = append(targets, models.ProbeTarget{HostID: host.HostID, Hostname: host.Hostname})
+	}
+	return targets, "", nil
+}
+
+// runProbeJob probes a server-side job's targets and records the results
+func (h *Handlers) runProbeJob(job *models.ProbeJob, orgID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeJobTimeout)
+	defer cancel()
+
+	results := h.prober.Run(ctx, job)
+	if err := h.storage.CompleteProbeJob(job.ID, orgID, results); err != nil {
+		logger.Logger.Error().Err(err).Str("job_id", job.ID).Msg("Failed to record probe results")
+		return
+	}
+	h.fireUnreachable(orgID, results)
+
+	reachable := 0
+	for _, result := range results {
+		if result.Reachable {
+			reachable++
+		}
+	}
+	logger.Logger.Info().
+		Str("job_id", job.ID).
+		Int("hosts", len(results)).
+		Int("reachable", reachable).
+		Msg("Probe job completed")
+}
+
+// GetProbeJob returns a probe job and its results
+// @Summary     Get host probe job
+// @Description Returns a probe job's status and, once completed, one result per host. Results for hosts outside the caller's tag-based access policy are omitted.
+// @Tags        Probes
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Probe job ID (UUID)"
+// @Success     200  {object}  models.ProbeJob    "Probe job"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     404  {object}  map[string]string  "Probe job not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/probes/{id} [get]
+func (h *Handlers) GetProbeJob(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	job, err := h.store(c).GetProbeJob(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("probe job not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get probe job", err))
+		return
+	}
+
+	allowed, err := h.visibleHostIDs(c, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to get probe job", err))
+		return
+	}
+	if allowed != nil {
+		targets := job.Targets[:0]
+		for _, target := range job.Targets {
+			if allowed[target.HostID] {
+				targets = append(targets, target)
+			}
+		}
+		job.Targets = targets
+
+		results := job.Results[:0]
+		for _, result := range job.Results {
+			if allowed[result.HostID] {
+				results = append(results, result)
+			}
+		}
+		job.Results = results
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ClaimProbeJob hands the oldest pending agent probe job to the calling prober agent
+// @Summary     Claim host probe job
+// @Description Used by prober agents: claims the oldest pending job with prober "agent" in the organization and marks it running. Returns 204 when there is nothing to do.
+// @Description The agent probes every target and reports back with POST /api/v1/probes/{id}/results.
+// @Tags        Probes
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.ProbeJob    "Claimed probe job"
+// @Success     204  "No pending probe jobs"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/probes/claim [post]
+func (h *Handlers) ClaimProbeJob(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	job, err := h.store(c).ClaimProbeJob(orgID, agentProberName(c))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to claim probe job", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("job_id", job.ID).
+		Str("claimed_by", job.ClaimedBy).
+		Msg("Probe job claimed")
+
+	c.JSON(http.StatusOK, job)
+}
+
+// SubmitProbeResults records the results of a claimed probe job
+// @Summary     Submit host probe results
+// @Description Used by prober agents to report the results of a claimed job, which completes it. Method and port are taken from the job; results for hosts that are not targets of the job are ignored.
+// @Tags        Probes
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id       path      string                           true  "Probe job ID (UUID)"
+// @Param       request  body      models.SubmitProbeResultsRequest  true  "Probe results"
+// @Success     200      {object}  models.ProbeJob    "Completed probe job"
+// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     404      {object}  map[string]string  "Probe job not found"
+// @Failure     409      {object}  map[string]string  "Probe job is not running"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/probes/{id}/results [post]
+func (h *Handlers) SubmitProbeResults(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req models.SubmitProbeResultsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	jobID := c.Param("id")
+	job, err := h.store(c).GetProbeJob(jobID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("probe job not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to record probe results", err))
+		return
+	}
+	if job.Prober != models.ProberAgent {
+		_ = c.Error(apierror.NotFound("probe job not found"))
+		return
+	}
+
+	targets := make(map[string]string, len(job.Targets))
+	for _, target := range job.Targets {
+		targets[target.HostID] = target.Hostname
+	}
+
+	prober := agentProberName(c)
+	now := time.Now().UTC()
+	results := make([]*models.ProbeResult, 0, len(req.Results))
+	for i := range req.Results {
+		result := req.Results[i]
+		hostname, ok := targets[result.HostID]
+		if !ok {
+			continue
+		}
+		result.Hostname = hostname
+		result.Method = job.Method
+		result.Port = job.Port
+		result.Prober = prober
+		if result.ProbedAt.IsZero() || result.ProbedAt.After(now) {
+			result.ProbedAt = now
+		}
+		if !result.Reachable {
+			result.LatencyMS = 0
+		}
+		results = append(results, &result)
+	}
+
+	if err := h.store(c).CompleteProbeJob(jobID, orgID, results); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("probe job not found"))
+			return
+		case errors.Is(err, storage.ErrConflict):
+			// Another submission completed the job first
+			_ = c.Error(apierror.Conflict("probe job is not running"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to record probe results", err))
+		return
+	}
+
+	h.fireUnreachable(orgID, results)
+
+	job, err = h.store(c).GetProbeJob(jobID, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to get probe job", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("job_id", jobID).
+		Int("results", len(results)).
+		Msg("Probe results recorded")
+
+	c.JSON(http.StatusOK, job)
+}
+
+// agentProberName identifies the calling prober agent in probe results
+func agentProberName(c *gin.Context) string {
+	if userValue, exists := c.Get("user"); exists {
+		if user, ok := userValue.(*models.User); ok {
+			return models.ProberAgent + ":" + user.Username
+		}
+	}
+	return models.ProberAgent
+}
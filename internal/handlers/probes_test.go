@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/probe"
+	"snailbus/internal/storage"
+)
+
+const (
+	probeHostUp   = "00000000-0000-0000-0000-000000000001"
+	probeHostDown = "00000000-0000-0000-0000-000000000002"
+)
+
+// setupProbeTest creates an organization with two hosts and a router acting as its admin
+func setupProbeTest(t *testing.T, opts ...Option) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("prober", "prober@example.com", "hash", org.ID, "admin")
+	for hostID, hostname := range map[string]string{probeHostUp: "127.0.0.1", probeHostDown: "down.invalid"} {
+		mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID)
+	}
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/hosts", h.ListHosts)
+	r.POST("/probes", h.CreateProbeJob)
+	r.POST("/probes/claim", h.ClaimProbeJob)
+	r.GET("/probes/:id", h.GetProbeJob)
+	r.POST("/probes/:id/results", h.SubmitProbeResults)
+	return r, mockStore, admin
+}
+
+func doProbeRequest(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(payload)))
+	return w
+}
+
+func TestHandlers_CreateProbeJob_Validation(t *testing.T) {
+	r, _, _ := setupProbeTest(t)
+
+	// Server-side probing is off unless a prober is configured
+	w := doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "tcp", Port: 22})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "tcp", Prober: "agent"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "udp", Port: 53, Prober: "agent"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{
+		Method:  "icmp",
+		Prober:  "agent",
+		HostIDs: []string{"00000000-0000-0000-0000-000000000099"},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_ProbeJob_Agent(t *testing.T) {
+	r, _, _ := setupProbeTest(t)
+
+	// Nothing to claim yet
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodPost, "/probes/claim", nil).Code)
+
+	w := doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "icmp", Prober: "agent"})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job models.ProbeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.ProbeJobPending, job.Status)
+	assert.Len(t, job.Targets, 2)
+
+	w = doProbeRequest(r, http.MethodPost, "/probes/claim", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var claimed models.ProbeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claimed))
+	assert.Equal(t, job.ID, claimed.ID)
+	assert.Equal(t, models.ProbeJobRunning, claimed.Status)
+	assert.Equal(t, "agent:prober", claimed.ClaimedBy)
+
+	// A claimed job is not handed out twice
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodPost, "/probes/claim", nil).Code)
+
+	w = doProbeRequest(r, http.MethodPost, "/probes/"+job.ID+"/results", models.SubmitProbeResultsRequest{
+		Results: []models.ProbeResult{
+			{HostID: probeHostUp, Reachable: true, LatencyMS: 1.5},
+			{HostID: probeHostDown, Error: "dns: no such host"},
+			{HostID: "00000000-0000-0000-0000-000000000099", Reachable: true}, // not a target
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var completed models.ProbeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &completed))
+	assert.Equal(t, models.ProbeJobCompleted, completed.Status)
+	require.Len(t, completed.Results, 2)
+	for _, result := range completed.Results {
+		assert.Equal(t, models.ProbeMethodICMP, result.Method)
+		assert.Equal(t, "agent:prober", result.Prober)
+	}
+
+	// Completed jobs cannot be reported twice
+	w = doProbeRequest(r, http.MethodPost, "/probes/"+job.ID+"/results", models.SubmitProbeResultsRequest{
+		Results: []models.ProbeResult{{HostID: probeHostUp}},
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The latest probe is shown next to last_seen
+	w = doProbeRequest(r, http.MethodGet, "/hosts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Hosts []models.HostSummary `json:"hosts"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Hosts, 2)
+	for _, host := range listed.Hosts {
+		require.NotNil(t, host.LastProbe, host.HostID)
+		assert.Equal(t, host.HostID == probeHostUp, host.LastProbe.Reachable)
+	}
+}
+
+func TestHandlers_ProbeJob_Server(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	r, _, _ := setupProbeTest(t, WithProber(probe.New(2*time.Second)))
+
+	w := doProbeRequest(r, http.MethodPost, "/probes", models.CreateProbeJobRequest{Method: "tcp", Port: port})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job models.ProbeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.ProbeJobRunning, job.Status)
+
+	// Server jobs are not handed to agents
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodPost, "/probes/claim", nil).Code)
+
+	var completed models.ProbeJob
+	require.Eventually(t, func() bool {
+		w := doProbeRequest(r, http.MethodGet, "/probes/"+job.ID, nil)
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &completed) != nil {
+			return false
+		}
+		return completed.Status == models.ProbeJobCompleted
+	}, 10*time.Second, 20*time.Millisecond)
+
+	require.Len(t, completed.Results, 2)
+	for _, result := range completed.Results {
+		switch result.HostID {
+		case probeHostUp:
+			// The host reports a loopback address, which the server does not probe
+			assert.False(t, result.Reachable)
+			assert.Contains(t, result.Error, outbound.ErrForbiddenAddress.Error())
+		case probeHostDown:
+			assert.False(t, result.Reachable)
+			assert.Contains(t, result.Error, "dns:")
+		}
+	}
+
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/probes/unknown", nil).Code)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// VerifyReceipt checks a stored ingest receipt against the server signing key
+// @Summary     Verify ingest receipt
+// @Description Loads an ingest receipt issued to the authenticated user's organization and verifies its signature with the current server signing key.
+// @Description The response includes the base64 Ed25519 public key so the receipt can also be verified offline.
+// @Tags        Ingest
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Receipt ID"
+// @Success     200  {object}  models.ReceiptVerification  "Verification result"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     404  {object}  map[string]string  "Receipt not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/receipts/{id}/verify [get]
+func (h *Handlers) VerifyReceipt(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	receipt, err := h.store(c).GetReceipt(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("receipt not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("receipt_id", c.Param("id")).Msg("Failed to get receipt")
+		_ = c.Error(apierror.Internal("failed to retrieve receipt", err))
+		return
+	}
+
+	result := models.ReceiptVerification{
+		Valid:     true,
+		Receipt:   receipt,
+		PublicKey: h.receipts.PublicKey(),
+	}
+	if err := h.receipts.Verify(receipt); err != nil {
+		result.Valid = false
+		result.Reason = err.Error()
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/receipts"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_IngestReceipt(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	signer, err := receipts.GenerateSigner()
+	require.NoError(t, err)
+	h := New(mockStore, WithReceiptSigner(signer))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+	otherOrg, _ := mockStore.CreateOrganization("Other Org")
+	otherUser, _ := mockStore.CreateUser("otheruser", "other@example.com", "hash", otherOrg.ID, "admin")
+
+	asUser := func(user *models.User) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", user.ID)
+			c.Set("user", user)
+			c.Set("org_id", user.OrgID)
+		}
+	}
+
+	r := setupTestRouter(h)
+	r.POST("/ingest", asUser(user), h.Ingest)
+	r.GET("/receipts/:id/verify", asUser(user), h.VerifyReceipt)
+	r.GET("/other/receipts/:id/verify", asUser(otherUser), h.VerifyReceipt)
+
+	body, _ := json.Marshal(models.IngestRequest{
+		Meta: models.ReportMeta{
+			HostID:       "00000000-0000-0000-0000-000000000001",
+			Hostname:     "test-host",
+			CollectionID: "collection-1",
+			Timestamp:    time.Now().Format(time.RFC3339),
+		},
+		Data: json.RawMessage(`{}`),
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.IngestResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Receipt)
+	sum := sha256.Sum256(body)
+	assert.Equal(t, receipts.Checksum(sum[:]), response.Receipt.Checksum)
+	assert.Equal(t, "collection-1", response.Receipt.CollectionID)
+	assert.NoError(t, signer.Verify(response.Receipt))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/receipts/"+response.Receipt.ID+"/verify", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var verification models.ReceiptVerification
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verification))
+	assert.True(t, verification.Valid)
+	assert.Equal(t, signer.PublicKey(), verification.PublicKey)
+
+	// Receipts are scoped to the organization that received the report
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other/receipts/"+response.Receipt.ID+"/verify", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A server using a different key reports the mismatch
+	rotated := New(mockStore)
+	r2 := setupTestRouter(rotated)
+	r2.GET("/receipts/:id/verify", asUser(user), rotated.VerifyReceipt)
+	w = httptest.NewRecorder()
+	r2.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/receipts/"+response.Receipt.ID+"/verify", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verification))
+	assert.False(t, verification.Valid)
+	assert.Equal(t, receipts.ErrKeyMismatch.Error(), verification.Reason)
+}
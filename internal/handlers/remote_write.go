@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+// remoteWriteEnabled writes a 400 response and returns false if remote-write export is disabled
+func (h *Handlers) remoteWriteEnabled(c *gin.Context) bool {
+	if h.remoteWrite == nil {
+		_ = c.Error(apierror.Validation("remote write is disabled").WithDetail("Set REMOTE_WRITE_ENABLED=true to enable it"))
+		return false
+	}
+	return true
+}
+
+// GetRemoteWrite returns the organization's Prometheus remote-write target
+// @Summary     Get remote-write target
+// @Description Returns the Prometheus remote-write endpoint that receives the organization's fleet gauges, with the time and error of the last push. Credentials are never returned. The ETag header carries the target's version for If-Match. Requires admin role and REMOTE_WRITE_ENABLED.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.RemoteWriteConfig  "Remote-write target"
+// @Failure     400  {object}  map[string]string         "Remote write disabled"
+// @Failure     401  {object}  map[string]string         "Unauthorized"
+// @Failure     403  {object}  map[string]string         "Admin role required"
+// @Failure     404  {object}  map[string]string         "No remote-write target configured"
+// @Failure     500  {object}  map[string]string         "Internal server error"
+// @Router      /api/v1/orgs/current/remote-write [get]
+func (h *Handlers) GetRemoteWrite(c *gin.Context) {
+	if !h.remoteWriteEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	config, err := h.store(c).GetRemoteWriteConfig(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no remote-write target configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get remote-write target", err))
+		return
+	}
+
+	setETag(c, config.Version)
+	c.JSON(http.StatusOK, config)
+}
+
+// SetRemoteWrite configures the organization's Prometheus remote-write target
+// @Summary     Set remote-write target
+// @Description Pushes per-host gauges to a Prometheus remote-write endpoint (Prometheus with --web.enable-remote-write-receiver, Mimir, Thanos, VictoriaMetrics, ...) every REMOTE_WRITE_INTERVAL:
+// @Description snailbus_host_up (1 if the host reported within REMOTE_WRITE_STALE_AFTER), snailbus_host_report_age_seconds, and snailbus_host_packages, labelled with host_id and hostname.
+// @Description Select a subset with metrics (up, report_age, packages). Authenticate with username and password or with bearer_token.
+// @Description With If-Match, the target is only replaced if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                        false  "ETag of the target being replaced"
+// @Param       request  body      models.SetRemoteWriteRequest  true   "Remote-write target"
+// @Success     200      {object}  models.RemoteWriteConfig      "Remote-write target set"
+// @Failure     400      {object}  map[string]string             "Invalid target or remote write disabled"
+// @Failure     401      {object}  map[string]string             "Unauthorized"
+// @Failure     403      {object}  map[string]string             "Admin role required"
+// @Failure     412      {object}  map[string]string             "Target changed since If-Match was read"
+// @Failure     500      {object}  map[string]string             "Internal server error"
+// @Router      /api/v1/orgs/current/remote-write [put]
+func (h *Handlers) SetRemoteWrite(c *gin.Context) {
+	if !h.remoteWriteEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetRemoteWriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	target, err := outbound.CheckURL(req.URL)
+	if err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if req.BearerToken != "" && (req.Username != "" || req.Password != "") {
+		_ = c.Error(apierror.Validation("use either username and password or bearer_token"))
+		return
+	}
+	if req.Password != "" && req.Username == "" {
+		_ = c.Error(apierror.Validation("password requires a username"))
+		return
+	}
+
+	config := &models.RemoteWriteConfig{
+		OrgID:       orgID,
+		URL:         target.String(),
+		Metrics:     req.Metrics,
+		Username:    req.Username,
+		Password:    req.Password,
+		BearerToken: req.BearerToken,
+		Version:     ifVersion,
+	}
+	if err := h.store(c).SetRemoteWriteConfig(config); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set remote-write target", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("host", target.Host).
+		Str("auth", config.Auth).
+		Msg("Remote-write target set")
+
+	setETag(c, config.Version)
+	c.JSON(http.StatusOK, config)
+}
+
+// DeleteRemoteWrite stops pushing the organization's fleet gauges
+// @Summary     Delete remote-write target
+// @Description Removes the organization's remote-write target and its credentials. With If-Match, the target is only removed if its ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the target being removed"
+// @Success     204  "Remote-write target deleted"
+// @Failure     400  {object}  map[string]string  "Remote write disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No remote-write target configured"
+// @Failure     412  {object}  map[string]string  "Target changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/remote-write [delete]
+func (h *Handlers) DeleteRemoteWrite(c *gin.Context) {
+	if !h.remoteWriteEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteRemoteWriteConfig(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no remote-write target configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete remote-write target", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Remote-write target deleted")
+	c.Status(http.StatusNoContent)
+}
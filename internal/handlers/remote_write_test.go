@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/remotewrite"
+	"snailbus/internal/storage"
+)
+
+// setupRemoteWriteTest creates an organization and a router acting as its admin
+func setupRemoteWriteTest(t *testing.T, enabled bool) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	var opts []Option
+	if enabled {
+		opts = append(opts, WithRemoteWrite(remotewrite.NewExporter(mockStore, time.Minute, 24*time.Hour)))
+	}
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/remote-write", h.GetRemoteWrite)
+	r.PUT("/orgs/current/remote-write", h.SetRemoteWrite)
+	r.DELETE("/orgs/current/remote-write", h.DeleteRemoteWrite)
+	return r, mockStore, admin
+}
+
+func TestHandlers_RemoteWrite_Disabled(t *testing.T) {
+	r, _, _ := setupRemoteWriteTest(t, false)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/remote-write", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "REMOTE_WRITE_ENABLED")
+}
+
+func TestHandlers_RemoteWrite(t *testing.T) {
+	r, mockStore, admin := setupRemoteWriteTest(t, true)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/remote-write", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	invalid := []models.SetRemoteWriteRequest{
+		{URL: "ftp://prometheus.example.com/api/v1/write"},
+		{URL: "prometheus.example.com"},
+		{URL: "http://localhost:9090/api/v1/write"},
+		{URL: "http://10.0.0.5:9090/api/v1/write"},
+		{URL: "https://prometheus.example.com", Username: "u", BearerToken: "t"},
+		{URL: "https://prometheus.example.com", Password: "p"},
+		{URL: "https://prometheus.example.com", Metrics: []string{"cpu"}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPut, "/orgs/current/remote-write", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	w = doProbeRequest(r, http.MethodPut, "/orgs/current/remote-write", models.SetRemoteWriteRequest{
+		URL:      "https://prometheus.example.com/api/v1/write",
+		Metrics:  []string{models.RemoteWriteMetricUp},
+		Username: "tenant-1",
+		Password: "s3cret",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "s3cret")
+
+	w = doProbeRequest(r, http.MethodGet, "/orgs/current/remote-write", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cret")
+	var config models.RemoteWriteConfig
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, "basic", config.Auth)
+	assert.Equal(t, []string{models.RemoteWriteMetricUp}, config.Metrics)
+
+	stored, err := mockStore.GetRemoteWriteConfig(admin.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", stored.Password)
+
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/remote-write", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/remote-write", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/reports"
+	"snailbus/internal/storage"
+)
+
+// maxListedReports is how many of the most recent reports ListReports returns
+const maxListedReports = 100
+
+// GenerateReport generates a fleet report on demand
+// @Summary     Generate fleet report
+// @Description Generates a report of the organization's hosts: inventory (hosts by OS and tag), compliance (check-in window, reachability, and collection errors of each host), or os_currency (hosts behind the newest OS version in the fleet). Archived hosts are left out.
+// @Description With email=true the report is also sent, as HTML with a PDF attached, to the organization's active admins; a failed delivery is recorded in email_error. Email requires SMTP_HOST on the server. Requires admin role.
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.GenerateReportRequest  true  "Report kind"
+// @Success     201      {object}  models.FleetReport            "Report generated"
+// @Failure     400      {object}  map[string]string             "Invalid request or email not configured"
+// @Failure     401      {object}  map[string]string             "Unauthorized"
+// @Failure     403      {object}  map[string]string             "Admin role required"
+// @Failure     500      {object}  map[string]string             "Internal server error"
+// @Router      /api/v1/reports [post]
+func (h *Handlers) GenerateReport(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	var req models.GenerateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	report, err := h.reports.Create(c.Request.Context(), orgID, req.Kind, models.ReportTriggerOnDemand, middleware.GetUserID(c), req.Email)
+	if err != nil {
+		if errors.Is(err, reports.ErrEmailNotConfigured) {
+			_ = c.Error(apierror.Validation(err.Error()))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("kind", req.Kind).Msg("Failed to generate fleet report")
+		_ = c.Error(apierror.Internal("failed to generate report", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("report_id", report.ID).
+		Str("kind", report.Kind).
+		Int("emailed_to", len(report.EmailedTo)).
+		Msg("Fleet report generated")
+	c.JSON(http.StatusCreated, report)
+}
+
+// ListReports returns the organization's recent fleet reports
+// @Summary     List fleet reports
+// @Description Returns the organization's 100 most recent reports, newest first, without their content. Download a report with GET /reports/{id}. Requires admin role.
+// @Tags        Reports
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Reports with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/reports [get]
+func (h *Handlers) ListReports(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	list, err := h.store(c).ListFleetReports(orgID, maxListedReports)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list reports", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": list,
+		"total":   len(list),
+	})
+}
+
+// GetReport downloads a fleet report
+// @Summary     Download fleet report
+// @Description Returns a report rendered as a standalone HTML page (format=html, the default) or as a PDF file (format=pdf). Requires admin role.
+// @Tags        Reports
+// @Produce     html
+// @Produce     application/pdf
+// @Security    ApiKeyAuth
+// @Param       id      path      string             true   "Report ID (UUID)"
+// @Param       format  query     string             false  "html or pdf"  Enums(html, pdf)
+// @Success     200     {file}    file               "Rendered report"
+// @Failure     400     {object}  map[string]string  "Invalid format"
+// @Failure     401     {object}  map[string]string  "Unauthorized"
+// @Failure     403     {object}  map[string]string  "Admin role required"
+// @Failure     404     {object}  map[string]string  "Report not found"
+// @Failure     500     {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/reports/{id} [get]
+func (h *Handlers) GetReport(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	format := c.DefaultQuery("format", models.ReportFormatHTML)
+	if format != models.ReportFormatHTML && format != models.ReportFormatPDF {
+		_ = c.Error(apierror.Validation("format must be html or pdf"))
+		return
+	}
+
+	report, err := h.store(c).GetFleetReport(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("report not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get report", err))
+		return
+	}
+
+	if format == models.ReportFormatPDF {
+		c.Header("Content-Disposition", `attachment; filename="`+reports.Filename(report, format)+`"`)
+		c.Data(http.StatusOK, "application/pdf", reports.RenderPDF(report))
+		return
+	}
+	html, err := reports.RenderHTML(report)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("report_id", report.ID).Msg("Failed to render fleet report")
+		_ = c.Error(apierror.Internal("failed to render report", err))
+		return
+	}
+	c.Header("Content-Disposition", `inline; filename="`+reports.Filename(report, format)+`"`)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// GetReportSchedule returns the organization's report schedule
+// @Summary     Get report schedule
+// @Description Returns which reports are generated for the organization, how often, and when next. The ETag header carries the schedule's version for If-Match. Requires admin role.
+// @Tags        Reports
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.ReportSchedule  "Report schedule"
+// @Failure     401  {object}  map[string]string      "Unauthorized"
+// @Failure     403  {object}  map[string]string      "Admin role required"
+// @Failure     404  {object}  map[string]string      "No report schedule configured"
+// @Failure     500  {object}  map[string]string      "Internal server error"
+// @Router      /api/v1/orgs/current/report-schedule [get]
+func (h *Handlers) GetReportSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	schedule, err := h.store(c).GetReportSchedule(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no report schedule configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get report schedule", err))
+		return
+	}
+
+	setETag(c, schedule.Version)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// SetReportSchedule replaces the organization's report schedule
+// @Summary     Set report schedule
+// @Description Generates the listed report kinds daily, weekly, or monthly, starting one period from now. With email=true each report is sent to the organization's active admins, which requires SMTP_HOST on the server. Scheduled reports are listed by GET /reports like on-demand ones.
+// @Description With If-Match, the schedule is only replaced if its ETag still matches. Requires admin role.
+// @Tags        Reports
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                           false  "ETag of the schedule being replaced"
+// @Param       request  body      models.SetReportScheduleRequest  true   "Report kinds and frequency"
+// @Success     200      {object}  models.ReportSchedule            "Report schedule set"
+// @Failure     400      {object}  map[string]string                "Invalid schedule or email not configured"
+// @Failure     401      {object}  map[string]string                "Unauthorized"
+// @Failure     403      {object}  map[string]string                "Admin role required"
+// @Failure     412      {object}  map[string]string                "Schedule changed since If-Match was read"
+// @Failure     500      {object}  map[string]string                "Internal server error"
+// @Router      /api/v1/orgs/current/report-schedule [put]
+func (h *Handlers) SetReportSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	if req.Email && !h.reports.CanEmail() {
+		_ = c.Error(apierror.Validation(reports.ErrEmailNotConfigured.Error()))
+		return
+	}
+	kinds := make([]string, 0, len(req.Kinds))
+	seen := make(map[string]bool, len(req.Kinds))
+	for _, kind := range req.Kinds {
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+
+	schedule := &models.ReportSchedule{
+		OrgID:           orgID,
+		Kinds:           kinds,
+		Frequency:       req.Frequency,
+		Email:           req.Email,
+		NextRunAt:       models.NextRun(req.Frequency, time.Now().UTC()),
+		UpdatedByUserID: middleware.GetUserID(c),
+		Version:         ifVersion,
+	}
+	if err := h.store(c).SetReportSchedule(schedule); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set report schedule", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Strs("kinds", schedule.Kinds).
+		Str("frequency", schedule.Frequency).
+		Bool("email", schedule.Email).
+		Msg("Report schedule set")
+	setETag(c, schedule.Version)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteReportSchedule stops scheduled reports
+// @Summary     Delete report schedule
+// @Description Stops generating scheduled reports for the organization. Reports already generated are kept. With If-Match, the schedule is only removed if its ETag still matches. Requires admin role.
+// @Tags        Reports
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the schedule being removed"
+// @Success     204  "Report schedule deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No report schedule configured"
+// @Failure     412  {object}  map[string]string  "Schedule changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/report-schedule [delete]
+func (h *Handlers) DeleteReportSchedule(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteReportSchedule(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no report schedule configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete report schedule", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Report schedule deleted")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_Reports(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	hostID := "00000000-0000-0000-0000-000000000001"
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now().UTC(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "web-1"},
+		Data:       json.RawMessage(`{"system":{"os":{"name":"Debian","version":"12"}}}`),
+	}, org.ID, admin.ID))
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/reports", h.GenerateReport)
+	r.GET("/reports", h.ListReports)
+	r.GET("/reports/:id", h.GetReport)
+
+	// Invalid kinds are rejected, and email needs SMTP_HOST
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodPost, "/reports", models.GenerateReportRequest{Kind: "weekly"}).Code)
+	w := doProbeRequest(r, http.MethodPost, "/reports", models.GenerateReportRequest{Kind: models.ReportKindInventory, Email: true})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "email is not configured")
+
+	w = doProbeRequest(r, http.MethodPost, "/reports", models.GenerateReportRequest{Kind: models.ReportKindInventory})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var report models.FleetReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "Fleet inventory - Test Org", report.Title)
+	assert.Equal(t, models.ReportTriggerOnDemand, report.Trigger)
+	assert.Equal(t, admin.ID, report.RequestedBy)
+
+	w = doProbeRequest(r, http.MethodGet, "/reports", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Reports []models.FleetReport `json:"reports"`
+		Total   int                  `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Total)
+	assert.Equal(t, report.ID, list.Reports[0].ID)
+
+	// HTML by default
+	w = doProbeRequest(r, http.MethodGet, "/reports/"+report.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/html"))
+	assert.Contains(t, w.Body.String(), "<td>web-1</td>")
+
+	w = doProbeRequest(r, http.MethodGet, "/reports/"+report.ID+"?format=pdf", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `attachment; filename="snailbus-inventory-`)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF-"))
+
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodGet, "/reports/"+report.ID+"?format=docx", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/reports/00000000-0000-0000-0000-00000000ffff", nil).Code)
+
+	// Reports of other organizations are not found
+	otherOrg, _ := mockStore.CreateOrganization("Other Org")
+	other := gin.New()
+	other.Use(middleware.ErrorHandler())
+	other.Use(func(c *gin.Context) { c.Set("org_id", otherOrg.ID) })
+	other.GET("/reports/:id", h.GetReport)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(other, http.MethodGet, "/reports/"+report.ID, nil).Code)
+}
+
+func TestHandlers_ReportSchedule(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/report-schedule", h.GetReportSchedule)
+	r.PUT("/orgs/current/report-schedule", h.SetReportSchedule)
+	r.DELETE("/orgs/current/report-schedule", h.DeleteReportSchedule)
+
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/orgs/current/report-schedule", nil).Code)
+
+	invalid := []models.SetReportScheduleRequest{
+		{Frequency: models.ReportFrequencyDaily},
+		{Kinds: []string{"uptime"}, Frequency: models.ReportFrequencyDaily},
+		{Kinds: []string{models.ReportKindInventory}, Frequency: "hourly"},
+		{Kinds: []string{models.ReportKindInventory}, Frequency: models.ReportFrequencyDaily, Email: true},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPut, "/orgs/current/report-schedule", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	before := time.Now().UTC()
+	w := doProbeRequest(r, http.MethodPut, "/orgs/current/report-schedule", models.SetReportScheduleRequest{
+		Kinds:     []string{models.ReportKindCompliance, models.ReportKindInventory, models.ReportKindCompliance},
+		Frequency: models.ReportFrequencyWeekly,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var schedule models.ReportSchedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+	assert.Equal(t, []string{models.ReportKindCompliance, models.ReportKindInventory}, schedule.Kinds, "duplicates dropped")
+	assert.Equal(t, admin.ID, schedule.UpdatedByUserID)
+	assert.WithinDuration(t, before.AddDate(0, 0, 7), schedule.NextRunAt, time.Minute)
+	assert.Nil(t, schedule.LastRunAt)
+
+	assert.Equal(t, http.StatusOK, doProbeRequest(r, http.MethodGet, "/orgs/current/report-schedule", nil).Code)
+	assert.Equal(t, http.StatusNoContent, doProbeRequest(r, http.MethodDelete, "/orgs/current/report-schedule", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodDelete, "/orgs/current/report-schedule", nil).Code)
+}
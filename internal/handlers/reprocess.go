@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/reprocess"
+	"snailbus/internal/storage"
+)
+
+// StartReprocess starts re-deriving stored hosts from their raw reports
+// @Summary     Start reprocess job
+// @Description Replays the host event stream of one organization, or of every organization when org_id is omitted, to rewrite hosts, tags, and details with the current derivation logic, then rebuilds each organization's facet counters.
+// @Description Hosts are rewritten by up to workers (default 1) at a time, started at up to hosts_per_second (default 50) so ingest is not starved. An organization's facet counters are rebuilt as soon as all of its hosts are done. Only one job runs at a time; jobs are tracked in memory by the instance that runs them. Requires system administrator privileges.
+// @Tags        Admin
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.StartReprocessRequest  true  "Organization and throttle"
+// @Success     202      {object}  models.ReprocessJob           "Job started"
+// @Failure     400      {object}  map[string]string             "Invalid request"
+// @Failure     401      {object}  map[string]string             "Unauthorized"
+// @Failure     403      {object}  map[string]string             "System administrator access required"
+// @Failure     404      {object}  map[string]string             "Organization not found"
+// @Failure     409      {object}  map[string]string             "A reprocess job is already running"
+// @Failure     500      {object}  map[string]string             "Internal server error"
+// @Router      /api/v1/admin/reprocess [post]
+func (h *Handlers) StartReprocess(c *gin.Context) {
+	var req models.StartReprocessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	if req.OrgID != "" {
+		if _, err := h.store(c).GetOrganizationByID(req.OrgID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				_ = c.Error(apierror.NotFound("organization not found"))
+				return
+			}
+			logger.FromContext(c).Err(err).Str("target_org_id", req.OrgID).Msg("Failed to get organization")
+			_ = c.Error(apierror.Internal("failed to start reprocess job", err))
+			return
+		}
+	}
+
+	job, err := h.reprocess.Start(req.OrgID, req.HostsPerSecond, req.Workers, middleware.GetUserID(c))
+	if err != nil {
+		if errors.Is(err, reprocess.ErrJobRunning) {
+			_ = c.Error(apierror.Conflict(err.Error()))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to start reprocess job", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("job_id", job.ID).
+		Str("target_org_id", job.OrgID).
+		Float64("hosts_per_second", job.HostsPerSecond).
+		Int("workers", job.Workers).
+		Msg("Reprocess job started")
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListReprocessJobs returns the recent reprocess jobs
+// @Summary     List reprocess jobs
+// @Description Returns the running and recently finished reprocess jobs of this instance, newest first. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Jobs with total count"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "System administrator access required"
+// @Router      /api/v1/admin/reprocess [get]
+func (h *Handlers) ListReprocessJobs(c *gin.Context) {
+	jobs := h.reprocess.List()
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"total": len(jobs),
+	})
+}
+
+// GetReprocessJob returns a reprocess job's progress
+// @Summary     Get reprocess job
+// @Description Returns a reprocess job with the number of hosts processed and failed so far. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       job_id  path      string               true  "Job ID"
+// @Success     200     {object}  models.ReprocessJob  "Job"
+// @Failure     401     {object}  map[string]string    "Unauthorized"
+// @Failure     403     {object}  map[string]string    "System administrator access required"
+// @Failure     404     {object}  map[string]string    "Job not found"
+// @Router      /api/v1/admin/reprocess/{job_id} [get]
+func (h *Handlers) GetReprocessJob(c *gin.Context) {
+	job, err := h.reprocess.Get(c.Param("job_id"))
+	if err != nil {
+		_ = c.Error(apierror.NotFound("reprocess job not found"))
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelReprocessJob stops a running reprocess job
+// @Summary     Cancel reprocess job
+// @Description Stops a running reprocess job after the host it is working on. Hosts already rewritten keep their new projection. Requires system administrator privileges.
+// @Tags        Admin
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       job_id  path  string  true  "Job ID"
+// @Success     202  "Cancellation requested"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "System administrator access required"
+// @Failure     404  {object}  map[string]string  "Job not found"
+// @Failure     409  {object}  map[string]string  "Job is not running"
+// @Router      /api/v1/admin/reprocess/{job_id}/cancel [post]
+func (h *Handlers) CancelReprocessJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+	if err := h.reprocess.Cancel(jobID); err != nil {
+		if errors.Is(err, reprocess.ErrJobFinished) {
+			_ = c.Error(apierror.Conflict(err.Error()))
+			return
+		}
+		_ = c.Error(apierror.NotFound("reprocess job not found"))
+		return
+	}
+
+	logger.FromContext(c).Str("job_id", jobID).Msg("Reprocess job canceled")
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_Reprocess(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "host1"},
+		Data:       json.RawMessage(`{}`),
+	}, org.ID, admin.ID))
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/admin/reprocess", h.StartReprocess)
+	r.GET("/admin/reprocess", h.ListReprocessJobs)
+	r.GET("/admin/reprocess/:job_id", h.GetReprocessJob)
+	r.POST("/admin/reprocess/:job_id/cancel", h.CancelReprocessJob)
+
+	assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodPost, "/admin/reprocess", models.StartReprocessRequest{HostsPerSecond: 5000}).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodPost, "/admin/reprocess", models.StartReprocessRequest{OrgID: "00000000-0000-0000-0000-000000000999"}).Code)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/admin/reprocess/missing", nil).Code)
+
+	w := doProbeRequest(r, http.MethodPost, "/admin/reprocess", models.StartReprocessRequest{OrgID: org.ID, HostsPerSecond: 1000})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var job models.ReprocessJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, org.ID, job.OrgID)
+	assert.Equal(t, admin.ID, job.RequestedBy)
+
+	require.Eventually(t, func() bool {
+		w := doProbeRequest(r, http.MethodGet, "/admin/reprocess/"+job.ID, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		return job.Status != models.ReprocessJobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, models.ReprocessJobCompleted, job.Status)
+	assert.Equal(t, 1, job.Total)
+	assert.Equal(t, 1, job.Processed)
+
+	assert.Equal(t, http.StatusConflict, doProbeRequest(r, http.MethodPost, "/admin/reprocess/"+job.ID+"/cancel", nil).Code)
+
+	w = doProbeRequest(r, http.MethodGet, "/admin/reprocess", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+}
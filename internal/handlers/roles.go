@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+)
+
+// ListRoles lists the organization roles and their permissions
+// @Summary     List roles
+// @Description Lists the roles users of an organization can have, from least to most privileged, with the permissions each grants. Each role has the permissions of the roles before it.
+// @Description Permissions describe what a role allows so clients can decide what to offer a user; the API itself checks roles.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.RolesResponse  "Roles"
+// @Failure     401  {object}  map[string]string     "Unauthorized"
+// @Router      /api/v1/roles [get]
+func (h *Handlers) ListRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, models.RolesResponse{Roles: auth.Roles()})
+}
+
+// validateRole responds with 400 and returns false if role is not an organization role
+func validateRole(c *gin.Context, role string) bool {
+	if err := auth.ValidateRole(role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid role",
+			"message": err.Error(),
+			"roles":   auth.RoleNames(),
+		})
+		return false
+	}
+	return true
+}
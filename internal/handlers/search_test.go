@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_ListHosts_Search(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	hosts := []struct {
+		id, hostname, os, version, tag, openssl string
+	}{
+		{"00000000-0000-0000-0000-000000000001", "web-01", "Fedora", "40", "env:prod", "3.0.9"},
+		{"00000000-0000-0000-0000-000000000002", "web-02", "Fedora", "41", "env:prod", "3.2.1"},
+		{"00000000-0000-0000-0000-000000000003", "db-01", "Fedora", "39", "env:prod", "1.1.1"},
+		{"00000000-0000-0000-0000-000000000004", "ci-01", "Debian", "12", "env:dev", "3.0.11"},
+	}
+	for _, host := range hosts {
+		data := `{"system":{"os":{"name":"` + host.os + `","version":"` + host.version + `"}},` +
+			`"packages":{"installed":[{"name":"openssl","version":"` + host.openssl + `"},{"name":"bash","version":"5.2"}]}}`
+		mockStore.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: host.hostname},
+			Data:       json.RawMessage(data),
+		}, org.ID, admin.ID)
+		require.NoError(t, mockStore.SetHostTags(host.id, org.ID, []string{host.tag}, admin.ID, 0))
+	}
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("org_id", org.ID)
+	})
+	r.GET("/hosts", h.ListHosts)
+
+	search := func(q string) (int, []string, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hosts?q="+url.QueryEscape(q), nil))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		var names []string
+		if list, ok := body["hosts"].([]interface{}); ok {
+			for _, host := range list {
+				names = append(names, host.(map[string]interface{})["hostname"].(string))
+			}
+		}
+		return w.Code, names, body
+	}
+
+	code, names, _ := search("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, names, 4)
+
+	code, names, body := search("os:fedora version>=40 tag:env=prod package:openssl<3.1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"web-01"}, names)
+	assert.Equal(t, float64(1), body["total"])
+
+	_, names, _ = search("os:fedora -hostname:db-*")
+	assert.ElementsMatch(t, []string{"web-01", "web-02"}, names)
+
+	_, names, _ = search("package:openssl<3.0")
+	assert.Equal(t, []string{"db-01"}, names)
+
+	_, names, _ = search("os:debian,fedora version:12")
+	assert.Equal(t, []string{"ci-01"}, names)
+
+	_, names, _ = search("web")
+	assert.ElementsMatch(t, []string{"web-01", "web-02"}, names)
+
+	code, _, body = search("colour:blue")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid search query", body["error"])
+	assert.Contains(t, body["message"], `unknown field "colour"`)
+}
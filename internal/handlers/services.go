@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// ListServices searches the listening ports reported across the fleet
+// @Summary     Search host services
+// @Description Returns the listening ports from the latest report of each host in the authenticated user's organization, to find exposed services without reading raw reports, e.g. ?port=22.
+// @Description Filters are exact matches and combine with AND; protocol is case-insensitive. Archived hosts are left out unless include_archived=true.
+// @Description Users with a tag-based host access policy only see services on hosts carrying at least one of their allowed tags.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       port              query     int     false  "Port number"
+// @Param       protocol          query     string  false  "Protocol, e.g. tcp or udp"
+// @Param       process           query     string  false  "Listening process name"
+// @Param       host_id           query     string  false  "Only services on this host"
+// @Param       include_archived  query     bool    false  "Include archived hosts"
+// @Success     200  {object}  map[string]interface{}  "Services with total count"
+// @Failure     400  {object}  map[string]string       "Invalid port"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/services [get]
+func (h *Handlers) ListServices(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	filter := models.HostServiceFilter{
+		Protocol:        c.Query("protocol"),
+		Process:         c.Query("process"),
+		HostID:          c.Query("host_id"),
+		IncludeArchived: c.Query("include_archived") == "true",
+	}
+	if value := c.Query("port"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			_ = c.Error(apierror.Validation("port must be an integer between 1 and 65535"))
+			return
+		}
+		filter.Port = &port
+	}
+
+	allowed, err := h.visibleHostIDs(c, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve services", err))
+		return
+	}
+
+	services, err := h.store(c).SearchHostServices(orgID, filter)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve services", err))
+		return
+	}
+	if allowed != nil {
+		visible := services[:0]
+		for _, service := range services {
+			if allowed[service.HostID] {
+				visible = append(visible, service)
+			}
+		}
+		services = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"services": services,
+		"total":    len(services),
+	})
+}
+
+// GetHostServices returns the listening ports of a single host
+// @Summary     Get host services
+// @Description Returns the listening ports from the host's latest report, ordered by port. Archived hosts are included.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string  true  "Host ID (UUID)"
+// @Success     200      {object}  map[string]interface{}  "Services with total count"
+// @Failure     401      {object}  map[string]string       "Unauthorized"
+// @Failure     404      {object}  map[string]string       "Host not found"
+// @Failure     500      {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/services [get]
+func (h *Handlers) GetHostServices(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	// Hosts outside the user's tag policy are reported as not found to avoid leaking their existence
+	if _, err := h.store(c).GetHostTags(hostID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host")
+		_ = c.Error(apierror.Internal("failed to retrieve services", err))
+		return
+	}
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to retrieve services", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	services, err := h.store(c).SearchHostServices(orgID, models.HostServiceFilter{HostID: hostID, IncludeArchived: true})
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to list host services")
+		_ = c.Error(apierror.Internal("failed to retrieve services", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"services": services,
+		"total":    len(services),
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_ListServices(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	save := func(hostID, hostname, data string) {
+		require.NoError(t, mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(data),
+		}, org.ID, user.ID))
+	}
+	save(webID, "web-01", `{"network": {"listening_ports": [
+		{"protocol": "tcp", "address": "0.0.0.0", "port": 22, "process": "sshd", "pid": 812},
+		{"protocol": "TCP", "address": "0.0.0.0", "port": 443, "process": "nginx"},
+		{"protocol": "tcp", "address": "0.0.0.0", "port": 22, "process": "sshd"},
+		{"protocol": "tcp", "port": 0}
+	]}}`)
+	save(dbID, "db-01", `{"network": {"listening_ports": [
+		{"proto": "tcp", "local_address": "::", "port": "22", "program": "sshd"},
+		{"proto": "udp", "local_address": "127.0.0.1", "port": 323, "program": "chronyd"}
+	]}}`)
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("org_id", user.OrgID)
+	})
+	r.GET("/services", h.ListServices)
+	r.GET("/hosts/:host_id/services", h.GetHostServices)
+
+	list := func(path string) []models.HostService {
+		w := doProbeRequest(r, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Services []models.HostService `json:"services"`
+			Total    int                  `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, len(resp.Services), resp.Total)
+		return resp.Services
+	}
+
+	assert.Len(t, list("/services"), 4)
+
+	ssh := list("/services?port=22")
+	require.Len(t, ssh, 2)
+	assert.Equal(t, "db-01", ssh[0].Hostname)
+	assert.Equal(t, "::", ssh[0].Address)
+	assert.Equal(t, "web-01", ssh[1].Hostname)
+	require.NotNil(t, ssh[1].PID)
+	assert.Equal(t, int64(812), *ssh[1].PID)
+
+	assert.Len(t, list("/services?protocol=UDP"), 1)
+	assert.Len(t, list("/services?process=nginx"), 1)
+	for _, query := range []string{"?port=ssh", "?port=70000"} {
+		assert.Equal(t, http.StatusBadRequest, doProbeRequest(r, http.MethodGet, "/services"+query, nil).Code, query)
+	}
+
+	web := list("/hosts/" + webID + "/services")
+	require.Len(t, web, 2)
+	assert.Equal(t, 22, web[0].Port)
+	assert.Equal(t, "tcp", web[1].Protocol)
+	assert.Equal(t, http.StatusNotFound, doProbeRequest(r, http.MethodGet, "/hosts/00000000-0000-0000-0000-000000000009/services", nil).Code)
+
+	// Archived hosts are left out of the search but keep their per-host listing
+	_, err := mockStore.ArchiveHost(dbID, org.ID, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, list("/services?port=22"), 1)
+	assert.Len(t, list("/services?port=22&include_archived=true"), 2)
+	assert.Len(t, list("/hosts/"+dbID+"/services"), 2)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/auth"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// issueSessionToken generates an access and refresh token pair
+// Returns the plain tokens and the hashed pair to store.
+func (h *Handlers) issueSessionToken() (access, refresh string, token models.SessionToken, err error) {
+	access, token.AccessHash, err = auth.GenerateOAuthToken(auth.SessionAccessTokenPrefix)
+	if err != nil {
+		return "", "", token, err
+	}
+	refresh, token.RefreshHash, err = auth.GenerateOAuthToken(auth.SessionRefreshTokenPrefix)
+	if err != nil {
+		return "", "", token, err
+	}
+	token.ExpiresAt = time.Now().UTC().Add(h.sessionTTL)
+	return access, refresh, token, nil
+}
+
+// sessionResponse writes the login response for a session's new token pair
+func sessionResponse(c *gin.Context, user *models.User, access, refresh string, token models.SessionToken) {
+	c.Header("Cache-Control", "no-store")
+	expiresAt := token.ExpiresAt
+	c.JSON(http.StatusOK, models.LoginResponse{
+		User:         user,
+		Token:        access,
+		CSRFToken:    middleware.GetCSRFToken(c),
+		RefreshToken: refresh,
+		ExpiresAt:    &expiresAt,
+	})
+}
+
+// startSession starts a session for a user who logged in
+func (h *Handlers) startSession(c *gin.Context, user *models.User) {
+	access, refresh, token, err := h.issueSessionToken()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create session", err))
+		return
+	}
+
+	session := &models.Session{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		OrgID:     user.OrgID,
+		ExpiresAt: time.Now().UTC().Add(h.sessionMax),
+		Token:     token,
+	}
+	if err := h.store(c).CreateSession(session); err != nil {
+		logger.FromContext(c).
+			Err(err).
+			Str("user_id", user.ID).
+			Msg("Failed to create session")
+		_ = c.Error(apierror.Internal("failed to create session", err))
+		return
+	}
+
+	sessionResponse(c, user, access, refresh, token)
+}
+
+// RefreshSession renews a session's access token
+// @Summary     Refresh session
+// @Description Exchanges a session's refresh token for a new access token and refresh token. The old tokens stop working. Sessions can be refreshed until they are SESSION_LIFETIME old; after that, or after logging out, the user must log in again.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       request  body      models.RefreshSessionRequest  true  "Refresh token"
+// @Success     200      {object}  models.LoginResponse  "Session refreshed"
+// @Failure     400      {object}  map[string]string     "Invalid request or sessions disabled"
+// @Failure     401      {object}  map[string]string     "Invalid, expired, or already used refresh token"
+// @Router      /api/v1/auth/refresh [post]
+func (h *Handlers) RefreshSession(c *gin.Context) {
+	if h.sessionTTL == 0 {
+		_ = c.Error(apierror.Validation("sessions are disabled").WithDetail("Add session to AUTH_METHODS to enable them"))
+		return
+	}
+
+	var req models.RefreshSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	access, refresh, token, err := h.issueSessionToken()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to refresh session", err))
+		return
+	}
+
+	session, err := h.store(c).RotateSessionToken(auth.HashOAuthToken(req.RefreshToken), token, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.Unauthorized("invalid or expired refresh token"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to refresh session", err))
+		return
+	}
+
+	user, err := h.store(c).GetUserByID(session.UserID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.FromContext(c).Err(err).Str("user_id", session.UserID).Msg("Failed to get session user")
+		_ = c.Error(apierror.Internal("failed to refresh session", err))
+		return
+	}
+	// Deactivated users and users moved to another organization must log in again
+	if err != nil || !user.IsActive || user.OrgID != session.OrgID {
+		h.store(c).DeleteSession(session.ID, session.UserID)
+		_ = c.Error(apierror.Unauthorized("invalid or expired refresh token"))
+		return
+	}
+
+	sessionResponse(c, user, access, refresh, token)
+}
+
+// Logout ends the session the request was authenticated with
+// @Summary     Logout
+// @Description Ends the current session; its access and refresh tokens stop working immediately. Requests authenticated with anything but a session token are rejected, since API keys are revoked at /api/v1/api-keys/{id}.
+// @Tags        Auth
+// @Security    ApiKeyAuth
+// @Success     204  "Logged out"
+// @Failure     400  {object}  map[string]string  "Not authenticated with a session token"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Router      /api/v1/auth/logout [post]
+func (h *Handlers) Logout(c *gin.Context) {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || principal.Method != auth.MethodSession {
+		_ = c.Error(apierror.Validation("not authenticated with a session token"))
+		return
+	}
+
+	if err := h.store(c).DeleteSession(principal.CredentialID, principal.UserID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.FromContext(c).
+			Err(err).
+			Str("session_id", principal.CredentialID).
+			Msg("Failed to delete session")
+		_ = c.Error(apierror.Internal("failed to log out", err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func setupSessionTest(t *testing.T, opts ...Option) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	passwordHash, _ := auth.HashPassword("password123")
+	user, _ := mockStore.CreateUser("testuser", "test@example.com", passwordHash, org.ID, "viewer")
+
+	r := setupTestRouter(h)
+	r.POST("/api/v1/auth/login", h.Login)
+	r.POST("/api/v1/auth/refresh", h.RefreshSession)
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthChain(middleware.NewSessionAuthenticator(mockStore), middleware.NewAPIKeyAuthenticator(mockStore)))
+	protected.GET("/auth/me", h.GetMe)
+	protected.POST("/auth/logout", h.Logout)
+	return r, mockStore, user
+}
+
+// doSessionRequest sends a JSON request, authenticated with a bearer token if one is given
+func doSessionRequest(r *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func loginSession(t *testing.T, r *gin.Engine) models.LoginResponse {
+	t.Helper()
+	w := doSessionRequest(r, http.MethodPost, "/api/v1/auth/login", "", models.LoginRequest{Username: "testuser", Password: "password123"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestHandlers_Sessions(t *testing.T) {
+	r, _, user := setupSessionTest(t, WithSessions(15*time.Minute, 24*time.Hour))
+
+	login := loginSession(t, r)
+	assert.True(t, strings.HasPrefix(login.Token, auth.SessionAccessTokenPrefix))
+	assert.True(t, strings.HasPrefix(login.RefreshToken, auth.SessionRefreshTokenPrefix))
+	require.NotNil(t, login.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), *login.ExpiresAt, time.Minute)
+
+	w := doSessionRequest(r, http.MethodGet, "/api/v1/auth/me", login.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), user.ID)
+
+	// Refresh tokens are not access tokens
+	w = doSessionRequest(r, http.MethodGet, "/api/v1/auth/me", login.RefreshToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Refreshing rotates both tokens
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: login.RefreshToken})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var refreshed models.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.Equal(t, user.ID, refreshed.User.ID)
+	assert.NotEqual(t, login.Token, refreshed.Token)
+
+	w = doSessionRequest(r, http.MethodGet, "/api/v1/auth/me", login.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doSessionRequest(r, http.MethodGet, "/api/v1/auth/me", refreshed.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Logging out ends the session
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/logout", refreshed.Token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doSessionRequest(r, http.MethodGet, "/api/v1/auth/me", refreshed.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: refreshed.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandlers_Sessions_Expiry(t *testing.T) {
+	r, mockStore, user := setupSessionTest(t, WithSessions(15*time.Minute, time.Hour))
+
+	// An expired session cannot be refreshed
+	refresh, refreshHash, err := auth.GenerateOAuthToken(auth.SessionRefreshTokenPrefix)
+	require.NoError(t, err)
+	require.NoError(t, mockStore.CreateSession(&models.Session{
+		ID: "expired", UserID: user.ID, OrgID: user.OrgID, ExpiresAt: time.Now().Add(-time.Minute),
+		Token: models.SessionToken{AccessHash: "access", RefreshHash: refreshHash, ExpiresAt: time.Now().Add(-time.Hour)},
+	}))
+	w := doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: refresh})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Deleted users must log in again
+	login := loginSession(t, r)
+	require.NoError(t, mockStore.DeleteUser(user.ID, 0))
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandlers_Sessions_Disabled(t *testing.T) {
+	r, _, _ := setupSessionTest(t)
+
+	// Without sessions login keeps returning an API key
+	login := loginSession(t, r)
+	assert.True(t, auth.IsAPIKeyFormat(login.Token))
+	assert.Empty(t, login.RefreshToken)
+	assert.Nil(t, login.ExpiresAt)
+
+	w := doSessionRequest(r, http.MethodPost, "/api/v1/auth/refresh", "", models.RefreshSessionRequest{RefreshToken: "sbsr_x"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Logout only ends sessions
+	w = doSessionRequest(r, http.MethodPost, "/api/v1/auth/logout", login.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
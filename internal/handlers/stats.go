@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+)
+
+// parseCompareTime parses a compare bound as a date (midnight UTC) or an RFC 3339 timestamp
+func parseCompareTime(value string) (time.Time, bool) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// CompareFleet returns what changed in the fleet between two dates
+// @Summary     Compare fleet between dates
+// @Description Compares the fleet as it was at from with the fleet at to, rebuilt from the host event history: hosts added and removed, OS release migrations, and snail-core agent version changes, grouped by from → to.
+// @Description from and to are dates (YYYY-MM-DD, midnight UTC) or RFC 3339 timestamps; a host counts as present at a time if it existed just before it. For monthly change reports use the first day of each month.
+// @Description For users with a tag-based host access policy, only the hosts they could see at each time are compared.
+// @Tags        Stats
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       from  query     string                  true  "Start date or timestamp"  example(2025-01-01)
+// @Param       to    query     string                  true  "End date or timestamp"    example(2025-02-01)
+// @Success     200   {object}  models.FleetComparison  "Fleet changes"
+// @Failure     400   {object}  map[string]string       "Invalid from or to"
+// @Failure     401   {object}  map[string]string       "Unauthorized"
+// @Failure     500   {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/stats/compare [get]
+func (h *Handlers) CompareFleet(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	from, ok := parseCompareTime(c.Query("from"))
+	if !ok {
+		_ = c.Error(apierror.Validation("from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"))
+		return
+	}
+	to, ok := parseCompareTime(c.Query("to"))
+	if !ok {
+		_ = c.Error(apierror.Validation("to must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"))
+		return
+	}
+	if !from.Before(to) {
+		_ = c.Error(apierror.Validation("from must be before to"))
+		return
+	}
+
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to compare fleet", err))
+		return
+	}
+
+	snapshots := make([][]*models.FleetHost, 2)
+	for i, at := range []time.Time{from, to} {
+		hosts, err := h.store(c).GetFleetSnapshot(orgID, at)
+		if err != nil {
+			logger.FromContext(c).Err(err).Time("at", at).Msg("Failed to get fleet snapshot")
+			_ = c.Error(apierror.Internal("failed to compare fleet", err))
+			return
+		}
+		if policy.Restricted() {
+			visible := hosts[:0]
+			for _, host := range hosts {
+				if policy.Allows(host.Tags) {
+					visible = append(visible, host)
+				}
+			}
+			hosts = visible
+		}
+		snapshots[i] = hosts
+	}
+
+	comparison := compareFleet(snapshots[0], snapshots[1])
+	comparison.From = from
+	comparison.To = to
+	c.JSON(http.StatusOK, comparison)
+}
+
+// compareFleet diffs two fleet snapshots, each ordered by hostname
+func compareFleet(before, after []*models.FleetHost) *models.FleetComparison {
+	comparison := &models.FleetComparison{
+		HostsFrom:     len(before),
+		HostsTo:       len(after),
+		Added:         []models.FleetHostRef{},
+		Removed:       []models.FleetHostRef{},
+		OSMigrations:  []models.FleetMigration{},
+		AgentUpgrades: []models.FleetMigration{},
+	}
+
+	previous := make(map[string]*models.FleetHost, len(before))
+	for _, host := range before {
+		previous[host.HostID] = host
+	}
+	current := make(map[string]bool, len(after))
+
+	osMigrations := map[[2]string]*models.FleetMigration{}
+	agentUpgrades := map[[2]string]*models.FleetMigration{}
+	record := func(groups map[[2]string]*models.FleetMigration, from, to string, host *models.FleetHost) {
+		key := [2]string{from, to}
+		if groups[key] == nil {
+			groups[key] = &models.FleetMigration{From: from, To: to, Hosts: []models.FleetHostRef{}}
+		}
+		groups[key].Count++
+		groups[key].Hosts = append(groups[key].Hosts, models.FleetHostRef{HostID: host.HostID, Hostname: host.Hostname})
+	}
+
+	for _, host := range after {
+		current[host.HostID] = true
+		old, ok := previous[host.HostID]
+		if !ok {
+			comparison.Added = append(comparison.Added, models.FleetHostRef{HostID: host.HostID, Hostname: host.Hostname})
+			continue
+		}
+		if old.OSRelease() != host.OSRelease() {
+			record(osMigrations, old.OSRelease(), host.OSRelease(), host)
+		}
+		if old.SnailVersion != host.SnailVersion {
+			record(agentUpgrades, old.SnailVersion, host.SnailVersion, host)
+		}
+	}
+	for _, host := range before {
+		if !current[host.HostID] {
+			comparison.Removed = append(comparison.Removed, models.FleetHostRef{HostID: host.HostID, Hostname: host.Hostname})
+		}
+	}
+
+	comparison.OSMigrations = sortedMigrations(osMigrations)
+	comparison.AgentUpgrades = sortedMigrations(agentUpgrades)
+	return comparison
+}
+
+// sortedMigrations orders migration groups by host count, then from and to
+func sortedMigrations(groups map[[2]string]*models.FleetMigration) []models.FleetMigration {
+	migrations := make([]models.FleetMigration, 0, len(groups))
+	for _, group := range groups {
+		migrations = append(migrations, *group)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		if migrations[i].Count != migrations[j].Count {
+			return migrations[i].Count > migrations[j].Count
+		}
+		if migrations[i].From != migrations[j].From {
+			return migrations[i].From < migrations[j].From
+		}
+		return migrations[i].To < migrations[j].To
+	})
+	return migrations
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// saveFleetHost ingests a report with the given OS version and agent version
+func saveFleetHost(t *testing.T, store *storage.MockStorage, orgID, userID, hostID, osVersion, snailVersion string) {
+	t.Helper()
+	require.NoError(t, store.SaveHost(&models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:], SnailVersion: snailVersion},
+		Data:       json.RawMessage(`{"system":{"os":{"name":"Fedora","version":"` + osVersion + `"}}}`),
+	}, orgID, userID))
+}
+
+// instant returns a timestamp strictly between the events stored before and after it
+func instant() time.Time {
+	time.Sleep(2 * time.Millisecond)
+	at := time.Now().UTC()
+	time.Sleep(2 * time.Millisecond)
+	return at
+}
+
+func TestHandlers_CompareFleet(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	const (
+		host1 = "00000000-0000-0000-0000-000000000001"
+		host2 = "00000000-0000-0000-0000-000000000002"
+		host3 = "00000000-0000-0000-0000-000000000003"
+		host4 = "00000000-0000-0000-0000-000000000004"
+	)
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host1, "41", "0.4.0")
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host2, "41", "0.4.0")
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host3, "41", "0.4.0")
+	require.NoError(t, mockStore.SetHostTags(host1, org.ID, []string{"team:web"}, admin.ID, 0))
+	from := instant()
+
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host1, "42", "0.5.0")
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host2, "42", "0.4.0")
+	require.NoError(t, mockStore.DeleteHost(host3, org.ID, admin.ID, nil))
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host4, "42", "0.5.0")
+	to := instant()
+
+	// Changes after to are not included
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host2, "43", "0.6.0")
+
+	compare := func(user *models.User, query string) (int, models.FleetComparison) {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/stats/compare", h.CompareFleet)
+
+		w := doProbeRequest(r, http.MethodGet, "/stats/compare?"+query, nil)
+		var comparison models.FleetComparison
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &comparison))
+		}
+		return w.Code, comparison
+	}
+	query := url.Values{"from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}}.Encode()
+
+	code, comparison := compare(admin, query)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, comparison.HostsFrom)
+	assert.Equal(t, 3, comparison.HostsTo)
+	assert.Equal(t, []models.FleetHostRef{{HostID: host4, Hostname: "host-4"}}, comparison.Added)
+	assert.Equal(t, []models.FleetHostRef{{HostID: host3, Hostname: "host-3"}}, comparison.Removed)
+	require.Len(t, comparison.OSMigrations, 1)
+	assert.Equal(t, "Fedora 41", comparison.OSMigrations[0].From)
+	assert.Equal(t, "Fedora 42", comparison.OSMigrations[0].To)
+	assert.Equal(t, 2, comparison.OSMigrations[0].Count)
+	require.Len(t, comparison.AgentUpgrades, 1)
+	assert.Equal(t, models.FleetMigration{From: "0.4.0", To: "0.5.0", Count: 1, Hosts: []models.FleetHostRef{{HostID: host1, Hostname: "host-1"}}}, comparison.AgentUpgrades[0])
+
+	// Restricted users only compare the hosts they can see
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"team:web"}))
+	code, comparison = compare(viewer, query)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, comparison.HostsFrom)
+	assert.Empty(t, comparison.Added)
+	assert.Empty(t, comparison.Removed)
+	assert.Len(t, comparison.AgentUpgrades, 1)
+
+	// Dates are accepted; a fleet that did not exist yet is empty
+	code, comparison = compare(admin, "from=2025-01-01&to=2025-02-01")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), comparison.From)
+	assert.Zero(t, comparison.HostsTo)
+
+	for _, invalid := range []string{"", "from=2025-01-01", "from=2025-02-01&to=2025-01-01", "from=yesterday&to=2025-01-01"} {
+		code, _ := compare(admin, invalid)
+		assert.Equal(t, http.StatusBadRequest, code, invalid)
+	}
+}
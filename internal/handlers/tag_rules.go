@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/autotag"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// applyHostTagRules adds the tags the organization's host tag rules derive from a
+// reporting host's hostname. Failures are logged; the report is already stored.
+func (h *Handlers) applyHostTagRules(c *gin.Context, orgID string, meta models.ReportMeta) {
+	rules, err := h.store(c).GetHostTagRules(orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", meta.HostID).Msg("Failed to load host tag rules")
+		return
+	}
+	compiled, err := autotag.Compile(rules.Rules)
+	if err != nil {
+		logger.FromContext(c).Err(err).Msg("Failed to compile host tag rules")
+		return
+	}
+	derived := compiled.Tags(meta.Hostname)
+	if len(derived) == 0 {
+		return
+	}
+
+	current, err := h.store(c).GetHostTags(meta.HostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", meta.HostID).Msg("Failed to get host tags")
+		return
+	}
+	added, err := h.addHostTags(c, meta.HostID, orgID, current, derived, "")
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", meta.HostID).Msg("Failed to apply host tag rules")
+		return
+	}
+	if len(added) > 0 {
+		logger.FromContext(c).
+			Str("host_id", meta.HostID).
+			Strs("tags", added).
+			Msg("Host tagged by tag rules")
+	}
+}
+
+// addHostTags adds the derived tags a host does not have yet and returns them
+func (h *Handlers) addHostTags(c *gin.Context, hostID, orgID string, current, derived []string, actorUserID string) ([]string, error) {
+	added := autotag.Missing(current, derived)
+	if len(added) == 0 {
+		return added, nil
+	}
+	tags := normalizeTags(append(append([]string(nil), current...), added...))
+	return added, h.store(c).SetHostTags(hostID, orgID, tags, actorUserID, 0)
+}
+
+// GetHostTagRules returns the organization's host tag rules
+// @Summary     Get host tag rules
+// @Description Returns the rules deriving host tags from hostnames. The ETag header carries the rules' version for If-Match. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  models.HostTagRules  "Host tag rules"
+// @Failure     401  {object}  map[string]string    "Unauthorized"
+// @Failure     403  {object}  map[string]string    "Admin role required"
+// @Failure     404  {object}  map[string]string    "No host tag rules configured"
+// @Failure     500  {object}  map[string]string    "Internal server error"
+// @Router      /api/v1/orgs/current/tag-rules [get]
+func (h *Handlers) GetHostTagRules(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+
+	rules, err := h.store(c).GetHostTagRules(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no host tag rules configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get host tag rules", err))
+		return
+	}
+
+	setETag(c, rules.Version)
+	c.JSON(http.StatusOK, rules)
+}
+
+// SetHostTagRules replaces the organization's host tag rules
+// @Summary     Set host tag rules
+// @Description Lists regular expressions (RE2 syntax) matched against hostnames, each with the tags to add to matching hosts, e.g. ^web-\d+ adds role:web. Tags may reference capture groups as ${1} or ${name}; a tag whose group did not match is skipped.
+// @Description Every matching rule applies when a host reports. Rules only add tags; tags set by hand or by earlier rules are kept. Use POST /orgs/current/tag-rules/apply to tag existing hosts.
+// @Description With If-Match, the rules are only replaced if their ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match header    string                         false  "ETag of the rules being replaced"
+// @Param       request  body      models.SetHostTagRulesRequest  true   "Rules"
+// @Success     200      {object}  models.HostTagRules            "Host tag rules set"
+// @Failure     400      {object}  map[string]string              "Invalid rules"
+// @Failure     401      {object}  map[string]string              "Unauthorized"
+// @Failure     403      {object}  map[string]string              "Admin role required"
+// @Failure     412      {object}  map[string]string              "Rules changed since If-Match was read"
+// @Failure     500      {object}  map[string]string              "Internal server error"
+// @Router      /api/v1/orgs/current/tag-rules [put]
+func (h *Handlers) SetHostTagRules(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetHostTagRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	for i := range req.Rules {
+		for j, tag := range req.Rules[i].Tags {
+			req.Rules[i].Tags[j] = strings.TrimSpace(tag)
+		}
+	}
+	if _, err := autotag.Compile(req.Rules); err != nil {
+		_ = c.Error(apierror.Validation("invalid host tag rules").WithDetail(err.Error()))
+		return
+	}
+
+	rules := &models.HostTagRules{
+		OrgID:           orgID,
+		Rules:           req.Rules,
+		UpdatedByUserID: middleware.GetUserID(c),
+		Version:         ifVersion,
+	}
+	if err := h.store(c).SetHostTagRules(rules); err != nil {
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to set host tag rules", err))
+		return
+	}
+
+	logger.FromContext(c).Int("rules", len(rules.Rules)).Msg("Host tag rules set")
+	setETag(c, rules.Version)
+	c.JSON(http.StatusOK, rules)
+}
+
+// DeleteHostTagRules stops tagging the organization's hosts automatically
+// @Summary     Delete host tag rules
+// @Description Removes the organization's host tag rules, so hosts are no longer tagged when they report. Tags the rules already added are kept. With If-Match, the rules are only removed if their ETag still matches. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       If-Match  header  string  false  "ETag of the rules being removed"
+// @Success     204  "Host tag rules deleted"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "No host tag rules configured"
+// @Failure     412  {object}  map[string]string  "Rules changed since If-Match was read"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/orgs/current/tag-rules [delete]
+func (h *Handlers) DeleteHostTagRules(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store(c).DeleteHostTagRules(orgID, ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("no host tag rules configured"))
+			return
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete host tag rules", err))
+		return
+	}
+
+	logger.FromContext(c).Msg("Host tag rules deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// ApplyHostTagRules re-evaluates the host tag rules against every host
+// @Summary     Apply host tag rules
+// @Description Matches the hostname of every host in the organization, except archived ones, against the host tag rules and adds the tags each host is missing, e.g. after the rules changed. Returns the tags added to each host.
+// @Description With dry_run=true nothing is changed and the response lists the tags that would be added. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       dry_run  query     bool                       false  "Only report the tags that would be added"
+// @Success     200      {object}  models.HostTagRulesResult  "Tags added"
+// @Failure     401      {object}  map[string]string          "Unauthorized"
+// @Failure     403      {object}  map[string]string          "Admin role required"
+// @Failure     404      {object}  map[string]string          "No host tag rules configured"
+// @Failure     500      {object}  map[string]string          "Internal server error"
+// @Router      /api/v1/orgs/current/tag-rules/apply [post]
+func (h *Handlers) ApplyHostTagRules(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	dryRun := c.Query("dry_run") == "true"
+
+	rules, err := h.store(c).GetHostTagRules(orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("no host tag rules configured"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get host tag rules", err))
+		return
+	}
+	compiled, err := autotag.Compile(rules.Rules)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to apply host tag rules", err))
+		return
+	}
+
+	hosts, err := h.store(c).ListHosts(orgID, false)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to apply host tag rules", err))
+		return
+	}
+
+	result := models.HostTagRulesResult{DryRun: dryRun, Changes: []models.HostTagChange{}}
+	for _, host := range hosts {
+		result.HostsEvaluated++
+		derived := compiled.Tags(host.Hostname)
+		added := autotag.Missing(host.Tags, derived)
+		if len(added) == 0 {
+			continue
+		}
+		if !dryRun {
+			added, err = h.addHostTags(c, host.HostID, orgID, host.Tags, derived, middleware.GetUserID(c))
+			if errors.Is(err, storage.ErrNotFound) {
+				continue // Deleted since it was listed
+			}
+			if err != nil {
+				logger.FromContext(c).Err(err).Str("host_id", host.HostID).Msg("Failed to apply host tag rules")
+				_ = c.Error(apierror.Internal("failed to apply host tag rules", err))
+				return
+			}
+		}
+		result.HostsTagged++
+		result.Changes = append(result.Changes, models.HostTagChange{HostID: host.HostID, Hostname: host.Hostname, Added: added})
+	}
+
+	logger.FromContext(c).
+		Bool("dry_run", dryRun).
+		Int("hosts_evaluated", result.HostsEvaluated).
+		Int("hosts_tagged", result.HostsTagged).
+		Msg("Host tag rules applied")
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// setupTagRulesTest creates an organization and a router acting as its admin
+func setupTagRulesTest(t *testing.T) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.GET("/orgs/current/tag-rules", h.GetHostTagRules)
+	r.PUT("/orgs/current/tag-rules", h.SetHostTagRules)
+	r.DELETE("/orgs/current/tag-rules", h.DeleteHostTagRules)
+	r.POST("/orgs/current/tag-rules/apply", h.ApplyHostTagRules)
+	r.POST("/ingest", h.Ingest)
+	return r, mockStore, admin
+}
+
+// ingestHostname reports a host with a hostname
+func ingestHostname(t *testing.T, r *gin.Engine, hostID, hostname string) {
+	t.Helper()
+	body := `{"meta": {"host_id": "` + hostID + `", "hostname": "` + hostname + `"}, "data": {"system": {}}}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+var testTagRules = models.SetHostTagRulesRequest{Rules: []models.HostTagRule{
+	{Pattern: `^web-\d+`, Tags: []string{"role:web"}},
+	{Pattern: `\.(?P<env>prod|staging)\.`, Tags: []string{" env:${env}"}},
+}}
+
+func TestHandlers_HostTagRules(t *testing.T) {
+	r, _, admin := setupTagRulesTest(t)
+
+	w := doProbeRequest(r, http.MethodGet, "/orgs/current/tag-rules", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doProbeRequest(r, http.MethodPost, "/orgs/current/tag-rules/apply", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	invalid := []models.SetHostTagRulesRequest{
+		{},
+		{Rules: []models.HostTagRule{}},
+		{Rules: []models.HostTagRule{{Pattern: `web-(`, Tags: []string{"role:web"}}}},
+		{Rules: []models.HostTagRule{{Pattern: `^web`}}},
+		{Rules: []models.HostTagRule{{Pattern: `-(prod)$`, Tags: []string{"env:$2"}}}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPut, "/orgs/current/tag-rules", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req)
+	}
+
+	w = doProbeRequest(r, http.MethodPut, "/orgs/current/tag-rules", testTagRules)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodGet, "/orgs/current/tag-rules", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	var rules models.HostTagRules
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	require.Len(t, rules.Rules, 2)
+	assert.Equal(t, []string{"env:${env}"}, rules.Rules[1].Tags, "tags are trimmed")
+	assert.Equal(t, admin.ID, rules.UpdatedByUserID)
+
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/tag-rules", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodDelete, "/orgs/current/tag-rules", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_HostTagRules_Ingest(t *testing.T) {
+	r, mockStore, admin := setupTagRulesTest(t)
+
+	w := doProbeRequest(r, http.MethodPut, "/orgs/current/tag-rules", testTagRules)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	const webID = "00000000-0000-0000-0000-000000000001"
+	ingestHostname(t, r, webID, "web-1.prod.example.com")
+	require.NoError(t, mockStore.SetHostTags(webID, admin.OrgID, []string{"env:prod", "team:web"}, admin.ID, 0))
+	ingestHostname(t, r, webID, "web-1.prod.example.com")
+
+	tags, err := mockStore.GetHostTags(webID, admin.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"env:prod", "role:web", "team:web"}, tags, "manual tags are kept")
+
+	const dbID = "00000000-0000-0000-0000-000000000002"
+	ingestHostname(t, r, dbID, "db-1.example.com")
+	tags, err = mockStore.GetHostTags(dbID, admin.OrgID)
+	require.NoError(t, err)
+	assert.Empty(t, tags, "no rule matches")
+}
+
+func TestHandlers_ApplyHostTagRules(t *testing.T) {
+	r, mockStore, admin := setupTagRulesTest(t)
+
+	const webID, dbID = "00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"
+	ingestHostname(t, r, webID, "web-1.staging.example.com")
+	ingestHostname(t, r, dbID, "db-1.example.com")
+
+	w := doProbeRequest(r, http.MethodPut, "/orgs/current/tag-rules", testTagRules)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodPost, "/orgs/current/tag-rules/apply?dry_run=true", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result models.HostTagRulesResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.HostsEvaluated)
+	assert.Equal(t, 1, result.HostsTagged)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, models.HostTagChange{HostID: webID, Hostname: "web-1.staging.example.com", Added: []string{"env:staging", "role:web"}}, result.Changes[0])
+	tags, err := mockStore.GetHostTags(webID, admin.OrgID)
+	require.NoError(t, err)
+	assert.Empty(t, tags, "a dry run changes nothing")
+
+	w = doProbeRequest(r, http.MethodPost, "/orgs/current/tag-rules/apply", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.DryRun)
+	assert.Equal(t, 1, result.HostsTagged)
+	tags, err = mockStore.GetHostTags(webID, admin.OrgID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"env:staging", "role:web"}, tags)
+
+	events, err := mockStore.ListHostEvents(admin.OrgID, webID, 0, 10, false)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.HostEventTagged, events[1].Type)
+	assert.Equal(t, admin.ID, events[1].ActorUserID, "the admin who applied the rules")
+
+	w = doProbeRequest(r, http.MethodPost, "/orgs/current/tag-rules/apply", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 0, result.HostsTagged, "hosts already carry the tags")
+	assert.Empty(t, result.Changes)
+}
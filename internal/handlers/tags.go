@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/acl"
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// hostPolicy returns the host visibility policy for the authenticated user
+// Requests without a user in context (e.g. internal callers) are unrestricted
+func (h *Handlers) hostPolicy(c *gin.Context) (*acl.Policy, error) {
+	userValue, exists := c.Get("user")
+	if !exists {
+		return &acl.Policy{}, nil
+	}
+	user, ok := userValue.(*models.User)
+	if !ok {
+		return &acl.Policy{}, nil
+	}
+	return h.acl.PolicyFor(user)
+}
+
+// canViewHost reports whether the authenticated user may see a host under their tag policy
+func (h *Handlers) canViewHost(c *gin.Context, hostID, orgID string) (bool, error) {
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		return false, err
+	}
+	if !policy.Restricted() {
+		return true, nil
+	}
+
+	tags, err := h.store(c).GetHostTags(hostID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return policy.Allows(tags), nil
+}
+
+// normalizeTags trims whitespace, drops empty values, and de-duplicates tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// SetHostTags replaces the tags on a host
+// @Summary     Set host tags
+// @Description Replaces all tags attached to a host in the authenticated user's organization. Tags drive tag-based host access policies (e.g. "team:web").
+// @Description With If-Match set to the ETag of GET /hosts/{host_id}, the tags are only replaced if the host's tags and details have not changed since.
+// @Tags        Hosts
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id   path      string                        true   "Host ID (UUID)"
+// @Param       If-Match  header    string                        false  "ETag of the host's tags and details"
+// @Param       request   body      models.UpdateHostTagsRequest  true   "Tags to attach"
+// @Success     200      {object}  models.HostTagsResponse  "Tags updated"
+// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     404      {object}  map[string]string  "Host not found"
+// @Failure     412      {object}  map[string]string  "Host tags or details changed since If-Match was read"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/tags [put]
+func (h *Handlers) SetHostTags(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	var req models.UpdateHostTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+	ifVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	// Editors restricted by a tag policy cannot retag hosts they cannot see
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to update host tags", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	tags := normalizeTags(req.Tags)
+	if err := h.store(c).SetHostTags(hostID, orgID, tags, middleware.GetUserID(c), ifVersion); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			_ = c.Error(apierror.NotFound("host not found"))
+		case errors.Is(err, storage.ErrVersionMismatch):
+			versionMismatch(c)
+		default:
+			_ = c.Error(apierror.Internal("failed to update host tags", err))
+		}
+		return
+	}
+
+	h.setHostETag(c, hostID, orgID)
+	c.JSON(http.StatusOK, models.HostTagsResponse{HostID: hostID, Tags: tags})
+}
+
+// GetHostAccessPolicy returns a user's tag-based host access policy (admin-only)
+// @Summary     Get user host access policy
+// @Description Returns the tags a user is restricted to when viewing hosts. An empty list means the user can see every host in the organization.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       user_id  path      string  true  "User ID"
+// @Success     200      {object}  models.HostAccessPolicy  "Host access policy"
+// @Failure     403      {object}  map[string]string  "Forbidden - admin role required or user not in your organization"
+// @Failure     404      {object}  map[string]string  "User not found"
+// @Router      /api/v1/users/{user_id}/host-access [get]
+func (h *Handlers) GetHostAccessPolicy(c *gin.Context) {
+	targetUser, err := h.sameOrgUser(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	tags, err := h.store(c).GetHostAccessTags(targetUser.ID, targetUser.OrgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve host access policy", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.HostAccessPolicy{
+		UserID:     targetUser.ID,
+		Tags:       tags,
+		Restricted: len(tags) > 0,
+	})
+}
+
+// UpdateHostAccessPolicy replaces a user's tag-based host access policy (admin-only)
+// @Summary     Update user host access policy
+// @Description Restricts a user to hosts carrying at least one of the given tags. Send an empty list to remove all restrictions. Admins are never restricted.
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       user_id  path      string                                true  "User ID"
+// @Param       request  body      models.UpdateHostAccessPolicyRequest  true  "Allowed tags"
+// @Success     200      {object}  models.HostAccessPolicy  "Host access policy updated"
+// @Failure     400      {object}  map[string]string  "Invalid request"
+// @Failure     403      {object}  map[string]string  "Forbidden - admin role required or user not in your organization"
+// @Failure     404      {object}  map[string]string  "User not found"
+// @Router      /api/v1/users/{user_id}/host-access [put]
+func (h *Handlers) UpdateHostAccessPolicy(c *gin.Context) {
+	targetUser, err := h.sameOrgUser(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req models.UpdateHostAccessPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return
+	}
+
+	tags := normalizeTags(req.Tags)
+	if err := h.store(c).SetHostAccessTags(targetUser.ID, targetUser.OrgID, tags); err != nil {
+		_ = c.Error(apierror.Internal("failed to update host access policy", err))
+		return
+	}
+	h.acl.Invalidate(targetUser.ID)
+
+	c.JSON(http.StatusOK, models.HostAccessPolicy{
+		UserID:     targetUser.ID,
+		Tags:       tags,
+		Restricted: len(tags) > 0,
+	})
+}
+
+// sameOrgUser loads the user named by the user_id path parameter and verifies it belongs
+// to the caller's organization
+func (h *Handlers) sameOrgUser(c *gin.Context) (*models.User, error) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		return nil, apierror.Unauthorized("unauthorized")
+	}
+
+	userID := c.Param("user_id")
+	targetUser, err := h.store(c).GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, apierror.NotFound("user not found")
+		}
+		return nil, apierror.Internal("failed to retrieve user", err)
+	}
+
+	if targetUser.OrgID != orgID {
+		return nil, apierror.Forbidden("user not in your organization").
+			WithDetail("You can only manage users in your own organization.")
+	}
+
+	return targetUser, nil
+}
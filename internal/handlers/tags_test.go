@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestHandlers_HostAccessPolicy(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	webHost := "00000000-0000-0000-0000-000000000001"
+	dbHost := "00000000-0000-0000-0000-000000000002"
+	for _, hostID := range []string{webHost, dbHost} {
+		mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostID},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID)
+	}
+
+	asUser := func(user *models.User) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+			c.Set("role", user.Role)
+		}
+	}
+
+	do := func(user *models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(asUser(user))
+		r.PUT("/hosts/:host_id/tags", h.SetHostTags)
+		r.GET("/hosts", h.ListHosts)
+		r.GET("/hosts/:host_id", h.GetHost)
+		r.PUT("/users/:user_id/host-access", h.UpdateHostAccessPolicy)
+		r.GET("/users/:user_id/host-access", h.GetHostAccessPolicy)
+
+		var reqBody []byte
+		if body != nil {
+			reqBody, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(admin, http.MethodPut, "/hosts/"+webHost+"/tags", models.UpdateHostTagsRequest{Tags: []string{" team:web ", "env:prod", "team:web"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var tagsResp models.HostTagsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tagsResp))
+	assert.Equal(t, []string{"env:prod", "team:web"}, tagsResp.Tags)
+
+	w = do(admin, http.MethodPut, "/hosts/"+dbHost+"/tags", models.UpdateHostTagsRequest{Tags: []string{"team:db"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Without a policy the viewer sees every host
+	w = do(viewer, http.MethodGet, "/hosts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listResp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResp))
+	assert.Equal(t, float64(2), listResp["total"])
+
+	// Restrict the viewer to team:web hosts
+	w = do(admin, http.MethodPut, "/users/"+viewer.ID+"/host-access", models.UpdateHostAccessPolicyRequest{Tags: []string{"team:web"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var policy models.HostAccessPolicy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	assert.True(t, policy.Restricted)
+
+	w = do(viewer, http.MethodGet, "/hosts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResp))
+	assert.Equal(t, float64(1), listResp["total"])
+
+	assert.Equal(t, http.StatusOK, do(viewer, http.MethodGet, "/hosts/"+webHost, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(viewer, http.MethodGet, "/hosts/"+dbHost, nil).Code)
+
+	// Admins are never restricted
+	w = do(admin, http.MethodGet, "/hosts", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listResp))
+	assert.Equal(t, float64(2), listResp["total"])
+
+	// Clearing the policy restores full visibility
+	w = do(admin, http.MethodPut, "/users/"+viewer.ID+"/host-access", models.UpdateHostAccessPolicyRequest{Tags: []string{}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, do(viewer, http.MethodGet, "/hosts/"+dbHost, nil).Code)
+
+	// Policies cannot be managed for users in other organizations
+	otherOrg, _ := mockStore.CreateOrganization("Other Org")
+	outsider, _ := mockStore.CreateUser("outsider", "outsider@example.com", "hash", otherOrg.ID, "viewer")
+	assert.Equal(t, http.StatusForbidden, do(admin, http.MethodGet, "/users/"+outsider.ID+"/host-access", nil).Code)
+}
+
+func TestHandlers_DeleteHost_HostAccessPolicy(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	editor, _ := mockStore.CreateUser("editor", "editor@example.com", "hash", org.ID, "editor")
+
+	webHost := "00000000-0000-0000-0000-000000000001"
+	dbHost := "00000000-0000-0000-0000-000000000002"
+	for _, hostID := range []string{webHost, dbHost} {
+		mockStore.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: time.Now(),
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostID},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, admin.ID)
+	}
+
+	do := func(user *models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+			c.Set("role", user.Role)
+		})
+		r.PUT("/hosts/:host_id/tags", h.SetHostTags)
+		r.DELETE("/hosts/:host_id", h.DeleteHost)
+		r.PUT("/users/:user_id/host-access", h.UpdateHostAccessPolicy)
+
+		var reqBody []byte
+		if body != nil {
+			reqBody, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, do(admin, http.MethodPut, "/hosts/"+webHost+"/tags", models.UpdateHostTagsRequest{Tags: []string{"team:web"}}).Code)
+	require.Equal(t, http.StatusOK, do(admin, http.MethodPut, "/hosts/"+dbHost+"/tags", models.UpdateHostTagsRequest{Tags: []string{"team:db"}}).Code)
+	require.Equal(t, http.StatusOK, do(admin, http.MethodPut, "/users/"+editor.ID+"/host-access", models.UpdateHostAccessPolicyRequest{Tags: []string{"team:web"}}).Code)
+
+	// A host the editor's policy hides cannot be deleted, and is reported as not found
+	assert.Equal(t, http.StatusNotFound, do(editor, http.MethodDelete, "/hosts/"+dbHost, nil).Code)
+	_, err := mockStore.GetHost(dbHost, org.ID)
+	assert.NoError(t, err, "hidden host was deleted")
+
+	assert.Equal(t, http.StatusNoContent, do(editor, http.MethodDelete, "/hosts/"+webHost, nil).Code)
+	_, err = mockStore.GetHost(webHost, org.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/checkin"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Uptime periods
+const (
+	defaultUptimeWindow = "30d"
+	maxUptimeWindow     = 90 * 24 * time.Hour
+)
+
+// parseUptimeWindow parses a period length in hours or days, e.g. 24h or 7d
+func parseUptimeWindow(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	var window time.Duration
+	switch value[len(value)-1] {
+	case 'h':
+		window = time.Duration(n) * time.Hour
+	case 'd':
+		window = time.Duration(n) * 24 * time.Hour
+	default:
+		return 0, false
+	}
+	return window, window <= maxUptimeWindow
+}
+
+// uptimePeriod reads the window query parameter, responding with 400 and returning false if it is invalid
+func uptimePeriod(c *gin.Context, now time.Time) (string, time.Time, bool) {
+	value := c.DefaultQuery("window", defaultUptimeWindow)
+	window, ok := parseUptimeWindow(value)
+	if !ok {
+		_ = c.Error(apierror.Validation("window must be a number of hours or days up to 90d, e.g. 24h or 7d"))
+		return "", time.Time{}, false
+	}
+	return value, now.Add(-window), true
+}
+
+// GetHostUptime returns a host's reporting uptime over a period
+// @Summary     Get host reporting uptime
+// @Description Returns the share of the period during which the host reported within its check-in window, from its report history. Each report covers the host's current check-in window (see GET /checkins) from when it was received; the host is down while no report covers it.
+// @Description The period ends now and is measured from its start, or from the host's first report if that is later. Also returns the number of reports, and the number and longest of the outages, including one still ongoing.
+// @Tags        Hosts
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       host_id  path      string             true   "Host ID"
+// @Param       window   query     string             false  "Length of the period in hours or days, up to 90d"  default(30d)
+// @Success     200      {object}  models.HostUptime  "Reporting uptime"
+// @Failure     400      {object}  map[string]string  "Invalid window"
+// @Failure     401      {object}  map[string]string  "Unauthorized"
+// @Failure     404      {object}  map[string]string  "Host not found"
+// @Failure     500      {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/hosts/{host_id}/uptime [get]
+func (h *Handlers) GetHostUptime(c *gin.Context) {
+	hostID := c.Param("host_id")
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	now := time.Now().UTC()
+	_, from, ok := uptimePeriod(c, now)
+	if !ok {
+		return
+	}
+
+	report, err := h.store(c).GetHost(hostID, orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("host not found"))
+			return
+		}
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host")
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	// Hosts outside the user's tag policy are reported as not found to avoid leaking their existence
+	visible, err := h.canViewHost(c, hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to evaluate host access policy")
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	if !visible {
+		_ = c.Error(apierror.NotFound("host not found"))
+		return
+	}
+
+	tags, err := h.store(c).GetHostTags(hostID, orgID)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host tags")
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	schedule, err := h.store(c).GetCheckinSchedule(orgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	times, err := h.store(c).ListHostReportTimes(orgID, hostID, from, now)
+	if err != nil {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to list host report times")
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+
+	window, windowTag := checkin.Window(schedule, tags, h.staleAfter)
+	uptime := checkin.Uptime(times[hostID], window, from, now)
+	uptime.HostID = hostID
+	uptime.Hostname = report.Meta.Hostname
+	uptime.WindowTag = windowTag
+	c.JSON(http.StatusOK, uptime)
+}
+
+// GetUptimeStats returns the reporting uptime of the organization's hosts over a period
+// @Summary     Get fleet reporting uptime
+// @Description Returns the reporting uptime (see GET /hosts/{host_id}/uptime) of every host that is not archived, lowest first, and the fleet's uptime weighted by how long each host was measured.
+// @Description With group_by set to a tag key such as env, hosts are also grouped by the value of their env:<value> tags; a host with several such tags counts in each group, and hosts without one form the group "".
+// @Description Users with a tag-based host access policy only see hosts carrying at least one of their allowed tags.
+// @Tags        Stats
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       window    query     string              false  "Length of the period in hours or days, up to 90d"  default(30d)
+// @Param       group_by  query     string              false  "Tag key to group hosts by"  example(env)
+// @Success     200       {object}  models.UptimeStats  "Reporting uptime"
+// @Failure     400       {object}  map[string]string   "Invalid window or group_by"
+// @Failure     401       {object}  map[string]string   "Unauthorized"
+// @Failure     500       {object}  map[string]string   "Internal server error"
+// @Router      /api/v1/stats/uptime [get]
+func (h *Handlers) GetUptimeStats(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+	now := time.Now().UTC()
+	window, from, ok := uptimePeriod(c, now)
+	if !ok {
+		return
+	}
+	groupBy := strings.TrimSpace(c.Query("group_by"))
+	if len(groupBy) > 100 || strings.Contains(groupBy, ":") {
+		_ = c.Error(apierror.Validation("group_by must be a tag key without ':' of at most 100 characters"))
+		return
+	}
+
+	schedule, err := h.store(c).GetCheckinSchedule(orgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	hosts, err := h.store(c).ListHosts(orgID, false)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	policy, err := h.hostPolicy(c)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+	hosts = policy.FilterHosts(hosts)
+	times, err := h.store(c).ListHostReportTimes(orgID, "", from, now)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to compute uptime", err))
+		return
+	}
+
+	stats := models.UptimeStats{
+		From:        from,
+		To:          now,
+		Window:      window,
+		GroupBy:     groupBy,
+		Hosts:       len(hosts),
+		HostUptimes: make([]models.HostUptime, 0, len(hosts)),
+	}
+	groups := map[string]*models.UptimeGroup{}
+	var measured, up float64
+	for _, host := range hosts {
+		interval, windowTag := checkin.Window(schedule, host.Tags, h.staleAfter)
+		uptime := checkin.Uptime(times[host.HostID], interval, from, now)
+		uptime.HostID = host.HostID
+		uptime.Hostname = host.Hostname
+		uptime.WindowTag = windowTag
+		stats.HostUptimes = append(stats.HostUptimes, uptime)
+		measured += uptime.MeasuredSeconds
+		up += uptime.UpSeconds
+
+		if groupBy == "" {
+			continue
+		}
+		for _, value := range tagValues(host.Tags, groupBy) {
+			group := groups[value]
+			if group == nil {
+				group = &models.UptimeGroup{Group: value}
+				groups[value] = group
+			}
+			group.Hosts++
+			group.MeasuredSeconds += uptime.MeasuredSeconds
+			group.UpSeconds += uptime.UpSeconds
+			group.Outages += uptime.Outages
+		}
+	}
+	stats.UptimePercent = checkin.Percent(up, measured)
+
+	if groupBy != "" {
+		stats.Groups = make([]models.UptimeGroup, 0, len(groups))
+		for _, group := range groups {
+			group.UptimePercent = checkin.Percent(group.UpSeconds, group.MeasuredSeconds)
+			stats.Groups = append(stats.Groups, *group)
+		}
+		sort.Slice(stats.Groups, func(i, j int) bool { return stats.Groups[i].Group < stats.Groups[j].Group })
+	}
+	// Lowest uptime first
+	sort.Slice(stats.HostUptimes, func(i, j int) bool {
+		a, b := stats.HostUptimes[i], stats.HostUptimes[j]
+		if a.UptimePercent != b.UptimePercent {
+			return a.UptimePercent < b.UptimePercent
+		}
+		return a.HostID < b.HostID
+	})
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// tagValues returns the values of a host's key:value tags with the given key, or [""] if it has none
+func tagValues(tags []string, key string) []string {
+	values := []string{}
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, key+":"); ok {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestParseUptimeWindow(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"24h", 24 * time.Hour, true},
+		{"7d", 7 * 24 * time.Hour, true},
+		{"90d", 90 * 24 * time.Hour, true},
+		{"91d", 0, false},
+		{"0d", 0, false},
+		{"7w", 0, false},
+		{"d", 0, false},
+		{"1.5d", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseUptimeWindow(tt.value)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		if tt.ok {
+			assert.Equal(t, tt.want, got, tt.value)
+		}
+	}
+}
+
+func TestHandlers_Uptime(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	h := New(mockStore)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	viewer, _ := mockStore.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	require.NoError(t, mockStore.SetHostAccessTags(viewer.ID, org.ID, []string{"env:prod"}))
+
+	const (
+		host1 = "00000000-0000-0000-0000-000000000001"
+		host2 = "00000000-0000-0000-0000-000000000002"
+	)
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host1, "42", "0.5.0")
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host1, "42", "0.5.0")
+	saveFleetHost(t, mockStore, org.ID, admin.ID, host2, "42", "0.5.0")
+	require.NoError(t, mockStore.SetHostTags(host1, org.ID, []string{"env:prod"}, admin.ID, 0))
+	require.NoError(t, mockStore.SetCheckinSchedule(&models.CheckinSchedule{
+		OrgID:   org.ID,
+		Windows: []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 3600}},
+	}))
+
+	router := func(user *models.User) *gin.Engine {
+		r := setupTestRouter(h)
+		r.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("org_id", user.OrgID)
+		})
+		r.GET("/hosts/:host_id/uptime", h.GetHostUptime)
+		r.GET("/stats/uptime", h.GetUptimeStats)
+		return r
+	}
+	r := router(admin)
+
+	w := doProbeRequest(r, http.MethodGet, "/hosts/"+host1+"/uptime?window=7d", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var uptime models.HostUptime
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uptime))
+	assert.Equal(t, host1, uptime.HostID)
+	assert.Equal(t, "host-1", uptime.Hostname)
+	assert.Equal(t, int64(3600), uptime.ExpectedIntervalSeconds)
+	assert.Equal(t, "env:prod", uptime.WindowTag)
+	assert.Equal(t, 2, uptime.Reports)
+	assert.Equal(t, 100.0, uptime.UptimePercent, "measured from the first report, which is still within its window")
+	assert.Zero(t, uptime.Outages)
+
+	w = doProbeRequest(r, http.MethodGet, "/hosts/"+host1+"/uptime?window=1y", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/hosts/00000000-0000-0000-0000-000000000009/uptime", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doProbeRequest(r, http.MethodGet, "/stats/uptime?window=24h&group_by=env", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var stats models.UptimeStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, "24h", stats.Window)
+	assert.Equal(t, 2, stats.Hosts)
+	assert.Equal(t, 100.0, stats.UptimePercent)
+	require.Len(t, stats.HostUptimes, 2)
+	require.Len(t, stats.Groups, 2)
+	assert.Equal(t, "", stats.Groups[0].Group, "hosts without an env tag")
+	assert.Equal(t, "prod", stats.Groups[1].Group)
+	assert.Equal(t, 1, stats.Groups[1].Hosts)
+
+	w = doProbeRequest(r, http.MethodGet, "/stats/uptime?group_by=env:prod", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A restricted user only sees the hosts their policy allows
+	r = router(viewer)
+	w = doProbeRequest(r, http.MethodGet, "/stats/uptime", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var restricted models.UptimeStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &restricted))
+	assert.Equal(t, 1, restricted.Hosts)
+	assert.Equal(t, "30d", restricted.Window)
+	assert.Nil(t, restricted.Groups)
+	w = doProbeRequest(r, http.MethodGet, "/hosts/"+host2+"/uptime", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/middleware"
+)
+
+// GetOrgUsage returns the authenticated organization's API consumption
+// @Summary     Organization usage
+// @Description Returns the organization's API calls per endpoint, ingested reports and bytes, and rate-limit rejections over the last 24 hours, plus the storage its hosts and host history occupy.
+// @Description Call counts are tracked in memory per server instance and start over when it restarts (see since). Rate-limit rejections are only counted for credentials that authenticated recently. Requires admin role.
+// @Tags        Organizations
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Organization usage"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Insufficient role"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/orgs/current/usage [get]
+func (h *Handlers) GetOrgUsage(c *gin.Context) {
+	orgID := middleware.GetOrgID(c)
+	if orgID == "" {
+		_ = c.Error(apierror.Unauthorized("unauthorized"))
+		return
+	}
+
+	storageUsage, err := h.store(c).GetOrgStorageUsage(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to retrieve usage", err))
+		return
+	}
+
+	usage := h.usage.Snapshot(orgID)
+	c.JSON(http.StatusOK, gin.H{
+		"org_id":          orgID,
+		"window":          usage.Window,
+		"since":           usage.Since,
+		"endpoints":       usage.Endpoints,
+		"ingest":          usage.Ingest,
+		"rate_limit_hits": usage.RateLimitHits,
+		"storage":         storageUsage,
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+	"snailbus/internal/usage"
+)
+
+func TestHandlers_GetOrgUsage(t *testing.T) {
+	mockStore := storage.NewMockStorage()
+	tracker := usage.NewTracker()
+	h := New(mockStore, WithUsageTracker(tracker))
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	other, _ := mockStore.CreateOrganization("Other Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	require.NoError(t, mockStore.SaveHost(&models.Report{
+		ID:         "00000000-0000-0000-0000-000000000001",
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: "00000000-0000-0000-0000-000000000001", Hostname: "host1"},
+		Data:       json.RawMessage(`{"system": {}}`),
+	}, org.ID, admin.ID))
+
+	tracker.RecordRequest(org.ID, "GET /api/v1/hosts", http.StatusOK)
+	tracker.RecordRequest(other.ID, "GET /api/v1/hosts", http.StatusOK)
+	tracker.RecordIngest(org.ID, 512)
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("org_id", org.ID)
+	})
+	r.GET("/orgs/current/usage", h.GetOrgUsage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orgs/current/usage", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		OrgID         string                  `json:"org_id"`
+		Window        string                  `json:"window"`
+		Endpoints     []usage.EndpointUsage   `json:"endpoints"`
+		Ingest        usage.IngestUsage       `json:"ingest"`
+		RateLimitHits int64                   `json:"rate_limit_hits"`
+		Storage       *models.OrgStorageUsage `json:"storage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, org.ID, response.OrgID)
+	assert.Equal(t, "24h0m0s", response.Window)
+	assert.Equal(t, []usage.EndpointUsage{{Endpoint: "GET /api/v1/hosts", Requests: 1}}, response.Endpoints)
+	assert.Equal(t, usage.IngestUsage{Reports: 1, Bytes: 512}, response.Ingest)
+	require.NotNil(t, response.Storage)
+	assert.Equal(t, int64(1), response.Storage.Hosts)
+	assert.Equal(t, int64(1), response.Storage.HostEvents)
+	assert.Equal(t, response.Storage.HostBytes+response.Storage.HostEventBytes, response.Storage.TotalBytes)
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+	"snailbus/internal/middleware"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+// Default and maximum number of deliveries returned by ListWebhookDeliveries
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 500
+)
+
+// webhooksEnabled writes a 400 response and returns false if webhooks are disabled
+func (h *Handlers) webhooksEnabled(c *gin.Context) bool {
+	if h.webhooks == nil {
+		_ = c.Error(apierror.Validation("webhooks are disabled").WithDetail("Set OUTBOUND_ACTIONS_ENABLED=true to enable them"))
+		return false
+	}
+	return true
+}
+
+// fireWebhook queues the organization's webhooks for a host event
+// Failures are logged; an event never fails the request that caused it.
+func (h *Handlers) fireWebhook(orgID string, event models.WebhookEvent) {
+	if h.webhooks == nil {
+		return
+	}
+	queued, err := h.webhooks.Fire(orgID, event)
+	if err != nil {
+		logger.Logger.Error().Err(err).
+			Str("org_id", orgID).
+			Str("host_id", event.HostID).
+			Str("event", event.Type).
+			Msg("Failed to queue webhooks")
+		return
+	}
+	if queued > 0 {
+		logger.Logger.Debug().
+			Str("org_id", orgID).
+			Str("host_id", event.HostID).
+			Str("event", event.Type).
+			Int("deliveries", queued).
+			Msg("Queued webhooks")
+	}
+}
+
+// buildWebhook validates a webhook request into a webhook
+// Returns false after writing a 400 response if it is invalid
+func buildWebhook(c *gin.Context, webhook *models.Webhook) bool {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apierror.Validation(err.Error()))
+		return false
+	}
+
+	target, err := outbound.CheckURL(req.URL)
+	if err != nil {
+		_ = c.Error(apierror.Validation("invalid webhook").WithDetail(err.Error()))
+		return false
+	}
+
+	webhook.URL = target.String()
+	webhook.Events = []string{}
+	for _, event := range req.Events {
+		if !containsString(webhook.Events, event) {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+	return true
+}
+
+// ListWebhooks returns the organization's webhooks
+// @Summary     List webhooks
+// @Description Returns the organization's webhooks: URLs that receive signed JSON host events. Requires admin role and OUTBOUND_ACTIONS_ENABLED.
+// @Tags        Webhooks
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}  "Webhooks with total count"
+// @Failure     400  {object}  map[string]string       "Webhooks disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/webhooks [get]
+func (h *Handlers) ListWebhooks(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	list, err := h.store(c).ListWebhooks(orgID)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list webhooks", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": list,
+		"total":    len(list),
+	})
+}
+
+// CreateWebhook registers a webhook
+// @Summary     Create webhook
+// @Description Registers a URL that is POSTed a JSON event for each of the listed events: host.ingested when a report is accepted by /api/v1/ingest, host.deleted when a host is deleted, and host.stale when a host misses its check-in window (once until it reports again).
+// @Description Deliveries are signed with HMAC-SHA256 in the X-Snailbus-Signature header, like outbound actions; the signing secret is returned only in this response. X-Snailbus-Event carries the event type and X-Snailbus-Delivery the delivery ID.
+// @Description Failed deliveries are retried with exponential backoff up to 5 attempts. Requires admin role.
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       request  body      models.WebhookRequest         true  "Webhook definition"
+// @Success     201      {object}  models.WebhookSecretResponse  "Webhook created, with its signing secret"
+// @Failure     400      {object}  map[string]string             "Invalid webhook or webhooks disabled"
+// @Failure     401      {object}  map[string]string             "Unauthorized"
+// @Failure     403      {object}  map[string]string             "Admin role required"
+// @Failure     500      {object}  map[string]string             "Internal server error"
+// @Router      /api/v1/webhooks [post]
+func (h *Handlers) CreateWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	webhook := &models.Webhook{
+		ID:        uuid.New().String(),
+		CreatedBy: middleware.GetUserID(c),
+	}
+	if !buildWebhook(c, webhook) {
+		return
+	}
+	secret, err := actions.GenerateSigningSecret()
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to create webhook", err))
+		return
+	}
+	webhook.SigningSecret = secret
+
+	if err := h.store(c).CreateWebhook(webhook, orgID); err != nil {
+		_ = c.Error(apierror.Internal("failed to create webhook", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("webhook_id", webhook.ID).
+		Strs("events", webhook.Events).
+		Msg("Webhook created")
+
+	c.JSON(http.StatusCreated, models.WebhookSecretResponse{Webhook: webhook, SigningSecret: secret})
+}
+
+// GetWebhook returns a webhook
+// @Summary     Get webhook
+// @Description Returns a webhook in the organization. Requires admin role.
+// @Tags        Webhooks
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Webhook ID (UUID)"
+// @Success     200  {object}  models.Webhook     "Webhook"
+// @Failure     400  {object}  map[string]string  "Webhooks disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Webhook not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/webhooks/{id} [get]
+func (h *Handlers) GetWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	webhook, err := h.store(c).GetWebhook(c.Param("id"), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("webhook not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to get webhook", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook replaces a webhook's definition
+// @Summary     Update webhook
+// @Description Replaces a webhook's URL, events, and enabled flag. Deliveries already queued go to the new URL on their next attempt; disabling a webhook fails its queued deliveries. The signing secret is not changed. Requires admin role.
+// @Tags        Webhooks
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id       path      string                 true  "Webhook ID (UUID)"
+// @Param       request  body      models.WebhookRequest  true  "Webhook definition"
+// @Success     200      {object}  models.Webhook         "Webhook updated"
+// @Failure     400      {object}  map[string]string      "Invalid webhook or webhooks disabled"
+// @Failure     401      {object}  map[string]string      "Unauthorized"
+// @Failure     403      {object}  map[string]string      "Admin role required"
+// @Failure     404      {object}  map[string]string      "Webhook not found"
+// @Failure     500      {object}  map[string]string      "Internal server error"
+// @Router      /api/v1/webhooks/{id} [put]
+func (h *Handlers) UpdateWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+
+	webhook := &models.Webhook{ID: c.Param("id")}
+	if !buildWebhook(c, webhook) {
+		return
+	}
+
+	if err := h.store(c).UpdateWebhook(webhook, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("webhook not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to update webhook", err))
+		return
+	}
+
+	logger.FromContext(c).
+		Str("webhook_id", webhook.ID).
+		Bool("enabled", webhook.Enabled).
+		Strs("events", webhook.Events).
+		Msg("Webhook updated")
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+// @Summary     Delete webhook
+// @Description Deletes a webhook, its delivery log, and any deliveries not yet sent. Requires admin role.
+// @Tags        Webhooks
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Webhook ID (UUID)"
+// @Success     204  "Webhook deleted"
+// @Failure     400  {object}  map[string]string  "Webhooks disabled"
+// @Failure     401  {object}  map[string]string  "Unauthorized"
+// @Failure     403  {object}  map[string]string  "Admin role required"
+// @Failure     404  {object}  map[string]string  "Webhook not found"
+// @Failure     500  {object}  map[string]string  "Internal server error"
+// @Router      /api/v1/webhooks/{id} [delete]
+func (h *Handlers) DeleteWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	webhookID := c.Param("id")
+
+	if err := h.store(c).DeleteWebhook(webhookID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("webhook not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to delete webhook", err))
+		return
+	}
+
+	logger.FromContext(c).Str("webhook_id", webhookID).Msg("Webhook deleted")
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns a webhook's delivery log
+// @Summary     List webhook deliveries
+// @Description Returns a webhook's deliveries, newest first, with the event, status (pending, running, succeeded, failed), attempt count, and last response or error. Completed deliveries are kept for 7 days. Requires admin role.
+// @Tags        Webhooks
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id     path      string  true   "Webhook ID (UUID)"
+// @Param       limit  query     int     false  "Maximum number of deliveries (default 50, max 500)"
+// @Success     200  {object}  map[string]interface{}  "Deliveries with total count"
+// @Failure     400  {object}  map[string]string       "Invalid limit or webhooks disabled"
+// @Failure     401  {object}  map[string]string       "Unauthorized"
+// @Failure     403  {object}  map[string]string       "Admin role required"
+// @Failure     404  {object}  map[string]string       "Webhook not found"
+// @Failure     500  {object}  map[string]string       "Internal server error"
+// @Router      /api/v1/webhooks/{id}/deliveries [get]
+func (h *Handlers) ListWebhookDeliveries(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	orgID := middleware.GetOrgID(c)
+	webhookID := c.Param("id")
+
+	limit := defaultWebhookDeliveryLimit
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxWebhookDeliveryLimit {
+			_ = c.Error(apierror.Validation("limit must be between 1 and " + strconv.Itoa(maxWebhookDeliveryLimit)))
+			return
+		}
+		limit = parsed
+	}
+
+	if _, err := h.store(c).GetWebhook(webhookID, orgID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			_ = c.Error(apierror.NotFound("webhook not found"))
+			return
+		}
+		_ = c.Error(apierror.Internal("failed to list webhook deliveries", err))
+		return
+	}
+
+	deliveries, err := h.store(c).ListWebhookDeliveries(webhookID, orgID, limit)
+	if err != nil {
+		_ = c.Error(apierror.Internal("failed to list webhook deliveries", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+// hostDeletedEvent describes a host about to be deleted as a host.deleted event
+// The hostname is looked up first since it is gone once the host is deleted.
+func (h *Handlers) hostDeletedEvent(c *gin.Context, hostID, orgID string, deletion *models.HostDeletion) models.WebhookEvent {
+	event := models.WebhookEvent{Type: models.WebhookEventHostDeleted, HostID: hostID, Deletion: deletion}
+	report, err := h.store(c).GetHost(hostID, orgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.FromContext(c).Err(err).Str("host_id", hostID).Msg("Failed to get host for webhooks")
+	}
+	if report != nil {
+		event.Hostname = report.Meta.Hostname
+	}
+	event.OccurredAt = time.Now().UTC()
+	return event
+}
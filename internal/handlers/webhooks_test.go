@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+	"snailbus/internal/webhooks"
+)
+
+// setupWebhooksTest creates an organization and a router acting as its admin
+func setupWebhooksTest(t *testing.T, enabled bool) (*gin.Engine, *storage.MockStorage, *models.User) {
+	mockStore := storage.NewMockStorage()
+	var opts []Option
+	if enabled {
+		opts = append(opts, WithWebhooks(webhooks.NewDispatcher(mockStore, time.Hour)))
+	}
+	h := New(mockStore, opts...)
+
+	org, _ := mockStore.CreateOrganization("Test Org")
+	admin, _ := mockStore.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+
+	r := setupTestRouter(h)
+	r.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Set("user_id", admin.ID)
+		c.Set("org_id", admin.OrgID)
+	})
+	r.POST("/ingest", h.Ingest)
+	r.DELETE("/hosts/:host_id", h.DeleteHost)
+	r.GET("/webhooks", h.ListWebhooks)
+	r.POST("/webhooks", h.CreateWebhook)
+	r.GET("/webhooks/:id", h.GetWebhook)
+	r.PUT("/webhooks/:id", h.UpdateWebhook)
+	r.DELETE("/webhooks/:id", h.DeleteWebhook)
+	r.GET("/webhooks/:id/deliveries", h.ListWebhookDeliveries)
+	return r, mockStore, admin
+}
+
+func TestHandlers_Webhooks_Disabled(t *testing.T) {
+	r, _, _ := setupWebhooksTest(t, false)
+
+	w := doProbeRequest(r, http.MethodGet, "/webhooks", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "OUTBOUND_ACTIONS_ENABLED")
+}
+
+func TestHandlers_Webhooks_CRUD(t *testing.T) {
+	r, _, _ := setupWebhooksTest(t, true)
+
+	// Invalid definitions are rejected
+	invalid := []models.WebhookRequest{
+		{URL: "https://hooks.example.com", Events: []string{"host.unknown"}},
+		{URL: "https://hooks.example.com"},
+		{URL: "ftp://hooks.example.com", Events: []string{models.WebhookEventHostIngested}},
+		{URL: "/relative", Events: []string{models.WebhookEventHostIngested}},
+		{URL: "http://localhost:9000/hooks", Events: []string{models.WebhookEventHostIngested}},
+		{URL: "http://169.254.169.254/latest/meta-data", Events: []string{models.WebhookEventHostIngested}},
+		{URL: "http://[::1]/hooks", Events: []string{models.WebhookEventHostIngested}},
+	}
+	for _, req := range invalid {
+		w := doProbeRequest(r, http.MethodPost, "/webhooks", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	w := doProbeRequest(r, http.MethodPost, "/webhooks", models.WebhookRequest{
+		URL:    "https://hooks.example.com/snailbus",
+		Events: []string{models.WebhookEventHostIngested, models.WebhookEventHostStale, models.WebhookEventHostIngested},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.WebhookSecretResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.True(t, created.Enabled)
+	assert.Equal(t, []string{models.WebhookEventHostIngested, models.WebhookEventHostStale}, created.Events)
+	assert.True(t, strings.HasPrefix(created.SigningSecret, "sbws_"))
+
+	// The signing secret is only returned on creation
+	w = doProbeRequest(r, http.MethodGet, "/webhooks/"+created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "signing_secret")
+
+	disabled := false
+	w = doProbeRequest(r, http.MethodPut, "/webhooks/"+created.ID, models.WebhookRequest{
+		URL:     "https://hooks.example.com/v2",
+		Events:  []string{models.WebhookEventHostDeleted},
+		Enabled: &disabled,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "https://hooks.example.com/v2", updated.URL)
+	assert.Equal(t, []string{models.WebhookEventHostDeleted}, updated.Events)
+	assert.False(t, updated.Enabled)
+
+	w = doProbeRequest(r, http.MethodGet, "/webhooks", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+
+	w = doProbeRequest(r, http.MethodPut, "/webhooks/missing", models.WebhookRequest{
+		URL:    "https://hooks.example.com",
+		Events: []string{models.WebhookEventHostDeleted},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doProbeRequest(r, http.MethodDelete, "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doProbeRequest(r, http.MethodGet, "/webhooks/"+created.ID+"/deliveries", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlers_Webhooks_FiredByIngestAndDelete(t *testing.T) {
+	r, _, _ := setupWebhooksTest(t, true)
+
+	w := doProbeRequest(r, http.MethodPost, "/webhooks", models.WebhookRequest{
+		URL:    "https://hooks.example.com/snailbus",
+		Events: []string{models.WebhookEventHostIngested, models.WebhookEventHostDeleted},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var webhook models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+
+	w = doProbeRequest(r, http.MethodPost, "/ingest", models.IngestRequest{
+		Meta: models.ReportMeta{HostID: probeHostUp, Hostname: "web-1", CollectionID: "collection-1"},
+		Data: json.RawMessage(`{}`),
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = doProbeRequest(r, http.MethodDelete, "/hosts/"+probeHostUp+"?reason=decommissioned", nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	w = doProbeRequest(r, http.MethodGet, "/webhooks/"+webhook.ID+"/deliveries", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+		Total      int                      `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Equal(t, 2, page.Total)
+
+	deleted, ingested := page.Deliveries[0], page.Deliveries[1]
+	assert.Equal(t, models.WebhookDeliveryPending, ingested.Status)
+	assert.Equal(t, models.WebhookEventHostIngested, ingested.Event.Type)
+	assert.Equal(t, probeHostUp, ingested.Event.HostID)
+	assert.Equal(t, "web-1", ingested.Event.Hostname)
+	assert.Equal(t, "collection-1", ingested.Event.CollectionID)
+	assert.NotNil(t, ingested.Event.LastSeen)
+
+	assert.Equal(t, models.WebhookEventHostDeleted, deleted.Event.Type)
+	assert.Equal(t, probeHostUp, deleted.Event.HostID)
+	assert.Equal(t, "web-1", deleted.Event.Hostname)
+	require.NotNil(t, deleted.Event.Deletion)
+	assert.Equal(t, models.HostDeletionDecommissioned, deleted.Event.Deletion.Reason)
+
+	w = doProbeRequest(r, http.MethodGet, "/webhooks/"+webhook.ID+"/deliveries?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,121 @@
+// Package hostlimit rate limits ingest per host, so that one misconfigured agent
+// reporting in a tight loop cannot take an organization's share of ingest.
+//
+// Reports are counted per organization and host ID against a default rate, such as
+// "10-M" for ten reports a minute. Overrides give individual hosts another rate, or
+// exempt them with "off". Rejections are exported per host as the
+// ingest_host_rate_limited_total metric, so the noisiest hosts can be found.
+package hostlimit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+
+	"snailbus/internal/metrics"
+)
+
+// Off disables the limit, as the default rate or as a host's override
+const Off = "off"
+
+// Result is the outcome of counting a report against its host's limit
+type Result struct {
+	Allowed   bool
+	Limit     int64         // Reports allowed per period; 0 for exempt hosts
+	Remaining int64         // Reports left in the current period
+	Period    time.Duration // Period the limit counts reports over
+	Reset     time.Time     // When the current period ends
+}
+
+// Limiter counts reports per host
+type Limiter struct {
+	store       limiter.Store
+	defaultRate *limiter.Rate // nil when hosts without an override are not limited
+	overrides   map[string]*limiter.Rate
+}
+
+// New creates a limiter with a default rate and per-host-ID overrides, in the
+// format of ParseRate
+func New(defaultRate string, overrides map[string]string) (*Limiter, error) {
+	rate, err := ParseRate(defaultRate)
+	if err != nil {
+		return nil, err
+	}
+	l := &Limiter{
+		store:       memory.NewStore(),
+		defaultRate: rate,
+		overrides:   make(map[string]*limiter.Rate, len(overrides)),
+	}
+	for hostID, value := range overrides {
+		if l.overrides[hostID], err = ParseRate(value); err != nil {
+			return nil, fmt.Errorf("host %s: %w", hostID, err)
+		}
+	}
+	return l, nil
+}
+
+// Allow counts a report from a host and reports whether it is within the host's limit
+func (l *Limiter) Allow(ctx context.Context, orgID, hostID string) (Result, error) {
+	rate, ok := l.overrides[hostID]
+	if !ok {
+		rate = l.defaultRate
+	}
+	if rate == nil {
+		return Result{Allowed: true}, nil
+	}
+
+	lctx, err := l.store.Get(ctx, orgID+"/"+hostID, *rate)
+	if err != nil {
+		return Result{}, err
+	}
+	if lctx.Reached {
+		metrics.IngestHostRateLimitedTotal.WithLabelValues(orgID, hostID).Inc()
+	}
+	return Result{
+		Allowed:   !lctx.Reached,
+		Limit:     lctx.Limit,
+		Remaining: lctx.Remaining,
+		Period:    rate.Period,
+		Reset:     time.Unix(lctx.Reset, 0),
+	}, nil
+}
+
+// ParseRate parses a rate such as "10-M" (S, M, H, or D periods), or Off for no limit (nil)
+func ParseRate(value string) (*limiter.Rate, error) {
+	if strings.EqualFold(strings.TrimSpace(value), Off) {
+		return nil, nil
+	}
+	rate, err := limiter.NewRateFromFormatted(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate %q (e.g., '10-M' or 'off'): %w", value, err)
+	}
+	if rate.Limit < 1 {
+		return nil, fmt.Errorf("invalid rate %q: the limit must be positive, or 'off'", value)
+	}
+	return &rate, nil
+}
+
+// ParseOverrides parses a comma-separated list of host_id=rate overrides
+func ParseOverrides(value string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		hostID, rate, ok := strings.Cut(entry, "=")
+		hostID = strings.TrimSpace(hostID)
+		if !ok || hostID == "" {
+			return nil, fmt.Errorf("override %q must be host_id=rate", entry)
+		}
+		if _, err := ParseRate(rate); err != nil {
+			return nil, fmt.Errorf("host %s: %w", hostID, err)
+		}
+		overrides[hostID] = strings.TrimSpace(rate)
+	}
+	return overrides, nil
+}
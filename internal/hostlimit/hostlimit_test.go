@@ -0,0 +1,84 @@
+package hostlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l, err := New("2-M", map[string]string{"busy": "4-M", "exempt": "off"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	count := func(orgID, hostID string, n int) (allowed int, last Result) {
+		for i := 0; i < n; i++ {
+			result, err := l.Allow(ctx, orgID, hostID)
+			require.NoError(t, err)
+			if result.Allowed {
+				allowed++
+			}
+			last = result
+		}
+		return allowed, last
+	}
+
+	allowed, last := count("org-1", "host-1", 3)
+	assert.Equal(t, 2, allowed)
+	assert.False(t, last.Allowed)
+	assert.Equal(t, int64(2), last.Limit)
+	assert.Equal(t, time.Minute, last.Period)
+	assert.True(t, last.Reset.After(time.Now()))
+
+	// Hosts are counted per organization
+	allowed, _ = count("org-2", "host-1", 2)
+	assert.Equal(t, 2, allowed)
+
+	allowed, _ = count("org-1", "busy", 5)
+	assert.Equal(t, 4, allowed, "an override replaces the default rate")
+	allowed, last = count("org-1", "exempt", 10)
+	assert.Equal(t, 10, allowed)
+	assert.Zero(t, last.Limit)
+
+	// With the default off only overridden hosts are limited
+	l, err = New("off", map[string]string{"busy": "1-H"})
+	require.NoError(t, err)
+	allowed, _ = count("org-1", "host-1", 5)
+	assert.Equal(t, 5, allowed)
+	allowed, _ = count("org-1", "busy", 2)
+	assert.Equal(t, 1, allowed)
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("10-m")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rate.Limit)
+	assert.Equal(t, time.Minute, rate.Period)
+
+	rate, err = ParseRate("OFF")
+	require.NoError(t, err)
+	assert.Nil(t, rate)
+
+	for _, invalid := range []string{"", "10", "10-W", "0-M", "-1-M", "ten-M"} {
+		_, err := ParseRate(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	overrides, err := ParseOverrides(" host-a = 60-M, host-b=off ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host-a": "60-M", "host-b": "off"}, overrides)
+
+	overrides, err = ParseOverrides("")
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	for _, invalid := range []string{"host-a", "=10-M", "host-a=fast"} {
+		_, err := ParseOverrides(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
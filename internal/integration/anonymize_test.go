@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/anonymize"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+	"snailbus/internal/testutils"
+)
+
+// TestAnonymize_PartitionedHostReports checks that each report in the history is scrubbed
+// with its own values. ctids repeat across the monthly partitions of host_reports, so the
+// first report of each month has the same ctid.
+func TestAnonymize_PartitionedHostReports(t *testing.T) {
+	db, cleanup, err := testutils.SetupTestDB(t)
+	require.NoError(t, err)
+	defer cleanup()
+	store, err := storage.NewPostgresStorage(testutils.GetTestDatabaseURL())
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Months long past, so the test only touches partitions of its own
+	march := time.Date(2001, time.March, 1, 0, 0, 0, 0, time.UTC)
+	_, err = store.DropHostReportPartitions(march.AddDate(0, 3, 0))
+	require.NoError(t, err)
+	defer store.DropHostReportPartitions(march.AddDate(0, 3, 0))
+	_, err = store.EnsureHostReportPartitions(march, march.AddDate(0, 1, 0))
+	require.NoError(t, err)
+
+	org, user, _, err := testutils.CreateTestOrganizationWithUser(store, "Anonymize Org", "anonymize", "anonymize@example.com", "password123", "admin")
+	require.NoError(t, err)
+
+	hostID := "00000000-0000-0000-0000-000000000a01"
+	reports := map[string]string{} // Report ID to the hostname it was collected under
+	for i, hostname := range []string{"march.example.com", "april.example.com"} {
+		report := testutils.CreateTestReport(hostID, hostname, org.ID, user.ID)
+		report.Data = json.RawMessage(`{"system": {"hostname": "` + hostname + `"}}`)
+		require.NoError(t, store.SaveHost(report, org.ID, user.ID))
+
+		history := models.NewHostReport(fmt.Sprintf("00000000-0000-0000-0000-000000000b%02d", i), report, user.ID)
+		history.ReceivedAt = march.AddDate(0, i, 1)
+		require.NoError(t, store.SaveHostReport(history, org.ID, 10))
+		reports[history.ID] = hostname
+	}
+
+	key := []byte("test-pseudonym-key")
+	_, err = anonymize.Anonymize(context.Background(), db, anonymize.Options{Key: key})
+	require.NoError(t, err)
+
+	p := anonymize.NewPseudonymizer(key)
+	for id, hostname := range reports {
+		var scrubbedHostname, data string
+		require.NoError(t, db.QueryRow(`SELECT hostname, data::text FROM host_reports WHERE id = $1`, id).Scan(&scrubbedHostname, &data))
+		assert.Equal(t, p.Hostname(hostname), scrubbedHostname, "report %s", id)
+		assert.JSONEq(t, `{"system": {"hostname": "`+p.Hostname(hostname)+`"}}`, data, "report %s", id)
+	}
+}
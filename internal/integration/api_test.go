@@ -26,11 +26,13 @@ import (
 func setupTestRouter(store storage.Storage) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	r.Use(middleware.Recovery(nil))
 
 	h := handlers.New(store)
 
 	// Health check endpoint
 	r.GET("/health", h.Health)
+	r.GET("/readyz", h.Ready)
 
 	// Root endpoint
 	r.GET("/", func(c *gin.Context) {
@@ -51,10 +53,17 @@ func setupTestRouter(store storage.Storage) *gin.Engine {
 			auth.POST("/api-key", h.GetAPIKeyFromCredentials)
 		}
 
+		// OAuth token endpoints for third-party clients (client credentials, no user authentication)
+		oauth := v1.Group("/oauth")
+		{
+			oauth.POST("/token", h.OAuthToken)
+			oauth.POST("/revoke", h.RevokeOAuthToken)
+		}
+
 		// Protected routes (require API key authentication)
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware(store))
-		protected.Use(middleware.OrgContextMiddleware())
+		protected.Use(middleware.OrgContextMiddleware(store))
 		{
 			// Auth endpoints
 			protected.GET("/auth/me", h.GetMe)
@@ -63,16 +72,47 @@ func setupTestRouter(store storage.Storage) *gin.Engine {
 			protected.POST("/api-keys", h.CreateAPIKey)
 			protected.GET("/api-keys", h.ListAPIKeys)
 			protected.DELETE("/api-keys/:id", h.DeleteAPIKey)
+			protected.PUT("/api-keys/:id/endpoints", h.UpdateAPIKeyEndpoints)
 
 			// Host management endpoints - viewing accessible to all authenticated users
 			protected.GET("/hosts", h.ListHosts)
 			protected.GET("/hosts/:host_id", h.GetHost)
+			protected.GET("/hosts/:host_id/events", h.GetHostEvents)
+			protected.GET("/hosts/:host_id/services", h.GetHostServices)
+			protected.GET("/events", h.ListHostEvents)
+			protected.GET("/events/stream", h.StreamHostEvents)
+			protected.GET("/accounts", h.ListAccounts)
+			protected.GET("/services", h.ListServices)
+			protected.GET("/checkins", h.ListCheckins)
+
+			// Delegated tokens - users authorize and revoke third-party integrations
+			protected.POST("/oauth/authorize", h.AuthorizeOAuthClient)
+			protected.GET("/oauth/grants", h.ListOAuthGrants)
+			protected.DELETE("/oauth/grants/:id", h.DeleteOAuthGrant)
+
+			// Fleet statistics
+			protected.GET("/stats/compare", h.CompareFleet)
+
+			// Feature flags in effect for the caller's organization
+			protected.GET("/orgs/current/flags", h.GetOrgFeatureFlags)
+
+			// Ingest receipt verification
+			protected.GET("/receipts/:id/verify", h.VerifyReceipt)
+
+			// Host probe job results
+			protected.GET("/probes/:id", h.GetProbeJob)
 
-			// Host deletion - requires editor or admin role
+			// Host deletion and probe results - requires editor or admin role
 			editorOrAdmin := protected.Group("")
 			editorOrAdmin.Use(middleware.RequireRole("editor", "admin"))
 			{
 				editorOrAdmin.DELETE("/hosts/:host_id", h.DeleteHost)
+				editorOrAdmin.PATCH("/hosts/:host_id", h.UpdateHost)
+				editorOrAdmin.POST("/hosts/:host_id/restore", h.RestoreHost)
+				editorOrAdmin.POST("/hosts/:host_id/archive", h.ArchiveHost)
+				editorOrAdmin.POST("/hosts/:host_id/unarchive", h.UnarchiveHost)
+				editorOrAdmin.POST("/probes/claim", h.ClaimProbeJob)
+				editorOrAdmin.POST("/probes/:id/results", h.SubmitProbeResults)
 			}
 
 			// User management endpoints - admin only
@@ -80,16 +120,48 @@ func setupTestRouter(store storage.Storage) *gin.Engine {
 			adminOnly.Use(middleware.RequireRole("admin"))
 			{
 				adminOnly.GET("/users", h.ListUsers)
+				adminOnly.POST("/probes", h.CreateProbeJob)
+				adminOnly.GET("/orgs/current/usage", h.GetOrgUsage)
+				adminOnly.GET("/orgs/current/remote-write", h.GetRemoteWrite)
+				adminOnly.PUT("/orgs/current/remote-write", h.SetRemoteWrite)
+				adminOnly.DELETE("/orgs/current/remote-write", h.DeleteRemoteWrite)
+				adminOnly.GET("/orgs/current/ingest-filter", h.GetIngestFilter)
+				adminOnly.PUT("/orgs/current/ingest-filter", h.SetIngestFilter)
+				adminOnly.DELETE("/orgs/current/ingest-filter", h.DeleteIngestFilter)
+				adminOnly.GET("/orgs/current/checkin-schedule", h.GetCheckinSchedule)
+				adminOnly.PUT("/orgs/current/checkin-schedule", h.SetCheckinSchedule)
+				adminOnly.DELETE("/orgs/current/checkin-schedule", h.DeleteCheckinSchedule)
+				adminOnly.POST("/reports", h.GenerateReport)
+				adminOnly.GET("/reports", h.ListReports)
+				adminOnly.GET("/reports/:id", h.GetReport)
+				adminOnly.GET("/orgs/current/report-schedule", h.GetReportSchedule)
+				adminOnly.PUT("/orgs/current/report-schedule", h.SetReportSchedule)
+				adminOnly.DELETE("/orgs/current/report-schedule", h.DeleteReportSchedule)
 				adminOnly.POST("/users", h.CreateUser)
 				adminOnly.PUT("/users/:user_id/role", h.UpdateUserRole)
+				adminOnly.POST("/events/replay", h.ReplayHostEvents)
 				adminOnly.DELETE("/users/:user_id", h.DeleteUser)
+				adminOnly.GET("/actions", h.ListActions)
+				adminOnly.POST("/actions", h.CreateAction)
+				adminOnly.GET("/actions/:id", h.GetAction)
+				adminOnly.PUT("/actions/:id", h.UpdateAction)
+				adminOnly.DELETE("/actions/:id", h.DeleteAction)
+				adminOnly.POST("/actions/:id/signing-secret/rotate", h.RotateActionSecret)
+				adminOnly.GET("/actions/:id/runs", h.ListActionRuns)
+				adminOnly.POST("/actions/:id/runs/:run_id/retry", h.RetryActionRun)
+				adminOnly.GET("/secrets", h.ListOrgSecrets)
+				adminOnly.PUT("/secrets/:name", h.SetOrgSecret)
+				adminOnly.DELETE("/secrets/:name", h.DeleteOrgSecret)
+				adminOnly.GET("/oauth/clients", h.ListOAuthClients)
+				adminOnly.POST("/oauth/clients", h.CreateOAuthClient)
+				adminOnly.DELETE("/oauth/clients/:id", h.DeleteOAuthClient)
 			}
 		}
 
 		// Ingest endpoint - requires editor or admin role
 		ingest := v1.Group("")
 		ingest.Use(middleware.AuthMiddleware(store))
-		ingest.Use(middleware.OrgContextMiddleware())
+		ingest.Use(middleware.OrgContextMiddleware(store))
 		ingest.Use(middleware.RequireRole("editor", "admin"))
 		{
 			ingest.POST("/ingest", h.Ingest)
@@ -249,6 +321,20 @@ func TestIntegration_APIKeyCreationAndUsage(t *testing.T) {
 	require.NoError(t, err)
 	assert.GreaterOrEqual(t, keysResp["total"].(float64), float64(2)) // At least 2 keys (login + new one)
 
+	// Restrict the key to ingest only
+	w = client.doRequest(http.MethodPut, "/api/v1/api-keys/"+keyResp.ID+"/endpoints", models.UpdateAPIKeyEndpointsRequest{
+		AllowedEndpoints: []string{"POST /api/v1/ingest"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = newClient.doRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Invalid patterns are rejected
+	w = client.doRequest(http.MethodPut, "/api/v1/api-keys/"+keyResp.ID+"/endpoints", models.UpdateAPIKeyEndpointsRequest{
+		AllowedEndpoints: []string{"api/v1/ingest"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
 	// Delete the API key
 	w = client.doRequest(http.MethodDelete, "/api/v1/api-keys/"+keyResp.ID, nil)
 	assert.Equal(t, http.StatusNoContent, w.Code)
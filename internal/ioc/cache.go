@@ -0,0 +1,63 @@
+package ioc
+
+import (
+	"sync"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+// DefaultTTL is how long an organization's matcher is cached
+// Lists changed through another server instance take up to the TTL to apply there.
+const DefaultTTL = 30 * time.Second
+
+// Store loads an organization's IOC lists
+type Store interface {
+	// GetIOCIndicators returns every list of the organization with its indicators
+	GetIOCIndicators(orgID string) ([]*models.IOCList, error)
+}
+
+// Cache builds a matcher per organization and keeps it for a TTL
+type Cache struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu       sync.Mutex
+	matchers map[string]cachedMatcher
+}
+
+type cachedMatcher struct {
+	matcher  *Matcher
+	loadedAt time.Time
+}
+
+// NewCache creates a cache that keeps matchers for ttl (0 disables caching)
+func NewCache(store Store, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl, now: time.Now, matchers: make(map[string]cachedMatcher)}
+}
+
+// Matcher returns the organization's matcher, reloading its lists once the TTL has passed
+func (c *Cache) Matcher(orgID string) (*Matcher, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if cached, ok := c.matchers[orgID]; ok && now.Sub(cached.loadedAt) < c.ttl {
+		return cached.matcher, nil
+	}
+	lists, err := c.store.GetIOCIndicators(orgID)
+	if err != nil {
+		return nil, err
+	}
+	matcher := NewMatcher(lists)
+	c.matchers[orgID] = cachedMatcher{matcher: matcher, loadedAt: now}
+	return matcher, nil
+}
+
+// Invalidate drops the organization's matcher, e.g. after one of its lists changed
+func (c *Cache) Invalidate(orgID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.matchers, orgID)
+}
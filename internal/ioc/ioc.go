@@ -0,0 +1,178 @@
+// Package ioc matches ingested reports against an organization's lists of indicators
+// of compromise (IOCs).
+//
+// Lists are uploaded as CSV or as STIX 2.1 bundles and hold file hashes (MD5, SHA-1,
+// SHA-256), process names, and file names. A Matcher walks a report's data for them:
+// any string that is a hex hash is compared with the hashes, values under keys that
+// name a process (process, comm, or name inside processes) with the process names,
+// and values under keys that name a file (path, file, exe) with the file names.
+// Agents only report hashes and processes where they are configured to collect
+// them; a report without them never matches.
+package ioc
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// MaxMatches is the most matches reported for one report
+const MaxMatches = 100
+
+// Keys whose string values are matched as process or file names, lowercased
+var (
+	processKeys = map[string]bool{"process": true, "process_name": true, "comm": true, "program": true}
+	fileKeys    = map[string]bool{"path": true, "file": true, "filename": true, "file_name": true, "file_path": true}
+	// Executables are matched as both: /usr/bin/xmrig matches process xmrig and file xmrig
+	executableKeys = map[string]bool{"exe": true, "executable": true, "binary": true, "image": true}
+)
+
+// entry is an indicator and the list it came from
+type entry struct {
+	list      *models.IOCList
+	indicator models.IOCIndicator
+}
+
+// Matcher finds an organization's indicators in report data
+type Matcher struct {
+	hashes    map[string][]entry // Lowercase hex, across hash types
+	processes map[string][]entry
+	files     map[string][]entry // Base names and absolute paths
+}
+
+// NewMatcher creates a matcher for the indicators of lists
+func NewMatcher(lists []*models.IOCList) *Matcher {
+	m := &Matcher{
+		hashes:    make(map[string][]entry),
+		processes: make(map[string][]entry),
+		files:     make(map[string][]entry),
+	}
+	for _, list := range lists {
+		for _, indicator := range list.Indicators {
+			e := entry{list: list, indicator: indicator}
+			switch indicator.Type {
+			case models.IOCTypeProcessName:
+				m.processes[indicator.Value] = append(m.processes[indicator.Value], e)
+			case models.IOCTypeFileName:
+				m.files[indicator.Value] = append(m.files[indicator.Value], e)
+			default:
+				m.hashes[indicator.Value] = append(m.hashes[indicator.Value], e)
+			}
+		}
+	}
+	return m
+}
+
+// Empty reports whether the matcher has no indicators, so reports need not be walked
+func (m *Matcher) Empty() bool {
+	return len(m.hashes) == 0 && len(m.processes) == 0 && len(m.files) == 0
+}
+
+// Match returns the indicators found in report data, each once with the first path it
+// was found at; object keys are visited in sorted order. Data that is not valid JSON
+// matches nothing.
+func (m *Matcher) Match(data json.RawMessage) []models.IOCMatch {
+	if m.Empty() || len(data) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil
+	}
+
+	w := &walker{matcher: m, seen: make(map[string]bool)}
+	w.walk("", "", false, document)
+	return w.matches
+}
+
+// walker collects the matches of one report
+type walker struct {
+	matcher *Matcher
+	matches []models.IOCMatch
+	seen    map[string]bool // List ID, type, and value of matches found
+}
+
+// walk visits a value found at path under key; inProcess is set below keys naming processes
+func (w *walker) walk(at, key string, inProcess bool, value interface{}) {
+	if len(w.matches) == MaxMatches {
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		w.matchString(at, strings.ToLower(key), inProcess, v)
+	case []interface{}:
+		for i, item := range v {
+			w.walk(at+"["+strconv.Itoa(i)+"]", key, inProcess, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if at != "" {
+				child = at + "." + k
+			}
+			lower := strings.ToLower(k)
+			w.walk(child, k, inProcess || strings.Contains(lower, "process"), v[k])
+		}
+	}
+}
+
+// matchString compares a string value with the indicators its key says it may hold
+func (w *walker) matchString(at, key string, inProcess bool, value string) {
+	m := w.matcher
+	if _, ok := hashTypes[len(value)]; ok && isHex(value) {
+		w.add(at, m.hashes[strings.ToLower(value)])
+	}
+
+	switch {
+	case processKeys[key] || (inProcess && key == "name"):
+		w.add(at, m.processes[value])
+	case executableKeys[key]:
+		w.add(at, m.processes[path.Base(value)])
+		w.matchFile(at, value)
+	case fileKeys[key]:
+		w.matchFile(at, value)
+	}
+}
+
+// matchFile compares a file path or name with the file names, by base name and by path
+func (w *walker) matchFile(at, value string) {
+	m := w.matcher
+	base := path.Base(value)
+	w.add(at, m.files[base])
+	if path.IsAbs(value) {
+		if clean := path.Clean(value); clean != base {
+			w.add(at, m.files[clean])
+		}
+	}
+}
+
+// add records the indicators found at path
+func (w *walker) add(at string, entries []entry) {
+	for _, e := range entries {
+		key := e.list.ID + "\x00" + e.indicator.Type + "\x00" + e.indicator.Value
+		if w.seen[key] || len(w.matches) == MaxMatches {
+			continue
+		}
+		w.seen[key] = true
+		w.matches = append(w.matches, models.IOCMatch{
+			ListID:      e.list.ID,
+			ListName:    e.list.Name,
+			Type:        e.indicator.Type,
+			Value:       e.indicator.Value,
+			Description: e.indicator.Description,
+			Path:        at,
+		})
+	}
+}
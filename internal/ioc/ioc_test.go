@@ -0,0 +1,154 @@
+package ioc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+const (
+	md5Hash    = "44d88612fea8a8f36de82e1278abb02f"
+	sha256Hash = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := "type,value,description\n" +
+		"# comment\n" +
+		"SHA-256," + strings.ToUpper(sha256Hash) + ",EICAR\n" +
+		"," + md5Hash + "\n" +
+		"process,xmrig,miner\n" +
+		"file_name,/tmp/.x/kworker\n" +
+		"sha256," + sha256Hash + ",duplicate\n"
+
+	indicators, err := ParseCSV(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []models.IOCIndicator{
+		{Type: models.IOCTypeSHA256, Value: sha256Hash, Description: "EICAR"},
+		{Type: models.IOCTypeMD5, Value: md5Hash},
+		{Type: models.IOCTypeProcessName, Value: "xmrig", Description: "miner"},
+		{Type: models.IOCTypeFileName, Value: "/tmp/.x/kworker"},
+	}, indicators)
+
+	for _, invalid := range []string{
+		"sha256,abc\n",
+		"md5," + sha256Hash + "\n",
+		"registry_key,HKLM\n",
+		"process,/usr/bin/xmrig\n",
+		"file_name,tmp/x\n",
+		"md5\n",
+		",not-a-hash\n",
+	} {
+		_, err := ParseCSV(strings.NewReader(invalid))
+		assert.True(t, errors.Is(err, ErrInvalid), "%q: %v", invalid, err)
+	}
+}
+
+func TestParseSTIX(t *testing.T) {
+	input := `{"type": "bundle", "id": "bundle--1", "objects": [
+		{"type": "indicator", "name": "EICAR", "pattern_type": "stix",
+		 "pattern": "[file:hashes.'SHA-256' = '` + sha256Hash + `'] OR [file:hashes.MD5 = '` + md5Hash + `']"},
+		{"type": "indicator", "description": "Miner", "pattern": "[process:name = 'xmrig' AND process:pid > 1]"},
+		{"type": "indicator", "name": "Dropper", "pattern": "[file:name = 'it\\'s.sh']"},
+		{"type": "indicator", "name": "Domain", "pattern": "[domain-name:value = 'evil.example']"},
+		{"type": "indicator", "name": "SHA-512", "pattern": "[file:hashes.'SHA-512' = 'abcd']"},
+		{"type": "indicator", "name": "Sigma", "pattern_type": "sigma", "pattern": "title: x"},
+		{"type": "malware", "name": "Not an indicator"}
+	]}`
+
+	indicators, skipped, err := ParseSTIX(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []models.IOCIndicator{
+		{Type: models.IOCTypeSHA256, Value: sha256Hash, Description: "EICAR"},
+		{Type: models.IOCTypeMD5, Value: md5Hash, Description: "EICAR"},
+		{Type: models.IOCTypeProcessName, Value: "xmrig", Description: "Miner"},
+		{Type: models.IOCTypeFileName, Value: "it's.sh", Description: "Dropper"},
+	}, indicators)
+	assert.Equal(t, 3, skipped)
+
+	_, _, err = ParseSTIX(strings.NewReader(`{"type": "indicator"}`))
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, _, err = Parse("yaml", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestMatcher_Match(t *testing.T) {
+	lists := []*models.IOCList{
+		{ID: "list-1", Name: "Malware", Indicators: []models.IOCIndicator{
+			{Type: models.IOCTypeSHA256, Value: sha256Hash, Description: "EICAR"},
+			{Type: models.IOCTypeProcessName, Value: "xmrig"},
+			{Type: models.IOCTypeFileName, Value: "/tmp/.x/kworker"},
+		}},
+		{ID: "list-2", Name: "Tools", Indicators: []models.IOCIndicator{
+			{Type: models.IOCTypeFileName, Value: "nc.traditional"},
+			{Type: models.IOCTypeProcessName, Value: "xmrig"},
+		}},
+	}
+	m := NewMatcher(lists)
+	require.False(t, m.Empty())
+
+	matches := m.Match([]byte(`{
+		"processes": [
+			{"name": "sshd", "exe": "/usr/sbin/sshd"},
+			{"name": "xmrig", "exe": "/tmp/.x/kworker", "sha256": "` + strings.ToUpper(sha256Hash) + `"}
+		],
+		"files": [{"path": "/usr/bin/nc.traditional"}],
+		"name": "xmrig",
+		"packages": [{"name": "nc.traditional"}]
+	}`))
+	require.Len(t, matches, 5)
+	assert.Equal(t, models.IOCMatch{
+		ListID: "list-2", ListName: "Tools", Type: models.IOCTypeFileName, Value: "nc.traditional", Path: "files[0].path",
+	}, matches[0])
+	assert.Equal(t, "processes[1].exe", matches[1].Path)
+	assert.Equal(t, "/tmp/.x/kworker", matches[1].Value)
+	assert.Equal(t, "processes[1].name", matches[2].Path)
+	assert.Equal(t, "list-1", matches[2].ListID)
+	assert.Equal(t, "list-2", matches[3].ListID, "each list's indicator is a match of its own")
+	assert.Equal(t, models.IOCMatch{
+		ListID: "list-1", ListName: "Malware", Type: models.IOCTypeSHA256, Value: sha256Hash, Description: "EICAR", Path: "processes[1].sha256",
+	}, matches[4])
+
+	assert.Empty(t, m.Match([]byte(`{"processes": [{"name": "sshd"}]}`)))
+	assert.Empty(t, m.Match([]byte(`{`)))
+	assert.Empty(t, NewMatcher(nil).Match([]byte(`{"name": "xmrig"}`)))
+}
+
+type fakeStore struct {
+	lists []*models.IOCList
+	loads int
+}
+
+func (s *fakeStore) GetIOCIndicators(orgID string) ([]*models.IOCList, error) {
+	s.loads++
+	return s.lists, nil
+}
+
+func TestCache(t *testing.T) {
+	store := &fakeStore{}
+	cache := NewCache(store, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	m, err := cache.Matcher("org-1")
+	require.NoError(t, err)
+	assert.True(t, m.Empty())
+
+	store.lists = []*models.IOCList{{ID: "list-1", Indicators: []models.IOCIndicator{{Type: models.IOCTypeProcessName, Value: "xmrig"}}}}
+	m, _ = cache.Matcher("org-1")
+	assert.True(t, m.Empty(), "cached until the TTL passes")
+	assert.Equal(t, 1, store.loads)
+
+	cache.Invalidate("org-1")
+	m, _ = cache.Matcher("org-1")
+	assert.False(t, m.Empty())
+
+	now = now.Add(2 * time.Minute)
+	_, _ = cache.Matcher("org-1")
+	assert.Equal(t, 3, store.loads)
+}
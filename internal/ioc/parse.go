@@ -0,0 +1,242 @@
+package ioc
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// MaxIndicators is the most indicators a list may hold
+const MaxIndicators = 100000
+
+// ErrInvalid is returned for lists that cannot be parsed; the wrapping error says why
+var ErrInvalid = errors.New("invalid IOC list")
+
+// typeAliases maps the type names accepted in CSV files to indicator types
+var typeAliases = map[string]string{
+	"md5":          models.IOCTypeMD5,
+	"sha1":         models.IOCTypeSHA1,
+	"sha-1":        models.IOCTypeSHA1,
+	"sha256":       models.IOCTypeSHA256,
+	"sha-256":      models.IOCTypeSHA256,
+	"process":      models.IOCTypeProcessName,
+	"process_name": models.IOCTypeProcessName,
+	"file":         models.IOCTypeFileName,
+	"filename":     models.IOCTypeFileName,
+	"file_name":    models.IOCTypeFileName,
+}
+
+// hashTypes maps the length of a hex hash to its indicator type
+var hashTypes = map[int]string{
+	32: models.IOCTypeMD5,
+	40: models.IOCTypeSHA1,
+	64: models.IOCTypeSHA256,
+}
+
+// Parse reads a list in the given format and returns its indicators, with the number
+// of STIX indicators skipped because none of their comparisons are supported
+func Parse(format string, r io.Reader) ([]models.IOCIndicator, int, error) {
+	switch format {
+	case models.IOCFormatCSV:
+		indicators, err := ParseCSV(r)
+		return indicators, 0, err
+	case models.IOCFormatSTIX:
+		return ParseSTIX(r)
+	}
+	return nil, 0, fmt.Errorf("%w: unknown format %q (csv or stix)", ErrInvalid, format)
+}
+
+// ParseCSV reads indicators from CSV rows of type,value and an optional description
+// A first row starting with "type" is a header, and lines starting with # are comments.
+// An empty type is inferred from the length of a hex hash.
+func ParseCSV(r io.Reader) ([]models.IOCIndicator, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	set := newIndicatorSet()
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "type") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%w: line %d: want type,value[,description]", ErrInvalid, line)
+		}
+		indicator := models.IOCIndicator{Type: record[0], Value: record[1]}
+		if len(record) > 2 {
+			indicator.Description = strings.TrimSpace(record[2])
+		}
+		if err := set.add(indicator); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalid, line, err)
+		}
+	}
+	return set.indicators, nil
+}
+
+// stixComparison finds the comparisons of a STIX pattern that can be matched: equality
+// of a file hash, file name, or process name with a string
+var stixComparison = regexp.MustCompile(
+	`(file:hashes\.(?:'([^']+)'|([A-Za-z0-9-]+))|file:name|process:name|process:image_ref\.name)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// ParseSTIX reads the indicator objects of a STIX 2.1 bundle
+// Each supported comparison in an indicator's pattern becomes an indicator of its own, so
+// a pattern combining comparisons with AND matches more loosely than STIX specifies.
+// Indicators without a supported comparison are skipped and counted.
+func ParseSTIX(r io.Reader) ([]models.IOCIndicator, int, error) {
+	var bundle struct {
+		Type    string `json:"type"`
+		Objects []struct {
+			Type        string `json:"type"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Pattern     string `json:"pattern"`
+			PatternType string `json:"pattern_type"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if bundle.Type != "bundle" {
+		return nil, 0, fmt.Errorf("%w: not a STIX bundle", ErrInvalid)
+	}
+
+	set := newIndicatorSet()
+	skipped := 0
+	for _, object := range bundle.Objects {
+		if object.Type != "indicator" {
+			continue
+		}
+		if object.PatternType != "" && object.PatternType != "stix" {
+			skipped++
+			continue
+		}
+		description := object.Name
+		if description == "" {
+			description = object.Description
+		}
+
+		found := false
+		for _, m := range stixComparison.FindAllStringSubmatch(object.Pattern, -1) {
+			indicator := models.IOCIndicator{
+				Value:       strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(m[4]),
+				Description: description,
+			}
+			switch {
+			case m[1] == "file:name":
+				indicator.Type = models.IOCTypeFileName
+			case m[1] == "process:name", m[1] == "process:image_ref.name":
+				indicator.Type = models.IOCTypeProcessName
+			default:
+				algorithm := m[2] + m[3]
+				if indicator.Type = typeAliases[strings.ToLower(algorithm)]; !isHash(indicator.Type) {
+					continue // e.g. SHA-512 or SSDEEP
+				}
+			}
+			if err := set.add(indicator); err != nil {
+				return nil, 0, fmt.Errorf("%w: indicator %q: %w", ErrInvalid, description, err)
+			}
+			found = true
+		}
+		if !found {
+			skipped++
+		}
+	}
+	return set.indicators, skipped, nil
+}
+
+// indicatorSet collects normalized indicators, keeping the first of each type and value
+type indicatorSet struct {
+	indicators []models.IOCIndicator
+	seen       map[models.IOCIndicator]bool
+}
+
+func newIndicatorSet() *indicatorSet {
+	return &indicatorSet{indicators: []models.IOCIndicator{}, seen: make(map[models.IOCIndicator]bool)}
+}
+
+func (s *indicatorSet) add(indicator models.IOCIndicator) error {
+	indicator, err := Normalize(indicator)
+	if err != nil {
+		return err
+	}
+	key := models.IOCIndicator{Type: indicator.Type, Value: indicator.Value}
+	if s.seen[key] {
+		return nil
+	}
+	if len(s.indicators) == MaxIndicators {
+		return fmt.Errorf("more than %d indicators", MaxIndicators)
+	}
+	s.seen[key] = true
+	s.indicators = append(s.indicators, indicator)
+	return nil
+}
+
+// Normalize checks an indicator and returns it in the form it is stored and matched in:
+// a known type, and hashes in lowercase hex. An empty type is inferred from a hash's length.
+func Normalize(indicator models.IOCIndicator) (models.IOCIndicator, error) {
+	value := strings.TrimSpace(indicator.Value)
+	typ := strings.ToLower(strings.TrimSpace(indicator.Type))
+	if typ == "" && isHex(value) {
+		typ = hashTypes[len(value)]
+	}
+	if alias, ok := typeAliases[typ]; ok {
+		typ = alias
+	}
+
+	switch {
+	case value == "":
+		return indicator, errors.New("empty value")
+	case isHash(typ):
+		value = strings.ToLower(value)
+		if !isHex(value) || hashTypes[len(value)] != typ {
+			return indicator, fmt.Errorf("%q is not a %s hash", indicator.Value, typ)
+		}
+	case typ == models.IOCTypeProcessName:
+		if strings.Contains(value, "/") {
+			return indicator, fmt.Errorf("process name %q contains a slash", value)
+		}
+	case typ == models.IOCTypeFileName:
+		if strings.Contains(value, "/") {
+			if !path.IsAbs(value) {
+				return indicator, fmt.Errorf("file path %q is not absolute", value)
+			}
+			value = path.Clean(value)
+		}
+	default:
+		return indicator, fmt.Errorf("unknown type %q (md5, sha1, sha256, process_name, or file_name)", indicator.Type)
+	}
+
+	return models.IOCIndicator{Type: typ, Value: value, Description: indicator.Description}, nil
+}
+
+func isHash(typ string) bool {
+	return typ == models.IOCTypeMD5 || typ == models.IOCTypeSHA1 || typ == models.IOCTypeSHA256
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+// Package jobs runs the server's scheduled background jobs.
+//
+// Each job runs on its own interval. A run first takes the job's lock in the database
+// and is skipped if another replica holds it, so replicas do not duplicate work even
+// without LEADER_ELECTION. The last run of each job, by whichever replica ran it, is
+// recorded for GET /api/v1/admin/jobs.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Job is a task the scheduler runs every Interval
+type Job struct {
+	Name     string // Unique among jobs; names the job's lock and status
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs on their intervals, one replica at a time
+type Scheduler struct {
+	store  storage.Storage
+	runner string // This replica, recorded on the runs it starts
+	jobs   []Job
+	now    func() time.Time
+}
+
+// NewScheduler creates a scheduler recording its runs in store as runner
+func NewScheduler(store storage.Storage, runner string) *Scheduler {
+	return &Scheduler{
+		store:  store,
+		runner: runner,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Add schedules a job; jobs are added before Run
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Run runs every job each Interval until ctx is done, then waits for the runs in progress
+// The first runs come one interval after the start, not at it.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.schedule(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+// schedule runs a job every Interval until ctx is done
+func (s *Scheduler) schedule(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ran, err := s.RunOnce(ctx, job)
+			if err != nil {
+				logger.Logger.Error().Err(err).Str("job", job.Name).Msg("Background job failed")
+			} else if !ran {
+				logger.Logger.Debug().Str("job", job.Name).Msg("Background job is running on another replica; skipped")
+			}
+		}
+	}
+}
+
+// RunOnce runs the job now unless another replica is running it, and reports whether it
+// ran. The run is recorded in the job's status.
+func (s *Scheduler) RunOnce(ctx context.Context, job Job) (bool, error) {
+	unlock, locked, err := s.store.LockJob(ctx, job.Name)
+	if err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer unlock()
+
+	// The run goes ahead even if it cannot be recorded; the status is only informational
+	if err := s.store.StartJobRun(job.Name, s.runner, s.now()); err != nil {
+		logger.Logger.Error().Err(err).Str("job", job.Name).Msg("Failed to record background job start")
+	}
+	runErr := job.Run(ctx)
+	message := ""
+	if runErr != nil {
+		message = runErr.Error()
+	}
+	if err := s.store.FinishJobRun(job.Name, s.now(), message); err != nil {
+		logger.Logger.Error().Err(err).Str("job", job.Name).Msg("Failed to record background job finish")
+	}
+	return true, runErr
+}
+
+// Statuses returns the scheduled jobs with their last runs, by name
+func (s *Scheduler) Statuses() ([]*models.JobStatus, error) {
+	recorded, err := s.store.ListJobStatuses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job statuses: %w", err)
+	}
+	byName := make(map[string]*models.JobStatus, len(recorded))
+	for _, status := range recorded {
+		byName[status.Name] = status
+	}
+
+	statuses := make([]*models.JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status, ok := byName[job.Name]
+		if !ok {
+			status = &models.JobStatus{Name: job.Name} // Not run yet
+		}
+		status.IntervalSeconds = int64(job.Interval / time.Second)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
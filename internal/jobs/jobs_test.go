@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/storage"
+)
+
+func TestScheduler_RunOnce(t *testing.T) {
+	store := storage.NewMockStorage()
+	s := NewScheduler(store, "replica-1")
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	runs := 0
+	failing := false
+	job := Job{Name: "test-job", Interval: time.Hour, Run: func(context.Context) error {
+		runs++
+		if failing {
+			return errors.New("database unavailable")
+		}
+		return nil
+	}}
+	s.Add(job)
+
+	statuses, err := s.Statuses()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "test-job", statuses[0].Name)
+	assert.Equal(t, int64(3600), statuses[0].IntervalSeconds)
+	assert.Nil(t, statuses[0].LastStartedAt, "not run yet")
+
+	ran, err := s.RunOnce(context.Background(), job)
+	require.NoError(t, err)
+	assert.True(t, ran)
+
+	failing = true
+	ran, err = s.RunOnce(context.Background(), job)
+	assert.True(t, ran)
+	assert.EqualError(t, err, "database unavailable")
+	assert.Equal(t, 2, runs)
+
+	statuses, err = s.Statuses()
+	require.NoError(t, err)
+	status := statuses[0]
+	assert.Equal(t, int64(2), status.Runs)
+	assert.Equal(t, int64(1), status.Failures)
+	assert.Equal(t, "replica-1", status.LastRunner)
+	assert.Equal(t, "database unavailable", status.LastError)
+	assert.False(t, status.Running)
+	require.NotNil(t, status.LastSuccessAt)
+	assert.True(t, status.LastSuccessAt.Equal(now))
+}
+
+func TestScheduler_RunOnce_Locked(t *testing.T) {
+	store := storage.NewMockStorage()
+	s := NewScheduler(store, "replica-1")
+	job := Job{Name: "test-job", Interval: time.Hour, Run: func(context.Context) error {
+		t.Error("job ran while another replica held its lock")
+		return nil
+	}}
+
+	// Another replica is running the job
+	unlock, locked, err := store.LockJob(context.Background(), job.Name)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	ran, err := s.RunOnce(context.Background(), job)
+	require.NoError(t, err)
+	assert.False(t, ran)
+
+	unlock()
+	job.Run = func(context.Context) error { return nil }
+	ran, err = s.RunOnce(context.Background(), job)
+	require.NoError(t, err)
+	assert.True(t, ran, "runs once the lock is released")
+}
+
+func TestScheduler_Run(t *testing.T) {
+	store := storage.NewMockStorage()
+	s := NewScheduler(store, "replica-1")
+	ran := make(chan struct{}, 1)
+	s.Add(Job{Name: "test-job", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was done")
+	}
+}
@@ -0,0 +1,234 @@
+// Package jsonapi renders the API's JSON responses as JSON:API documents.
+//
+// Handlers keep writing their usual JSON. When a client asks for MediaType, the
+// middleware buffers the response and Convert rewrites it: objects of known routes
+// become resources with type, id, attributes, relationships, and links; list responses
+// become a data array with the remaining keys (such as total) under meta; and error
+// responses become an errors array. Responses of routes without a mapping, and
+// non-JSON responses such as exports, are passed through unchanged.
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MediaType is the JSON:API media type
+const MediaType = "application/vnd.api+json"
+
+// Relationship links a resource to another resource through one of its attributes
+type Relationship struct {
+	Type    string // Type of the related resource
+	IDField string // Attribute holding the related resource's ID; removed from the attributes
+	Related string // Link to the related resource; empty when it has no endpoint
+}
+
+// Resource describes how a JSON object maps to a JSON:API resource
+// Link templates may use {field} placeholders for the object's attributes; a link
+// whose placeholders cannot be filled is left out.
+type Resource struct {
+	Type          string
+	IDFields      []string // Attributes forming the ID, joined with ":"
+	Self          string   // Link to the resource itself
+	Links         map[string]string
+	Relationships map[string]Relationship
+}
+
+// Route maps a route's response to resources
+type Route struct {
+	Resource   *Resource
+	Collection string // Key of the resource list in the response; empty for a single resource
+}
+
+// Wants reports whether an Accept header asks for JSON:API
+func Wants(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if strings.EqualFold(mediaType, MediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert rewrites a JSON response body as a JSON:API document
+// route is nil for routes without a mapping; their successful responses are returned
+// unchanged with ok false. self is the request URI, used as the document's self link.
+func Convert(route *Route, status int, body []byte, self string) (converted []byte, ok bool, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var out map[string]interface{}
+	switch {
+	case status >= http.StatusBadRequest:
+		out = map[string]interface{}{"errors": []interface{}{errorObject(status, doc)}}
+	case route == nil || route.Resource == nil:
+		return body, false, nil
+	case route.Collection != "":
+		object, isObject := doc.(map[string]interface{})
+		items, isList := object[route.Collection].([]interface{})
+		if !isObject || !isList {
+			return body, false, nil
+		}
+		data := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			data = append(data, route.Resource.resource(item))
+		}
+		out = map[string]interface{}{"data": data, "links": map[string]string{"self": self}}
+		meta := map[string]interface{}{}
+		for key, value := range object {
+			if key != route.Collection {
+				meta[key] = value
+			}
+		}
+		if len(meta) > 0 {
+			out["meta"] = meta
+		}
+	default:
+		out = map[string]interface{}{"data": route.Resource.resource(doc), "links": map[string]string{"self": self}}
+	}
+
+	converted, err = json.Marshal(out)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return converted, true, nil
+}
+
+// resource converts one object; values that are not objects are returned unchanged
+func (r *Resource) resource(value interface{}) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	ids := make([]string, 0, len(r.IDFields))
+	for _, field := range r.IDFields {
+		ids = append(ids, text(object[field]))
+	}
+	id := strings.Join(ids, ":")
+
+	attributes := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		attributes[key] = value
+	}
+	if len(r.IDFields) == 1 {
+		delete(attributes, r.IDFields[0])
+	}
+
+	res := map[string]interface{}{"type": r.Type, "id": id}
+	links := map[string]string{}
+	if link, ok := fill(r.Self, object); ok {
+		links["self"] = link
+	}
+	for name, template := range r.Links {
+		if link, ok := fill(template, object); ok {
+			links[name] = link
+		}
+	}
+
+	relationships := map[string]interface{}{}
+	for name, rel := range r.Relationships {
+		relatedID := text(object[rel.IDField])
+		delete(attributes, rel.IDField)
+		if relatedID == "" {
+			continue
+		}
+		relationship := map[string]interface{}{
+			"data": map[string]string{"type": rel.Type, "id": relatedID},
+		}
+		if link, ok := fill(rel.Related, object); ok {
+			relationship["links"] = map[string]string{"related": link}
+		}
+		relationships[name] = relationship
+	}
+
+	res["attributes"] = attributes
+	if len(relationships) > 0 {
+		res["relationships"] = relationships
+	}
+	if len(links) > 0 {
+		res["links"] = links
+	}
+	return res
+}
+
+// errorObject converts an error response, normally {"error": ..., "message": ..., "request_id": ...}
+func errorObject(status int, doc interface{}) map[string]interface{} {
+	obj := map[string]interface{}{
+		"status": strconv.Itoa(status),
+		"title":  http.StatusText(status),
+	}
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return obj
+	}
+	if title := text(object["error"]); title != "" {
+		obj["title"] = title
+	}
+	if detail := text(object["message"]); detail != "" {
+		obj["detail"] = detail
+	}
+	// The request ID identifies this occurrence of the error
+	if id := text(object["request_id"]); id != "" {
+		obj["id"] = id
+	}
+	meta := map[string]interface{}{}
+	for key, value := range object {
+		if key != "error" && key != "message" && key != "request_id" {
+			meta[key] = value
+		}
+	}
+	if len(meta) > 0 {
+		obj["meta"] = meta
+	}
+	return obj
+}
+
+// fill replaces the {field} placeholders of a link template with the object's attributes
+func fill(template string, object map[string]interface{}) (string, bool) {
+	if template == "" {
+		return "", false
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			b.WriteString(template)
+			return b.String(), true
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", false
+		}
+		value := text(object[template[start+1:start+end]])
+		if value == "" {
+			return "", false
+		}
+		b.WriteString(template[:start])
+		b.WriteString(value)
+		template = template[start+end+1:]
+	}
+}
+
+// text formats an ID-like JSON value as a string
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,104 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convert(t *testing.T, route *Route, status int, body string) map[string]interface{} {
+	t.Helper()
+	converted, ok, err := Convert(route, status, []byte(body), "/api/v1/test?x=1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(converted, &doc))
+	return doc
+}
+
+func TestWants(t *testing.T) {
+	assert.True(t, Wants(MediaType))
+	assert.True(t, Wants("application/json;q=0.5, application/vnd.api+json"))
+	assert.False(t, Wants("application/json"))
+	assert.False(t, Wants(""))
+}
+
+func TestConvert_Collection(t *testing.T) {
+	route := Routes["GET /api/v1/hosts"]
+	doc := convert(t, &route, http.StatusOK, `{"hosts": [{
+		"host_id": "h1", "hostname": "web-01", "org_id": "o1", "uploaded_by_user_id": "u1", "last_seen": "2025-01-01T00:00:00Z"
+	}], "total": 1}`)
+
+	assert.Equal(t, map[string]interface{}{"total": float64(1)}, doc["meta"])
+	assert.Equal(t, map[string]interface{}{"self": "/api/v1/test?x=1"}, doc["links"])
+
+	data := doc["data"].([]interface{})
+	require.Len(t, data, 1)
+	host := data[0].(map[string]interface{})
+	assert.Equal(t, "hosts", host["type"])
+	assert.Equal(t, "h1", host["id"])
+	assert.Equal(t, map[string]interface{}{"hostname": "web-01", "last_seen": "2025-01-01T00:00:00Z"}, host["attributes"])
+	assert.Equal(t, map[string]interface{}{
+		"self":     "/api/v1/hosts/h1",
+		"events":   "/api/v1/hosts/h1/events",
+		"services": "/api/v1/hosts/h1/services",
+	}, host["links"])
+	relationships := host["relationships"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"type": "users", "id": "u1"}}, relationships["owner"])
+}
+
+func TestConvert_Resources(t *testing.T) {
+	route := Routes["GET /api/v1/services"]
+	doc := convert(t, &route, http.StatusOK, `{"services": [{
+		"host_id": "h1", "hostname": "web-01", "protocol": "tcp", "address": "0.0.0.0", "port": 22
+	}], "total": 1}`)
+	service := doc["data"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "h1:tcp:0.0.0.0:22", service["id"])
+	// Attributes forming a compound ID stay attributes
+	assert.Equal(t, float64(22), service["attributes"].(map[string]interface{})["port"])
+	host := service["relationships"].(map[string]interface{})["host"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"related": "/api/v1/hosts/h1"}, host["links"])
+
+	route = Routes["GET /api/v1/actions/:id"]
+	doc = convert(t, &route, http.StatusOK, `{"id": "a1", "name": "Webhook"}`)
+	action := doc["data"].(map[string]interface{})
+	assert.Equal(t, "actions", action["type"])
+	assert.Equal(t, "/api/v1/actions/a1/runs", action["links"].(map[string]interface{})["runs"])
+	assert.Nil(t, action["relationships"], "relationships without an ID are left out")
+}
+
+func TestConvert_Error(t *testing.T) {
+	doc := convert(t, nil, http.StatusBadRequest, `{"error": "invalid action", "message": "bad template", "limit": 5}`)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"status": "400",
+		"title":  "invalid action",
+		"detail": "bad template",
+		"meta":   map[string]interface{}{"limit": float64(5)},
+	}}, doc["errors"])
+}
+
+func TestConvert_ErrorRequestID(t *testing.T) {
+	doc := convert(t, nil, http.StatusInternalServerError, `{"error": "failed to list actions", "request_id": "r1"}`)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"id":     "r1",
+		"status": "500",
+		"title":  "failed to list actions",
+	}}, doc["errors"])
+}
+
+func TestConvert_Unmapped(t *testing.T) {
+	body := []byte(`{"status": "ok"}`)
+	converted, ok, err := Convert(nil, http.StatusOK, body, "/health")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, body, converted)
+
+	// A mapped route whose response lacks the collection is passed through
+	route := Routes["GET /api/v1/hosts"]
+	_, ok, err = Convert(&route, http.StatusOK, []byte(`{"message": "no hosts"}`), "/api/v1/hosts")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,106 @@
+package jsonapi
+
+// Resources of the API
+var (
+	hostOwner = Relationship{Type: "users", IDField: "uploaded_by_user_id"}
+	hostLinks = map[string]string{
+		"events":   "/api/v1/hosts/{host_id}/events",
+		"services": "/api/v1/hosts/{host_id}/services",
+	}
+	hostRelationship = Relationship{Type: "hosts", IDField: "host_id", Related: "/api/v1/hosts/{host_id}"}
+
+	// Host summaries from the host list
+	hostSummaries = &Resource{
+		Type:     "hosts",
+		IDFields: []string{"host_id"},
+		Self:     "/api/v1/hosts/{host_id}",
+		Links:    hostLinks,
+		Relationships: map[string]Relationship{
+			"owner":        hostOwner,
+			"organization": {Type: "organizations", IDField: "org_id"},
+		},
+	}
+
+	// Full host reports, identified by id
+	hostReports = &Resource{
+		Type:     "hosts",
+		IDFields: []string{"id"},
+		Self:     "/api/v1/hosts/{id}",
+		Links: map[string]string{
+			"events":   "/api/v1/hosts/{id}/events",
+			"services": "/api/v1/hosts/{id}/services",
+		},
+	}
+
+	hostEvents = &Resource{
+		Type:     "host-events",
+		IDFields: []string{"id"},
+		Relationships: map[string]Relationship{
+			"host":  hostRelationship,
+			"actor": {Type: "users", IDField: "actor_user_id"},
+		},
+	}
+
+	hostAccounts = &Resource{
+		Type:          "host-accounts",
+		IDFields:      []string{"host_id", "username"},
+		Relationships: map[string]Relationship{"host": hostRelationship},
+	}
+
+	hostServices = &Resource{
+		Type:          "host-services",
+		IDFields:      []string{"host_id", "protocol", "address", "port"},
+		Relationships: map[string]Relationship{"host": hostRelationship},
+	}
+
+	users = &Resource{
+		Type:          "users",
+		IDFields:      []string{"id"},
+		Relationships: map[string]Relationship{"organization": {Type: "organizations", IDField: "org_id"}},
+	}
+
+	apiKeys = &Resource{
+		Type:          "api-keys",
+		IDFields:      []string{"id"},
+		Relationships: map[string]Relationship{"owner": {Type: "users", IDField: "user_id"}},
+	}
+
+	actions = &Resource{
+		Type:     "actions",
+		IDFields: []string{"id"},
+		Self:     "/api/v1/actions/{id}",
+		Links:    map[string]string{"runs": "/api/v1/actions/{id}/runs"},
+		Relationships: map[string]Relationship{
+			"owner": {Type: "users", IDField: "created_by"},
+		},
+	}
+
+	actionRuns = &Resource{
+		Type:     "action-runs",
+		IDFields: []string{"id"},
+		Relationships: map[string]Relationship{
+			"action":       {Type: "actions", IDField: "action_id", Related: "/api/v1/actions/{action_id}"},
+			"organization": {Type: "organizations", IDField: "org_id"},
+		},
+	}
+)
+
+// Routes maps "METHOD /route/pattern" to the resources of its response
+var Routes = map[string]Route{
+	"GET /api/v1/auth/me":                         {Resource: users},
+	"GET /api/v1/users":                           {Resource: users, Collection: "users"},
+	"GET /api/v1/api-keys":                        {Resource: apiKeys, Collection: "api_keys"},
+	"GET /api/v1/hosts":                           {Resource: hostSummaries, Collection: "hosts"},
+	"GET /api/v1/hosts/:host_id":                  {Resource: hostReports},
+	"GET /api/v1/hosts/:host_id/events":           {Resource: hostEvents, Collection: "events"},
+	"GET /api/v1/hosts/:host_id/services":         {Resource: hostServices, Collection: "services"},
+	"GET /api/v1/events":                          {Resource: hostEvents, Collection: "events"},
+	"GET /api/v1/accounts":                        {Resource: hostAccounts, Collection: "accounts"},
+	"GET /api/v1/services":                        {Resource: hostServices, Collection: "services"},
+	"GET /api/v1/actions":                         {Resource: actions, Collection: "actions"},
+	"POST /api/v1/actions":                        {Resource: actions},
+	"GET /api/v1/actions/:id":                     {Resource: actions},
+	"PUT /api/v1/actions/:id":                     {Resource: actions},
+	"GET /api/v1/actions/:id/runs":                {Resource: actionRuns, Collection: "runs"},
+	"POST /api/v1/actions/:id/runs/:run_id/retry": {Resource: actionRuns},
+}
@@ -0,0 +1,121 @@
+// Package jsonlimit enforces structural limits on JSON documents before they are decoded.
+//
+// Deeply nested or extremely wide payloads are cheap to send but expensive to
+// decode into Go values and to store as JSONB. Check walks a document token by
+// token, without building it, and stops at the first limit it exceeds.
+package jsonlimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Limit names reported in errors
+const (
+	LimitDepth        = "depth"
+	LimitKeys         = "keys"
+	LimitStringLength = "string_length"
+)
+
+// Default limits, generous enough for full snail-core reports
+const (
+	DefaultMaxDepth        = 64
+	DefaultMaxKeys         = 200000
+	DefaultMaxStringLength = 1 << 20 // 1MB
+)
+
+// Limits bounds the shape of a JSON document; a zero field disables that limit
+type Limits struct {
+	MaxDepth        int // Maximum nesting of objects and arrays
+	MaxKeys         int // Maximum number of object keys in the whole document
+	MaxStringLength int // Maximum length in bytes of any key or string value
+}
+
+// DefaultLimits returns the limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDepth:        DefaultMaxDepth,
+		MaxKeys:         DefaultMaxKeys,
+		MaxStringLength: DefaultMaxStringLength,
+	}
+}
+
+// Error reports which limit a document exceeded
+type Error struct {
+	Limit  string // One of the Limit* constants
+	Max    int    // The configured maximum
+	Offset int64  // Byte offset in the document where the limit was exceeded
+}
+
+func (e *Error) Error() string {
+	switch e.Limit {
+	case LimitDepth:
+		return fmt.Sprintf("JSON nesting depth exceeds %d (at byte %d)", e.Max, e.Offset)
+	case LimitKeys:
+		return fmt.Sprintf("JSON document has more than %d object keys (at byte %d)", e.Max, e.Offset)
+	default:
+		return fmt.Sprintf("JSON string longer than %d bytes (at byte %d)", e.Max, e.Offset)
+	}
+}
+
+// container tracks an open object or array while scanning
+type container struct {
+	object    bool
+	expectKey bool // Inside an object, whether the next token is a key
+}
+
+// Check reports whether data is within limits
+// It returns *Error when a limit is exceeded and the decoder's error when data
+// is not valid JSON.
+func (l Limits) Check(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var stack []container
+	keys := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		isKey := false
+		if n := len(stack); n > 0 && stack[n-1].object {
+			if tok != json.Delim('}') {
+				isKey = stack[n-1].expectKey
+				stack[n-1].expectKey = !stack[n-1].expectKey
+			}
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			switch v {
+			case '{', '[':
+				stack = append(stack, container{object: v == '{', expectKey: true})
+				if l.MaxDepth > 0 && len(stack) > l.MaxDepth {
+					return &Error{Limit: LimitDepth, Max: l.MaxDepth, Offset: dec.InputOffset()}
+				}
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if isKey {
+				keys++
+				if l.MaxKeys > 0 && keys > l.MaxKeys {
+					return &Error{Limit: LimitKeys, Max: l.MaxKeys, Offset: dec.InputOffset()}
+				}
+			}
+			if l.MaxStringLength > 0 && len(v) > l.MaxStringLength {
+				return &Error{Limit: LimitStringLength, Max: l.MaxStringLength, Offset: dec.InputOffset()}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package jsonlimit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimits_Check(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxKeys: 4, MaxStringLength: 8}
+
+	tests := []struct {
+		name      string
+		doc       string
+		wantLimit string // Empty when the document is within limits
+	}{
+		{"flat object", `{"a": 1, "b": "short"}`, ""},
+		{"at max depth", `{"a": {"b": [1, 2]}}`, ""},
+		{"too deep", `{"a": {"b": [[1]]}}`, LimitDepth},
+		{"nested arrays count", `[[[[]]]]`, LimitDepth},
+		{"at max keys", `{"a": {"b": 1, "c": 2}, "d": 3}`, ""},
+		{"too many keys", `{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}`, LimitKeys},
+		{"keys counted across objects", `[{"a": 1, "b": 2}, {"c": 3, "d": 4}, {"e": 5}]`, LimitKeys},
+		{"string values are not keys", `{"a": "b", "c": ["d", "e", "f", "g"]}`, ""},
+		{"long value", `{"a": "123456789"}`, LimitStringLength},
+		{"long key", `{"123456789": 1}`, LimitStringLength},
+		{"keys after nested value", `{"a": {"b": 1}, "c": [1], "d": 2, "e": 3}`, LimitKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.Check([]byte(tt.doc))
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+			var limitErr *Error
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Check() error = %v, want *Error", err)
+			}
+			if limitErr.Limit != tt.wantLimit {
+				t.Errorf("Check() limit = %s, want %s", limitErr.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestLimits_CheckDisabled(t *testing.T) {
+	doc := strings.Repeat("[", 500) + strings.Repeat("]", 500)
+	if err := (Limits{}).Check([]byte(doc)); err != nil {
+		t.Errorf("Check() with no limits error = %v", err)
+	}
+	if err := DefaultLimits().Check([]byte(doc)); err == nil {
+		t.Error("Check() with default limits accepted 500 levels of nesting")
+	}
+}
+
+func TestLimits_CheckInvalidJSON(t *testing.T) {
+	for _, doc := range []string{`{"a":`, `{"a" 1}`, `[1, 2`} {
+		err := DefaultLimits().Check([]byte(doc))
+		if err == nil {
+			t.Errorf("Check(%q) error = nil, want syntax error", doc)
+			continue
+		}
+		var limitErr *Error
+		if errors.As(err, &limitErr) {
+			t.Errorf("Check(%q) returned a limit error for invalid JSON", doc)
+		}
+	}
+}
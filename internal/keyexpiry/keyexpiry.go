@@ -0,0 +1,65 @@
+// Package keyexpiry deletes API keys once they have been expired for a while.
+//
+// Expired keys are rejected at authentication as soon as they expire. They are kept,
+// and listed as expired, for a retention period so their owners can see which keys
+// stopped working and replace them, and are then deleted. Each deletion is recorded in
+// the organization's audit log.
+package keyexpiry
+
+import (
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// CheckInterval is how often the cleaner looks for keys past their retention
+const CheckInterval = time.Hour
+
+// Cleaner deletes API keys that expired more than a retention period ago
+type Cleaner struct {
+	store     storage.Storage
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewCleaner creates a cleaner deleting keys from store retention after they expire
+func NewCleaner(store storage.Storage, retention time.Duration) *Cleaner {
+	return &Cleaner{
+		store:     store,
+		retention: retention,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Clean deletes the keys of every user that expired before the retention period and
+// returns how many were deleted
+func (c *Cleaner) Clean() (int, error) {
+	deleted, err := c.store.DeleteExpiredAPIKeys("", c.now().Add(-c.retention))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range deleted {
+		event := &models.AuditEvent{
+			OrgID:      key.OrgID,
+			Action:     models.AuditAPIKeyDeleted,
+			TargetType: models.AuditTargetAPIKey,
+			TargetID:   key.ID,
+			Details: map[string]string{
+				"reason":     "expired",
+				"name":       key.Name,
+				"user_id":    key.UserID,
+				"expired_at": key.ExpiresAt.UTC().Format(time.RFC3339),
+			},
+		}
+		if err := c.store.CreateAuditEvent(event); err != nil {
+			logger.Logger.Error().Err(err).Str("key_id", key.ID).Msg("Failed to record audit event")
+		}
+	}
+	if len(deleted) > 0 {
+		logger.Logger.Info().Int("deleted", len(deleted)).Dur("retention", c.retention).Msg("Deleted expired API keys")
+	}
+	return len(deleted), nil
+}
@@ -0,0 +1,59 @@
+package keyexpiry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestCleaner_Clean(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+	user, err := store.CreateUser("alice", "alice@example.com", "hash", org.ID, "admin")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+	old, err := store.CreateAPIKey(user.ID, "hash1", "prefix1", "Old", at(-48*time.Hour))
+	require.NoError(t, err)
+	_, err = store.CreateAPIKey(user.ID, "hash2", "prefix2", "Recent", at(-time.Hour))
+	require.NoError(t, err)
+	_, err = store.CreateAPIKey(user.ID, "hash3", "prefix3", "Valid", at(time.Hour))
+	require.NoError(t, err)
+	_, err = store.CreateAPIKey(user.ID, "hash4", "prefix4", "Permanent", nil)
+	require.NoError(t, err)
+
+	c := NewCleaner(store, 24*time.Hour)
+	c.now = func() time.Time { return now }
+	deleted, err := c.Clean()
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted, "only the key expired for longer than the retention is deleted")
+
+	keys, err := store.GetAPIKeysByUserID(user.ID)
+	require.NoError(t, err)
+	names := []string{}
+	for _, key := range keys {
+		names = append(names, key.Name)
+	}
+	assert.ElementsMatch(t, []string{"Recent", "Valid", "Permanent"}, names)
+
+	page, err := store.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, models.AuditAPIKeyDeleted, page.Events[0].Action)
+	assert.Equal(t, old.ID, page.Events[0].TargetID)
+	assert.Equal(t, "expired", page.Events[0].Details["reason"])
+
+	deleted, err = c.Clean()
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
@@ -0,0 +1,400 @@
+// Package leader elects one replica to run the background job runners, using a
+// Kubernetes coordination.k8s.io/v1 Lease.
+//
+// The runners claim their work in the database, so running them on every replica
+// is safe; electing a leader only stops every replica from polling for the same
+// work. The elector talks to the API server directly with the pod's service
+// account, which needs get, create, and update on the Lease.
+//
+// Like client-go, a lease is judged expired by when this replica last saw it
+// change rather than by the holder's renewTime, so clock skew between nodes does
+// not cause two leaders.
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+)
+
+// Service account files mounted into every pod
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenFile         = serviceAccountDir + "/token"
+	caFile            = serviceAccountDir + "/ca.crt"
+	namespaceFile     = serviceAccountDir + "/namespace"
+)
+
+// microTime is the format of a Lease's MicroTime fields
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// errConflict is returned when another replica changed the lease first
+var errConflict = errors.New("lease was changed by another replica")
+
+// Config configures an Elector
+type Config struct {
+	// Namespace and Name identify the Lease
+	Namespace string
+	Name      string
+	// Identity is this replica's holder identity, usually the pod name
+	Identity string
+	// LeaseDuration is how long a lease that is not renewed stays held.
+	// It is renewed every LeaseDuration/5 and given up if it cannot be
+	// renewed for 2/3 of LeaseDuration.
+	LeaseDuration time.Duration
+}
+
+// Elector holds a Lease while its replica is the leader
+type Elector struct {
+	cfg           Config
+	client        *http.Client
+	baseURL       string
+	token         func() (string, error)
+	now           func() time.Time
+	retryPeriod   time.Duration
+	renewDeadline time.Duration
+
+	mu       sync.Mutex
+	leader   bool
+	observed string    // resourceVersion of the lease last seen
+	seenAt   time.Time // When it was first seen
+}
+
+// NewInCluster creates an elector that reaches the API server with the pod's
+// service account. An empty namespace is the pod's own.
+func NewInCluster(cfg Config) (*Elector, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("service account CA %s contains no certificates", caFile)
+	}
+	if cfg.Namespace == "" {
+		namespace, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+	}
+	// The token is rotated by the kubelet, so it is read for every request
+	token := func() (string, error) {
+		data, err := os.ReadFile(tokenFile)
+		return strings.TrimSpace(string(data)), err
+	}
+	return New(cfg, client, "https://"+net.JoinHostPort(host, port), token), nil
+}
+
+// New creates an elector that reaches the API server at baseURL
+func New(cfg Config, client *http.Client, baseURL string, token func() (string, error)) *Elector {
+	return &Elector{
+		cfg:           cfg,
+		client:        client,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		token:         token,
+		now:           time.Now,
+		retryPeriod:   cfg.LeaseDuration / 5,
+		renewDeadline: cfg.LeaseDuration * 2 / 3,
+	}
+}
+
+// IsLeader reports whether this replica currently holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns for the lease until ctx is done, calling lead each time it is
+// acquired. The context passed to lead is cancelled when the lease is lost or ctx
+// is done, and lead must return before the lease is given up or released.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	log := logger.Logger.With().Str("lease", e.cfg.Namespace+"/"+e.cfg.Name).Str("identity", e.cfg.Identity).Logger()
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.tryAcquireOrRenew(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Failed to acquire leader lease")
+		}
+		if acquired {
+			log.Info().Msg("Acquired leader lease; running background jobs")
+			e.setLeader(true)
+			e.lead(ctx, lead)
+			e.setLeader(false)
+			if ctx.Err() != nil {
+				e.release()
+				log.Info().Msg("Released leader lease")
+				return
+			}
+			log.Warn().Msg("Lost leader lease; background jobs stopped")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs lead while the lease keeps being renewed
+func (e *Elector) lead(ctx context.Context, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+	lastRenewed := e.now()
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-done:
+			cancel()
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := e.tryAcquireOrRenew(ctx)
+		if renewed {
+			lastRenewed = e.now()
+			continue
+		}
+		// Another replica took over, or the lease may have expired while unreachable
+		if err == nil || errors.Is(err, errConflict) || e.now().Sub(lastRenewed) > e.renewDeadline {
+			if err != nil {
+				logger.Logger.Warn().Err(err).Msg("Failed to renew leader lease")
+			}
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	e.leader = leader
+	e.mu.Unlock()
+	if leader {
+		metrics.Leader.Set(1)
+	} else {
+		metrics.Leader.Set(0)
+	}
+}
+
+// lease is the part of a coordination.k8s.io/v1 Lease the elector uses
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       *string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *string `json:"acquireTime,omitempty"`
+	RenewTime            *string `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32  `json:"leaseTransitions,omitempty"`
+}
+
+// tryAcquireOrRenew takes the lease if it is free or expired, or renews it if this
+// replica holds it, and reports whether this replica holds it afterwards
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := e.now()
+	current, err := e.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		return e.write(ctx, http.MethodPost, e.newLease(now))
+	}
+
+	holder := ""
+	if current.Spec.HolderIdentity != nil {
+		holder = *current.Spec.HolderIdentity
+	}
+	e.mu.Lock()
+	if current.Metadata.ResourceVersion != e.observed {
+		e.observed, e.seenAt = current.Metadata.ResourceVersion, now
+	}
+	seenAt := e.seenAt
+	e.mu.Unlock()
+
+	duration := e.cfg.LeaseDuration
+	if current.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*current.Spec.LeaseDurationSeconds) * time.Second
+	}
+	if holder != "" && holder != e.cfg.Identity && now.Before(seenAt.Add(duration)) {
+		return false, nil
+	}
+
+	next := e.newLease(now)
+	next.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+	transitions := int32(0)
+	if current.Spec.LeaseTransitions != nil {
+		transitions = *current.Spec.LeaseTransitions
+	}
+	if holder == e.cfg.Identity {
+		next.Spec.AcquireTime = current.Spec.AcquireTime
+	} else {
+		transitions++
+	}
+	next.Spec.LeaseTransitions = &transitions
+	return e.write(ctx, http.MethodPut, next)
+}
+
+// release gives up the lease so another replica can take over without waiting for it to expire
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	current, err := e.get(ctx)
+	if err != nil || current == nil || current.Spec.HolderIdentity == nil || *current.Spec.HolderIdentity != e.cfg.Identity {
+		return
+	}
+	empty, expired := "", int32(1)
+	current.Spec.HolderIdentity = &empty
+	current.Spec.LeaseDurationSeconds = &expired
+	if _, err := e.write(ctx, http.MethodPut, current); err != nil {
+		logger.Logger.Warn().Err(err).Msg("Failed to release leader lease")
+	}
+}
+
+func (e *Elector) newLease(now time.Time) *lease {
+	identity := e.cfg.Identity
+	seconds := int32(e.cfg.LeaseDuration / time.Second)
+	stamp := now.UTC().Format(microTime)
+	transitions := int32(0)
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: e.cfg.Name, Namespace: e.cfg.Namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       &identity,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &stamp,
+			RenewTime:            &stamp,
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+func (e *Elector) leasesURL() string {
+	return e.baseURL + "/apis/coordination.k8s.io/v1/namespaces/" + e.cfg.Namespace + "/leases"
+}
+
+// get returns the lease, or nil if it does not exist yet
+func (e *Elector) get(ctx context.Context) (*lease, error) {
+	resp, err := e.do(ctx, http.MethodGet, e.leasesURL()+"/"+e.cfg.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var current lease
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		return nil, fmt.Errorf("failed to decode lease: %w", err)
+	}
+	return &current, nil
+}
+
+// write creates (POST) or replaces (PUT) the lease and reports whether it was written
+// A replace carries the resourceVersion that was read, so it fails if the lease changed since.
+func (e *Elector) write(ctx context.Context, method string, l *lease) (bool, error) {
+	url := e.leasesURL()
+	if method == http.MethodPut {
+		url += "/" + e.cfg.Name
+	}
+	body, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	resp, err := e.do(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var written lease
+		if err := json.NewDecoder(resp.Body).Decode(&written); err == nil {
+			e.mu.Lock()
+			e.observed, e.seenAt = written.Metadata.ResourceVersion, e.now()
+			e.mu.Unlock()
+		}
+		return true, nil
+	case http.StatusConflict:
+		return false, errConflict
+	default:
+		return false, statusError(resp)
+	}
+}
+
+func (e *Elector) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.token != nil {
+		token, err := e.token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return e.client.Do(req)
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("kubernetes API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
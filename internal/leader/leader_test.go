@@ -0,0 +1,182 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPIServer stores one Lease like the Kubernetes API server, rejecting
+// replaces whose resourceVersion is stale
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+	tokens  []string
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+
+	if !strings.HasPrefix(r.URL.Path, "/apis/coordination.k8s.io/v1/namespaces/snailbus/leases") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		var next lease
+		if err := json.NewDecoder(r.Body).Decode(&next); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if (r.Method == http.MethodPost && f.lease != nil) ||
+			(r.Method == http.MethodPut && (f.lease == nil || next.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion)) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.version++
+		next.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = &next
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(f.lease)
+	}
+}
+
+func (f *fakeAPIServer) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lease == nil || f.lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *f.lease.Spec.HolderIdentity
+}
+
+func newTestElector(t *testing.T, server *httptest.Server, identity string) *Elector {
+	t.Helper()
+	cfg := Config{Namespace: "snailbus", Name: "snailbus-jobs", Identity: identity, LeaseDuration: 15 * time.Second}
+	return New(cfg, server.Client(), server.URL, func() (string, error) { return "token-" + identity, nil })
+}
+
+func TestElector_TryAcquireOrRenew(t *testing.T) {
+	fake := &fakeAPIServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a, b := newTestElector(t, server, "pod-a"), newTestElector(t, server, "pod-b")
+	a.now = func() time.Time { return now }
+	b.now = func() time.Time { return now }
+
+	// The first replica creates the lease
+	acquired, err := a.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, "pod-a", fake.holder())
+	assert.Equal(t, "Bearer token-pod-a", fake.tokens[0])
+
+	acquired, err = b.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired, "a held lease is not taken")
+
+	// Renewals keep it held, judged by when b last saw it change
+	now = now.Add(10 * time.Second)
+	acquired, err = a.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	now = now.Add(10 * time.Second)
+	acquired, err = b.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// A lease that stops changing expires
+	now = now.Add(16 * time.Second)
+	acquired, err = b.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, "pod-b", fake.holder())
+	assert.Equal(t, int32(1), *fake.lease.Spec.LeaseTransitions)
+
+	acquired, err = a.tryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired, "the old holder sees the takeover")
+}
+
+func TestElector_Conflict(t *testing.T) {
+	fake := &fakeAPIServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a := newTestElector(t, server, "pod-a")
+	_, err := a.tryAcquireOrRenew(context.Background())
+	require.NoError(t, err)
+
+	// A write based on a lease that has changed since is refused
+	stale := a.newLease(time.Now())
+	stale.Metadata.ResourceVersion = "0"
+	written, err := a.write(context.Background(), http.MethodPut, stale)
+	assert.False(t, written)
+	assert.ErrorIs(t, err, errConflict)
+}
+
+func TestElector_Run(t *testing.T) {
+	fake := &fakeAPIServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a := newTestElector(t, server, "pod-a")
+	a.retryPeriod = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run(ctx, func(leadCtx context.Context) {
+			close(leading)
+			<-leadCtx.Done()
+			close(stopped)
+		})
+	}()
+
+	select {
+	case <-leading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never became leader")
+	}
+	assert.True(t, a.IsLeader())
+
+	// Stopping waits for the jobs, then releases the lease for the next replica
+	cancel()
+	<-done
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Run returned before lead did")
+	}
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, "", fake.holder())
+
+	b := newTestElector(t, server, "pod-b")
+	acquired, err := b.tryAcquireOrRenew(context.Background())
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
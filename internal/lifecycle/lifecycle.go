@@ -0,0 +1,220 @@
+// Package lifecycle tracks the server's startup phases and shutdown for
+// Kubernetes probes.
+//
+// The API listener starts before migrations run, so that startup and liveness
+// probes are answered while the schema is brought up to date. Until the router
+// is built the Gate answers the probe endpoints itself and turns every other
+// request away with 503. On shutdown the server drains first: /readyz fails so
+// that the pod is removed from its Services before the listener closes.
+package lifecycle
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Startup statuses
+const (
+	StatusStarting = "starting"
+	StatusStarted  = "started"
+	StatusFailed   = "failed"
+)
+
+// Phase statuses
+const (
+	PhaseRunning = "running"
+	PhaseDone    = "done"
+	PhaseFailed  = "failed"
+)
+
+// Phase is one step of startup, such as running migrations
+type Phase struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"` // So far, while running
+	Error      string    `json:"error,omitempty"`
+}
+
+// Startup reports progress through startup
+type Startup struct {
+	Status    string    `json:"status"`          // starting, started, or failed
+	Phase     string    `json:"phase,omitempty"` // The running phase, while starting
+	StartedAt time.Time `json:"started_at"`      // When the process started
+	Phases    []Phase   `json:"phases"`
+	Draining  bool      `json:"draining"` // Shutdown has begun and /readyz fails
+}
+
+// State is the startup and shutdown state of the server
+type State struct {
+	mu            sync.Mutex
+	now           func() time.Time
+	startedAt     time.Time
+	phases        []Phase
+	started       bool
+	drainingSince time.Time
+}
+
+// NewState creates the state of a server that is starting now
+func NewState() *State {
+	s := &State{now: time.Now}
+	s.startedAt = s.now().UTC()
+	return s
+}
+
+// Phase records the start of a startup phase and returns the function that ends it
+// Ending it with an error marks startup as failed.
+func (s *State) Phase(name string) func(err error) {
+	s.mu.Lock()
+	s.phases = append(s.phases, Phase{Name: name, Status: PhaseRunning, StartedAt: s.now().UTC()})
+	i := len(s.phases) - 1
+	s.mu.Unlock()
+
+	return func(err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		phase := &s.phases[i]
+		phase.DurationMS = s.now().Sub(phase.StartedAt).Milliseconds()
+		phase.Status = PhaseDone
+		if err != nil {
+			phase.Status = PhaseFailed
+			phase.Error = err.Error()
+		}
+	}
+}
+
+// MarkStarted records that startup has finished and the router is serving requests
+func (s *State) MarkStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+}
+
+// Started reports whether startup has finished
+func (s *State) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Drain records that shutdown has begun, so /readyz fails from now on
+// Draining again keeps the time it first began.
+func (s *State) Drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drainingSince.IsZero() {
+		s.drainingSince = s.now()
+	}
+}
+
+// Draining reports whether shutdown has begun
+func (s *State) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.drainingSince.IsZero()
+}
+
+// DrainedFor returns how long the server has been draining, or 0 if it is not
+func (s *State) DrainedFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drainingSince.IsZero() {
+		return 0
+	}
+	return s.now().Sub(s.drainingSince)
+}
+
+// Snapshot returns the startup progress
+func (s *State) Snapshot() Startup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	startup := Startup{
+		Status:    StatusStarting,
+		StartedAt: s.startedAt,
+		Phases:    make([]Phase, len(s.phases)),
+		Draining:  !s.drainingSince.IsZero(),
+	}
+	copy(startup.Phases, s.phases)
+	for i := range startup.Phases {
+		phase := &startup.Phases[i]
+		switch phase.Status {
+		case PhaseRunning:
+			phase.DurationMS = s.now().Sub(phase.StartedAt).Milliseconds()
+			startup.Phase = phase.Name
+		case PhaseFailed:
+			startup.Status = StatusFailed
+		}
+	}
+	if s.started && startup.Status != StatusFailed {
+		startup.Status = StatusStarted
+	}
+	return startup
+}
+
+// Gate is the API server's handler. Until Open it answers /health, /readyz, and
+// /startupz itself and turns every other request away with 503; from then on
+// every request goes to the router.
+type Gate struct {
+	state   *State
+	handler atomic.Pointer[http.Handler]
+}
+
+// NewGate creates a closed gate that reports the startup progress of state
+func NewGate(state *State) *Gate {
+	return &Gate{state: state}
+}
+
+// Open sends every following request to handler
+func (g *Gate) Open(handler http.Handler) {
+	g.handler.Store(&handler)
+}
+
+func (g *Gate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler := g.handler.Load(); handler != nil {
+		(*handler).ServeHTTP(w, r)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/health":
+		// The process is alive; failing liveness here would restart it mid-migration
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusStarting, "service": "snailbus"})
+	case "/readyz":
+		startup := g.state.Snapshot()
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not_ready", "startup": startup.Status, "phase": startup.Phase})
+	case "/startupz":
+		writeJSON(w, http.StatusServiceUnavailable, g.state.Snapshot())
+	default:
+		w.Header().Set("Retry-After", "5")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "service is starting"})
+	}
+}
+
+// PreStopHandler serves the target of a Kubernetes preStop hook: it starts draining
+// and answers once the server has drained for delay, so the pod has left its
+// Services' endpoints before the kubelet sends SIGTERM
+func PreStopHandler(state *State, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state.Drain()
+		if remaining := delay - state.DrainedFor(); remaining > 0 {
+			timer := time.NewTimer(remaining)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "shutting_down"})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
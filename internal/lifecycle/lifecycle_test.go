@@ -0,0 +1,125 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testState returns a state whose clock only moves when advanced
+func testState() (*State, func(time.Duration)) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := &State{now: func() time.Time { return now }}
+	s.startedAt = now
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestState_Phases(t *testing.T) {
+	s, advance := testState()
+
+	endMigrations := s.Phase("migrations")
+	advance(2 * time.Second)
+	startup := s.Snapshot()
+	assert.Equal(t, StatusStarting, startup.Status)
+	assert.Equal(t, "migrations", startup.Phase)
+	require.Len(t, startup.Phases, 1)
+	assert.Equal(t, PhaseRunning, startup.Phases[0].Status)
+	assert.Equal(t, int64(2000), startup.Phases[0].DurationMS)
+
+	endMigrations(nil)
+	advance(time.Second)
+	s.Phase("database")(nil)
+	s.MarkStarted()
+	startup = s.Snapshot()
+	assert.Equal(t, StatusStarted, startup.Status)
+	assert.Empty(t, startup.Phase)
+	assert.Equal(t, PhaseDone, startup.Phases[0].Status)
+	assert.Equal(t, int64(2000), startup.Phases[0].DurationMS, "a finished phase keeps its duration")
+	assert.True(t, s.Started())
+
+	// A failed phase fails startup
+	s, _ = testState()
+	s.Phase("migrations")(errors.New("dirty database version 3"))
+	startup = s.Snapshot()
+	assert.Equal(t, StatusFailed, startup.Status)
+	assert.Equal(t, "dirty database version 3", startup.Phases[0].Error)
+}
+
+func TestState_Drain(t *testing.T) {
+	s, advance := testState()
+	assert.False(t, s.Draining())
+	assert.Zero(t, s.DrainedFor())
+
+	s.Drain()
+	advance(3 * time.Second)
+	s.Drain()
+	assert.True(t, s.Draining())
+	assert.Equal(t, 3*time.Second, s.DrainedFor(), "draining again keeps the first start")
+	assert.True(t, s.Snapshot().Draining)
+}
+
+func TestGate(t *testing.T) {
+	s, _ := testState()
+	s.Phase("migrations")
+	gate := NewGate(s)
+
+	get := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		gate.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body
+	}
+
+	// Liveness passes while migrations run; readiness and startup do not
+	w, body := get("/health")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "starting", body["status"])
+	w, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "migrations", body["phase"])
+	w, body = get("/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Len(t, body["phases"], 1)
+	w, _ = get("/api/v1/hosts")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	gate.Open(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusTeapot, map[string]string{"path": r.URL.Path})
+	}))
+	w, body = get("/health")
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "/health", body["path"])
+}
+
+func TestPreStopHandler(t *testing.T) {
+	s := NewState()
+	handler := PreStopHandler(s, 20*time.Millisecond)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, s.Draining())
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// Once drained for the delay it answers at once
+	start = time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+
+	// A cancelled hook stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	PreStopHandler(NewState(), time.Hour).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil).WithContext(ctx))
+	assert.Empty(t, w.Body.String())
+}
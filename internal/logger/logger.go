@@ -102,6 +102,13 @@ func FromContext(c interface {
 		}
 	}
 
+	// Extract the system administrator impersonating the user, if any
+	if impersonatorID, exists := c.Get("impersonator_id"); exists {
+		if id, ok := impersonatorID.(string); ok {
+			event = event.Str("impersonator_id", id)
+		}
+	}
+
 	return event
 }
 
@@ -27,6 +27,59 @@ var (
 		[]string{"method", "endpoint", "status_code"},
 	)
 
+	// HTTPPanicsTotal counts panics recovered by middleware.Recovery
+	HTTPPanicsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "Total number of panics recovered in HTTP handlers",
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	// HTTPRequestBodyRejectedTotal counts request bodies rejected with 413 by middleware.RequestSizeLimit's
+	// size class and the reason: content_length (declared too large), body (found too large as it was
+	// read), or decompressed (too large once decompressed)
+	HTTPRequestBodyRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_request_body_rejected_total",
+			Help: "Total number of request bodies rejected for their size",
+		},
+		[]string{"class", "reason"},
+	)
+
+	// Error rate tracking (see internal/errorrate)
+	HTTPEndpointErrorRatio = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_endpoint_error_ratio",
+			Help: "Ratio of 5xx responses per endpoint over a sliding window",
+		},
+		[]string{"endpoint", "window"},
+	)
+
+	HTTPEndpointErrorAlerting = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_endpoint_error_alerting",
+			Help: "Whether the endpoint's error ratio is above the alert threshold (1) or not (0)",
+		},
+		[]string{"endpoint"},
+	)
+
+	// BuildInfo is always 1; its labels identify the running build
+	BuildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "Version, commit, build date, and Go version of the running server; always 1",
+		},
+		[]string{"version", "commit", "build_date", "go_version"},
+	)
+
+	ServiceDegraded = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snailbus_degraded",
+			Help: "Whether any endpoint error rate alert is firing (1) or not (0)",
+		},
+	)
+
 	// Database connection pool metrics
 	DBMaxOpenConns = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -93,6 +146,168 @@ var (
 		[]string{"database"},
 	)
 
+	// Replication (see DATABASE_REPLICA_URL)
+	DBInRecovery = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_in_recovery",
+			Help: "Whether the database is a standby (1) or a primary (0)",
+		},
+		[]string{"database"},
+	)
+
+	DBReplicaLagSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_replica_lag_seconds",
+			Help: "Replay lag of the read replica at the last health check",
+		},
+	)
+
+	DBReplicaServingReads = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_replica_serving_reads",
+			Help: "Whether reads are routed to the replica (1) or have failed over to the primary (0)",
+		},
+	)
+
+	// Table maintenance (see internal/dbadvisor), refreshed every few minutes
+	DBTableLiveTuples = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_live_tuples",
+			Help: "Estimated number of live rows per table",
+		},
+		[]string{"table"},
+	)
+
+	DBTableDeadTuples = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_dead_tuples",
+			Help: "Estimated number of dead rows per table, reclaimed by the next vacuum",
+		},
+		[]string{"table"},
+	)
+
+	DBTableSizeBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_size_bytes",
+			Help: "Size of each table's heap (kind=table) and indexes (kind=indexes)",
+		},
+		[]string{"table", "kind"},
+	)
+
+	DBTableEstimatedBloatBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_estimated_bloat_bytes",
+			Help: "Estimated table and index space held by dead rows",
+		},
+		[]string{"table"},
+	)
+
+	DBTableHOTUpdateRatio = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_hot_update_ratio",
+			Help: "Share of updates that were HOT (did not write to indexes) since statistics were reset",
+		},
+		[]string{"table"},
+	)
+
+	DBTableAutovacuums = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_autovacuum_count",
+			Help: "Number of times autovacuum vacuumed each table since statistics were reset",
+		},
+		[]string{"table"},
+	)
+
+	DBTableLastAutovacuum = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_table_last_autovacuum_timestamp_seconds",
+			Help: "Unix time autovacuum last vacuumed each table",
+		},
+		[]string{"table"},
+	)
+
+	DBVacuumsRunning = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_vacuums_running",
+			Help: "Number of vacuums running on snailbus tables",
+		},
+	)
+
+	DBMaintenanceAdvice = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_maintenance_advice",
+			Help: "Number of maintenance suggestions from GET /api/v1/admin/db/maintenance",
+		},
+		[]string{"kind", "severity"},
+	)
+
+	// Ingest admission control (see internal/admission)
+	IngestInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingest_in_flight",
+			Help: "Number of ingest requests currently being processed",
+		},
+	)
+
+	IngestQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingest_queue_depth",
+			Help: "Number of ingest requests waiting for a processing slot",
+		},
+	)
+
+	IngestSaturation = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingest_saturation_ratio",
+			Help: "Ratio of ingest processing slots in use",
+		},
+	)
+
+	// Autoscaling signals of this replica (see internal/autoscale)
+	AutoscalingInFlightIngests = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoscaling_in_flight_ingests",
+			Help: "Number of ingest requests currently being processed by this replica",
+		},
+	)
+
+	AutoscalingIngestQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoscaling_ingest_queue_depth",
+			Help: "Number of ingest requests waiting for an admission slot on this replica",
+		},
+	)
+
+	AutoscalingRequestsPerSecond = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoscaling_requests_per_second",
+			Help: "Requests completed per second by this replica over the last minute",
+		},
+	)
+
+	AutoscalingLatencyP95 = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoscaling_handler_latency_p95_seconds",
+			Help: "95th percentile handler latency of this replica over the last minute",
+		},
+	)
+
+	IngestRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_rejected_total",
+			Help: "Total number of ingest requests rejected with 429 because the server was saturated",
+		},
+		[]string{"reason"},
+	)
+
+	// Leader election (see internal/leader)
+	Leader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snailbus_leader",
+			Help: "Whether this replica holds the leader lease and runs the background jobs (1) or not (0)",
+		},
+	)
+
 	// Business metrics
 	HostsIngestedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -102,6 +317,42 @@ var (
 		[]string{"org_id"},
 	)
 
+	// HostsStaleTotal is the number of each organization's unarchived hosts marked stale,
+	// set by checkin.StaleMonitor
+	HostsStaleTotal = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hosts_stale_total",
+			Help: "Number of hosts that missed their check-in window and have not reported since",
+		},
+		[]string{"org_id"},
+	)
+
+	// IngestHostRateLimitedTotal only has series for hosts that exceeded their limit,
+	// which keeps its cardinality to the noisy ones
+	IngestHostRateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_host_rate_limited_total",
+			Help: "Total number of reports rejected because their host exceeded its ingest rate limit",
+		},
+		[]string{"org_id", "host_id"},
+	)
+
+	IngestFieldsStrippedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_fields_stripped_total",
+			Help: "Total number of report data values removed by organization ingest filters",
+		},
+		[]string{"org_id"},
+	)
+
+	IOCMatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ioc_matches_total",
+			Help: "Total number of indicators of compromise found on a host for the first time",
+		},
+		[]string{"org_id"},
+	)
+
 	APIKeysCreatedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "api_keys_created_total",
@@ -117,6 +368,23 @@ var (
 		},
 		[]string{"org_id"},
 	)
+
+	// APIKeyPrefixCandidates counts the keys each API key lookup verifies; more than
+	// one means keys with legacy prefixes share one
+	APIKeyPrefixCandidates = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "api_key_prefix_candidates",
+			Help:    "Number of stored API keys matching the prefix of a presented key",
+			Buckets: []float64{0, 1, 2, 3, 5, 10},
+		},
+	)
+
+	APIKeyPrefixCollisionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "api_key_prefix_collisions_total",
+			Help: "Total number of generated API keys discarded because their prefix was taken",
+		},
+	)
 )
 
 // RegisterDBMetrics registers database connection pool metrics
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/admission"
+)
+
+// IngestAdmission holds each request in an admission slot while it runs
+// Requests that cannot get a slot are answered with 429 and a Retry-After header,
+// so agents back off instead of timing out against a saturated database.
+func IngestAdmission(controller *admission.Controller) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		release, err := controller.Acquire(c.Request.Context())
+		if err != nil {
+			if !errors.Is(err, admission.ErrQueueFull) && !errors.Is(err, admission.ErrQueueTimeout) {
+				// The client went away while queued
+				c.Abort()
+				return
+			}
+
+			// Rejections are counted in ingest_rejected_total rather than logged, since
+			// they come in bursts exactly when the server is busiest
+			retryAfter := controller.RetryAfter()
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "server overloaded",
+				"message":     "Too many reports are being processed; retry later",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		defer release()
+
+		c.Next()
+	}
+}
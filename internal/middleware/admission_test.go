@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/admission"
+)
+
+func TestIngestAdmission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	controller := admission.NewController(1, 0, 2*time.Second)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+
+	r := gin.New()
+	r.Use(IngestAdmission(controller))
+	r.POST("/ingest", func(c *gin.Context) {
+		if c.Query("block") == "true" {
+			close(started)
+			<-unblock
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	// Hold the only slot
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest?block=true", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"retry_after":2`)
+
+	// The slot is released when the request finishes
+	close(unblock)
+	assert.Equal(t, http.StatusCreated, <-done)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
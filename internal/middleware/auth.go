@@ -1,118 +1,42 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 
 	"snailbus/internal/auth"
-	"snailbus/internal/metrics"
+	"snailbus/internal/logger"
 	"snailbus/internal/models"
 	"snailbus/internal/storage"
 )
 
 // AuthMiddleware validates API keys from the X-API-Key header
+// It is an AuthChain with only the API key authenticator; use AuthChain directly
+// to accept other authentication methods
 func AuthMiddleware(store storage.Storage) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Extract API key from header
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey == "" {
-			// Also check Authorization header for backward compatibility
-			authHeader := c.GetHeader("Authorization")
-			if authHeader != "" {
-				// Support both "Bearer <key>" and "ApiKey <key>" formats
-				parts := strings.SplitN(authHeader, " ", 2)
-				if len(parts) == 2 {
-					apiKey = parts[1]
-				}
-			}
-		}
-
-		if apiKey == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "missing API key",
-				"message": "Please provide an API key in the X-API-Key header",
-			})
-			c.Abort()
-			return
-		}
-
-		// Extract prefix for efficient lookup
-		keyPrefix := auth.GetKeyPrefix(apiKey)
-
-		// Get all API keys with this prefix
-		apiKeys, err := store.GetAPIKeyByPrefix(keyPrefix)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "authentication error",
-			})
-			c.Abort()
-			return
-		}
-
-		if len(apiKeys) == 0 {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "invalid API key",
-			})
-			c.Abort()
-			return
-		}
-
-		// Verify the key against all candidates with matching prefix
-		var authenticatedUserID string
-		var apiKeyID string
-		var matchedKey *models.APIKey
-
-		for _, key := range apiKeys {
-			if auth.VerifyAPIKey(apiKey, key.KeyHash) {
-				// Check if expired
-				if auth.IsExpired(key.ExpiresAt) {
-					c.JSON(http.StatusUnauthorized, gin.H{
-						"error": "API key expired",
-					})
-					c.Abort()
-					return
-				}
-
-				matchedKey = key
-				authenticatedUserID = key.UserID
-				apiKeyID = key.ID
-				break
-			}
-		}
-
-		if matchedKey == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "invalid API key",
-			})
-			c.Abort()
-			return
-		}
-
-		// Get user to check if active
-		user, err := store.GetUserByID(authenticatedUserID)
-		if err != nil || !user.IsActive {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "user account is inactive",
-			})
-			c.Abort()
-			return
-		}
-
-		// Set user context
-		c.Set("user_id", authenticatedUserID)
-		c.Set("api_key_id", apiKeyID)
-		c.Set("user", user)
+	return AuthChain(NewAPIKeyAuthenticator(store))
+}
 
-		// Track business metric: API keys used per org
-		metrics.APIKeysUsedTotal.WithLabelValues(user.OrgID).Inc()
+// endpointMatchers caches compiled endpoint matchers keyed by their joined patterns
+var endpointMatchers sync.Map
 
-		// Update last used timestamp (async, don't wait)
-		go store.UpdateAPIKeyLastUsed(apiKeyID)
+// endpointMatcher returns the compiled matcher for an API key's allowed endpoints
+func endpointMatcher(patterns []string) (*auth.EndpointMatcher, error) {
+	cacheKey := strings.Join(patterns, "\n")
+	if matcher, ok := endpointMatchers.Load(cacheKey); ok {
+		return matcher.(*auth.EndpointMatcher), nil
+	}
 
-		c.Next()
+	matcher, err := auth.CompileEndpoints(patterns)
+	if err != nil {
+		return nil, err
 	}
+	endpointMatchers.Store(cacheKey, matcher)
+	return matcher, nil
 }
 
 // AdminMiddleware checks if the authenticated user is an admin
@@ -127,7 +51,7 @@ func AdminMiddleware(store storage.Storage) gin.HandlerFunc {
 			return
 		}
 
-		user, err := store.GetUserByID(userID.(string))
+		user, err := RequestStorage(c.Request.Context(), store).GetUserByID(userID.(string))
 		if err != nil || !user.IsAdmin {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error": "admin access required",
@@ -152,31 +76,16 @@ func AdminMiddleware(store storage.Storage) gin.HandlerFunc {
 //	protected.Use(middleware.RequireRole("admin", "editor"))
 func RequireRole(requiredRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get user from context (set by AuthMiddleware)
-		userValue, exists := c.Get("user")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "unauthorized",
-				"message": "User not found in context. Ensure AuthMiddleware is applied before RequireRole.",
-			})
-			c.Abort()
-			return
-		}
-
-		user, ok := userValue.(*models.User)
+		// Get the caller's role (set by AuthChain/AuthMiddleware)
+		role, ok := contextRole(c)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "internal server error",
-				"message": "Invalid user type in context",
-			})
-			c.Abort()
 			return
 		}
 
-		// Check if user's role matches any of the required roles
+		// Check if the role matches any of the required roles
 		hasRequiredRole := false
 		for _, requiredRole := range requiredRoles {
-			if user.Role == requiredRole {
+			if role == requiredRole {
 				hasRequiredRole = true
 				break
 			}
@@ -187,7 +96,7 @@ func RequireRole(requiredRoles ...string) gin.HandlerFunc {
 				"error":          "insufficient role",
 				"message":        "Your role does not have permission to access this resource",
 				"required_roles": requiredRoles,
-				"your_role":      user.Role,
+				"your_role":      role,
 			})
 			c.Abort()
 			return
@@ -197,10 +106,50 @@ func RequireRole(requiredRoles ...string) gin.HandlerFunc {
 	}
 }
 
+// contextRole returns the authenticated caller's role, preferring the principal
+// and falling back to the user for contexts populated without AuthChain.
+// It aborts the request and returns false when neither is present.
+func contextRole(c *gin.Context) (string, bool) {
+	if principal := GetPrincipal(c); principal != nil {
+		return principal.Role, true
+	}
+
+	userValue, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "User not found in context. Ensure AuthMiddleware is applied before RequireRole.",
+		})
+		c.Abort()
+		return "", false
+	}
+
+	user, ok := userValue.(*models.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal server error",
+			"message": "Invalid user type in context",
+		})
+		c.Abort()
+		return "", false
+	}
+	return user.Role, true
+}
+
+// OrgIDHeader selects the organization a request acts in, for users who are members of
+// organizations other than their own
+const OrgIDHeader = "X-Org-ID"
+
 // OrgContextMiddleware extracts organization ID and role from the authenticated user
 // and makes them easily accessible in handlers via context keys.
 // This middleware must be used after AuthMiddleware, which sets the "user" in the context.
 //
+// Requests act in the user's own organization unless OrgIDHeader names another
+// organization the user is a member of (see storage.GetOrgMembership). The request then
+// acts in that organization with the membership's role: org_id, role, the principal, and
+// the "user" in the context are all switched, so handlers need not know about memberships.
+// Naming an organization the user is not a member of fails with 403.
+//
 // After this middleware, handlers can access:
 //   - org_id: via GetOrgID(c) or c.Get("org_id")
 //   - role: via GetRole(c) or c.Get("role")
@@ -209,13 +158,24 @@ func RequireRole(requiredRoles ...string) gin.HandlerFunc {
 //
 //	protected := v1.Group("")
 //	protected.Use(middleware.AuthMiddleware(store))
-//	protected.Use(middleware.OrgContextMiddleware())
+//	protected.Use(middleware.OrgContextMiddleware(store))
 //	{
 //	    protected.GET("/hosts", h.ListHosts) // Can use GetOrgID(c) in handler
 //	}
-func OrgContextMiddleware() gin.HandlerFunc {
+func OrgContextMiddleware(store storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get user from context (set by AuthMiddleware)
+		// Prefer the principal (set by AuthChain/AuthMiddleware)
+		if principal := GetPrincipal(c); principal != nil {
+			if !selectOrg(c, store, principal) {
+				return
+			}
+			c.Set("org_id", principal.OrgID)
+			c.Set("role", principal.Role)
+			c.Next()
+			return
+		}
+
+		// Fall back to a user placed in context directly
 		userValue, exists := c.Get("user")
 		if !exists {
 			// If user is not in context, this middleware should not be used
@@ -246,6 +206,71 @@ func OrgContextMiddleware() gin.HandlerFunc {
 	}
 }
 
+// selectOrg switches the principal to the organization named by OrgIDHeader, if any.
+// It aborts the request and returns false when the organization cannot be selected.
+func selectOrg(c *gin.Context, store storage.Storage, principal *auth.Principal) bool {
+	orgID := strings.TrimSpace(c.GetHeader(OrgIDHeader))
+	if orgID == "" || orgID == principal.OrgID {
+		return true
+	}
+
+	// Delegated tokens are granted by a user for one organization
+	if principal.Method == auth.MethodOAuth {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "organization cannot be selected",
+			"message": "Delegated tokens act in the organization they were granted for; remove the " + OrgIDHeader + " header.",
+		})
+		c.Abort()
+		return false
+	}
+	// So are impersonation tokens, by a system administrator
+	if principal.Method == auth.MethodImpersonation {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "organization cannot be selected",
+			"message": "Impersonation tokens act in the organization they were issued for; remove the " + OrgIDHeader + " header.",
+		})
+		c.Abort()
+		return false
+	}
+	// Keys issued at enrollment report for their host, in the organization it enrolled in
+	if principal.HostID != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "organization cannot be selected",
+			"message": "API keys issued at enrollment act in the organization the host enrolled in; remove the " + OrgIDHeader + " header.",
+		})
+		c.Abort()
+		return false
+	}
+
+	membership, err := RequestStorage(c.Request.Context(), store).GetOrgMembership(principal.UserID, orgID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "not a member of organization",
+			"message": "You are not a member of the organization in the " + OrgIDHeader + " header. GET /api/v1/auth/orgs lists your organizations.",
+		})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", principal.UserID).Str("org_id", orgID).Msg("Failed to get organization membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to select organization"})
+		c.Abort()
+		return false
+	}
+
+	principal.OrgID = membership.OrgID
+	principal.Role = membership.Role
+	if principal.User != nil {
+		// Handlers reading the user from the context act in the selected organization too
+		acting := *principal.User
+		acting.OrgID = membership.OrgID
+		acting.Role = membership.Role
+		principal.User = &acting
+		c.Set("user", principal.User)
+	}
+	return true
+}
+
 // GetOrgID retrieves the organization ID from the context
 // Returns empty string if not found (should not happen if OrgContextMiddleware is used)
 func GetOrgID(c *gin.Context) string {
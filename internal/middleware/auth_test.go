@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestAuthMiddleware_AllowedEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	user, _ := store.CreateUser("ingester", "ingester@example.com", "hash", org.ID, "editor")
+
+	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	apiKey, err := store.CreateAPIKey(user.ID, keyHash, keyPrefix, "integration", nil)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(store))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/v1/ingest", ok)
+	r.GET("/api/v1/hosts", ok)
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", plainKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Unrestricted keys reach every endpoint
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/v1/ingest"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/v1/hosts"))
+
+	require.NoError(t, store.SetAPIKeyAllowedEndpoints(apiKey.ID, []string{"POST /api/v1/ingest"}))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/v1/ingest"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/v1/hosts"))
+
+	// Clearing the restriction restores full access
+	require.NoError(t, store.SetAPIKeyAllowedEndpoints(apiKey.ID, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/v1/hosts"))
+}
+
+func TestOrgContextMiddleware_SelectOrg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	home, _ := store.CreateOrganization("Home Org")
+	other, _ := store.CreateOrganization("Other Org")
+	stranger, _ := store.CreateOrganization("Stranger Org")
+	user, _ := store.CreateUser("alice", "alice@example.com", "hash", home.ID, "admin")
+	_, err := store.AddOrgMembership(user.ID, other.ID, "viewer")
+	require.NoError(t, err)
+
+	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	_, err = store.CreateAPIKey(user.ID, keyHash, keyPrefix, "cli", nil)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(store), OrgContextMiddleware(store))
+	r.GET("/whoami", func(c *gin.Context) {
+		acting, _ := c.Get("user")
+		c.JSON(http.StatusOK, gin.H{
+			"org_id":    GetOrgID(c),
+			"role":      GetRole(c),
+			"principal": GetPrincipal(c).OrgID,
+			"user":      acting.(*models.User).OrgID,
+		})
+	})
+
+	do := func(orgID string) (int, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set("X-API-Key", plainKey)
+		if orgID != "" {
+			req.Header.Set(OrgIDHeader, orgID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	// Without the header, and with the user's own organization, requests act at home
+	for _, orgID := range []string{"", home.ID} {
+		code, body := do(orgID)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]string{"org_id": home.ID, "role": "admin", "principal": home.ID, "user": home.ID}, body)
+	}
+
+	// A membership switches the organization and role everywhere handlers look
+	code, body := do(other.ID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"org_id": other.ID, "role": "viewer", "principal": other.ID, "user": other.ID}, body)
+
+	code, _ = do(stranger.ID)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// The stored user is not changed by acting in another organization
+	stored, err := store.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, home.ID, stored.OrgID)
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/auth"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries no
+// credentials for its method, so the next authenticator in the chain is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator turns the credentials on a request into a Principal
+//
+// Authenticate returns ErrNoCredentials when the request has nothing for this
+// method, an *AuthError when credentials were presented but rejected, and any
+// other error when verification itself failed (reported as a 500).
+type Authenticator interface {
+	Name() string
+	Authenticate(r *http.Request) (*auth.Principal, error)
+}
+
+// authenticatedHook is implemented by authenticators that record successful use
+// of a credential once the chain has authorized the request
+type authenticatedHook interface {
+	Authenticated(p *auth.Principal)
+}
+
+// AuthError rejects a request with the given status and error body
+type AuthError struct {
+	Status  int
+	Code    string // Short error, returned as "error"
+	Message string // Optional detail, returned as "message"
+}
+
+func (e *AuthError) Error() string {
+	return e.Code
+}
+
+// unauthorized is a convenience for the common 401 AuthError
+func unauthorized(code string) *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized, Code: code}
+}
+
+// AuthChain authenticates requests with the first authenticator that finds
+// credentials on them. Credentials that are present but invalid fail the request
+// without falling through to later authenticators.
+//
+// On success the chain stores the *auth.Principal under "principal" (see
+// GetPrincipal) along with the user_id, user, api_key_id, and impersonator_id keys
+// that handlers and later middleware read.
+func AuthChain(authenticators ...Authenticator) gin.HandlerFunc {
+	names := make([]string, len(authenticators))
+	for i, a := range authenticators {
+		names[i] = a.Name()
+	}
+
+	return func(c *gin.Context) {
+		var principal *auth.Principal
+		var authenticator Authenticator
+
+		for _, a := range authenticators {
+			p, err := a.Authenticate(c.Request)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				abortAuth(c, err)
+				return
+			}
+			principal, authenticator = p, a
+			break
+		}
+
+		if principal == nil {
+			abortAuth(c, missingCredentials(names))
+			return
+		}
+
+		// Enforce credential scopes (fail closed if the patterns don't compile)
+		if len(principal.Scopes) > 0 {
+			matcher, err := endpointMatcher(principal.Scopes)
+			if err != nil || !matcher.Allows(c.Request.Method, c.Request.URL.Path) {
+				abortAuth(c, &AuthError{
+					Status:  http.StatusForbidden,
+					Code:    "endpoint not allowed",
+					Message: "This credential is not permitted to call this endpoint",
+				})
+				return
+			}
+		}
+
+		if principal.User == nil || !principal.User.IsActive {
+			abortAuth(c, unauthorized("user account is inactive"))
+			return
+		}
+
+		c.Set("principal", principal)
+		c.Set("user_id", principal.UserID)
+		c.Set("user", principal.User)
+		if principal.Method == auth.MethodAPIKey {
+			c.Set("api_key_id", principal.CredentialID)
+		}
+		if principal.Impersonator != nil {
+			c.Set("impersonator_id", principal.Impersonator.ID)
+		}
+
+		if hook, ok := authenticator.(authenticatedHook); ok {
+			hook.Authenticated(principal)
+		}
+
+		c.Next()
+	}
+}
+
+// missingCredentials describes what the chain accepts when no authenticator matched
+func missingCredentials(methods []string) *AuthError {
+	if len(methods) == 1 && methods[0] == auth.MethodAPIKey {
+		return &AuthError{
+			Status:  http.StatusUnauthorized,
+			Code:    "missing API key",
+			Message: "Please provide an API key in the X-API-Key header",
+		}
+	}
+	return &AuthError{
+		Status:  http.StatusUnauthorized,
+		Code:    "missing credentials",
+		Message: "Please authenticate with one of: " + strings.Join(methods, ", "),
+	}
+}
+
+// abortAuth writes the error response for a failed authentication
+func abortAuth(c *gin.Context, err error) {
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		authErr = &AuthError{Status: http.StatusInternalServerError, Code: "authentication error"}
+	}
+
+	body := gin.H{"error": authErr.Code}
+	if authErr.Message != "" {
+		body["message"] = authErr.Message
+	}
+	c.JSON(authErr.Status, body)
+	c.Abort()
+}
+
+// GetPrincipal retrieves the authenticated principal from the context
+// Returns nil if the request was not authenticated by AuthChain
+func GetPrincipal(c *gin.Context) *auth.Principal {
+	value, exists := c.Get("principal")
+	if !exists {
+		return nil
+	}
+	principal, _ := value.(*auth.Principal)
+	return principal
+}
@@ -0,0 +1,377 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+func TestAuthChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	user, _ := store.CreateUser("agent", "agent@example.com", "hash", org.ID, "editor")
+
+	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	_, err = store.CreateAPIKey(user.ID, keyHash, keyPrefix, "agent", nil)
+	require.NoError(t, err)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	sign := func(claims *auth.Claims) string {
+		token, err := auth.SignJWT(claims, secret)
+		require.NoError(t, err)
+		return token
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+
+	r := gin.New()
+	r.Use(AuthChain(
+		NewJWTAuthenticator(store, secret, "snailbus", "api"),
+		NewAPIKeyAuthenticator(store),
+		NewMTLSAuthenticator(store),
+	))
+	whoami := func(c *gin.Context) {
+		p := GetPrincipal(c)
+		c.JSON(http.StatusOK, gin.H{"method": p.Method, "user_id": c.GetString("user_id")})
+	}
+	r.GET("/api/v1/hosts", whoami)
+	r.POST("/api/v1/ingest", whoami)
+
+	do := func(method string, setup func(*http.Request)) (int, map[string]string) {
+		req := httptest.NewRequest(method, "/api/v1/hosts", nil)
+		if method == http.MethodPost {
+			req = httptest.NewRequest(method, "/api/v1/ingest", nil)
+		}
+		setup(req)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	t.Run("api key header", func(t *testing.T) {
+		code, body := do(http.MethodGet, func(r *http.Request) { r.Header.Set("X-API-Key", plainKey) })
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, auth.MethodAPIKey, body["method"])
+		assert.Equal(t, user.ID, body["user_id"])
+	})
+
+	t.Run("api key as bearer token", func(t *testing.T) {
+		code, body := do(http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+plainKey) })
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, auth.MethodAPIKey, body["method"])
+	})
+
+	t.Run("jwt", func(t *testing.T) {
+		token := sign(&auth.Claims{Subject: user.ID, Issuer: "snailbus", Audience: auth.Audience{"api"}, ExpiresAt: expires})
+		code, body := do(http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, auth.MethodJWT, body["method"])
+		assert.Equal(t, user.ID, body["user_id"])
+	})
+
+	t.Run("invalid jwt does not fall through", func(t *testing.T) {
+		wrongAudience := sign(&auth.Claims{Subject: user.ID, Issuer: "snailbus", Audience: auth.Audience{"web"}, ExpiresAt: expires})
+		code, body := do(http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+wrongAudience) })
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "invalid token", body["error"])
+
+		expired := sign(&auth.Claims{Subject: user.ID, Issuer: "snailbus", Audience: auth.Audience{"api"}, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+		code, body = do(http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+expired) })
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "token expired", body["error"])
+	})
+
+	t.Run("jwt endpoint scopes", func(t *testing.T) {
+		token := sign(&auth.Claims{
+			Subject: user.ID, Issuer: "snailbus", Audience: auth.Audience{"api"}, ExpiresAt: expires,
+			AllowedEndpoints: []string{"POST /api/v1/ingest"},
+		})
+		bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+		code, _ := do(http.MethodPost, bearer)
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = do(http.MethodGet, bearer)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("mtls", func(t *testing.T) {
+		cert := &x509.Certificate{SerialNumber: big.NewInt(0xbeef), Subject: pkix.Name{CommonName: "agent"}}
+		code, body := do(http.MethodGet, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, auth.MethodMTLS, body["method"])
+
+		unknown := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "nobody"}}
+		code, _ = do(http.MethodGet, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{unknown}}}
+		})
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("missing credentials", func(t *testing.T) {
+		code, body := do(http.MethodGet, func(r *http.Request) {})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "missing credentials", body["error"])
+		assert.Contains(t, body["message"], "jwt, api_key, mtls")
+	})
+}
+
+func TestOAuthAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	user, _ := store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	require.NoError(t, store.CreateOAuthClient(&models.OAuthClient{ID: "client-1", OrgID: org.ID, Name: "Dashboard"}))
+
+	grant := func(id string, expiresAt time.Time) (access, refresh string) {
+		access, accessHash, err := auth.GenerateOAuthToken(auth.OAuthAccessTokenPrefix)
+		require.NoError(t, err)
+		refresh, refreshHash, err := auth.GenerateOAuthToken(auth.OAuthRefreshTokenPrefix)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateOAuthGrant(&models.OAuthGrant{
+			ID: id, ClientID: "client-1", UserID: user.ID, OrgID: org.ID, Scopes: []string{"hosts:read"},
+			Token: models.OAuthToken{AccessHash: accessHash, RefreshHash: refreshHash, ExpiresAt: expiresAt},
+		}))
+		return access, refresh
+	}
+	access, refresh := grant("grant-1", time.Now().Add(time.Hour))
+	expired, _ := grant("grant-2", time.Now().Add(-time.Minute))
+
+	r := gin.New()
+	r.Use(AuthChain(NewOAuthAuthenticator(store), NewAPIKeyAuthenticator(store)))
+	whoami := func(c *gin.Context) {
+		p := GetPrincipal(c)
+		c.JSON(http.StatusOK, gin.H{"method": p.Method, "credential_id": p.CredentialID})
+	}
+	r.GET("/api/v1/hosts", whoami)
+	r.GET("/api/v1/api-keys", whoami)
+
+	do := func(path, token string) (int, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := do("/api/v1/hosts", access)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, auth.MethodOAuth, body["method"])
+	assert.Equal(t, "grant-1", body["credential_id"])
+
+	// Scopes limit the token to its endpoints
+	code, _ = do("/api/v1/api-keys", access)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Expired access tokens and refresh tokens are rejected, not tried as API keys
+	code, body = do("/api/v1/hosts", expired)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid or expired token", body["error"])
+	code, body = do("/api/v1/hosts", refresh)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid token", body["error"])
+
+	// Revoking the grant revokes the token
+	require.NoError(t, store.DeleteOAuthGrant("grant-1", user.ID))
+	code, _ = do("/api/v1/hosts", access)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestSessionAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	user, _ := store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+
+	session := func(id string, expiresAt time.Time) (access, refresh string) {
+		access, accessHash, err := auth.GenerateOAuthToken(auth.SessionAccessTokenPrefix)
+		require.NoError(t, err)
+		refresh, refreshHash, err := auth.GenerateOAuthToken(auth.SessionRefreshTokenPrefix)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateSession(&models.Session{
+			ID: id, UserID: user.ID, OrgID: org.ID, ExpiresAt: time.Now().Add(24 * time.Hour),
+			Token: models.SessionToken{AccessHash: accessHash, RefreshHash: refreshHash, ExpiresAt: expiresAt},
+		}))
+		return access, refresh
+	}
+	access, refresh := session("session-1", time.Now().Add(15*time.Minute))
+	expired, _ := session("session-2", time.Now().Add(-time.Minute))
+
+	r := gin.New()
+	r.Use(AuthChain(NewSessionAuthenticator(store), NewAPIKeyAuthenticator(store)))
+	r.GET("/api/v1/hosts", func(c *gin.Context) {
+		p := GetPrincipal(c)
+		c.JSON(http.StatusOK, gin.H{"method": p.Method, "credential_id": p.CredentialID})
+	})
+
+	do := func(token string) (int, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := do(access)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, auth.MethodSession, body["method"])
+	assert.Equal(t, "session-1", body["credential_id"])
+
+	// Expired access tokens and refresh tokens are rejected, not tried as API keys
+	code, body = do(expired)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid or expired token", body["error"])
+	code, body = do(refresh)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid token", body["error"])
+
+	// Ending the session revokes its token
+	require.NoError(t, store.DeleteSession("session-1", user.ID))
+	code, _ = do(access)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestImpersonationAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	other, _ := store.CreateOrganization("Other Org")
+	user, _ := store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	admin, _ := store.CreateUser("operator", "operator@example.com", "hash", other.ID, "admin")
+	require.NoError(t, store.SetUserSystemAdmin(admin.ID, true))
+	_, err := store.AddOrgMembership(user.ID, other.ID, "viewer")
+	require.NoError(t, err)
+
+	issue := func(id string, expiresAt time.Time) string {
+		token, tokenHash, err := auth.GenerateOAuthToken(auth.ImpersonationTokenPrefix)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateImpersonationToken(&models.ImpersonationToken{
+			ID: id, AdminUserID: admin.ID, UserID: user.ID, OrgID: org.ID,
+			TokenHash: tokenHash, Reason: "ticket 42", ExpiresAt: expiresAt,
+		}))
+		return token
+	}
+	token := issue("token-1", time.Now().Add(15*time.Minute))
+	expired := issue("token-2", time.Now().Add(-time.Minute))
+
+	r := gin.New()
+	r.Use(AuthChain(NewImpersonationAuthenticator(store), NewAPIKeyAuthenticator(store)))
+	r.Use(OrgContextMiddleware(store))
+	r.GET("/api/v1/hosts", func(c *gin.Context) {
+		p := GetPrincipal(c)
+		c.JSON(http.StatusOK, gin.H{
+			"method":          p.Method,
+			"user_id":         p.UserID,
+			"org_id":          GetOrgID(c),
+			"impersonator_id": c.GetString("impersonator_id"),
+		})
+	})
+
+	do := func(token, orgID string) (int, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if orgID != "" {
+			req.Header.Set(OrgIDHeader, orgID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	// The token acts as the user, in their organization, and names the administrator
+	code, body := do(token, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, auth.MethodImpersonation, body["method"])
+	assert.Equal(t, user.ID, body["user_id"])
+	assert.Equal(t, org.ID, body["org_id"])
+	assert.Equal(t, admin.ID, body["impersonator_id"])
+
+	// It cannot select the user's other organizations
+	code, _ = do(token, other.ID)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Expired tokens are rejected, not tried as API keys
+	code, body = do(expired, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid or expired token", body["error"])
+
+	// Tokens stop working when the administrator loses the flag
+	require.NoError(t, store.SetUserSystemAdmin(admin.ID, false))
+	code, _ = do(token, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAPIKeyAuthenticator_Prefixes(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Test Org")
+	user, _ := store.CreateUser("agent", "agent@example.com", "hash", org.ID, "editor")
+	authenticator := NewAPIKeyAuthenticator(store)
+
+	authenticate := func(key string) (*auth.Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+		req.Header.Set("X-API-Key", key)
+		return authenticator.Authenticate(req)
+	}
+
+	plainKey, apiKey, err := storage.GenerateAPIKey(store, user.ID, "agent", nil)
+	require.NoError(t, err)
+	assert.Len(t, apiKey.KeyPrefix, auth.APIKeyPrefixLength)
+	p, err := authenticate(plainKey)
+	require.NoError(t, err)
+	assert.Equal(t, apiKey.ID, p.CredentialID)
+
+	// Keys stored before prefixes were lengthened are found by their legacy prefix
+	legacyKey, keyHash, _, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	legacy, err := store.CreateAPIKey(user.ID, keyHash, legacyKey[:auth.LegacyAPIKeyPrefixLength], "legacy", nil)
+	require.NoError(t, err)
+	p, err = authenticate(legacyKey)
+	require.NoError(t, err)
+	assert.Equal(t, legacy.ID, p.CredentialID)
+
+	// Malformed keys are refused without a lookup
+	for _, key := range []string{"short", plainKey[:40], plainKey[:43] + "!"} {
+		_, err := authenticate(key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestAuthMiddleware_MissingAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(storage.NewMockStorage()))
+	r.GET("/api/v1/hosts", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "missing API key")
+}
@@ -0,0 +1,359 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/metrics"
+	"snailbus/internal/storage"
+)
+
+// bearerToken returns the credential from an "Authorization: <scheme> <credential>" header
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// APIKeyAuthenticator authenticates API keys from the X-API-Key header,
+// or from "Authorization: Bearer <key>" / "ApiKey <key>" for backward compatibility
+type APIKeyAuthenticator struct {
+	store storage.Storage
+}
+
+// NewAPIKeyAuthenticator creates an API key authenticator
+func NewAPIKeyAuthenticator(store storage.Storage) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *APIKeyAuthenticator) Name() string {
+	return auth.MethodAPIKey
+}
+
+// Authenticate verifies the API key against the stored key hashes
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		// Bearer JWTs, delegated tokens, session tokens, and impersonation tokens belong to their own authenticators
+		if token := bearerToken(r); !auth.LooksLikeJWT(token) && !auth.LooksLikeOAuthToken(token) &&
+			!auth.LooksLikeSessionToken(token) && !auth.LooksLikeImpersonationToken(token) {
+			apiKey = token
+		}
+	}
+	if apiKey == "" {
+		return nil, ErrNoCredentials
+	}
+
+	if !auth.IsAPIKeyFormat(apiKey) {
+		return nil, unauthorized("invalid API key")
+	}
+
+	// Get all API keys with this prefix
+	apiKeys, err := RequestStorage(r.Context(), a.store).GetAPIKeyByPrefix(auth.GetKeyPrefixes(apiKey)...)
+	if err != nil {
+		return nil, err
+	}
+	metrics.APIKeyPrefixCandidates.Observe(float64(len(apiKeys)))
+
+	// Verify the key against all candidates with matching prefix
+	for _, key := range apiKeys {
+		if !auth.VerifyAPIKey(apiKey, key.KeyHash) {
+			continue
+		}
+		if auth.IsExpired(key.ExpiresAt) {
+			return nil, unauthorized("API key expired")
+		}
+
+		user, err := RequestStorage(r.Context(), a.store).GetUserByID(key.UserID)
+		if err != nil {
+			return nil, unauthorized("user account is inactive")
+		}
+		principal := auth.NewUserPrincipal(user, auth.MethodAPIKey, key.ID, key.AllowedEndpoints)
+		principal.HostID = key.HostID
+		return principal, nil
+	}
+
+	return nil, unauthorized("invalid API key")
+}
+
+// Authenticated records API key usage
+func (a *APIKeyAuthenticator) Authenticated(p *auth.Principal) {
+	// Track business metric: API keys used per org
+	metrics.APIKeysUsedTotal.WithLabelValues(p.OrgID).Inc()
+
+	// Update last used timestamp (async, don't wait)
+	go a.store.UpdateAPIKeyLastUsed(p.CredentialID)
+}
+
+// JWTAuthenticator authenticates HS256 JWTs from "Authorization: Bearer <token>"
+// The sub claim is the user ID; the user's current org and role apply.
+type JWTAuthenticator struct {
+	store    storage.Storage
+	secret   []byte
+	issuer   string // Required iss claim, if set
+	audience string // Required aud entry, if set
+}
+
+// NewJWTAuthenticator creates a JWT authenticator; issuer and audience are optional
+func NewJWTAuthenticator(store storage.Storage, secret []byte, issuer, audience string) *JWTAuthenticator {
+	return &JWTAuthenticator{store: store, secret: secret, issuer: issuer, audience: audience}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *JWTAuthenticator) Name() string {
+	return auth.MethodJWT
+}
+
+// Authenticate verifies the token signature, lifetime, issuer, and audience
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("X-API-Key") != "" {
+		return nil, ErrNoCredentials
+	}
+	token := bearerToken(r)
+	if !auth.LooksLikeJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := auth.ParseJWT(token, a.secret, time.Now())
+	if err == auth.ErrTokenExpired {
+		return nil, unauthorized("token expired")
+	}
+	if err != nil {
+		return nil, unauthorized("invalid token")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, unauthorized("invalid token")
+	}
+	if a.audience != "" && !claims.Audience.Contains(a.audience) {
+		return nil, unauthorized("invalid token")
+	}
+
+	user, err := RequestStorage(r.Context(), a.store).GetUserByID(claims.Subject)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid token")
+		}
+		return nil, err
+	}
+	return auth.NewUserPrincipal(user, auth.MethodJWT, claims.ID, claims.AllowedEndpoints), nil
+}
+
+// OAuthAuthenticator authenticates delegated access tokens from "Authorization: Bearer <token>"
+// The token acts as the user who authorized it, limited to the endpoints of its scopes.
+type OAuthAuthenticator struct {
+	store storage.Storage
+}
+
+// NewOAuthAuthenticator creates a delegated token authenticator
+func NewOAuthAuthenticator(store storage.Storage) *OAuthAuthenticator {
+	return &OAuthAuthenticator{store: store}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *OAuthAuthenticator) Name() string {
+	return auth.MethodOAuth
+}
+
+// Authenticate looks the access token up by its hash
+func (a *OAuthAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("X-API-Key") != "" {
+		return nil, ErrNoCredentials
+	}
+	token := bearerToken(r)
+	if !auth.LooksLikeOAuthToken(token) {
+		return nil, ErrNoCredentials
+	}
+	if !strings.HasPrefix(token, auth.OAuthAccessTokenPrefix) {
+		return nil, unauthorized("invalid token")
+	}
+
+	grant, err := RequestStorage(r.Context(), a.store).GetOAuthGrantByAccessToken(auth.HashOAuthToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid or expired token")
+		}
+		return nil, err
+	}
+
+	user, err := RequestStorage(r.Context(), a.store).GetUserByID(grant.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid token")
+		}
+		return nil, err
+	}
+	// Grants do not follow a user into another organization
+	if user.OrgID != grant.OrgID {
+		return nil, unauthorized("invalid token")
+	}
+	return auth.NewUserPrincipal(user, auth.MethodOAuth, grant.ID, auth.OAuthScopeEndpoints(grant.Scopes)), nil
+}
+
+// Authenticated records delegated token usage
+func (a *OAuthAuthenticator) Authenticated(p *auth.Principal) {
+	go a.store.UpdateOAuthGrantLastUsed(p.CredentialID)
+}
+
+// SessionAuthenticator authenticates Web UI session access tokens from "Authorization: Bearer <token>"
+// The session acts as the user who logged in, with the user's current role.
+type SessionAuthenticator struct {
+	store storage.Storage
+}
+
+// NewSessionAuthenticator creates a session authenticator
+func NewSessionAuthenticator(store storage.Storage) *SessionAuthenticator {
+	return &SessionAuthenticator{store: store}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *SessionAuthenticator) Name() string {
+	return auth.MethodSession
+}
+
+// Authenticate looks the access token up by its hash
+func (a *SessionAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("X-API-Key") != "" {
+		return nil, ErrNoCredentials
+	}
+	token := bearerToken(r)
+	if !auth.LooksLikeSessionToken(token) {
+		return nil, ErrNoCredentials
+	}
+	if !strings.HasPrefix(token, auth.SessionAccessTokenPrefix) {
+		return nil, unauthorized("invalid token")
+	}
+
+	session, err := RequestStorage(r.Context(), a.store).GetSessionByAccessToken(auth.HashOAuthToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid or expired token")
+		}
+		return nil, err
+	}
+
+	user, err := RequestStorage(r.Context(), a.store).GetUserByID(session.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid token")
+		}
+		return nil, err
+	}
+	// Sessions do not follow a user into another organization
+	if user.OrgID != session.OrgID {
+		return nil, unauthorized("invalid token")
+	}
+	return auth.NewUserPrincipal(user, auth.MethodSession, session.ID, nil), nil
+}
+
+// Authenticated records session usage
+func (a *SessionAuthenticator) Authenticated(p *auth.Principal) {
+	go a.store.UpdateSessionLastUsed(p.CredentialID)
+}
+
+// ImpersonationAuthenticator authenticates impersonation tokens from "Authorization: Bearer <token>"
+// The token acts as the user it was issued for, in the organization they were in then, and
+// the principal carries the system administrator who requested it.
+type ImpersonationAuthenticator struct {
+	store storage.Storage
+}
+
+// NewImpersonationAuthenticator creates an impersonation token authenticator
+func NewImpersonationAuthenticator(store storage.Storage) *ImpersonationAuthenticator {
+	return &ImpersonationAuthenticator{store: store}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *ImpersonationAuthenticator) Name() string {
+	return auth.MethodImpersonation
+}
+
+// Authenticate looks the token up by its hash
+func (a *ImpersonationAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("X-API-Key") != "" {
+		return nil, ErrNoCredentials
+	}
+	token := bearerToken(r)
+	if !auth.LooksLikeImpersonationToken(token) {
+		return nil, ErrNoCredentials
+	}
+
+	impersonation, err := RequestStorage(r.Context(), a.store).GetImpersonationToken(auth.HashOAuthToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid or expired token")
+		}
+		return nil, err
+	}
+
+	user, err := RequestStorage(r.Context(), a.store).GetUserByID(impersonation.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid token")
+		}
+		return nil, err
+	}
+	// Tokens do not follow a user into another organization, or past becoming a system administrator
+	if user.OrgID != impersonation.OrgID || user.IsAdmin {
+		return nil, unauthorized("invalid token")
+	}
+	// Tokens stop working when the administrator loses the flag
+	admin, err := RequestStorage(r.Context(), a.store).GetUserByID(impersonation.AdminUserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("invalid token")
+		}
+		return nil, err
+	}
+	if !admin.IsAdmin || !admin.IsActive {
+		return nil, unauthorized("invalid token")
+	}
+
+	principal := auth.NewUserPrincipal(user, auth.MethodImpersonation, impersonation.ID, nil)
+	principal.Impersonator = admin
+	return principal, nil
+}
+
+// MTLSAuthenticator authenticates verified TLS client certificates
+// The certificate's subject common name is the username. Certificates are
+// verified against TLS_CLIENT_CA_FILE by the TLS server before this runs.
+type MTLSAuthenticator struct {
+	store storage.Storage
+}
+
+// NewMTLSAuthenticator creates a client certificate authenticator
+func NewMTLSAuthenticator(store storage.Storage) *MTLSAuthenticator {
+	return &MTLSAuthenticator{store: store}
+}
+
+// Name returns the AUTH_METHODS name of the authenticator
+func (a *MTLSAuthenticator) Name() string {
+	return auth.MethodMTLS
+}
+
+// Authenticate maps the verified client certificate to a user
+func (a *MTLSAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	username := cert.Subject.CommonName
+	if username == "" {
+		return nil, unauthorized("client certificate has no common name")
+	}
+
+	user, _, err := RequestStorage(r.Context(), a.store).GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, unauthorized("unknown client certificate")
+		}
+		return nil, err
+	}
+	return auth.NewUserPrincipal(user, auth.MethodMTLS, cert.SerialNumber.Text(16), nil), nil
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/autoscale"
+)
+
+// AutoscaleMiddleware records the latency of every request in the autoscaling tracker
+// Requests that match no route are skipped, like in ErrorRateMiddleware.
+func AutoscaleMiddleware(tracker *autoscale.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if c.FullPath() == "" {
+			return
+		}
+		tracker.Observe(time.Since(start))
+	}
+}
+
+// AutoscaleIngest counts the request as an in-flight ingest while it runs
+// Add it after IngestAdmission so ingests waiting for a slot are not counted twice.
+func AutoscaleIngest(tracker *autoscale.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done := tracker.StartIngest()
+		defer done()
+		c.Next()
+	}
+}
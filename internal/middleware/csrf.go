@@ -149,6 +149,8 @@ func isAuthEndpoint(path string) bool {
 		"/api/v1/auth/login",
 		"/api/v1/auth/register",
 		"/api/v1/auth/api-key",
+		"/api/v1/oauth/token",  // Called server-to-server by third-party clients
+		"/api/v1/oauth/revoke", // Called server-to-server by third-party clients
 	}
 
 	for _, endpoint := range authEndpoints {
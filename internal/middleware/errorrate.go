@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/errorrate"
+)
+
+// ErrorRateMiddleware records every response in the error rate tracker
+// Requests that match no route are skipped so probes for random paths cannot
+// grow the tracked endpoint set
+func ErrorRateMiddleware(tracker *errorrate.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			return
+		}
+		tracker.Record(c.Request.Method+" "+route, c.Writer.Status())
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/apierror"
+	"snailbus/internal/logger"
+)
+
+// ErrorHandler renders the last error a handler passed to c.Error, if the handler did not
+// write a response itself, with the status and JSON envelope of its kind (see
+// apierror.From). Internal errors are logged with their cause; the client only sees the
+// error's message. Add it after ErrorRequestID and Recovery so its responses carry the
+// request ID, and after middleware that reads the response status once the handler
+// returns (metrics, error rates, usage) so that it sees the rendered status. Middleware
+// added after it must write their own responses rather than use c.Error.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		apiErr := apierror.From(c.Errors.Last().Err)
+		status := apiErr.Status()
+		if apiErr.Err != nil && status >= 500 {
+			logger.FromContext(c).
+				Err(apiErr.Err).
+				Str("response", apiErr.Message).
+				Msg("Request failed with an internal error")
+		}
+		c.AbortWithStatusJSON(status, apiErr.Body())
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/apierror"
+)
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), ErrorRequestID(), ErrorHandler())
+	fail := func(err error) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			_ = c.Error(err)
+		}
+	}
+	r.GET("/not-found", fail(apierror.NotFound("host group not found")))
+	r.GET("/forbidden", fail(apierror.Forbidden("user not in your organization").WithDetail("You can only manage users in your own organization.")))
+	r.GET("/validation", fail(apierror.Validation("invalid rule").WithField("rule")))
+	r.GET("/wrapped", fail(fmt.Errorf("saving group: %w", apierror.Conflict("host group name already exists"))))
+	r.GET("/sentinel", fail(fmt.Errorf("query: %w", apierror.ErrNotFound)))
+	r.GET("/internal", fail(apierror.Internal("failed to list host groups", errors.New("connection refused"))))
+	r.GET("/unknown", fail(errors.New("pq: relation does not exist")))
+	r.GET("/written", func(c *gin.Context) {
+		_ = c.Error(apierror.NotFound("ignored"))
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/not-found", http.StatusNotFound, `{"error": "host group not found", "request_id": "req-1"}`},
+		{"/forbidden", http.StatusForbidden, `{"error": "user not in your organization", "message": "You can only manage users in your own organization.", "request_id": "req-1"}`},
+		{"/validation", http.StatusBadRequest, `{"error": "invalid rule", "field": "rule", "request_id": "req-1"}`},
+		{"/wrapped", http.StatusConflict, `{"error": "host group name already exists", "request_id": "req-1"}`},
+		{"/sentinel", http.StatusNotFound, `{"error": "not found", "request_id": "req-1"}`},
+		{"/internal", http.StatusInternalServerError, `{"error": "failed to list host groups", "request_id": "req-1"}`},
+		// The text of unclassified errors is not shown
+		{"/unknown", http.StatusInternalServerError, `{"error": "internal server error", "request_id": "req-1"}`},
+		{"/written", http.StatusOK, `{"ok": true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestErrorHandler_StatusSeenByOuterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Middleware added before ErrorHandler, like metrics and error rates, sees the rendered status
+	var recorded int
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		recorded = c.Writer.Status()
+	}, ErrorHandler())
+	r.GET("/internal", func(c *gin.Context) {
+		_ = c.Error(apierror.Internal("failed to list hosts", errors.New("connection refused")))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusInternalServerError, recorded)
+}
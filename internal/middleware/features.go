@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/features"
+)
+
+// RequireFeature hides a route from organizations the feature flag is not enabled for
+// They get 404, as if the route did not exist. Must run after OrgContextMiddleware.
+func RequireFeature(checker *features.Checker, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checker.Enabled(GetOrgID(c), name) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/jsonapi"
+	"snailbus/internal/logger"
+)
+
+// jsonAPIWriter buffers JSON responses so they can be rewritten once the handler is done
+// Other responses, such as CSV exports and event streams, are written through as they are produced.
+type jsonAPIWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+// decide buffers the response if the handler is writing JSON
+func (w *jsonAPIWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+func (w *jsonAPIWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *jsonAPIWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *jsonAPIWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.buffering {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *jsonAPIWriter) Flush() {
+	w.decide()
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// JSONAPI renders JSON responses as JSON:API documents for clients that send
+// Accept: application/vnd.api+json. Handlers are unchanged; see package jsonapi
+// for how responses are mapped.
+func JSONAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		if !jsonapi.Wants(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &jsonAPIWriter{ResponseWriter: original}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.body.Bytes()
+		var route *jsonapi.Route
+		if r, ok := jsonapi.Routes[c.Request.Method+" "+c.FullPath()]; ok {
+			route = &r
+		}
+		converted, ok, err := jsonapi.Convert(route, original.Status(), body, c.Request.URL.RequestURI())
+		if err != nil {
+			logger.FromContext(c).Err(err).Msg("Failed to render JSON:API response")
+		}
+		if err == nil && ok {
+			original.Header().Set("Content-Type", jsonapi.MediaType)
+			body = converted
+		}
+		original.Header().Del("Content-Length")
+		if _, err := original.Write(body); err != nil {
+			logger.FromContext(c).Err(err).Msg("Failed to write response")
+		}
+	}
+}
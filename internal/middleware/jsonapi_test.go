@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/jsonapi"
+)
+
+func TestJSONAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(JSONAPI())
+	r.GET("/api/v1/actions/:id", func(c *gin.Context) {
+		if c.Param("id") == "missing" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "action not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "name": "Webhook"})
+	})
+	r.GET("/api/v1/hosts/export", func(c *gin.Context) {
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("host_id\nh1\n")
+		c.Writer.Flush()
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Plain JSON is unchanged
+	w := get("/api/v1/actions/a1", "application/json")
+	assert.JSONEq(t, `{"id": "a1", "name": "Webhook"}`, w.Body.String())
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	w = get("/api/v1/actions/a1", jsonapi.MediaType)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jsonapi.MediaType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"data": {"type": "actions", "id": "a1", "attributes": {"name": "Webhook"},
+			"links": {"self": "/api/v1/actions/a1", "runs": "/api/v1/actions/a1/runs"}},
+		"links": {"self": "/api/v1/actions/a1"}
+	}`, w.Body.String())
+
+	w = get("/api/v1/actions/missing", jsonapi.MediaType)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"errors": [{"status": "404", "title": "action not found"}]}`, w.Body.String())
+
+	// Non-JSON responses stream through
+	w = get("/api/v1/hosts/export", jsonapi.MediaType)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "host_id\nh1\n", w.Body.String())
+}
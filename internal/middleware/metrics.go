@@ -8,7 +8,14 @@ import (
 	"snailbus/internal/metrics"
 )
 
+// UnmatchedEndpoint is the endpoint label of requests that match no route
+// Labelling them with their path would let scanners probing random URLs create
+// a new series per path
+const UnmatchedEndpoint = "unmatched"
+
 // MetricsMiddleware tracks HTTP request metrics
+// Requests are labelled with the route pattern (e.g. /api/v1/hosts/:host_id), not the
+// request path, so one series covers every host
 func MetricsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -19,10 +26,9 @@ func MetricsMiddleware() gin.HandlerFunc {
 		// Calculate duration
 		duration := time.Since(start).Seconds()
 
-		// Get route path (use the matched route if available, otherwise use the request path)
 		endpoint := c.FullPath()
 		if endpoint == "" {
-			endpoint = c.Request.URL.Path
+			endpoint = UnmatchedEndpoint
 		}
 
 		// Get status code
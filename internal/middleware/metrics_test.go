@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/metrics"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(MetricsMiddleware())
+	r.GET("/hosts/:host_id", func(c *gin.Context) {
+		if c.Param("host_id") == "missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	requests := func(endpoint, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(http.MethodGet, endpoint, status))
+	}
+	ok := requests("/hosts/:host_id", "200")
+	notFound := requests("/hosts/:host_id", "404")
+	unmatched := requests(UnmatchedEndpoint, "404")
+
+	for _, path := range []string{"/hosts/a", "/hosts/b", "/hosts/missing", "/wp-login.php", "/.env"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Requests are counted per route, and paths that match no route share one series
+	assert.Equal(t, ok+2, requests("/hosts/:host_id", "200"))
+	assert.Equal(t, notFound+1, requests("/hosts/:host_id", "404"))
+	assert.Equal(t, unmatched+2, requests(UnmatchedEndpoint, "404"))
+}
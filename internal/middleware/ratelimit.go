@@ -92,22 +92,8 @@ func APIKeyRateLimitMiddleware(rateStr string) gin.HandlerFunc {
 	instance := limiter.New(store, rate)
 
 	return func(c *gin.Context) {
-		// Get API key from header (same logic as AuthMiddleware)
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey == "" {
-			// Also check Authorization header for backward compatibility
-			authHeader := c.GetHeader("Authorization")
-			if authHeader != "" {
-				// Support both "Bearer <key>" and "ApiKey <key>" formats
-				parts := strings.SplitN(authHeader, " ", 2)
-				if len(parts) == 2 {
-					apiKey = parts[1]
-				}
-			}
-		}
-
 		// If no API key found, use client IP as fallback
-		key := apiKey
+		key := requestCredential(c)
 		if key == "" {
 			key = c.ClientIP()
 		}
@@ -143,6 +129,24 @@ func APIKeyRateLimitMiddleware(rateStr string) gin.HandlerFunc {
 	}
 }
 
+// requestCredential returns the API key or bearer token sent with the request
+// (same logic as AuthMiddleware), or "" if there is none
+func requestCredential(c *gin.Context) string {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		// Also check Authorization header for backward compatibility
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" {
+			// Support both "Bearer <key>" and "ApiKey <key>" formats
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) == 2 {
+				apiKey = parts[1]
+			}
+		}
+	}
+	return apiKey
+}
+
 // InitRateLimitMiddleware initializes and returns rate limiting middleware functions
 func InitRateLimitMiddleware() (gin.HandlerFunc, gin.HandlerFunc, gin.HandlerFunc, gin.HandlerFunc) {
 	config := getRateLimitConfig()
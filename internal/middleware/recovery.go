@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/crashreport"
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+)
+
+// Recovery recovers panics in the handlers after it and answers with a 500 carrying
+// the request ID. The panic is logged with its stack trace, counted in
+// http_panics_total, and sent to reporter if one is configured (reporter may be nil).
+// Add it after RequestIDMiddleware, JSONAPI, and ErrorRequestID, so its response
+// passes through them.
+func Recovery(reporter *crashreport.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			// Aborting the response is how net/http handlers end a request early; let
+			// the server handle it as usual
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			requestID := c.GetString(logger.RequestIDKey)
+
+			// A client that went away is not a bug; there is no one left to answer
+			if isBrokenPipe(value) {
+				logger.FromContext(c).Interface("panic", value).Str("route", route).Msg("Client connection closed during response")
+				c.Abort()
+				return
+			}
+
+			pcs := make([]uintptr, 64)
+			pcs = pcs[:runtime.Callers(3, pcs)]
+
+			metrics.HTTPPanicsTotal.WithLabelValues(c.Request.Method, route).Inc()
+			event := logger.Logger.Error().
+				Str("request_id", requestID).
+				Str("method", c.Request.Method).
+				Str("route", route).
+				Interface("panic", value).
+				Str("stack", string(debug.Stack()))
+			if userID := c.GetString("user_id"); userID != "" {
+				event = event.Str("user_id", userID)
+			}
+			if orgID := c.GetString("org_id"); orgID != "" {
+				event = event.Str("org_id", orgID)
+			}
+			event.Msg("Recovered from panic in request handler")
+
+			reporter.Report(crashreport.Panic{
+				Value:     value,
+				Stack:     pcs,
+				RequestID: requestID,
+				Method:    c.Request.Method,
+				Route:     route,
+				URL:       c.Request.URL.Path,
+			})
+
+			if c.Writer.Written() {
+				// Part of the response went out; the client sees it cut short
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal server error",
+				"message":    "The request failed unexpectedly; quote the request ID when reporting it",
+				"request_id": requestID,
+			})
+		}()
+		c.Next()
+	}
+}
+
+// isBrokenPipe reports whether a panic was caused by writing to a closed connection
+func isBrokenPipe(value interface{}) bool {
+	err, ok := value.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if errors.As(opErr, &syscallErr) &&
+		(errors.Is(syscallErr.Err, syscall.EPIPE) || errors.Is(syscallErr.Err, syscall.ECONNRESET)) {
+		return true
+	}
+	msg := strings.ToLower(opErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
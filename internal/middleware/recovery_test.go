@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/metrics"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), Recovery(nil))
+	r.GET("/panic/:id", func(c *gin.Context) {
+		var m map[string]int
+		m[c.Param("id")] = 1 // Writing to a nil map panics
+	})
+	r.GET("/partial", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("after writing")
+	})
+	r.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	before := testutil.ToFloat64(metrics.HTTPPanicsTotal.WithLabelValues(http.MethodGet, "/panic/:id"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/panic/x", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{
+		"error": "internal server error",
+		"message": "The request failed unexpectedly; quote the request ID when reporting it",
+		"request_id": "req-1"
+	}`, w.Body.String())
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.HTTPPanicsTotal.WithLabelValues(http.MethodGet, "/panic/:id")))
+
+	// A response already on its way is cut short instead of replaced
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+
+	// http.ErrAbortHandler is left to net/http
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	})
+}
+
+func TestIsBrokenPipe(t *testing.T) {
+	brokenPipe := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+	assert.True(t, isBrokenPipe(brokenPipe))
+	assert.False(t, isBrokenPipe(errors.New("broken pipe")))
+	assert.False(t, isBrokenPipe("boom"))
+}
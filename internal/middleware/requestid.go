@@ -1,20 +1,40 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"snailbus/internal/logger"
+	"snailbus/internal/storage"
 )
 
+// RequestIDHeader carries the request ID, from clients that want to pick it and back
+// to the client in every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
 // RequestIDMiddleware generates a unique request ID for each HTTP request
 // and stores it in the Gin context. It also sets the X-Request-ID header
 // in the response so clients can track requests.
+//
+// A request ID sent by the client is kept if it is at most 128 letters, digits, and
+// "-", "_", ".", or ":"; anything else is replaced, since the ID is copied into logs,
+// error responses, and the database's application_name.
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if request ID is already in header (for distributed tracing)
-		requestID := c.GetHeader("X-Request-ID")
-		if requestID == "" {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
 			// Generate new UUID for request ID
 			requestID = uuid.New().String()
 		}
@@ -22,9 +42,197 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		// Store in context
 		c.Set(logger.RequestIDKey, requestID)
 
+		// Attribute the export reads made with the request context to this request
+		c.Request = c.Request.WithContext(storage.WithQueryTag(c.Request.Context(), requestID))
+
 		// Set response header
-		c.Header("X-Request-ID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// requestStorageKey is the request context key for the storage bound by QueryConnection
+type requestStorageKey struct{}
+
+// QueryConnection runs the rest of the request with a storage bound to one connection
+// named after the request ID (see storage.WithConn), so pg_stat_activity attributes the
+// request's queries to it. It must run after RequestIDMiddleware; handlers and middleware
+// reach the bound storage through RequestStorage. Requests to the pooled paths, such as
+// event streams that stay open for as long as the client listens, run on the pool
+// instead of holding a connection.
+func QueryConnection(store storage.Storage, pooled ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(pooled, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		request := c.Request
+		_ = store.WithConn(request.Context(), func(conn storage.Storage) error {
+			c.Request = request.WithContext(context.WithValue(request.Context(), requestStorageKey{}, conn))
+			c.Next()
+			return nil
+		})
+		// The connection is back in the pool
+		c.Request = request
+	}
+}
+
+// RequestStorage returns the storage QueryConnection bound to the request ctx belongs to,
+// or store outside of QueryConnection. Goroutines and work that outlives the request
+// must use store itself, as the bound storage serves one caller at a time.
+func RequestStorage(ctx context.Context, store storage.Storage) storage.Storage {
+	if conn, ok := ctx.Value(requestStorageKey{}).(storage.Storage); ok {
+		return conn
+	}
+	return store
+}
+
+// validRequestID reports whether a client-supplied request ID can be used as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs every request once it has been handled, with its status and latency
+// and the request ID, user, and organization (see logger.FromContext). It must run
+// after RequestIDMiddleware.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		logger.FromContext(c).
+			Str("method", c.Request.Method).
+			Str("path", path).
+			Int("status", c.Writer.Status()).
+			Int("bytes", c.Writer.Size()).
+			Dur("latency", time.Since(start)).
+			Str("client_ip", c.ClientIP()).
+			Msg("Request handled")
+	}
+}
+
+// errorBodyWriter buffers JSON error responses so the request ID can be added once the handler is done
+// Successful and non-JSON responses are written through as they are produced.
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+// decide buffers the response if the handler is writing a JSON error
+func (w *errorBodyWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		w.buffering = w.Status() >= http.StatusBadRequest &&
+			strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorBodyWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.buffering {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *errorBodyWriter) Flush() {
+	w.decide()
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
 
+// ErrorRequestID adds the request ID to JSON error responses as request_id, so users
+// reporting an error can quote it, and logs every server error with the ID to look up.
+// It must run after RequestIDMiddleware and, to reach JSON:API errors, after JSONAPI.
+func ErrorRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &errorBodyWriter{ResponseWriter: original}
+		c.Writer = writer
 		c.Next()
+		c.Writer = original
+
+		requestID := c.GetString(logger.RequestIDKey)
+		if status := original.Status(); status >= http.StatusInternalServerError {
+			event := logger.Logger.Error().
+				Str("request_id", requestID).
+				Int("status", status).
+				Str("method", c.Request.Method).
+				Str("path", c.Request.URL.Path)
+			if len(c.Errors) > 0 {
+				event = event.Str("errors", c.Errors.String())
+			}
+			event.Msg("Request failed; the client was given this request_id, search the logs for it to find the cause")
+		}
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.body.Bytes()
+		if withID, ok := addRequestID(body, requestID); ok {
+			body = withID
+		}
+		original.Header().Del("Content-Length")
+		if _, err := original.Write(body); err != nil {
+			logger.FromContext(c).Err(err).Msg("Failed to write response")
+		}
+	}
+}
+
+// addRequestID adds request_id to a JSON object unless it already has one
+func addRequestID(body []byte, requestID string) ([]byte, bool) {
+	if requestID == "" {
+		return nil, false
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil || object == nil {
+		return nil, false
+	}
+	if _, ok := object["request_id"]; ok {
+		return nil, false
+	}
+	id, err := json.Marshal(requestID)
+	if err != nil {
+		return nil, false
+	}
+	object["request_id"] = id
+	withID, err := json.Marshal(object)
+	if err != nil {
+		return nil, false
 	}
+	return withID, true
 }
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/jsonapi"
+	"snailbus/internal/logger"
+	"snailbus/internal/storage"
+)
+
+// connStorage hands out conn from WithConn
+type connStorage struct {
+	*storage.MockStorage
+	conn storage.Storage
+}
+
+func (s *connStorage) WithConn(ctx context.Context, fn func(conn storage.Storage) error) error {
+	return fn(s.conn)
+}
+
+func TestQueryConnection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &connStorage{MockStorage: storage.NewMockStorage(), conn: storage.NewMockStorage()}
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), QueryConnection(store, "/stream"))
+	r.GET("/conn", func(c *gin.Context) {
+		assert.Same(t, store.conn, RequestStorage(c.Request.Context(), store))
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/stream", func(c *gin.Context) {
+		assert.Same(t, store, RequestStorage(c.Request.Context(), store))
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/conn", nil)
+	req.Header.Set(RequestIDHeader, "req-conn")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Pooled paths don't hold a connection
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Outside of QueryConnection the storage given is used
+	assert.Same(t, store, RequestStorage(context.Background(), store))
+}
+
+func TestErrorRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), JSONAPI(), ErrorRequestID())
+	r.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET("/fail", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list actions"})
+	})
+	r.GET("/list-error", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, []string{"not an object"})
+	})
+	r.GET("/text", func(c *gin.Context) {
+		c.String(http.StatusNotFound, "not found")
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Successful responses are unchanged
+	w := get("/ok", "")
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+
+	// JSON errors carry the request ID
+	w = get("/fail", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+	assert.JSONEq(t, `{"error": "failed to list actions", "request_id": "req-1"}`, w.Body.String())
+
+	// JSON:API errors carry it as the error ID
+	w = get("/fail", jsonapi.MediaType)
+	assert.JSONEq(t, `{"errors": [{"id": "req-1", "status": "500", "title": "failed to list actions"}]}`, w.Body.String())
+
+	// Other error bodies are left as they are
+	w = get("/list-error", "")
+	assert.JSONEq(t, `["not an object"]`, w.Body.String())
+	w = get("/text", "")
+	assert.Equal(t, "not found", w.Body.String())
+}
+
+func TestRequestIDMiddleware_ClientIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), AccessLog())
+	r.GET("/id", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(logger.RequestIDKey))
+	})
+
+	get := func(requestID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/id", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Well-formed client IDs are kept, for tracing across services
+	for _, id := range []string{"req-1", "0b6f3c2e-5d0c-4f7a-9a51-6e2f8d7c1a90", "trace:span_1.2", strings.Repeat("a", maxRequestIDLength)} {
+		w := get(id)
+		assert.Equal(t, id, w.Body.String())
+		assert.Equal(t, id, w.Header().Get(RequestIDHeader))
+	}
+
+	// Missing, oversized, and malformed IDs are replaced with a generated one
+	for _, id := range []string{"", strings.Repeat("a", maxRequestIDLength+1), "req 1", "req\x001", "'; DROP TABLE hosts; --"} {
+		w := get(id)
+		generated := w.Header().Get(RequestIDHeader)
+		assert.NotEqual(t, id, generated)
+		_, err := uuid.Parse(generated)
+		assert.NoError(t, err, "%q is replaced with a UUID", id)
+		assert.Equal(t, generated, w.Body.String())
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemAdminRole is recorded for routes restricted to system administrators (users.is_admin)
+// It is not an organization role, so role-scoped API docs never include these routes.
+const SystemAdminRole = "system_admin"
+
+// RoleRoute is a registered route and the roles allowed to call it
+type RoleRoute struct {
+	Method string
+	Path   string // Router form, e.g. /api/v1/hosts/:host_id
+	Roles  []string
+}
+
+// RouteRoles records the roles each restricted route requires, so the API docs can be
+// filtered to what a role can call. Routes that are not recorded are open to every
+// authenticated role (or are public).
+type RouteRoles struct {
+	mu     sync.RWMutex
+	routes []RoleRoute
+}
+
+// NewRouteRoles creates an empty route role table
+func NewRouteRoles() *RouteRoles {
+	return &RouteRoles{}
+}
+
+// RequireRole creates a child group of parent that requires one of roles
+// Routes registered on the returned group are recorded with those roles.
+func (t *RouteRoles) RequireRole(parent *gin.RouterGroup, roles ...string) *RoleGroup {
+	group := parent.Group("")
+	group.Use(RequireRole(roles...))
+	return t.Record(group, roles...)
+}
+
+// Record wraps a group that is already restricted by other middleware, such as
+// AdminMiddleware, so the routes registered on it are recorded with roles
+func (t *RouteRoles) Record(group *gin.RouterGroup, roles ...string) *RoleGroup {
+	return &RoleGroup{RouterGroup: group, table: t, roles: roles}
+}
+
+// Routes returns the recorded routes in registration order
+func (t *RouteRoles) Routes() []RoleRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]RoleRoute(nil), t.routes...)
+}
+
+func (t *RouteRoles) add(method, fullPath string, roles []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, RoleRoute{Method: method, Path: fullPath, Roles: roles})
+}
+
+// RoleGroup is a router group whose routes are recorded in a RouteRoles table
+type RoleGroup struct {
+	*gin.RouterGroup
+	table *RouteRoles
+	roles []string
+}
+
+// Handle registers a route and records its roles
+func (g *RoleGroup) Handle(method, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	fullPath := g.BasePath()
+	if relativePath != "" {
+		fullPath = path.Join(fullPath, relativePath)
+		if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(fullPath, "/") {
+			fullPath += "/"
+		}
+	}
+	g.table.add(method, fullPath, g.roles)
+	return g.RouterGroup.Handle(method, relativePath, handlers...)
+}
+
+// GET registers a GET route and records its roles
+func (g *RoleGroup) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+// POST registers a POST route and records its roles
+func (g *RoleGroup) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+// PUT registers a PUT route and records its roles
+func (g *RoleGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+// PATCH registers a PATCH route and records its roles
+func (g *RoleGroup) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+// DELETE registers a DELETE route and records its roles
+func (g *RoleGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodDelete, relativePath, handlers...)
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/models"
+)
+
+func TestRouteRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	roles := NewRouteRoles()
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{Role: c.GetHeader("X-Role")})
+	})
+	api := r.Group("/api/v1")
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/hosts", ok)
+	editors := roles.RequireRole(api, "editor", "admin")
+	editors.DELETE("/hosts/:host_id", ok)
+	editors.POST("/probes/", ok)
+	roles.Record(api.Group("/admin"), SystemAdminRole).GET("", ok)
+
+	assert.Equal(t, []RoleRoute{
+		{Method: http.MethodDelete, Path: "/api/v1/hosts/:host_id", Roles: []string{"editor", "admin"}},
+		{Method: http.MethodPost, Path: "/api/v1/probes/", Roles: []string{"editor", "admin"}},
+		{Method: http.MethodGet, Path: "/api/v1/admin", Roles: []string{SystemAdminRole}},
+	}, roles.Routes())
+
+	// Recorded groups still enforce their roles
+	for role, want := range map[string]int{"viewer": http.StatusForbidden, "editor": http.StatusOK} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/hosts/1", nil)
+		req.Header.Set("X-Role", role)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, role)
+	}
+}
@@ -5,41 +5,77 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"snailbus/internal/config"
 	"snailbus/internal/logger"
 )
 
-// SecurityHeadersMiddleware adds security headers to all HTTP responses
-func SecurityHeadersMiddleware() gin.HandlerFunc {
-	// Get CSP from environment variable, with a reasonable default
-	csp := getEnv("CONTENT_SECURITY_POLICY",
-		"default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self'; connect-src 'self'; frame-ancestors 'none';")
+// SecurityHeaders are the values of the security headers set on responses.
+// An empty value leaves the header unset.
+type SecurityHeaders struct {
+	ContentSecurityPolicy   string
+	StrictTransportSecurity string // Only sent on HTTPS requests
+	ReferrerPolicy          string
+	FrameOptions            string
+}
+
+// SecurityHeadersMiddleware adds the security headers configured in cfg to all HTTP responses
+func SecurityHeadersMiddleware(cfg *config.Config) gin.HandlerFunc {
+	headers := SecurityHeaders{
+		ContentSecurityPolicy:   cfg.ContentSecurityPolicy,
+		StrictTransportSecurity: cfg.StrictTransportSecurity,
+		ReferrerPolicy:          cfg.ReferrerPolicy,
+		FrameOptions:            cfg.FrameOptions,
+	}
 
 	logger.Logger.Info().
-		Str("csp_policy", csp).
+		Str("csp_policy", headers.ContentSecurityPolicy).
+		Str("hsts", headers.StrictTransportSecurity).
+		Str("referrer_policy", headers.ReferrerPolicy).
+		Str("frame_options", headers.FrameOptions).
 		Msg("Initializing security headers middleware")
 
 	return func(c *gin.Context) {
 		// Prevent MIME type sniffing
 		c.Header("X-Content-Type-Options", "nosniff")
 
-		// Prevent clickjacking attacks
-		c.Header("X-Frame-Options", "DENY")
-
 		// Enable XSS filtering
 		c.Header("X-XSS-Protection", "1; mode=block")
 
-		// Referrer Policy - only send origin for cross-origin requests
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
+		headers.apply(c, false)
+		c.Next()
+	}
+}
 
-		// Content Security Policy
-		c.Header("Content-Security-Policy", csp)
+// SecurityHeadersOverride replaces the headers set by SecurityHeadersMiddleware on the
+// routes it is added to, e.g. a more permissive policy for the Swagger UI. Empty
+// fields keep the values set for every route.
+func SecurityHeadersOverride(override SecurityHeaders) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		override.apply(c, true)
+		c.Next()
+	}
+}
 
-		// HTTP Strict Transport Security (HSTS) - only for HTTPS connections
-		if c.Request.TLS != nil || strings.HasPrefix(c.Request.Header.Get("X-Forwarded-Proto"), "https") {
-			// 1 year max-age for HSTS
-			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains; preload")
+// apply sets the non-empty headers; when skipEmpty is false, empty ones are removed
+func (h SecurityHeaders) apply(c *gin.Context, skipEmpty bool) {
+	set := func(name, value string) {
+		if value == "" && skipEmpty {
+			return
 		}
+		c.Header(name, value) // An empty value deletes the header
+	}
 
-		c.Next()
+	// Prevent clickjacking attacks
+	set("X-Frame-Options", h.FrameOptions)
+
+	// Referrer Policy, e.g. only send the origin for cross-origin requests
+	set("Referrer-Policy", h.ReferrerPolicy)
+
+	// Content Security Policy
+	set("Content-Security-Policy", h.ContentSecurityPolicy)
+
+	// HTTP Strict Transport Security (HSTS) - only for HTTPS connections
+	if c.Request.TLS != nil || strings.HasPrefix(c.Request.Header.Get("X-Forwarded-Proto"), "https") {
+		set("Strict-Transport-Security", h.StrictTransportSecurity)
 	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"snailbus/internal/config"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		ContentSecurityPolicy:   "default-src 'none'",
+		StrictTransportSecurity: "max-age=600",
+		ReferrerPolicy:          "no-referrer",
+		FrameOptions:            "",
+	}
+
+	r := gin.New()
+	r.Use(SecurityHeadersMiddleware(cfg))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/docs", SecurityHeadersOverride(SecurityHeaders{
+		ContentSecurityPolicy: "default-src 'self'",
+		FrameOptions:          "SAMEORIGIN",
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Plain HTTP: no HSTS, disabled headers are left out
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Empty(t, w.Header().Values("X-Frame-Options"))
+	assert.Empty(t, w.Header().Values("Strict-Transport-Security"))
+
+	// HTTPS behind a proxy gets HSTS
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "max-age=600", w.Header().Get("Strict-Transport-Security"))
+
+	// Overrides replace the set values and keep the others
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+}
@@ -7,25 +7,52 @@ import (
 
 	"snailbus/internal/config"
 	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
 )
 
+// Size classes of requests, each with its own limit on the body as sent
+const (
+	SizeClassGet         = "get"
+	SizeClassIngest      = "ingest"
+	SizeClassIngestBatch = "ingest_batch"
+	SizeClassBundle      = "bundle"
+	SizeClassPost        = "post"
+)
+
+// Reasons a body is rejected, the reason label of http_request_body_rejected_total
+const (
+	BodyRejectedContentLength = "content_length" // Content-Length exceeds the limit
+	BodyRejectedBody          = "body"           // The body exceeded the limit as it was read
+	BodyRejectedDecompressed  = "decompressed"   // The body exceeded a handler's limit once decompressed
+)
+
+// bodyRejectedKey holds the reason a handler gave for a 413 response
+const bodyRejectedKey = "body_rejected_reason"
+
+// sizeClass returns the size class of a request and its limit
+func sizeClass(cfg *config.Config, method, path string) (string, int64) {
+	switch {
+	case method == http.MethodGet:
+		return SizeClassGet, cfg.MaxRequestSizeGet
+	case path == "/api/v1/ingest":
+		return SizeClassIngest, cfg.MaxRequestSizeIngest
+	case path == "/api/v1/ingest/batch":
+		return SizeClassIngestBatch, cfg.MaxRequestSizeIngestBatch
+	case path == "/api/v1/bundles":
+		return SizeClassBundle, cfg.MaxRequestSizeBundle
+	default:
+		// POST, PUT, PATCH, and anything else with a body
+		return SizeClassPost, cfg.MaxRequestSizePost
+	}
+}
+
 // RequestSizeLimit creates middleware that enforces request size limits
+// The limit applies to the body as sent, so compressed bodies are limited before they are
+// decompressed; handlers that decompress bound the output themselves and report it with
+// RejectDecompressedBody. Every 413 response is counted in http_request_body_rejected_total.
 func RequestSizeLimit(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var maxSize int64
-
-		// Determine size limit based on method and path
-		switch {
-		case c.Request.Method == "GET":
-			maxSize = cfg.MaxRequestSizeGet
-		case c.Request.URL.Path == "/api/v1/ingest":
-			maxSize = cfg.MaxRequestSizeIngest
-		case c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH":
-			maxSize = cfg.MaxRequestSizePost
-		default:
-			// For other methods, use a reasonable default
-			maxSize = cfg.MaxRequestSizePost
-		}
+		class, maxSize := sizeClass(cfg, c.Request.Method, c.Request.URL.Path)
 
 		// Check Content-Length header first (for efficiency)
 		if c.Request.ContentLength > maxSize {
@@ -36,6 +63,7 @@ func RequestSizeLimit(cfg *config.Config) gin.HandlerFunc {
 				Int64("max_allowed", maxSize).
 				Msg("Request size exceeds limit")
 
+			metrics.HTTPRequestBodyRejectedTotal.WithLabelValues(class, BodyRejectedContentLength).Inc()
 			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
 				"error":   "Request entity too large",
 				"message": "The request body is too large",
@@ -49,5 +77,20 @@ func RequestSizeLimit(cfg *config.Config) gin.HandlerFunc {
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
 
 		c.Next()
+
+		// Handlers answer bodies cut off by the limit with 413
+		if c.Writer.Status() == http.StatusRequestEntityTooLarge {
+			reason := c.GetString(bodyRejectedKey)
+			if reason == "" {
+				reason = BodyRejectedBody
+			}
+			metrics.HTTPRequestBodyRejectedTotal.WithLabelValues(class, reason).Inc()
+		}
 	}
 }
+
+// RejectDecompressedBody records that a handler answered 413 because the body was too
+// large once decompressed, rather than as sent
+func RejectDecompressedBody(c *gin.Context) {
+	c.Set(bodyRejectedKey, BodyRejectedDecompressed)
+}
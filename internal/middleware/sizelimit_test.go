@@ -2,14 +2,17 @@ package middleware
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"snailbus/internal/config"
+	"snailbus/internal/metrics"
 )
 
 func TestRequestSizeLimit(t *testing.T) {
@@ -17,9 +20,11 @@ func TestRequestSizeLimit(t *testing.T) {
 
 	// Create test config with size limits
 	cfg := &config.Config{
-		MaxRequestSizeIngest: 10 * 1024 * 1024, // 10MB
-		MaxRequestSizePost:   1 * 1024 * 1024,  // 1MB
-		MaxRequestSizeGet:    100 * 1024,       // 100KB
+		MaxRequestSizeIngest:      10 * 1024 * 1024, // 10MB
+		MaxRequestSizeIngestBatch: 20 * 1024 * 1024, // 20MB
+		MaxRequestSizePost:        1 * 1024 * 1024,  // 1MB
+		MaxRequestSizeGet:         100 * 1024,       // 100KB
+		MaxRequestSizeBundle:      20 * 1024 * 1024, // 20MB
 	}
 
 	// Create router with size limit middleware
@@ -90,4 +95,92 @@ func TestRequestSizeLimit(t *testing.T) {
 	req.ContentLength = int64(len(hugeBody))
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Bundle uploads have their own, larger limit
+	r.POST("/api/v1/bundles", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/bundles", bytes.NewReader(hugeBody))
+	req.Header.Set("Content-Type", "application/gzip")
+	req.ContentLength = int64(len(hugeBody))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// So do batches of reports
+	r.POST("/api/v1/ingest/batch", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/ingest/batch", bytes.NewReader(hugeBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(hugeBody))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequestSizeLimit_CountsRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		MaxRequestSizeIngest:      1024,
+		MaxRequestSizeIngestBatch: 1024,
+		MaxRequestSizePost:        1024,
+		MaxRequestSizeGet:         1024,
+		MaxRequestSizeBundle:      1024,
+	}
+
+	r := gin.New()
+	r.Use(RequestSizeLimit(cfg))
+	r.POST("/api/v1/ingest", func(c *gin.Context) {
+		if c.Query("decompress") != "" {
+			RejectDecompressedBody(c)
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	counter := func(reason string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequestBodyRejectedTotal.WithLabelValues(SizeClassIngest, reason))
+	}
+	before := map[string]float64{}
+	for _, reason := range []string{BodyRejectedContentLength, BodyRejectedBody, BodyRejectedDecompressed} {
+		before[reason] = counter(reason)
+	}
+
+	body := bytes.Repeat([]byte("a"), 2048)
+
+	// Rejected on Content-Length before the handler runs
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/ingest", bytes.NewReader(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Rejected while reading a body of unknown length
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/ingest", io.MultiReader(bytes.NewReader(body)))
+	req.ContentLength = -1
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Rejected by the handler once decompressed
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/ingest?decompress=1", bytes.NewReader([]byte("small")))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Accepted bodies are not counted
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/ingest", bytes.NewReader([]byte("small")))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, before[BodyRejectedContentLength]+1, counter(BodyRejectedContentLength))
+	assert.Equal(t, before[BodyRejectedBody]+1, counter(BodyRejectedBody))
+	assert.Equal(t, before[BodyRejectedDecompressed]+1, counter(BodyRejectedDecompressed))
 }
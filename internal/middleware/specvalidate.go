@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/specvalidate"
+)
+
+// maxValidatedBodySize is the largest request body checked against the spec
+// Larger bodies (ingest reports, bundles) are passed to their handlers unchecked
+// rather than buffered twice.
+const maxValidatedBodySize = 1 << 20 // 1MB
+
+// RequestValidation rejects requests whose parameters or JSON body do not match the
+// operation documented in the OpenAPI spec, with 400 and the violating field
+// Routes the spec does not document pass through, as do compressed bodies and
+// bodies over 1MB, whose handlers validate them while decoding.
+func RequestValidation(validator *specvalidate.Validator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next()
+			return
+		}
+
+		req := specvalidate.Request{
+			Method:     c.Request.Method,
+			Path:       route,
+			Query:      c.Request.URL.Query(),
+			Header:     c.Request.Header,
+			PathParams: make(map[string]string, len(c.Params)),
+		}
+		for _, param := range c.Params {
+			req.PathParams[param.Key] = param.Value
+		}
+
+		if validator.HasBody(req.Method, route) && validatableBody(c.Request) {
+			body, ok := readValidatedBody(c)
+			if !ok {
+				return
+			}
+			req.Body = body
+		}
+
+		if err := validator.Validate(req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"field":   err.Field,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// validatableBody reports whether a request body is uncompressed JSON
+func validatableBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r.ContentLength == 0
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	if r.ContentLength > maxValidatedBodySize {
+		return false
+	}
+	contentType := r.Header.Get("Content-Type")
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(strings.ToLower(contentType))
+	return contentType == "" || contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+// readValidatedBody reads the body for validation and restores it for the handler
+// A body that turns out to be over the validation limit is restored unread, and nil is
+// returned so it is not checked. It reports false once it has answered the request.
+func readValidatedBody(c *gin.Context) ([]byte, bool) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return []byte{}, true
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxValidatedBodySize+1))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Request entity too large",
+				"message": "The request body is too large",
+				"limit":   tooLarge.Limit,
+			})
+			return nil, false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "Failed to read the request body",
+		})
+		return nil, false
+	}
+	if len(body) > maxValidatedBodySize {
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		return nil, true
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// readCloser reads from a replayed prefix of a body and closes the original
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/specvalidate"
+)
+
+const requestValidationSpec = `{
+  "swagger": "2.0",
+  "paths": {
+    "/api/v1/users/{user_id}/role": {
+      "put": {
+        "parameters": [
+          {"name": "user_id", "in": "path", "type": "string", "required": true},
+          {"name": "request", "in": "body", "required": true, "schema": {"$ref": "#/definitions/models.UpdateUserRoleRequest"}}
+        ]
+      }
+    },
+    "/api/v1/hosts": {
+      "get": {
+        "parameters": [{"name": "limit", "in": "query", "type": "integer"}]
+      }
+    }
+  },
+  "definitions": {
+    "models.UpdateUserRoleRequest": {
+      "type": "object",
+      "required": ["role"],
+      "properties": {"role": {"type": "string", "enum": ["viewer", "editor", "admin"]}}
+    }
+  }
+}`
+
+func TestRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(requestValidationSpec), &spec))
+	validator, err := specvalidate.New(spec)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(RequestValidation(validator))
+	// Echo the body, to check the handler still receives it in full
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	}
+	r.PUT("/api/v1/users/:user_id/role", echo)
+	r.GET("/api/v1/hosts", echo)
+	r.POST("/api/v1/undocumented", echo)
+
+	send := func(method, path string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	jsonHeader := map[string]string{"Content-Type": "application/json"}
+
+	t.Run("valid body reaches the handler", func(t *testing.T) {
+		w := send("PUT", "/api/v1/users/u1/role", []byte(`{"role": "editor"}`), jsonHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"role": "editor"}`, w.Body.String())
+	})
+
+	t.Run("invalid body names the field", func(t *testing.T) {
+		w := send("PUT", "/api/v1/users/u1/role", []byte(`{"role": "owner"}`), jsonHeader)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Invalid request", resp["error"])
+		assert.Equal(t, "body.role", resp["field"])
+		assert.Contains(t, resp["message"], "must be one of viewer, editor, admin")
+	})
+
+	t.Run("missing body", func(t *testing.T) {
+		w := send("PUT", "/api/v1/users/u1/role", nil, jsonHeader)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"body"`)
+	})
+
+	t.Run("invalid query parameter", func(t *testing.T) {
+		w := send("GET", "/api/v1/hosts?limit=ten", nil, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"query.limit"`)
+
+		w = send("GET", "/api/v1/hosts?limit=10", nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("non-JSON body is not checked", func(t *testing.T) {
+		w := send("PUT", "/api/v1/users/u1/role", []byte("role=owner"), map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("compressed body is not checked", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(`{"role": "owner"}`))
+		require.NoError(t, gz.Close())
+		w := send("PUT", "/api/v1/users/u1/role", buf.Bytes(), map[string]string{
+			"Content-Type":     "application/json",
+			"Content-Encoding": "gzip",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("large body is passed on unchecked", func(t *testing.T) {
+		body := []byte(`{"role": "owner", "padding": "` + strings.Repeat("x", maxValidatedBodySize) + `"}`)
+		req := httptest.NewRequest("PUT", "/api/v1/users/u1/role", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = -1 // Unknown length, so the body is read before it is found to be too large
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, len(body), w.Body.Len())
+	})
+
+	t.Run("undocumented route passes", func(t *testing.T) {
+		w := send("POST", "/api/v1/undocumented", []byte(`{"anything": true}`), jsonHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
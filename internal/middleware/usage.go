@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snailbus/internal/usage"
+)
+
+// UsageMiddleware records each organization's requests in the usage tracker
+// Rate-limited requests are rejected before authentication, so they are
+// attributed through the credential they were sent with
+func UsageMiddleware(tracker *usage.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		endpoint := ""
+		if route != "" {
+			endpoint = c.Request.Method + " " + route
+		}
+		credential := requestCredential(c)
+
+		if orgID := GetOrgID(c); orgID != "" {
+			if endpoint != "" {
+				tracker.RecordRequest(orgID, endpoint, c.Writer.Status())
+			}
+			if credential != "" {
+				tracker.RememberCredential(credential, orgID)
+			}
+			return
+		}
+		if c.Writer.Status() == http.StatusTooManyRequests && credential != "" {
+			tracker.RecordRateLimited(credential, endpoint, c.Writer.Status())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/usage"
+)
+
+func TestUsageMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker := usage.NewTracker()
+
+	limited := false
+	r := gin.New()
+	r.Use(UsageMiddleware(tracker))
+	r.GET("/hosts", func(c *gin.Context) {
+		// Stands in for a rate limiter that runs before authentication
+		if limited {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Set("org_id", "org-1")
+		c.Status(http.StatusOK)
+	})
+
+	request := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/hosts", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, request("sb_key"))
+	require.Equal(t, http.StatusOK, request(""))
+
+	limited = true
+	require.Equal(t, http.StatusTooManyRequests, request("sb_key"))
+	require.Equal(t, http.StatusTooManyRequests, request("sb_other"))
+
+	snapshot := tracker.Snapshot("org-1")
+	require.Len(t, snapshot.Endpoints, 1)
+	assert.Equal(t, usage.EndpointUsage{Endpoint: "GET /hosts", Requests: 3, Errors: 1}, snapshot.Endpoints[0])
+	assert.Equal(t, int64(1), snapshot.RateLimitHits, "only credentials seen authenticating are attributed")
+}
@@ -0,0 +1,212 @@
+package migrations
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PostgreSQL table lock modes, weakest first
+var lockModes = []string{
+	"ACCESS SHARE",
+	"ROW SHARE",
+	"ROW EXCLUSIVE",
+	"SHARE UPDATE EXCLUSIVE",
+	"SHARE",
+	"SHARE ROW EXCLUSIVE",
+	"EXCLUSIVE",
+	"ACCESS EXCLUSIVE",
+}
+
+// lockEffects describes what each lock mode taken by a migration holds up
+var lockEffects = map[string]string{
+	"ROW EXCLUSIVE":          "blocks other schema changes; writes to the same rows wait",
+	"SHARE UPDATE EXCLUSIVE": "blocks other schema changes and vacuum",
+	"SHARE":                  "blocks writes",
+	"SHARE ROW EXCLUSIVE":    "blocks writes",
+	"EXCLUSIVE":              "blocks writes",
+	"ACCESS EXCLUSIVE":       "blocks reads and writes",
+}
+
+// Lock is a table lock a migration is expected to take
+type Lock struct {
+	Table string // Or "index <name>" for a dropped index, which locks its table too
+	Mode  string
+}
+
+// Effect describes what the lock holds up while the migration runs
+func (l Lock) Effect() string {
+	return lockEffects[l.Mode]
+}
+
+const identifier = `((?:"[^"]+"|[a-z_][a-z0-9_$]*)(?:\.(?:"[^"]+"|[a-z_][a-z0-9_$]*))?)`
+
+// lockRules map statements to the lock they take on the table they name
+// Statements are matched lowercased with whitespace collapsed.
+var lockRules = []struct {
+	pattern *regexp.Regexp
+	mode    string
+	prefix  string // Names an object other than a table, e.g. "index "
+	final   bool   // The statement takes no other lock, so later rules are skipped
+}{
+	{regexp.MustCompile(`\balter table (?:if exists )?(?:only )?` + identifier + ` validate constraint\b`), "SHARE UPDATE EXCLUSIVE", "", true},
+	{regexp.MustCompile(`\balter table (?:if exists )?(?:only )?` + identifier), "ACCESS EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bcreate (?:unique )?index concurrently (?:if not exists )?(?:[a-z0-9_"$.]+ )?on (?:only )?` + identifier), "SHARE UPDATE EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bcreate (?:unique )?index (?:if not exists )?(?:[a-z0-9_"$.]+ )?on (?:only )?` + identifier), "SHARE", "", false},
+	{regexp.MustCompile(`\bdrop index (?:concurrently )?(?:if exists )?` + identifier), "ACCESS EXCLUSIVE", "index ", false},
+	{regexp.MustCompile(`\bdrop table (?:if exists )?` + identifier), "ACCESS EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\btruncate (?:table )?(?:only )?` + identifier), "ACCESS EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bcreate (?:or replace )?(?:constraint )?trigger [a-z0-9_"$]+ .*?\bon ` + identifier), "SHARE ROW EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bdrop trigger (?:if exists )?[a-z0-9_"$]+ on ` + identifier), "ACCESS EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\breferences ` + identifier), "SHARE ROW EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bupdate (?:only )?` + identifier + ` set\b`), "ROW EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\bdelete from (?:only )?` + identifier), "ROW EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\binsert into ` + identifier), "ROW EXCLUSIVE", "", false},
+	{regexp.MustCompile(`\block table (?:only )?` + identifier + ` in ([a-z ]+?) mode`), "", "", false},
+}
+
+var createTablePattern = regexp.MustCompile(`\bcreate table (?:if not exists )?` + identifier)
+
+var functionPattern = regexp.MustCompile(`^create (?:or replace )?(?:function|procedure)\b`)
+
+// EstimateLocks returns the table locks a migration is expected to take, strongest
+// lock per table, strongest first
+// The estimate comes from the statements' text: statements inside DO blocks count,
+// function bodies do not (they run later, when called), and tables the migration
+// creates are left out since nothing else can be using them yet. A migration file
+// runs in one transaction, so every lock is held until the whole file has run.
+func EstimateLocks(sql string) []Lock {
+	strongest := make(map[string]int)
+	created := make(map[string]bool)
+	for _, statement := range splitStatements(sql) {
+		if functionPattern.MatchString(statement) {
+			continue
+		}
+		if match := createTablePattern.FindStringSubmatch(statement); match != nil {
+			created[unquote(match[1])] = true
+		}
+		for _, rule := range lockRules {
+			matches := rule.pattern.FindAllStringSubmatch(statement, -1)
+			for _, match := range matches {
+				mode := rule.mode
+				if mode == "" {
+					mode = strings.ToUpper(match[2])
+				}
+				rank := modeRank(mode)
+				if rank < 0 {
+					continue
+				}
+				table := rule.prefix + unquote(match[1])
+				if current, ok := strongest[table]; !ok || rank > current {
+					strongest[table] = rank
+				}
+			}
+			if rule.final && len(matches) > 0 {
+				break
+			}
+		}
+	}
+
+	locks := make([]Lock, 0, len(strongest))
+	for table, rank := range strongest {
+		if created[table] {
+			continue
+		}
+		locks = append(locks, Lock{Table: table, Mode: lockModes[rank]})
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if a, b := modeRank(locks[i].Mode), modeRank(locks[j].Mode); a != b {
+			return a > b
+		}
+		return locks[i].Table < locks[j].Table
+	})
+	return locks
+}
+
+func modeRank(mode string) int {
+	for i, m := range lockModes {
+		if m == mode {
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(name string) string {
+	return strings.ReplaceAll(name, `"`, "")
+}
+
+// splitStatements splits SQL into statements, lowercased with comments removed and
+// whitespace collapsed
+// Semicolons inside strings, quoted identifiers, and dollar-quoted bodies do not
+// split. String contents are dropped; dollar-quoted bodies are kept so statements
+// inside DO blocks can be matched.
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.Join(strings.Fields(strings.ToLower(current.String())), " "); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+			current.WriteByte(' ')
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				end = len(sql) - i - 1
+			}
+			if c == '"' {
+				current.WriteString(sql[i:min(i+end+2, len(sql))])
+			} else {
+				// String contents are values, not SQL
+				current.WriteString("''")
+			}
+			i += end + 1
+		case c == '$':
+			if tag := dollarTag(sql[i:]); tag != "" {
+				end := strings.Index(sql[i+len(tag):], tag)
+				if end < 0 {
+					end = len(sql) - i - len(tag)
+				}
+				// Keep the body without its delimiters so it is matched like plain SQL
+				current.WriteString(" " + sql[i+len(tag):i+len(tag)+end] + " ")
+				i += len(tag) + end + len(tag) - 1
+				break
+			}
+			current.WriteByte(c)
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+var dollarTagPattern = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarTag returns the opening dollar-quote delimiter at the start of s, if any
+func dollarTag(s string) string {
+	return dollarTagPattern.FindString(s)
+}
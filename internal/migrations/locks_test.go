@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEstimateLocks(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []Lock
+	}{
+		{
+			name: "new table referencing an existing one",
+			sql: `CREATE TABLE IF NOT EXISTS host_tags (
+				host_id TEXT REFERENCES hosts(host_id) ON DELETE CASCADE,
+				tag TEXT NOT NULL
+			);
+			CREATE INDEX idx_host_tags_tag ON host_tags(tag);`,
+			want: []Lock{{Table: "hosts", Mode: "SHARE ROW EXCLUSIVE"}},
+		},
+		{
+			name: "strongest lock per table, strongest first",
+			sql: `CREATE INDEX idx_hosts_name ON hosts(hostname);
+			ALTER TABLE hosts ADD COLUMN archived_at TIMESTAMPTZ;
+			UPDATE users SET role = 'admin' WHERE role IS NULL;`,
+			want: []Lock{
+				{Table: "hosts", Mode: "ACCESS EXCLUSIVE"},
+				{Table: "users", Mode: "ROW EXCLUSIVE"},
+			},
+		},
+		{
+			name: "concurrent index and constraint validation",
+			sql: `CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_hosts_org ON ONLY public.hosts (org_id);
+			ALTER TABLE users VALIDATE CONSTRAINT users_org_fkey;`,
+			want: []Lock{
+				{Table: "public.hosts", Mode: "SHARE UPDATE EXCLUSIVE"},
+				{Table: "users", Mode: "SHARE UPDATE EXCLUSIVE"},
+			},
+		},
+		{
+			name: "function bodies are not run, DO blocks are",
+			sql: `CREATE OR REPLACE FUNCTION touch() RETURNS trigger AS $$
+			BEGIN
+				UPDATE hosts SET updated_at = NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+			DO $body$
+			BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'x;y') THEN
+					ALTER TABLE organizations ADD CONSTRAINT x CHECK (true);
+				END IF;
+			END
+			$body$;
+			CREATE TRIGGER trg_touch BEFORE UPDATE ON api_keys FOR EACH ROW EXECUTE FUNCTION touch();`,
+			want: []Lock{
+				{Table: "organizations", Mode: "ACCESS EXCLUSIVE"},
+				{Table: "api_keys", Mode: "SHARE ROW EXCLUSIVE"},
+			},
+		},
+		{
+			name: "comments and strings are not statements",
+			sql: `-- ALTER TABLE hosts ADD COLUMN x INT;
+			/* DROP TABLE users; */
+			INSERT INTO audit_log (message) VALUES ('drop table users; truncate hosts');`,
+			want: []Lock{{Table: "audit_log", Mode: "ROW EXCLUSIVE"}},
+		},
+		{
+			name: "drops, truncate, and explicit locks",
+			sql: `DROP INDEX IF EXISTS idx_old;
+			DROP TRIGGER IF EXISTS trg_touch ON api_keys;
+			TRUNCATE TABLE host_events;
+			LOCK TABLE "Hosts" IN SHARE MODE;`,
+			want: []Lock{
+				{Table: "api_keys", Mode: "ACCESS EXCLUSIVE"},
+				{Table: "host_events", Mode: "ACCESS EXCLUSIVE"},
+				{Table: "index idx_old", Mode: "ACCESS EXCLUSIVE"},
+				{Table: "hosts", Mode: "SHARE"},
+			},
+		},
+		{
+			name: "no statements",
+			sql:  "-- nothing to do\n",
+			want: []Lock{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateLocks(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EstimateLocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
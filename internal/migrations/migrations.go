@@ -0,0 +1,257 @@
+// Package migrations checks the database schema against the migration files before
+// they are applied.
+//
+// golang-migrate only records the schema version, so an applied migration that was
+// later edited, or a database migrated by a newer build, goes unnoticed until
+// queries fail. The server records a SHA-256 checksum of each migration it applies
+// in schema_migration_checksums and refuses to start when an applied migration no
+// longer matches its file. WritePlan and EstimateLocks describe what an upgrade would do
+// without applying it.
+package migrations
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChecksumTable records the checksum of each applied migration
+const ChecksumTable = "schema_migration_checksums"
+
+// versionTable is golang-migrate's default version table
+const versionTable = "schema_migrations"
+
+// ErrUnsupportedSource is returned by Load for migration sources other than file://
+var ErrUnsupportedSource = errors.New("only file:// migration sources can be verified")
+
+// File is an up migration
+type File struct {
+	Version  uint
+	Name     string // Description from the file name, e.g. "add_host_tags"
+	Filename string
+	Checksum string // Hex SHA-256 of the file
+	SQL      string
+}
+
+var filenamePattern = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+// Load reads the up migrations of a MIGRATIONS_PATH source URL
+func Load(source string) ([]File, error) {
+	dir, ok := strings.CutPrefix(source, "file://")
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSource, source)
+	}
+	return LoadFS(os.DirFS(dir))
+}
+
+// LoadFS reads the up migrations in the root of fsys, ordered by version
+func LoadFS(fsys fs.FS) ([]File, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var files []File
+	seen := make(map[uint]string)
+	for _, entry := range entries {
+		match := filenamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		if other, ok := seen[uint(version)]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		seen[uint(version)] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		sum := sha256.Sum256(content)
+		files = append(files, File{
+			Version:  uint(version),
+			Name:     match[2],
+			Filename: entry.Name(),
+			Checksum: hex.EncodeToString(sum[:]),
+			SQL:      string(content),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Version < files[j].Version })
+	return files, nil
+}
+
+// State is the schema version of a database and the checksums recorded for it
+type State struct {
+	Version   uint // Last applied migration; meaningless unless Applied
+	Applied   bool // False for a database no migration has run on
+	Dirty     bool // A migration failed part way and needs manual repair
+	Checksums map[uint]string
+}
+
+// ReadState reads the database's schema version and recorded checksums
+// It only reads, so it is safe for a dry run: missing tables are treated as empty.
+func ReadState(db *sql.DB) (*State, error) {
+	state := &State{Checksums: make(map[uint]string)}
+
+	exists, err := tableExists(db, versionTable)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		var version int64
+		err := db.QueryRow(`SELECT version, dirty FROM `+versionTable+` LIMIT 1`).Scan(&version, &state.Dirty)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, fmt.Errorf("failed to read schema version: %w", err)
+		case version >= 0:
+			state.Version = uint(version)
+			state.Applied = true
+		}
+	}
+
+	exists, err = tableExists(db, ChecksumTable)
+	if err != nil || !exists {
+		return state, err
+	}
+	rows, err := db.Query(`SELECT version, checksum FROM ` + ChecksumTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration checksums: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan migration checksum: %w", err)
+		}
+		state.Checksums[uint(version)] = checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read migration checksums: %w", err)
+	}
+	return state, nil
+}
+
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", table, err)
+	}
+	return exists, nil
+}
+
+// Verify checks that the applied migrations match files
+// It fails when the database is at a version the files do not have (e.g. after
+// rolling back to an older build), or when an applied migration's file is missing
+// or has changed since its checksum was recorded. Applied migrations without a
+// recorded checksum are accepted; RecordChecksums records them.
+func Verify(files []File, state *State) error {
+	if !state.Applied {
+		return nil
+	}
+	byVersion := make(map[uint]File, len(files))
+	for _, file := range files {
+		byVersion[file.Version] = file
+	}
+
+	var problems []string
+	if _, ok := byVersion[state.Version]; !ok {
+		latest := uint(0)
+		if len(files) > 0 {
+			latest = files[len(files)-1].Version
+		}
+		problems = append(problems, fmt.Sprintf(
+			"the database is at migration %d, which is not among the migration files (latest %d); was it migrated by a newer build?",
+			state.Version, latest))
+	}
+
+	versions := make([]uint, 0, len(state.Checksums))
+	for version := range state.Checksums {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, version := range versions {
+		if version > state.Version {
+			continue // Recorded before a rollback with migrate down
+		}
+		file, ok := byVersion[version]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("applied migration %d is missing from the migration files", version))
+		case file.Checksum != state.Checksums[version]:
+			problems = append(problems, fmt.Sprintf("applied migration %s has changed since it was applied", file.Filename))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("migration files do not match the database:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Pending returns the files not yet applied to the database, in order
+func Pending(files []File, state *State) []File {
+	var pending []File
+	for _, file := range files {
+		if !state.Applied || file.Version > state.Version {
+			pending = append(pending, file)
+		}
+	}
+	return pending
+}
+
+// RecordChecksums records the checksums of the files up to version, the database's
+// version after migrating from before, and returns how many were recorded
+// Migrations applied by this run replace any checksum left from before a manual
+// rollback; earlier ones are only recorded when they have none. The checksum table
+// is created if needed.
+func RecordChecksums(db *sql.DB, files []File, before *State, version uint) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + ChecksumTable + ` (
+		version BIGINT PRIMARY KEY,
+		filename TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", ChecksumTable, err)
+	}
+
+	recorded := 0
+	for _, file := range files {
+		if file.Version > version {
+			break
+		}
+		conflict := `DO NOTHING`
+		if !before.Applied || file.Version > before.Version {
+			conflict = `DO UPDATE SET filename = EXCLUDED.filename, checksum = EXCLUDED.checksum, recorded_at = NOW()`
+		} else if before.Checksums[file.Version] != "" {
+			continue
+		}
+		result, err := db.Exec(`
+			INSERT INTO `+ChecksumTable+` (version, filename, checksum)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (version) `+conflict,
+			int64(file.Version), file.Filename, file.Checksum)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to record checksum of %s: %w", file.Filename, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			recorded++
+		}
+	}
+	return recorded, nil
+}
@@ -0,0 +1,201 @@
+package migrations
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_tags.up.sql":    {Data: []byte("ALTER TABLE hosts ADD COLUMN tags TEXT[];")},
+		"000002_add_tags.down.sql":  {Data: []byte("ALTER TABLE hosts DROP COLUMN tags;")},
+		"000001_init.up.sql":        {Data: []byte("CREATE TABLE hosts (id TEXT);")},
+		"000010_add_index.up.sql":   {Data: []byte("CREATE INDEX idx ON hosts(id);")},
+		"README.md":                 {Data: []byte("not a migration")},
+		"000003_subdir.up.sql/x.up": {Data: []byte("ignored")},
+	}
+
+	files, err := LoadFS(fsys)
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	var versions []uint
+	for _, file := range files {
+		versions = append(versions, file.Version)
+	}
+	if want := []uint{1, 2, 10}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("versions = %v, want %v", versions, want)
+	}
+	if files[1].Name != "add_tags" || files[1].Filename != "000002_add_tags.up.sql" {
+		t.Errorf("files[1] = %q %q, want add_tags from 000002_add_tags.up.sql", files[1].Name, files[1].Filename)
+	}
+	if len(files[0].Checksum) != 64 || files[0].Checksum == files[1].Checksum {
+		t.Errorf("checksums = %q, %q, want distinct hex SHA-256", files[0].Checksum, files[1].Checksum)
+	}
+}
+
+func TestLoadFS_DuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_init.up.sql":  {Data: []byte("SELECT 1;")},
+		"1_other_init.up.sql": {Data: []byte("SELECT 2;")},
+	}
+	if _, err := LoadFS(fsys); err == nil || !strings.Contains(err.Error(), "same version") {
+		t.Errorf("LoadFS() error = %v, want a duplicate version error", err)
+	}
+}
+
+func TestLoad_UnsupportedSource(t *testing.T) {
+	if _, err := Load("github://sluggisty/snailbus/migrations"); err == nil || !strings.Contains(err.Error(), ErrUnsupportedSource.Error()) {
+		t.Errorf("Load() error = %v, want ErrUnsupportedSource", err)
+	}
+}
+
+// The repository's migrations must load, number without gaps, and each be reversible
+func TestLoad_RepositoryMigrations(t *testing.T) {
+	files, err := Load("file://../../migrations")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Load() found no migrations")
+	}
+	for i, file := range files {
+		if file.Version != uint(i+1) {
+			t.Errorf("%s: version %d, want %d", file.Filename, file.Version, i+1)
+		}
+		down := strings.TrimSuffix(file.Filename, ".up.sql") + ".down.sql"
+		if _, err := os.Stat(filepath.Join("../../migrations", down)); err != nil {
+			t.Errorf("%s has no down migration: %v", file.Filename, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	files := []File{
+		{Version: 1, Filename: "000001_init.up.sql", Checksum: "aaa"},
+		{Version: 2, Filename: "000002_add_tags.up.sql", Checksum: "bbb"},
+		{Version: 3, Filename: "000003_add_index.up.sql", Checksum: "ccc"},
+	}
+
+	tests := []struct {
+		name    string
+		state   *State
+		wantErr string
+	}{
+		{
+			name:  "fresh database",
+			state: &State{Checksums: map[uint]string{}},
+		},
+		{
+			name:  "matching checksums",
+			state: &State{Applied: true, Version: 2, Checksums: map[uint]string{1: "aaa", 2: "bbb"}},
+		},
+		{
+			name:  "applied before checksums were recorded",
+			state: &State{Applied: true, Version: 3, Checksums: map[uint]string{}},
+		},
+		{
+			name:    "edited after it was applied",
+			state:   &State{Applied: true, Version: 2, Checksums: map[uint]string{1: "aaa", 2: "changed"}},
+			wantErr: "000002_add_tags.up.sql has changed",
+		},
+		{
+			name:    "database migrated by a newer build",
+			state:   &State{Applied: true, Version: 4, Checksums: map[uint]string{}},
+			wantErr: "at migration 4, which is not among the migration files (latest 3)",
+		},
+		{
+			name:  "checksums above the version are from before a rollback",
+			state: &State{Applied: true, Version: 1, Checksums: map[uint]string{1: "aaa", 2: "old"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(files, tt.state)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify_MissingFile(t *testing.T) {
+	files := []File{{Version: 1, Checksum: "aaa"}, {Version: 3, Checksum: "ccc"}}
+	state := &State{Applied: true, Version: 3, Checksums: map[uint]string{1: "aaa", 2: "bbb", 3: "ccc"}}
+	if err := Verify(files, state); err == nil || !strings.Contains(err.Error(), "migration 2 is missing") {
+		t.Errorf("Verify() error = %v, want migration 2 missing", err)
+	}
+}
+
+func TestPending(t *testing.T) {
+	files := []File{{Version: 1}, {Version: 2}, {Version: 3}}
+	tests := []struct {
+		name  string
+		state *State
+		want  []uint
+	}{
+		{"fresh database", &State{}, []uint{1, 2, 3}},
+		{"part way", &State{Applied: true, Version: 1}, []uint{2, 3}},
+		{"up to date", &State{Applied: true, Version: 3}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint
+			for _, file := range Pending(files, tt.state) {
+				got = append(got, file.Version)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePlan(t *testing.T) {
+	files := []File{
+		{Version: 1, Filename: "000001_init.up.sql", Checksum: "aaa", SQL: "CREATE TABLE hosts (id TEXT);"},
+		{Version: 2, Filename: "000002_add_tags.up.sql", Checksum: "bbb", SQL: "ALTER TABLE hosts ADD COLUMN tags TEXT[];"},
+	}
+
+	var out bytes.Buffer
+	state := &State{Applied: true, Version: 1, Checksums: map[uint]string{1: "aaa"}}
+	if err := WritePlan(&out, files, state); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	for _, want := range []string{
+		"Database version: 1\n",
+		"Applied migrations match the migration files",
+		"1 pending migration(s)",
+		"000002_add_tags.up.sql",
+		"ACCESS EXCLUSIVE",
+		"blocks reads and writes",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "000001_init.up.sql") {
+		t.Errorf("plan lists an applied migration:\n%s", out.String())
+	}
+
+	out.Reset()
+	state = &State{Applied: true, Version: 1, Checksums: map[uint]string{1: "edited"}}
+	if err := WritePlan(&out, files, state); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Verification failed") {
+		t.Errorf("plan does not report the checksum mismatch:\n%s", out.String())
+	}
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"fmt"
+	"io"
+)
+
+// WritePlan writes what migrating the database to files would do: the current
+// version, any mismatch Verify would refuse to start with, and each pending
+// migration with the locks it is expected to take
+func WritePlan(w io.Writer, files []File, state *State) error {
+	pw := &planWriter{w: w}
+
+	switch {
+	case !state.Applied:
+		pw.printf("Database version: none (no migrations applied)\n")
+	case state.Dirty:
+		pw.printf("Database version: %d (dirty: a migration failed part way; repair it and force the version before upgrading)\n", state.Version)
+	default:
+		pw.printf("Database version: %d\n", state.Version)
+	}
+
+	if err := Verify(files, state); err != nil {
+		pw.printf("\nVerification failed; the server will refuse to start:\n%v\n", err)
+	} else {
+		pw.printf("Applied migrations match the migration files\n")
+	}
+
+	pending := Pending(files, state)
+	if len(pending) == 0 {
+		pw.printf("\nNo pending migrations\n")
+		return pw.err
+	}
+
+	pw.printf("\n%d pending migration(s), each run in its own transaction:\n", len(pending))
+	for _, file := range pending {
+		pw.printf("\n  %s\n", file.Filename)
+		locks := EstimateLocks(file.SQL)
+		if len(locks) == 0 {
+			pw.printf("    no locks on existing tables\n")
+			continue
+		}
+		for _, lock := range locks {
+			pw.printf("    %-22s %-32s %s\n", lock.Mode, lock.Table, lock.Effect())
+		}
+	}
+	pw.printf("\nLocks are estimated from the SQL and held until each migration's transaction commits.\n")
+	return pw.err
+}
+
+// planWriter keeps the first write error so WritePlan can report it once
+type planWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *planWriter) printf(format string, args ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
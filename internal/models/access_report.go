@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Access report formats
+const (
+	AccessReportFormatJSON = "json"
+	AccessReportFormatCSV  = "csv"
+)
+
+// AccessReport lists everyone and everything with access to an organization at one point in time
+// @Description Point-in-time access review of an organization: its users with their roles, host access tags, API keys, and delegated grants, and its OAuth integrations. Secrets and key hashes are never included.
+type AccessReport struct {
+	OrgID        string                     `json:"org_id"`
+	OrgName      string                     `json:"org_name"`
+	GeneratedAt  time.Time                  `json:"generated_at"`
+	GeneratedBy  string                     `json:"generated_by"` // ID of the admin who requested it
+	Users        []*AccessReportUser        `json:"users"`
+	Integrations []*AccessReportIntegration `json:"integrations"`
+}
+
+// AccessReportUser is a user's access and credentials
+type AccessReportUser struct {
+	ID             string        `json:"id"`
+	Username       string        `json:"username"`
+	Email          string        `json:"email"`
+	Role           string        `json:"role"`
+	IsActive       bool          `json:"is_active"`
+	IsSystemAdmin  bool          `json:"is_system_admin"`
+	HostAccessTags []string      `json:"host_access_tags"` // Empty when the user sees every host
+	CreatedAt      time.Time     `json:"created_at"`
+	LastActivityAt *time.Time    `json:"last_activity_at,omitempty"` // Latest use of any of the user's API keys or grants
+	APIKeys        []*APIKey     `json:"api_keys"`                   // Including the keys of Web UI sessions
+	Grants         []*OAuthGrant `json:"grants"`                     // Access the user delegated to integrations
+}
+
+// AccessReportIntegration is an OAuth client registered by the organization
+type AccessReportIntegration struct {
+	*OAuthClient
+	Grants     int        `json:"grants"`                 // Users who authorized it
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // Latest use of any of its grants
+}
@@ -0,0 +1,23 @@
+package models
+
+// HostAccount is a local user account from a host's latest report
+// @Description Local user account reported by a host, normalized from the report's users section
+type HostAccount struct {
+	HostID   string `json:"host_id"`
+	Hostname string `json:"hostname"`
+	Username string `json:"username"`
+	UID      *int64 `json:"uid,omitempty"`
+	GID      *int64 `json:"gid,omitempty"`
+	Home     string `json:"home,omitempty"`
+	Shell    string `json:"shell,omitempty"`
+}
+
+// HostAccountFilter selects accounts across an organization's hosts
+// Empty fields match any value.
+type HostAccountFilter struct {
+	Username        string
+	Shell           string
+	UID             *int64
+	HostID          string
+	IncludeArchived bool
+}
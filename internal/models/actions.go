@@ -0,0 +1,128 @@
+package models
+
+import "time"
+
+// Finding types that can trigger outbound actions
+const (
+	FindingHostUnreachable = "host_unreachable"      // A probe found a host unreachable
+	FindingReportErrors    = "report_errors"         // An ingested report carried collection errors
+	FindingHostOverdue     = "host_overdue"          // A host missed its expected check-in window
+	FindingHealthWarning   = "host_health_warning"   // A host's reported health became warning
+	FindingHealthCritical  = "host_health_critical"  // A host's reported health became critical
+	FindingHealthRecovered = "host_health_recovered" // A host's reported health went back to ok
+	FindingHostNew         = "host_new"              // A host sent its first report
+	FindingIOCMatch        = "ioc_match"             // A host matched an indicator of compromise for the first time
+)
+
+// Action kinds
+const (
+	ActionKindHTTP       = "http"       // Templated HTTP call
+	ActionKindSlack      = "slack"      // Slack incoming webhook; body_template is the message text
+	ActionKindMattermost = "mattermost" // Mattermost incoming webhook; body_template is the message text
+)
+
+// Action run statuses
+const (
+	ActionRunPending   = "pending"   // Waiting for its first attempt or a retry
+	ActionRunRunning   = "running"   // Being delivered
+	ActionRunSucceeded = "succeeded" // The target answered with a 2xx status
+	ActionRunFailed    = "failed"    // Every attempt failed; can be retried manually
+)
+
+// Finding is a problem detected on a host
+// @Description A problem detected on a host, passed to action templates as .Finding
+type Finding struct {
+	Type       string    `json:"type"`
+	HostID     string    `json:"host_id"`
+	Hostname   string    `json:"hostname"`
+	Summary    string    `json:"summary"`
+	Details    []string  `json:"details,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Key identifies repeated findings of the same problem on the same host
+func (f Finding) Key() string {
+	return f.Type + ":" + f.HostID
+}
+
+// Action is an HTTP call made when a finding is detected (e.g. creating a Jira or GitHub issue)
+// Slack and Mattermost actions post a chat message to an incoming webhook instead.
+// @Description Outbound HTTP call templated from a finding. URL, header values, and body are Go text/template strings; {{secret "name"}} inserts an organization secret and {{json .Finding.Summary}} a JSON-quoted value. For slack and mattermost actions the body template renders the message text.
+type Action struct {
+	ID                      string            `json:"id"`
+	Name                    string            `json:"name"`
+	Kind                    string            `json:"kind"`
+	Triggers                []string          `json:"triggers"` // Finding types that run the action
+	Method                  string            `json:"method"`
+	URL                     string            `json:"url"`
+	Headers                 map[string]string `json:"headers,omitempty"`
+	BodyTemplate            string            `json:"body_template,omitempty"`
+	Enabled                 bool              `json:"enabled"`
+	SchemaVersion           int               `json:"schema_version"`      // Pinned shape of the template data and {{payload}}
+	RateLimitPerHour        int               `json:"rate_limit_per_hour"` // Most runs queued in any hour; 0 is unlimited
+	SigningSecret           string            `json:"-"`
+	PreviousSigningSecret   string            `json:"-"`                                    // Also signs deliveries until PreviousSecretExpiresAt
+	SigningSecretCreatedAt  *time.Time        `json:"signing_secret_created_at,omitempty"`  // Unset for actions that are not signed yet
+	PreviousSecretExpiresAt *time.Time        `json:"previous_secret_expires_at,omitempty"` // Set during a rotation's grace period
+	CreatedBy               string            `json:"created_by,omitempty"`
+	CreatedAt               time.Time         `json:"created_at"`
+	UpdatedAt               time.Time         `json:"updated_at"`
+}
+
+// ActionSecretResponse is returned when an action's signing secret is issued
+type ActionSecretResponse struct {
+	*Action
+	SigningSecret string `json:"signing_secret"` // Plain secret, shown only once
+}
+
+// ActionRequest creates or replaces an action
+// @Description Request payload for creating or replacing an outbound action. Kind defaults to http, method to POST, and enabled to true. Slack and mattermost actions always POST and default body_template to a one-line summary of the finding. schema_version defaults to the current version on create and is left unchanged on update.
+type ActionRequest struct {
+	Name             string            `json:"name" binding:"required,max=100"`
+	Kind             string            `json:"kind" binding:"omitempty,oneof=http slack mattermost"`
+	Triggers         []string          `json:"triggers" binding:"required,min=1,max=8,dive,oneof=host_unreachable report_errors host_overdue host_health_warning host_health_critical host_health_recovered host_new ioc_match"`
+	Method           string            `json:"method" binding:"omitempty,oneof=POST PUT PATCH"`
+	URL              string            `json:"url" binding:"required,max=2000"`
+	Headers          map[string]string `json:"headers" binding:"max=32"`
+	BodyTemplate     string            `json:"body_template" binding:"max=65536"`
+	Enabled          *bool             `json:"enabled"`
+	SchemaVersion    int               `json:"schema_version" binding:"omitempty,min=1"`
+	RateLimitPerHour int               `json:"rate_limit_per_hour" binding:"min=0,max=10000"`
+}
+
+// RotateActionSecretRequest replaces an action's signing secret
+// @Description Request payload for rotating an action's signing secret. The previous secret keeps signing deliveries for grace_period_hours (default 24, 0 to drop it immediately).
+type RotateActionSecretRequest struct {
+	GracePeriodHours *int `json:"grace_period_hours" binding:"omitempty,min=0,max=720"`
+}
+
+// ActionRun is one delivery of an action for a finding
+// @Description Delivery history of an action for one finding, retried with backoff until it succeeds or runs out of attempts
+type ActionRun struct {
+	ID             string     `json:"id"`
+	ActionID       string     `json:"action_id"`
+	OrgID          string     `json:"org_id"`
+	Finding        Finding    `json:"finding"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last attempt
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"` // Set while pending
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// OrgSecret is a named secret available to an organization's action templates
+// @Description Organization secret; the value is write-only and never returned
+type OrgSecret struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetOrgSecretRequest sets the value of an organization secret
+// @Description Request payload setting an organization secret
+type SetOrgSecretRequest struct {
+	Value string `json:"value" binding:"required,max=4096"`
+}
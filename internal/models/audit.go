@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditUserCreated       = "user.created"
+	AuditUserDeleted       = "user.deleted"
+	AuditUserRoleChanged   = "user.role_changed"
+	AuditUserImpersonated  = "user.impersonated"
+	AuditMemberAdded       = "member.added"
+	AuditMemberRemoved     = "member.removed"
+	AuditMemberRoleChanged = "member.role_changed"
+	AuditAPIKeyCreated     = "api_key.created"
+	AuditAPIKeyDeleted     = "api_key.deleted"
+	AuditHostDeleted       = "host.deleted"
+	AuditHostIngested      = "host.ingested"
+	AuditHostEnrolled      = "host.enrolled"
+
+	AuditEnrollmentTokenCreated = "enrollment_token.created"
+	AuditEnrollmentTokenDeleted = "enrollment_token.deleted"
+)
+
+// AuditActions lists the actions recorded in the audit log
+var AuditActions = []string{
+	AuditUserCreated,
+	AuditUserDeleted,
+	AuditUserRoleChanged,
+	AuditUserImpersonated,
+	AuditMemberAdded,
+	AuditMemberRemoved,
+	AuditMemberRoleChanged,
+	AuditAPIKeyCreated,
+	AuditAPIKeyDeleted,
+	AuditHostDeleted,
+	AuditHostIngested,
+	AuditHostEnrolled,
+	AuditEnrollmentTokenCreated,
+	AuditEnrollmentTokenDeleted,
+}
+
+// Audit target types
+const (
+	AuditTargetUser   = "user"
+	AuditTargetAPIKey = "api_key"
+	AuditTargetHost   = "host"
+
+	AuditTargetEnrollmentToken = "enrollment_token"
+)
+
+// AuditEvent is an entry in an organization's audit log
+// @Description A state-changing operation: who did it, to what, and from which request. Events are ordered by id, newest first.
+type AuditEvent struct {
+	ID                   int64             `json:"id"`
+	OrgID                string            `json:"org_id"`
+	Action               string            `json:"action"`
+	ActorUserID          string            `json:"actor_user_id,omitempty"`         // Cleared if the user is deleted
+	ActorUsername        string            `json:"actor_username,omitempty"`        // Username at the time of the event
+	AuthMethod           string            `json:"auth_method,omitempty"`           // How the actor authenticated (api_key, jwt, ...)
+	ImpersonatorUserID   string            `json:"impersonator_user_id,omitempty"`  // System administrator acting as the actor, if any
+	ImpersonatorUsername string            `json:"impersonator_username,omitempty"` // Their username at the time of the event
+	TargetType           string            `json:"target_type,omitempty"`
+	TargetID             string            `json:"target_id,omitempty"`
+	Details              map[string]string `json:"details,omitempty"` // Action-specific context, e.g. the new role
+	RequestID            string            `json:"request_id,omitempty"`
+	ClientIP             string            `json:"client_ip,omitempty"`
+	UserAgent            string            `json:"user_agent,omitempty"`
+	CreatedAt            time.Time         `json:"created_at"`
+}
+
+// AuditFilter selects audit events; empty fields match every event
+type AuditFilter struct {
+	Action      string
+	ActorUserID string
+}
+
+// Matches reports whether event is selected by the filter
+func (f AuditFilter) Matches(event *AuditEvent) bool {
+	return (f.Action == "" || event.Action == f.Action) &&
+		(f.ActorUserID == "" || event.ActorUserID == f.ActorUserID)
+}
@@ -9,37 +9,62 @@ type User struct {
 	Email     string    `json:"email"`
 	IsActive  bool      `json:"is_active"`
 	IsAdmin   bool      `json:"is_admin"`
-	OrgID     string    `json:"org_id"` // Required foreign key to organizations
-	Role      string    `json:"role"`   // Required enum: 'admin', 'editor', 'viewer'
+	OrgID     string    `json:"org_id"`  // Required foreign key to organizations
+	Role      string    `json:"role"`    // Required enum: 'admin', 'editor', 'viewer'
+	Version   int64     `json:"version"` // Incremented on every change; the user's ETag
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Role is an organization role and what it allows
+// @Description Organization role with the permissions it grants; each role has the permissions of the roles before it
+type Role struct {
+	Name        string   `json:"name" example:"editor"`
+	Description string   `json:"description" example:"Submits reports and manages hosts"`
+	Permissions []string `json:"permissions" example:"hosts:read,hosts:write,ingest"`
+}
+
+// RolesResponse lists the organization roles from least to most privileged
+type RolesResponse struct {
+	Roles []Role `json:"roles"`
+}
+
 // APIKey represents an API key
 type APIKey struct {
-	ID         string     `json:"id"`
-	UserID     string     `json:"user_id"`
-	KeyHash    string     `json:"-"` // Never return the hash
-	KeyPrefix  string     `json:"-"` // Never return the prefix
-	Name       string     `json:"name"`
-	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	KeyHash          string     `json:"-"` // Never return the hash
+	KeyPrefix        string     `json:"-"` // Never return the prefix
+	Name             string     `json:"name"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Expired          bool       `json:"expired"` // Whether ExpiresAt has passed; expired keys are rejected and eventually deleted
+	CreatedAt        time.Time  `json:"created_at"`
+	AllowedEndpoints []string   `json:"allowed_endpoints,omitempty"` // "[METHOD ]/path" patterns; empty means unrestricted
+	HostID           string     `json:"host_id,omitempty"`           // Host the key may report as, for keys issued at enrollment
 }
 
 // CreateAPIKeyRequest is used when creating a new API key
 type CreateAPIKeyRequest struct {
-	Name      string     `json:"name" binding:"required"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Name             string     `json:"name" binding:"required"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	AllowedEndpoints []string   `json:"allowed_endpoints,omitempty" binding:"max=32,dive,min=1,max=200"`
+}
+
+// UpdateAPIKeyEndpointsRequest replaces the endpoint restrictions of an API key
+// An empty list removes all restrictions
+type UpdateAPIKeyEndpointsRequest struct {
+	AllowedEndpoints []string `json:"allowed_endpoints" binding:"max=32,dive,min=1,max=200"`
 }
 
 // CreateAPIKeyResponse is returned when creating a new API key
 type CreateAPIKeyResponse struct {
-	ID        string     `json:"id"`
-	Key       string     `json:"key"` // Plain key, shown only once
-	Name      string     `json:"name"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID               string     `json:"id"`
+	Key              string     `json:"key"` // Plain key, shown only once
+	Name             string     `json:"name"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	AllowedEndpoints []string   `json:"allowed_endpoints,omitempty"`
 }
 
 // LoginRequest is used for user login
@@ -57,11 +82,62 @@ type RegisterRequest struct {
 	OrgName  string `json:"org_name" binding:"required,min=1,max=100"` // Name for the new organization
 }
 
-// LoginResponse is returned after successful login
+// LoginResponse is returned after successful login and session refresh
 type LoginResponse struct {
 	User      *User  `json:"user"`
-	Token     string `json:"token"`      // API key for this session
+	Token     string `json:"token"`      // Session access token, or an API key when sessions are disabled
 	CSRFToken string `json:"csrf_token"` // CSRF token for frontend protection
+
+	RefreshToken string     `json:"refresh_token,omitempty"` // Renews the session at /auth/refresh; only with sessions
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`    // When the access token expires; only with sessions
+}
+
+// RefreshSessionRequest renews a session with its refresh token
+type RefreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionToken is the hashed access and refresh token pair of a session
+type SessionToken struct {
+	AccessHash  string
+	RefreshHash string
+	ExpiresAt   time.Time // Access token expiry; refresh tokens work until the session expires
+}
+
+// Session is a user's sign-in to the Web UI, ended by logging out or by its expiry
+type Session struct {
+	ID         string
+	UserID     string
+	OrgID      string
+	ExpiresAt  time.Time // The session cannot be refreshed after this
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	Token      SessionToken
+}
+
+// ImpersonateRequest is a system administrator's request to act as another user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,min=1,max=500"` // Why, e.g. the support ticket; recorded in the audit log
+}
+
+// ImpersonateResponse holds an impersonation token
+type ImpersonateResponse struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"` // Plain token, shown only once
+	User      *User     `json:"user"`  // The user the token acts as
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ImpersonationToken lets a system administrator act as a user until it expires
+type ImpersonationToken struct {
+	ID          string
+	AdminUserID string
+	UserID      string
+	OrgID       string // The user's organization when the token was issued
+	TokenHash   string
+	Reason      string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
 }
 
 // CreateUserRequest is used by admins to create new users
@@ -69,10 +145,34 @@ type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
-	Role     string `json:"role" binding:"required,oneof=admin editor viewer"`
+	Role     string `json:"role" binding:"required" enums:"viewer,editor,admin"` // Checked with auth.ValidateRole
+}
+
+// CreateOrganizationRequest is used when creating an organization outside of registration
+// (e.g. from the snailbusctl CLI)
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
 }
 
 // UpdateUserRoleRequest is used by admins to update a user's role
 type UpdateUserRoleRequest struct {
-	Role string `json:"role" binding:"required,oneof=admin editor viewer"`
+	Role string `json:"role" binding:"required" enums:"viewer,editor,admin"` // Checked with auth.ValidateRole
+}
+
+// OrgMembership is an organization a user can act in and the user's role there
+// @Description A user's access to an organization. home is the organization the user belongs to; other memberships are selected per request with the X-Org-ID header.
+type OrgMembership struct {
+	OrgID     string    `json:"org_id"`
+	OrgName   string    `json:"org_name"`
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Home      bool      `json:"home"` // The user's own organization (users.org_id and users.role)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddOrgMemberRequest is used by admins to let a user of another organization act in theirs
+type AddOrgMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required" enums:"viewer,editor,admin"` // Checked with auth.ValidateRole
 }
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Import batch sources
+const (
+	ImportSourceAPI = "api" // Uploaded to POST /api/v1/bundles
+	ImportSourceCLI = "cli" // Imported with snailbusctl import-bundle
+)
+
+// Import result statuses of a report in a bundle
+const (
+	ImportReportImported   = "imported"   // Stored as the host's current report
+	ImportReportSuperseded = "superseded" // The host already has a report at least as recent
+	ImportReportRejected   = "rejected"   // Invalid; see the result's error
+)
+
+// ImportBatch records the import of an offline bundle
+// @Description Import of a signed offline bundle of reports. Reports keep the collection time their agent recorded; results list what happened to each report.
+type ImportBatch struct {
+	ID           string         `json:"id"`
+	Source       string         `json:"source"`                // api or cli
+	ImportedBy   string         `json:"imported_by,omitempty"` // User the reports are attributed to
+	BundleSHA256 string         `json:"bundle_sha256"`         // Checksum of the uploaded bundle file
+	KeyID        string         `json:"key_id"`                // Trusted key the bundle was signed with
+	Exporter     string         `json:"exporter,omitempty"`    // Who or what exported the bundle, from its manifest
+	ExportedAt   time.Time      `json:"exported_at"`
+	ReportCount  int            `json:"report_count"`
+	Imported     int            `json:"imported"`
+	Superseded   int            `json:"superseded"`
+	Rejected     int            `json:"rejected"`
+	Results      []ImportResult `json:"results,omitempty"` // Only returned for a single batch
+	StartedAt    time.Time      `json:"started_at"`
+	CompletedAt  *time.Time     `json:"completed_at,omitempty"` // Unset while the import runs, or if it was interrupted
+}
+
+// ImportResult is the outcome of one report in a bundle
+type ImportResult struct {
+	Path         string `json:"path"` // File name in the bundle
+	HostID       string `json:"host_id,omitempty"`
+	Hostname     string `json:"hostname,omitempty"`
+	CollectionID string `json:"collection_id,omitempty"`
+	Timestamp    string `json:"timestamp,omitempty"` // Collection time, RFC 3339 UTC
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Host statuses, derived from whether the host reports within its check-in window
+const (
+	HostStatusActive = "active" // The host reported within its check-in window
+	HostStatusStale  = "stale"  // The host missed its check-in window and has not reported since
+)
+
+// HostStatuses lists the valid host statuses
+var HostStatuses = []string{HostStatusActive, HostStatusStale}
+
+// HostStatus returns the status of a host marked stale at staleSince; nil if it is not marked
+func HostStatus(staleSince *time.Time) string {
+	if staleSince != nil {
+		return HostStatusStale
+	}
+	return HostStatusActive
+}
+
+// CheckinSchedule declares how often an organization's hosts are expected to report
+// @Description Expected check-in cadence of the organization's hosts. A host uses the shortest window whose tag it carries, otherwise default_interval_seconds, otherwise the server default (CHECKIN_DEFAULT_INTERVAL).
+type CheckinSchedule struct {
+	OrgID                  string          `json:"org_id"`
+	DefaultIntervalSeconds int64           `json:"default_interval_seconds,omitempty"` // Hosts without a matching window; 0 uses the server default
+	Windows                []CheckinWindow `json:"windows"`
+	UpdatedByUserID        string          `json:"updated_by_user_id,omitempty"` // User who last changed the schedule
+	Version                int64           `json:"version"`                      // Incremented whenever the schedule is replaced; its ETag
+	CreatedAt              time.Time       `json:"created_at"`
+	UpdatedAt              time.Time       `json:"updated_at"`
+}
+
+// CheckinWindow is the expected check-in interval of hosts carrying a tag
+// @Description Hosts carrying tag are expected to report at least every interval_seconds
+type CheckinWindow struct {
+	Tag             string `json:"tag" binding:"required,min=1,max=100" example:"env:prod"`
+	IntervalSeconds int64  `json:"interval_seconds" binding:"required,min=60,max=2592000" example:"3600"`
+}
+
+// SetCheckinScheduleRequest replaces an organization's check-in schedule
+// @Description Request payload for the check-in schedule. Delete the schedule to use the server default for every host.
+type SetCheckinScheduleRequest struct {
+	DefaultIntervalSeconds int64           `json:"default_interval_seconds" binding:"omitempty,min=60,max=2592000" example:"86400"`
+	Windows                []CheckinWindow `json:"windows" binding:"max=100,dive"`
+}
+
+// HostCheckin is a host's last check-in measured against its expected window
+// @Description A host's last report compared with the check-in window that applies to it
+type HostCheckin struct {
+	HostID                  string    `json:"host_id"`
+	Hostname                string    `json:"hostname"`
+	LastSeen                time.Time `json:"last_seen"`
+	ExpectedIntervalSeconds int64     `json:"expected_interval_seconds"`
+	WindowTag               string    `json:"window_tag,omitempty"` // Tag whose window applies; empty for the organization or server default
+	DueAt                   time.Time `json:"due_at"`               // When the next report is expected by
+	Overdue                 bool      `json:"overdue"`
+	OverdueSeconds          float64   `json:"overdue_seconds,omitempty"`
+}
+
+// HostUptime is the share of a period during which a host reported within its check-in window
+// @Description Reporting uptime of a host. Each report covers the host's check-in window from when it was received; the host is down while no report covers it. Measured from the start of the period, or from the host's first report if that is later.
+type HostUptime struct {
+	HostID                  string    `json:"host_id"`
+	Hostname                string    `json:"hostname"`
+	ExpectedIntervalSeconds int64     `json:"expected_interval_seconds"`
+	WindowTag               string    `json:"window_tag,omitempty"` // Tag whose window applies; empty for the organization or server default
+	From                    time.Time `json:"from"`                 // Start of the measurement
+	To                      time.Time `json:"to"`
+	MeasuredSeconds         float64   `json:"measured_seconds"`
+	UpSeconds               float64   `json:"up_seconds"`
+	UptimePercent           float64   `json:"uptime_percent"`
+	Reports                 int       `json:"reports"`                // Reports received in the period
+	Outages                 int       `json:"outages"`                // Periods no report covered, including one still ongoing
+	LongestOutageSeconds    float64   `json:"longest_outage_seconds"` // Longest of them
+}
+
+// UptimeGroup is the reporting uptime of the hosts sharing a tag value
+// @Description Reporting uptime of a group of hosts, weighted by how long each host was measured
+type UptimeGroup struct {
+	Group           string  `json:"group"` // Tag value; empty for hosts without the tag
+	Hosts           int     `json:"hosts"`
+	MeasuredSeconds float64 `json:"measured_seconds"`
+	UpSeconds       float64 `json:"up_seconds"`
+	UptimePercent   float64 `json:"uptime_percent"`
+	Outages         int     `json:"outages"`
+}
+
+// UptimeStats is the reporting uptime of an organization's hosts over a period
+// @Description Reporting uptime of the organization's hosts, overall, per group, and per host (lowest first)
+type UptimeStats struct {
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	Window        string        `json:"window"`             // Length of the period, as requested
+	GroupBy       string        `json:"group_by,omitempty"` // Tag key the hosts are grouped by
+	Hosts         int           `json:"hosts"`
+	UptimePercent float64       `json:"uptime_percent"` // Weighted by how long each host was measured
+	Groups        []UptimeGroup `json:"groups,omitempty"`
+	HostUptimes   []HostUptime  `json:"host_uptimes"`
+}
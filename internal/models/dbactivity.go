@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// DBActivity describes a database backend serving snailbus, as reported by pg_stat_activity
+type DBActivity struct {
+	PID             int        `json:"pid"`
+	ApplicationName string     `json:"application_name"`
+	RequestID       string     `json:"request_id,omitempty"` // Request that issued the query, when attributed
+	State           string     `json:"state"`
+	WaitEventType   string     `json:"wait_event_type,omitempty"`
+	WaitEvent       string     `json:"wait_event,omitempty"`
+	Query           string     `json:"query"`
+	BackendStart    time.Time  `json:"backend_start"`
+	QueryStart      *time.Time `json:"query_start,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds"` // Time since query_start
+}
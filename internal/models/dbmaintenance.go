@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// TableMaintenance describes the size, dead tuples, and vacuum history of a snailbus
+// table, as reported by pg_stat_user_tables
+type TableMaintenance struct {
+	Table            string `json:"table"`
+	Partitioned      bool   `json:"partitioned"`        // A partition or a partitioned parent
+	FillFactor       int    `json:"fillfactor"`         // 100 unless set with ALTER TABLE ... SET (fillfactor)
+	TableBytes       int64  `json:"table_bytes"`        // Heap, including TOAST
+	IndexBytes       int64  `json:"index_bytes"`        // All indexes
+	LiveTuples       int64  `json:"live_tuples"`        // Estimated
+	DeadTuples       int64  `json:"dead_tuples"`        // Estimated, reclaimed by the next vacuum
+	ModsSinceAnalyze int64  `json:"mods_since_analyze"` // Rows changed since the last analyze
+	Inserts          int64  `json:"inserts"`            // Since statistics were reset
+	Updates          int64  `json:"updates"`            // Since statistics were reset, including HOT updates
+	HOTUpdates       int64  `json:"hot_updates"`        // Updates that did not touch any index
+	Deletes          int64  `json:"deletes"`            // Since statistics were reset
+	VacuumCount      int64  `json:"vacuum_count"`       // Manual vacuums
+	AutovacuumCount  int64  `json:"autovacuum_count"`   // Vacuums by autovacuum
+	AutoanalyzeCount int64  `json:"autoanalyze_count"`  // Analyzes by autovacuum
+
+	// Derived from the counters above
+	DeadTupleRatio      float64 `json:"dead_tuple_ratio"`      // Dead tuples out of all tuples
+	HOTUpdateRatio      float64 `json:"hot_update_ratio"`      // HOT updates out of all updates
+	EstimatedBloatBytes int64   `json:"estimated_bloat_bytes"` // Table and index space held by dead tuples
+
+	LastVacuum      *time.Time `json:"last_vacuum,omitempty"`
+	LastAutovacuum  *time.Time `json:"last_autovacuum,omitempty"`
+	LastAnalyze     *time.Time `json:"last_analyze,omitempty"`
+	LastAutoanalyze *time.Time `json:"last_autoanalyze,omitempty"`
+
+	Indexes []IndexMaintenance `json:"indexes"`
+}
+
+// IndexMaintenance describes the size and use of an index, as reported by pg_stat_user_indexes
+type IndexMaintenance struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	Scans  int64  `json:"scans"` // Since statistics were reset
+	Unique bool   `json:"unique"`
+}
+
+// VacuumProgress describes a vacuum running on a snailbus table, as reported by pg_stat_progress_vacuum
+type VacuumProgress struct {
+	PID                int     `json:"pid"`
+	Table              string  `json:"table"`
+	Autovacuum         bool    `json:"autovacuum"`
+	Phase              string  `json:"phase"`
+	HeapBlocksTotal    int64   `json:"heap_blocks_total"`
+	HeapBlocksVacuumed int64   `json:"heap_blocks_vacuumed"`
+	DurationSeconds    float64 `json:"duration_seconds"` // Time since the vacuum started
+}
+
+// Maintenance advice kinds
+const (
+	AdviceFillFactor   = "fillfactor"
+	AdviceAutovacuum   = "autovacuum"
+	AdviceBloat        = "bloat"
+	AdvicePartitioning = "partitioning"
+	AdviceUnusedIndex  = "unused_index"
+)
+
+// Maintenance advice severities
+const (
+	AdviceInfo    = "info"
+	AdviceWarning = "warning"
+)
+
+// MaintenanceAdvice is a suggested change to a table's storage or vacuum settings
+type MaintenanceAdvice struct {
+	Table    string `json:"table"`
+	Index    string `json:"index,omitempty"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	SQL      string `json:"sql,omitempty"` // Statement applying the suggestion; review before running it
+}
+
+// DBMaintenance reports the maintenance state of the snailbus tables
+type DBMaintenance struct {
+	CollectedAt    time.Time           `json:"collected_at"`
+	StatsResetAt   *time.Time          `json:"stats_reset_at,omitempty"` // Counters are cumulative since then
+	Tables         []TableMaintenance  `json:"tables"`
+	RunningVacuums []VacuumProgress    `json:"running_vacuums"`
+	Advice         []MaintenanceAdvice `json:"advice"`
+}
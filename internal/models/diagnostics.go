@@ -0,0 +1,21 @@
+package models
+
+// DatabaseDiagnostics describes the schema version and connection pools, for diagnostic bundles
+type DatabaseDiagnostics struct {
+	MigrationVersion uint                 `json:"migration_version"` // 0 when no migration has been applied
+	MigrationDirty   bool                 `json:"migration_dirty"`   // A migration failed part way and needs manual repair
+	Pools            map[string]PoolStats `json:"pools"`             // "primary" and, if configured, "replica"
+}
+
+// PoolStats are the statistics of a database connection pool
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMs     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
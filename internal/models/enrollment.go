@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// EnrollmentToken lets agents enroll themselves for an ingest-scoped API key
+type EnrollmentToken struct {
+	ID              string    `json:"id"`
+	OrgID           string    `json:"org_id"`
+	Name            string    `json:"name"`
+	TokenHash       string    `json:"-"` // Never return the hash
+	MaxUses         int       `json:"max_uses"`
+	Uses            int       `json:"uses"` // Enrollments so far
+	ExpiresAt       time.Time `json:"expires_at"`
+	CreatedByUserID string    `json:"created_by_user_id"` // Owns the API keys issued with the token
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CreateEnrollmentTokenRequest mints an enrollment token
+type CreateEnrollmentTokenRequest struct {
+	Name      string     `json:"name" binding:"required,min=1,max=100"`
+	MaxUses   int        `json:"max_uses" binding:"required,min=1,max=100000"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Defaults to 24 hours from now
+}
+
+// CreateEnrollmentTokenResponse is returned when minting an enrollment token
+type CreateEnrollmentTokenResponse struct {
+	*EnrollmentToken
+	Token string `json:"token"` // Plain token, shown only once
+}
+
+// EnrollRequest exchanges an enrollment token for an agent's API key
+type EnrollRequest struct {
+	Token    string `json:"token" binding:"required"`
+	HostID   string `json:"host_id" binding:"required,uuid"`
+	Hostname string `json:"hostname" binding:"required,max=255"`
+}
+
+// EnrollResponse carries the API key issued to an enrolled agent
+type EnrollResponse struct {
+	HostID           string   `json:"host_id"`
+	OrgID            string   `json:"org_id"`
+	APIKeyID         string   `json:"api_key_id"`
+	APIKey           string   `json:"api_key"` // Plain key, shown only once
+	AllowedEndpoints []string `json:"allowed_endpoints"`
+}
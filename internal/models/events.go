@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Host event types
+const (
+	HostEventIngested   = "ingested" // First report for a host, or a report after it was deleted
+	HostEventUpdated    = "updated"  // Report replacing an existing one
+	HostEventTagged     = "tagged"   // Tags replaced
+	HostEventEdited     = "edited"   // Display name or description changed
+	HostEventDeleted    = "deleted"
+	HostEventRestored   = "restored"   // Deleted host brought back with its last report and tags
+	HostEventArchived   = "archived"   // Hidden from default lists, facets, and findings; data is kept
+	HostEventUnarchived = "unarchived" // Archived host shown again
+)
+
+// HostEvent is an entry in the append-only stream of host mutations
+// @Description A host mutation. Events are ordered by id within an organization; the hosts list is a projection of this stream.
+type HostEvent struct {
+	ID          int64             `json:"id"`
+	OrgID       string            `json:"org_id"`
+	HostID      string            `json:"host_id"`
+	Hostname    string            `json:"hostname,omitempty"` // Hostname at the time of the event
+	Type        string            `json:"type"`
+	ActorUserID string            `json:"actor_user_id,omitempty"` // User who caused the event, if known
+	Payload     *HostEventPayload `json:"payload,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// HostEventPayload carries the state an event applies
+// Report is set for ingested, updated, and restored events; Tags for tagged and restored events;
+// Details for edited and restored events; Deletion for deleted events when a reason was given
+type HostEventPayload struct {
+	Report           *Report       `json:"report,omitempty"`
+	UploadedByUserID string        `json:"uploaded_by_user_id,omitempty"`
+	Tags             []string      `json:"tags,omitempty"`
+	Details          *HostDetails  `json:"details,omitempty"`
+	Deletion         *HostDeletion `json:"deletion,omitempty"`
+	ImportBatchID    string        `json:"import_batch_id,omitempty"` // Set on reports imported from an offline bundle
+}
+
+// Host deletion reasons
+const (
+	HostDeletionDecommissioned = "decommissioned" // Machine retired
+	HostDeletionDuplicate      = "duplicate"      // Same machine reported under another host ID
+	HostDeletionReimaged       = "reimaged"       // Reinstalled; the agent reports under a new host ID
+	HostDeletionMistake        = "mistake"        // Reported by accident, e.g. a test install
+	HostDeletionOther          = "other"          // Explained in the note
+
+	// HostDeletionRetention is set by the retention enforcer; users cannot give it
+	HostDeletionRetention = "retention" // Not seen within the organization's retention
+)
+
+// HostDeletionReasons lists the accepted deletion reasons
+var HostDeletionReasons = []string{
+	HostDeletionDecommissioned,
+	HostDeletionDuplicate,
+	HostDeletionReimaged,
+	HostDeletionMistake,
+	HostDeletionOther,
+}
+
+// MaxHostDeletionNoteLength bounds the free-text note of a deletion
+const MaxHostDeletionNoteLength = 500
+
+// HostDeletion records why a host was deleted
+type HostDeletion struct {
+	Reason string `json:"reason"`
+	Note   string `json:"note,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// FacetCount is the number of hosts sharing one facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// HostFacets holds exact host counts per facet for an organization
+// @Description Host counts grouped by OS name, OS version, and tag
+type HostFacets struct {
+	Total     int64        `json:"total"`      // Number of hosts
+	OSNames   []FacetCount `json:"os_name"`    // Hosts per OS name (e.g. "Fedora")
+	OSVersion []FacetCount `json:"os_version"` // Hosts per OS name and version (e.g. "Fedora 42")
+	Tags      []FacetCount `json:"tag"`        // Hosts per tag
+}
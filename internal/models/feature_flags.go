@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// FeatureFlag gates a feature that is being rolled out
+// @Description Feature flag with its global default and per-organization overrides
+type FeatureFlag struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Enabled     bool                  `json:"enabled"` // Default for organizations without an override
+	Orgs        []FeatureFlagOverride `json:"orgs"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+}
+
+// FeatureFlagOverride sets a flag for one organization regardless of its default
+type FeatureFlagOverride struct {
+	OrgID     string    `json:"org_id"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EnabledFor reports whether the flag is on for an organization
+func (f *FeatureFlag) EnabledFor(orgID string) bool {
+	for _, override := range f.Orgs {
+		if override.OrgID == orgID {
+			return override.Enabled
+		}
+	}
+	return f.Enabled
+}
+
+// SetFeatureFlagRequest creates or replaces a feature flag
+// @Description Request payload for a feature flag. enabled is the default for organizations without an override.
+type SetFeatureFlagRequest struct {
+	Description string `json:"description" binding:"max=500"`
+	Enabled     *bool  `json:"enabled" binding:"required"`
+}
+
+// SetFeatureFlagOverrideRequest enables or disables a flag for one organization
+type SetFeatureFlagOverrideRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
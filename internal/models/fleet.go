@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// FleetHost is a host as it was at a point in time, rebuilt from the host event stream
+type FleetHost struct {
+	HostID       string   `json:"host_id"`
+	Hostname     string   `json:"hostname"`
+	OSName       string   `json:"os_name,omitempty"`
+	OSVersion    string   `json:"os_version,omitempty"`
+	SnailVersion string   `json:"snail_version,omitempty"` // snail-core agent version
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// OSRelease is the OS name and version of a fleet host, e.g. "Fedora 42"
+func (h *FleetHost) OSRelease() string {
+	if h.OSVersion == "" {
+		return h.OSName
+	}
+	if h.OSName == "" {
+		return h.OSVersion
+	}
+	return h.OSName + " " + h.OSVersion
+}
+
+// FleetHostRef identifies a host in a fleet comparison
+type FleetHostRef struct {
+	HostID   string `json:"host_id"`
+	Hostname string `json:"hostname"`
+}
+
+// FleetMigration is a group of hosts that moved from one value to another
+// @Description Hosts that moved between the same two OS releases or agent versions
+type FleetMigration struct {
+	From  string         `json:"from"`
+	To    string         `json:"to"`
+	Count int            `json:"count"`
+	Hosts []FleetHostRef `json:"hosts"`
+}
+
+// FleetComparison is what changed in the fleet between two points in time
+// @Description Fleet changes between two points in time: hosts added and removed, OS release migrations, and agent version changes
+type FleetComparison struct {
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	HostsFrom     int              `json:"hosts_from"` // Hosts at from
+	HostsTo       int              `json:"hosts_to"`   // Hosts at to
+	Added         []FleetHostRef   `json:"added"`
+	Removed       []FleetHostRef   `json:"removed"`
+	OSMigrations  []FleetMigration `json:"os_migrations"`
+	AgentUpgrades []FleetMigration `json:"agent_upgrades"` // Any snail-core version change, including downgrades
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Host health statuses, as reported by the agent
+const (
+	HealthOK       = "ok"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+	HealthUnknown  = "unknown" // The agent could not run its checks
+)
+
+// HealthStatuses lists the accepted health statuses
+var HealthStatuses = []string{HealthOK, HealthWarning, HealthCritical, HealthUnknown}
+
+// Limits on the health block of a report
+const (
+	MaxHealthChecks             = 100
+	MaxHealthCheckNameLength    = 100
+	MaxHealthCheckMessageLength = 500
+)
+
+// HostHealth is the health an agent reports for its host
+// @Description Custom health status reported by the agent, with the checks that are failing. Status is one of ok, warning, critical, unknown.
+type HostHealth struct {
+	Status string        `json:"status" example:"warning"`
+	Checks []HealthCheck `json:"checks,omitempty"` // Failing checks; passing checks may be left out
+}
+
+// HealthCheck is the result of one agent health check
+// @Description Result of one agent health check, e.g. a disk space or service check
+type HealthCheck struct {
+	Name    string `json:"name" example:"disk:/var"`
+	Status  string `json:"status" example:"warning"`
+	Message string `json:"message,omitempty" example:"92% used"`
+}
+
+// Normalize lowercases the statuses so "Critical" and "critical" are the same
+func (h *HostHealth) Normalize() {
+	h.Status = strings.ToLower(strings.TrimSpace(h.Status))
+	for i := range h.Checks {
+		h.Checks[i].Status = strings.ToLower(strings.TrimSpace(h.Checks[i].Status))
+	}
+}
+
+// Validate checks the statuses and the limits on checks
+func (h *HostHealth) Validate() error {
+	if !validHealthStatus(h.Status) {
+		return fmt.Errorf("health status must be one of %s", strings.Join(HealthStatuses, ", "))
+	}
+	if len(h.Checks) > MaxHealthChecks {
+		return fmt.Errorf("health may list at most %d checks", MaxHealthChecks)
+	}
+	for i, check := range h.Checks {
+		switch {
+		case check.Name == "":
+			return fmt.Errorf("health check %d has no name", i)
+		case len(check.Name) > MaxHealthCheckNameLength:
+			return fmt.Errorf("health check %d name is longer than %d characters", i, MaxHealthCheckNameLength)
+		case len(check.Message) > MaxHealthCheckMessageLength:
+			return fmt.Errorf("health check %q message is longer than %d characters", check.Name, MaxHealthCheckMessageLength)
+		case !validHealthStatus(check.Status):
+			return fmt.Errorf("health check %q status must be one of %s", check.Name, strings.Join(HealthStatuses, ", "))
+		}
+	}
+	return nil
+}
+
+// Failing returns the checks whose status is not ok
+func (h *HostHealth) Failing() []HealthCheck {
+	var failing []HealthCheck
+	for _, check := range h.Checks {
+		if check.Status != HealthOK {
+			failing = append(failing, check)
+		}
+	}
+	return failing
+}
+
+func validHealthStatus(status string) bool {
+	for _, s := range HealthStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HealthTransitionFinding returns the finding type raised when a host's health goes
+// from previous to current, or "" when the change raises none
+// previous is empty for a host that has not reported health before. Entering warning
+// or critical raises a finding, as does recovering to ok from either; reports without
+// health and changes to or from unknown do not.
+func HealthTransitionFinding(previous, current string) string {
+	if current == previous {
+		return ""
+	}
+	switch current {
+	case HealthWarning:
+		return FindingHealthWarning
+	case HealthCritical:
+		return FindingHealthCritical
+	case HealthOK:
+		if previous == HealthWarning || previous == HealthCritical {
+			return FindingHealthRecovered
+		}
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// HostGroup is a named set of an organization's hosts, such as an environment
+// @Description Group of hosts. A host belongs to the group if it was added to it (host_ids) or matches rule, a fleet search query as accepted by GET /api/v1/hosts?q=. host_count is only returned when a single group is requested.
+type HostGroup struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Rule        string    `json:"rule,omitempty"` // Search query matching dynamic members, e.g. os:fedora tag:env=prod
+	HostIDs     []string  `json:"host_ids"`       // Static members, sorted
+	HostCount   *int      `json:"host_count,omitempty"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// HostGroupRequest creates or replaces a host group
+type HostGroupRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=500"`
+	Rule        string `json:"rule" binding:"max=1000"` // Empty for a group of static members only
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HostReport is a report from a host's history
+// @Description A report as it was stored at ingest. Listings leave out data; fetch a report by ID for it.
+type HostReport struct {
+	ID               string          `json:"id"`
+	HostID           string          `json:"host_id"`
+	Hostname         string          `json:"hostname"`                // Hostname the agent reported at the time
+	CollectionID     string          `json:"collection_id,omitempty"` // Agent-assigned collection ID
+	CollectedAt      *time.Time      `json:"collected_at,omitempty"`  // When the agent says it collected the report
+	SnailVersion     string          `json:"snail_version,omitempty"`
+	ReceivedAt       time.Time       `json:"received_at"`
+	UploadedByUserID string          `json:"uploaded_by_user_id,omitempty"`
+	Errors           []string        `json:"errors,omitempty"`
+	Health           *HostHealth     `json:"health,omitempty"`
+	Data             json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+}
+
+// NewHostReport returns the history entry for a report stored by SaveHost
+func NewHostReport(id string, report *Report, uploadedByUserID string) *HostReport {
+	entry := &HostReport{
+		ID:               id,
+		HostID:           report.Meta.HostID,
+		Hostname:         report.Meta.Hostname,
+		CollectionID:     report.Meta.CollectionID,
+		SnailVersion:     report.Meta.SnailVersion,
+		ReceivedAt:       report.ReceivedAt,
+		UploadedByUserID: uploadedByUserID,
+		Errors:           report.Errors,
+		Health:           report.Health,
+		Data:             report.Data,
+	}
+	if report.Meta.Timestamp != "" {
+		if t, err := ParseReportTimestamp(report.Meta.Timestamp); err == nil {
+			entry.CollectedAt = &t
+		}
+	}
+	return entry
+}
+
+// HostReportDiff is the difference between the data of two reports from a host's history
+// @Description Paths added, removed, and changed from one report's data to another's. from and to describe the reports without their data.
+type HostReportDiff struct {
+	HostID  string         `json:"host_id"`
+	From    *HostReport    `json:"from"`
+	To      *HostReport    `json:"to"`
+	Added   []ReportChange `json:"added"`
+	Removed []ReportChange `json:"removed"`
+	Changed []ReportChange `json:"changed"`
+}
+
+// ReportChange is a difference between two reports' data at one path
+// @Description A path names a value by its object keys separated by dots. Array elements are named by their name or id, e.g. packages.installed[name=bash].version, or by their position, e.g. network.listening_ports[2], when they have neither.
+type ReportChange struct {
+	Path string          `json:"path" example:"packages.installed[name=bash].version"`
+	From json.RawMessage `json:"from,omitempty"` // Value in the from report; absent when added
+	To   json.RawMessage `json:"to,omitempty"`   // Value in the to report; absent when removed
+}
+
+// HostReportRetention is how many reports of each host an organization keeps, and how long
+// it keeps hosts that stopped reporting
+// @Description Number of reports kept in each host's history, overriding the server default (HOST_REPORT_RETENTION). 0 keeps no history. delete_hosts_unseen_days deletes hosts that have not reported for that many days; 0 keeps them.
+type HostReportRetention struct {
+	OrgID                 string    `json:"org_id"`
+	ReportsPerHost        int       `json:"reports_per_host"`
+	DeleteHostsUnseenDays int       `json:"delete_hosts_unseen_days"`
+	UpdatedByUserID       string    `json:"updated_by_user_id,omitempty"` // User who last changed the retention
+	Version               int64     `json:"version"`                      // Incremented whenever the retention is replaced; its ETag
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// SetHostReportRetentionRequest replaces an organization's host report retention
+// @Description Request payload for the host report retention. Delete it to use the server default.
+type SetHostReportRetentionRequest struct {
+	ReportsPerHost        *int `json:"reports_per_host" binding:"required,min=0,max=1000" example:"30"`
+	DeleteHostsUnseenDays int  `json:"delete_hosts_unseen_days" binding:"min=0,max=3650" example:"90"` // 0 keeps unseen hosts
+}
+
+// RetentionRun is what enforcing an organization's retention deleted, or would delete
+// @Description Result of enforcing the organization's host report retention. In a dry run nothing is deleted and the counts are what would be.
+type RetentionRun struct {
+	OrgID                 string    `json:"org_id"`
+	DryRun                bool      `json:"dry_run"`
+	ReportsPerHost        int       `json:"reports_per_host"`         // Retention enforced
+	DeleteHostsUnseenDays int       `json:"delete_hosts_unseen_days"` // 0 when unseen hosts are kept
+	ReportsDeleted        int       `json:"reports_deleted"`          // Reports past the retention in host histories
+	HostsDeleted          int       `json:"hosts_deleted"`
+	HostIDs               []string  `json:"host_ids"` // Hosts deleted for not reporting
+	RanAt                 time.Time `json:"ran_at"`
+}
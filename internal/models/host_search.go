@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// HostSearchFilter selects hosts by structured fields of their last report
+// Empty fields match every host; the rest must all match.
+type HostSearchFilter struct {
+	Hostname        string     // Hostname substring, case-insensitive
+	OSName          string     // OS name, case-insensitive
+	OSVersion       string     // OS version, or its leading segments ("22" matches "22.04")
+	Packages        []string   // Names of packages that must all be installed
+	LastSeenAfter   *time.Time // Last report received at or after this time
+	LastSeenBefore  *time.Time // Last report received before this time
+	IncludeArchived bool
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// IngestFilter is an organization's denylist of report data fields dropped at ingest
+// @Description Report data paths removed before reports are stored. Paths are dot-separated object keys from the root of data; "*" matches any key and arrays apply the rest of the path to every element.
+type IngestFilter struct {
+	OrgID           string    `json:"org_id"`
+	Paths           []string  `json:"paths" example:"users,processes.cmdline"`
+	UpdatedByUserID string    `json:"updated_by_user_id,omitempty"` // User who last changed the filter
+	Version         int64     `json:"version"`                      // Incremented whenever the filter is replaced; its ETag
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SetIngestFilterRequest replaces an organization's ingest filter
+// @Description Request payload for the ingest filter. Delete the filter to store reports unfiltered.
+type SetIngestFilterRequest struct {
+	Paths []string `json:"paths" binding:"required,min=1,max=100,dive,max=256"`
+}
+
+// StrippedField records a denylisted path removed from a report at ingest
+// @Description A filter path that matched an ingested report, with the number of values removed
+type StrippedField struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// IOC indicator types
+const (
+	IOCTypeMD5         = "md5"          // MD5 file hash
+	IOCTypeSHA1        = "sha1"         // SHA-1 file hash
+	IOCTypeSHA256      = "sha256"       // SHA-256 file hash
+	IOCTypeProcessName = "process_name" // Name of a running process, e.g. xmrig
+	IOCTypeFileName    = "file_name"    // File name, or an absolute path if it contains a slash
+)
+
+// IOC list upload formats
+const (
+	IOCFormatCSV  = "csv"  // type,value,description rows
+	IOCFormatSTIX = "stix" // STIX 2.1 bundle of indicator objects
+)
+
+// IOCList is a named list of indicators of compromise that reports are matched against
+// @Description List of indicators of compromise uploaded as CSV or STIX. Indicators are only returned when a single list is requested.
+type IOCList struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	Format         string         `json:"format"` // Format the list was uploaded in
+	IndicatorCount int            `json:"indicator_count"`
+	Indicators     []IOCIndicator `json:"indicators,omitempty"`
+	CreatedBy      string         `json:"created_by,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// IOCIndicator is one indicator of compromise
+// @Description Indicator of compromise. Hashes are lowercase hex.
+type IOCIndicator struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// IOCListResponse is returned when a list is uploaded
+type IOCListResponse struct {
+	*IOCList
+	Skipped int `json:"skipped"` // STIX indicators with no supported comparison
+}
+
+// IOCMatch is an indicator found in a host's reports
+// @Description Indicator of compromise found in a host's report data, with where it was found and when it was first and last reported
+type IOCMatch struct {
+	ListID      string    `json:"list_id"`
+	ListName    string    `json:"list_name,omitempty"`
+	HostID      string    `json:"host_id"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	Description string    `json:"description,omitempty"`
+	Path        string    `json:"path"` // Where in report data the value was found, e.g. processes[3].name
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// IOCMatchFilter selects an organization's IOC matches
+// Empty fields match any value.
+type IOCMatchFilter struct {
+	HostID string
+	ListID string
+	Limit  int
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// JobStatus is the state of a scheduled background job
+// @Description Scheduled background job and its last run, by whichever replica ran it. Runs take a database lock, so only one replica runs a job at a time.
+type JobStatus struct {
+	Name            string     `json:"name"`
+	IntervalSeconds int64      `json:"interval_seconds"`      // How often the job runs
+	Running         bool       `json:"running"`               // A replica started a run that has not finished
+	Runs            int64      `json:"runs"`                  // Runs finished, including failures
+	Failures        int64      `json:"failures"`              // Runs that returned an error
+	LastRunner      string     `json:"last_runner,omitempty"` // Replica that started the last run
+	LastStartedAt   *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt  *time.Time `json:"last_finished_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"` // Error of the last run, empty if it succeeded
+}
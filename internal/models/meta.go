@@ -0,0 +1,19 @@
+package models
+
+// SpecRoute is an HTTP method and path, as registered in the router or documented in the OpenAPI spec
+type SpecRoute struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`              // Router form for routes (":id"), spec form for documented paths ("{id}")
+	Handler string `json:"handler,omitempty"` // Go handler name, for registered routes
+}
+
+// SpecDriftReport compares the OpenAPI spec with the routes the server actually serves
+// @Description Differences between the OpenAPI specification and the live route table. in_sync is true when every route is documented and every documented operation is served.
+type SpecDriftReport struct {
+	InSync            bool        `json:"in_sync"`
+	SpecSource        string      `json:"spec_source"`        // Where the spec was loaded from (embedded or a file path)
+	RouteCount        int         `json:"route_count"`        // Routes considered, excluding ignored ones
+	DocumentedCount   int         `json:"documented_count"`   // Operations in the spec
+	Undocumented      []SpecRoute `json:"undocumented"`       // Served but missing from the spec
+	DocumentedMissing []SpecRoute `json:"documented_missing"` // In the spec but not served
+}
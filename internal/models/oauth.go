@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// OAuthClient is a third-party integration registered to request delegated tokens
+// @Description Third-party integration that users can authorize to read their hosts
+type OAuthClient struct {
+	ID              string    `json:"id"` // The OAuth client_id
+	OrgID           string    `json:"org_id"`
+	Name            string    `json:"name"`
+	RedirectURIs    []string  `json:"redirect_uris"`
+	Scopes          []string  `json:"scopes"` // Scopes the client may request
+	Public          bool      `json:"public"` // Public clients have no secret and must use PKCE
+	SecretHash      string    `json:"-"`      // Never return the hash
+	CreatedByUserID string    `json:"created_by_user_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CreateOAuthClientRequest registers a third-party integration
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,min=1,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=10,dive,min=1,max=500"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Public       bool     `json:"public"`
+}
+
+// CreateOAuthClientResponse is returned when registering a client
+type CreateOAuthClientResponse struct {
+	*OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"` // Plain secret, shown only once; empty for public clients
+}
+
+// OAuthAuthorizeRequest is the user's approval of a client's authorization request
+type OAuthAuthorizeRequest struct {
+	ClientID            string `json:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" binding:"required"`
+	Scope               string `json:"scope"` // Space-separated; defaults to all of the client's scopes
+	State               string `json:"state" binding:"max=500"`
+	CodeChallenge       string `json:"code_challenge" binding:"max=128"`
+	CodeChallengeMethod string `json:"code_challenge_method"` // Only S256 is supported
+}
+
+// OAuthAuthorizeResponse tells the consent page where to send the user
+type OAuthAuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"` // redirect_uri with the code and state
+}
+
+// OAuthCode is an issued, not yet exchanged authorization code
+type OAuthCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	OrgID         string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string // S256 challenge; empty without PKCE
+	ExpiresAt     time.Time
+}
+
+// OAuthToken is the hashed access and refresh token pair of a grant
+type OAuthToken struct {
+	AccessHash  string
+	RefreshHash string
+	ExpiresAt   time.Time // Access token expiry; refresh tokens live as long as the grant
+}
+
+// OAuthGrant is a user's authorization of a client, revocable by either
+// @Description Third-party integration a user has authorized
+type OAuthGrant struct {
+	ID         string     `json:"id"`
+	ClientID   string     `json:"client_id"`
+	ClientName string     `json:"client_name"`
+	UserID     string     `json:"user_id"`
+	OrgID      string     `json:"org_id"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      OAuthToken `json:"-"`
+}
+
+// OAuthTokenResponse is the token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// DatabasePrivileges describes what the role behind DATABASE_URL may do, as checked at startup
+type DatabasePrivileges struct {
+	Role       string    `json:"role"`
+	Restricted bool      `json:"restricted"`        // Migrations run as a separate role (DATABASE_MIGRATION_URL)
+	Missing    []string  `json:"missing,omitempty"` // Privileges the server needs but lacks, e.g. "INSERT on hosts"
+	DDL        []string  `json:"ddl,omitempty"`     // Ways the role can still change the schema, e.g. "CREATE on schema public"
+	CheckedAt  time.Time `json:"checked_at"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Probe methods
+const (
+	ProbeMethodTCP  = "tcp"
+	ProbeMethodICMP = "icmp"
+)
+
+// Probe job statuses
+const (
+	ProbeJobPending   = "pending"   // Waiting for a prober agent to claim it
+	ProbeJobRunning   = "running"   // Being probed by the server or a claimed agent
+	ProbeJobCompleted = "completed" // Results have been recorded
+)
+
+// Probers that can run a probe job
+const (
+	ProberServer = "server" // Probed by snailbus itself
+	ProberAgent  = "agent"  // Claimed and probed by a designated prober agent
+)
+
+// ProbeTarget is a host included in a probe job
+// @Description Host to probe, addressed by its reported hostname
+type ProbeTarget struct {
+	HostID   string `json:"host_id"`
+	Hostname string `json:"hostname"`
+}
+
+// ProbeResult is the outcome of probing one host
+// @Description Reachability of a host as seen by a prober. Error starts with "dns:" when the hostname did not resolve.
+type ProbeResult struct {
+	HostID    string    `json:"host_id" binding:"required,uuid"`
+	Hostname  string    `json:"hostname"`
+	Method    string    `json:"method"`
+	Port      int       `json:"port,omitempty"`
+	Reachable bool      `json:"reachable"`
+	Address   string    `json:"address,omitempty"`    // Address the hostname resolved to
+	LatencyMS float64   `json:"latency_ms,omitempty"` // Round-trip or connect time
+	Error     string    `json:"error,omitempty" binding:"max=500"`
+	Prober    string    `json:"prober"`    // "server" or "agent:<username>"
+	ProbedAt  time.Time `json:"probed_at"` // Defaults to the submission time for agent results
+}
+
+// ProbeJob is a request to check the reachability of a set of hosts
+// @Description Reachability probe over a set of hosts, run by the server or by a prober agent
+type ProbeJob struct {
+	ID          string         `json:"id"`
+	Method      string         `json:"method"`
+	Port        int            `json:"port,omitempty"`
+	Prober      string         `json:"prober"`
+	Status      string         `json:"status"`
+	Targets     []ProbeTarget  `json:"targets"`
+	RequestedBy string         `json:"requested_by,omitempty"`
+	ClaimedBy   string         `json:"claimed_by,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Results     []*ProbeResult `json:"results,omitempty"`
+}
+
+// CreateProbeJobRequest starts a probe job
+// @Description Request payload for starting a probe job. Omit host_ids to probe every visible host.
+type CreateProbeJobRequest struct {
+	HostIDs []string `json:"host_ids" binding:"max=1000,dive,uuid"`
+	Method  string   `json:"method" binding:"required,oneof=tcp icmp"`
+	Port    int      `json:"port" binding:"omitempty,min=1,max=65535"` // Required for tcp
+	Prober  string   `json:"prober" binding:"omitempty,oneof=server agent"`
+}
+
+// SubmitProbeResultsRequest is sent by a prober agent once it has probed a claimed job
+// @Description Probe results for a claimed job. Method and port are taken from the job.
+type SubmitProbeResultsRequest struct {
+	Results []ProbeResult `json:"results" binding:"required,max=1000,dive"`
+}
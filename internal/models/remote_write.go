@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Fleet metrics that can be remote-written to an organization's Prometheus
+const (
+	RemoteWriteMetricUp        = "up"         // snailbus_host_up: 1 if the host reported recently, 0 if stale
+	RemoteWriteMetricReportAge = "report_age" // snailbus_host_report_age_seconds: time since the last report
+	RemoteWriteMetricPackages  = "packages"   // snailbus_host_packages: installed package count
+)
+
+// RemoteWriteConfig is an organization's Prometheus remote-write target
+// @Description Prometheus remote-write endpoint that receives the organization's fleet gauges. Credentials are write-only.
+type RemoteWriteConfig struct {
+	OrgID       string     `json:"org_id"`
+	URL         string     `json:"url"`
+	Metrics     []string   `json:"metrics"`            // Metrics to export; all when empty
+	Username    string     `json:"username,omitempty"` // Basic auth username
+	Password    string     `json:"-"`
+	BearerToken string     `json:"-"`
+	Auth        string     `json:"auth"`                   // "none", "basic", or "bearer"
+	LastPushAt  *time.Time `json:"last_push_at,omitempty"` // Start of the most recent push
+	LastError   string     `json:"last_error,omitempty"`   // Error of the most recent push, if it failed
+	Version     int64      `json:"version"`                // Incremented whenever the target is replaced; its ETag
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// SetAuth derives Auth from the configured credentials
+func (c *RemoteWriteConfig) SetAuth() {
+	switch {
+	case c.BearerToken != "":
+		c.Auth = "bearer"
+	case c.Username != "":
+		c.Auth = "basic"
+	default:
+		c.Auth = "none"
+	}
+}
+
+// SetRemoteWriteRequest configures an organization's remote-write target
+// @Description Request payload for the Prometheus remote-write target. Use either username and password or bearer_token.
+type SetRemoteWriteRequest struct {
+	URL         string   `json:"url" binding:"required,max=2000"`
+	Metrics     []string `json:"metrics" binding:"max=3,dive,oneof=up report_age packages"`
+	Username    string   `json:"username" binding:"max=255"`
+	Password    string   `json:"password" binding:"max=4096"`
+	BearerToken string   `json:"bearer_token" binding:"max=4096"`
+}
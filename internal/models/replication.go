@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Database roles as reported by pg_is_in_recovery()
+const (
+	DatabaseRolePrimary = "primary"
+	DatabaseRoleReplica = "replica"
+)
+
+// ReplicationStatus describes the primary and, if configured, the read replica
+type ReplicationStatus struct {
+	PrimaryRole string         `json:"primary_role"` // "replica" means DATABASE_URL points at a standby
+	Replica     *ReplicaStatus `json:"replica,omitempty"`
+}
+
+// ReplicaStatus is the most recent health check of the read replica
+type ReplicaStatus struct {
+	Role          string     `json:"role,omitempty"`
+	LagSeconds    float64    `json:"lag_seconds"`
+	MaxLagSeconds float64    `json:"max_lag_seconds"`
+	ServingReads  bool       `json:"serving_reads"` // False when reads have failed over to the primary
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 )
 
@@ -19,8 +22,10 @@ type Report struct {
 	ID         string          `json:"id"` // host_id (UUID)
 	ReceivedAt time.Time       `json:"received_at"`
 	Meta       ReportMeta      `json:"meta"`
-	Data       json.RawMessage `json:"data"`
+	Data       json.RawMessage `json:"data" swaggertype:"object"`
 	Errors     []string        `json:"errors,omitempty"`
+	Health     *HostHealth     `json:"health,omitempty"`   // Agent-reported health, if the agent sent it
+	Stripped   []StrippedField `json:"stripped,omitempty"` // Fields removed by the organization's ingest filter; kept in the host's event history
 }
 
 // ReportMeta contains metadata about the collection
@@ -29,42 +34,140 @@ type ReportMeta struct {
 	Hostname     string `json:"hostname"`
 	HostID       string `json:"host_id"` // Persistent UUID identifying the host
 	CollectionID string `json:"collection_id"`
-	Timestamp    string `json:"timestamp"`
+	Timestamp    string `json:"timestamp"` // Agent-reported collection time, RFC 3339 in UTC once stored
 	SnailVersion string `json:"snail_version"`
 }
 
+// reportTimestampLayouts are the formats accepted for ReportMeta.Timestamp
+// Timestamps without a zone offset are taken to be UTC.
+var reportTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ParseReportTimestamp parses an agent-reported collection time
+func ParseReportTimestamp(value string) (time.Time, error) {
+	for _, layout := range reportTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q is not an RFC 3339 date-time", value)
+}
+
+// FormatReportTimestamp formats a collection time the way it is returned in ReportMeta.Timestamp
+func FormatReportTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ReportSections returns the top-level sections of report data (e.g. "packages",
+// "network", "docker"), sorted. Sections that are null or empty do not count, and data
+// that is not a JSON object has none.
+func ReportSections(data json.RawMessage) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return []string{}
+	}
+	sections := make([]string, 0, len(fields))
+	for name, value := range fields {
+		value = bytes.TrimSpace(value)
+		if bytes.Equal(value, []byte("null")) || isEmptyJSONContainer(value) {
+			continue
+		}
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// isEmptyJSONContainer reports whether value is an empty JSON object or array
+func isEmptyJSONContainer(value []byte) bool {
+	if len(value) < 2 || (value[0] != '{' && value[0] != '[') {
+		return false
+	}
+	return len(bytes.TrimSpace(value[1:len(value)-1])) == 0
+}
+
 // IngestRequest is the incoming request format from snail-core
 // @Description Request payload from snail-core containing metadata, collected data, and any errors
 type IngestRequest struct {
 	Meta   ReportMeta      `json:"meta"`
-	Data   json.RawMessage `json:"data"`
+	Data   json.RawMessage `json:"data" swaggertype:"object"`
 	Errors []string        `json:"errors,omitempty"`
+	Health *HostHealth     `json:"health,omitempty"` // Optional custom health status
 }
 
 // IngestResponse is returned after successful ingestion
 // @Description Response after successfully ingesting a collection report
 type IngestResponse struct {
-	Status     string `json:"status"`
-	ReportID   string `json:"report_id"`
-	ReceivedAt string `json:"received_at"`
-	Message    string `json:"message,omitempty"`
+	Status     string          `json:"status"`
+	ReportID   string          `json:"report_id"`
+	ReceivedAt string          `json:"received_at"`
+	Message    string          `json:"message,omitempty"`
+	Receipt    *Receipt        `json:"receipt,omitempty"`  // Signed proof of acceptance
+	Stripped   []StrippedField `json:"stripped,omitempty"` // Fields removed by the organization's ingest filter
+}
+
+// IngestBatchResponse is returned after a batch of reports is processed
+// @Description Per-report outcome of a batch ingest, in the order the reports were sent
+type IngestBatchResponse struct {
+	Accepted int                 `json:"accepted"`
+	Rejected int                 `json:"rejected"`
+	Results  []IngestBatchResult `json:"results"`
+}
+
+// IngestBatchResult is the outcome of one report of a batch
+// @Description Outcome of one report: status is the HTTP status POST /api/v1/ingest would have returned for it alone
+type IngestBatchResult struct {
+	Index      int             `json:"index"` // Position of the report in the request
+	HostID     string          `json:"host_id,omitempty"`
+	Status     int             `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	ReceivedAt string          `json:"received_at,omitempty"`
+	Receipt    *Receipt        `json:"receipt,omitempty"`
+	Stripped   []StrippedField `json:"stripped,omitempty"`
 }
 
 // HostSummary represents summary info about a host
-// @Description Summary information about a host including host_id, hostname, OS distribution, version components, and last seen timestamp
+// @Description Summary information about a host including host_id, hostname, OS distribution, version components, last seen timestamp, and status
 type HostSummary struct {
-	HostID           string    `json:"host_id"`                    // Persistent UUID
-	Hostname         string    `json:"hostname"`                   // Current hostname (may change)
-	OSName           string    `json:"os_name"`                    // Linux distribution name (e.g., "Fedora", "Debian")
-	OSVersion        string    `json:"os_version"`                 // OS version (full version string, e.g., "42", "12.2", "22.04")
-	OSVersionMajor   string    `json:"os_version_major,omitempty"` // Major version number
-	OSVersionMinor   string    `json:"os_version_minor,omitempty"` // Minor version number
-	OSVersionPatch   string    `json:"os_version_patch,omitempty"` // Patch version number
-	OrgID            string    `json:"org_id"`                     // Required foreign key to organizations
-	UploadedByUserID string    `json:"uploaded_by_user_id"`        // Required foreign key to users
-	LastSeen         time.Time `json:"last_seen"`
+	HostID           string       `json:"host_id"`                    // Persistent UUID
+	Hostname         string       `json:"hostname"`                   // Current hostname (may change)
+	Name             string       `json:"name"`                       // Display name if set, otherwise the hostname
+	DisplayName      string       `json:"display_name,omitempty"`     // User-set display name overriding the hostname
+	Description      string       `json:"description,omitempty"`      // User-set description
+	OSName           string       `json:"os_name"`                    // Linux distribution name (e.g., "Fedora", "Debian")
+	OSVersion        string       `json:"os_version"`                 // OS version (full version string, e.g., "42", "12.2", "22.04")
+	OSVersionMajor   string       `json:"os_version_major,omitempty"` // Major version number
+	OSVersionMinor   string       `json:"os_version_minor,omitempty"` // Minor version number
+	OSVersionPatch   string       `json:"os_version_patch,omitempty"` // Patch version number
+	KernelVersion    string       `json:"kernel_version,omitempty"`   // Kernel release from the last report (system.kernel)
+	Architecture     string       `json:"architecture,omitempty"`     // CPU architecture from the last report (system.architecture, e.g. "x86_64")
+	PackageCount     *int         `json:"package_count,omitempty"`    // Installed packages in the last report, if it lists packages
+	OrgID            string       `json:"org_id"`                     // Required foreign key to organizations
+	UploadedByUserID string       `json:"uploaded_by_user_id"`        // Required foreign key to users
+	Tags             []string     `json:"tags,omitempty"`             // Tags attached to the host (e.g., "team:web")
+	LastSeen         time.Time    `json:"last_seen"`                  // When the server received the last report
+	CollectedAt      *time.Time   `json:"collected_at,omitempty"`     // When the agent says it collected the last report
+	LastProbe        *ProbeResult `json:"last_probe,omitempty"`       // Most recent reachability probe, if any
+	Health           *HostHealth  `json:"health,omitempty"`           // Health from the last report, if the agent reports it
+	Sections         []string     `json:"sections,omitempty"`         // Top-level data sections in the last report (e.g. "packages", "docker")
+	ArchivedAt       *time.Time   `json:"archived_at,omitempty"`      // When the host was archived; archived hosts are hidden by default
+	Status           string       `json:"status"`                     // active, or stale once the host misses its check-in window
+	StaleSince       *time.Time   `json:"stale_since,omitempty"`      // When the host was found stale
 }
 
+// Host export formats and views
+const (
+	HostExportFormatNDJSON = "ndjson"
+	HostExportFormatCSV    = "csv"
+	HostExportViewFull     = "full"
+	HostExportViewSummary  = "summary"
+)
+
 // Organization represents an organization in the system
 // @Description Organization entity for multi-tenant support
 type Organization struct {
@@ -73,3 +176,67 @@ type Organization struct {
 	CreatedAt time.Time `json:"created_at"` // Creation timestamp
 	UpdatedAt time.Time `json:"updated_at"` // Last update timestamp
 }
+
+// Receipt is a signed acknowledgement that a report was accepted
+// @Description Server-signed proof that a collection report was accepted. The signature (Ed25519, base64) covers the receipt ID, host ID, collection ID, checksum, and received_at.
+type Receipt struct {
+	ID           string    `json:"id"`
+	HostID       string    `json:"host_id"`
+	CollectionID string    `json:"collection_id"`
+	Checksum     string    `json:"checksum"` // SHA-256 of the uncompressed request body, "sha256:<hex>"
+	ReceivedAt   time.Time `json:"received_at"`
+	KeyID        string    `json:"key_id"` // Identifies the server signing key
+	Signature    string    `json:"signature"`
+}
+
+// ReceiptVerification is returned when verifying a receipt
+// @Description Result of verifying a stored receipt against the server signing key
+type ReceiptVerification struct {
+	Valid     bool     `json:"valid"`
+	Reason    string   `json:"reason,omitempty"` // Why verification failed
+	Receipt   *Receipt `json:"receipt"`
+	PublicKey string   `json:"public_key"` // Base64 Ed25519 public key for offline verification
+}
+
+// HostDetails are the user-maintained fields of a host
+// @Description Display name and description set by users. Ingest never changes them.
+type HostDetails struct {
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+}
+
+// UpdateHostRequest is used to edit a host's details
+// @Description Request payload updating a host's display name and description. Omitted fields are left unchanged; an empty string clears a field. The agent-reported hostname cannot be changed.
+type UpdateHostRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=255"`
+	Description *string `json:"description" binding:"omitempty,max=2000"`
+}
+
+// HostDetailsResponse is returned after a host's details are updated
+// @Description A host's agent-reported hostname with its user-maintained details
+type HostDetailsResponse struct {
+	HostID      string `json:"host_id"`
+	Hostname    string `json:"hostname"` // As reported by the agent
+	Name        string `json:"name"`     // Display name if set, otherwise the hostname
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+}
+
+// Apply returns d with the fields set in the request replaced
+func (r UpdateHostRequest) Apply(d HostDetails) HostDetails {
+	if r.DisplayName != nil {
+		d.DisplayName = *r.DisplayName
+	}
+	if r.Description != nil {
+		d.Description = *r.Description
+	}
+	return d
+}
+
+// HostName returns the name a host is shown under: its display name if set, otherwise its hostname
+func HostName(hostname, displayName string) string {
+	if displayName != "" {
+		return displayName
+	}
+	return hostname
+}
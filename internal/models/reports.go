@@ -0,0 +1,114 @@
+package models
+
+import "time"
+
+// Fleet report kinds
+const (
+	ReportKindInventory  = "inventory"   // Hosts by OS and tag, with every host's last report
+	ReportKindCompliance = "compliance"  // Per-host check-in, reachability, and collection error checks
+	ReportKindOSCurrency = "os_currency" // Hosts running an older OS version than the newest one in the fleet
+)
+
+// Fleet report formats
+const (
+	ReportFormatHTML = "html"
+	ReportFormatPDF  = "pdf"
+)
+
+// How a fleet report was started
+const (
+	ReportTriggerOnDemand  = "on_demand"
+	ReportTriggerScheduled = "scheduled"
+)
+
+// Report schedule frequencies
+const (
+	ReportFrequencyDaily   = "daily"
+	ReportFrequencyWeekly  = "weekly"
+	ReportFrequencyMonthly = "monthly"
+)
+
+// FleetReport is a snapshot of the organization's fleet
+// @Description A generated fleet report. Download it as HTML or PDF from GET /reports/{id}.
+type FleetReport struct {
+	ID          string         `json:"id"`
+	OrgID       string         `json:"org_id"`
+	Kind        string         `json:"kind"`
+	Title       string         `json:"title"`
+	Trigger     string         `json:"trigger"`                // "on_demand" or "scheduled"
+	RequestedBy string         `json:"requested_by,omitempty"` // User who generated it; empty for scheduled reports
+	EmailedTo   []string       `json:"emailed_to,omitempty"`   // Admins the report was sent to
+	EmailError  string         `json:"email_error,omitempty"`  // Why sending the report failed, if it did
+	CreatedAt   time.Time      `json:"created_at"`
+	Content     *ReportContent `json:"-"`
+}
+
+// ReportContent is the body of a fleet report, independent of its format
+type ReportContent struct {
+	Summary  []ReportStat    `json:"summary"`
+	Sections []ReportSection `json:"sections"`
+}
+
+// ReportStat is a headline figure of a report
+type ReportStat struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// ReportSection is a titled table of a report
+type ReportSection struct {
+	Title   string     `json:"title"`
+	Note    string     `json:"note,omitempty"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// GenerateReportRequest generates a fleet report on demand
+// @Description Request payload for generating a fleet report. With email set the report is also sent to the organization's admins as a PDF attachment.
+type GenerateReportRequest struct {
+	Kind  string `json:"kind" binding:"required,oneof=inventory compliance os_currency" example:"inventory"`
+	Email bool   `json:"email"`
+}
+
+// ReportSchedule generates fleet reports for an organization at a fixed frequency
+// @Description Fleet reports generated daily, weekly, or monthly. With email set each report is sent to the organization's admins.
+type ReportSchedule struct {
+	OrgID           string     `json:"org_id"`
+	Kinds           []string   `json:"kinds"`
+	Frequency       string     `json:"frequency"` // "daily", "weekly", or "monthly"
+	Email           bool       `json:"email"`
+	NextRunAt       time.Time  `json:"next_run_at"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	UpdatedByUserID string     `json:"updated_by_user_id,omitempty"` // User who last changed the schedule
+	Version         int64      `json:"version"`                      // Incremented whenever the schedule is replaced; its ETag
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// NextRun returns when a schedule with the given frequency runs after from
+func NextRun(frequency string, from time.Time) time.Time {
+	switch frequency {
+	case ReportFrequencyWeekly:
+		return from.AddDate(0, 0, 7)
+	case ReportFrequencyMonthly:
+		return from.AddDate(0, 1, 0)
+	}
+	return from.AddDate(0, 0, 1)
+}
+
+// Advance records a run at now and moves NextRunAt to the first run after now
+// Runs missed while the server was down are skipped rather than caught up.
+func (s *ReportSchedule) Advance(now time.Time) {
+	s.LastRunAt = &now
+	for !s.NextRunAt.After(now) {
+		s.NextRunAt = NextRun(s.Frequency, s.NextRunAt)
+	}
+}
+
+// SetReportScheduleRequest replaces an organization's report schedule
+// @Description Request payload for the report schedule. The first reports are generated one period after the schedule is set.
+type SetReportScheduleRequest struct {
+	Kinds     []string `json:"kinds" binding:"required,min=1,max=3,dive,oneof=inventory compliance os_currency"`
+	Frequency string   `json:"frequency" binding:"required,oneof=daily weekly monthly" example:"weekly"`
+	Email     bool     `json:"email"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Reprocess job statuses
+const (
+	ReprocessJobRunning   = "running"
+	ReprocessJobCompleted = "completed" // Every host was visited; some may have failed
+	ReprocessJobCanceled  = "canceled"
+	ReprocessJobFailed    = "failed" // Stopped early, e.g. the host list could not be loaded
+)
+
+// HostRef identifies a host together with its organization
+type HostRef struct {
+	HostID string `json:"host_id"`
+	OrgID  string `json:"org_id"`
+}
+
+// ReprocessJob re-derives hosts' stored projections from their raw reports
+// @Description Background job that rebuilds hosts, tags, and facet counters from the host event stream after derivation logic changes. Jobs are tracked in memory by the instance running them.
+type ReprocessJob struct {
+	ID             string     `json:"id"`
+	OrgID          string     `json:"org_id,omitempty"` // Empty when reprocessing every organization
+	Status         string     `json:"status"`
+	HostsPerSecond float64    `json:"hosts_per_second"` // Throttle applied to host rewrites
+	Workers        int        `json:"workers"`          // Hosts rewritten at a time
+	Total          int        `json:"total"`            // Hosts to reprocess
+	Processed      int        `json:"processed"`        // Hosts visited, including failures
+	Failed         int        `json:"failed"`
+	Progress       float64    `json:"progress"` // Processed / Total, 0 to 1
+	LastError      string     `json:"last_error,omitempty"`
+	RequestedBy    string     `json:"requested_by,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// StartReprocessRequest starts a reprocess job
+// @Description Request payload for a reprocess job. Omit org_id to reprocess every organization.
+type StartReprocessRequest struct {
+	OrgID          string  `json:"org_id"`
+	HostsPerSecond float64 `json:"hosts_per_second" binding:"omitempty,gt=0,max=1000"` // Defaults to 50
+	Workers        int     `json:"workers" binding:"omitempty,min=1,max=32"`           // Defaults to 1
+}
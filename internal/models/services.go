@@ -0,0 +1,23 @@
+package models
+
+// HostService is a listening port from a host's latest report
+// @Description Listening socket reported by a host, normalized from the report's network.listening_ports section
+type HostService struct {
+	HostID   string `json:"host_id"`
+	Hostname string `json:"hostname"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Process  string `json:"process,omitempty"`
+	PID      *int64 `json:"pid,omitempty"`
+}
+
+// HostServiceFilter selects listening ports across an organization's hosts
+// Empty fields match any value.
+type HostServiceFilter struct {
+	Port            *int
+	Protocol        string
+	Process         string
+	HostID          string
+	IncludeArchived bool
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// HostTagRules are an organization's rules deriving host tags from hostnames
+// @Description Rules adding tags to hosts whose hostname matches a regular expression. Every matching rule applies; tags are only ever added, never removed.
+type HostTagRules struct {
+	OrgID           string        `json:"org_id"`
+	Rules           []HostTagRule `json:"rules"`
+	UpdatedByUserID string        `json:"updated_by_user_id,omitempty"` // User who last changed the rules
+	Version         int64         `json:"version"`                      // Incremented whenever the rules are replaced; its ETag
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// HostTagRule adds tags to hosts whose hostname matches pattern
+// @Description A regular expression (RE2 syntax) matched against the hostname, and the tags added on a match. Tags may reference capture groups as ${1} or ${name}.
+type HostTagRule struct {
+	Pattern string   `json:"pattern" binding:"required,min=1,max=256" example:"^web-\\d+"`
+	Tags    []string `json:"tags" binding:"required,min=1,max=16,dive,min=1,max=100" example:"role:web"`
+}
+
+// SetHostTagRulesRequest replaces an organization's host tag rules
+// @Description Request payload for the host tag rules. Delete the rules to stop tagging hosts automatically.
+type SetHostTagRulesRequest struct {
+	Rules []HostTagRule `json:"rules" binding:"required,min=1,max=100,dive"`
+}
+
+// HostTagRulesResult reports the tags the rules added when they were re-evaluated
+// @Description Outcome of evaluating the host tag rules against every host of the organization
+type HostTagRulesResult struct {
+	DryRun         bool            `json:"dry_run"`         // True when the tags were only computed, not added
+	HostsEvaluated int             `json:"hosts_evaluated"` // Hosts whose hostname was matched against the rules
+	HostsTagged    int             `json:"hosts_tagged"`    // Hosts that gained at least one tag
+	Changes        []HostTagChange `json:"changes"`
+}
+
+// HostTagChange lists the tags rules added to a host
+type HostTagChange struct {
+	HostID   string   `json:"host_id"`
+	Hostname string   `json:"hostname"`
+	Added    []string `json:"added"`
+}
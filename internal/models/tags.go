@@ -0,0 +1,28 @@
+package models
+
+// UpdateHostTagsRequest is used to replace the set of tags on a host
+// @Description Request payload replacing all tags attached to a host
+type UpdateHostTagsRequest struct {
+	Tags []string `json:"tags" binding:"max=64,dive,min=1,max=100"` // Tags to attach (e.g., "team:web", "env:prod")
+}
+
+// HostTagsResponse is returned after host tags are read or updated
+// @Description Tags currently attached to a host
+type HostTagsResponse struct {
+	HostID string   `json:"host_id"`
+	Tags   []string `json:"tags"`
+}
+
+// HostAccessPolicy describes which hosts a user may see
+// @Description Tag-based host visibility policy for a user. An empty tag list means unrestricted access.
+type HostAccessPolicy struct {
+	UserID     string   `json:"user_id"`
+	Tags       []string `json:"tags"`       // Hosts must carry at least one of these tags to be visible
+	Restricted bool     `json:"restricted"` // False when the user can see every host in the organization
+}
+
+// UpdateHostAccessPolicyRequest is used by admins to replace a user's host access policy
+// @Description Request payload replacing a user's tag-based host access policy. Send an empty list to remove all restrictions.
+type UpdateHostAccessPolicyRequest struct {
+	Tags []string `json:"tags" binding:"max=64,dive,min=1,max=100"`
+}
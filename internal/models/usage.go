@@ -0,0 +1,11 @@
+package models
+
+// OrgStorageUsage is the database storage consumed by an organization's hosts
+// Sizes are as stored, after Postgres compression
+type OrgStorageUsage struct {
+	Hosts          int64 `json:"hosts"`
+	HostBytes      int64 `json:"host_bytes"`
+	HostEvents     int64 `json:"host_events"`
+	HostEventBytes int64 `json:"host_event_bytes"` // Event history, including report snapshots
+	TotalBytes     int64 `json:"total_bytes"`
+}
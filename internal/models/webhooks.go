@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// Webhook event types
+const (
+	WebhookEventHostIngested = "host.ingested" // A host report was accepted
+	WebhookEventHostDeleted  = "host.deleted"  // A host was deleted
+	WebhookEventHostStale    = "host.stale"    // A host missed its check-in window
+)
+
+// WebhookEvents lists the event types a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookEventHostIngested,
+	WebhookEventHostDeleted,
+	WebhookEventHostStale,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"   // Waiting for its first attempt or a retry
+	WebhookDeliveryRunning   = "running"   // Being delivered
+	WebhookDeliverySucceeded = "succeeded" // The receiver answered with a 2xx status
+	WebhookDeliveryFailed    = "failed"    // Every attempt failed
+)
+
+// Webhook is a URL that receives the organization's host events
+// @Description URL receiving signed JSON host events (host.ingested, host.deleted, host.stale)
+type Webhook struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Events        []string  `json:"events"`
+	Enabled       bool      `json:"enabled"`
+	SigningSecret string    `json:"-"`
+	CreatedBy     string    `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Subscribed reports whether the webhook receives events of eventType
+func (w *Webhook) Subscribed(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRequest creates or replaces a webhook
+// @Description Request payload for creating or replacing a webhook. enabled defaults to true.
+type WebhookRequest struct {
+	URL     string   `json:"url" binding:"required,max=2000"`
+	Events  []string `json:"events" binding:"required,min=1,max=3,dive,oneof=host.ingested host.deleted host.stale"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// WebhookSecretResponse is returned when a webhook is created
+type WebhookSecretResponse struct {
+	*Webhook
+	SigningSecret string `json:"signing_secret"` // Plain secret, shown only once
+}
+
+// WebhookEvent is the JSON document POSTed to webhooks
+// @Description Host event sent to a webhook. last_seen is set for host.ingested and host.stale, collection_id for host.ingested, and deletion for host.deleted when a reason was given.
+type WebhookEvent struct {
+	Type         string        `json:"type"`
+	OrgID        string        `json:"org_id"`
+	HostID       string        `json:"host_id"`
+	Hostname     string        `json:"hostname,omitempty"`
+	CollectionID string        `json:"collection_id,omitempty"`
+	LastSeen     *time.Time    `json:"last_seen,omitempty"`
+	Deletion     *HostDeletion `json:"deletion,omitempty"`
+	OccurredAt   time.Time     `json:"occurred_at"`
+}
+
+// WebhookDelivery is one event sent to a webhook
+// @Description Delivery log entry of a webhook, retried with backoff until it succeeds or runs out of attempts
+type WebhookDelivery struct {
+	ID             string       `json:"id"`
+	WebhookID      string       `json:"webhook_id"`
+	OrgID          string       `json:"org_id"`
+	Event          WebhookEvent `json:"event"`
+	Status         string       `json:"status"`
+	Attempts       int          `json:"attempts"`
+	ResponseStatus int          `json:"response_status,omitempty"` // HTTP status of the last attempt
+	LastError      string       `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time   `json:"next_attempt_at,omitempty"` // Set while pending
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	CompletedAt    *time.Time   `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,109 @@
+// Package outbound makes HTTP requests to user-supplied URLs: actions, webhooks, and
+// remote write targets.
+//
+// The client refuses to connect to loopback, private, link-local, multicast, and
+// unspecified addresses. The check runs on the resolved address of every connection,
+// so a hostname that resolves to an internal address is refused as well as a literal
+// one. Redirects are not followed, and proxies from the environment are not used.
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a URL points at an address the client refuses
+var ErrForbiddenAddress = errors.New("address is not allowed for outbound requests")
+
+// forbiddenNets are ranges not covered by the net.IP classification methods
+var forbiddenNets = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // "This" network
+	mustCIDR("100.64.0.0/10"), // Carrier-grade NAT
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// Forbidden reports whether ip is an address the client refuses to connect to
+func Forbidden(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range forbiddenNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// control rejects connections to forbidden addresses after DNS resolution
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || Forbidden(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// NewClient returns a client that only connects to public addresses and does not
+// follow redirects; a redirect response is returned to the caller as is
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckURL parses an outbound target URL
+// It must be an http:// or https:// URL with a host that is not localhost or a literal
+// forbidden address. Hostnames are only resolved when connecting, where the client
+// checks them again.
+func CheckURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return nil, errors.New("url must be an http:// or https:// URL")
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && Forbidden(ip) {
+		return nil, fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return parsed, nil
+}
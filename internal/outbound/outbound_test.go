@@ -0,0 +1,71 @@
+package outbound
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForbidden(t *testing.T) {
+	for _, addr := range []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"fe80::1", "fc00::1", "0.0.0.0", "::", "0.1.2.3", "100.64.0.1", "224.0.0.1",
+	} {
+		if !Forbidden(net.ParseIP(addr)) {
+			t.Errorf("Forbidden(%s) = false, want true", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "2606:4700::1111"} {
+		if Forbidden(net.ParseIP(addr)) {
+			t.Errorf("Forbidden(%s) = true, want false", addr)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	if _, err := CheckURL(" https://hooks.example.com/x "); err != nil {
+		t.Fatalf("CheckURL() error = %v", err)
+	}
+	for _, raw := range []string{"ftp://example.com", "example.com", "https://", "http://[::1]:80/"} {
+		if _, err := CheckURL(raw); err == nil {
+			t.Errorf("CheckURL(%q) succeeded, want error", raw)
+		}
+	}
+	for _, raw := range []string{"http://localhost:8080", "http://api.localhost.", "http://127.0.0.1/", "http://169.254.169.254/latest/meta-data"} {
+		if _, err := CheckURL(raw); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckURL(%q) error = %v, want ErrForbiddenAddress", raw, err)
+		}
+	}
+}
+
+func TestClient_RefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Get() error = %v, want ErrForbiddenAddress", err)
+	}
+}
+
+func TestClient_DoesNotFollowRedirects(t *testing.T) {
+	client := NewClient(time.Second)
+	// Connect through a plain transport so the test server on loopback is reachable
+	client.Transport = http.DefaultTransport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+}
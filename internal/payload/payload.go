@@ -0,0 +1,255 @@
+// Package payload converts report payloads between JSON and the binary encodings
+// agents on constrained devices may send instead: CBOR (RFC 8949) and MessagePack.
+//
+// Reports are stored, filtered, and matched as JSON. A binary request body is decoded
+// and re-encoded as canonical JSON before anything else looks at it, so it is subject
+// to the same limits and validation as a JSON body. Responses can be encoded the same
+// way: the JSON encoding of the response is converted, so field names and omitted
+// fields are identical in every encoding.
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Format is the encoding of a payload
+type Format string
+
+// Supported formats
+const (
+	FormatJSON    Format = "json"
+	FormatCBOR    Format = "cbor"
+	FormatMsgPack Format = "msgpack"
+)
+
+// Content types of the formats
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeCBOR    = "application/cbor"
+	ContentTypeMsgPack = "application/msgpack"
+)
+
+// defaultMaxDepth bounds nesting when the caller sets no limit
+const defaultMaxDepth = 1024
+
+// ErrInvalid is returned for payloads that cannot be decoded, or that have no JSON equivalent
+var ErrInvalid = errors.New("invalid payload")
+
+// contentTypes maps media types, including common aliases, to formats
+var contentTypes = map[string]Format{
+	ContentTypeJSON:           FormatJSON,
+	ContentTypeCBOR:           FormatCBOR,
+	ContentTypeMsgPack:        FormatMsgPack,
+	"application/x-msgpack":   FormatMsgPack,
+	"application/vnd.msgpack": FormatMsgPack,
+}
+
+// FromContentType returns the format of a Content-Type header
+// Anything that is not CBOR or MessagePack is treated as JSON, as before binary
+// encodings were supported.
+func FromContentType(contentType string) Format {
+	if format, ok := contentTypes[mediaType(contentType)]; ok {
+		return format
+	}
+	return FormatJSON
+}
+
+// Negotiate returns the format to respond in for an Accept header
+// The first supported media type in the header wins; fallback is used when the header
+// is empty, accepts anything, or names nothing supported.
+func Negotiate(accept string, fallback Format) Format {
+	for _, part := range strings.Split(accept, ",") {
+		switch media := mediaType(part); media {
+		case "*/*", "application/*":
+			return fallback
+		default:
+			if format, ok := contentTypes[media]; ok {
+				return format
+			}
+		}
+	}
+	return fallback
+}
+
+// ContentType returns the Content-Type of responses in the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCBOR:
+		return ContentTypeCBOR
+	case FormatMsgPack:
+		return ContentTypeMsgPack
+	}
+	return ContentTypeJSON + "; charset=utf-8"
+}
+
+// Binary reports whether the format is one of the binary encodings
+func (f Format) Binary() bool {
+	return f == FormatCBOR || f == FormatMsgPack
+}
+
+// ToJSON decodes a payload and returns its canonical JSON encoding, with object keys
+// sorted. Byte strings become base64 strings and timestamps RFC 3339 strings, as
+// encoding/json would write them. Integer map keys are written as decimal strings;
+// other non-string keys, NaN, infinities, and trailing bytes are rejected. Nesting
+// deeper than maxDepth (0 for the default) is rejected before the payload is fully decoded.
+func ToJSON(format Format, data []byte, maxDepth int) ([]byte, error) {
+	if !format.Binary() {
+		return data, nil
+	}
+	if maxDepth <= 0 || maxDepth > math.MaxInt16 {
+		maxDepth = defaultMaxDepth
+	}
+
+	var value interface{}
+	decoder := codec.NewDecoderBytes(data, handle(format, maxDepth))
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	if n := decoder.NumBytesRead(); n != len(data) {
+		return nil, fmt.Errorf("%w: %d bytes after the end of the payload", ErrInvalid, len(data)-n)
+	}
+	value, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+	document, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	return document, nil
+}
+
+// Marshal encodes v in the format
+// For binary formats v is encoded as JSON first and converted, so JSON struct tags
+// and custom JSON marshalers apply as usual.
+func Marshal(format Format, v interface{}) ([]byte, error) {
+	document, err := json.Marshal(v)
+	if err != nil || !format.Binary() {
+		return document, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, handle(format, 0)).Encode(binaryValue(value)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// handle returns a codec handle for a binary format
+func handle(format Format, maxDepth int) codec.Handle {
+	if format == FormatCBOR {
+		h := &codec.CborHandle{}
+		h.MaxDepth = int16(maxDepth)
+		h.MapType = reflect.TypeOf(map[interface{}]interface{}(nil))
+		return h
+	}
+	h := &codec.MsgpackHandle{}
+	h.MaxDepth = int16(maxDepth)
+	h.MapType = reflect.TypeOf(map[interface{}]interface{}(nil))
+	h.WriteExt = true
+	return h
+}
+
+// jsonValue converts a decoded binary value into one encoding/json writes faithfully
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name, err := jsonKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if object[name], err = jsonValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case float32:
+		return jsonValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: %v has no JSON representation", ErrInvalid, v)
+		}
+		return v, nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	}
+	return value, nil
+}
+
+// jsonKey returns the JSON object key of a decoded map key
+func jsonKey(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case []byte:
+		return string(k), nil
+	case int64:
+		return strconv.FormatInt(k, 10), nil
+	case uint64:
+		return strconv.FormatUint(k, 10), nil
+	}
+	return "", fmt.Errorf("%w: map key of type %T has no JSON representation", ErrInvalid, key)
+}
+
+// binaryValue converts a JSON value decoded with UseNumber into the most compact
+// binary equivalent: integral numbers become integers
+func binaryValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = binaryValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = binaryValue(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// mediaType returns the lowercase media type of a Content-Type or Accept entry, without parameters
+func mediaType(header string) string {
+	media, _, err := mime.ParseMediaType(strings.TrimSpace(header))
+	if err != nil {
+		return ""
+	}
+	return media
+}
@@ -0,0 +1,106 @@
+package payload
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+// encode writes v with the package's handle for a binary format
+func encode(t *testing.T, format Format, v interface{}) []byte {
+	t.Helper()
+	var out []byte
+	require.NoError(t, codec.NewEncoderBytes(&out, handle(format, 0)).Encode(v))
+	return out
+}
+
+func TestFromContentType(t *testing.T) {
+	assert.Equal(t, FormatJSON, FromContentType(""))
+	assert.Equal(t, FormatJSON, FromContentType("application/json; charset=utf-8"))
+	assert.Equal(t, FormatJSON, FromContentType("text/plain"), "unknown types are read as JSON")
+	assert.Equal(t, FormatCBOR, FromContentType("application/cbor"))
+	assert.Equal(t, FormatMsgPack, FromContentType("Application/MsgPack"))
+	assert.Equal(t, FormatMsgPack, FromContentType("application/x-msgpack"))
+}
+
+func TestNegotiate(t *testing.T) {
+	assert.Equal(t, FormatCBOR, Negotiate("", FormatCBOR))
+	assert.Equal(t, FormatCBOR, Negotiate("*/*", FormatCBOR))
+	assert.Equal(t, FormatJSON, Negotiate("application/json", FormatCBOR))
+	assert.Equal(t, FormatMsgPack, Negotiate("text/html, application/msgpack;q=0.9, */*;q=0.1", FormatJSON))
+	assert.Equal(t, FormatJSON, Negotiate("text/html", FormatJSON))
+}
+
+func TestToJSON(t *testing.T) {
+	report := map[string]interface{}{
+		"meta": map[string]interface{}{"host_id": "host-1", "hostname": "web-1"},
+		"data": map[string]interface{}{
+			"cpu":     map[string]interface{}{"count": 8, "load": 0.5},
+			"disks":   []interface{}{"sda", "sdb"},
+			"enabled": true,
+			"none":    nil,
+		},
+	}
+	want := `{"data":{"cpu":{"count":8,"load":0.5},"disks":["sda","sdb"],"enabled":true,"none":null},"meta":{"host_id":"host-1","hostname":"web-1"}}`
+
+	for _, format := range []Format{FormatCBOR, FormatMsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			document, err := ToJSON(format, encode(t, format, report), 0)
+			require.NoError(t, err)
+			assert.JSONEq(t, want, string(document))
+
+			document, err = ToJSON(format, encode(t, format, map[interface{}]interface{}{
+				int64(1): []byte("hi"),
+				"at":     time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+			}), 0)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"1": "aGk=", "at": "2025-01-02T15:04:05Z"}`, string(document))
+
+			_, err = ToJSON(format, encode(t, format, map[string]interface{}{"load": math.NaN()}), 0)
+			assert.ErrorIs(t, err, ErrInvalid)
+			_, err = ToJSON(format, encode(t, format, map[interface{}]interface{}{true: 1}), 0)
+			assert.ErrorIs(t, err, ErrInvalid)
+			_, err = ToJSON(format, []byte{0x81}, 0)
+			assert.ErrorIs(t, err, ErrInvalid, "truncated")
+			_, err = ToJSON(format, []byte{0x01, 0x02}, 0)
+			assert.ErrorIs(t, err, ErrInvalid, "trailing bytes")
+
+			nested := interface{}("leaf")
+			for i := 0; i < 10; i++ {
+				nested = []interface{}{nested}
+			}
+			_, err = ToJSON(format, encode(t, format, nested), 5)
+			assert.ErrorIs(t, err, ErrInvalid, "nesting beyond the limit")
+		})
+	}
+
+	document, err := ToJSON(FormatJSON, []byte(`{"a": 1}`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a": 1}`, string(document), "JSON is passed through")
+}
+
+func TestMarshal(t *testing.T) {
+	type response struct {
+		Status  string   `json:"status"`
+		Count   int      `json:"count"`
+		Ratio   float64  `json:"ratio"`
+		Skipped []string `json:"skipped,omitempty"`
+	}
+	v := response{Status: "ok", Count: 3, Ratio: 0.25}
+
+	document, err := Marshal(FormatJSON, v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status": "ok", "count": 3, "ratio": 0.25}`, string(document))
+
+	for _, format := range []Format{FormatCBOR, FormatMsgPack} {
+		encoded, err := Marshal(format, v)
+		require.NoError(t, err)
+		document, err := ToJSON(format, encoded, 0)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"status": "ok", "count": 3, "ratio": 0.25}`, string(document), "%s round trip", format)
+	}
+}
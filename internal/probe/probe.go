@@ -0,0 +1,211 @@
+// Package probe checks whether hosts are reachable from where snailbus runs.
+//
+// A probe first resolves the host's reported hostname, so DNS failures are told
+// apart from hosts that resolve but do not answer. Hosts report their hostname
+// themselves, so only the addresses outbound connections may reach are probed
+// (see outbound.Forbidden): a hostname resolving to loopback, private, or
+// link-local addresses is not probed from the server. Reachability is then checked
+// with a TCP connect to a port or an ICMP echo. ICMP uses unprivileged datagram
+// sockets, which on Linux requires the process group to be inside
+// net.ipv4.ping_group_range.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+)
+
+const (
+	// DefaultTimeout bounds each probe, including name resolution
+	DefaultTimeout = 3 * time.Second
+	// DefaultConcurrency is how many hosts are probed at once
+	DefaultConcurrency = 16
+)
+
+// Prober runs probe jobs from the server
+type Prober struct {
+	timeout     time.Duration
+	concurrency int
+	resolver    *net.Resolver
+	allowed     func(net.IP) bool // Addresses that may be probed
+}
+
+// New creates a prober; a non-positive timeout selects DefaultTimeout
+func New(timeout time.Duration) *Prober {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Prober{
+		timeout:     timeout,
+		concurrency: DefaultConcurrency,
+		resolver:    net.DefaultResolver,
+		allowed:     func(ip net.IP) bool { return !outbound.Forbidden(ip) },
+	}
+}
+
+// Run probes every target of job and returns one result per target, in target order
+func (p *Prober) Run(ctx context.Context, job *models.ProbeJob) []*models.ProbeResult {
+	results := make([]*models.ProbeResult, len(job.Targets))
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+
+	for i, target := range job.Targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target models.ProbeTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.probe(ctx, target, job.Method, job.Port)
+		}(i, target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// probe checks a single target
+func (p *Prober) probe(ctx context.Context, target models.ProbeTarget, method string, port int) *models.ProbeResult {
+	result := &models.ProbeResult{
+		HostID:   target.HostID,
+		Hostname: target.Hostname,
+		Method:   method,
+		Port:     port,
+		Prober:   models.ProberServer,
+		ProbedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, target.Hostname)
+	if err != nil || len(addrs) == 0 {
+		result.Error = fmt.Sprintf("dns: %v", lookupError(err))
+		return result
+	}
+	addrs = p.allowedAddrs(addrs)
+	if len(addrs) == 0 {
+		result.Error = fmt.Sprintf("%v: %s", outbound.ErrForbiddenAddress, target.Hostname)
+		return result
+	}
+
+	var latency time.Duration
+	switch method {
+	case models.ProbeMethodTCP:
+		result.Address = addrs[0].IP.String()
+		latency, err = probeTCP(ctx, addrs[0].IP, port)
+	case models.ProbeMethodICMP:
+		ip := firstIPv4(addrs)
+		if ip == nil {
+			result.Error = "icmp: hostname has no IPv4 address"
+			return result
+		}
+		result.Address = ip.String()
+		latency, err = probeICMP(ctx, ip)
+	default:
+		err = fmt.Errorf("unsupported probe method %q", method)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Reachable = true
+	result.LatencyMS = float64(latency.Microseconds()) / 1000
+	return result
+}
+
+// probeTCP connects to ip:port and returns the time taken to connect
+func probeTCP(ctx context.Context, ip net.IP, port int) (time.Duration, error) {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), fmt.Sprint(port)))
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
+
+// probeICMP sends one ICMP echo request to ip and waits for the reply
+func probeICMP(ctx context.Context, ip net.IP) (time.Duration, error) {
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		return 0, fmt.Errorf("icmp: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	request := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("snailbus-probe")},
+	}
+	payload, err := request.Marshal(nil)
+	if err != nil {
+		return 0, fmt.Errorf("icmp: %w", err)
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(payload, &net.UDPAddr{IP: ip}); err != nil {
+		return 0, fmt.Errorf("icmp: %w", err)
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(reply)
+		if err != nil {
+			return 0, fmt.Errorf("icmp: %w", err)
+		}
+		// The kernel filters datagram ping sockets by echo ID, but other ICMP
+		// messages (e.g. destination unreachable) can still arrive
+		msg, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), reply[:n])
+		if err != nil {
+			continue
+		}
+		switch msg.Type {
+		case ipv4.ICMPTypeEchoReply:
+			return time.Since(start), nil
+		case ipv4.ICMPTypeDestinationUnreachable:
+			return 0, fmt.Errorf("icmp: destination unreachable")
+		}
+	}
+}
+
+// allowedAddrs returns the addresses of addrs that may be probed
+func (p *Prober) allowedAddrs(addrs []net.IPAddr) []net.IPAddr {
+	var allowed []net.IPAddr
+	for _, addr := range addrs {
+		if p.allowed(addr.IP) {
+			allowed = append(allowed, addr)
+		}
+	}
+	return allowed
+}
+
+func firstIPv4(addrs []net.IPAddr) net.IP {
+	for _, addr := range addrs {
+		if ip := addr.IP.To4(); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+func lookupError(err error) error {
+	if err == nil {
+		return fmt.Errorf("no addresses found")
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+)
+
+func TestProber_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	// A port that was just released is almost certainly closed
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	// The listeners are on loopback, which real probes refuse
+	prober := New(2 * time.Second)
+	prober.allowed = func(net.IP) bool { return true }
+	run := func(hostname string, port int) *models.ProbeResult {
+		results := prober.Run(context.Background(), &models.ProbeJob{
+			Method:  models.ProbeMethodTCP,
+			Port:    port,
+			Targets: []models.ProbeTarget{{HostID: "host-1", Hostname: hostname}},
+		})
+		require.Len(t, results, 1)
+		return results[0]
+	}
+
+	result := run("127.0.0.1", openPort)
+	assert.True(t, result.Reachable)
+	assert.Equal(t, "127.0.0.1", result.Address)
+	assert.Equal(t, models.ProberServer, result.Prober)
+	assert.Empty(t, result.Error)
+
+	result = run("127.0.0.1", closedPort)
+	assert.False(t, result.Reachable)
+	assert.NotEmpty(t, result.Error)
+	assert.False(t, strings.HasPrefix(result.Error, "dns:"))
+
+	// Name resolution failures are reported separately from unreachable hosts
+	result = run("host.invalid", openPort)
+	assert.False(t, result.Reachable)
+	assert.True(t, strings.HasPrefix(result.Error, "dns:"), result.Error)
+}
+
+func TestProber_ForbiddenAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// Hosts resolving to internal addresses are not probed, even if they would answer
+	prober := New(2 * time.Second)
+	for _, hostname := range []string{"127.0.0.1", "localhost", "10.0.0.1", "169.254.169.254"} {
+		results := prober.Run(context.Background(), &models.ProbeJob{
+			Method:  models.ProbeMethodTCP,
+			Port:    port,
+			Targets: []models.ProbeTarget{{HostID: "host-1", Hostname: hostname}},
+		})
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Reachable, hostname)
+		assert.Empty(t, results[0].Address, hostname)
+		assert.Contains(t, results[0].Error, outbound.ErrForbiddenAddress.Error(), hostname)
+	}
+}
+
+func TestProber_RunKeepsTargetOrder(t *testing.T) {
+	prober := New(time.Second)
+	job := &models.ProbeJob{Method: models.ProbeMethodTCP, Port: 1}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		job.Targets = append(job.Targets, models.ProbeTarget{HostID: id, Hostname: id + ".invalid"})
+	}
+
+	results := prober.Run(context.Background(), job)
+	require.Len(t, results, len(job.Targets))
+	for i, target := range job.Targets {
+		assert.Equal(t, target.HostID, results[i].HostID)
+	}
+}
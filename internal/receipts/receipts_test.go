@@ -0,0 +1,59 @@
+package receipts
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+func TestSigner_SignAndVerify(t *testing.T) {
+	signer, err := GenerateSigner()
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(`{"meta":{}}`))
+	receipt := &models.Receipt{
+		ID:           "00000000-0000-0000-0000-00000000a001",
+		HostID:       "00000000-0000-0000-0000-000000000001",
+		CollectionID: "collection-1",
+		Checksum:     Checksum(sum[:]),
+		ReceivedAt:   time.Now(),
+	}
+	signer.Sign(receipt)
+
+	assert.Equal(t, signer.KeyID(), receipt.KeyID)
+	assert.NoError(t, signer.Verify(receipt))
+
+	// Any change to a signed field invalidates the receipt
+	tampered := *receipt
+	tampered.Checksum = Checksum(make([]byte, sha256.Size))
+	assert.ErrorIs(t, signer.Verify(&tampered), ErrInvalidSignature)
+
+	tampered = *receipt
+	tampered.ReceivedAt = receipt.ReceivedAt.Add(time.Second)
+	assert.ErrorIs(t, signer.Verify(&tampered), ErrInvalidSignature)
+
+	// Receipts from another key are reported as such
+	other, err := GenerateSigner()
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Verify(receipt), ErrKeyMismatch)
+}
+
+func TestNewSigner(t *testing.T) {
+	_, err := NewSigner([]byte("too short"))
+	assert.Error(t, err)
+
+	seed := make([]byte, 32)
+	a, err := NewSigner(seed)
+	require.NoError(t, err)
+	b, err := NewSigner(seed)
+	require.NoError(t, err)
+
+	// The same seed always yields the same key
+	assert.Equal(t, a.KeyID(), b.KeyID())
+	assert.Equal(t, a.PublicKey(), b.PublicKey())
+}
@@ -0,0 +1,66 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label is a Prometheus label pair
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Series is one time series with a single sample
+type Series struct {
+	Labels    []Label // Including __name__
+	Value     float64
+	Timestamp int64 // Milliseconds since the epoch
+}
+
+// Field numbers of the remote-write 1.0 protobuf messages (prometheus/prompb)
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+// Encode builds a snappy-compressed remote-write WriteRequest
+// Labels are sorted by name, as receivers require.
+func Encode(series []Series) []byte {
+	var req []byte
+	for _, s := range series {
+		labels := append([]Label(nil), s.Labels...)
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+		var ts []byte
+		for _, l := range labels {
+			var label []byte
+			label = protowire.AppendTag(label, labelName, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, labelValue, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+			ts = protowire.AppendTag(ts, timeSeriesLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+		ts = protowire.AppendTag(ts, timeSeriesSamples, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, writeRequestTimeseries, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return snappy.Encode(nil, req)
+}
@@ -0,0 +1,209 @@
+// Package remotewrite pushes per-host fleet gauges to organizations' own Prometheus
+// (or Mimir, Thanos, VictoriaMetrics, ...) through the remote-write protocol.
+//
+// Each organization configures at most one target. Every interval the exporter claims
+// the targets that are due, builds one sample per host and selected metric from the
+// host list, and POSTs them as a snappy-compressed protobuf WriteRequest. A failed
+// push is recorded on the target and simply repeated on the next interval; gauges
+// need no backfill. Pushes go through the outbound client, which refuses internal
+// addresses, like action and webhook deliveries.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"snailbus/internal/checkin"
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+// Metric names written for each host
+const (
+	MetricUp        = "snailbus_host_up"
+	MetricReportAge = "snailbus_host_report_age_seconds"
+	MetricPackages  = "snailbus_host_packages"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	maxErrorLength = 500
+)
+
+// Exporter pushes fleet gauges to the configured remote-write targets
+type Exporter struct {
+	store      storage.Storage
+	interval   time.Duration
+	staleAfter time.Duration
+	client     *http.Client
+	now        func() time.Time
+}
+
+// NewExporter creates an exporter that pushes every interval
+// Hosts that miss their organization's check-in window are exported as down; staleAfter
+// is the window of hosts the organization's check-in schedule does not cover.
+func NewExporter(store storage.Storage, interval, staleAfter time.Duration) *Exporter {
+	return &Exporter{
+		store:      store,
+		interval:   interval,
+		staleAfter: staleAfter,
+		client:     outbound.NewClient(requestTimeout),
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Interval returns how often each target is pushed
+func (e *Exporter) Interval() time.Duration {
+	return e.interval
+}
+
+// Run pushes due targets until ctx is done
+// It polls more often than the interval so that a new target is pushed promptly.
+func (e *Exporter) Run(ctx context.Context) {
+	poll := e.interval / 4
+	if poll < time.Second {
+		poll = time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.pushDue(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to push remote-write targets")
+			}
+		}
+	}
+}
+
+// pushDue pushes every target not pushed within the interval
+func (e *Exporter) pushDue(ctx context.Context) error {
+	configs, err := e.store.ClaimRemoteWriteConfigs(e.now(), e.interval)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		lastError := ""
+		if err := e.Push(ctx, config); err != nil {
+			lastError = truncate(err.Error(), maxErrorLength)
+			logger.Logger.Warn().Err(err).Str("org_id", config.OrgID).Msg("Remote-write push failed")
+		}
+		if err := e.store.RecordRemoteWriteResult(config.OrgID, lastError); err != nil {
+			logger.Logger.Error().Err(err).Str("org_id", config.OrgID).Msg("Failed to record remote-write result")
+		}
+	}
+	return nil
+}
+
+// Push writes the organization's current fleet gauges to its target
+func (e *Exporter) Push(ctx context.Context, config *models.RemoteWriteConfig) error {
+	series, err := e.Collect(config)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(Encode(series)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "snailbus-remote-write")
+	switch {
+	case config.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+config.BearerToken)
+	case config.Username != "":
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Only the status is recorded, so last_error cannot be used to read responses back
+		return fmt.Errorf("remote-write endpoint returned status %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
+
+// Collect builds the organization's series for the metrics selected in config
+func (e *Exporter) Collect(config *models.RemoteWriteConfig) ([]Series, error) {
+	selected := map[string]bool{}
+	for _, metric := range config.Metrics {
+		selected[metric] = true
+	}
+	all := len(selected) == 0
+
+	hosts, err := e.store.ListHosts(config.OrgID, false)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := e.store.GetCheckinSchedule(config.OrgID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	var packages map[string]int
+	if all || selected[models.RemoteWriteMetricPackages] {
+		if packages, err = e.store.CountHostPackages(config.OrgID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := e.now()
+	timestamp := now.UnixMilli()
+	series := make([]Series, 0, len(hosts)*3)
+	add := func(name string, host *models.HostSummary, value float64) {
+		series = append(series, Series{
+			Labels: []Label{
+				{Name: "__name__", Value: name},
+				{Name: "host_id", Value: host.HostID},
+				{Name: "hostname", Value: host.Hostname},
+			},
+			Value:     value,
+			Timestamp: timestamp,
+		})
+	}
+
+	for _, host := range hosts {
+		age := now.Sub(host.LastSeen)
+		if age < 0 {
+			age = 0
+		}
+		if all || selected[models.RemoteWriteMetricUp] {
+			up := 1.0
+			if checkin.Evaluate(schedule, host, e.staleAfter, now).Overdue {
+				up = 0
+			}
+			add(MetricUp, host, up)
+		}
+		if all || selected[models.RemoteWriteMetricReportAge] {
+			add(MetricReportAge, host, age.Seconds())
+		}
+		if packages != nil {
+			add(MetricPackages, host, float64(packages[host.HostID]))
+		}
+	}
+	return series, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
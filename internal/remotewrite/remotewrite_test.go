@@ -0,0 +1,267 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	testHostFresh = "00000000-0000-0000-0000-000000000001"
+	testHostStale = "00000000-0000-0000-0000-000000000002"
+)
+
+// decode parses a snappy-compressed WriteRequest back into series
+func decode(t *testing.T, body []byte) []Series {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+
+	// fields calls fn for each length-delimited or fixed field of a message
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			require.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+			n = fn(num, typ, b)
+			require.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+		}
+	}
+
+	var series []Series
+	fields(raw, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+		var s Series
+		fields(ts, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+			if num == timeSeriesLabels {
+				var l Label
+				fields(msg, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					v, n := protowire.ConsumeString(b)
+					if num == labelName {
+						l.Name = v
+					} else {
+						l.Value = v
+					}
+					return n
+				})
+				s.Labels = append(s.Labels, l)
+			} else {
+				fields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					if typ == protowire.Fixed64Type {
+						v, n := protowire.ConsumeFixed64(b)
+						s.Value = math.Float64frombits(v)
+						return n
+					}
+					v, n := protowire.ConsumeVarint(b)
+					s.Timestamp = int64(v)
+					return n
+				})
+			}
+			return n
+		})
+		series = append(series, s)
+		return n
+	})
+	return series
+}
+
+// byMetric indexes series by metric name and host ID
+func byMetric(series []Series) map[string]map[string]float64 {
+	out := map[string]map[string]float64{}
+	for _, s := range series {
+		var name, hostID string
+		for _, l := range s.Labels {
+			switch l.Name {
+			case "__name__":
+				name = l.Value
+			case "host_id":
+				hostID = l.Value
+			}
+		}
+		if out[name] == nil {
+			out[name] = map[string]float64{}
+		}
+		out[name][hostID] = s.Value
+	}
+	return out
+}
+
+func setupExporter(t *testing.T) (*Exporter, *storage.MockStorage, string, time.Time) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for hostID, seen := range map[string]time.Time{testHostFresh: now.Add(-time.Minute), testHostStale: now.Add(-48 * time.Hour)} {
+		require.NoError(t, store.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: seen,
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(`{"packages": {"installed": [{"name": "bash"}, {"name": "openssl"}]}}`),
+		}, org.ID, "user-1"))
+	}
+
+	e := NewExporter(store, time.Minute, 24*time.Hour)
+	// The test endpoints listen on loopback, which the outbound client refuses
+	e.client = &http.Client{Timeout: requestTimeout}
+	e.now = func() time.Time { return now }
+	return e, store, org.ID, now
+}
+
+func TestEncode_SortsLabels(t *testing.T) {
+	series := decode(t, Encode([]Series{{
+		Labels:    []Label{{Name: "hostname", Value: "web-1"}, {Name: "__name__", Value: MetricUp}, {Name: "host_id", Value: "h"}},
+		Value:     1,
+		Timestamp: 1700000000000,
+	}}))
+	require.Len(t, series, 1)
+	assert.Equal(t, []Label{{"__name__", MetricUp}, {"host_id", "h"}, {"hostname", "web-1"}}, series[0].Labels)
+	assert.Equal(t, 1.0, series[0].Value)
+	assert.Equal(t, int64(1700000000000), series[0].Timestamp)
+}
+
+func TestExporter_Collect(t *testing.T) {
+	e, _, orgID, now := setupExporter(t)
+
+	series, err := e.Collect(&models.RemoteWriteConfig{OrgID: orgID})
+	require.NoError(t, err)
+	require.Len(t, series, 6)
+	for _, s := range series {
+		assert.Equal(t, now.UnixMilli(), s.Timestamp)
+	}
+
+	metrics := byMetric(series)
+	assert.Equal(t, 1.0, metrics[MetricUp][testHostFresh])
+	assert.Equal(t, 0.0, metrics[MetricUp][testHostStale])
+	assert.Equal(t, 60.0, metrics[MetricReportAge][testHostFresh])
+	assert.Equal(t, (48 * time.Hour).Seconds(), metrics[MetricReportAge][testHostStale])
+	assert.Equal(t, 2.0, metrics[MetricPackages][testHostFresh])
+
+	// Only the selected metrics are written
+	series, err = e.Collect(&models.RemoteWriteConfig{OrgID: orgID, Metrics: []string{models.RemoteWriteMetricUp}})
+	require.NoError(t, err)
+	assert.Len(t, series, 2)
+	assert.Contains(t, byMetric(series), MetricUp)
+
+	// Other organizations' hosts are never included
+	series, err = e.Collect(&models.RemoteWriteConfig{OrgID: "other-org"})
+	require.NoError(t, err)
+	assert.Empty(t, series)
+}
+
+func TestExporter_CollectCheckinWindows(t *testing.T) {
+	e, store, orgID, _ := setupExporter(t)
+
+	// A declared window replaces the exporter's staleAfter
+	require.NoError(t, store.SetHostTags(testHostFresh, orgID, []string{"env:prod"}, "", 0))
+	require.NoError(t, store.SetCheckinSchedule(&models.CheckinSchedule{
+		OrgID:                  orgID,
+		DefaultIntervalSeconds: int64((72 * time.Hour).Seconds()),
+		Windows:                []models.CheckinWindow{{Tag: "env:prod", IntervalSeconds: 30}},
+	}))
+
+	series, err := e.Collect(&models.RemoteWriteConfig{OrgID: orgID, Metrics: []string{models.RemoteWriteMetricUp}})
+	require.NoError(t, err)
+	up := byMetric(series)[MetricUp]
+	assert.Equal(t, 0.0, up[testHostFresh], "prod host missed its 30s window")
+	assert.Equal(t, 1.0, up[testHostStale], "untagged host is within the 72h default")
+}
+
+func TestExporter_PushDue(t *testing.T) {
+	e, store, orgID, now := setupExporter(t)
+
+	var received []Series
+	var headers http.Header
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = decode(t, body)
+		headers = r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	require.NoError(t, store.SetRemoteWriteConfig(&models.RemoteWriteConfig{
+		OrgID:       orgID,
+		URL:         server.URL + "/api/v1/push",
+		BearerToken: "t0ken",
+	}))
+
+	require.NoError(t, e.pushDue(context.Background()))
+	assert.Len(t, received, 6)
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", headers.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "Bearer t0ken", headers.Get("Authorization"))
+
+	config, err := store.GetRemoteWriteConfig(orgID)
+	require.NoError(t, err)
+	require.NotNil(t, config.LastPushAt)
+	assert.Equal(t, now, *config.LastPushAt)
+	assert.Empty(t, config.LastError)
+
+	// Nothing is pushed again within the interval
+	received = nil
+	require.NoError(t, e.pushDue(context.Background()))
+	assert.Nil(t, received)
+
+	// Failures are recorded and retried on the next interval
+	status = http.StatusUnauthorized
+	now = now.Add(e.Interval())
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.pushDue(context.Background()))
+	config, err = store.GetRemoteWriteConfig(orgID)
+	require.NoError(t, err)
+	assert.Contains(t, config.LastError, "status 401")
+}
+
+func TestExporter_BasicAuth(t *testing.T) {
+	e, _, orgID, _ := setupExporter(t)
+
+	var user, pass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ = r.BasicAuth()
+	}))
+	defer server.Close()
+
+	err := e.Push(context.Background(), &models.RemoteWriteConfig{
+		OrgID:    orgID,
+		URL:      server.URL,
+		Username: "tenant-1",
+		Password: "s3cret",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-1", user)
+	assert.Equal(t, "s3cret", pass)
+}
+
+func TestExporter_RefusesInternalURLs(t *testing.T) {
+	_, store, orgID, _ := setupExporter(t)
+	e := NewExporter(store, time.Minute, 24*time.Hour)
+
+	pushed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed = true
+	}))
+	defer server.Close()
+
+	err := e.Push(context.Background(), &models.RemoteWriteConfig{OrgID: orgID, URL: server.URL})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed")
+	assert.False(t, pushed)
+}
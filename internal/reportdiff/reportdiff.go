@@ -0,0 +1,256 @@
+// Package reportdiff compares the data of two reports from a host's history.
+//
+// Changes are reported by path: object keys separated by dots, e.g. "system.os.version".
+// Arrays whose elements are all objects with a unique name, or else id, are compared
+// element by element under that key, e.g. "packages.installed[name=bash].version", so an
+// upgraded package is one changed version rather than a removed and an added entry.
+// Other arrays are compared as sets: an element found in only one of the reports is
+// added or removed at its position in that report, e.g. "network.listening_ports[2]".
+package reportdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"snailbus/internal/models"
+)
+
+// elementKeys are the keys array elements are matched by, in order of preference
+var elementKeys = []string{"name", "id"}
+
+// Compare returns the changes from one report's data to another's
+// The reports in the result are copies without their data.
+func Compare(from, to *models.HostReport) (*models.HostReportDiff, error) {
+	a, err := decode(from.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data in report %s: %w", from.ID, err)
+	}
+	b, err := decode(to.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data in report %s: %w", to.ID, err)
+	}
+
+	d := &differ{
+		diff: &models.HostReportDiff{
+			HostID:  to.HostID,
+			From:    withoutData(from),
+			To:      withoutData(to),
+			Added:   []models.ReportChange{},
+			Removed: []models.ReportChange{},
+			Changed: []models.ReportChange{},
+		},
+	}
+	if err := d.compare("", a, b); err != nil {
+		return nil, err
+	}
+	return d.diff, nil
+}
+
+// decode parses report data, keeping numbers as written; missing data is null
+func decode(data json.RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func withoutData(report *models.HostReport) *models.HostReport {
+	summary := *report
+	summary.Data = nil
+	return &summary
+}
+
+type differ struct {
+	diff *models.HostReportDiff
+}
+
+// compare records the changes between a and b, the values at path
+func (d *differ) compare(path string, a, b interface{}) error {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			return d.compareObjects(path, a, b)
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			return d.compareArrays(path, a, b)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return d.record(&d.diff.Changed, path, a, b)
+}
+
+func (d *differ) compareObjects(path string, a, b map[string]interface{}) error {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		av, inA := a[key]
+		bv, inB := b[key]
+		var err error
+		switch {
+		case !inB:
+			err = d.record(&d.diff.Removed, child, av, nil)
+		case !inA:
+			err = d.record(&d.diff.Added, child, nil, bv)
+		default:
+			err = d.compare(child, av, bv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) compareArrays(path string, a, b []interface{}) error {
+	if key := elementKey(a, b); key != "" {
+		return d.compareKeyed(path, key, a, b)
+	}
+
+	// Match equal elements, counting duplicates, by their JSON encoding
+	unmatched := make(map[string][]int, len(a))
+	for i, element := range a {
+		encoded, err := json.Marshal(element)
+		if err != nil {
+			return err
+		}
+		unmatched[string(encoded)] = append(unmatched[string(encoded)], i)
+	}
+	matched := make([]bool, len(a))
+	for j, element := range b {
+		encoded, err := json.Marshal(element)
+		if err != nil {
+			return err
+		}
+		if indexes := unmatched[string(encoded)]; len(indexes) > 0 {
+			matched[indexes[0]] = true
+			unmatched[string(encoded)] = indexes[1:]
+			continue
+		}
+		if err := d.record(&d.diff.Added, fmt.Sprintf("%s[%d]", path, j), nil, element); err != nil {
+			return err
+		}
+	}
+	for i, element := range a {
+		if !matched[i] {
+			if err := d.record(&d.diff.Removed, fmt.Sprintf("%s[%d]", path, i), element, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareKeyed compares arrays of objects matched by the value of key
+func (d *differ) compareKeyed(path, key string, a, b []interface{}) error {
+	byKey := make(map[string]interface{}, len(a))
+	for _, element := range a {
+		byKey[keyValue(element, key)] = element
+	}
+	seen := make(map[string]bool, len(b))
+	for _, element := range b {
+		value := keyValue(element, key)
+		seen[value] = true
+		child := fmt.Sprintf("%s[%s=%s]", path, key, value)
+		var err error
+		if previous, ok := byKey[value]; ok {
+			err = d.compare(child, previous, element)
+		} else {
+			err = d.record(&d.diff.Added, child, nil, element)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, element := range a {
+		if value := keyValue(element, key); !seen[value] {
+			if err := d.record(&d.diff.Removed, fmt.Sprintf("%s[%s=%s]", path, key, value), element, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elementKey returns the key identifying the elements of both arrays, or "" if none does:
+// every element must be an object with a unique string or number value for it
+func elementKey(a, b []interface{}) string {
+	if len(a) == 0 && len(b) == 0 {
+		return ""
+	}
+	for _, key := range elementKeys {
+		if uniqueKey(a, key) && uniqueKey(b, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+func uniqueKey(elements []interface{}, key string) bool {
+	seen := make(map[string]bool, len(elements))
+	for _, element := range elements {
+		value := keyValue(element, key)
+		if value == "" || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// keyValue returns an element's value for key as a string, or "" if it has none
+func keyValue(element interface{}, key string) string {
+	object, ok := element.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch value := object[key].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// record adds a change at path; added changes leave out from and removed ones to
+func (d *differ) record(changes *[]models.ReportChange, path string, from, to interface{}) error {
+	change := models.ReportChange{Path: path}
+	var err error
+	if changes != &d.diff.Added {
+		if change.From, err = json.Marshal(from); err != nil {
+			return err
+		}
+	}
+	if changes != &d.diff.Removed {
+		if change.To, err = json.Marshal(to); err != nil {
+			return err
+		}
+	}
+	*changes = append(*changes, change)
+	return nil
+}
@@ -0,0 +1,155 @@
+package reportdiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+func report(id, data string) *models.HostReport {
+	return &models.HostReport{ID: id, HostID: "host-1", Hostname: "web-1", Data: json.RawMessage(data)}
+}
+
+// paths returns the path of each change and its values as JSON, for comparison
+func paths(changes []models.ReportChange) map[string][2]string {
+	result := make(map[string][2]string, len(changes))
+	for _, change := range changes {
+		result[change.Path] = [2]string{string(change.From), string(change.To)}
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	from := report("r1", `{
+		"system": {"os": {"name": "Fedora", "version": "41"}, "uptime_seconds": 100, "kernel": "6.11"},
+		"packages": {"installed": [
+			{"name": "bash", "version": "5.2.26"},
+			{"name": "curl", "version": "8.9.1"},
+			{"name": "vim", "version": "9.1"}
+		]},
+		"network": {"listening_ports": [{"port": 22}, {"port": 80}]},
+		"dns": ["10.0.0.1", "10.0.0.2"]
+	}`)
+	to := report("r2", `{
+		"system": {"os": {"name": "Fedora", "version": "42"}, "uptime_seconds": 5, "timezone": "UTC"},
+		"packages": {"installed": [
+			{"name": "bash", "version": "5.2.26"},
+			{"name": "curl", "version": "8.11.0"},
+			{"name": "git", "version": "2.47"}
+		]},
+		"network": {"listening_ports": [{"port": 443}, {"port": 22}]},
+		"dns": ["10.0.0.2", "10.0.0.1"]
+	}`)
+
+	diff, err := Compare(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, "host-1", diff.HostID)
+	assert.Equal(t, "r1", diff.From.ID)
+	assert.Equal(t, "r2", diff.To.ID)
+	assert.Nil(t, diff.From.Data)
+	assert.NotNil(t, from.Data, "the reports passed in are left alone")
+
+	assert.Equal(t, map[string][2]string{
+		"system.timezone":              {"", `"UTC"`},
+		"packages.installed[name=git]": {"", `{"name":"git","version":"2.47"}`},
+		"network.listening_ports[0]":   {"", `{"port":443}`},
+	}, paths(diff.Added))
+	assert.Equal(t, map[string][2]string{
+		"system.kernel":                {`"6.11"`, ""},
+		"packages.installed[name=vim]": {`{"name":"vim","version":"9.1"}`, ""},
+		"network.listening_ports[1]":   {`{"port":80}`, ""},
+	}, paths(diff.Removed))
+	assert.Equal(t, map[string][2]string{
+		"system.os.version":                     {`"41"`, `"42"`},
+		"system.uptime_seconds":                 {`100`, `5`},
+		"packages.installed[name=curl].version": {`"8.9.1"`, `"8.11.0"`},
+	}, paths(diff.Changed))
+
+	// Changes come in path order within each object
+	assert.Equal(t, "packages.installed[name=curl].version", diff.Changed[0].Path)
+}
+
+func TestCompare_Keys(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		changed []string
+		added   []string
+		removed []string
+	}{
+		{
+			name:    "matched by id without names",
+			from:    `[{"id": 1, "state": "up"}]`,
+			to:      `[{"id": 1, "state": "down"}]`,
+			changed: []string{"[id=1].state"},
+		},
+		{
+			name:    "duplicate names fall back to sets",
+			from:    `[{"name": "eth0", "mtu": 1500}, {"name": "eth0", "mtu": 9000}]`,
+			to:      `[{"name": "eth0", "mtu": 9000}]`,
+			removed: []string{"[0]"},
+		},
+		{
+			name:  "repeated elements are counted",
+			from:  `["a"]`,
+			to:    `["a", "a"]`,
+			added: []string{"[1]"},
+		},
+		{
+			name:    "type change",
+			from:    `{"swap": {"total": 0}}`,
+			to:      `{"swap": null}`,
+			changed: []string{"swap"},
+		},
+		{
+			name:    "whole data",
+			from:    `{}`,
+			to:      `[]`,
+			changed: []string{""},
+		},
+		{
+			name: "numbers compare as written",
+			from: `{"load": 1.50}`,
+			to:   `{"load": 1.50}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := Compare(report("r1", tt.from), report("r2", tt.to))
+			require.NoError(t, err)
+			pathsOf := func(changes []models.ReportChange) []string {
+				var result []string
+				for _, change := range changes {
+					result = append(result, change.Path)
+				}
+				return result
+			}
+			assert.Equal(t, tt.changed, pathsOf(diff.Changed))
+			assert.Equal(t, tt.added, pathsOf(diff.Added))
+			assert.Equal(t, tt.removed, pathsOf(diff.Removed))
+		})
+	}
+}
+
+func TestCompare_EmptyAndInvalid(t *testing.T) {
+	diff, err := Compare(report("r1", ""), report("r2", `{"a": 1}`))
+	require.NoError(t, err)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, "null", string(diff.Changed[0].From))
+
+	// Nothing changed still lists empty arrays
+	diff, err = Compare(report("r1", `{"a": 1}`), report("r2", `{"a": 1}`))
+	require.NoError(t, err)
+	encoded, err := json.Marshal(diff)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"added":[],"removed":[],"changed":[]`)
+
+	_, err = Compare(report("r1", `{"a": `), report("r2", `{}`))
+	assert.ErrorContains(t, err, "report r1")
+}
@@ -0,0 +1,236 @@
+package reports
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"snailbus/internal/checkin"
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+)
+
+// timeFormat is how times are shown in reports
+const timeFormat = "2006-01-02 15:04 UTC"
+
+var kindTitles = map[string]string{
+	models.ReportKindInventory:  "Fleet inventory",
+	models.ReportKindCompliance: "Fleet compliance",
+	models.ReportKindOSCurrency: "OS currency",
+}
+
+// inventory counts hosts by OS and tag and lists every host's last report
+func inventory(hosts []*models.HostSummary, staleAfter time.Duration, now time.Time) *models.ReportContent {
+	osCounts := make(map[[2]string]int)
+	tagCounts := make(map[string]int)
+	stale, tagged := 0, 0
+	rows := make([][]string, 0, len(hosts))
+	for _, host := range sortedHosts(hosts) {
+		osCounts[[2]string{host.OSName, host.OSVersion}]++
+		for _, tag := range host.Tags {
+			tagCounts[tag]++
+		}
+		if len(host.Tags) > 0 {
+			tagged++
+		}
+		if now.Sub(host.LastSeen) > staleAfter {
+			stale++
+		}
+		rows = append(rows, []string{host.Name, osLabel(host.OSName, host.OSVersion), strings.Join(host.Tags, ", "), host.LastSeen.UTC().Format(timeFormat)})
+	}
+
+	osRows := make([][]string, 0, len(osCounts))
+	for os, count := range osCounts {
+		osRows = append(osRows, []string{unknown(os[0]), unknown(os[1]), strconv.Itoa(count)})
+	}
+	sortByCount(osRows, 2)
+	tagRows := make([][]string, 0, len(tagCounts))
+	for tag, count := range tagCounts {
+		tagRows = append(tagRows, []string{tag, strconv.Itoa(count)})
+	}
+	sortByCount(tagRows, 1)
+
+	return &models.ReportContent{
+		Summary: []models.ReportStat{
+			{Label: "Hosts", Value: strconv.Itoa(len(hosts))},
+			{Label: "OS versions", Value: strconv.Itoa(len(osCounts))},
+			{Label: "Tagged hosts", Value: strconv.Itoa(tagged)},
+			{Label: fmt.Sprintf("Not seen in %s", staleAfter), Value: strconv.Itoa(stale)},
+		},
+		Sections: []models.ReportSection{
+			{Title: "Operating systems", Columns: []string{"OS", "Version", "Hosts"}, Rows: osRows},
+			{Title: "Tags", Columns: []string{"Tag", "Hosts"}, Rows: tagRows},
+			{Title: "Hosts", Columns: []string{"Host", "OS", "Tags", "Last seen"}, Rows: rows},
+		},
+	}
+}
+
+// compliance checks every host's check-in window, last probe, and collection errors
+// errorCounts holds the number of collection errors of each host's last report.
+func compliance(hosts []*models.HostSummary, schedule *models.CheckinSchedule, errorCounts map[string]int, staleAfter time.Duration, now time.Time) *models.ReportContent {
+	var failing, passing [][]string
+	overdue, unreachable, withErrors := 0, 0, 0
+	for _, host := range sortedHosts(hosts) {
+		pass := true
+
+		checkinResult := "ok"
+		if status := checkin.Evaluate(schedule, host, staleAfter, now); status.Overdue {
+			checkinResult = "overdue since " + status.DueAt.UTC().Format(timeFormat)
+			overdue++
+			pass = false
+		}
+
+		probeResult := "not probed"
+		if host.LastProbe != nil {
+			probeResult = "ok"
+			if !host.LastProbe.Reachable {
+				probeResult = "unreachable"
+				unreachable++
+				pass = false
+			}
+		}
+
+		errorsResult := "ok"
+		if n := errorCounts[host.HostID]; n > 0 {
+			errorsResult = fmt.Sprintf("%d errors", n)
+			withErrors++
+			pass = false
+		}
+
+		if pass {
+			passing = append(passing, []string{host.Name, "pass", checkinResult, probeResult, errorsResult})
+		} else {
+			failing = append(failing, []string{host.Name, "fail", checkinResult, probeResult, errorsResult})
+		}
+	}
+
+	return &models.ReportContent{
+		Summary: []models.ReportStat{
+			{Label: "Hosts", Value: strconv.Itoa(len(hosts))},
+			{Label: "Passing", Value: strconv.Itoa(len(passing))},
+			{Label: "Failing", Value: strconv.Itoa(len(failing))},
+			{Label: "Overdue check-ins", Value: strconv.Itoa(overdue)},
+			{Label: "Unreachable", Value: strconv.Itoa(unreachable)},
+			{Label: "Reports with collection errors", Value: strconv.Itoa(withErrors)},
+		},
+		Sections: []models.ReportSection{{
+			Title: "Hosts",
+			Note: "A host passes when it reported within its check-in window, answered its last reachability probe, " +
+				"and its last report carried no collection errors. Failing hosts are listed first.",
+			Columns: []string{"Host", "Result", "Check-in", "Reachability", "Collection errors"},
+			Rows:    append(failing, passing...),
+		}},
+	}
+}
+
+// osCurrency compares each host's OS version with the newest version of its OS in the fleet
+func osCurrency(hosts []*models.HostSummary) *models.ReportContent {
+	newest := make(map[string]string)
+	for _, host := range hosts {
+		if host.OSName == "" {
+			continue
+		}
+		if latest, ok := newest[host.OSName]; !ok || search.CompareVersions(host.OSVersion, latest) > 0 {
+			newest[host.OSName] = host.OSVersion
+		}
+	}
+
+	current := make(map[string]int)
+	behind := make(map[string]int)
+	var behindHosts []*models.HostSummary
+	unknownOS := 0
+	for _, host := range hosts {
+		switch {
+		case host.OSName == "":
+			unknownOS++
+		case search.CompareVersions(host.OSVersion, newest[host.OSName]) < 0:
+			behind[host.OSName]++
+			behindHosts = append(behindHosts, host)
+		default:
+			current[host.OSName]++
+		}
+	}
+
+	osNames := make([]string, 0, len(newest))
+	for name := range newest {
+		osNames = append(osNames, name)
+	}
+	sort.Strings(osNames)
+	osRows := make([][]string, 0, len(osNames))
+	totalBehind := 0
+	for _, name := range osNames {
+		osRows = append(osRows, []string{name, unknown(newest[name]), strconv.Itoa(current[name]), strconv.Itoa(behind[name])})
+		totalBehind += behind[name]
+	}
+
+	// Oldest versions first within each OS
+	sort.SliceStable(behindHosts, func(i, j int) bool {
+		a, b := behindHosts[i], behindHosts[j]
+		if a.OSName != b.OSName {
+			return a.OSName < b.OSName
+		}
+		if c := search.CompareVersions(a.OSVersion, b.OSVersion); c != 0 {
+			return c < 0
+		}
+		return a.Name < b.Name
+	})
+	hostRows := make([][]string, 0, len(behindHosts))
+	for _, host := range behindHosts {
+		hostRows = append(hostRows, []string{host.Name, host.OSName, unknown(host.OSVersion), newest[host.OSName]})
+	}
+
+	return &models.ReportContent{
+		Summary: []models.ReportStat{
+			{Label: "Hosts", Value: strconv.Itoa(len(hosts))},
+			{Label: "On the newest version", Value: strconv.Itoa(len(hosts) - totalBehind - unknownOS)},
+			{Label: "Behind", Value: strconv.Itoa(totalBehind)},
+			{Label: "Unknown OS", Value: strconv.Itoa(unknownOS)},
+		},
+		Sections: []models.ReportSection{
+			{
+				Title:   "Operating systems",
+				Note:    "The newest version of each OS is the newest one reported by a host of the organization.",
+				Columns: []string{"OS", "Newest version", "Current", "Behind"},
+				Rows:    osRows,
+			},
+			{Title: "Hosts behind", Columns: []string{"Host", "OS", "Version", "Newest version"}, Rows: hostRows},
+		},
+	}
+}
+
+// sortedHosts returns the hosts ordered by name, then ID
+func sortedHosts(hosts []*models.HostSummary) []*models.HostSummary {
+	sorted := append([]*models.HostSummary(nil), hosts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].HostID < sorted[j].HostID
+	})
+	return sorted
+}
+
+// sortByCount orders rows by the count in column countColumn, highest first, then by their first columns
+func sortByCount(rows [][]string, countColumn int) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, _ := strconv.Atoi(rows[i][countColumn])
+		b, _ := strconv.Atoi(rows[j][countColumn])
+		if a != b {
+			return a > b
+		}
+		return strings.Join(rows[i][:countColumn], "\x00") < strings.Join(rows[j][:countColumn], "\x00")
+	})
+}
+
+func osLabel(name, version string) string {
+	return strings.TrimSpace(unknown(name) + " " + version)
+}
+
+func unknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,116 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attachment is a file attached to a report email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends report emails
+type Mailer interface {
+	Send(to []string, subject, html string, attachment Attachment) error
+}
+
+// SMTPMailer sends email through an SMTP server (SMTP_HOST)
+// net/smtp upgrades the connection with STARTTLS when the server offers it, and
+// refuses to send credentials over an unencrypted connection to a remote host.
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer creates a mailer; username may be empty for servers without authentication
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+// Send sends an HTML email with one attachment
+func (m *SMTPMailer) Send(to []string, subject, html string, attachment Attachment) error {
+	message, err := buildMessage(m.from, to, subject, html, attachment, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	// The envelope sender is the bare address; SMTP_FROM may carry a display name
+	sender := m.from
+	if address, err := mail.ParseAddress(m.from); err == nil {
+		sender = address.Address
+	}
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	if err := smtp.SendMail(addr, auth, sender, to, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// buildMessage formats a multipart/mixed message with an HTML body and an attachment
+func buildMessage(from string, to []string, subject, html string, attachment Attachment, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	htmlPart, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(htmlPart)
+	if _, err := qp.Write([]byte(html)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	attachmentPart, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename})},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		fmt.Fprintf(attachmentPart, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(attachmentPart, "%s\r\n", encoded)
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
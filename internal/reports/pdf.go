@@ -0,0 +1,160 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	pageMargin = 40.0
+)
+
+// Standard PDF fonts, which viewers provide so nothing is embedded
+const (
+	fontRegular  = "F1"
+	fontBold     = "F2"
+	fontMono     = "F3"
+	fontMonoBold = "F4"
+)
+
+var pdfFonts = []struct{ name, baseFont string }{
+	{fontRegular, "Helvetica"},
+	{fontBold, "Helvetica-Bold"},
+	{fontMono, "Courier"},
+	{fontMonoBold, "Courier-Bold"},
+}
+
+// pdfDocument lays out lines of text on A4 pages and writes them as a PDF file
+// Text is encoded as WinAnsi; characters outside Latin-1 are replaced with "?".
+type pdfDocument struct {
+	pages []*bytes.Buffer // Content stream of each page
+	y     float64         // Baseline of the last line on the current page
+}
+
+func newPDF() *pdfDocument {
+	return &pdfDocument{}
+}
+
+// text adds a line, wrapping it at word boundaries to fit the page width
+// Monospaced lines are table rows laid out to fit and are added as they are.
+func (d *pdfDocument) text(font string, size float64, line string) {
+	lines := []string{line}
+	if font != fontMono && font != fontMonoBold {
+		lines = wrap(line, int((pageWidth-2*pageMargin)/(0.5*size)))
+	}
+	for _, wrapped := range lines {
+		leading := size * 1.4
+		if len(d.pages) == 0 || d.y-leading < pageMargin {
+			d.pages = append(d.pages, &bytes.Buffer{})
+			d.y = pageHeight - pageMargin
+		}
+		d.y -= leading
+		fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %g Tf %g %.2f Td (%s) Tj ET\n", font, size, pageMargin, d.y, pdfString(wrapped))
+	}
+}
+
+// space leaves a vertical gap; a gap at the bottom of a page is dropped
+func (d *pdfDocument) space(height float64) {
+	if len(d.pages) > 0 && d.y-height >= pageMargin {
+		d.y -= height
+	}
+}
+
+// bytes writes the document: catalog, page tree, fonts, then each page and its content
+func (d *pdfDocument) bytes() []byte {
+	if len(d.pages) == 0 {
+		d.pages = append(d.pages, &bytes.Buffer{})
+	}
+
+	var objects []string
+	add := func(object string) int {
+		objects = append(objects, object)
+		return len(objects)
+	}
+	add("<< /Type /Catalog /Pages 2 0 R >>")
+	pagesIndex := add("") // filled in once the page objects are numbered
+	var fonts strings.Builder
+	for _, font := range pdfFonts {
+		id := add(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.baseFont))
+		fmt.Fprintf(&fonts, "/%s %d 0 R ", font.name, id)
+	}
+	var kids []string
+	for _, page := range d.pages {
+		contentID := add(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+		pageID := add(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fonts.String(), contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+	objects[pagesIndex-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// pdfString encodes text as the body of a PDF literal string
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			// Latin-1 matches WinAnsi here; written as an octal escape
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrap splits text into lines of at most width characters at spaces
+// Words longer than width are cut.
+func wrap(text string, width int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		w := []rune(word)
+		for len(w) > width {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lines = append(lines, string(w[:width]))
+			w = w[width:]
+		}
+		if len(line) > 0 && len(line)+1+len(w) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, w...)
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
@@ -0,0 +1,172 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.generated { color: #666; margin-top: 0; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+.summary td:first-child { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="generated">{{.Generated}}</p>
+<table class="summary">
+{{- range .Content.Summary}}
+<tr><td>{{.Label}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- range .Content.Sections}}
+<h2>{{.Title}}</h2>
+{{- if .Note}}
+<p>{{.Note}}</p>
+{{- end}}
+{{- if .Rows}}
+<table>
+<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// generated describes when and how a report was generated
+func generated(report *models.FleetReport) string {
+	line := "Generated " + report.CreatedAt.UTC().Format(timeFormat)
+	if report.Trigger == models.ReportTriggerScheduled {
+		line += " by the report schedule"
+	}
+	return line
+}
+
+// RenderHTML renders a report as a standalone HTML page
+func RenderHTML(report *models.FleetReport) (string, error) {
+	content := report.Content
+	if content == nil {
+		content = &models.ReportContent{}
+	}
+	var b bytes.Buffer
+	err := htmlTemplate.Execute(&b, struct {
+		Title     string
+		Generated string
+		Content   *models.ReportContent
+	}{report.Title, generated(report), content})
+	if err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+	return b.String(), nil
+}
+
+// RenderPDF renders a report as a PDF document
+// Tables are set in a monospaced font with cells cut to fit the page width.
+func RenderPDF(report *models.FleetReport) []byte {
+	doc := newPDF()
+	doc.text(fontBold, 18, report.Title)
+	doc.text(fontRegular, 9, generated(report))
+	doc.space(10)
+
+	if report.Content != nil {
+		for _, stat := range report.Content.Summary {
+			doc.text(fontRegular, 11, stat.Label+": "+stat.Value)
+		}
+		for _, section := range report.Content.Sections {
+			doc.space(14)
+			doc.text(fontBold, 13, section.Title)
+			if section.Note != "" {
+				doc.text(fontRegular, 9, section.Note)
+			}
+			doc.space(4)
+			if len(section.Rows) == 0 {
+				doc.text(fontRegular, 10, "None.")
+				continue
+			}
+			widths := columnWidths(section, tableChars)
+			doc.text(fontMonoBold, tableSize, tableRow(section.Columns, widths))
+			for _, row := range section.Rows {
+				doc.text(fontMono, tableSize, tableRow(row, widths))
+			}
+		}
+	}
+	return doc.bytes()
+}
+
+// Table layout: the monospaced font is 0.6 em wide, so 107 characters fit at 8 points
+const (
+	tableSize  = 8
+	tableChars = 107
+	columnGap  = 2
+)
+
+// columnWidths sizes each column to its longest cell, narrowing the widest columns
+// until the table fits in maxChars
+func columnWidths(section models.ReportSection, maxChars int) []int {
+	widths := make([]int, len(section.Columns))
+	for i, column := range section.Columns {
+		widths[i] = len([]rune(column))
+	}
+	for _, row := range section.Rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if n := len([]rune(row[i])); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for {
+		total := columnGap * (len(widths) - 1)
+		widest := 0
+		for i, w := range widths {
+			total += w
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if total <= maxChars || widths[widest] <= 4 {
+			return widths
+		}
+		widths[widest]--
+	}
+}
+
+// tableRow pads or cuts each cell to its column's width
+func tableRow(cells []string, widths []int) string {
+	var b strings.Builder
+	for i, width := range widths {
+		var cell []rune
+		if i < len(cells) {
+			cell = []rune(cells[i])
+		}
+		if len(cell) > width {
+			cell = append(cell[:width-3], []rune("...")...)
+		}
+		b.WriteString(string(cell))
+		if i < len(widths)-1 {
+			b.WriteString(strings.Repeat(" ", width-len(cell)+columnGap))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+func testReport() *models.FleetReport {
+	return &models.FleetReport{
+		Kind:      models.ReportKindInventory,
+		Title:     "Fleet inventory - <Acme & Co>",
+		Trigger:   models.ReportTriggerScheduled,
+		CreatedAt: time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC),
+		Content: &models.ReportContent{
+			Summary: []models.ReportStat{{Label: "Hosts", Value: "2"}},
+			Sections: []models.ReportSection{
+				{Title: "Hosts", Columns: []string{"Host", "OS"}, Rows: [][]string{{"<script>", "Debian 12"}, {"café", "Fedora 40"}}},
+				{Title: "Tags", Columns: []string{"Tag", "Hosts"}},
+			},
+		},
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	html, err := RenderHTML(testReport())
+	require.NoError(t, err)
+
+	assert.Contains(t, html, "<h1>Fleet inventory - &lt;Acme &amp; Co&gt;</h1>")
+	assert.Contains(t, html, "Generated 2024-06-03 09:00 UTC by the report schedule")
+	assert.Contains(t, html, "<td>&lt;script&gt;</td>")
+	assert.NotContains(t, html, "<script>")
+	assert.Contains(t, html, "<p>None.</p>", "empty sections say so")
+
+	// A listed report has no content
+	report := testReport()
+	report.Content = nil
+	_, err = RenderHTML(report)
+	assert.NoError(t, err)
+}
+
+func TestRenderPDF(t *testing.T) {
+	pdf := RenderPDF(testReport())
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "(Fleet inventory - <Acme & Co>) Tj")
+	assert.Contains(t, string(pdf), `caf\351`, "Latin-1 text is kept")
+
+	// startxref points at the cross-reference table, whose entries point at the objects
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	require.NotNil(t, match)
+	xref, err := strconv.Atoi(string(match[1]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	require.NotEmpty(t, entries)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(strconv.Itoa(i+1)+" 0 obj\n")), "object %d", i+1)
+	}
+}
+
+func TestRenderPDF_Pages(t *testing.T) {
+	report := testReport()
+	rows := make([][]string, 200)
+	for i := range rows {
+		rows[i] = []string{"host-" + strconv.Itoa(i), "Debian 12"}
+	}
+	report.Content.Sections[0].Rows = rows
+
+	// About 68 table rows fit on a page
+	pdf := string(RenderPDF(report))
+	assert.Contains(t, pdf, "/Count 4 ")
+	assert.Equal(t, 4, strings.Count(pdf, "/Type /Page /Parent"))
+}
+
+func TestPDFString(t *testing.T) {
+	assert.Equal(t, `a\(b\)\\c`, pdfString(`a(b)\c`))
+	assert.Equal(t, `\374ber`, pdfString("über"))
+	assert.Equal(t, "?? a b", pdfString("✓✓ a\tb"))
+}
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, []string{"the quick", "brown fox"}, wrap("the quick brown fox", 10))
+	assert.Equal(t, []string{"abcdefghij", "klm x"}, wrap("abcdefghijklm x", 10), "long words are cut")
+	assert.Equal(t, []string{""}, wrap("", 10))
+}
+
+func TestColumnWidths(t *testing.T) {
+	section := models.ReportSection{
+		Columns: []string{"Host", "OS"},
+		Rows:    [][]string{{"a-very-long-hostname", "Debian"}},
+	}
+	assert.Equal(t, []int{20, 6}, columnWidths(section, 100))
+	// The widest column is narrowed to fit
+	widths := columnWidths(section, 20)
+	assert.Equal(t, []int{12, 6}, widths)
+	assert.Equal(t, "a-very-lo...  Debian", tableRow(section.Rows[0], widths))
+	assert.Equal(t, "Host          OS", tableRow(section.Columns, widths))
+}
+
+func TestBuildMessage(t *testing.T) {
+	attachment := Attachment{Filename: "report.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF"), 100)}
+	date := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	raw, err := buildMessage("Snailbus <reports@example.com>", []string{"a@example.com", "b@example.com"},
+		"Fleet inventory – Acme", "<p>Hosts: 3</p>", attachment, date)
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com, b@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Fleet inventory – Acme", subject)
+	sent, err := msg.Header.Date()
+	require.NoError(t, err)
+	assert.True(t, sent.Equal(date))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	// multipart.Reader decodes quoted-printable parts itself
+	body, err := parts.NextPart()
+	require.NoError(t, err)
+	html, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Hosts: 3</p>", string(html))
+
+	file, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "report.pdf", file.FileName())
+	encoded, err := io.ReadAll(file)
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, attachment.Data, data)
+
+	_, err = parts.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,204 @@
+// Package reports generates fleet reports and renders them as HTML or PDF.
+//
+// A report is a snapshot of an organization's hosts: an inventory by OS and tag, a
+// compliance checklist, or how current the hosts' OS versions are. The content is
+// stored as summary figures and tables, independent of the format, and rendered when
+// the report is downloaded or emailed. Reports are generated on demand or by the
+// organization's report schedule; scheduled runs are claimed through the database so
+// each one is generated by a single instance.
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// CheckInterval is how often the service looks for due report schedules
+const CheckInterval = 5 * time.Minute
+
+// ErrEmailNotConfigured is returned when a report is to be emailed but no mailer is set
+var ErrEmailNotConfigured = errors.New("email is not configured on this server")
+
+// Service generates, stores, and emails fleet reports
+type Service struct {
+	store      storage.Storage
+	mailer     Mailer
+	staleAfter time.Duration
+	now        func() time.Time
+}
+
+// NewService creates a report service
+// mailer is nil when email is not configured; staleAfter is the check-in window of
+// hosts whose organization has no check-in schedule.
+func NewService(store storage.Storage, mailer Mailer, staleAfter time.Duration) *Service {
+	return &Service{
+		store:      store,
+		mailer:     mailer,
+		staleAfter: staleAfter,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// CanEmail reports whether reports can be emailed
+func (s *Service) CanEmail() bool {
+	return s.mailer != nil
+}
+
+// Create generates a report of the organization's fleet and stores it
+// With email set the report is sent to the organization's admins first; a failed
+// delivery is recorded on the report rather than returned, so the report is kept.
+func (s *Service) Create(ctx context.Context, orgID, kind, trigger, requestedBy string, email bool) (*models.FleetReport, error) {
+	if email && s.mailer == nil {
+		return nil, ErrEmailNotConfigured
+	}
+
+	org, err := s.store.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	now := s.now()
+	content, err := s.generate(ctx, orgID, kind, now)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.FleetReport{
+		ID:          uuid.New().String(),
+		OrgID:       orgID,
+		Kind:        kind,
+		Title:       fmt.Sprintf("%s - %s", kindTitles[kind], org.Name),
+		Trigger:     trigger,
+		RequestedBy: requestedBy,
+		CreatedAt:   now,
+		Content:     content,
+	}
+	if email {
+		if err := s.email(report); err != nil {
+			logger.Logger.Warn().Err(err).Str("org_id", orgID).Str("report_id", report.ID).Msg("Failed to email fleet report")
+			report.EmailedTo = nil
+			report.EmailError = err.Error()
+		}
+	}
+
+	if err := s.store.CreateFleetReport(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// generate builds the content of a report kind
+func (s *Service) generate(ctx context.Context, orgID, kind string, now time.Time) (*models.ReportContent, error) {
+	hosts, err := s.store.ListHosts(orgID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+
+	switch kind {
+	case models.ReportKindInventory:
+		return inventory(hosts, s.staleAfter, now), nil
+	case models.ReportKindCompliance:
+		schedule, err := s.store.GetCheckinSchedule(orgID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to get check-in schedule: %w", err)
+		}
+		errorCounts := make(map[string]int)
+		err = s.store.IterateHosts(ctx, orgID, func(report *models.Report) error {
+			errorCounts[report.Meta.HostID] = len(report.Errors)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host reports: %w", err)
+		}
+		return compliance(hosts, schedule, errorCounts, s.staleAfter, now), nil
+	case models.ReportKindOSCurrency:
+		return osCurrency(hosts), nil
+	}
+	return nil, fmt.Errorf("unknown report kind %q", kind)
+}
+
+// email sends a report to the organization's active admins with the PDF attached
+func (s *Service) email(report *models.FleetReport) error {
+	users, err := s.store.ListUsersByOrganization(report.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to list admins: %w", err)
+	}
+	var recipients []string
+	for _, user := range users {
+		if user.Role == "admin" && user.IsActive && user.Email != "" {
+			recipients = append(recipients, user.Email)
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("the organization has no active admin with an email address")
+	}
+
+	html, err := RenderHTML(report)
+	if err != nil {
+		return err
+	}
+	attachment := Attachment{
+		Filename:    Filename(report, models.ReportFormatPDF),
+		ContentType: "application/pdf",
+		Data:        RenderPDF(report),
+	}
+	if err := s.mailer.Send(recipients, report.Title, html, attachment); err != nil {
+		return err
+	}
+	report.EmailedTo = recipients
+	return nil
+}
+
+// Run generates the reports of due schedules every CheckInterval until ctx is done
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunDue(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to run report schedules")
+			}
+		}
+	}
+}
+
+// RunDue generates the reports of every due schedule and returns how many were stored
+// A report that fails is logged and skipped so it does not hold up the others.
+func (s *Service) RunDue(ctx context.Context) (int, error) {
+	schedules, err := s.store.ClaimReportSchedules(s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for _, schedule := range schedules {
+		// A schedule may ask for email after the server lost its SMTP settings
+		email := schedule.Email && s.CanEmail()
+		for _, kind := range schedule.Kinds {
+			report, err := s.Create(ctx, schedule.OrgID, kind, models.ReportTriggerScheduled, "", email)
+			if err != nil {
+				logger.Logger.Error().Err(err).Str("org_id", schedule.OrgID).Str("kind", kind).Msg("Failed to generate scheduled report")
+				continue
+			}
+			logger.Logger.Info().Str("org_id", schedule.OrgID).Str("report_id", report.ID).Str("kind", kind).Msg("Scheduled report generated")
+			generated++
+		}
+	}
+	return generated, nil
+}
+
+// Filename returns the download name of a report in format
+func Filename(report *models.FleetReport, format string) string {
+	return fmt.Sprintf("snailbus-%s-%s.%s", report.Kind, report.CreatedAt.UTC().Format("20060102-1504"), format)
+}
@@ -0,0 +1,241 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	testHostWeb = "00000000-0000-0000-0000-000000000001"
+	testHostDB  = "00000000-0000-0000-0000-000000000002"
+	testHostOld = "00000000-0000-0000-0000-000000000003"
+)
+
+// fakeMailer records the emails it is asked to send
+type fakeMailer struct {
+	sent []sentEmail
+	err  error
+}
+
+type sentEmail struct {
+	to         []string
+	subject    string
+	html       string
+	attachment Attachment
+}
+
+func (m *fakeMailer) Send(to []string, subject, html string, attachment Attachment) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentEmail{to, subject, html, attachment})
+	return nil
+}
+
+// setupFleet creates an organization with three hosts: two on Debian 12, one on Debian 11
+// that last reported three days ago with collection errors
+func setupFleet(t *testing.T, now time.Time) (*storage.MockStorage, *models.Organization) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Acme")
+	require.NoError(t, err)
+	admin, err := store.CreateUser("admin", "admin@example.com", "hash", org.ID, "admin")
+	require.NoError(t, err)
+	_, err = store.CreateUser("viewer", "viewer@example.com", "hash", org.ID, "viewer")
+	require.NoError(t, err)
+
+	for _, host := range []struct {
+		id, name, version string
+		seen              time.Time
+		tags              []string
+		errors            []string
+	}{
+		{testHostWeb, "web-1", "12", now.Add(-time.Hour), []string{"env:prod"}, nil},
+		{testHostDB, "db-1", "12", now.Add(-time.Hour), []string{"env:prod", "role:db"}, nil},
+		{testHostOld, "old-1", "11", now.Add(-72 * time.Hour), nil, []string{"packages: timeout"}},
+	} {
+		require.NoError(t, store.SaveHost(&models.Report{
+			ID:         host.id,
+			ReceivedAt: host.seen,
+			Meta:       models.ReportMeta{HostID: host.id, Hostname: host.name},
+			Data:       json.RawMessage(`{"system":{"os":{"name":"Debian","version":"` + host.version + `"}}}`),
+			Errors:     host.errors,
+		}, org.ID, admin.ID))
+		require.NoError(t, store.SetHostTags(host.id, org.ID, host.tags, admin.ID, 0))
+	}
+	return store, org
+}
+
+func newTestService(store storage.Storage, mailer Mailer, now time.Time) *Service {
+	service := NewService(store, mailer, 24*time.Hour)
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func stat(content *models.ReportContent, label string) string {
+	for _, s := range content.Summary {
+		if s.Label == label {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func TestService_Create(t *testing.T) {
+	now := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	store, org := setupFleet(t, now)
+	service := newTestService(store, nil, now)
+	ctx := context.Background()
+
+	t.Run("inventory", func(t *testing.T) {
+		report, err := service.Create(ctx, org.ID, models.ReportKindInventory, models.ReportTriggerOnDemand, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "Fleet inventory - Acme", report.Title)
+		assert.Equal(t, "3", stat(report.Content, "Hosts"))
+		assert.Equal(t, "2", stat(report.Content, "Tagged hosts"))
+		assert.Equal(t, "1", stat(report.Content, "Not seen in 24h0m0s"))
+
+		osSection := report.Content.Sections[0]
+		assert.Equal(t, [][]string{{"Debian", "12", "2"}, {"Debian", "11", "1"}}, osSection.Rows, "most common first")
+		tagSection := report.Content.Sections[1]
+		assert.Equal(t, [][]string{{"env:prod", "2"}, {"role:db", "1"}}, tagSection.Rows)
+		hostSection := report.Content.Sections[2]
+		require.Len(t, hostSection.Rows, 3)
+		assert.Equal(t, "db-1", hostSection.Rows[0][0], "hosts by name")
+
+		// The stored report keeps its content
+		stored, err := store.GetFleetReport(report.ID, org.ID)
+		require.NoError(t, err)
+		assert.Equal(t, report.Content, stored.Content)
+	})
+
+	t.Run("compliance", func(t *testing.T) {
+		report, err := service.Create(ctx, org.ID, models.ReportKindCompliance, models.ReportTriggerOnDemand, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "2", stat(report.Content, "Passing"))
+		assert.Equal(t, "1", stat(report.Content, "Failing"))
+		assert.Equal(t, "1", stat(report.Content, "Overdue check-ins"))
+		assert.Equal(t, "1", stat(report.Content, "Reports with collection errors"))
+
+		rows := report.Content.Sections[0].Rows
+		require.Len(t, rows, 3)
+		assert.Equal(t, "old-1", rows[0][0], "failing hosts first")
+		assert.Equal(t, "fail", rows[0][1])
+		assert.Equal(t, "1 errors", rows[0][4])
+	})
+
+	t.Run("compliance uses the check-in schedule", func(t *testing.T) {
+		require.NoError(t, store.SetCheckinSchedule(&models.CheckinSchedule{OrgID: org.ID, DefaultIntervalSeconds: 7 * 86400}))
+		defer store.DeleteCheckinSchedule(org.ID, 0)
+
+		report, err := service.Create(ctx, org.ID, models.ReportKindCompliance, models.ReportTriggerOnDemand, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "0", stat(report.Content, "Overdue check-ins"))
+	})
+
+	t.Run("os currency", func(t *testing.T) {
+		report, err := service.Create(ctx, org.ID, models.ReportKindOSCurrency, models.ReportTriggerOnDemand, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "2", stat(report.Content, "On the newest version"))
+		assert.Equal(t, "1", stat(report.Content, "Behind"))
+		assert.Equal(t, [][]string{{"Debian", "12", "2", "1"}}, report.Content.Sections[0].Rows)
+		assert.Equal(t, [][]string{{"old-1", "Debian", "11", "12"}}, report.Content.Sections[1].Rows)
+	})
+
+	t.Run("email requires a mailer", func(t *testing.T) {
+		_, err := service.Create(ctx, org.ID, models.ReportKindInventory, models.ReportTriggerOnDemand, "", true)
+		assert.ErrorIs(t, err, ErrEmailNotConfigured)
+	})
+
+	t.Run("unknown organization", func(t *testing.T) {
+		_, err := service.Create(ctx, "00000000-0000-0000-0000-00000000ffff", models.ReportKindInventory, models.ReportTriggerOnDemand, "", false)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
+
+func TestService_Email(t *testing.T) {
+	now := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	store, org := setupFleet(t, now)
+	mailer := &fakeMailer{}
+	service := newTestService(store, mailer, now)
+
+	report, err := service.Create(context.Background(), org.ID, models.ReportKindInventory, models.ReportTriggerOnDemand, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin@example.com"}, report.EmailedTo, "only admins receive reports")
+	assert.Empty(t, report.EmailError)
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, report.Title, mailer.sent[0].subject)
+	assert.Contains(t, mailer.sent[0].html, "<h1>Fleet inventory - Acme</h1>")
+	assert.Equal(t, "snailbus-inventory-20240603-0900.pdf", mailer.sent[0].attachment.Filename)
+	assert.Equal(t, "application/pdf", mailer.sent[0].attachment.ContentType)
+
+	// A failed delivery is recorded and the report is still stored
+	mailer.err = errors.New("connection refused")
+	report, err = service.Create(context.Background(), org.ID, models.ReportKindInventory, models.ReportTriggerOnDemand, "", true)
+	require.NoError(t, err)
+	assert.Empty(t, report.EmailedTo)
+	assert.Equal(t, "connection refused", report.EmailError)
+	_, err = store.GetFleetReport(report.ID, org.ID)
+	assert.NoError(t, err)
+}
+
+func TestService_RunDue(t *testing.T) {
+	now := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	store, org := setupFleet(t, now)
+	mailer := &fakeMailer{}
+	service := newTestService(store, mailer, now)
+	ctx := context.Background()
+
+	require.NoError(t, store.SetReportSchedule(&models.ReportSchedule{
+		OrgID:     org.ID,
+		Kinds:     []string{models.ReportKindInventory, models.ReportKindOSCurrency},
+		Frequency: models.ReportFrequencyWeekly,
+		Email:     true,
+		NextRunAt: now.Add(-time.Minute),
+	}))
+
+	generated, err := service.RunDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, generated)
+	assert.Len(t, mailer.sent, 2)
+
+	reports, err := store.ListFleetReports(org.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	for _, report := range reports {
+		assert.Equal(t, models.ReportTriggerScheduled, report.Trigger)
+		assert.Empty(t, report.RequestedBy)
+	}
+
+	schedule, err := store.GetReportSchedule(org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Minute).AddDate(0, 0, 7), schedule.NextRunAt)
+	require.NotNil(t, schedule.LastRunAt)
+	assert.Equal(t, now, *schedule.LastRunAt)
+
+	// Nothing is due until next week
+	generated, err = service.RunDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, generated)
+
+	// Without a mailer scheduled reports are still generated, just not emailed
+	service = newTestService(store, nil, now.AddDate(0, 0, 7))
+	generated, err = service.RunDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, generated)
+	assert.Len(t, mailer.sent, 2)
+}
+
+func TestFilename(t *testing.T) {
+	report := &models.FleetReport{Kind: models.ReportKindOSCurrency, CreatedAt: time.Date(2024, 6, 3, 9, 5, 0, 0, time.UTC)}
+	assert.Equal(t, "snailbus-os_currency-20240603-0905.html", Filename(report, models.ReportFormatHTML))
+	assert.Equal(t, "snailbus-os_currency-20240603-0905.pdf", Filename(report, models.ReportFormatPDF))
+}
@@ -0,0 +1,266 @@
+// Package reprocess re-derives stored host projections from the raw reports in the
+// host event stream.
+//
+// Hosts rows, host tags, and facet counters are derived from reports when they are
+// ingested. When that derivation changes, existing hosts keep the old results until
+// they report again. A reprocess job replays every host's events with a bounded
+// number of workers, started at a throttled rate so ingest keeps priority, and
+// rebuilds each organization's facet counters once all of its hosts are done. Jobs
+// are tracked in memory by the instance that runs them.
+package reprocess
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+	"snailbus/internal/workpool"
+)
+
+// DefaultHostsPerSecond is the throttle applied when a job does not set one
+const DefaultHostsPerSecond = 50
+
+// DefaultWorkers is how many hosts a job replays at a time when it does not set it
+const DefaultWorkers = 1
+
+// maxJobs bounds how many finished jobs are kept for status queries
+const maxJobs = 20
+
+var (
+	// ErrJobRunning is returned when a job is started while another is running
+	ErrJobRunning = errors.New("a reprocess job is already running")
+	// ErrJobNotFound is returned for unknown job IDs
+	ErrJobNotFound = errors.New("reprocess job not found")
+	// ErrJobFinished is returned when canceling a job that is no longer running
+	ErrJobFinished = errors.New("reprocess job is not running")
+)
+
+// Runner runs reprocess jobs, one at a time
+type Runner struct {
+	store storage.Storage
+	wait  func(ctx context.Context, d time.Duration) error // Overridden in tests
+
+	mu     sync.Mutex
+	jobs   []*models.ReprocessJob // Oldest first
+	cancel context.CancelFunc     // Cancels the running job; nil when none is running
+}
+
+// NewRunner creates a runner over store
+func NewRunner(store storage.Storage) *Runner {
+	return &Runner{store: store, wait: sleep}
+}
+
+// Start begins reprocessing the organization's hosts, or every organization's when
+// orgID is empty, at up to hostsPerSecond hosts per second with up to workers at a time
+func (r *Runner) Start(orgID string, hostsPerSecond float64, workers int, requestedBy string) (*models.ReprocessJob, error) {
+	if hostsPerSecond <= 0 {
+		hostsPerSecond = DefaultHostsPerSecond
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return nil, ErrJobRunning
+	}
+
+	j := &models.ReprocessJob{
+		ID:             uuid.New().String(),
+		OrgID:          orgID,
+		Status:         models.ReprocessJobRunning,
+		HostsPerSecond: hostsPerSecond,
+		Workers:        workers,
+		RequestedBy:    requestedBy,
+		StartedAt:      time.Now().UTC(),
+	}
+	r.jobs = append(r.jobs, j)
+	if len(r.jobs) > maxJobs {
+		r.jobs = r.jobs[len(r.jobs)-maxJobs:]
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx, j)
+
+	snapshot := *j
+	return &snapshot, nil
+}
+
+// Get returns a job's current progress
+func (r *Runner) Get(id string) (*models.ReprocessJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, j := range r.jobs {
+		if j.ID == id {
+			snapshot := *j
+			return &snapshot, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// List returns the retained jobs, newest first
+func (r *Runner) List() []*models.ReprocessJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := make([]*models.ReprocessJob, 0, len(r.jobs))
+	for i := len(r.jobs) - 1; i >= 0; i-- {
+		snapshot := *r.jobs[i]
+		jobs = append(jobs, &snapshot)
+	}
+	return jobs
+}
+
+// Cancel stops a running job after the host it is working on
+func (r *Runner) Cancel(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, j := range r.jobs {
+		if j.ID != id {
+			continue
+		}
+		if j.Status != models.ReprocessJobRunning {
+			return ErrJobFinished
+		}
+		r.cancel()
+		return nil
+	}
+	return ErrJobNotFound
+}
+
+// Stop cancels the running job, if any
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// run replays every host, then rebuilds the facet counters of each organization it covered
+func (r *Runner) run(ctx context.Context, j *models.ReprocessJob) {
+	logger.Logger.Info().
+		Str("job_id", j.ID).
+		Str("org_id", j.OrgID).
+		Float64("hosts_per_second", j.HostsPerSecond).
+		Int("workers", j.Workers).
+		Msg("Reprocess job started")
+
+	status := r.process(ctx, j)
+
+	r.mu.Lock()
+	now := time.Now().UTC()
+	j.Status = status
+	j.FinishedAt = &now
+	if status == models.ReprocessJobCompleted {
+		j.Progress = 1
+	}
+	r.cancel()
+	r.cancel = nil
+	result := *j
+	r.mu.Unlock()
+
+	logger.Logger.Info().
+		Str("job_id", result.ID).
+		Str("status", result.Status).
+		Int("processed", result.Processed).
+		Int("failed", result.Failed).
+		Dur("duration", now.Sub(result.StartedAt)).
+		Msg("Reprocess job finished")
+}
+
+// process does the job's work and returns its final status
+func (r *Runner) process(ctx context.Context, j *models.ReprocessJob) string {
+	refs, err := r.store.ListEventHosts(j.OrgID)
+	if err != nil {
+		r.update(j, func() { j.LastError = err.Error() })
+		logger.Logger.Error().Err(err).Str("job_id", j.ID).Msg("Failed to list hosts to reprocess")
+		return models.ReprocessJobFailed
+	}
+	r.update(j, func() { j.Total = len(refs) })
+
+	rebuilt := 0 // refs whose organization's counters are handled
+	interval := time.Duration(float64(time.Second) / j.HostsPerSecond)
+	opts := workpool.Options{
+		Workers: j.Workers,
+		Pace: func(ctx context.Context) error {
+			return r.wait(ctx, interval)
+		},
+		// refs are ordered by organization, so an organization is done once every ref
+		// up to its last one is; its counters are rebuilt as soon as that happens
+		Checkpoint: func(done int) {
+			for ; rebuilt < done; rebuilt++ {
+				ref := refs[rebuilt]
+				if rebuilt < len(refs)-1 && refs[rebuilt+1].OrgID == ref.OrgID {
+					continue
+				}
+				if err := r.store.RebuildFacetCounts(ref.OrgID); err != nil {
+					logger.Logger.Warn().Err(err).
+						Str("job_id", j.ID).
+						Str("org_id", ref.OrgID).
+						Msg("Failed to rebuild facet counts")
+					r.update(j, func() { j.LastError = err.Error() })
+				}
+			}
+		},
+	}
+	err = workpool.Run(ctx, refs, opts, func(ctx context.Context, ref models.HostRef) error {
+		err := r.store.ReplayHost(ref.HostID, ref.OrgID)
+		if err != nil {
+			logger.Logger.Warn().Err(err).
+				Str("job_id", j.ID).
+				Str("host_id", ref.HostID).
+				Str("org_id", ref.OrgID).
+				Msg("Failed to reprocess host")
+		}
+		r.update(j, func() {
+			j.Processed++
+			if err != nil {
+				j.Failed++
+				j.LastError = err.Error()
+			}
+		})
+		// A host that fails is counted and skipped; it does not stop the job
+		return nil
+	})
+	if err != nil {
+		return models.ReprocessJobCanceled
+	}
+	return models.ReprocessJobCompleted
+}
+
+// update applies fn to the job under the runner's lock and refreshes its progress
+func (r *Runner) update(j *models.ReprocessJob, fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn()
+	if j.Total > 0 {
+		j.Progress = float64(j.Processed) / float64(j.Total)
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package reprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// waitForJob polls until the job leaves the running state
+func waitForJob(t *testing.T, r *Runner, id string) *models.ReprocessJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := r.Get(id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if job.Status != models.ReprocessJobRunning {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s still running", id)
+	return nil
+}
+
+func saveHost(t *testing.T, store *storage.MockStorage, hostID, orgID, userID string) {
+	t.Helper()
+	report := &models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+		Data:       json.RawMessage(`{}`),
+	}
+	if err := store.SaveHost(report, orgID, userID); err != nil {
+		t.Fatalf("SaveHost() error = %v", err)
+	}
+}
+
+func TestRunner_Start(t *testing.T) {
+	store := storage.NewMockStorage()
+	org1, _ := store.CreateOrganization("Org 1")
+	org2, _ := store.CreateOrganization("Org 2")
+	user, _ := store.CreateUser("user", "user@example.com", "hash", org1.ID, "admin")
+	saveHost(t, store, "00000000-0000-0000-0000-000000000001", org1.ID, user.ID)
+	saveHost(t, store, "00000000-0000-0000-0000-000000000002", org1.ID, user.ID)
+	saveHost(t, store, "00000000-0000-0000-0000-000000000003", org2.ID, user.ID)
+
+	var waits []time.Duration
+	r := NewRunner(store)
+	r.wait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	// One organization
+	job, err := r.Start(org1.ID, 10, 0, user.ID)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	done := waitForJob(t, r, job.ID)
+	if done.Status != models.ReprocessJobCompleted || done.Total != 2 || done.Processed != 2 || done.Progress != 1 {
+		t.Errorf("job = %+v, want 2 of 2 hosts completed", done)
+	}
+	if done.Workers != DefaultWorkers {
+		t.Errorf("Workers = %d, want %d", done.Workers, DefaultWorkers)
+	}
+	if len(waits) != 1 || waits[0] != 100*time.Millisecond {
+		t.Errorf("waits = %v, want one 100ms wait between hosts", waits)
+	}
+
+	// Every organization, at the default rate
+	job, err = r.Start("", 0, 2, user.ID)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if job.HostsPerSecond != DefaultHostsPerSecond || job.Workers != 2 {
+		t.Errorf("job = %+v, want the default rate with 2 workers", job)
+	}
+	done = waitForJob(t, r, job.ID)
+	if done.Status != models.ReprocessJobCompleted || done.Total != 3 || done.Failed != 0 {
+		t.Errorf("job = %+v, want 3 hosts completed", done)
+	}
+
+	jobs := r.List()
+	if len(jobs) != 2 || jobs[0].ID != job.ID {
+		t.Errorf("List() = %d jobs, want 2 newest first", len(jobs))
+	}
+	if err := r.Cancel(job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Cancel() finished job error = %v, want ErrJobFinished", err)
+	}
+	if _, err := r.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get() error = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestRunner_Cancel(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, _ := store.CreateOrganization("Org")
+	user, _ := store.CreateUser("user", "user@example.com", "hash", org.ID, "admin")
+	saveHost(t, store, "00000000-0000-0000-0000-000000000001", org.ID, user.ID)
+	saveHost(t, store, "00000000-0000-0000-0000-000000000002", org.ID, user.ID)
+
+	r := NewRunner(store)
+	r.wait = func(ctx context.Context, d time.Duration) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	job, err := r.Start(org.ID, 1, 1, user.ID)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := r.Start(org.ID, 1, 1, user.ID); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Start() while running error = %v, want ErrJobRunning", err)
+	}
+
+	if err := r.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	done := waitForJob(t, r, job.ID)
+	if done.Status != models.ReprocessJobCanceled || done.Processed >= 2 || done.FinishedAt == nil {
+		t.Errorf("job = %+v, want canceled before the second host", done)
+	}
+
+	// A new job can start once the canceled one has stopped
+	if _, err := r.Start(org.ID, 1, 1, user.ID); err != nil {
+		t.Errorf("Start() after cancel error = %v", err)
+	}
+	r.Stop()
+}
@@ -0,0 +1,71 @@
+package retention
+
+import (
+	"fmt"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/storage"
+)
+
+// Partitioner keeps host report history in monthly partitions
+// It creates the current and next month's partitions ahead of the reports that go in
+// them and, with a max age, drops the months that ended more than the max age ago. Report
+// history is pruned by count per host as well (see Enforcer); a month is only dropped
+// once all of its reports are past the max age. With a max age it also purges the host
+// events of hosts deleted more than the max age ago, whose last report they hold.
+type Partitioner struct {
+	store  storage.Storage
+	maxAge time.Duration // 0 keeps every month
+	dryRun bool          // Only log the cutoff instead of dropping months
+	now    func() time.Time
+}
+
+// NewPartitioner creates a partitioner for store; maxAge is HOST_REPORT_MAX_AGE
+func NewPartitioner(store storage.Storage, maxAge time.Duration, dryRun bool) *Partitioner {
+	return &Partitioner{
+		store:  store,
+		maxAge: maxAge,
+		dryRun: dryRun,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run creates the partitions of this month and the next, then drops the months past the
+// max age and the events of hosts deleted before it
+func (p *Partitioner) Run() error {
+	now := p.now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	created, err := p.store.EnsureHostReportPartitions(month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return fmt.Errorf("failed to create host report partitions: %w", err)
+	}
+	if len(created) > 0 {
+		logger.Logger.Info().Strs("partitions", created).Msg("Created host report partitions")
+	}
+
+	if p.maxAge <= 0 {
+		return nil
+	}
+	before := now.Add(-p.maxAge)
+	if p.dryRun {
+		logger.Logger.Info().Time("before", before).Msg("Dry run: not dropping host report partitions")
+		return nil
+	}
+	dropped, err := p.store.DropHostReportPartitions(before)
+	if err != nil {
+		return fmt.Errorf("failed to drop host report partitions: %w", err)
+	}
+	if len(dropped) > 0 {
+		logger.Logger.Info().Strs("partitions", dropped).Msg("Dropped host report partitions")
+	}
+
+	purged, err := p.store.PurgeDeletedHostEvents(before)
+	if err != nil {
+		return fmt.Errorf("failed to purge host events: %w", err)
+	}
+	if purged > 0 {
+		logger.Logger.Info().Int("events", purged).Msg("Purged the events of deleted hosts")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package retention enforces organizations' host report retention on a schedule.
+//
+// Ingest trims a host's history to the retention each time the host reports, so a lower
+// retention only reaches hosts as they report again, and hosts that stopped reporting
+// keep their history indefinitely. The enforcer trims every host's history to the
+// retention and deletes the hosts that have not reported for the organization's
+// delete_hosts_unseen_days. In dry-run mode it only logs what it would delete. Each host
+// deleted is recorded in the organization's audit log.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// CheckInterval is how often the enforcer applies every organization's retention
+const CheckInterval = time.Hour
+
+// Enforcer applies organizations' host report retention
+type Enforcer struct {
+	store          storage.Storage
+	defaultReports int  // Reports kept per host by organizations without a retention
+	dryRun         bool // Scheduled runs only count what they would delete
+	now            func() time.Time
+}
+
+// NewEnforcer creates an enforcer for store; defaultReports is HOST_REPORT_RETENTION
+// With dryRun, scheduled runs only log what they would delete. Enforce takes its own dryRun.
+func NewEnforcer(store storage.Storage, defaultReports int, dryRun bool) *Enforcer {
+	return &Enforcer{
+		store:          store,
+		defaultReports: defaultReports,
+		dryRun:         dryRun,
+		now:            func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// EnforceAll enforces the retention of every organization with hosts
+// An organization that fails is logged and skipped so it does not hold up the others.
+func (e *Enforcer) EnforceAll() error {
+	orgIDs, err := e.store.ListHostOrgIDs()
+	if err != nil {
+		return err
+	}
+	for _, orgID := range orgIDs {
+		run, err := e.Enforce(orgID, "", e.dryRun)
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("org_id", orgID).Msg("Failed to enforce host report retention")
+			continue
+		}
+		if run.ReportsDeleted > 0 || run.HostsDeleted > 0 {
+			logger.Logger.Info().
+				Str("org_id", orgID).
+				Bool("dry_run", run.DryRun).
+				Int("reports_deleted", run.ReportsDeleted).
+				Int("hosts_deleted", run.HostsDeleted).
+				Msg("Enforced host report retention")
+		}
+	}
+	return nil
+}
+
+// Enforce trims the organization's host histories to its retention and deletes its
+// hosts that have not reported for delete_hosts_unseen_days. actorUserID is the user who
+// asked for the run, if any. With dryRun nothing is deleted and the result counts what
+// would be. Archived hosts are kept however long they are unseen.
+func (e *Enforcer) Enforce(orgID, actorUserID string, dryRun bool) (*models.RetentionRun, error) {
+	run := &models.RetentionRun{
+		OrgID:          orgID,
+		DryRun:         dryRun,
+		ReportsPerHost: e.defaultReports,
+		HostIDs:        []string{},
+		RanAt:          e.now(),
+	}
+	retention, err := e.store.GetHostReportRetention(orgID)
+	if err == nil {
+		run.ReportsPerHost = retention.ReportsPerHost
+		run.DeleteHostsUnseenDays = retention.DeleteHostsUnseenDays
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get host report retention: %w", err)
+	}
+
+	// Hosts go first, so the reports deleted with them are not counted as trimmed as well
+	// (a dry run deletes no hosts, so it counts their excess reports in both)
+	if run.DeleteHostsUnseenDays > 0 {
+		if err := e.deleteUnseenHosts(run, actorUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		run.ReportsDeleted, err = e.store.CountExcessHostReports(orgID, run.ReportsPerHost)
+	} else {
+		run.ReportsDeleted, err = e.store.PruneHostReports(orgID, run.ReportsPerHost)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// deleteUnseenHosts deletes the unarchived hosts that last reported before the
+// organization's delete_hosts_unseen_days, or in a dry run only lists them
+func (e *Enforcer) deleteUnseenHosts(run *models.RetentionRun, actorUserID string) error {
+	hosts, err := e.store.ListHosts(run.OrgID, false)
+	if err != nil {
+		return fmt.Errorf("failed to list hosts: %w", err)
+	}
+
+	cutoff := run.RanAt.AddDate(0, 0, -run.DeleteHostsUnseenDays)
+	deletion := &models.HostDeletion{
+		Reason: models.HostDeletionRetention,
+		Note:   fmt.Sprintf("not seen for %d days", run.DeleteHostsUnseenDays),
+	}
+	for _, host := range hosts {
+		if !host.LastSeen.Before(cutoff) {
+			continue
+		}
+		if !run.DryRun {
+			err := e.store.DeleteHost(host.HostID, run.OrgID, actorUserID, deletion)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue // Deleted since it was listed
+			}
+			if err != nil {
+				return fmt.Errorf("failed to delete host %s: %w", host.HostID, err)
+			}
+			e.recordDeletion(run.OrgID, actorUserID, host, deletion)
+		}
+		run.HostIDs = append(run.HostIDs, host.HostID)
+	}
+	run.HostsDeleted = len(run.HostIDs)
+	return nil
+}
+
+// recordDeletion records a host deleted for not reporting in the audit log
+func (e *Enforcer) recordDeletion(orgID, actorUserID string, host *models.HostSummary, deletion *models.HostDeletion) {
+	event := &models.AuditEvent{
+		OrgID:       orgID,
+		ActorUserID: actorUserID,
+		Action:      models.AuditHostDeleted,
+		TargetType:  models.AuditTargetHost,
+		TargetID:    host.HostID,
+		Details: map[string]string{
+			"reason":    deletion.Reason,
+			"note":      deletion.Note,
+			"hostname":  host.Hostname,
+			"last_seen": host.LastSeen.UTC().Format(time.RFC3339),
+		},
+	}
+	if err := e.store.CreateAuditEvent(event); err != nil {
+		logger.Logger.Error().Err(err).Str("host_id", host.HostID).Msg("Failed to record audit event")
+	}
+}
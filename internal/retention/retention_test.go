@@ -0,0 +1,183 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+const (
+	testHostActive = "00000000-0000-0000-0000-000000000001"
+	testHostGone   = "00000000-0000-0000-0000-000000000002"
+)
+
+func TestEnforcer_Enforce(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	report := func(hostID string, seen time.Time) {
+		r := &models.Report{
+			ID:         hostID,
+			ReceivedAt: seen,
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: "host-" + hostID[len(hostID)-1:]},
+			Data:       json.RawMessage(`{}`),
+		}
+		require.NoError(t, store.SaveHost(r, org.ID, "user-1"))
+		require.NoError(t, store.SaveHostReport(models.NewHostReport(seen.String(), r, "user-1"), org.ID, 10))
+	}
+	for i := 5; i > 0; i-- {
+		report(testHostActive, now.Add(-time.Duration(i)*time.Hour))
+	}
+	for i := 3; i > 0; i-- {
+		report(testHostGone, now.Add(-time.Duration(40+i)*24*time.Hour))
+	}
+	require.NoError(t, store.SetHostReportRetention(&models.HostReportRetention{
+		OrgID:                 org.ID,
+		ReportsPerHost:        2,
+		DeleteHostsUnseenDays: 30,
+	}))
+
+	e := NewEnforcer(store, 10, false)
+	e.now = func() time.Time { return now }
+
+	// A dry run deletes nothing; it also counts the history of the host it would delete
+	run, err := e.Enforce(org.ID, "", true)
+	require.NoError(t, err)
+	assert.True(t, run.DryRun)
+	assert.Equal(t, 4, run.ReportsDeleted)
+	assert.Equal(t, []string{testHostGone}, run.HostIDs)
+	hosts, err := store.ListHosts(org.ID, false)
+	require.NoError(t, err)
+	assert.Len(t, hosts, 2)
+
+	run, err = e.Enforce(org.ID, "admin-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, run.ReportsDeleted, "the active host's history is trimmed to 2 reports")
+	assert.Equal(t, 1, run.HostsDeleted)
+	reports, err := store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, reports, 2)
+	_, err = store.GetHost(testHostGone, org.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	page, err := store.ListAuditEvents(org.ID, models.AuditFilter{}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, models.AuditHostDeleted, page.Events[0].Action)
+	assert.Equal(t, testHostGone, page.Events[0].TargetID)
+	assert.Equal(t, models.HostDeletionRetention, page.Events[0].Details["reason"])
+	assert.Equal(t, "admin-1", page.Events[0].ActorUserID)
+
+	// Enforcing again has nothing left to delete
+	run, err = e.Enforce(org.ID, "", false)
+	require.NoError(t, err)
+	assert.Zero(t, run.ReportsDeleted)
+	assert.Zero(t, run.HostsDeleted)
+}
+
+func TestEnforcer_EnforceAll_DryRun(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	r := &models.Report{
+		ID:         testHostActive,
+		ReceivedAt: now,
+		Meta:       models.ReportMeta{HostID: testHostActive, Hostname: "host-1"},
+		Data:       json.RawMessage(`{}`),
+	}
+	require.NoError(t, store.SaveHost(r, org.ID, "user-1"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.SaveHostReport(models.NewHostReport(string(rune('a'+i)), r, "user-1"), org.ID, 10))
+	}
+
+	// Organizations without a retention keep the server default; a dry run keeps everything
+	require.NoError(t, NewEnforcer(store, 1, true).EnforceAll())
+	reports, err := store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, reports, 3)
+
+	require.NoError(t, NewEnforcer(store, 1, false).EnforceAll())
+	reports, err = store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, reports, 1)
+}
+
+func TestPartitioner_Run(t *testing.T) {
+	store := storage.NewMockStorage()
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+	r := &models.Report{
+		ID:         testHostActive,
+		ReceivedAt: now,
+		Meta:       models.ReportMeta{HostID: testHostActive, Hostname: "host-1"},
+		Data:       json.RawMessage(`{}`),
+	}
+	require.NoError(t, store.SaveHost(r, org.ID, "user-1"))
+	for i, received := range []time.Time{
+		time.Date(2025, time.December, 31, 23, 0, 0, 0, time.UTC),
+		time.Date(2026, time.January, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, time.February, 10, 0, 0, 0, 0, time.UTC),
+	} {
+		report := models.NewHostReport(fmt.Sprintf("report-%d", i), r, "user-1")
+		report.ReceivedAt = received
+		require.NoError(t, store.SaveHostReport(report, org.ID, 10))
+	}
+	_, err = store.EnsureHostReportPartitions(time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC), now)
+	require.NoError(t, err)
+
+	// A dry run only creates the upcoming partitions
+	p := NewPartitioner(store, 45*24*time.Hour, true)
+	p.now = func() time.Time { return now }
+	require.NoError(t, p.Run())
+	created, err := store.EnsureHostReportPartitions(now, now.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	assert.Empty(t, created, "this month's and next month's partitions exist")
+	reports, err := store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, reports, 3)
+
+	// 45 days before March 15 is in January, so only December is dropped
+	p.dryRun = false
+	require.NoError(t, p.Run())
+	reports, err = store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "report-2", reports[0].ID)
+	assert.Equal(t, "report-1", reports[1].ID)
+
+	// Without a max age nothing is dropped
+	p = NewPartitioner(store, 0, false)
+	p.now = func() time.Time { return now.AddDate(5, 0, 0) }
+	require.NoError(t, p.Run())
+	reports, err = store.ListHostReports(testHostActive, org.ID)
+	require.NoError(t, err)
+	assert.Len(t, reports, 2)
+	// Hosts deleted more than the max age ago lose their events, so they cannot be restored
+	require.NoError(t, store.DeleteHost(testHostActive, org.ID, "user-1", nil))
+	require.NoError(t, p.Run())
+	_, err = store.RestoreHost(testHostActive, org.ID, "user-1")
+	require.NoError(t, err, "without a max age events are kept")
+	require.NoError(t, store.DeleteHost(testHostActive, org.ID, "user-1", nil))
+
+	p = NewPartitioner(store, 45*24*time.Hour, false)
+	p.now = func() time.Time { return time.Now().UTC().Add(46 * 24 * time.Hour) }
+	require.NoError(t, p.Run())
+	events, err := store.ListHostEvents(org.ID, testHostActive, 0, 0, false)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	_, err = store.RestoreHost(testHostActive, org.ID, "user-1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
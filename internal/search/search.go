@@ -0,0 +1,470 @@
+// Package search parses the fleet search query language used by GET /api/v1/hosts?q=.
+//
+// A query is a whitespace-separated list of terms, all of which must match:
+//
+//	os:fedora version>=40 tag:env=prod package:openssl<3.0 -hostname:db-*
+//
+// A term is field, operator, and value. A leading "-" negates the term and a
+// comma-separated value matches any of its alternatives (os:fedora,rhel). Values
+// may be double-quoted and may use "*" as a wildcard. A bare word without a field
+// matches hostnames containing it.
+//
+// Fields:
+//   - os: OS name, case-insensitive
+//   - version: OS version; ":" matches whole leading segments (version:22 matches
+//     22.04), and =, !=, <, <=, >, >= compare versions segment by segment
+//   - hostname (host): hostname, case-insensitive
+//   - id: host ID
+//   - tag: an attached tag; tag:env=prod also matches the tag "env:prod"
+//   - package (pkg): an installed package by name, optionally with a version
+//     constraint (package:openssl<3.0)
+//   - health: the health status from the host's last report (ok, warning,
+//     critical, unknown); hosts whose agent reports no health match none
+//   - section: a top-level data section of the host's last report (section:docker),
+//     case-sensitive
+//   - status: active, or stale for hosts that missed their check-in window
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"snailbus/internal/models"
+)
+
+// Fields that terms can match against
+const (
+	FieldText     = "text" // Bare words, matched as a hostname substring
+	FieldOS       = "os"
+	FieldVersion  = "version"
+	FieldHostname = "hostname"
+	FieldID       = "id"
+	FieldTag      = "tag"
+	FieldPackage  = "package"
+	FieldHealth   = "health"
+	FieldSection  = "section"
+	FieldStatus   = "status"
+)
+
+// fieldAliases maps every accepted field name to its canonical field
+var fieldAliases = map[string]string{
+	"os":       FieldOS,
+	"version":  FieldVersion,
+	"hostname": FieldHostname,
+	"host":     FieldHostname,
+	"id":       FieldID,
+	"tag":      FieldTag,
+	"package":  FieldPackage,
+	"pkg":      FieldPackage,
+	"health":   FieldHealth,
+	"section":  FieldSection,
+	"status":   FieldStatus,
+}
+
+// Operators, longest first so that "<=" is not read as "<"
+const (
+	OpMatch = ":"
+	OpEq    = "="
+	OpNe    = "!="
+	OpLe    = "<="
+	OpGe    = ">="
+	OpLt    = "<"
+	OpGt    = ">"
+)
+
+var operators = []string{OpNe, OpLe, OpGe, OpMatch, OpEq, OpLt, OpGt}
+
+// versionOperators are the operators allowed in version comparisons
+var versionOperators = []string{OpNe, OpLe, OpGe, OpEq, OpLt, OpGt}
+
+// Query is a parsed search query; a host matches when every term matches
+type Query struct {
+	Terms []Term
+}
+
+// Term is a single condition on one field
+type Term struct {
+	Field  string
+	Op     string
+	Values []Value // Alternatives; the term matches if any of them does
+	Negate bool
+}
+
+// Value is one alternative of a term
+type Value struct {
+	Pattern string // Text to match; may contain "*" wildcards except in version comparisons
+
+	// Package version constraint (package:openssl<3.0); empty when any version matches
+	VersionOp string
+	Version   string
+}
+
+// Package is an installed package as reported by snail-core
+type Package struct {
+	Name    string
+	Version string
+}
+
+// Host is what a query is evaluated against
+type Host struct {
+	Summary  *models.HostSummary
+	Packages []Package
+}
+
+// Error describes why a query could not be parsed
+type Error struct {
+	Pos int // Byte offset of the offending term
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Msg, e.Pos)
+}
+
+// SectionTerm returns the term for GET /api/v1/hosts?has_section=, matching hosts whose
+// last report has one of the comma-separated data sections
+func SectionTerm(sections string) (Term, error) {
+	term := Term{Field: FieldSection, Op: OpMatch}
+	for _, section := range strings.Split(sections, ",") {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			return Term{}, fmt.Errorf("empty section name in %q", sections)
+		}
+		term.Values = append(term.Values, Value{Pattern: section})
+	}
+	return term, nil
+}
+
+// StatusTerm returns the term for GET /api/v1/hosts?status=, matching hosts with one of
+// the comma-separated statuses
+func StatusTerm(statuses string) (Term, error) {
+	term := Term{Field: FieldStatus, Op: OpMatch}
+	for _, status := range strings.Split(statuses, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if !slices.Contains(models.HostStatuses, status) {
+			return Term{}, fmt.Errorf("unknown status %q; must be one of %s", status, strings.Join(models.HostStatuses, ", "))
+		}
+		term.Values = append(term.Values, Value{Pattern: status})
+	}
+	return term, nil
+}
+
+// Parse parses a query string; an empty string parses to a query matching every host
+func Parse(input string) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{Terms: make([]Term, 0, len(tokens))}
+	for _, tok := range tokens {
+		term, err := parseTerm(tok)
+		if err != nil {
+			return nil, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	return query, nil
+}
+
+// token is a whitespace-separated word with quotes removed
+type token struct {
+	pos    int
+	text   string
+	quoted []bool // Whether each byte of text came from inside quotes
+}
+
+// tokenize splits input on unquoted whitespace
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	var cur *token
+	inQuotes := false
+	quoteStart := 0
+
+	for i, r := range input {
+		switch {
+		case r == '"':
+			if cur == nil {
+				cur = &token{pos: i}
+			}
+			inQuotes = !inQuotes
+			quoteStart = i
+		case unicode.IsSpace(r) && !inQuotes:
+			if cur != nil {
+				tokens = append(tokens, *cur)
+				cur = nil
+			}
+		default:
+			if cur == nil {
+				cur = &token{pos: i}
+			}
+			s := string(r)
+			cur.text += s
+			for range len(s) {
+				cur.quoted = append(cur.quoted, inQuotes)
+			}
+		}
+	}
+	if inQuotes {
+		return nil, &Error{Pos: quoteStart, Msg: "unterminated quote"}
+	}
+	if cur != nil {
+		tokens = append(tokens, *cur)
+	}
+	return tokens, nil
+}
+
+// parseTerm parses a single token into a term
+func parseTerm(tok token) (Term, error) {
+	text, quoted := tok.text, tok.quoted
+	term := Term{}
+
+	if strings.HasPrefix(text, "-") && !quoted[0] {
+		term.Negate = true
+		text, quoted = text[1:], quoted[1:]
+	}
+	if text == "" {
+		return term, &Error{Pos: tok.pos, Msg: "empty term"}
+	}
+
+	// The field name is the leading run of unquoted letters, followed by an operator
+	name := 0
+	for name < len(text) && !quoted[name] && (isLetter(text[name]) || text[name] == '_') {
+		name++
+	}
+	op := ""
+	if name > 0 {
+		for _, candidate := range operators {
+			if strings.HasPrefix(text[name:], candidate) && !quoted[name] {
+				op = candidate
+				break
+			}
+		}
+	}
+
+	if op == "" {
+		// Bare word
+		term.Field = FieldText
+		term.Op = OpMatch
+		term.Values = []Value{{Pattern: text}}
+		return term, nil
+	}
+
+	field, ok := fieldAliases[strings.ToLower(text[:name])]
+	if !ok {
+		return term, &Error{Pos: tok.pos, Msg: fmt.Sprintf("unknown field %q", text[:name])}
+	}
+	term.Field = field
+	term.Op = op
+
+	if op != OpMatch && op != OpEq && field != FieldVersion {
+		return term, &Error{Pos: tok.pos, Msg: fmt.Sprintf("operator %q is only supported for version", op)}
+	}
+	if op == OpEq && field != FieldVersion {
+		// "=" is an alias for ":" on text fields
+		term.Op = OpMatch
+	}
+
+	rest, restQuoted := text[name+len(op):], quoted[name+len(op):]
+	for _, alt := range splitUnquoted(rest, restQuoted, ',') {
+		value, err := parseValue(field, alt.text, alt.quoted)
+		if err != nil {
+			return term, &Error{Pos: tok.pos, Msg: err.Error()}
+		}
+		term.Values = append(term.Values, value)
+	}
+	return term, nil
+}
+
+// parseValue parses one alternative of a term's value
+func parseValue(field, text string, quoted []bool) (Value, error) {
+	if text == "" {
+		return Value{}, fmt.Errorf("missing value for %s", field)
+	}
+
+	switch field {
+	case FieldVersion:
+		if strings.Contains(text, "*") {
+			return Value{}, fmt.Errorf("wildcards are not supported in versions")
+		}
+	case FieldPackage:
+		// Split "name<version" at the first unquoted comparison operator
+		for i := 0; i < len(text); i++ {
+			if quoted[i] || !strings.ContainsRune("<>=!", rune(text[i])) {
+				continue
+			}
+			for _, op := range versionOperators {
+				if strings.HasPrefix(text[i:], op) {
+					name, version := text[:i], text[i+len(op):]
+					if name == "" || version == "" {
+						return Value{}, fmt.Errorf("package constraints need a name and a version (e.g. openssl<3.0)")
+					}
+					return Value{Pattern: name, VersionOp: op, Version: version}, nil
+				}
+			}
+			return Value{}, fmt.Errorf("invalid package constraint %q", text)
+		}
+	}
+	return Value{Pattern: text}, nil
+}
+
+type part struct {
+	text   string
+	quoted []bool
+}
+
+// splitUnquoted splits text on unquoted occurrences of sep
+func splitUnquoted(text string, quoted []bool, sep byte) []part {
+	var parts []part
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == sep && !quoted[i] {
+			parts = append(parts, part{text[start:i], quoted[start:i]})
+			start = i + 1
+		}
+	}
+	return append(parts, part{text[start:], quoted[start:]})
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// NeedsPackages reports whether evaluating the query requires package data
+func (q *Query) NeedsPackages() bool {
+	for _, term := range q.Terms {
+		if term.Field == FieldPackage {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether host satisfies every term of the query
+func (q *Query) Match(host Host) bool {
+	for _, term := range q.Terms {
+		if term.match(host) == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether any alternative of the term matches, ignoring negation
+func (t Term) match(host Host) bool {
+	for _, value := range t.Values {
+		if t.matchValue(host, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Term) matchValue(host Host, value Value) bool {
+	summary := host.Summary
+	switch t.Field {
+	case FieldText:
+		return strings.Contains(strings.ToLower(summary.Hostname), strings.ToLower(value.Pattern))
+	case FieldOS:
+		return Glob(strings.ToLower(value.Pattern), strings.ToLower(summary.OSName))
+	case FieldHostname:
+		return Glob(strings.ToLower(value.Pattern), strings.ToLower(summary.Hostname))
+	case FieldID:
+		return Glob(strings.ToLower(value.Pattern), strings.ToLower(summary.HostID))
+	case FieldHealth:
+		if summary.Health == nil {
+			return false
+		}
+		return Glob(strings.ToLower(value.Pattern), summary.Health.Status)
+	case FieldStatus:
+		return Glob(strings.ToLower(value.Pattern), summary.Status)
+	case FieldSection:
+		for _, section := range summary.Sections {
+			if Glob(value.Pattern, section) {
+				return true
+			}
+		}
+		return false
+	case FieldVersion:
+		if summary.OSVersion == "" {
+			return false
+		}
+		if t.Op == OpMatch {
+			return VersionHasPrefix(summary.OSVersion, value.Pattern)
+		}
+		return compare(summary.OSVersion, t.Op, value.Pattern)
+	case FieldTag:
+		for _, tag := range summary.Tags {
+			if matchTag(value.Pattern, tag) {
+				return true
+			}
+		}
+		return false
+	case FieldPackage:
+		for _, pkg := range host.Packages {
+			if !Glob(strings.ToLower(value.Pattern), strings.ToLower(pkg.Name)) {
+				continue
+			}
+			if value.VersionOp == "" || compare(pkg.Version, value.VersionOp, value.Version) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// matchTag matches a tag pattern; "key=value" patterns also match "key:value" tags
+func matchTag(pattern, tag string) bool {
+	if Glob(pattern, tag) {
+		return true
+	}
+	if key, value, ok := strings.Cut(pattern, "="); ok {
+		return Glob(key+":"+value, tag)
+	}
+	return false
+}
+
+// compare applies a version comparison operator to version and target
+func compare(version, op, target string) bool {
+	c := CompareVersions(version, target)
+	switch op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGe:
+		return c >= 0
+	}
+	return false
+}
+
+// Glob reports whether s matches pattern, where "*" matches any run of characters
+func Glob(pattern, s string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == s
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return strings.HasSuffix(s, last) && len(s) >= len(last)
+}
@@ -0,0 +1,239 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`os:fedora version>=40 tag:env=prod package:openssl<3.0 -hostname:db-* web`)
+	require.NoError(t, err)
+	assert.Equal(t, []Term{
+		{Field: FieldOS, Op: OpMatch, Values: []Value{{Pattern: "fedora"}}},
+		{Field: FieldVersion, Op: OpGe, Values: []Value{{Pattern: "40"}}},
+		{Field: FieldTag, Op: OpMatch, Values: []Value{{Pattern: "env=prod"}}},
+		{Field: FieldPackage, Op: OpMatch, Values: []Value{{Pattern: "openssl", VersionOp: OpLt, Version: "3.0"}}},
+		{Field: FieldHostname, Op: OpMatch, Values: []Value{{Pattern: "db-*"}}, Negate: true},
+		{Field: FieldText, Op: OpMatch, Values: []Value{{Pattern: "web"}}},
+	}, q.Terms)
+	assert.True(t, q.NeedsPackages())
+}
+
+func TestParse_Syntax(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Term
+	}{
+		{"os:fedora,rhel", Term{Field: FieldOS, Op: OpMatch, Values: []Value{{Pattern: "fedora"}, {Pattern: "rhel"}}}},
+		{"OS=Fedora", Term{Field: FieldOS, Op: OpMatch, Values: []Value{{Pattern: "Fedora"}}}},
+		{"host:web-01", Term{Field: FieldHostname, Op: OpMatch, Values: []Value{{Pattern: "web-01"}}}},
+		{"pkg:kernel", Term{Field: FieldPackage, Op: OpMatch, Values: []Value{{Pattern: "kernel"}}}},
+		{"package:openssl>=3.0.7-1,libssl!=1.1", Term{Field: FieldPackage, Op: OpMatch, Values: []Value{
+			{Pattern: "openssl", VersionOp: OpGe, Version: "3.0.7-1"},
+			{Pattern: "libssl", VersionOp: OpNe, Version: "1.1"},
+		}}},
+		{"version!=22.04", Term{Field: FieldVersion, Op: OpNe, Values: []Value{{Pattern: "22.04"}}}},
+		{"version<=9", Term{Field: FieldVersion, Op: OpLe, Values: []Value{{Pattern: "9"}}}},
+		{`tag:"team:web, ops"`, Term{Field: FieldTag, Op: OpMatch, Values: []Value{{Pattern: "team:web, ops"}}}},
+		{`"os:fedora"`, Term{Field: FieldText, Op: OpMatch, Values: []Value{{Pattern: "os:fedora"}}}},
+		{"-tag:decommissioned", Term{Field: FieldTag, Op: OpMatch, Values: []Value{{Pattern: "decommissioned"}}, Negate: true}},
+		{"web-01", Term{Field: FieldText, Op: OpMatch, Values: []Value{{Pattern: "web-01"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := Parse(tt.input)
+			require.NoError(t, err)
+			require.Len(t, q.Terms, 1)
+			assert.Equal(t, tt.want, q.Terms[0])
+		})
+	}
+
+	q, err := Parse("   ")
+	require.NoError(t, err)
+	assert.Empty(t, q.Terms)
+	assert.False(t, q.NeedsPackages())
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"color:red", `unknown field "color"`},
+		{"os>fedora", `operator ">" is only supported for version`},
+		{"tag:", "missing value for tag"},
+		{"os:fedora,", "missing value for os"},
+		{"version>=4*", "wildcards are not supported in versions"},
+		{"package:<3.0", "package constraints need a name and a version"},
+		{"package:openssl<", "package constraints need a name and a version"},
+		{"package:openssl!3", `invalid package constraint "openssl!3"`},
+		{`hostname:"web`, "unterminated quote"},
+		{"os:fedora -", "empty term"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			require.Error(t, err)
+			var parseErr *Error
+			require.ErrorAs(t, err, &parseErr)
+			assert.Contains(t, parseErr.Msg, tt.msg)
+		})
+	}
+
+	_, err := Parse("os:fedora bogus:1")
+	assert.EqualError(t, err, `unknown field "bogus" (at position 10)`)
+}
+
+func TestQuery_Match(t *testing.T) {
+	host := Host{
+		Summary: &models.HostSummary{
+			HostID:    "7f1c0f6e-0000-0000-0000-000000000001",
+			Hostname:  "web-01.example.com",
+			OSName:    "Fedora",
+			OSVersion: "40",
+			Tags:      []string{"env:prod", "team:web"},
+			Health:    &models.HostHealth{Status: models.HealthCritical},
+			Sections:  []string{"docker", "network", "packages"},
+			Status:    models.HostStatusStale,
+		},
+		Packages: []Package{
+			{Name: "openssl", Version: "3.0.9-1.fc40"},
+			{Name: "kernel", Version: "6.8.5-301.fc40"},
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"os:fedora", true},
+		{"os:FEDORA,debian", true},
+		{"os:debian", false},
+		{"-os:debian", true},
+		{"os:fed*", true},
+		{"version:40", true},
+		{"version>=40", true},
+		{"version>40", false},
+		{"version<41", true},
+		{"version=40.0", false},
+		{"version!=39", true},
+		{"hostname:web-*", true},
+		{"hostname:*.example.com", true},
+		{"hostname:db-*", false},
+		{"-hostname:db-*", true},
+		{"web-01", true},
+		{"EXAMPLE", true},
+		{"db", false},
+		{"id:7f1c0f6e-*", true},
+		{"tag:env=prod", true},
+		{"tag:env:prod", true},
+		{"tag:env=staging", false},
+		{"tag:team:*", true},
+		{"-tag:team:web", false},
+		{"package:openssl", true},
+		{"package:openssl<3.0", false},
+		{"package:openssl<3.1", true},
+		{"package:openssl>=3.0.9", true},
+		{"package:openssl=3.0.9-1.fc40", true},
+		{"pkg:kern*>6", true},
+		{"package:nginx", false},
+		{"-package:nginx", true},
+		{"health:critical", true},
+		{"health:Warning,CRITICAL", true},
+		{"health:ok", false},
+		{"-health:ok", true},
+		{"section:docker", true},
+		{"section:podman,docker", true},
+		{"section:Docker", false},
+		{"section:net*", true},
+		{"-section:podman", true},
+		{"status:stale", true},
+		{"status:Active", false},
+		{"-status:active", true},
+		{"os:fedora version>=40 tag:env=prod package:openssl<3.1", true},
+		{"os:fedora version>=40 tag:env=prod package:openssl<3.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, q.Match(host))
+		})
+	}
+
+	// Hosts without an OS version never match version terms
+	unknown := Host{Summary: &models.HostSummary{Hostname: "bare"}}
+	q, _ := Parse("version<100")
+	assert.False(t, q.Match(unknown))
+
+	// Hosts that report no health match no health status
+	q, _ = Parse("health:*")
+	assert.False(t, q.Match(unknown))
+}
+
+func TestSectionTerm(t *testing.T) {
+	term, err := SectionTerm("docker, podman")
+	require.NoError(t, err)
+	assert.Equal(t, Term{Field: FieldSection, Op: OpMatch, Values: []Value{{Pattern: "docker"}, {Pattern: "podman"}}}, term)
+
+	_, err = SectionTerm("docker,")
+	assert.Error(t, err)
+	_, err = SectionTerm("")
+	assert.Error(t, err)
+}
+
+func TestStatusTerm(t *testing.T) {
+	term, err := StatusTerm("Stale, active")
+	require.NoError(t, err)
+	assert.Equal(t, Term{Field: FieldStatus, Op: OpMatch, Values: []Value{{Pattern: "stale"}, {Pattern: "active"}}}, term)
+
+	_, err = StatusTerm("offline")
+	assert.Error(t, err)
+	_, err = StatusTerm("stale,")
+	assert.Error(t, err)
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"40", "40", 0},
+		{"40", "41", -1},
+		{"10", "9", 1},
+		{"3.0", "3.0.9-1.fc40", -1},
+		{"3.0.9-1.fc40", "3.1", -1},
+		{"22.04", "22.04", 0},
+		{"1.01", "1.1", 0},
+		{"1.0a", "1.0.1", -1},
+		{"2.0rc1", "2.0rc2", -1},
+		{"18446744073709551616", "18446744073709551615", 1},
+		{"", "1", -1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CompareVersions(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, CompareVersions(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+
+	assert.True(t, VersionHasPrefix("22.04.3", "22"))
+	assert.True(t, VersionHasPrefix("22.04.3", "22.04"))
+	assert.False(t, VersionHasPrefix("2.2", "22"))
+	assert.False(t, VersionHasPrefix("22", "22.04"))
+	assert.False(t, VersionHasPrefix("22", ""))
+}
+
+func TestGlob(t *testing.T) {
+	assert.True(t, Glob("web", "web"))
+	assert.False(t, Glob("web", "web-01"))
+	assert.True(t, Glob("web*", "web-01"))
+	assert.True(t, Glob("*01", "web-01"))
+	assert.True(t, Glob("w*-*1", "web-01"))
+	assert.True(t, Glob("*", ""))
+	assert.False(t, Glob("ab*ba", "aba"))
+	assert.False(t, Glob("w*x*1", "web-01"))
+}
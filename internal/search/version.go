@@ -0,0 +1,85 @@
+package search
+
+import "strings"
+
+// CompareVersions compares two version strings segment by segment, returning
+// -1, 0, or 1. Versions are split into runs of digits and runs of letters;
+// other characters only separate segments. Numeric segments compare as numbers
+// and sort after alphabetic ones, and a version with extra segments sorts after
+// its prefix, so 3.0 < 3.0.9-1.fc40 < 3.1.
+func CompareVersions(a, b string) int {
+	as, bs := versionSegments(a), versionSegments(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareSegments(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// VersionHasPrefix reports whether the segments of prefix are the leading segments of version
+func VersionHasPrefix(version, prefix string) bool {
+	vs, ps := versionSegments(version), versionSegments(prefix)
+	if len(ps) == 0 || len(ps) > len(vs) {
+		return false
+	}
+	for i := range ps {
+		if compareSegments(vs[i], ps[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// versionSegments splits a version into runs of digits and runs of letters
+func versionSegments(version string) []string {
+	var segments []string
+	start := -1
+	for i := 0; i <= len(version); i++ {
+		if start >= 0 && (i == len(version) || kind(version[i]) != kind(version[start])) {
+			segments = append(segments, version[start:i])
+			start = -1
+		}
+		if i < len(version) && start < 0 && kind(version[i]) != 0 {
+			start = i
+		}
+	}
+	return segments
+}
+
+// kind classifies a byte as a digit (1), a letter (2), or a separator (0)
+func kind(b byte) int {
+	switch {
+	case b >= '0' && b <= '9':
+		return 1
+	case isLetter(b):
+		return 2
+	}
+	return 0
+}
+
+func compareSegments(a, b string) int {
+	aNum, bNum := kind(a[0]) == 1, kind(b[0]) == 1
+	switch {
+	case aNum && !bNum:
+		return 1
+	case !aNum && bNum:
+		return -1
+	case aNum && bNum:
+		// Compare as numbers without overflow: drop leading zeros, then longer is larger
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
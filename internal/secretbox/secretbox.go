@@ -0,0 +1,301 @@
+// Package secretbox encrypts secrets stored in the database with envelope encryption.
+//
+// Each value is encrypted with AES-256-GCM under a fresh random data key, and the data
+// key is wrapped by a master key. The stored value carries the ID of the master key
+// and the wrapped data key, so master keys can be rotated: values are always sealed
+// with the primary key, and open with any key the KeyWrapper still knows. Keys loads
+// master keys from a file; a KMS can stand in by implementing KeyWrapper.
+//
+// Values without the sealed prefix are returned unchanged by Open, so rows written
+// before encryption was enabled keep working until they are re-encrypted.
+package secretbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Prefix marks sealed values; the version allows the format to evolve
+const Prefix = "snailbus:enc:v1:"
+
+// KeySize is the length of master and data keys (AES-256)
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a value was sealed with a master key that is not loaded
+	ErrUnknownKey = errors.New("secret was encrypted with an unknown key")
+	// ErrNoKeys is returned when opening a sealed value without encryption configured
+	ErrNoKeys = errors.New("secret is encrypted but no encryption keys are configured")
+	// ErrMalformed is returned for sealed values that cannot be parsed or authenticated
+	ErrMalformed = errors.New("malformed encrypted secret")
+)
+
+// keyIDPattern restricts key IDs to characters that cannot clash with the ":" separator
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// KeyWrapper encrypts and decrypts data keys with master keys
+type KeyWrapper interface {
+	// PrimaryKeyID identifies the master key new values are sealed with
+	PrimaryKeyID() string
+	// Wrap encrypts a data key with the primary master key
+	Wrap(dataKey []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped by the master key keyID, returning
+	// ErrUnknownKey if that key is not available
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Box seals and opens secrets. A nil Box leaves new values in plaintext and
+// fails to open sealed ones with ErrNoKeys.
+type Box struct {
+	keys KeyWrapper
+}
+
+// New creates a box sealing with the wrapper's primary key
+func New(keys KeyWrapper) *Box {
+	return &Box{keys: keys}
+}
+
+// IsSealed reports whether a stored value is encrypted
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// KeyID returns the master key a sealed value was encrypted with, or "" for plaintext
+func KeyID(value string) string {
+	if !IsSealed(value) {
+		return ""
+	}
+	keyID, _, _ := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	return keyID
+}
+
+// Enabled reports whether the box encrypts new values
+func (b *Box) Enabled() bool {
+	return b != nil && b.keys != nil
+}
+
+// Seal encrypts a secret. Empty values stay empty, so "no secret" checks keep working.
+func (b *Box) Seal(plaintext string) (string, error) {
+	if !b.Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := b.keys.Wrap(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	keyID := b.keys.PrimaryKeyID()
+	ciphertext, err := seal(dataKey, []byte(plaintext), []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return Prefix + keyID + ":" + encode(wrapped) + ":" + encode(ciphertext), nil
+}
+
+// Open decrypts a sealed secret, returning plaintext values unchanged
+func (b *Box) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if !b.Enabled() {
+		return "", ErrNoKeys
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	keyID := parts[0]
+	wrapped, err := decode(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := decode(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := b.keys.Unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReseal reports whether a stored value should be re-encrypted: it is plaintext,
+// or sealed with a key other than the primary one
+func (b *Box) NeedsReseal(value string) bool {
+	if !b.Enabled() || value == "" {
+		return false
+	}
+	return KeyID(value) != b.keys.PrimaryKeyID()
+}
+
+// Reseal re-encrypts a stored value with the primary key
+func (b *Box) Reseal(value string) (string, error) {
+	plaintext, err := b.Open(value)
+	if err != nil {
+		return "", err
+	}
+	return b.Seal(plaintext)
+}
+
+// Keys are master keys held in memory, the first being the primary one
+type Keys struct {
+	order []string
+	keys  map[string][]byte
+}
+
+// NewKeys creates a key set from key IDs and 32-byte keys; the first key is the primary one
+func NewKeys(ids []string, keys [][]byte) (*Keys, error) {
+	if len(ids) == 0 || len(ids) != len(keys) {
+		return nil, fmt.Errorf("at least one key is required, with one ID per key")
+	}
+	k := &Keys{keys: make(map[string][]byte, len(ids))}
+	for i, id := range ids {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("key ID %q must be 1-64 letters, digits, '-' or '_'", id)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		if len(keys[i]) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes (got %d)", id, KeySize, len(keys[i]))
+		}
+		k.order = append(k.order, id)
+		k.keys[id] = keys[i]
+	}
+	return k, nil
+}
+
+// ParseKeys reads master keys, one "<key-id> <base64 key>" per line. Blank lines and
+// lines starting with # are ignored. The first key is the primary one.
+func ParseKeys(r io.Reader) (*Keys, error) {
+	var ids []string
+	var keys [][]byte
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<key-id> <base64 key>\"", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key must be valid base64: %w", line, err)
+		}
+		ids = append(ids, fields[0])
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewKeys(ids, keys)
+}
+
+// LoadKeyFile reads master keys from a file in the ParseKeys format
+func LoadKeyFile(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	keys, err := ParseKeys(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// PrimaryKeyID returns the ID of the first key
+func (k *Keys) PrimaryKeyID() string {
+	return k.order[0]
+}
+
+// KeyIDs returns the IDs of all keys, primary first
+func (k *Keys) KeyIDs() []string {
+	return append([]string(nil), k.order...)
+}
+
+// Wrap encrypts a data key with the primary key
+func (k *Keys) Wrap(dataKey []byte) ([]byte, error) {
+	id := k.PrimaryKeyID()
+	return seal(k.keys[id], dataKey, []byte(id))
+}
+
+// Unwrap decrypts a data key wrapped by the key keyID
+func (k *Keys) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
+
+// seal encrypts with AES-256-GCM, prepending the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,119 @@
+package secretbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeys creates keys with the given IDs, each filled with the last byte of its ID
+func testKeys(t *testing.T, ids ...string) *Keys {
+	t.Helper()
+	keys := make([][]byte, len(ids))
+	for i, id := range ids {
+		keys[i] = bytes.Repeat([]byte{id[len(id)-1]}, KeySize)
+	}
+	k, err := NewKeys(ids, keys)
+	require.NoError(t, err)
+	return k
+}
+
+func TestBox_SealAndOpen(t *testing.T) {
+	box := New(testKeys(t, "k1"))
+
+	sealed, err := box.Seal("s3cret")
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.Equal(t, "k1", KeyID(sealed))
+	assert.NotContains(t, sealed, "s3cret")
+
+	again, err := box.Seal("s3cret")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "each value gets its own data key and nonce")
+
+	opened, err := box.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", opened)
+
+	// Empty and plaintext values pass through
+	empty, err := box.Seal("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+	plain, err := box.Open("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", plain)
+	assert.Equal(t, "", KeyID("legacy"))
+
+	// Tampering is detected
+	tampered := sealed[:len(sealed)-2] + "AA"
+	_, err = box.Open(tampered)
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = box.Open(Prefix + "k1:nope")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestBox_Nil(t *testing.T) {
+	var box *Box
+	assert.False(t, box.Enabled())
+
+	value, err := box.Seal("s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", value, "without keys values are stored as is")
+	assert.False(t, box.NeedsReseal(value))
+
+	sealed, err := New(testKeys(t, "k1")).Seal("s3cret")
+	require.NoError(t, err)
+	_, err = box.Open(sealed)
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
+
+func TestBox_Rotation(t *testing.T) {
+	old := New(testKeys(t, "k1"))
+	sealed, err := old.Seal("s3cret")
+	require.NoError(t, err)
+
+	// k2 becomes primary, k1 is kept to open existing values
+	rotated := New(testKeys(t, "k2", "k1"))
+	assert.True(t, rotated.NeedsReseal(sealed))
+	assert.True(t, rotated.NeedsReseal("legacy"))
+	assert.False(t, rotated.NeedsReseal(""))
+
+	resealed, err := rotated.Reseal(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", KeyID(resealed))
+	assert.False(t, rotated.NeedsReseal(resealed))
+	opened, err := rotated.Open(resealed)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", opened)
+
+	// Once k1 is dropped, values still sealed with it can't be opened
+	_, err = New(testKeys(t, "k2")).Open(sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(strings.NewReader(`
+# primary
+2026-10 AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=
+2026-01 AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", keys.PrimaryKeyID())
+	assert.Equal(t, []string{"2026-10", "2026-01"}, keys.KeyIDs())
+
+	invalid := []string{
+		"",
+		"k1",
+		"k1 not-base64!",
+		"k1 AQEB",
+		"bad:id AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=",
+		"k1 AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\nk1 AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=",
+	}
+	for _, input := range invalid {
+		_, err := ParseKeys(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,420 @@
+// Package specvalidate checks requests against the operations of the OpenAPI spec.
+//
+// The spec is the Swagger 2.0 document generated by swag from the handler
+// annotations. New indexes its operations by method and path; Validate checks
+// the query, path, and header parameters of one request and its JSON body
+// against the documented schema, and reports the first field that violates it.
+// Only the constraints swag emits are checked: required, type, enum, string
+// length, numeric range, and the properties and items of body schemas.
+package specvalidate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Error reports the first part of a request that does not match the spec
+type Error struct {
+	Field   string // Location of the violation, e.g. "body.role", "query.limit", "path.host_id"
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Request is the part of an HTTP request that is validated
+type Request struct {
+	Method     string
+	Path       string // Route path, with ":name" or "{name}" parameters
+	Query      url.Values
+	Header     http.Header
+	PathParams map[string]string // Values of the path parameters by name
+	Body       []byte            // JSON body; nil when absent or not validated
+}
+
+// Validator checks requests against the operations of one spec
+type Validator struct {
+	definitions map[string]interface{}
+	operations  map[string]*operation
+}
+
+type operation struct {
+	params []map[string]interface{} // Non-body parameters
+	body   map[string]interface{}   // Body parameter, if the operation has one
+}
+
+// specMethods are the path item keys that describe operations
+var specMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// New indexes the operations of a decoded Swagger 2.0 spec
+func New(spec map[string]interface{}) (*Validator, error) {
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("spec has no paths object")
+	}
+	basePath, _ := spec["basePath"].(string)
+	basePath = strings.TrimSuffix(basePath, "/")
+	definitions, _ := spec["definitions"].(map[string]interface{})
+
+	v := &Validator{definitions: definitions, operations: make(map[string]*operation)}
+	for path, item := range paths {
+		operations, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Parameters on the path item apply to all of its operations
+		shared, _ := operations["parameters"].([]interface{})
+		for method, op := range operations {
+			if !specMethods[strings.ToLower(method)] {
+				continue
+			}
+			opMap, _ := op.(map[string]interface{})
+			params, _ := opMap["parameters"].([]interface{})
+			v.operations[operationKey(method, basePath+path)] = newOperation(append(append([]interface{}{}, shared...), params...))
+		}
+	}
+	return v, nil
+}
+
+func newOperation(params []interface{}) *operation {
+	op := &operation{}
+	for _, p := range params {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch param["in"] {
+		case "body":
+			op.body = param
+		case "query", "path", "header":
+			op.params = append(op.params, param)
+		}
+		// formData parameters are multipart uploads, left to their handlers
+	}
+	return op
+}
+
+// operationKey normalizes a method and path for lookup
+// Router parameters (":id", "*rest") and spec parameters ("{id}") all become "{}"
+func operationKey(method, path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") ||
+			(strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")) {
+			segments[i] = "{}"
+		}
+	}
+	return strings.ToUpper(method) + " " + strings.Join(segments, "/")
+}
+
+// HasBody reports whether the operation documents a request body
+func (v *Validator) HasBody(method, path string) bool {
+	op, ok := v.operations[operationKey(method, path)]
+	return ok && op.body != nil
+}
+
+// Validate checks a request against its documented operation
+// Requests for undocumented operations are not checked.
+func (v *Validator) Validate(req Request) *Error {
+	op, ok := v.operations[operationKey(req.Method, req.Path)]
+	if !ok {
+		return nil
+	}
+
+	for _, param := range op.params {
+		if err := v.checkParam(param, req); err != nil {
+			return err
+		}
+	}
+
+	if op.body == nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(req.Body)) == 0 {
+		if required, _ := op.body["required"].(bool); required && req.Body != nil {
+			return &Error{Field: "body", Message: "request body is required"}
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(req.Body))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		// Malformed JSON is reported by the handler, with its own message
+		return nil
+	}
+	schema, _ := op.body["schema"].(map[string]interface{})
+	return v.checkValue(schema, body, "body", 0)
+}
+
+func (v *Validator) checkParam(param map[string]interface{}, req Request) *Error {
+	name, _ := param["name"].(string)
+	in, _ := param["in"].(string)
+	field := in + "." + name
+
+	var values []string
+	switch in {
+	case "query":
+		values = req.Query[name]
+	case "path":
+		if value, ok := req.PathParams[name]; ok {
+			values = []string{value}
+		}
+	case "header":
+		values = req.Header.Values(name)
+	}
+
+	if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+		if required, _ := param["required"].(bool); required {
+			return &Error{Field: field, Message: "is required"}
+		}
+		return nil
+	}
+
+	if param["type"] == "array" {
+		items, _ := param["items"].(map[string]interface{})
+		if format, _ := param["collectionFormat"].(string); format != "multi" {
+			values = strings.Split(values[0], collectionSeparator(format))
+		}
+		for i, value := range values {
+			if err := checkString(items, value, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkString(param, values[0], field)
+}
+
+func collectionSeparator(format string) string {
+	switch format {
+	case "ssv":
+		return " "
+	case "tsv":
+		return "\t"
+	case "pipes":
+		return "|"
+	default:
+		return ","
+	}
+}
+
+// checkString checks a parameter value, which arrives as text, against its declared type
+func checkString(schema map[string]interface{}, value, field string) *Error {
+	if schema == nil {
+		return nil
+	}
+	var typed interface{} = value
+	switch schema["type"] {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return &Error{Field: field, Message: "must be an integer"}
+		}
+		typed = json.Number(value)
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return &Error{Field: field, Message: "must be a number"}
+		}
+		typed = json.Number(value)
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return &Error{Field: field, Message: "must be true or false"}
+		}
+		typed = b
+	}
+	return checkConstraints(schema, typed, field)
+}
+
+// maxDepth bounds $ref recursion for self-referencing definitions
+const maxDepth = 32
+
+func (v *Validator) checkValue(schema map[string]interface{}, value interface{}, field string, depth int) *Error {
+	if schema == nil || depth > maxDepth {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		return v.checkValue(v.resolve(ref), value, field, depth+1)
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			sub, _ := s.(map[string]interface{})
+			if err := v.checkValue(sub, value, field, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	// Optional fields are pointers in the request models, so null is always accepted
+	if value == nil {
+		return nil
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return &Error{Field: field, Message: "must be an object"}
+		}
+		return v.checkObject(schema, object, field, depth)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return &Error{Field: field, Message: "must be an array"}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			if err := v.checkValue(items, item, fmt.Sprintf("%s[%d]", field, i), depth+1); err != nil {
+				return err
+			}
+		}
+		return checkConstraints(schema, value, field)
+	case "string":
+		if _, ok := value.(string); !ok {
+			return &Error{Field: field, Message: "must be a string"}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return &Error{Field: field, Message: "must be an integer"}
+		}
+		if _, err := n.Int64(); err != nil {
+			return &Error{Field: field, Message: "must be an integer"}
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return &Error{Field: field, Message: "must be a number"}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return &Error{Field: field, Message: "must be true or false"}
+		}
+	default:
+		// Untyped schemas (allOf wrappers, free-form values) accept anything
+		if _, isObject := schema["properties"]; isObject {
+			if object, ok := value.(map[string]interface{}); ok {
+				return v.checkObject(schema, object, field, depth)
+			}
+		}
+		return nil
+	}
+	return checkConstraints(schema, value, field)
+}
+
+func (v *Validator) checkObject(schema, object map[string]interface{}, field string, depth int) *Error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if value, present := object[name]; !present || value == nil {
+				return &Error{Field: field + "." + name, Message: "is required"}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, _ := schema["additionalProperties"].(map[string]interface{})
+	for name, value := range object {
+		// Unknown properties are ignored by the handlers' decoders, so they are allowed
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			property = additional
+		}
+		if err := v.checkValue(property, value, field+"."+name, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConstraints checks enum, length, and range constraints on a value of the right type
+func checkConstraints(schema map[string]interface{}, value interface{}, field string) *Error {
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		if !inEnum(enum, value) {
+			allowed := make([]string, len(enum))
+			for i, e := range enum {
+				allowed[i] = fmt.Sprint(e)
+			}
+			return &Error{Field: field, Message: "must be one of " + strings.Join(allowed, ", ")}
+		}
+	}
+
+	switch typed := value.(type) {
+	case string:
+		length := len([]rune(typed))
+		if min, ok := number(schema["minLength"]); ok && float64(length) < min {
+			return &Error{Field: field, Message: fmt.Sprintf("must be at least %g characters", min)}
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(length) > max {
+			return &Error{Field: field, Message: fmt.Sprintf("must be at most %g characters", max)}
+		}
+	case json.Number:
+		n, err := typed.Float64()
+		if err != nil {
+			return nil
+		}
+		if min, ok := number(schema["minimum"]); ok && n < min {
+			return &Error{Field: field, Message: fmt.Sprintf("must be at least %g", min)}
+		}
+		if max, ok := number(schema["maximum"]); ok && n > max {
+			return &Error{Field: field, Message: fmt.Sprintf("must be at most %g", max)}
+		}
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(typed)) < min {
+			return &Error{Field: field, Message: fmt.Sprintf("must have at least %g items", min)}
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(typed)) > max {
+			return &Error{Field: field, Message: fmt.Sprintf("must have at most %g items", max)}
+		}
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if n, ok := value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				if en, ok := number(e); ok && en == f {
+					return true
+				}
+			}
+			continue
+		}
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+// number reads a numeric spec keyword, decoded from JSON or YAML
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// resolve looks up a local "#/definitions/name" reference
+func (v *Validator) resolve(ref string) map[string]interface{} {
+	name := strings.TrimPrefix(ref, "#/definitions/")
+	if name == ref {
+		return nil
+	}
+	schema, _ := v.definitions[name].(map[string]interface{})
+	return schema
+}
@@ -0,0 +1,243 @@
+package specvalidate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// testSpec is shaped like the swag output for a few snailbus operations
+const testSpec = `{
+  "swagger": "2.0",
+  "basePath": "/",
+  "paths": {
+    "/api/v1/hosts": {
+      "get": {
+        "parameters": [
+          {"name": "limit", "in": "query", "type": "integer", "minimum": 1, "maximum": 500},
+          {"name": "status", "in": "query", "type": "string", "enum": ["active", "stale"]},
+          {"name": "tags", "in": "query", "type": "array", "items": {"type": "string", "maxLength": 5}}
+        ]
+      }
+    },
+    "/api/v1/hosts/{host_id}": {
+      "patch": {
+        "parameters": [
+          {"name": "host_id", "in": "path", "type": "string", "required": true},
+          {"name": "If-Match", "in": "header", "type": "string", "required": true},
+          {"name": "request", "in": "body", "required": true, "schema": {"$ref": "#/definitions/models.UpdateHostRequest"}}
+        ]
+      }
+    },
+    "/api/v1/users/{user_id}/role": {
+      "put": {
+        "parameters": [
+          {"name": "user_id", "in": "path", "type": "string", "required": true},
+          {"name": "request", "in": "body", "required": true, "schema": {"$ref": "#/definitions/models.UpdateUserRoleRequest"}}
+        ]
+      }
+    },
+    "/api/v1/ingest/batch": {
+      "post": {
+        "parameters": [
+          {"name": "request", "in": "body", "required": true, "schema": {"type": "array", "items": {"$ref": "#/definitions/models.IngestRequest"}}}
+        ]
+      }
+    }
+  },
+  "definitions": {
+    "models.UpdateUserRoleRequest": {
+      "type": "object",
+      "required": ["role"],
+      "properties": {"role": {"type": "string", "enum": ["viewer", "editor", "admin"]}}
+    },
+    "models.UpdateHostRequest": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string", "minLength": 1, "maxLength": 10},
+        "owner": {"allOf": [{"$ref": "#/definitions/models.Owner"}], "description": "Owner"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+        "priority": {"type": "integer"}
+      }
+    },
+    "models.Owner": {
+      "type": "object",
+      "required": ["email"],
+      "properties": {"email": {"type": "string"}, "primary": {"type": "boolean"}}
+    },
+    "models.IngestRequest": {
+      "type": "object",
+      "properties": {
+        "meta": {"type": "object", "required": ["hostname"], "properties": {"hostname": {"type": "string"}}},
+        "data": {"type": "object"},
+        "errors": {"type": "array", "items": {"type": "string"}}
+      }
+    }
+  }
+}`
+
+func newTestValidator(t *testing.T) *Validator {
+	t.Helper()
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(testSpec), &spec); err != nil {
+		t.Fatalf("invalid test spec: %v", err)
+	}
+	v, err := New(spec)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return v
+}
+
+func TestValidator_Params(t *testing.T) {
+	v := newTestValidator(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantField string // Empty when the request is valid
+	}{
+		{"no params", "", ""},
+		{"valid params", "limit=50&status=stale&tags=web,db", ""},
+		{"limit not an integer", "limit=ten", "query.limit"},
+		{"limit below minimum", "limit=0", "query.limit"},
+		{"limit above maximum", "limit=501", "query.limit"},
+		{"status not in enum", "status=gone", "query.status"},
+		{"array item too long", "tags=web,database", "query.tags[1]"},
+		{"empty value is absent", "limit=", ""},
+		{"undocumented params pass", "cursor=abc", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			err := v.Validate(Request{Method: "GET", Path: "/api/v1/hosts", Query: query, Header: http.Header{}})
+			checkField(t, err, tt.wantField)
+		})
+	}
+}
+
+func TestValidator_Body(t *testing.T) {
+	v := newTestValidator(t)
+	header := http.Header{"If-Match": []string{`"3"`}}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+	}{
+		{"valid", `{"name": "web-1", "owner": {"email": "a@example.com"}, "labels": {"env": "prod"}}`, ""},
+		{"empty object", `{}`, ""},
+		{"unknown fields allowed", `{"colour": "blue"}`, ""},
+		{"null values allowed", `{"name": null, "owner": null}`, ""},
+		{"wrong type", `{"name": 5}`, "body.name"},
+		{"too short", `{"name": ""}`, "body.name"},
+		{"too long", `{"name": "web-server-01"}`, "body.name"},
+		{"required field through allOf", `{"owner": {"primary": true}}`, "body.owner.email"},
+		{"nested wrong type", `{"owner": {"email": "a@example.com", "primary": "yes"}}`, "body.owner.primary"},
+		{"additional properties checked", `{"labels": {"env": 1}}`, "body.labels.env"},
+		{"integer with fraction", `{"priority": 1.5}`, "body.priority"},
+		{"body not an object", `["web-1"]`, "body"},
+		{"missing body", ``, "body"},
+		{"malformed JSON left to the handler", `{"name":`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(Request{
+				Method:     "PATCH",
+				Path:       "/api/v1/hosts/:host_id",
+				Header:     header,
+				PathParams: map[string]string{"host_id": "6f1c"},
+				Body:       []byte(tt.body),
+			})
+			checkField(t, err, tt.wantField)
+		})
+	}
+}
+
+func TestValidator_RequiredParamsAndEnums(t *testing.T) {
+	v := newTestValidator(t)
+
+	err := v.Validate(Request{
+		Method:     "PATCH",
+		Path:       "/api/v1/hosts/{id}",
+		Header:     http.Header{},
+		PathParams: map[string]string{"host_id": "6f1c"},
+		Body:       []byte(`{}`),
+	})
+	checkField(t, err, "header.If-Match")
+
+	err = v.Validate(Request{
+		Method:     "PUT",
+		Path:       "/api/v1/users/:user_id/role",
+		PathParams: map[string]string{"user_id": "u1"},
+		Body:       []byte(`{"role": "owner"}`),
+	})
+	checkField(t, err, "body.role")
+	if err.Message != "must be one of viewer, editor, admin" {
+		t.Errorf("Message = %q", err.Message)
+	}
+
+	err = v.Validate(Request{
+		Method:     "PUT",
+		Path:       "/api/v1/users/:user_id/role",
+		PathParams: map[string]string{"user_id": "u1"},
+		Body:       []byte(`{}`),
+	})
+	checkField(t, err, "body.role")
+
+	// A body that was not read (compressed or too large) is not checked
+	err = v.Validate(Request{
+		Method:     "PUT",
+		Path:       "/api/v1/users/:user_id/role",
+		PathParams: map[string]string{"user_id": "u1"},
+	})
+	checkField(t, err, "")
+}
+
+func TestValidator_ArrayBody(t *testing.T) {
+	v := newTestValidator(t)
+
+	valid := `[{"meta": {"hostname": "web-1"}, "data": {"os": {}}}, {"meta": {"hostname": "web-2"}, "errors": ["timeout"]}]`
+	checkField(t, v.Validate(Request{Method: "POST", Path: "/api/v1/ingest/batch", Body: []byte(valid)}), "")
+
+	invalid := `[{"meta": {"hostname": "web-1"}}, {"meta": {}}]`
+	checkField(t, v.Validate(Request{Method: "POST", Path: "/api/v1/ingest/batch", Body: []byte(invalid)}), "body[1].meta.hostname")
+}
+
+func TestValidator_Undocumented(t *testing.T) {
+	v := newTestValidator(t)
+
+	if v.HasBody("GET", "/api/v1/hosts") {
+		t.Error("HasBody() = true for an operation without a body parameter")
+	}
+	if !v.HasBody("PUT", "/api/v1/users/{user_id}/role") {
+		t.Error("HasBody() = false for an operation with a body parameter")
+	}
+	err := v.Validate(Request{Method: "DELETE", Path: "/api/v1/hosts", Body: []byte(`"anything"`)})
+	checkField(t, err, "")
+}
+
+func TestNew_InvalidSpec(t *testing.T) {
+	if _, err := New(map[string]interface{}{"swagger": "2.0"}); err == nil {
+		t.Error("New() accepted a spec without paths")
+	}
+}
+
+func checkField(t *testing.T, err *Error, wantField string) {
+	t.Helper()
+	if wantField == "" {
+		if err != nil {
+			t.Fatalf("Validate() error = %v, want nil", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("Validate() error = nil, want violation of %s", wantField)
+	}
+	if err.Field != wantField {
+		t.Errorf("Validate() field = %s, want %s (%v)", err.Field, wantField, err)
+	}
+}
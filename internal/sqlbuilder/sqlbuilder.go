@@ -0,0 +1,187 @@
+// Package sqlbuilder assembles parameterized PostgreSQL SELECT statements.
+//
+// Conditions are written with ? placeholders and combined in any order; Build
+// numbers them $1, $2, ... in the order they appear in the statement, so clauses
+// can be added conditionally without tracking argument positions by hand. Write ??
+// for a literal question mark, e.g. the jsonb ? operator.
+//
+// Only SQL fragments written in code belong in a query; values always go in args.
+package sqlbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Cond is a SQL boolean expression with ? placeholders and their arguments
+type Cond struct {
+	sql  string
+	args []interface{}
+}
+
+// Expr returns a condition written in SQL, binding one argument per ? placeholder
+// The SQL is used as written, so parenthesize an expression containing OR.
+func Expr(sql string, args ...interface{}) Cond {
+	return Cond{sql: sql, args: args}
+}
+
+// Eq returns column = value
+func Eq(column string, value interface{}) Cond {
+	return Expr(column+" = ?", value)
+}
+
+// Any returns column = ANY(values), bound as a PostgreSQL text array
+func Any(column string, values []string) Cond {
+	return Expr(column+" = ANY(?)", pq.Array(values))
+}
+
+// IsNull returns column IS NULL
+func IsNull(column string) Cond {
+	return Expr(column + " IS NULL")
+}
+
+// And joins conditions with AND; an empty list is true
+func And(conds ...Cond) Cond {
+	return join(conds, " AND ", "TRUE")
+}
+
+// Or joins conditions with OR; an empty list is false
+func Or(conds ...Cond) Cond {
+	return join(conds, " OR ", "FALSE")
+}
+
+// Not negates a condition
+func Not(cond Cond) Cond {
+	return Cond{sql: "NOT (" + cond.sql + ")", args: cond.args}
+}
+
+func join(conds []Cond, sep, empty string) Cond {
+	switch len(conds) {
+	case 0:
+		return Expr(empty)
+	case 1:
+		return conds[0]
+	}
+	parts := make([]string, len(conds))
+	var args []interface{}
+	for i, cond := range conds {
+		parts[i] = "(" + cond.sql + ")"
+		args = append(args, cond.args...)
+	}
+	return Cond{sql: "(" + strings.Join(parts, sep) + ")", args: args}
+}
+
+// SelectBuilder builds a SELECT statement; the zero value is not usable, start with Select
+type SelectBuilder struct {
+	columns []string
+	from    string
+	joins   []Cond
+	where   []Cond
+	orderBy []string
+	limit   int
+}
+
+// Select starts a statement returning columns
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// Columns adds columns to those the statement returns
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// From sets the table, with an optional alias (e.g. "hosts h")
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from = table
+	return b
+}
+
+// Join adds a JOIN clause written in SQL, e.g. "JOIN hosts h ON h.host_id = a.host_id"
+// Placeholders in a LATERAL subquery bind args.
+func (b *SelectBuilder) Join(clause string, args ...interface{}) *SelectBuilder {
+	b.joins = append(b.joins, Expr(clause, args...))
+	return b
+}
+
+// Where adds conditions, ANDed with the others
+func (b *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// OrderBy adds ORDER BY expressions
+func (b *SelectBuilder) OrderBy(exprs ...string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, exprs...)
+	return b
+}
+
+// Limit caps the number of rows; 0 means no limit
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// Build returns the statement with numbered placeholders and its arguments
+// It panics when a fragment's placeholders do not match its arguments, which is a
+// mistake in the code building the query rather than in its input.
+func (b *SelectBuilder) Build() (string, []interface{}) {
+	var sql strings.Builder
+	var args []interface{}
+	write := func(fragment Cond) {
+		sql.WriteString(fragment.sql)
+		args = append(args, fragment.args...)
+	}
+
+	sql.WriteString("SELECT " + strings.Join(b.columns, ", "))
+	sql.WriteString(" FROM " + b.from)
+	for _, join := range b.joins {
+		sql.WriteString(" ")
+		write(join)
+	}
+	if len(b.where) > 0 {
+		sql.WriteString(" WHERE ")
+		for i, cond := range b.where {
+			if i > 0 {
+				sql.WriteString(" AND ")
+			}
+			write(cond)
+		}
+	}
+	if len(b.orderBy) > 0 {
+		sql.WriteString(" ORDER BY " + strings.Join(b.orderBy, ", "))
+	}
+	if b.limit > 0 {
+		sql.WriteString(" LIMIT ?")
+		args = append(args, b.limit)
+	}
+
+	return numberPlaceholders(sql.String(), len(args)), args
+}
+
+// numberPlaceholders replaces each ? with $1, $2, ... and each ?? with ?
+func numberPlaceholders(sql string, want int) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			b.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == '?' {
+			b.WriteByte('?')
+			i++
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	if n != want {
+		panic(fmt.Sprintf("sqlbuilder: %d placeholders for %d arguments in %q", n, want, sql))
+	}
+	return b.String()
+}
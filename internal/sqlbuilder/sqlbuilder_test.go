@@ -0,0 +1,139 @@
+package sqlbuilder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSelectBuilder_Build(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *SelectBuilder
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "columns and table only",
+			builder: Select("id", "name").From("organizations"),
+			wantSQL: "SELECT id, name FROM organizations",
+		},
+		{
+			name:    "Columns adds to the selected columns",
+			builder: Select("id").Columns("name", "created_at").From("organizations"),
+			wantSQL: "SELECT id, name, created_at FROM organizations",
+		},
+		{
+			name:     "conditions are ANDed and numbered in order",
+			builder:  Select("id").From("hosts").Where(Eq("org_id", "org-1"), IsNull("archived_at"), Eq("hostname", "web-1")),
+			wantSQL:  "SELECT id FROM hosts WHERE org_id = $1 AND archived_at IS NULL AND hostname = $2",
+			wantArgs: []interface{}{"org-1", "web-1"},
+		},
+		{
+			name:     "Where can be called repeatedly",
+			builder:  Select("id").From("hosts").Where(Eq("org_id", "org-1")).Where().Where(Eq("port", 22)),
+			wantSQL:  "SELECT id FROM hosts WHERE org_id = $1 AND port = $2",
+			wantArgs: []interface{}{"org-1", 22},
+		},
+		{
+			name: "join arguments come before conditions",
+			builder: Select("a.id").From("accounts a").
+				Join("JOIN hosts h ON h.host_id = a.host_id AND h.hostname <> ?", "ignored").
+				Where(Eq("a.org_id", "org-1")),
+			wantSQL:  "SELECT a.id FROM accounts a JOIN hosts h ON h.host_id = a.host_id AND h.hostname <> $1 WHERE a.org_id = $2",
+			wantArgs: []interface{}{"ignored", "org-1"},
+		},
+		{
+			name:     "order by and limit",
+			builder:  Select("id").From("hosts").Where(Eq("org_id", "org-1")).OrderBy("received_at DESC", "id").Limit(10),
+			wantSQL:  "SELECT id FROM hosts WHERE org_id = $1 ORDER BY received_at DESC, id LIMIT $2",
+			wantArgs: []interface{}{"org-1", 10},
+		},
+		{
+			name:     "any binds an array",
+			builder:  Select("id").From("hosts").Where(Any("hostname", []string{"a", "b"})),
+			wantSQL:  "SELECT id FROM hosts WHERE hostname = ANY($1)",
+			wantArgs: []interface{}{pq.Array([]string{"a", "b"})},
+		},
+		{
+			name:     "or is parenthesized",
+			builder:  Select("id").From("hosts").Where(Eq("org_id", "org-1"), Or(Eq("hostname", "a"), Eq("hostname", "b"))),
+			wantSQL:  "SELECT id FROM hosts WHERE org_id = $1 AND ((hostname = $2) OR (hostname = $3))",
+			wantArgs: []interface{}{"org-1", "a", "b"},
+		},
+		{
+			name:     "nested and, or, not",
+			builder:  Select("id").From("hosts").Where(Not(And(Eq("a", 1), Or(Eq("b", 2), IsNull("c"))))),
+			wantSQL:  "SELECT id FROM hosts WHERE NOT (((a = $1) AND (((b = $2) OR (c IS NULL)))))",
+			wantArgs: []interface{}{1, 2},
+		},
+		{
+			name:    "empty and, or",
+			builder: Select("id").From("hosts").Where(And(), Or()),
+			wantSQL: "SELECT id FROM hosts WHERE TRUE AND FALSE",
+		},
+		{
+			name:     "single-element and, or are unwrapped",
+			builder:  Select("id").From("hosts").Where(And(Eq("a", 1)), Or(Eq("b", 2))),
+			wantSQL:  "SELECT id FROM hosts WHERE a = $1 AND b = $2",
+			wantArgs: []interface{}{1, 2},
+		},
+		{
+			name:     "escaped question mark",
+			builder:  Select("id").From("hosts").Where(Expr("data ?? ?", "packages")),
+			wantSQL:  "SELECT id FROM hosts WHERE data ? $1",
+			wantArgs: []interface{}{"packages"},
+		},
+		{
+			name:     "expression with several arguments",
+			builder:  Select("id").From("hosts").Where(Expr("received_at BETWEEN ? AND ?", "from", "to")),
+			wantSQL:  "SELECT id FROM hosts WHERE received_at BETWEEN $1 AND $2",
+			wantArgs: []interface{}{"from", "to"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.builder.Build()
+			if sql != tt.wantSQL {
+				t.Errorf("Build() sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Build() args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSelectBuilder_BuildMismatchedPlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SelectBuilder
+	}{
+		{"missing argument", Select("id").From("hosts").Where(Expr("a = ? AND b = ?", 1))},
+		{"extra argument", Select("id").From("hosts").Where(Expr("a = 1", 1))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil || !strings.Contains(r.(string), "placeholders") {
+					t.Errorf("Build() panic = %v, want a placeholder mismatch", r)
+				}
+			}()
+			tt.builder.Build()
+		})
+	}
+}
+
+func TestSelectBuilder_BuildIsRepeatable(t *testing.T) {
+	builder := Select("id").From("hosts").Where(Eq("org_id", "org-1")).Limit(5)
+	sql1, args1 := builder.Build()
+	sql2, args2 := builder.Build()
+	if sql1 != sql2 || !reflect.DeepEqual(args1, args2) {
+		t.Errorf("Build() twice = %q %v and %q %v", sql1, args1, sql2, args2)
+	}
+}
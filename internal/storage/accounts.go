@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"snailbus/internal/models"
+)
+
+// parseHostAccounts extracts the local user accounts from report data's users section
+// The section is either a list of accounts or an object holding one under "users".
+// Accounts without a username are skipped, and only the first entry for a username is kept.
+func parseHostAccounts(dataJSON []byte) []models.HostAccount {
+	var data struct {
+		Users json.RawMessage `json:"users"`
+	}
+	if err := json.Unmarshal(dataJSON, &data); err != nil || len(data.Users) == 0 {
+		return nil
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data.Users, &entries); err != nil {
+		var section struct {
+			Users []json.RawMessage `json:"users"`
+		}
+		if err := json.Unmarshal(data.Users, &section); err != nil {
+			return nil
+		}
+		entries = section.Users
+	}
+
+	accounts := make([]models.HostAccount, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, raw := range entries {
+		var entry struct {
+			Name     string      `json:"name"`
+			Username string      `json:"username"`
+			UID      interface{} `json:"uid"`
+			GID      interface{} `json:"gid"`
+			Home     string      `json:"home"`
+			HomeDir  string      `json:"home_dir"`
+			Shell    string      `json:"shell"`
+		}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		username := entry.Username
+		if username == "" {
+			username = entry.Name
+		}
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		home := entry.Home
+		if home == "" {
+			home = entry.HomeDir
+		}
+		accounts = append(accounts, models.HostAccount{
+			Username: username,
+			UID:      reportedInt(entry.UID),
+			GID:      reportedInt(entry.GID),
+			Home:     home,
+			Shell:    entry.Shell,
+		})
+	}
+	return accounts
+}
+
+// reportedInt reads an integer reported as a JSON number or numeric string
+func reportedInt(value interface{}) *int64 {
+	var id int64
+	var err error
+	switch v := value.(type) {
+	case float64:
+		id = int64(v)
+		if float64(id) != v {
+			return nil
+		}
+	case string:
+		if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &id
+}
+
+// matchHostAccount reports whether an account has the username, shell, and uid filter asks for
+// It backs the mock storage; host and archive conditions are left to the caller.
+func matchHostAccount(account models.HostAccount, filter models.HostAccountFilter) bool {
+	if filter.Username != "" && account.Username != filter.Username {
+		return false
+	}
+	if filter.Shell != "" && account.Shell != filter.Shell {
+		return false
+	}
+	if filter.UID != nil && (account.UID == nil || *account.UID != *filter.UID) {
+		return false
+	}
+	return true
+}
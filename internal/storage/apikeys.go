@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/metrics"
+	"snailbus/internal/models"
+)
+
+// maxAPIKeyAttempts bounds how many keys GenerateAPIKey tries when prefixes collide.
+// A collision of 16 random base64 characters is already vanishingly rare.
+const maxAPIKeyAttempts = 5
+
+// GenerateAPIKey generates an API key for a user and stores it, generating another
+// key when the prefix is already taken. Returns the plain key, which is shown once.
+func GenerateAPIKey(store Storage, userID, name string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	for attempt := 0; attempt < maxAPIKeyAttempts; attempt++ {
+		plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			return "", nil, err
+		}
+		apiKey, err := store.CreateAPIKey(userID, keyHash, keyPrefix, name, expiresAt)
+		if errors.Is(err, ErrAPIKeyPrefixTaken) {
+			metrics.APIKeyPrefixCollisionsTotal.Inc()
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return plainKey, apiKey, nil
+	}
+	return "", nil, fmt.Errorf("no unique API key prefix after %d attempts: %w", maxAPIKeyAttempts, ErrAPIKeyPrefixTaken)
+}
+
+// DeletedAPIKey is an API key removed by DeleteExpiredAPIKeys, with the organization of
+// the user it belonged to
+type DeletedAPIKey struct {
+	ID        string
+	UserID    string
+	OrgID     string
+	Name      string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "snailbus/internal/models"
+
+// DefaultAuditPageSize and MaxAuditPageSize bound ListAuditEvents pages
+const (
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 1000
+)
+
+// AuditPage is one page of an organization's audit log
+type AuditPage struct {
+	Events []*models.AuditEvent
+	Next   int64 // beforeID of the next page; 0 on the last page
+}
+
+// clampAuditPageSize applies the default and maximum page size
+func clampAuditPageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultAuditPageSize
+	}
+	if limit > MaxAuditPageSize {
+		return MaxAuditPageSize
+	}
+	return limit
+}
+
+// auditPage trims events read with one extra event to limit and sets where the next page starts
+func auditPage(events []*models.AuditEvent, limit int) *AuditPage {
+	page := &AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.Next = page.Events[limit-1].ID
+	}
+	return page
+}
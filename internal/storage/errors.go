@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"snailbus/internal/apierror"
+)
+
+// Storage errors are sentinels compared with errors.Is, never ==, so that
+// implementations may wrap them with context. The kinds are apierror's, so handlers can
+// report storage errors with apierror.From.
+var (
+	// ErrNotFound is returned when a requested resource does not exist, or exists
+	// in another organization and must not be revealed to the caller
+	ErrNotFound = apierror.ErrNotFound
+
+	// ErrConflict is returned when a write conflicts with the current state of a
+	// resource. The more specific conflicts below all match it.
+	ErrConflict = apierror.ErrConflict
+
+	// ErrInvalidInput is returned when an argument is malformed or violates a
+	// constraint (e.g. an unknown role or a reference to a missing row)
+	ErrInvalidInput = apierror.ErrValidation
+
+	// ErrInvalidID is returned for IDs that are not valid UUIDs. A malformed ID
+	// cannot name an existing row, so it matches ErrNotFound as well as ErrInvalidInput.
+	ErrInvalidID error = &invalidIDError{}
+
+	// Registration conflicts returned by RegisterUser, CreateUser, and CreateOrganization
+	ErrUsernameTaken = conflict("username already exists")
+	ErrEmailTaken    = conflict("email already exists")
+	ErrOrgNameTaken  = conflict("organization name already exists")
+	ErrOrgHasUsers   = conflict("organization already has a user")
+
+	// ErrAlreadyMember is returned by AddOrgMembership when the user already belongs to or
+	// is a member of the organization
+	ErrAlreadyMember = conflict("user is already a member of the organization")
+
+	// ErrAPIKeyPrefixTaken is returned by CreateAPIKey when another key has the same prefix
+	ErrAPIKeyPrefixTaken = conflict("API key prefix already exists")
+
+	// ErrIOCListNameTaken is returned by CreateIOCList and ReplaceIOCList when the organization
+	// has another list of the same name
+	ErrIOCListNameTaken = conflict("IOC list name already exists")
+
+	// ErrHostGroupNameTaken is returned by CreateHostGroup and UpdateHostGroup when the
+	// organization has another group of the same name
+	ErrHostGroupNameTaken = conflict("host group name already exists")
+
+	// ErrHostNotDeleted is returned by RestoreHost for hosts that currently exist
+	ErrHostNotDeleted = conflict("host is not deleted")
+
+	// ErrHostArchived and ErrHostNotArchived are returned by ArchiveHost and UnarchiveHost
+	// for hosts that are already in the requested state
+	ErrHostArchived    = conflict("host is already archived")
+	ErrHostNotArchived = conflict("host is not archived")
+
+	// ErrProbeJobNotRunning is returned by CompleteProbeJob for jobs that are pending or completed
+	ErrProbeJobNotRunning = conflict("probe job is not running")
+
+	// ErrActionRunNotFailed is returned by RetryActionRun for runs that have not failed
+	ErrActionRunNotFailed = conflict("action run is not failed")
+
+	// ErrBundleAlreadyImported is returned by CreateImportBatch and FinishImportBatch for
+	// bundles the organization has already imported
+	ErrBundleAlreadyImported = conflict("bundle has already been imported")
+
+	// ErrVersionMismatch is returned by conditional writes whose expected version is
+	// not the resource's current version, or that expect a version of a missing resource
+	ErrVersionMismatch = conflict("resource version does not match")
+)
+
+// conflict returns a specific conflict, which also matches ErrConflict
+func conflict(msg string) error {
+	return apierror.Conflict(msg)
+}
+
+type invalidIDError struct{}
+
+func (e *invalidIDError) Error() string {
+	return "invalid ID"
+}
+
+func (e *invalidIDError) Is(target error) bool {
+	return target == ErrNotFound || target == ErrInvalidInput
+}
+
+// RequestError is a storage error annotated with the request that caused it, taken from
+// the context's query tag (see WithQueryTag). Its message names the request ID that
+// clients are given, so a logged error can be found from a user's report.
+type RequestError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (request %s)", e.Err, e.RequestID)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// withRequest annotates err with the request ID of ctx, if it carries one
+func withRequest(ctx context.Context, err error) error {
+	tag := queryTag(ctx)
+	if err == nil || tag == "" {
+		return err
+	}
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return err
+	}
+	return &RequestError{RequestID: tag, Err: err}
+}
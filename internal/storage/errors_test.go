@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+func TestErrors_Is(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"conflict matches ErrConflict", ErrUsernameTaken, ErrConflict, true},
+		{"conflict matches itself", ErrHostNotDeleted, ErrHostNotDeleted, true},
+		{"conflicts are distinct", ErrUsernameTaken, ErrEmailTaken, false},
+		{"conflict is not not found", ErrOrgHasUsers, ErrNotFound, false},
+		{"invalid ID matches ErrNotFound", ErrInvalidID, ErrNotFound, true},
+		{"invalid ID matches ErrInvalidInput", ErrInvalidID, ErrInvalidInput, true},
+		{"invalid ID is not a conflict", ErrInvalidID, ErrConflict, false},
+		{"wrapped conflict", fmt.Errorf("failed to create user: %w", ErrEmailTaken), ErrConflict, true},
+		{"wrapped invalid ID", fmt.Errorf("failed to get host: %w", ErrInvalidID), ErrNotFound, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRequest(t *testing.T) {
+	if err := withRequest(context.Background(), ErrNotFound); err != ErrNotFound {
+		t.Errorf("withRequest() without a query tag = %v, want ErrNotFound unchanged", err)
+	}
+
+	ctx := WithQueryTag(context.Background(), "req-1")
+	if err := withRequest(ctx, nil); err != nil {
+		t.Errorf("withRequest(nil) = %v, want nil", err)
+	}
+
+	err := withRequest(ctx, fmt.Errorf("failed to get host batch: %w", ErrInvalidID))
+	if got, want := err.Error(), "failed to get host batch: invalid ID (request req-1)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = false, want true", err)
+	}
+	var requestErr *RequestError
+	if !errors.As(err, &requestErr) || requestErr.RequestID != "req-1" {
+		t.Errorf("errors.As(%v) did not find request req-1", err)
+	}
+
+	// Errors are annotated once
+	if again := withRequest(ctx, fmt.Errorf("outer: %w", err)); again.Error() != "outer: "+err.Error() {
+		t.Errorf("withRequest() annotated twice: %v", again)
+	}
+}
+
+func TestMockStorage_TypedErrors(t *testing.T) {
+	store := NewMockStorage()
+
+	org, err := store.CreateOrganization("Test Org")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	if _, err := store.CreateOrganization("Test Org"); !errors.Is(err, ErrOrgNameTaken) {
+		t.Errorf("CreateOrganization() duplicate error = %v, want ErrOrgNameTaken", err)
+	}
+	if _, err := store.CreateOrganization("TEST org"); !errors.Is(err, ErrOrgNameTaken) {
+		t.Errorf("CreateOrganization() duplicate in other case error = %v, want ErrOrgNameTaken", err)
+	}
+	otherOrg, err := store.CreateOrganization("Other Org")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+
+	user, err := store.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := store.CreateUser("testuser", "other@example.com", "hash", org.ID, "admin"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("CreateUser() duplicate username error = %v, want ErrUsernameTaken", err)
+	}
+	if _, err := store.CreateUser("otheruser", "test@example.com", "hash", org.ID, "admin"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("CreateUser() duplicate email error = %v, want ErrEmailTaken", err)
+	}
+
+	const hostID = "00000000-0000-0000-0000-000000000001"
+	report := &models.Report{
+		ID:         hostID,
+		ReceivedAt: time.Now(),
+		Meta:       models.ReportMeta{HostID: hostID, Hostname: "web-1"},
+		Data:       json.RawMessage(`{}`),
+	}
+	if err := store.SaveHost(report, org.ID, user.ID); err != nil {
+		t.Fatalf("SaveHost() error = %v", err)
+	}
+	if _, err := store.GetHost(hostID, otherOrg.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetHost() from other org error = %v, want ErrNotFound", err)
+	}
+
+	job := &models.ProbeJob{
+		ID:          "00000000-0000-0000-0000-0000000000a1",
+		Method:      models.ProbeMethodICMP,
+		Prober:      models.ProberAgent,
+		Status:      models.ProbeJobPending,
+		Targets:     []models.ProbeTarget{{HostID: hostID, Hostname: "web-1"}},
+		RequestedBy: user.ID,
+	}
+	if err := store.CreateProbeJob(job, org.ID); err != nil {
+		t.Fatalf("CreateProbeJob() error = %v", err)
+	}
+	if err := store.CompleteProbeJob(job.ID, org.ID, nil); !errors.Is(err, ErrProbeJobNotRunning) {
+		t.Errorf("CompleteProbeJob() on pending job error = %v, want ErrProbeJobNotRunning", err)
+	}
+	if err := store.CompleteProbeJob(job.ID, otherOrg.ID, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CompleteProbeJob() from other org error = %v, want ErrNotFound", err)
+	}
+
+	store.shouldErrorOnGetHost = true
+	if _, err := store.GetHost(hostID, org.ID); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetHost() injected error = %v, want a failure other than ErrNotFound", err)
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	store := NewMockStorage()
+
+	plainKey, apiKey, err := GenerateAPIKey(store, "user-1", "CI", nil)
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+	if apiKey.KeyPrefix != plainKey[:16] {
+		t.Errorf("GenerateAPIKey() prefix = %q, want the first 16 characters of %q", apiKey.KeyPrefix, plainKey)
+	}
+
+	// A taken prefix is refused, so the next generated key is used instead
+	if _, err := store.CreateAPIKey("user-1", "hash", apiKey.KeyPrefix, "Other", nil); !errors.Is(err, ErrAPIKeyPrefixTaken) {
+		t.Errorf("CreateAPIKey() duplicate prefix error = %v, want ErrAPIKeyPrefixTaken", err)
+	}
+	if _, err := store.CreateAPIKey("user-1", "hash", "legacy01", "Legacy", nil); err != nil {
+		t.Errorf("CreateAPIKey() legacy prefix error = %v", err)
+	}
+	if _, err := store.CreateAPIKey("user-1", "hash", "legacy01", "Legacy 2", nil); err != nil {
+		t.Errorf("CreateAPIKey() shared legacy prefix error = %v", err)
+	}
+}
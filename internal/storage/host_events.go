@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+// Host event projection
+//
+// Host mutations are recorded as models.HostEvent and the hosts table (with its
+// tags and details) is a projection of that stream. hostState folds a host's events, in
+// order, into the state the projection should hold; it is used to rebuild the
+// projection and to find what a restore brings back.
+
+// DefaultHostEventLimit and MaxHostEventLimit bound ListHostEvents pages
+const (
+	DefaultHostEventLimit = 100
+	MaxHostEventLimit     = 1000
+)
+
+// hostState is the projected state of one host
+type hostState struct {
+	orgID      string
+	report     *models.Report // Last report; kept after deletion so the host can be restored
+	uploadedBy string
+	tags       []string // Tags at the time of deletion while deleted
+	details    models.HostDetails
+	archivedAt *time.Time // Set while the host is archived
+	exists     bool
+}
+
+// apply folds one event into the state
+func (s *hostState) apply(event *models.HostEvent) {
+	s.orgID = event.OrgID
+	payload := event.Payload
+	if payload == nil {
+		payload = &models.HostEventPayload{}
+	}
+
+	switch event.Type {
+	case models.HostEventIngested, models.HostEventUpdated:
+		if !s.exists {
+			// Tags and details do not survive deletion; a host that reports again starts over
+			s.tags = nil
+			s.details = models.HostDetails{}
+		}
+		s.report = payload.Report
+		s.uploadedBy = payload.UploadedByUserID
+		s.exists = true
+	case models.HostEventTagged:
+		s.tags = payload.Tags
+	case models.HostEventEdited:
+		if payload.Details != nil {
+			s.details = *payload.Details
+		}
+	case models.HostEventArchived:
+		archivedAt := event.CreatedAt
+		s.archivedAt = &archivedAt
+	case models.HostEventUnarchived:
+		s.archivedAt = nil
+	case models.HostEventDeleted:
+		// A deleted host is no longer archived; it is restored or reports again unarchived
+		s.exists = false
+		s.archivedAt = nil
+	case models.HostEventRestored:
+		s.report = payload.Report
+		s.uploadedBy = payload.UploadedByUserID
+		s.tags = payload.Tags
+		s.details = models.HostDetails{}
+		if payload.Details != nil {
+			s.details = *payload.Details
+		}
+		s.exists = true
+	}
+}
+
+// restoreEvent builds the event restoring a deleted host to its last state
+// Returns ErrNotFound if the host has no report to restore and ErrHostNotDeleted if it exists
+func (s *hostState) restoreEvent(hostID, actorUserID string) (*models.HostEvent, error) {
+	if s.report == nil {
+		return nil, ErrNotFound
+	}
+	if s.exists {
+		return nil, ErrHostNotDeleted
+	}
+	payload := &models.HostEventPayload{
+		Report:           s.report,
+		UploadedByUserID: s.uploadedBy,
+		Tags:             s.tags,
+	}
+	if s.details != (models.HostDetails{}) {
+		details := s.details
+		payload.Details = &details
+	}
+	return &models.HostEvent{
+		OrgID:       s.orgID,
+		HostID:      hostID,
+		Hostname:    s.report.Meta.Hostname,
+		Type:        models.HostEventRestored,
+		ActorUserID: actorUserID,
+		Payload:     payload,
+	}, nil
+}
+
+// editEvent builds the event applying update to a host's current details
+func editEvent(hostID, orgID, hostname, actorUserID string, current models.HostDetails, update models.UpdateHostRequest) *models.HostEvent {
+	details := update.Apply(current)
+	return &models.HostEvent{
+		OrgID:       orgID,
+		HostID:      hostID,
+		Hostname:    hostname,
+		Type:        models.HostEventEdited,
+		ActorUserID: actorUserID,
+		Payload:     &models.HostEventPayload{Details: &details},
+	}
+}
+
+// archiveEvent builds the event archiving (archive) or unarchiving a host
+// Returns ErrHostArchived or ErrHostNotArchived if the host is already in that state
+func archiveEvent(hostID, orgID, hostname, actorUserID string, archived, archive bool) (*models.HostEvent, error) {
+	eventType := models.HostEventArchived
+	if !archive {
+		eventType = models.HostEventUnarchived
+	}
+	switch {
+	case archive && archived:
+		return nil, ErrHostArchived
+	case !archive && !archived:
+		return nil, ErrHostNotArchived
+	}
+	return &models.HostEvent{
+		OrgID:       orgID,
+		HostID:      hostID,
+		Hostname:    hostname,
+		Type:        eventType,
+		ActorUserID: actorUserID,
+	}, nil
+}
+
+// deletionPayload carries the deletion reason on a deleted event, if one was given
+func deletionPayload(deletion *models.HostDeletion) *models.HostEventPayload {
+	if deletion == nil {
+		return nil
+	}
+	stored := *deletion
+	return &models.HostEventPayload{Deletion: &stored}
+}
+
+// snapshotEvent builds an ingested or updated event for a report
+func snapshotEvent(report *models.Report, orgID, uploadedByUserID string, existed bool) *models.HostEvent {
+	eventType := models.HostEventIngested
+	if existed {
+		eventType = models.HostEventUpdated
+	}
+	stored := *report
+	return &models.HostEvent{
+		OrgID:       orgID,
+		HostID:      report.Meta.HostID,
+		Hostname:    report.Meta.Hostname,
+		Type:        eventType,
+		ActorUserID: uploadedByUserID,
+		Payload:     &models.HostEventPayload{Report: &stored, UploadedByUserID: uploadedByUserID},
+	}
+}
+
+// isSnapshotEvent reports whether events of eventType carry a full report
+func isSnapshotEvent(eventType string) bool {
+	switch eventType {
+	case models.HostEventIngested, models.HostEventUpdated, models.HostEventRestored:
+		return true
+	}
+	return false
+}
+
+// compactReportData reduces the report data of a superseded snapshot to the OS name and
+// version GetFleetSnapshot reads, as host_event_report_data (migration 000054) does
+func compactReportData(data json.RawMessage) json.RawMessage {
+	var compacted struct {
+		System struct {
+			OS struct {
+				Name    json.RawMessage `json:"name,omitempty"`
+				Version json.RawMessage `json:"version,omitempty"`
+			} `json:"os"`
+		} `json:"system"`
+	}
+	// Data of another shape keeps nothing
+	_ = json.Unmarshal(data, &compacted)
+	encoded, _ := json.Marshal(compacted)
+	return encoded
+}
+
+// batchHostIDs returns the distinct host IDs of a batch of reports, sorted
+func batchHostIDs(reports []*models.Report) []string {
+	seen := make(map[string]bool, len(reports))
+	hostIDs := make([]string, 0, len(reports))
+	for _, report := range reports {
+		if !seen[report.Meta.HostID] {
+			seen[report.Meta.HostID] = true
+			hostIDs = append(hostIDs, report.Meta.HostID)
+		}
+	}
+	sort.Strings(hostIDs)
+	return hostIDs
+}
+
+// sortFleetHosts orders a fleet snapshot by hostname, then host ID
+func sortFleetHosts(hosts []*models.FleetHost) {
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Hostname != hosts[j].Hostname {
+			return hosts[i].Hostname < hosts[j].Hostname
+		}
+		return hosts[i].HostID < hosts[j].HostID
+	})
+}
+
+// clampHostEventLimit applies the default and maximum page size
+func clampHostEventLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultHostEventLimit
+	}
+	if limit > MaxHostEventLimit {
+		return MaxHostEventLimit
+	}
+	return limit
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"snailbus/internal/models"
+	"snailbus/internal/sqlbuilder"
+)
+
+// DefaultHostPageSize and MaxHostPageSize bound ListHostsPaginated pages
+const (
+	DefaultHostPageSize = 100
+	MaxHostPageSize     = 1000
+)
+
+// HostCursor marks where a page of hosts ended. Hosts are paged by last report,
+// newest first, with the host ID breaking ties, so a host that reports while a client
+// pages moves to the front instead of shifting every later page.
+type HostCursor struct {
+	LastSeen time.Time
+	HostID   string
+}
+
+// String encodes the cursor as returned in next_cursor
+func (c HostCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.LastSeen.UTC().Format(time.RFC3339Nano) + " " + c.HostID))
+}
+
+// ParseHostCursor decodes a cursor produced by HostCursor.String
+// Returns an error matching ErrInvalidInput if it is malformed.
+func ParseHostCursor(s string) (*HostCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed host cursor", ErrInvalidInput)
+	}
+	lastSeen, hostID, ok := strings.Cut(string(raw), " ")
+	if !ok || hostID == "" {
+		return nil, fmt.Errorf("%w: malformed host cursor", ErrInvalidInput)
+	}
+	t, err := time.Parse(time.RFC3339Nano, lastSeen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed host cursor", ErrInvalidInput)
+	}
+	return &HostCursor{LastSeen: t, HostID: hostID}, nil
+}
+
+// HostPage is one page of an organization's hosts
+type HostPage struct {
+	Hosts []*models.HostSummary
+	Total int         // Hosts on all pages
+	Next  *HostCursor // Where the next page starts; nil on the last page
+}
+
+// PageHosts returns the page of limit hosts (clamped to the default and maximum
+// page size) following after, or the first page if after is nil. hosts are sorted
+// in page order in place. It pages lists that are filtered after they are read,
+// such as search results, the same way ListHostsPaginated pages in SQL.
+func PageHosts(hosts []*models.HostSummary, after *HostCursor, limit int) *HostPage {
+	limit = clampHostPageSize(limit)
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hostBefore(hosts[i], HostCursor{LastSeen: hosts[j].LastSeen, HostID: hosts[j].HostID})
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(hosts), func(i int) bool { return !hostBefore(hosts[i], *after) && !atCursor(hosts[i], *after) })
+	}
+	end := start + limit
+	if end > len(hosts) {
+		end = len(hosts)
+	}
+
+	page := &HostPage{Hosts: hosts[start:end], Total: len(hosts)}
+	if end < len(hosts) {
+		page.Next = cursorAfter(page.Hosts)
+	}
+	return page
+}
+
+// hostBefore reports whether host comes before the cursor position in page order
+func hostBefore(host *models.HostSummary, c HostCursor) bool {
+	if !host.LastSeen.Equal(c.LastSeen) {
+		return host.LastSeen.After(c.LastSeen)
+	}
+	return host.HostID < c.HostID
+}
+
+// atCursor reports whether host is the one the cursor points at
+func atCursor(host *models.HostSummary, c HostCursor) bool {
+	return host.LastSeen.Equal(c.LastSeen) && host.HostID == c.HostID
+}
+
+// cursorAfter returns the cursor following the last host of a page
+func cursorAfter(hosts []*models.HostSummary) *HostCursor {
+	last := hosts[len(hosts)-1]
+	return &HostCursor{LastSeen: last.LastSeen, HostID: last.HostID}
+}
+
+// hostsAfter selects the hosts following the cursor in page order
+func hostsAfter(c *HostCursor) sqlbuilder.Cond {
+	return sqlbuilder.Expr("(received_at < ? OR (received_at = ? AND host_id > ?))", c.LastSeen, c.LastSeen, c.HostID)
+}
+
+// clampHostPageSize applies the default and maximum page size
+func clampHostPageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultHostPageSize
+	}
+	if limit > MaxHostPageSize {
+		return MaxHostPageSize
+	}
+	return limit
+}
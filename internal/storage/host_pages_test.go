@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"snailbus/internal/models"
+)
+
+func TestHostCursor(t *testing.T) {
+	cursor := HostCursor{LastSeen: time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC), HostID: testHostID1}
+	parsed, err := ParseHostCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("ParseHostCursor() error = %v", err)
+	}
+	if !parsed.LastSeen.Equal(cursor.LastSeen) || parsed.HostID != cursor.HostID {
+		t.Errorf("ParseHostCursor() = %+v, want %+v", parsed, cursor)
+	}
+
+	for _, s := range []string{"", "not base64!", "MjAyNg", HostCursor{HostID: ""}.String()} {
+		if _, err := ParseHostCursor(s); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseHostCursor(%q) error = %v, want ErrInvalidInput", s, err)
+		}
+	}
+}
+
+func TestPageHosts(t *testing.T) {
+	now := time.Now()
+	// host-b and host-c reported at the same time; the host ID breaks the tie
+	hosts := []*models.HostSummary{
+		{HostID: "host-a", LastSeen: now.Add(-time.Hour)},
+		{HostID: "host-c", LastSeen: now},
+		{HostID: "host-d", LastSeen: now.Add(-2 * time.Hour)},
+		{HostID: "host-b", LastSeen: now},
+	}
+
+	var ids []string
+	var after *HostCursor
+	for pages := 1; ; pages++ {
+		page := PageHosts(hosts, after, 3)
+		if page.Total != 4 {
+			t.Errorf("page %d: Total = %d, want 4", pages, page.Total)
+		}
+		for _, host := range page.Hosts {
+			ids = append(ids, host.HostID)
+		}
+		if page.Next == nil {
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+			break
+		}
+		after = page.Next
+	}
+
+	want := []string{"host-b", "host-c", "host-a", "host-d"}
+	if len(ids) != len(want) {
+		t.Fatalf("paged hosts = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("paged hosts = %v, want %v", ids, want)
+			break
+		}
+	}
+
+	// A cursor whose host has since reported again still continues after its position
+	page := PageHosts(hosts, &HostCursor{LastSeen: now.Add(-90 * time.Minute), HostID: "host-x"}, 0)
+	if len(page.Hosts) != 1 || page.Hosts[0].HostID != "host-d" || page.Next != nil {
+		t.Errorf("PageHosts() after a stale cursor = %+v, want only host-d", page)
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+	"snailbus/internal/sqlbuilder"
+)
+
+// hostFilterConditions translates a structured host search into SQL conditions on
+// hosts, each served by an index: a trigram index on the lowercased hostname and a
+// GIN index on the installed packages (migration 000042), and an index on the OS
+// name and version columns (migration 000046).
+func hostFilterConditions(filter models.HostSearchFilter) []sqlbuilder.Cond {
+	var conditions []sqlbuilder.Cond
+	if filter.Hostname != "" {
+		conditions = append(conditions, sqlbuilder.Expr(`lower(hostname) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Hostname))+"%"))
+	}
+	if filter.OSName != "" {
+		conditions = append(conditions, sqlbuilder.Eq("lower(os_name)", strings.ToLower(filter.OSName)))
+	}
+	if filter.OSVersion != "" {
+		conditions = append(conditions, sqlbuilder.Or(
+			sqlbuilder.Eq("os_version", filter.OSVersion),
+			sqlbuilder.Expr(`os_version LIKE ? ESCAPE '\'`, escapeLike(filter.OSVersion)+".%"),
+		))
+	}
+	for _, name := range filter.Packages {
+		// Containment on the array is what the jsonb_path_ops index answers
+		installed, _ := json.Marshal([]map[string]string{{"name": name}})
+		conditions = append(conditions, sqlbuilder.Expr("data->'packages'->'installed' @> ?::jsonb", string(installed)))
+	}
+	if filter.LastSeenAfter != nil {
+		conditions = append(conditions, sqlbuilder.Expr("received_at >= ?", *filter.LastSeenAfter))
+	}
+	if filter.LastSeenBefore != nil {
+		conditions = append(conditions, sqlbuilder.Expr("received_at < ?", *filter.LastSeenBefore))
+	}
+	return conditions
+}
+
+// escapeLike escapes the LIKE wildcards in s, so it only matches itself
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// matchesHostFilter evaluates a structured host search the way hostFilterConditions
+// does in SQL; packages are the host's installed packages (see parsePackages)
+func matchesHostFilter(filter models.HostSearchFilter, host *models.HostSummary, packages []search.Package) bool {
+	if filter.Hostname != "" && !strings.Contains(strings.ToLower(host.Hostname), strings.ToLower(filter.Hostname)) {
+		return false
+	}
+	if filter.OSName != "" && !strings.EqualFold(host.OSName, filter.OSName) {
+		return false
+	}
+	if filter.OSVersion != "" && host.OSVersion != filter.OSVersion && !strings.HasPrefix(host.OSVersion, filter.OSVersion+".") {
+		return false
+	}
+	for _, name := range filter.Packages {
+		installed := false
+		for _, pkg := range packages {
+			if pkg.Name == name {
+				installed = true
+				break
+			}
+		}
+		if !installed {
+			return false
+		}
+	}
+	if filter.LastSeenAfter != nil && host.LastSeen.Before(*filter.LastSeenAfter) {
+		return false
+	}
+	if filter.LastSeenBefore != nil && !host.LastSeen.Before(*filter.LastSeenBefore) {
+		return false
+	}
+	return true
+}
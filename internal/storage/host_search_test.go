@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+)
+
+func TestMatchesHostFilter(t *testing.T) {
+	lastSeen := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	host := &models.HostSummary{Hostname: "Web-01", OSName: "Ubuntu", OSVersion: "22.04", LastSeen: lastSeen}
+	packages := []search.Package{{Name: "nginx"}, {Name: "openssl"}}
+	before, after := lastSeen.Add(-time.Minute), lastSeen.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		filter models.HostSearchFilter
+		want   bool
+	}{
+		{"empty", models.HostSearchFilter{}, true},
+		{"hostname substring", models.HostSearchFilter{Hostname: "web"}, true},
+		{"hostname mismatch", models.HostSearchFilter{Hostname: "db"}, false},
+		{"os name ignores case", models.HostSearchFilter{OSName: "ubuntu"}, true},
+		{"os version", models.HostSearchFilter{OSVersion: "22.04"}, true},
+		{"os version segment", models.HostSearchFilter{OSVersion: "22"}, true},
+		{"os version partial segment", models.HostSearchFilter{OSVersion: "2"}, false},
+		{"packages", models.HostSearchFilter{Packages: []string{"openssl", "nginx"}}, true},
+		{"missing package", models.HostSearchFilter{Packages: []string{"openssl", "curl"}}, false},
+		{"last seen after", models.HostSearchFilter{LastSeenAfter: &lastSeen}, true},
+		{"last seen after later", models.HostSearchFilter{LastSeenAfter: &after}, false},
+		{"last seen before is exclusive", models.HostSearchFilter{LastSeenBefore: &lastSeen}, false},
+		{"last seen before later", models.HostSearchFilter{LastSeenBefore: &after, LastSeenAfter: &before}, true},
+	}
+	for _, tt := range tests {
+		if got := matchesHostFilter(tt.filter, host, packages); got != tt.want {
+			t.Errorf("matchesHostFilter(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got, want := escapeLike(`web_01%\`), `web\_01\%\\`; got != want {
+		t.Errorf("escapeLike() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxHostDataPaths and MaxHostDataPathLength bound the data paths of a HostSelection
+const (
+	MaxHostDataPaths      = 20
+	MaxHostDataPathLength = 256
+)
+
+// HostSelection picks what GetHostSelection loads of a host's report data. The zero
+// value loads all of it, like GetHost.
+type HostSelection struct {
+	OmitData bool       // Load no data at all
+	Paths    [][]string // Load only these paths of the data (see ParseHostDataPath); nil loads all of it
+}
+
+// ParseHostDataPath splits a dot-separated path into the report data, such as
+// system.packages, into its keys. A key that is a number also indexes arrays, counting
+// from the end if negative, as the jsonb #> operator does.
+// Returns an error matching ErrInvalidInput if it is malformed.
+func ParseHostDataPath(s string) ([]string, error) {
+	if s == "" || len(s) > MaxHostDataPathLength {
+		return nil, fmt.Errorf("%w: path must be 1 to %d characters", ErrInvalidInput, MaxHostDataPathLength)
+	}
+	keys := strings.Split(s, ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("%w: path %q has an empty key", ErrInvalidInput, s)
+		}
+	}
+	return keys, nil
+}
+
+// extractDataPath returns the value at path in data, nil if there is none. It walks the
+// data the way the jsonb #> operator does in SQL.
+func extractDataPath(data json.RawMessage, path []string) json.RawMessage {
+	value := data
+	for _, key := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err == nil && object != nil {
+			value = object[key]
+		} else {
+			var array []json.RawMessage
+			if err := json.Unmarshal(value, &array); err != nil {
+				return nil
+			}
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				return nil
+			}
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 || i >= len(array) {
+				return nil
+			}
+			value = array[i]
+		}
+		if value == nil {
+			return nil
+		}
+	}
+	return value
+}
+
+// nestDataPaths rebuilds the parts of a report's data found at paths, values[i] being
+// the value at paths[i] or null if there is none, so a selection keeps the data's shape:
+// system.packages is returned as {"system": {"packages": ...}}. Paths with no value are
+// left out; a path inside another selected path is already part of it.
+func nestDataPaths(paths [][]string, values []json.RawMessage) (json.RawMessage, error) {
+	root := map[string]interface{}{}
+	for i, path := range paths {
+		value := values[i]
+		if len(value) == 0 || string(value) == "null" {
+			continue
+		}
+		parent := root
+		for _, key := range path[:len(path)-1] {
+			child, ok := parent[key]
+			if !ok {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			next, ok := child.(map[string]interface{})
+			if !ok {
+				parent = nil // An enclosing path was selected whole
+				break
+			}
+			parent = next
+		}
+		if parent != nil {
+			parent[path[len(path)-1]] = value
+		}
+	}
+	return json.Marshal(root)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseHostDataPath(t *testing.T) {
+	keys, err := ParseHostDataPath("system.packages")
+	if err != nil {
+		t.Fatalf("ParseHostDataPath() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "system" || keys[1] != "packages" {
+		t.Errorf("ParseHostDataPath() = %v, want [system packages]", keys)
+	}
+
+	for _, s := range []string{"", ".", "system.", ".system", "system..packages", string(make([]byte, MaxHostDataPathLength+1))} {
+		if _, err := ParseHostDataPath(s); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseHostDataPath(%q) error = %v, want ErrInvalidInput", s, err)
+		}
+	}
+}
+
+func TestExtractDataPath(t *testing.T) {
+	data := json.RawMessage(`{"system": {"os_name": "Fedora"}, "network": {"interfaces": [{"name": "lo"}, {"name": "eth0"}]}, "empty": null}`)
+
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"system"}, `{"os_name": "Fedora"}`},
+		{[]string{"system", "os_name"}, `"Fedora"`},
+		{[]string{"network", "interfaces", "1", "name"}, `"eth0"`},
+		{[]string{"network", "interfaces", "-2", "name"}, `"lo"`},
+		{[]string{"network", "interfaces", "2"}, ""},
+		{[]string{"network", "interfaces", "name"}, ""},
+		{[]string{"system", "os_name", "version"}, ""},
+		{[]string{"empty", "key"}, ""},
+		{[]string{"missing"}, ""},
+	}
+	for _, tt := range tests {
+		got := extractDataPath(data, tt.path)
+		if tt.want == "" {
+			if got != nil {
+				t.Errorf("extractDataPath(%v) = %s, want none", tt.path, got)
+			}
+			continue
+		}
+		if !jsonEqual(t, got, tt.want) {
+			t.Errorf("extractDataPath(%v) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNestDataPaths(t *testing.T) {
+	paths := [][]string{{"system", "os_name"}, {"system"}, {"network", "interfaces"}, {"missing"}, {"packages", "installed"}}
+	values := []json.RawMessage{
+		json.RawMessage(`"Fedora"`),
+		json.RawMessage(`{"os_name": "Fedora", "arch": "x86_64"}`),
+		json.RawMessage(`[{"name": "eth0"}]`),
+		json.RawMessage(`null`),
+		nil,
+	}
+	got, err := nestDataPaths(paths, values)
+	if err != nil {
+		t.Fatalf("nestDataPaths() error = %v", err)
+	}
+	want := `{"system": {"os_name": "Fedora", "arch": "x86_64"}, "network": {"interfaces": [{"name": "eth0"}]}}`
+	if !jsonEqual(t, got, want) {
+		t.Errorf("nestDataPaths() = %s, want %s", got, want)
+	}
+}
+
+// jsonEqual reports whether got and want hold the same JSON value
+func jsonEqual(t *testing.T, got json.RawMessage, want string) bool {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid want %s: %v", want, err)
+	}
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	return string(gb) == string(wb)
+}
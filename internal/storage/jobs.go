@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+)
+
+// LockJob takes the session advisory lock of a job on a connection of its own, held
+// until unlock. The lock is released with the session, so a replica that dies mid-run
+// does not keep the job from running elsewhere.
+func (ps *PostgresStorage) LockJob(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := ps.pool.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get connection for job lock: %w", classifyError(err))
+	}
+
+	key := "job:" + name
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to lock job: %w", classifyError(err))
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		defer conn.Close()
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			logger.Logger.Error().Err(err).Str("job", name).Msg("Failed to unlock job; discarding its connection")
+			// A connection returned to the pool would keep holding the lock
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}
+	return unlock, true, nil
+}
+
+// StartJobRun records the start of a job's run
+func (ps *PostgresStorage) StartJobRun(name, runner string, startedAt time.Time) error {
+	_, err := ps.db.Exec(`
+		INSERT INTO background_jobs (name, last_runner, last_started_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET last_runner = EXCLUDED.last_runner, last_started_at = EXCLUDED.last_started_at
+	`, name, runner, startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record job start: %w", classifyError(err))
+	}
+	return nil
+}
+
+// FinishJobRun records the end of a job's run and counts it
+func (ps *PostgresStorage) FinishJobRun(name string, finishedAt time.Time, runErr string) error {
+	_, err := ps.db.Exec(`
+		UPDATE background_jobs SET
+			last_finished_at = $2,
+			last_error = $3,
+			last_success_at = CASE WHEN $3 = '' THEN $2 ELSE last_success_at END,
+			runs = runs + 1,
+			failures = failures + CASE WHEN $3 = '' THEN 0 ELSE 1 END
+		WHERE name = $1
+	`, name, finishedAt, runErr)
+	if err != nil {
+		return fmt.Errorf("failed to record job finish: %w", classifyError(err))
+	}
+	return nil
+}
+
+// ListJobStatuses returns the last run of every job that has run, by name
+func (ps *PostgresStorage) ListJobStatuses() ([]*models.JobStatus, error) {
+	rows, err := ps.db.Query(`
+		SELECT name, last_runner, last_started_at, last_finished_at, last_success_at, last_error, runs, failures
+		FROM background_jobs
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	statuses := []*models.JobStatus{}
+	for rows.Next() {
+		status := &models.JobStatus{}
+		var started, finished, succeeded sql.NullTime
+		if err := rows.Scan(&status.Name, &status.LastRunner, &started, &finished, &succeeded,
+			&status.LastError, &status.Runs, &status.Failures); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		status.LastStartedAt = utcTime(started)
+		status.LastFinishedAt = utcTime(finished)
+		status.LastSuccessAt = utcTime(succeeded)
+		status.Running = jobRunning(status)
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return statuses, nil
+}
+
+// jobRunning reports whether the job's last run started has not finished
+func jobRunning(status *models.JobStatus) bool {
+	return status.LastStartedAt != nil &&
+		(status.LastFinishedAt == nil || status.LastFinishedAt.Before(*status.LastStartedAt))
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"snailbus/internal/dbadvisor"
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+	"snailbus/internal/models"
+)
+
+// tableMaintenanceQuery reads the statistics of the tables in the current schema, largest first
+const tableMaintenanceQuery = `
+	SELECT s.relname, c.relkind = 'p' OR c.relispartition,
+		COALESCE((SELECT option_value::int FROM pg_options_to_table(c.reloptions) WHERE option_name = 'fillfactor'), 100),
+		pg_table_size(c.oid), pg_indexes_size(c.oid),
+		s.n_live_tup, s.n_dead_tup, s.n_mod_since_analyze, s.n_tup_ins, s.n_tup_upd, s.n_tup_hot_upd, s.n_tup_del,
+		s.vacuum_count, s.autovacuum_count, s.autoanalyze_count,
+		s.last_vacuum, s.last_autovacuum, s.last_analyze, s.last_autoanalyze
+	FROM pg_stat_user_tables s
+	JOIN pg_class c ON c.oid = s.relid
+	WHERE s.schemaname = current_schema()
+	ORDER BY pg_total_relation_size(c.oid) DESC, s.relname
+`
+
+// indexMaintenanceQuery reads the size and scans of the indexes in the current schema
+const indexMaintenanceQuery = `
+	SELECT s.relname, s.indexrelname, pg_relation_size(s.indexrelid), s.idx_scan, i.indisunique
+	FROM pg_stat_user_indexes s
+	JOIN pg_index i ON i.indexrelid = s.indexrelid
+	WHERE s.schemaname = current_schema()
+	ORDER BY s.relname, s.indexrelname
+`
+
+// runningVacuumsQuery reads the progress of the vacuums running on tables in the current schema
+const runningVacuumsQuery = `
+	SELECT p.pid, c.relname, COALESCE(a.backend_type = 'autovacuum worker', false), p.phase,
+		p.heap_blks_total, p.heap_blks_vacuumed,
+		COALESCE(EXTRACT(EPOCH FROM (NOW() - a.xact_start)), 0)::float8
+	FROM pg_stat_progress_vacuum p
+	JOIN pg_class c ON c.oid = p.relid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_stat_activity a ON a.pid = p.pid
+	WHERE p.datname = current_database() AND n.nspname = current_schema()
+	ORDER BY p.pid
+`
+
+// DBMaintenance reports the size, dead tuples, and vacuum activity of the snailbus tables,
+// with the changes dbadvisor suggests, and records them as metrics
+func (ps *PostgresStorage) DBMaintenance(ctx context.Context) (*models.DBMaintenance, error) {
+	report := &models.DBMaintenance{CollectedAt: time.Now().UTC()}
+
+	var statsReset sql.NullTime
+	err := ps.db.QueryRowContext(ctx, `SELECT stats_reset FROM pg_stat_database WHERE datname = current_database()`).
+		Scan(&statsReset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get statistics reset time: %w", err)
+	}
+	if statsReset.Valid {
+		t := statsReset.Time.UTC()
+		report.StatsResetAt = &t
+	}
+
+	if report.Tables, err = ps.tableMaintenance(ctx); err != nil {
+		return nil, err
+	}
+	if report.RunningVacuums, err = ps.runningVacuums(ctx); err != nil {
+		return nil, err
+	}
+	report.Advice = dbadvisor.Advise(report.Tables, report.CollectedAt)
+
+	recordMaintenanceMetrics(report)
+	return report, nil
+}
+
+// tableMaintenance reads the statistics of the tables and their indexes
+func (ps *PostgresStorage) tableMaintenance(ctx context.Context) ([]models.TableMaintenance, error) {
+	rows, err := ps.db.QueryContext(ctx, tableMaintenanceQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	tables := []models.TableMaintenance{}
+	for rows.Next() {
+		t := models.TableMaintenance{Indexes: []models.IndexMaintenance{}}
+		var lastVacuum, lastAutovacuum, lastAnalyze, lastAutoanalyze sql.NullTime
+		if err := rows.Scan(&t.Table, &t.Partitioned, &t.FillFactor, &t.TableBytes, &t.IndexBytes,
+			&t.LiveTuples, &t.DeadTuples, &t.ModsSinceAnalyze, &t.Inserts, &t.Updates, &t.HOTUpdates, &t.Deletes,
+			&t.VacuumCount, &t.AutovacuumCount, &t.AutoanalyzeCount,
+			&lastVacuum, &lastAutovacuum, &lastAnalyze, &lastAutoanalyze); err != nil {
+			return nil, fmt.Errorf("failed to scan table statistics: %w", err)
+		}
+		t.LastVacuum = utcTime(lastVacuum)
+		t.LastAutovacuum = utcTime(lastAutovacuum)
+		t.LastAnalyze = utcTime(lastAnalyze)
+		t.LastAutoanalyze = utcTime(lastAutoanalyze)
+		deriveMaintenance(&t)
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get table statistics: %w", err)
+	}
+
+	byName := make(map[string]*models.TableMaintenance, len(tables))
+	for i := range tables {
+		byName[tables[i].Table] = &tables[i]
+	}
+	indexRows, err := ps.db.QueryContext(ctx, indexMaintenanceQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index statistics: %w", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var table string
+		var index models.IndexMaintenance
+		if err := indexRows.Scan(&table, &index.Name, &index.Bytes, &index.Scans, &index.Unique); err != nil {
+			return nil, fmt.Errorf("failed to scan index statistics: %w", err)
+		}
+		if t := byName[table]; t != nil {
+			t.Indexes = append(t.Indexes, index)
+		}
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get index statistics: %w", err)
+	}
+	return tables, nil
+}
+
+// runningVacuums reads the progress of the vacuums running on the tables
+func (ps *PostgresStorage) runningVacuums(ctx context.Context) ([]models.VacuumProgress, error) {
+	rows, err := ps.db.QueryContext(ctx, runningVacuumsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vacuum progress: %w", err)
+	}
+	defer rows.Close()
+
+	vacuums := []models.VacuumProgress{}
+	for rows.Next() {
+		var v models.VacuumProgress
+		if err := rows.Scan(&v.PID, &v.Table, &v.Autovacuum, &v.Phase,
+			&v.HeapBlocksTotal, &v.HeapBlocksVacuumed, &v.DurationSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan vacuum progress: %w", err)
+		}
+		vacuums = append(vacuums, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get vacuum progress: %w", err)
+	}
+	return vacuums, nil
+}
+
+// deriveMaintenance computes a table's ratios and estimates the space its dead tuples
+// hold in the table and its indexes
+func deriveMaintenance(t *models.TableMaintenance) {
+	if tuples := t.LiveTuples + t.DeadTuples; tuples > 0 {
+		t.DeadTupleRatio = float64(t.DeadTuples) / float64(tuples)
+	}
+	if t.Updates > 0 {
+		t.HOTUpdateRatio = float64(t.HOTUpdates) / float64(t.Updates)
+	}
+	t.EstimatedBloatBytes = int64(float64(t.TableBytes+t.IndexBytes) * t.DeadTupleRatio)
+}
+
+// utcTime returns a nullable timestamp as a UTC pointer
+func utcTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// recordMaintenanceMetrics exports a maintenance report as gauges
+func recordMaintenanceMetrics(report *models.DBMaintenance) {
+	metrics.DBTableLiveTuples.Reset()
+	metrics.DBTableDeadTuples.Reset()
+	metrics.DBTableSizeBytes.Reset()
+	metrics.DBTableEstimatedBloatBytes.Reset()
+	metrics.DBTableHOTUpdateRatio.Reset()
+	metrics.DBTableAutovacuums.Reset()
+	metrics.DBTableLastAutovacuum.Reset()
+	for _, t := range report.Tables {
+		metrics.DBTableLiveTuples.WithLabelValues(t.Table).Set(float64(t.LiveTuples))
+		metrics.DBTableDeadTuples.WithLabelValues(t.Table).Set(float64(t.DeadTuples))
+		metrics.DBTableSizeBytes.WithLabelValues(t.Table, "table").Set(float64(t.TableBytes))
+		metrics.DBTableSizeBytes.WithLabelValues(t.Table, "indexes").Set(float64(t.IndexBytes))
+		metrics.DBTableEstimatedBloatBytes.WithLabelValues(t.Table).Set(float64(t.EstimatedBloatBytes))
+		metrics.DBTableHOTUpdateRatio.WithLabelValues(t.Table).Set(t.HOTUpdateRatio)
+		metrics.DBTableAutovacuums.WithLabelValues(t.Table).Set(float64(t.AutovacuumCount))
+		if t.LastAutovacuum != nil {
+			metrics.DBTableLastAutovacuum.WithLabelValues(t.Table).Set(float64(t.LastAutovacuum.Unix()))
+		}
+	}
+	metrics.DBVacuumsRunning.Set(float64(len(report.RunningVacuums)))
+
+	metrics.DBMaintenanceAdvice.Reset()
+	for _, a := range report.Advice {
+		metrics.DBMaintenanceAdvice.WithLabelValues(a.Kind, a.Severity).Inc()
+	}
+}
+
+// RunMaintenanceMonitor refreshes the table maintenance metrics every interval until ctx is done
+func (ps *PostgresStorage) RunMaintenanceMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := ps.DBMaintenance(ctx); err != nil && ctx.Err() == nil {
+			logger.Logger.Warn().Err(err).Msg("Failed to collect table maintenance statistics")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
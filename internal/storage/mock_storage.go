@@ -1,19 +1,59 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"snailbus/internal/auth"
+	"snailbus/internal/dbadvisor"
 	"snailbus/internal/models"
+	"snailbus/internal/search"
 )
 
+// errInjected is returned by operations configured to fail
+var errInjected = errors.New("mock: injected failure")
+
 // MockStorage is a mock implementation of the Storage interface for testing
 type MockStorage struct {
 	mu sync.RWMutex
 
+	mockState
+
+	// Database administration (see SetDBActivity, SetReplicationStatus, SetMigrationVersion)
+	dbActivity       []*models.DBActivity
+	replication      *models.ReplicationStatus
+	privileges       *models.DatabasePrivileges
+	maintenance      *models.DBMaintenance
+	migrationVersion uint
+
+	// Background jobs whose lock is held (see LockJob)
+	jobLocks map[string]bool
+
+	// Monthly host report partitions (see EnsureHostReportPartitions)
+	hostReportPartitions map[string]bool
+
+	// Error injection
+	shouldErrorOnSaveHost     bool
+	shouldErrorOnGetHost      bool
+	shouldErrorOnDeleteHost   bool
+	shouldErrorOnListHosts    bool
+	shouldErrorOnCreateUser   bool
+	shouldErrorOnGetUser      bool
+	shouldErrorOnCreateAPIKey bool
+	shouldErrorOnCreateOrg    bool
+}
+
+// mockState is the data a MockStorage holds, which WithTx restores on rollback
+type mockState struct {
 	// Hosts storage
-	hosts      map[string]*models.Report // key: hostID
+	hosts      map[string]*models.Report // key: hostKey(orgID, hostID)
 	hostsByOrg map[string][]string       // orgID -> []hostID
 
 	// Users storage
@@ -23,6 +63,9 @@ type MockStorage struct {
 	usersByOrg      map[string][]string     // orgID -> []userID
 	passwords       map[string]string       // userID -> passwordHash
 
+	// Memberships of organizations other than the user's own
+	orgMemberships map[string]map[string]*models.OrgMembership // userID -> orgID -> membership
+
 	// API Keys storage
 	apiKeys         map[string]*models.APIKey // key: apiKeyID
 	apiKeysByUser   map[string][]string       // userID -> []apiKeyID
@@ -30,22 +73,99 @@ type MockStorage struct {
 
 	// Organizations storage
 	organizations       map[string]*models.Organization // key: orgID
-	organizationsByName map[string]string               // name -> orgID
+	organizationsByName map[string]string               // lowercased name -> orgID
 
-	// Error injection
-	shouldErrorOnSaveHost     bool
-	shouldErrorOnGetHost      bool
-	shouldErrorOnDeleteHost   bool
-	shouldErrorOnListHosts    bool
-	shouldErrorOnCreateUser   bool
-	shouldErrorOnGetUser      bool
-	shouldErrorOnCreateAPIKey bool
-	shouldErrorOnCreateOrg    bool
+	// Host tags, details, and access policies
+	hostTags     map[string][]string           // host key -> tags
+	hostDetails  map[string]models.HostDetails // host key -> display name and description
+	hostArchived map[string]time.Time          // host key -> when it was archived
+	hostStale    map[string]time.Time          // host key -> when it was marked stale
+	hostVersions map[string]int64              // host key -> metadata version, 1 when absent
+	hostAccess   map[string][]string           // orgID/userID -> allowed tags
+
+	// Ingest receipts
+	receipts     map[string]*models.Receipt // key: receiptID
+	receiptOrgID map[string]string          // receiptID -> orgID
+
+	// Host probes
+	probeJobs     map[string]*models.ProbeJob    // key: jobID (includes results)
+	probeJobOrgID map[string]string              // jobID -> orgID
+	probeJobOrder []string                       // jobIDs in creation order
+	lastProbe     map[string]*models.ProbeResult // host key -> latest result
+
+	// Host event stream, in append order
+	hostEvents []*models.HostEvent
+
+	// Outbound actions, their runs, and organization secrets
+	actions     map[string]*models.Action    // key: actionID
+	actionOrgID map[string]string            // actionID -> orgID
+	actionOrder []string                     // actionIDs in creation order
+	actionRuns  map[string]*models.ActionRun // key: runID
+	runOrder    []string                     // runIDs in creation order
+	orgSecrets  map[string]map[string]mockSecret
+
+	// Webhooks and their delivery log
+	webhooks          map[string]*models.Webhook         // key: webhookID
+	webhookOrgID      map[string]string                  // webhookID -> orgID
+	webhookOrder      []string                           // webhookIDs in creation order
+	webhookDeliveries map[string]*models.WebhookDelivery // key: deliveryID
+	webhookDedupKeys  map[string]string                  // deliveryID -> dedup key
+	deliveryOrder     []string                           // deliveryIDs in creation order
+
+	// Audit log, in ID order
+	auditEvents []*models.AuditEvent
+
+	// Prometheus remote-write targets
+	remoteWrite map[string]*models.RemoteWriteConfig // key: orgID
+
+	// Ingest filters
+	ingestFilters    map[string]*models.IngestFilter    // key: orgID
+	hostTagRules     map[string]*models.HostTagRules    // key: orgID
+	checkinSchedules map[string]*models.CheckinSchedule // key: orgID
+
+	// Host report history, newest first, and retention overrides
+	hostReports         map[string][]*models.HostReport        // host key -> reports
+	hostReportRetention map[string]*models.HostReportRetention // key: orgID
+
+	// Fleet reports, in creation order, and report schedules
+	fleetReports    []*models.FleetReport
+	reportSchedules map[string]*models.ReportSchedule // key: orgID
+
+	// Offline bundle import batches, in creation order
+	importBatches    []*models.ImportBatch
+	importBatchOrgID map[string]string // batchID -> orgID
+
+	// Delegated token clients, pending authorization codes, and grants
+	oauthClients map[string]*models.OAuthClient // key: clientID
+	oauthCodes   map[string]*models.OAuthCode   // key: code hash
+	oauthGrants  map[string]*models.OAuthGrant  // key: grantID
+	sessions     map[string]*models.Session     // key: sessionID
+
+	// Tokens system administrators impersonate users with
+	impersonationTokens map[string]*models.ImpersonationToken // key: token ID
+
+	// Tokens agents enroll with
+	enrollmentTokens map[string]*models.EnrollmentToken // key: token ID
+
+	// Last runs of the scheduled background jobs
+	jobStatuses map[string]*models.JobStatus // key: name
+
+	// Feature flags with their organization overrides
+	featureFlags map[string]*models.FeatureFlag // key: name
+
+	// IOC lists with their indicators, and the matches found in hosts' reports
+	iocLists     map[string]*models.IOCList  // key: listID
+	iocListOrgID map[string]string           // listID -> orgID
+	iocMatches   map[string]*models.IOCMatch // key: list ID, host ID, type, and value
+
+	// Host groups with their static members
+	hostGroups     map[string]*models.HostGroup // key: groupID
+	hostGroupOrgID map[string]string            // groupID -> orgID
 }
 
 // NewMockStorage creates a new mock storage instance
 func NewMockStorage() *MockStorage {
-	return &MockStorage{
+	return &MockStorage{mockState: mockState{
 		hosts:               make(map[string]*models.Report),
 		hostsByOrg:          make(map[string][]string),
 		users:               make(map[string]*models.User),
@@ -58,7 +178,48 @@ func NewMockStorage() *MockStorage {
 		apiKeysByPrefix:     make(map[string][]string),
 		organizations:       make(map[string]*models.Organization),
 		organizationsByName: make(map[string]string),
-	}
+		hostTags:            make(map[string][]string),
+		hostDetails:         make(map[string]models.HostDetails),
+		hostVersions:        make(map[string]int64),
+		hostArchived:        make(map[string]time.Time),
+		hostStale:           make(map[string]time.Time),
+		hostAccess:          make(map[string][]string),
+		receipts:            make(map[string]*models.Receipt),
+		receiptOrgID:        make(map[string]string),
+		probeJobs:           make(map[string]*models.ProbeJob),
+		probeJobOrgID:       make(map[string]string),
+		lastProbe:           make(map[string]*models.ProbeResult),
+		actions:             make(map[string]*models.Action),
+		actionOrgID:         make(map[string]string),
+		actionRuns:          make(map[string]*models.ActionRun),
+		webhooks:            make(map[string]*models.Webhook),
+		webhookOrgID:        make(map[string]string),
+		webhookDeliveries:   make(map[string]*models.WebhookDelivery),
+		webhookDedupKeys:    make(map[string]string),
+		orgSecrets:          make(map[string]map[string]mockSecret),
+		remoteWrite:         make(map[string]*models.RemoteWriteConfig),
+		ingestFilters:       make(map[string]*models.IngestFilter),
+		hostTagRules:        make(map[string]*models.HostTagRules),
+		checkinSchedules:    make(map[string]*models.CheckinSchedule),
+		hostReports:         make(map[string][]*models.HostReport),
+		hostReportRetention: make(map[string]*models.HostReportRetention),
+		reportSchedules:     make(map[string]*models.ReportSchedule),
+		importBatchOrgID:    make(map[string]string),
+		oauthClients:        make(map[string]*models.OAuthClient),
+		oauthCodes:          make(map[string]*models.OAuthCode),
+		oauthGrants:         make(map[string]*models.OAuthGrant),
+		sessions:            make(map[string]*models.Session),
+		impersonationTokens: make(map[string]*models.ImpersonationToken),
+		enrollmentTokens:    make(map[string]*models.EnrollmentToken),
+		jobStatuses:         make(map[string]*models.JobStatus),
+		featureFlags:        make(map[string]*models.FeatureFlag),
+		iocLists:            make(map[string]*models.IOCList),
+		iocListOrgID:        make(map[string]string),
+		iocMatches:          make(map[string]*models.IOCMatch),
+		hostGroups:          make(map[string]*models.HostGroup),
+		hostGroupOrgID:      make(map[string]string),
+		orgMemberships:      make(map[string]map[string]*models.OrgMembership),
+	}}
 }
 
 // SaveHost stores or updates a host's report
@@ -67,55 +228,71 @@ func (m *MockStorage) SaveHost(report *models.Report, orgID, uploadedByUserID st
 	defer m.mu.Unlock()
 
 	if m.shouldErrorOnSaveHost {
-		return ErrNotFound
+		return errInjected
 	}
 
-	// Check if host exists and verify org_id matches
-	if existing, exists := m.hosts[report.Meta.HostID]; exists {
-		// Find which org it belongs to
-		for org, hostIDs := range m.hostsByOrg {
-			for _, hid := range hostIDs {
-				if hid == report.Meta.HostID {
-					if org != orgID {
-						return ErrNotFound
-					}
-					break
-				}
-			}
-		}
-		_ = existing // Use existing to avoid unused variable
+	_, existed := m.hosts[hostKey(orgID, report.Meta.HostID)]
+
+	m.putHost(report, orgID)
+	m.appendHostEvent(snapshotEvent(report, orgID, uploadedByUserID, existed))
+	return nil
+}
+
+// SaveHosts stores or updates the reports of several hosts
+func (m *MockStorage) SaveHosts(reports []*models.Report, orgID, uploadedByUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shouldErrorOnSaveHost {
+		return errInjected
 	}
 
-	// Store host
-	m.hosts[report.Meta.HostID] = report
+	for _, report := range reports {
+		_, existed := m.hosts[hostKey(orgID, report.Meta.HostID)]
+		m.putHost(report, orgID)
+		m.appendHostEvent(snapshotEvent(report, orgID, uploadedByUserID, existed))
+	}
+	return nil
+}
 
-	// Update org mapping
-	if _, exists := m.hostsByOrg[orgID]; !exists {
-		m.hostsByOrg[orgID] = []string{}
+// putHost stores a report as the organization's copy of the host
+func (m *MockStorage) putHost(report *models.Report, orgID string) {
+	if !m.hostInOrg(report.Meta.HostID, orgID) {
+		m.hostsByOrg[orgID] = append(m.hostsByOrg[orgID], report.Meta.HostID)
 	}
-	// Remove from old org if exists
-	for org, hostIDs := range m.hostsByOrg {
-		newHostIDs := []string{}
-		for _, hid := range hostIDs {
-			if hid != report.Meta.HostID {
-				newHostIDs = append(newHostIDs, hid)
+	m.hosts[hostKey(orgID, report.Meta.HostID)] = report
+	delete(m.hostStale, hostKey(orgID, report.Meta.HostID))
+}
+
+// hostKey identifies a host within its organization
+// Host IDs are generated by agents, so only the pair is unique.
+func hostKey(orgID, hostID string) string {
+	return orgID + "/" + hostID
+}
+
+// appendHostEvent records an event, filling in its ID and timestamp
+// A snapshot compacts the host's previous one, as in PostgresStorage.
+func (m *MockStorage) appendHostEvent(event *models.HostEvent) {
+	if isSnapshotEvent(event.Type) {
+		for i := len(m.hostEvents) - 1; i >= 0; i-- {
+			previous := m.hostEvents[i]
+			if previous.OrgID != event.OrgID || previous.HostID != event.HostID || !isSnapshotEvent(previous.Type) {
+				continue
+			}
+			if previous.Payload != nil && previous.Payload.Report != nil {
+				// Copies, so the state WithTx restores on rollback keeps the full report
+				compacted, payload, report := *previous, *previous.Payload, *previous.Payload.Report
+				report.Data = compactReportData(report.Data)
+				payload.Report = &report
+				compacted.Payload = &payload
+				m.hostEvents[i] = &compacted
 			}
-		}
-		m.hostsByOrg[org] = newHostIDs
-	}
-	// Add to new org
-	found := false
-	for _, hid := range m.hostsByOrg[orgID] {
-		if hid == report.Meta.HostID {
-			found = true
 			break
 		}
 	}
-	if !found {
-		m.hostsByOrg[orgID] = append(m.hostsByOrg[orgID], report.Meta.HostID)
-	}
-
-	return nil
+	event.ID = int64(len(m.hostEvents) + 1)
+	event.CreatedAt = time.Now().UTC()
+	m.hostEvents = append(m.hostEvents, event)
 }
 
 // GetHost returns the full report data for a specific host
@@ -124,221 +301,925 @@ func (m *MockStorage) GetHost(hostID, orgID string) (*models.Report, error) {
 	defer m.mu.RUnlock()
 
 	if m.shouldErrorOnGetHost {
-		return nil, ErrNotFound
+		return nil, errInjected
 	}
 
-	report, exists := m.hosts[hostID]
+	report, exists := m.hosts[hostKey(orgID, hostID)]
 	if !exists {
 		return nil, ErrNotFound
 	}
+	return report, nil
+}
 
-	// Verify org_id
-	hostIDs, exists := m.hostsByOrg[orgID]
-	if !exists {
-		return nil, ErrNotFound
+// GetHostSelection returns a host's report with only the selected parts of its data
+func (m *MockStorage) GetHostSelection(hostID, orgID string, sel HostSelection) (*models.Report, error) {
+	report, err := m.GetHost(hostID, orgID)
+	if err != nil || (!sel.OmitData && sel.Paths == nil) {
+		return report, err
 	}
-	for _, hid := range hostIDs {
-		if hid == hostID {
-			return report, nil
+
+	selected := *report
+	selected.Data = nil
+	if !sel.OmitData {
+		values := make([]json.RawMessage, len(sel.Paths))
+		for i, path := range sel.Paths {
+			values[i] = extractDataPath(report.Data, path)
+		}
+		if selected.Data, err = nestDataPaths(sel.Paths, values); err != nil {
+			return nil, err
 		}
 	}
+	return &selected, nil
+}
 
-	return nil, ErrNotFound
+// GetHostHealth returns the health from a host's last report
+func (m *MockStorage) GetHostHealth(hostID, orgID string) (*models.HostHealth, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shouldErrorOnGetHost {
+		return nil, errInjected
+	}
+
+	report, exists := m.hosts[hostKey(orgID, hostID)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return report.Health, nil
 }
 
 // DeleteHost removes a host
-func (m *MockStorage) DeleteHost(hostID, orgID string) error {
+func (m *MockStorage) DeleteHost(hostID, orgID, actorUserID string, deletion *models.HostDeletion) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.shouldErrorOnDeleteHost {
-		return ErrNotFound
+		return errInjected
 	}
 
 	// Verify org_id
-	hostIDs, exists := m.hostsByOrg[orgID]
-	if !exists {
-		return ErrNotFound
-	}
-	found := false
-	for _, hid := range hostIDs {
-		if hid == hostID {
-			found = true
-			break
-		}
-	}
-	if !found {
+	if !m.hostInOrg(hostID, orgID) {
 		return ErrNotFound
 	}
 
-	// Delete host
-	delete(m.hosts, hostID)
+	hostname := m.hosts[hostKey(orgID, hostID)].Meta.Hostname
+	m.removeHost(hostID, orgID)
+	m.appendHostEvent(&models.HostEvent{
+		OrgID:       orgID,
+		HostID:      hostID,
+		Hostname:    hostname,
+		Type:        models.HostEventDeleted,
+		ActorUserID: actorUserID,
+		Payload:     deletionPayload(deletion),
+	})
+	return nil
+}
+
+// removeHost deletes a host and everything attached to it
+func (m *MockStorage) removeHost(hostID, orgID string) {
+	delete(m.hosts, hostKey(orgID, hostID))
+	delete(m.hostTags, hostKey(orgID, hostID))
+	delete(m.hostDetails, hostKey(orgID, hostID))
+	delete(m.hostArchived, hostKey(orgID, hostID))
+	delete(m.hostStale, hostKey(orgID, hostID))
+	delete(m.hostVersions, hostKey(orgID, hostID))
+	delete(m.lastProbe, hostKey(orgID, hostID))
+	delete(m.hostReports, hostKey(orgID, hostID))
 
 	// Remove from org mapping
 	newHostIDs := []string{}
-	for _, hid := range hostIDs {
+	for _, hid := range m.hostsByOrg[orgID] {
 		if hid != hostID {
 			newHostIDs = append(newHostIDs, hid)
 		}
 	}
 	m.hostsByOrg[orgID] = newHostIDs
 
-	return nil
+	// Remove from static group membership
+	for id, group := range m.hostGroups {
+		if m.hostGroupOrgID[id] == orgID {
+			group.HostIDs = slices.DeleteFunc(group.HostIDs, func(hid string) bool { return hid == hostID })
+		}
+	}
 }
 
-// ListHosts returns all hosts with summary info for the specified organization
-func (m *MockStorage) ListHosts(orgID string) ([]*models.HostSummary, error) {
+// ListHostEvents returns host events after afterID, oldest first
+func (m *MockStorage) ListHostEvents(orgID, hostID string, afterID int64, limit int, includeReports bool) ([]*models.HostEvent, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.shouldErrorOnListHosts {
-		return nil, ErrNotFound
-	}
-
-	hostIDs, exists := m.hostsByOrg[orgID]
-	if !exists {
-		return []*models.HostSummary{}, nil
-	}
-
-	hosts := []*models.HostSummary{}
-	for _, hostID := range hostIDs {
-		report, exists := m.hosts[hostID]
-		if !exists {
+	limit = clampHostEventLimit(limit)
+	events := []*models.HostEvent{}
+	for _, event := range m.hostEvents {
+		if event.OrgID != orgID || event.ID <= afterID || (hostID != "" && event.HostID != hostID) {
 			continue
 		}
-
-		host := &models.HostSummary{
-			HostID:   report.Meta.HostID,
-			Hostname: report.Meta.Hostname,
-			LastSeen: report.ReceivedAt,
+		copied := *event
+		if event.Payload != nil {
+			payload := *event.Payload
+			if !includeReports {
+				payload.Report = nil
+			}
+			copied.Payload = &payload
+		}
+		events = append(events, &copied)
+		if len(events) == limit {
+			break
 		}
-		hosts = append(hosts, host)
 	}
-
-	return hosts, nil
+	return events, nil
 }
 
-// GetAllHosts returns all hosts with their full report data
-func (m *MockStorage) GetAllHosts(orgID string) ([]*models.Report, error) {
+// LastHostEventID returns the ID of the organization's newest host event
+func (m *MockStorage) LastHostEventID(orgID string) (int64, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	hostIDs, exists := m.hostsByOrg[orgID]
-	if !exists {
-		return []*models.Report{}, nil
+	var id int64
+	for _, event := range m.hostEvents {
+		if event.OrgID == orgID && event.ID > id {
+			id = event.ID
+		}
 	}
+	return id, nil
+}
 
-	reports := []*models.Report{}
-	for _, hostID := range hostIDs {
-		report, exists := m.hosts[hostID]
-		if exists {
-			reports = append(reports, report)
+// foldHostEvents folds the events of one host into its current state
+func (m *MockStorage) foldHostEvents(hostID, orgID string) *hostState {
+	state := &hostState{}
+	for _, event := range m.hostEvents {
+		if event.HostID == hostID && event.OrgID == orgID {
+			state.apply(event)
 		}
 	}
-
-	return reports, nil
+	return state
 }
 
-// Close closes the database connection
-func (m *MockStorage) Close() error {
-	return nil
+// projectHostState writes a folded host state into the host maps
+func (m *MockStorage) projectHostState(hostID string, state *hostState) {
+	orgID := state.orgID
+	if !state.exists {
+		m.removeHost(hostID, orgID)
+		return
+	}
+	m.putHost(state.report, orgID)
+	m.hostVersions[hostKey(orgID, hostID)] = m.hostMetadataVersion(hostID, orgID) + 1
+	if len(state.tags) > 0 {
+		m.hostTags[hostKey(orgID, hostID)] = append([]string{}, state.tags...)
+	} else {
+		delete(m.hostTags, hostKey(orgID, hostID))
+	}
+	if state.details != (models.HostDetails{}) {
+		m.hostDetails[hostKey(orgID, hostID)] = state.details
+	} else {
+		delete(m.hostDetails, hostKey(orgID, hostID))
+	}
+	if state.archivedAt != nil {
+		m.hostArchived[hostKey(orgID, hostID)] = *state.archivedAt
+	} else {
+		delete(m.hostArchived, hostKey(orgID, hostID))
+	}
 }
 
-// CreateUser creates a new user
-func (m *MockStorage) CreateUser(username, email, passwordHash, orgID, role string) (*models.User, error) {
+// RestoreHost brings back a deleted host with its last report and tags
+func (m *MockStorage) RestoreHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldErrorOnCreateUser {
-		return nil, ErrNotFound
+	state := m.foldHostEvents(hostID, orgID)
+	event, err := state.restoreEvent(hostID, actorUserID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if username already exists
-	if _, exists := m.usersByUsername[username]; exists {
-		return nil, ErrNotFound
-	}
+	m.appendHostEvent(event)
+	state.apply(event)
+	m.projectHostState(hostID, state)
+	copied := *event
+	return &copied, nil
+}
 
-	// Check if email already exists
-	if _, exists := m.usersByEmail[email]; exists {
-		return nil, ErrNotFound
-	}
+// ReplayHostEvents rebuilds the organization's hosts and host tags from the event stream
+func (m *MockStorage) ReplayHostEvents(orgID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	userID := "user-" + username // Simple ID generation for mock
-	user := &models.User{
-		ID:        userID,
-		Username:  username,
-		Email:     email,
-		IsActive:  true,
-		IsAdmin:   role == "admin",
-		OrgID:     orgID,
-		Role:      role,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	seen := make(map[string]bool)
+	for _, event := range m.hostEvents {
+		if event.OrgID != orgID || seen[event.HostID] {
+			continue
+		}
+		seen[event.HostID] = true
+		m.projectHostState(event.HostID, m.foldHostEvents(event.HostID, orgID))
 	}
+	return len(seen), nil
+}
 
-	m.users[userID] = user
-	m.usersByUsername[username] = userID
-	m.usersByEmail[email] = userID
-	m.passwords[userID] = passwordHash
+// SearchHostAccounts parses the accounts of the organization's hosts and returns those matching filter
+func (m *MockStorage) SearchHostAccounts(orgID string, filter models.HostAccountFilter) ([]*models.HostAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	if _, exists := m.usersByOrg[orgID]; !exists {
-		m.usersByOrg[orgID] = []string{}
+	accounts := []*models.HostAccount{}
+	for _, hostID := range m.hostsByOrg[orgID] {
+		report, exists := m.hosts[hostKey(orgID, hostID)]
+		if !exists || (filter.HostID != "" && hostID != filter.HostID) {
+			continue
+		}
+		if _, archived := m.hostArchived[hostKey(orgID, hostID)]; archived && !filter.IncludeArchived {
+			continue
+		}
+		for _, account := range parseHostAccounts(report.Data) {
+			if !matchHostAccount(account, filter) {
+				continue
+			}
+			account.HostID = hostID
+			account.Hostname = report.Meta.Hostname
+			accounts = append(accounts, &account)
+		}
 	}
-	m.usersByOrg[orgID] = append(m.usersByOrg[orgID], userID)
-
-	return user, nil
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Username != accounts[j].Username {
+			return accounts[i].Username < accounts[j].Username
+		}
+		if accounts[i].Hostname != accounts[j].Hostname {
+			return accounts[i].Hostname < accounts[j].Hostname
+		}
+		return accounts[i].HostID < accounts[j].HostID
+	})
+	return accounts, nil
 }
 
-// GetUserByUsername retrieves a user by username
-func (m *MockStorage) GetUserByUsername(username string) (*models.User, string, error) {
+// SearchHostServices returns the listening ports matching filter from the hosts' reports
+func (m *MockStorage) SearchHostServices(orgID string, filter models.HostServiceFilter) ([]*models.HostService, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.shouldErrorOnGetUser {
-		return nil, "", ErrNotFound
+	services := []*models.HostService{}
+	for _, hostID := range m.hostsByOrg[orgID] {
+		report, exists := m.hosts[hostKey(orgID, hostID)]
+		if !exists || (filter.HostID != "" && hostID != filter.HostID) {
+			continue
+		}
+		if _, archived := m.hostArchived[hostKey(orgID, hostID)]; archived && !filter.IncludeArchived {
+			continue
+		}
+		for _, service := range parseHostServices(report.Data) {
+			if !matchHostService(service, filter) {
+				continue
+			}
+			service.HostID = hostID
+			service.Hostname = report.Meta.Hostname
+			services = append(services, &service)
+		}
 	}
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		if a.HostID != b.HostID {
+			return a.HostID < b.HostID
+		}
+		return a.Address < b.Address
+	})
+	return services, nil
+}
 
-	userID, exists := m.usersByUsername[username]
-	if !exists {
-		return nil, "", ErrNotFound
-	}
+// ListEventHosts returns every host with events, ordered by organization and host ID
+func (m *MockStorage) ListEventHosts(orgID string) ([]models.HostRef, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	user, exists := m.users[userID]
-	if !exists {
-		return nil, "", ErrNotFound
+	seen := make(map[models.HostRef]bool)
+	refs := []models.HostRef{}
+	for _, event := range m.hostEvents {
+		ref := models.HostRef{HostID: event.HostID, OrgID: event.OrgID}
+		if (orgID != "" && event.OrgID != orgID) || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
 	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].OrgID != refs[j].OrgID {
+			return refs[i].OrgID < refs[j].OrgID
+		}
+		return refs[i].HostID < refs[j].HostID
+	})
+	return refs, nil
+}
 
-	passwordHash := m.passwords[userID]
-	return user, passwordHash, nil
+// ReplayHost rewrites one host from its events
+func (m *MockStorage) ReplayHost(hostID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.projectHostState(hostID, m.foldHostEvents(hostID, orgID))
+	return nil
 }
 
-// GetUserByID retrieves a user by ID
-func (m *MockStorage) GetUserByID(userID string) (*models.User, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// PurgeDeletedHostEvents removes the events of hosts whose last event is a deletion before before
+func (m *MockStorage) PurgeDeletedHostEvents(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if m.shouldErrorOnGetUser {
-		return nil, ErrNotFound
+	last := make(map[string]*models.HostEvent)
+	for _, event := range m.hostEvents {
+		last[hostKey(event.OrgID, event.HostID)] = event
 	}
-
-	user, exists := m.users[userID]
-	if !exists {
-		return nil, ErrNotFound
+	kept := m.hostEvents[:0:0]
+	for _, event := range m.hostEvents {
+		final := last[hostKey(event.OrgID, event.HostID)]
+		if final.Type == models.HostEventDeleted && final.CreatedAt.Before(before) {
+			continue
+		}
+		kept = append(kept, event)
 	}
+	purged := len(m.hostEvents) - len(kept)
+	m.hostEvents = kept
+	return purged, nil
+}
 
-	return user, nil
+// RebuildFacetCounts is a no-op: the mock counts facets from the hosts on every read
+func (m *MockStorage) RebuildFacetCounts(orgID string) error {
+	return nil
 }
 
-// GetUserByEmail retrieves a user by email
-func (m *MockStorage) GetUserByEmail(email string) (*models.User, error) {
+// GetFleetSnapshot folds the organization's events before at into the hosts of that time
+func (m *MockStorage) GetFleetSnapshot(orgID string, at time.Time) ([]*models.FleetHost, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.shouldErrorOnGetUser {
-		return nil, ErrNotFound
+	states := make(map[string]*hostState)
+	for _, event := range m.hostEvents {
+		if event.OrgID != orgID || !event.CreatedAt.Before(at) {
+			continue
+		}
+		if states[event.HostID] == nil {
+			states[event.HostID] = &hostState{}
+		}
+		states[event.HostID].apply(event)
 	}
 
-	userID, exists := m.usersByEmail[email]
+	hosts := []*models.FleetHost{}
+	for hostID, state := range states {
+		if !state.exists || state.report == nil || state.archivedAt != nil {
+			continue
+		}
+		os := parseReportInfo(state.report.Data)
+		hosts = append(hosts, &models.FleetHost{
+			HostID:       hostID,
+			Hostname:     state.report.Meta.Hostname,
+			OSName:       os.name,
+			OSVersion:    os.version,
+			SnailVersion: state.report.Meta.SnailVersion,
+			Tags:         append([]string(nil), state.tags...),
+		})
+	}
+	sortFleetHosts(hosts)
+	return hosts, nil
+}
+
+// ListHostReportTimes returns the times of the hosts' report-bearing events in [from, to),
+// each host's preceded by its last one before from
+func (m *MockStorage) ListHostReportTimes(orgID, hostID string, from, to time.Time) (map[string][]time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	times := make(map[string][]time.Time)
+	for _, event := range m.hostEvents {
+		if event.OrgID != orgID || (hostID != "" && event.HostID != hostID) || !event.CreatedAt.Before(to) ||
+			(event.Type != models.HostEventIngested && event.Type != models.HostEventUpdated) {
+			continue
+		}
+		reports := times[event.HostID]
+		if event.CreatedAt.Before(from) && len(reports) > 0 {
+			reports = reports[:0] // Only the last report before from is kept
+		}
+		times[event.HostID] = append(reports, event.CreatedAt)
+	}
+	return times, nil
+}
+
+// reportInfo is the host summary information found in a report's data, as the
+// generated columns of migration 000046 extract it
+type reportInfo struct {
+	name, version                            string
+	versionMajor, versionMinor, versionPatch string
+	kernelVersion, architecture              string
+	packageCount                             *int
+}
+
+// parseReportInfo extracts summary info from report data; missing fields are left empty
+func parseReportInfo(dataJSON []byte) reportInfo {
+	var info reportInfo
+	var data struct {
+		System struct {
+			OS struct {
+				Name         interface{} `json:"name"`
+				Version      interface{} `json:"version"`
+				VersionMajor interface{} `json:"version_major"`
+				VersionMinor interface{} `json:"version_minor"`
+				VersionPatch interface{} `json:"version_patch"`
+			} `json:"os"`
+			Kernel       interface{} `json:"kernel"`
+			Architecture interface{} `json:"architecture"`
+		} `json:"system"`
+		Packages struct {
+			Installed interface{} `json:"installed"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(dataJSON, &data); err != nil {
+		return info
+	}
+
+	info.name, _ = data.System.OS.Name.(string)
+	info.version, _ = data.System.OS.Version.(string)
+	info.versionMajor, _ = data.System.OS.VersionMajor.(string)
+	info.versionMinor, _ = data.System.OS.VersionMinor.(string)
+	info.versionPatch, _ = data.System.OS.VersionPatch.(string)
+	info.kernelVersion, _ = data.System.Kernel.(string)
+	info.architecture, _ = data.System.Architecture.(string)
+	if installed, ok := data.Packages.Installed.([]interface{}); ok {
+		count := len(installed)
+		info.packageCount = &count
+	}
+	return info
+}
+
+// ListHosts returns all hosts with summary info for the specified organization
+func (m *MockStorage) ListHosts(orgID string, includeArchived bool) ([]*models.HostSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shouldErrorOnListHosts {
+		return nil, errInjected
+	}
+
+	hostIDs, exists := m.hostsByOrg[orgID]
+	if !exists {
+		return []*models.HostSummary{}, nil
+	}
+
+	hosts := []*models.HostSummary{}
+	for _, hostID := range hostIDs {
+		report, exists := m.hosts[hostKey(orgID, hostID)]
+		if !exists {
+			continue
+		}
+		archivedAt, archived := m.hostArchived[hostKey(orgID, hostID)]
+		if archived && !includeArchived {
+			continue
+		}
+
+		info := parseReportInfo(report.Data)
+		details := m.hostDetails[hostKey(orgID, hostID)]
+		host := &models.HostSummary{
+			HostID:         report.Meta.HostID,
+			Hostname:       report.Meta.Hostname,
+			Name:           models.HostName(report.Meta.Hostname, details.DisplayName),
+			DisplayName:    details.DisplayName,
+			Description:    details.Description,
+			OSName:         info.name,
+			OSVersion:      info.version,
+			OSVersionMajor: info.versionMajor,
+			OSVersionMinor: info.versionMinor,
+			OSVersionPatch: info.versionPatch,
+			KernelVersion:  info.kernelVersion,
+			Architecture:   info.architecture,
+			PackageCount:   info.packageCount,
+			OrgID:          orgID,
+			Tags:           m.hostTags[hostKey(orgID, hostID)],
+			LastSeen:       report.ReceivedAt,
+			LastProbe:      m.lastProbe[hostKey(orgID, hostID)],
+			Health:         report.Health,
+			Sections:       models.ReportSections(report.Data),
+		}
+		if t := collectedAt(report.Meta.Timestamp); t.Valid {
+			host.CollectedAt = &t.Time
+		}
+		if archived {
+			host.ArchivedAt = &archivedAt
+		}
+		if staleSince, stale := m.hostStale[hostKey(orgID, hostID)]; stale {
+			host.StaleSince = &staleSince
+		}
+		host.Status = models.HostStatus(host.StaleSince)
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
+
+// ListHostsPaginated returns one page of the organization's hosts, newest report first
+func (m *MockStorage) ListHostsPaginated(orgID string, includeArchived bool, after *HostCursor, limit int) (*HostPage, error) {
+	hosts, err := m.ListHosts(orgID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	return PageHosts(hosts, after, limit), nil
+}
+
+// SearchHosts returns the hosts of the organization matching a parsed search query
+func (m *MockStorage) SearchHosts(orgID string, query *search.Query, includeArchived bool) ([]*models.HostSummary, error) {
+	hosts, err := m.ListHosts(orgID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched := []*models.HostSummary{}
+	for _, host := range hosts {
+		candidate := search.Host{Summary: host}
+		if report, exists := m.hosts[hostKey(orgID, host.HostID)]; exists && query.NeedsPackages() {
+			candidate.Packages = parsePackages(report.Data)
+		}
+		if query.Match(candidate) {
+			matched = append(matched, host)
+		}
+	}
+	return matched, nil
+}
+
+// FindHosts returns the hosts of the organization matching a structured search
+func (m *MockStorage) FindHosts(orgID string, filter models.HostSearchFilter) ([]*models.HostSummary, error) {
+	hosts, err := m.ListHosts(orgID, filter.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched := []*models.HostSummary{}
+	for _, host := range hosts {
+		var packages []search.Package
+		if report, exists := m.hosts[hostKey(orgID, host.HostID)]; exists && len(filter.Packages) > 0 {
+			packages = parsePackages(report.Data)
+		}
+		if matchesHostFilter(filter, host, packages) {
+			matched = append(matched, host)
+		}
+	}
+	return matched, nil
+}
+
+// FindHostsPaginated returns a page of the hosts matching a structured search
+func (m *MockStorage) FindHostsPaginated(orgID string, filter models.HostSearchFilter, after *HostCursor, limit int) (*HostPage, error) {
+	hosts, err := m.FindHosts(orgID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return PageHosts(hosts, after, limit), nil
+}
+
+// GetAllHosts returns all hosts with their full report data
+func (m *MockStorage) GetAllHosts(orgID string) ([]*models.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hostIDs, exists := m.hostsByOrg[orgID]
+	if !exists {
+		return []*models.Report{}, nil
+	}
+
+	reports := []*models.Report{}
+	for _, hostID := range hostIDs {
+		report, exists := m.hosts[hostKey(orgID, hostID)]
+		if exists {
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, nil
+}
+
+// IterateHosts calls fn for each host in the organization
+// The hosts are snapshotted first so fn may call back into the mock
+func (m *MockStorage) IterateHosts(ctx context.Context, orgID string, fn func(*models.Report) error) error {
+	reports, err := m.GetAllHosts(orgID)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterateHostBatches calls fn with the organization's hosts after afterHostID in batches, ordered by host ID
+// The hosts are snapshotted first so fn may call back into the mock
+func (m *MockStorage) IterateHostBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.Report) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultHostBatchSize
+	}
+	reports, err := m.GetAllHosts(orgID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Meta.HostID < reports[j].Meta.HostID })
+	start := sort.Search(len(reports), func(i int) bool { return reports[i].Meta.HostID > afterHostID })
+	reports = reports[start:]
+
+	for len(reports) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(batchSize, len(reports))
+		if err := fn(reports[:n:n]); err != nil {
+			return err
+		}
+		reports = reports[n:]
+	}
+	return nil
+}
+
+func (m *MockStorage) IterateHostSummaryBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.HostSummary) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultHostBatchSize
+	}
+	hosts, err := m.ListHosts(orgID, true)
+	if err != nil {
+		return err
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].HostID < hosts[j].HostID })
+	start := sort.Search(len(hosts), func(i int) bool { return hosts[i].HostID > afterHostID })
+	hosts = hosts[start:]
+
+	for len(hosts) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(batchSize, len(hosts))
+		if err := fn(hosts[:n:n]); err != nil {
+			return err
+		}
+		hosts = hosts[n:]
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (m *MockStorage) Close() error {
+	return nil
+}
+
+// WithTx runs fn with the mock itself and, if fn fails or panics, restores the data held
+// before it ran. Unlike a database transaction it does not isolate fn from concurrent
+// callers, whose changes are lost on rollback too.
+func (m *MockStorage) WithTx(fn func(tx Storage) error) (err error) {
+	m.mu.RLock()
+	snapshot := m.mockState.clone()
+	m.mu.RUnlock()
+
+	committed := false
+	defer func() {
+		if !committed {
+			m.mu.Lock()
+			m.mockState = snapshot
+			m.mu.Unlock()
+		}
+	}()
+
+	if err := fn(m); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// WithConn runs fn with the mock itself; the mock has no connections to tag
+func (m *MockStorage) WithConn(ctx context.Context, fn func(conn Storage) error) error {
+	return fn(m)
+}
+
+// clone copies the state deeply enough that changes made through one copy, including
+// to the records its maps point to, are not seen through the other
+func (s *mockState) clone() mockState {
+	c := *s
+	c.hosts = clonePtrMap(s.hosts)
+	c.hostsByOrg = cloneSliceMap(s.hostsByOrg)
+	c.users = clonePtrMap(s.users)
+	c.usersByUsername = maps.Clone(s.usersByUsername)
+	c.usersByEmail = maps.Clone(s.usersByEmail)
+	c.usersByOrg = cloneSliceMap(s.usersByOrg)
+	c.passwords = maps.Clone(s.passwords)
+	c.orgMemberships = make(map[string]map[string]*models.OrgMembership, len(s.orgMemberships))
+	for userID, memberships := range s.orgMemberships {
+		c.orgMemberships[userID] = clonePtrMap(memberships)
+	}
+	c.apiKeys = clonePtrMap(s.apiKeys)
+	c.apiKeysByUser = cloneSliceMap(s.apiKeysByUser)
+	c.apiKeysByPrefix = cloneSliceMap(s.apiKeysByPrefix)
+	c.organizations = clonePtrMap(s.organizations)
+	c.organizationsByName = maps.Clone(s.organizationsByName)
+	c.hostTags = cloneSliceMap(s.hostTags)
+	c.hostDetails = maps.Clone(s.hostDetails)
+	c.hostArchived = maps.Clone(s.hostArchived)
+	c.hostStale = maps.Clone(s.hostStale)
+	c.hostVersions = maps.Clone(s.hostVersions)
+	c.hostAccess = cloneSliceMap(s.hostAccess)
+	c.receipts = clonePtrMap(s.receipts)
+	c.receiptOrgID = maps.Clone(s.receiptOrgID)
+	c.probeJobs = clonePtrMap(s.probeJobs)
+	c.probeJobOrgID = maps.Clone(s.probeJobOrgID)
+	c.probeJobOrder = slices.Clone(s.probeJobOrder)
+	c.lastProbe = clonePtrMap(s.lastProbe)
+	c.hostEvents = clonePtrSlice(s.hostEvents)
+	c.actions = clonePtrMap(s.actions)
+	c.actionOrgID = maps.Clone(s.actionOrgID)
+	c.actionOrder = slices.Clone(s.actionOrder)
+	c.actionRuns = clonePtrMap(s.actionRuns)
+	c.runOrder = slices.Clone(s.runOrder)
+	c.orgSecrets = make(map[string]map[string]mockSecret, len(s.orgSecrets))
+	for orgID, secrets := range s.orgSecrets {
+		c.orgSecrets[orgID] = maps.Clone(secrets)
+	}
+	c.webhooks = clonePtrMap(s.webhooks)
+	c.webhookOrgID = maps.Clone(s.webhookOrgID)
+	c.webhookOrder = slices.Clone(s.webhookOrder)
+	c.webhookDeliveries = clonePtrMap(s.webhookDeliveries)
+	c.webhookDedupKeys = maps.Clone(s.webhookDedupKeys)
+	c.deliveryOrder = slices.Clone(s.deliveryOrder)
+	c.auditEvents = clonePtrSlice(s.auditEvents)
+	c.remoteWrite = clonePtrMap(s.remoteWrite)
+	c.ingestFilters = clonePtrMap(s.ingestFilters)
+	c.hostTagRules = clonePtrMap(s.hostTagRules)
+	c.checkinSchedules = clonePtrMap(s.checkinSchedules)
+	c.hostReports = make(map[string][]*models.HostReport, len(s.hostReports))
+	for key, reports := range s.hostReports {
+		c.hostReports[key] = clonePtrSlice(reports)
+	}
+	c.hostReportRetention = clonePtrMap(s.hostReportRetention)
+	c.fleetReports = clonePtrSlice(s.fleetReports)
+	c.reportSchedules = clonePtrMap(s.reportSchedules)
+	c.importBatches = clonePtrSlice(s.importBatches)
+	c.importBatchOrgID = maps.Clone(s.importBatchOrgID)
+	c.oauthClients = clonePtrMap(s.oauthClients)
+	c.oauthCodes = clonePtrMap(s.oauthCodes)
+	c.oauthGrants = clonePtrMap(s.oauthGrants)
+	c.sessions = clonePtrMap(s.sessions)
+	c.impersonationTokens = clonePtrMap(s.impersonationTokens)
+	c.enrollmentTokens = clonePtrMap(s.enrollmentTokens)
+	c.jobStatuses = clonePtrMap(s.jobStatuses)
+	c.featureFlags = clonePtrMap(s.featureFlags)
+	c.iocLists = clonePtrMap(s.iocLists)
+	c.iocListOrgID = maps.Clone(s.iocListOrgID)
+	c.iocMatches = clonePtrMap(s.iocMatches)
+	c.hostGroups = clonePtrMap(s.hostGroups)
+	c.hostGroupOrgID = maps.Clone(s.hostGroupOrgID)
+	return c
+}
+
+// clonePtrMap copies a map along with the values its entries point to
+func clonePtrMap[K comparable, V any](m map[K]*V) map[K]*V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[K]*V, len(m))
+	for k, v := range m {
+		copied := *v
+		c[k] = &copied
+	}
+	return c
+}
+
+// clonePtrSlice copies a slice along with the values its elements point to
+func clonePtrSlice[V any](s []*V) []*V {
+	if s == nil {
+		return nil
+	}
+	c := make([]*V, len(s))
+	for i, v := range s {
+		copied := *v
+		c[i] = &copied
+	}
+	return c
+}
+
+// cloneSliceMap copies a map along with its slices
+func cloneSliceMap[K comparable, V any](m map[K][]V) map[K][]V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[K][]V, len(m))
+	for k, v := range m {
+		c[k] = slices.Clone(v)
+	}
+	return c
+}
+
+// CreateUser creates a new user
+func (m *MockStorage) CreateUser(username, email, passwordHash, orgID, role string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shouldErrorOnCreateUser {
+		return nil, errInjected
+	}
+
+	// Check if username already exists
+	if _, exists := m.usersByUsername[username]; exists {
+		return nil, ErrUsernameTaken
+	}
+
+	// Check if email already exists
+	if _, exists := m.usersByEmail[email]; exists {
+		return nil, ErrEmailTaken
+	}
+
+	userID := "user-" + username // Simple ID generation for mock
+	user := &models.User{
+		ID:        userID,
+		Username:  username,
+		Email:     email,
+		IsActive:  true,
+		IsAdmin:   role == "admin",
+		OrgID:     orgID,
+		Role:      role,
+		Version:   1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	m.users[userID] = user
+	m.usersByUsername[username] = userID
+	m.usersByEmail[email] = userID
+	m.passwords[userID] = passwordHash
+
+	if _, exists := m.usersByOrg[orgID]; !exists {
+		m.usersByOrg[orgID] = []string{}
+	}
+	m.usersByOrg[orgID] = append(m.usersByOrg[orgID], userID)
+
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (m *MockStorage) GetUserByUsername(username string) (*models.User, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shouldErrorOnGetUser {
+		return nil, "", errInjected
+	}
+
+	userID, exists := m.usersByUsername[username]
+	if !exists {
+		return nil, "", ErrNotFound
+	}
+
+	user, exists := m.users[userID]
+	if !exists {
+		return nil, "", ErrNotFound
+	}
+
+	passwordHash := m.passwords[userID]
+	return user, passwordHash, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (m *MockStorage) GetUserByID(userID string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shouldErrorOnGetUser {
+		return nil, errInjected
+	}
+
+	user, exists := m.users[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (m *MockStorage) GetUserByEmail(email string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shouldErrorOnGetUser {
+		return nil, errInjected
+	}
+
+	userID, exists := m.usersByEmail[email]
 	if !exists {
 		return nil, ErrNotFound
 	}
@@ -351,270 +1232,3112 @@ func (m *MockStorage) GetUserByEmail(email string) (*models.User, error) {
 	return user, nil
 }
 
-// CreateAPIKey creates a new API key
-func (m *MockStorage) CreateAPIKey(userID, keyHash, keyPrefix, name string, expiresAt *time.Time) (*models.APIKey, error) {
+// CreateAPIKey creates a new API key
+func (m *MockStorage) CreateAPIKey(userID, keyHash, keyPrefix, name string, expiresAt *time.Time) (*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shouldErrorOnCreateAPIKey {
+		return nil, errInjected
+	}
+	if len(keyPrefix) >= auth.APIKeyPrefixLength && len(m.apiKeysByPrefix[keyPrefix]) > 0 {
+		return nil, ErrAPIKeyPrefixTaken
+	}
+
+	// Generate a simple ID (replace spaces to avoid URL issues)
+	keyID := "key-" + name
+	// Replace spaces with dashes for URL safety
+	keyID = strings.ReplaceAll(keyID, " ", "-")
+	apiKey := &models.APIKey{
+		ID:        keyID,
+		UserID:    userID,
+		KeyHash:   keyHash,
+		KeyPrefix: keyPrefix,
+		Name:      name,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	m.apiKeys[keyID] = apiKey
+
+	if _, exists := m.apiKeysByUser[userID]; !exists {
+		m.apiKeysByUser[userID] = []string{}
+	}
+	m.apiKeysByUser[userID] = append(m.apiKeysByUser[userID], keyID)
+
+	if _, exists := m.apiKeysByPrefix[keyPrefix]; !exists {
+		m.apiKeysByPrefix[keyPrefix] = []string{}
+	}
+	m.apiKeysByPrefix[keyPrefix] = append(m.apiKeysByPrefix[keyPrefix], keyID)
+
+	return apiKey, nil
+}
+
+// GetAPIKeyByPrefix retrieves API keys by any of the prefixes
+func (m *MockStorage) GetAPIKeyByPrefix(keyPrefixes ...string) ([]*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for _, keyPrefix := range keyPrefixes {
+		for _, keyID := range m.apiKeysByPrefix[keyPrefix] {
+			if key, exists := m.apiKeys[keyID]; exists {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeysByUserID retrieves all API keys for a user
+func (m *MockStorage) GetAPIKeysByUserID(userID string) ([]*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keyIDs, exists := m.apiKeysByUser[userID]
+	if !exists {
+		return []*models.APIKey{}, nil
+	}
+
+	keys := []*models.APIKey{}
+	for _, keyID := range keyIDs {
+		if key, exists := m.apiKeys[keyID]; exists {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes an API key
+func (m *MockStorage) DeleteAPIKey(keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.apiKeys[keyID]
+	if !exists {
+		return ErrNotFound
+	}
+	m.deleteAPIKey(key)
+	return nil
+}
+
+// DeleteExpiredAPIKeys deletes the API keys, of userID or of every user, that expired before expiredBefore
+func (m *MockStorage) DeleteExpiredAPIKeys(userID string, expiredBefore time.Time) ([]*DeletedAPIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := []*DeletedAPIKey{}
+	for _, key := range m.apiKeys {
+		if (userID != "" && key.UserID != userID) || key.ExpiresAt == nil || !key.ExpiresAt.Before(expiredBefore) {
+			continue
+		}
+		var orgID string
+		if user := m.users[key.UserID]; user != nil {
+			orgID = user.OrgID
+		}
+		deleted = append(deleted, &DeletedAPIKey{ID: key.ID, UserID: key.UserID, OrgID: orgID, Name: key.Name, ExpiresAt: *key.ExpiresAt})
+		m.deleteAPIKey(key)
+	}
+	return deleted, nil
+}
+
+// deleteAPIKey removes a key and its index entries; the caller holds the write lock
+func (m *MockStorage) deleteAPIKey(key *models.APIKey) {
+	keyID := key.ID
+
+	// Remove from user mapping
+	keyIDs := m.apiKeysByUser[key.UserID]
+	newKeyIDs := []string{}
+	for _, kid := range keyIDs {
+		if kid != keyID {
+			newKeyIDs = append(newKeyIDs, kid)
+		}
+	}
+	m.apiKeysByUser[key.UserID] = newKeyIDs
+
+	// Remove from prefix mapping
+	keyIDs = m.apiKeysByPrefix[key.KeyPrefix]
+	newKeyIDs = []string{}
+	for _, kid := range keyIDs {
+		if kid != keyID {
+			newKeyIDs = append(newKeyIDs, kid)
+		}
+	}
+	m.apiKeysByPrefix[key.KeyPrefix] = newKeyIDs
+
+	delete(m.apiKeys, keyID)
+}
+
+// SetAPIKeyAllowedEndpoints replaces the endpoint patterns an API key is restricted to
+func (m *MockStorage) SetAPIKeyAllowedEndpoints(keyID string, endpoints []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.apiKeys[keyID]
+	if !exists {
+		return ErrNotFound
+	}
+	key.AllowedEndpoints = append([]string(nil), endpoints...)
+	return nil
+}
+
+// SetAPIKeyHost binds an API key to the host it may report as
+func (m *MockStorage) SetAPIKeyHost(keyID, hostID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.apiKeys[keyID]
+	if !exists {
+		return ErrNotFound
+	}
+	key.HostID = hostID
+	return nil
+}
+
+// UpdateAPIKeyLastUsed updates the last_used_at timestamp
+func (m *MockStorage) UpdateAPIKeyLastUsed(keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.apiKeys[keyID]
+	if !exists {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	key.LastUsedAt = &now
+	return nil
+}
+
+// orgNameKey is the organizationsByName key of an organization name, which is unique ignoring case
+func orgNameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// CreateOrganization creates a new organization
+func (m *MockStorage) CreateOrganization(name string) (*models.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shouldErrorOnCreateOrg {
+		return nil, errInjected
+	}
+
+	// Check if name already exists
+	if _, exists := m.organizationsByName[orgNameKey(name)]; exists {
+		return nil, ErrOrgNameTaken
+	}
+
+	orgID := "org-" + name // Simple ID generation
+	org := &models.Organization{
+		ID:        orgID,
+		Name:      name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	m.organizations[orgID] = org
+	m.organizationsByName[orgNameKey(name)] = orgID
+
+	return org, nil
+}
+
+// GetOrganizationByID retrieves an organization by ID
+func (m *MockStorage) GetOrganizationByID(orgID string) (*models.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, exists := m.organizations[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return org, nil
+}
+
+// GetOrganizationByName retrieves an organization by name
+func (m *MockStorage) GetOrganizationByName(name string) (*models.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orgID, exists := m.organizationsByName[orgNameKey(name)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	org, exists := m.organizations[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return org, nil
+}
+
+// CountUsersInOrganization counts the number of users in an organization
+func (m *MockStorage) CountUsersInOrganization(orgID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userIDs, exists := m.usersByOrg[orgID]
+	if !exists {
+		return 0, nil
+	}
+
+	return len(userIDs), nil
+}
+
+// GetOrgStorageUsage approximates storage as the JSON size of hosts and host events
+func (m *MockStorage) GetOrgStorageUsage(orgID string) (*models.OrgStorageUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := &models.OrgStorageUsage{}
+	for _, hostID := range m.hostsByOrg[orgID] {
+		data, err := json.Marshal(m.hosts[hostKey(orgID, hostID)])
+		if err != nil {
+			return nil, err
+		}
+		usage.Hosts++
+		usage.HostBytes += int64(len(data))
+	}
+	for _, event := range m.hostEvents {
+		if event.OrgID != orgID {
+			continue
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		usage.HostEvents++
+		usage.HostEventBytes += int64(len(data))
+	}
+	usage.TotalBytes = usage.HostBytes + usage.HostEventBytes
+
+	return usage, nil
+}
+
+// RegisterUser atomically creates a new organization and its first admin user
+func (m *MockStorage) RegisterUser(orgName, username, email, passwordHash string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.usersByUsername[username]; exists {
+		return nil, ErrUsernameTaken
+	}
+	if _, exists := m.usersByEmail[email]; exists {
+		return nil, ErrEmailTaken
+	}
+	if orgID, exists := m.organizationsByName[orgNameKey(orgName)]; exists {
+		if len(m.usersByOrg[orgID]) > 0 {
+			return nil, ErrOrgHasUsers
+		}
+		return nil, ErrOrgNameTaken
+	}
+	if m.shouldErrorOnCreateOrg || m.shouldErrorOnCreateUser {
+		return nil, errInjected
+	}
+
+	now := time.Now()
+	orgID := "org-" + orgName
+	m.organizations[orgID] = &models.Organization{
+		ID:        orgID,
+		Name:      orgName,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.organizationsByName[orgNameKey(orgName)] = orgID
+
+	userID := "user-" + username
+	user := &models.User{
+		ID:        userID,
+		Username:  username,
+		Email:     email,
+		IsActive:  true,
+		IsAdmin:   true,
+		OrgID:     orgID,
+		Role:      "admin",
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.users[userID] = user
+	m.usersByUsername[username] = userID
+	m.usersByEmail[email] = userID
+	m.passwords[userID] = passwordHash
+	m.usersByOrg[orgID] = append(m.usersByOrg[orgID], userID)
+
+	return user, nil
+}
+
+// ListUsersByOrganization lists all users in an organization
+func (m *MockStorage) ListUsersByOrganization(orgID string) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userIDs, exists := m.usersByOrg[orgID]
+	if !exists {
+		return []*models.User{}, nil
+	}
+
+	users := []*models.User{}
+	for _, userID := range userIDs {
+		if user, exists := m.users[userID]; exists {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// UpdateUserRole updates a user's role
+func (m *MockStorage) UpdateUserRole(userID, role string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(user.Version, ifVersion); err != nil {
+		return err
+	}
+
+	user.Role = role
+	user.IsAdmin = role == "admin"
+	user.Version++
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// DeleteUser deletes a user
+func (m *MockStorage) DeleteUser(userID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(user.Version, ifVersion); err != nil {
+		return err
+	}
+
+	// Remove from username mapping
+	delete(m.usersByUsername, user.Username)
+
+	// Remove from email mapping
+	delete(m.usersByEmail, user.Email)
+
+	// Remove from org mapping
+	userIDs := m.usersByOrg[user.OrgID]
+	newUserIDs := []string{}
+	for _, uid := range userIDs {
+		if uid != userID {
+			newUserIDs = append(newUserIDs, uid)
+		}
+	}
+	m.usersByOrg[user.OrgID] = newUserIDs
+
+	delete(m.users, userID)
+	delete(m.passwords, userID)
+	delete(m.orgMemberships, userID)
+
+	// Audit events keep the username but lose the reference, like ON DELETE SET NULL
+	for _, event := range m.auditEvents {
+		if event.ActorUserID == userID {
+			event.ActorUserID = ""
+		}
+	}
+
+	return nil
+}
+
+// hostInOrg reports whether a host belongs to an organization (caller must hold the lock)
+func (m *MockStorage) hostInOrg(hostID, orgID string) bool {
+	for _, hid := range m.hostsByOrg[orgID] {
+		if hid == hostID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVersion returns ErrVersionMismatch unless ifVersion is 0 or the current version
+func checkVersion(current, ifVersion int64) error {
+	if ifVersion != 0 && ifVersion != current {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// hostMetadataVersion returns the version of a host's tags and details (caller must hold the lock)
+func (m *MockStorage) hostMetadataVersion(hostID, orgID string) int64 {
+	if version, ok := m.hostVersions[hostKey(orgID, hostID)]; ok {
+		return version
+	}
+	return 1
+}
+
+// GetHostMetadataVersion returns the version of a host's tags and details
+func (m *MockStorage) GetHostMetadataVersion(hostID, orgID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return 0, ErrNotFound
+	}
+	return m.hostMetadataVersion(hostID, orgID), nil
+}
+
+// SetHostTags replaces all tags on a host
+func (m *MockStorage) SetHostTags(hostID, orgID string, tags []string, actorUserID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return ErrNotFound
+	}
+	version := m.hostMetadataVersion(hostID, orgID)
+	if err := checkVersion(version, ifVersion); err != nil {
+		return err
+	}
+
+	m.hostTags[hostKey(orgID, hostID)] = append([]string{}, tags...)
+	m.hostVersions[hostKey(orgID, hostID)] = version + 1
+	m.appendHostEvent(&models.HostEvent{
+		OrgID:       orgID,
+		HostID:      hostID,
+		Hostname:    m.hosts[hostKey(orgID, hostID)].Meta.Hostname,
+		Type:        models.HostEventTagged,
+		ActorUserID: actorUserID,
+		Payload:     &models.HostEventPayload{Tags: append([]string{}, tags...)},
+	})
+	return nil
+}
+
+// UpdateHostDetails applies an edit to a host's display name and description
+func (m *MockStorage) UpdateHostDetails(hostID, orgID string, update models.UpdateHostRequest, actorUserID string, ifVersion int64) (*models.HostEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return nil, ErrNotFound
+	}
+	version := m.hostMetadataVersion(hostID, orgID)
+	if err := checkVersion(version, ifVersion); err != nil {
+		return nil, err
+	}
+	m.hostVersions[hostKey(orgID, hostID)] = version + 1
+
+	event := editEvent(hostID, orgID, m.hosts[hostKey(orgID, hostID)].Meta.Hostname, actorUserID, m.hostDetails[hostKey(orgID, hostID)], update)
+	m.appendHostEvent(event)
+	if details := *event.Payload.Details; details != (models.HostDetails{}) {
+		m.hostDetails[hostKey(orgID, hostID)] = details
+	} else {
+		delete(m.hostDetails, hostKey(orgID, hostID))
+	}
+	copied := *event
+	return &copied, nil
+}
+
+// ArchiveHost hides a host from default lists, facets, and findings
+func (m *MockStorage) ArchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
+	return m.setHostArchived(hostID, orgID, actorUserID, true)
+}
+
+// UnarchiveHost shows an archived host again
+func (m *MockStorage) UnarchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
+	return m.setHostArchived(hostID, orgID, actorUserID, false)
+}
+
+// setHostArchived records an archived or unarchived event for the host
+func (m *MockStorage) setHostArchived(hostID, orgID, actorUserID string, archive bool) (*models.HostEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return nil, ErrNotFound
+	}
+
+	_, archived := m.hostArchived[hostKey(orgID, hostID)]
+	event, err := archiveEvent(hostID, orgID, m.hosts[hostKey(orgID, hostID)].Meta.Hostname, actorUserID, archived, archive)
+	if err != nil {
+		return nil, err
+	}
+	m.appendHostEvent(event)
+	if archive {
+		m.hostArchived[hostKey(orgID, hostID)] = event.CreatedAt
+	} else {
+		delete(m.hostArchived, hostKey(orgID, hostID))
+	}
+	copied := *event
+	return &copied, nil
+}
+
+// IsHostArchived reports whether a host is archived
+func (m *MockStorage) IsHostArchived(hostID, orgID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return false, ErrNotFound
+	}
+	_, archived := m.hostArchived[hostKey(orgID, hostID)]
+	return archived, nil
+}
+
+// GetHostTags returns the tags attached to a host
+func (m *MockStorage) GetHostTags(hostID, orgID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.hostInOrg(hostID, orgID) {
+		return nil, ErrNotFound
+	}
+
+	return append([]string{}, m.hostTags[hostKey(orgID, hostID)]...), nil
+}
+
+// GetHostAccessTags returns the tags a user is restricted to in an organization
+func (m *MockStorage) GetHostAccessTags(userID, orgID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string{}, m.hostAccess[orgID+"/"+userID]...), nil
+}
+
+// SetHostAccessTags replaces the tags a user is restricted to in an organization
+func (m *MockStorage) SetHostAccessTags(userID, orgID string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(tags) == 0 {
+		delete(m.hostAccess, orgID+"/"+userID)
+		return nil
+	}
+
+	m.hostAccess[orgID+"/"+userID] = append([]string{}, tags...)
+	return nil
+}
+
+// SetUserSystemAdmin grants or revokes the system-wide admin flag
+func (m *MockStorage) SetUserSystemAdmin(userID string, isAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return ErrNotFound
+	}
+	user.IsAdmin = isAdmin
+	user.Version++
+	return nil
+}
+
+// AddOrgMembership makes a user a member of an organization other than its own
+func (m *MockStorage) AddOrgMembership(userID, orgID, role string) (*models.OrgMembership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if _, exists := m.organizations[orgID]; !exists {
+		return nil, ErrInvalidInput
+	}
+	if user.OrgID == orgID || m.orgMemberships[userID][orgID] != nil {
+		return nil, ErrAlreadyMember
+	}
+
+	if m.orgMemberships[userID] == nil {
+		m.orgMemberships[userID] = make(map[string]*models.OrgMembership)
+	}
+	membership := &models.OrgMembership{OrgID: orgID, UserID: userID, Role: role, CreatedAt: time.Now()}
+	m.orgMemberships[userID][orgID] = membership
+	return m.membershipView(membership), nil
+}
+
+// UpdateOrgMembershipRole changes a user's role in an organization it is a member of
+func (m *MockStorage) UpdateOrgMembershipRole(userID, orgID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	membership := m.orgMemberships[userID][orgID]
+	if membership == nil {
+		return ErrNotFound
+	}
+	membership.Role = role
+	return nil
+}
+
+// DeleteOrgMembership removes a user from an organization it is a member of
+func (m *MockStorage) DeleteOrgMembership(userID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.orgMemberships[userID][orgID] == nil {
+		return ErrNotFound
+	}
+	delete(m.orgMemberships[userID], orgID)
+	return nil
+}
+
+// GetOrgMembership returns the user's role in an organization, its own or one it is a member of
+func (m *MockStorage) GetOrgMembership(userID, orgID string) (*models.OrgMembership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if user.OrgID == orgID {
+		return m.homeMembership(user), nil
+	}
+	if membership := m.orgMemberships[userID][orgID]; membership != nil {
+		return m.membershipView(membership), nil
+	}
+	return nil, ErrNotFound
+}
+
+// ListUserOrgMemberships lists the organizations a user can act in, its own first
+func (m *MockStorage) ListUserOrgMemberships(userID string) ([]*models.OrgMembership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, exists := m.users[userID]
+	if !exists {
+		return []*models.OrgMembership{}, nil
+	}
+	others := []*models.OrgMembership{}
+	for _, membership := range m.orgMemberships[userID] {
+		others = append(others, m.membershipView(membership))
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return strings.ToLower(others[i].OrgName) < strings.ToLower(others[j].OrgName)
+	})
+	return append([]*models.OrgMembership{m.homeMembership(user)}, others...), nil
+}
+
+// ListOrgMembers lists the users of other organizations that are members of orgID
+func (m *MockStorage) ListOrgMembers(orgID string) ([]*models.OrgMembership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []*models.OrgMembership{}
+	for _, memberships := range m.orgMemberships {
+		if membership := memberships[orgID]; membership != nil {
+			members = append(members, m.membershipView(membership))
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+// homeMembership describes a user's own organization as a membership (caller must hold the lock)
+func (m *MockStorage) homeMembership(user *models.User) *models.OrgMembership {
+	membership := &models.OrgMembership{
+		OrgID:     user.OrgID,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Home:      true,
+		CreatedAt: user.CreatedAt,
+	}
+	if org := m.organizations[user.OrgID]; org != nil {
+		membership.OrgName = org.Name
+	}
+	return membership
+}
+
+// membershipView copies a stored membership with its organization and user names (caller must hold the lock)
+func (m *MockStorage) membershipView(membership *models.OrgMembership) *models.OrgMembership {
+	view := *membership
+	if org := m.organizations[view.OrgID]; org != nil {
+		view.OrgName = org.Name
+	}
+	if user := m.users[view.UserID]; user != nil {
+		view.Username = user.Username
+	}
+	return &view
+}
+
+// SetDBActivity sets the backends reported by ListDBActivity (test helper)
+func (m *MockStorage) SetDBActivity(activity []*models.DBActivity) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dbActivity = activity
+}
+
+// SetReplicationStatus sets the status reported by ReplicationStatus (test helper)
+func (m *MockStorage) SetReplicationStatus(status *models.ReplicationStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replication = status
+}
+
+// ReplicationStatus returns the status set with SetReplicationStatus, or a lone primary
+func (m *MockStorage) ReplicationStatus(ctx context.Context) (*models.ReplicationStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.replication == nil {
+		return &models.ReplicationStatus{PrimaryRole: models.DatabaseRolePrimary}, nil
+	}
+	status := *m.replication
+	return &status, nil
+}
+
+// SetDatabasePrivileges sets the privileges reported by DatabasePrivileges (test helper)
+func (m *MockStorage) SetDatabasePrivileges(privileges *models.DatabasePrivileges) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.privileges = privileges
+}
+
+// DatabasePrivileges returns the privileges set with SetDatabasePrivileges, or a role
+// with every privilege it needs and no DDL
+func (m *MockStorage) DatabasePrivileges(ctx context.Context) (*models.DatabasePrivileges, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.privileges == nil {
+		return &models.DatabasePrivileges{Role: "snailbus", CheckedAt: time.Now().UTC()}, nil
+	}
+	privileges := *m.privileges
+	return &privileges, nil
+}
+
+// SetDBMaintenance sets the tables and vacuums reported by DBMaintenance (test helper)
+func (m *MockStorage) SetDBMaintenance(maintenance *models.DBMaintenance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maintenance = maintenance
+}
+
+// DBMaintenance returns the tables and vacuums set with SetDBMaintenance, with their advice
+func (m *MockStorage) DBMaintenance(ctx context.Context) (*models.DBMaintenance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := &models.DBMaintenance{
+		CollectedAt:    time.Now().UTC(),
+		Tables:         []models.TableMaintenance{},
+		RunningVacuums: []models.VacuumProgress{},
+	}
+	if m.maintenance != nil {
+		report.StatsResetAt = m.maintenance.StatsResetAt
+		report.Tables = append(report.Tables, m.maintenance.Tables...)
+		report.RunningVacuums = append(report.RunningVacuums, m.maintenance.RunningVacuums...)
+	}
+	report.Advice = dbadvisor.Advise(report.Tables, report.CollectedAt)
+	return report, nil
+}
+
+// ListDBActivity returns the backends set with SetDBActivity
+func (m *MockStorage) ListDBActivity(ctx context.Context) ([]*models.DBActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	activity := make([]*models.DBActivity, len(m.dbActivity))
+	copy(activity, m.dbActivity)
+	return activity, nil
+}
+
+// CancelDBQuery removes the backend with the given pid from the reported activity
+func (m *MockStorage) CancelDBQuery(ctx context.Context, pid int, terminate bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, a := range m.dbActivity {
+		if a.PID == pid {
+			m.dbActivity = append(m.dbActivity[:i], m.dbActivity[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// DatabaseDiagnostics reports an idle primary pool at the migration version set with SetMigrationVersion
+func (m *MockStorage) DatabaseDiagnostics(ctx context.Context) (*models.DatabaseDiagnostics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return &models.DatabaseDiagnostics{
+		MigrationVersion: m.migrationVersion,
+		Pools:            map[string]models.PoolStats{"primary": {}},
+	}, nil
+}
+
+// SetMigrationVersion sets the version reported by DatabaseDiagnostics (test helper)
+func (m *MockStorage) SetMigrationVersion(version uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.migrationVersion = version
+}
+
+// GetHostFacets counts facets on the fly from the organization's hosts
+func (m *MockStorage) GetHostFacets(orgID string) (*models.HostFacets, error) {
+	hosts, err := m.ListHosts(orgID, false)
+	if err != nil {
+		return nil, err
+	}
+	return CountHostFacets(hosts), nil
+}
+
+// SaveReceipt stores a signed ingest receipt
+func (m *MockStorage) SaveReceipt(receipt *models.Receipt, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *receipt
+	m.receipts[receipt.ID] = &stored
+	m.receiptOrgID[receipt.ID] = orgID
+	return nil
+}
+
+// GetReceipt retrieves a receipt by ID within an organization
+func (m *MockStorage) GetReceipt(receiptID, orgID string) (*models.Receipt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	receipt, exists := m.receipts[receiptID]
+	if !exists || m.receiptOrgID[receiptID] != orgID {
+		return nil, ErrNotFound
+	}
+	copied := *receipt
+	return &copied, nil
+}
+
+// copyProbeJob returns a copy of job that shares no slices with it
+func copyProbeJob(job *models.ProbeJob) *models.ProbeJob {
+	copied := *job
+	copied.Targets = append([]models.ProbeTarget(nil), job.Targets...)
+	copied.Results = append([]*models.ProbeResult(nil), job.Results...)
+	return &copied
+}
+
+// CreateProbeJob stores a new probe job
+func (m *MockStorage) CreateProbeJob(job *models.ProbeJob, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.CreatedAt = time.Now().UTC()
+	m.probeJobs[job.ID] = copyProbeJob(job)
+	m.probeJobOrgID[job.ID] = orgID
+	m.probeJobOrder = append(m.probeJobOrder, job.ID)
+	return nil
+}
+
+// GetProbeJob retrieves a probe job and its results within an organization
+func (m *MockStorage) GetProbeJob(jobID, orgID string) (*models.ProbeJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.probeJobs[jobID]
+	if !exists || m.probeJobOrgID[jobID] != orgID {
+		return nil, ErrNotFound
+	}
+	return copyProbeJob(job), nil
+}
+
+// ClaimProbeJob hands the oldest pending agent job to a prober agent
+func (m *MockStorage) ClaimProbeJob(orgID, claimedBy string) (*models.ProbeJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, jobID := range m.probeJobOrder {
+		job := m.probeJobs[jobID]
+		if m.probeJobOrgID[jobID] == orgID && job.Status == models.ProbeJobPending {
+			job.Status = models.ProbeJobRunning
+			job.ClaimedBy = claimedBy
+			return copyProbeJob(job), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CompleteProbeJob records a running job's results and marks it completed
+func (m *MockStorage) CompleteProbeJob(jobID, orgID string, results []*models.ProbeResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.probeJobs[jobID]
+	if !exists || m.probeJobOrgID[jobID] != orgID {
+		return ErrNotFound
+	}
+	if job.Status != models.ProbeJobRunning {
+		return ErrProbeJobNotRunning
+	}
+
+	for _, result := range results {
+		if !m.hostInOrg(result.HostID, orgID) {
+			continue
+		}
+		stored := *result
+		job.Results = append(job.Results, &stored)
+		if last := m.lastProbe[hostKey(orgID, result.HostID)]; last == nil || !stored.ProbedAt.Before(last.ProbedAt) {
+			m.lastProbe[hostKey(orgID, result.HostID)] = &stored
+		}
+	}
+
+	now := time.Now().UTC()
+	job.Status = models.ProbeJobCompleted
+	job.CompletedAt = &now
+	return nil
+}
+
+// mockSecret is a stored organization secret
+type mockSecret struct {
+	value string
+	meta  models.OrgSecret
+}
+
+// copyAction returns a copy of an action that shares nothing with the stored one
+func copyAction(action *models.Action) *models.Action {
+	copied := *action
+	copied.Triggers = append([]string{}, action.Triggers...)
+	if action.Headers != nil {
+		copied.Headers = make(map[string]string, len(action.Headers))
+		for k, v := range action.Headers {
+			copied.Headers[k] = v
+		}
+	}
+	if action.SigningSecretCreatedAt != nil {
+		t := *action.SigningSecretCreatedAt
+		copied.SigningSecretCreatedAt = &t
+	}
+	if action.PreviousSecretExpiresAt != nil {
+		t := *action.PreviousSecretExpiresAt
+		copied.PreviousSecretExpiresAt = &t
+	}
+	return &copied
+}
+
+// CreateAction stores a new action
+func (m *MockStorage) CreateAction(action *models.Action, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	action.CreatedAt = now
+	action.UpdatedAt = now
+	if action.SigningSecret != "" {
+		action.SigningSecretCreatedAt = &now
+	}
+	if action.Kind == "" {
+		action.Kind = models.ActionKindHTTP
+	}
+	m.actions[action.ID] = copyAction(action)
+	m.actionOrgID[action.ID] = orgID
+	m.actionOrder = append(m.actionOrder, action.ID)
+	return nil
+}
+
+// GetAction retrieves an action in the organization
+func (m *MockStorage) GetAction(actionID, orgID string) (*models.Action, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	action, exists := m.actions[actionID]
+	if !exists || m.actionOrgID[actionID] != orgID {
+		return nil, ErrNotFound
+	}
+	return copyAction(action), nil
+}
+
+// ListActions returns the organization's actions, oldest first
+func (m *MockStorage) ListActions(orgID string) ([]*models.Action, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	actions := []*models.Action{}
+	for _, actionID := range m.actionOrder {
+		if action, exists := m.actions[actionID]; exists && m.actionOrgID[actionID] == orgID {
+			actions = append(actions, copyAction(action))
+		}
+	}
+	return actions, nil
+}
+
+// UpdateAction replaces an action's definition
+func (m *MockStorage) UpdateAction(action *models.Action, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.actions[action.ID]
+	if !exists || m.actionOrgID[action.ID] != orgID {
+		return ErrNotFound
+	}
+	if action.SchemaVersion == 0 {
+		action.SchemaVersion = existing.SchemaVersion
+	}
+	if action.Kind == "" {
+		action.Kind = models.ActionKindHTTP
+	}
+	action.SigningSecret = existing.SigningSecret
+	action.SigningSecretCreatedAt = existing.SigningSecretCreatedAt
+	action.PreviousSigningSecret = existing.PreviousSigningSecret
+	action.PreviousSecretExpiresAt = existing.PreviousSecretExpiresAt
+	action.CreatedBy = existing.CreatedBy
+	action.CreatedAt = existing.CreatedAt
+	action.UpdatedAt = time.Now().UTC()
+	m.actions[action.ID] = copyAction(action)
+	return nil
+}
+
+// RotateActionSigningSecret replaces an action's signing secret
+func (m *MockStorage) RotateActionSigningSecret(actionID, orgID, secret string, previousExpiresAt *time.Time) (*models.Action, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	action, exists := m.actions[actionID]
+	if !exists || m.actionOrgID[actionID] != orgID {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if previousExpiresAt == nil || action.SigningSecret == "" {
+		action.PreviousSigningSecret = ""
+		action.PreviousSecretExpiresAt = nil
+	} else {
+		expires := previousExpiresAt.UTC()
+		action.PreviousSigningSecret = action.SigningSecret
+		action.PreviousSecretExpiresAt = &expires
+	}
+	action.SigningSecret = secret
+	action.SigningSecretCreatedAt = &now
+	action.UpdatedAt = now
+	return copyAction(action), nil
+}
+
+// DeleteAction removes an action and its run history
+func (m *MockStorage) DeleteAction(actionID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.actions[actionID]; !exists || m.actionOrgID[actionID] != orgID {
+		return ErrNotFound
+	}
+	delete(m.actions, actionID)
+	delete(m.actionOrgID, actionID)
+	for runID, run := range m.actionRuns {
+		if run.ActionID == actionID {
+			delete(m.actionRuns, runID)
+		}
+	}
+	return nil
+}
+
+// CreateActionRun queues a run unless the action already has a run for the same finding since the given time
+func (m *MockStorage) CreateActionRun(run *models.ActionRun, since time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.actions[run.ActionID]; !exists {
+		return false, ErrInvalidInput
+	}
+	key := run.Finding.Key()
+	for _, existing := range m.actionRuns {
+		if existing.ActionID == run.ActionID && existing.Finding.Key() == key && existing.CreatedAt.After(since) {
+			return false, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	run.CreatedAt = now
+	run.UpdatedAt = now
+	copied := *run
+	m.actionRuns[run.ID] = &copied
+	m.runOrder = append(m.runOrder, run.ID)
+	return true, nil
+}
+
+// CountActionRuns returns the number of runs queued for an action since the given time
+func (m *MockStorage) CountActionRuns(actionID string, since time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, run := range m.actionRuns {
+		if run.ActionID == actionID && run.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetActionRun retrieves an action run in the organization
+func (m *MockStorage) GetActionRun(runID, orgID string) (*models.ActionRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, exists := m.actionRuns[runID]
+	if !exists || run.OrgID != orgID {
+		return nil, ErrNotFound
+	}
+	copied := *run
+	return &copied, nil
+}
+
+// ListActionRuns returns an action's runs, newest first
+func (m *MockStorage) ListActionRuns(actionID, orgID string, limit int) ([]*models.ActionRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	runs := []*models.ActionRun{}
+	for i := len(m.runOrder) - 1; i >= 0 && len(runs) < limit; i-- {
+		run, exists := m.actionRuns[m.runOrder[i]]
+		if exists && run.ActionID == actionID && run.OrgID == orgID {
+			copied := *run
+			runs = append(runs, &copied)
+		}
+	}
+	return runs, nil
+}
+
+// ClaimActionRuns marks due runs as running until now+lease and returns them
+func (m *MockStorage) ClaimActionRuns(now time.Time, lease time.Duration, limit int) ([]*models.ActionRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := []*models.ActionRun{}
+	for _, runID := range m.runOrder {
+		if len(runs) == limit {
+			break
+		}
+		run, exists := m.actionRuns[runID]
+		if !exists || (run.Status != models.ActionRunPending && run.Status != models.ActionRunRunning) {
+			continue
+		}
+		if run.NextAttemptAt == nil || run.NextAttemptAt.After(now) {
+			continue
+		}
+		leaseEnd := now.Add(lease)
+		run.Status = models.ActionRunRunning
+		run.NextAttemptAt = &leaseEnd
+		run.UpdatedAt = time.Now().UTC()
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	return runs, nil
+}
+
+// FinishActionRun records the outcome of an attempt
+func (m *MockStorage) FinishActionRun(run *models.ActionRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.actionRuns[run.ID]
+	if !exists || existing.OrgID != run.OrgID {
+		return ErrNotFound
+	}
+	run.UpdatedAt = time.Now().UTC()
+	copied := *run
+	m.actionRuns[run.ID] = &copied
+	return nil
+}
+
+// RetryActionRun requeues a failed run with a fresh set of attempts
+func (m *MockStorage) RetryActionRun(runID, orgID string) (*models.ActionRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, exists := m.actionRuns[runID]
+	if !exists || run.OrgID != orgID {
+		return nil, ErrNotFound
+	}
+	if run.Status != models.ActionRunFailed {
+		return nil, ErrActionRunNotFailed
+	}
+	now := time.Now().UTC()
+	run.Status = models.ActionRunPending
+	run.Attempts = 0
+	run.NextAttemptAt = &now
+	run.CompletedAt = nil
+	run.UpdatedAt = now
+	copied := *run
+	return &copied, nil
+}
+
+// SetOrgSecret creates or replaces an organization secret
+func (m *MockStorage) SetOrgSecret(orgID, name, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secrets, exists := m.orgSecrets[orgID]
+	if !exists {
+		secrets = make(map[string]mockSecret)
+		m.orgSecrets[orgID] = secrets
+	}
+	now := time.Now().UTC()
+	secret, exists := secrets[name]
+	if !exists {
+		secret.meta = models.OrgSecret{Name: name, CreatedAt: now}
+	}
+	secret.value = value
+	secret.meta.UpdatedAt = now
+	secrets[name] = secret
+	return nil
+}
+
+// DeleteOrgSecret removes an organization secret
+func (m *MockStorage) DeleteOrgSecret(orgID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.orgSecrets[orgID][name]; !exists {
+		return ErrNotFound
+	}
+	delete(m.orgSecrets[orgID], name)
+	return nil
+}
+
+// ListOrgSecrets returns the names of the organization's secrets, without values
+func (m *MockStorage) ListOrgSecrets(orgID string) ([]*models.OrgSecret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	secrets := []*models.OrgSecret{}
+	for _, secret := range m.orgSecrets[orgID] {
+		meta := secret.meta
+		secrets = append(secrets, &meta)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// GetOrgSecretValues returns the organization's secrets by name
+func (m *MockStorage) GetOrgSecretValues(orgID string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	values := make(map[string]string)
+	for name, secret := range m.orgSecrets[orgID] {
+		values[name] = secret.value
+	}
+	return values, nil
+}
+
+// copyWebhook returns a copy of a webhook that shares nothing with the stored one
+func copyWebhook(webhook *models.Webhook) *models.Webhook {
+	copied := *webhook
+	copied.Events = append([]string{}, webhook.Events...)
+	return &copied
+}
+
+// CreateWebhook stores a new webhook
+func (m *MockStorage) CreateWebhook(webhook *models.Webhook, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	m.webhooks[webhook.ID] = copyWebhook(webhook)
+	m.webhookOrgID[webhook.ID] = orgID
+	m.webhookOrder = append(m.webhookOrder, webhook.ID)
+	return nil
+}
+
+// GetWebhook retrieves a webhook in the organization
+func (m *MockStorage) GetWebhook(webhookID, orgID string) (*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhook, exists := m.webhooks[webhookID]
+	if !exists || m.webhookOrgID[webhookID] != orgID {
+		return nil, ErrNotFound
+	}
+	return copyWebhook(webhook), nil
+}
+
+// ListWebhooks returns the organization's webhooks, oldest first
+func (m *MockStorage) ListWebhooks(orgID string) ([]*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := []*models.Webhook{}
+	for _, webhookID := range m.webhookOrder {
+		if webhook, exists := m.webhooks[webhookID]; exists && m.webhookOrgID[webhookID] == orgID {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces a webhook's URL, events, and enabled flag
+func (m *MockStorage) UpdateWebhook(webhook *models.Webhook, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.webhooks[webhook.ID]
+	if !exists || m.webhookOrgID[webhook.ID] != orgID {
+		return ErrNotFound
+	}
+	webhook.SigningSecret = existing.SigningSecret
+	webhook.CreatedBy = existing.CreatedBy
+	webhook.CreatedAt = existing.CreatedAt
+	webhook.UpdatedAt = time.Now().UTC()
+	m.webhooks[webhook.ID] = copyWebhook(webhook)
+	return nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (m *MockStorage) DeleteWebhook(webhookID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.webhooks[webhookID]; !exists || m.webhookOrgID[webhookID] != orgID {
+		return ErrNotFound
+	}
+	delete(m.webhooks, webhookID)
+	delete(m.webhookOrgID, webhookID)
+	for deliveryID, delivery := range m.webhookDeliveries {
+		if delivery.WebhookID == webhookID {
+			delete(m.webhookDeliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// ListWebhookOrgs returns the IDs of organizations with an enabled webhook subscribed to eventType
+func (m *MockStorage) ListWebhookOrgs(eventType string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	orgIDs := []string{}
+	for webhookID, webhook := range m.webhooks {
+		orgID := m.webhookOrgID[webhookID]
+		if webhook.Enabled && webhook.Subscribed(eventType) && !seen[orgID] {
+			seen[orgID] = true
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+	sort.Strings(orgIDs)
+	return orgIDs, nil
+}
+
+// CreateWebhookDelivery queues a delivery unless dedupKey is set and the webhook already
+// has a delivery with the same key since the given time
+func (m *MockStorage) CreateWebhookDelivery(delivery *models.WebhookDelivery, dedupKey string, since time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.webhooks[delivery.WebhookID]; !exists {
+		return false, ErrInvalidInput
+	}
+	if dedupKey != "" {
+		for deliveryID, existing := range m.webhookDeliveries {
+			if existing.WebhookID == delivery.WebhookID && m.webhookDedupKeys[deliveryID] == dedupKey && existing.CreatedAt.After(since) {
+				return false, nil
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	copied := *delivery
+	m.webhookDeliveries[delivery.ID] = &copied
+	m.webhookDedupKeys[delivery.ID] = dedupKey
+	m.deliveryOrder = append(m.deliveryOrder, delivery.ID)
+	return true, nil
+}
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first
+func (m *MockStorage) ListWebhookDeliveries(webhookID, orgID string, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for i := len(m.deliveryOrder) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		delivery, exists := m.webhookDeliveries[m.deliveryOrder[i]]
+		if exists && delivery.WebhookID == webhookID && delivery.OrgID == orgID {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries marks due deliveries as running until now+lease and returns them
+func (m *MockStorage) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, deliveryID := range m.deliveryOrder {
+		if len(deliveries) == limit {
+			break
+		}
+		delivery, exists := m.webhookDeliveries[deliveryID]
+		if !exists || (delivery.Status != models.WebhookDeliveryPending && delivery.Status != models.WebhookDeliveryRunning) {
+			continue
+		}
+		if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		leaseEnd := now.Add(lease)
+		delivery.Status = models.WebhookDeliveryRunning
+		delivery.NextAttemptAt = &leaseEnd
+		delivery.UpdatedAt = time.Now().UTC()
+		copied := *delivery
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries, nil
+}
+
+// FinishWebhookDelivery records the outcome of an attempt
+func (m *MockStorage) FinishWebhookDelivery(delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.webhookDeliveries[delivery.ID]
+	if !exists || existing.OrgID != delivery.OrgID {
+		return ErrNotFound
+	}
+	delivery.UpdatedAt = time.Now().UTC()
+	copied := *delivery
+	m.webhookDeliveries[delivery.ID] = &copied
+	return nil
+}
+
+// DeleteWebhookDeliveries removes deliveries completed before the given time
+func (m *MockStorage) DeleteWebhookDeliveries(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for deliveryID, delivery := range m.webhookDeliveries {
+		if delivery.CompletedAt != nil && delivery.CompletedAt.Before(before) {
+			delete(m.webhookDeliveries, deliveryID)
+			delete(m.webhookDedupKeys, deliveryID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// CreateAuditEvent appends an event to the organization's audit log
+func (m *MockStorage) CreateAuditEvent(event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = int64(len(m.auditEvents) + 1)
+	event.CreatedAt = time.Now().UTC()
+	copied := *event
+	m.auditEvents = append(m.auditEvents, &copied)
+	return nil
+}
+
+// ListAuditEvents returns a page of the organization's audit events, newest first
+func (m *MockStorage) ListAuditEvents(orgID string, filter models.AuditFilter, beforeID int64, limit int) (*AuditPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit = clampAuditPageSize(limit)
+	events := []*models.AuditEvent{}
+	for i := len(m.auditEvents) - 1; i >= 0 && len(events) <= limit; i-- {
+		event := m.auditEvents[i]
+		if event.OrgID != orgID || (beforeID != 0 && event.ID >= beforeID) || !filter.Matches(event) {
+			continue
+		}
+		copied := *event
+		events = append(events, &copied)
+	}
+	return auditPage(events, limit), nil
+}
+
+// GetRemoteWriteConfig returns the organization's remote-write target
+func (m *MockStorage) GetRemoteWriteConfig(orgID string) (*models.RemoteWriteConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	config, exists := m.remoteWrite[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *config
+	return &copied, nil
+}
+
+// SetRemoteWriteConfig creates or replaces the organization's remote-write target
+func (m *MockStorage) SetRemoteWriteConfig(config *models.RemoteWriteConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	if existing, exists := m.remoteWrite[config.OrgID]; exists {
+		createdAt, version = existing.CreatedAt, existing.Version
+	}
+	if err := checkVersion(version, config.Version); err != nil {
+		return err
+	}
+	config.Version = version + 1
+	config.CreatedAt = createdAt
+	config.UpdatedAt = now
+	config.LastPushAt = nil
+	config.LastError = ""
+	config.SetAuth()
+	copied := *config
+	m.remoteWrite[config.OrgID] = &copied
+	return nil
+}
+
+// DeleteRemoteWriteConfig removes the organization's remote-write target
+func (m *MockStorage) DeleteRemoteWriteConfig(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.remoteWrite[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.remoteWrite, orgID)
+	return nil
+}
+
+// ClaimRemoteWriteConfigs marks the targets not pushed since now-interval as pushed at now and returns them
+func (m *MockStorage) ClaimRemoteWriteConfigs(now time.Time, interval time.Duration) ([]*models.RemoteWriteConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	configs := []*models.RemoteWriteConfig{}
+	for _, config := range m.remoteWrite {
+		if config.LastPushAt != nil && config.LastPushAt.After(now.Add(-interval)) {
+			continue
+		}
+		pushedAt := now
+		config.LastPushAt = &pushedAt
+		copied := *config
+		configs = append(configs, &copied)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].OrgID < configs[j].OrgID })
+	return configs, nil
+}
+
+// RecordRemoteWriteResult stores the error of the organization's last push
+func (m *MockStorage) RecordRemoteWriteResult(orgID, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if config, exists := m.remoteWrite[orgID]; exists {
+		config.LastError = lastError
+	}
+	return nil
+}
+
+// CountHostPackages returns the number of installed packages per host in the organization
+func (m *MockStorage) CountHostPackages(orgID string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, hostID := range m.hostsByOrg[orgID] {
+		report, exists := m.hosts[hostKey(orgID, hostID)]
+		if !exists {
+			continue
+		}
+		var data struct {
+			Packages struct {
+				Installed []json.RawMessage `json:"installed"`
+			} `json:"packages"`
+		}
+		json.Unmarshal(report.Data, &data)
+		counts[hostID] = len(data.Packages.Installed)
+	}
+	return counts, nil
+}
+
+// GetIngestFilter returns the organization's ingest filter
+func (m *MockStorage) GetIngestFilter(orgID string) (*models.IngestFilter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter, exists := m.ingestFilters[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *filter
+	copied.Paths = append([]string(nil), filter.Paths...)
+	return &copied, nil
+}
+
+// SetIngestFilter creates or replaces the organization's ingest filter
+func (m *MockStorage) SetIngestFilter(filter *models.IngestFilter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	if existing, exists := m.ingestFilters[filter.OrgID]; exists {
+		createdAt, version = existing.CreatedAt, existing.Version
+	}
+	if err := checkVersion(version, filter.Version); err != nil {
+		return err
+	}
+	filter.Version = version + 1
+	filter.CreatedAt = createdAt
+	filter.UpdatedAt = now
+	copied := *filter
+	copied.Paths = append([]string(nil), filter.Paths...)
+	m.ingestFilters[filter.OrgID] = &copied
+	return nil
+}
+
+// DeleteIngestFilter removes the organization's ingest filter
+func (m *MockStorage) DeleteIngestFilter(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.ingestFilters[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.ingestFilters, orgID)
+	return nil
+}
+
+// copyHostTagRules returns a copy of host tag rules that shares no slices with them
+func copyHostTagRules(rules *models.HostTagRules) *models.HostTagRules {
+	copied := *rules
+	copied.Rules = make([]models.HostTagRule, len(rules.Rules))
+	for i, rule := range rules.Rules {
+		rule.Tags = append([]string(nil), rule.Tags...)
+		copied.Rules[i] = rule
+	}
+	return &copied
+}
+
+// GetHostTagRules returns the organization's host tag rules
+func (m *MockStorage) GetHostTagRules(orgID string) (*models.HostTagRules, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules, exists := m.hostTagRules[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyHostTagRules(rules), nil
+}
+
+// SetHostTagRules creates or replaces the organization's host tag rules
+func (m *MockStorage) SetHostTagRules(rules *models.HostTagRules) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	if existing, exists := m.hostTagRules[rules.OrgID]; exists {
+		createdAt, version = existing.CreatedAt, existing.Version
+	}
+	if err := checkVersion(version, rules.Version); err != nil {
+		return err
+	}
+	rules.Version = version + 1
+	rules.CreatedAt = createdAt
+	rules.UpdatedAt = now
+	if rules.Rules == nil {
+		rules.Rules = []models.HostTagRule{}
+	}
+	m.hostTagRules[rules.OrgID] = copyHostTagRules(rules)
+	return nil
+}
+
+// DeleteHostTagRules removes the organization's host tag rules
+func (m *MockStorage) DeleteHostTagRules(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.hostTagRules[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.hostTagRules, orgID)
+	return nil
+}
+
+// copyImportBatch returns a copy of a batch that shares no slices with it
+func copyImportBatch(batch *models.ImportBatch) *models.ImportBatch {
+	copied := *batch
+	copied.Results = append([]models.ImportResult(nil), batch.Results...)
+	return &copied
+}
+
+// CreateImportBatch records the start of an import
+func (m *MockStorage) CreateImportBatch(batch *models.ImportBatch, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.importBatches {
+		if m.importBatchOrgID[existing.ID] == orgID && existing.BundleSHA256 == batch.BundleSHA256 && existing.CompletedAt != nil {
+			return ErrBundleAlreadyImported
+		}
+	}
+	batch.StartedAt = time.Now().UTC()
+	stored := copyImportBatch(batch)
+	stored.Results = nil
+	m.importBatches = append(m.importBatches, stored)
+	m.importBatchOrgID[batch.ID] = orgID
+	return nil
+}
+
+// FinishImportBatch records a batch's counts and results and marks it completed
+func (m *MockStorage) FinishImportBatch(batch *models.ImportBatch, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, existing := range m.importBatches {
+		if existing.ID == batch.ID && m.importBatchOrgID[existing.ID] == orgID {
+			index = i
+		} else if m.importBatchOrgID[existing.ID] == orgID && existing.BundleSHA256 == batch.BundleSHA256 && existing.CompletedAt != nil {
+			return ErrBundleAlreadyImported
+		}
+	}
+	if index < 0 {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	batch.CompletedAt = &now
+	m.importBatches[index] = copyImportBatch(batch)
+	return nil
+}
+
+// ListImportBatches returns up to limit of the organization's batches, newest first, without results
+func (m *MockStorage) ListImportBatches(orgID string, limit int) ([]*models.ImportBatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	batches := []*models.ImportBatch{}
+	for i := len(m.importBatches) - 1; i >= 0 && len(batches) < limit; i-- {
+		if batch := m.importBatches[i]; m.importBatchOrgID[batch.ID] == orgID {
+			copied := *batch
+			copied.Results = nil
+			batches = append(batches, &copied)
+		}
+	}
+	return batches, nil
+}
+
+// GetImportBatch returns a batch of the organization with its results
+func (m *MockStorage) GetImportBatch(batchID, orgID string) (*models.ImportBatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, batch := range m.importBatches {
+		if batch.ID == batchID && m.importBatchOrgID[batch.ID] == orgID {
+			return copyImportBatch(batch), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ImportHost stores a bundled report unless the host has a more recent one or was deleted after it
+func (m *MockStorage) ImportHost(report *models.Report, orgID, uploadedByUserID, batchID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, existed := m.hosts[hostKey(orgID, report.Meta.HostID)]
+	if existed && !existing.ReceivedAt.Before(report.ReceivedAt) {
+		return false, nil
+	}
+	if !existed {
+		for _, event := range m.hostEvents {
+			if event.OrgID == orgID && event.HostID == report.Meta.HostID && event.Type == models.HostEventDeleted &&
+				!event.CreatedAt.Before(report.ReceivedAt) {
+				return false, nil
+			}
+		}
+	}
+
+	m.putHost(report, orgID)
+	event := snapshotEvent(report, orgID, uploadedByUserID, existed)
+	event.Payload.ImportBatchID = batchID
+	m.appendHostEvent(event)
+	return true, nil
+}
+
+// copyCheckinSchedule returns a copy of a schedule that shares no slices with it
+func copyCheckinSchedule(schedule *models.CheckinSchedule) *models.CheckinSchedule {
+	copied := *schedule
+	copied.Windows = append([]models.CheckinWindow{}, schedule.Windows...)
+	return &copied
+}
+
+// GetCheckinSchedule returns the organization's check-in schedule
+func (m *MockStorage) GetCheckinSchedule(orgID string) (*models.CheckinSchedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	schedule, exists := m.checkinSchedules[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyCheckinSchedule(schedule), nil
+}
+
+// SetCheckinSchedule creates or replaces the organization's check-in schedule
+func (m *MockStorage) SetCheckinSchedule(schedule *models.CheckinSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	if existing, exists := m.checkinSchedules[schedule.OrgID]; exists {
+		createdAt, version = existing.CreatedAt, existing.Version
+	}
+	if err := checkVersion(version, schedule.Version); err != nil {
+		return err
+	}
+	schedule.Version = version + 1
+	schedule.CreatedAt = createdAt
+	schedule.UpdatedAt = now
+	if schedule.Windows == nil {
+		schedule.Windows = []models.CheckinWindow{}
+	}
+	m.checkinSchedules[schedule.OrgID] = copyCheckinSchedule(schedule)
+	return nil
+}
+
+// DeleteCheckinSchedule removes the organization's check-in schedule
+func (m *MockStorage) DeleteCheckinSchedule(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.checkinSchedules[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.checkinSchedules, orgID)
+	return nil
+}
+
+// ListCheckinSchedules returns every organization's check-in schedule, by organization ID
+func (m *MockStorage) ListCheckinSchedules() ([]*models.CheckinSchedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	schedules := make([]*models.CheckinSchedule, 0, len(m.checkinSchedules))
+	for _, schedule := range m.checkinSchedules {
+		schedules = append(schedules, copyCheckinSchedule(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].OrgID < schedules[j].OrgID })
+	return schedules, nil
+}
+
+// ListHostOrgIDs returns the organizations with unarchived hosts
+func (m *MockStorage) ListHostOrgIDs() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orgIDs := []string{}
+	for orgID, hostIDs := range m.hostsByOrg {
+		for _, hostID := range hostIDs {
+			if _, archived := m.hostArchived[hostKey(orgID, hostID)]; !archived {
+				orgIDs = append(orgIDs, orgID)
+				break
+			}
+		}
+	}
+	sort.Strings(orgIDs)
+	return orgIDs, nil
+}
+
+// MarkStaleHosts marks the organization's hosts in stale as stale and clears the mark of the rest
+func (m *MockStorage) MarkStaleHosts(orgID string, stale map[string]time.Time, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	marked := 0
+	for _, hostID := range m.hostsByOrg[orgID] {
+		key := hostKey(orgID, hostID)
+		if _, archived := m.hostArchived[key]; archived {
+			continue
+		}
+		lastSeen, isStale := stale[hostID]
+		if !isStale {
+			delete(m.hostStale, key)
+			continue
+		}
+		if _, already := m.hostStale[key]; already || m.hosts[key].ReceivedAt.After(lastSeen) {
+			continue
+		}
+		m.hostStale[key] = now
+		marked++
+	}
+	return marked, nil
+}
+
+// SaveHostReport adds a report to its host's history and prunes the history to keep reports
+func (m *MockStorage) SaveHostReport(report *models.HostReport, orgID string, keep int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := hostKey(orgID, report.HostID)
+	if _, exists := m.hosts[key]; !exists {
+		return ErrInvalidInput // The history references the host
+	}
+	reports := m.hostReports[key]
+	if keep > 0 {
+		stored := *report
+		reports = append([]*models.HostReport{&stored}, reports...)
+		sort.SliceStable(reports, func(i, j int) bool { return reports[i].ReceivedAt.After(reports[j].ReceivedAt) })
+	}
+	if len(reports) > keep {
+		reports = reports[:keep]
+	}
+	m.hostReports[key] = reports
+	return nil
+}
+
+// ListHostReports returns a host's report history without report data, newest first
+func (m *MockStorage) ListHostReports(hostID, orgID string) ([]*models.HostReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reports := []*models.HostReport{}
+	for _, report := range m.hostReports[hostKey(orgID, hostID)] {
+		listed := *report
+		listed.Data = nil
+		reports = append(reports, &listed)
+	}
+	return reports, nil
+}
+
+// GetHostReportByID returns a report from a host's history with its data
+func (m *MockStorage) GetHostReportByID(reportID, hostID, orgID string) (*models.HostReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, report := range m.hostReports[hostKey(orgID, hostID)] {
+		if report.ID == reportID {
+			found := *report
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetHostReportRetention returns the organization's host report retention
+func (m *MockStorage) GetHostReportRetention(orgID string) (*models.HostReportRetention, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	retention, exists := m.hostReportRetention[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *retention
+	return &copied, nil
+}
+
+// SetHostReportRetention creates or replaces the organization's host report retention
+func (m *MockStorage) SetHostReportRetention(retention *models.HostReportRetention) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	if existing, exists := m.hostReportRetention[retention.OrgID]; exists {
+		createdAt, version = existing.CreatedAt, existing.Version
+	}
+	if err := checkVersion(version, retention.Version); err != nil {
+		return err
+	}
+	retention.Version = version + 1
+	retention.CreatedAt = createdAt
+	retention.UpdatedAt = now
+	copied := *retention
+	m.hostReportRetention[retention.OrgID] = &copied
+	return nil
+}
+
+// DeleteHostReportRetention removes the organization's host report retention
+func (m *MockStorage) DeleteHostReportRetention(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.hostReportRetention[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.hostReportRetention, orgID)
+	return nil
+}
+
+// CountExcessHostReports counts the reports PruneHostReports would remove
+func (m *MockStorage) CountExcessHostReports(orgID string, keep int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for key, reports := range m.hostReports {
+		if strings.HasPrefix(key, orgID+"/") && len(reports) > keep {
+			count += len(reports) - keep
+		}
+	}
+	return count, nil
+}
+
+// PruneHostReports removes all but the keep newest reports of each of the organization's hosts
+func (m *MockStorage) PruneHostReports(orgID string, keep int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pruned := 0
+	for key, reports := range m.hostReports {
+		if strings.HasPrefix(key, orgID+"/") && len(reports) > keep {
+			pruned += len(reports) - keep
+			m.hostReports[key] = reports[:keep]
+		}
+	}
+	return pruned, nil
+}
+
+// EnsureHostReportPartitions records the monthly partitions from the month of from
+// through the month of to that were not recorded yet
+func (m *MockStorage) EnsureHostReportPartitions(from, to time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.hostReportPartitions == nil {
+		m.hostReportPartitions = make(map[string]bool)
+	}
+	created := []string{}
+	month := from
+	for {
+		name, start, end := hostReportPartition(month)
+		if start.After(to) {
+			break
+		}
+		if !m.hostReportPartitions[name] {
+			m.hostReportPartitions[name] = true
+			created = append(created, name)
+		}
+		month = end
+	}
+	return created, nil
+}
+
+// DropHostReportPartitions forgets the monthly partitions that end at or before before
+// and removes the reports of those months from every host's history
+func (m *MockStorage) DropHostReportPartitions(before time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, cutoff, _ := hostReportPartition(before)
+	dropped := []string{}
+	for name := range m.hostReportPartitions {
+		if _, end, ok := parseHostReportPartition(name); ok && !end.After(cutoff) {
+			delete(m.hostReportPartitions, name)
+			dropped = append(dropped, name)
+		}
+	}
+	for key, reports := range m.hostReports {
+		kept := []*models.HostReport{}
+		for _, report := range reports {
+			if !report.ReceivedAt.Before(cutoff) {
+				kept = append(kept, report)
+			}
+		}
+		m.hostReports[key] = kept
+	}
+	sort.Strings(dropped)
+	return dropped, nil
+}
+
+// copyFleetReport returns a copy of a report that shares no slices with it
+func copyFleetReport(report *models.FleetReport) *models.FleetReport {
+	copied := *report
+	copied.EmailedTo = append([]string(nil), report.EmailedTo...)
+	return &copied
+}
+
+// CreateFleetReport stores a generated report
+func (m *MockStorage) CreateFleetReport(report *models.FleetReport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report.CreatedAt = time.Now().UTC()
+	m.fleetReports = append(m.fleetReports, copyFleetReport(report))
+	return nil
+}
+
+// GetFleetReport returns a report of the organization with its content
+func (m *MockStorage) GetFleetReport(reportID, orgID string) (*models.FleetReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, report := range m.fleetReports {
+		if report.ID == reportID && report.OrgID == orgID {
+			return copyFleetReport(report), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListFleetReports returns the organization's most recent reports without their content
+func (m *MockStorage) ListFleetReports(orgID string, limit int) ([]*models.FleetReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reports := []*models.FleetReport{}
+	for i := len(m.fleetReports) - 1; i >= 0 && len(reports) < limit; i-- {
+		if report := m.fleetReports[i]; report.OrgID == orgID {
+			copied := copyFleetReport(report)
+			copied.Content = nil
+			reports = append(reports, copied)
+		}
+	}
+	return reports, nil
+}
+
+// copyReportSchedule returns a copy of a schedule that shares no slices or pointers with it
+func copyReportSchedule(schedule *models.ReportSchedule) *models.ReportSchedule {
+	copied := *schedule
+	copied.Kinds = append([]string{}, schedule.Kinds...)
+	if schedule.LastRunAt != nil {
+		lastRunAt := *schedule.LastRunAt
+		copied.LastRunAt = &lastRunAt
+	}
+	return &copied
+}
+
+// GetReportSchedule returns the organization's report schedule
+func (m *MockStorage) GetReportSchedule(orgID string) (*models.ReportSchedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	schedule, exists := m.reportSchedules[orgID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyReportSchedule(schedule), nil
+}
+
+// SetReportSchedule creates or replaces the organization's report schedule
+// The last run is kept when a schedule is replaced.
+func (m *MockStorage) SetReportSchedule(schedule *models.ReportSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	createdAt, version := now, int64(0)
+	var lastRunAt *time.Time
+	if existing, exists := m.reportSchedules[schedule.OrgID]; exists {
+		createdAt, version, lastRunAt = existing.CreatedAt, existing.Version, existing.LastRunAt
+	}
+	if err := checkVersion(version, schedule.Version); err != nil {
+		return err
+	}
+	schedule.Version = version + 1
+	schedule.CreatedAt = createdAt
+	schedule.LastRunAt = lastRunAt
+	schedule.UpdatedAt = now
+	m.reportSchedules[schedule.OrgID] = copyReportSchedule(schedule)
+	return nil
+}
+
+// DeleteReportSchedule removes the organization's report schedule
+func (m *MockStorage) DeleteReportSchedule(orgID string, ifVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.reportSchedules[orgID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := checkVersion(existing.Version, ifVersion); err != nil {
+		return err
+	}
+	delete(m.reportSchedules, orgID)
+	return nil
+}
+
+// ClaimReportSchedules returns the schedules due at now, by organization ID, and advances them
+func (m *MockStorage) ClaimReportSchedules(now time.Time) ([]*models.ReportSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules := []*models.ReportSchedule{}
+	for _, schedule := range m.reportSchedules {
+		if schedule.NextRunAt.After(now) {
+			continue
+		}
+		schedule.Advance(now)
+		schedules = append(schedules, copyReportSchedule(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].OrgID < schedules[j].OrgID })
+	return schedules, nil
+}
+
+// copyOAuthGrant returns a copy of a grant with the client name filled in
+func (m *MockStorage) copyOAuthGrant(grant *models.OAuthGrant) *models.OAuthGrant {
+	copied := *grant
+	copied.Scopes = append([]string(nil), grant.Scopes...)
+	if client, exists := m.oauthClients[grant.ClientID]; exists {
+		copied.ClientName = client.Name
+	}
+	return &copied
+}
+
+// CreateOAuthClient stores a client under its ID
+func (m *MockStorage) CreateOAuthClient(client *models.OAuthClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client.CreatedAt = time.Now().UTC()
+	copied := *client
+	m.oauthClients[client.ID] = &copied
+	return nil
+}
+
+// ListOAuthClients returns the organization's clients, oldest first
+func (m *MockStorage) ListOAuthClients(orgID string) ([]*models.OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clients := []*models.OAuthClient{}
+	for _, client := range m.oauthClients {
+		if client.OrgID == orgID {
+			copied := *client
+			clients = append(clients, &copied)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].CreatedAt.Before(clients[j].CreatedAt) })
+	return clients, nil
+}
+
+// GetOAuthClient retrieves a client by ID
+func (m *MockStorage) GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	client, exists := m.oauthClients[clientID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *client
+	return &copied, nil
+}
+
+// DeleteOAuthClient removes a client with its codes and grants
+func (m *MockStorage) DeleteOAuthClient(clientID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, exists := m.oauthClients[clientID]
+	if !exists || client.OrgID != orgID {
+		return ErrNotFound
+	}
+	delete(m.oauthClients, clientID)
+	for hash, code := range m.oauthCodes {
+		if code.ClientID == clientID {
+			delete(m.oauthCodes, hash)
+		}
+	}
+	for id, grant := range m.oauthGrants {
+		if grant.ClientID == clientID {
+			delete(m.oauthGrants, id)
+		}
+	}
+	return nil
+}
+
+// CreateOAuthCode stores an authorization code and drops expired ones
+func (m *MockStorage) CreateOAuthCode(code *models.OAuthCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range m.oauthCodes {
+		if existing.ExpiresAt.Before(now) {
+			delete(m.oauthCodes, hash)
+		}
+	}
+	copied := *code
+	m.oauthCodes[code.CodeHash] = &copied
+	return nil
+}
+
+// ConsumeOAuthCode deletes and returns an unexpired authorization code
+func (m *MockStorage) ConsumeOAuthCode(codeHash string, now time.Time) (*models.OAuthCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code, exists := m.oauthCodes[codeHash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	delete(m.oauthCodes, codeHash)
+	if !code.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+	return code, nil
+}
+
+// CreateOAuthGrant stores a grant with its token pair
+func (m *MockStorage) CreateOAuthGrant(grant *models.OAuthGrant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grant.CreatedAt = time.Now().UTC()
+	copied := *grant
+	m.oauthGrants[grant.ID] = &copied
+	grant.ClientName = m.copyOAuthGrant(grant).ClientName
+	return nil
+}
+
+// RotateOAuthToken replaces the token pair holding the refresh token
+func (m *MockStorage) RotateOAuthToken(clientID, refreshHash string, token models.OAuthToken) (*models.OAuthGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, grant := range m.oauthGrants {
+		if grant.ClientID == clientID && grant.Token.RefreshHash == refreshHash {
+			grant.Token = token
+			return m.copyOAuthGrant(grant), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetOAuthGrantByAccessToken returns the grant holding an unexpired access token
+func (m *MockStorage) GetOAuthGrantByAccessToken(accessHash string, now time.Time) (*models.OAuthGrant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, grant := range m.oauthGrants {
+		if grant.Token.AccessHash == accessHash && grant.Token.ExpiresAt.After(now) {
+			return m.copyOAuthGrant(grant), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateOAuthGrantLastUsed records that a grant's access token was used
+func (m *MockStorage) UpdateOAuthGrantLastUsed(grantID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if grant, exists := m.oauthGrants[grantID]; exists {
+		now := time.Now().UTC()
+		grant.LastUsedAt = &now
+	}
+	return nil
+}
+
+// ListOAuthGrants returns the user's grants, newest first
+func (m *MockStorage) ListOAuthGrants(userID string) ([]*models.OAuthGrant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grants := []*models.OAuthGrant{}
+	for _, grant := range m.oauthGrants {
+		if grant.UserID == userID {
+			grants = append(grants, m.copyOAuthGrant(grant))
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].CreatedAt.After(grants[j].CreatedAt) })
+	return grants, nil
+}
+
+// DeleteOAuthGrant revokes one of the user's grants
+func (m *MockStorage) DeleteOAuthGrant(grantID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grant, exists := m.oauthGrants[grantID]
+	if !exists || grant.UserID != userID {
+		return ErrNotFound
+	}
+	delete(m.oauthGrants, grantID)
+	return nil
+}
+
+// RevokeOAuthToken deletes the client's grant holding the access or refresh token
+func (m *MockStorage) RevokeOAuthToken(clientID, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, grant := range m.oauthGrants {
+		if grant.ClientID == clientID && (grant.Token.AccessHash == tokenHash || grant.Token.RefreshHash == tokenHash) {
+			delete(m.oauthGrants, id)
+		}
+	}
+	return nil
+}
+
+// copySession returns a copy of a session
+func copySession(session *models.Session) *models.Session {
+	copied := *session
+	if session.LastUsedAt != nil {
+		lastUsedAt := *session.LastUsedAt
+		copied.LastUsedAt = &lastUsedAt
+	}
+	return &copied
+}
+
+// CreateSession stores a session with its token pair and drops the user's expired sessions
+func (m *MockStorage) CreateSession(session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range m.sessions {
+		if existing.UserID == session.UserID && !existing.ExpiresAt.After(now) {
+			delete(m.sessions, id)
+		}
+	}
+	session.CreatedAt = now.UTC()
+	m.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+// RotateSessionToken replaces the token pair holding the refresh token
+func (m *MockStorage) RotateSessionToken(refreshHash string, token models.SessionToken, now time.Time) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, session := range m.sessions {
+		if session.Token.RefreshHash == refreshHash && session.ExpiresAt.After(now) {
+			session.Token = token
+			return copySession(session), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetSessionByAccessToken returns the session holding an unexpired access token
+func (m *MockStorage) GetSessionByAccessToken(accessHash string, now time.Time) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.sessions {
+		if session.Token.AccessHash == accessHash && session.Token.ExpiresAt.After(now) {
+			return copySession(session), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateSessionLastUsed records that a session's access token was used
+func (m *MockStorage) UpdateSessionLastUsed(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, exists := m.sessions[sessionID]; exists {
+		now := time.Now().UTC()
+		session.LastUsedAt = &now
+	}
+	return nil
+}
+
+// DeleteSession ends one of the user's sessions
+func (m *MockStorage) DeleteSession(sessionID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists || session.UserID != userID {
+		return ErrNotFound
+	}
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+// CreateImpersonationToken stores an impersonation token and drops expired ones
+func (m *MockStorage) CreateImpersonationToken(token *models.ImpersonationToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range m.impersonationTokens {
+		if !existing.ExpiresAt.After(now) {
+			delete(m.impersonationTokens, id)
+		}
+	}
+	token.CreatedAt = now.UTC()
+	copied := *token
+	m.impersonationTokens[token.ID] = &copied
+	return nil
+}
+
+// GetImpersonationToken returns the unexpired impersonation token with the hash
+func (m *MockStorage) GetImpersonationToken(tokenHash string, now time.Time) (*models.ImpersonationToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.impersonationTokens {
+		if token.TokenHash == tokenHash && token.ExpiresAt.After(now) {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CreateEnrollmentToken stores an enrollment token under its ID
+func (m *MockStorage) CreateEnrollmentToken(token *models.EnrollmentToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token.Uses = 0
+	token.CreatedAt = time.Now().UTC()
+	copied := *token
+	m.enrollmentTokens[token.ID] = &copied
+	return nil
+}
+
+// ListEnrollmentTokens returns the organization's enrollment tokens, newest first
+func (m *MockStorage) ListEnrollmentTokens(orgID string) ([]*models.EnrollmentToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := []*models.EnrollmentToken{}
+	for _, token := range m.enrollmentTokens {
+		if token.OrgID == orgID {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// DeleteEnrollmentToken deletes an enrollment token of the organization
+func (m *MockStorage) DeleteEnrollmentToken(tokenID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, exists := m.enrollmentTokens[tokenID]
+	if !exists || token.OrgID != orgID {
+		return ErrNotFound
+	}
+	delete(m.enrollmentTokens, tokenID)
+	return nil
+}
+
+// RedeemEnrollmentToken counts a use of an unexpired token that has uses left
+func (m *MockStorage) RedeemEnrollmentToken(tokenHash string, now time.Time) (*models.EnrollmentToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.enrollmentTokens {
+		if token.TokenHash == tokenHash && token.ExpiresAt.After(now) && token.Uses < token.MaxUses {
+			token.Uses++
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// LockJob takes the job's lock unless it is already held
+func (m *MockStorage) LockJob(ctx context.Context, name string) (func(), bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldErrorOnCreateAPIKey {
-		return nil, ErrNotFound
+	if m.jobLocks[name] {
+		return nil, false, nil
 	}
-
-	// Generate a simple ID (replace spaces to avoid URL issues)
-	keyID := "key-" + name
-	// Replace spaces with dashes for URL safety
-	keyID = strings.ReplaceAll(keyID, " ", "-")
-	apiKey := &models.APIKey{
-		ID:        keyID,
-		UserID:    userID,
-		KeyHash:   keyHash,
-		KeyPrefix: keyPrefix,
-		Name:      name,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
+	if m.jobLocks == nil {
+		m.jobLocks = make(map[string]bool)
+	}
+	m.jobLocks[name] = true
+	unlock := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.jobLocks, name)
 	}
+	return unlock, true, nil
+}
 
-	m.apiKeys[keyID] = apiKey
+// StartJobRun records the start of a job's run
+func (m *MockStorage) StartJobRun(name, runner string, startedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if _, exists := m.apiKeysByUser[userID]; !exists {
-		m.apiKeysByUser[userID] = []string{}
+	status, exists := m.jobStatuses[name]
+	if !exists {
+		status = &models.JobStatus{Name: name}
+		m.jobStatuses[name] = status
 	}
-	m.apiKeysByUser[userID] = append(m.apiKeysByUser[userID], keyID)
+	status.LastRunner = runner
+	status.LastStartedAt = &startedAt
+	return nil
+}
 
-	if _, exists := m.apiKeysByPrefix[keyPrefix]; !exists {
-		m.apiKeysByPrefix[keyPrefix] = []string{}
-	}
-	m.apiKeysByPrefix[keyPrefix] = append(m.apiKeysByPrefix[keyPrefix], keyID)
+// FinishJobRun records the end of a job's run and counts it
+func (m *MockStorage) FinishJobRun(name string, finishedAt time.Time, runErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return apiKey, nil
+	status, exists := m.jobStatuses[name]
+	if !exists {
+		return nil
+	}
+	status.LastFinishedAt = &finishedAt
+	status.LastError = runErr
+	status.Runs++
+	if runErr == "" {
+		status.LastSuccessAt = &finishedAt
+	} else {
+		status.Failures++
+	}
+	return nil
 }
 
-// GetAPIKeyByPrefix retrieves API keys by prefix
-func (m *MockStorage) GetAPIKeyByPrefix(keyPrefix string) ([]*models.APIKey, error) {
+// ListJobStatuses returns the last run of every job that has run, by name
+func (m *MockStorage) ListJobStatuses() ([]*models.JobStatus, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	keyIDs, exists := m.apiKeysByPrefix[keyPrefix]
-	if !exists {
-		return []*models.APIKey{}, nil
-	}
-
-	keys := []*models.APIKey{}
-	for _, keyID := range keyIDs {
-		if key, exists := m.apiKeys[keyID]; exists {
-			keys = append(keys, key)
-		}
+	statuses := []*models.JobStatus{}
+	for _, status := range m.jobStatuses {
+		copied := *status
+		copied.Running = jobRunning(&copied)
+		statuses = append(statuses, &copied)
 	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
 
-	return keys, nil
+// copyFeatureFlag returns a copy of a flag that callers may modify
+func copyFeatureFlag(flag *models.FeatureFlag) *models.FeatureFlag {
+	copied := *flag
+	copied.Orgs = append([]models.FeatureFlagOverride{}, flag.Orgs...)
+	return &copied
 }
 
-// GetAPIKeysByUserID retrieves all API keys for a user
-func (m *MockStorage) GetAPIKeysByUserID(userID string) ([]*models.APIKey, error) {
+// ListFeatureFlags returns every flag with its organization overrides, by name
+func (m *MockStorage) ListFeatureFlags() ([]*models.FeatureFlag, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	keyIDs, exists := m.apiKeysByUser[userID]
-	if !exists {
-		return []*models.APIKey{}, nil
+	flags := []*models.FeatureFlag{}
+	for _, flag := range m.featureFlags {
+		flags = append(flags, copyFeatureFlag(flag))
 	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
 
-	keys := []*models.APIKey{}
-	for _, keyID := range keyIDs {
-		if key, exists := m.apiKeys[keyID]; exists {
-			keys = append(keys, key)
-		}
-	}
+// SetFeatureFlag creates a flag or replaces its description and default
+func (m *MockStorage) SetFeatureFlag(name, description string, enabled bool) (*models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return keys, nil
+	now := time.Now()
+	flag, exists := m.featureFlags[name]
+	if !exists {
+		flag = &models.FeatureFlag{Name: name, Orgs: []models.FeatureFlagOverride{}, CreatedAt: now}
+		m.featureFlags[name] = flag
+	}
+	flag.Description = description
+	flag.Enabled = enabled
+	flag.UpdatedAt = now
+	return copyFeatureFlag(flag), nil
 }
 
-// DeleteAPIKey deletes an API key
-func (m *MockStorage) DeleteAPIKey(keyID string) error {
+// DeleteFeatureFlag removes a flag and its overrides
+func (m *MockStorage) DeleteFeatureFlag(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	key, exists := m.apiKeys[keyID]
-	if !exists {
+	if _, exists := m.featureFlags[name]; !exists {
 		return ErrNotFound
 	}
+	delete(m.featureFlags, name)
+	return nil
+}
 
-	// Remove from user mapping
-	keyIDs := m.apiKeysByUser[key.UserID]
-	newKeyIDs := []string{}
-	for _, kid := range keyIDs {
-		if kid != keyID {
-			newKeyIDs = append(newKeyIDs, kid)
-		}
-	}
-	m.apiKeysByUser[key.UserID] = newKeyIDs
+// SetFeatureFlagOverride enables or disables a flag for one organization
+func (m *MockStorage) SetFeatureFlagOverride(name, orgID string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Remove from prefix mapping
-	keyIDs = m.apiKeysByPrefix[key.KeyPrefix]
-	newKeyIDs = []string{}
-	for _, kid := range keyIDs {
-		if kid != keyID {
-			newKeyIDs = append(newKeyIDs, kid)
+	flag, exists := m.featureFlags[name]
+	if !exists {
+		return ErrNotFound
+	}
+	override := models.FeatureFlagOverride{OrgID: orgID, Enabled: enabled, UpdatedAt: time.Now()}
+	for i := range flag.Orgs {
+		if flag.Orgs[i].OrgID == orgID {
+			flag.Orgs[i] = override
+			return nil
 		}
 	}
-	m.apiKeysByPrefix[key.KeyPrefix] = newKeyIDs
-
-	delete(m.apiKeys, keyID)
+	flag.Orgs = append(flag.Orgs, override)
+	sort.Slice(flag.Orgs, func(i, j int) bool { return flag.Orgs[i].OrgID < flag.Orgs[j].OrgID })
 	return nil
 }
 
-// UpdateAPIKeyLastUsed updates the last_used_at timestamp
-func (m *MockStorage) UpdateAPIKeyLastUsed(keyID string) error {
+// DeleteFeatureFlagOverride returns the organization to the flag's default
+func (m *MockStorage) DeleteFeatureFlagOverride(name, orgID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	key, exists := m.apiKeys[keyID]
+	flag, exists := m.featureFlags[name]
 	if !exists {
 		return ErrNotFound
 	}
+	for i := range flag.Orgs {
+		if flag.Orgs[i].OrgID == orgID {
+			flag.Orgs = append(flag.Orgs[:i], flag.Orgs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
 
-	now := time.Now()
-	key.LastUsedAt = &now
+// CreateIOCList stores a list with its indicators
+func (m *MockStorage) CreateIOCList(list *models.IOCList, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.iocListNameTaken(list.Name, orgID, list.ID) {
+		return ErrIOCListNameTaken
+	}
+	now := time.Now().UTC()
+	list.CreatedAt = now
+	list.UpdatedAt = now
+	list.IndicatorCount = len(list.Indicators)
+	m.iocLists[list.ID] = copyIOCList(list)
+	m.iocListOrgID[list.ID] = orgID
 	return nil
 }
 
-// CreateOrganization creates a new organization
-func (m *MockStorage) CreateOrganization(name string) (*models.Organization, error) {
+// ReplaceIOCList replaces a list's name, format, and indicators
+func (m *MockStorage) ReplaceIOCList(list *models.IOCList, orgID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldErrorOnCreateOrg {
-		return nil, ErrNotFound
+	existing, exists := m.iocLists[list.ID]
+	if !exists || m.iocListOrgID[list.ID] != orgID {
+		return ErrNotFound
 	}
-
-	// Check if name already exists
-	if _, exists := m.organizationsByName[name]; exists {
-		return nil, ErrNotFound
+	if m.iocListNameTaken(list.Name, orgID, list.ID) {
+		return ErrIOCListNameTaken
 	}
+	list.CreatedBy = existing.CreatedBy
+	list.CreatedAt = existing.CreatedAt
+	list.UpdatedAt = time.Now().UTC()
+	list.IndicatorCount = len(list.Indicators)
+	m.iocLists[list.ID] = copyIOCList(list)
 
-	orgID := "org-" + name // Simple ID generation
-	org := &models.Organization{
-		ID:        orgID,
-		Name:      name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	kept := make(map[models.IOCIndicator]bool, len(list.Indicators))
+	for _, indicator := range list.Indicators {
+		kept[models.IOCIndicator{Type: indicator.Type, Value: indicator.Value}] = true
 	}
+	for key, match := range m.iocMatches {
+		if match.ListID == list.ID && !kept[models.IOCIndicator{Type: match.Type, Value: match.Value}] {
+			delete(m.iocMatches, key)
+		}
+	}
+	return nil
+}
 
-	m.organizations[orgID] = org
-	m.organizationsByName[name] = orgID
-
-	return org, nil
+// iocListNameTaken reports whether another list of the organization has the name
+func (m *MockStorage) iocListNameTaken(name, orgID, listID string) bool {
+	for id, list := range m.iocLists {
+		if id != listID && m.iocListOrgID[id] == orgID && list.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
-// GetOrganizationByID retrieves an organization by ID
-func (m *MockStorage) GetOrganizationByID(orgID string) (*models.Organization, error) {
+// ListIOCLists returns the organization's lists without their indicators, by name
+func (m *MockStorage) ListIOCLists(orgID string) ([]*models.IOCList, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	org, exists := m.organizations[orgID]
-	if !exists {
-		return nil, ErrNotFound
+	lists := []*models.IOCList{}
+	for id, list := range m.iocLists {
+		if m.iocListOrgID[id] == orgID {
+			summary := copyIOCList(list)
+			summary.Indicators = nil
+			lists = append(lists, summary)
+		}
 	}
-
-	return org, nil
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists, nil
 }
 
-// GetOrganizationByName retrieves an organization by name
-func (m *MockStorage) GetOrganizationByName(name string) (*models.Organization, error) {
+// GetIOCList returns a list of the organization with its indicators, by type and value
+func (m *MockStorage) GetIOCList(listID, orgID string) (*models.IOCList, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	orgID, exists := m.organizationsByName[name]
-	if !exists {
+	list, exists := m.iocLists[listID]
+	if !exists || m.iocListOrgID[listID] != orgID {
 		return nil, ErrNotFound
 	}
+	result := copyIOCList(list)
+	sort.Slice(result.Indicators, func(i, j int) bool {
+		a, b := result.Indicators[i], result.Indicators[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Value < b.Value
+	})
+	return result, nil
+}
 
-	org, exists := m.organizations[orgID]
-	if !exists {
-		return nil, ErrNotFound
-	}
+// DeleteIOCList removes a list with its matches
+func (m *MockStorage) DeleteIOCList(listID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return org, nil
+	if _, exists := m.iocLists[listID]; !exists || m.iocListOrgID[listID] != orgID {
+		return ErrNotFound
+	}
+	delete(m.iocLists, listID)
+	delete(m.iocListOrgID, listID)
+	for key, match := range m.iocMatches {
+		if match.ListID == listID {
+			delete(m.iocMatches, key)
+		}
+	}
+	return nil
 }
 
-// CountUsersInOrganization counts the number of users in an organization
-func (m *MockStorage) CountUsersInOrganization(orgID string) (int, error) {
+// GetIOCIndicators returns every list of the organization that has indicators, by name
+func (m *MockStorage) GetIOCIndicators(orgID string) ([]*models.IOCList, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	userIDs, exists := m.usersByOrg[orgID]
-	if !exists {
-		return 0, nil
+	lists := []*models.IOCList{}
+	for id, list := range m.iocLists {
+		if m.iocListOrgID[id] == orgID && len(list.Indicators) > 0 {
+			lists = append(lists, copyIOCList(list))
+		}
 	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists, nil
+}
 
-	return len(userIDs), nil
+// RecordIOCMatches stores the matches found in a host's report and returns the new ones
+func (m *MockStorage) RecordIOCMatches(orgID, hostID string, matches []models.IOCMatch, seenAt time.Time) ([]models.IOCMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seenAt = seenAt.UTC()
+	var newMatches []models.IOCMatch
+	for _, match := range matches {
+		if _, exists := m.iocLists[match.ListID]; !exists || m.iocListOrgID[match.ListID] != orgID {
+			continue
+		}
+		key := match.ListID + "\x00" + hostID + "\x00" + match.Type + "\x00" + match.Value
+		if existing, exists := m.iocMatches[key]; exists {
+			existing.Path = match.Path
+			if seenAt.After(existing.LastSeenAt) {
+				existing.LastSeenAt = seenAt
+			}
+			continue
+		}
+		match.HostID = hostID
+		match.FirstSeenAt = seenAt
+		match.LastSeenAt = seenAt
+		stored := match
+		m.iocMatches[key] = &stored
+		newMatches = append(newMatches, match)
+	}
+	return newMatches, nil
 }
 
-// ListUsersByOrganization lists all users in an organization
-func (m *MockStorage) ListUsersByOrganization(orgID string) ([]*models.User, error) {
+// ListIOCMatches returns the organization's matches selected by filter, most recently seen first
+func (m *MockStorage) ListIOCMatches(orgID string, filter models.IOCMatchFilter) ([]*models.IOCMatch, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	userIDs, exists := m.usersByOrg[orgID]
-	if !exists {
-		return []*models.User{}, nil
+	matches := []*models.IOCMatch{}
+	for _, match := range m.iocMatches {
+		list := m.iocLists[match.ListID]
+		if m.iocListOrgID[match.ListID] != orgID ||
+			(filter.HostID != "" && match.HostID != filter.HostID) ||
+			(filter.ListID != "" && match.ListID != filter.ListID) {
+			continue
+		}
+		host, exists := m.hosts[hostKey(orgID, match.HostID)]
+		if !exists {
+			continue // Deleted hosts lose their matches
+		}
+		result := *match
+		result.ListName = list.Name
+		result.Hostname = host.Meta.Hostname
+		for _, indicator := range list.Indicators {
+			if indicator.Type == match.Type && indicator.Value == match.Value {
+				result.Description = indicator.Description
+			}
+		}
+		matches = append(matches, &result)
 	}
-
-	users := []*models.User{}
-	for _, userID := range userIDs {
-		if user, exists := m.users[userID]; exists {
-			users = append(users, user)
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if !a.LastSeenAt.Equal(b.LastSeenAt) {
+			return a.LastSeenAt.After(b.LastSeenAt)
 		}
+		return a.HostID+a.ListID+a.Type+a.Value < b.HostID+b.ListID+b.Type+b.Value
+	})
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
 	}
+	return matches, nil
+}
 
-	return users, nil
+func copyIOCList(list *models.IOCList) *models.IOCList {
+	c := *list
+	c.Indicators = append([]models.IOCIndicator(nil), list.Indicators...)
+	return &c
 }
 
-// UpdateUserRole updates a user's role
-func (m *MockStorage) UpdateUserRole(userID, role string) error {
+// CreateHostGroup stores a group without members
+func (m *MockStorage) CreateHostGroup(group *models.HostGroup, orgID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	user, exists := m.users[userID]
-	if !exists {
-		return ErrNotFound
+	if m.hostGroupNameTaken(group.Name, orgID, group.ID) {
+		return ErrHostGroupNameTaken
 	}
-
-	user.Role = role
-	user.IsAdmin = role == "admin"
-	user.UpdatedAt = time.Now()
-
+	now := time.Now().UTC()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+	group.HostIDs = []string{}
+	m.hostGroups[group.ID] = copyHostGroup(group)
+	m.hostGroupOrgID[group.ID] = orgID
 	return nil
 }
 
-// DeleteUser deletes a user
-func (m *MockStorage) DeleteUser(userID string) error {
+// UpdateHostGroup replaces a group's name, description, and rule
+func (m *MockStorage) UpdateHostGroup(group *models.HostGroup, orgID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	user, exists := m.users[userID]
-	if !exists {
+	existing, exists := m.hostGroups[group.ID]
+	if !exists || m.hostGroupOrgID[group.ID] != orgID {
 		return ErrNotFound
 	}
+	if m.hostGroupNameTaken(group.Name, orgID, group.ID) {
+		return ErrHostGroupNameTaken
+	}
+	existing.Name = group.Name
+	existing.Description = group.Description
+	existing.Rule = group.Rule
+	existing.UpdatedAt = time.Now().UTC()
+	*group = *copyHostGroup(existing)
+	return nil
+}
 
-	// Remove from username mapping
-	delete(m.usersByUsername, user.Username)
+// hostGroupNameTaken reports whether another group of the organization has the name
+func (m *MockStorage) hostGroupNameTaken(name, orgID, groupID string) bool {
+	for id, group := range m.hostGroups {
+		if id != groupID && m.hostGroupOrgID[id] == orgID && group.Name == name {
+			return true
+		}
+	}
+	return false
+}
 
-	// Remove from email mapping
-	delete(m.usersByEmail, user.Email)
+// ListHostGroups returns the organization's groups with their static members, by name
+func (m *MockStorage) ListHostGroups(orgID string) ([]*models.HostGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	// Remove from org mapping
-	userIDs := m.usersByOrg[user.OrgID]
-	newUserIDs := []string{}
-	for _, uid := range userIDs {
-		if uid != userID {
-			newUserIDs = append(newUserIDs, uid)
+	groups := []*models.HostGroup{}
+	for id, group := range m.hostGroups {
+		if m.hostGroupOrgID[id] == orgID {
+			groups = append(groups, copyHostGroup(group))
 		}
 	}
-	m.usersByOrg[user.OrgID] = newUserIDs
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
 
-	delete(m.users, userID)
-	delete(m.passwords, userID)
+// GetHostGroup returns a group of the organization with its static members
+func (m *MockStorage) GetHostGroup(groupID, orgID string) (*models.HostGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	group, exists := m.hostGroups[groupID]
+	if !exists || m.hostGroupOrgID[groupID] != orgID {
+		return nil, ErrNotFound
+	}
+	return copyHostGroup(group), nil
+}
+
+// DeleteHostGroup removes a group with its membership
+func (m *MockStorage) DeleteHostGroup(groupID, orgID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.hostGroups[groupID]; !exists || m.hostGroupOrgID[groupID] != orgID {
+		return ErrNotFound
+	}
+	delete(m.hostGroups, groupID)
+	delete(m.hostGroupOrgID, groupID)
+	return nil
+}
 
+// AddHostGroupMember adds a host of the organization to a group's static members
+func (m *MockStorage) AddHostGroupMember(groupID, orgID, hostID, actorUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, exists := m.hostGroups[groupID]
+	if !exists || m.hostGroupOrgID[groupID] != orgID || !m.hostInOrg(hostID, orgID) {
+		return ErrNotFound
+	}
+	if !slices.Contains(group.HostIDs, hostID) {
+		group.HostIDs = append(group.HostIDs, hostID)
+		sort.Strings(group.HostIDs)
+	}
+	return nil
+}
+
+// RemoveHostGroupMember removes a host from a group's static members
+func (m *MockStorage) RemoveHostGroupMember(groupID, orgID, hostID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, exists := m.hostGroups[groupID]
+	if !exists || m.hostGroupOrgID[groupID] != orgID || !slices.Contains(group.HostIDs, hostID) {
+		return ErrNotFound
+	}
+	group.HostIDs = slices.DeleteFunc(group.HostIDs, func(hid string) bool { return hid == hostID })
 	return nil
 }
+
+func copyHostGroup(group *models.HostGroup) *models.HostGroup {
+	c := *group
+	c.HostIDs = append([]string{}, group.HostIDs...)
+	return &c
+}
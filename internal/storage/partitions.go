@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// hostReportPartitionPrefix starts the names of host_reports' monthly partitions, which
+// end in the month as YYYYMM
+const hostReportPartitionPrefix = "host_reports_p"
+
+// hostReportPartition returns the name and bounds of the monthly partition holding t
+func hostReportPartition(t time.Time) (name string, from, to time.Time) {
+	t = t.UTC()
+	from = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return hostReportPartitionPrefix + from.Format("200601"), from, from.AddDate(0, 1, 0)
+}
+
+// parseHostReportPartition returns the bounds of a monthly partition from its name
+// ok is false for other partitions, such as host_reports_default.
+func parseHostReportPartition(name string) (from, to time.Time, ok bool) {
+	month, found := strings.CutPrefix(name, hostReportPartitionPrefix)
+	if !found {
+		return time.Time{}, time.Time{}, false
+	}
+	from, err := time.Parse("200601", month)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, from.AddDate(0, 1, 0), true
+}
+
+// hostReportPartitions returns the names of host_reports' partitions
+func (ps *PostgresStorage) hostReportPartitions() (map[string]bool, error) {
+	rows, err := ps.db.Query(`
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'host_reports'::regclass
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host report partitions: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	partitions := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan host report partition: %w", err)
+		}
+		partitions[name] = true
+	}
+	return partitions, rows.Err()
+}
+
+// EnsureHostReportPartitions creates the monthly partitions of host_reports from the
+// month of from through the month of to that do not exist yet
+func (ps *PostgresStorage) EnsureHostReportPartitions(from, to time.Time) ([]string, error) {
+	existing, err := ps.hostReportPartitions()
+	if err != nil {
+		return nil, err
+	}
+	created := []string{}
+	month := from
+	for {
+		name, start, end := hostReportPartition(month)
+		if start.After(to) {
+			break
+		}
+		if !existing[name] {
+			if err := ps.createHostReportPartition(name, start, end); err != nil {
+				return created, err
+			}
+			created = append(created, name)
+		}
+		month = end
+	}
+	return created, nil
+}
+
+// createHostReportPartition creates and attaches a monthly partition of host_reports
+// Reports of the month already in the default partition are moved into it first, since
+// Postgres does not attach a partition while the default one holds rows in its range.
+func (ps *PostgresStorage) createHostReportPartition(name string, from, to time.Time) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Replicas creating the same partition take turns; the later one finds it exists
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('host_reports_partitions'))"); err != nil {
+		return fmt.Errorf("failed to lock host report partitions: %w", classifyError(err))
+	}
+	var exists bool
+	if err := tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check host report partition: %w", classifyError(err))
+	}
+	if exists {
+		return nil
+	}
+
+	table := pq.QuoteIdentifier(name)
+	if _, err := tx.Exec("CREATE TABLE " + table + " (LIKE host_reports INCLUDING DEFAULTS)"); err != nil {
+		return fmt.Errorf("failed to create host report partition %s: %w", name, classifyError(err))
+	}
+	_, err = tx.Exec(`
+		WITH moved AS (
+			DELETE FROM host_reports_default WHERE received_at >= $1 AND received_at < $2
+			RETURNING *
+		)
+		INSERT INTO `+table+` SELECT * FROM moved
+	`, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to move reports to host report partition %s: %w", name, classifyError(err))
+	}
+	// Attaching adds the parent's primary key, index, and foreign keys to the partition
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE host_reports ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)",
+		table, pq.QuoteLiteral(from.Format(time.RFC3339)), pq.QuoteLiteral(to.Format(time.RFC3339))))
+	if err != nil {
+		return fmt.Errorf("failed to attach host report partition %s: %w", name, classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create host report partition %s: %w", name, classifyError(err))
+	}
+	return nil
+}
+
+// DropHostReportPartitions drops the monthly partitions of host_reports that end at or
+// before before, and deletes the reports of those months from the default partition
+func (ps *PostgresStorage) DropHostReportPartitions(before time.Time) ([]string, error) {
+	existing, err := ps.hostReportPartitions()
+	if err != nil {
+		return nil, err
+	}
+	// Whole months are dropped: those that ended by the start of before's month
+	_, cutoff, _ := hostReportPartition(before)
+
+	dropped := []string{}
+	for name := range existing {
+		_, end, ok := parseHostReportPartition(name)
+		if !ok || end.After(cutoff) {
+			continue
+		}
+		if _, err := ps.db.Exec("DROP TABLE IF EXISTS " + pq.QuoteIdentifier(name)); err != nil {
+			return dropped, fmt.Errorf("failed to drop host report partition %s: %w", name, classifyError(err))
+		}
+		dropped = append(dropped, name)
+	}
+	if _, err := ps.db.Exec("DELETE FROM host_reports_default WHERE received_at < $1", cutoff); err != nil {
+		return dropped, fmt.Errorf("failed to delete old host reports: %w", classifyError(err))
+	}
+	sort.Strings(dropped)
+	return dropped, nil
+}
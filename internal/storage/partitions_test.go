@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostReportPartition(t *testing.T) {
+	name, from, to := hostReportPartition(time.Date(2026, time.January, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600)))
+	if name != "host_reports_p202602" {
+		t.Errorf("name = %q, want host_reports_p202602", name)
+	}
+	if want := time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC); !from.Equal(want) {
+		t.Errorf("from = %s, want %s", from, want)
+	}
+	if want := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC); !to.Equal(want) {
+		t.Errorf("to = %s, want %s", to, want)
+	}
+
+	parsedFrom, parsedTo, ok := parseHostReportPartition(name)
+	if !ok || !parsedFrom.Equal(from) || !parsedTo.Equal(to) {
+		t.Errorf("parseHostReportPartition(%q) = %s, %s, %v", name, parsedFrom, parsedTo, ok)
+	}
+	for _, other := range []string{"host_reports_default", "host_reports_p2026", "hosts"} {
+		if _, _, ok := parseHostReportPartition(other); ok {
+			t.Errorf("parseHostReportPartition(%q) ok, want not a monthly partition", other)
+		}
+	}
+}
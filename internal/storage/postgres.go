@@ -1,28 +1,81 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 
 	"snailbus/internal/models"
+	"snailbus/internal/search"
+	"snailbus/internal/secretbox"
+	"snailbus/internal/sqlbuilder"
 )
 
+// DefaultApplicationName identifies snailbus connections in pg_stat_activity
+// It is used unless the DSN already sets application_name
+const DefaultApplicationName = "snailbus"
+
+// maxApplicationNameLength is Postgres' limit (NAMEDATALEN - 1)
+const maxApplicationNameLength = 63
+
+// classifyError maps Postgres errors onto the storage sentinels, keeping the
+// original error wrapped for logs. Other errors are returned unchanged.
+func classifyError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+	switch pqErr.Code {
+	case "22P02": // invalid_text_representation, e.g. a malformed UUID
+		return fmt.Errorf("%w: %w", ErrInvalidID, err)
+	case "23505": // unique_violation
+		switch pqErr.Constraint {
+		case "users_username_key":
+			return fmt.Errorf("%w: %w", ErrUsernameTaken, err)
+		case "users_email_key":
+			return fmt.Errorf("%w: %w", ErrEmailTaken, err)
+		case "organizations_name_lower_key":
+			return fmt.Errorf("%w: %w", ErrOrgNameTaken, err)
+		case "idx_api_keys_key_prefix_unique":
+			return fmt.Errorf("%w: %w", ErrAPIKeyPrefixTaken, err)
+		case "ioc_lists_org_name_key":
+			return fmt.Errorf("%w: %w", ErrIOCListNameTaken, err)
+		case "host_groups_org_name_key":
+			return fmt.Errorf("%w: %w", ErrHostGroupNameTaken, err)
+		case "user_org_memberships_pkey":
+			return fmt.Errorf("%w: %w", ErrAlreadyMember, err)
+		}
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case "23503", "23514", "22001": // foreign_key_violation, check_violation, string_data_right_truncation
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	return err
+}
+
 // PostgresStorage implements Storage using PostgreSQL
 type PostgresStorage struct {
-	db *sql.DB
+	db      database       // Queries run here: the pool, or the transaction inside WithTx
+	pool    *sql.DB        // Shared with the storages WithTx creates
+	appName string         // application_name reported by our connections
+	replica *replica       // Optional read replica, see EnableReplica
+	secrets *secretbox.Box // Optional encryption of stored secrets, see EnableSecretEncryption
 }
 
 // DB returns the underlying database connection for metrics collection
 func (ps *PostgresStorage) DB() *sql.DB {
-	return ps.db
+	return ps.pool
 }
 
 // NewPostgresStorage creates a new PostgreSQL-backed storage
 func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
+	dsn, appName := withApplicationName(dsn)
+
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -39,349 +92,4657 @@ func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	ps := &PostgresStorage{
-		db: db,
+		db:      poolDB{db},
+		pool:    db,
+		appName: appName,
 	}
 
 	return ps, nil
 }
 
-// SaveHost stores or updates a host's report (replaces any previous report)
-// If the host already exists, it verifies that org_id matches before updating
-func (ps *PostgresStorage) SaveHost(report *models.Report, orgID, uploadedByUserID string) error {
-	// First, check if host exists and verify org_id matches
-	var existingOrgID string
-	checkQuery := `SELECT org_id FROM hosts WHERE host_id = $1`
-	err := ps.db.QueryRow(checkQuery, report.Meta.HostID).Scan(&existingOrgID)
+// withApplicationName returns dsn with application_name set to DefaultApplicationName,
+// unless the DSN already sets one, along with the effective application name
+// Both URL (postgres://...) and key=value connection strings are supported
+func withApplicationName(dsn string) (string, string) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// Let sql.Open report the malformed DSN
+			return dsn, DefaultApplicationName
+		}
+		q := u.Query()
+		if name := q.Get("application_name"); name != "" {
+			return dsn, name
+		}
+		q.Set("application_name", DefaultApplicationName)
+		u.RawQuery = q.Encode()
+		return u.String(), DefaultApplicationName
+	}
 
-	if err == nil {
-		// Host exists - verify org_id matches
-		if existingOrgID != orgID {
-			return fmt.Errorf("host belongs to a different organization: %w", ErrNotFound)
+	for _, field := range strings.Fields(dsn) {
+		if name, ok := strings.CutPrefix(field, "application_name="); ok && name != "" {
+			return dsn, strings.Trim(name, "'")
 		}
-	} else if err != sql.ErrNoRows {
-		// Unexpected error
-		return fmt.Errorf("failed to check existing host: %w", err)
 	}
-	// If err == sql.ErrNoRows, host doesn't exist, proceed with insert
+	return strings.TrimSpace(dsn + " application_name=" + DefaultApplicationName), DefaultApplicationName
+}
 
-	// Use INSERT with ON CONFLICT
-	// Note: We've already verified org_id matches above if the host exists
-	query := `
-		INSERT INTO hosts (host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors, org_id, uploaded_by_user_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (host_id) DO UPDATE SET
-			hostname = EXCLUDED.hostname,
-			received_at = EXCLUDED.received_at,
-			collection_id = EXCLUDED.collection_id,
-			timestamp = EXCLUDED.timestamp,
-			snail_version = EXCLUDED.snail_version,
-			data = EXCLUDED.data,
-			errors = EXCLUDED.errors,
-			org_id = EXCLUDED.org_id,
-			uploaded_by_user_id = EXCLUDED.uploaded_by_user_id
-	`
+// conn returns a dedicated connection for a context-aware operation
+// If ctx carries a query tag (see WithQueryTag), the connection's application_name is
+// set to "<app>/<tag>" so the queries can be traced back to the request that issued them.
+// Callers must hand the connection back with releaseConn.
+func (ps *PostgresStorage) conn(ctx context.Context) (*sql.Conn, error) {
+	conn, err := ps.pool.Conn(ctx)
+	if err != nil {
+		return nil, withRequest(ctx, fmt.Errorf("failed to acquire connection: %w", err))
+	}
 
-	var errors []string
-	if report.Errors != nil {
-		errors = report.Errors
+	tag := queryTag(ctx)
+	if tag == "" {
+		return conn, nil
 	}
 
-	_, err = ps.db.Exec(query,
-		report.Meta.HostID,
-		report.Meta.Hostname,
-		report.ReceivedAt,
-		report.Meta.CollectionID,
-		report.Meta.Timestamp,
-		report.Meta.SnailVersion,
-		report.Data,
-		pq.Array(errors),
-		orgID,
-		uploadedByUserID,
-	)
+	name := ps.appName + "/" + tag
+	if len(name) > maxApplicationNameLength {
+		name = name[:maxApplicationNameLength]
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT set_config('application_name', $1, false)`, name); err != nil {
+		conn.Close()
+		return nil, withRequest(ctx, fmt.Errorf("failed to set application name: %w", err))
+	}
+	return conn, nil
+}
+
+// releaseConn restores the connection's default application_name and returns it to the pool
+func (ps *PostgresStorage) releaseConn(conn *sql.Conn) {
+	// RESET falls back to the value from the DSN; if it fails the connection is
+	// likely broken and database/sql will discard it
+	conn.ExecContext(context.Background(), `RESET application_name`)
+	conn.Close()
+}
+
+// SaveHost stores or updates a host's report (replaces any previous report)
+// Hosts are keyed by organization and host ID, so the same agent-generated ID
+// reported by another organization is stored as a separate host.
+func (ps *PostgresStorage) SaveHost(report *models.Report, orgID, uploadedByUserID string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockHost(tx, orgID, report.Meta.HostID); err != nil {
+		return err
+	}
+	if err := saveHost(tx, report, orgID, uploadedByUserID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save host: %w", classifyError(err))
+	}
+	return nil
+}
 
+// SaveHosts stores or updates the reports of several hosts in one transaction
+// Either every report is stored or none is. Hosts are locked in ID order, so batches
+// sharing hosts cannot deadlock; reports are then applied in the order given.
+func (ps *PostgresStorage) SaveHosts(reports []*models.Report, orgID, uploadedByUserID string) error {
+	tx, err := ps.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to save host: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, hostID := range batchHostIDs(reports) {
+		if err := lockHost(tx, orgID, hostID); err != nil {
+			return err
+		}
+	}
+	for _, report := range reports {
+		if err := saveHost(tx, report, orgID, uploadedByUserID); err != nil {
+			return err
+		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save hosts: %w", classifyError(err))
+	}
 	return nil
 }
 
+// saveHost appends the ingested or updated event of a report to a locked host
+func saveHost(tx dbConn, report *models.Report, orgID, uploadedByUserID string) error {
+	var existed bool
+	err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM hosts WHERE host_id = $1 AND org_id = $2)`, report.Meta.HostID, orgID,
+	).Scan(&existed)
+	if err != nil {
+		return fmt.Errorf("failed to check existing host: %w", classifyError(err))
+	}
+
+	return appendHostEvent(tx, snapshotEvent(report, orgID, uploadedByUserID, existed))
+}
+
 // GetHost returns the full report data for a specific host (by host_id UUID)
 // Verifies that the host belongs to the specified organization
 func (ps *PostgresStorage) GetHost(hostID, orgID string) (*models.Report, error) {
 	query := `
-		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors
+		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors, health
 		FROM hosts
 		WHERE host_id = $1 AND org_id = $2
 	`
 
 	report := &models.Report{}
 	var errors []string
+	var timestamp sql.NullTime
+	var health []byte
 
 	err := ps.db.QueryRow(query, hostID, orgID).Scan(
 		&report.Meta.HostID,
 		&report.Meta.Hostname,
 		&report.ReceivedAt,
 		&report.Meta.CollectionID,
-		&report.Meta.Timestamp,
+		&timestamp,
 		&report.Meta.SnailVersion,
 		&report.Data,
 		pq.Array(&errors),
+		&health,
 	)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get host: %w", err)
+		return nil, fmt.Errorf("failed to get host: %w", classifyError(err))
 	}
 
 	report.ID = report.Meta.HostID // Use host_id as ID
+	report.Meta.Timestamp = reportTimestamp(timestamp)
 	report.Errors = errors
+	report.Health = decodeHealth(health)
 	return report, nil
 }
 
-// DeleteHost removes a host by host_id
-// Verifies that the host belongs to the specified organization before deletion
-func (ps *PostgresStorage) DeleteHost(hostID, orgID string) error {
-	result, err := ps.db.Exec("DELETE FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID)
-	if err != nil {
-		return fmt.Errorf("failed to delete host: %w", err)
+// GetHostSelection returns a host's report with only the selected parts of its data,
+// extracted in the database so the rest of the report is not read out
+func (ps *PostgresStorage) GetHostSelection(hostID, orgID string, sel HostSelection) (*models.Report, error) {
+	if !sel.OmitData && sel.Paths == nil {
+		return ps.GetHost(hostID, orgID)
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrNotFound
+	// Each path is extracted with #>, in order, into one array; a missing path is null
+	data := "NULL::jsonb"
+	args := []interface{}{hostID, orgID}
+	if !sel.OmitData {
+		data = `(SELECT jsonb_agg(data #> string_to_array(p, '.') ORDER BY n)
+			FROM unnest($3::text[]) WITH ORDINALITY AS t(p, n))`
+		paths := make([]string, len(sel.Paths))
+		for i, path := range sel.Paths {
+			paths[i] = strings.Join(path, ".")
+		}
+		args = append(args, pq.Array(paths))
 	}
-
-	return nil
-}
-
-// ListHosts returns all hosts with summary info for the specified organization
-func (ps *PostgresStorage) ListHosts(orgID string) ([]*models.HostSummary, error) {
 	query := `
-		SELECT host_id, hostname, received_at, data, org_id, uploaded_by_user_id
+		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, ` + data + `, errors, health
 		FROM hosts
-		WHERE org_id = $1
-		ORDER BY received_at DESC
+		WHERE host_id = $1 AND org_id = $2
 	`
 
-	rows, err := ps.db.Query(query, orgID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list hosts: %w", err)
-	}
-	defer rows.Close()
-
-	var hosts []*models.HostSummary
+	report := &models.Report{}
+	var errors []string
+	var timestamp sql.NullTime
+	var values, health []byte
 
-	for rows.Next() {
-		var hostID string
-		var hostname string
-		var receivedAt time.Time
-		var dataJSON []byte
-		var orgID string
-		var uploadedByUserID string
+	err := ps.db.QueryRow(query, args...).Scan(
+		&report.Meta.HostID,
+		&report.Meta.Hostname,
+		&report.ReceivedAt,
+		&report.Meta.CollectionID,
+		&timestamp,
+		&report.Meta.SnailVersion,
+		&values,
+		pq.Array(&errors),
+		&health,
+	)
 
-		if err := rows.Scan(&hostID, &hostname, &receivedAt, &dataJSON, &orgID, &uploadedByUserID); err != nil {
-			return nil, fmt.Errorf("failed to scan host: %w", err)
-		}
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host: %w", classifyError(err))
+	}
 
-		// Extract OS info from JSONB data
-		var osName, osVersion, osVersionMajor, osVersionMinor, osVersionPatch string
-		var data map[string]interface{}
-		if err := json.Unmarshal(dataJSON, &data); err == nil {
-			if system, ok := data["system"].(map[string]interface{}); ok {
-				if os, ok := system["os"].(map[string]interface{}); ok {
-					if name, ok := os["name"].(string); ok {
-						osName = name
-					}
-					if version, ok := os["version"].(string); ok {
-						osVersion = version
-					}
-					// Extract version components
-					if major, ok := os["version_major"].(string); ok && major != "" {
-						osVersionMajor = major
-					}
-					if minor, ok := os["version_minor"].(string); ok && minor != "" {
-						osVersionMinor = minor
-					}
-					if patch, ok := os["version_patch"].(string); ok && patch != "" {
-						osVersionPatch = patch
-					}
-				}
-			}
+	if !sel.OmitData {
+		var extracted []json.RawMessage
+		if err := json.Unmarshal(values, &extracted); err != nil {
+			return nil, fmt.Errorf("failed to decode host data paths: %w", err)
 		}
-
-		host := &models.HostSummary{
-			HostID:           hostID,
-			Hostname:         hostname,
-			OSName:           osName,
-			OSVersion:        osVersion,
-			OSVersionMajor:   osVersionMajor,
-			OSVersionMinor:   osVersionMinor,
-			OSVersionPatch:   osVersionPatch,
-			OrgID:            orgID,
-			UploadedByUserID: uploadedByUserID,
-			LastSeen:         receivedAt,
+		if report.Data, err = nestDataPaths(sel.Paths, extracted); err != nil {
+			return nil, fmt.Errorf("failed to encode host data paths: %w", err)
 		}
-
-		hosts = append(hosts, host)
 	}
-
-	return hosts, nil
+	report.ID = report.Meta.HostID // Use host_id as ID
+	report.Meta.Timestamp = reportTimestamp(timestamp)
+	report.Errors = errors
+	report.Health = decodeHealth(health)
+	return report, nil
 }
 
-// GetAllHosts returns all hosts with their full report data for the specified organization
-func (ps *PostgresStorage) GetAllHosts(orgID string) ([]*models.Report, error) {
-	query := `
-		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors
-		FROM hosts
-		WHERE org_id = $1
-		ORDER BY received_at DESC
-	`
-
-	rows, err := ps.db.Query(query, orgID)
+// GetHostHealth returns the health from a host's last report, nil if it reported none
+func (ps *PostgresStorage) GetHostHealth(hostID, orgID string) (*models.HostHealth, error) {
+	var health []byte
+	err := ps.db.QueryRow("SELECT health FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).Scan(&health)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all hosts: %w", err)
+		return nil, fmt.Errorf("failed to get host health: %w", classifyError(err))
 	}
-	defer rows.Close()
-
-	var reports []*models.Report
-	for rows.Next() {
-		report := &models.Report{}
-		var errors []string
-
-		if err := rows.Scan(
-			&report.Meta.HostID,
-			&report.Meta.Hostname,
-			&report.ReceivedAt,
-			&report.Meta.CollectionID,
-			&report.Meta.Timestamp,
-			&report.Meta.SnailVersion,
-			&report.Data,
-			pq.Array(&errors),
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan report: %w", err)
-		}
+	return decodeHealth(health), nil
+}
 
-		report.ID = report.Meta.HostID
-		report.Errors = errors
-		reports = append(reports, report)
+// encodeHealth encodes a report's health for the hosts.health column; nil stays NULL
+func encodeHealth(health *models.HostHealth) (interface{}, error) {
+	if health == nil {
+		return nil, nil
 	}
-
-	return reports, nil
+	encoded, err := json.Marshal(health)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host health: %w", err)
+	}
+	return encoded, nil
 }
 
-// Close closes the database connection
-func (ps *PostgresStorage) Close() error {
-	return ps.db.Close()
+// decodeHealth decodes the hosts.health column; NULL and unreadable values are nil
+func decodeHealth(raw []byte) *models.HostHealth {
+	if len(raw) == 0 {
+		return nil
+	}
+	var health models.HostHealth
+	if err := json.Unmarshal(raw, &health); err != nil {
+		return nil
+	}
+	return &health
 }
 
-// Auth methods
-
-// CreateUser creates a new user
-func (ps *PostgresStorage) CreateUser(username, email, passwordHash, orgID, role string) (*models.User, error) {
-	query := `
-		INSERT INTO users (username, email, password_hash, org_id, role)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, username, email, is_active, is_admin, org_id, role, created_at, updated_at
-	`
-
-	user := &models.User{}
-	err := ps.db.QueryRow(query, username, email, passwordHash, orgID, role).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.IsActive,
-		&user.IsAdmin,
-		&user.OrgID,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+// DeleteHost removes a host by host_id
+// Verifies that the host belongs to the specified organization before deletion
+func (ps *PostgresStorage) DeleteHost(hostID, orgID, actorUserID string, deletion *models.HostDeletion) error {
+	return ps.mutateHost(hostID, orgID, func(tx dbConn, hostname string) error {
+		return appendHostEvent(tx, &models.HostEvent{
+			OrgID:       orgID,
+			HostID:      hostID,
+			Hostname:    hostname,
+			Type:        models.HostEventDeleted,
+			ActorUserID: actorUserID,
+			Payload:     deletionPayload(deletion),
+		})
+	})
+}
 
+// mutateHost runs fn in a transaction holding the host's lock
+// Returns ErrNotFound if the host does not exist in the organization
+func (ps *PostgresStorage) mutateHost(hostID, orgID string, fn func(tx dbConn, hostname string) error) error {
+	tx, err := ps.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return user, nil
-}
-
-// GetUserByUsername retrieves a user by username and returns the password hash
-func (ps *PostgresStorage) GetUserByUsername(username string) (*models.User, string, error) {
-	query := `
-		SELECT id, username, email, password_hash, is_active, is_admin, org_id, role, created_at, updated_at
-		FROM users
-		WHERE username = $1
-	`
-
-	user := &models.User{}
-	var passwordHash string
-
-	err := ps.db.QueryRow(query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&passwordHash,
-		&user.IsActive,
-		&user.IsAdmin,
-		&user.OrgID,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	if err := lockHost(tx, orgID, hostID); err != nil {
+		return err
+	}
 
+	var hostname string
+	err = tx.QueryRow("SELECT hostname FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).Scan(&hostname)
 	if err == sql.ErrNoRows {
-		return nil, "", ErrNotFound
+		return ErrNotFound
 	}
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to check host: %w", classifyError(err))
 	}
 
-	return user, passwordHash, nil
+	if err := fn(tx, hostname); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host change: %w", err)
+	}
+	return nil
 }
 
-// GetUserByID retrieves a user by ID
-func (ps *PostgresStorage) GetUserByID(userID string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, is_active, is_admin, org_id, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
+// lockHost serializes mutations and replays of a single host until the transaction ends
+func lockHost(tx dbConn, orgID, hostID string) error {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('host:' || $1 || '/' || $2))", orgID, hostID); err != nil {
+		return fmt.Errorf("failed to lock host: %w", err)
+	}
+	return nil
+}
 
-	user := &models.User{}
-	err := ps.db.QueryRow(query, userID).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.IsActive,
-		&user.IsAdmin,
-		&user.OrgID,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+// appendHostEvent records an event and applies it to the hosts projection
+// The event's ID and CreatedAt are filled in from the database. A snapshot compacts the
+// host's previous one, since only the last is needed to rebuild or restore the host.
+func appendHostEvent(tx dbConn, event *models.HostEvent) error {
+	if isSnapshotEvent(event.Type) {
+		_, err := tx.Exec(`
+			UPDATE host_events
+			SET payload = jsonb_set(payload, '{report,data}', host_event_report_data(payload->'report'->'data'))
+			WHERE id = (
+				SELECT id FROM host_events
+				WHERE host_id = $1 AND org_id = $2 AND event_type IN ('ingested', 'updated', 'restored')
+				ORDER BY id DESC
+				LIMIT 1
+			)
+		`, event.HostID, event.OrgID)
+		if err != nil {
+			return fmt.Errorf("failed to compact host events: %w", err)
+		}
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+	payload := []byte("{}")
+	if event.Payload != nil {
+		var err error
+		if payload, err = json.Marshal(event.Payload); err != nil {
+			return fmt.Errorf("failed to encode host event: %w", err)
+		}
 	}
+
+	err := tx.QueryRow(`
+		INSERT INTO host_events (org_id, host_id, hostname, event_type, actor_user_id, payload)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6)
+		RETURNING id, created_at
+	`, event.OrgID, event.HostID, event.Hostname, event.Type, event.ActorUserID, payload).Scan(&event.ID, &event.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to append host event: %w", err)
 	}
 
-	return user, nil
+	return applyHostEvent(tx, event)
 }
 
-// GetUserByEmail retrieves a user by email
-func (ps *PostgresStorage) GetUserByEmail(email string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, is_active, is_admin, org_id, role, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
+// applyHostEvent updates hosts and host_tags for one event
+func applyHostEvent(tx dbConn, event *models.HostEvent) error {
+	payload := event.Payload
+	if payload == nil {
+		payload = &models.HostEventPayload{}
+	}
+
+	switch event.Type {
+	case models.HostEventIngested, models.HostEventUpdated:
+		return projectHostReport(tx, payload.Report, event.OrgID, payload.UploadedByUserID)
+	case models.HostEventTagged:
+		return projectHostTags(tx, event.HostID, event.OrgID, payload.Tags)
+	case models.HostEventEdited:
+		if payload.Details == nil {
+			return fmt.Errorf("host event has no details")
+		}
+		return projectHostDetails(tx, event.HostID, event.OrgID, *payload.Details)
+	case models.HostEventArchived:
+		return projectHostArchived(tx, event.HostID, event.OrgID, &event.CreatedAt)
+	case models.HostEventUnarchived:
+		return projectHostArchived(tx, event.HostID, event.OrgID, nil)
+	case models.HostEventDeleted:
+		if _, err := tx.Exec("DELETE FROM hosts WHERE host_id = $1 AND org_id = $2", event.HostID, event.OrgID); err != nil {
+			return fmt.Errorf("failed to delete host: %w", err)
+		}
+		return nil
+	case models.HostEventRestored:
+		if err := projectHostReport(tx, payload.Report, event.OrgID, payload.UploadedByUserID); err != nil {
+			return err
+		}
+		if err := projectHostTags(tx, event.HostID, event.OrgID, payload.Tags); err != nil {
+			return err
+		}
+		var details models.HostDetails
+		if payload.Details != nil {
+			details = *payload.Details
+		}
+		return projectHostDetails(tx, event.HostID, event.OrgID, details)
+	}
+	return fmt.Errorf("unknown host event type %q", event.Type)
+}
+
+// projectHostReport writes a report into hosts
+// A report does not change whether the host is archived, and clears its stale mark
+func projectHostReport(tx dbConn, report *models.Report, orgID, uploadedByUserID string) error {
+	if report == nil {
+		return fmt.Errorf("host event has no report")
+	}
+
+	query := `
+		INSERT INTO hosts (host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors, org_id, uploaded_by_user_id, health, sections)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (org_id, host_id) DO UPDATE SET
+			hostname = EXCLUDED.hostname,
+			received_at = EXCLUDED.received_at,
+			collection_id = EXCLUDED.collection_id,
+			timestamp = EXCLUDED.timestamp,
+			snail_version = EXCLUDED.snail_version,
+			data = EXCLUDED.data,
+			errors = EXCLUDED.errors,
+			uploaded_by_user_id = EXCLUDED.uploaded_by_user_id,
+			health = EXCLUDED.health,
+			sections = EXCLUDED.sections,
+			stale_since = NULL
+	`
+
+	var errors []string
+	if report.Errors != nil {
+		errors = report.Errors
+	}
+	health, err := encodeHealth(report.Health)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query,
+		report.Meta.HostID,
+		report.Meta.Hostname,
+		report.ReceivedAt,
+		report.Meta.CollectionID,
+		collectedAt(report.Meta.Timestamp),
+		report.Meta.SnailVersion,
+		report.Data,
+		pq.Array(errors),
+		orgID,
+		uploadedByUserID,
+		health,
+		pq.Array(models.ReportSections(report.Data)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save host: %w", classifyError(err))
+	}
+	if err := projectHostAccounts(tx, report.Meta.HostID, orgID, parseHostAccounts(report.Data)); err != nil {
+		return err
+	}
+	return projectHostServices(tx, report.Meta.HostID, orgID, parseHostServices(report.Data))
+}
+
+// projectHostAccounts replaces the account inventory of a host
+func projectHostAccounts(tx dbConn, hostID, orgID string, accounts []models.HostAccount) error {
+	if _, err := tx.Exec("DELETE FROM host_accounts WHERE host_id = $1 AND org_id = $2", hostID, orgID); err != nil {
+		return fmt.Errorf("failed to clear host accounts: %w", err)
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	usernames := make([]string, len(accounts))
+	uids := make([]sql.NullInt64, len(accounts))
+	gids := make([]sql.NullInt64, len(accounts))
+	homes := make([]string, len(accounts))
+	shells := make([]string, len(accounts))
+	for i, account := range accounts {
+		usernames[i] = account.Username
+		if account.UID != nil {
+			uids[i] = sql.NullInt64{Int64: *account.UID, Valid: true}
+		}
+		if account.GID != nil {
+			gids[i] = sql.NullInt64{Int64: *account.GID, Valid: true}
+		}
+		homes[i] = account.Home
+		shells[i] = account.Shell
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO host_accounts (host_id, org_id, username, uid, gid, home, shell)
+		SELECT $1, $2, a.username, a.uid, a.gid, a.home, a.shell
+		FROM unnest($3::text[], $4::bigint[], $5::bigint[], $6::text[], $7::text[]) AS a(username, uid, gid, home, shell)
+		ON CONFLICT DO NOTHING
+	`, hostID, orgID, pq.Array(usernames), pq.Array(uids), pq.Array(gids), pq.Array(homes), pq.Array(shells))
+	if err != nil {
+		return fmt.Errorf("failed to insert host accounts: %w", classifyError(err))
+	}
+	return nil
+}
+
+// projectHostServices replaces the listening port inventory of a host
+func projectHostServices(tx dbConn, hostID, orgID string, services []models.HostService) error {
+	if _, err := tx.Exec("DELETE FROM host_services WHERE host_id = $1 AND org_id = $2", hostID, orgID); err != nil {
+		return fmt.Errorf("failed to clear host services: %w", err)
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	protocols := make([]string, len(services))
+	addresses := make([]string, len(services))
+	ports := make([]int64, len(services))
+	processes := make([]string, len(services))
+	pids := make([]sql.NullInt64, len(services))
+	for i, service := range services {
+		protocols[i] = service.Protocol
+		addresses[i] = service.Address
+		ports[i] = int64(service.Port)
+		processes[i] = service.Process
+		if service.PID != nil {
+			pids[i] = sql.NullInt64{Int64: *service.PID, Valid: true}
+		}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO host_services (host_id, org_id, protocol, address, port, process, pid)
+		SELECT $1, $2, s.protocol, s.address, s.port, s.process, s.pid
+		FROM unnest($3::text[], $4::text[], $5::integer[], $6::text[], $7::bigint[]) AS s(protocol, address, port, process, pid)
+		ON CONFLICT DO NOTHING
+	`, hostID, orgID, pq.Array(protocols), pq.Array(addresses), pq.Array(ports), pq.Array(processes), pq.Array(pids))
+	if err != nil {
+		return fmt.Errorf("failed to insert host services: %w", classifyError(err))
+	}
+	return nil
+}
+
+// collectedAt converts ReportMeta.Timestamp for the hosts.timestamp column
+// Reports replayed from events recorded before timestamps were validated may hold
+// values that do not parse; those are stored as NULL.
+func collectedAt(timestamp string) sql.NullTime {
+	t, err := models.ParseReportTimestamp(timestamp)
+	if err != nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+// reportTimestamp formats hosts.timestamp as ReportMeta.Timestamp
+func reportTimestamp(timestamp sql.NullTime) string {
+	if !timestamp.Valid {
+		return ""
+	}
+	return models.FormatReportTimestamp(timestamp.Time)
+}
+
+// projectHostTags replaces the tags of a host and increments its metadata version
+func projectHostTags(tx dbConn, hostID, orgID string, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM host_tags WHERE host_id = $1 AND org_id = $2", hostID, orgID); err != nil {
+		return fmt.Errorf("failed to clear host tags: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE hosts SET metadata_version = metadata_version + 1 WHERE host_id = $1 AND org_id = $2", hostID, orgID); err != nil {
+		return fmt.Errorf("failed to update host metadata version: %w", err)
+	}
+
+	// host_tags.archived mirrors the host so the facet triggers can skip archived hosts' tags
+	if len(tags) > 0 {
+		_, err := tx.Exec(`
+			INSERT INTO host_tags (host_id, org_id, tag, archived)
+			SELECT $1, $2, unnest($3::text[]),
+				COALESCE((SELECT archived_at IS NOT NULL FROM hosts WHERE host_id = $1 AND org_id = $2), false)
+			ON CONFLICT DO NOTHING
+		`, hostID, orgID, pq.Array(tags))
+		if err != nil {
+			return fmt.Errorf("failed to insert host tags: %w", classifyError(err))
+		}
+	}
+	return nil
+}
+
+// projectHostDetails writes the user-maintained details of a host and increments its metadata version
+func projectHostDetails(tx dbConn, hostID, orgID string, details models.HostDetails) error {
+	_, err := tx.Exec(`
+		UPDATE hosts SET display_name = $3, description = $4, metadata_version = metadata_version + 1
+		WHERE host_id = $1 AND org_id = $2
+	`, hostID, orgID, details.DisplayName, details.Description)
+	if err != nil {
+		return fmt.Errorf("failed to update host details: %w", classifyError(err))
+	}
+	return nil
+}
+
+// projectHostArchived sets when a host was archived, or clears it if archivedAt is nil
+func projectHostArchived(tx dbConn, hostID, orgID string, archivedAt *time.Time) error {
+	_, err := tx.Exec(`UPDATE hosts SET archived_at = $3 WHERE host_id = $1 AND org_id = $2`, hostID, orgID, archivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update host archive state: %w", classifyError(err))
+	}
+	_, err = tx.Exec(`UPDATE host_tags SET archived = $3 WHERE host_id = $1 AND org_id = $2`, hostID, orgID, archivedAt != nil)
+	if err != nil {
+		return fmt.Errorf("failed to update host tags archive state: %w", classifyError(err))
+	}
+	return nil
+}
+
+// ArchiveHost hides a host from default lists, facets, and findings
+func (ps *PostgresStorage) ArchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
+	return ps.setHostArchived(hostID, orgID, actorUserID, true)
+}
+
+// UnarchiveHost shows an archived host again
+func (ps *PostgresStorage) UnarchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
+	return ps.setHostArchived(hostID, orgID, actorUserID, false)
+}
+
+// setHostArchived records an archived or unarchived event for the host
+func (ps *PostgresStorage) setHostArchived(hostID, orgID, actorUserID string, archive bool) (*models.HostEvent, error) {
+	var event *models.HostEvent
+	err := ps.mutateHost(hostID, orgID, func(tx dbConn, hostname string) error {
+		var archived bool
+		err := tx.QueryRow("SELECT archived_at IS NOT NULL FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).Scan(&archived)
+		if err != nil {
+			return fmt.Errorf("failed to get host archive state: %w", classifyError(err))
+		}
+		if event, err = archiveEvent(hostID, orgID, hostname, actorUserID, archived, archive); err != nil {
+			return err
+		}
+		return appendHostEvent(tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// IsHostArchived reports whether a host is archived
+func (ps *PostgresStorage) IsHostArchived(hostID, orgID string) (bool, error) {
+	var archived bool
+	err := ps.db.QueryRow(
+		"SELECT archived_at IS NOT NULL FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID,
+	).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get host archive state: %w", classifyError(err))
+	}
+	return archived, nil
+}
+
+// UpdateHostDetails applies an edit to a host's display name and description
+func (ps *PostgresStorage) UpdateHostDetails(hostID, orgID string, update models.UpdateHostRequest, actorUserID string, ifVersion int64) (*models.HostEvent, error) {
+	var event *models.HostEvent
+	err := ps.mutateHost(hostID, orgID, func(tx dbConn, hostname string) error {
+		var current models.HostDetails
+		var version int64
+		err := tx.QueryRow("SELECT display_name, description, metadata_version FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).
+			Scan(&current.DisplayName, &current.Description, &version)
+		if err != nil {
+			return fmt.Errorf("failed to get host details: %w", classifyError(err))
+		}
+		if ifVersion != 0 && version != ifVersion {
+			return ErrVersionMismatch
+		}
+		event = editEvent(hostID, orgID, hostname, actorUserID, current, update)
+		return appendHostEvent(tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// ListHostEvents returns host events after afterID, oldest first
+func (ps *PostgresStorage) ListHostEvents(orgID, hostID string, afterID int64, limit int, includeReports bool) ([]*models.HostEvent, error) {
+	query := `
+		SELECT id, org_id, host_id, hostname, event_type, COALESCE(actor_user_id::text, ''),
+			CASE WHEN $3 THEN payload ELSE payload - 'report' END, created_at
+		FROM host_events
+		WHERE org_id = $1 AND id > $2 AND ($4 = '' OR host_id::text = $4)
+		ORDER BY id
+		LIMIT $5
+	`
+
+	rows, err := ps.reader().Query(query, orgID, afterID, includeReports, hostID, clampHostEventLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host events: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	events := []*models.HostEvent{}
+	for rows.Next() {
+		event, err := scanHostEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list host events: %w", classifyError(err))
+	}
+	return events, nil
+}
+
+// LastHostEventID returns the ID of the organization's newest host event
+func (ps *PostgresStorage) LastHostEventID(orgID string) (int64, error) {
+	var id int64
+	err := ps.reader().QueryRow(`SELECT COALESCE(MAX(id), 0) FROM host_events WHERE org_id = $1`, orgID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last host event: %w", classifyError(err))
+	}
+	return id, nil
+}
+
+// scanHostEvent scans id, org_id, host_id, hostname, event_type, actor, payload, created_at
+func scanHostEvent(rows *sql.Rows) (*models.HostEvent, error) {
+	event := &models.HostEvent{}
+	var payload []byte
+	if err := rows.Scan(&event.ID, &event.OrgID, &event.HostID, &event.Hostname, &event.Type,
+		&event.ActorUserID, &payload, &event.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan host event: %w", err)
+	}
+	if len(payload) > 0 && string(payload) != "{}" {
+		event.Payload = &models.HostEventPayload{}
+		if err := json.Unmarshal(payload, event.Payload); err != nil {
+			return nil, fmt.Errorf("failed to decode host event %d: %w", event.ID, err)
+		}
+	}
+	return event, nil
+}
+
+// foldHostEvents reads every event of a host and folds them into its current state
+func foldHostEvents(tx dbConn, hostID, orgID string) (*hostState, int, error) {
+	rows, err := tx.Query(`
+		SELECT id, org_id, host_id, hostname, event_type, COALESCE(actor_user_id::text, ''), payload, created_at
+		FROM host_events
+		WHERE host_id = $1 AND org_id = $2
+		ORDER BY id
+	`, hostID, orgID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "22P02" {
+			return &hostState{}, 0, nil // Invalid UUID has no events
+		}
+		return nil, 0, fmt.Errorf("failed to read host events: %w", err)
+	}
+	defer rows.Close()
+
+	state := &hostState{}
+	count := 0
+	for rows.Next() {
+		event, err := scanHostEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		state.apply(event)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read host events: %w", err)
+	}
+	return state, count, nil
+}
+
+// RestoreHost brings back a deleted host with its last report and tags
+func (ps *PostgresStorage) RestoreHost(hostID, orgID, actorUserID string) (*models.HostEvent, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockHost(tx, orgID, hostID); err != nil {
+		return nil, err
+	}
+
+	state, _, err := foldHostEvents(tx, hostID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	event, err := state.restoreEvent(hostID, actorUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendHostEvent(tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to restore host: %w", classifyError(err))
+	}
+	return event, nil
+}
+
+// ReplayHostEvents rebuilds the organization's hosts and host tags from the event stream
+// Each host is replayed in its own transaction under the host lock, so concurrent
+// ingests are never overwritten with older state. Hosts that exist without any
+// events are left untouched.
+func (ps *PostgresStorage) ReplayHostEvents(orgID string) (int, error) {
+	rows, err := ps.db.Query(`SELECT DISTINCT host_id FROM host_events WHERE org_id = $1`, orgID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list hosts with events: %w", err)
+	}
+	var hostIDs []string
+	for rows.Next() {
+		var hostID string
+		if err := rows.Scan(&hostID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan host id: %w", err)
+		}
+		hostIDs = append(hostIDs, hostID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list hosts with events: %w", err)
+	}
+
+	for _, hostID := range hostIDs {
+		if err := ps.ReplayHost(hostID, orgID); err != nil {
+			return 0, fmt.Errorf("failed to replay host %s: %w", hostID, err)
+		}
+	}
+	return len(hostIDs), nil
+}
+
+// SearchHostAccounts returns the organization's host accounts matching filter
+func (ps *PostgresStorage) SearchHostAccounts(orgID string, filter models.HostAccountFilter) ([]*models.HostAccount, error) {
+	query, args := hostAccountsQuery(orgID, filter).Build()
+	rows, err := ps.reader().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search host accounts: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	accounts := []*models.HostAccount{}
+	for rows.Next() {
+		account := &models.HostAccount{}
+		var uid, gid sql.NullInt64
+		if err := rows.Scan(&account.HostID, &account.Hostname, &account.Username, &uid, &gid, &account.Home, &account.Shell); err != nil {
+			return nil, fmt.Errorf("failed to scan host account: %w", err)
+		}
+		if uid.Valid {
+			account.UID = &uid.Int64
+		}
+		if gid.Valid {
+			account.GID = &gid.Int64
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search host accounts: %w", classifyError(err))
+	}
+	return accounts, nil
+}
+
+// SearchHostServices returns the organization's listening ports matching filter
+func (ps *PostgresStorage) SearchHostServices(orgID string, filter models.HostServiceFilter) ([]*models.HostService, error) {
+	query, args := hostServicesQuery(orgID, filter).Build()
+	rows, err := ps.reader().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search host services: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	services := []*models.HostService{}
+	for rows.Next() {
+		service := &models.HostService{}
+		var pid sql.NullInt64
+		if err := rows.Scan(&service.HostID, &service.Hostname, &service.Protocol, &service.Address, &service.Port, &service.Process, &pid); err != nil {
+			return nil, fmt.Errorf("failed to scan host service: %w", err)
+		}
+		if pid.Valid {
+			service.PID = &pid.Int64
+		}
+		services = append(services, service)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search host services: %w", classifyError(err))
+	}
+	return services, nil
+}
+
+// ListEventHosts returns every host with events, with its organization
+func (ps *PostgresStorage) ListEventHosts(orgID string) ([]models.HostRef, error) {
+	rows, err := ps.db.Query(`
+		SELECT DISTINCT org_id, host_id FROM host_events
+		WHERE $1 = '' OR org_id::text = $1
+		ORDER BY org_id, host_id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts with events: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	refs := []models.HostRef{}
+	for rows.Next() {
+		var ref models.HostRef
+		if err := rows.Scan(&ref.OrgID, &ref.HostID); err != nil {
+			return nil, fmt.Errorf("failed to scan host: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list hosts with events: %w", classifyError(err))
+	}
+	return refs, nil
+}
+
+// PurgeDeletedHostEvents removes the events of hosts whose last event is a deletion before before
+func (ps *PostgresStorage) PurgeDeletedHostEvents(before time.Time) (int, error) {
+	result, err := ps.db.Exec(`
+		DELETE FROM host_events e
+		USING (
+			SELECT d.org_id, d.host_id FROM host_events d
+			WHERE d.event_type = 'deleted' AND d.created_at < $1
+				AND NOT EXISTS (
+					SELECT 1 FROM host_events later
+					WHERE later.host_id = d.host_id AND later.org_id = d.org_id AND later.id > d.id
+				)
+		) purged
+		WHERE e.org_id = purged.org_id AND e.host_id = purged.host_id
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge host events: %w", classifyError(err))
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge host events: %w", err)
+	}
+	return int(purged), nil
+}
+
+// RebuildFacetCounts recomputes the organization's host facet counters
+// The triggers only apply deltas, so counters drift from the hosts when the functions
+// deriving facet values change. The counts are recomputed in one statement, whose
+// snapshot sees the hosts and counters as of the same moment, and each counter is moved
+// by its difference rather than overwritten: writes committing meanwhile keep the deltas
+// their triggers applied, and are not blocked. Rebuilds of one organization take turns.
+func (ps *PostgresStorage) RebuildFacetCounts(orgID string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`SELECT pg_advisory_xact_lock(hashtext('host_facet_counts:' || $1))`,
+		`WITH fresh AS (
+			SELECT 'total' AS facet, '*' AS value, COUNT(*) AS count FROM hosts
+			WHERE org_id = $1 AND archived_at IS NULL
+			UNION ALL
+			SELECT 'os_name', host_os_name(data), COUNT(*) FROM hosts
+			WHERE org_id = $1 AND archived_at IS NULL AND host_os_name(data) IS NOT NULL
+			GROUP BY host_os_name(data)
+			UNION ALL
+			SELECT 'os_version', host_os_version(data), COUNT(*) FROM hosts
+			WHERE org_id = $1 AND archived_at IS NULL AND host_os_version(data) IS NOT NULL
+			GROUP BY host_os_version(data)
+			UNION ALL
+			SELECT 'tag', tag, COUNT(*) FROM host_tags
+			WHERE org_id = $1 AND NOT archived
+			GROUP BY tag
+		), drift AS (
+			SELECT facet, value, SUM(count) AS delta FROM (
+				SELECT facet, value, count FROM fresh
+				UNION ALL
+				SELECT facet, value, -count FROM host_facet_counts WHERE org_id = $1
+			) counts
+			GROUP BY facet, value
+			HAVING SUM(count) <> 0
+		)
+		INSERT INTO host_facet_counts (org_id, facet, value, count)
+		SELECT $1, facet, value, delta FROM drift
+		ON CONFLICT (org_id, facet, value) DO UPDATE SET count = host_facet_counts.count + EXCLUDED.count`,
+		`DELETE FROM host_facet_counts WHERE org_id = $1 AND count <= 0`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, orgID); err != nil {
+			return fmt.Errorf("failed to rebuild facet counts: %w", classifyError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to rebuild facet counts: %w", classifyError(err))
+	}
+	return nil
+}
+
+// GetFleetSnapshot returns the organization's hosts as they were just before at
+// A host's state comes from its last report-bearing or deleted event before at, its
+// tags from its last tagged, restored, or ingested (which starts over without tags) event,
+// and whether it was archived from its last archived, unarchived, deleted, or restored event.
+// Only the OS and agent fields are read from the report payloads.
+func (ps *PostgresStorage) GetFleetSnapshot(orgID string, at time.Time) ([]*models.FleetHost, error) {
+	query := `
+		WITH state AS (
+			SELECT DISTINCT ON (host_id) host_id, event_type, hostname,
+				payload->'report'->'data'->'system'->'os'->>'name' AS os_name,
+				payload->'report'->'data'->'system'->'os'->>'version' AS os_version,
+				payload->'report'->'meta'->>'snail_version' AS snail_version
+			FROM host_events
+			WHERE org_id = $1 AND created_at < $2
+				AND event_type IN ('ingested', 'updated', 'deleted', 'restored')
+			ORDER BY host_id, id DESC
+		), tags AS (
+			SELECT DISTINCT ON (host_id) host_id,
+				CASE WHEN event_type = 'ingested' THEN NULL ELSE payload->'tags' END AS tags
+			FROM host_events
+			WHERE org_id = $1 AND created_at < $2
+				AND event_type IN ('tagged', 'restored', 'ingested')
+			ORDER BY host_id, id DESC
+		), archived AS (
+			SELECT DISTINCT ON (host_id) host_id, event_type = 'archived' AS archived
+			FROM host_events
+			WHERE org_id = $1 AND created_at < $2
+				AND event_type IN ('archived', 'unarchived', 'deleted', 'restored')
+			ORDER BY host_id, id DESC
+		)
+		SELECT s.host_id, s.hostname, COALESCE(s.os_name, ''), COALESCE(s.os_version, ''),
+			COALESCE(s.snail_version, ''), COALESCE(t.tags, '[]'::jsonb)
+		FROM state s
+		LEFT JOIN tags t ON t.host_id = s.host_id
+		LEFT JOIN archived a ON a.host_id = s.host_id
+		WHERE s.event_type <> 'deleted' AND NOT COALESCE(a.archived, false)
+	`
+
+	rows, err := ps.reader().Query(query, orgID, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fleet snapshot: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	hosts := []*models.FleetHost{}
+	for rows.Next() {
+		host := &models.FleetHost{}
+		var tagsJSON []byte
+		if err := rows.Scan(&host.HostID, &host.Hostname, &host.OSName, &host.OSVersion, &host.SnailVersion, &tagsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan fleet host: %w", err)
+		}
+		if err := json.Unmarshal(tagsJSON, &host.Tags); err != nil {
+			return nil, fmt.Errorf("failed to decode fleet host tags: %w", err)
+		}
+		hosts = append(hosts, host)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get fleet snapshot: %w", err)
+	}
+
+	sortFleetHosts(hosts)
+	return hosts, nil
+}
+
+// ListHostReportTimes returns the times of the hosts' report-bearing events in [from, to),
+// each host's preceded by its last one before from
+func (ps *PostgresStorage) ListHostReportTimes(orgID, hostID string, from, to time.Time) (map[string][]time.Time, error) {
+	query := `
+		(
+			SELECT host_id, created_at
+			FROM host_events
+			WHERE org_id = $1 AND ($4 = '' OR host_id = NULLIF($4, '')::uuid)
+				AND event_type IN ('ingested', 'updated')
+				AND created_at >= $2 AND created_at < $3
+		)
+		UNION ALL
+		(
+			SELECT DISTINCT ON (host_id) host_id, created_at
+			FROM host_events
+			WHERE org_id = $1 AND ($4 = '' OR host_id = NULLIF($4, '')::uuid)
+				AND event_type IN ('ingested', 'updated')
+				AND created_at < $2
+			ORDER BY host_id, created_at DESC
+		)
+		ORDER BY host_id, created_at
+	`
+
+	rows, err := ps.reader().Query(query, orgID, from, to, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host report times: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	times := make(map[string][]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan host report time: %w", err)
+		}
+		times[id] = append(times[id], at.UTC())
+	}
+	return times, rows.Err()
+}
+
+// ReplayHost rewrites one host's projection from its events
+func (ps *PostgresStorage) ReplayHost(hostID, orgID string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockHost(tx, orgID, hostID); err != nil {
+		return err
+	}
+
+	state, _, err := foldHostEvents(tx, hostID, orgID)
+	if err != nil {
+		return err
+	}
+
+	if state.exists {
+		if err := projectHostReport(tx, state.report, orgID, state.uploadedBy); err != nil {
+			return err
+		}
+		if err := projectHostArchived(tx, hostID, orgID, state.archivedAt); err != nil {
+			return err
+		}
+		if err := projectHostTags(tx, hostID, orgID, state.tags); err != nil {
+			return err
+		}
+		if err := projectHostDetails(tx, hostID, orgID, state.details); err != nil {
+			return err
+		}
+	} else if _, err := tx.Exec("DELETE FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID); err != nil {
+		return fmt.Errorf("failed to delete host: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ListHosts returns all hosts with summary info for the specified organization
+func (ps *PostgresStorage) ListHosts(orgID string, includeArchived bool) ([]*models.HostSummary, error) {
+	return ps.listHosts(hostListQuery(orgID, includeArchived, nil), nil)
+}
+
+// ListHostsPaginated returns one page of the organization's hosts, newest report first
+func (ps *PostgresStorage) ListHostsPaginated(orgID string, includeArchived bool, after *HostCursor, limit int) (*HostPage, error) {
+	return ps.pageHosts(orgID, includeArchived, nil, after, limit)
+}
+
+// FindHosts returns the hosts of the organization matching a structured search
+func (ps *PostgresStorage) FindHosts(orgID string, filter models.HostSearchFilter) ([]*models.HostSummary, error) {
+	hosts, err := ps.listHosts(hostListQuery(orgID, filter.IncludeArchived, hostFilterConditions(filter)), nil)
+	if err != nil {
+		return nil, err
+	}
+	if hosts == nil {
+		hosts = []*models.HostSummary{}
+	}
+	return hosts, nil
+}
+
+// FindHostsPaginated returns a page of the hosts matching a structured search
+func (ps *PostgresStorage) FindHostsPaginated(orgID string, filter models.HostSearchFilter, after *HostCursor, limit int) (*HostPage, error) {
+	return ps.pageHosts(orgID, filter.IncludeArchived, hostFilterConditions(filter), after, limit)
+}
+
+// pageHosts reads the page of the hosts selected by conditions following after
+func (ps *PostgresStorage) pageHosts(orgID string, includeArchived bool, conditions []sqlbuilder.Cond, after *HostCursor, limit int) (*HostPage, error) {
+	limit = clampHostPageSize(limit)
+
+	page := &HostPage{}
+	count, args := hostCountQuery(orgID, includeArchived, conditions).Build()
+	if err := ps.reader().QueryRow(count, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count hosts: %w", classifyError(err))
+	}
+
+	if after != nil {
+		conditions = append(conditions, hostsAfter(after))
+	}
+	// One extra host tells whether another page follows
+	hosts, err := ps.listHosts(hostListQuery(orgID, includeArchived, conditions).OrderBy("host_id").Limit(limit+1), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) > limit {
+		hosts = hosts[:limit]
+		page.Next = cursorAfter(hosts)
+	}
+	if hosts == nil {
+		hosts = []*models.HostSummary{}
+	}
+	page.Hosts = hosts
+	return page, nil
+}
+
+// SearchHosts returns the hosts of the organization matching a parsed search query
+// Simple positive terms are pushed down into SQL to narrow the scan; the full
+// query, including version comparisons and negations, is then evaluated per host.
+func (ps *PostgresStorage) SearchHosts(orgID string, q *search.Query, includeArchived bool) ([]*models.HostSummary, error) {
+	// Package data is only read for queries on packages
+	installed := "NULL::jsonb"
+	if q.NeedsPackages() {
+		installed = "data->'packages'->'installed'"
+	}
+	query := hostListQuery(orgID, includeArchived, searchConditions(q)).Columns(installed)
+	return ps.listHosts(query, func(host *models.HostSummary, installed []byte) bool {
+		candidate := search.Host{Summary: host}
+		if q.NeedsPackages() {
+			candidate.Packages = parseInstalledPackages(installed)
+		}
+		return q.Match(candidate)
+	})
+}
+
+// listHosts reads the host summaries selected by a hostListQuery
+// keep, when set, is called with each host and the query's one extra column, after the
+// summary's, to filter the results.
+func (ps *PostgresStorage) listHosts(q *sqlbuilder.SelectBuilder, keep func(*models.HostSummary, []byte) bool) ([]*models.HostSummary, error) {
+	query, args := q.Build()
+	rows, err := ps.reader().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	var hosts []*models.HostSummary
+
+	for rows.Next() {
+		var hostID string
+		var hostname string
+		var details models.HostDetails
+		var receivedAt time.Time
+		var timestamp, archivedAt, staleSince sql.NullTime
+		var osName, osVersion, osVersionMajor, osVersionMinor, osVersionPatch string
+		var kernelVersion, architecture string
+		var packageCount sql.NullInt64
+		var extra []byte
+		var orgID string
+		var uploadedByUserID string
+		var tags []string
+		var health []byte
+		var sections []string
+		var probe nullProbeResult
+
+		dest := []interface{}{&hostID, &hostname, &details.DisplayName, &details.Description, &receivedAt, &timestamp, &archivedAt,
+			&osName, &osVersion, &osVersionMajor, &osVersionMinor, &osVersionPatch, &kernelVersion, &architecture, &packageCount,
+			&orgID, &uploadedByUserID, pq.Array(&tags), &health, pq.Array(&sections), &staleSince,
+			&probe.method, &probe.port, &probe.reachable, &probe.address, &probe.latencyMS, &probe.err, &probe.prober, &probe.probedAt}
+		if keep != nil {
+			dest = append(dest, &extra)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan host: %w", err)
+		}
+
+		host := &models.HostSummary{
+			HostID:           hostID,
+			Hostname:         hostname,
+			Name:             models.HostName(hostname, details.DisplayName),
+			DisplayName:      details.DisplayName,
+			Description:      details.Description,
+			OSName:           osName,
+			OSVersion:        osVersion,
+			OSVersionMajor:   osVersionMajor,
+			OSVersionMinor:   osVersionMinor,
+			OSVersionPatch:   osVersionPatch,
+			KernelVersion:    kernelVersion,
+			Architecture:     architecture,
+			OrgID:            orgID,
+			UploadedByUserID: uploadedByUserID,
+			Tags:             tags,
+			LastSeen:         receivedAt,
+			LastProbe:        probe.result(hostID, hostname),
+			Health:           decodeHealth(health),
+			Sections:         sections,
+		}
+		if timestamp.Valid {
+			t := timestamp.Time.UTC()
+			host.CollectedAt = &t
+		}
+		if archivedAt.Valid {
+			t := archivedAt.Time.UTC()
+			host.ArchivedAt = &t
+		}
+		if staleSince.Valid {
+			t := staleSince.Time.UTC()
+			host.StaleSince = &t
+		}
+		if packageCount.Valid {
+			count := int(packageCount.Int64)
+			host.PackageCount = &count
+		}
+		host.Status = models.HostStatus(host.StaleSince)
+
+		if keep != nil && !keep(host, extra) {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
+
+// parsePackages extracts the installed packages from report data's
+// packages.installed list; missing or malformed entries are skipped
+func parsePackages(dataJSON []byte) []search.Package {
+	var data struct {
+		Packages struct {
+			Installed json.RawMessage `json:"installed"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(dataJSON, &data); err != nil {
+		return nil
+	}
+	return parseInstalledPackages(data.Packages.Installed)
+}
+
+// parseInstalledPackages extracts the packages of a packages.installed list
+func parseInstalledPackages(installedJSON []byte) []search.Package {
+	var installed []json.RawMessage
+	if err := json.Unmarshal(installedJSON, &installed); err != nil {
+		return nil
+	}
+
+	packages := make([]search.Package, 0, len(installed))
+	for _, raw := range installed {
+		var pkg struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Release string `json:"release"`
+		}
+		if err := json.Unmarshal(raw, &pkg); err != nil || pkg.Name == "" {
+			continue
+		}
+		version := pkg.Version
+		if pkg.Release != "" {
+			version += "-" + pkg.Release
+		}
+		packages = append(packages, search.Package{Name: pkg.Name, Version: version})
+	}
+	return packages
+}
+
+// GetAllHosts returns all hosts with their full report data for the specified organization
+func (ps *PostgresStorage) GetAllHosts(orgID string) ([]*models.Report, error) {
+	var reports []*models.Report
+	err := ps.IterateHosts(context.Background(), orgID, func(report *models.Report) error {
+		reports = append(reports, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// IterateHosts streams all hosts with their full report data for the specified organization
+// Rows are scanned and handed to fn one at a time, so memory use is bounded by a single report
+func (ps *PostgresStorage) IterateHosts(ctx context.Context, orgID string, fn func(*models.Report) error) error {
+	query := `
+		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors, health
+		FROM hosts
+		WHERE org_id = $1
+		ORDER BY received_at DESC
+	`
+
+	conn, err := ps.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer ps.releaseConn(conn)
+
+	rows, err := conn.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return withRequest(ctx, fmt.Errorf("failed to get all hosts: %w", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		report, err := scanHostReport(rows)
+		if err != nil {
+			return withRequest(ctx, err)
+		}
+		if err := fn(report); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return withRequest(ctx, fmt.Errorf("failed to iterate hosts: %w", err))
+	}
+	return nil
+}
+
+// IterateHostBatches reads the organization's hosts in batches of up to batchSize, ordered by host ID
+// Batches are paged by host ID rather than OFFSET, so every query is an index range scan
+func (ps *PostgresStorage) IterateHostBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.Report) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultHostBatchSize
+	}
+	for {
+		batch, err := ps.hostBatch(ctx, orgID, afterHostID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		afterHostID = batch[len(batch)-1].Meta.HostID
+	}
+}
+
+// IterateHostSummaryBatches reads the organization's host summaries in batches of up to batchSize, ordered by host ID
+func (ps *PostgresStorage) IterateHostSummaryBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.HostSummary) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultHostBatchSize
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := ps.listHosts(hostSummaryBatchQuery(orgID, afterHostID, batchSize), nil)
+		if err != nil {
+			return withRequest(ctx, err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		afterHostID = batch[len(batch)-1].HostID
+	}
+}
+
+// hostBatch reads up to limit hosts of the organization after afterHostID, ordered by host ID
+func (ps *PostgresStorage) hostBatch(ctx context.Context, orgID, afterHostID string, limit int) ([]*models.Report, error) {
+	query := `
+		SELECT host_id, hostname, received_at, collection_id, timestamp, snail_version, data, errors, health
+		FROM hosts
+		WHERE org_id = $1 AND ($2 = '' OR host_id > NULLIF($2, '')::uuid)
+		ORDER BY host_id
+		LIMIT $3
+	`
+
+	conn, err := ps.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer ps.releaseConn(conn)
+
+	rows, err := conn.QueryContext(ctx, query, orgID, afterHostID, limit)
+	if err != nil {
+		return nil, withRequest(ctx, fmt.Errorf("failed to get host batch: %w", err))
+	}
+	defer rows.Close()
+
+	batch := make([]*models.Report, 0, limit)
+	for rows.Next() {
+		report, err := scanHostReport(rows)
+		if err != nil {
+			return nil, withRequest(ctx, err)
+		}
+		batch = append(batch, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, withRequest(ctx, fmt.Errorf("failed to iterate host batch: %w", err))
+	}
+	return batch, nil
+}
+
+// scanHostReport scans a host's full report from a row of host_id, hostname, received_at,
+// collection_id, timestamp, snail_version, data, errors, and health
+func scanHostReport(rows *sql.Rows) (*models.Report, error) {
+	report := &models.Report{}
+	var errors []string
+	var timestamp sql.NullTime
+	var health []byte
+
+	if err := rows.Scan(
+		&report.Meta.HostID,
+		&report.Meta.Hostname,
+		&report.ReceivedAt,
+		&report.Meta.CollectionID,
+		&timestamp,
+		&report.Meta.SnailVersion,
+		&report.Data,
+		pq.Array(&errors),
+		&health,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan report: %w", err)
+	}
+
+	report.ID = report.Meta.HostID
+	report.Meta.Timestamp = reportTimestamp(timestamp)
+	report.Errors = errors
+	report.Health = decodeHealth(health)
+	return report, nil
+}
+
+// Close closes the database connection
+func (ps *PostgresStorage) Close() error {
+	if ps.replica != nil {
+		ps.replica.db.Close()
+	}
+	return ps.pool.Close()
+}
+
+// Auth methods
+
+// CreateUser creates a new user
+func (ps *PostgresStorage) CreateUser(username, email, passwordHash, orgID, role string) (*models.User, error) {
+	query := `
+		INSERT INTO users (username, email, password_hash, org_id, role)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, username, email, is_active, is_admin, org_id, role, version, created_at, updated_at
+	`
+
+	user := &models.User{}
+	err := ps.db.QueryRow(query, username, email, passwordHash, orgID, role).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsActive,
+		&user.IsAdmin,
+		&user.OrgID,
+		&user.Role,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", classifyError(err))
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by username and returns the password hash
+func (ps *PostgresStorage) GetUserByUsername(username string) (*models.User, string, error) {
+	query := `
+		SELECT id, username, email, password_hash, is_active, is_admin, org_id, role, version, created_at, updated_at
+		FROM users
+		WHERE username = $1
+	`
+
+	user := &models.User{}
+	var passwordHash string
+
+	err := ps.db.QueryRow(query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&passwordHash,
+		&user.IsActive,
+		&user.IsAdmin,
+		&user.OrgID,
+		&user.Role,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", classifyError(err))
+	}
+
+	return user, passwordHash, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (ps *PostgresStorage) GetUserByID(userID string) (*models.User, error) {
+	query := `
+		SELECT id, username, email, is_active, is_admin, org_id, role, version, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
+
+	user := &models.User{}
+	err := ps.db.QueryRow(query, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsActive,
+		&user.IsAdmin,
+		&user.OrgID,
+		&user.Role,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", classifyError(err))
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (ps *PostgresStorage) GetUserByEmail(email string) (*models.User, error) {
+	query := `
+		SELECT id, username, email, is_active, is_admin, org_id, role, version, created_at, updated_at
+		FROM users
+		WHERE email = $1
+	`
+
+	user := &models.User{}
+	err := ps.db.QueryRow(query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsActive,
+		&user.IsAdmin,
+		&user.OrgID,
+		&user.Role,
+		&user.Version,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", classifyError(err))
+	}
+
+	return user, nil
+}
+
+// CreateAPIKey creates a new API key
+// Returns ErrAPIKeyPrefixTaken if a key with a full-length prefix has the same one
+func (ps *PostgresStorage) CreateAPIKey(userID, keyHash, keyPrefix, name string, expiresAt *time.Time) (*models.APIKey, error) {
+	query := `
+		INSERT INTO api_keys (user_id, key_hash, key_prefix, name, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, name, last_used_at, expires_at, created_at
+	`
+
+	apiKey := &models.APIKey{}
+	err := ps.db.QueryRow(query, userID, keyHash, keyPrefix, name, expiresAt).Scan(
+		&apiKey.ID,
+		&apiKey.UserID,
+		&apiKey.Name,
+		&apiKey.LastUsedAt,
+		&apiKey.ExpiresAt,
+		&apiKey.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", classifyError(err))
+	}
+
+	return apiKey, nil
+}
+
+// GetAPIKeyByPrefix retrieves API keys by any of the prefixes (for efficient lookup)
+func (ps *PostgresStorage) GetAPIKeyByPrefix(keyPrefixes ...string) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, key_hash, key_prefix, name, last_used_at, expires_at, created_at, allowed_endpoints,
+			COALESCE(host_id::text, '')
+		FROM api_keys
+		WHERE key_prefix = ANY($1)
+	`
+
+	rows, err := ps.db.Query(query, pq.Array(keyPrefixes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	var apiKeys []*models.APIKey
+	for rows.Next() {
+		apiKey := &models.APIKey{}
+		err := rows.Scan(
+			&apiKey.ID,
+			&apiKey.UserID,
+			&apiKey.KeyHash,
+			&apiKey.KeyPrefix,
+			&apiKey.Name,
+			&apiKey.LastUsedAt,
+			&apiKey.ExpiresAt,
+			&apiKey.CreatedAt,
+			pq.Array(&apiKey.AllowedEndpoints),
+			&apiKey.HostID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, nil
+}
+
+// GetAPIKeysByUserID retrieves all API keys for a user
+func (ps *PostgresStorage) GetAPIKeysByUserID(userID string) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, last_used_at, expires_at, created_at, allowed_endpoints, COALESCE(host_id::text, '')
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := ps.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	var apiKeys []*models.APIKey
+	for rows.Next() {
+		apiKey := &models.APIKey{}
+		err := rows.Scan(
+			&apiKey.ID,
+			&apiKey.UserID,
+			&apiKey.Name,
+			&apiKey.LastUsedAt,
+			&apiKey.ExpiresAt,
+			&apiKey.CreatedAt,
+			pq.Array(&apiKey.AllowedEndpoints),
+			&apiKey.HostID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, nil
+}
+
+// DeleteAPIKey deletes an API key
+func (ps *PostgresStorage) DeleteAPIKey(keyID string) error {
+	result, err := ps.db.Exec("DELETE FROM api_keys WHERE id = $1", keyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredAPIKeys deletes the API keys, of userID or of every user, that expired before expiredBefore
+func (ps *PostgresStorage) DeleteExpiredAPIKeys(userID string, expiredBefore time.Time) ([]*DeletedAPIKey, error) {
+	query := `
+		DELETE FROM api_keys k
+		USING users u
+		WHERE u.id = k.user_id AND k.expires_at < $1`
+	args := []interface{}{expiredBefore}
+	if userID != "" {
+		query += " AND k.user_id = $2"
+		args = append(args, userID)
+	}
+	query += " RETURNING k.id, k.user_id, u.org_id, k.name, k.expires_at"
+
+	rows, err := ps.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired API keys: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	deleted := []*DeletedAPIKey{}
+	for rows.Next() {
+		key := &DeletedAPIKey{}
+		if err := rows.Scan(&key.ID, &key.UserID, &key.OrgID, &key.Name, &key.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted API key: %w", err)
+		}
+		deleted = append(deleted, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete expired API keys: %w", classifyError(err))
+	}
+	return deleted, nil
+}
+
+// SetAPIKeyAllowedEndpoints replaces the endpoint patterns an API key is restricted to
+func (ps *PostgresStorage) SetAPIKeyAllowedEndpoints(keyID string, endpoints []string) error {
+	if endpoints == nil {
+		endpoints = []string{}
+	}
+
+	result, err := ps.db.Exec("UPDATE api_keys SET allowed_endpoints = $1 WHERE id = $2", pq.Array(endpoints), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key endpoints: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetAPIKeyHost binds an API key to the host it may report as
+func (ps *PostgresStorage) SetAPIKeyHost(keyID, hostID string) error {
+	result, err := ps.db.Exec("UPDATE api_keys SET host_id = $1 WHERE id = $2", hostID, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to bind API key to host: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyLastUsed updates the last_used_at timestamp for an API key
+func (ps *PostgresStorage) UpdateAPIKeyLastUsed(keyID string) error {
+	_, err := ps.db.Exec(
+		"UPDATE api_keys SET last_used_at = NOW() WHERE id = $1",
+		keyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key last used: %w", classifyError(err))
+	}
+	return nil
+}
+
+// Ingest receipt methods
+
+// SaveReceipt stores a signed ingest receipt
+func (ps *PostgresStorage) SaveReceipt(receipt *models.Receipt, orgID string) error {
+	query := `
+		INSERT INTO ingest_receipts (id, org_id, host_id, collection_id, checksum, received_at, key_id, signature)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := ps.db.Exec(query,
+		receipt.ID,
+		orgID,
+		receipt.HostID,
+		receipt.CollectionID,
+		receipt.Checksum,
+		receipt.ReceivedAt,
+		receipt.KeyID,
+		receipt.Signature,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save receipt: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+// GetReceipt retrieves a receipt by ID
+// Verifies that the receipt belongs to the specified organization
+func (ps *PostgresStorage) GetReceipt(receiptID, orgID string) (*models.Receipt, error) {
+	query := `
+		SELECT id, host_id, collection_id, checksum, received_at, key_id, signature
+		FROM ingest_receipts
+		WHERE id = $1 AND org_id = $2
+	`
+
+	receipt := &models.Receipt{}
+	err := ps.db.QueryRow(query, receiptID, orgID).Scan(
+		&receipt.ID,
+		&receipt.HostID,
+		&receipt.CollectionID,
+		&receipt.Checksum,
+		&receipt.ReceivedAt,
+		&receipt.KeyID,
+		&receipt.Signature,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %w", classifyError(err))
+	}
+
+	receipt.ReceivedAt = receipt.ReceivedAt.UTC()
+	return receipt, nil
+}
+
+// Host probe methods
+
+// nullProbeResult scans a probe result from a LEFT JOIN that may not have matched
+type nullProbeResult struct {
+	method, address, err, prober sql.NullString
+	port                         sql.NullInt64
+	reachable                    sql.NullBool
+	latencyMS                    sql.NullFloat64
+	probedAt                     sql.NullTime
+}
+
+// result returns the probe result, or nil if the host has never been probed
+func (n *nullProbeResult) result(hostID, hostname string) *models.ProbeResult {
+	if !n.probedAt.Valid {
+		return nil
+	}
+	return &models.ProbeResult{
+		HostID:    hostID,
+		Hostname:  hostname,
+		Method:    n.method.String,
+		Port:      int(n.port.Int64),
+		Reachable: n.reachable.Bool,
+		Address:   n.address.String,
+		LatencyMS: n.latencyMS.Float64,
+		Error:     n.err.String,
+		Prober:    n.prober.String,
+		ProbedAt:  n.probedAt.Time.UTC(),
+	}
+}
+
+// probeJobColumns are the probe_jobs columns read by scanProbeJob
+const probeJobColumns = `id, method, port, prober, status, targets, requested_by, claimed_by, created_at, completed_at`
+
+// scanProbeJob scans a row selected with probeJobColumns
+func scanProbeJob(row interface{ Scan(...interface{}) error }) (*models.ProbeJob, error) {
+	job := &models.ProbeJob{}
+	var targetsJSON []byte
+	var requestedBy sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Method, &job.Port, &job.Prober, &job.Status, &targetsJSON,
+		&requestedBy, &job.ClaimedBy, &job.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(targetsJSON, &job.Targets); err != nil {
+		return nil, fmt.Errorf("failed to decode probe targets: %w", err)
+	}
+	job.RequestedBy = requestedBy.String
+	if completedAt.Valid {
+		t := completedAt.Time.UTC()
+		job.CompletedAt = &t
+	}
+	job.CreatedAt = job.CreatedAt.UTC()
+	return job, nil
+}
+
+// CreateProbeJob stores a new probe job
+func (ps *PostgresStorage) CreateProbeJob(job *models.ProbeJob, orgID string) error {
+	targetsJSON, err := json.Marshal(job.Targets)
+	if err != nil {
+		return fmt.Errorf("failed to encode probe targets: %w", err)
+	}
+
+	var requestedBy interface{}
+	if job.RequestedBy != "" {
+		requestedBy = job.RequestedBy
+	}
+
+	err = ps.db.QueryRow(`
+		INSERT INTO probe_jobs (id, org_id, method, port, prober, status, targets, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at
+	`, job.ID, orgID, job.Method, job.Port, job.Prober, job.Status, targetsJSON, requestedBy).Scan(&job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create probe job: %w", classifyError(err))
+	}
+
+	job.CreatedAt = job.CreatedAt.UTC()
+	return nil
+}
+
+// GetProbeJob retrieves a probe job and its results
+// Verifies that the job belongs to the specified organization
+func (ps *PostgresStorage) GetProbeJob(jobID, orgID string) (*models.ProbeJob, error) {
+	job, err := scanProbeJob(ps.db.QueryRow(
+		`SELECT `+probeJobColumns+` FROM probe_jobs WHERE id = $1 AND org_id = $2`,
+		jobID, orgID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get probe job: %w", classifyError(err))
+	}
+
+	rows, err := ps.db.Query(`
+		SELECT host_id, hostname, method, port, reachable, address, latency_ms, error, prober, probed_at
+		FROM host_probe_results
+		WHERE job_id = $1
+		ORDER BY hostname, host_id
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get probe results: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := &models.ProbeResult{}
+		if err := rows.Scan(&result.HostID, &result.Hostname, &result.Method, &result.Port, &result.Reachable,
+			&result.Address, &result.LatencyMS, &result.Error, &result.Prober, &result.ProbedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan probe result: %w", err)
+		}
+		result.ProbedAt = result.ProbedAt.UTC()
+		job.Results = append(job.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read probe results: %w", err)
+	}
+
+	return job, nil
+}
+
+// ClaimProbeJob hands the oldest pending agent job to a prober agent
+// Concurrent claims never receive the same job
+func (ps *PostgresStorage) ClaimProbeJob(orgID, claimedBy string) (*models.ProbeJob, error) {
+	job, err := scanProbeJob(ps.db.QueryRow(`
+		UPDATE probe_jobs
+		SET status = $3, claimed_by = $4
+		WHERE id = (
+			SELECT id FROM probe_jobs
+			WHERE org_id = $1 AND status = $2
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+probeJobColumns,
+		orgID, models.ProbeJobPending, models.ProbeJobRunning, claimedBy,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim probe job: %w", classifyError(err))
+	}
+
+	return job, nil
+}
+
+// CompleteProbeJob records a running job's results and marks it completed
+func (ps *PostgresStorage) CompleteProbeJob(jobID, orgID string, results []*models.ProbeResult) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE probe_jobs SET status = $3, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND status = $4
+	`, jobID, orgID, models.ProbeJobCompleted, models.ProbeJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to complete probe job: %w", classifyError(err))
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rows == 0 {
+		// Distinguish a job that is not running from one that does not exist
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM probe_jobs WHERE id = $1 AND org_id = $2)`, jobID, orgID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check probe job: %w", err)
+		}
+		if exists {
+			return ErrProbeJobNotRunning
+		}
+		return ErrNotFound
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO host_probe_results
+			(job_id, org_id, host_id, hostname, method, port, reachable, address, latency_ms, error, prober, probed_at)
+		SELECT $1, $2, host_id, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		FROM hosts
+		WHERE host_id = $3 AND org_id = $2
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare probe result insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, r := range results {
+		_, err := stmt.Exec(jobID, orgID, r.HostID, r.Hostname, r.Method, r.Port, r.Reachable,
+			r.Address, r.LatencyMS, r.Error, r.Prober, r.ProbedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save probe result: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit probe results: %w", err)
+	}
+
+	return nil
+}
+
+// Outbound action methods
+
+// actionColumns are the actions columns read by scanAction
+const actionColumns = `id, name, kind, triggers, method, url, headers, body_template, enabled, schema_version, rate_limit_per_hour,
+	signing_secret, signing_secret_created_at, previous_signing_secret, previous_secret_expires_at, created_by, created_at, updated_at`
+
+// scanAction scans a row selected with actionColumns, decrypting its signing secrets
+func (ps *PostgresStorage) scanAction(row interface{ Scan(...interface{}) error }) (*models.Action, error) {
+	action := &models.Action{}
+	var headersJSON []byte
+	var createdBy sql.NullString
+	var secretCreatedAt, previousExpiresAt sql.NullTime
+
+	err := row.Scan(&action.ID, &action.Name, &action.Kind, pq.Array(&action.Triggers), &action.Method, &action.URL,
+		&headersJSON, &action.BodyTemplate, &action.Enabled, &action.SchemaVersion, &action.RateLimitPerHour,
+		&action.SigningSecret, &secretCreatedAt, &action.PreviousSigningSecret, &previousExpiresAt,
+		&createdBy, &action.CreatedAt, &action.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if secretCreatedAt.Valid {
+		t := secretCreatedAt.Time.UTC()
+		action.SigningSecretCreatedAt = &t
+	}
+	if previousExpiresAt.Valid {
+		t := previousExpiresAt.Time.UTC()
+		action.PreviousSecretExpiresAt = &t
+	}
+
+	if err := json.Unmarshal(headersJSON, &action.Headers); err != nil {
+		return nil, fmt.Errorf("failed to decode action headers: %w", err)
+	}
+	if err := ps.openSecrets(&action.SigningSecret, &action.PreviousSigningSecret); err != nil {
+		return nil, err
+	}
+	action.CreatedBy = createdBy.String
+	action.CreatedAt = action.CreatedAt.UTC()
+	action.UpdatedAt = action.UpdatedAt.UTC()
+	return action, nil
+}
+
+// CreateAction stores a new action
+func (ps *PostgresStorage) CreateAction(action *models.Action, orgID string) error {
+	headersJSON, err := json.Marshal(action.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode action headers: %w", err)
+	}
+
+	var createdBy interface{}
+	if action.CreatedBy != "" {
+		createdBy = action.CreatedBy
+	}
+
+	signingSecret, err := ps.sealSecret(action.SigningSecret)
+	if err != nil {
+		return err
+	}
+
+	var secretCreatedAt sql.NullTime
+	err = ps.db.QueryRow(`
+		INSERT INTO actions (id, org_id, name, triggers, method, url, headers, body_template, enabled, created_by,
+			schema_version, signing_secret, signing_secret_created_at, kind, rate_limit_per_hour)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, CASE WHEN $12 = '' THEN NULL ELSE NOW() END,
+			COALESCE(NULLIF($13, ''), 'http'), $14)
+		RETURNING signing_secret_created_at, created_at, updated_at
+	`, action.ID, orgID, action.Name, pq.Array(action.Triggers), action.Method, action.URL, headersJSON,
+		action.BodyTemplate, action.Enabled, createdBy, action.SchemaVersion, signingSecret,
+		action.Kind, action.RateLimitPerHour,
+	).Scan(&secretCreatedAt, &action.CreatedAt, &action.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create action: %w", classifyError(err))
+	}
+
+	if secretCreatedAt.Valid {
+		t := secretCreatedAt.Time.UTC()
+		action.SigningSecretCreatedAt = &t
+	}
+	if action.Kind == "" {
+		action.Kind = models.ActionKindHTTP
+	}
+	action.CreatedAt = action.CreatedAt.UTC()
+	action.UpdatedAt = action.UpdatedAt.UTC()
+	return nil
+}
+
+// GetAction retrieves an action
+// Verifies that the action belongs to the specified organization
+func (ps *PostgresStorage) GetAction(actionID, orgID string) (*models.Action, error) {
+	action, err := ps.scanAction(ps.db.QueryRow(
+		`SELECT `+actionColumns+` FROM actions WHERE id = $1 AND org_id = $2`,
+		actionID, orgID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get action: %w", classifyError(err))
+	}
+	return action, nil
+}
+
+// ListActions returns the organization's actions, oldest first
+func (ps *PostgresStorage) ListActions(orgID string) ([]*models.Action, error) {
+	rows, err := ps.db.Query(`SELECT `+actionColumns+` FROM actions WHERE org_id = $1 ORDER BY created_at, id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list actions: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	actions := []*models.Action{}
+	for rows.Next() {
+		action, err := ps.scanAction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan action: %w", err)
+		}
+		actions = append(actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list actions: %w", err)
+	}
+	return actions, nil
+}
+
+// UpdateAction replaces an action's definition
+// A zero schema version keeps the action's current one; signing secrets are left unchanged.
+func (ps *PostgresStorage) UpdateAction(action *models.Action, orgID string) error {
+	headersJSON, err := json.Marshal(action.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode action headers: %w", err)
+	}
+
+	updated, err := ps.scanAction(ps.db.QueryRow(`
+		UPDATE actions
+		SET name = $3, triggers = $4, method = $5, url = $6, headers = $7, body_template = $8, enabled = $9,
+			schema_version = COALESCE(NULLIF($10, 0), schema_version), kind = COALESCE(NULLIF($11, ''), 'http'),
+			rate_limit_per_hour = $12,
+			updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+actionColumns,
+		action.ID, orgID, action.Name, pq.Array(action.Triggers), action.Method, action.URL, headersJSON,
+		action.BodyTemplate, action.Enabled, action.SchemaVersion, action.Kind, action.RateLimitPerHour))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update action: %w", classifyError(err))
+	}
+
+	*action = *updated
+	return nil
+}
+
+// RotateActionSigningSecret replaces an action's signing secret
+// The old secret becomes the previous one until previousExpiresAt, or is dropped when it is nil.
+func (ps *PostgresStorage) RotateActionSigningSecret(actionID, orgID, secret string, previousExpiresAt *time.Time) (*models.Action, error) {
+	sealed, err := ps.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	action, err := ps.scanAction(ps.db.QueryRow(`
+		UPDATE actions
+		SET previous_signing_secret = CASE WHEN $4::timestamptz IS NULL THEN '' ELSE signing_secret END,
+			previous_secret_expires_at = CASE WHEN $4::timestamptz IS NULL OR signing_secret = '' THEN NULL ELSE $4::timestamptz END,
+			signing_secret = $3, signing_secret_created_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+actionColumns,
+		actionID, orgID, sealed, previousExpiresAt))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate action signing secret: %w", classifyError(err))
+	}
+	return action, nil
+}
+
+// DeleteAction removes an action and its run history
+func (ps *PostgresStorage) DeleteAction(actionID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM actions WHERE id = $1 AND org_id = $2", actionID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete action: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// actionRunColumns are the action_runs columns read by scanActionRun
+const actionRunColumns = `id, action_id, org_id, finding, status, attempts, response_status, last_error, next_attempt_at, created_at, updated_at, completed_at`
+
+// scanActionRun scans a row selected with actionRunColumns
+func scanActionRun(row interface{ Scan(...interface{}) error }) (*models.ActionRun, error) {
+	run := &models.ActionRun{}
+	var findingJSON []byte
+	var nextAttemptAt, completedAt sql.NullTime
+
+	err := row.Scan(&run.ID, &run.ActionID, &run.OrgID, &findingJSON, &run.Status, &run.Attempts,
+		&run.ResponseStatus, &run.LastError, &nextAttemptAt, &run.CreatedAt, &run.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(findingJSON, &run.Finding); err != nil {
+		return nil, fmt.Errorf("failed to decode finding: %w", err)
+	}
+	if nextAttemptAt.Valid {
+		t := nextAttemptAt.Time.UTC()
+		run.NextAttemptAt = &t
+	}
+	if completedAt.Valid {
+		t := completedAt.Time.UTC()
+		run.CompletedAt = &t
+	}
+	run.CreatedAt = run.CreatedAt.UTC()
+	run.UpdatedAt = run.UpdatedAt.UTC()
+	return run, nil
+}
+
+// CreateActionRun queues a run unless the action already has a run for the same finding since the given time
+func (ps *PostgresStorage) CreateActionRun(run *models.ActionRun, since time.Time) (bool, error) {
+	findingJSON, err := json.Marshal(run.Finding)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode finding: %w", err)
+	}
+
+	err = ps.db.QueryRow(`
+		INSERT INTO action_runs (id, action_id, org_id, finding_key, finding, status, next_attempt_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE NOT EXISTS (
+			SELECT 1 FROM action_runs
+			WHERE action_id = $2 AND finding_key = $4 AND created_at > $8
+		)
+		RETURNING created_at, updated_at
+	`, run.ID, run.ActionID, run.OrgID, run.Finding.Key(), findingJSON, run.Status, run.NextAttemptAt, since).
+		Scan(&run.CreatedAt, &run.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create action run: %w", classifyError(err))
+	}
+
+	run.CreatedAt = run.CreatedAt.UTC()
+	run.UpdatedAt = run.UpdatedAt.UTC()
+	return true, nil
+}
+
+// CountActionRuns returns the number of runs queued for an action since the given time
+func (ps *PostgresStorage) CountActionRuns(actionID string, since time.Time) (int, error) {
+	var count int
+	err := ps.db.QueryRow(
+		"SELECT COUNT(*) FROM action_runs WHERE action_id = $1 AND created_at > $2", actionID, since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count action runs: %w", classifyError(err))
+	}
+	return count, nil
+}
+
+// GetActionRun retrieves an action run
+// Verifies that the run belongs to the specified organization
+func (ps *PostgresStorage) GetActionRun(runID, orgID string) (*models.ActionRun, error) {
+	run, err := scanActionRun(ps.db.QueryRow(
+		`SELECT `+actionRunColumns+` FROM action_runs WHERE id = $1 AND org_id = $2`,
+		runID, orgID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get action run: %w", classifyError(err))
+	}
+	return run, nil
+}
+
+// ListActionRuns returns an action's runs, newest first
+func (ps *PostgresStorage) ListActionRuns(actionID, orgID string, limit int) ([]*models.ActionRun, error) {
+	rows, err := ps.db.Query(`
+		SELECT `+actionRunColumns+`
+		FROM action_runs
+		WHERE action_id = $1 AND org_id = $2
+		ORDER BY created_at DESC, id
+		LIMIT $3
+	`, actionID, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list action runs: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	runs := []*models.ActionRun{}
+	for rows.Next() {
+		run, err := scanActionRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan action run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list action runs: %w", err)
+	}
+	return runs, nil
+}
+
+// ClaimActionRuns marks due runs as running until now+lease and returns them
+// SKIP LOCKED lets several snailbus instances claim runs concurrently
+func (ps *PostgresStorage) ClaimActionRuns(now time.Time, lease time.Duration, limit int) ([]*models.ActionRun, error) {
+	rows, err := ps.db.Query(`
+		UPDATE action_runs
+		SET status = 'running', next_attempt_at = $2, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM action_runs
+			WHERE status IN ('pending', 'running') AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+actionRunColumns, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim action runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*models.ActionRun{}
+	for rows.Next() {
+		run, err := scanActionRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan action run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim action runs: %w", err)
+	}
+	return runs, nil
+}
+
+// FinishActionRun records the outcome of an attempt
+func (ps *PostgresStorage) FinishActionRun(run *models.ActionRun) error {
+	err := ps.db.QueryRow(`
+		UPDATE action_runs
+		SET status = $3, attempts = $4, response_status = $5, last_error = $6, next_attempt_at = $7,
+			completed_at = $8, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING updated_at
+	`, run.ID, run.OrgID, run.Status, run.Attempts, run.ResponseStatus, run.LastError, run.NextAttemptAt,
+		run.CompletedAt).Scan(&run.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound // The action was deleted during the attempt
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish action run: %w", classifyError(err))
+	}
+	run.UpdatedAt = run.UpdatedAt.UTC()
+	return nil
+}
+
+// RetryActionRun requeues a failed run with a fresh set of attempts
+func (ps *PostgresStorage) RetryActionRun(runID, orgID string) (*models.ActionRun, error) {
+	run, err := scanActionRun(ps.db.QueryRow(`
+		UPDATE action_runs
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), completed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND status = 'failed'
+		RETURNING `+actionRunColumns, runID, orgID))
+	if err == sql.ErrNoRows {
+		if _, err := ps.GetActionRun(runID, orgID); err != nil {
+			return nil, err
+		}
+		return nil, ErrActionRunNotFailed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry action run: %w", classifyError(err))
+	}
+	return run, nil
+}
+
+// Organization secret methods
+
+// SetOrgSecret creates or replaces an organization secret
+func (ps *PostgresStorage) SetOrgSecret(orgID, name, value string) error {
+	value, err := ps.sealSecret(value)
+	if err != nil {
+		return err
+	}
+	_, err = ps.db.Exec(`
+		INSERT INTO org_secrets (org_id, name, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, name) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, orgID, name, value)
+	if err != nil {
+		return fmt.Errorf("failed to set organization secret: %w", classifyError(err))
+	}
+	return nil
+}
+
+// DeleteOrgSecret removes an organization secret
+func (ps *PostgresStorage) DeleteOrgSecret(orgID, name string) error {
+	result, err := ps.db.Exec("DELETE FROM org_secrets WHERE org_id = $1 AND name = $2", orgID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization secret: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListOrgSecrets returns the names of the organization's secrets, without values
+func (ps *PostgresStorage) ListOrgSecrets(orgID string) ([]*models.OrgSecret, error) {
+	rows, err := ps.db.Query(`SELECT name, created_at, updated_at FROM org_secrets WHERE org_id = $1 ORDER BY name`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization secrets: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	secrets := []*models.OrgSecret{}
+	for rows.Next() {
+		secret := &models.OrgSecret{}
+		if err := rows.Scan(&secret.Name, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization secret: %w", err)
+		}
+		secret.CreatedAt = secret.CreatedAt.UTC()
+		secret.UpdatedAt = secret.UpdatedAt.UTC()
+		secrets = append(secrets, secret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organization secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// GetOrgSecretValues returns the organization's secrets by name
+func (ps *PostgresStorage) GetOrgSecretValues(orgID string) (map[string]string, error) {
+	rows, err := ps.db.Query(`SELECT name, value FROM org_secrets WHERE org_id = $1`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization secrets: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan organization secret: %w", err)
+		}
+		if err := ps.openSecrets(&value); err != nil {
+			return nil, fmt.Errorf("organization secret %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get organization secrets: %w", err)
+	}
+	return values, nil
+}
+
+// Webhook methods
+
+// webhookColumns are the webhooks columns read by scanWebhook
+const webhookColumns = `id, url, events, enabled, signing_secret, created_by, created_at, updated_at`
+
+// scanWebhook scans a row selected with webhookColumns, decrypting its signing secret
+func (ps *PostgresStorage) scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	var createdBy sql.NullString
+
+	err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Enabled, &webhook.SigningSecret,
+		&createdBy, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.openSecrets(&webhook.SigningSecret); err != nil {
+		return nil, err
+	}
+	webhook.CreatedBy = createdBy.String
+	webhook.CreatedAt = webhook.CreatedAt.UTC()
+	webhook.UpdatedAt = webhook.UpdatedAt.UTC()
+	return webhook, nil
+}
+
+// CreateWebhook stores a new webhook
+func (ps *PostgresStorage) CreateWebhook(webhook *models.Webhook, orgID string) error {
+	var createdBy interface{}
+	if webhook.CreatedBy != "" {
+		createdBy = webhook.CreatedBy
+	}
+
+	signingSecret, err := ps.sealSecret(webhook.SigningSecret)
+	if err != nil {
+		return err
+	}
+
+	err = ps.db.QueryRow(`
+		INSERT INTO webhooks (id, org_id, url, events, enabled, signing_secret, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at
+	`, webhook.ID, orgID, webhook.URL, pq.Array(webhook.Events), webhook.Enabled, signingSecret, createdBy,
+	).Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", classifyError(err))
+	}
+
+	webhook.CreatedAt = webhook.CreatedAt.UTC()
+	webhook.UpdatedAt = webhook.UpdatedAt.UTC()
+	return nil
+}
+
+// GetWebhook retrieves a webhook
+// Verifies that the webhook belongs to the specified organization
+func (ps *PostgresStorage) GetWebhook(webhookID, orgID string) (*models.Webhook, error) {
+	webhook, err := ps.scanWebhook(ps.db.QueryRow(
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND org_id = $2`,
+		webhookID, orgID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", classifyError(err))
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns the organization's webhooks, oldest first
+func (ps *PostgresStorage) ListWebhooks(orgID string) ([]*models.Webhook, error) {
+	rows, err := ps.db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE org_id = $1 ORDER BY created_at, id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := ps.scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces a webhook's URL, events, and enabled flag
+func (ps *PostgresStorage) UpdateWebhook(webhook *models.Webhook, orgID string) error {
+	updated, err := ps.scanWebhook(ps.db.QueryRow(`
+		UPDATE webhooks
+		SET url = $3, events = $4, enabled = $5, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+webhookColumns,
+		webhook.ID, orgID, webhook.URL, pq.Array(webhook.Events), webhook.Enabled))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", classifyError(err))
+	}
+
+	*webhook = *updated
+	return nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (ps *PostgresStorage) DeleteWebhook(webhookID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM webhooks WHERE id = $1 AND org_id = $2", webhookID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListWebhookOrgs returns the IDs of organizations with an enabled webhook subscribed to eventType
+func (ps *PostgresStorage) ListWebhookOrgs(eventType string) ([]string, error) {
+	rows, err := ps.db.Query(
+		`SELECT DISTINCT org_id FROM webhooks WHERE enabled AND $1 = ANY(events) ORDER BY org_id`, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook organizations: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	orgIDs := []string{}
+	for rows.Next() {
+		var orgID string
+		if err := rows.Scan(&orgID); err != nil {
+			return nil, fmt.Errorf("failed to scan organization ID: %w", err)
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	return orgIDs, rows.Err()
+}
+
+// webhookDeliveryColumns are the webhook_deliveries columns read by scanWebhookDelivery
+const webhookDeliveryColumns = `id, webhook_id, org_id, event, status, attempts, response_status, last_error, next_attempt_at, created_at, updated_at, completed_at`
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	var eventJSON []byte
+	var nextAttemptAt, completedAt sql.NullTime
+
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.OrgID, &eventJSON, &delivery.Status, &delivery.Attempts,
+		&delivery.ResponseStatus, &delivery.LastError, &nextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(eventJSON, &delivery.Event); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook event: %w", err)
+	}
+	if nextAttemptAt.Valid {
+		t := nextAttemptAt.Time.UTC()
+		delivery.NextAttemptAt = &t
+	}
+	if completedAt.Valid {
+		t := completedAt.Time.UTC()
+		delivery.CompletedAt = &t
+	}
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	delivery.UpdatedAt = delivery.UpdatedAt.UTC()
+	return delivery, nil
+}
+
+// scanWebhookDeliveries scans every row selected with webhookDeliveryColumns
+func scanWebhookDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateWebhookDelivery queues a delivery unless dedupKey is set and the webhook already
+// has a delivery with the same key since the given time
+func (ps *PostgresStorage) CreateWebhookDelivery(delivery *models.WebhookDelivery, dedupKey string, since time.Time) (bool, error) {
+	eventJSON, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+
+	err = ps.db.QueryRow(`
+		INSERT INTO webhook_deliveries (id, webhook_id, org_id, event_type, dedup_key, event, status, next_attempt_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8
+		WHERE $5 = '' OR NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries
+			WHERE webhook_id = $2 AND dedup_key = $5 AND created_at > $9
+		)
+		RETURNING created_at, updated_at
+	`, delivery.ID, delivery.WebhookID, delivery.OrgID, delivery.Event.Type, dedupKey, eventJSON, delivery.Status,
+		delivery.NextAttemptAt, since).
+		Scan(&delivery.CreatedAt, &delivery.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook delivery: %w", classifyError(err))
+	}
+
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	delivery.UpdatedAt = delivery.UpdatedAt.UTC()
+	return true, nil
+}
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first
+func (ps *PostgresStorage) ListWebhookDeliveries(webhookID, orgID string, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := ps.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND org_id = $2
+		ORDER BY created_at DESC, id
+		LIMIT $3
+	`, webhookID, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", classifyError(err))
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries marks due deliveries as running until now+lease and returns them
+// SKIP LOCKED lets several snailbus instances claim deliveries concurrently
+func (ps *PostgresStorage) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := ps.db.Query(`
+		UPDATE webhook_deliveries
+		SET status = 'running', next_attempt_at = $2, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status IN ('pending', 'running') AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// FinishWebhookDelivery records the outcome of an attempt
+func (ps *PostgresStorage) FinishWebhookDelivery(delivery *models.WebhookDelivery) error {
+	err := ps.db.QueryRow(`
+		UPDATE webhook_deliveries
+		SET status = $3, attempts = $4, response_status = $5, last_error = $6, next_attempt_at = $7,
+			completed_at = $8, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING updated_at
+	`, delivery.ID, delivery.OrgID, delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.LastError,
+		delivery.NextAttemptAt, delivery.CompletedAt).Scan(&delivery.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound // The webhook was deleted during the attempt
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish webhook delivery: %w", classifyError(err))
+	}
+	delivery.UpdatedAt = delivery.UpdatedAt.UTC()
+	return nil
+}
+
+// DeleteWebhookDeliveries removes deliveries completed before the given time
+func (ps *PostgresStorage) DeleteWebhookDeliveries(before time.Time) (int64, error) {
+	result, err := ps.db.Exec(`DELETE FROM webhook_deliveries WHERE completed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete webhook deliveries: %w", classifyError(err))
+	}
+	return result.RowsAffected()
+}
+
+// Audit log methods
+
+// CreateAuditEvent appends an event to the organization's audit log
+func (ps *PostgresStorage) CreateAuditEvent(event *models.AuditEvent) error {
+	var actorUserID interface{}
+	if event.ActorUserID != "" {
+		actorUserID = event.ActorUserID
+	}
+	var impersonatorUserID interface{}
+	if event.ImpersonatorUserID != "" {
+		impersonatorUserID = event.ImpersonatorUserID
+	}
+	details := []byte("{}")
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit event details: %w", err)
+		}
+		details = encoded
+	}
+
+	err := ps.db.QueryRow(`
+		INSERT INTO audit_events (org_id, action, actor_user_id, actor_username, auth_method,
+			target_type, target_id, details, request_id, client_ip, user_agent,
+			impersonator_user_id, impersonator_username)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at
+	`, event.OrgID, event.Action, actorUserID, event.ActorUsername, event.AuthMethod,
+		event.TargetType, event.TargetID, details, event.RequestID, event.ClientIP, event.UserAgent,
+		impersonatorUserID, event.ImpersonatorUsername,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", classifyError(err))
+	}
+
+	event.CreatedAt = event.CreatedAt.UTC()
+	return nil
+}
+
+// ListAuditEvents returns a page of the organization's audit events, newest first
+func (ps *PostgresStorage) ListAuditEvents(orgID string, filter models.AuditFilter, beforeID int64, limit int) (*AuditPage, error) {
+	limit = clampAuditPageSize(limit)
+
+	// One extra event tells whether another page follows
+	rows, err := ps.reader().Query(`
+		SELECT id, org_id, action, COALESCE(actor_user_id::text, ''), actor_username, auth_method,
+			COALESCE(impersonator_user_id::text, ''), impersonator_username,
+			target_type, target_id, details, request_id, client_ip, user_agent, created_at
+		FROM audit_events
+		WHERE org_id = $1
+			AND ($2 = 0 OR id < $2)
+			AND ($3 = '' OR action = $3)
+			AND ($4 = '' OR actor_user_id::text = $4)
+		ORDER BY id DESC
+		LIMIT $5
+	`, orgID, beforeID, filter.Action, filter.ActorUserID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.OrgID, &event.Action, &event.ActorUserID, &event.ActorUsername,
+			&event.AuthMethod, &event.ImpersonatorUserID, &event.ImpersonatorUsername, &event.TargetType, &event.TargetID, &details, &event.RequestID,
+			&event.ClientIP, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if len(details) > 0 && string(details) != "{}" {
+			if err := json.Unmarshal(details, &event.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit event %d: %w", event.ID, err)
+			}
+		}
+		event.CreatedAt = event.CreatedAt.UTC()
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", classifyError(err))
+	}
+	return auditPage(events, limit), nil
+}
+
+// Prometheus remote-write methods
+
+const remoteWriteColumns = `org_id, url, metrics, username, password, bearer_token, last_push_at, last_error, version, created_at, updated_at`
+
+// scanRemoteWriteConfig scans a row selected with remoteWriteColumns, decrypting its credentials
+func (ps *PostgresStorage) scanRemoteWriteConfig(row interface{ Scan(...interface{}) error }) (*models.RemoteWriteConfig, error) {
+	config := &models.RemoteWriteConfig{}
+	var lastPushAt sql.NullTime
+
+	err := row.Scan(&config.OrgID, &config.URL, pq.Array(&config.Metrics), &config.Username, &config.Password,
+		&config.BearerToken, &lastPushAt, &config.LastError, &config.Version, &config.CreatedAt, &config.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.openSecrets(&config.Password, &config.BearerToken); err != nil {
+		return nil, err
+	}
+
+	if lastPushAt.Valid {
+		t := lastPushAt.Time.UTC()
+		config.LastPushAt = &t
+	}
+	config.CreatedAt = config.CreatedAt.UTC()
+	config.UpdatedAt = config.UpdatedAt.UTC()
+	config.SetAuth()
+	return config, nil
+}
+
+// GetRemoteWriteConfig returns the organization's remote-write target
+func (ps *PostgresStorage) GetRemoteWriteConfig(orgID string) (*models.RemoteWriteConfig, error) {
+	row := ps.db.QueryRow(`SELECT `+remoteWriteColumns+` FROM org_remote_write WHERE org_id = $1`, orgID)
+	config, err := ps.scanRemoteWriteConfig(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote-write config: %w", classifyError(err))
+	}
+	return config, nil
+}
+
+// SetRemoteWriteConfig creates or replaces the organization's remote-write target
+// Replacing a target clears its last error, so it is pushed on the next cycle.
+func (ps *PostgresStorage) SetRemoteWriteConfig(config *models.RemoteWriteConfig) error {
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = []string{}
+	}
+
+	password, err := ps.sealSecret(config.Password)
+	if err != nil {
+		return err
+	}
+	bearerToken, err := ps.sealSecret(config.BearerToken)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_remote_write", config.OrgID, config.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_remote_write AS w (org_id, url, metrics, username, password, bearer_token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (org_id) DO UPDATE SET
+			url = EXCLUDED.url,
+			metrics = EXCLUDED.metrics,
+			username = EXCLUDED.username,
+			password = EXCLUDED.password,
+			bearer_token = EXCLUDED.bearer_token,
+			last_push_at = NULL,
+			last_error = '',
+			version = w.version + 1,
+			updated_at = NOW()
+		RETURNING version, created_at, updated_at
+	`, config.OrgID, config.URL, pq.Array(metrics), config.Username, password, bearerToken)
+	if err := row.Scan(&config.Version, &config.CreatedAt, &config.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set remote-write config: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit remote-write config: %w", err)
+	}
+	config.CreatedAt = config.CreatedAt.UTC()
+	config.UpdatedAt = config.UpdatedAt.UTC()
+	config.LastPushAt = nil
+	config.LastError = ""
+	config.SetAuth()
+	return nil
+}
+
+// DeleteRemoteWriteConfig removes the organization's remote-write target
+func (ps *PostgresStorage) DeleteRemoteWriteConfig(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_remote_write WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete remote-write config: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_remote_write", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// checkOrgSettingVersion returns ErrVersionMismatch unless the organization's row in a settings
+// table has version ifVersion, and locks the row until the transaction ends. 0 skips the check.
+func checkOrgSettingVersion(tx dbConn, table, orgID string, ifVersion int64) error {
+	if ifVersion == 0 {
+		return nil
+	}
+	var version int64
+	err := tx.QueryRow(`SELECT version FROM `+table+` WHERE org_id = $1 FOR UPDATE`, orgID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", table, classifyError(err))
+	}
+	if version != ifVersion {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// ClaimRemoteWriteConfigs marks the targets not pushed since now-interval as pushed at now and returns them
+func (ps *PostgresStorage) ClaimRemoteWriteConfigs(now time.Time, interval time.Duration) ([]*models.RemoteWriteConfig, error) {
+	rows, err := ps.db.Query(`
+		UPDATE org_remote_write SET last_push_at = $1
+		WHERE org_id IN (
+			SELECT org_id FROM org_remote_write
+			WHERE last_push_at IS NULL OR last_push_at <= $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+remoteWriteColumns, now, now.Add(-interval))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim remote-write configs: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	configs := []*models.RemoteWriteConfig{}
+	for rows.Next() {
+		config, err := ps.scanRemoteWriteConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan remote-write config: %w", err)
+		}
+		configs = append(configs, config)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim remote-write configs: %w", err)
+	}
+	return configs, nil
+}
+
+// RecordRemoteWriteResult stores the error of the organization's last push
+func (ps *PostgresStorage) RecordRemoteWriteResult(orgID, lastError string) error {
+	if _, err := ps.db.Exec("UPDATE org_remote_write SET last_error = $2 WHERE org_id = $1", orgID, lastError); err != nil {
+		return fmt.Errorf("failed to record remote-write result: %w", classifyError(err))
+	}
+	return nil
+}
+
+// CountHostPackages returns the number of installed packages per host in the organization
+// Counted in SQL so the report data never leaves the database.
+func (ps *PostgresStorage) CountHostPackages(orgID string) (map[string]int, error) {
+	rows, err := ps.reader().Query(`
+		SELECT host_id,
+			CASE WHEN jsonb_typeof(data->'packages'->'installed') = 'array'
+				THEN jsonb_array_length(data->'packages'->'installed') ELSE 0 END
+		FROM hosts WHERE org_id = $1
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count host packages: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var hostID string
+		var count int
+		if err := rows.Scan(&hostID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan host package count: %w", err)
+		}
+		counts[hostID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count host packages: %w", err)
+	}
+	return counts, nil
+}
+
+// Ingest filter methods
+
+// GetIngestFilter returns the organization's ingest filter
+func (ps *PostgresStorage) GetIngestFilter(orgID string) (*models.IngestFilter, error) {
+	filter := &models.IngestFilter{}
+	var updatedBy sql.NullString
+	err := ps.db.QueryRow(`
+		SELECT org_id, paths, updated_by_user_id, version, created_at, updated_at
+		FROM org_ingest_filters
+		WHERE org_id = $1
+	`, orgID).Scan(&filter.OrgID, pq.Array(&filter.Paths), &updatedBy, &filter.Version, &filter.CreatedAt, &filter.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingest filter: %w", classifyError(err))
+	}
+	filter.UpdatedByUserID = updatedBy.String
+	filter.CreatedAt = filter.CreatedAt.UTC()
+	filter.UpdatedAt = filter.UpdatedAt.UTC()
+	return filter, nil
+}
+
+// SetIngestFilter creates or replaces the organization's ingest filter
+func (ps *PostgresStorage) SetIngestFilter(filter *models.IngestFilter) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_ingest_filters", filter.OrgID, filter.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_ingest_filters AS f (org_id, paths, updated_by_user_id)
+		VALUES ($1, $2, NULLIF($3, '')::uuid)
+		ON CONFLICT (org_id) DO UPDATE SET
+			paths = EXCLUDED.paths,
+			updated_by_user_id = EXCLUDED.updated_by_user_id,
+			version = f.version + 1,
+			updated_at = NOW()
+		RETURNING version, created_at, updated_at
+	`, filter.OrgID, pq.Array(filter.Paths), filter.UpdatedByUserID)
+	if err := row.Scan(&filter.Version, &filter.CreatedAt, &filter.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set ingest filter: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ingest filter: %w", err)
+	}
+	filter.CreatedAt = filter.CreatedAt.UTC()
+	filter.UpdatedAt = filter.UpdatedAt.UTC()
+	return nil
+}
+
+// DeleteIngestFilter removes the organization's ingest filter
+func (ps *PostgresStorage) DeleteIngestFilter(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_ingest_filters WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete ingest filter: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_ingest_filters", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// Host tag rule methods
+
+// GetHostTagRules returns the organization's host tag rules
+func (ps *PostgresStorage) GetHostTagRules(orgID string) (*models.HostTagRules, error) {
+	rules := &models.HostTagRules{}
+	var encoded []byte
+	var updatedBy sql.NullString
+	err := ps.db.QueryRow(`
+		SELECT org_id, rules, updated_by_user_id, version, created_at, updated_at
+		FROM org_host_tag_rules
+		WHERE org_id = $1
+	`, orgID).Scan(&rules.OrgID, &encoded, &updatedBy, &rules.Version, &rules.CreatedAt, &rules.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host tag rules: %w", classifyError(err))
+	}
+	if err := json.Unmarshal(encoded, &rules.Rules); err != nil {
+		return nil, fmt.Errorf("failed to decode host tag rules: %w", err)
+	}
+	rules.UpdatedByUserID = updatedBy.String
+	rules.CreatedAt = rules.CreatedAt.UTC()
+	rules.UpdatedAt = rules.UpdatedAt.UTC()
+	return rules, nil
+}
+
+// SetHostTagRules creates or replaces the organization's host tag rules
+func (ps *PostgresStorage) SetHostTagRules(rules *models.HostTagRules) error {
+	if rules.Rules == nil {
+		rules.Rules = []models.HostTagRule{}
+	}
+	encoded, err := json.Marshal(rules.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode host tag rules: %w", err)
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_host_tag_rules", rules.OrgID, rules.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_host_tag_rules AS r (org_id, rules, updated_by_user_id)
+		VALUES ($1, $2, NULLIF($3, '')::uuid)
+		ON CONFLICT (org_id) DO UPDATE SET
+			rules = EXCLUDED.rules,
+			updated_by_user_id = EXCLUDED.updated_by_user_id,
+			version = r.version + 1,
+			updated_at = NOW()
+		RETURNING version, created_at, updated_at
+	`, rules.OrgID, encoded, rules.UpdatedByUserID)
+	if err := row.Scan(&rules.Version, &rules.CreatedAt, &rules.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set host tag rules: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host tag rules: %w", err)
+	}
+	rules.CreatedAt = rules.CreatedAt.UTC()
+	rules.UpdatedAt = rules.UpdatedAt.UTC()
+	return nil
+}
+
+// DeleteHostTagRules removes the organization's host tag rules
+func (ps *PostgresStorage) DeleteHostTagRules(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_host_tag_rules WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete host tag rules: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_host_tag_rules", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// Offline bundle import methods
+
+const importBatchColumns = `id, source, COALESCE(imported_by::text, ''), bundle_sha256, key_id, exporter, exported_at,
+	report_count, imported, superseded, rejected, started_at, completed_at`
+
+func scanImportBatch(row interface{ Scan(...interface{}) error }, dest ...interface{}) (*models.ImportBatch, error) {
+	batch := &models.ImportBatch{}
+	var completedAt sql.NullTime
+	err := row.Scan(append([]interface{}{&batch.ID, &batch.Source, &batch.ImportedBy, &batch.BundleSHA256, &batch.KeyID,
+		&batch.Exporter, &batch.ExportedAt, &batch.ReportCount, &batch.Imported, &batch.Superseded, &batch.Rejected,
+		&batch.StartedAt, &completedAt}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	batch.ExportedAt = batch.ExportedAt.UTC()
+	batch.StartedAt = batch.StartedAt.UTC()
+	if completedAt.Valid {
+		t := completedAt.Time.UTC()
+		batch.CompletedAt = &t
+	}
+	return batch, nil
+}
+
+// CreateImportBatch records the start of an import
+// An interrupted import of the same bundle does not block a new one.
+func (ps *PostgresStorage) CreateImportBatch(batch *models.ImportBatch, orgID string) error {
+	var imported bool
+	err := ps.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM import_batches
+			WHERE org_id = $1 AND bundle_sha256 = $2 AND completed_at IS NOT NULL
+		)
+	`, orgID, batch.BundleSHA256).Scan(&imported)
+	if err != nil {
+		return fmt.Errorf("failed to check import batches: %w", classifyError(err))
+	}
+	if imported {
+		return ErrBundleAlreadyImported
+	}
+
+	err = ps.db.QueryRow(`
+		INSERT INTO import_batches (id, org_id, source, imported_by, bundle_sha256, key_id, exporter, exported_at, report_count)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9)
+		RETURNING started_at
+	`, batch.ID, orgID, batch.Source, batch.ImportedBy, batch.BundleSHA256, batch.KeyID, batch.Exporter,
+		batch.ExportedAt, batch.ReportCount).Scan(&batch.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create import batch: %w", classifyError(err))
+	}
+	batch.StartedAt = batch.StartedAt.UTC()
+	return nil
+}
+
+// FinishImportBatch records a batch's counts and results and marks it completed
+// Of two concurrent imports of the same bundle, the one finishing second gets
+// ErrBundleAlreadyImported; its reports were superseded by the first.
+func (ps *PostgresStorage) FinishImportBatch(batch *models.ImportBatch, orgID string) error {
+	results, err := json.Marshal(batch.Results)
+	if err != nil {
+		return fmt.Errorf("failed to encode import results: %w", err)
+	}
+	var completedAt time.Time
+	err = ps.db.QueryRow(`
+		UPDATE import_batches
+		SET imported = $3, superseded = $4, rejected = $5, results = $6, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING completed_at
+	`, batch.ID, orgID, batch.Imported, batch.Superseded, batch.Rejected, results).Scan(&completedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "import_batches_completed_bundle_key" {
+		return ErrBundleAlreadyImported
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish import batch: %w", classifyError(err))
+	}
+	completedAt = completedAt.UTC()
+	batch.CompletedAt = &completedAt
+	return nil
+}
+
+// ListImportBatches returns up to limit of the organization's batches, newest first
+func (ps *PostgresStorage) ListImportBatches(orgID string, limit int) ([]*models.ImportBatch, error) {
+	rows, err := ps.db.Query(`
+		SELECT `+importBatchColumns+`
+		FROM import_batches
+		WHERE org_id = $1
+		ORDER BY started_at DESC, id
+		LIMIT $2
+	`, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list import batches: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	batches := []*models.ImportBatch{}
+	for rows.Next() {
+		batch, err := scanImportBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list import batches: %w", err)
+	}
+	return batches, nil
+}
+
+// GetImportBatch returns a batch of the organization with its results
+func (ps *PostgresStorage) GetImportBatch(batchID, orgID string) (*models.ImportBatch, error) {
+	var results []byte
+	batch, err := scanImportBatch(ps.db.QueryRow(`
+		SELECT `+importBatchColumns+`, results
+		FROM import_batches
+		WHERE id = $1 AND org_id = $2
+	`, batchID, orgID), &results)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import batch: %w", classifyError(err))
+	}
+	if err := json.Unmarshal(results, &batch.Results); err != nil {
+		return nil, fmt.Errorf("failed to decode import results: %w", err)
+	}
+	return batch, nil
+}
+
+// ImportHost stores a bundled report unless the host has a more recent one
+// Hosts deleted after the report was collected stay deleted.
+func (ps *PostgresStorage) ImportHost(report *models.Report, orgID, uploadedByUserID, batchID string) (bool, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockHost(tx, orgID, report.Meta.HostID); err != nil {
+		return false, err
+	}
+
+	var receivedAt sql.NullTime
+	err = tx.QueryRow(
+		`SELECT received_at FROM hosts WHERE host_id = $1 AND org_id = $2`, report.Meta.HostID, orgID,
+	).Scan(&receivedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to check existing host: %w", classifyError(err))
+	}
+	existed := err == nil
+	if !existed {
+		err = tx.QueryRow(`
+			SELECT MAX(created_at) FROM host_events
+			WHERE org_id = $1 AND host_id = $2 AND event_type = $3
+		`, orgID, report.Meta.HostID, models.HostEventDeleted).Scan(&receivedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to check host deletion: %w", classifyError(err))
+		}
+	}
+	if receivedAt.Valid && !receivedAt.Time.Before(report.ReceivedAt) {
+		return false, nil
+	}
+
+	event := snapshotEvent(report, orgID, uploadedByUserID, existed)
+	event.Payload.ImportBatchID = batchID
+	if err := appendHostEvent(tx, event); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to import host: %w", classifyError(err))
+	}
+	return true, nil
+}
+
+// Check-in schedule methods
+
+const checkinScheduleColumns = `org_id, default_interval_seconds, windows, updated_by_user_id, version, created_at, updated_at`
+
+func scanCheckinSchedule(row interface{ Scan(...interface{}) error }) (*models.CheckinSchedule, error) {
+	schedule := &models.CheckinSchedule{}
+	var windows []byte
+	var updatedBy sql.NullString
+	if err := row.Scan(&schedule.OrgID, &schedule.DefaultIntervalSeconds, &windows, &updatedBy,
+		&schedule.Version, &schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(windows, &schedule.Windows); err != nil {
+		return nil, fmt.Errorf("failed to decode check-in windows: %w", err)
+	}
+	schedule.UpdatedByUserID = updatedBy.String
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	schedule.UpdatedAt = schedule.UpdatedAt.UTC()
+	return schedule, nil
+}
+
+// GetCheckinSchedule returns the organization's check-in schedule
+func (ps *PostgresStorage) GetCheckinSchedule(orgID string) (*models.CheckinSchedule, error) {
+	schedule, err := scanCheckinSchedule(ps.db.QueryRow(`
+		SELECT `+checkinScheduleColumns+`
+		FROM org_checkin_schedules
+		WHERE org_id = $1
+	`, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get check-in schedule: %w", classifyError(err))
+	}
+	return schedule, nil
+}
+
+// SetCheckinSchedule creates or replaces the organization's check-in schedule
+func (ps *PostgresStorage) SetCheckinSchedule(schedule *models.CheckinSchedule) error {
+	if schedule.Windows == nil {
+		schedule.Windows = []models.CheckinWindow{}
+	}
+	windows, err := json.Marshal(schedule.Windows)
+	if err != nil {
+		return fmt.Errorf("failed to encode check-in windows: %w", err)
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_checkin_schedules", schedule.OrgID, schedule.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_checkin_schedules AS s (org_id, default_interval_seconds, windows, updated_by_user_id)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+		ON CONFLICT (org_id) DO UPDATE SET
+			default_interval_seconds = EXCLUDED.default_interval_seconds,
+			windows = EXCLUDED.windows,
+			updated_by_user_id = EXCLUDED.updated_by_user_id,
+			version = s.version + 1,
+			updated_at = NOW()
+		RETURNING version, created_at, updated_at
+	`, schedule.OrgID, schedule.DefaultIntervalSeconds, windows, schedule.UpdatedByUserID)
+	if err := row.Scan(&schedule.Version, &schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set check-in schedule: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit check-in schedule: %w", err)
+	}
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	schedule.UpdatedAt = schedule.UpdatedAt.UTC()
+	return nil
+}
+
+// DeleteCheckinSchedule removes the organization's check-in schedule
+func (ps *PostgresStorage) DeleteCheckinSchedule(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_checkin_schedules WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete check-in schedule: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_checkin_schedules", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// ListCheckinSchedules returns every organization's check-in schedule
+func (ps *PostgresStorage) ListCheckinSchedules() ([]*models.CheckinSchedule, error) {
+	rows, err := ps.db.Query(`SELECT ` + checkinScheduleColumns + ` FROM org_checkin_schedules ORDER BY org_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list check-in schedules: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	schedules := []*models.CheckinSchedule{}
+	for rows.Next() {
+		schedule, err := scanCheckinSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan check-in schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// ListHostOrgIDs returns the organizations with unarchived hosts
+func (ps *PostgresStorage) ListHostOrgIDs() ([]string, error) {
+	rows, err := ps.db.Query(`SELECT DISTINCT org_id FROM hosts WHERE archived_at IS NULL ORDER BY org_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host organizations: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	orgIDs := []string{}
+	for rows.Next() {
+		var orgID string
+		if err := rows.Scan(&orgID); err != nil {
+			return nil, fmt.Errorf("failed to scan host organization: %w", err)
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	return orgIDs, rows.Err()
+}
+
+// MarkStaleHosts marks the organization's hosts in stale as stale and clears the mark of the rest
+// A host is only marked if its last report is no newer than the one it was found stale on,
+// so a report that arrives while the organization is being checked wins.
+func (ps *PostgresStorage) MarkStaleHosts(orgID string, stale map[string]time.Time, now time.Time) (int, error) {
+	hostIDs := make([]string, 0, len(stale))
+	lastSeen := make([]string, 0, len(stale))
+	for hostID, seen := range stale {
+		hostIDs = append(hostIDs, hostID)
+		lastSeen = append(lastSeen, seen.UTC().Format(time.RFC3339Nano))
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE hosts h SET stale_since = $3
+		FROM unnest($2::uuid[], $4::timestamptz[]) AS s(host_id, last_seen)
+		WHERE h.org_id = $1 AND h.host_id = s.host_id AND h.stale_since IS NULL
+			AND h.archived_at IS NULL AND h.received_at <= s.last_seen
+	`, orgID, pq.Array(hostIDs), now, pq.Array(lastSeen))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark stale hosts: %w", classifyError(err))
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark stale hosts: %w", err)
+	}
+
+	// Hosts whose window grew since they were marked are no longer stale
+	_, err = tx.Exec(`
+		UPDATE hosts SET stale_since = NULL
+		WHERE org_id = $1 AND stale_since IS NOT NULL AND archived_at IS NULL AND NOT (host_id = ANY($2::uuid[]))
+	`, orgID, pq.Array(hostIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear stale hosts: %w", classifyError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to mark stale hosts: %w", classifyError(err))
+	}
+	return int(marked), nil
+}
+
+// Host report history methods
+
+const hostReportColumns = `id, host_id, hostname, collection_id, timestamp, snail_version, received_at,
+	COALESCE(uploaded_by_user_id::text, ''), errors, health`
+
+// scanHistoryReport scans hostReportColumns, followed by data when withData is set
+func scanHistoryReport(row interface{ Scan(...interface{}) error }, withData bool) (*models.HostReport, error) {
+	report := &models.HostReport{}
+	var timestamp sql.NullTime
+	var errors []string
+	var health []byte
+	dest := []interface{}{&report.ID, &report.HostID, &report.Hostname, &report.CollectionID, &timestamp,
+		&report.SnailVersion, &report.ReceivedAt, &report.UploadedByUserID, pq.Array(&errors), &health}
+	if withData {
+		dest = append(dest, &report.Data)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if timestamp.Valid {
+		t := timestamp.Time.UTC()
+		report.CollectedAt = &t
+	}
+	report.ReceivedAt = report.ReceivedAt.UTC()
+	report.Errors = errors
+	report.Health = decodeHealth(health)
+	return report, nil
+}
+
+// SaveHostReport adds a report to its host's history and prunes the history to keep reports
+func (ps *PostgresStorage) SaveHostReport(report *models.HostReport, orgID string, keep int) error {
+	var health []byte
+	if report.Health != nil {
+		var err error
+		if health, err = json.Marshal(report.Health); err != nil {
+			return fmt.Errorf("failed to encode health: %w", err)
+		}
+	}
+	var timestamp sql.NullTime
+	if report.CollectedAt != nil {
+		timestamp = sql.NullTime{Time: *report.CollectedAt, Valid: true}
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if keep > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO host_reports (id, org_id, host_id, hostname, collection_id, timestamp, snail_version,
+				received_at, data, errors, health, uploaded_by_user_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE($10::text[], '{}'), $11, NULLIF($12, '')::uuid)
+		`, report.ID, orgID, report.HostID, report.Hostname, report.CollectionID, timestamp, report.SnailVersion,
+			report.ReceivedAt, []byte(report.Data), pq.Array(report.Errors), health, report.UploadedByUserID)
+		if err != nil {
+			return fmt.Errorf("failed to save host report: %w", classifyError(err))
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM host_reports
+		WHERE org_id = $1 AND host_id = $2 AND id NOT IN (
+			SELECT id FROM host_reports
+			WHERE org_id = $1 AND host_id = $2
+			ORDER BY received_at DESC, id DESC
+			LIMIT $3
+		)
+	`, orgID, report.HostID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune host reports: %w", classifyError(err))
+	}
+	return tx.Commit()
+}
+
+// ListHostReports returns a host's report history without report data, newest first
+func (ps *PostgresStorage) ListHostReports(hostID, orgID string) ([]*models.HostReport, error) {
+	rows, err := ps.reader().Query(`
+		SELECT `+hostReportColumns+`
+		FROM host_reports
+		WHERE org_id = $1 AND host_id = $2
+		ORDER BY received_at DESC, id DESC
+	`, orgID, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host reports: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	reports := []*models.HostReport{}
+	for rows.Next() {
+		report, err := scanHistoryReport(rows, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan host report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list host reports: %w", classifyError(err))
+	}
+	return reports, nil
+}
+
+// GetHostReportByID returns a report from a host's history with its data
+func (ps *PostgresStorage) GetHostReportByID(reportID, hostID, orgID string) (*models.HostReport, error) {
+	report, err := scanHistoryReport(ps.db.QueryRow(`
+		SELECT `+hostReportColumns+`, data
+		FROM host_reports
+		WHERE id = $1 AND org_id = $2 AND host_id = $3
+	`, reportID, orgID, hostID), true)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host report: %w", classifyError(err))
+	}
+	return report, nil
+}
+
+const hostReportRetentionColumns = `org_id, reports_per_host, delete_hosts_unseen_days, updated_by_user_id, version, created_at, updated_at`
+
+func scanHostReportRetention(row interface{ Scan(...interface{}) error }) (*models.HostReportRetention, error) {
+	retention := &models.HostReportRetention{}
+	var updatedBy sql.NullString
+	if err := row.Scan(&retention.OrgID, &retention.ReportsPerHost, &retention.DeleteHostsUnseenDays, &updatedBy,
+		&retention.Version, &retention.CreatedAt, &retention.UpdatedAt); err != nil {
+		return nil, err
+	}
+	retention.UpdatedByUserID = updatedBy.String
+	retention.CreatedAt = retention.CreatedAt.UTC()
+	retention.UpdatedAt = retention.UpdatedAt.UTC()
+	return retention, nil
+}
+
+// GetHostReportRetention returns the organization's host report retention
+func (ps *PostgresStorage) GetHostReportRetention(orgID string) (*models.HostReportRetention, error) {
+	retention, err := scanHostReportRetention(ps.db.QueryRow(`
+		SELECT `+hostReportRetentionColumns+`
+		FROM org_host_report_retention
+		WHERE org_id = $1
+	`, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host report retention: %w", classifyError(err))
+	}
+	return retention, nil
+}
+
+// SetHostReportRetention creates or replaces the organization's host report retention
+func (ps *PostgresStorage) SetHostReportRetention(retention *models.HostReportRetention) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_host_report_retention", retention.OrgID, retention.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_host_report_retention AS r (org_id, reports_per_host, delete_hosts_unseen_days, updated_by_user_id)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+		ON CONFLICT (org_id) DO UPDATE SET
+			reports_per_host = EXCLUDED.reports_per_host,
+			delete_hosts_unseen_days = EXCLUDED.delete_hosts_unseen_days,
+			updated_by_user_id = EXCLUDED.updated_by_user_id,
+			version = r.version + 1,
+			updated_at = NOW()
+		RETURNING version, created_at, updated_at
+	`, retention.OrgID, retention.ReportsPerHost, retention.DeleteHostsUnseenDays, retention.UpdatedByUserID)
+	if err := row.Scan(&retention.Version, &retention.CreatedAt, &retention.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set host report retention: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host report retention: %w", err)
+	}
+	retention.CreatedAt = retention.CreatedAt.UTC()
+	retention.UpdatedAt = retention.UpdatedAt.UTC()
+	return nil
+}
+
+// DeleteHostReportRetention removes the organization's host report retention
+func (ps *PostgresStorage) DeleteHostReportRetention(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_host_report_retention WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete host report retention: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_host_report_retention", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// excessHostReports selects the reports past the $2 newest of each of organization $1's hosts
+const excessHostReports = `
+	SELECT id FROM (
+		SELECT id, ROW_NUMBER() OVER (PARTITION BY host_id ORDER BY received_at DESC, id DESC) AS position
+		FROM host_reports
+		WHERE org_id = $1
+	) ranked
+	WHERE position > $2
+`
+
+// CountExcessHostReports counts the reports PruneHostReports would remove
+func (ps *PostgresStorage) CountExcessHostReports(orgID string, keep int) (int, error) {
+	var count int
+	if err := ps.reader().QueryRow("SELECT COUNT(*) FROM ("+excessHostReports+") excess", orgID, keep).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count host reports: %w", classifyError(err))
+	}
+	return count, nil
+}
+
+// PruneHostReports removes all but the keep newest reports of each of the organization's hosts
+func (ps *PostgresStorage) PruneHostReports(orgID string, keep int) (int, error) {
+	result, err := ps.db.Exec("DELETE FROM host_reports WHERE id IN ("+excessHostReports+")", orgID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune host reports: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(rows), nil
+}
+
+// Fleet report methods
+
+const fleetReportColumns = `id, org_id, kind, title, trigger, COALESCE(requested_by::text, ''), emailed_to, email_error, created_at`
+
+func scanFleetReport(row interface{ Scan(...interface{}) error }, dest ...interface{}) (*models.FleetReport, error) {
+	report := &models.FleetReport{}
+	err := row.Scan(append([]interface{}{&report.ID, &report.OrgID, &report.Kind, &report.Title, &report.Trigger,
+		&report.RequestedBy, pq.Array(&report.EmailedTo), &report.EmailError, &report.CreatedAt}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	report.CreatedAt = report.CreatedAt.UTC()
+	return report, nil
+}
+
+// CreateFleetReport stores a generated report
+func (ps *PostgresStorage) CreateFleetReport(report *models.FleetReport) error {
+	content, err := json.Marshal(report.Content)
+	if err != nil {
+		return fmt.Errorf("failed to encode report content: %w", err)
+	}
+	err = ps.db.QueryRow(`
+		INSERT INTO fleet_reports (id, org_id, kind, title, trigger, requested_by, content, emailed_to, email_error)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, $7, COALESCE($8::text[], '{}'), $9)
+		RETURNING created_at
+	`, report.ID, report.OrgID, report.Kind, report.Title, report.Trigger, report.RequestedBy, content,
+		pq.Array(report.EmailedTo), report.EmailError).Scan(&report.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create fleet report: %w", classifyError(err))
+	}
+	report.CreatedAt = report.CreatedAt.UTC()
+	return nil
+}
+
+// GetFleetReport returns a report of the organization with its content
+func (ps *PostgresStorage) GetFleetReport(reportID, orgID string) (*models.FleetReport, error) {
+	var content []byte
+	report, err := scanFleetReport(ps.db.QueryRow(`
+		SELECT `+fleetReportColumns+`, content
+		FROM fleet_reports
+		WHERE id = $1 AND org_id = $2
+	`, reportID, orgID), &content)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fleet report: %w", classifyError(err))
+	}
+	if err := json.Unmarshal(content, &report.Content); err != nil {
+		return nil, fmt.Errorf("failed to decode report content: %w", err)
+	}
+	return report, nil
+}
+
+// ListFleetReports returns the organization's most recent reports without their content
+func (ps *PostgresStorage) ListFleetReports(orgID string, limit int) ([]*models.FleetReport, error) {
+	rows, err := ps.reader().Query(`
+		SELECT `+fleetReportColumns+`
+		FROM fleet_reports
+		WHERE org_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2
+	`, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fleet reports: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	reports := []*models.FleetReport{}
+	for rows.Next() {
+		report, err := scanFleetReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fleet report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list fleet reports: %w", classifyError(err))
+	}
+	return reports, nil
+}
+
+// Report schedule methods
+
+const reportScheduleColumns = `org_id, kinds, frequency, email, next_run_at, last_run_at, updated_by_user_id, version, created_at, updated_at`
+
+func scanReportSchedule(row interface{ Scan(...interface{}) error }) (*models.ReportSchedule, error) {
+	schedule := &models.ReportSchedule{}
+	var lastRunAt sql.NullTime
+	var updatedBy sql.NullString
+	if err := row.Scan(&schedule.OrgID, pq.Array(&schedule.Kinds), &schedule.Frequency, &schedule.Email,
+		&schedule.NextRunAt, &lastRunAt, &updatedBy, &schedule.Version, &schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	schedule.NextRunAt = schedule.NextRunAt.UTC()
+	if lastRunAt.Valid {
+		t := lastRunAt.Time.UTC()
+		schedule.LastRunAt = &t
+	}
+	schedule.UpdatedByUserID = updatedBy.String
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	schedule.UpdatedAt = schedule.UpdatedAt.UTC()
+	return schedule, nil
+}
+
+// GetReportSchedule returns the organization's report schedule
+func (ps *PostgresStorage) GetReportSchedule(orgID string) (*models.ReportSchedule, error) {
+	schedule, err := scanReportSchedule(ps.db.QueryRow(`
+		SELECT `+reportScheduleColumns+`
+		FROM org_report_schedules
+		WHERE org_id = $1
+	`, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report schedule: %w", classifyError(err))
+	}
+	return schedule, nil
+}
+
+// SetReportSchedule creates or replaces the organization's report schedule
+// The last run is kept when a schedule is replaced.
+func (ps *PostgresStorage) SetReportSchedule(schedule *models.ReportSchedule) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSettingVersion(tx, "org_report_schedules", schedule.OrgID, schedule.Version); err != nil {
+		return err
+	}
+	row := tx.QueryRow(`
+		INSERT INTO org_report_schedules AS s (org_id, kinds, frequency, email, next_run_at, updated_by_user_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid)
+		ON CONFLICT (org_id) DO UPDATE SET
+			kinds = EXCLUDED.kinds,
+			frequency = EXCLUDED.frequency,
+			email = EXCLUDED.email,
+			next_run_at = EXCLUDED.next_run_at,
+			updated_by_user_id = EXCLUDED.updated_by_user_id,
+			version = s.version + 1,
+			updated_at = NOW()
+		RETURNING `+reportScheduleColumns,
+		schedule.OrgID, pq.Array(schedule.Kinds), schedule.Frequency, schedule.Email, schedule.NextRunAt, schedule.UpdatedByUserID)
+	saved, err := scanReportSchedule(row)
+	if err != nil {
+		return fmt.Errorf("failed to set report schedule: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit report schedule: %w", err)
+	}
+	*schedule = *saved
+	return nil
+}
+
+// DeleteReportSchedule removes the organization's report schedule
+func (ps *PostgresStorage) DeleteReportSchedule(orgID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM org_report_schedules WHERE org_id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", orgID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete report schedule: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ps.missingOrChanged("org_report_schedules", "org_id", orgID, ifVersion)
+	}
+	return nil
+}
+
+// ClaimReportSchedules returns the schedules due at now and advances them
+// Rows locked by another instance are skipped, so each run is claimed once.
+func (ps *PostgresStorage) ClaimReportSchedules(now time.Time) ([]*models.ReportSchedule, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+reportScheduleColumns+`
+		FROM org_report_schedules
+		WHERE next_run_at <= $1
+		ORDER BY org_id
+		FOR UPDATE SKIP LOCKED
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim report schedules: %w", classifyError(err))
+	}
+	schedules := []*models.ReportSchedule{}
+	for rows.Next() {
+		schedule, err := scanReportSchedule(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan report schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim report schedules: %w", classifyError(err))
+	}
+
+	for _, schedule := range schedules {
+		schedule.Advance(now)
+		_, err := tx.Exec(`UPDATE org_report_schedules SET next_run_at = $2, last_run_at = $3 WHERE org_id = $1`,
+			schedule.OrgID, schedule.NextRunAt, schedule.LastRunAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to advance report schedule: %w", classifyError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to claim report schedules: %w", classifyError(err))
+	}
+	return schedules, nil
+}
+
+// Delegated token (OAuth client) methods
+
+const oauthClientColumns = `id, org_id, name, redirect_uris, scopes, public, secret_hash, created_by, created_at`
+
+func scanOAuthClient(row interface{ Scan(...interface{}) error }) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	var createdBy sql.NullString
+
+	err := row.Scan(&client.ID, &client.OrgID, &client.Name, pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes),
+		&client.Public, &client.SecretHash, &createdBy, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	client.CreatedByUserID = createdBy.String
+	client.CreatedAt = client.CreatedAt.UTC()
+	return client, nil
+}
+
+// CreateOAuthClient stores a client under its ID
+func (ps *PostgresStorage) CreateOAuthClient(client *models.OAuthClient) error {
+	var createdBy interface{}
+	if client.CreatedByUserID != "" {
+		createdBy = client.CreatedByUserID
+	}
+
+	err := ps.db.QueryRow(`
+		INSERT INTO oauth_clients (id, org_id, name, redirect_uris, scopes, public, secret_hash, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at
+	`, client.ID, client.OrgID, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes),
+		client.Public, client.SecretHash, createdBy).Scan(&client.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth client: %w", classifyError(err))
+	}
+	client.CreatedAt = client.CreatedAt.UTC()
+	return nil
+}
+
+// ListOAuthClients returns the organization's clients, oldest first
+func (ps *PostgresStorage) ListOAuthClients(orgID string) ([]*models.OAuthClient, error) {
+	rows, err := ps.db.Query(`SELECT `+oauthClientColumns+` FROM oauth_clients WHERE org_id = $1 ORDER BY created_at, id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	clients := []*models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan OAuth client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+	return clients, nil
+}
+
+// GetOAuthClient retrieves a client by ID
+func (ps *PostgresStorage) GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	client, err := scanOAuthClient(ps.db.QueryRow(`SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id = $1`, clientID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth client: %w", classifyError(err))
+	}
+	return client, nil
+}
+
+// DeleteOAuthClient removes a client; its codes and grants are removed by cascade
+func (ps *PostgresStorage) DeleteOAuthClient(clientID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM oauth_clients WHERE id = $1 AND org_id = $2", clientID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete OAuth client: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateOAuthCode stores an authorization code and drops expired ones
+func (ps *PostgresStorage) CreateOAuthCode(code *models.OAuthCode) error {
+	if _, err := ps.db.Exec("DELETE FROM oauth_codes WHERE expires_at < NOW()"); err != nil {
+		return fmt.Errorf("failed to delete expired OAuth codes: %w", classifyError(err))
+	}
+	_, err := ps.db.Exec(`
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, org_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, code.CodeHash, code.ClientID, code.UserID, code.OrgID, code.RedirectURI, pq.Array(code.Scopes),
+		code.CodeChallenge, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth code: %w", classifyError(err))
+	}
+	return nil
+}
+
+// ConsumeOAuthCode deletes and returns an unexpired authorization code
+// Deleting in the same statement makes each code usable exactly once.
+func (ps *PostgresStorage) ConsumeOAuthCode(codeHash string, now time.Time) (*models.OAuthCode, error) {
+	code := &models.OAuthCode{}
+	err := ps.db.QueryRow(`
+		DELETE FROM oauth_codes WHERE code_hash = $1
+		RETURNING code_hash, client_id, user_id, org_id, redirect_uri, scopes, code_challenge, expires_at
+	`, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.OrgID, &code.RedirectURI,
+		pq.Array(&code.Scopes), &code.CodeChallenge, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume OAuth code: %w", classifyError(err))
+	}
+	if !code.ExpiresAt.After(now) {
+		return nil, ErrNotFound
+	}
+	code.ExpiresAt = code.ExpiresAt.UTC()
+	return code, nil
+}
+
+// CreateOAuthGrant stores a grant with its token pair
+func (ps *PostgresStorage) CreateOAuthGrant(grant *models.OAuthGrant) error {
+	err := ps.db.QueryRow(`
+		WITH grant_row AS (
+			INSERT INTO oauth_grants (id, client_id, user_id, org_id, scopes, access_hash, refresh_hash, access_expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING client_id, created_at
+		)
+		SELECT c.name, g.created_at FROM grant_row g JOIN oauth_clients c ON c.id = g.client_id
+	`, grant.ID, grant.ClientID, grant.UserID, grant.OrgID, pq.Array(grant.Scopes), grant.Token.AccessHash,
+		grant.Token.RefreshHash, grant.Token.ExpiresAt).Scan(&grant.ClientName, &grant.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OAuth grant: %w", classifyError(err))
+	}
+	grant.CreatedAt = grant.CreatedAt.UTC()
+	return nil
+}
+
+const oauthGrantColumns = `g.id, g.client_id, c.name, g.user_id, g.org_id, g.scopes, g.access_hash, g.refresh_hash,
+	g.access_expires_at, g.last_used_at, g.created_at`
+
+func scanOAuthGrant(row interface{ Scan(...interface{}) error }) (*models.OAuthGrant, error) {
+	grant := &models.OAuthGrant{}
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(&grant.ID, &grant.ClientID, &grant.ClientName, &grant.UserID, &grant.OrgID, pq.Array(&grant.Scopes),
+		&grant.Token.AccessHash, &grant.Token.RefreshHash, &grant.Token.ExpiresAt, &lastUsedAt, &grant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time.UTC()
+		grant.LastUsedAt = &t
+	}
+	grant.Token.ExpiresAt = grant.Token.ExpiresAt.UTC()
+	grant.CreatedAt = grant.CreatedAt.UTC()
+	return grant, nil
+}
+
+// RotateOAuthToken replaces the token pair holding the refresh token
+// The old refresh token stops working as soon as the new pair is stored.
+func (ps *PostgresStorage) RotateOAuthToken(clientID, refreshHash string, token models.OAuthToken) (*models.OAuthGrant, error) {
+	grant, err := scanOAuthGrant(ps.db.QueryRow(`
+		WITH g AS (
+			UPDATE oauth_grants SET access_hash = $3, refresh_hash = $4, access_expires_at = $5
+			WHERE client_id = $1 AND refresh_hash = $2
+			RETURNING *
+		)
+		SELECT `+oauthGrantColumns+` FROM g JOIN oauth_clients c ON c.id = g.client_id
+	`, clientID, refreshHash, token.AccessHash, token.RefreshHash, token.ExpiresAt))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate OAuth token: %w", classifyError(err))
+	}
+	return grant, nil
+}
+
+// GetOAuthGrantByAccessToken returns the grant holding an unexpired access token
+func (ps *PostgresStorage) GetOAuthGrantByAccessToken(accessHash string, now time.Time) (*models.OAuthGrant, error) {
+	grant, err := scanOAuthGrant(ps.db.QueryRow(`
+		SELECT `+oauthGrantColumns+`
+		FROM oauth_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.access_hash = $1 AND g.access_expires_at > $2
+	`, accessHash, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth grant: %w", classifyError(err))
+	}
+	return grant, nil
+}
+
+// UpdateOAuthGrantLastUsed records that a grant's access token was used
+func (ps *PostgresStorage) UpdateOAuthGrantLastUsed(grantID string) error {
+	if _, err := ps.db.Exec("UPDATE oauth_grants SET last_used_at = NOW() WHERE id = $1", grantID); err != nil {
+		return fmt.Errorf("failed to update OAuth grant last used: %w", classifyError(err))
+	}
+	return nil
+}
+
+// ListOAuthGrants returns the user's grants, newest first
+func (ps *PostgresStorage) ListOAuthGrants(userID string) ([]*models.OAuthGrant, error) {
+	rows, err := ps.db.Query(`
+		SELECT `+oauthGrantColumns+`
+		FROM oauth_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.user_id = $1
+		ORDER BY g.created_at DESC, g.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth grants: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	grants := []*models.OAuthGrant{}
+	for rows.Next() {
+		grant, err := scanOAuthGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan OAuth grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list OAuth grants: %w", err)
+	}
+	return grants, nil
+}
+
+// DeleteOAuthGrant revokes one of the user's grants
+func (ps *PostgresStorage) DeleteOAuthGrant(grantID, userID string) error {
+	result, err := ps.db.Exec("DELETE FROM oauth_grants WHERE id = $1 AND user_id = $2", grantID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete OAuth grant: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeOAuthToken deletes the client's grant holding the access or refresh token
+func (ps *PostgresStorage) RevokeOAuthToken(clientID, tokenHash string) error {
+	_, err := ps.db.Exec(`
+		DELETE FROM oauth_grants WHERE client_id = $1 AND (access_hash = $2 OR refresh_hash = $2)
+	`, clientID, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke OAuth token: %w", classifyError(err))
+	}
+	return nil
+}
+
+// Session methods
+
+// CreateSession stores a session with its token pair and drops the user's expired sessions
+func (ps *PostgresStorage) CreateSession(session *models.Session) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = $1 AND expires_at <= NOW()", session.UserID); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", classifyError(err))
+	}
+	err = tx.QueryRow(`
+		INSERT INTO sessions (id, user_id, org_id, access_hash, refresh_hash, access_expires_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, session.ID, session.UserID, session.OrgID, session.Token.AccessHash, session.Token.RefreshHash,
+		session.Token.ExpiresAt, session.ExpiresAt).Scan(&session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+	session.CreatedAt = session.CreatedAt.UTC()
+	return nil
+}
+
+const sessionColumns = `id, user_id, org_id, access_hash, refresh_hash, access_expires_at, expires_at, last_used_at, created_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	session := &models.Session{}
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(&session.ID, &session.UserID, &session.OrgID, &session.Token.AccessHash, &session.Token.RefreshHash,
+		&session.Token.ExpiresAt, &session.ExpiresAt, &lastUsedAt, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time.UTC()
+		session.LastUsedAt = &t
+	}
+	session.Token.ExpiresAt = session.Token.ExpiresAt.UTC()
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	session.CreatedAt = session.CreatedAt.UTC()
+	return session, nil
+}
+
+// RotateSessionToken replaces the token pair holding the refresh token
+// The old tokens stop working as soon as the new pair is stored.
+func (ps *PostgresStorage) RotateSessionToken(refreshHash string, token models.SessionToken, now time.Time) (*models.Session, error) {
+	session, err := scanSession(ps.db.QueryRow(`
+		UPDATE sessions SET access_hash = $2, refresh_hash = $3, access_expires_at = $4
+		WHERE refresh_hash = $1 AND expires_at > $5
+		RETURNING `+sessionColumns,
+		refreshHash, token.AccessHash, token.RefreshHash, token.ExpiresAt, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate session token: %w", classifyError(err))
+	}
+	return session, nil
+}
+
+// GetSessionByAccessToken returns the session holding an unexpired access token
+func (ps *PostgresStorage) GetSessionByAccessToken(accessHash string, now time.Time) (*models.Session, error) {
+	session, err := scanSession(ps.db.QueryRow(`
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE access_hash = $1 AND access_expires_at > $2
+	`, accessHash, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", classifyError(err))
+	}
+	return session, nil
+}
+
+// UpdateSessionLastUsed records that a session's access token was used
+func (ps *PostgresStorage) UpdateSessionLastUsed(sessionID string) error {
+	if _, err := ps.db.Exec("UPDATE sessions SET last_used_at = NOW() WHERE id = $1", sessionID); err != nil {
+		return fmt.Errorf("failed to update session last used: %w", classifyError(err))
+	}
+	return nil
+}
+
+// DeleteSession ends one of the user's sessions
+func (ps *PostgresStorage) DeleteSession(sessionID, userID string) error {
+	result, err := ps.db.Exec("DELETE FROM sessions WHERE id = $1 AND user_id = $2", sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Organization methods
+
+// CreateOrganization creates a new organization
+// Returns ErrOrgNameTaken if an organization has the same name, ignoring case
+func (ps *PostgresStorage) CreateOrganization(name string) (*models.Organization, error) {
+	query := `
+		INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id, name, created_at, updated_at
+	`
+
+	org := &models.Organization{}
+	err := ps.db.QueryRow(query, name).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", classifyError(err))
+	}
+
+	return org, nil
+}
+
+// GetOrganizationByID retrieves an organization by ID
+func (ps *PostgresStorage) GetOrganizationByID(orgID string) (*models.Organization, error) {
+	query := `
+		SELECT id, name, created_at, updated_at
+		FROM organizations
+		WHERE id = $1
+	`
+
+	org := &models.Organization{}
+	err := ps.db.QueryRow(query, orgID).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", classifyError(err))
+	}
+
+	return org, nil
+}
+
+// GetOrganizationByName retrieves an organization by name, ignoring case
+func (ps *PostgresStorage) GetOrganizationByName(name string) (*models.Organization, error) {
+	query := `
+		SELECT id, name, created_at, updated_at
+		FROM organizations
+		WHERE lower(name) = lower($1)
+	`
+
+	org := &models.Organization{}
+	err := ps.db.QueryRow(query, name).Scan(
+		&org.ID,
+		&org.Name,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", classifyError(err))
+	}
+
+	return org, nil
+}
+
+// CountUsersInOrganization counts the number of users in an organization
+func (ps *PostgresStorage) CountUsersInOrganization(orgID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM users
+		WHERE org_id = $1
+	`
+
+	var count int
+	err := ps.db.QueryRow(query, orgID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users in organization: %w", classifyError(err))
+	}
+
+	return count, nil
+}
+
+// GetOrgStorageUsage returns the rows and bytes the organization's hosts and host events occupy
+// Sizes come from pg_column_size, so they reflect TOAST compression but not indexes
+func (ps *PostgresStorage) GetOrgStorageUsage(orgID string) (*models.OrgStorageUsage, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM hosts WHERE org_id = $1),
+			(SELECT COALESCE(SUM(pg_column_size(h.*)), 0) FROM hosts h WHERE h.org_id = $1),
+			(SELECT COUNT(*) FROM host_events WHERE org_id = $1),
+			(SELECT COALESCE(SUM(pg_column_size(e.*)), 0) FROM host_events e WHERE e.org_id = $1)
+	`
+
+	usage := &models.OrgStorageUsage{}
+	err := ps.db.QueryRow(query, orgID).Scan(
+		&usage.Hosts,
+		&usage.HostBytes,
+		&usage.HostEvents,
+		&usage.HostEventBytes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization storage usage: %w", classifyError(err))
+	}
+	usage.TotalBytes = usage.HostBytes + usage.HostEventBytes
+
+	return usage, nil
+}
+
+// RegisterUser atomically creates a new organization and its first admin user
+// Concurrent registrations for the same organization name (ignoring case) are serialized
+// with a transaction-scoped advisory lock so that only one of them can claim the name;
+// the unique index on lower(name) catches organizations created outside registration.
+func (ps *PostgresStorage) RegisterUser(orgName, username, email, passwordHash string) (*models.User, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "register:"+strings.ToLower(orgName)); err != nil {
+		return nil, fmt.Errorf("failed to acquire registration lock: %w", err)
+	}
+
+	var usernameTaken, emailTaken bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS(SELECT 1 FROM users WHERE username = $1),
+			EXISTS(SELECT 1 FROM users WHERE email = $2)
+	`, username, email).Scan(&usernameTaken, &emailTaken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing users: %w", err)
+	}
+	if usernameTaken {
+		return nil, ErrUsernameTaken
+	}
+	if emailTaken {
+		return nil, ErrEmailTaken
+	}
+
+	var userCount int
+	err = tx.QueryRow(`
+		SELECT COUNT(u.id)
+		FROM organizations o
+		LEFT JOIN users u ON u.org_id = o.id
+		WHERE lower(o.name) = lower($1)
+		GROUP BY o.id
+		LIMIT 1
+	`, orgName).Scan(&userCount)
+	if err == nil {
+		if userCount > 0 {
+			return nil, ErrOrgHasUsers
+		}
+		return nil, ErrOrgNameTaken
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check organization: %w", err)
+	}
+
+	var orgID string
+	err = tx.QueryRow(`INSERT INTO organizations (name) VALUES ($1) RETURNING id`, orgName).Scan(&orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", classifyError(err))
+	}
 
 	user := &models.User{}
-	err := ps.db.QueryRow(query, email).Scan(
+	err = tx.QueryRow(`
+		INSERT INTO users (username, email, password_hash, org_id, role)
+		VALUES ($1, $2, $3, $4, 'admin')
+		RETURNING id, username, email, is_active, is_admin, org_id, role, version, created_at, updated_at
+	`, username, email, passwordHash, orgID).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -389,307 +4750,1248 @@ func (ps *PostgresStorage) GetUserByEmail(email string) (*models.User, error) {
 		&user.IsAdmin,
 		&user.OrgID,
 		&user.Role,
+		&user.Version,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	if err != nil {
+		// A concurrent registration for a different organization may have
+		// claimed the username or email after our existence check; classifyError
+		// reports that as ErrUsernameTaken or ErrEmailTaken
+		return nil, fmt.Errorf("failed to create user: %w", classifyError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit registration: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsersByOrganization lists all users in an organization
+func (ps *PostgresStorage) ListUsersByOrganization(orgID string) ([]*models.User, error) {
+	query := `
+		SELECT id, username, email, is_active, is_admin, org_id, role, version, created_at, updated_at
+		FROM users
+		WHERE org_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := ps.db.Query(query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.IsActive,
+			&user.IsAdmin,
+			&user.OrgID,
+			&user.Role,
+			&user.Version,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// UpdateUserRole updates a user's role
+func (ps *PostgresStorage) UpdateUserRole(userID, role string, ifVersion int64) error {
+	query := `
+		UPDATE users
+		SET role = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND ($3::bigint = 0 OR version = $3::bigint)
+	`
+
+	result, err := ps.db.Exec(query, role, userID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ps.missingOrChanged("users", "id", userID, ifVersion)
+	}
+
+	return nil
+}
+
+// missingOrChanged explains a conditional write to table that matched no row: ErrVersionMismatch
+// if the row keyed by column = key exists and a version was expected, ErrNotFound otherwise
+func (ps *PostgresStorage) missingOrChanged(table, column, key string, ifVersion int64) error {
+	if ifVersion == 0 {
+		return ErrNotFound
+	}
+	var exists bool
+	err := ps.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+table+` WHERE `+column+` = $1)`, key).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", table, classifyError(err))
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
+// SetUserSystemAdmin grants or revokes the system-wide admin flag
+func (ps *PostgresStorage) SetUserSystemAdmin(userID string, isAdmin bool) error {
+	result, err := ps.db.Exec(`UPDATE users SET is_admin = $1, version = version + 1, updated_at = NOW() WHERE id = $2`, isAdmin, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user admin flag: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser deletes a user by ID
+func (ps *PostgresStorage) DeleteUser(userID string, ifVersion int64) error {
+	result, err := ps.db.Exec("DELETE FROM users WHERE id = $1 AND ($2::bigint = 0 OR version = $2::bigint)", userID, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ps.missingOrChanged("users", "id", userID, ifVersion)
+	}
+
+	return nil
+}
+
+// Organization membership methods
+
+// orgMembershipsQuery selects users' own organizations (home) and their memberships of
+// others; callers append a WHERE clause on ms
+const orgMembershipsQuery = `
+	WITH ms AS (
+		SELECT u.org_id, u.id AS user_id, u.role::text AS role, TRUE AS home, u.created_at FROM users u
+		UNION ALL
+		SELECT m.org_id, m.user_id, m.role::text, FALSE, m.created_at FROM user_org_memberships m
+	)
+	SELECT ms.org_id, o.name, ms.user_id, u.username, ms.role, ms.home, ms.created_at
+	FROM ms
+	JOIN organizations o ON o.id = ms.org_id
+	JOIN users u ON u.id = ms.user_id
+`
+
+// queryOrgMemberships runs orgMembershipsQuery followed by where
+func (ps *PostgresStorage) queryOrgMemberships(where string, args ...interface{}) ([]*models.OrgMembership, error) {
+	rows, err := ps.db.Query(orgMembershipsQuery+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization memberships: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	memberships := []*models.OrgMembership{}
+	for rows.Next() {
+		m := &models.OrgMembership{}
+		if err := rows.Scan(&m.OrgID, &m.OrgName, &m.UserID, &m.Username, &m.Role, &m.Home, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization membership: %w", err)
+		}
+		memberships = append(memberships, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organization memberships: %w", classifyError(err))
+	}
+	return memberships, nil
+}
+
+// AddOrgMembership makes a user a member of an organization other than its own
+func (ps *PostgresStorage) AddOrgMembership(userID, orgID, role string) (*models.OrgMembership, error) {
+	query := `
+		INSERT INTO user_org_memberships (user_id, org_id, role)
+		SELECT id, $2, $3 FROM users WHERE id = $1 AND org_id <> $2
+	`
+
+	result, err := ps.db.Exec(query, userID, orgID, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add organization membership: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		// Either the user does not exist or orgID is its own organization
+		if _, err := ps.GetUserByID(userID); err != nil {
+			return nil, err
+		}
+		return nil, ErrAlreadyMember
+	}
+
+	return ps.GetOrgMembership(userID, orgID)
+}
+
+// UpdateOrgMembershipRole changes a user's role in an organization it is a member of
+func (ps *PostgresStorage) UpdateOrgMembershipRole(userID, orgID, role string) error {
+	result, err := ps.db.Exec(
+		"UPDATE user_org_memberships SET role = $3, updated_at = NOW() WHERE user_id = $1 AND org_id = $2",
+		userID, orgID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update organization membership: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteOrgMembership removes a user from an organization it is a member of
+func (ps *PostgresStorage) DeleteOrgMembership(userID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM user_org_memberships WHERE user_id = $1 AND org_id = $2", userID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization membership: %w", classifyError(err))
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetOrgMembership returns the user's role in an organization, its own or one it is a member of
+func (ps *PostgresStorage) GetOrgMembership(userID, orgID string) (*models.OrgMembership, error) {
+	memberships, err := ps.queryOrgMemberships("WHERE ms.user_id = $1 AND ms.org_id = $2", userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, ErrNotFound
+	}
+	return memberships[0], nil
+}
+
+// ListUserOrgMemberships lists the organizations a user can act in, its own first
+func (ps *PostgresStorage) ListUserOrgMemberships(userID string) ([]*models.OrgMembership, error) {
+	return ps.queryOrgMemberships("WHERE ms.user_id = $1 ORDER BY ms.home DESC, lower(o.name)", userID)
+}
+
+// ListOrgMembers lists the users of other organizations that are members of orgID
+func (ps *PostgresStorage) ListOrgMembers(orgID string) ([]*models.OrgMembership, error) {
+	return ps.queryOrgMemberships("WHERE ms.org_id = $1 AND NOT ms.home ORDER BY u.username", orgID)
+}
+
+// Host tag methods
+
+// SetHostTags replaces all tags on a host
+// Verifies that the host belongs to the specified organization
+func (ps *PostgresStorage) SetHostTags(hostID, orgID string, tags []string, actorUserID string, ifVersion int64) error {
+	return ps.mutateHost(hostID, orgID, func(tx dbConn, hostname string) error {
+		if ifVersion != 0 {
+			var version int64
+			err := tx.QueryRow("SELECT metadata_version FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).Scan(&version)
+			if err != nil {
+				return fmt.Errorf("failed to get host metadata version: %w", classifyError(err))
+			}
+			if version != ifVersion {
+				return ErrVersionMismatch
+			}
+		}
+		return appendHostEvent(tx, &models.HostEvent{
+			OrgID:       orgID,
+			HostID:      hostID,
+			Hostname:    hostname,
+			Type:        models.HostEventTagged,
+			ActorUserID: actorUserID,
+			Payload:     &models.HostEventPayload{Tags: tags},
+		})
+	})
+}
+
+// GetHostMetadataVersion returns the version of a host's tags and details
+func (ps *PostgresStorage) GetHostMetadataVersion(hostID, orgID string) (int64, error) {
+	var version int64
+	err := ps.db.QueryRow("SELECT metadata_version FROM hosts WHERE host_id = $1 AND org_id = $2", hostID, orgID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get host metadata version: %w", classifyError(err))
+	}
+	return version, nil
+}
+
+// GetHostTags returns the tags attached to a host
+// Returns ErrNotFound if the host does not belong to the specified organization
+func (ps *PostgresStorage) GetHostTags(hostID, orgID string) ([]string, error) {
+	query := `
+		SELECT COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM host_tags t WHERE t.org_id = h.org_id AND t.host_id = h.host_id), '{}')
+		FROM hosts h
+		WHERE h.host_id = $1 AND h.org_id = $2
+	`
+
+	var tags []string
+	err := ps.db.QueryRow(query, hostID, orgID).Scan(pq.Array(&tags))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host tags: %w", classifyError(err))
+	}
+
+	return tags, nil
+}
+
+// GetHostFacets reads the pre-aggregated facet counters maintained by the host triggers
+func (ps *PostgresStorage) GetHostFacets(orgID string) (*models.HostFacets, error) {
+	query := `
+		SELECT facet, value, count
+		FROM host_facet_counts
+		WHERE org_id = $1 AND count > 0
+		ORDER BY facet, count DESC, value
+	`
+
+	rows, err := ps.reader().Query(query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host facets: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	facets := &models.HostFacets{
+		OSNames:   []models.FacetCount{},
+		OSVersion: []models.FacetCount{},
+		Tags:      []models.FacetCount{},
+	}
+	for rows.Next() {
+		var facet string
+		var fc models.FacetCount
+		if err := rows.Scan(&facet, &fc.Value, &fc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan host facet: %w", err)
+		}
+
+		switch facet {
+		case FacetTotal:
+			facets.Total = fc.Count
+		case FacetOSName:
+			facets.OSNames = append(facets.OSNames, fc)
+		case FacetOSVersion:
+			facets.OSVersion = append(facets.OSVersion, fc)
+		case FacetTag:
+			facets.Tags = append(facets.Tags, fc)
+		}
+	}
+
+	return facets, rows.Err()
+}
+
+// Host access policy methods
+
+// GetHostAccessTags returns the tags a user is restricted to in an organization (empty means unrestricted)
+func (ps *PostgresStorage) GetHostAccessTags(userID, orgID string) ([]string, error) {
+	rows, err := ps.db.Query(
+		"SELECT tag FROM host_access_policies WHERE user_id = $1 AND org_id = $2 ORDER BY tag",
+		userID, orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query host access policies: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan host access policy: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// SetHostAccessTags replaces the tags a user is restricted to in an organization
+func (ps *PostgresStorage) SetHostAccessTags(userID, orgID string, tags []string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM host_access_policies WHERE user_id = $1 AND org_id = $2", userID, orgID); err != nil {
+		return fmt.Errorf("failed to clear host access policies: %w", classifyError(err))
+	}
+
+	if len(tags) > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO host_access_policies (user_id, org_id, tag)
+			SELECT $1, $2, unnest($3::text[])
+			ON CONFLICT DO NOTHING
+		`, userID, orgID, pq.Array(tags))
+		if err != nil {
+			return fmt.Errorf("failed to insert host access policies: %w", classifyError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit host access policies: %w", err)
+	}
+
+	return nil
+}
+
+// Impersonation methods
+
+// CreateImpersonationToken stores an impersonation token and drops expired ones
+func (ps *PostgresStorage) CreateImpersonationToken(token *models.ImpersonationToken) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM impersonation_tokens WHERE expires_at <= NOW()"); err != nil {
+		return fmt.Errorf("failed to delete expired impersonation tokens: %w", classifyError(err))
+	}
+	err = tx.QueryRow(`
+		INSERT INTO impersonation_tokens (id, admin_user_id, user_id, org_id, token_hash, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, token.ID, token.AdminUserID, token.UserID, token.OrgID, token.TokenHash, token.Reason, token.ExpiresAt,
+	).Scan(&token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create impersonation token: %w", classifyError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit impersonation token: %w", err)
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	return nil
+}
+
+// GetImpersonationToken returns the unexpired impersonation token with the hash
+func (ps *PostgresStorage) GetImpersonationToken(tokenHash string, now time.Time) (*models.ImpersonationToken, error) {
+	token := &models.ImpersonationToken{}
+	err := ps.db.QueryRow(`
+		SELECT id, admin_user_id, user_id, org_id, token_hash, reason, expires_at, created_at
+		FROM impersonation_tokens
+		WHERE token_hash = $1 AND expires_at > $2
+	`, tokenHash, now).Scan(&token.ID, &token.AdminUserID, &token.UserID, &token.OrgID, &token.TokenHash,
+		&token.Reason, &token.ExpiresAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation token: %w", classifyError(err))
+	}
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.CreatedAt = token.CreatedAt.UTC()
+	return token, nil
+}
+
+// Agent enrollment methods
+
+const enrollmentTokenColumns = `id, org_id, name, token_hash, max_uses, uses, expires_at, created_by_user_id, created_at`
+
+func scanEnrollmentToken(row interface{ Scan(...interface{}) error }) (*models.EnrollmentToken, error) {
+	token := &models.EnrollmentToken{}
+	err := row.Scan(&token.ID, &token.OrgID, &token.Name, &token.TokenHash, &token.MaxUses, &token.Uses,
+		&token.ExpiresAt, &token.CreatedByUserID, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.CreatedAt = token.CreatedAt.UTC()
+	return token, nil
+}
+
+// CreateEnrollmentToken stores an enrollment token under its ID
+func (ps *PostgresStorage) CreateEnrollmentToken(token *models.EnrollmentToken) error {
+	err := ps.db.QueryRow(`
+		INSERT INTO enrollment_tokens (id, org_id, name, token_hash, max_uses, expires_at, created_by_user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING uses, created_at
+	`, token.ID, token.OrgID, token.Name, token.TokenHash, token.MaxUses, token.ExpiresAt, token.CreatedByUserID,
+	).Scan(&token.Uses, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create enrollment token: %w", classifyError(err))
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	return nil
+}
+
+// ListEnrollmentTokens returns the organization's enrollment tokens, newest first
+func (ps *PostgresStorage) ListEnrollmentTokens(orgID string) ([]*models.EnrollmentToken, error) {
+	rows, err := ps.db.Query(`SELECT `+enrollmentTokenColumns+` FROM enrollment_tokens WHERE org_id = $1 ORDER BY created_at DESC, id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list enrollment tokens: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	tokens := []*models.EnrollmentToken{}
+	for rows.Next() {
+		token, err := scanEnrollmentToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan enrollment token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list enrollment tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteEnrollmentToken deletes an enrollment token of the organization
+func (ps *PostgresStorage) DeleteEnrollmentToken(tokenID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM enrollment_tokens WHERE id = $1 AND org_id = $2", tokenID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete enrollment token: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RedeemEnrollmentToken counts a use of an unexpired token that has uses left
+// The check and the count are one statement, so concurrent enrollments cannot overspend it.
+func (ps *PostgresStorage) RedeemEnrollmentToken(tokenHash string, now time.Time) (*models.EnrollmentToken, error) {
+	token, err := scanEnrollmentToken(ps.db.QueryRow(`
+		UPDATE enrollment_tokens SET uses = uses + 1
+		WHERE token_hash = $1 AND expires_at > $2 AND uses < max_uses
+		RETURNING `+enrollmentTokenColumns, tokenHash, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem enrollment token: %w", classifyError(err))
+	}
+	return token, nil
+}
+
+// Database administration methods
+
+// ListDBActivity returns the backends in pg_stat_activity opened by snailbus
+// Backends are matched by application_name, including per-request tagged names
+func (ps *PostgresStorage) ListDBActivity(ctx context.Context) ([]*models.DBActivity, error) {
+	query := `
+		SELECT pid, application_name, COALESCE(state, ''),
+			COALESCE(wait_event_type, ''), COALESCE(wait_event, ''), COALESCE(query, ''),
+			backend_start, query_start,
+			COALESCE(EXTRACT(EPOCH FROM (NOW() - query_start)), 0)::float8
+		FROM pg_stat_activity
+		WHERE datname = current_database()
+			AND (application_name = $1 OR application_name LIKE $1 || '/%')
+			AND pid <> pg_backend_pid()
+		ORDER BY query_start ASC NULLS LAST
+	`
+
+	rows, err := ps.db.QueryContext(ctx, query, ps.appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list database activity: %w", err)
+	}
+	defer rows.Close()
+
+	activity := []*models.DBActivity{}
+	for rows.Next() {
+		a := &models.DBActivity{}
+		var queryStart sql.NullTime
+		if err := rows.Scan(
+			&a.PID,
+			&a.ApplicationName,
+			&a.State,
+			&a.WaitEventType,
+			&a.WaitEvent,
+			&a.Query,
+			&a.BackendStart,
+			&queryStart,
+			&a.DurationSeconds,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan database activity: %w", err)
+		}
+		if queryStart.Valid {
+			a.QueryStart = &queryStart.Time
+		}
+		a.RequestID = strings.TrimPrefix(a.ApplicationName, ps.appName+"/")
+		if a.RequestID == a.ApplicationName {
+			a.RequestID = ""
+		}
+		activity = append(activity, a)
+	}
+
+	return activity, rows.Err()
+}
+
+// CancelDBQuery cancels the running query on a snailbus backend (or terminates the backend)
+// Backends that don't belong to snailbus are reported as ErrNotFound
+func (ps *PostgresStorage) CancelDBQuery(ctx context.Context, pid int, terminate bool) error {
+	query := `
+		SELECT CASE WHEN $2 THEN pg_terminate_backend(pid) ELSE pg_cancel_backend(pid) END
+		FROM pg_stat_activity
+		WHERE pid = $1
+			AND datname = current_database()
+			AND (application_name = $3 OR application_name LIKE $3 || '/%')
+			AND pid <> pg_backend_pid()
+	`
+
+	var signalled bool
+	err := ps.db.QueryRowContext(ctx, query, pid, terminate, ps.appName).Scan(&signalled)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel query: %w", err)
+	}
+	if !signalled {
+		return fmt.Errorf("failed to signal backend %d", pid)
+	}
+
+	return nil
+}
+
+// DatabaseDiagnostics reads the migration state recorded by golang-migrate and the pool statistics
+func (ps *PostgresStorage) DatabaseDiagnostics(ctx context.Context) (*models.DatabaseDiagnostics, error) {
+	diagnostics := &models.DatabaseDiagnostics{
+		Pools: map[string]models.PoolStats{"primary": poolStats(ps.pool.Stats())},
+	}
+	if ps.replica != nil {
+		diagnostics.Pools["replica"] = poolStats(ps.replica.db.Stats())
+	}
+
+	var version int64
+	err := ps.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").
+		Scan(&version, &diagnostics.MigrationDirty)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get migration version: %w", err)
+	}
+	diagnostics.MigrationVersion = uint(version)
+
+	return diagnostics, nil
+}
+
+func poolStats(stats sql.DBStats) models.PoolStats {
+	return models.PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     float64(stats.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+// ListFeatureFlags returns every flag with its organization overrides, by name
+func (ps *PostgresStorage) ListFeatureFlags() ([]*models.FeatureFlag, error) {
+	rows, err := ps.db.Query(`
+		SELECT name, description, enabled, created_at, updated_at
+		FROM feature_flags
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	flags := []*models.FeatureFlag{}
+	byName := make(map[string]*models.FeatureFlag)
+	for rows.Next() {
+		flag := &models.FeatureFlag{Orgs: []models.FeatureFlagOverride{}}
+		if err := rows.Scan(&flag.Name, &flag.Description, &flag.Enabled, &flag.CreatedAt, &flag.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags = append(flags, flag)
+		byName[flag.Name] = flag
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+
+	overrides, err := ps.db.Query(`
+		SELECT flag_name, org_id, enabled, updated_at
+		FROM feature_flag_orgs
+		ORDER BY flag_name, org_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flag overrides: %w", classifyError(err))
+	}
+	defer overrides.Close()
+
+	for overrides.Next() {
+		var name string
+		var override models.FeatureFlagOverride
+		if err := overrides.Scan(&name, &override.OrgID, &override.Enabled, &override.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag override: %w", err)
+		}
+		if flag, ok := byName[name]; ok {
+			flag.Orgs = append(flag.Orgs, override)
+		}
+	}
+	if err := overrides.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list feature flag overrides: %w", err)
+	}
+	return flags, nil
+}
+
+// SetFeatureFlag creates a flag or replaces its description and default
+func (ps *PostgresStorage) SetFeatureFlag(name, description string, enabled bool) (*models.FeatureFlag, error) {
+	flag := &models.FeatureFlag{Name: name, Description: description, Enabled: enabled}
+	err := ps.db.QueryRow(`
+		INSERT INTO feature_flags (name, description, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, name, description, enabled).Scan(&flag.CreatedAt, &flag.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set feature flag: %w", classifyError(err))
+	}
+
+	rows, err := ps.db.Query(`
+		SELECT org_id, enabled, updated_at FROM feature_flag_orgs WHERE flag_name = $1 ORDER BY org_id
+	`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flag overrides: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	flag.Orgs = []models.FeatureFlagOverride{}
+	for rows.Next() {
+		var override models.FeatureFlagOverride
+		if err := rows.Scan(&override.OrgID, &override.Enabled, &override.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag override: %w", err)
+		}
+		flag.Orgs = append(flag.Orgs, override)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list feature flag overrides: %w", err)
+	}
+	return flag, nil
+}
+
+// DeleteFeatureFlag removes a flag and its overrides
+func (ps *PostgresStorage) DeleteFeatureFlag(name string) error {
+	result, err := ps.db.Exec("DELETE FROM feature_flags WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetFeatureFlagOverride enables or disables a flag for one organization
+func (ps *PostgresStorage) SetFeatureFlagOverride(name, orgID string, enabled bool) error {
+	result, err := ps.db.Exec(`
+		INSERT INTO feature_flag_orgs (flag_name, org_id, enabled)
+		SELECT name, $2, $3 FROM feature_flags WHERE name = $1
+		ON CONFLICT (flag_name, org_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			updated_at = NOW()
+	`, name, orgID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set feature flag override: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteFeatureFlagOverride returns the organization to the flag's default
+func (ps *PostgresStorage) DeleteFeatureFlagOverride(name, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM feature_flag_orgs WHERE flag_name = $1 AND org_id = $2", name, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag override: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IOC list methods
+
+// insertIOCIndicators adds indicators to a list
+func insertIOCIndicators(tx dbConn, listID string, indicators []models.IOCIndicator) error {
+	if len(indicators) == 0 {
+		return nil
+	}
+	types := make([]string, len(indicators))
+	values := make([]string, len(indicators))
+	descriptions := make([]string, len(indicators))
+	for i, indicator := range indicators {
+		types[i] = indicator.Type
+		values[i] = indicator.Value
+		descriptions[i] = indicator.Description
+	}
+	_, err := tx.Exec(`
+		INSERT INTO ioc_indicators (list_id, type, value, description)
+		SELECT $1, i.type, i.value, i.description
+		FROM unnest($2::text[], $3::text[], $4::text[]) AS i(type, value, description)
+		ON CONFLICT DO NOTHING
+	`, listID, pq.Array(types), pq.Array(values), pq.Array(descriptions))
+	if err != nil {
+		return fmt.Errorf("failed to insert IOC indicators: %w", classifyError(err))
+	}
+	return nil
+}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+// CreateIOCList stores a list with its indicators
+func (ps *PostgresStorage) CreateIOCList(list *models.IOCList, orgID string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO ioc_lists (id, org_id, name, format, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid)
+		RETURNING created_at, updated_at
+	`, list.ID, orgID, list.Name, list.Format, list.CreatedBy).Scan(&list.CreatedAt, &list.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to create IOC list: %w", classifyError(err))
+	}
+	if err := insertIOCIndicators(tx, list.ID, list.Indicators); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit IOC list: %w", err)
 	}
 
-	return user, nil
+	list.IndicatorCount = len(list.Indicators)
+	list.CreatedAt = list.CreatedAt.UTC()
+	list.UpdatedAt = list.UpdatedAt.UTC()
+	return nil
 }
 
-// CreateAPIKey creates a new API key
-func (ps *PostgresStorage) CreateAPIKey(userID, keyHash, keyPrefix, name string, expiresAt *time.Time) (*models.APIKey, error) {
-	query := `
-		INSERT INTO api_keys (user_id, key_hash, key_prefix, name, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, name, last_used_at, expires_at, created_at
-	`
-
-	apiKey := &models.APIKey{}
-	err := ps.db.QueryRow(query, userID, keyHash, keyPrefix, name, expiresAt).Scan(
-		&apiKey.ID,
-		&apiKey.UserID,
-		&apiKey.Name,
-		&apiKey.LastUsedAt,
-		&apiKey.ExpiresAt,
-		&apiKey.CreatedAt,
-	)
+// ReplaceIOCList replaces a list's name, format, and indicators
+// Matches of indicators the list no longer has are removed.
+func (ps *PostgresStorage) ReplaceIOCList(list *models.IOCList, orgID string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
+	err = tx.QueryRow(`
+		UPDATE ioc_lists SET name = $3, format = $4, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING COALESCE(created_by::text, ''), created_at, updated_at
+	`, list.ID, orgID, list.Name, list.Format).Scan(&list.CreatedBy, &list.CreatedAt, &list.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update IOC list: %w", classifyError(err))
+	}
+	if _, err := tx.Exec("DELETE FROM ioc_indicators WHERE list_id = $1", list.ID); err != nil {
+		return fmt.Errorf("failed to delete IOC indicators: %w", err)
+	}
+	if err := insertIOCIndicators(tx, list.ID, list.Indicators); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM ioc_matches m
+		WHERE m.list_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM ioc_indicators i WHERE i.list_id = m.list_id AND i.type = m.type AND i.value = m.value
+		)
+	`, list.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create API key: %w", err)
+		return fmt.Errorf("failed to delete stale IOC matches: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit IOC list: %w", err)
 	}
 
-	return apiKey, nil
+	list.IndicatorCount = len(list.Indicators)
+	list.CreatedAt = list.CreatedAt.UTC()
+	list.UpdatedAt = list.UpdatedAt.UTC()
+	return nil
 }
 
-// GetAPIKeyByPrefix retrieves API keys by prefix (for efficient lookup)
-func (ps *PostgresStorage) GetAPIKeyByPrefix(keyPrefix string) ([]*models.APIKey, error) {
-	query := `
-		SELECT id, user_id, key_hash, key_prefix, name, last_used_at, expires_at, created_at
-		FROM api_keys
-		WHERE key_prefix = $1
-	`
+// iocListColumns are the ioc_lists columns read by scanIOCList, with the list's indicator count
+const iocListColumns = `l.id, l.name, l.format, COALESCE(l.created_by::text, ''), l.created_at, l.updated_at,
+	(SELECT COUNT(*) FROM ioc_indicators i WHERE i.list_id = l.id)`
+
+func scanIOCList(row interface{ Scan(...interface{}) error }) (*models.IOCList, error) {
+	list := &models.IOCList{}
+	if err := row.Scan(&list.ID, &list.Name, &list.Format, &list.CreatedBy, &list.CreatedAt, &list.UpdatedAt, &list.IndicatorCount); err != nil {
+		return nil, err
+	}
+	list.CreatedAt = list.CreatedAt.UTC()
+	list.UpdatedAt = list.UpdatedAt.UTC()
+	return list, nil
+}
 
-	rows, err := ps.db.Query(query, keyPrefix)
+// ListIOCLists returns the organization's lists without their indicators, by name
+func (ps *PostgresStorage) ListIOCLists(orgID string) ([]*models.IOCList, error) {
+	rows, err := ps.db.Query("SELECT "+iocListColumns+" FROM ioc_lists l WHERE l.org_id = $1 ORDER BY l.name", orgID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query API keys: %w", err)
+		return nil, fmt.Errorf("failed to list IOC lists: %w", classifyError(err))
 	}
 	defer rows.Close()
 
-	var apiKeys []*models.APIKey
+	lists := []*models.IOCList{}
 	for rows.Next() {
-		apiKey := &models.APIKey{}
-		err := rows.Scan(
-			&apiKey.ID,
-			&apiKey.UserID,
-			&apiKey.KeyHash,
-			&apiKey.KeyPrefix,
-			&apiKey.Name,
-			&apiKey.LastUsedAt,
-			&apiKey.ExpiresAt,
-			&apiKey.CreatedAt,
-		)
+		list, err := scanIOCList(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key: %w", err)
+			return nil, fmt.Errorf("failed to scan IOC list: %w", err)
 		}
-		apiKeys = append(apiKeys, apiKey)
+		lists = append(lists, list)
 	}
-
-	return apiKeys, nil
+	return lists, rows.Err()
 }
 
-// GetAPIKeysByUserID retrieves all API keys for a user
-func (ps *PostgresStorage) GetAPIKeysByUserID(userID string) ([]*models.APIKey, error) {
-	query := `
-		SELECT id, user_id, name, last_used_at, expires_at, created_at
-		FROM api_keys
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-	`
+// GetIOCList returns a list of the organization with its indicators
+func (ps *PostgresStorage) GetIOCList(listID, orgID string) (*models.IOCList, error) {
+	list, err := scanIOCList(ps.db.QueryRow("SELECT "+iocListColumns+" FROM ioc_lists l WHERE l.id = $1 AND l.org_id = $2", listID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IOC list: %w", classifyError(err))
+	}
 
-	rows, err := ps.db.Query(query, userID)
+	rows, err := ps.db.Query("SELECT type, value, description FROM ioc_indicators WHERE list_id = $1 ORDER BY type, value", listID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query API keys: %w", err)
+		return nil, fmt.Errorf("failed to get IOC indicators: %w", err)
 	}
 	defer rows.Close()
 
-	var apiKeys []*models.APIKey
+	list.Indicators = []models.IOCIndicator{}
 	for rows.Next() {
-		apiKey := &models.APIKey{}
-		err := rows.Scan(
-			&apiKey.ID,
-			&apiKey.UserID,
-			&apiKey.Name,
-			&apiKey.LastUsedAt,
-			&apiKey.ExpiresAt,
-			&apiKey.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		var indicator models.IOCIndicator
+		if err := rows.Scan(&indicator.Type, &indicator.Value, &indicator.Description); err != nil {
+			return nil, fmt.Errorf("failed to scan IOC indicator: %w", err)
 		}
-		apiKeys = append(apiKeys, apiKey)
+		list.Indicators = append(list.Indicators, indicator)
 	}
-
-	return apiKeys, nil
+	return list, rows.Err()
 }
 
-// DeleteAPIKey deletes an API key
-func (ps *PostgresStorage) DeleteAPIKey(keyID string) error {
-	result, err := ps.db.Exec("DELETE FROM api_keys WHERE id = $1", keyID)
+// DeleteIOCList removes a list with its indicators and matches
+func (ps *PostgresStorage) DeleteIOCList(listID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM ioc_lists WHERE id = $1 AND org_id = $2", listID, orgID)
 	if err != nil {
-		return fmt.Errorf("failed to delete API key: %w", err)
+		return fmt.Errorf("failed to delete IOC list: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
-
-	rows, _ := result.RowsAffected()
 	if rows == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
 
-// UpdateAPIKeyLastUsed updates the last_used_at timestamp for an API key
-func (ps *PostgresStorage) UpdateAPIKeyLastUsed(keyID string) error {
-	_, err := ps.db.Exec(
-		"UPDATE api_keys SET last_used_at = NOW() WHERE id = $1",
-		keyID,
-	)
+// GetIOCIndicators returns every list of the organization with its indicators
+func (ps *PostgresStorage) GetIOCIndicators(orgID string) ([]*models.IOCList, error) {
+	rows, err := ps.db.Query(`
+		SELECT l.id, l.name, i.type, i.value, i.description
+		FROM ioc_lists l
+		JOIN ioc_indicators i ON i.list_id = l.id
+		WHERE l.org_id = $1
+		ORDER BY l.name, l.id
+	`, orgID)
 	if err != nil {
-		return fmt.Errorf("failed to update API key last used: %w", err)
+		return nil, fmt.Errorf("failed to get IOC indicators: %w", classifyError(err))
 	}
-	return nil
-}
-
-// Organization methods
+	defer rows.Close()
 
-// CreateOrganization creates a new organization
-func (ps *PostgresStorage) CreateOrganization(name string) (*models.Organization, error) {
-	query := `
-		INSERT INTO organizations (name)
-		VALUES ($1)
-		RETURNING id, name, created_at, updated_at
-	`
+	lists := []*models.IOCList{}
+	var list *models.IOCList
+	for rows.Next() {
+		var listID, name string
+		var indicator models.IOCIndicator
+		if err := rows.Scan(&listID, &name, &indicator.Type, &indicator.Value, &indicator.Description); err != nil {
+			return nil, fmt.Errorf("failed to scan IOC indicator: %w", err)
+		}
+		if list == nil || list.ID != listID {
+			list = &models.IOCList{ID: listID, Name: name}
+			lists = append(lists, list)
+		}
+		list.Indicators = append(list.Indicators, indicator)
+		list.IndicatorCount++
+	}
+	return lists, rows.Err()
+}
 
-	org := &models.Organization{}
-	err := ps.db.QueryRow(query, name).Scan(
-		&org.ID,
-		&org.Name,
-		&org.CreatedAt,
-		&org.UpdatedAt,
-	)
+// RecordIOCMatches stores the matches found in a host's report and returns the new ones
+// Matches of lists deleted in the meantime are dropped.
+func (ps *PostgresStorage) RecordIOCMatches(orgID, hostID string, matches []models.IOCMatch, seenAt time.Time) ([]models.IOCMatch, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	listIDs := make([]string, len(matches))
+	types := make([]string, len(matches))
+	values := make([]string, len(matches))
+	paths := make([]string, len(matches))
+	for i, match := range matches {
+		listIDs[i] = match.ListID
+		types[i] = match.Type
+		values[i] = match.Value
+		paths[i] = match.Path
+	}
 
+	// xmax is 0 for rows the statement inserted rather than updated
+	rows, err := ps.db.Query(`
+		INSERT INTO ioc_matches (list_id, host_id, org_id, type, value, path, first_seen_at, last_seen_at)
+		SELECT m.list_id, $1, $2, m.type, m.value, m.path, $3, $3
+		FROM unnest($4::uuid[], $5::text[], $6::text[], $7::text[]) AS m(list_id, type, value, path)
+		JOIN ioc_lists l ON l.id = m.list_id AND l.org_id = $2
+		ON CONFLICT (list_id, org_id, host_id, type, value) DO UPDATE SET
+			path = EXCLUDED.path,
+			last_seen_at = GREATEST(ioc_matches.last_seen_at, EXCLUDED.last_seen_at)
+		RETURNING list_id, type, value, xmax = 0
+	`, hostID, orgID, seenAt, pq.Array(listIDs), pq.Array(types), pq.Array(values), pq.Array(paths))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create organization: %w", err)
+		return nil, fmt.Errorf("failed to record IOC matches: %w", classifyError(err))
 	}
+	defer rows.Close()
 
-	return org, nil
-}
-
-// GetOrganizationByID retrieves an organization by ID
-func (ps *PostgresStorage) GetOrganizationByID(orgID string) (*models.Organization, error) {
-	query := `
-		SELECT id, name, created_at, updated_at
-		FROM organizations
-		WHERE id = $1
-	`
-
-	org := &models.Organization{}
-	err := ps.db.QueryRow(query, orgID).Scan(
-		&org.ID,
-		&org.Name,
-		&org.CreatedAt,
-		&org.UpdatedAt,
-	)
+	inserted := make(map[string]bool)
+	for rows.Next() {
+		var listID, typ, value string
+		var isNew bool
+		if err := rows.Scan(&listID, &typ, &value, &isNew); err != nil {
+			return nil, fmt.Errorf("failed to scan IOC match: %w", err)
+		}
+		if isNew {
+			inserted[listID+"\x00"+typ+"\x00"+value] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+	var newMatches []models.IOCMatch
+	for _, match := range matches {
+		if inserted[match.ListID+"\x00"+match.Type+"\x00"+match.Value] {
+			match.HostID = hostID
+			match.FirstSeenAt = seenAt.UTC()
+			match.LastSeenAt = seenAt.UTC()
+			newMatches = append(newMatches, match)
+		}
 	}
+	return newMatches, nil
+}
+
+// ListIOCMatches returns the organization's matches selected by filter, most recently seen first
+func (ps *PostgresStorage) ListIOCMatches(orgID string, filter models.IOCMatchFilter) ([]*models.IOCMatch, error) {
+	rows, err := ps.db.Query(`
+		SELECT m.list_id, l.name, m.host_id, COALESCE(h.hostname, ''), m.type, m.value, COALESCE(i.description, ''),
+			m.path, m.first_seen_at, m.last_seen_at
+		FROM ioc_matches m
+		JOIN ioc_lists l ON l.id = m.list_id
+		LEFT JOIN hosts h ON h.host_id = m.host_id AND h.org_id = m.org_id
+		LEFT JOIN ioc_indicators i ON i.list_id = m.list_id AND i.type = m.type AND i.value = m.value
+		WHERE m.org_id = $1
+			AND ($2 = '' OR m.host_id::text = $2)
+			AND ($3 = '' OR m.list_id::text = $3)
+		ORDER BY m.last_seen_at DESC, m.host_id, m.list_id, m.type, m.value
+		LIMIT $4
+	`, orgID, filter.HostID, filter.ListID, filter.Limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get organization: %w", err)
+		return nil, fmt.Errorf("failed to list IOC matches: %w", classifyError(err))
 	}
+	defer rows.Close()
 
-	return org, nil
+	matches := []*models.IOCMatch{}
+	for rows.Next() {
+		match := &models.IOCMatch{}
+		if err := rows.Scan(&match.ListID, &match.ListName, &match.HostID, &match.Hostname, &match.Type, &match.Value,
+			&match.Description, &match.Path, &match.FirstSeenAt, &match.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan IOC match: %w", err)
+		}
+		match.FirstSeenAt = match.FirstSeenAt.UTC()
+		match.LastSeenAt = match.LastSeenAt.UTC()
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
 }
 
-// GetOrganizationByName retrieves an organization by name
-func (ps *PostgresStorage) GetOrganizationByName(name string) (*models.Organization, error) {
-	query := `
-		SELECT id, name, created_at, updated_at
-		FROM organizations
-		WHERE name = $1
-	`
+// CreateHostGroup stores a group without members
+func (ps *PostgresStorage) CreateHostGroup(group *models.HostGroup, orgID string) error {
+	err := ps.db.QueryRow(`
+		INSERT INTO host_groups (id, org_id, name, description, rule, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid)
+		RETURNING created_at, updated_at
+	`, group.ID, orgID, group.Name, group.Description, group.Rule, group.CreatedBy).Scan(&group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create host group: %w", classifyError(err))
+	}
 
-	org := &models.Organization{}
-	err := ps.db.QueryRow(query, name).Scan(
-		&org.ID,
-		&org.Name,
-		&org.CreatedAt,
-		&org.UpdatedAt,
-	)
+	group.HostIDs = []string{}
+	group.CreatedAt = group.CreatedAt.UTC()
+	group.UpdatedAt = group.UpdatedAt.UTC()
+	return nil
+}
 
+// UpdateHostGroup replaces a group's name, description, and rule
+func (ps *PostgresStorage) UpdateHostGroup(group *models.HostGroup, orgID string) error {
+	err := ps.db.QueryRow(`
+		UPDATE host_groups g SET name = $3, description = $4, rule = $5, updated_at = NOW()
+		WHERE g.id = $1 AND g.org_id = $2
+		RETURNING `+hostGroupColumns,
+		group.ID, orgID, group.Name, group.Description, group.Rule,
+	).Scan(hostGroupDest(group)...)
 	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+		return ErrNotFound
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get organization: %w", err)
+		return fmt.Errorf("failed to update host group: %w", classifyError(err))
 	}
-
-	return org, nil
+	group.CreatedAt = group.CreatedAt.UTC()
+	group.UpdatedAt = group.UpdatedAt.UTC()
+	return nil
 }
 
-// CountUsersInOrganization counts the number of users in an organization
-func (ps *PostgresStorage) CountUsersInOrganization(orgID string) (int, error) {
-	query := `
-		SELECT COUNT(*)
-		FROM users
-		WHERE org_id = $1
-	`
-
-	var count int
-	err := ps.db.QueryRow(query, orgID).Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to count users in organization: %w", err)
-	}
+// hostGroupColumns are the host_groups columns read by hostGroupDest, with the group's static members
+const hostGroupColumns = `g.id, g.name, g.description, g.rule, COALESCE(g.created_by::text, ''), g.created_at, g.updated_at,
+	ARRAY(SELECT m.host_id::text FROM host_group_members m WHERE m.group_id = g.id ORDER BY m.host_id)`
 
-	return count, nil
+func hostGroupDest(group *models.HostGroup) []interface{} {
+	return []interface{}{&group.ID, &group.Name, &group.Description, &group.Rule, &group.CreatedBy,
+		&group.CreatedAt, &group.UpdatedAt, pq.Array(&group.HostIDs)}
 }
 
-// ListUsersByOrganization lists all users in an organization
-func (ps *PostgresStorage) ListUsersByOrganization(orgID string) ([]*models.User, error) {
-	query := `
-		SELECT id, username, email, is_active, is_admin, org_id, role, created_at, updated_at
-		FROM users
-		WHERE org_id = $1
-		ORDER BY created_at ASC
-	`
+func scanHostGroup(row interface{ Scan(...interface{}) error }) (*models.HostGroup, error) {
+	group := &models.HostGroup{}
+	if err := row.Scan(hostGroupDest(group)...); err != nil {
+		return nil, err
+	}
+	if group.HostIDs == nil {
+		group.HostIDs = []string{}
+	}
+	group.CreatedAt = group.CreatedAt.UTC()
+	group.UpdatedAt = group.UpdatedAt.UTC()
+	return group, nil
+}
 
-	rows, err := ps.db.Query(query, orgID)
+// ListHostGroups returns the organization's groups with their static members, by name
+func (ps *PostgresStorage) ListHostGroups(orgID string) ([]*models.HostGroup, error) {
+	rows, err := ps.db.Query("SELECT "+hostGroupColumns+" FROM host_groups g WHERE g.org_id = $1 ORDER BY g.name", orgID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, fmt.Errorf("failed to list host groups: %w", classifyError(err))
 	}
 	defer rows.Close()
 
-	var users []*models.User
+	groups := []*models.HostGroup{}
 	for rows.Next() {
-		user := &models.User{}
-		err := rows.Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.IsActive,
-			&user.IsAdmin,
-			&user.OrgID,
-			&user.Role,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+		group, err := scanHostGroup(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+			return nil, fmt.Errorf("failed to scan host group: %w", err)
 		}
-		users = append(users, user)
+		groups = append(groups, group)
 	}
-
-	return users, nil
+	return groups, rows.Err()
 }
 
-// UpdateUserRole updates a user's role
-func (ps *PostgresStorage) UpdateUserRole(userID, role string) error {
-	query := `
-		UPDATE users
-		SET role = $1, updated_at = NOW()
-		WHERE id = $2
-	`
-
-	result, err := ps.db.Exec(query, role, userID)
+// GetHostGroup returns a group of the organization with its static members
+func (ps *PostgresStorage) GetHostGroup(groupID, orgID string) (*models.HostGroup, error) {
+	group, err := scanHostGroup(ps.db.QueryRow("SELECT "+hostGroupColumns+" FROM host_groups g WHERE g.id = $1 AND g.org_id = $2", groupID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update user role: %w", err)
+		return nil, fmt.Errorf("failed to get host group: %w", classifyError(err))
 	}
+	return group, nil
+}
 
-	rows, _ := result.RowsAffected()
+// DeleteHostGroup removes a group with its membership
+func (ps *PostgresStorage) DeleteHostGroup(groupID, orgID string) error {
+	result, err := ps.db.Exec("DELETE FROM host_groups WHERE id = $1 AND org_id = $2", groupID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete host group: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 	if rows == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func (ps *PostgresStorage) DeleteUser(userID string) error {
-	result, err := ps.db.Exec("DELETE FROM users WHERE id = $1", userID)
+// AddHostGroupMember adds a host of the organization to a group's static members
+func (ps *PostgresStorage) AddHostGroupMember(groupID, orgID, hostID, actorUserID string) error {
+	// The count is of the group and host found, whether or not the host was already a member
+	var found int
+	err := ps.db.QueryRow(`
+		WITH target AS (
+			SELECT g.id AS group_id, g.org_id, h.host_id
+			FROM host_groups g
+			JOIN hosts h ON h.org_id = g.org_id AND h.host_id = $3
+			WHERE g.id = $1 AND g.org_id = $2
+		), inserted AS (
+			INSERT INTO host_group_members (group_id, org_id, host_id, added_by)
+			SELECT group_id, org_id, host_id, NULLIF($4, '')::uuid FROM target
+			ON CONFLICT (group_id, host_id) DO NOTHING
+		)
+		SELECT COUNT(*) FROM target
+	`, groupID, orgID, hostID, actorUserID).Scan(&found)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to add host group member: %w", classifyError(err))
+	}
+	if found == 0 {
+		return ErrNotFound
 	}
+	return nil
+}
 
-	rows, _ := result.RowsAffected()
+// RemoveHostGroupMember removes a host from a group's static members
+func (ps *PostgresStorage) RemoveHostGroupMember(groupID, orgID, hostID string) error {
+	result, err := ps.db.Exec(`
+		DELETE FROM host_group_members m
+		USING host_groups g
+		WHERE m.group_id = g.id AND g.id = $1 AND g.org_id = $2 AND m.host_id = $3
+	`, groupID, orgID, hostID)
+	if err != nil {
+		return fmt.Errorf("failed to remove host group member: %w", classifyError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 	if rows == 0 {
 		return ErrNotFound
 	}
-
 	return nil
 }
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"snailbus/internal/migrations"
+	"snailbus/internal/models"
+)
+
+// tablePrivileges are the privileges the server needs on every table in its schema
+var tablePrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+
+// migrationTables are written only by migrations; the server just reads the
+// applied version for diagnostic bundles
+var migrationTables = []string{"schema_migrations", migrations.ChecksumTable}
+
+// missingPrivilegesQuery lists the table and sequence privileges the current role lacks
+// Partitions are skipped since queries reach them through their parent.
+const missingPrivilegesQuery = `
+	SELECT p.privilege || ' on ' || c.relname
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	CROSS JOIN unnest($1::text[]) AS p(privilege)
+	WHERE n.nspname = current_schema()
+		AND c.relkind IN ('r', 'p')
+		AND NOT c.relispartition
+		AND NOT (c.relname = ANY($2) AND p.privilege <> 'SELECT')
+		AND NOT has_table_privilege(c.oid, p.privilege)
+	UNION ALL
+	SELECT 'USAGE on sequence ' || c.relname
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = current_schema()
+		AND c.relkind = 'S'
+		AND NOT has_sequence_privilege(c.oid, 'USAGE')
+	ORDER BY 1
+`
+
+// ddlPrivilegesQuery reports the ways the current role can change the schema
+const ddlPrivilegesQuery = `
+	SELECT
+		current_user,
+		(SELECT rolsuper FROM pg_roles WHERE rolname = current_user),
+		current_schema(),
+		has_schema_privilege(current_schema(), 'CREATE'),
+		current_database(),
+		has_database_privilege(current_database(), 'CREATE'),
+		(SELECT COUNT(*) FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND pg_has_role(c.relowner, 'USAGE'))
+`
+
+// DatabasePrivileges checks the role behind DATABASE_URL: the table privileges the
+// server needs, and whether the role can still run DDL
+func (ps *PostgresStorage) DatabasePrivileges(ctx context.Context) (*models.DatabasePrivileges, error) {
+	privileges := &models.DatabasePrivileges{CheckedAt: time.Now().UTC()}
+
+	var superuser, createInSchema, createInDatabase bool
+	var schema, database string
+	var ownedTables int
+	err := ps.db.QueryRowContext(ctx, ddlPrivilegesQuery).Scan(
+		&privileges.Role, &superuser, &schema, &createInSchema, &database, &createInDatabase, &ownedTables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database role: %w", err)
+	}
+	if superuser {
+		privileges.DDL = append(privileges.DDL, "superuser")
+	}
+	if createInSchema {
+		privileges.DDL = append(privileges.DDL, "CREATE on schema "+schema)
+	}
+	if createInDatabase {
+		privileges.DDL = append(privileges.DDL, "CREATE on database "+database)
+	}
+	if ownedTables > 0 {
+		privileges.DDL = append(privileges.DDL, fmt.Sprintf("owns %d tables", ownedTables))
+	}
+
+	rows, err := ps.db.QueryContext(ctx, missingPrivilegesQuery, pq.Array(tablePrivileges), pq.Array(migrationTables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check table privileges: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var missing string
+		if err := rows.Scan(&missing); err != nil {
+			return nil, fmt.Errorf("failed to scan table privilege: %w", err)
+		}
+		privileges.Missing = append(privileges.Missing, missing)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check table privileges: %w", err)
+	}
+
+	return privileges, nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+	"snailbus/internal/sqlbuilder"
+)
+
+// Queries whose WHERE clause depends on a filter are assembled here so the SQL
+// each filter produces can be tested without a database.
+
+// hostListQuery selects host summaries with their tags and latest probe, newest report first
+func hostListQuery(orgID string, includeArchived bool, conditions []sqlbuilder.Cond) *sqlbuilder.SelectBuilder {
+	return hostSummaryQuery(orgID, includeArchived, conditions).OrderBy("received_at DESC")
+}
+
+// hostSummaryBatchQuery selects up to limit host summaries after afterHostID in host ID
+// order, archived hosts included
+func hostSummaryBatchQuery(orgID, afterHostID string, limit int) *sqlbuilder.SelectBuilder {
+	q := hostSummaryQuery(orgID, true, nil)
+	if afterHostID != "" {
+		q.Where(sqlbuilder.Expr("host_id > ?", afterHostID))
+	}
+	return q.OrderBy("host_id").Limit(limit)
+}
+
+// hostSummaryQuery selects host summaries with their tags and latest probe, in no order
+// The summary fields found in report data are read from the generated columns of
+// migration 000046 rather than from data.
+func hostSummaryQuery(orgID string, includeArchived bool, conditions []sqlbuilder.Cond) *sqlbuilder.SelectBuilder {
+	q := sqlbuilder.Select(
+		"host_id", "hostname", "display_name", "description", "received_at", "timestamp", "archived_at",
+		"COALESCE(os_name, '')", "COALESCE(os_version, '')", "COALESCE(os_version_major, '')", "COALESCE(os_version_minor, '')", "COALESCE(os_version_patch, '')",
+		"COALESCE(kernel_version, '')", "COALESCE(architecture, '')", "package_count", "org_id", "uploaded_by_user_id",
+		"COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM host_tags t WHERE t.org_id = hosts.org_id AND t.host_id = hosts.host_id), '{}')",
+		"health", "sections", "stale_since",
+		"p.method", "p.port", "p.reachable", "p.address", "p.latency_ms", "p.error", "p.prober", "p.probed_at",
+	).
+		From("hosts").
+		Join(`LEFT JOIN LATERAL (
+			SELECT method, port, reachable, address, latency_ms, error, prober, probed_at
+			FROM host_probe_results r
+			WHERE r.org_id = hosts.org_id AND r.host_id = hosts.host_id
+			ORDER BY r.probed_at DESC
+			LIMIT 1
+		) p ON true`).
+		Where(sqlbuilder.Eq("org_id", orgID))
+	if !includeArchived {
+		q.Where(sqlbuilder.IsNull("archived_at"))
+	}
+	return q.Where(conditions...)
+}
+
+// hostCountQuery counts the hosts a hostListQuery with the same arguments selects
+func hostCountQuery(orgID string, includeArchived bool, conditions []sqlbuilder.Cond) *sqlbuilder.SelectBuilder {
+	q := sqlbuilder.Select("COUNT(*)").From("hosts").Where(sqlbuilder.Eq("org_id", orgID))
+	if !includeArchived {
+		q.Where(sqlbuilder.IsNull("archived_at"))
+	}
+	return q.Where(conditions...)
+}
+
+// searchConditions translates the exact-match terms of a query into SQL conditions
+// Terms using wildcards, negation, or comparisons are left to search.Query.Match.
+func searchConditions(q *search.Query) []sqlbuilder.Cond {
+	var conditions []sqlbuilder.Cond
+
+	for _, term := range q.Terms {
+		if term.Negate || term.Op != search.OpMatch {
+			continue
+		}
+		var patterns []string
+		for _, value := range term.Values {
+			if strings.Contains(value.Pattern, "*") {
+				patterns = nil
+				break
+			}
+			patterns = append(patterns, value.Pattern)
+			if key, val, ok := strings.Cut(value.Pattern, "="); ok && term.Field == search.FieldTag {
+				patterns = append(patterns, key+":"+val)
+			}
+		}
+		if len(patterns) == 0 {
+			continue
+		}
+		if term.Field != search.FieldTag && term.Field != search.FieldSection {
+			for i := range patterns {
+				patterns[i] = strings.ToLower(patterns[i])
+			}
+		}
+
+		switch term.Field {
+		case search.FieldOS:
+			conditions = append(conditions, sqlbuilder.Any("lower(os_name)", patterns))
+		case search.FieldHostname:
+			conditions = append(conditions, sqlbuilder.Any("lower(hostname)", patterns))
+		case search.FieldID:
+			conditions = append(conditions, sqlbuilder.Any("host_id::text", patterns))
+		case search.FieldHealth:
+			conditions = append(conditions, sqlbuilder.Any("health->>'status'", patterns))
+		case search.FieldSection:
+			conditions = append(conditions, sqlbuilder.Expr("sections && ?", pq.Array(patterns)))
+		case search.FieldStatus:
+			// A term naming both statuses, or neither, is left to Match
+			stale, active := slices.Contains(patterns, models.HostStatusStale), slices.Contains(patterns, models.HostStatusActive)
+			if stale && !active {
+				conditions = append(conditions, sqlbuilder.Expr("stale_since IS NOT NULL"))
+			} else if active && !stale {
+				conditions = append(conditions, sqlbuilder.IsNull("stale_since"))
+			}
+		case search.FieldTag:
+			conditions = append(conditions, sqlbuilder.Expr(
+				"EXISTS (SELECT 1 FROM host_tags t WHERE t.org_id = hosts.org_id AND t.host_id = hosts.host_id AND t.tag = ANY(?))",
+				pq.Array(patterns)))
+		case search.FieldPackage:
+			conditions = append(conditions, sqlbuilder.Expr(`EXISTS (
+				SELECT 1 FROM jsonb_array_elements(
+					CASE WHEN jsonb_typeof(data->'packages'->'installed') = 'array' THEN data->'packages'->'installed' ELSE '[]'::jsonb END
+				) pkg WHERE lower(pkg->>'name') = ANY(?))`, pq.Array(patterns)))
+		}
+	}
+
+	return conditions
+}
+
+// hostAccountsQuery selects the organization's host accounts matching filter
+func hostAccountsQuery(orgID string, filter models.HostAccountFilter) *sqlbuilder.SelectBuilder {
+	q := sqlbuilder.Select("a.host_id", "h.hostname", "a.username", "a.uid", "a.gid", "a.home", "a.shell").
+		From("host_accounts a").
+		Join("JOIN hosts h ON h.org_id = a.org_id AND h.host_id = a.host_id").
+		Where(sqlbuilder.Eq("a.org_id", orgID))
+	if filter.Username != "" {
+		q.Where(sqlbuilder.Eq("a.username", filter.Username))
+	}
+	if filter.Shell != "" {
+		q.Where(sqlbuilder.Eq("a.shell", filter.Shell))
+	}
+	if filter.UID != nil {
+		q.Where(sqlbuilder.Eq("a.uid", *filter.UID))
+	}
+	if filter.HostID != "" {
+		q.Where(sqlbuilder.Eq("a.host_id", filter.HostID))
+	}
+	if !filter.IncludeArchived {
+		q.Where(sqlbuilder.IsNull("h.archived_at"))
+	}
+	return q.OrderBy("a.username", "h.hostname", "a.host_id")
+}
+
+// hostServicesQuery selects the organization's listening ports matching filter
+func hostServicesQuery(orgID string, filter models.HostServiceFilter) *sqlbuilder.SelectBuilder {
+	q := sqlbuilder.Select("s.host_id", "h.hostname", "s.protocol", "s.address", "s.port", "s.process", "s.pid").
+		From("host_services s").
+		Join("JOIN hosts h ON h.org_id = s.org_id AND h.host_id = s.host_id").
+		Where(sqlbuilder.Eq("s.org_id", orgID))
+	if filter.Port != nil {
+		q.Where(sqlbuilder.Eq("s.port", *filter.Port))
+	}
+	if filter.Protocol != "" {
+		q.Where(sqlbuilder.Eq("s.protocol", strings.ToLower(filter.Protocol)))
+	}
+	if filter.Process != "" {
+		q.Where(sqlbuilder.Eq("s.process", filter.Process))
+	}
+	if filter.HostID != "" {
+		q.Where(sqlbuilder.Eq("s.host_id", filter.HostID))
+	}
+	if !filter.IncludeArchived {
+		q.Where(sqlbuilder.IsNull("h.archived_at"))
+	}
+	return q.OrderBy("s.port", "s.protocol", "h.hostname", "s.host_id", "s.address")
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"snailbus/internal/models"
+	"snailbus/internal/search"
+)
+
+// whereClause returns the part of a statement between WHERE and ORDER BY
+func whereClause(t *testing.T, sql string) string {
+	t.Helper()
+	_, where, ok := strings.Cut(sql, " WHERE ")
+	if !ok {
+		t.Fatalf("no WHERE clause in %q", sql)
+	}
+	where, _, _ = strings.Cut(where, " ORDER BY ")
+	return where
+}
+
+func TestHostAccountsQuery(t *testing.T) {
+	uid := int64(1000)
+	tests := []struct {
+		name      string
+		filter    models.HostAccountFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "no filter",
+			wantWhere: "a.org_id = $1 AND h.archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "archived hosts included",
+			filter:    models.HostAccountFilter{IncludeArchived: true},
+			wantWhere: "a.org_id = $1",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "every filter",
+			filter:    models.HostAccountFilter{Username: "alice", Shell: "/bin/bash", UID: &uid, HostID: "host-1"},
+			wantWhere: "a.org_id = $1 AND a.username = $2 AND a.shell = $3 AND a.uid = $4 AND a.host_id = $5 AND h.archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1", "alice", "/bin/bash", int64(1000), "host-1"},
+		},
+		{
+			name:      "placeholders follow the filters that are set",
+			filter:    models.HostAccountFilter{UID: &uid, IncludeArchived: true},
+			wantWhere: "a.org_id = $1 AND a.uid = $2",
+			wantArgs:  []interface{}{"org-1", int64(1000)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := hostAccountsQuery("org-1", tt.filter).Build()
+			if where := whereClause(t, sql); where != tt.wantWhere {
+				t.Errorf("WHERE = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+			if !strings.HasSuffix(sql, " ORDER BY a.username, h.hostname, a.host_id") {
+				t.Errorf("sql = %q, want accounts ordered by username", sql)
+			}
+		})
+	}
+}
+
+func TestHostServicesQuery(t *testing.T) {
+	port := 443
+	tests := []struct {
+		name      string
+		filter    models.HostServiceFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "no filter",
+			wantWhere: "s.org_id = $1 AND h.archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "every filter",
+			filter:    models.HostServiceFilter{Port: &port, Protocol: "TCP", Process: "nginx", HostID: "host-1", IncludeArchived: true},
+			wantWhere: "s.org_id = $1 AND s.port = $2 AND s.protocol = $3 AND s.process = $4 AND s.host_id = $5",
+			wantArgs:  []interface{}{"org-1", 443, "tcp", "nginx", "host-1"},
+		},
+		{
+			name:      "protocol only",
+			filter:    models.HostServiceFilter{Protocol: "udp"},
+			wantWhere: "s.org_id = $1 AND s.protocol = $2 AND h.archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1", "udp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := hostServicesQuery("org-1", tt.filter).Build()
+			if where := whereClause(t, sql); where != tt.wantWhere {
+				t.Errorf("WHERE = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestHostListQuery(t *testing.T) {
+	tagCondition := "EXISTS (SELECT 1 FROM host_tags t WHERE t.org_id = hosts.org_id AND t.host_id = hosts.host_id AND t.tag = ANY("
+	tests := []struct {
+		name            string
+		query           string // Search query; empty lists every host
+		includeArchived bool
+		wantWhere       string
+		wantArgs        []interface{}
+	}{
+		{
+			name:      "all hosts",
+			wantWhere: "org_id = $1 AND archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:            "archived hosts included",
+			includeArchived: true,
+			wantWhere:       "org_id = $1",
+			wantArgs:        []interface{}{"org-1"},
+		},
+		{
+			name:      "os and hostname are lowercased",
+			query:     "os:Fedora,RHEL hostname:Web-1",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND lower(os_name) = ANY($2) AND lower(hostname) = ANY($3)",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"fedora", "rhel"}), pq.Array([]string{"web-1"})},
+		},
+		{
+			name:      "tag key=value also matches key:value",
+			query:     "tag:env=Prod",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND " + tagCondition + "$2))",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"env=Prod", "env:Prod"})},
+		},
+		{
+			name:      "host ID",
+			query:     "id:0A1B",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND host_id::text = ANY($2)",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"0a1b"})},
+		},
+		{
+			name:      "health status",
+			query:     "health:Critical,warning",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND health->>'status' = ANY($2)",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"critical", "warning"})},
+		},
+		{
+			name:      "data sections keep their case",
+			query:     "section:docker,Podman",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND sections && $2",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"docker", "Podman"})},
+		},
+		{
+			name:      "stale hosts",
+			query:     "status:Stale",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND stale_since IS NOT NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "either status is left to Match",
+			query:     "status:active,stale",
+			wantWhere: "org_id = $1 AND archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "wildcards, negations, and comparisons are left to Match",
+			query:     "hostname:web-* -os:debian version>=40 web",
+			wantWhere: "org_id = $1 AND archived_at IS NULL",
+			wantArgs:  []interface{}{"org-1"},
+		},
+		{
+			name:      "placeholders number across conditions",
+			query:     "tag:env=prod os:fedora",
+			wantWhere: "org_id = $1 AND archived_at IS NULL AND " + tagCondition + "$2)) AND lower(os_name) = ANY($3)",
+			wantArgs:  []interface{}{"org-1", pq.Array([]string{"env=prod", "env:prod"}), pq.Array([]string{"fedora"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := searchConditions(&search.Query{})
+			if tt.query != "" {
+				q, err := search.Parse(tt.query)
+				if err != nil {
+					t.Fatalf("Parse(%q) error = %v", tt.query, err)
+				}
+				conditions = searchConditions(q)
+			}
+			sql, args := hostListQuery("org-1", tt.includeArchived, conditions).Build()
+			// The LATERAL join holds its own WHERE, so look after the last one
+			where := sql[strings.LastIndex(sql, ") p ON true WHERE ")+len(") p ON true WHERE "):]
+			where, _, _ = strings.Cut(where, " ORDER BY ")
+			if where != tt.wantWhere {
+				t.Errorf("WHERE = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestHostSummaryQuery_ReadsColumns(t *testing.T) {
+	sql, _ := hostSummaryQuery("org-1", false, nil).Build()
+	columns, _, _ := strings.Cut(sql, " FROM hosts ")
+	if strings.Contains(columns, "data") {
+		t.Errorf("columns = %q, want summary fields read from generated columns, not report data", columns)
+	}
+	for _, column := range []string{"os_name", "kernel_version", "architecture", "package_count"} {
+		if !strings.Contains(columns, column) {
+			t.Errorf("columns = %q, want %s", columns, column)
+		}
+	}
+}
+
+func TestHostSummaryBatchQuery(t *testing.T) {
+	sql, args := hostSummaryBatchQuery("org-1", "", 100).Build()
+	if !strings.HasSuffix(sql, " WHERE org_id = $1 ORDER BY host_id LIMIT $2") {
+		t.Errorf("sql = %q, want hosts of every state ordered by host ID", sql)
+	}
+	if want := []interface{}{"org-1", 100}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+
+	sql, args = hostSummaryBatchQuery("org-1", "host-1", 100).Build()
+	if !strings.HasSuffix(sql, " WHERE org_id = $1 AND host_id > $2 ORDER BY host_id LIMIT $3") {
+		t.Errorf("sql = %q, want hosts after host-1", sql)
+	}
+	if want := []interface{}{"org-1", "host-1", 100}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+}
+
+func TestSearchConditions_Package(t *testing.T) {
+	// The version constraint is checked by Match; SQL narrows hosts to the package name
+	q, err := search.Parse("package:OpenSSL<3.0")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	sql, args := hostListQuery("org-1", true, searchConditions(q)).Build()
+	if !strings.Contains(sql, "pkg WHERE lower(pkg->>'name') = ANY($2))") {
+		t.Errorf("sql = %q, want a package condition bound to $2", sql)
+	}
+	if want := []interface{}{"org-1", pq.Array([]string{"openssl"})}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"snailbus/internal/logger"
+	"snailbus/internal/metrics"
+	"snailbus/internal/models"
+)
+
+// replicaLagQuery reports whether the server is a standby and how far its replay is behind
+// A streaming standby that has replayed everything it received is current even if the
+// primary has been idle, so the last-replay timestamp is only used when WAL is pending
+// or the WAL receiver is not streaming.
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(),
+		CASE
+			WHEN NOT pg_is_in_recovery() THEN 0
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()
+				AND EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming') THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM (NOW() - pg_last_xact_replay_timestamp())), 0)
+		END::float8
+`
+
+// replicaCheckTimeout bounds a single replica health check
+const replicaCheckTimeout = 5 * time.Second
+
+// replica is a read-only standby that list and search queries are routed to
+// while its replay lag stays within maxLag
+type replica struct {
+	db     *sql.DB
+	maxLag time.Duration
+
+	mu     sync.RWMutex
+	status models.ReplicaStatus
+}
+
+// EnableReplica routes list and search reads to a streaming replica
+// Reads stay on the primary until the first health check (run here) passes, and fail
+// back over to it whenever the replica is unreachable, promoted, or lagging by more
+// than maxLag. An unreachable replica is not an error: the monitor keeps retrying.
+func (ps *PostgresStorage) EnableReplica(dsn string, maxLag time.Duration) error {
+	dsn, _ = withApplicationName(dsn)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open replica database: %w", err)
+	}
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	ps.replica = &replica{
+		db:     db,
+		maxLag: maxLag,
+		status: models.ReplicaStatus{MaxLagSeconds: maxLag.Seconds()},
+	}
+	ps.checkReplica(context.Background())
+	return nil
+}
+
+// ReplicaDB returns the replica connection for metrics collection, or nil if none is configured
+func (ps *PostgresStorage) ReplicaDB() *sql.DB {
+	if ps.replica == nil {
+		return nil
+	}
+	return ps.replica.db
+}
+
+// RunReplicaMonitor re-checks the replica's role and lag every interval until ctx is done
+func (ps *PostgresStorage) RunReplicaMonitor(ctx context.Context, interval time.Duration) {
+	if ps.replica == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ps.checkReplica(ctx)
+		}
+	}
+}
+
+// checkReplica records the replica's role and lag and decides whether it serves reads
+func (ps *PostgresStorage) checkReplica(ctx context.Context) {
+	r := ps.replica
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var inRecovery bool
+	var lag float64
+	err := r.db.QueryRowContext(ctx, replicaLagQuery).Scan(&inRecovery, &lag)
+	now := time.Now()
+
+	status := models.ReplicaStatus{
+		MaxLagSeconds: r.maxLag.Seconds(),
+		CheckedAt:     &now,
+	}
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case !inRecovery:
+		// A promoted replica no longer follows the primary, so its data may diverge
+		status.Role = models.DatabaseRolePrimary
+		status.Error = "replica is not in recovery"
+	default:
+		status.Role = models.DatabaseRoleReplica
+		status.LagSeconds = lag
+		status.ServingReads = lag <= r.maxLag.Seconds()
+	}
+
+	r.mu.Lock()
+	wasServing := r.status.ServingReads
+	r.status = status
+	r.mu.Unlock()
+
+	if wasServing && !status.ServingReads {
+		logger.Logger.Warn().Float64("lag_seconds", status.LagSeconds).Str("error", status.Error).
+			Msg("Read replica unavailable, routing reads to the primary")
+	} else if !wasServing && status.ServingReads {
+		logger.Logger.Info().Float64("lag_seconds", status.LagSeconds).Msg("Routing reads to the replica")
+	}
+
+	if status.Role != "" {
+		metrics.DBInRecovery.WithLabelValues("replica").Set(boolGauge(inRecovery))
+	}
+	metrics.DBReplicaLagSeconds.Set(status.LagSeconds)
+	metrics.DBReplicaServingReads.Set(boolGauge(status.ServingReads))
+}
+
+// reader returns the replica if it is healthy and within the lag threshold, otherwise the primary
+// Only queries that tolerate slightly stale results should use it. Inside WithTx it
+// returns the transaction, so reads see its uncommitted changes.
+func (ps *PostgresStorage) reader() dbConn {
+	if ps.replica == nil || ps.inTx() {
+		return ps.db
+	}
+
+	ps.replica.mu.RLock()
+	serving := ps.replica.status.ServingReads
+	ps.replica.mu.RUnlock()
+	if !serving {
+		return ps.db
+	}
+	return ps.replica.db
+}
+
+// ReplicationStatus reports the primary's role and the replica's last health check
+func (ps *PostgresStorage) ReplicationStatus(ctx context.Context) (*models.ReplicationStatus, error) {
+	var inRecovery bool
+	if err := ps.db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		return nil, fmt.Errorf("failed to check database role: %w", err)
+	}
+	metrics.DBInRecovery.WithLabelValues("primary").Set(boolGauge(inRecovery))
+
+	status := &models.ReplicationStatus{PrimaryRole: models.DatabaseRolePrimary}
+	if inRecovery {
+		status.PrimaryRole = models.DatabaseRoleReplica
+	}
+	if ps.replica != nil {
+		ps.replica.mu.RLock()
+		replicaStatus := ps.replica.status
+		ps.replica.mu.RUnlock()
+		status.Replica = &replicaStatus
+	}
+	return status, nil
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
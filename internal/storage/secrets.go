@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"snailbus/internal/secretbox"
+)
+
+// secretColumn is a column holding secrets that are encrypted at rest
+type secretColumn struct {
+	table  string
+	keys   []string // Primary key columns
+	column string
+}
+
+// secretColumns lists every column encrypted by EnableSecretEncryption
+var secretColumns = []secretColumn{
+	{table: "org_secrets", keys: []string{"org_id", "name"}, column: "value"},
+	{table: "actions", keys: []string{"id"}, column: "signing_secret"},
+	{table: "actions", keys: []string{"id"}, column: "previous_signing_secret"},
+	{table: "webhooks", keys: []string{"id"}, column: "signing_secret"},
+	{table: "org_remote_write", keys: []string{"org_id"}, column: "password"},
+	{table: "org_remote_write", keys: []string{"org_id"}, column: "bearer_token"},
+}
+
+// EnableSecretEncryption encrypts organization secrets, action and webhook signing secrets, and
+// remote-write credentials with box when they are written, and decrypts them on read
+// Rows written before are read as plaintext until ReencryptSecrets seals them.
+func (ps *PostgresStorage) EnableSecretEncryption(box *secretbox.Box) {
+	ps.secrets = box
+}
+
+// sealSecret encrypts a secret for storage
+func (ps *PostgresStorage) sealSecret(value string) (string, error) {
+	sealed, err := ps.secrets.Seal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// openSecrets decrypts stored secrets in place
+func (ps *PostgresStorage) openSecrets(values ...*string) error {
+	for _, value := range values {
+		opened, err := ps.secrets.Open(*value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt secret: %w", err)
+		}
+		*value = opened
+	}
+	return nil
+}
+
+// ReencryptSecrets seals the secrets still stored in plaintext or under a master key
+// other than the primary one, and returns how many values were rewritten per table
+// and column. Each value is only replaced if it did not change in the meantime, so
+// it is safe to run while the server is writing secrets.
+func (ps *PostgresStorage) ReencryptSecrets(ctx context.Context) (map[string]int, error) {
+	if !ps.secrets.Enabled() {
+		return nil, fmt.Errorf("secret encryption is not enabled")
+	}
+
+	counts := make(map[string]int, len(secretColumns))
+	for _, sc := range secretColumns {
+		n, err := ps.reencryptColumn(ctx, sc)
+		if err != nil {
+			return counts, fmt.Errorf("failed to re-encrypt %s.%s: %w", sc.table, sc.column, err)
+		}
+		counts[sc.table+"."+sc.column] = n
+	}
+	return counts, nil
+}
+
+// CountSecrets returns how many stored secrets are in plaintext and how many are sealed,
+// per table and column. Empty values are not secrets and are not counted.
+func (ps *PostgresStorage) CountSecrets(ctx context.Context) (plaintext, sealed map[string]int, err error) {
+	plaintext = make(map[string]int, len(secretColumns))
+	sealed = make(map[string]int, len(secretColumns))
+	for _, sc := range secretColumns {
+		var p, s int
+		err := ps.db.QueryRowContext(ctx, fmt.Sprintf(`
+			SELECT count(*) FILTER (WHERE NOT starts_with(%[1]s, $1)),
+			       count(*) FILTER (WHERE starts_with(%[1]s, $1))
+			FROM %[2]s WHERE %[1]s <> ''`, sc.column, sc.table), secretbox.Prefix).Scan(&p, &s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count %s.%s: %w", sc.table, sc.column, classifyError(err))
+		}
+		plaintext[sc.table+"."+sc.column] += p
+		sealed[sc.table+"."+sc.column] += s
+	}
+	return plaintext, sealed, nil
+}
+
+// reencryptColumn reseals the values of one secret column that need it
+func (ps *PostgresStorage) reencryptColumn(ctx context.Context, sc secretColumn) (int, error) {
+	keyList := strings.Join(sc.keys, ", ")
+	rows, err := ps.db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s <> ''`, keyList, sc.column, sc.table, sc.column))
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	type pending struct {
+		keys  []interface{}
+		value string
+	}
+	var stale []pending
+	for rows.Next() {
+		keys := make([]string, len(sc.keys))
+		dest := make([]interface{}, 0, len(sc.keys)+1)
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		var value string
+		dest = append(dest, &value)
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !ps.secrets.NeedsReseal(value) {
+			continue
+		}
+		p := pending{value: value}
+		for _, key := range keys {
+			p.keys = append(p.keys, key)
+		}
+		stale = append(stale, p)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	conditions := make([]string, len(sc.keys))
+	for i, key := range sc.keys {
+		conditions[i] = fmt.Sprintf("%s::text = $%d", key, i+3)
+	}
+	update := fmt.Sprintf(`UPDATE %s SET %s = $1 WHERE %s = $2 AND %s`,
+		sc.table, sc.column, sc.column, strings.Join(conditions, " AND "))
+
+	rewritten := 0
+	for _, p := range stale {
+		sealed, err := ps.secrets.Reseal(p.value)
+		if err != nil {
+			return rewritten, fmt.Errorf("row %v: %w", p.keys, err)
+		}
+		result, err := ps.db.ExecContext(ctx, update, append([]interface{}{sealed, p.value}, p.keys...)...)
+		if err != nil {
+			return rewritten, classifyError(err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			rewritten += int(n)
+		}
+	}
+	return rewritten, nil
+}
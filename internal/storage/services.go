@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+
+	"snailbus/internal/models"
+)
+
+// parseHostServices extracts the listening ports from report data's network.listening_ports section
+// Entries without a valid port are skipped, and only the first entry for a protocol, address,
+// and port is kept. Protocols are lowercased so tcp and TCP match.
+func parseHostServices(dataJSON []byte) []models.HostService {
+	var data struct {
+		Network struct {
+			ListeningPorts []json.RawMessage `json:"listening_ports"`
+		} `json:"network"`
+	}
+	if err := json.Unmarshal(dataJSON, &data); err != nil {
+		return nil
+	}
+
+	entries := data.Network.ListeningPorts
+	services := make([]models.HostService, 0, len(entries))
+	seen := make(map[models.HostService]bool, len(entries))
+	for _, raw := range entries {
+		var entry struct {
+			Protocol     string      `json:"protocol"`
+			Proto        string      `json:"proto"`
+			Address      string      `json:"address"`
+			LocalAddress string      `json:"local_address"`
+			Port         interface{} `json:"port"`
+			Process      string      `json:"process"`
+			Program      string      `json:"program"`
+			PID          interface{} `json:"pid"`
+		}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		port := reportedInt(entry.Port)
+		if port == nil || *port < 1 || *port > 65535 {
+			continue
+		}
+
+		service := models.HostService{
+			Protocol: strings.ToLower(firstNonEmpty(entry.Protocol, entry.Proto)),
+			Address:  firstNonEmpty(entry.Address, entry.LocalAddress),
+			Port:     int(*port),
+		}
+		if seen[service] {
+			continue
+		}
+		seen[service] = true
+
+		service.Process = firstNonEmpty(entry.Process, entry.Program)
+		service.PID = reportedInt(entry.PID)
+		services = append(services, service)
+	}
+	return services
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// matchHostService reports whether a service has the port, protocol, and process filter asks for
+// It backs the mock storage; host and archive conditions are left to the caller.
+func matchHostService(service models.HostService, filter models.HostServiceFilter) bool {
+	if filter.Port != nil && service.Port != *filter.Port {
+		return false
+	}
+	if filter.Protocol != "" && service.Protocol != strings.ToLower(filter.Protocol) {
+		return false
+	}
+	if filter.Process != "" && service.Process != filter.Process {
+		return false
+	}
+	return true
+}
@@ -1,60 +1,646 @@
 package storage
 
 import (
-	"errors"
+	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"snailbus/internal/models"
+	"snailbus/internal/search"
 )
 
-var (
-	// ErrNotFound is returned when a requested resource is not found
-	ErrNotFound = errors.New("not found")
+// queryTagKey is the context key for WithQueryTag
+type queryTagKey struct{}
+
+// WithQueryTag attaches a tag (typically the request ID) to ctx. WithConn and the
+// streaming reads (IterateHosts, IterateHostBatches) report it in the connection's
+// application_name, so their queries can be attributed in pg_stat_activity to the
+// request that issued them. Methods called outside WithConn run on pooled connections
+// under the plain application name; errors are only annotated with the tag by the
+// methods that take a context.
+func WithQueryTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, queryTagKey{}, tag)
+}
+
+// queryTag returns the tag attached with WithQueryTag, if any
+func queryTag(ctx context.Context) string {
+	tag, _ := ctx.Value(queryTagKey{}).(string)
+	return tag
+}
+
+// Facet names used for pre-aggregated host counts (see GetHostFacets)
+const (
+	FacetTotal     = "total" // Pseudo-facet counting all hosts under the value "*"
+	FacetOSName    = "os_name"
+	FacetOSVersion = "os_version"
+	FacetTag       = "tag"
+)
+
+// DefaultHostBatchSize is the batch size IterateHostBatches uses when none is given
+const DefaultHostBatchSize = 500
+
+// DefaultHostReportRetention is how many reports of each host are kept when neither the
+// server nor the organization configures it; MaxHostReportRetention bounds both
+const (
+	DefaultHostReportRetention = 10
+	MaxHostReportRetention     = 1000
 )
 
+// CountHostFacets aggregates facets from host summaries
+// It backs the mock storage and callers that can only count a filtered subset of hosts
+func CountHostFacets(hosts []*models.HostSummary) *models.HostFacets {
+	counts := map[string]map[string]int64{
+		FacetOSName:    {},
+		FacetOSVersion: {},
+		FacetTag:       {},
+	}
+	for _, host := range hosts {
+		if host.OSName != "" {
+			counts[FacetOSName][host.OSName]++
+		}
+		if version := strings.TrimSpace(host.OSName + " " + host.OSVersion); version != "" {
+			counts[FacetOSVersion][version]++
+		}
+		for _, tag := range host.Tags {
+			counts[FacetTag][tag]++
+		}
+	}
+
+	return &models.HostFacets{
+		Total:     int64(len(hosts)),
+		OSNames:   sortedFacetCounts(counts[FacetOSName]),
+		OSVersion: sortedFacetCounts(counts[FacetOSVersion]),
+		Tags:      sortedFacetCounts(counts[FacetTag]),
+	}
+}
+
+// sortedFacetCounts orders facet values by descending count, then by value
+func sortedFacetCounts(counts map[string]int64) []models.FacetCount {
+	result := make([]models.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, models.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
 // Storage defines the interface for storing and retrieving host reports
+// Errors match the sentinels in errors.go under errors.Is; lookups of malformed
+// IDs report ErrInvalidID, which also matches ErrNotFound.
 type Storage interface {
 	// SaveHost stores or updates a host's report
 	// orgID and uploadedByUserID are required and will be stored with the host
+	// Host IDs are unique per organization; another organization may hold the same ID
 	SaveHost(report *models.Report, orgID, uploadedByUserID string) error
+	// SaveHosts stores or updates the reports of several hosts in one transaction, like
+	// SaveHost for each in order; if any fails, none is stored
+	SaveHosts(reports []*models.Report, orgID, uploadedByUserID string) error
 
 	// GetHost returns the full report data for a specific host by host_id (UUID)
 	// Verifies that the host belongs to the specified organization
 	GetHost(hostID, orgID string) (*models.Report, error)
+	// GetHostSelection returns a host's report like GetHost, with only the selected
+	// parts of its data
+	GetHostSelection(hostID, orgID string, sel HostSelection) (*models.Report, error)
+
+	// GetHostHealth returns the health from a host's last report, nil if the agent reported none
+	// Returns ErrNotFound if the host does not exist in the organization
+	GetHostHealth(hostID, orgID string) (*models.HostHealth, error)
 
-	// DeleteHost removes a host by host_id (UUID)
+	// DeleteHost removes a host by host_id (UUID), recording actorUserID as the deleting user
+	// and the optional deletion reason on the deleted event
 	// Verifies that the host belongs to the specified organization before deletion
-	DeleteHost(hostID, orgID string) error
+	DeleteHost(hostID, orgID, actorUserID string, deletion *models.HostDeletion) error
 
 	// ListHosts returns all hosts with summary info for the specified organization
-	ListHosts(orgID string) ([]*models.HostSummary, error)
+	// Archived hosts are only included when includeArchived is set
+	ListHosts(orgID string, includeArchived bool) ([]*models.HostSummary, error)
+
+	// ListHostsPaginated returns up to limit hosts of the organization (DefaultHostPageSize if
+	// not positive, at most MaxHostPageSize) following after, or the first page if after is nil,
+	// with the total number of hosts. Hosts are ordered by last report, newest first.
+	// Archived hosts are only included when includeArchived is set
+	ListHostsPaginated(orgID string, includeArchived bool, after *HostCursor, limit int) (*HostPage, error)
+
+	// SearchHosts returns the hosts of the organization matching a parsed search query
+	// Archived hosts are only included when includeArchived is set
+	SearchHosts(orgID string, query *search.Query, includeArchived bool) ([]*models.HostSummary, error)
+
+	// FindHosts returns the hosts of the organization matching a structured search,
+	// ordered by last report, newest first
+	FindHosts(orgID string, filter models.HostSearchFilter) ([]*models.HostSummary, error)
+
+	// FindHostsPaginated pages the hosts FindHosts returns like ListHostsPaginated;
+	// the total counts the matching hosts
+	FindHostsPaginated(orgID string, filter models.HostSearchFilter, after *HostCursor, limit int) (*HostPage, error)
 
 	// GetAllHosts returns all hosts with their full report data for the specified organization
+	// Prefer IterateHosts for anything that may touch a large fleet
 	GetAllHosts(orgID string) ([]*models.Report, error)
 
+	// IterateHosts streams every host's full report for the specified organization to fn,
+	// one at a time, without holding the whole fleet in memory. Iteration stops at the
+	// first error returned by fn, which is returned unchanged, or when ctx is cancelled.
+	IterateHosts(ctx context.Context, orgID string, fn func(*models.Report) error) error
+
+	// IterateHostBatches reads the organization's hosts with their full reports in batches of
+	// up to batchSize (DefaultHostBatchSize if not positive), ordered by host ID, and hands each
+	// batch to fn. Only hosts after afterHostID are read, so a job can resume from the last host
+	// of a finished batch. Each batch is a query of its own: no connection is held while fn runs.
+	// Iteration stops at the first error returned by fn, which is returned unchanged, or when
+	// ctx is cancelled.
+	IterateHostBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.Report) error) error
+
+	// IterateHostSummaryBatches reads the organization's host summaries, archived hosts
+	// included, in batches like IterateHostBatches
+	IterateHostSummaryBatches(ctx context.Context, orgID, afterHostID string, batchSize int, fn func([]*models.HostSummary) error) error
+
 	// Close closes the database connection
 	Close() error
 
+	// WithTx runs fn with a Storage whose changes are committed together if fn returns nil,
+	// and discarded if it returns an error, which WithTx returns unchanged. Calls through tx
+	// see its uncommitted changes; use tx, not the outer storage, for everything inside fn.
+	// A failed call can leave the transaction unusable, so fn should return its error
+	// rather than carry on.
+	WithTx(fn func(tx Storage) error) error
+
+	// WithConn runs fn with a Storage whose queries run on one connection, with the query
+	// tag of ctx (see WithQueryTag) in its application_name, and returns fn's error. The
+	// connection is taken on the first query and handed back when fn returns. Calls through
+	// conn must not overlap, so hand it to no other goroutine; streaming reads such as
+	// IterateHostBatches still take a connection of their own, tagged the same way.
+	WithConn(ctx context.Context, fn func(conn Storage) error) error
+
 	// Auth methods
+	// CreateUser reports duplicates as ErrUsernameTaken or ErrEmailTaken
 	CreateUser(username, email, passwordHash, orgID, role string) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, string, error) // Returns user and password hash
 	GetUserByID(userID string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 
 	CreateAPIKey(userID, keyHash, keyPrefix, name string, expiresAt *time.Time) (*models.APIKey, error)
-	GetAPIKeyByPrefix(keyPrefix string) ([]*models.APIKey, error) // Returns all keys with this prefix
+	GetAPIKeyByPrefix(keyPrefixes ...string) ([]*models.APIKey, error) // Returns all keys with any of these prefixes
 	GetAPIKeysByUserID(userID string) ([]*models.APIKey, error)
 	DeleteAPIKey(keyID string) error
+	// DeleteExpiredAPIKeys deletes the API keys that expired before expiredBefore and
+	// returns them; an empty userID covers every user's keys
+	DeleteExpiredAPIKeys(userID string, expiredBefore time.Time) ([]*DeletedAPIKey, error)
 	UpdateAPIKeyLastUsed(keyID string) error
+	// SetAPIKeyAllowedEndpoints replaces the endpoint patterns a key is restricted to (empty = unrestricted)
+	SetAPIKeyAllowedEndpoints(keyID string, endpoints []string) error
+	// SetAPIKeyHost binds a key to the host it may report as; ErrNotFound if the key does not exist
+	SetAPIKeyHost(keyID, hostID string) error
+
+	// Ingest receipt methods
+	SaveReceipt(receipt *models.Receipt, orgID string) error
+	// GetReceipt returns ErrNotFound if the receipt does not belong to the organization
+	GetReceipt(receiptID, orgID string) (*models.Receipt, error)
+
+	// Host probe methods
+	CreateProbeJob(job *models.ProbeJob, orgID string) error
+	// GetProbeJob returns the job with its results; ErrNotFound if it is not in the organization
+	GetProbeJob(jobID, orgID string) (*models.ProbeJob, error)
+	// ClaimProbeJob marks the oldest pending agent job as running and returns it;
+	// ErrNotFound if there is nothing to claim
+	ClaimProbeJob(orgID, claimedBy string) (*models.ProbeJob, error)
+	// CompleteProbeJob records the results of a running job and marks it completed.
+	// Results for hosts deleted since the job started are dropped.
+	// Returns ErrNotFound if the job is not in the organization and ErrProbeJobNotRunning
+	// if it is pending or already completed.
+	CompleteProbeJob(jobID, orgID string, results []*models.ProbeResult) error
 
 	// Organization methods
+	// Organization names are unique ignoring case: CreateOrganization returns ErrOrgNameTaken
+	// for a name that differs from an existing one only in case, and GetOrganizationByName
+	// finds the organization under any casing
 	CreateOrganization(name string) (*models.Organization, error)
 	GetOrganizationByID(orgID string) (*models.Organization, error)
 	GetOrganizationByName(name string) (*models.Organization, error)
 	CountUsersInOrganization(orgID string) (int, error)
+	// GetOrgStorageUsage returns the rows and bytes the organization's hosts and host events occupy
+	GetOrgStorageUsage(orgID string) (*models.OrgStorageUsage, error)
+
+	// RegisterUser atomically creates a new organization and its first (admin) user.
+	// Either both are created or neither is. Conflicts are reported as
+	// ErrUsernameTaken, ErrEmailTaken, ErrOrgNameTaken, or ErrOrgHasUsers.
+	RegisterUser(orgName, username, email, passwordHash string) (*models.User, error)
 
 	// User management methods (admin-only)
+	// Conditional writes take ifVersion, the resource version the caller last read; 0 writes
+	// unconditionally. They return ErrVersionMismatch if the resource has changed since.
 	ListUsersByOrganization(orgID string) ([]*models.User, error)
-	UpdateUserRole(userID, role string) error
-	DeleteUser(userID string) error
+	UpdateUserRole(userID, role string, ifVersion int64) error
+	DeleteUser(userID string, ifVersion int64) error
+
+	// Organization membership methods
+	// A user belongs to one organization (users.org_id) and can be made a member of others,
+	// with a role in each. GetOrgMembership and ListUserOrgMemberships report the user's own
+	// organization as a membership with Home set; it cannot be added, changed, or removed here.
+	// AddOrgMembership returns ErrAlreadyMember if the user belongs to or is a member of orgID
+	AddOrgMembership(userID, orgID, role string) (*models.OrgMembership, error)
+	UpdateOrgMembershipRole(userID, orgID, role string) error
+	DeleteOrgMembership(userID, orgID string) error
+	// GetOrgMembership returns ErrNotFound if the user cannot act in orgID
+	GetOrgMembership(userID, orgID string) (*models.OrgMembership, error)
+	// ListUserOrgMemberships returns the user's own organization first, then its memberships by name
+	ListUserOrgMemberships(userID string) ([]*models.OrgMembership, error)
+	// ListOrgMembers returns the memberships of users from other organizations in orgID, by username
+	ListOrgMembers(orgID string) ([]*models.OrgMembership, error)
+
+	// SetUserSystemAdmin grants or revokes the system-wide admin flag (is_admin),
+	// which is separate from the per-organization admin role
+	SetUserSystemAdmin(userID string, isAdmin bool) error
+
+	// Host tag methods
+	// SetHostTags replaces all tags on a host; returns ErrNotFound if the host is not in the organization
+	SetHostTags(hostID, orgID string, tags []string, actorUserID string, ifVersion int64) error
+	GetHostTags(hostID, orgID string) ([]string, error)
+	// GetHostMetadataVersion returns the version of a host's tags and details, which SetHostTags
+	// and UpdateHostDetails check against ifVersion; ingested reports do not change it
+	GetHostMetadataVersion(hostID, orgID string) (int64, error)
+
+	// UpdateHostDetails applies an edit to a host's display name and description and returns
+	// the recorded edited event; returns ErrNotFound if the host is not in the organization
+	UpdateHostDetails(hostID, orgID string, update models.UpdateHostRequest, actorUserID string, ifVersion int64) (*models.HostEvent, error)
+
+	// ArchiveHost hides a host from default lists, facets, and findings without deleting its data,
+	// and returns the recorded archived event. UnarchiveHost reverses it. Both return ErrNotFound
+	// if the host is not in the organization; ArchiveHost returns ErrHostArchived and
+	// UnarchiveHost ErrHostNotArchived if the host is already in that state.
+	ArchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error)
+	UnarchiveHost(hostID, orgID, actorUserID string) (*models.HostEvent, error)
+	// IsHostArchived returns ErrNotFound if the host is not in the organization
+	IsHostArchived(hostID, orgID string) (bool, error)
+
+	// GetHostFacets returns exact host counts per OS name, OS version, and tag for the organization,
+	// excluding archived hosts. Counts are pre-aggregated at write time, so this does not scan hosts
+	GetHostFacets(orgID string) (*models.HostFacets, error)
+
+	// Host event methods
+	// SaveHost, DeleteHost, SetHostTags, UpdateHostDetails, RestoreHost, ArchiveHost, and
+	// UnarchiveHost append to the host event stream and apply the event to the hosts projection atomically.
+	// ListHostEvents returns events with an ID greater than afterID, oldest first, optionally for
+	// a single host. Report payloads are only included when includeReports is set. Only the
+	// last ingested, updated, or restored event of a host keeps its full report; earlier ones
+	// keep the report's metadata and the OS name and version of its data.
+	ListHostEvents(orgID, hostID string, afterID int64, limit int, includeReports bool) ([]*models.HostEvent, error)
+	// LastHostEventID returns the ID of the organization's newest host event, or 0 if it has none
+	LastHostEventID(orgID string) (int64, error)
+	// RestoreHost brings back a deleted host with its last report, tags, and details
+	// Returns ErrNotFound if the host has no history and ErrHostNotDeleted if it exists
+	RestoreHost(hostID, orgID, actorUserID string) (*models.HostEvent, error)
+	// ReplayHostEvents rebuilds the organization's hosts, host tags, and host details from the event stream
+	// and returns the number of hosts replayed
+	ReplayHostEvents(orgID string) (int, error)
+	// SearchHostAccounts returns the local user accounts of the organization's hosts matching
+	// filter, ordered by username and hostname
+	SearchHostAccounts(orgID string, filter models.HostAccountFilter) ([]*models.HostAccount, error)
+	// SearchHostServices returns the listening ports of the organization's hosts matching
+	// filter, ordered by port, protocol, and hostname
+	SearchHostServices(orgID string, filter models.HostServiceFilter) ([]*models.HostService, error)
+	// ListEventHosts returns every host with events in the organization, or in all organizations
+	// when orgID is empty, ordered by organization
+	ListEventHosts(orgID string) ([]models.HostRef, error)
+	// ReplayHost rewrites one host's hosts row, tags, and details from its events
+	ReplayHost(hostID, orgID string) error
+	// PurgeDeletedHostEvents removes every event of the hosts deleted before before (and not
+	// restored or reported since), which can then no longer be restored, and returns how
+	// many events were removed
+	PurgeDeletedHostEvents(before time.Time) (int, error)
+	// RebuildFacetCounts recomputes the organization's host facet counters from its hosts
+	RebuildFacetCounts(orgID string) error
+	// GetFleetSnapshot returns the organization's hosts as they were just before at, with the
+	// OS, agent version, and tags of that time, ordered by hostname. Hosts archived at the time are left out.
+	GetFleetSnapshot(orgID string, at time.Time) ([]*models.FleetHost, error)
+	// ListHostReportTimes returns when each of the organization's hosts reported in [from, to),
+	// oldest first, preceded by the host's last report before from if it has one. hostID
+	// limits the result to one host; "" returns every host, including deleted ones.
+	ListHostReportTimes(orgID, hostID string, from, to time.Time) (map[string][]time.Time, error)
+
+	// Host access policy methods
+	// Policies are set per organization; an empty tag list means the user is not restricted by tags
+	GetHostAccessTags(userID, orgID string) ([]string, error)
+	SetHostAccessTags(userID, orgID string, tags []string) error
+
+	// Outbound action methods
+	CreateAction(action *models.Action, orgID string) error
+	GetAction(actionID, orgID string) (*models.Action, error)
+	ListActions(orgID string) ([]*models.Action, error)
+	// UpdateAction replaces an action's definition; returns ErrNotFound if it is not in the organization
+	// A zero schema version keeps the action's current one, and signing secrets are left unchanged
+	UpdateAction(action *models.Action, orgID string) error
+	// RotateActionSigningSecret replaces an action's signing secret, keeping the old one as the
+	// previous secret until previousExpiresAt, or dropping it when previousExpiresAt is nil
+	RotateActionSigningSecret(actionID, orgID, secret string, previousExpiresAt *time.Time) (*models.Action, error)
+	// DeleteAction removes an action and its run history
+	DeleteAction(actionID, orgID string) error
+	// CreateActionRun queues a run unless the action already has a run for the same finding
+	// (by models.Finding.Key) created after since; returns false if it was deduplicated
+	CreateActionRun(run *models.ActionRun, since time.Time) (bool, error)
+	// CountActionRuns returns the number of runs queued for an action since the given time
+	CountActionRuns(actionID string, since time.Time) (int, error)
+	GetActionRun(runID, orgID string) (*models.ActionRun, error)
+	// ListActionRuns returns up to limit of an action's runs, newest first
+	ListActionRuns(actionID, orgID string, limit int) ([]*models.ActionRun, error)
+	// ClaimActionRuns marks up to limit due runs, across organizations, as running until now+lease
+	// and returns them. Due runs are pending runs whose next attempt is due and running runs
+	// whose lease expired (e.g. after a crash).
+	ClaimActionRuns(now time.Time, lease time.Duration, limit int) ([]*models.ActionRun, error)
+	// FinishActionRun records the status, attempts, response, and next attempt of a claimed run
+	FinishActionRun(run *models.ActionRun) error
+	// RetryActionRun requeues a failed run with a fresh set of attempts
+	// Returns ErrNotFound if the run is not in the organization and ErrActionRunNotFailed if it has not failed
+	RetryActionRun(runID, orgID string) (*models.ActionRun, error)
+
+	// Organization secret methods
+	// Secret values are only read by GetOrgSecretValues, to render action templates
+	SetOrgSecret(orgID, name, value string) error
+	DeleteOrgSecret(orgID, name string) error
+	ListOrgSecrets(orgID string) ([]*models.OrgSecret, error)
+	GetOrgSecretValues(orgID string) (map[string]string, error)
+
+	// Webhook methods
+	CreateWebhook(webhook *models.Webhook, orgID string) error
+	// GetWebhook returns ErrNotFound if the webhook is not in the organization
+	GetWebhook(webhookID, orgID string) (*models.Webhook, error)
+	// ListWebhooks returns the organization's webhooks, oldest first
+	ListWebhooks(orgID string) ([]*models.Webhook, error)
+	// UpdateWebhook replaces a webhook's URL, events, and enabled flag; the signing secret is left unchanged
+	// Returns ErrNotFound if the webhook is not in the organization
+	UpdateWebhook(webhook *models.Webhook, orgID string) error
+	// DeleteWebhook removes a webhook and its delivery log
+	DeleteWebhook(webhookID, orgID string) error
+	// ListWebhookOrgs returns the IDs of organizations with an enabled webhook subscribed to eventType
+	ListWebhookOrgs(eventType string) ([]string, error)
+	// CreateWebhookDelivery queues a delivery. A non-empty dedupKey skips it if the webhook
+	// already has a delivery with the same key created after since; returns false if skipped.
+	CreateWebhookDelivery(delivery *models.WebhookDelivery, dedupKey string, since time.Time) (bool, error)
+	// ListWebhookDeliveries returns up to limit of a webhook's deliveries, newest first
+	ListWebhookDeliveries(webhookID, orgID string, limit int) ([]*models.WebhookDelivery, error)
+	// ClaimWebhookDeliveries marks up to limit due deliveries, across organizations, as running
+	// until now+lease and returns them, like ClaimActionRuns
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error)
+	// FinishWebhookDelivery records the status, attempts, response, and next attempt of a claimed delivery
+	FinishWebhookDelivery(delivery *models.WebhookDelivery) error
+	// DeleteWebhookDeliveries removes deliveries completed before the given time and returns how many
+	DeleteWebhookDeliveries(before time.Time) (int64, error)
+
+	// Audit log methods
+	// CreateAuditEvent appends an event to the organization's audit log and sets its ID and CreatedAt
+	CreateAuditEvent(event *models.AuditEvent) error
+	// ListAuditEvents returns a page of the organization's audit events matching filter,
+	// newest first, with an ID less than beforeID (0 starts at the newest event)
+	ListAuditEvents(orgID string, filter models.AuditFilter, beforeID int64, limit int) (*AuditPage, error)
+
+	// Prometheus remote-write methods
+	// GetRemoteWriteConfig returns ErrNotFound if the organization has no remote-write target
+	GetRemoteWriteConfig(orgID string) (*models.RemoteWriteConfig, error)
+	// SetRemoteWriteConfig creates or replaces the organization's remote-write target
+	// The organization settings below are versioned: Set requires config.Version to be the
+	// current version unless it is 0, and sets it to the new version.
+	SetRemoteWriteConfig(config *models.RemoteWriteConfig) error
+	DeleteRemoteWriteConfig(orgID string, ifVersion int64) error
+	// ClaimRemoteWriteConfigs returns the targets, across organizations, not pushed since
+	// now-interval and marks them pushed at now, so each is claimed once per interval
+	ClaimRemoteWriteConfigs(now time.Time, interval time.Duration) ([]*models.RemoteWriteConfig, error)
+	// RecordRemoteWriteResult stores the error of the organization's last push ("" on success)
+	RecordRemoteWriteResult(orgID, lastError string) error
+	// CountHostPackages returns the number of installed packages per host ID in the organization
+	CountHostPackages(orgID string) (map[string]int, error)
+
+	// Ingest filter methods
+	// GetIngestFilter returns ErrNotFound if the organization has no ingest filter
+	GetIngestFilter(orgID string) (*models.IngestFilter, error)
+	// SetIngestFilter creates or replaces the organization's ingest filter
+	SetIngestFilter(filter *models.IngestFilter) error
+	DeleteIngestFilter(orgID string, ifVersion int64) error
+
+	// Host tag rule methods
+	// GetHostTagRules returns ErrNotFound if the organization has no host tag rules
+	GetHostTagRules(orgID string) (*models.HostTagRules, error)
+	// SetHostTagRules creates or replaces the organization's host tag rules
+	SetHostTagRules(rules *models.HostTagRules) error
+	DeleteHostTagRules(orgID string, ifVersion int64) error
+
+	// Offline bundle import methods
+	// CreateImportBatch records the start of an import, filling in StartedAt
+	// Returns ErrBundleAlreadyImported if the organization completed an import of the same bundle
+	CreateImportBatch(batch *models.ImportBatch, orgID string) error
+	// FinishImportBatch records a batch's counts and results and marks it completed
+	FinishImportBatch(batch *models.ImportBatch, orgID string) error
+	// ListImportBatches returns up to limit of the organization's batches, newest first, without results
+	ListImportBatches(orgID string, limit int) ([]*models.ImportBatch, error)
+	GetImportBatch(batchID, orgID string) (*models.ImportBatch, error)
+	// ImportHost stores a bundled report as an updated event tagged with the batch, like SaveHost,
+	// unless the host already has a report received at or after the report's ReceivedAt, or was
+	// deleted after it. Returns whether the report was stored.
+	ImportHost(report *models.Report, orgID, uploadedByUserID, batchID string) (bool, error)
+
+	// Check-in schedule methods
+	// GetCheckinSchedule returns ErrNotFound if the organization has no check-in schedule
+	GetCheckinSchedule(orgID string) (*models.CheckinSchedule, error)
+	// SetCheckinSchedule creates or replaces the organization's check-in schedule
+	SetCheckinSchedule(schedule *models.CheckinSchedule) error
+	DeleteCheckinSchedule(orgID string, ifVersion int64) error
+	// ListCheckinSchedules returns the schedules of every organization
+	ListCheckinSchedules() ([]*models.CheckinSchedule, error)
+	// ListHostOrgIDs returns the organizations with unarchived hosts
+	ListHostOrgIDs() ([]string, error)
+	// MarkStaleHosts marks the organization's hosts in stale as stale since now and clears the
+	// mark of its other unarchived hosts. stale maps each host ID to the last report it was
+	// found stale on; a host that has reported since is not marked. Returns the number of
+	// hosts newly marked
+	MarkStaleHosts(orgID string, stale map[string]time.Time, now time.Time) (int, error)
+
+	// Host report history methods
+	// SaveHostReport adds a report stored by SaveHost to its host's history, then removes all but
+	// the keep newest reports of the host; keep 0 stores nothing and clears the history
+	SaveHostReport(report *models.HostReport, orgID string, keep int) error
+	// ListHostReports returns a host's report history without report data, newest first
+	ListHostReports(hostID, orgID string) ([]*models.HostReport, error)
+	// GetHostReportByID returns a report from a host's history with its data
+	// Returns ErrNotFound if the report is not in the host's history
+	GetHostReportByID(reportID, hostID, orgID string) (*models.HostReport, error)
+	// GetHostReportRetention returns ErrNotFound if the organization uses the server default
+	GetHostReportRetention(orgID string) (*models.HostReportRetention, error)
+	// SetHostReportRetention creates or replaces the organization's host report retention
+	SetHostReportRetention(retention *models.HostReportRetention) error
+	DeleteHostReportRetention(orgID string, ifVersion int64) error
+	// CountExcessHostReports counts the reports past the keep newest of each of the
+	// organization's hosts, which PruneHostReports would delete
+	CountExcessHostReports(orgID string, keep int) (int, error)
+	// PruneHostReports removes all but the keep newest reports of each of the organization's
+	// hosts and returns how many were removed
+	PruneHostReports(orgID string, keep int) (int, error)
+	// EnsureHostReportPartitions creates the monthly partitions of the history from the month
+	// of from through the month of to (UTC) that do not exist yet, and returns their names
+	EnsureHostReportPartitions(from, to time.Time) ([]string, error)
+	// DropHostReportPartitions removes the history of every month that ended by the start of
+	// before's month, dropping their partitions, and returns the partitions dropped
+	DropHostReportPartitions(before time.Time) ([]string, error)
+
+	// Fleet report methods
+	// CreateFleetReport stores a generated report and sets its creation time
+	CreateFleetReport(report *models.FleetReport) error
+	// GetFleetReport returns a report with its content; ErrNotFound if it is not in the organization
+	GetFleetReport(reportID, orgID string) (*models.FleetReport, error)
+	// ListFleetReports returns up to limit of the organization's reports without content, newest first
+	ListFleetReports(orgID string, limit int) ([]*models.FleetReport, error)
+
+	// Report schedule methods
+	// GetReportSchedule returns ErrNotFound if the organization has no report schedule
+	GetReportSchedule(orgID string) (*models.ReportSchedule, error)
+	// SetReportSchedule creates or replaces the organization's report schedule
+	SetReportSchedule(schedule *models.ReportSchedule) error
+	DeleteReportSchedule(orgID string, ifVersion int64) error
+	// ClaimReportSchedules returns the schedules due at now, across organizations, and
+	// moves each to its next run so every run is claimed once
+	ClaimReportSchedules(now time.Time) ([]*models.ReportSchedule, error)
+
+	// Delegated token (OAuth client) methods
+	// CreateOAuthClient stores the client under its ID and sets its creation time
+	CreateOAuthClient(client *models.OAuthClient) error
+	ListOAuthClients(orgID string) ([]*models.OAuthClient, error)
+	// GetOAuthClient looks a client up by ID across organizations; ErrNotFound if it does not exist
+	GetOAuthClient(clientID string) (*models.OAuthClient, error)
+	// DeleteOAuthClient also revokes every grant of the client
+	DeleteOAuthClient(clientID, orgID string) error
+	// CreateOAuthCode stores an authorization code and drops expired ones
+	CreateOAuthCode(code *models.OAuthCode) error
+	// ConsumeOAuthCode deletes and returns the code; ErrNotFound if it is unknown, used, or expired at now
+	ConsumeOAuthCode(codeHash string, now time.Time) (*models.OAuthCode, error)
+	// CreateOAuthGrant stores the grant, with its token pair, under its ID and sets its creation time
+	CreateOAuthGrant(grant *models.OAuthGrant) error
+	// RotateOAuthToken replaces the token pair holding refreshHash with token and returns the grant;
+	// ErrNotFound if the refresh token is unknown or was issued to another client
+	RotateOAuthToken(clientID, refreshHash string, token models.OAuthToken) (*models.OAuthGrant, error)
+	// GetOAuthGrantByAccessToken returns ErrNotFound if the access token is unknown or expired at now
+	GetOAuthGrantByAccessToken(accessHash string, now time.Time) (*models.OAuthGrant, error)
+	UpdateOAuthGrantLastUsed(grantID string) error
+	// ListOAuthGrants returns the user's grants, newest first
+	ListOAuthGrants(userID string) ([]*models.OAuthGrant, error)
+	// DeleteOAuthGrant returns ErrNotFound if the grant is not the user's
+	DeleteOAuthGrant(grantID, userID string) error
+	// RevokeOAuthToken deletes the client's grant holding the access or refresh token, if any
+	RevokeOAuthToken(clientID, tokenHash string) error
+
+	// Session methods
+	// CreateSession stores the session, with its token pair, under its ID, sets its creation
+	// time, and drops the user's expired sessions
+	CreateSession(session *models.Session) error
+	// RotateSessionToken replaces the token pair holding refreshHash with token and returns the
+	// session; ErrNotFound if the refresh token is unknown or its session expired at now
+	RotateSessionToken(refreshHash string, token models.SessionToken, now time.Time) (*models.Session, error)
+	// GetSessionByAccessToken returns ErrNotFound if the access token is unknown or expired at now
+	GetSessionByAccessToken(accessHash string, now time.Time) (*models.Session, error)
+	UpdateSessionLastUsed(sessionID string) error
+	// DeleteSession returns ErrNotFound if the session is not the user's
+	DeleteSession(sessionID, userID string) error
+
+	// Impersonation methods
+	// CreateImpersonationToken stores the token under its ID, sets its creation time, and drops
+	// expired tokens
+	CreateImpersonationToken(token *models.ImpersonationToken) error
+	// GetImpersonationToken returns ErrNotFound if the token is unknown or expired at now
+	GetImpersonationToken(tokenHash string, now time.Time) (*models.ImpersonationToken, error)
+
+	// Agent enrollment methods
+	// CreateEnrollmentToken stores the token under its ID and sets its creation time
+	CreateEnrollmentToken(token *models.EnrollmentToken) error
+	// ListEnrollmentTokens returns the organization's tokens, expired and used up ones included
+	ListEnrollmentTokens(orgID string) ([]*models.EnrollmentToken, error)
+	// DeleteEnrollmentToken returns ErrNotFound if the token is not in the organization.
+	// API keys issued with the token are kept.
+	DeleteEnrollmentToken(tokenID, orgID string) error
+	// RedeemEnrollmentToken counts a use of the token and returns it, or ErrNotFound if the
+	// token is unknown, expired at now, or has no uses left
+	RedeemEnrollmentToken(tokenHash string, now time.Time) (*models.EnrollmentToken, error)
+
+	// Database administration methods
+	// ListDBActivity returns the database backends opened by snailbus, excluding the caller's own
+	ListDBActivity(ctx context.Context) ([]*models.DBActivity, error)
+	// CancelDBQuery cancels the running query on a snailbus backend, or terminates the backend
+	// entirely if terminate is set. Returns ErrNotFound if pid is not a snailbus backend.
+	CancelDBQuery(ctx context.Context, pid int, terminate bool) error
+	// ReplicationStatus reports the primary's role and the read replica's last health check
+	ReplicationStatus(ctx context.Context) (*models.ReplicationStatus, error)
+	// DatabaseDiagnostics reports the applied migration version and connection pool statistics
+	DatabaseDiagnostics(ctx context.Context) (*models.DatabaseDiagnostics, error)
+	// DatabasePrivileges reports the table privileges the server's role lacks and the ways
+	// it can still change the schema
+	DatabasePrivileges(ctx context.Context) (*models.DatabasePrivileges, error)
+	// DBMaintenance reports the size, dead tuples, and vacuum activity of the snailbus
+	// tables, with suggested storage and vacuum changes
+	DBMaintenance(ctx context.Context) (*models.DBMaintenance, error)
+
+	// Background job methods
+	// LockJob takes a scheduled job's lock for one run, so that replicas do not run it at
+	// the same time. Returns false if another run holds it; otherwise unlock releases it.
+	LockJob(ctx context.Context, name string) (unlock func(), locked bool, err error)
+	// StartJobRun records that runner started a run of the job at startedAt
+	StartJobRun(name, runner string, startedAt time.Time) error
+	// FinishJobRun records the end of the job's current run; runErr is empty if it succeeded
+	FinishJobRun(name string, finishedAt time.Time, runErr string) error
+	// ListJobStatuses returns the last run of every job that has run, by name, without
+	// their intervals, which are known only to the scheduler
+	ListJobStatuses() ([]*models.JobStatus, error)
+
+	// Feature flag methods
+	// ListFeatureFlags returns every flag with its organization overrides, by name
+	ListFeatureFlags() ([]*models.FeatureFlag, error)
+	// SetFeatureFlag creates a flag or replaces its description and default, keeping its overrides
+	SetFeatureFlag(name, description string, enabled bool) (*models.FeatureFlag, error)
+	DeleteFeatureFlag(name string) error
+	// SetFeatureFlagOverride returns ErrNotFound if the flag does not exist
+	SetFeatureFlagOverride(name, orgID string, enabled bool) error
+	DeleteFeatureFlagOverride(name, orgID string) error
+
+	// IOC list methods
+	// CreateIOCList stores a list with its indicators under its ID and sets its timestamps
+	// Returns ErrIOCListNameTaken if the organization has a list of the same name
+	CreateIOCList(list *models.IOCList, orgID string) error
+	// ReplaceIOCList replaces a list's name, format, and indicators, and removes the matches
+	// of indicators it no longer has; ErrNotFound if the list is not in the organization
+	ReplaceIOCList(list *models.IOCList, orgID string) error
+	// ListIOCLists returns the organization's lists with indicator counts but without indicators, by name
+	ListIOCLists(orgID string) ([]*models.IOCList, error)
+	// GetIOCList returns a list with its indicators; ErrNotFound if it is not in the organization
+	GetIOCList(listID, orgID string) (*models.IOCList, error)
+	// DeleteIOCList removes a list with its indicators and matches
+	DeleteIOCList(listID, orgID string) error
+	// GetIOCIndicators returns every list of the organization that has indicators, with them, to match reports against
+	GetIOCIndicators(orgID string) ([]*models.IOCList, error)
+	// RecordIOCMatches stores the matches found in a host's report, updating where and when
+	// known ones were last seen, and returns the matches the host had not had before
+	RecordIOCMatches(orgID, hostID string, matches []models.IOCMatch, seenAt time.Time) ([]models.IOCMatch, error)
+	// ListIOCMatches returns up to filter.Limit of the organization's matches selected by filter,
+	// most recently seen first
+	ListIOCMatches(orgID string, filter models.IOCMatchFilter) ([]*models.IOCMatch, error)
+
+	// Host group methods
+	// CreateHostGroup stores a group without members under its ID and sets its timestamps
+	// Returns ErrHostGroupNameTaken if the organization has a group of the same name
+	CreateHostGroup(group *models.HostGroup, orgID string) error
+	// UpdateHostGroup replaces a group's name, description, and rule, keeping its members, and
+	// fills in the rest of group; ErrNotFound if the group is not in the organization
+	UpdateHostGroup(group *models.HostGroup, orgID string) error
+	// ListHostGroups returns the organization's groups with their static members, by name
+	ListHostGroups(orgID string) ([]*models.HostGroup, error)
+	// GetHostGroup returns a group with its static members; ErrNotFound if it is not in the organization
+	GetHostGroup(groupID, orgID string) (*models.HostGroup, error)
+	// DeleteHostGroup removes a group; its hosts are not affected
+	DeleteHostGroup(groupID, orgID string) error
+	// AddHostGroupMember adds a host to a group's static members; adding a member again does nothing
+	// Returns ErrNotFound if the group or the host is not in the organization
+	AddHostGroupMember(groupID, orgID, hostID, actorUserID string) error
+	// RemoveHostGroupMember removes a host from a group's static members
+	// Returns ErrNotFound if the group is not in the organization or the host is not a static member
+	RemoveHostGroupMember(groupID, orgID, hostID string) error
 }
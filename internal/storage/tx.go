@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dbConn runs queries: the connection pool, a replica, or a transaction
+type dbConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// dbTx is a transaction begun by a storage method
+type dbTx interface {
+	dbConn
+	Commit() error
+	Rollback() error
+}
+
+// database is where PostgresStorage runs its queries. Methods that need several
+// statements to apply together Begin a transaction on it; inside WithTx that
+// transaction is a savepoint of the caller's, so it commits or rolls back with it.
+type database interface {
+	dbConn
+	Begin() (dbTx, error)
+}
+
+// poolDB is the database outside of WithTx
+type poolDB struct {
+	*sql.DB
+}
+
+// Begin starts a transaction on a pooled connection
+func (db poolDB) Begin() (dbTx, error) {
+	return db.DB.Begin()
+}
+
+// txDB is the database inside WithTx
+type txDB struct {
+	*sql.Tx
+	savepoints *int // Savepoints begun so far, to name the next one
+}
+
+// Begin starts a savepoint of the transaction
+func (db txDB) Begin() (dbTx, error) {
+	*db.savepoints++
+	name := fmt.Sprintf("sp_%d", *db.savepoints)
+	if _, err := db.Tx.Exec("SAVEPOINT " + name); err != nil {
+		return nil, err
+	}
+	return &savepoint{Tx: db.Tx, name: name}, nil
+}
+
+// savepoint is a dbTx nested in a WithTx transaction
+type savepoint struct {
+	*sql.Tx
+	name string
+	done bool
+}
+
+// Commit releases the savepoint; its changes commit with the enclosing transaction
+func (sp *savepoint) Commit() error {
+	if sp.done {
+		return sql.ErrTxDone
+	}
+	sp.done = true
+	_, err := sp.Tx.Exec("RELEASE SAVEPOINT " + sp.name)
+	return err
+}
+
+// Rollback undoes the changes made since the savepoint, unless it was committed
+func (sp *savepoint) Rollback() error {
+	if sp.done {
+		return sql.ErrTxDone
+	}
+	sp.done = true
+	_, err := sp.Tx.Exec("ROLLBACK TO SAVEPOINT " + sp.name)
+	return err
+}
+
+// WithTx runs fn in a transaction on the primary. Methods that begin their own
+// transaction run it as a savepoint, and so does a nested WithTx. Streaming reads take
+// their own connection (IterateHosts, IterateHostBatches) and do not see tx's changes.
+func (ps *PostgresStorage) WithTx(fn func(tx Storage) error) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	txStorage := *ps
+	switch tx := tx.(type) {
+	case *sql.Tx:
+		txStorage.db = txDB{Tx: tx, savepoints: new(int)}
+	default:
+		// Nested WithTx: the savepoint shares the enclosing transaction's database
+		txStorage.db = ps.db
+	}
+	if err := fn(&txStorage); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", classifyError(err))
+	}
+	return nil
+}
+
+// inTx reports whether the storage is the tx of a WithTx
+func (ps *PostgresStorage) inTx() bool {
+	_, ok := ps.db.(txDB)
+	return ok
+}
+
+// connDB is the database inside WithConn: one connection, taken from the pool on the
+// first query so requests that never reach the database do not hold one
+type connDB struct {
+	ps   *PostgresStorage // Storage the connection is taken from
+	ctx  context.Context  // Carries the query tag; statements are not cancelled with it
+	conn *sql.Conn
+}
+
+// get returns the connection, taking it from the pool if this is the first query
+func (db *connDB) get() (*sql.Conn, error) {
+	if db.conn == nil {
+		conn, err := db.ps.conn(db.ctx)
+		if err != nil {
+			return nil, err
+		}
+		db.conn = conn
+	}
+	return db.conn, nil
+}
+
+func (db *connDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(db.ctx, query, args...)
+}
+
+func (db *connDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	conn, err := db.get()
+	if err != nil {
+		return nil, err
+	}
+	return conn.ExecContext(ctx, query, args...)
+}
+
+func (db *connDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(db.ctx, query, args...)
+}
+
+func (db *connDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := db.get()
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+func (db *connDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(db.ctx, query, args...)
+}
+
+// QueryRowContext runs the query on the pool if no connection could be taken, since a
+// *sql.Row cannot carry the error; the pool then reports the same failure
+func (db *connDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	conn, err := db.get()
+	if err != nil {
+		return db.ps.pool.QueryRowContext(ctx, query, args...)
+	}
+	return conn.QueryRowContext(ctx, query, args...)
+}
+
+func (db *connDB) Prepare(query string) (*sql.Stmt, error) {
+	conn, err := db.get()
+	if err != nil {
+		return nil, err
+	}
+	return conn.PrepareContext(db.ctx, query)
+}
+
+// Begin starts a transaction on the connection
+func (db *connDB) Begin() (dbTx, error) {
+	conn, err := db.get()
+	if err != nil {
+		return nil, err
+	}
+	return conn.BeginTx(db.ctx, nil)
+}
+
+// WithConn runs fn with a storage whose queries share one connection, named after the
+// query tag of ctx (see conn). Inside WithTx or another WithConn, fn gets ps itself.
+func (ps *PostgresStorage) WithConn(ctx context.Context, fn func(conn Storage) error) error {
+	if _, ok := ps.db.(poolDB); !ok || queryTag(ctx) == "" {
+		return fn(ps)
+	}
+
+	db := &connDB{ps: ps, ctx: context.WithoutCancel(ctx)}
+	defer func() {
+		if db.conn != nil {
+			ps.releaseConn(db.conn)
+		}
+	}()
+	connStorage := *ps
+	connStorage.db = db
+	return fn(&connStorage)
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMockStorage_WithTx(t *testing.T) {
+	store := NewMockStorage()
+
+	org, err := store.CreateOrganization("Test Org")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error = %v", err)
+	}
+	user, err := store.CreateUser("testuser", "test@example.com", "hash", org.ID, "viewer")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// A failed fn discards everything it did, including changes to existing records
+	errAbort := errors.New("abort")
+	err = store.WithTx(func(tx Storage) error {
+		if _, err := tx.CreateUser("rolledback", "rolledback@example.com", "hash", org.ID, "viewer"); err != nil {
+			return err
+		}
+		if err := tx.UpdateUserRole(user.ID, "admin", 0); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx() error = %v, want fn's error", err)
+	}
+	if _, _, err := store.GetUserByUsername("rolledback"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserByUsername() after rollback error = %v, want ErrNotFound", err)
+	}
+	if got, _ := store.GetUserByID(user.ID); got.Role != "viewer" {
+		t.Errorf("role after rollback = %q, want viewer", got.Role)
+	}
+
+	// So does a panic
+	func() {
+		defer func() { recover() }()
+		store.WithTx(func(tx Storage) error {
+			tx.CreateUser("panicked", "panicked@example.com", "hash", org.ID, "viewer")
+			panic("boom")
+		})
+	}()
+	if _, _, err := store.GetUserByUsername("panicked"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserByUsername() after panic error = %v, want ErrNotFound", err)
+	}
+
+	// A successful fn keeps its changes
+	err = store.WithTx(func(tx Storage) error {
+		_, err := tx.CreateUser("committed", "committed@example.com", "hash", org.ID, "viewer")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	if _, _, err := store.GetUserByUsername("committed"); err != nil {
+		t.Errorf("GetUserByUsername() after commit error = %v", err)
+	}
+}
@@ -44,12 +44,7 @@ func CreateTestUser(store storage.Storage, username, email, password, orgID, rol
 // CreateTestAPIKey creates a test API key for a user.
 // Returns the plain API key (to use in requests) and the APIKey model, or an error.
 func CreateTestAPIKey(store storage.Storage, userID, name string) (string, *models.APIKey, error) {
-	plainKey, keyHash, keyPrefix, err := auth.GenerateAPIKey()
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
-	}
-
-	apiKey, err := store.CreateAPIKey(userID, keyHash, keyPrefix, name, nil)
+	plainKey, apiKey, err := storage.GenerateAPIKey(store, userID, name, nil)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to create test API key: %w", err)
 	}
@@ -0,0 +1,311 @@
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/auth"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// Fleet defaults, used for zero FleetOptions fields
+const (
+	DefaultFleetOrgs        = 1
+	DefaultFleetHostsPerOrg = 100
+	DefaultFleetMinPackages = 200
+	DefaultFleetMaxPackages = 1500
+)
+
+// FleetOptions configures a synthetic fleet; zero values use the defaults
+type FleetOptions struct {
+	Orgs        int
+	HostsPerOrg int
+	Seed        int64 // Fleets with the same seed and options are identical
+	MinPackages int   // Installed packages per host, the main driver of report size
+	MaxPackages int
+	OrgPrefix   string // Organization names are <prefix>-<n>; "loadtest" by default
+}
+
+// Fleet generates reports for a synthetic fleet of Orgs organizations with
+// HostsPerOrg hosts each, for load and performance tests.
+//
+// A host always has the same ID, hostname, OS, and roles, so hosts report again
+// instead of piling up; its packages, uptime, and listening ports vary from report to
+// report like on a real machine. Operating systems follow a skewed mix, and package
+// counts a log-normal distribution between MinPackages and MaxPackages, so report
+// sizes spread from tens to hundreds of kilobytes. Reports are generated on demand,
+// so fleets of millions of hosts need no memory up front.
+type Fleet struct {
+	opts FleetOptions
+}
+
+// NewFleet creates a fleet generator
+func NewFleet(opts FleetOptions) *Fleet {
+	if opts.Orgs <= 0 {
+		opts.Orgs = DefaultFleetOrgs
+	}
+	if opts.HostsPerOrg <= 0 {
+		opts.HostsPerOrg = DefaultFleetHostsPerOrg
+	}
+	if opts.MinPackages <= 0 {
+		opts.MinPackages = DefaultFleetMinPackages
+	}
+	if opts.MaxPackages < opts.MinPackages {
+		opts.MaxPackages = max(opts.MinPackages, DefaultFleetMaxPackages)
+	}
+	if opts.OrgPrefix == "" {
+		opts.OrgPrefix = "loadtest"
+	}
+	return &Fleet{opts: opts}
+}
+
+// Orgs returns the number of organizations
+func (f *Fleet) Orgs() int {
+	return f.opts.Orgs
+}
+
+// HostsPerOrg returns the number of hosts in each organization
+func (f *Fleet) HostsPerOrg() int {
+	return f.opts.HostsPerOrg
+}
+
+// OrgName returns the name of the org-th organization, counting from 0
+func (f *Fleet) OrgName(org int) string {
+	return fmt.Sprintf("%s-%03d", f.opts.OrgPrefix, org+1)
+}
+
+// HostID returns the ID of a host
+func (f *Fleet) HostID(org, host int) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("snailbus-fleet:%d/%d/%d", f.opts.Seed, org, host))).String()
+}
+
+// fleetDistros is the OS mix of the fleet, weighted by share
+var fleetDistros = []struct {
+	name, version, major, minor string
+	kernel                      string
+	weight                      int
+}{
+	{"Red Hat Enterprise Linux", "9.4", "9", "4", "5.14.0-427.13.1.el9_4.x86_64", 25},
+	{"Red Hat Enterprise Linux", "8.10", "8", "10", "4.18.0-553.el8_10.x86_64", 10},
+	{"Ubuntu", "22.04", "22", "04", "5.15.0-113-generic", 18},
+	{"Ubuntu", "24.04", "24", "04", "6.8.0-35-generic", 8},
+	{"Debian", "12.5", "12", "5", "6.1.0-21-amd64", 12},
+	{"Rocky Linux", "9.3", "9", "3", "5.14.0-362.24.1.el9_3.x86_64", 10},
+	{"Fedora", "42", "42", "", "6.14.2-300.fc42.x86_64", 9},
+	{"Fedora", "41", "41", "", "6.11.4-301.fc41.x86_64", 5},
+	{"Amazon Linux", "2023", "2023", "", "6.1.94-99.176.amzn2023.x86_64", 3},
+}
+
+// fleetRoles are the kinds of hosts in the fleet
+var fleetRoles = []struct {
+	prefix   string
+	packages []string
+	ports    []fleetPort
+}{
+	{"web", []string{"nginx", "openssl", "certbot"}, []fleetPort{{"tcp", 80, "nginx"}, {"tcp", 443, "nginx"}}},
+	{"app", []string{"python3", "gunicorn", "nodejs"}, []fleetPort{{"tcp", 8000, "gunicorn"}, {"tcp", 3000, "node"}}},
+	{"db", []string{"postgresql-server", "pgbouncer"}, []fleetPort{{"tcp", 5432, "postgres"}, {"tcp", 6432, "pgbouncer"}}},
+	{"cache", []string{"redis", "memcached"}, []fleetPort{{"tcp", 6379, "redis-server"}, {"tcp", 11211, "memcached"}}},
+	{"k8s", []string{"containerd", "kubelet", "kubectl"}, []fleetPort{{"tcp", 10250, "kubelet"}, {"tcp", 10256, "kube-proxy"}}},
+	{"ci", []string{"git", "podman", "golang"}, []fleetPort{{"tcp", 9100, "node_exporter"}}},
+}
+
+type fleetPort struct {
+	protocol string
+	number   int
+	process  string
+}
+
+// basePackages are installed on every host
+var basePackages = []string{
+	"bash", "coreutils", "glibc", "systemd", "openssh-server", "openssl-libs", "sudo", "curl", "ca-certificates",
+	"tzdata", "chrony", "rsyslog", "vim-minimal", "less", "tar", "gzip", "xz", "zlib", "libcurl", "krb5-libs",
+}
+
+// packageWords name the filler packages making up the rest of a host's package list
+var packageWords = []string{
+	"lib", "python3", "perl", "golang", "rust", "java", "font", "gnome", "qt5", "texlive", "kernel", "firmware",
+	"selinux", "util", "devel", "tools", "common", "data", "plugin", "doc",
+}
+
+// rngFor returns a random source for one host, or one report of a host when report >= 0
+func (f *Fleet) rngFor(org, host int, report int64) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d/%d/%d", f.opts.Seed, org, host, report)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// Request builds the ingest request of a host's report collected at collectedAt
+// Reports of the same host collected at different times differ in their
+// volatile fields only.
+func (f *Fleet) Request(org, host int, collectedAt time.Time) *models.IngestRequest {
+	stable := f.rngFor(org, host, -1)
+	volatile := f.rngFor(org, host, collectedAt.UnixNano())
+
+	role := fleetRoles[stable.Intn(len(fleetRoles))]
+	distro := fleetDistros[weightedIndex(stable)]
+	hostname := fmt.Sprintf("%s-%05d.%s.fleet.snailbus.test", role.prefix, host+1, f.OrgName(org))
+	hostID := f.HostID(org, host)
+
+	// Package counts are log-normal: most hosts are near the low end, a few are huge
+	spread := math.Log(float64(f.opts.MaxPackages) / float64(f.opts.MinPackages))
+	fraction := math.Min(1, math.Abs(stable.NormFloat64())/3)
+	count := int(float64(f.opts.MinPackages) * math.Exp(spread*fraction))
+
+	packages := make([]map[string]string, 0, count)
+	addPackage := func(name string) {
+		packages = append(packages, map[string]string{
+			"name":    name,
+			"version": fmt.Sprintf("%d.%d.%d", 1+stable.Intn(5), stable.Intn(30), stable.Intn(20)),
+			"release": fmt.Sprintf("%d.%s", 1+volatile.Intn(3), distro.major),
+			"arch":    "x86_64",
+		})
+	}
+	for _, name := range basePackages {
+		addPackage(name)
+	}
+	for _, name := range role.packages {
+		addPackage(name)
+	}
+	for i := len(packages); i < count; i++ {
+		addPackage(fmt.Sprintf("%s-%s-%d", packageWords[stable.Intn(len(packageWords))],
+			packageWords[stable.Intn(len(packageWords))], i))
+	}
+
+	ports := []map[string]interface{}{
+		{"protocol": "tcp", "address": "0.0.0.0", "port": 22, "process": "sshd", "pid": 1000 + volatile.Intn(30000)},
+	}
+	for _, p := range role.ports {
+		ports = append(ports, map[string]interface{}{
+			"protocol": p.protocol, "address": "0.0.0.0", "port": p.number, "process": p.process,
+			"pid": 1000 + volatile.Intn(30000),
+		})
+	}
+
+	users := []map[string]interface{}{
+		{"name": "root", "uid": 0, "gid": 0, "home": "/root", "shell": "/bin/bash"},
+	}
+	for i := 0; i < 1+stable.Intn(6); i++ {
+		name := fmt.Sprintf("user%02d", i)
+		users = append(users, map[string]interface{}{
+			"name": name, "uid": 1000 + i, "gid": 1000 + i, "home": "/home/" + name, "shell": "/bin/bash",
+		})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"system": map[string]interface{}{
+			"hostname": hostname,
+			"os": map[string]string{
+				"name":          distro.name,
+				"version":       distro.version,
+				"version_major": distro.major,
+				"version_minor": distro.minor,
+			},
+			"kernel":         distro.kernel,
+			"architecture":   "x86_64",
+			"cpu_count":      []int{2, 4, 8, 16, 32, 64}[stable.Intn(6)],
+			"memory_bytes":   int64(1+stable.Intn(64)) << 30,
+			"uptime_seconds": volatile.Intn(180 * 24 * 3600),
+		},
+		"packages": map[string]interface{}{"installed": packages},
+		"network":  map[string]interface{}{"listening_ports": ports},
+		"users":    users,
+	})
+
+	req := &models.IngestRequest{
+		Meta: models.ReportMeta{
+			Hostname:     hostname,
+			HostID:       hostID,
+			CollectionID: uuid.NewSHA1(uuid.NameSpaceURL, []byte(hostID+"/"+collectedAt.String())).String(),
+			Timestamp:    collectedAt.UTC().Format(time.RFC3339),
+			SnailVersion: "0.5.0",
+		},
+		Data: data,
+	}
+	// A few collections partly fail, as on real fleets
+	if volatile.Intn(50) == 0 {
+		req.Errors = []string{"packages: rpm database is locked by another process"}
+	}
+	return req
+}
+
+// Report builds a host's report as stored, received at collectedAt
+func (f *Fleet) Report(org, host int, collectedAt time.Time) *models.Report {
+	req := f.Request(org, host, collectedAt)
+	return &models.Report{
+		ID:         req.Meta.HostID,
+		ReceivedAt: collectedAt.UTC().Truncate(time.Second),
+		Meta:       req.Meta,
+		Data:       req.Data,
+		Errors:     req.Errors,
+	}
+}
+
+// weightedIndex picks an index of fleetDistros by weight
+func weightedIndex(rng *rand.Rand) int {
+	total := 0
+	for _, d := range fleetDistros {
+		total += d.weight
+	}
+	n := rng.Intn(total)
+	for i, d := range fleetDistros {
+		if n < d.weight {
+			return i
+		}
+		n -= d.weight
+	}
+	return len(fleetDistros) - 1
+}
+
+// FleetOrg is an organization created by Fleet.Seed, with an editor and its API key
+type FleetOrg struct {
+	Organization *models.Organization `json:"organization"`
+	User         *models.User         `json:"user"`
+	APIKey       string               `json:"api_key"`
+}
+
+// Seed creates the fleet's organizations, each with an editor and an API key for
+// ingesting. With withHosts, the hosts' reports are saved directly too, collected
+// at now, for tests of reads over a large fleet.
+func (f *Fleet) Seed(store storage.Storage, withHosts bool, now time.Time) ([]*FleetOrg, error) {
+	passwordHash, err := auth.HashPassword("loadtest-" + uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]*FleetOrg, 0, f.opts.Orgs)
+	for org := 0; org < f.opts.Orgs; org++ {
+		name := f.OrgName(org)
+		o, err := store.CreateOrganization(name)
+		if err != nil {
+			return orgs, fmt.Errorf("failed to create organization %s: %w", name, err)
+		}
+		username := name + "-ingest"
+		user, err := store.CreateUser(username, username+"@fleet.snailbus.test", passwordHash, o.ID, "editor")
+		if err != nil {
+			return orgs, fmt.Errorf("failed to create user %s: %w", username, err)
+		}
+		plainKey, _, err := storage.GenerateAPIKey(store, user.ID, "Load test", nil)
+		if err != nil {
+			return orgs, fmt.Errorf("failed to create API key for %s: %w", username, err)
+		}
+		orgs = append(orgs, &FleetOrg{Organization: o, User: user, APIKey: plainKey})
+
+		if !withHosts {
+			continue
+		}
+		for host := 0; host < f.opts.HostsPerOrg; host++ {
+			if err := store.SaveHost(f.Report(org, host, now), o.ID, user.ID); err != nil {
+				return orgs, fmt.Errorf("failed to save host %d of %s: %w", host, name, err)
+			}
+		}
+	}
+	return orgs, nil
+}
@@ -0,0 +1,61 @@
+package testutils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/storage"
+)
+
+func TestFleet_Request(t *testing.T) {
+	fleet := NewFleet(FleetOptions{Orgs: 2, HostsPerOrg: 50, MinPackages: 20, MaxPackages: 400, Seed: 7})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	first := fleet.Request(1, 3, now)
+	again := fleet.Request(1, 3, now)
+	assert.Equal(t, first, again, "the same report is generated every time")
+
+	later := fleet.Request(1, 3, now.Add(time.Hour))
+	assert.Equal(t, first.Meta.HostID, later.Meta.HostID)
+	assert.Equal(t, first.Meta.Hostname, later.Meta.Hostname)
+	assert.NotEqual(t, first.Meta.CollectionID, later.Meta.CollectionID)
+
+	assert.NotEqual(t, first.Meta.HostID, fleet.Request(0, 3, now).Meta.HostID)
+	assert.Equal(t, "loadtest-002", fleet.OrgName(1))
+
+	// Package counts stay within bounds and vary between hosts
+	counts := map[int]bool{}
+	for host := 0; host < fleet.HostsPerOrg(); host++ {
+		var data struct {
+			Packages struct {
+				Installed []json.RawMessage `json:"installed"`
+			} `json:"packages"`
+		}
+		require.NoError(t, json.Unmarshal(fleet.Request(0, host, now).Data, &data))
+		n := len(data.Packages.Installed)
+		assert.GreaterOrEqual(t, n, 20)
+		assert.LessOrEqual(t, n, 400)
+		counts[n] = true
+	}
+	assert.Greater(t, len(counts), 10)
+}
+
+func TestFleet_Seed(t *testing.T) {
+	store := storage.NewMockStorage()
+	fleet := NewFleet(FleetOptions{Orgs: 2, HostsPerOrg: 3, MinPackages: 10, MaxPackages: 20})
+
+	orgs, err := fleet.Seed(store, true, time.Now())
+	require.NoError(t, err)
+	require.Len(t, orgs, 2)
+	for _, org := range orgs {
+		assert.NotEmpty(t, org.APIKey)
+		assert.Equal(t, "editor", org.User.Role)
+		hosts, err := store.ListHosts(org.Organization.ID, false)
+		require.NoError(t, err)
+		assert.Len(t, hosts, 3)
+	}
+}
@@ -98,10 +98,12 @@ func (tc *TestClient) DoGzipRequest(method, path string, body interface{}) *http
 }
 
 // SetupTestRouter creates a minimal Gin router for testing
-// This is a basic router without middleware - useful for unit tests
+// It only recovers panics, as 500 responses, and renders handler errors - useful for unit tests
 func SetupTestRouter(h *handlers.Handlers) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	r.Use(middleware.Recovery(nil))
+	r.Use(middleware.ErrorHandler())
 	return r
 }
 
@@ -110,11 +112,17 @@ func SetupTestRouter(h *handlers.Handlers) *gin.Engine {
 func SetupFullTestRouter(store storage.Storage) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.Recovery(nil))
+	r.Use(middleware.ErrorHandler())
+	r.Use(middleware.QueryConnection(store, "/api/v1/events/stream"))
 
-	h := handlers.New(store)
+	h := handlers.New(store, handlers.WithRouteTable(r.Routes))
 
 	// Health check endpoint
 	r.GET("/health", h.Health)
+	r.GET("/readyz", h.Ready)
+	r.GET("/startupz", h.Startup)
 
 	// Root endpoint
 	r.GET("/", func(c *gin.Context) {
@@ -135,28 +143,90 @@ func SetupFullTestRouter(store storage.Storage) *gin.Engine {
 			auth.POST("/api-key", h.GetAPIKeyFromCredentials)
 		}
 
+		// OAuth token endpoints for third-party clients (client credentials, no user authentication)
+		oauth := v1.Group("/oauth")
+		{
+			oauth.POST("/token", h.OAuthToken)
+			oauth.POST("/revoke", h.RevokeOAuthToken)
+		}
+
+		// Agent enrollment (the enrollment token is the only credential)
+		v1.POST("/enroll", h.Enroll)
+
 		// Protected routes (require API key authentication)
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware(store))
-		protected.Use(middleware.OrgContextMiddleware())
+		protected.Use(middleware.OrgContextMiddleware(store))
 		{
 			// Auth endpoints
 			protected.GET("/auth/me", h.GetMe)
+			protected.GET("/auth/orgs", h.ListMyOrganizations)
 
 			// API key management
 			protected.POST("/api-keys", h.CreateAPIKey)
 			protected.GET("/api-keys", h.ListAPIKeys)
+			protected.DELETE("/api-keys", h.DeleteExpiredAPIKeys)
 			protected.DELETE("/api-keys/:id", h.DeleteAPIKey)
+			protected.PUT("/api-keys/:id/endpoints", h.UpdateAPIKeyEndpoints)
+			protected.GET("/roles", h.ListRoles)
 
 			// Host management endpoints - viewing accessible to all authenticated users
 			protected.GET("/hosts", h.ListHosts)
+			protected.GET("/hosts/export", h.ExportHosts)
+			protected.GET("/hosts/facets", h.GetHostFacets)
 			protected.GET("/hosts/:host_id", h.GetHost)
-
-			// Host deletion - requires editor or admin role
+			protected.GET("/hosts/:host_id/events", h.GetHostEvents)
+			protected.GET("/hosts/:host_id/services", h.GetHostServices)
+			protected.GET("/hosts/:host_id/uptime", h.GetHostUptime)
+			protected.GET("/events", h.ListHostEvents)
+			protected.GET("/events/stream", h.StreamHostEvents)
+			protected.GET("/accounts", h.ListAccounts)
+			protected.GET("/services", h.ListServices)
+			protected.GET("/checkins", h.ListCheckins)
+
+			// GraphQL over hosts, report history, host counts, users, and API keys, scoped
+			// like the REST endpoints above
+			protected.POST("/graphql", h.GraphQL)
+
+			// Delegated tokens - users authorize and revoke third-party integrations
+			protected.POST("/oauth/authorize", h.AuthorizeOAuthClient)
+			protected.GET("/oauth/grants", h.ListOAuthGrants)
+			protected.DELETE("/oauth/grants/:id", h.DeleteOAuthGrant)
+
+			// Fleet statistics
+			protected.GET("/stats/compare", h.CompareFleet)
+			protected.GET("/stats/uptime", h.GetUptimeStats)
+
+			// Feature flags in effect for the caller's organization
+			protected.GET("/orgs/current/flags", h.GetOrgFeatureFlags)
+
+			// Ingest receipt verification
+			protected.GET("/receipts/:id/verify", h.VerifyReceipt)
+
+			// Host probe job results
+			protected.GET("/probes/:id", h.GetProbeJob)
+
+			// Host groups
+			protected.GET("/groups", h.ListHostGroups)
+			protected.GET("/groups/:group_id", h.GetHostGroup)
+
+			// Host deletion, tagging, probe results, and grouping - requires editor or admin role
 			editorOrAdmin := protected.Group("")
 			editorOrAdmin.Use(middleware.RequireRole("editor", "admin"))
 			{
 				editorOrAdmin.DELETE("/hosts/:host_id", h.DeleteHost)
+				editorOrAdmin.PATCH("/hosts/:host_id", h.UpdateHost)
+				editorOrAdmin.PUT("/hosts/:host_id/tags", h.SetHostTags)
+				editorOrAdmin.POST("/hosts/:host_id/restore", h.RestoreHost)
+				editorOrAdmin.POST("/hosts/:host_id/archive", h.ArchiveHost)
+				editorOrAdmin.POST("/hosts/:host_id/unarchive", h.UnarchiveHost)
+				editorOrAdmin.POST("/probes/claim", h.ClaimProbeJob)
+				editorOrAdmin.POST("/probes/:id/results", h.SubmitProbeResults)
+				editorOrAdmin.POST("/groups", h.CreateHostGroup)
+				editorOrAdmin.PUT("/groups/:group_id", h.UpdateHostGroup)
+				editorOrAdmin.DELETE("/groups/:group_id", h.DeleteHostGroup)
+				editorOrAdmin.PUT("/groups/:group_id/hosts/:host_id", h.AddHostGroupMember)
+				editorOrAdmin.DELETE("/groups/:group_id/hosts/:host_id", h.RemoveHostGroupMember)
 			}
 
 			// User management endpoints - admin only
@@ -164,19 +234,89 @@ func SetupFullTestRouter(store storage.Storage) *gin.Engine {
 			adminOnly.Use(middleware.RequireRole("admin"))
 			{
 				adminOnly.GET("/users", h.ListUsers)
+				adminOnly.POST("/probes", h.CreateProbeJob)
+				adminOnly.GET("/orgs/current/usage", h.GetOrgUsage)
+				adminOnly.GET("/orgs/current/remote-write", h.GetRemoteWrite)
+				adminOnly.PUT("/orgs/current/remote-write", h.SetRemoteWrite)
+				adminOnly.DELETE("/orgs/current/remote-write", h.DeleteRemoteWrite)
+				adminOnly.GET("/orgs/current/ingest-filter", h.GetIngestFilter)
+				adminOnly.PUT("/orgs/current/ingest-filter", h.SetIngestFilter)
+				adminOnly.DELETE("/orgs/current/ingest-filter", h.DeleteIngestFilter)
+				adminOnly.GET("/orgs/current/checkin-schedule", h.GetCheckinSchedule)
+				adminOnly.PUT("/orgs/current/checkin-schedule", h.SetCheckinSchedule)
+				adminOnly.DELETE("/orgs/current/checkin-schedule", h.DeleteCheckinSchedule)
+				adminOnly.POST("/reports", h.GenerateReport)
+				adminOnly.GET("/reports", h.ListReports)
+				adminOnly.GET("/reports/:id", h.GetReport)
+				adminOnly.GET("/orgs/current/report-schedule", h.GetReportSchedule)
+				adminOnly.PUT("/orgs/current/report-schedule", h.SetReportSchedule)
+				adminOnly.DELETE("/orgs/current/report-schedule", h.DeleteReportSchedule)
 				adminOnly.POST("/users", h.CreateUser)
 				adminOnly.PUT("/users/:user_id/role", h.UpdateUserRole)
+				adminOnly.POST("/events/replay", h.ReplayHostEvents)
 				adminOnly.DELETE("/users/:user_id", h.DeleteUser)
+				adminOnly.GET("/orgs/current/members", h.ListOrgMembers)
+				adminOnly.POST("/orgs/current/members", h.AddOrgMember)
+				adminOnly.PUT("/orgs/current/members/:user_id/role", h.UpdateOrgMemberRole)
+				adminOnly.DELETE("/orgs/current/members/:user_id", h.RemoveOrgMember)
+				adminOnly.GET("/actions", h.ListActions)
+				adminOnly.POST("/actions", h.CreateAction)
+				adminOnly.GET("/actions/:id", h.GetAction)
+				adminOnly.PUT("/actions/:id", h.UpdateAction)
+				adminOnly.DELETE("/actions/:id", h.DeleteAction)
+				adminOnly.POST("/actions/:id/signing-secret/rotate", h.RotateActionSecret)
+				adminOnly.GET("/actions/:id/runs", h.ListActionRuns)
+				adminOnly.POST("/actions/:id/runs/:run_id/retry", h.RetryActionRun)
+				adminOnly.GET("/secrets", h.ListOrgSecrets)
+				adminOnly.PUT("/secrets/:name", h.SetOrgSecret)
+				adminOnly.DELETE("/secrets/:name", h.DeleteOrgSecret)
+				adminOnly.GET("/oauth/clients", h.ListOAuthClients)
+				adminOnly.POST("/oauth/clients", h.CreateOAuthClient)
+				adminOnly.DELETE("/oauth/clients/:id", h.DeleteOAuthClient)
+				adminOnly.GET("/enroll-tokens", h.ListEnrollmentTokens)
+				adminOnly.POST("/enroll-tokens", h.CreateEnrollmentToken)
+				adminOnly.DELETE("/enroll-tokens/:id", h.DeleteEnrollmentToken)
+				adminOnly.GET("/users/:user_id/host-access", h.GetHostAccessPolicy)
+				adminOnly.PUT("/users/:user_id/host-access", h.UpdateHostAccessPolicy)
+			}
+
+			// Operational endpoints - system administrators only (users.is_admin)
+			systemAdmin := protected.Group("/admin")
+			systemAdmin.Use(middleware.AdminMiddleware(store))
+			{
+				systemAdmin.GET("/db/activity", h.ListDBActivity)
+				systemAdmin.POST("/db/cancel/:pid", h.CancelDBQuery)
+				systemAdmin.GET("/db/maintenance", h.GetDBMaintenance)
+				systemAdmin.GET("/error-rates", h.ListErrorRates)
+				systemAdmin.GET("/diagnostics", h.GetDiagnostics)
+				systemAdmin.GET("/flags", h.ListFeatureFlags)
+				systemAdmin.PUT("/flags/:name", h.SetFeatureFlag)
+				systemAdmin.DELETE("/flags/:name", h.DeleteFeatureFlag)
+				systemAdmin.PUT("/flags/:name/orgs/:org_id", h.SetFeatureFlagOverride)
+				systemAdmin.DELETE("/flags/:name/orgs/:org_id", h.DeleteFeatureFlagOverride)
+				systemAdmin.POST("/reprocess", h.StartReprocess)
+				systemAdmin.GET("/reprocess", h.ListReprocessJobs)
+				systemAdmin.GET("/reprocess/:job_id", h.GetReprocessJob)
+				systemAdmin.POST("/reprocess/:job_id/cancel", h.CancelReprocessJob)
+				systemAdmin.POST("/impersonate/:user_id", h.Impersonate)
+			}
+
+			// API metadata - system administrators only
+			meta := protected.Group("/meta")
+			meta.Use(middleware.AdminMiddleware(store))
+			{
+				meta.GET("/spec-drift", h.GetSpecDrift)
 			}
 		}
 
 		// Ingest endpoint - requires editor or admin role
 		ingest := v1.Group("")
 		ingest.Use(middleware.AuthMiddleware(store))
-		ingest.Use(middleware.OrgContextMiddleware())
+		ingest.Use(middleware.OrgContextMiddleware(store))
 		ingest.Use(middleware.RequireRole("editor", "admin"))
 		{
 			ingest.POST("/ingest", h.Ingest)
+			ingest.POST("/ingest/batch", h.IngestBatch)
 		}
 	}
 
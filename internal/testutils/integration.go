@@ -120,7 +120,7 @@ func AssertUserHasAPIKeys(t *testing.T, store storage.Storage, userID string, ex
 // AssertOrganizationHasHosts verifies that an organization has the expected number of hosts.
 func AssertOrganizationHasHosts(t *testing.T, store storage.Storage, orgID string, expectedCount int) {
 	t.Helper()
-	hosts, err := store.ListHosts(orgID)
+	hosts, err := store.ListHosts(orgID, false)
 	require.NoError(t, err)
 	assert.Equal(t, expectedCount, len(hosts), "Expected %d hosts in organization %s, got %d", expectedCount, orgID, len(hosts))
 }
@@ -0,0 +1,229 @@
+// Package usage tracks per-organization API consumption for the tenant usage endpoint.
+//
+// Requests, ingested reports, and rate-limit rejections are recorded into hourly
+// buckets per organization, and a snapshot totals the buckets of the last 24
+// hours. Counts are kept in memory per server instance.
+//
+// Rate limiting runs before authentication, so a rejected request carries no
+// organization. The tracker remembers which organization each credential
+// recently authenticated as (by SHA-256, never the credential itself) and
+// attributes rejections to it; rejections for credentials it has not seen are
+// not counted.
+package usage
+
+import (
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BucketWidth is the resolution of the usage window
+	BucketWidth = time.Hour
+	// Window is the period a snapshot covers
+	Window = 24 * time.Hour
+
+	// MaxCredentials bounds the credential to organization map
+	MaxCredentials = 10000
+
+	numBuckets = int(Window / BucketWidth)
+)
+
+// EndpointUsage counts the requests an organization made to one endpoint
+type EndpointUsage struct {
+	Endpoint string `json:"endpoint"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"` // 4xx and 5xx responses, including rate-limit rejections
+}
+
+// IngestUsage counts the reports an organization uploaded
+type IngestUsage struct {
+	Reports int64 `json:"reports"`
+	Bytes   int64 `json:"bytes"` // Uncompressed report bytes
+}
+
+// OrgUsage is an organization's consumption over the window
+type OrgUsage struct {
+	Window        string          `json:"window"`
+	Since         time.Time       `json:"since"` // Start of the window, or when tracking began if later
+	Endpoints     []EndpointUsage `json:"endpoints"`
+	Ingest        IngestUsage     `json:"ingest"`
+	RateLimitHits int64           `json:"rate_limit_hits"`
+}
+
+type bucket struct {
+	slot          int64 // start of the bucket in BucketWidth units since the epoch
+	endpoints     map[string]*EndpointUsage
+	ingest        IngestUsage
+	rateLimitHits int64
+}
+
+type series struct {
+	buckets [numBuckets]bucket
+}
+
+// Tracker records usage per organization
+type Tracker struct {
+	started time.Time
+
+	mu          sync.Mutex
+	orgs        map[string]*series
+	credentials map[[sha256.Size]byte]string
+}
+
+// NewTracker creates an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{
+		started:     time.Now().UTC(),
+		orgs:        make(map[string]*series),
+		credentials: make(map[[sha256.Size]byte]string),
+	}
+}
+
+// bucketFor returns the current bucket of orgID, resetting it if it is stale
+// Callers must hold t.mu
+func (t *Tracker) bucketFor(orgID string, now time.Time) *bucket {
+	slot := now.UnixNano() / int64(BucketWidth)
+	s, ok := t.orgs[orgID]
+	if !ok {
+		s = &series{}
+		t.orgs[orgID] = s
+	}
+	b := &s.buckets[slot%int64(numBuckets)]
+	if b.slot != slot || b.endpoints == nil {
+		*b = bucket{slot: slot, endpoints: make(map[string]*EndpointUsage)}
+	}
+	return b
+}
+
+// countRequest adds a response to the endpoint's counts in b
+func (b *bucket) countRequest(endpoint string, status int) {
+	e, ok := b.endpoints[endpoint]
+	if !ok {
+		e = &EndpointUsage{Endpoint: endpoint}
+		b.endpoints[endpoint] = e
+	}
+	e.Requests++
+	if status >= 400 {
+		e.Errors++
+	}
+}
+
+// RecordRequest counts a response to an authenticated request
+func (t *Tracker) RecordRequest(orgID, endpoint string, status int) {
+	t.recordRequest(orgID, endpoint, status, time.Now())
+}
+
+func (t *Tracker) recordRequest(orgID, endpoint string, status int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bucketFor(orgID, now).countRequest(endpoint, status)
+}
+
+// RecordIngest counts an accepted report of size bytes
+func (t *Tracker) RecordIngest(orgID string, bytes int) {
+	t.recordIngest(orgID, bytes, time.Now())
+}
+
+func (t *Tracker) recordIngest(orgID string, bytes int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucketFor(orgID, now)
+	b.ingest.Reports++
+	b.ingest.Bytes += int64(bytes)
+}
+
+// RememberCredential records that credential authenticated as a member of orgID
+func (t *Tracker) RememberCredential(credential, orgID string) {
+	key := sha256.Sum256([]byte(credential))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.credentials[key]; !ok && len(t.credentials) >= MaxCredentials {
+		// Start over rather than tracking recency; active credentials are re-learned on their next request
+		t.credentials = make(map[[sha256.Size]byte]string)
+	}
+	t.credentials[key] = orgID
+}
+
+// RecordRateLimited counts a request to endpoint rejected by a rate limiter
+// It is attributed to the organization credential last authenticated as, if any
+func (t *Tracker) RecordRateLimited(credential, endpoint string, status int) {
+	t.recordRateLimited(credential, endpoint, status, time.Now())
+}
+
+func (t *Tracker) recordRateLimited(credential, endpoint string, status int, now time.Time) {
+	key := sha256.Sum256([]byte(credential))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	orgID, ok := t.credentials[key]
+	if !ok {
+		return
+	}
+	b := t.bucketFor(orgID, now)
+	b.rateLimitHits++
+	if endpoint != "" {
+		b.countRequest(endpoint, status)
+	}
+}
+
+// Snapshot returns orgID's usage over the last Window
+func (t *Tracker) Snapshot(orgID string) OrgUsage {
+	return t.snapshot(orgID, time.Now())
+}
+
+func (t *Tracker) snapshot(orgID string, now time.Time) OrgUsage {
+	slot := now.UnixNano() / int64(BucketWidth)
+	oldest := slot - int64(numBuckets) + 1
+
+	since := time.Unix(0, oldest*int64(BucketWidth)).UTC()
+	if t.started.After(since) {
+		since = t.started
+	}
+	usage := OrgUsage{
+		Window:    Window.String(),
+		Since:     since,
+		Endpoints: []EndpointUsage{},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.orgs[orgID]
+	if !ok {
+		return usage
+	}
+	endpoints := make(map[string]*EndpointUsage)
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.slot < oldest || b.slot > slot {
+			continue
+		}
+		usage.Ingest.Reports += b.ingest.Reports
+		usage.Ingest.Bytes += b.ingest.Bytes
+		usage.RateLimitHits += b.rateLimitHits
+		for endpoint, counts := range b.endpoints {
+			e, ok := endpoints[endpoint]
+			if !ok {
+				e = &EndpointUsage{Endpoint: endpoint}
+				endpoints[endpoint] = e
+			}
+			e.Requests += counts.Requests
+			e.Errors += counts.Errors
+		}
+	}
+	for _, e := range endpoints {
+		usage.Endpoints = append(usage.Endpoints, *e)
+	}
+
+	// Busiest endpoints first
+	sort.Slice(usage.Endpoints, func(i, j int) bool {
+		if usage.Endpoints[i].Requests != usage.Endpoints[j].Requests {
+			return usage.Endpoints[i].Requests > usage.Endpoints[j].Requests
+		}
+		return usage.Endpoints[i].Endpoint < usage.Endpoints[j].Endpoint
+	})
+	return usage
+}
@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker_Snapshot(t *testing.T) {
+	tracker := NewTracker()
+	tracker.started = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 2, 12, 30, 0, 0, time.UTC)
+
+	// Older than the window: not counted
+	tracker.recordRequest("org-1", "GET /api/v1/hosts", http.StatusOK, now.Add(-25*time.Hour))
+	tracker.recordIngest("org-1", 1000, now.Add(-25*time.Hour))
+
+	for i := 0; i < 3; i++ {
+		tracker.recordRequest("org-1", "GET /api/v1/hosts", http.StatusOK, now.Add(-2*time.Hour))
+	}
+	tracker.recordRequest("org-1", "GET /api/v1/hosts/:host_id", http.StatusNotFound, now)
+	tracker.recordRequest("org-2", "GET /api/v1/hosts", http.StatusOK, now)
+	tracker.recordIngest("org-1", 2048, now)
+	tracker.recordIngest("org-1", 1024, now.Add(-time.Hour))
+
+	usage := tracker.snapshot("org-1", now)
+	assert.Equal(t, "24h0m0s", usage.Window)
+	assert.Equal(t, time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC), usage.Since)
+	require.Len(t, usage.Endpoints, 2)
+	assert.Equal(t, EndpointUsage{Endpoint: "GET /api/v1/hosts", Requests: 3}, usage.Endpoints[0])
+	assert.Equal(t, EndpointUsage{Endpoint: "GET /api/v1/hosts/:host_id", Requests: 1, Errors: 1}, usage.Endpoints[1])
+	assert.Equal(t, IngestUsage{Reports: 2, Bytes: 3072}, usage.Ingest)
+
+	// Unknown organizations have empty usage
+	empty := tracker.snapshot("org-3", now)
+	assert.Empty(t, empty.Endpoints)
+	assert.NotNil(t, empty.Endpoints)
+}
+
+func TestTracker_SinceTrackingBegan(t *testing.T) {
+	tracker := NewTracker()
+	usage := tracker.Snapshot("org-1")
+	assert.Equal(t, tracker.started, usage.Since)
+}
+
+func TestTracker_RateLimited(t *testing.T) {
+	tracker := NewTracker()
+	now := time.Now()
+
+	// Rejections for unknown credentials are dropped
+	tracker.recordRateLimited("sb_unknown", "GET /api/v1/hosts", http.StatusTooManyRequests, now)
+	assert.Empty(t, tracker.credentials)
+
+	tracker.RememberCredential("sb_key", "org-1")
+	tracker.recordRateLimited("sb_key", "GET /api/v1/hosts", http.StatusTooManyRequests, now)
+	tracker.recordRateLimited("sb_key", "", http.StatusTooManyRequests, now)
+
+	usage := tracker.snapshot("org-1", now)
+	assert.Equal(t, int64(2), usage.RateLimitHits)
+	require.Len(t, usage.Endpoints, 1)
+	assert.Equal(t, EndpointUsage{Endpoint: "GET /api/v1/hosts", Requests: 1, Errors: 1}, usage.Endpoints[0])
+
+	// Credentials are stored hashed
+	for key := range tracker.credentials {
+		assert.NotContains(t, string(key[:]), "sb_key")
+	}
+}
+
+func TestTracker_CredentialBound(t *testing.T) {
+	tracker := NewTracker()
+	for i := 0; i < MaxCredentials; i++ {
+		tracker.RememberCredential(string(rune(i)), "org-1")
+	}
+	// Re-remembering a known credential does not reset the map
+	tracker.RememberCredential(string(rune(0)), "org-1")
+	assert.Len(t, tracker.credentials, MaxCredentials)
+
+	tracker.RememberCredential("one-more", "org-2")
+	assert.Len(t, tracker.credentials, 1)
+}
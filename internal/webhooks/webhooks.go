@@ -0,0 +1,319 @@
+// Package webhooks sends an organization's host events to the URLs it registers.
+//
+// Fire queues one delivery per enabled webhook subscribed to an event, and the
+// dispatcher delivers due deliveries in the background. A failed delivery is retried
+// with exponential backoff up to MaxAttempts. Deliveries live in storage, so they
+// survive restarts and are shared between instances; completed deliveries are kept
+// for DeliveryRetention as the webhook's delivery log.
+//
+// host.ingested and host.deleted are fired by the handlers. host.stale is raised by
+// the dispatcher itself for hosts that miss their check-in window, once each time a
+// host goes stale. The body is the JSON event, signed like outbound action deliveries
+// and sent through the same outbound client, which refuses internal addresses.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/checkin"
+	"snailbus/internal/logger"
+	"snailbus/internal/models"
+	"snailbus/internal/outbound"
+	"snailbus/internal/storage"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is attempted before it fails
+	MaxAttempts = 5
+	// BaseBackoff is the wait before the first retry; it doubles with each attempt
+	BaseBackoff = 30 * time.Second
+	// MaxBackoff caps the wait between retries
+	MaxBackoff = time.Hour
+	// PollInterval is how often the dispatcher looks for due deliveries
+	PollInterval = 5 * time.Second
+	// DeliveryRetention is how long completed deliveries are kept
+	DeliveryRetention = 7 * 24 * time.Hour
+	// PruneInterval is how often completed deliveries past DeliveryRetention are removed
+	PruneInterval = time.Hour
+
+	// EventHeader carries the event type of a delivery
+	EventHeader = "X-Snailbus-Event"
+
+	requestTimeout = 30 * time.Second
+	claimLease     = 2 * time.Minute // Longer than a delivery, so a claimed delivery is only reclaimed after a crash
+	claimBatch     = 20
+	maxErrorLength = 500
+)
+
+// Dispatcher queues and delivers webhook events
+type Dispatcher struct {
+	store    storage.Storage
+	client   *http.Client
+	fallback time.Duration
+	now      func() time.Time
+}
+
+// NewDispatcher creates a dispatcher backed by store
+// fallback is the check-in window of hosts no organization schedule covers.
+func NewDispatcher(store storage.Storage, fallback time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		client:   outbound.NewClient(requestTimeout),
+		fallback: fallback,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Fire queues a delivery of event to each of the organization's enabled webhooks
+// subscribed to its type, and returns the number of deliveries queued
+func (d *Dispatcher) Fire(orgID string, event models.WebhookEvent) (int, error) {
+	return d.fire(orgID, event, "", time.Time{})
+}
+
+// fire queues deliveries of event; a non-empty dedupKey skips webhooks that already
+// had a delivery with that key since the given time
+func (d *Dispatcher) fire(orgID string, event models.WebhookEvent, dedupKey string, since time.Time) (int, error) {
+	webhooks, err := d.store.ListWebhooks(orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := d.now()
+	event.OrgID = orgID
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = now
+	}
+	queued := 0
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !webhook.Subscribed(event.Type) {
+			continue
+		}
+		delivery := &models.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhook.ID,
+			OrgID:         orgID,
+			Event:         event,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		}
+		created, err := d.store.CreateWebhookDelivery(delivery, dedupKey, since)
+		if err != nil {
+			return queued, err
+		}
+		if created {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// Run delivers due deliveries every PollInterval, looks for stale hosts every
+// checkin.CheckInterval, and prunes the delivery log every PruneInterval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	deliveries := time.NewTicker(PollInterval)
+	defer deliveries.Stop()
+	stale := time.NewTicker(checkin.CheckInterval)
+	defer stale.Stop()
+	prune := time.NewTicker(PruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deliveries.C:
+			if _, err := d.processDue(ctx); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to process webhook deliveries")
+			}
+		case <-stale.C:
+			if _, err := d.CheckStale(); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to check for stale hosts")
+			}
+		case <-prune.C:
+			if _, err := d.store.DeleteWebhookDeliveries(d.now().Add(-DeliveryRetention)); err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to prune webhook deliveries")
+			}
+		}
+	}
+}
+
+// CheckStale fires host.stale for each host that missed its check-in window in the
+// organizations subscribed to it, and returns the number of deliveries queued
+// A host is reported once per missed window: the event is not repeated until the host
+// reports again and then goes stale again. An organization that fails is logged and
+// skipped so it does not hold up the others.
+func (d *Dispatcher) CheckStale() (int, error) {
+	orgIDs, err := d.store.ListWebhookOrgs(models.WebhookEventHostStale)
+	if err != nil {
+		return 0, err
+	}
+
+	now := d.now()
+	queued := 0
+	for _, orgID := range orgIDs {
+		schedule, err := d.store.GetCheckinSchedule(orgID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Logger.Error().Err(err).Str("org_id", orgID).Msg("Failed to get check-in schedule for stale hosts")
+			continue
+		}
+		hosts, err := d.store.ListHosts(orgID, false)
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("org_id", orgID).Msg("Failed to list hosts for stale hosts")
+			continue
+		}
+		for _, host := range hosts {
+			status := checkin.Evaluate(schedule, host, d.fallback, now)
+			if !status.Overdue {
+				continue
+			}
+			lastSeen := host.LastSeen
+			event := models.WebhookEvent{
+				Type:       models.WebhookEventHostStale,
+				HostID:     host.HostID,
+				Hostname:   host.Hostname,
+				LastSeen:   &lastSeen,
+				OccurredAt: status.DueAt,
+			}
+			n, err := d.fire(orgID, event, models.WebhookEventHostStale+":"+host.HostID, lastSeen)
+			if err != nil {
+				logger.Logger.Error().Err(err).Str("org_id", orgID).Str("host_id", host.HostID).
+					Msg("Failed to queue host.stale webhooks")
+				continue
+			}
+			queued += n
+		}
+	}
+	return queued, nil
+}
+
+// processDue claims due deliveries and attempts them, returning how many were attempted
+func (d *Dispatcher) processDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		deliveries, err := d.store.ClaimWebhookDeliveries(d.now(), claimLease, claimBatch)
+		if err != nil {
+			return attempted, err
+		}
+		for _, delivery := range deliveries {
+			d.deliver(ctx, delivery)
+		}
+		attempted += len(deliveries)
+		if len(deliveries) < claimBatch || ctx.Err() != nil {
+			return attempted, nil
+		}
+	}
+}
+
+// deliver makes one attempt at a claimed delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	status, err := d.attempt(ctx, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	now := d.now()
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+	case delivery.Attempts >= MaxAttempts || errors.Is(err, errPermanent):
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = truncate(err.Error(), maxErrorLength)
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+	default:
+		next := now.Add(backoff(delivery.Attempts))
+		delivery.Status = models.WebhookDeliveryPending
+		delivery.LastError = truncate(err.Error(), maxErrorLength)
+		delivery.NextAttemptAt = &next
+	}
+
+	log := logger.Logger.Info()
+	if delivery.Status != models.WebhookDeliverySucceeded {
+		log = logger.Logger.Warn().Str("error", delivery.LastError)
+	}
+	log.Str("delivery_id", delivery.ID).
+		Str("webhook_id", delivery.WebhookID).
+		Str("org_id", delivery.OrgID).
+		Str("event", delivery.Event.Type).
+		Str("status", delivery.Status).
+		Int("attempts", delivery.Attempts).
+		Msg("Webhook delivery attempted")
+
+	if err := d.store.FinishWebhookDelivery(delivery); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Logger.Error().Err(err).Str("delivery_id", delivery.ID).Msg("Failed to record webhook delivery")
+	}
+}
+
+// errPermanent marks failures that retrying cannot fix
+var errPermanent = errors.New("permanent failure")
+
+// attempt POSTs the delivery's event to its webhook, returning the response status
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	webhook, err := d.store.GetWebhook(delivery.WebhookID, delivery.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	if !webhook.Enabled {
+		return 0, fmt.Errorf("%w: webhook is disabled", errPermanent)
+	}
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "snailbus-webhooks")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(actions.DeliveryHeader, delivery.ID)
+	if webhook.SigningSecret != "" {
+		req.Header.Set(actions.SignatureHeader, actions.SignPayload(webhook.SigningSecret, string(body), d.now()))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Only the status is recorded, so the delivery log cannot be used to read responses back
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	wait := BaseBackoff
+	for i := 1; i < attempts && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxBackoff {
+		wait = MaxBackoff
+	}
+	return wait
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
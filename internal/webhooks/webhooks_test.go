@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"snailbus/internal/actions"
+	"snailbus/internal/models"
+	"snailbus/internal/storage"
+)
+
+// receiver records requests and answers with a configurable status
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newReceiver(t *testing.T, status int) (*receiver, *httptest.Server) {
+	rcv := &receiver{status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, string(body))
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(server.Close)
+	return rcv, server
+}
+
+func newTestDispatcher(store storage.Storage, now *time.Time) *Dispatcher {
+	d := NewDispatcher(store, time.Hour)
+	// The test receivers listen on loopback, which the outbound client refuses
+	d.client = &http.Client{Timeout: requestTimeout}
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func createTestWebhook(t *testing.T, store storage.Storage, orgID, url string, events ...string) *models.Webhook {
+	webhook := &models.Webhook{
+		ID:            "webhook-" + orgID,
+		URL:           url + "/hooks",
+		Events:        events,
+		Enabled:       true,
+		SigningSecret: "sbws_test",
+	}
+	require.NoError(t, store.CreateWebhook(webhook, orgID))
+	return webhook
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	store := storage.NewMockStorage()
+	rcv, server := newReceiver(t, http.StatusNoContent)
+	now := time.Now().UTC().Truncate(time.Second)
+	d := newTestDispatcher(store, &now)
+
+	webhook := createTestWebhook(t, store, "org-1", server.URL, models.WebhookEventHostIngested)
+
+	queued, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostIngested, HostID: "host-1", Hostname: "web-01"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	// Events the webhook is not subscribed to queue nothing
+	queued, err = d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostDeleted, HostID: "host-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	attempted, err := d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	require.Len(t, rcv.requests, 1)
+	assert.Equal(t, http.MethodPost, rcv.requests[0].Method)
+	assert.Equal(t, "/hooks", rcv.requests[0].URL.Path)
+	assert.Equal(t, "application/json", rcv.requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, models.WebhookEventHostIngested, rcv.requests[0].Header.Get(EventHeader))
+	assert.Equal(t, actions.SignPayload("sbws_test", rcv.bodies[0], now), rcv.requests[0].Header.Get(actions.SignatureHeader))
+
+	var event models.WebhookEvent
+	require.NoError(t, json.Unmarshal([]byte(rcv.bodies[0]), &event))
+	assert.Equal(t, models.WebhookEventHostIngested, event.Type)
+	assert.Equal(t, "org-1", event.OrgID)
+	assert.Equal(t, "host-1", event.HostID)
+	assert.Equal(t, "web-01", event.Hostname)
+	assert.True(t, event.OccurredAt.Equal(now))
+
+	deliveries, err := store.ListWebhookDeliveries(webhook.ID, "org-1", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, deliveries[0].ID, rcv.requests[0].Header.Get(actions.DeliveryHeader))
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+	assert.NotNil(t, deliveries[0].CompletedAt)
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	store := storage.NewMockStorage()
+	rcv, server := newReceiver(t, http.StatusServiceUnavailable)
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+
+	webhook := createTestWebhook(t, store, "org-1", server.URL, models.WebhookEventHostDeleted)
+	_, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostDeleted, HostID: "host-1"})
+	require.NoError(t, err)
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		attempted, err := d.processDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, attempted, "attempt %d", attempt)
+
+		deliveries, err := store.ListWebhookDeliveries(webhook.ID, "org-1", 1)
+		require.NoError(t, err)
+		delivery := deliveries[0]
+		assert.Equal(t, attempt, delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+		if attempt < MaxAttempts {
+			assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+			require.NotNil(t, delivery.NextAttemptAt)
+			assert.Equal(t, now.Add(backoff(attempt)), *delivery.NextAttemptAt)
+
+			// Nothing is due before the backoff elapses
+			attempted, err = d.processDue(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 0, attempted)
+			now = *delivery.NextAttemptAt
+		} else {
+			assert.Equal(t, models.WebhookDeliveryFailed, delivery.Status)
+			assert.Nil(t, delivery.NextAttemptAt)
+			assert.Contains(t, delivery.LastError, "status 503")
+		}
+	}
+	assert.Len(t, rcv.requests, MaxAttempts)
+
+	// Failed deliveries are pruned once past the retention
+	deleted, err := store.DeleteWebhookDeliveries(now.Add(DeliveryRetention))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestDispatcher_RefusesInternalURLs(t *testing.T) {
+	store := storage.NewMockStorage()
+	rcv, server := newReceiver(t, http.StatusOK)
+	d := NewDispatcher(store, time.Hour)
+
+	webhook := createTestWebhook(t, store, "org-1", server.URL, models.WebhookEventHostDeleted)
+	_, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostDeleted, HostID: "host-1"})
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	deliveries, err := store.ListWebhookDeliveries(webhook.ID, "org-1", 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Contains(t, deliveries[0].LastError, "not allowed")
+	assert.Empty(t, rcv.requests)
+}
+
+func TestDispatcher_DoesNotRecordResponseBody(t *testing.T) {
+	store := storage.NewMockStorage()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "internal-only response")
+	}))
+	t.Cleanup(server.Close)
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+
+	webhook := createTestWebhook(t, store, "org-1", server.URL, models.WebhookEventHostDeleted)
+	_, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostDeleted, HostID: "host-1"})
+	require.NoError(t, err)
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+
+	deliveries, err := store.ListWebhookDeliveries(webhook.ID, "org-1", 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "webhook returned status 403", deliveries[0].LastError)
+}
+
+func TestDispatcher_Disabled(t *testing.T) {
+	store := storage.NewMockStorage()
+	rcv, server := newReceiver(t, http.StatusOK)
+	now := time.Now().UTC()
+	d := newTestDispatcher(store, &now)
+
+	webhook := createTestWebhook(t, store, "org-1", server.URL, models.WebhookEventHostIngested)
+	_, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostIngested, HostID: "host-1"})
+	require.NoError(t, err)
+
+	// Queued deliveries of a webhook disabled since fail without being sent
+	webhook.Enabled = false
+	require.NoError(t, store.UpdateWebhook(webhook, "org-1"))
+	_, err = d.processDue(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, rcv.requests)
+
+	deliveries, err := store.ListWebhookDeliveries(webhook.ID, "org-1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+
+	// Disabled webhooks get no new deliveries
+	queued, err := d.Fire("org-1", models.WebhookEvent{Type: models.WebhookEventHostIngested, HostID: "host-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+}
+
+func TestDispatcher_CheckStale(t *testing.T) {
+	store := storage.NewMockStorage()
+	_, server := newReceiver(t, http.StatusOK)
+	now := time.Now().UTC().Truncate(time.Second)
+	d := newTestDispatcher(store, &now)
+
+	org, err := store.CreateOrganization("Test Org")
+	require.NoError(t, err)
+	user, err := store.CreateUser("testuser", "test@example.com", "hash", org.ID, "admin")
+	require.NoError(t, err)
+	webhook := createTestWebhook(t, store, org.ID, server.URL, models.WebhookEventHostStale)
+
+	report := func(hostID, hostname string, receivedAt time.Time) {
+		require.NoError(t, store.SaveHost(&models.Report{
+			ID:         hostID,
+			ReceivedAt: receivedAt,
+			Meta:       models.ReportMeta{HostID: hostID, Hostname: hostname},
+			Data:       json.RawMessage(`{}`),
+		}, org.ID, user.ID))
+	}
+	staleID := "00000000-0000-0000-0000-000000000001"
+	report(staleID, "stale-01", now.Add(-2*time.Hour))
+	report("00000000-0000-0000-0000-000000000002", "fresh-01", now.Add(-time.Minute))
+
+	// Only the host past the one-hour fallback window is stale
+	queued, err := d.CheckStale()
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+
+	deliveries, err := store.ListWebhookDeliveries(webhook.ID, org.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	event := deliveries[0].Event
+	assert.Equal(t, models.WebhookEventHostStale, event.Type)
+	assert.Equal(t, staleID, event.HostID)
+	assert.Equal(t, "stale-01", event.Hostname)
+	require.NotNil(t, event.LastSeen)
+	assert.True(t, event.LastSeen.Equal(now.Add(-2*time.Hour)))
+	assert.True(t, event.OccurredAt.Equal(now.Add(-time.Hour)))
+
+	// A host is reported once while it stays stale
+	now = now.Add(30 * time.Minute)
+	queued, err = d.CheckStale()
+	require.NoError(t, err)
+	assert.Equal(t, 0, queued)
+
+	// and again once it reports and then goes stale again, along with the other host
+	report(staleID, "stale-01", time.Now().UTC())
+	now = now.Add(3 * time.Hour)
+	queued, err = d.CheckStale()
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, BaseBackoff, backoff(1))
+	assert.Equal(t, 2*BaseBackoff, backoff(2))
+	assert.Equal(t, MaxBackoff, backoff(20))
+}
@@ -0,0 +1,121 @@
+// Package workpool processes a slice of items with a bounded number of workers.
+//
+// Background jobs that visit every host (exports, reprocessing) read hosts in batches
+// and hand each batch to Run. Items are dispatched in order, at most Workers at a
+// time and optionally paced, but may finish out of order; Checkpoint reports how
+// many leading items are done, so callers can emit results in order or record a
+// position to resume from. The first error returned for an item, or the
+// cancellation of the context, stops the run.
+package workpool
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkers is the concurrency used when Options.Workers is not set
+const DefaultWorkers = 1
+
+// Options configures a run
+type Options struct {
+	Workers int // Items processed at a time; defaults to DefaultWorkers
+	// Pace, if set, is called before each item after the first is dispatched, e.g. to
+	// throttle the run. An error stops dispatching and is returned by Run.
+	Pace func(ctx context.Context) error
+	// Checkpoint, if set, is called each time the leading run of finished items grows,
+	// with the number of items from the start that are all done. Calls are sequential
+	// and stop at the first error.
+	Checkpoint func(done int)
+}
+
+// result is the outcome of one item
+type result struct {
+	index int
+	err   error
+}
+
+// Run calls fn for every item with up to opts.Workers calls at a time
+// It returns the first error from fn or opts.Pace, or the context's error if the
+// context is cancelled before every item is done.
+func Run[T any](ctx context.Context, items []T, opts Options, fn func(ctx context.Context, item T) error) error {
+	if len(items) == 0 {
+		return ctx.Err()
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	results := make(chan result)
+	var paceErr error
+	go func() {
+		defer close(indexes)
+		for i := range items {
+			if i > 0 && opts.Pace != nil {
+				if paceErr = opts.Pace(ctx); paceErr != nil {
+					return
+				}
+			}
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- result{index: i, err: fn(ctx, items[i])}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	finished := make([]bool, len(items))
+	done := 0
+	for res := range results {
+		if firstErr != nil {
+			continue
+		}
+		if res.err != nil {
+			firstErr = res.err
+			cancel()
+			continue
+		}
+		finished[res.index] = true
+		advanced := false
+		for done < len(items) && finished[done] {
+			done++
+			advanced = true
+		}
+		if advanced && opts.Checkpoint != nil {
+			opts.Checkpoint(done)
+		}
+	}
+
+	switch {
+	case firstErr != nil:
+		return firstErr
+	case done == len(items):
+		return nil
+	case paceErr != nil:
+		return paceErr
+	}
+	return ctx.Err()
+}
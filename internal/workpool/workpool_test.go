@@ -0,0 +1,101 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	items := make([]int, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	var running, peak int32
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	var checkpoints []int
+	err := Run(context.Background(), items, Options{
+		Workers:    4,
+		Checkpoint: func(done int) { checkpoints = append(checkpoints, done) },
+	}, func(ctx context.Context, item int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[item] = true
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, seen, 50)
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(4))
+	require.NotEmpty(t, checkpoints)
+	assert.Equal(t, 50, checkpoints[len(checkpoints)-1])
+	assert.IsIncreasing(t, checkpoints)
+
+	assert.NoError(t, Run(context.Background(), []int(nil), Options{}, func(context.Context, int) error {
+		t.Error("no items to process")
+		return nil
+	}))
+}
+
+func TestRun_Error(t *testing.T) {
+	boom := errors.New("boom")
+	var checkpoints []int
+	err := Run(context.Background(), []int{0, 1, 2, 3}, Options{
+		Checkpoint: func(done int) { checkpoints = append(checkpoints, done) },
+	}, func(ctx context.Context, item int) error {
+		if item == 2 {
+			return boom
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []int{1, 2}, checkpoints, "no checkpoint past the failed item")
+}
+
+func TestRun_Pace(t *testing.T) {
+	paced := 0
+	processed := 0
+	err := Run(context.Background(), []string{"a", "b", "c"}, Options{
+		Pace: func(ctx context.Context) error {
+			paced++
+			return nil
+		},
+	}, func(ctx context.Context, item string) error {
+		processed++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, paced, "paced between items")
+	assert.Equal(t, 3, processed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	processed = 0
+	err = Run(ctx, []string{"a", "b", "c"}, Options{
+		Pace: func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, func(ctx context.Context, item string) error {
+		processed++
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, processed)
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,14 +27,42 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"snailbus/internal/actions"
+	"snailbus/internal/admission"
+	"snailbus/internal/autoscale"
+	"snailbus/internal/buildinfo"
+	"snailbus/internal/bundle"
+	"snailbus/internal/checkin"
 	"snailbus/internal/config"
+	"snailbus/internal/crashreport"
+	"snailbus/internal/demo"
+	"snailbus/internal/errorrate"
+	"snailbus/internal/features"
 	"snailbus/internal/handlers"
+	"snailbus/internal/hostlimit"
+	"snailbus/internal/jobs"
+	"snailbus/internal/jsonlimit"
+	"snailbus/internal/keyexpiry"
+	"snailbus/internal/leader"
+	"snailbus/internal/lifecycle"
 	"snailbus/internal/logger"
 	"snailbus/internal/metrics"
 	"snailbus/internal/middleware"
+	"snailbus/internal/migrations"
+	"snailbus/internal/models"
+	"snailbus/internal/probe"
+	"snailbus/internal/receipts"
+	"snailbus/internal/remotewrite"
+	"snailbus/internal/reports"
+	"snailbus/internal/reprocess"
+	"snailbus/internal/retention"
+	"snailbus/internal/secretbox"
+	"snailbus/internal/specvalidate"
 	"snailbus/internal/storage"
+	"snailbus/internal/usage"
+	"snailbus/internal/webhooks"
 
-	_ "snailbus/docs" // swagger docs generated by swag
+	"snailbus/docs" // swagger docs generated by swag
 )
 
 var (
@@ -63,8 +96,19 @@ var (
 func main() {
 	// Parse command line arguments
 	var validateConfigCmd = flag.Bool("validate-config", false, "Validate configuration and exit")
+	var migrateDryRunCmd = flag.Bool("migrate-dry-run", false, "Print pending migrations and the locks they take, then exit without applying them")
+	var preStopCmd = flag.Bool("prestop", false, "Drain the server running in this container for SHUTDOWN_DELAY, then exit (Kubernetes preStop hook)")
 	flag.Parse()
 
+	// If prestop flag is set, drain the running server and exit; the rest of the configuration is not needed
+	if *preStopCmd {
+		if err := preStop(); err != nil {
+			fmt.Fprintf(os.Stderr, "preStop failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Load and validate configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -83,26 +127,103 @@ func main() {
 		os.Exit(0)
 	}
 
+	// If migrate-dry-run flag is set, print the migration plan and exit
+	if *migrateDryRunCmd {
+		if err := printMigrationPlan(cfg.MigrationDatabaseURL(), cfg.MigrationsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Migration dry run failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Initialize structured logging
 	logger.Init()
 
+	// Identify the build in logs, /version, and the build_info metric
+	build := buildinfo.New(Version, Commit, BuildTime)
+	metrics.BuildInfo.WithLabelValues(build.Version, build.Commit, build.BuildDate, build.GoVersion).Set(1)
+
 	databaseURL := cfg.DatabaseURL
 
-	// Run migrations first
-	if err := runMigrations(databaseURL, cfg.MigrationsPath); err != nil {
+	// Startup phases and shutdown, reported by /startupz and /readyz
+	state := lifecycle.NewState()
+
+	// Ingest admission control (see internal/admission), disabled when INGEST_MAX_IN_FLIGHT is 0
+	var ingestAdmission *admission.Controller
+	if cfg.IngestMaxInFlight > 0 {
+		ingestAdmission = admission.NewController(cfg.IngestMaxInFlight, cfg.IngestMaxQueue, cfg.IngestQueueTimeout)
+	}
+
+	// Load signals for autoscalers (served on the metrics port at /autoscaling)
+	autoscaler := autoscale.NewTracker(ingestAdmission)
+	autoscaleCtx, stopAutoscale := context.WithCancel(context.Background())
+	defer stopAutoscale()
+	go autoscaler.Run(autoscaleCtx)
+
+	// Start listening before migrations so startup and liveness probes are answered
+	// while they run; the gate turns other requests away until the router is built
+	gate := lifecycle.NewGate(state)
+	apiServer, metricsServer := startServers(cfg, gate, state, autoscaler, build)
+
+	// Run migrations first, as the migration role if one is configured
+	endPhase := state.Phase("migrations")
+	err = runMigrations(cfg.MigrationDatabaseURL(), cfg.MigrationsPath)
+	endPhase(err)
+	if err != nil {
 		logger.Logger.Fatal().Err(err).Msg("Failed to run migrations")
 	}
 
 	// Initialize storage
+	endPhase = state.Phase("database")
 	store, err := storage.NewPostgresStorage(databaseURL)
+	endPhase(err)
 	if err != nil {
 		logger.Logger.Fatal().Err(err).Msg("Failed to initialize storage")
 	}
 	defer store.Close()
 
+	// Check the privileges of the role serving traffic (reported by /readyz)
+	endPhase = state.Phase("privileges")
+	privileges := checkDatabasePrivileges(store, cfg.SeparateMigrationRole())
+	endPhase(nil)
+
 	// Register database metrics
 	metrics.RegisterDBMetrics(store.DB(), "snailbus")
 
+	// Encrypt stored secrets, sealing rows left in plaintext or under a retired master key
+	if cfg.SecretsKeyFile != "" {
+		endPhase = state.Phase("secrets")
+		err := enableSecretEncryption(store, cfg.SecretsKeyFile)
+		endPhase(err)
+		if err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Failed to enable secret encryption")
+		}
+	}
+	if err := checkStoredSecrets(store, cfg.SecretsKeyFile != ""); err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Stored secrets cannot be read")
+	}
+
+	// Demo mode seeds an example organization the first time the server starts
+	if cfg.DemoMode {
+		endPhase = state.Phase("demo_data")
+		seedDemo(store)
+		endPhase(nil)
+	}
+
+	// Route list and search reads to the replica while it keeps up
+	if cfg.DatabaseReplicaURL != "" {
+		endPhase = state.Phase("replica")
+		err := store.EnableReplica(cfg.DatabaseReplicaURL, cfg.ReplicaMaxLag)
+		endPhase(err)
+		if err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Failed to initialize read replica")
+		}
+		metrics.RegisterDBMetrics(store.ReplicaDB(), "snailbus_replica")
+		replicaCtx, stopReplicaMonitor := context.WithCancel(context.Background())
+		defer stopReplicaMonitor()
+		go store.RunReplicaMonitor(replicaCtx, 5*time.Second)
+	}
+
 	// Register Go runtime metrics (only once, ignore if already registered)
 	registerMetricsOnce.Do(func() {
 		// Try to register Go collector
@@ -127,20 +248,232 @@ func main() {
 		}
 	})
 
-	// Create handlers
-	h := handlers.New(store)
+	// Set up the ingest receipt signing key
+	var receiptSigner *receipts.Signer
+	if cfg.ReceiptSigningKey != "" {
+		seed, _ := base64.StdEncoding.DecodeString(cfg.ReceiptSigningKey) // validated by config
+		receiptSigner, err = receipts.NewSigner(seed)
+	} else {
+		logger.Logger.Warn().Msg("RECEIPT_SIGNING_KEY not set; ingest receipts will not verify after a restart")
+		receiptSigner, err = receipts.GenerateSigner()
+	}
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Failed to set up receipt signing key")
+	}
+	logger.Logger.Info().Str("key_id", receiptSigner.KeyID()).Msg("Ingest receipt signing key loaded")
+
+	// Set up per-endpoint error rate tracking and alerting
+	errorRateConfig := errorrate.Config{
+		Threshold:   cfg.ErrorRateThreshold,
+		MinRequests: cfg.ErrorRateMinRequests,
+		Window:      cfg.ErrorRateWindow,
+	}
+	if cfg.ErrorRateWebhookURL != "" {
+		errorRateConfig.Notify = errorrate.WebhookNotifier(cfg.ErrorRateWebhookURL)
+	}
+	errorRates := errorrate.NewTracker(errorRateConfig)
+	errorRateCtx, stopErrorRates := context.WithCancel(context.Background())
+	defer stopErrorRates()
+	go errorRates.Run(errorRateCtx)
+
+	// Per-organization usage (feeds /api/v1/orgs/current/usage)
+	usageTracker := usage.NewTracker()
+
+	// Report recovered panics to an error tracker, if one is configured
+	var crashReporter *crashreport.Reporter
+	if cfg.SentryDSN != "" {
+		if crashReporter, err = crashreport.New(cfg.SentryDSN, build.Version, cfg.SentryEnvironment); err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Invalid SENTRY_DSN")
+		}
+		logger.Logger.Info().Msg("Reporting recovered panics to the error tracker at SENTRY_DSN")
+	}
 
-	// Create Gin router
-	r := gin.Default()
+	// Create Gin router (panics are recovered by middleware.Recovery below)
+	r := gin.New()
+
+	// Feature flags, shared by the admin API and middleware.RequireFeature
+	featureFlags := features.NewChecker(store, features.DefaultTTL)
+
+	// Roles of restricted routes, recorded as they are registered; scopes /openapi.json?role=
+	routeRoles := middleware.NewRouteRoles()
+
+	// Create handlers
+	handlerOpts := []handlers.Option{
+		handlers.WithFeatures(featureFlags),
+		handlers.WithReceiptSigner(receiptSigner),
+		handlers.WithErrorRateTracker(errorRates),
+		handlers.WithUsageTracker(usageTracker),
+		handlers.WithRouteTable(r.Routes),
+		handlers.WithRouteRoles(routeRoles),
+		handlers.WithJSONLimits(jsonlimit.Limits{
+			MaxDepth:        cfg.IngestJSONMaxDepth,
+			MaxKeys:         cfg.IngestJSONMaxKeys,
+			MaxStringLength: cfg.IngestJSONMaxStringLength,
+		}),
+		handlers.WithMaxClockSkew(cfg.IngestMaxClockSkew),
+		handlers.WithMaxDecompressedSize(cfg.MaxDecompressedSizeIngest),
+		handlers.WithConfig(cfg),
+		handlers.WithCheckinDefault(cfg.CheckinDefaultInterval),
+		handlers.WithExportConcurrency(cfg.ExportWorkers, cfg.ExportBatchSize),
+		handlers.WithHostReportRetention(cfg.HostReportRetention),
+		handlers.WithDatabasePrivileges(privileges),
+		handlers.WithBuildInfo(build),
+		handlers.WithLifecycle(state),
+		handlers.WithOpenAPISpec(docs.SwaggerJSON(), docs.SwaggerYAML()),
+	}
+	if cfg.OpenAPISpecDir != "" {
+		handlerOpts = append(handlerOpts, handlers.WithOpenAPISpecDir(cfg.OpenAPISpecDir))
+		logger.Logger.Info().Str("dir", cfg.OpenAPISpecDir).Msg("Serving the OpenAPI spec from OPENAPI_SPEC_DIR instead of the embedded one")
+	}
+	// Background job runners, started once the router is serving
+	var runners []func(ctx context.Context)
+	if cfg.ProbeFromServer {
+		handlerOpts = append(handlerOpts, handlers.WithProber(probe.New(cfg.ProbeTimeout)))
+	}
+	if cfg.HostDeletionReasonRequired {
+		handlerOpts = append(handlerOpts, handlers.WithDeletionReasonRequired())
+	}
+	// Per-host ingest rate limits; hosts exempted with "off" are not counted
+	hostLimits, err := hostlimit.New(cfg.RateLimitIngestHost, cfg.RateLimitIngestHostOverrides)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Failed to set up per-host ingest rate limits")
+	}
+	handlerOpts = append(handlerOpts, handlers.WithHostRateLimits(hostLimits))
+	if cfg.OutboundActionsEnabled {
+		dispatcher := actions.NewDispatcher(store)
+		runners = append(runners, dispatcher.Run, checkin.NewMonitor(store, dispatcher, cfg.CheckinDefaultInterval).Run)
+		handlerOpts = append(handlerOpts, handlers.WithActions(dispatcher))
+		// Webhooks are outbound calls too, so they share the switch
+		webhookDispatcher := webhooks.NewDispatcher(store, cfg.CheckinDefaultInterval)
+		runners = append(runners, webhookDispatcher.Run)
+		handlerOpts = append(handlerOpts, handlers.WithWebhooks(webhookDispatcher))
+	}
+	if len(cfg.BundleTrustedKeys) > 0 {
+		bundleKeys, err := bundle.ParseKeys(cfg.BundleTrustedKeys)
+		if err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Failed to load bundle trusted keys")
+		}
+		handlerOpts = append(handlerOpts, handlers.WithBundleImport(bundleKeys, cfg.MaxRequestSizeBundle))
+		logger.Logger.Info().Int("keys", bundleKeys.Len()).Msg("Offline bundle import enabled")
+	}
+	if cfg.RemoteWriteEnabled {
+		exporter := remotewrite.NewExporter(store, cfg.RemoteWriteInterval, cfg.RemoteWriteStaleAfter)
+		runners = append(runners, exporter.Run)
+		handlerOpts = append(handlerOpts, handlers.WithRemoteWrite(exporter))
+	}
+	// Fleet reports are generated on demand and by organization schedules; email needs SMTP_HOST
+	var mailer reports.Mailer
+	if cfg.SMTPHost != "" {
+		mailer = reports.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	}
+	reportService := reports.NewService(store, mailer, cfg.CheckinDefaultInterval)
+	runners = append(runners, reportService.Run)
+	// Periodic jobs run on one replica at a time and report their last runs (GET /api/v1/admin/jobs)
+	scheduler := jobs.NewScheduler(store, replicaIdentity())
+	// Hosts that miss their check-in window are marked stale (GET /api/v1/hosts?status=stale)
+	staleMonitor := checkin.NewStaleMonitor(store, cfg.CheckinDefaultInterval)
+	scheduler.Add(jobs.Job{Name: "stale-hosts", Interval: checkin.CheckInterval, Run: func(context.Context) error {
+		_, err := staleMonitor.Check()
+		return err
+	}})
+	// Host histories are trimmed to their retention, and long-unseen hosts deleted, every hour
+	retentionEnforcer := retention.NewEnforcer(store, cfg.HostReportRetention, cfg.RetentionDryRun)
+	scheduler.Add(jobs.Job{Name: "host-retention", Interval: retention.CheckInterval, Run: func(context.Context) error {
+		return retentionEnforcer.EnforceAll()
+	}})
+	handlerOpts = append(handlerOpts, handlers.WithRetentionEnforcer(retentionEnforcer))
+	// Host histories are kept in monthly partitions, created ahead and dropped past HOST_REPORT_MAX_AGE.
+	// Creating, attaching and dropping partitions is DDL, so it runs as the migration role if one is configured
+	partitionStore := store
+	if cfg.SeparateMigrationRole() {
+		migrationStore, err := storage.NewPostgresStorage(cfg.MigrationDatabaseURL())
+		if err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Failed to connect as the migration role for host report partitions")
+		}
+		defer migrationStore.Close()
+		migrationStore.DB().SetMaxOpenConns(2)
+		partitionStore = migrationStore
+	}
+	partitioner := retention.NewPartitioner(partitionStore, cfg.HostReportMaxAge, cfg.RetentionDryRun)
+	scheduler.Add(jobs.Job{Name: "host-report-partitions", Interval: retention.CheckInterval, Run: func(context.Context) error {
+		return partitioner.Run()
+	}})
+	// Expired API keys are deleted once they have been listed as expired for the retention period
+	keyCleaner := keyexpiry.NewCleaner(store, cfg.APIKeyExpiredRetention)
+	scheduler.Add(jobs.Job{Name: "api-key-expiry", Interval: keyexpiry.CheckInterval, Run: func(context.Context) error {
+		_, err := keyCleaner.Clean()
+		return err
+	}})
+	runners = append(runners, scheduler.Run)
+	handlerOpts = append(handlerOpts, handlers.WithJobs(scheduler))
+	// Table bloat and vacuum statistics (GET /api/v1/admin/db/maintenance) are exported as metrics
+	runners = append(runners, func(ctx context.Context) { store.RunMaintenanceMonitor(ctx, 5*time.Minute) })
+	handlerOpts = append(handlerOpts, handlers.WithReports(reportService))
+	// Reprocess jobs (started through /api/v1/admin/reprocess) stop with the server
+	reprocessRunner := reprocess.NewRunner(store)
+	defer reprocessRunner.Stop()
+	handlerOpts = append(handlerOpts, handlers.WithReprocessRunner(reprocessRunner))
+	for _, method := range cfg.AuthMethods {
+		switch method {
+		case "oauth":
+			handlerOpts = append(handlerOpts, handlers.WithOAuth(cfg.OAuthAccessTokenTTL))
+		case "session":
+			handlerOpts = append(handlerOpts, handlers.WithSessions(cfg.SessionAccessTokenTTL, cfg.SessionLifetime))
+		case "impersonation":
+			handlerOpts = append(handlerOpts, handlers.WithImpersonation(cfg.ImpersonationTokenTTL))
+		}
+	}
+	h := handlers.New(store, handlerOpts...)
+
+	// Build the authenticator chain in the configured order
+	var authenticators []middleware.Authenticator
+	for _, method := range cfg.AuthMethods {
+		switch method {
+		case "api_key":
+			authenticators = append(authenticators, middleware.NewAPIKeyAuthenticator(store))
+		case "jwt":
+			secret, _ := base64.StdEncoding.DecodeString(cfg.JWTSecret) // validated by config
+			authenticators = append(authenticators, middleware.NewJWTAuthenticator(store, secret, cfg.JWTIssuer, cfg.JWTAudience))
+		case "mtls":
+			authenticators = append(authenticators, middleware.NewMTLSAuthenticator(store))
+		case "oauth":
+			authenticators = append(authenticators, middleware.NewOAuthAuthenticator(store))
+		case "session":
+			authenticators = append(authenticators, middleware.NewSessionAuthenticator(store))
+		case "impersonation":
+			authenticators = append(authenticators, middleware.NewImpersonationAuthenticator(store))
+		}
+	}
+	authMiddleware := middleware.AuthChain(authenticators...)
+	logger.Logger.Info().Strs("methods", cfg.AuthMethods).Msg("Authentication methods enabled")
 
 	// Add request ID middleware (should be first to capture all requests)
 	r.Use(middleware.RequestIDMiddleware())
 
+	// Log every request with its request ID, user, and organization
+	r.Use(middleware.AccessLog())
+
+	// Add JSON:API rendering (early, so it also converts errors from the middleware below)
+	r.Use(middleware.JSONAPI())
+
+	// Add the request ID to error responses (after JSONAPI, so it reaches JSON:API errors too)
+	r.Use(middleware.ErrorRequestID())
+
+	// Recover panics with a structured 500 (after the above, so the response passes through them)
+	r.Use(middleware.Recovery(crashReporter))
+
 	// Add request size limit middleware (should be early to prevent large requests)
 	r.Use(middleware.RequestSizeLimit(cfg))
 
+	// Reject requests that do not match the OpenAPI spec (after the size limit, which bounds the body it reads)
+	if cfg.RequestValidationEnabled {
+		if validator := requestValidator(h); validator != nil {
+			r.Use(middleware.RequestValidation(validator))
+		}
+	}
+
 	// Add security headers middleware (should be early to set headers for all responses)
-	r.Use(middleware.SecurityHeadersMiddleware())
+	r.Use(middleware.SecurityHeadersMiddleware(cfg))
 
 	// Add CSRF token middleware (sets CSRF token cookie for frontend access)
 	r.Use(middleware.CSRFTokenMiddleware())
@@ -151,22 +484,54 @@ func main() {
 	// Add metrics middleware (should be early to capture all requests)
 	r.Use(middleware.MetricsMiddleware())
 
+	// Add error rate tracking (feeds /readyz and the admin error rate endpoint)
+	r.Use(middleware.ErrorRateMiddleware(errorRates))
+
+	// Add latency tracking for autoscalers
+	r.Use(middleware.AutoscaleMiddleware(autoscaler))
+
+	// Add per-organization usage tracking (must wrap the rate limiters to see their rejections)
+	r.Use(middleware.UsageMiddleware(usageTracker))
+
+	// Render errors handlers report with c.Error (inside the middleware above, so the metrics,
+	// error rates, and usage they record see the rendered status, and the responses still
+	// carry the request ID)
+	r.Use(middleware.ErrorHandler())
+
+	// Run each request's queries on one connection named after its request ID, so
+	// GET /api/v1/admin/db/activity attributes them to the request; event streams stay
+	// open and run on the pool
+	r.Use(middleware.QueryConnection(store, "/api/v1/events/stream"))
+
 	// Initialize rate limiting middleware
 	generalRateLimiter, registerRateLimiter, loginRateLimiter, ingestRateLimiter := middleware.InitRateLimitMiddleware()
 
-	// Health check endpoint
+	// Health check endpoints
 	r.GET("/health", h.Health)
+	r.GET("/readyz", h.Ready)
+	r.GET("/startupz", h.Startup)
+
+	// Public status endpoint for status pages and uptime monitors (no database access)
+	r.GET("/status", middleware.IPRateLimitMiddleware(cfg.RateLimitStatus), h.Status)
+
+	// Build information, so operators can tell exactly what is deployed
+	r.GET("/version", middleware.IPRateLimitMiddleware(cfg.RateLimitStatus), h.Version)
 
 	// Root endpoint
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message":    "Welcome to Snailbus API",
-			"version":    Version,
-			"commit":     Commit,
-			"build_time": BuildTime,
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"build_time": build.BuildDate,
 		})
 	})
 
+	// Unknown paths get a JSON error, so they carry the request ID like other errors
+	r.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+
 	// API v1 routes
 	v1 := r.Group("/api/v1")
 	{
@@ -176,106 +541,242 @@ func main() {
 			auth.POST("/register", registerRateLimiter, h.Register)
 			auth.POST("/login", loginRateLimiter, h.Login)
 			auth.POST("/api-key", loginRateLimiter, h.GetAPIKeyFromCredentials) // Get API key from username/password (use login limit)
+			auth.POST("/refresh", loginRateLimiter, h.RefreshSession)
+		}
+
+		// OAuth token endpoints for third-party clients (client credentials, no user authentication)
+		oauth := v1.Group("/oauth")
+		{
+			oauth.POST("/token", loginRateLimiter, h.OAuthToken)
+			oauth.POST("/revoke", loginRateLimiter, h.RevokeOAuthToken)
 		}
 
-		// Protected routes (require API key authentication)
+		// Agent enrollment (the enrollment token is the only credential)
+		v1.POST("/enroll", loginRateLimiter, h.Enroll)
+
+		// Protected routes (require authentication)
 		protected := v1.Group("")
 		protected.Use(generalRateLimiter) // Apply general API key rate limiting
-		protected.Use(middleware.AuthMiddleware(store))
-		protected.Use(middleware.OrgContextMiddleware()) // Extract org_id and role for easy access
+		protected.Use(authMiddleware)
+		protected.Use(middleware.OrgContextMiddleware(store)) // Extract org_id and role for easy access
 		{
 			// Auth endpoints - accessible to all authenticated users
 			protected.GET("/auth/me", h.GetMe)
+			protected.GET("/auth/orgs", h.ListMyOrganizations)
+			protected.POST("/auth/logout", h.Logout)
 
 			// API key management - accessible to all authenticated users
 			protected.POST("/api-keys", h.CreateAPIKey)
 			protected.GET("/api-keys", h.ListAPIKeys)
+			protected.DELETE("/api-keys", h.DeleteExpiredAPIKeys)
 			protected.DELETE("/api-keys/:id", h.DeleteAPIKey)
+			protected.PUT("/api-keys/:id/endpoints", h.UpdateAPIKeyEndpoints)
+
+			// Roles and their permissions, for clients deciding what to offer a user
+			protected.GET("/roles", h.ListRoles)
 
 			// Host management endpoints - viewing accessible to all authenticated users
 			protected.GET("/hosts", h.ListHosts)
+			protected.GET("/hosts/export", h.ExportHosts)
+			protected.GET("/hosts/facets", h.GetHostFacets)
+			protected.GET("/hosts/search", h.FindHosts)
 			protected.GET("/hosts/:host_id", h.GetHost)
-
-			// Host deletion - requires editor or admin role
-			editorOrAdmin := protected.Group("")
-			editorOrAdmin.Use(middleware.RequireRole("editor", "admin"))
+			protected.GET("/hosts/:host_id/events", h.GetHostEvents)
+			protected.GET("/hosts/:host_id/reports", h.ListHostReports)
+			protected.GET("/hosts/:host_id/reports/:report_id", h.GetHostReport)
+			protected.GET("/hosts/:host_id/diff", h.GetHostReportDiff)
+			protected.GET("/hosts/:host_id/services", h.GetHostServices)
+			protected.GET("/hosts/:host_id/uptime", h.GetHostUptime)
+			protected.GET("/events", h.ListHostEvents)
+			protected.GET("/events/stream", h.StreamHostEvents)
+			protected.GET("/accounts", h.ListAccounts)
+			protected.GET("/services", h.ListServices)
+			protected.GET("/checkins", h.ListCheckins)
+
+			// GraphQL over hosts, report history, host counts, users, and API keys, scoped
+			// like the REST endpoints above
+			protected.POST("/graphql", h.GraphQL)
+
+			// Delegated tokens - users authorize and revoke third-party integrations
+			protected.POST("/oauth/authorize", h.AuthorizeOAuthClient)
+			protected.GET("/oauth/grants", h.ListOAuthGrants)
+			protected.DELETE("/oauth/grants/:id", h.DeleteOAuthGrant)
+
+			// Fleet statistics
+			protected.GET("/stats/compare", h.CompareFleet)
+			protected.GET("/stats/uptime", h.GetUptimeStats)
+
+			// Feature flags in effect for the caller's organization
+			protected.GET("/orgs/current/flags", h.GetOrgFeatureFlags)
+
+			// Ingest receipt verification
+			protected.GET("/receipts/:id/verify", h.VerifyReceipt)
+
+			// Host probe job results
+			protected.GET("/probes/:id", h.GetProbeJob)
+
+			// Host groups
+			protected.GET("/groups", h.ListHostGroups)
+			protected.GET("/groups/:group_id", h.GetHostGroup)
+
+			// Host deletion, tagging, probe results, and grouping - requires editor or admin role
+			editorOrAdmin := routeRoles.RequireRole(protected, "editor", "admin")
 			{
 				editorOrAdmin.DELETE("/hosts/:host_id", h.DeleteHost)
+				editorOrAdmin.PATCH("/hosts/:host_id", h.UpdateHost)
+				editorOrAdmin.PUT("/hosts/:host_id/tags", h.SetHostTags)
+				editorOrAdmin.POST("/hosts/:host_id/restore", h.RestoreHost)
+				editorOrAdmin.POST("/hosts/:host_id/archive", h.ArchiveHost)
+				editorOrAdmin.POST("/hosts/:host_id/unarchive", h.UnarchiveHost)
+				editorOrAdmin.POST("/probes/claim", h.ClaimProbeJob)
+				editorOrAdmin.POST("/probes/:id/results", h.SubmitProbeResults)
+				editorOrAdmin.POST("/groups", h.CreateHostGroup)
+				editorOrAdmin.PUT("/groups/:group_id", h.UpdateHostGroup)
+				editorOrAdmin.DELETE("/groups/:group_id", h.DeleteHostGroup)
+				editorOrAdmin.PUT("/groups/:group_id/hosts/:host_id", h.AddHostGroupMember)
+				editorOrAdmin.DELETE("/groups/:group_id/hosts/:host_id", h.RemoveHostGroupMember)
 			}
 
 			// User management endpoints - admin only
-			adminOnly := protected.Group("")
-			adminOnly.Use(middleware.RequireRole("admin"))
+			adminOnly := routeRoles.RequireRole(protected, "admin")
 			{
 				adminOnly.GET("/users", h.ListUsers)
+				adminOnly.POST("/probes", h.CreateProbeJob)
+				adminOnly.GET("/orgs/current/usage", h.GetOrgUsage)
+				adminOnly.GET("/orgs/current/access-report", h.GetAccessReport)
+				adminOnly.GET("/orgs/current/remote-write", h.GetRemoteWrite)
+				adminOnly.PUT("/orgs/current/remote-write", h.SetRemoteWrite)
+				adminOnly.DELETE("/orgs/current/remote-write", h.DeleteRemoteWrite)
+				adminOnly.GET("/orgs/current/ingest-filter", h.GetIngestFilter)
+				adminOnly.PUT("/orgs/current/ingest-filter", h.SetIngestFilter)
+				adminOnly.DELETE("/orgs/current/ingest-filter", h.DeleteIngestFilter)
+				adminOnly.GET("/orgs/current/tag-rules", h.GetHostTagRules)
+				adminOnly.PUT("/orgs/current/tag-rules", h.SetHostTagRules)
+				adminOnly.DELETE("/orgs/current/tag-rules", h.DeleteHostTagRules)
+				adminOnly.POST("/orgs/current/tag-rules/apply", h.ApplyHostTagRules)
+				adminOnly.GET("/orgs/current/checkin-schedule", h.GetCheckinSchedule)
+				adminOnly.PUT("/orgs/current/checkin-schedule", h.SetCheckinSchedule)
+				adminOnly.DELETE("/orgs/current/checkin-schedule", h.DeleteCheckinSchedule)
+				adminOnly.GET("/orgs/current/host-report-retention", h.GetHostReportRetention)
+				adminOnly.PUT("/orgs/current/host-report-retention", h.SetHostReportRetention)
+				adminOnly.DELETE("/orgs/current/host-report-retention", h.DeleteHostReportRetention)
+				adminOnly.POST("/orgs/current/host-report-retention/run", h.RunHostReportRetention)
+				adminOnly.POST("/reports", h.GenerateReport)
+				adminOnly.GET("/reports", h.ListReports)
+				adminOnly.GET("/reports/:id", h.GetReport)
+				adminOnly.GET("/orgs/current/report-schedule", h.GetReportSchedule)
+				adminOnly.PUT("/orgs/current/report-schedule", h.SetReportSchedule)
+				adminOnly.DELETE("/orgs/current/report-schedule", h.DeleteReportSchedule)
 				adminOnly.POST("/users", h.CreateUser)
 				adminOnly.PUT("/users/:user_id/role", h.UpdateUserRole)
+				adminOnly.POST("/events/replay", h.ReplayHostEvents)
 				adminOnly.DELETE("/users/:user_id", h.DeleteUser)
+				adminOnly.GET("/orgs/current/members", h.ListOrgMembers)
+				adminOnly.POST("/orgs/current/members", h.AddOrgMember)
+				adminOnly.PUT("/orgs/current/members/:user_id/role", h.UpdateOrgMemberRole)
+				adminOnly.DELETE("/orgs/current/members/:user_id", h.RemoveOrgMember)
+				adminOnly.GET("/actions", h.ListActions)
+				adminOnly.POST("/actions", h.CreateAction)
+				adminOnly.GET("/actions/:id", h.GetAction)
+				adminOnly.PUT("/actions/:id", h.UpdateAction)
+				adminOnly.DELETE("/actions/:id", h.DeleteAction)
+				adminOnly.POST("/actions/:id/signing-secret/rotate", h.RotateActionSecret)
+				adminOnly.GET("/actions/:id/runs", h.ListActionRuns)
+				adminOnly.POST("/actions/:id/runs/:run_id/retry", h.RetryActionRun)
+				adminOnly.GET("/webhooks", h.ListWebhooks)
+				adminOnly.POST("/webhooks", h.CreateWebhook)
+				adminOnly.GET("/webhooks/:id", h.GetWebhook)
+				adminOnly.PUT("/webhooks/:id", h.UpdateWebhook)
+				adminOnly.DELETE("/webhooks/:id", h.DeleteWebhook)
+				adminOnly.GET("/webhooks/:id/deliveries", h.ListWebhookDeliveries)
+				adminOnly.GET("/audit", h.ListAuditEvents)
+				adminOnly.GET("/secrets", h.ListOrgSecrets)
+				adminOnly.PUT("/secrets/:name", h.SetOrgSecret)
+				adminOnly.DELETE("/secrets/:name", h.DeleteOrgSecret)
+				adminOnly.GET("/oauth/clients", h.ListOAuthClients)
+				adminOnly.POST("/oauth/clients", h.CreateOAuthClient)
+				adminOnly.DELETE("/oauth/clients/:id", h.DeleteOAuthClient)
+				adminOnly.GET("/enroll-tokens", h.ListEnrollmentTokens)
+				adminOnly.POST("/enroll-tokens", h.CreateEnrollmentToken)
+				adminOnly.DELETE("/enroll-tokens/:id", h.DeleteEnrollmentToken)
+				adminOnly.POST("/bundles", h.ImportBundle)
+				adminOnly.GET("/bundles", h.ListImportBatches)
+				adminOnly.GET("/bundles/:id", h.GetImportBatch)
+				adminOnly.GET("/ioc-lists", h.ListIOCLists)
+				adminOnly.POST("/ioc-lists", h.CreateIOCList)
+				adminOnly.GET("/ioc-lists/:id", h.GetIOCList)
+				adminOnly.PUT("/ioc-lists/:id", h.ReplaceIOCList)
+				adminOnly.DELETE("/ioc-lists/:id", h.DeleteIOCList)
+				adminOnly.GET("/ioc-matches", h.ListIOCMatches)
+				adminOnly.GET("/users/:user_id/host-access", h.GetHostAccessPolicy)
+				adminOnly.PUT("/users/:user_id/host-access", h.UpdateHostAccessPolicy)
+			}
+
+			// Operational endpoints - system administrators only (users.is_admin)
+			systemAdmin := routeRoles.Record(protected.Group("/admin"), middleware.SystemAdminRole)
+			systemAdmin.Use(middleware.AdminMiddleware(store))
+			{
+				systemAdmin.GET("/db/activity", h.ListDBActivity)
+				systemAdmin.POST("/db/cancel/:pid", h.CancelDBQuery)
+				systemAdmin.GET("/db/maintenance", h.GetDBMaintenance)
+				systemAdmin.GET("/error-rates", h.ListErrorRates)
+				systemAdmin.GET("/jobs", h.ListJobs)
+				systemAdmin.GET("/diagnostics", h.GetDiagnostics)
+				systemAdmin.GET("/flags", h.ListFeatureFlags)
+				systemAdmin.PUT("/flags/:name", h.SetFeatureFlag)
+				systemAdmin.DELETE("/flags/:name", h.DeleteFeatureFlag)
+				systemAdmin.PUT("/flags/:name/orgs/:org_id", h.SetFeatureFlagOverride)
+				systemAdmin.DELETE("/flags/:name/orgs/:org_id", h.DeleteFeatureFlagOverride)
+				systemAdmin.POST("/reprocess", h.StartReprocess)
+				systemAdmin.GET("/reprocess", h.ListReprocessJobs)
+				systemAdmin.GET("/reprocess/:job_id", h.GetReprocessJob)
+				systemAdmin.POST("/reprocess/:job_id/cancel", h.CancelReprocessJob)
+				systemAdmin.POST("/impersonate/:user_id", h.Impersonate)
+			}
+
+			// API metadata - system administrators only
+			meta := routeRoles.Record(protected.Group("/meta"), middleware.SystemAdminRole)
+			meta.Use(middleware.AdminMiddleware(store))
+			{
+				meta.GET("/spec-drift", h.GetSpecDrift)
 			}
 		}
 
 		// Ingest endpoint - requires editor or admin role (viewers cannot upload)
-		ingest := v1.Group("")
-		ingest.Use(ingestRateLimiter) // Apply stricter rate limiting for ingest
-		ingest.Use(middleware.AuthMiddleware(store))
-		ingest.Use(middleware.OrgContextMiddleware()) // Extract org_id and role
-		ingest.Use(middleware.RequireRole("editor", "admin"))
+		ingestAuth := v1.Group("")
+		ingestAuth.Use(ingestRateLimiter) // Apply stricter rate limiting for ingest
+		ingestAuth.Use(authMiddleware)
+		ingestAuth.Use(middleware.OrgContextMiddleware(store)) // Extract org_id and role
+		ingest := routeRoles.RequireRole(ingestAuth, "editor", "admin")
+		if ingestAdmission != nil {
+			// Bounded concurrency with a short wait queue; sheds load with 429 before it reaches the database pool
+			ingest.Use(middleware.IngestAdmission(ingestAdmission))
+		}
+		ingest.Use(middleware.AutoscaleIngest(autoscaler))
 		{
 			ingest.POST("/ingest", h.Ingest)
+			ingest.POST("/ingest/batch", h.IngestBatch)
 		}
 	}
 
 	// OpenAPI specification endpoints (generated by swag)
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// The Swagger UI gets its own policy, it loads inline scripts and data: images
+	docsHeaders := middleware.SecurityHeadersOverride(middleware.SecurityHeaders{
+		ContentSecurityPolicy: cfg.DocsContentSecurityPolicy,
+	})
+	r.GET("/swagger/*any", docsHeaders, ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Legacy endpoints for backward compatibility (now serve generated spec)
 	r.GET("/openapi.yaml", h.GetOpenAPISpecYAML)
 	r.GET("/openapi.json", h.GetOpenAPISpecJSON)
 
-	// Start main API server
-	apiServer := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: r,
-	}
-
-	// Start metrics server on separate port
-	// This provides network-level security - metrics are only accessible from localhost/internal network
-	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", promhttp.Handler())
-	metricsServer := &http.Server{
-		Addr:    cfg.MetricsBindAddr + ":" + cfg.MetricsPort,
-		Handler: metricsMux,
-	}
-
-	// Start both servers concurrently
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	// Start main API server
-	go func() {
-		defer wg.Done()
-		logger.Logger.Info().
-			Str("port", cfg.Port).
-			Str("version", Version).
-			Str("commit", Commit).
-			Str("build_time", BuildTime).
-			Msg("Starting Snailbus API server")
-		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Logger.Fatal().Err(err).Msg("Failed to start API server")
-		}
-	}()
-
-	// Start metrics server
-	go func() {
-		defer wg.Done()
-		logger.Logger.Info().
-			Str("address", cfg.MetricsBindAddr).
-			Str("port", cfg.MetricsPort).
-			Msg("Starting metrics server")
-		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Logger.Fatal().Err(err).Msg("Failed to start metrics server")
-		}
-	}()
+	// Serve the router and start the background jobs
+	gate.Open(r)
+	state.MarkStarted()
+	logger.Logger.Info().Dur("startup", time.Since(state.Snapshot().StartedAt)).Msg("Startup complete; serving requests")
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobsDone := startJobs(jobsCtx, cfg, runners)
 
 	// Wait for interrupt signal to gracefully shutdown the servers
 	quit := make(chan os.Signal, 1)
@@ -284,11 +785,23 @@ func main() {
 
 	logger.Logger.Info().Msg("Received shutdown signal, initiating graceful shutdown...")
 
-	// Create shutdown context with 30 second timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Fail readiness first so load balancers stop sending new requests; time
+	// already spent draining in the preStop hook counts towards the delay
+	state.Drain()
+	if remaining := cfg.ShutdownDelay - state.DrainedFor(); remaining > 0 {
+		logger.Logger.Info().Dur("delay", remaining).Msg("Step 1/5: Failing readiness before closing the listener (a second signal skips the wait)...")
+		select {
+		case <-time.After(remaining):
+		case <-quit:
+		}
+	} else {
+		logger.Logger.Info().Msg("Step 1/5: Readiness is failing")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer shutdownCancel()
 
-	logger.Logger.Info().Msg("Step 1/4: Waiting for in-flight HTTP requests to complete (30s timeout)...")
+	logger.Logger.Info().Dur("timeout", cfg.ShutdownTimeout).Msg("Step 2/5: Waiting for in-flight HTTP requests to complete...")
 
 	// Gracefully shutdown API server (waits for in-flight requests)
 	if err := apiServer.Shutdown(shutdownCtx); err != nil {
@@ -304,7 +817,18 @@ func main() {
 		logger.Logger.Info().Msg("✓ Metrics server shut down successfully")
 	}
 
-	logger.Logger.Info().Msg("Step 2/4: Closing database connections...")
+	logger.Logger.Info().Msg("Step 3/5: Stopping background jobs...")
+
+	// Jobs finish the work they have claimed, and the leader releases its lease
+	stopJobs()
+	select {
+	case <-jobsDone:
+		logger.Logger.Info().Msg("✓ Background jobs stopped")
+	case <-shutdownCtx.Done():
+		logger.Logger.Warn().Msg("Background jobs did not stop before the shutdown timeout")
+	}
+
+	logger.Logger.Info().Msg("Step 4/5: Closing database connections...")
 
 	// Close database connections properly
 	if store != nil {
@@ -317,12 +841,19 @@ func main() {
 		}
 	}
 
-	logger.Logger.Info().Msg("Step 3/4: Flushing logs...")
+	logger.Logger.Info().Msg("Step 5/5: Flushing crash reports and logs...")
 
-	// Flush any buffered logs (zerolog handles this automatically, but we log completion)
-	logger.Logger.Info().Msg("✓ Log flushing completed")
+	// Reports of panics shortly before the signal may still be on their way; logs are
+	// written unbuffered, so only the reports need waiting for
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer flushCancel()
+	if err := crashReporter.Flush(flushCtx); err != nil {
+		logger.Logger.Warn().Err(err).Msg("Crash reports were still being delivered at shutdown")
+	} else {
+		logger.Logger.Info().Msg("✓ Crash reports and logs flushed")
+	}
 
-	logger.Logger.Info().Msg("Step 4/4: Graceful shutdown completed")
+	logger.Logger.Info().Msg("Graceful shutdown completed")
 
 	// Check if shutdown was graceful or forced
 	if shutdownCtx.Err() == context.DeadlineExceeded {
@@ -332,7 +863,160 @@ func main() {
 	}
 }
 
+// startServers starts the API server, serving handler, and the metrics server
+// The metrics server also serves /prestop, the target of the -prestop hook, and the
+// autoscaling signals at /autoscaling.
+func startServers(cfg *config.Config, handler http.Handler, state *lifecycle.State, autoscaler *autoscale.Tracker, build buildinfo.Info) (*http.Server, *http.Server) {
+	apiServer := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: handler,
+	}
+
+	// Client certificates are requested but optional, so the other
+	// authenticators keep working on the same listener
+	if cfg.TLSClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			logger.Logger.Fatal().Err(err).Msg("Failed to read TLS client CA file")
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			logger.Logger.Fatal().Str("file", cfg.TLSClientCAFile).Msg("TLS client CA file contains no certificates")
+		}
+		apiServer.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  clientCAs,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	// Start metrics server on separate port
+	// This provides network-level security - metrics are only accessible from localhost/internal network
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.Handler())
+	metricsMux.Handle("/prestop", lifecycle.PreStopHandler(state, cfg.ShutdownDelay))
+	metricsMux.Handle("/autoscaling", autoscaler.Handler())
+	metricsServer := &http.Server{
+		Addr:    net.JoinHostPort(cfg.MetricsBindAddr, cfg.MetricsPort),
+		Handler: metricsMux,
+	}
+
+	// Start main API server
+	go func() {
+		logger.Logger.Info().
+			Str("port", cfg.Port).
+			Str("version", build.Version).
+			Str("commit", build.Commit).
+			Str("build_date", build.BuildDate).
+			Bool("modified", build.Modified).
+			Str("go_version", build.GoVersion).
+			Str("platform", build.Platform).
+			Bool("tls", cfg.TLSCertFile != "").
+			Msg("Starting Snailbus API server")
+		var err error
+		if cfg.TLSCertFile != "" {
+			err = apiServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = apiServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Logger.Fatal().Err(err).Msg("Failed to start API server")
+		}
+	}()
+
+	// Start metrics server
+	go func() {
+		logger.Logger.Info().
+			Str("address", cfg.MetricsBindAddr).
+			Str("port", cfg.MetricsPort).
+			Msg("Starting metrics server")
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Logger.Fatal().Err(err).Msg("Failed to start metrics server")
+		}
+	}()
+
+	return apiServer, metricsServer
+}
+
+// startJobs runs the background job runners until ctx is done: on every replica, or
+// with LEADER_ELECTION only on the replica holding the lease. The returned channel
+// is closed once they have stopped and any lease has been released.
+func startJobs(ctx context.Context, cfg *config.Config, runners []func(ctx context.Context)) <-chan struct{} {
+	runJobs := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for _, runner := range runners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runner(ctx)
+			}()
+		}
+		wg.Wait()
+	}
+
+	done := make(chan struct{})
+	if cfg.LeaderElection == "" {
+		go func() {
+			defer close(done)
+			runJobs(ctx)
+		}()
+		return done
+	}
+
+	identity := replicaIdentity()
+	elector, err := leader.NewInCluster(leader.Config{
+		Namespace:     cfg.LeaderElectionNamespace,
+		Name:          cfg.LeaderElectionLease,
+		Identity:      identity,
+		LeaseDuration: cfg.LeaderElectionLeaseDuration,
+	})
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("Failed to set up leader election")
+	}
+	logger.Logger.Info().Str("lease", cfg.LeaderElectionLease).Str("identity", identity).Msg("Background jobs run on the leader only")
+	go func() {
+		defer close(done)
+		elector.Run(ctx, runJobs)
+	}()
+	return done
+}
+
+// replicaIdentity names this replica in the leader lease and background job runs
+// The pod name is unique among replicas and recognizable.
+func replicaIdentity() string {
+	if identity := os.Getenv("POD_NAME"); identity != "" {
+		return identity
+	}
+	identity, _ := os.Hostname()
+	return identity
+}
+
+// preStop asks the server in this container to drain, through the metrics server,
+// and returns once it has drained for SHUTDOWN_DELAY. It is meant as a Kubernetes
+// preStop exec hook, which runs inside the container and so reaches the metrics
+// server even when it only listens on localhost.
+func preStop() error {
+	host := getEnv("METRICS_BIND_ADDRESS", "127.0.0.1")
+	if host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := "http://" + net.JoinHostPort(host, getEnv("METRICS_PORT", "9090")) + "/prestop"
+
+	// No timeout: the kubelet ends the hook at the termination grace period
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
 // runMigrations runs database migrations
+// Applied migrations are checked against their files first, and the checksums of
+// newly applied ones are recorded for the next start.
 func runMigrations(databaseURL, migrationsPath string) error {
 	// Parse database URL to get driver instance
 	db, err := sql.Open("postgres", databaseURL)
@@ -341,6 +1025,24 @@ func runMigrations(databaseURL, migrationsPath string) error {
 	}
 	defer db.Close()
 
+	// Verify applied migrations before changing anything
+	files, err := migrations.Load(migrationsPath)
+	if errors.Is(err, migrations.ErrUnsupportedSource) {
+		logger.Logger.Warn().Str("source", migrationsPath).Msg("Migration checksums are not verified for this migration source")
+		files = nil
+	} else if err != nil {
+		return err
+	}
+	var before *migrations.State
+	if files != nil {
+		if before, err = migrations.ReadState(db); err != nil {
+			return err
+		}
+		if err := migrations.Verify(files, before); err != nil {
+			return err
+		}
+	}
+
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to create migration driver: %w", err)
@@ -368,9 +1070,185 @@ func runMigrations(databaseURL, migrationsPath string) error {
 		logger.Logger.Info().Msg("Database migrations completed successfully")
 	}
 
+	if files == nil {
+		return nil
+	}
+	version, _, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	recorded, err := migrations.RecordChecksums(db, files, before, version)
+	if err != nil {
+		return err
+	}
+	if recorded > 0 {
+		logger.Logger.Info().Int("count", recorded).Msg("Recorded migration checksums")
+	}
+
+	return nil
+}
+
+// printMigrationPlan prints the pending migrations and the locks they take without
+// applying them or writing to the database
+func printMigrationPlan(databaseURL, migrationsPath string) error {
+	files, err := migrations.Load(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	state, err := migrations.ReadState(db)
+	if err != nil {
+		return err
+	}
+	return migrations.WritePlan(os.Stdout, files, state)
+}
+
+// enableSecretEncryption loads the master keys and re-encrypts the secrets that are not
+// sealed with the primary one yet. Values that can't be re-encrypted, e.g. because they
+// were sealed with a key no longer in the file, are logged rather than fatal.
+func enableSecretEncryption(store *storage.PostgresStorage, keyFile string) error {
+	keys, err := secretbox.LoadKeyFile(keyFile)
+	if err != nil {
+		return err
+	}
+	store.EnableSecretEncryption(secretbox.New(keys))
+
+	counts, err := store.ReencryptSecrets(context.Background())
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("Failed to re-encrypt stored secrets")
+	}
+	resealed := 0
+	for _, n := range counts {
+		resealed += n
+	}
+	logger.Logger.Info().
+		Str("primary_key_id", keys.PrimaryKeyID()).
+		Strs("key_ids", keys.KeyIDs()).
+		Int("resealed", resealed).
+		Msg("Secret encryption enabled")
+	return nil
+}
+
+// checkStoredSecrets logs the stored secrets left in plaintext, which remain after a failed
+// re-encryption or when SECRETS_KEY_FILE is not set, and fails when secrets are sealed but
+// no master keys are configured to open them
+func checkStoredSecrets(store *storage.PostgresStorage, encrypted bool) error {
+	plaintext, sealed, err := store.CountSecrets(context.Background())
+	if err != nil {
+		logger.Logger.Warn().Err(err).Msg("Failed to count stored secrets")
+		return nil
+	}
+	total := func(counts map[string]int) int {
+		n := 0
+		for _, count := range counts {
+			n += count
+		}
+		return n
+	}
+
+	if !encrypted && total(sealed) > 0 {
+		return fmt.Errorf("%d stored secrets are encrypted but SECRETS_KEY_FILE is not set", total(sealed))
+	}
+	if n := total(plaintext); n > 0 {
+		for column, count := range plaintext {
+			if count == 0 {
+				delete(plaintext, column)
+			}
+		}
+		event := logger.Logger.Warn()
+		message := "Stored secrets are in plaintext; set SECRETS_KEY_FILE to encrypt them"
+		if encrypted {
+			event = logger.Logger.Error()
+			message = "Stored secrets remain in plaintext after re-encryption"
+		}
+		event.Int("plaintext", n).Interface("columns", plaintext).Msg(message)
+	}
 	return nil
 }
 
+// checkDatabasePrivileges checks that the DATABASE_URL role has the table privileges the
+// server needs and, when migrations run as a separate role, that it cannot run DDL
+// Problems are logged rather than fatal; a role missing privileges fails /readyz.
+func checkDatabasePrivileges(store *storage.PostgresStorage, restricted bool) *models.DatabasePrivileges {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	privileges, err := store.DatabasePrivileges(ctx)
+	if err != nil {
+		logger.Logger.Warn().Err(err).Msg("Failed to check database privileges")
+		return nil
+	}
+	privileges.Restricted = restricted
+
+	if len(privileges.Missing) > 0 {
+		logger.Logger.Error().
+			Str("role", privileges.Role).
+			Strs("missing", privileges.Missing).
+			Msg("Database role is missing privileges; /readyz will report not ready until they are granted and the server restarts")
+	}
+	if restricted && len(privileges.DDL) > 0 {
+		logger.Logger.Warn().
+			Str("role", privileges.Role).
+			Strs("ddl", privileges.DDL).
+			Msg("DATABASE_MIGRATION_URL is set but the DATABASE_URL role can still change the schema")
+	} else if restricted {
+		logger.Logger.Info().Str("role", privileges.Role).Msg("Database role is restricted to data access")
+	}
+	return privileges
+}
+
+// seedDemo creates the demo organization unless it already exists
+// Failures are logged rather than fatal: the server is still usable without demo data.
+func seedDemo(store storage.Storage) {
+	result, err := demo.Seed(store, demo.Options{})
+	if errors.Is(err, demo.ErrAlreadySeeded) {
+		logger.Logger.Info().Str("org", demo.DefaultOrgName).Msg("Demo mode: demo organization already exists")
+		return
+	}
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("Demo mode: failed to seed demo organization")
+		return
+	}
+
+	usernames := make([]string, 0, len(result.Users))
+	for _, user := range result.Users {
+		usernames = append(usernames, user.Username+" ("+user.Role+")")
+	}
+	logger.Logger.Warn().
+		Str("org", result.Organization.Name).
+		Strs("users", usernames).
+		Str("password", result.Password).
+		Str("api_key", result.APIKey).
+		Int("hosts", result.Hosts).
+		Msg("Demo mode: seeded demo organization; do not enable DEMO_MODE on a production server")
+}
+
+// requestValidator builds the request validator from the OpenAPI spec the server serves
+// Without a usable spec, requests are not validated rather than refused.
+func requestValidator(h *handlers.Handlers) *specvalidate.Validator {
+	spec, source, err := h.OpenAPISpec()
+	if err != nil {
+		logger.Logger.Warn().Err(err).Msg("OpenAPI spec not available; requests will not be validated against it")
+		return nil
+	}
+	validator, err := specvalidate.New(spec)
+	if err != nil {
+		logger.Logger.Warn().Err(err).Str("spec_source", source).Msg("Invalid OpenAPI spec; requests will not be validated against it")
+		return nil
+	}
+	logger.Logger.Info().Str("spec_source", source).Msg("Validating requests against the OpenAPI spec")
+	return validator
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,7 @@
+-- Rollback migration: Remove host tags and host access policies
+
+DROP INDEX IF EXISTS idx_host_access_policies_org_id;
+DROP INDEX IF EXISTS idx_host_tags_org_id_tag;
+
+DROP TABLE IF EXISTS host_access_policies;
+DROP TABLE IF EXISTS host_tags;
@@ -0,0 +1,26 @@
+-- Migration: Add host tags and tag-based host access policies
+-- Tags are free-form labels (e.g. "team:web") attached to hosts. Access policies
+-- restrict a user to hosts carrying at least one of the listed tags; users without
+-- any policy rows keep unrestricted visibility within their organization.
+
+-- Host tags table
+CREATE TABLE IF NOT EXISTS host_tags (
+    host_id UUID NOT NULL REFERENCES hosts(host_id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (host_id, tag)
+);
+
+-- Host access policies table (one row per allowed tag per user)
+CREATE TABLE IF NOT EXISTS host_access_policies (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag)
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_host_tags_org_id_tag ON host_tags(org_id, tag);
+CREATE INDEX IF NOT EXISTS idx_host_access_policies_org_id ON host_access_policies(org_id);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove per-API-key endpoint restrictions
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS allowed_endpoints;
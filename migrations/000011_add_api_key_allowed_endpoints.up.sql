@@ -0,0 +1,5 @@
+-- Migration: Add per-API-key endpoint restrictions
+-- An empty list means the key may call any endpoint its user's role allows.
+-- Entries are "[METHOD ]/path" patterns, e.g. "POST /api/v1/ingest" or "/api/v1/hosts/*".
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_endpoints TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,12 @@
+-- Rollback migration: Remove pre-aggregated host facet counters
+
+DROP TRIGGER IF EXISTS maintain_host_tag_facets ON host_tags;
+DROP TRIGGER IF EXISTS maintain_host_facets ON hosts;
+
+DROP FUNCTION IF EXISTS maintain_host_tag_facets();
+DROP FUNCTION IF EXISTS maintain_host_facets();
+DROP FUNCTION IF EXISTS host_os_version(JSONB);
+DROP FUNCTION IF EXISTS host_os_name(JSONB);
+DROP FUNCTION IF EXISTS bump_host_facet(UUID, TEXT, TEXT, BIGINT);
+
+DROP TABLE IF EXISTS host_facet_counts;
@@ -0,0 +1,111 @@
+-- Migration: Add pre-aggregated host facet counters
+-- Counts of hosts per OS name, OS version, and tag are maintained incrementally by
+-- triggers on hosts and host_tags, so they are updated inside the same transaction as
+-- every ingest, delete, and tag change (including cascading deletes) and can be read
+-- without scanning hosts. The pseudo-facet 'total' (value '*') counts all hosts.
+--
+-- There is deliberately no foreign key to organizations: when an organization is
+-- deleted, the cascading host deletes decrement its counters to zero, which removes them.
+
+CREATE TABLE IF NOT EXISTS host_facet_counts (
+    org_id UUID NOT NULL,
+    facet TEXT NOT NULL,
+    value TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (org_id, facet, value)
+);
+
+-- Apply a delta to one counter, dropping it once it reaches zero
+CREATE OR REPLACE FUNCTION bump_host_facet(p_org_id UUID, p_facet TEXT, p_value TEXT, p_delta BIGINT)
+RETURNS void AS $$
+BEGIN
+    IF p_value IS NULL OR p_value = '' THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO host_facet_counts (org_id, facet, value, count)
+    VALUES (p_org_id, p_facet, p_value, p_delta)
+    ON CONFLICT (org_id, facet, value) DO UPDATE SET count = host_facet_counts.count + EXCLUDED.count;
+
+    IF p_delta < 0 THEN
+        DELETE FROM host_facet_counts
+        WHERE org_id = p_org_id AND facet = p_facet AND value = p_value AND count <= 0;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- OS facets of a host report (values match the os_name/os_version shown in host summaries)
+CREATE OR REPLACE FUNCTION host_os_name(p_data JSONB) RETURNS TEXT AS $$
+    SELECT NULLIF(p_data->'system'->'os'->>'name', '');
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION host_os_version(p_data JSONB) RETURNS TEXT AS $$
+    SELECT NULLIF(concat_ws(' ', p_data->'system'->'os'->>'name', p_data->'system'->'os'->>'version'), '');
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION maintain_host_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND OLD.org_id IS NOT DISTINCT FROM NEW.org_id
+        AND host_os_version(OLD.data) IS NOT DISTINCT FROM host_os_version(NEW.data)
+        AND host_os_name(OLD.data) IS NOT DISTINCT FROM host_os_name(NEW.data) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM bump_host_facet(OLD.org_id, 'os_name', host_os_name(OLD.data), -1);
+        PERFORM bump_host_facet(OLD.org_id, 'os_version', host_os_version(OLD.data), -1);
+        IF TG_OP = 'DELETE' THEN
+            PERFORM bump_host_facet(OLD.org_id, 'total', '*', -1);
+        END IF;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM bump_host_facet(NEW.org_id, 'os_name', host_os_name(NEW.data), 1);
+        PERFORM bump_host_facet(NEW.org_id, 'os_version', host_os_version(NEW.data), 1);
+        IF TG_OP = 'INSERT' THEN
+            PERFORM bump_host_facet(NEW.org_id, 'total', '*', 1);
+        END IF;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION maintain_host_tag_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM bump_host_facet(OLD.org_id, 'tag', OLD.tag, -1);
+    ELSE
+        PERFORM bump_host_facet(NEW.org_id, 'tag', NEW.tag, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS maintain_host_facets ON hosts;
+CREATE TRIGGER maintain_host_facets AFTER INSERT OR UPDATE OR DELETE ON hosts
+    FOR EACH ROW EXECUTE FUNCTION maintain_host_facets();
+
+DROP TRIGGER IF EXISTS maintain_host_tag_facets ON host_tags;
+CREATE TRIGGER maintain_host_tag_facets AFTER INSERT OR DELETE ON host_tags
+    FOR EACH ROW EXECUTE FUNCTION maintain_host_tag_facets();
+
+-- Backfill counters from existing data
+DELETE FROM host_facet_counts;
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'total', '*', COUNT(*) FROM hosts GROUP BY org_id;
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'os_name', host_os_name(data), COUNT(*)
+FROM hosts WHERE host_os_name(data) IS NOT NULL
+GROUP BY org_id, host_os_name(data);
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'os_version', host_os_version(data), COUNT(*)
+FROM hosts WHERE host_os_version(data) IS NOT NULL
+GROUP BY org_id, host_os_version(data);
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'tag', tag, COUNT(*) FROM host_tags GROUP BY org_id, tag;
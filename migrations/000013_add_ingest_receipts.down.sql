@@ -0,0 +1,6 @@
+-- Rollback migration: Remove ingest receipts
+
+DROP INDEX IF EXISTS idx_ingest_receipts_host_id;
+DROP INDEX IF EXISTS idx_ingest_receipts_org_id;
+
+DROP TABLE IF EXISTS ingest_receipts;
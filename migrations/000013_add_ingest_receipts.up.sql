@@ -0,0 +1,20 @@
+-- Migration: Add signed ingest receipts
+-- A receipt is issued for every accepted report so agents and auditors can later prove
+-- what was submitted. Receipts outlive the host they describe (no foreign key on
+-- host_id) but are removed with their organization.
+
+CREATE TABLE IF NOT EXISTS ingest_receipts (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL,
+    collection_id TEXT NOT NULL DEFAULT '',
+    checksum TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    key_id TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_ingest_receipts_org_id ON ingest_receipts(org_id);
+CREATE INDEX IF NOT EXISTS idx_ingest_receipts_host_id ON ingest_receipts(host_id);
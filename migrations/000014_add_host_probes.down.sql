@@ -0,0 +1,8 @@
+-- Rollback migration: Remove host reachability probes
+
+DROP INDEX IF EXISTS idx_host_probe_results_job_id;
+DROP INDEX IF EXISTS idx_host_probe_results_host_id_probed_at;
+DROP INDEX IF EXISTS idx_probe_jobs_org_id_pending;
+
+DROP TABLE IF EXISTS host_probe_results;
+DROP TABLE IF EXISTS probe_jobs;
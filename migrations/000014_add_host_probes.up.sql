@@ -0,0 +1,40 @@
+-- Migration: Add host reachability probes
+-- A probe job checks whether a set of hosts answer on the network, either from the
+-- snailbus server or from a prober agent that claims the job. Results sit next to
+-- last_seen so an agent that stopped reporting can be told apart from a host that
+-- is down or no longer resolves.
+
+CREATE TABLE IF NOT EXISTS probe_jobs (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    method TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 0,
+    prober TEXT NOT NULL,
+    status TEXT NOT NULL,
+    targets JSONB NOT NULL DEFAULT '[]',
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    claimed_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS host_probe_results (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES probe_jobs(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL REFERENCES hosts(host_id) ON DELETE CASCADE,
+    hostname TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 0,
+    reachable BOOLEAN NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    latency_ms DOUBLE PRECISION NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    prober TEXT NOT NULL,
+    probed_at TIMESTAMPTZ NOT NULL
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_probe_jobs_org_id_pending ON probe_jobs(org_id, created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_host_probe_results_host_id_probed_at ON host_probe_results(host_id, probed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_host_probe_results_job_id ON host_probe_results(job_id);
@@ -0,0 +1,6 @@
+-- Rollback migration: Remove the host event stream
+
+DROP INDEX IF EXISTS idx_host_events_host_id_id;
+DROP INDEX IF EXISTS idx_host_events_org_id_id;
+
+DROP TABLE IF EXISTS host_events;
@@ -0,0 +1,49 @@
+-- Migration: Add the host event stream
+-- host_events is an append-only log of host mutations (ingested, updated, tagged,
+-- deleted, restored). Each mutation appends its event and applies it to hosts and
+-- host_tags in the same transaction, so those tables are a projection of the stream
+-- and can be rebuilt from it. Events outlive their host, so there is deliberately no
+-- foreign key to hosts.
+
+CREATE TABLE IF NOT EXISTS host_events (
+    id BIGSERIAL PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL,
+    hostname TEXT NOT NULL DEFAULT '',
+    event_type TEXT NOT NULL CHECK (event_type IN ('ingested', 'updated', 'tagged', 'deleted', 'restored')),
+    actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_events_org_id_id ON host_events(org_id, id);
+CREATE INDEX IF NOT EXISTS idx_host_events_host_id_id ON host_events(host_id, id);
+
+-- Seed the stream with the current state of every existing host
+INSERT INTO host_events (org_id, host_id, hostname, event_type, actor_user_id, payload, created_at)
+SELECT h.org_id, h.host_id, h.hostname, 'ingested', h.uploaded_by_user_id,
+    jsonb_build_object(
+        'report', jsonb_build_object(
+            'id', h.host_id,
+            'received_at', h.received_at,
+            'meta', jsonb_build_object(
+                'hostname', h.hostname,
+                'host_id', h.host_id,
+                'collection_id', COALESCE(h.collection_id, ''),
+                'timestamp', COALESCE(h.timestamp, ''),
+                'snail_version', COALESCE(h.snail_version, '')
+            ),
+            'data', h.data,
+            'errors', to_jsonb(h.errors)
+        ),
+        'uploaded_by_user_id', h.uploaded_by_user_id
+    ),
+    h.received_at
+FROM hosts h
+ORDER BY h.received_at;
+
+INSERT INTO host_events (org_id, host_id, hostname, event_type, payload)
+SELECT h.org_id, h.host_id, h.hostname, 'tagged', jsonb_build_object('tags', jsonb_agg(t.tag ORDER BY t.tag))
+FROM host_tags t
+JOIN hosts h ON h.host_id = t.host_id
+GROUP BY h.org_id, h.host_id, h.hostname;
@@ -0,0 +1,10 @@
+-- Rollback migration: Remove user-maintained host details
+
+DELETE FROM host_events WHERE event_type = 'edited';
+
+ALTER TABLE host_events DROP CONSTRAINT IF EXISTS host_events_event_type_check;
+ALTER TABLE host_events ADD CONSTRAINT host_events_event_type_check
+    CHECK (event_type IN ('ingested', 'updated', 'tagged', 'deleted', 'restored'));
+
+ALTER TABLE hosts DROP COLUMN IF EXISTS description;
+ALTER TABLE hosts DROP COLUMN IF EXISTS display_name;
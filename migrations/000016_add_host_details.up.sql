@@ -0,0 +1,11 @@
+-- Migration: Add user-maintained host details
+-- display_name and description are set by users (PATCH /api/v1/hosts/:host_id) and are
+-- never touched by ingest, so the agent-reported hostname is preserved alongside them.
+-- Changes are recorded as 'edited' host events and projected into hosts like tags.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE host_events DROP CONSTRAINT IF EXISTS host_events_event_type_check;
+ALTER TABLE host_events ADD CONSTRAINT host_events_event_type_check
+    CHECK (event_type IN ('ingested', 'updated', 'tagged', 'edited', 'deleted', 'restored'));
@@ -0,0 +1,10 @@
+-- Rollback migration: Remove outbound actions
+
+DROP INDEX IF EXISTS idx_action_runs_dedup;
+DROP INDEX IF EXISTS idx_action_runs_due;
+DROP INDEX IF EXISTS idx_action_runs_action_id_created_at;
+DROP INDEX IF EXISTS idx_actions_org_id;
+
+DROP TABLE IF EXISTS org_secrets;
+DROP TABLE IF EXISTS action_runs;
+DROP TABLE IF EXISTS actions;
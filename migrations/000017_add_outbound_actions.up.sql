@@ -0,0 +1,53 @@
+-- Migration: Add outbound actions
+-- An action is a templated HTTP call (e.g. creating a Jira or GitHub issue) made when a
+-- finding such as an unreachable host is detected. Each delivery is an action run,
+-- retried with backoff; runs double as a work queue claimed with SKIP LOCKED, and a
+-- running run whose lease (next_attempt_at) expired is claimed again.
+-- org_secrets holds values referenced from action templates; they are never returned
+-- by the API.
+
+CREATE TABLE IF NOT EXISTS actions (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    triggers TEXT[] NOT NULL,
+    method TEXT NOT NULL,
+    url TEXT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    body_template TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS action_runs (
+    id UUID PRIMARY KEY,
+    action_id UUID NOT NULL REFERENCES actions(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    finding_key TEXT NOT NULL,
+    finding JSONB NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS org_secrets (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, name)
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_actions_org_id ON actions(org_id);
+CREATE INDEX IF NOT EXISTS idx_action_runs_action_id_created_at ON action_runs(action_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_action_runs_due ON action_runs(next_attempt_at) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_action_runs_dedup ON action_runs(action_id, finding_key, created_at DESC);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove per-organization Prometheus remote-write targets
+
+DROP TABLE IF EXISTS org_remote_write;
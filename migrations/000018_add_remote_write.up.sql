@@ -0,0 +1,16 @@
+-- Migration: Add per-organization Prometheus remote-write targets
+-- The exporter claims a target by advancing last_push_at, so with several snailbus
+-- instances each organization is still pushed once per interval.
+
+CREATE TABLE IF NOT EXISTS org_remote_write (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    metrics TEXT[] NOT NULL DEFAULT '{}',
+    username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    bearer_token TEXT NOT NULL DEFAULT '',
+    last_push_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Rollback migration: Remove delegated tokens for third-party integrations
+
+DROP TABLE IF EXISTS oauth_grants;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_clients;
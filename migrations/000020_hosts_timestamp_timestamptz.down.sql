@@ -0,0 +1,4 @@
+-- Rollback migration: Store the agent-reported collection time as text
+
+ALTER TABLE hosts
+    ALTER COLUMN timestamp TYPE TEXT USING to_char("timestamp" AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"');
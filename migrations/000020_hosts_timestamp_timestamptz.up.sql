@@ -0,0 +1,16 @@
+-- Migration: Store the agent-reported collection time as TIMESTAMPTZ
+-- hosts.timestamp held the agent's string verbatim. Values without a zone offset are
+-- taken to be UTC; values that do not parse as a timestamp become NULL.
+
+SET TIME ZONE 'UTC';
+
+CREATE FUNCTION pg_temp.try_timestamptz(value TEXT) RETURNS TIMESTAMPTZ AS $$
+BEGIN
+    RETURN NULLIF(value, '')::TIMESTAMPTZ;
+EXCEPTION WHEN OTHERS THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE hosts
+    ALTER COLUMN timestamp TYPE TIMESTAMPTZ USING pg_temp.try_timestamptz("timestamp");
@@ -0,0 +1,6 @@
+-- Rollback migration: Remove feature flags
+
+DROP INDEX IF EXISTS idx_feature_flag_orgs_org_id;
+
+DROP TABLE IF EXISTS feature_flag_orgs;
+DROP TABLE IF EXISTS feature_flags;
@@ -0,0 +1,21 @@
+-- Migration: Add feature flags
+-- A flag has a global default; per-organization overrides roll a feature out to
+-- selected organizations (or hold it back from them) before the default changes.
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS feature_flag_orgs (
+    flag_name TEXT NOT NULL REFERENCES feature_flags(name) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (flag_name, org_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_feature_flag_orgs_org_id ON feature_flag_orgs(org_id);
@@ -0,0 +1,75 @@
+-- Rollback migration: Remove host archiving
+-- Archived hosts become visible again, so the facet counters are rebuilt.
+
+DROP TRIGGER IF EXISTS maintain_host_tag_facets ON host_tags;
+
+CREATE OR REPLACE FUNCTION maintain_host_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND OLD.org_id IS NOT DISTINCT FROM NEW.org_id
+        AND host_os_version(OLD.data) IS NOT DISTINCT FROM host_os_version(NEW.data)
+        AND host_os_name(OLD.data) IS NOT DISTINCT FROM host_os_name(NEW.data) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM bump_host_facet(OLD.org_id, 'os_name', host_os_name(OLD.data), -1);
+        PERFORM bump_host_facet(OLD.org_id, 'os_version', host_os_version(OLD.data), -1);
+        IF TG_OP = 'DELETE' THEN
+            PERFORM bump_host_facet(OLD.org_id, 'total', '*', -1);
+        END IF;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM bump_host_facet(NEW.org_id, 'os_name', host_os_name(NEW.data), 1);
+        PERFORM bump_host_facet(NEW.org_id, 'os_version', host_os_version(NEW.data), 1);
+        IF TG_OP = 'INSERT' THEN
+            PERFORM bump_host_facet(NEW.org_id, 'total', '*', 1);
+        END IF;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION maintain_host_tag_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM bump_host_facet(OLD.org_id, 'tag', OLD.tag, -1);
+    ELSE
+        PERFORM bump_host_facet(NEW.org_id, 'tag', NEW.tag, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER maintain_host_tag_facets AFTER INSERT OR DELETE ON host_tags
+    FOR EACH ROW EXECUTE FUNCTION maintain_host_tag_facets();
+
+DELETE FROM host_events WHERE event_type IN ('archived', 'unarchived');
+
+ALTER TABLE host_events DROP CONSTRAINT IF EXISTS host_events_event_type_check;
+ALTER TABLE host_events ADD CONSTRAINT host_events_event_type_check
+    CHECK (event_type IN ('ingested', 'updated', 'tagged', 'edited', 'deleted', 'restored'));
+
+ALTER TABLE host_tags DROP COLUMN IF EXISTS archived;
+ALTER TABLE hosts DROP COLUMN IF EXISTS archived_at;
+
+-- Rebuild counters now that every host counts again
+DELETE FROM host_facet_counts;
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'total', '*', COUNT(*) FROM hosts GROUP BY org_id;
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'os_name', host_os_name(data), COUNT(*)
+FROM hosts WHERE host_os_name(data) IS NOT NULL
+GROUP BY org_id, host_os_name(data);
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'os_version', host_os_version(data), COUNT(*)
+FROM hosts WHERE host_os_version(data) IS NOT NULL
+GROUP BY org_id, host_os_version(data);
+
+INSERT INTO host_facet_counts (org_id, facet, value, count)
+SELECT org_id, 'tag', tag, COUNT(*) FROM host_tags GROUP BY org_id, tag;
@@ -0,0 +1,60 @@
+-- Migration: Add host archiving
+-- Archived hosts keep their data but are hidden from default host lists, facets, and
+-- findings. Archiving is recorded as 'archived'/'unarchived' host events and projected
+-- into hosts.archived_at. host_tags.archived mirrors the host's state so the facet
+-- triggers can keep counting only unarchived hosts, including on cascading deletes.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE host_tags ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE host_events DROP CONSTRAINT IF EXISTS host_events_event_type_check;
+ALTER TABLE host_events ADD CONSTRAINT host_events_event_type_check
+    CHECK (event_type IN ('ingested', 'updated', 'tagged', 'edited', 'deleted', 'restored', 'archived', 'unarchived'));
+
+-- Archived hosts contribute nothing to the counters; archiving or unarchiving a host
+-- removes or adds all of its contributions
+CREATE OR REPLACE FUNCTION maintain_host_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND OLD.org_id IS NOT DISTINCT FROM NEW.org_id
+        AND (OLD.archived_at IS NULL) = (NEW.archived_at IS NULL)
+        AND host_os_version(OLD.data) IS NOT DISTINCT FROM host_os_version(NEW.data)
+        AND host_os_name(OLD.data) IS NOT DISTINCT FROM host_os_name(NEW.data) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.archived_at IS NULL THEN
+        PERFORM bump_host_facet(OLD.org_id, 'os_name', host_os_name(OLD.data), -1);
+        PERFORM bump_host_facet(OLD.org_id, 'os_version', host_os_version(OLD.data), -1);
+        PERFORM bump_host_facet(OLD.org_id, 'total', '*', -1);
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.archived_at IS NULL THEN
+        PERFORM bump_host_facet(NEW.org_id, 'os_name', host_os_name(NEW.data), 1);
+        PERFORM bump_host_facet(NEW.org_id, 'os_version', host_os_version(NEW.data), 1);
+        PERFORM bump_host_facet(NEW.org_id, 'total', '*', 1);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION maintain_host_tag_facets() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.archived = NEW.archived THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP IN ('UPDATE', 'DELETE') AND NOT OLD.archived THEN
+        PERFORM bump_host_facet(OLD.org_id, 'tag', OLD.tag, -1);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NOT NEW.archived THEN
+        PERFORM bump_host_facet(NEW.org_id, 'tag', NEW.tag, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS maintain_host_tag_facets ON host_tags;
+CREATE TRIGGER maintain_host_tag_facets AFTER INSERT OR UPDATE OR DELETE ON host_tags
+    FOR EACH ROW EXECUTE FUNCTION maintain_host_tag_facets();
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove per-organization ingest filters
+
+DROP TABLE IF EXISTS org_ingest_filters;
@@ -0,0 +1,11 @@
+-- Migration: Add per-organization ingest filters
+-- Paths listed here are removed from report data before it is stored; the paths a
+-- report matched are recorded in its ingested or updated host event.
+
+CREATE TABLE IF NOT EXISTS org_ingest_filters (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    paths TEXT[] NOT NULL DEFAULT '{}',
+    updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove the host account inventory
+
+DROP TABLE IF EXISTS host_accounts;
@@ -0,0 +1,19 @@
+-- Migration: Add the host account inventory
+-- Local user accounts from each host's latest report, normalized at ingest so they
+-- can be searched across the fleet. Rows are replaced whenever the host's report is
+-- projected; existing hosts are filled in by their next report or a reprocess job.
+
+CREATE TABLE IF NOT EXISTS host_accounts (
+    host_id UUID NOT NULL REFERENCES hosts(host_id) ON DELETE CASCADE,
+    org_id UUID NOT NULL,
+    username TEXT NOT NULL,
+    uid BIGINT,
+    gid BIGINT,
+    home TEXT NOT NULL DEFAULT '',
+    shell TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (host_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_accounts_org_username ON host_accounts(org_id, username);
+CREATE INDEX IF NOT EXISTS idx_host_accounts_org_shell ON host_accounts(org_id, shell);
+CREATE INDEX IF NOT EXISTS idx_host_accounts_org_uid ON host_accounts(org_id, uid);
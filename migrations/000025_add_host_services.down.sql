@@ -0,0 +1,3 @@
+-- Rollback migration: Remove the host service inventory
+
+DROP TABLE IF EXISTS host_services;
@@ -0,0 +1,18 @@
+-- Migration: Add the host service inventory
+-- Listening ports from each host's latest report, normalized at ingest so exposure
+-- can be searched across the fleet. Rows are replaced whenever the host's report is
+-- projected; existing hosts are filled in by their next report or a reprocess job.
+
+CREATE TABLE IF NOT EXISTS host_services (
+    host_id UUID NOT NULL REFERENCES hosts(host_id) ON DELETE CASCADE,
+    org_id UUID NOT NULL,
+    protocol TEXT NOT NULL DEFAULT '',
+    address TEXT NOT NULL DEFAULT '',
+    port INTEGER NOT NULL CHECK (port BETWEEN 1 AND 65535),
+    process TEXT NOT NULL DEFAULT '',
+    pid BIGINT,
+    PRIMARY KEY (host_id, protocol, address, port)
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_services_org_port ON host_services(org_id, port);
+CREATE INDEX IF NOT EXISTS idx_host_services_org_process ON host_services(org_id, process);
@@ -0,0 +1,8 @@
+-- Rollback migration: Remove schema versions and signing secrets from outbound actions
+
+ALTER TABLE actions
+    DROP COLUMN IF EXISTS previous_secret_expires_at,
+    DROP COLUMN IF EXISTS previous_signing_secret,
+    DROP COLUMN IF EXISTS signing_secret_created_at,
+    DROP COLUMN IF EXISTS signing_secret,
+    DROP COLUMN IF EXISTS schema_version;
@@ -0,0 +1,13 @@
+-- Migration: Add schema versions and signing secrets to outbound actions
+-- schema_version pins the template data and {{payload}} document an action is rendered
+-- with, so receivers keep the format they were built for. Deliveries are signed with
+-- HMAC-SHA256 using signing_secret; after a rotation the previous secret also signs them
+-- until previous_secret_expires_at. Existing actions are unsigned until their secret is
+-- first rotated.
+
+ALTER TABLE actions
+    ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS signing_secret TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS signing_secret_created_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS previous_signing_secret TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ;
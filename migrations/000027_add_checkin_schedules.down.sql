@@ -0,0 +1,3 @@
+-- Rollback migration: Remove per-organization check-in schedules
+
+DROP TABLE IF EXISTS org_checkin_schedules;
@@ -0,0 +1,13 @@
+-- Migration: Add per-organization check-in schedules
+-- Each schedule declares how often hosts are expected to report: windows match hosts
+-- by tag (the shortest matching window applies), and default_interval_seconds covers
+-- hosts without a matching tag. Overdue hosts raise host_overdue findings.
+
+CREATE TABLE IF NOT EXISTS org_checkin_schedules (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    default_interval_seconds BIGINT NOT NULL DEFAULT 0 CHECK (default_interval_seconds >= 0),
+    windows JSONB NOT NULL DEFAULT '[]',
+    updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
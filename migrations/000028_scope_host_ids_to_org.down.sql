@@ -0,0 +1,30 @@
+-- Rollback migration: Make host IDs globally unique again
+-- Fails if two organizations hold a host with the same ID; delete one of them first.
+
+ALTER TABLE host_tags DROP CONSTRAINT IF EXISTS host_tags_host_fkey;
+ALTER TABLE host_probe_results DROP CONSTRAINT IF EXISTS host_probe_results_host_fkey;
+ALTER TABLE host_accounts DROP CONSTRAINT IF EXISTS host_accounts_host_fkey;
+ALTER TABLE host_services DROP CONSTRAINT IF EXISTS host_services_host_fkey;
+
+ALTER TABLE hosts DROP CONSTRAINT hosts_pkey;
+ALTER TABLE hosts ADD PRIMARY KEY (host_id);
+
+ALTER TABLE host_tags DROP CONSTRAINT host_tags_pkey;
+ALTER TABLE host_tags ADD PRIMARY KEY (host_id, tag);
+ALTER TABLE host_tags ADD CONSTRAINT host_tags_host_id_fkey
+    FOREIGN KEY (host_id) REFERENCES hosts(host_id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_host_probe_results_host_probed_at;
+CREATE INDEX IF NOT EXISTS idx_host_probe_results_host_id_probed_at ON host_probe_results(host_id, probed_at DESC);
+ALTER TABLE host_probe_results ADD CONSTRAINT host_probe_results_host_id_fkey
+    FOREIGN KEY (host_id) REFERENCES hosts(host_id) ON DELETE CASCADE;
+
+ALTER TABLE host_accounts DROP CONSTRAINT host_accounts_pkey;
+ALTER TABLE host_accounts ADD PRIMARY KEY (host_id, username);
+ALTER TABLE host_accounts ADD CONSTRAINT host_accounts_host_id_fkey
+    FOREIGN KEY (host_id) REFERENCES hosts(host_id) ON DELETE CASCADE;
+
+ALTER TABLE host_services DROP CONSTRAINT host_services_pkey;
+ALTER TABLE host_services ADD PRIMARY KEY (host_id, protocol, address, port);
+ALTER TABLE host_services ADD CONSTRAINT host_services_host_id_fkey
+    FOREIGN KEY (host_id) REFERENCES hosts(host_id) ON DELETE CASCADE;
@@ -0,0 +1,33 @@
+-- Migration: Scope host IDs to their organization
+-- Host IDs are generated by the agents, so two organizations can report the same
+-- UUID (cloned images, copied machine-ids). Hosts are now keyed by (org_id, host_id)
+-- and the tables hanging off hosts reference that pair, so each organization keeps
+-- its own copy of the host.
+
+ALTER TABLE host_tags DROP CONSTRAINT IF EXISTS host_tags_host_id_fkey;
+ALTER TABLE host_probe_results DROP CONSTRAINT IF EXISTS host_probe_results_host_id_fkey;
+ALTER TABLE host_accounts DROP CONSTRAINT IF EXISTS host_accounts_host_id_fkey;
+ALTER TABLE host_services DROP CONSTRAINT IF EXISTS host_services_host_id_fkey;
+
+ALTER TABLE hosts DROP CONSTRAINT hosts_pkey;
+ALTER TABLE hosts ADD PRIMARY KEY (org_id, host_id);
+
+ALTER TABLE host_tags DROP CONSTRAINT host_tags_pkey;
+ALTER TABLE host_tags ADD PRIMARY KEY (org_id, host_id, tag);
+ALTER TABLE host_tags ADD CONSTRAINT host_tags_host_fkey
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE;
+
+ALTER TABLE host_probe_results ADD CONSTRAINT host_probe_results_host_fkey
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE;
+DROP INDEX IF EXISTS idx_host_probe_results_host_id_probed_at;
+CREATE INDEX IF NOT EXISTS idx_host_probe_results_host_probed_at ON host_probe_results(org_id, host_id, probed_at DESC);
+
+ALTER TABLE host_accounts DROP CONSTRAINT host_accounts_pkey;
+ALTER TABLE host_accounts ADD PRIMARY KEY (org_id, host_id, username);
+ALTER TABLE host_accounts ADD CONSTRAINT host_accounts_host_fkey
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE;
+
+ALTER TABLE host_services DROP CONSTRAINT host_services_pkey;
+ALTER TABLE host_services ADD PRIMARY KEY (org_id, host_id, protocol, address, port);
+ALTER TABLE host_services ADD CONSTRAINT host_services_host_fkey
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+-- Rollback migration: Remove fleet reports and report schedules
+
+DROP TABLE IF EXISTS org_report_schedules;
+DROP TABLE IF EXISTS fleet_reports;
@@ -0,0 +1,31 @@
+-- Migration: Add fleet reports and report schedules
+-- A fleet report is a snapshot of the organization's hosts (inventory, compliance, or
+-- OS currency) taken on demand or by a schedule. The content is stored as rendered
+-- sections and turned into HTML or PDF when downloaded.
+
+CREATE TABLE IF NOT EXISTS fleet_reports (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    title TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    content JSONB NOT NULL,
+    emailed_to TEXT[] NOT NULL DEFAULT '{}',
+    email_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_fleet_reports_org_created ON fleet_reports(org_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS org_report_schedules (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    kinds TEXT[] NOT NULL,
+    frequency TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly')),
+    email BOOLEAN NOT NULL DEFAULT false,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- Rollback migration: Remove agent-reported host health
+
+DROP INDEX IF EXISTS idx_hosts_org_health_status;
+ALTER TABLE hosts DROP COLUMN IF EXISTS health;
@@ -0,0 +1,8 @@
+-- Migration: Add agent-reported host health
+-- Agents may send a health block (status and failing checks) with each report. The
+-- latest one is projected onto the host so hosts can be listed and searched by health.
+-- Existing hosts have no health until their agent reports it.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS health JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_health_status ON hosts(org_id, (health->>'status'));
@@ -0,0 +1,5 @@
+-- Rollback migration: Compare organization names case-sensitively again
+-- Organizations renamed by the up migration keep their new names.
+
+DROP INDEX IF EXISTS organizations_name_lower_key;
+CREATE INDEX IF NOT EXISTS idx_organizations_name ON organizations(name);
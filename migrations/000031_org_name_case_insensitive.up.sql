@@ -0,0 +1,19 @@
+-- Migration: Make organization names unique regardless of case
+-- Names were compared case-sensitively and only the registration path checked them, so
+-- "Acme" and "acme" could both exist and concurrent creates outside registration could
+-- claim the same name. The unique index makes the database the arbiter.
+
+-- Names that differ only in case: the oldest organization keeps its name, the others
+-- get the start of their ID appended so the index can be built
+UPDATE organizations o
+SET name = o.name || ' (' || left(o.id::text, 8) || ')'
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY lower(name) ORDER BY created_at, id) AS n
+    FROM organizations
+) ranked
+WHERE ranked.id = o.id AND ranked.n > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS organizations_name_lower_key ON organizations (lower(name));
+
+-- Lookups by name now go through lower(name)
+DROP INDEX IF EXISTS idx_organizations_name;
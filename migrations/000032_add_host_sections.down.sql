@@ -0,0 +1,4 @@
+-- Rollback migration: Remove the host data sections index
+
+DROP INDEX IF EXISTS idx_hosts_sections;
+ALTER TABLE hosts DROP COLUMN IF EXISTS sections;
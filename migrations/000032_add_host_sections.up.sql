@@ -0,0 +1,18 @@
+-- Migration: Index the data sections each host reports
+-- Integrations look for hosts exposing a kind of data (e.g. docker) with
+-- GET /api/v1/hosts?has_section=docker. The top-level keys of the last report are kept
+-- in an array with a GIN index instead of scanning every report's data.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS sections TEXT[] NOT NULL DEFAULT '{}';
+
+-- Backfill from the stored reports; null and empty sections do not count, as at ingest
+UPDATE hosts
+SET sections = ARRAY(
+    SELECT key
+    FROM jsonb_each(data)
+    WHERE value NOT IN ('null'::jsonb, '{}'::jsonb, '[]'::jsonb)
+    ORDER BY key COLLATE "C"
+)
+WHERE jsonb_typeof(data) = 'object';
+
+CREATE INDEX IF NOT EXISTS idx_hosts_sections ON hosts USING GIN (sections);
@@ -0,0 +1,7 @@
+-- Rollback migration: Remove chat actions and per-action rate limits
+
+DELETE FROM actions WHERE kind <> 'http';
+
+ALTER TABLE actions
+    DROP COLUMN IF EXISTS rate_limit_per_hour,
+    DROP COLUMN IF EXISTS kind;
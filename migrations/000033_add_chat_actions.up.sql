@@ -0,0 +1,9 @@
+-- Migration: Add chat actions and per-action rate limits
+-- kind selects how an action is delivered: http actions send their rendered body as-is,
+-- while slack and mattermost actions post the rendered body as the text of a chat
+-- message to an incoming webhook. rate_limit_per_hour caps the runs queued for an
+-- action in any hour (0 is unlimited), so a burst of findings cannot flood a channel.
+
+ALTER TABLE actions
+    ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'http' CHECK (kind IN ('http', 'slack', 'mattermost')),
+    ADD COLUMN IF NOT EXISTS rate_limit_per_hour INTEGER NOT NULL DEFAULT 0 CHECK (rate_limit_per_hour >= 0);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove offline bundle import batches
+
+DROP TABLE IF EXISTS import_batches;
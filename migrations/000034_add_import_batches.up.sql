@@ -0,0 +1,27 @@
+-- Migration: Add offline bundle import batches
+-- Air-gapped sites export signed bundles of reports that are imported in one batch.
+-- Each batch records the bundle checksum, the key it was signed with, and the outcome
+-- of every report. A bundle is imported once per organization: completed batches are
+-- unique by checksum, while an interrupted batch (completed_at NULL) can be retried.
+
+CREATE TABLE IF NOT EXISTS import_batches (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    source TEXT NOT NULL CHECK (source IN ('api', 'cli')),
+    imported_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    bundle_sha256 TEXT NOT NULL,
+    key_id TEXT NOT NULL,
+    exporter TEXT NOT NULL DEFAULT '',
+    exported_at TIMESTAMPTZ NOT NULL,
+    report_count INTEGER NOT NULL,
+    imported INTEGER NOT NULL DEFAULT 0,
+    superseded INTEGER NOT NULL DEFAULT 0,
+    rejected INTEGER NOT NULL DEFAULT 0,
+    results JSONB NOT NULL DEFAULT '[]',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_batches_org_started ON import_batches(org_id, started_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS import_batches_completed_bundle_key
+    ON import_batches(org_id, bundle_sha256) WHERE completed_at IS NOT NULL;
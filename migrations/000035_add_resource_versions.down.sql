@@ -0,0 +1,8 @@
+-- Rollback migration: Remove resource versions
+
+ALTER TABLE org_report_schedules DROP COLUMN IF EXISTS version;
+ALTER TABLE org_checkin_schedules DROP COLUMN IF EXISTS version;
+ALTER TABLE org_ingest_filters DROP COLUMN IF EXISTS version;
+ALTER TABLE org_remote_write DROP COLUMN IF EXISTS version;
+ALTER TABLE hosts DROP COLUMN IF EXISTS metadata_version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,13 @@
+-- Migration: Add resource versions for optimistic concurrency
+-- Mutating endpoints return the version as an ETag and accept it back in If-Match,
+-- so concurrent admins cannot silently overwrite each other's changes. Versions start
+-- at 1 and are incremented by the storage layer on every change to the resource.
+-- hosts.metadata_version counts changes to a host's tags, display name, and description;
+-- ingested reports do not change it.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS metadata_version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE org_remote_write ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE org_ingest_filters ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE org_checkin_schedules ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE org_report_schedules ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- Rollback migration: Remove unique API key prefixes
+-- Keys created since keep their 16-character prefixes, which the previous lookup
+-- (by the first 8 characters) cannot find; revoke and recreate them after rolling back.
+
+DROP INDEX IF EXISTS idx_api_keys_key_prefix_unique;
@@ -0,0 +1,9 @@
+-- Migration: Make API key prefixes unique
+-- Keys are looked up by prefix and then verified with bcrypt against every candidate,
+-- so shared prefixes make authentication slower as keys accumulate. New keys have
+-- 16-character prefixes that are unique: a generated key whose prefix is taken is
+-- regenerated. Existing keys keep their 8-character prefixes, which may repeat, and
+-- are still found by the existing idx_api_keys_key_prefix index.
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_prefix_unique
+    ON api_keys(key_prefix) WHERE length(key_prefix) >= 16;
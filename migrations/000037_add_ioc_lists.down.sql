@@ -0,0 +1,5 @@
+-- Rollback migration: Remove IOC lists
+
+DROP TABLE IF EXISTS ioc_matches;
+DROP TABLE IF EXISTS ioc_indicators;
+DROP TABLE IF EXISTS ioc_lists;
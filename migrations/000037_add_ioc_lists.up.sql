@@ -0,0 +1,41 @@
+-- Migration: Add IOC lists
+-- Indicators of compromise (file hashes, process names, file names) uploaded by an
+-- organization as CSV or STIX. Every ingested report is matched against them, and
+-- each indicator a host's reports matched is kept in ioc_matches with when it was
+-- first and last seen; the first sighting on a host raises an ioc_match finding.
+
+CREATE TABLE IF NOT EXISTS ioc_lists (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    format TEXT NOT NULL CHECK (format IN ('csv', 'stix')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT ioc_lists_org_name_key UNIQUE (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS ioc_indicators (
+    list_id UUID NOT NULL REFERENCES ioc_lists(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('md5', 'sha1', 'sha256', 'process_name', 'file_name')),
+    value TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (list_id, type, value)
+);
+
+CREATE TABLE IF NOT EXISTS ioc_matches (
+    list_id UUID NOT NULL REFERENCES ioc_lists(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL,
+    org_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    value TEXT NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (list_id, org_id, host_id, type, value),
+    -- Host IDs are unique per organization (migration 000028)
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ioc_matches_org_last_seen ON ioc_matches(org_id, last_seen_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ioc_matches_host ON ioc_matches(org_id, host_id);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove per-organization host tag rules
+
+DROP TABLE IF EXISTS org_host_tag_rules;
@@ -0,0 +1,13 @@
+-- Migration: Add per-organization host tag rules
+-- Each rule is a regular expression matched against a host's hostname and the tags
+-- it adds to matching hosts, which may reference the expression's capture groups.
+-- Rules are applied at ingest and on demand; they only add tags, never remove them.
+
+CREATE TABLE IF NOT EXISTS org_host_tag_rules (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    rules JSONB NOT NULL DEFAULT '[]',
+    updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove the report event time index
+
+DROP INDEX IF EXISTS idx_host_events_org_reports_created_at;
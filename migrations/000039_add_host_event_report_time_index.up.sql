@@ -0,0 +1,7 @@
+-- Migration: Index report events by time
+-- Reporting uptime reads when each of an organization's hosts reported in a period
+-- from its ingested and updated events.
+
+CREATE INDEX IF NOT EXISTS idx_host_events_org_reports_created_at
+    ON host_events(org_id, created_at)
+    WHERE event_type IN ('ingested', 'updated');
@@ -0,0 +1,4 @@
+-- Rollback migration: Remove host report history
+
+DROP TABLE IF EXISTS org_host_report_retention;
+DROP TABLE IF EXISTS host_reports;
@@ -0,0 +1,33 @@
+-- Migration: Keep a history of each host's reports
+-- hosts holds a host's last report; host_reports keeps its most recent reports as they
+-- were stored at ingest, up to the organization's retention or the server default
+-- (HOST_REPORT_RETENTION). Older reports are pruned when a host reports again. The
+-- history is written at ingest rather than projected from host_events, so replaying
+-- events does not add to it; it goes with the host when the host is deleted.
+
+CREATE TABLE IF NOT EXISTS host_reports (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL,
+    host_id UUID NOT NULL,
+    hostname TEXT NOT NULL,
+    collection_id TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ,
+    snail_version TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMPTZ NOT NULL,
+    data JSONB NOT NULL,
+    errors TEXT[] NOT NULL DEFAULT '{}',
+    health JSONB,
+    uploaded_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_reports_host_received ON host_reports(org_id, host_id, received_at DESC);
+
+CREATE TABLE IF NOT EXISTS org_host_report_retention (
+    org_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    reports_per_host INTEGER NOT NULL CHECK (reports_per_host >= 0),
+    updated_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Rollback migration: Remove Web UI sessions
+
+DROP TABLE IF EXISTS sessions;
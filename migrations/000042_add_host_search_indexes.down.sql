@@ -0,0 +1,7 @@
+-- Rollback migration: Remove the structured host search indexes
+-- The pg_trgm extension is left installed, since other objects may use it.
+
+DROP INDEX IF EXISTS idx_hosts_org_received_at;
+DROP INDEX IF EXISTS idx_hosts_packages_installed;
+DROP INDEX IF EXISTS idx_hosts_org_os;
+DROP INDEX IF EXISTS idx_hosts_hostname_trgm;
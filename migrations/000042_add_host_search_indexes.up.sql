@@ -0,0 +1,18 @@
+-- Migration: Index the fields of structured host search
+-- GET /api/v1/hosts/search filters hosts by hostname substring, OS name and version,
+-- installed packages, and last report time. These indexes let it find matching hosts
+-- without reading every report's data.
+
+-- Substring matches on hostnames use trigrams
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_hosts_hostname_trgm ON hosts USING GIN (lower(hostname) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_os
+    ON hosts(org_id, lower(data->'system'->'os'->>'name'), (data->'system'->'os'->>'version'));
+
+-- jsonb_path_ops answers containment (@>) on the installed package list
+CREATE INDEX IF NOT EXISTS idx_hosts_packages_installed
+    ON hosts USING GIN ((data->'packages'->'installed') jsonb_path_ops);
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_received_at ON hosts(org_id, received_at DESC);
@@ -0,0 +1,10 @@
+-- Rollback migration: Remove webhooks
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_completed_at;
+DROP INDEX IF EXISTS idx_webhook_deliveries_dedup;
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id_created_at;
+DROP INDEX IF EXISTS idx_webhooks_org_id;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,42 @@
+-- Migration: Add webhooks
+-- A webhook is a URL an organization registers to receive signed JSON events about
+-- its hosts (ingested, deleted, stale). Each event sent to a webhook is a delivery,
+-- retried with backoff; deliveries double as a work queue claimed with SKIP LOCKED,
+-- like action_runs. dedup_key is set for events that must be sent once per episode
+-- (a host going stale), and empty otherwise.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    signing_secret TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    dedup_key TEXT NOT NULL DEFAULT '',
+    event JSONB NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_webhooks_org_id ON webhooks(org_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id_created_at ON webhook_deliveries(webhook_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_dedup ON webhook_deliveries(webhook_id, dedup_key, created_at DESC) WHERE dedup_key <> '';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_completed_at ON webhook_deliveries(completed_at) WHERE completed_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Rollback migration: Remove the audit log
+
+DROP INDEX IF EXISTS idx_audit_events_actor_user_id_id;
+DROP INDEX IF EXISTS idx_audit_events_org_id_action_id;
+DROP INDEX IF EXISTS idx_audit_events_org_id_id;
+
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,26 @@
+-- Migration: Add the audit log
+-- audit_events records who changed what in an organization: user and API key
+-- management, role changes, host deletion, and ingest. Events are appended and never
+-- updated. The actor's username is copied into the event so it still reads after the
+-- user is deleted, and the target is kept as text with no foreign key for the same reason.
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    actor_username TEXT NOT NULL DEFAULT '',
+    auth_method TEXT NOT NULL DEFAULT '',
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    request_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_id_id ON audit_events(org_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_id_action_id ON audit_events(org_id, action, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_user_id_id ON audit_events(actor_user_id, id DESC);
@@ -0,0 +1,5 @@
+-- Rollback migration: Remove stale host marks
+
+DROP INDEX IF EXISTS idx_hosts_org_id_stale_since;
+
+ALTER TABLE hosts DROP COLUMN IF EXISTS stale_since;
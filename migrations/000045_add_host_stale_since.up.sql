@@ -0,0 +1,8 @@
+-- Migration: Mark stale hosts
+-- hosts.stale_since is set by the stale host monitor when a host misses its check-in
+-- window, and cleared by the host's next report. The partial index serves
+-- GET /api/v1/hosts?status=stale and the hosts_stale_total metric.
+
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS stale_since TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_id_stale_since ON hosts(org_id, stale_since) WHERE stale_since IS NOT NULL;
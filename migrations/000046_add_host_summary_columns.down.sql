@@ -0,0 +1,18 @@
+-- Rollback migration: Remove the host summary columns
+
+DROP INDEX IF EXISTS idx_hosts_org_architecture;
+DROP INDEX IF EXISTS idx_hosts_org_kernel_version;
+DROP INDEX IF EXISTS idx_hosts_org_os_name;
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_os
+    ON hosts(org_id, lower(data->'system'->'os'->>'name'), (data->'system'->'os'->>'version'));
+
+ALTER TABLE hosts
+    DROP COLUMN IF EXISTS package_count,
+    DROP COLUMN IF EXISTS architecture,
+    DROP COLUMN IF EXISTS kernel_version,
+    DROP COLUMN IF EXISTS os_version_patch,
+    DROP COLUMN IF EXISTS os_version_minor,
+    DROP COLUMN IF EXISTS os_version_major,
+    DROP COLUMN IF EXISTS os_version,
+    DROP COLUMN IF EXISTS os_name;
@@ -0,0 +1,26 @@
+-- Migration: Extract host summary fields from report data in the database
+-- Listing hosts used to read every report's whole data to find its OS. The fields a
+-- host summary shows are generated columns computed from data when a report is written,
+-- so listings read a few short columns, and searches on them can use plain indexes.
+
+ALTER TABLE hosts
+    ADD COLUMN IF NOT EXISTS os_name TEXT GENERATED ALWAYS AS (data->'system'->'os'->>'name') STORED,
+    ADD COLUMN IF NOT EXISTS os_version TEXT GENERATED ALWAYS AS (data->'system'->'os'->>'version') STORED,
+    ADD COLUMN IF NOT EXISTS os_version_major TEXT GENERATED ALWAYS AS (data->'system'->'os'->>'version_major') STORED,
+    ADD COLUMN IF NOT EXISTS os_version_minor TEXT GENERATED ALWAYS AS (data->'system'->'os'->>'version_minor') STORED,
+    ADD COLUMN IF NOT EXISTS os_version_patch TEXT GENERATED ALWAYS AS (data->'system'->'os'->>'version_patch') STORED,
+    ADD COLUMN IF NOT EXISTS kernel_version TEXT GENERATED ALWAYS AS (data->'system'->>'kernel') STORED,
+    ADD COLUMN IF NOT EXISTS architecture TEXT GENERATED ALWAYS AS (data->'system'->>'architecture') STORED,
+    -- NULL when the report lists no packages, unlike a report listing none
+    ADD COLUMN IF NOT EXISTS package_count INTEGER GENERATED ALWAYS AS (
+        CASE WHEN jsonb_typeof(data->'packages'->'installed') = 'array'
+            THEN jsonb_array_length(data->'packages'->'installed')
+        END
+    ) STORED;
+
+-- Replaces the expression index of migration 000042 with one on the columns
+DROP INDEX IF EXISTS idx_hosts_org_os;
+CREATE INDEX IF NOT EXISTS idx_hosts_org_os_name ON hosts(org_id, lower(os_name), os_version);
+
+CREATE INDEX IF NOT EXISTS idx_hosts_org_kernel_version ON hosts(org_id, kernel_version);
+CREATE INDEX IF NOT EXISTS idx_hosts_org_architecture ON hosts(org_id, architecture);
@@ -0,0 +1,5 @@
+-- Rollback migration: Remove organization memberships
+
+DROP INDEX IF EXISTS idx_user_org_memberships_org_id;
+
+DROP TABLE IF EXISTS user_org_memberships;
@@ -0,0 +1,16 @@
+-- Migration: Add organization memberships
+-- A user belongs to the organization in users.org_id with users.role. user_org_memberships
+-- adds other organizations the user can act in, each with its own role, selected per
+-- request with the X-Org-ID header. The user's own organization is never listed here.
+
+CREATE TABLE IF NOT EXISTS user_org_memberships (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    role user_role NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, org_id)
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_user_org_memberships_org_id ON user_org_memberships(org_id);
@@ -0,0 +1,4 @@
+-- Rollback migration: Remove host groups
+
+DROP TABLE IF EXISTS host_group_members;
+DROP TABLE IF EXISTS host_groups;
@@ -0,0 +1,30 @@
+-- Migration: Add host groups
+-- A group organizes an organization's hosts into views such as environments
+-- (prod, stage). Hosts belong to a group if they were added to it (static members,
+-- in host_group_members) or match its rule, a fleet search query (os:fedora
+-- tag:env=prod) evaluated when the group is read.
+
+CREATE TABLE IF NOT EXISTS host_groups (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    rule TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT host_groups_org_name_key UNIQUE (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS host_group_members (
+    group_id UUID NOT NULL REFERENCES host_groups(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL,
+    host_id UUID NOT NULL,
+    added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, host_id),
+    CONSTRAINT host_group_members_host_fkey
+        FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_group_members_host ON host_group_members(org_id, host_id);
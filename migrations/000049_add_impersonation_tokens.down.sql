@@ -0,0 +1,5 @@
+-- Rollback migration: Remove impersonation tokens
+
+ALTER TABLE audit_events DROP COLUMN IF EXISTS impersonator_username;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS impersonator_user_id;
+DROP TABLE IF EXISTS impersonation_tokens;
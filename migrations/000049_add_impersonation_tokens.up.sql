@@ -0,0 +1,21 @@
+-- Migration: Add impersonation tokens
+-- System administrators can act as another user for a short time, to debug an issue the
+-- user reported without asking for their credentials. Each token acts as one user in the
+-- organization the user was in when it was issued. Tokens are stored as SHA-256 hashes.
+-- Audit events record the administrator behind every change made with a token.
+
+CREATE TABLE IF NOT EXISTS impersonation_tokens (
+    id UUID PRIMARY KEY,
+    admin_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_tokens_admin_user_id ON impersonation_tokens(admin_user_id);
+
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_username TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE api_keys DROP COLUMN IF EXISTS host_id;
+
+DROP TABLE IF EXISTS enrollment_tokens;
@@ -0,0 +1,21 @@
+-- Migration: Add agent enrollment tokens
+-- Admins mint limited-use tokens that agents exchange for their own API key, instead of
+-- sharing one editor key across every machine. Tokens are stored as SHA-256 hashes; each
+-- exchange counts as a use. The keys issued belong to the admin who minted the token, are
+-- restricted to ingest, and are bound to the host the agent enrolled as (api_keys.host_id).
+
+CREATE TABLE IF NOT EXISTS enrollment_tokens (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    max_uses INTEGER NOT NULL CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_by_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_tokens_org_id ON enrollment_tokens(org_id);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS host_id UUID;
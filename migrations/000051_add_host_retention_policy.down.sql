@@ -0,0 +1 @@
+ALTER TABLE org_host_report_retention DROP COLUMN IF EXISTS delete_hosts_unseen_days;
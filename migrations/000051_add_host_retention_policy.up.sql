@@ -0,0 +1,8 @@
+-- Migration: Delete hosts that stop reporting
+-- The organization's retention can also delete hosts that have not reported for a number
+-- of days; 0 keeps them however long they are unseen. The retention enforcer applies
+-- both limits on a schedule, so lowering them no longer waits for hosts to report again.
+
+ALTER TABLE org_host_report_retention
+    ADD COLUMN IF NOT EXISTS delete_hosts_unseen_days INTEGER NOT NULL DEFAULT 0
+    CHECK (delete_hosts_unseen_days >= 0);
@@ -0,0 +1,15 @@
+-- Migration: Track scheduled background jobs
+-- Each replica runs the scheduled jobs (stale hosts, retention, expired API keys), taking
+-- an advisory lock for every run so only one replica runs a job at a time. The last run
+-- of each job is recorded here, whichever replica ran it, for GET /api/v1/admin/jobs.
+
+CREATE TABLE IF NOT EXISTS background_jobs (
+    name TEXT PRIMARY KEY,
+    last_runner TEXT NOT NULL DEFAULT '',
+    last_started_at TIMESTAMPTZ,
+    last_finished_at TIMESTAMPTZ,
+    last_success_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    runs BIGINT NOT NULL DEFAULT 0,
+    failures BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,27 @@
+-- Rollback migration: Keep host report history in a single table
+
+ALTER TABLE host_reports RENAME TO host_reports_partitioned;
+ALTER INDEX idx_host_reports_host_received RENAME TO idx_host_reports_partitioned_host_received;
+ALTER INDEX host_reports_pkey RENAME TO host_reports_partitioned_pkey;
+
+CREATE TABLE host_reports (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL,
+    host_id UUID NOT NULL,
+    hostname TEXT NOT NULL,
+    collection_id TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ,
+    snail_version TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMPTZ NOT NULL,
+    data JSONB NOT NULL,
+    errors TEXT[] NOT NULL DEFAULT '{}',
+    health JSONB,
+    uploaded_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_reports_host_received ON host_reports(org_id, host_id, received_at DESC);
+
+INSERT INTO host_reports SELECT * FROM host_reports_partitioned;
+
+DROP TABLE host_reports_partitioned;
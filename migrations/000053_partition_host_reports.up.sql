@@ -0,0 +1,55 @@
+-- Migration: Partition host report history by month
+-- host_reports is range-partitioned on received_at, one partition per calendar month
+-- (UTC) named host_reports_pYYYYMM. The host-report-partitions job creates the current
+-- and next month's partitions ahead of time and drops whole months past
+-- HOST_REPORT_MAX_AGE, so old history is removed without a large DELETE. Reports received
+-- in a month without a partition land in host_reports_default until the job creates it.
+-- Partitions for the months holding existing reports are created here.
+
+ALTER TABLE host_reports RENAME TO host_reports_unpartitioned;
+ALTER INDEX host_reports_pkey RENAME TO host_reports_unpartitioned_pkey;
+ALTER INDEX idx_host_reports_host_received RENAME TO idx_host_reports_unpartitioned_host_received;
+
+-- The primary key of a partitioned table must include the partition key
+CREATE TABLE host_reports (
+    id UUID NOT NULL,
+    org_id UUID NOT NULL,
+    host_id UUID NOT NULL,
+    hostname TEXT NOT NULL,
+    collection_id TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ,
+    snail_version TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMPTZ NOT NULL,
+    data JSONB NOT NULL,
+    errors TEXT[] NOT NULL DEFAULT '{}',
+    health JSONB,
+    uploaded_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    PRIMARY KEY (id, received_at),
+    FOREIGN KEY (org_id, host_id) REFERENCES hosts(org_id, host_id) ON DELETE CASCADE
+) PARTITION BY RANGE (received_at);
+
+CREATE INDEX IF NOT EXISTS idx_host_reports_host_received ON host_reports(org_id, host_id, received_at DESC);
+
+CREATE TABLE host_reports_default PARTITION OF host_reports DEFAULT;
+
+DO $$
+DECLARE
+    month TIMESTAMP;
+BEGIN
+    FOR month IN
+        SELECT generate_series(
+            COALESCE(date_trunc('month', MIN(received_at) AT TIME ZONE 'UTC'), date_trunc('month', NOW() AT TIME ZONE 'UTC')),
+            date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '1 month',
+            INTERVAL '1 month')
+        FROM host_reports_unpartitioned
+    LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF host_reports FOR VALUES FROM (%L) TO (%L)',
+            'host_reports_p' || to_char(month, 'YYYYMM'),
+            (month AT TIME ZONE 'UTC'),
+            ((month + INTERVAL '1 month') AT TIME ZONE 'UTC'));
+    END LOOP;
+END $$;
+
+INSERT INTO host_reports SELECT * FROM host_reports_unpartitioned;
+
+DROP TABLE host_reports_unpartitioned;
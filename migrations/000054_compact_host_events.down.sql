@@ -0,0 +1,5 @@
+-- Rollback migration: Stop compacting host report snapshots
+-- Report data already compacted is not brought back
+
+DROP INDEX IF EXISTS idx_host_events_deleted_created_at;
+DROP FUNCTION IF EXISTS host_event_report_data(JSONB);
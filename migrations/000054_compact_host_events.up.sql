@@ -0,0 +1,26 @@
+-- Migration: Compact superseded report snapshots in host_events
+-- ingested, updated, and restored events carry the full report, so the hosts projection
+-- can be rebuilt and a deleted host restored. Only a host's last snapshot is needed for
+-- that; earlier ones keep the report's metadata and the OS name and version the fleet
+-- comparison reads, and drop the rest of the report data. New snapshots compact the
+-- previous one as they are appended.
+
+CREATE OR REPLACE FUNCTION host_event_report_data(p_data JSONB) RETURNS JSONB AS $$
+    SELECT jsonb_build_object('system', jsonb_build_object('os', jsonb_strip_nulls(jsonb_build_object(
+        'name', p_data->'system'->'os'->'name',
+        'version', p_data->'system'->'os'->'version'
+    ))));
+$$ LANGUAGE sql IMMUTABLE;
+
+UPDATE host_events e
+SET payload = jsonb_set(e.payload, '{report,data}', host_event_report_data(e.payload->'report'->'data'))
+WHERE e.event_type IN ('ingested', 'updated', 'restored')
+    AND e.payload->'report' ? 'data'
+    AND EXISTS (
+        SELECT 1 FROM host_events later
+        WHERE later.host_id = e.host_id AND later.org_id = e.org_id AND later.id > e.id
+            AND later.event_type IN ('ingested', 'updated', 'restored')
+    );
+
+-- Hosts deleted before HOST_REPORT_MAX_AGE are found by the time of their deletion
+CREATE INDEX IF NOT EXISTS idx_host_events_deleted_created_at ON host_events(created_at) WHERE event_type = 'deleted';